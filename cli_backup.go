@@ -0,0 +1,124 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+
+	"execp2p/internal/app"
+	"execp2p/internal/backup"
+	"execp2p/internal/keystore"
+	"execp2p/internal/timefmt"
+
+	"github.com/spf13/cobra"
+)
+
+var (
+	backupOverwriteFlag bool
+
+	backupCmd = &cobra.Command{
+		Use:   "backup",
+		Short: "Create or restore an encrypted backup of the application state",
+	}
+
+	backupCreateCmd = &cobra.Command{
+		Use:   "create <file>",
+		Short: "Write identity, trust data, rooms and settings to an encrypted archive",
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return runBackupCreate(args[0])
+		},
+	}
+
+	backupRestoreCmd = &cobra.Command{
+		Use:   "restore <file>",
+		Short: "Restore the application state from an encrypted archive",
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return runBackupRestore(args[0])
+		},
+	}
+)
+
+func init() {
+	backupRestoreCmd.Flags().BoolVar(&backupOverwriteFlag, "overwrite", false, "Replace existing state in the data directory")
+	backupCmd.AddCommand(backupCreateCmd, backupRestoreCmd)
+	rootCmd.AddCommand(backupCmd)
+}
+
+func runBackupCreate(file string) error {
+	cfg := loadConfig()
+	dir, err := app.DataDir(cfg)
+	if err != nil {
+		return err
+	}
+
+	keys, err := unlockIdentity(cfg)
+	if err != nil && !errors.Is(err, keystore.ErrNotFound) {
+		return fmt.Errorf("failed to unlock identity: %w", err)
+	}
+
+	passphrase, err := readPassphrase("EXECP2P_BACKUP_PASSPHRASE", "Backup passphrase", true)
+	if err != nil {
+		return err
+	}
+
+	data, err := backup.Create(dir, keys, version, passphrase)
+	if err != nil {
+		return fmt.Errorf("failed to create backup: %w", err)
+	}
+	if err := os.WriteFile(file, data, 0o600); err != nil {
+		return fmt.Errorf("failed to write backup: %w", err)
+	}
+
+	fmt.Printf("Backup written to %s (identity included: %t)\n", file, keys != nil)
+	return nil
+}
+
+func runBackupRestore(file string) error {
+	cfg := loadConfig()
+	dir, err := app.DataDir(cfg)
+	if err != nil {
+		return err
+	}
+
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return fmt.Errorf("failed to read backup: %w", err)
+	}
+	passphrase, err := readPassphrase("EXECP2P_BACKUP_PASSPHRASE", "Backup passphrase", false)
+	if err != nil {
+		return err
+	}
+
+	archive, err := backup.Open(data, passphrase)
+	if err != nil {
+		return fmt.Errorf("failed to open backup: %w", err)
+	}
+	if err := archive.Restore(dir, backupOverwriteFlag); err != nil {
+		return err
+	}
+
+	protection := ""
+	if archive.Identity != nil {
+		if err := ensureKeystorePassphrase(cfg); err != nil {
+			return err
+		}
+		// a linked device's backup brings back the primary's key with its files
+		primary, err := app.LinkedPrimaryKey(cfg)
+		if err != nil {
+			return err
+		}
+		protection, err = app.StoreIdentityKeys(cfg, archive.Identity, primary)
+		if err != nil {
+			return fmt.Errorf("failed to restore identity: %w", err)
+		}
+	}
+
+	fmt.Printf("Restored %d file(s) from backup created %s into %s\n",
+		len(archive.Files), timefmt.Default().DateTime(archive.Manifest.CreatedAt), dir)
+	if protection != "" {
+		fmt.Printf("Identity restored (keystore protection: %s)\n", protection)
+	}
+	return nil
+}
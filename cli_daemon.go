@@ -0,0 +1,141 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"syscall"
+
+	"execp2p/internal/app"
+	"execp2p/internal/config"
+	"execp2p/internal/control"
+	"execp2p/internal/logger"
+
+	"github.com/spf13/cobra"
+)
+
+var (
+	daemonSocketFlag    string
+	daemonListenFlag    string
+	daemonTokenFileFlag string
+	daemonMetricsFlag   string
+
+	daemonCmd = &cobra.Command{
+		Use:   "daemon",
+		Short: "Run the backend without a UI, driven by other programs through a local API",
+		Long: `Run the backend without a UI. Other programs drive it through a REST API
+with a WebSocket event stream (GET /v1/events), served on a unix socket or a
+loopback port. Every request needs "Authorization: Bearer <token>"; the token
+is taken from $EXECP2P_DAEMON_TOKEN or generated and written to the token file.
+With --metrics-listen, counters and gauges are also served in the Prometheus
+text format at /metrics (and as expvar JSON at /debug/vars) on a loopback port.`,
+		Args: cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return runDaemon()
+		},
+	}
+)
+
+func init() {
+	daemonCmd.Flags().StringVar(&daemonSocketFlag, "socket", "", "Unix socket of the control API (default: daemon.sock in the data directory)")
+	daemonCmd.Flags().StringVar(&daemonListenFlag, "listen", "", "Serve the control API on this loopback address instead, e.g. 127.0.0.1:7700")
+	daemonCmd.Flags().StringVar(&daemonTokenFileFlag, "token-file", "", "Where the generated access token is written (default: daemon.token in the data directory)")
+	daemonCmd.Flags().StringVar(&daemonMetricsFlag, "metrics-listen", "", "Serve Prometheus metrics at /metrics on this loopback address, e.g. 127.0.0.1:9477")
+	rootCmd.AddCommand(daemonCmd)
+}
+
+func runDaemon() error {
+	cfg := loadConfig()
+	if err := unlockKeystore(cfg); err != nil {
+		return err
+	}
+	socket, tokenFile, err := daemonPaths(cfg)
+	if err != nil {
+		return err
+	}
+
+	token := os.Getenv("EXECP2P_DAEMON_TOKEN")
+	if token == "" {
+		if token, err = control.NewToken(); err != nil {
+			return err
+		}
+		if err := control.WriteToken(tokenFile, token); err != nil {
+			return err
+		}
+		defer os.Remove(tokenFile)
+	}
+
+	ln, err := control.Listen(socket, daemonListenFlag)
+	if err != nil {
+		return err
+	}
+	if daemonListenFlag == "" {
+		defer os.Remove(socket)
+	}
+	var metricsLn net.Listener
+	if daemonMetricsFlag != "" {
+		if metricsLn, err = control.ListenLoopback(daemonMetricsFlag); err != nil {
+			ln.Close()
+			return err
+		}
+	}
+
+	entApp, err := app.NewExecP2P(cfg)
+	if err != nil {
+		ln.Close()
+		if metricsLn != nil {
+			metricsLn.Close()
+		}
+		return fmt.Errorf("failed to initialize ExecP2P: %w", err)
+	}
+	defer entApp.Close()
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	watchConfig(ctx, entApp)
+
+	ctl := control.New(entApp)
+	go ctl.Run(ctx)
+
+	endpoint := "unix:" + socket
+	if daemonListenFlag != "" {
+		endpoint = "http://" + ln.Addr().String()
+	}
+	fmt.Fprintf(os.Stderr, "ExecP2P daemon listening on %s\n", endpoint)
+	if os.Getenv("EXECP2P_DAEMON_TOKEN") == "" {
+		fmt.Fprintf(os.Stderr, "Access token: %s\n", tokenFile)
+	}
+	if metricsLn != nil {
+		fmt.Fprintf(os.Stderr, "Metrics: http://%s/metrics\n", metricsLn.Addr())
+		go func() {
+			if err := control.ServeMetrics(ctx, metricsLn); err != nil {
+				logger.L().Error("Metrics endpoint failed", "err", err)
+			}
+		}()
+	}
+	return ctl.Serve(ctx, ln, token)
+}
+
+// daemonPaths returns the control socket and token file, by default in the
+// data directory
+func daemonPaths(cfg *config.Config) (socket, tokenFile string, err error) {
+	socket, tokenFile = daemonSocketFlag, daemonTokenFileFlag
+	if socket != "" && tokenFile != "" {
+		return socket, tokenFile, nil
+	}
+	dataDir, err := app.DataDir(cfg)
+	if err != nil {
+		return "", "", err
+	}
+	if socket == "" {
+		socket = filepath.Join(dataDir, "daemon.sock")
+	}
+	if tokenFile == "" {
+		tokenFile = filepath.Join(dataDir, "daemon.token")
+	}
+	return socket, tokenFile, nil
+}
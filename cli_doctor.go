@@ -0,0 +1,116 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/signal"
+	"time"
+
+	"execp2p/internal/doctor"
+
+	"github.com/spf13/cobra"
+)
+
+var (
+	doctorSTUNFlag      []string
+	doctorSignalingFlag string
+	doctorDHTTimeout    time.Duration
+	doctorJSONFlag      bool
+
+	doctorCmd = &cobra.Command{
+		Use:   "doctor",
+		Short: "Check the network and tell which ways of joining a room will work",
+		Long: `Check what the network allows: STUN on every configured server and the NAT
+type, UDP broadcast on the local network, reachability of the DHT bootstrap
+nodes and the signaling server. The report ends with the join strategies that
+can be expected to work. Nothing identifying you or a room is sent.`,
+		Args: cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return runDoctor()
+		},
+	}
+)
+
+func init() {
+	doctorCmd.Flags().StringSliceVar(&doctorSTUNFlag, "stun", nil, "STUN servers (host:port) to check instead of the configured ones")
+	doctorCmd.Flags().StringVar(&doctorSignalingFlag, "signaling-server", "", "URL of the signaling server to check (default: the configured one)")
+	doctorCmd.Flags().DurationVar(&doctorDHTTimeout, "dht-timeout", 15*time.Second, "How long the DHT bootstrap may take")
+	doctorCmd.Flags().BoolVar(&doctorJSONFlag, "json", false, "Print the report as JSON")
+	rootCmd.AddCommand(doctorCmd)
+}
+
+func runDoctor() error {
+	cfg := loadConfig()
+	servers := cfg.Discovery.STUNServers
+	if len(doctorSTUNFlag) > 0 {
+		servers = doctorSTUNFlag
+	}
+	signaling := cfg.Discovery.SignalingServer
+	if doctorSignalingFlag != "" {
+		signaling = doctorSignalingFlag
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+	if !doctorJSONFlag {
+		fmt.Fprintln(os.Stderr, "Checking the network, this takes a few seconds...")
+	}
+	report := doctor.Run(ctx, doctor.Options{
+		STUNServers:     servers,
+		SignalingServer: signaling,
+		DHTTimeout:      doctorDHTTimeout,
+	})
+
+	if doctorJSONFlag {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		return enc.Encode(report)
+	}
+	printDoctorReport(report)
+	return nil
+}
+
+func printDoctorReport(r *doctor.Report) {
+	fmt.Println("STUN")
+	for _, res := range r.STUN.Results {
+		if res.Error != "" {
+			fmt.Printf("  %-8s %s: %s\n", "FAIL", res.Server, res.Error)
+			continue
+		}
+		fmt.Printf("  %-8s %s: %s (%s)\n", "OK", res.Server, res.MappedAddr, res.RTT.Round(time.Millisecond))
+	}
+
+	nat := map[string]string{
+		doctor.NATNone:                "none, you are reachable at " + r.ExternalAddr,
+		doctor.NATEndpointIndependent: "endpoint-independent (cone), seen as " + r.ExternalAddr,
+		doctor.NATSymmetric:           "symmetric, the port changes per destination",
+		doctor.NATUnknown:             "present, type unknown, seen as " + r.ExternalAddr,
+		doctor.NATNoUDP:               "unknown, no STUN server answered",
+	}[r.NAT]
+	fmt.Printf("NAT\n  %s\n", nat)
+
+	for _, c := range []struct {
+		name  string
+		check doctor.Check
+	}{{"UDP broadcast", r.Broadcast}, {"DHT bootstrap", r.DHT}, {"Signaling server", r.Signaling}} {
+		fmt.Printf("%s\n  %-8s %s\n", c.name, checkLabel(c.check), c.check.Detail)
+	}
+
+	fmt.Println("\nJoin strategies")
+	verdicts := map[string]string{doctor.Works: "works", doctor.MayWork: "may work", doctor.WontWork: "won't work"}
+	for _, s := range r.Strategies {
+		fmt.Printf("  %-28s %-11s %s\n", s.Name, verdicts[s.Verdict], s.Reason)
+	}
+}
+
+func checkLabel(c doctor.Check) string {
+	switch {
+	case c.Skipped:
+		return "SKIPPED"
+	case c.OK:
+		return "OK"
+	}
+	return "FAIL"
+}
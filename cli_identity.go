@@ -0,0 +1,159 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+
+	"execp2p/internal/app"
+	"execp2p/internal/keystore"
+	"execp2p/internal/timefmt"
+
+	"github.com/spf13/cobra"
+)
+
+var (
+	identityForceFlag bool
+
+	identityCmd = &cobra.Command{
+		Use:   "identity",
+		Short: "Inspect, export or import the persistent identity",
+	}
+
+	identityShowCmd = &cobra.Command{
+		Use:   "show",
+		Short: "Print the fingerprint of the stored identity",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return runIdentityShow()
+		},
+	}
+
+	identityExportCmd = &cobra.Command{
+		Use:   "export <file>",
+		Short: "Export the identity to a passphrase-encrypted bundle",
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return runIdentityExport(args[0])
+		},
+	}
+
+	identityImportCmd = &cobra.Command{
+		Use:   "import <file>",
+		Short: "Import an identity bundle, replacing the stored identity",
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return runIdentityImport(args[0])
+		},
+	}
+
+	identityAuditCmd = &cobra.Command{
+		Use:   "audit",
+		Short: "Print the security audit log (remote wipes ordered, refused and carried out)",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return runIdentityAudit()
+		},
+	}
+)
+
+func init() {
+	identityImportCmd.Flags().BoolVar(&identityForceFlag, "force", false, "Replace an existing identity")
+	identityCmd.AddCommand(identityShowCmd, identityExportCmd, identityImportCmd, identityAuditCmd)
+	rootCmd.AddCommand(identityCmd)
+}
+
+func runIdentityShow() error {
+	cfg := loadConfig()
+	keys, err := unlockIdentity(cfg)
+	if errors.Is(err, keystore.ErrNotFound) {
+		fmt.Println("No persistent identity yet; one is created on first launch.")
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to unlock identity: %w", err)
+	}
+	fmt.Println(keys.Fingerprint())
+	return nil
+}
+
+func runIdentityExport(file string) error {
+	cfg := loadConfig()
+	keys, err := unlockIdentity(cfg)
+	if err != nil {
+		return fmt.Errorf("failed to unlock identity: %w", err)
+	}
+
+	passphrase, err := readPassphrase("EXECP2P_EXPORT_PASSPHRASE", "Export passphrase", true)
+	if err != nil {
+		return err
+	}
+	primary, err := app.PrimaryKey(cfg)
+	if err != nil {
+		return err
+	}
+	bundle, err := keystore.ExportBundle(keys, primary, passphrase)
+	if err != nil {
+		return err
+	}
+	if err := os.WriteFile(file, bundle, 0o600); err != nil {
+		return fmt.Errorf("failed to write bundle: %w", err)
+	}
+
+	fmt.Printf("Identity %s exported to %s\n", keys.Fingerprint(), file)
+	return nil
+}
+
+func runIdentityImport(file string) error {
+	cfg := loadConfig()
+	dir, err := app.DataDir(cfg)
+	if err != nil {
+		return err
+	}
+	if keystore.New(dir).Exists() && !identityForceFlag {
+		return fmt.Errorf("an identity already exists in %s; use --force to replace it", dir)
+	}
+
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return fmt.Errorf("failed to read bundle: %w", err)
+	}
+	passphrase, err := readPassphrase("EXECP2P_EXPORT_PASSPHRASE", "Export passphrase", false)
+	if err != nil {
+		return err
+	}
+	keys, primary, err := keystore.ImportBundle(data, passphrase)
+	if err != nil {
+		return fmt.Errorf("failed to open bundle: %w", err)
+	}
+
+	if err := ensureKeystorePassphrase(cfg); err != nil {
+		return err
+	}
+	protection, err := app.StoreIdentityKeys(cfg, keys, primary)
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("Identity %s imported (keystore protection: %s)\n", keys.Fingerprint(), protection)
+	return nil
+}
+
+func runIdentityAudit() error {
+	records, err := app.AuditLog(loadConfig())
+	if err != nil {
+		return fmt.Errorf("failed to read the security audit log: %w", err)
+	}
+	if len(records) == 0 {
+		fmt.Println("The security audit log is empty.")
+		return nil
+	}
+	for _, rec := range records {
+		fmt.Printf("%s  %-20s  %s", timefmt.Default().DateTime(rec.Time), rec.Event, rec.PeerID)
+		if rec.Detail != "" {
+			fmt.Printf("  (%s)", rec.Detail)
+		}
+		fmt.Println()
+	}
+	return nil
+}
@@ -0,0 +1,203 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+	"time"
+
+	"execp2p/internal/app"
+	"execp2p/internal/control"
+	"execp2p/internal/network"
+	"execp2p/internal/timefmt"
+
+	"github.com/spf13/cobra"
+	"golang.org/x/term"
+)
+
+// exit codes of join, for scripts
+const (
+	exitAuthFailure      = 3
+	exitDiscoveryFailure = 4
+	exitTransportFailure = 5
+	exitRoomFull         = 6
+	exitIncompatible     = 7
+	exitBanned           = 8
+	exitRemoved          = 9
+	exitRoomClosed       = 10
+)
+
+var (
+	joinTimeoutFlag time.Duration
+
+	joinCmd = &cobra.Command{
+		Use:   "join <room-id> <access-key> [address]",
+		Short: "Join a room and chat on stdin/stdout, without a UI",
+		Long: `Join a room and chat on stdin/stdout: every line read is sent, every message
+received is printed as "<time> <sender>: <text>". Status goes to stderr.
+Without an address the host is looked up (local network, DHT, signaling).
+Type /quit or close stdin to leave.
+
+Exit codes: 3 the access key was refused, 4 the room was not found,
+5 no connection could be made to it, 6 the room is full, 7 the host speaks
+an incompatible protocol version, 8 the host banned us, 9 the host removed
+us, 10 the host closed the room.`,
+		Args: cobra.RangeArgs(2, 3),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			var addr string
+			if len(args) == 3 {
+				addr = args[2]
+			}
+			return runJoin(args[0], args[1], addr)
+		},
+	}
+)
+
+func init() {
+	joinCmd.Flags().DurationVar(&joinTimeoutFlag, "timeout", time.Minute, "How long to wait for the secure channel once the host was reached")
+	rootCmd.AddCommand(joinCmd)
+}
+
+func runJoin(roomID, accessKey, addr string) error {
+	cfg := loadConfig()
+	// stdin carries the chat, so a passphrase can only be asked for on a
+	// terminal; scripts set $EXECP2P_KEYSTORE_PASSPHRASE
+	if term.IsTerminal(int(os.Stdin.Fd())) {
+		if err := unlockKeystore(cfg); err != nil {
+			return err
+		}
+	}
+
+	entApp, err := app.NewExecP2P(cfg)
+	if err != nil {
+		return fmt.Errorf("failed to initialize ExecP2P: %w", err)
+	}
+	defer entApp.Close()
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	watchConfig(ctx, entApp)
+
+	ctl := control.New(entApp)
+	go ctl.Run(ctx)
+
+	fmt.Fprintf(os.Stderr, "Joining room %s...\n", roomID)
+	if err := joinAndWait(ctx, entApp, roomID, addr, accessKey); err != nil {
+		return joinExitError(err)
+	}
+	fmt.Fprintln(os.Stderr, "Connected. Type /quit to leave.")
+
+	events, unsubscribe := ctl.Events(0)
+	defer func() { unsubscribe() }()
+	lines := readLines(ctx)
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case line, ok := <-lines:
+			if !ok || line == "/quit" {
+				return nil
+			}
+			if line == "" {
+				continue
+			}
+			params, _ := json.Marshal(map[string]string{"text": line})
+			if _, err := ctl.Call(ctx, "send", params); err != nil {
+				fmt.Fprintln(os.Stderr, "Failed to send:", err)
+			}
+		case ev, ok := <-events:
+			if !ok {
+				// fell behind; what was missed is in the history
+				fmt.Fprintln(os.Stderr, "Some messages were missed")
+				events, unsubscribe = ctl.Events(0)
+				continue
+			}
+			printEvent(ev)
+		}
+	}
+}
+
+// joinAndWait joins the room and waits until the access key was accepted.
+// The connection lives as long as ctx, so only the wait is bounded.
+func joinAndWait(ctx context.Context, e *app.ExecP2P, roomID, addr, accessKey string) error {
+	if err := e.JoinRoom(ctx, roomID, addr, accessKey); err != nil {
+		return err
+	}
+	waitCtx, cancel := context.WithTimeout(ctx, joinTimeoutFlag)
+	defer cancel()
+	if err := e.WaitForPeer(waitCtx); err != nil {
+		if errors.Is(err, context.DeadlineExceeded) {
+			return fmt.Errorf("%w: no secure channel with the room after %s", app.ErrTransport, joinTimeoutFlag)
+		}
+		return err
+	}
+	return nil
+}
+
+// joinExitError gives a join failure the exit code of its class
+func joinExitError(err error) error {
+	switch {
+	case errors.Is(err, network.ErrAccessDenied):
+		return &exitError{code: exitAuthFailure, err: err}
+	case errors.Is(err, network.ErrRoomFull):
+		return &exitError{code: exitRoomFull, err: err}
+	case errors.Is(err, network.ErrIncompatibleVersion):
+		return &exitError{code: exitIncompatible, err: err}
+	case errors.Is(err, network.ErrBanned):
+		return &exitError{code: exitBanned, err: err}
+	case errors.Is(err, network.ErrRemoved):
+		return &exitError{code: exitRemoved, err: err}
+	case errors.Is(err, network.ErrRoomClosed):
+		return &exitError{code: exitRoomClosed, err: err}
+	case errors.Is(err, app.ErrDiscovery):
+		return &exitError{code: exitDiscoveryFailure, err: err}
+	case errors.Is(err, app.ErrTransport):
+		return &exitError{code: exitTransportFailure, err: err}
+	}
+	return err
+}
+
+// readLines delivers stdin line by line; the channel is closed at EOF
+func readLines(ctx context.Context) <-chan string {
+	lines := make(chan string)
+	go func() {
+		defer close(lines)
+		scanner := bufio.NewScanner(os.Stdin)
+		for scanner.Scan() {
+			select {
+			case lines <- strings.TrimSpace(scanner.Text()):
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+	return lines
+}
+
+// printEvent writes messages to stdout and membership changes to stderr
+func printEvent(ev control.Event) {
+	switch data := ev.Data.(type) {
+	case control.Message:
+		text := data.Text
+		if data.Type != "text" {
+			text = fmt.Sprintf("[%s] %s", data.Type, data.Text)
+		}
+		fmt.Printf("%s %s: %s\n", timefmt.Default().Format(data.Timestamp).Time, data.SenderName, text)
+	case []control.Peer:
+		names := make([]string, 0, len(data))
+		for _, p := range data {
+			if p.Local {
+				continue
+			}
+			names = append(names, p.Name)
+		}
+		fmt.Fprintf(os.Stderr, "In the room: %s\n", strings.Join(names, ", "))
+	}
+}
@@ -0,0 +1,104 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+
+	"execp2p/internal/app"
+	"execp2p/internal/config"
+	"execp2p/internal/crypto"
+	"execp2p/internal/keystore"
+
+	"golang.org/x/term"
+)
+
+// readPassphrase returns the passphrase from envVar or, if unset, prompts for
+// it on the terminal. With confirm the user has to type it twice.
+func readPassphrase(envVar, prompt string, confirm bool) ([]byte, error) {
+	if v := os.Getenv(envVar); v != "" {
+		return []byte(v), nil
+	}
+
+	first, err := promptSecret(prompt)
+	if err != nil {
+		return nil, err
+	}
+	if len(first) == 0 {
+		return nil, fmt.Errorf("empty passphrase")
+	}
+	if confirm {
+		second, err := promptSecret("Repeat " + strings.ToLower(prompt[:1]) + prompt[1:])
+		if err != nil {
+			return nil, err
+		}
+		if string(first) != string(second) {
+			return nil, fmt.Errorf("passphrases do not match")
+		}
+	}
+	return first, nil
+}
+
+func promptSecret(prompt string) ([]byte, error) {
+	fmt.Fprint(os.Stderr, prompt+": ")
+	defer fmt.Fprintln(os.Stderr)
+
+	fd := int(os.Stdin.Fd())
+	if term.IsTerminal(fd) {
+		return term.ReadPassword(fd)
+	}
+	// not a terminal (piped input) - read a single line
+	line, err := bufio.NewReader(os.Stdin).ReadString('\n')
+	if err != nil && line == "" {
+		return nil, fmt.Errorf("failed to read passphrase: %w", err)
+	}
+	return []byte(strings.TrimRight(line, "\r\n")), nil
+}
+
+// unlockIdentity loads the stored identity keys, prompting for the keystore
+// passphrase when the keystore needs one and none was provided
+func unlockIdentity(cfg *config.Config) (*crypto.IdentityKeys, error) {
+	keys, err := app.LoadIdentityKeys(cfg)
+	if errors.Is(err, keystore.ErrPassphraseMissing) {
+		passphrase, perr := readPassphrase("EXECP2P_KEYSTORE_PASSPHRASE", "Keystore passphrase", false)
+		if perr != nil {
+			return nil, perr
+		}
+		cfg.Identity.Passphrase = string(passphrase)
+		keys, err = app.LoadIdentityKeys(cfg)
+	}
+	return keys, err
+}
+
+// ensureKeystorePassphrase prompts for a new keystore passphrase when the
+// identity is going to be sealed with passphrase protection
+func ensureKeystorePassphrase(cfg *config.Config) error {
+	if cfg.Identity.Passphrase != "" {
+		return nil
+	}
+	if cfg.Identity.KeystoreProtection == keystore.ProtectionKeychain && keystore.KeychainAvailable() {
+		return nil
+	}
+	passphrase, err := readPassphrase("EXECP2P_KEYSTORE_PASSPHRASE", "New keystore passphrase", true)
+	if err != nil {
+		return err
+	}
+	cfg.Identity.Passphrase = string(passphrase)
+	return nil
+}
+
+// unlockKeystore asks for the keystore passphrase, before a command without
+// a GUI starts, when the identity needs one: an SSH session or a service
+// usually has no OS keychain
+func unlockKeystore(cfg *config.Config) error {
+	if cfg.Identity.Ephemeral {
+		return nil
+	}
+	_, err := unlockIdentity(cfg)
+	if errors.Is(err, keystore.ErrNotFound) {
+		return ensureKeystorePassphrase(cfg)
+	}
+	return err
+}
@@ -0,0 +1,171 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+	"time"
+
+	"execp2p/internal/app"
+	"execp2p/internal/control"
+	"execp2p/internal/irc"
+	"execp2p/internal/logger"
+
+	"github.com/spf13/cobra"
+	"golang.org/x/term"
+)
+
+// lines of one room message said on IRC; the rest is summarised, so a
+// paste doesn't flood the channel
+const relayMaxLines = 8
+
+var (
+	relayIRCServerFlag  string
+	relayIRCChannelFlag string
+	relayIRCNickFlag    string
+	relayIRCTLSFlag     bool
+
+	relayCmd = &cobra.Command{
+		Use:   "relay <room-id> <access-key> [address]",
+		Short: "Join a room and an IRC channel and mirror messages both ways",
+		Long: `Join a room and an IRC channel and mirror messages both ways, each prefixed
+with the nickname of its sender: "<nick> text". Meant for communities moving
+to ExecP2P while part of them is still on IRC.
+
+The relay says decrypted room messages in the IRC channel, in the clear for
+the IRC network and everyone in the channel; tell the room before running
+it. The server password, if any, comes from $EXECP2P_IRC_PASSWORD.
+Without a nickname configured the relay is called "IRC" in the room.
+
+Exit codes are those of join.`,
+		Args: cobra.RangeArgs(2, 3),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			var addr string
+			if len(args) == 3 {
+				addr = args[2]
+			}
+			return runRelay(args[0], args[1], addr)
+		},
+	}
+)
+
+func init() {
+	relayCmd.Flags().StringVar(&relayIRCServerFlag, "irc-server", "", "IRC server as host:port, e.g. irc.libera.chat:6697")
+	relayCmd.Flags().StringVar(&relayIRCChannelFlag, "irc-channel", "", "IRC channel to mirror, e.g. #execp2p")
+	relayCmd.Flags().StringVar(&relayIRCNickFlag, "irc-nick", "execp2p-relay", "Nickname of the relay on IRC")
+	relayCmd.Flags().BoolVar(&relayIRCTLSFlag, "irc-tls", true, "Connect to the IRC server over TLS")
+	relayCmd.Flags().DurationVar(&joinTimeoutFlag, "timeout", time.Minute, "How long to wait for the secure channel once the host was reached")
+	relayCmd.MarkFlagRequired("irc-server")
+	relayCmd.MarkFlagRequired("irc-channel")
+	rootCmd.AddCommand(relayCmd)
+}
+
+func runRelay(roomID, accessKey, addr string) error {
+	cfg := loadConfig()
+	if cfg.Room.Nickname == "" {
+		cfg.Room.Nickname = "IRC"
+	}
+	if term.IsTerminal(int(os.Stdin.Fd())) {
+		if err := unlockKeystore(cfg); err != nil {
+			return err
+		}
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	// IRC first: it is the cheaper of the two to get wrong
+	fmt.Fprintf(os.Stderr, "Connecting to %s on %s...\n", relayIRCChannelFlag, relayIRCServerFlag)
+	client, err := irc.Dial(ctx, irc.Options{
+		Server:   relayIRCServerFlag,
+		TLS:      relayIRCTLSFlag,
+		Nick:     relayIRCNickFlag,
+		Channel:  relayIRCChannelFlag,
+		Password: os.Getenv("EXECP2P_IRC_PASSWORD"),
+	})
+	if err != nil {
+		return err
+	}
+	defer client.Close()
+
+	entApp, err := app.NewExecP2P(cfg)
+	if err != nil {
+		return fmt.Errorf("failed to initialize ExecP2P: %w", err)
+	}
+	defer entApp.Close()
+
+	watchConfig(ctx, entApp)
+
+	ctl := control.New(entApp)
+	go ctl.Run(ctx)
+
+	fmt.Fprintf(os.Stderr, "Joining room %s...\n", roomID)
+	if err := joinAndWait(ctx, entApp, roomID, addr, accessKey); err != nil {
+		return joinExitError(err)
+	}
+	fmt.Fprintf(os.Stderr, "Relaying between the room and %s. Press Ctrl+C to stop.\n", relayIRCChannelFlag)
+	logger.L().Warn("Room messages are said in an IRC channel", "channel", relayIRCChannelFlag, "server", relayIRCServerFlag)
+
+	events, unsubscribe := ctl.Events(0)
+	defer func() { unsubscribe() }()
+	said := client.Messages()
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case m, ok := <-said:
+			if !ok {
+				return nil
+			}
+			text := "<" + m.Nick + "> " + m.Text
+			if m.Action {
+				text = "* " + m.Nick + " " + m.Text
+			}
+			params, _ := json.Marshal(map[string]string{"text": text})
+			if _, err := ctl.Call(ctx, "send", params); err != nil {
+				fmt.Fprintln(os.Stderr, "Failed to send to the room:", err)
+			}
+		case ev, ok := <-events:
+			if !ok {
+				fmt.Fprintln(os.Stderr, "Some messages were missed")
+				events, unsubscribe = ctl.Events(0)
+				continue
+			}
+			msg, ok := ev.Data.(control.Message)
+			if !ok {
+				continue
+			}
+			if err := client.Say(relayText(msg)); err != nil {
+				fmt.Fprintln(os.Stderr, "Failed to send to IRC:", err)
+			}
+		}
+	}
+}
+
+// relayText is a room message as said on IRC: every line prefixed with the
+// sender, at most relayMaxLines of them
+func relayText(msg control.Message) string {
+	text := msg.Text
+	if msg.Type != "text" {
+		text = fmt.Sprintf("[%s] %s", msg.Type, msg.Text)
+	}
+	var lines []string
+	for _, line := range strings.Split(text, "\n") {
+		if strings.TrimSpace(line) != "" {
+			lines = append(lines, line)
+		}
+	}
+	if len(lines) > relayMaxLines {
+		more := len(lines) - relayMaxLines + 1
+		lines = append(lines[:relayMaxLines-1], fmt.Sprintf("(… %d more lines)", more))
+	}
+	prefix := "<" + msg.SenderName + "> "
+	for i := range lines {
+		lines[i] = prefix + lines[i]
+	}
+	return strings.Join(lines, "\n")
+}
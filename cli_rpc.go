@@ -0,0 +1,42 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/signal"
+	"syscall"
+
+	"execp2p/internal/app"
+	"execp2p/internal/control"
+
+	"golang.org/x/term"
+)
+
+// runRPCStdio drives the backend with JSON-RPC requests read from stdin;
+// responses and events are written to stdout
+func runRPCStdio() error {
+	cfg := loadConfig()
+	// stdin carries requests, so a passphrase can only be asked for on a
+	// terminal; scripts set $EXECP2P_KEYSTORE_PASSPHRASE
+	if term.IsTerminal(int(os.Stdin.Fd())) {
+		if err := unlockKeystore(cfg); err != nil {
+			return err
+		}
+	}
+
+	entApp, err := app.NewExecP2P(cfg)
+	if err != nil {
+		return fmt.Errorf("failed to initialize ExecP2P: %w", err)
+	}
+	defer entApp.Close()
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	watchConfig(ctx, entApp)
+
+	ctl := control.New(entApp)
+	go ctl.Run(ctx)
+	return ctl.ServeStdio(ctx, os.Stdin, os.Stdout)
+}
@@ -0,0 +1,149 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"execp2p/internal/app"
+	"execp2p/internal/control"
+
+	"github.com/spf13/cobra"
+)
+
+var (
+	statusJSONFlag bool
+
+	statusCmd = &cobra.Command{
+		Use:   "status",
+		Short: "Show the room, peers, NAT and transport of a running daemon",
+		Long: `Ask a running "execp2p daemon" through its control API about the room, the
+peers and their verification state, the NAT and the transport. The token is
+read from $EXECP2P_DAEMON_TOKEN or the daemon's token file.`,
+		Args: cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return runStatus()
+		},
+	}
+)
+
+func init() {
+	statusCmd.Flags().StringVar(&daemonSocketFlag, "socket", "", "Unix socket of the daemon (default: daemon.sock in the data directory)")
+	statusCmd.Flags().StringVar(&daemonListenFlag, "listen", "", "Loopback address of the daemon, if it serves on one, e.g. 127.0.0.1:7700")
+	statusCmd.Flags().StringVar(&daemonTokenFileFlag, "token-file", "", "Token file written by the daemon (default: daemon.token in the data directory)")
+	statusCmd.Flags().BoolVar(&statusJSONFlag, "json", false, "Print the status as JSON")
+	rootCmd.AddCommand(statusCmd)
+}
+
+// daemonStatus is everything status reports
+type daemonStatus struct {
+	Status control.Status `json:"status"`
+	Peers  []control.Peer `json:"peers"`
+	NAT    app.NATStatus  `json:"nat"`
+}
+
+func runStatus() error {
+	socket, tokenFile, err := daemonPaths(loadConfig())
+	if err != nil {
+		return err
+	}
+	token := os.Getenv("EXECP2P_DAEMON_TOKEN")
+	if token == "" {
+		b, err := os.ReadFile(tokenFile)
+		if err != nil {
+			return fmt.Errorf("no daemon token (is the daemon running?): %w", err)
+		}
+		token = strings.TrimSpace(string(b))
+	}
+
+	client := control.NewClient(socket, daemonListenFlag, token)
+	ctx := context.Background()
+	var s daemonStatus
+	if err := client.Get(ctx, "/v1/status", &s.Status); err != nil {
+		return err
+	}
+	if err := client.Get(ctx, "/v1/peers", &s.Peers); err != nil {
+		return err
+	}
+	if err := client.Get(ctx, "/v1/nat", &s.NAT); err != nil {
+		return err
+	}
+
+	if statusJSONFlag {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		return enc.Encode(s)
+	}
+	printStatus(s)
+	return nil
+}
+
+func printStatus(s daemonStatus) {
+	st := s.Status
+	fmt.Printf("Identity:    %s (%s)\n", st.Nickname, st.PeerID)
+	fmt.Printf("Fingerprint: %s\n", st.Fingerprint)
+
+	if st.RoomID == "" {
+		fmt.Println("Room:        none")
+	} else {
+		role := "joined"
+		if st.Listener {
+			role = fmt.Sprintf("host, port %d", st.ListenPort)
+		}
+		if st.Incognito {
+			role += ", incognito"
+		}
+		fmt.Printf("Room:        %s (%s)\n", st.RoomID, role)
+		encryption := "not established"
+		if st.Encrypted {
+			encryption = "end-to-end"
+		}
+		if st.Degraded {
+			encryption += ", connection degraded"
+		}
+		fmt.Printf("Encryption:  %s\n", encryption)
+	}
+
+	if t := st.Transport; t.Protocol != "" {
+		transport := strings.ToUpper(t.Protocol) + ", " + t.Method
+		if t.RemoteAddr != "" {
+			transport += fmt.Sprintf(", %s -> %s", t.LocalAddr, t.RemoteAddr)
+		}
+		fmt.Printf("Transport:   %s\n", transport)
+	}
+
+	switch nat := s.NAT; {
+	case nat.Error != "":
+		fmt.Printf("NAT:         unknown (%s)\n", nat.Error)
+	case nat.BehindNAT:
+		fmt.Printf("NAT:         behind NAT, seen as %s\n", nat.ExternalAddr)
+	default:
+		fmt.Printf("NAT:         none, reachable at %s\n", nat.ExternalAddr)
+	}
+
+	var peers []control.Peer
+	for _, p := range s.Peers {
+		if !p.Local {
+			peers = append(peers, p)
+		}
+	}
+	fmt.Printf("Peers:       %d\n", len(peers))
+	for _, p := range peers {
+		fmt.Printf("  %s  %s  %s  %s, %s\n", p.Name, p.PeerID, p.Fingerprint, p.Verification, p.Presence)
+		if p.Address != "" {
+			fmt.Printf("    %s via %s, connected %s, last heard %s\n",
+				p.Address, p.Transport, since(p.ConnectedSince), since(p.LastActivity))
+		}
+	}
+}
+
+// since tells how long ago a unix time was, to the second
+func since(unix int64) string {
+	if unix == 0 {
+		return "never"
+	}
+	return time.Since(time.Unix(unix, 0)).Truncate(time.Second).String() + " ago"
+}
@@ -0,0 +1,155 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+
+	"execp2p/internal/app"
+	"execp2p/internal/timefmt"
+	"execp2p/internal/trust"
+
+	"github.com/spf13/cobra"
+)
+
+var (
+	trustCmd = &cobra.Command{
+		Use:   "trust",
+		Short: "Manage pinned peer fingerprints (trust on first use)",
+	}
+
+	trustListCmd = &cobra.Command{
+		Use:   "list",
+		Short: "List pinned peers",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return runTrustList()
+		},
+	}
+
+	trustForgetCmd = &cobra.Command{
+		Use:   "forget <peer-id>",
+		Short: "Remove a pin so the peer's next fingerprint is trusted anew",
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return runTrustForget(args[0])
+		},
+	}
+
+	trustReleaseCmd = &cobra.Command{
+		Use:   "release <peer-id>",
+		Short: "Lift the quarantine of a peer that failed an identity or TLS certificate check",
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			store, err := openTrustStore()
+			if err != nil {
+				return err
+			}
+			if err := store.Release(args[0]); err != nil {
+				return err
+			}
+			fmt.Printf("Released %s\n", args[0])
+			return nil
+		},
+	}
+)
+
+var (
+	trustVerifyCmd = &cobra.Command{
+		Use:   "verify <peer-id> <fingerprint>",
+		Short: "Mark a peer as verified after comparing its fingerprint out of band",
+		Args:  cobra.ExactArgs(2),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return runTrustVerify(args[0], args[1])
+		},
+	}
+
+	trustUnverifyCmd = &cobra.Command{
+		Use:   "unverify <peer-id>",
+		Short: "Withdraw a peer's verification (the pin is kept)",
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			store, err := openTrustStore()
+			if err != nil {
+				return err
+			}
+			return store.ClearVerified(args[0])
+		},
+	}
+)
+
+func init() {
+	trustCmd.AddCommand(trustListCmd, trustForgetCmd, trustReleaseCmd, trustVerifyCmd, trustUnverifyCmd)
+	rootCmd.AddCommand(trustCmd)
+}
+
+func openTrustStore() (*trust.Store, error) {
+	dir, err := app.DataDir(loadConfig())
+	if err != nil {
+		return nil, err
+	}
+	return trust.Open(dir)
+}
+
+func runTrustList() error {
+	store, err := openTrustStore()
+	if err != nil {
+		return err
+	}
+	entries := store.List()
+	f := timefmt.Default()
+	for _, q := range store.QuarantinedPeers() {
+		state := "QUARANTINED"
+		if q.Rejected {
+			state = "REJECTED"
+		}
+		fmt.Printf("%s  %s since %s (%s): expected %s, presented %s\n",
+			q.PeerID, state, f.DateTime(q.Since), q.Reason, q.Expected, q.Presented)
+	}
+	if len(entries) == 0 {
+		fmt.Println("No pinned peers.")
+		return nil
+	}
+	for _, e := range entries {
+		fmt.Printf("%s  %s  first seen %s, last seen %s\n",
+			e.PeerID, e.Fingerprint, f.DateTime(e.FirstSeen), f.DateTime(e.LastSeen))
+		if e.TLSFingerprint != "" {
+			fmt.Printf("    TLS certificate %s\n", e.TLSFingerprint)
+		}
+		if e.Verified() {
+			fmt.Printf("    verified (%s) %s\n", e.VerifiedMethod, f.DateTime(e.VerifiedAt))
+		}
+	}
+	return nil
+}
+
+func runTrustForget(peerID string) error {
+	store, err := openTrustStore()
+	if err != nil {
+		return err
+	}
+	if err := store.Forget(peerID); err != nil {
+		return err
+	}
+	fmt.Printf("Forgot %s\n", peerID)
+	return nil
+}
+
+func runTrustVerify(peerID, fingerprint string) error {
+	store, err := openTrustStore()
+	if err != nil {
+		return err
+	}
+	entry, ok := store.Get(peerID)
+	if !ok {
+		return fmt.Errorf("peer %s is not pinned; connect to it first", peerID)
+	}
+	// the user types what the peer read out; it must match the pin exactly
+	if !strings.EqualFold(strings.ReplaceAll(fingerprint, " ", ""), entry.Fingerprint) {
+		return fmt.Errorf("fingerprint does not match the pinned one (%s); do not trust this peer", entry.Fingerprint)
+	}
+	if err := store.MarkVerified(peerID, entry.Fingerprint, trust.MethodManual); err != nil {
+		return err
+	}
+	fmt.Printf("Verified %s\n", peerID)
+	return nil
+}
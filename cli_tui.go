@@ -0,0 +1,50 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os/signal"
+	"syscall"
+
+	"execp2p/internal/app"
+	"execp2p/internal/logger"
+	"execp2p/internal/tui"
+
+	"github.com/spf13/cobra"
+)
+
+var tuiCmd = &cobra.Command{
+	Use:   "tui",
+	Short: "Chat in the terminal instead of the GUI (rooms, chat and fingerprints; for SSH sessions)",
+	Args:  cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return runTUI()
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(tuiCmd)
+}
+
+func runTUI() error {
+	cfg := loadConfig()
+	// prompts have to come before the screen is taken over
+	if err := unlockKeystore(cfg); err != nil {
+		return err
+	}
+
+	entApp, err := app.NewExecP2P(cfg)
+	if err != nil {
+		return fmt.Errorf("failed to initialize ExecP2P: %w", err)
+	}
+	defer entApp.Close()
+
+	// log lines would tear the screen
+	logger.SetOutput(io.Discard)
+
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGTERM)
+	defer stop()
+	watchConfig(ctx, entApp)
+	return tui.Run(ctx, entApp)
+}
@@ -1,8 +1,11 @@
 import { useState, useEffect } from 'react';
 import { MainLayout } from './components/layout/MainLayout';
-import { ConnectView } from './components/connect/ConnectView';
+import { ConnectView, RoomInvite } from './components/connect/ConnectView';
 import { ChatView } from './components/chat/ChatView';
 import { SettingsView } from './components/settings/SettingsView';
+import { DiagnosticsView } from './components/diagnostics/DiagnosticsView';
+import { SecurityAlert } from './components/security/SecurityAlert';
+import { CrashNotice } from './components/diagnostics/CrashNotice';
 
 // Interfejs do przechowywania stanu aplikacji
 interface AppState {
@@ -11,10 +14,13 @@ interface AppState {
     connected: boolean;
     secure: boolean;
     peerCount: number;
+    degraded?: boolean;
   };
   securityInfo: {
     identityFingerprint?: string;
     roomId?: string;
+    roomName?: string; // Nazwa pokoju nadana przez hosta lub moderatora
+    closesAt?: string; // Kiedy nasz pokój sam się zamknie (RFC 3339)
     listenPort?: number;
     kemAlgo?: string;
     sigAlgo?: string;
@@ -76,6 +82,8 @@ function App() {
             identityFingerprint: fingerprint,
             listenPort: networkStatus.listen_port,
             roomId: networkStatus.room_id || undefined,
+            roomName: networkStatus.room_name || undefined,
+            closesAt: networkStatus.closes_at || undefined,
             peer_id: networkStatus.peer_id || undefined,
             kemAlgo: securitySummary.encryption_algorithms?.key_exchange || 'CRYSTALS-Kyber-1024',
             sigAlgo: securitySummary.encryption_algorithms?.signatures || 'CRYSTALS-DILITHIUM-5',
@@ -109,21 +117,75 @@ function App() {
           connected: status.is_running || false,
           secure: status.e2e_encryption || false,
           peerCount: status.connected_peers || 0,
+          degraded: status.degraded || false,
         },
         securityInfo: {
           ...prev.securityInfo,
           roomId: status.room_id || prev.securityInfo.roomId,
+          roomName: status.room_name || undefined,
+          closesAt: status.closes_at || undefined,
         }
       }));
     });
     
+    // Wybrano inny z naszych pokojów: nowy, przełączony albo następny po
+    // opuszczeniu bieżącego
+    window.runtime.EventsOn('room:selected', () => {
+      handleConnectionSuccess();
+    });
+    
     fetchInitialData();
+
+    // Powrót do pokojów sprzed zamknięcia (room.rejoin); każdy odzyskany
+    // pokój przychodzi jako room:selected
+    window.go.wailsbridge.Bridge.RejoinRooms()
+      .catch((err: unknown) => console.error('Nie udało się wrócić do pokojów:', err));
     
     // Czyszczenie nasłuchiwania przy odmontowywaniu
     return () => {
       window.runtime.EventsOff('message:received');
       window.runtime.EventsOff('status:update');
       window.runtime.EventsOff('view:change');
+      window.runtime.EventsOff('room:selected');
+    };
+  }, []);
+
+  // Zaproszenie z linku execp2p:// (przy starcie albo z kolejnego
+  // uruchomienia) otwiera formularz dołączania
+  const [invite, setInvite] = useState<RoomInvite | null>(null);
+  useEffect(() => {
+    const takeInvite = async () => {
+      try {
+        const pending = await window.go.wailsbridge.Bridge.TakePendingInvite();
+        if (pending) {
+          setInvite(pending as RoomInvite);
+          handleViewChange('connect');
+        }
+      } catch (error) {
+        console.error('Błąd podczas odbierania zaproszenia:', error);
+      }
+    };
+    takeInvite();
+    window.runtime.EventsOn('invite:received', () => takeInvite());
+    return () => {
+      window.runtime.EventsOff('invite:received');
+    };
+  }, []);
+
+  // Powiadomienia systemowe pokazujemy tylko, gdy okno jest w tle
+  useEffect(() => {
+    const report = () => {
+      const focused = document.hasFocus() && document.visibilityState === 'visible';
+      window.go.wailsbridge.Bridge.SetWindowFocused(focused).catch(() => {});
+    };
+    report();
+    window.addEventListener('focus', report);
+    window.addEventListener('blur', report);
+    document.addEventListener('visibilitychange', report);
+    return () => {
+      window.removeEventListener('focus', report);
+      window.removeEventListener('blur', report);
+      document.removeEventListener('visibilitychange', report);
     };
   }, []);
 
@@ -205,12 +267,14 @@ function App() {
   const renderView = () => {
     switch (state.view) {
       case 'connect':
-        return <ConnectView onSuccess={handleConnectionSuccess} />;
+        return <ConnectView onSuccess={handleConnectionSuccess} invite={invite} onInviteHandled={() => setInvite(null)} />;
       case 'chat':
         return <ChatView 
           connected={state.connectionStatus.secure} 
           userID={state.securityInfo.peer_id || ''} 
           roomId={state.securityInfo.roomId}
+          roomName={state.securityInfo.roomName}
+          closesAt={state.securityInfo.closesAt}
           accessKey={state.securityInfo.accessKey}
           isRoomCreator={state.isRoomCreator}
           onRegenerateAccessKey={handleRegenerateAccessKey}
@@ -232,8 +296,10 @@ function App() {
             onRegenerateAccessKey={handleRegenerateAccessKey}
           />
         );
+      case 'diagnostics':
+        return <DiagnosticsView />;
       default:
-        return <ConnectView onSuccess={handleConnectionSuccess} />;
+        return <ConnectView onSuccess={handleConnectionSuccess} invite={invite} onInviteHandled={() => setInvite(null)} />;
     }
   };
 
@@ -244,9 +310,12 @@ function App() {
       connectionStatus={{
         connected: state.connectionStatus.connected,
         secure: state.connectionStatus.secure,
+        degraded: state.connectionStatus.degraded,
       }}
     >
       {renderView()}
+      <SecurityAlert />
+      <CrashNotice />
     </MainLayout>
   );
 }
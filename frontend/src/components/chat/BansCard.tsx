@@ -0,0 +1,102 @@
+import React, { useEffect, useState } from "react";
+import { cn } from "@/lib/utils";
+import { Card, CardHeader, CardTitle, CardContent } from "@/components/ui/card";
+import { Button } from "@/components/ui/button";
+import { Input } from "@/components/ui/input";
+import { Ban as BanIcon, Plus, Trash2 } from "lucide-react";
+
+// Tożsamość zablokowana w pokoju przez hosta
+export interface Ban {
+  fingerprint: string;
+  nickname?: string;
+  reason?: string;
+  banned_at: number;
+}
+
+interface BansCardProps {
+  roomId?: string;
+  className?: string;
+}
+
+// Lista blokad pokoju, widoczna tylko u hosta
+export function BansCard({ roomId, className }: BansCardProps) {
+  const [bans, setBans] = useState<Ban[]>([]);
+  const [fingerprint, setFingerprint] = useState("");
+  const [error, setError] = useState("");
+
+  useEffect(() => {
+    const load = () => {
+      window.go.wailsbridge.Bridge.GetBans()
+        .then((list: Ban[]) => setBans(list || []))
+        .catch((err: unknown) => console.error("Nie udało się pobrać blokad:", err));
+    };
+    load();
+    window.runtime.EventsOn("room:banned", load);
+    return () => {
+      window.runtime.EventsOff("room:banned");
+    };
+  }, [roomId]);
+
+  const addBan = () => {
+    setError("");
+    window.go.wailsbridge.Bridge.BanFingerprint(fingerprint, "")
+      .then(() => setFingerprint(""))
+      .catch((err: unknown) => setError(String(err)));
+  };
+
+  const removeBan = (ban: Ban) => {
+    window.go.wailsbridge.Bridge.UnbanFingerprint(ban.fingerprint)
+      .catch((err: unknown) => setError(String(err)));
+  };
+
+  return (
+    <Card className={cn("mt-4 bg-gray-900/60 border-gray-800", className)}>
+      <CardHeader className="pb-2">
+        <CardTitle className="text-sm flex items-center gap-2">
+          <BanIcon className="h-4 w-4" />
+          Zablokowani
+        </CardTitle>
+      </CardHeader>
+      <CardContent className="space-y-2 text-xs">
+        {bans.length === 0 && (
+          <p className="text-gray-500">Nikt nie jest zablokowany.</p>
+        )}
+        {bans.map((ban) => (
+          <div key={ban.fingerprint} className="flex items-center gap-2">
+            <span className="flex-1 flex flex-col">
+              <span className="text-gray-300">{ban.nickname || "Nieznany"}</span>
+              <span className="font-mono text-gray-500" title={ban.reason}>{ban.fingerprint}</span>
+            </span>
+            <Button
+              variant="ghost"
+              size="sm"
+              className="h-6 w-6 p-0 text-gray-400 hover:text-red-400"
+              onClick={() => removeBan(ban)}
+              title="Zdejmij blokadę"
+            >
+              <Trash2 className="h-3 w-3" />
+            </Button>
+          </div>
+        ))}
+        <div className="flex gap-2 pt-1">
+          <Input
+            value={fingerprint}
+            onChange={(e) => setFingerprint(e.target.value)}
+            placeholder="odcisk tożsamości"
+            className="h-7 text-xs font-mono"
+          />
+          <Button
+            size="sm"
+            className="h-7 px-2"
+            disabled={fingerprint.trim() === ""}
+            onClick={addBan}
+            title="Zablokuj tożsamość"
+          >
+            <Plus className="h-3 w-3" />
+          </Button>
+        </div>
+        {error && <p className="text-red-400">{error}</p>}
+      </CardContent>
+    </Card>
+  );
+}
@@ -4,6 +4,13 @@ import { Input } from "@/components/ui/input";
 import { cn } from "@/lib/utils";
 import { UserListTable, type ChatUser } from "./UserListTable";
 import { RoomInfoTable } from "./RoomInfoTable";
+import { ShortcodesCard, renderShortcodes, type RoomShortcode } from "./ShortcodesCard";
+import { BansCard } from "./BansCard";
+import { SearchCard } from "./SearchCard";
+import { RoomsCard } from "./RoomsCard";
+import { VoiceMessage } from "./VoiceMessage";
+import { FileMessage } from "./FileMessage";
+import { OnFileDrop, OnFileDropOff } from "../../../wailsjs/runtime/runtime";
 import { Send, User, MessageSquare, AlertTriangle, Image, Mic, StopCircle, File } from "lucide-react";
 import { Card, CardContent, CardHeader, CardTitle } from "@/components/ui/card";
 
@@ -12,17 +19,75 @@ type Message = {
   sender: string;
   content: string;
   timestamp: string;
+  timeFormatted?: string; // Czas sformatowany przez back-end (język i strefa z ustawień)
   isLocal: boolean;
   verified: boolean;
-  type?: "text" | "image" | "audio" | "gif"; // Typ wiadomości
+  type?: "text" | "image" | "audio" | "gif" | "file"; // Typ wiadomości
   mediaUrl?: string; // URL do pliku multimedialnego (zdjęcie, audio, gif)
-  status?: "sent" | "pending" | "error"; // Status wysłania wiadomości
+  thumbnailUrl?: string; // Miniatura zdjęcia (kliknięcie pokazuje mediaUrl)
+  originalId?: string; // Oryginał w pełnej rozdzielczości, do pobrania od nadawcy
+  mediaId?: string; // Identyfikator multimediów w back-endzie
+  waveform?: number[]; // Przebieg głośności nagrania (0-255)
+  durationMs?: number; // Długość nagrania
+  size?: number; // Rozmiar pliku w bajtach
+  progress?: number; // Postęp wysyłania pliku (0-1)
+  status?: "sent" | "pending" | "error" | "canceled"; // Status wysłania wiadomości
+};
+
+// Transfer z zdarzeń transfer:progress i transfer:complete
+type TransferEvent = {
+  id: string;
+  kind: "file" | "media" | "history";
+  direction: "send" | "receive";
+  name: string;
+  bytes: number;
+  total: number;
+  canceled?: boolean;
+  error?: string;
+};
+
+// Błąd sieci z network:error (network.ErrorCode w back-endzie)
+type NetworkError = {
+  code: "auth" | "transport" | "protocol" | "room_mismatch" | "version" | "closed" | "unknown";
+  reason?: string; // powód zamknięcia połączenia przez drugą stronę
+  message: string;
+  retryable: boolean;
+};
+
+// Komunikat dla użytkownika; zamknięcia połączenia opisuje już peer:disconnected
+function networkErrorText(err: NetworkError): string | null {
+  switch (err.code) {
+    case "auth":
+      return "Uwierzytelnienie nie powiodło się: nieprawidłowy klucz dostępu, członkostwo w pokoju albo tożsamość. Sprawdź klucz dostępu i dołącz ponownie.";
+    case "transport":
+      return "Połączenie zostało przerwane. Ponowne łączenie trwa automatycznie.";
+    case "protocol":
+      return "Druga strona wysłała nieprawidłowe dane, połączenie zostało zamknięte.";
+    case "room_mismatch":
+      return "Druga strona jest w innym pokoju. Sprawdź ID pokoju.";
+    case "version":
+      return "Druga strona używa niezgodnej wersji protokołu. Jedna ze stron musi zaktualizować aplikację.";
+    case "closed":
+      return null;
+    default:
+      return `Błąd sieci: ${err.message}`;
+  }
+}
+
+// Niewysłana wiadomość z kolejki pokoju (outbox.Message)
+type QueuedMessage = {
+  id: string;
+  room_id: string;
+  body: string;
+  queued_at: string;
 };
 
 interface ChatViewProps {
   connected?: boolean;
   userID?: string;
   roomId?: string;
+  roomName?: string;
+  closesAt?: string;
   accessKey?: string;
   isRoomCreator?: boolean;
   onRegenerateAccessKey?: () => Promise<string>;
@@ -32,6 +97,8 @@ export function ChatView({
   connected = false, 
   userID = "", 
   roomId, 
+  roomName,
+  closesAt,
   accessKey, 
   isRoomCreator = false,
   onRegenerateAccessKey
@@ -48,29 +115,61 @@ export function ChatView({
     },
   ]);
   const [inputValue, setInputValue] = useState("");
-  const [nickname, setNickname] = useState(() => {
-    // Wczytaj nickname z localStorage przy inicjalizacji
-    const savedNickname = localStorage.getItem("execp2p_nickname");
-    return savedNickname || "Użytkownik";
-  });
-  const [nicknameInput, setNicknameInput] = useState(() => {
-    // Wczytaj nickname z localStorage przy inicjalizacji
-    const savedNickname = localStorage.getItem("execp2p_nickname");
-    return savedNickname || "Użytkownik";
-  });
+  // Nick należy do back-endu (plik konfiguracji), patrz efekt poniżej
+  const [nickname, setNickname] = useState("Użytkownik");
+  const [nicknameInput, setNicknameInput] = useState("Użytkownik");
   const [users, setUsers] = useState<ChatUser[]>([]);
+  // nasze drugie urządzenia w pokoju i czy możemy je czyścić
+  const [ownDevices, setOwnDevices] = useState<string[]>([]);
+  const [primaryDevice, setPrimaryDevice] = useState(false);
   const [userNicknames, setUserNicknames] = useState<Record<string, string>>({});
   const messagesEndRef = useRef<HTMLDivElement>(null);
   const fileInputRef = useRef<HTMLInputElement>(null);
+  // Transfery zakończone, zanim ich wiadomość trafiła na listę
+  const finishedTransfers = useRef(new Map<string, TransferEvent>());
+  const [historyTransfer, setHistoryTransfer] = useState<{ id: string; bytes: number; total: number } | null>(null);
   const [isRecording, setIsRecording] = useState(false);
+  // Nagrywanie i odtwarzanie w back-endzie (ffmpeg), jeśli jest dostępne
+  const [voiceSupport, setVoiceSupport] = useState<{ record: boolean; play: boolean }>({ record: false, play: false });
+  const [playingVoice, setPlayingVoice] = useState("");
   const [mediaRecorder, setMediaRecorder] = useState<MediaRecorder | null>(null);
   const [audioChunks, setAudioChunks] = useState<Blob[]>([]);
+  const [shortcodes, setShortcodes] = useState<RoomShortcode[]>([]);
+  // wiadomości czekające na połączenie (kolejka pokoju w back-endzie)
+  const [queued, setQueued] = useState<QueuedMessage[]>([]);
+  // Nasza dostępność; back-end zmienia online na away po bezczynności
+  const [presence, setPresence] = useState("online");
+  // Kursor starszej strony zapisanej historii ("" = brak starszych wiadomości)
+  const [historyCursor, setHistoryCursor] = useState("");
   
   // Przewijanie do najnowszej wiadomości
   useEffect(() => {
     messagesEndRef.current?.scrollIntoView({ behavior: "smooth" });
   }, [messages]);
   
+  // Nick z back-endu; pseudonim zapisany dawniej w przeglądarce jest
+  // jednorazowo przenoszony do pliku konfiguracji
+  useEffect(() => {
+    const load = async () => {
+      try {
+        const legacy = localStorage.getItem("execp2p_nickname");
+        if (legacy) {
+          const settings = await window.go.wailsbridge.Bridge.GetSettings();
+          if (!settings.room.nickname) {
+            await window.go.wailsbridge.Bridge.UpdateNickname(legacy);
+          }
+          localStorage.removeItem("execp2p_nickname");
+        }
+        const name = await window.go.wailsbridge.Bridge.GetNickname();
+        setNickname(name);
+        setNicknameInput(name);
+      } catch (e) {
+        console.error("Błąd podczas pobierania nicku:", e);
+      }
+    };
+    load();
+  }, []);
+
   // Dodajemy bieżącego użytkownika do listy
   useEffect(() => {
     if (userID) {
@@ -88,37 +187,33 @@ export function ChatView({
   }, [userID, nickname]);
 
   // Obsługa opuszczania pokoju - odinstalowanie eventów i czyszczenie
-  const leaveRoom = () => {
+  const leaveRoom = async () => {
     console.log("Opuszczanie pokoju - rozpoczynam procedurę...");
     
     try {
-      // Natychmiast odinstaluj wszystkie listenery
+      // Back-end żegna się z uczestnikami przed zamknięciem połączenia
+      try {
+        await window.go.wailsbridge.Bridge.CloseConnection();
+        console.log("Połączenie zamknięte");
+      } catch (e) {
+        console.error("Błąd zamykania połączenia:", e);
+      }
+
+      // Jesteśmy jeszcze w innych pokojach: back-end wybrał kolejny
+      // (room:selected), czat zostaje
+      const remaining = await window.go.wailsbridge.Bridge.ListRooms();
+      if (remaining && remaining.length > 0) return;
+
+      // Odinstaluj wszystkie listenery
       window.runtime.EventsOff('message:received');
       window.runtime.EventsOff('security:message');
+      window.runtime.EventsOff('network:error');
       window.runtime.EventsOff('users:update');
+      window.runtime.EventsOff('peer:offline');
+      window.runtime.EventsOff('peer:online');
       window.runtime.EventsOff('nickname:update');
       window.runtime.EventsOff('room:left');
       
-      // Wyślij wiadomość o opuszczeniu pokoju i zamknij połączenie
-      if (connected) {
-        try {
-          window.go.wailsbridge.Bridge.SendMessage(JSON.stringify({
-            type: "user_left",
-            content: `Użytkownik ${nickname} opuścił pokój`,
-          }));
-          console.log("Wiadomość o opuszczeniu pokoju wysłana");
-        } catch (e) {
-          console.error("Błąd wysyłania wiadomości o opuszczeniu:", e);
-        }
-        
-        try {
-          window.go.wailsbridge.Bridge.CloseConnection();
-          console.log("Połączenie zamknięte");
-        } catch (e) {
-          console.error("Błąd zamykania połączenia:", e);
-        }
-      }
-      
       // Całkowite czyszczenie stanu aplikacji
       setMessages([]);
       setUsers([]);
@@ -139,29 +234,149 @@ export function ChatView({
     }
   };
   
-  // Obsługa opuszczania pokoju przy zamykaniu okna
+  // Własne skróty emoji pokoju (rejestr z podpisanych metadanych hosta)
   useEffect(() => {
-    const handleBeforeUnload = () => {
-      // Wyślij wiadomość o opuszczeniu pokoju
-      if (connected) {
-        try {
-          window.go.wailsbridge.Bridge.SendMessage(JSON.stringify({
-            type: "user_left",
-            content: `Użytkownik ${nickname} opuścił pokój`,
-          }));
-        } catch (error) {
-          console.error("Błąd podczas wysyłania wiadomości o opuszczeniu pokoju:", error);
-        }
+    window.go.wailsbridge.Bridge.GetRoomShortcodes()
+      .then((list: RoomShortcode[]) => setShortcodes(list || []))
+      .catch((err: unknown) => console.error("Nie udało się pobrać skrótów pokoju:", err));
+    window.runtime.EventsOn("room:shortcodes", (list: RoomShortcode[]) => {
+      setShortcodes(list || []);
+    });
+    return () => {
+      window.runtime.EventsOff("room:shortcodes");
+    };
+  }, [roomId]);
+
+  // Dostępność: aktywność (klawiatura, wskaźnik) zgłaszana najwyżej co 15 s
+  useEffect(() => {
+    window.go.wailsbridge.Bridge.GetPresence()
+      .then((p: string) => setPresence(p))
+      .catch((err: unknown) => console.error("Nie udało się pobrać dostępności:", err));
+    window.runtime.EventsOn("peer:presence", (data: { peer_id: string; presence: string; local: boolean }) => {
+      if (data.local) setPresence(data.presence);
+    });
+    let lastReport = 0;
+    const onActivity = () => {
+      const now = Date.now();
+      if (now - lastReport < 15000) return;
+      lastReport = now;
+      window.go.wailsbridge.Bridge.ReportActivity();
+    };
+    window.addEventListener("keydown", onActivity);
+    window.addEventListener("pointermove", onActivity);
+    return () => {
+      window.runtime.EventsOff("peer:presence");
+      window.removeEventListener("keydown", onActivity);
+      window.removeEventListener("pointermove", onActivity);
+    };
+  }, []);
+
+  const changePresence = async (p: string) => {
+    try {
+      await window.go.wailsbridge.Bridge.SetPresence(p);
+      setPresence(p);
+    } catch (err) {
+      console.error("Nie udało się zmienić dostępności:", err);
+    }
+  };
+
+  // Kolejka niewysłanych wiadomości; gdy się opróżni, oczekujące zostały wysłane
+  useEffect(() => {
+    if (!roomId) return;
+    window.go.wailsbridge.Bridge.GetQueuedMessages(roomId)
+      .then((list: QueuedMessage[]) => setQueued(list || []))
+      .catch((err: unknown) => console.error("Nie udało się pobrać kolejki wiadomości:", err));
+    window.runtime.EventsOn("outbox:update", (data: { room_id: string; messages: QueuedMessage[] }) => {
+      if (data.room_id !== roomId) return;
+      const list = data.messages || [];
+      setQueued(list);
+      if (list.length === 0) {
+        setMessages(prev => prev.map(msg => msg.status === "pending" ? { ...msg, status: "sent" } : msg));
       }
+    });
+    return () => {
+      window.runtime.EventsOff("outbox:update");
     };
-    
-    window.addEventListener('beforeunload', handleBeforeUnload);
-    
+  }, [roomId]);
+
+  const discardQueued = async () => {
+    if (!roomId) return;
+    // najpierw oznacz, bo zdarzenie z pustą kolejką oznaczyłoby je jako wysłane
+    setMessages(prev => prev.map(msg => msg.status === "pending" ? { ...msg, status: "error" } : msg));
+    try {
+      await window.go.wailsbridge.Bridge.ClearQueuedMessages(roomId);
+    } catch (err) {
+      console.error("Nie udało się odrzucić kolejki wiadomości:", err);
+    }
+  };
+
+  // Zaszyfrowana historia pokoju z lokalnej bazy; kolejne strony są
+  // doklejane na początku listy
+  const loadHistory = async (before: string) => {
+    if (!roomId) return;
+    try {
+      const page = await window.go.wailsbridge.Bridge.GetHistory(roomId, before, 50);
+      const older: Message[] = (page.messages || []).map((m: any) => ({
+        id: `history-${m.id}`,
+        sender: m.isLocal ? nickname : (m.sender_name || m.sender),
+        content: m.message,
+        timestamp: m.timestamp,
+        timeFormatted: m.time,
+        isLocal: m.isLocal,
+        verified: true,
+        type: (m.type as "text" | "image" | "audio" | "gif" | "file") || "text",
+        mediaUrl: m.mediaUrl,
+        thumbnailUrl: m.thumbnailUrl,
+        originalId: m.originalId,
+        mediaId: m.mediaId,
+        waveform: m.waveform,
+        durationMs: m.durationMs,
+        size: m.size,
+        status: "sent",
+      }));
+      setMessages(prev => {
+        const known = new Set(prev.map(msg => msg.id));
+        return [...older.filter(msg => !known.has(msg.id)), ...prev];
+      });
+      setHistoryCursor(page.next || "");
+    } catch (err) {
+      console.error("Nie udało się wczytać historii:", err);
+    }
+  };
+
+  useEffect(() => {
+    // Po przełączeniu pokoju czat pokazuje tylko jego wiadomości
+    setMessages(prev => prev.filter(msg => msg.id === "system-1"));
+    setHistoryCursor("");
+    loadHistory("");
+    // Po synchronizacji z drugim urządzeniem wczytaj historię od nowa
+    window.runtime.EventsOn("history:synced", () => loadHistory(""));
     return () => {
-      window.removeEventListener('beforeunload', handleBeforeUnload);
+      window.runtime.EventsOff("history:synced");
     };
-  }, [connected, nickname]);
-  
+  }, [roomId]);
+
+  // Pobiera brakującą historię z połączonego urządzenia z tą samą tożsamością
+  const syncHistory = async () => {
+    try {
+      const id = await window.go.wailsbridge.Bridge.SyncHistory();
+      setHistoryTransfer({ id, bytes: 0, total: 0 });
+    } catch (err) {
+      setMessages(prev => [
+        ...prev,
+        {
+          id: `history-sync-${Date.now()}`,
+          sender: "System",
+          content: `Nie można zsynchronizować historii: ${err}`,
+          timestamp: new Date().toISOString(),
+          isLocal: false,
+          verified: true,
+          type: "text",
+        },
+      ]);
+    }
+  };
+
   // Nasłuchiwanie zdarzenia opuszczenia pokoju
   useEffect(() => {
     const handleRoomLeft = () => {
@@ -183,17 +398,29 @@ export function ChatView({
     
     // Nasłuchiwanie zdarzeń z Wails
     window.runtime.EventsOn('message:received', (data: any) => {
+      // Wiadomości z innych naszych pokojów czekają na ich wybranie
+      if (data.room_id && data.room_id !== roomId) return;
       const msgData = data as {
+        id?: string;
         sender: string;
+        sender_name?: string;
         message: string;
         timestamp: string;
+        time?: string;
         isLocal: boolean;
         verified: boolean;
         type?: string;
         mediaUrl?: string;
+        thumbnailUrl?: string;
+        originalId?: string;
+        mediaId?: string;
+        waveform?: number[];
+        durationMs?: number;
+        size?: number;
       };
       
-      // Obsługa specjalnej wiadomości o opuszczeniu pokoju
+      // Wiadomość o opuszczeniu pokoju od starszych wersji, które nie
+      // wysyłały pożegnania
       if (msgData.type === "user_left") {
         // Dodaj komunikat systemowy o opuszczeniu pokoju
         setMessages(prev => [
@@ -213,22 +440,29 @@ export function ChatView({
         return;
       }
       
-      // Pobierz nickname nadawcy z mapy nicków, jeśli istnieje
-      const senderNickname = userNicknames[msgData.sender] || msgData.sender;
+      // Nazwa z back-endu jest jednoznaczna (przy kolizji nicków ma wyróżnik)
+      const senderNickname = msgData.sender_name || userNicknames[msgData.sender] || msgData.sender;
       
       setMessages(prev => [
         ...prev,
         {
-          id: `remote-${Date.now()}`,
+          id: msgData.id || `remote-${Date.now()}`,
           sender: senderNickname,
           content: msgData.message,
           timestamp: typeof msgData.timestamp === 'string' 
             ? msgData.timestamp 
             : new Date(msgData.timestamp).toISOString(),
+          timeFormatted: msgData.time,
           isLocal: false, // Zawsze ustawiamy na false, aby wiadomości były widoczne dla wszystkich
           verified: msgData.verified,
-          type: (msgData.type as "text" | "image" | "audio" | "gif") || "text",
+          type: (msgData.type as "text" | "image" | "audio" | "gif" | "file") || "text",
           mediaUrl: msgData.mediaUrl,
+          thumbnailUrl: msgData.thumbnailUrl,
+          originalId: msgData.originalId,
+          mediaId: msgData.mediaId,
+          waveform: msgData.waveform,
+          durationMs: msgData.durationMs,
+          size: msgData.size,
           status: "sent", // Wiadomości odebrane zawsze mają status "sent"
         }
       ]);
@@ -250,8 +484,26 @@ export function ChatView({
       ]);
     });
     
+    // Błędy sieci: komunikat zależy od rodzaju błędu, nie od jego treści
+    window.runtime.EventsOn('network:error', (err: NetworkError) => {
+      const content = networkErrorText(err);
+      if (!content) return;
+      setMessages(prev => [
+        ...prev,
+        {
+          id: `network-${Date.now()}`,
+          sender: "System",
+          content,
+          timestamp: new Date().toISOString(),
+          isLocal: false,
+          verified: true,
+          type: "text",
+        }
+      ]);
+    });
+
     // Nasłuchiwanie aktualizacji użytkowników
-    window.runtime.EventsOn('users:update', (userList: any) => {
+    const applyUsers = (userList: any) => {
       // Zaktualizuj listę użytkowników, zachowując lokalnego użytkownika
       setUsers(prev => {
         const localUser = prev.find(u => u.isLocal);
@@ -260,28 +512,47 @@ export function ChatView({
           .filter((u: any) => u.id !== userID)
           .map((u: any) => ({
             ...u,
-            // Użyj zapisanego nickname'a jeśli jest dostępny
-            nickname: userNicknames[u.id] || u.nickname,
+            // Back-end podaje jednoznaczną nazwę; zapisany nick tylko awaryjnie
+            nickname: u.nickname || userNicknames[u.id],
             isLocal: false
           }));
         
+        // Status i awatar lokalnego użytkownika pochodzą z jego profilu
+        const localProfile = userList.find((u: any) => u.id === userID);
+        const local = localUser && localProfile
+          ? { ...localUser, status: localProfile.status, avatar: localProfile.avatar, presence: localProfile.presence, role: localProfile.role }
+          : localUser;
+
         // Połącz lokalnego użytkownika z listą zdalnych użytkowników
-        return localUser ? [...remoteUsers, localUser] : remoteUsers;
+        return local ? [...remoteUsers, local] : remoteUsers;
       });
+    };
+    // back-end emituje listę tylko przy zmianie, więc pobierz bieżącą
+    window.go.wailsbridge.Bridge.GetPeers().then(applyUsers).catch((e: any) => {
+      console.error("Błąd podczas pobierania listy uczestników:", e);
     });
+    window.runtime.EventsOn('users:update', applyUsers);
+
+    // Uczestnik przestał odpowiadać albo znów się odezwał
+    const setOffline = (offline: boolean) => (data: { peer_id: string }) =>
+      setUsers(prev => prev.map(user => (user.id === data.peer_id ? { ...user, offline } : user)));
+    window.runtime.EventsOn('peer:offline', setOffline(true));
+    window.runtime.EventsOn('peer:online', setOffline(false));
     
     // Nasłuchiwanie aktualizacji nicków
-    window.runtime.EventsOn('nickname:update', (data: { sender: string, nickname: string }) => {
+    window.runtime.EventsOn('nickname:update', (data: { sender: string, nickname: string, display_name?: string }) => {
+      const displayName = data.display_name || data.nickname;
+
       // Aktualizuj mapę nicków
       setUserNicknames(prev => ({
         ...prev,
-        [data.sender]: data.nickname
+        [data.sender]: displayName
       }));
       
       // Aktualizuj listę użytkowników
       setUsers(prev => 
         prev.map(user => 
-          user.id === data.sender ? { ...user, nickname: data.nickname } : user
+          user.id === data.sender ? { ...user, nickname: displayName } : user
         )
       );
       
@@ -291,7 +562,7 @@ export function ChatView({
         {
           id: `nick-update-${Date.now()}`,
           sender: "System",
-          content: `Użytkownik zmienił nazwę na: ${data.nickname}`,
+          content: `Użytkownik zmienił nazwę na: ${displayName}`,
           timestamp: new Date().toISOString(),
           isLocal: false,
           verified: true,
@@ -303,10 +574,13 @@ export function ChatView({
     return () => {
       window.runtime.EventsOff('message:received');
       window.runtime.EventsOff('security:message');
+      window.runtime.EventsOff('network:error');
       window.runtime.EventsOff('users:update');
+      window.runtime.EventsOff('peer:offline');
+      window.runtime.EventsOff('peer:online');
       window.runtime.EventsOff('nickname:update');
     };
-  }, [connected, userNicknames, userID]);
+  }, [connected, userNicknames, userID, roomId]);
   
   // Funkcja do sprawdzania i żądania uprawnień do mikrofonu
   const requestMicrophonePermission = async () => {
@@ -346,8 +620,203 @@ export function ChatView({
     }
   };
   
+  useEffect(() => {
+    window.go.wailsbridge.Bridge.GetVoiceSupport()
+      .then((support: any) => setVoiceSupport({ record: !!support.record, play: !!support.play }))
+      .catch((err: unknown) => console.error("Nie udało się sprawdzić obsługi nagrań:", err));
+    window.runtime.EventsOn("voice:playback", (data: { mediaId: string; playing: boolean }) => {
+      setPlayingVoice(current => (data.playing ? data.mediaId : current === data.mediaId ? "" : current));
+    });
+    return () => {
+      window.runtime.EventsOff("voice:playback");
+    };
+  }, []);
+
+  // Pliki idą osobnymi strumieniami; back-end czyta je z dysku, więc ich
+  // zawartość nie przechodzi przez most
+  const addFileMessage = (id: string, name: string, size?: number) => {
+    const message: Message = {
+      id: `file-${id}`,
+      sender: nickname,
+      content: name,
+      timestamp: new Date().toISOString(),
+      isLocal: false,
+      verified: true,
+      type: "file",
+      mediaId: id,
+      size,
+      progress: 0,
+      status: "pending",
+    };
+    // Kolejka aktualizacji zachowuje kolejność, więc wynik zapisany przez
+    // transfer:complete jest już tu widoczny
+    setMessages(prev => {
+      const finished = finishedTransfers.current.get(id);
+      finishedTransfers.current.delete(id);
+      return [...prev, finished ? completeFileMessage(message, finished) : message];
+    });
+  };
+
+  const completeFileMessage = (msg: Message, t: TransferEvent): Message => ({
+    ...msg,
+    size: t.total,
+    progress: 1,
+    status: t.canceled ? "canceled" : t.error ? "error" : "sent",
+  });
+
+  const cancelTransfer = async (id: string) => {
+    try {
+      await window.go.wailsbridge.Bridge.CancelTransfer(id);
+    } catch (error) {
+      console.error("Błąd anulowania transferu:", error);
+    }
+  };
+
+  const reportFileError = (error: unknown) => {
+    setMessages(prev => [
+      ...prev,
+      {
+        id: `error-file-${Date.now()}`,
+        sender: "System",
+        content: `${error}`,
+        timestamp: new Date().toISOString(),
+        isLocal: false,
+        verified: true,
+        type: "text",
+      }
+    ]);
+  };
+
+  const sendFilePath = async (path: string) => {
+    try {
+      const id = await window.go.wailsbridge.Bridge.SendFile(path);
+      addFileMessage(id, path.split(/[\\/]/).pop() || path);
+    } catch (error) {
+      reportFileError(error);
+    }
+  };
+
+  const chooseFile = async () => {
+    try {
+      const result = await window.go.wailsbridge.Bridge.ChooseAndSendFile();
+      if (result.id) {
+        addFileMessage(result.id, result.name, result.size);
+      }
+    } catch (error) {
+      reportFileError(error);
+    }
+  };
+
+  useEffect(() => {
+    if (!connected) return;
+    OnFileDrop((_x: number, _y: number, paths: string[]) => {
+      paths.forEach(sendFilePath);
+    }, false);
+    window.runtime.EventsOn("transfer:progress", (t: TransferEvent) => {
+      if (t.kind === "history" && t.direction === "receive") {
+        setHistoryTransfer(prev => prev && prev.id === t.id ? { id: t.id, bytes: t.bytes, total: t.total } : prev);
+        return;
+      }
+      if (t.kind !== "file" || t.direction !== "send") return;
+      setMessages(prev => prev.map(msg => msg.id === `file-${t.id}`
+        ? { ...msg, size: t.total, progress: t.total > 0 ? t.bytes / t.total : 0 }
+        : msg));
+    });
+    window.runtime.EventsOn("transfer:complete", (t: TransferEvent) => {
+      if (t.kind === "history" && t.direction === "receive") {
+        setHistoryTransfer(prev => prev && prev.id === t.id ? null : prev);
+        return;
+      }
+      if (t.kind !== "file" || t.direction !== "send") return;
+      setMessages(prev => {
+        if (!prev.some(msg => msg.id === `file-${t.id}`)) {
+          // SendFile jeszcze nie zwrócił identyfikatora
+          finishedTransfers.current.set(t.id, t);
+          return prev;
+        }
+        return prev.map(msg => msg.id === `file-${t.id}` ? completeFileMessage(msg, t) : msg);
+      });
+      if (t.error && !t.canceled) {
+        reportFileError(`Błąd wysyłania pliku: ${t.error}`);
+      }
+    });
+    return () => {
+      OnFileDropOff();
+      window.runtime.EventsOff("transfer:progress");
+      window.runtime.EventsOff("transfer:complete");
+    };
+  }, [connected, nickname]);
+
+  // Nagrywanie w back-endzie: mikrofon, kodowanie Opus i przebieg głośności
+  // bez udziału web view
+  const startNativeRecording = async () => {
+    try {
+      await window.go.wailsbridge.Bridge.StartVoiceRecording();
+      setIsRecording(true);
+    } catch (error) {
+      setMessages(prev => [
+        ...prev,
+        {
+          id: `error-${Date.now()}`,
+          sender: "System",
+          content: `${error}`,
+          timestamp: new Date().toISOString(),
+          isLocal: false,
+          verified: true,
+          type: "text",
+        }
+      ]);
+    }
+  };
+
+  const stopNativeRecording = async () => {
+    setIsRecording(false);
+    const id = `local-audio-${Date.now()}`;
+    setMessages(prev => [
+      ...prev,
+      {
+        id,
+        sender: nickname,
+        content: "Wiadomość głosowa",
+        timestamp: new Date().toISOString(),
+        isLocal: false,
+        verified: true,
+        type: "audio",
+        status: "pending",
+      }
+    ]);
+    try {
+      const result = await window.go.wailsbridge.Bridge.StopVoiceRecording();
+      setMessages(prev => prev.map(msg => msg.id === id ? {
+        ...msg,
+        id: result.id || msg.id,
+        status: "sent",
+        mediaUrl: result.mediaUrl,
+        mediaId: result.id,
+        waveform: result.waveform,
+        durationMs: result.durationMs,
+      } : msg));
+    } catch (error) {
+      setMessages(prev => [
+        ...prev.map(msg => msg.id === id ? { ...msg, status: "error" as const } : msg),
+        {
+          id: `error-audio-${Date.now()}`,
+          sender: "System",
+          content: `${error}`,
+          timestamp: new Date().toISOString(),
+          isLocal: false,
+          verified: true,
+          type: "text",
+        }
+      ]);
+    }
+  };
+
   // Funkcja do rozpoczęcia nagrywania audio - bezpośrednia próba nagrywania
   const startRecording = async () => {
+    if (voiceSupport.record) {
+      return startNativeRecording();
+    }
     console.log("Rozpoczynam nagrywanie...");
     
     try {
@@ -424,6 +893,10 @@ export function ChatView({
   
   // Funkcja do zatrzymania nagrywania
   const stopRecording = () => {
+    if (voiceSupport.record && isRecording) {
+      stopNativeRecording();
+      return;
+    }
     if (mediaRecorder && isRecording) {
       mediaRecorder.stop();
       setIsRecording(false);
@@ -457,32 +930,17 @@ export function ChatView({
         // Najpierw dodajemy wiadomość lokalnie, aby była od razu widoczna
         setMessages(prev => [...prev, newMessage]);
         
-        // Przygotuj strukturę JSON dla wiadomości
-        const audioMessage = {
-          type: "audio",
-          content: "Wiadomość głosowa",
-          mediaUrl: base64data
-        };
-        
         console.log("Wysyłanie wiadomości audio");
         
-        // Wysyłamy wiadomość przez Wails
+        // Nagranie idzie osobnym strumieniem, wiadomość czatu tylko na nie wskazuje
         try {
-          const result = await window.go.wailsbridge.Bridge.SendMessage(JSON.stringify(audioMessage));
-          
-          // Sprawdź wynik wysyłania
-          if (result && result.includes("buforowana")) {
-            // Wiadomość została buforowana, pozostawiamy status "pending"
-            console.log("Wiadomość audio buforowana");
-          } else {
-            // Wiadomość wysłana pomyślnie, aktualizujemy status na "sent"
-            setMessages(prev => 
-              prev.map(msg => 
-                msg.id === newMessage.id ? { ...msg, status: "sent" } : msg
-              )
-            );
-            console.log("Wiadomość audio wysłana pomyślnie");
-          }
+          const result = await window.go.wailsbridge.Bridge.SendMedia("audio", "Wiadomość głosowa", base64data);
+          setMessages(prev => 
+            prev.map(msg => 
+              msg.id === newMessage.id ? { ...msg, id: result.id || msg.id, status: "sent", mediaUrl: result.mediaUrl } : msg
+            )
+          );
+          console.log("Wiadomość audio wysłana pomyślnie");
         } catch (error) {
           console.error("Błąd podczas wysyłania wiadomości audio:", error);
           // Pokaż komunikat o błędzie i oznacz wiadomość jako błędną
@@ -555,31 +1013,16 @@ export function ChatView({
       };
       
       try {
-        // Wysyłamy wiadomość przez Wails z dodatkowymi polami
-        const message = JSON.stringify({
-          type: messageType,
-          content: file.name,
-          mediaUrl: base64data
-        });
-        
         // Dodajemy wiadomość do widoku przed wysłaniem
         setMessages(prev => [...prev, newMessage]);
         
-        // Wysyłamy wiadomość przez Wails
-        const result = await window.go.wailsbridge.Bridge.SendMessage(message);
-        
-        // Sprawdź wynik wysyłania
-        if (result && result.includes("buforowana")) {
-          // Wiadomość została buforowana, pozostawiamy status "pending"
-          console.log("Wiadomość multimedialna buforowana");
-        } else {
-          // Wiadomość wysłana pomyślnie, aktualizujemy status na "sent"
-          setMessages(prev => 
-            prev.map(msg => 
-              msg.id === newMessage.id ? { ...msg, status: "sent" } : msg
-            )
-          );
-        }
+        // Zdjęcie idzie osobnym strumieniem, wiadomość czatu tylko na nie wskazuje
+        const result = await window.go.wailsbridge.Bridge.SendMedia(messageType, file.name, base64data);
+        setMessages(prev => 
+          prev.map(msg => 
+            msg.id === newMessage.id ? { ...msg, id: result.id || msg.id, status: "sent", mediaUrl: result.mediaUrl } : msg
+          )
+        );
       } catch (error) {
         console.error("Błąd podczas wysyłania multimediów:", error);
         // Oznacz wiadomość jako błędną
@@ -651,21 +1094,20 @@ export function ChatView({
     
     try {
       // Wysyłamy wiadomość przez Wails
-      const result = await window.go.wailsbridge.Bridge.SendMessage(messageJson);
+      const id = await window.go.wailsbridge.Bridge.SendMessage(messageJson);
       
-      // Sprawdź wynik wysyłania
-      if (result && result.includes("buforowana")) {
-        // Wiadomość została buforowana, pozostawiamy status "pending"
+      // Wiadomość wysłana: od teraz nosi identyfikator, który znają odbiorcy
+      setMessages(prev => 
+        prev.map(msg => 
+          msg.id === newMessage.id ? { ...msg, id: id || msg.id, status: "sent" } : msg
+        )
+      );
+    } catch (error) {
+      if (String(error).includes("buforowana")) {
+        // Wiadomość czeka w kolejce pokoju, pozostawiamy status "pending"
         console.log("Wiadomość buforowana:", messageToSend);
-      } else {
-        // Wiadomość wysłana pomyślnie, aktualizujemy status na "sent"
-        setMessages(prev => 
-          prev.map(msg => 
-            msg.id === newMessage.id ? { ...msg, status: "sent" } : msg
-          )
-        );
+        return;
       }
-    } catch (error) {
       console.error("Błąd podczas wysyłania wiadomości:", error);
       // Oznacz wiadomość jako błędną
       setMessages(prev => 
@@ -695,9 +1137,6 @@ export function ChatView({
     if (newNickname && newNickname !== nickname) {
       setNickname(newNickname);
       
-      // Zapisz nickname w localStorage dla późniejszego użycia
-      localStorage.setItem("execp2p_nickname", newNickname);
-      
       // Aktualizuj użytkownika w liście
       setUsers(prev => 
         prev.map(user => 
@@ -705,26 +1144,24 @@ export function ChatView({
         )
       );
       
-      // Wysyłamy aktualizację do innych użytkowników
+      // Back-end zapisuje nick i wysyła aktualizację do innych użytkowników
+      window.go.wailsbridge.Bridge.UpdateNickname(newNickname).catch((error: unknown) => {
+        console.error("Błąd podczas aktualizacji nickname:", error);
+      });
       if (connected) {
-        try {
-          window.go.wailsbridge.Bridge.UpdateNickname(newNickname);
-          // Dodaj wiadomość systemową o zmianie nazwy
-          setMessages(prev => [
-            ...prev,
-            {
-              id: `nick-update-self-${Date.now()}`,
-              sender: "System",
-              content: `Zmieniłeś swoją nazwę na: ${newNickname}`,
-              timestamp: new Date().toISOString(),
-              isLocal: false,
-              verified: true,
-              type: "text",
-            }
-          ]);
-        } catch (error) {
-          console.error("Błąd podczas aktualizacji nickname:", error);
-        }
+        // Dodaj wiadomość systemową o zmianie nazwy
+        setMessages(prev => [
+          ...prev,
+          {
+            id: `nick-update-self-${Date.now()}`,
+            sender: "System",
+            content: `Zmieniłeś swoją nazwę na: ${newNickname}`,
+            timestamp: new Date().toISOString(),
+            isLocal: false,
+            verified: true,
+            type: "text",
+          }
+        ]);
       }
     }
   };
@@ -762,6 +1199,34 @@ export function ChatView({
     }
   };
   
+  // Miniatura po kliknięciu zamienia się w zdjęcie w rozdzielczości czatu
+  const showFullPicture = (id: string) => {
+    setMessages(prev => prev.map(msg => msg.id === id ? { ...msg, thumbnailUrl: undefined } : msg));
+  };
+
+  // Oryginał trzyma nadawca; przychodzi osobnym strumieniem na żądanie
+  const loadOriginal = async (id: string, originalId: string) => {
+    try {
+      const url = await window.go.wailsbridge.Bridge.GetOriginalMedia(originalId);
+      setMessages(prev => prev.map(msg =>
+        msg.id === id ? { ...msg, mediaUrl: url, thumbnailUrl: undefined, originalId: undefined } : msg
+      ));
+    } catch (error) {
+      setMessages(prev => [
+        ...prev,
+        {
+          id: `error-${Date.now()}`,
+          sender: "System",
+          content: `${error}`,
+          timestamp: new Date().toISOString(),
+          isLocal: false,
+          verified: true,
+          type: "text",
+        }
+      ]);
+    }
+  };
+
   // Funkcja renderująca zawartość wiadomości w zależności od typu
   const renderMessageContent = (msg: Message) => {
     // Specjalne renderowanie dla przycisku uprawnień mikrofonu
@@ -782,12 +1247,23 @@ export function ChatView({
         // Sprawdź czy mediaUrl istnieje
         if (msg.mediaUrl) {
           return (
-            <img 
-              src={msg.mediaUrl} 
-              alt={msg.content}
-              className="max-w-full rounded-md"
-              style={{ maxHeight: "200px" }}
-            />
+            <div>
+              <img 
+                src={msg.thumbnailUrl || msg.mediaUrl} 
+                alt={msg.content}
+                className={cn("max-w-full rounded-md", msg.thumbnailUrl && "cursor-zoom-in")}
+                style={{ maxHeight: msg.thumbnailUrl ? "200px" : "480px" }}
+                onClick={() => showFullPicture(msg.id)}
+              />
+              {msg.originalId && (
+                <button
+                  className="text-xs text-blue-400 hover:underline mt-1"
+                  onClick={() => loadOriginal(msg.id, msg.originalId!)}
+                >
+                  Pobierz w pełnej rozdzielczości
+                </button>
+              )}
+            </div>
           );
         } else {
           // Jeśli nie ma mediaUrl, pokaż informację o braku
@@ -800,17 +1276,30 @@ export function ChatView({
         }
       case "audio":
         return (
-          <audio 
-            controls
-            src={msg.mediaUrl}
-            className="max-w-full mt-1"
-          >
-            Twoja przeglądarka nie obsługuje elementu audio.
-          </audio>
+          <VoiceMessage
+            mediaId={msg.mediaId}
+            mediaUrl={msg.mediaUrl}
+            waveform={msg.waveform}
+            durationMs={msg.durationMs}
+            nativePlayback={voiceSupport.play}
+            playing={!!msg.mediaId && playingVoice === msg.mediaId}
+          />
+        );
+      case "file":
+        return (
+          <FileMessage
+            name={msg.content}
+            mediaId={msg.mediaId}
+            size={msg.size}
+            progress={msg.status === "pending" ? msg.progress : undefined}
+            received={!msg.id.startsWith("file-")}
+            canceled={msg.status === "canceled"}
+            onCancel={msg.status === "pending" && msg.mediaId ? () => cancelTransfer(msg.mediaId!) : undefined}
+          />
         );
       case "text":
       default:
-        return msg.content;
+        return renderShortcodes(msg.content, shortcodes);
     }
   };
   
@@ -830,6 +1319,51 @@ export function ChatView({
     };
   }, []);
   
+  // Usunięcie i blokada uczestnika (host i moderatorzy); błąd trafia do czatu
+  const canModerate = isRoomCreator || users.some((u) => u.isLocal && u.role === "moderator");
+
+  const moderationError = (err: unknown) => {
+    setMessages((prev) => [
+      ...prev,
+      {
+        id: `moderation-${Date.now()}`,
+        sender: "System",
+        content: `Nie udało się: ${err}`,
+        timestamp: new Date().toISOString(),
+        isLocal: false,
+        verified: true,
+        type: "text",
+      },
+    ]);
+  };
+
+  const userName = (peerId: string) => users.find((u) => u.id === peerId)?.nickname || peerId.substring(0, 8);
+
+  const handleKick = (peerId: string) => {
+    if (!window.confirm(`Usunąć ${userName(peerId)} z pokoju?`)) return;
+    window.go.wailsbridge.Bridge.KickPeer(peerId).catch(moderationError);
+  };
+
+  const handleToggleModerator = (peerId: string, moderator: boolean) => {
+    window.go.wailsbridge.Bridge.SetPeerRole(peerId, moderator ? "moderator" : "member").catch(moderationError);
+  };
+
+  const handleBan = (peerId: string) => {
+    if (!window.confirm(`Zablokować ${userName(peerId)}? Ta tożsamość nie dołączy już do pokoju.`)) return;
+    window.go.wailsbridge.Bridge.BanPeer(peerId, "").catch(moderationError);
+  };
+
+  // Zdalne wyczyszczenie zgubionego urządzenia z naszą tożsamością
+  useEffect(() => {
+    window.go.wailsbridge.Bridge.OwnDevices().then((ids: string[]) => setOwnDevices(ids || [])).catch(() => setOwnDevices([]));
+    window.go.wailsbridge.Bridge.IsPrimaryDevice().then(setPrimaryDevice).catch(() => setPrimaryDevice(false));
+  }, [users]);
+
+  const handleWipe = (peerId: string) => {
+    if (!window.confirm(`Wyczyścić urządzenie ${userName(peerId)}? Usunie ono klucze tożsamości i wszystkie dane lokalne. Tego nie da się cofnąć.`)) return;
+    window.go.wailsbridge.Bridge.WipeDevice(peerId).catch(moderationError);
+  };
+
   // Sprawdzenie, czy faktycznie mamy dostęp do pokoju
   if (!roomId || (!connected && !isRoomCreator)) {
     return (
@@ -880,6 +1414,29 @@ export function ChatView({
                 Opuść pokój
               </Button>
             )}
+            {connected && !historyTransfer && (
+              <Button
+                onClick={syncHistory}
+                variant="ghost"
+                className="ml-3 text-xs py-1"
+                size="sm"
+                title="Pobierz historię z drugiego urządzenia z tą samą tożsamością"
+              >
+                Synchronizuj historię
+              </Button>
+            )}
+            {connected && historyTransfer && (
+              <Button
+                onClick={() => cancelTransfer(historyTransfer.id)}
+                variant="ghost"
+                className="ml-3 text-xs py-1"
+                size="sm"
+                title="Przerwij synchronizację historii"
+              >
+                Anuluj synchronizację
+                {historyTransfer.total > 0 && ` (${Math.round(historyTransfer.bytes / historyTransfer.total * 100)}%)`}
+              </Button>
+            )}
           </h2>
           <div className="flex items-center space-x-2">
             <User className="h-4 w-4 text-gray-400" />
@@ -902,9 +1459,27 @@ export function ChatView({
           </div>
         </div>
       
+      {queued.length > 0 && (
+        <div className="bg-amber-900/30 border-b border-amber-800 px-6 py-2 flex items-center justify-between text-sm text-amber-200">
+          <span>
+            Wiadomości czekające na połączenie: {queued.length}. Zostaną wysłane, gdy rozmówca będzie dostępny.
+          </span>
+          <Button onClick={discardQueued} variant="ghost" size="sm" className="text-xs py-1">
+            Odrzuć
+          </Button>
+        </div>
+      )}
+
       <div className="flex-1 flex overflow-hidden">
         <div className="flex-1 overflow-y-auto px-6 py-4">
         <div className="space-y-4">
+          {historyCursor && (
+            <div className="flex justify-center">
+              <Button variant="ghost" size="sm" onClick={() => loadHistory(historyCursor)}>
+                Wczytaj starsze wiadomości
+              </Button>
+            </div>
+          )}
           {messages.map((msg) => (
             <div 
               key={msg.id}
@@ -933,7 +1508,7 @@ export function ChatView({
               </div>
               <div className="text-xs mt-1 text-right flex justify-end items-center gap-1">
                 <span className="text-gray-500">
-                  {new Date(msg.timestamp).toLocaleTimeString()}
+                  {msg.timeFormatted || new Date(msg.timestamp).toLocaleTimeString()}
                 </span>
                 {msg.sender === nickname && msg.status && (
                   <span className={
@@ -956,14 +1531,37 @@ export function ChatView({
           <div ref={messagesEndRef} />
         </div>
         </div>
-        <div className="w-64 flex-shrink-0 border-l border-gray-800 p-4">
-          <UserListTable users={users} />
+        <div className="w-64 flex-shrink-0 border-l border-gray-800 p-4 overflow-y-auto">
+          <select
+            value={presence}
+            onChange={(e) => changePresence(e.target.value)}
+            className="w-full mb-2 bg-gray-900 border border-gray-700 rounded px-2 py-1 text-sm"
+          >
+            <option value="online">Dostępny</option>
+            <option value="away">Zaraz wracam</option>
+            <option value="dnd">Nie przeszkadzać</option>
+          </select>
+          <UserListTable
+            users={users}
+            onKick={canModerate ? handleKick : undefined}
+            onBan={canModerate ? handleBan : undefined}
+            onToggleModerator={isRoomCreator ? handleToggleModerator : undefined}
+            ownDevices={ownDevices}
+            onWipe={primaryDevice ? handleWipe : undefined}
+          />
+          <RoomsCard />
           <RoomInfoTable 
             roomId={roomId}
+            roomName={roomName}
+            closesAt={closesAt}
+            canRename={canModerate}
             accessKey={accessKey}
             isRoomCreator={isRoomCreator}
             onRegenerateAccessKey={onRegenerateAccessKey}
           />
+          <ShortcodesCard shortcodes={shortcodes} isRoomCreator={isRoomCreator} />
+          {isRoomCreator && <BansCard roomId={roomId} />}
+          <SearchCard roomId={roomId} />
         </div>
       </div>
       
@@ -1006,6 +1604,17 @@ export function ChatView({
                 Zdjęcie/GIF
               </Button>
               
+              <Button 
+                type="button"
+                onClick={chooseFile}
+                variant="outline"
+                className="gap-2"
+                title="Możesz też upuścić plik na okno"
+              >
+                <File className="h-4 w-4" />
+                Plik
+              </Button>
+              
               <input 
                 type="file" 
                 ref={fileInputRef}
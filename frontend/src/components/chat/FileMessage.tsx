@@ -0,0 +1,61 @@
+import React from "react";
+import { File, Download, X } from "lucide-react";
+
+interface FileMessageProps {
+  name: string;
+  mediaId?: string;
+  size?: number;
+  // Postęp wysyłania (0-1), tylko dla naszych plików w drodze
+  progress?: number;
+  // Odebrany plik można zapisać na dysku
+  received: boolean;
+  // Wysyłanie przerwano
+  canceled?: boolean;
+  // Przerywa wysyłanie w toku
+  onCancel?: () => void;
+}
+
+export const formatSize = (bytes: number) => {
+  if (bytes < 1024) return `${bytes} B`;
+  if (bytes < 1 << 20) return `${(bytes / 1024).toFixed(1)} KiB`;
+  return `${(bytes / (1 << 20)).toFixed(1)} MiB`;
+};
+
+export function FileMessage({ name, mediaId, size, progress, received, canceled, onCancel }: FileMessageProps) {
+  const [savedTo, setSavedTo] = React.useState("");
+
+  const save = async () => {
+    try {
+      setSavedTo(await window.go.wailsbridge.Bridge.SaveReceivedFile(mediaId!));
+    } catch (error) {
+      console.error("Błąd zapisu pliku:", error);
+    }
+  };
+
+  return (
+    <div className="mt-1 space-y-1">
+      <div className="flex items-center gap-2">
+        <File className="h-5 w-5 text-blue-400 shrink-0" />
+        <span className="break-all">{name}</span>
+        {size !== undefined && <span className="text-xs text-gray-400">{formatSize(size)}</span>}
+        {received && mediaId && (
+          <button type="button" onClick={save} className="p-1 rounded hover:bg-gray-700" title="Zapisz plik">
+            <Download className="h-4 w-4" />
+          </button>
+        )}
+        {onCancel && (
+          <button type="button" onClick={onCancel} className="p-1 rounded hover:bg-gray-700" title="Anuluj wysyłanie">
+            <X className="h-4 w-4" />
+          </button>
+        )}
+      </div>
+      {progress !== undefined && progress < 1 && (
+        <div className="h-1 w-48 bg-gray-700 rounded">
+          <div className="h-1 bg-blue-400 rounded" style={{ width: `${Math.round(progress * 100)}%` }} />
+        </div>
+      )}
+      {canceled && <p className="text-xs text-gray-400">Anulowano</p>}
+      {savedTo && <p className="text-xs text-gray-400">Zapisano: {savedTo}</p>}
+    </div>
+  );
+}
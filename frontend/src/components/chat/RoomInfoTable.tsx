@@ -2,32 +2,79 @@ import React, { useState } from "react";
 import { cn } from "@/lib/utils";
 import { Card, CardHeader, CardTitle, CardContent } from "@/components/ui/card";
 import { Button } from "@/components/ui/button";
-import { Copy, RefreshCw, KeyRound, AlertTriangle, Info } from "lucide-react";
+import { Input } from "@/components/ui/input";
+import { Copy, RefreshCw, KeyRound, AlertTriangle, Info, Archive, EyeOff, Pencil, Check, Timer } from "lucide-react";
+
+// Etykieta archiwizacji z podpisanych metadanych pokoju
+interface ArchiveStatus {
+  incognito: boolean;
+  archiving: boolean;
+  sinks: string[] | null;
+  since: string;
+  host_id: string;
+  local: boolean;
+  known: boolean;
+}
 
 interface RoomInfoTableProps {
   roomId?: string;
+  roomName?: string;
+  closesAt?: string; // RFC 3339, pokój z ograniczonym czasem życia
   accessKey?: string;
   isRoomCreator: boolean;
+  canRename?: boolean; // Host i moderatorzy
   className?: string;
   onRegenerateAccessKey?: () => Promise<string>;
 }
 
 export function RoomInfoTable({ 
   roomId, 
+  roomName,
+  closesAt,
   accessKey, 
   isRoomCreator,
+  canRename = false,
   className,
   onRegenerateAccessKey 
 }: RoomInfoTableProps) {
   const [regenerating, setRegenerating] = useState(false);
   const [currentAccessKey, setCurrentAccessKey] = useState(accessKey);
   const [regenerateStatus, setRegenerateStatus] = useState("");
+  const [archiveStatus, setArchiveStatus] = useState<ArchiveStatus | null>(null);
+  const [editingName, setEditingName] = useState(false);
+  const [nameDraft, setNameDraft] = useState("");
+  const [renameError, setRenameError] = useState("");
 
   // Aktualizuj klucz dostępu, gdy zmienia się prop
   React.useEffect(() => {
     setCurrentAccessKey(accessKey);
   }, [accessKey]);
 
+  // Czy host archiwizuje rozmowę (informacja dla wszystkich uczestników)
+  React.useEffect(() => {
+    window.go.wailsbridge.Bridge.GetArchiveStatus()
+      .then((status: ArchiveStatus) => setArchiveStatus(status))
+      .catch((err: unknown) => console.error("Nie udało się pobrać statusu archiwizacji:", err));
+    window.runtime.EventsOn("room:archive", (status: ArchiveStatus) => {
+      setArchiveStatus(status);
+    });
+    return () => {
+      window.runtime.EventsOff("room:archive");
+    };
+  }, [roomId]);
+
+  // Host zmienił klucz dostępu - obecni uczestnicy dostają nowy
+  React.useEffect(() => {
+    window.runtime.EventsOn("room:access_key", (rotation: { room_id: string; access_key: string }) => {
+      if (rotation.room_id === roomId) {
+        setCurrentAccessKey(rotation.access_key);
+      }
+    });
+    return () => {
+      window.runtime.EventsOff("room:access_key");
+    };
+  }, [roomId]);
+
   const copyToClipboard = (text: string | undefined) => {
     if (!text) return;
     
@@ -39,6 +86,19 @@ export function RoomInfoTable({
       .catch(err => console.error("Nie udało się skopiować do schowka:", err));
   };
   
+  const startRename = () => {
+    setNameDraft(roomName || "");
+    setRenameError("");
+    setEditingName(true);
+  };
+
+  // Nowa nazwa trafia do wszystkich w podpisanych metadanych pokoju
+  const saveRename = () => {
+    window.go.wailsbridge.Bridge.RenameRoom(nameDraft)
+      .then(() => setEditingName(false))
+      .catch((err: unknown) => setRenameError(String(err)));
+  };
+
   const handleRegenerateKey = async () => {
     if (!onRegenerateAccessKey) return;
     
@@ -73,6 +133,41 @@ export function RoomInfoTable({
       </CardHeader>
       <CardContent className="px-3 py-2">
         <div className="space-y-3">
+          <div className="flex justify-between items-center">
+            <span className="text-sm text-gray-400">Nazwa:</span>
+            {editingName ? (
+              <div className="flex items-center">
+                <Input
+                  value={nameDraft}
+                  onChange={(e) => setNameDraft(e.target.value)}
+                  onKeyDown={(e) => e.key === "Enter" && saveRename()}
+                  maxLength={64}
+                  className="h-7 text-xs w-[140px]"
+                  autoFocus
+                />
+                <Button variant="ghost" size="sm" className="ml-1 h-7 w-7 p-0" onClick={saveRename}>
+                  <Check className="h-3.5 w-3.5" />
+                </Button>
+              </div>
+            ) : (
+              <div className="flex items-center">
+                <span className="text-sm truncate max-w-[140px]">{roomName || "Bez nazwy"}</span>
+                {canRename && (
+                  <Button
+                    variant="ghost"
+                    size="sm"
+                    className="ml-1 h-7 w-7 p-0"
+                    onClick={startRename}
+                    title="Zmień nazwę pokoju"
+                  >
+                    <Pencil className="h-3.5 w-3.5" />
+                  </Button>
+                )}
+              </div>
+            )}
+          </div>
+          {renameError && <div className="text-xs text-red-400">{renameError}</div>}
+
           {roomId && (
             <div className="flex justify-between items-center">
               <span className="text-sm text-gray-400">ID Pokoju:</span>
@@ -146,13 +241,50 @@ export function RoomInfoTable({
                   
                   <div className="text-amber-400 text-xs mt-2 flex items-start">
                     <AlertTriangle className="h-3.5 w-3.5 mr-1 mt-0.5 flex-shrink-0" />
-                    <span>Po regeneracji klucza nowi użytkownicy będą potrzebować nowego klucza do dołączenia.</span>
+                    <span>Po regeneracji klucza nowi użytkownicy będą potrzebować nowego klucza do dołączenia. Połączeni uczestnicy otrzymają go automatycznie.</span>
                   </div>
                 </>
               )}
             </div>
           
-          {!isRoomCreator && accessKey && (
+          {closesAt && (
+            <div className="text-orange-300 text-xs flex items-start border border-orange-700/50 bg-orange-900/20 rounded px-2 py-1.5">
+              <Timer className="h-3.5 w-3.5 mr-1 mt-0.5 flex-shrink-0" />
+              <span>
+                Pokój zamknie się sam {new Date(closesAt).toLocaleString()}; historia rozmowy zostanie wtedy usunięta.
+              </span>
+            </div>
+          )}
+
+          {archiveStatus?.incognito && (
+            <div className="text-purple-300 text-xs flex items-start border border-purple-700/50 bg-purple-900/20 rounded px-2 py-1.5">
+              <EyeOff className="h-3.5 w-3.5 mr-1 mt-0.5 flex-shrink-0" />
+              <span>Pokój incognito: nic o tym pokoju nie jest zapisywane na dysku.</span>
+            </div>
+          )}
+
+          {archiveStatus?.archiving && (
+            <div className="text-amber-400 text-xs flex items-start border border-amber-700/50 bg-amber-900/20 rounded px-2 py-1.5">
+              <Archive className="h-3.5 w-3.5 mr-1 mt-0.5 flex-shrink-0" />
+              <span>
+                {archiveStatus.local
+                  ? "Archiwizujesz odszyfrowane wiadomości tego pokoju. Uczestnicy zostali o tym poinformowani."
+                  : "Host archiwizuje odszyfrowane wiadomości tego pokoju na swoim komputerze."}
+                {archiveStatus.sinks?.includes("xmpp") && (
+                  <span className="block mt-0.5">
+                    Wiadomości są też przekazywane do pokoju XMPP.
+                  </span>
+                )}
+                {archiveStatus.since && (
+                  <span className="block text-gray-400 mt-0.5">
+                    Od: {new Date(archiveStatus.since).toLocaleString()}
+                  </span>
+                )}
+              </span>
+            </div>
+          )}
+
+          {!isRoomCreator && currentAccessKey && (
               <div className="flex justify-between items-center">
                 <span className="text-sm text-gray-400 flex items-center">
                   <KeyRound className="h-3.5 w-3.5 mr-1 text-gray-500" />
@@ -160,13 +292,13 @@ export function RoomInfoTable({
                 </span>
                 <div className="flex items-center">
                 <span className="font-mono text-xs bg-gray-800 px-2 py-1 rounded truncate max-w-[120px]">
-                  {accessKey}
+                  {currentAccessKey}
                 </span>
                 <Button 
                   variant="ghost" 
                   size="sm"
                   className="ml-1 h-7 w-7 p-0"
-                  onClick={() => copyToClipboard(accessKey)}
+                  onClick={() => copyToClipboard(currentAccessKey)}
                 >
                   <Copy className="h-3.5 w-3.5" />
                 </Button>
@@ -0,0 +1,107 @@
+import React, { useEffect, useState } from "react";
+import { cn } from "@/lib/utils";
+import { Card, CardHeader, CardTitle, CardContent } from "@/components/ui/card";
+import { Button } from "@/components/ui/button";
+import { Layers, LogOut, Plus } from "lucide-react";
+
+// Jeden z pokojów, w których jesteśmy jednocześnie
+export interface RoomSummary {
+  room_id: string;
+  room_name?: string;
+  is_listener: boolean;
+  incognito: boolean;
+  connected_peers: number;
+  unread: number; // wiadomości od ostatniego przeczytania
+  active: boolean;
+}
+
+interface RoomsCardProps {
+  className?: string;
+}
+
+// Lista naszych pokojów: przełączanie, opuszczanie i wejście do kolejnego
+export function RoomsCard({ className }: RoomsCardProps) {
+  const [rooms, setRooms] = useState<RoomSummary[]>([]);
+  const [error, setError] = useState("");
+
+  useEffect(() => {
+    window.go.wailsbridge.Bridge.ListRooms()
+      .then((list: RoomSummary[]) => setRooms(list || []))
+      .catch((err: unknown) => console.error("Nie udało się pobrać listy pokojów:", err));
+    window.runtime.EventsOn("rooms:update", (list: RoomSummary[]) => setRooms(list || []));
+    return () => {
+      window.runtime.EventsOff("rooms:update");
+    };
+  }, []);
+
+  const selectRoom = (room: RoomSummary) => {
+    setError("");
+    window.go.wailsbridge.Bridge.SelectRoom(room.room_id)
+      .catch((err: unknown) => setError(String(err)));
+  };
+
+  const leaveRoom = (room: RoomSummary) => {
+    setError("");
+    window.go.wailsbridge.Bridge.LeaveRoom(room.room_id)
+      .catch((err: unknown) => setError(String(err)));
+  };
+
+  return (
+    <Card className={cn("mt-4 bg-gray-900/60 border-gray-800", className)}>
+      <CardHeader className="pb-2">
+        <CardTitle className="text-sm flex items-center gap-2">
+          <Layers className="h-4 w-4" />
+          Moje pokoje
+        </CardTitle>
+      </CardHeader>
+      <CardContent className="space-y-2 text-xs">
+        {rooms.map((room) => (
+          <div key={room.room_id} className="flex items-center gap-2">
+            <button
+              type="button"
+              className={cn(
+                "flex-1 flex flex-col text-left rounded px-1 py-0.5",
+                room.active ? "bg-blue-900/40" : "hover:bg-gray-800"
+              )}
+              onClick={() => selectRoom(room)}
+              title={room.room_id}
+            >
+              <span className={cn("flex items-center gap-2", room.active ? "text-blue-300" : "text-gray-300")}>
+                {room.room_name || room.room_id.slice(0, 12)}
+                {room.unread > 0 && (
+                  <span className="rounded-full bg-blue-600 px-1.5 text-[10px] leading-4 text-white" title="Nieprzeczytane wiadomości">
+                    {room.unread > 99 ? "99+" : room.unread}
+                  </span>
+                )}
+              </span>
+              <span className="text-gray-500">
+                {room.is_listener ? "host" : "gość"}
+                {room.incognito && " · incognito"}
+                {` · rozmówcy: ${room.connected_peers}`}
+              </span>
+            </button>
+            <Button
+              variant="ghost"
+              size="sm"
+              className="h-6 w-6 p-0 text-gray-400 hover:text-red-400"
+              onClick={() => leaveRoom(room)}
+              title="Opuść pokój"
+            >
+              <LogOut className="h-3 w-3" />
+            </Button>
+          </div>
+        ))}
+        <Button
+          variant="ghost"
+          size="sm"
+          className="h-7 w-full justify-start px-1 text-gray-400"
+          onClick={() => window.runtime.EventsEmit("view:change", "connect")}
+        >
+          <Plus className="h-3 w-3 mr-2" />
+          Utwórz lub dołącz do kolejnego
+        </Button>
+        {error && <p className="text-red-400">{error}</p>}
+      </CardContent>
+    </Card>
+  );
+}
@@ -0,0 +1,92 @@
+import React, { useState } from "react";
+import { cn } from "@/lib/utils";
+import { Card, CardHeader, CardTitle, CardContent } from "@/components/ui/card";
+import { Button } from "@/components/ui/button";
+import { Input } from "@/components/ui/input";
+import { Search } from "lucide-react";
+
+// Trafienie z zaszyfrowanej historii (SearchMessages w back-endzie)
+export interface SearchMatch {
+  id: string;
+  room_id: string;
+  sender: string;
+  sender_name?: string;
+  message: string;
+  snippet: string;
+  date_time: string;
+  isLocal: boolean;
+  score: number;
+}
+
+interface SearchCardProps {
+  roomId?: string;
+  className?: string;
+}
+
+export function SearchCard({ roomId, className }: SearchCardProps) {
+  const [query, setQuery] = useState("");
+  const [allRooms, setAllRooms] = useState(false);
+  const [results, setResults] = useState<SearchMatch[] | null>(null);
+  const [error, setError] = useState("");
+
+  const search = () => {
+    setError("");
+    if (query.trim() === "") {
+      setResults(null);
+      return;
+    }
+    window.go.wailsbridge.Bridge.SearchMessages(query, allRooms ? "" : roomId || "", 20)
+      .then((list: SearchMatch[]) => setResults(list || []))
+      .catch((err: unknown) => setError(String(err)));
+  };
+
+  return (
+    <Card className={cn("mt-4 bg-gray-900/60 border-gray-800", className)}>
+      <CardHeader className="pb-2">
+        <CardTitle className="text-sm flex items-center gap-2">
+          <Search className="h-4 w-4" />
+          Szukaj w historii
+        </CardTitle>
+      </CardHeader>
+      <CardContent className="space-y-2 text-xs">
+        <form
+          className="flex gap-2"
+          onSubmit={(e) => {
+            e.preventDefault();
+            search();
+          }}
+        >
+          <Input
+            value={query}
+            onChange={(e) => setQuery(e.target.value)}
+            placeholder="Szukane słowa"
+            className="h-7 text-xs"
+          />
+          <Button type="submit" size="sm" className="h-7 px-2" title="Szukaj">
+            <Search className="h-3 w-3" />
+          </Button>
+        </form>
+        <label className="flex items-center gap-2 text-gray-400">
+          <input type="checkbox" checked={allRooms} onChange={(e) => setAllRooms(e.target.checked)} />
+          Wszystkie pokoje
+        </label>
+        {error && <p className="text-red-400">{error}</p>}
+        {results && results.length === 0 && (
+          <p className="text-gray-500">Brak wyników.</p>
+        )}
+        {results?.map((m) => (
+          <div key={`${m.room_id}-${m.id}`} className="rounded bg-gray-800/60 p-2">
+            <div className="flex justify-between text-gray-400">
+              <span>{m.isLocal ? "Ty" : m.sender_name || m.sender}</span>
+              <span>{m.date_time}</span>
+            </div>
+            <p className="text-gray-200 break-words">{m.snippet}</p>
+            {allRooms && (
+              <p className="font-mono text-gray-500 truncate" title={m.room_id}>{m.room_id}</p>
+            )}
+          </div>
+        ))}
+      </CardContent>
+    </Card>
+  );
+}
@@ -0,0 +1,147 @@
+import React, { useRef, useState } from "react";
+import { cn } from "@/lib/utils";
+import { Card, CardHeader, CardTitle, CardContent } from "@/components/ui/card";
+import { Button } from "@/components/ui/button";
+import { Input } from "@/components/ui/input";
+import { Smile, Plus, Trash2 } from "lucide-react";
+
+// Własny skrót emoji pokoju z podpisanych metadanych hosta
+export interface RoomShortcode {
+  code: string;
+  hash: string;
+  mime: string;
+  size: number;
+  data_url: string;
+}
+
+const SHORTCODE_PATTERN = /:([a-z0-9_+-]{2,32}):/g;
+
+// Zamienia :skrót: w tekście na obrazek z rejestru pokoju
+export function renderShortcodes(text: string, shortcodes: RoomShortcode[]): React.ReactNode {
+  if (shortcodes.length === 0 || !text.includes(":")) {
+    return text;
+  }
+  const byCode = new Map(shortcodes.map((sc) => [sc.code, sc]));
+  const parts: React.ReactNode[] = [];
+  let last = 0;
+  for (const match of text.matchAll(SHORTCODE_PATTERN)) {
+    const sc = byCode.get(match[1]);
+    if (!sc || !sc.data_url || match.index === undefined) continue;
+    parts.push(text.slice(last, match.index));
+    parts.push(
+      <img
+        key={`${match.index}-${sc.code}`}
+        src={sc.data_url}
+        alt={match[0]}
+        title={match[0]}
+        className="inline-block h-6 w-6 align-text-bottom object-contain"
+      />
+    );
+    last = match.index + match[0].length;
+  }
+  if (parts.length === 0) {
+    return text;
+  }
+  parts.push(text.slice(last));
+  return parts;
+}
+
+interface ShortcodesCardProps {
+  shortcodes: RoomShortcode[];
+  isRoomCreator: boolean;
+  className?: string;
+}
+
+export function ShortcodesCard({ shortcodes, isRoomCreator, className }: ShortcodesCardProps) {
+  const [code, setCode] = useState("");
+  const [error, setError] = useState("");
+  const fileRef = useRef<HTMLInputElement>(null);
+
+  if (!isRoomCreator && shortcodes.length === 0) {
+    return null;
+  }
+
+  const addShortcode = (file: File) => {
+    setError("");
+    const reader = new FileReader();
+    reader.onload = () => {
+      window.go.wailsbridge.Bridge.AddRoomShortcode(code, reader.result as string)
+        .then(() => setCode(""))
+        .catch((err: unknown) => setError(String(err)));
+    };
+    reader.readAsDataURL(file);
+  };
+
+  const removeShortcode = (sc: RoomShortcode) => {
+    window.go.wailsbridge.Bridge.RemoveRoomShortcode(sc.code)
+      .catch((err: unknown) => setError(String(err)));
+  };
+
+  return (
+    <Card className={cn("mt-4 bg-gray-900/60 border-gray-800", className)}>
+      <CardHeader className="pb-2">
+        <CardTitle className="text-sm flex items-center gap-2">
+          <Smile className="h-4 w-4" />
+          Skróty pokoju
+        </CardTitle>
+      </CardHeader>
+      <CardContent className="space-y-2 text-xs">
+        {shortcodes.length === 0 && (
+          <p className="text-gray-500">Brak własnych skrótów.</p>
+        )}
+        {shortcodes.map((sc) => (
+          <div key={sc.code} className="flex items-center gap-2">
+            {sc.data_url ? (
+              <img src={sc.data_url} alt={`:${sc.code}:`} className="h-5 w-5 object-contain" />
+            ) : (
+              <span className="h-5 w-5 rounded bg-gray-800" title="Pobieranie obrazka od hosta" />
+            )}
+            <span className="flex-1 font-mono text-gray-300">:{sc.code}:</span>
+            {isRoomCreator && (
+              <Button
+                variant="ghost"
+                size="sm"
+                className="h-6 w-6 p-0 text-gray-400 hover:text-red-400"
+                onClick={() => removeShortcode(sc)}
+                title="Usuń skrót"
+              >
+                <Trash2 className="h-3 w-3" />
+              </Button>
+            )}
+          </div>
+        ))}
+        {isRoomCreator && (
+          <div className="flex gap-2 pt-1">
+            <Input
+              value={code}
+              onChange={(e) => setCode(e.target.value)}
+              placeholder=":skrot:"
+              className="h-7 text-xs"
+            />
+            <Button
+              size="sm"
+              className="h-7 px-2"
+              disabled={code.trim() === ""}
+              onClick={() => fileRef.current?.click()}
+              title="Wybierz obrazek (PNG, GIF, WebP, JPEG do 64 KB)"
+            >
+              <Plus className="h-3 w-3" />
+            </Button>
+            <input
+              ref={fileRef}
+              type="file"
+              accept="image/png,image/gif,image/webp,image/jpeg"
+              className="hidden"
+              onChange={(e) => {
+                const file = e.target.files?.[0];
+                if (file) addShortcode(file);
+                e.target.value = "";
+              }}
+            />
+          </div>
+        )}
+        {error && <p className="text-red-400">{error}</p>}
+      </CardContent>
+    </Card>
+  );
+}
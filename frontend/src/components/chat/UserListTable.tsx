@@ -1,21 +1,48 @@
 import React from "react";
 import { cn } from "@/lib/utils";
 import { Card, CardHeader, CardTitle, CardContent } from "@/components/ui/card";
-import { Users, User, Shield } from "lucide-react";
+import { Users, User, Shield, UserX, Ban, Star, Eraser } from "lucide-react";
 
 // Definiujemy interfejs dla użytkownika czatu
 export interface ChatUser {
   id: string;
   nickname: string;
   isLocal: boolean;
+  status?: string; // Z podpisanego profilu
+  avatar?: string; // data URL awatara z profilu
+  presence?: string; // online, away albo dnd
+  role?: string; // host, moderator albo member
+  offline?: boolean; // połączony, ale od dłuższej chwili milczy
 }
 
+const roleLabels: Record<string, string> = {
+  host: "host",
+  moderator: "moderator",
+};
+
+const presenceDots: Record<string, string> = {
+  online: "bg-green-500",
+  away: "bg-yellow-500",
+  dnd: "bg-red-500",
+};
+
+const presenceTitles: Record<string, string> = {
+  online: "Dostępny",
+  away: "Zaraz wracam",
+  dnd: "Nie przeszkadzać",
+};
+
 interface UserListTableProps {
   users: ChatUser[];
   className?: string;
+  onKick?: (id: string) => void; // Tylko u hosta pokoju
+  onBan?: (id: string) => void;
+  onToggleModerator?: (id: string, moderator: boolean) => void; // Tylko host
+  ownDevices?: string[]; // Połączone urządzenia z naszą tożsamością
+  onWipe?: (id: string) => void; // Tylko urządzenie główne
 }
 
-export function UserListTable({ users, className }: UserListTableProps) {
+export function UserListTable({ users, className, onKick, onBan, onToggleModerator, ownDevices, onWipe }: UserListTableProps) {
   return (
     <Card className={cn("w-full", className)}>
       <CardHeader className="py-3">
@@ -41,19 +68,76 @@ export function UserListTable({ users, className }: UserListTableProps) {
                   key={user.id}
                   className={cn(
                     "hover:bg-gray-800/50 transition-colors",
-                    user.isLocal && "text-blue-400"
+                    user.isLocal && "text-blue-400",
+                    user.offline && "opacity-60"
                   )}
                 >
                   <td className="p-2 font-medium flex items-center">
-                    {user.isLocal ? (
+                    <span
+                      className={cn(
+                        "h-2 w-2 rounded-full mr-1.5 flex-shrink-0",
+                        user.offline ? "bg-gray-500" : presenceDots[user.presence || "online"]
+                      )}
+                      title={user.offline ? "Brak kontaktu" : presenceTitles[user.presence || "online"]}
+                    />
+                    {user.avatar ? (
+                      <img src={user.avatar} alt="" className="h-5 w-5 mr-1.5 rounded-full object-cover" />
+                    ) : user.isLocal ? (
                       <Shield className="h-3.5 w-3.5 mr-1.5 text-blue-400" />
                     ) : (
                       <User className="h-3.5 w-3.5 mr-1.5 text-gray-500" />
                     )}
-                    {user.nickname} {user.isLocal && <span className="text-blue-400 text-xs ml-1">(Ty)</span>}
+                    <span className="flex flex-col">
+                      <span>
+                        {user.nickname} {user.isLocal && <span className="text-blue-400 text-xs ml-1">(Ty)</span>}
+                        {user.role && roleLabels[user.role] && (
+                          <span className="text-xs font-normal text-yellow-500 ml-1">{roleLabels[user.role]}</span>
+                        )}
+                      </span>
+                      {user.status && <span className="text-xs font-normal text-gray-500">{user.status}</span>}
+                    </span>
                   </td>
                   <td className="p-2 font-mono text-xs text-gray-400">
                     {user.id.substring(0, 8)}...
+                    {onToggleModerator && !user.isLocal && (
+                      <button
+                        onClick={() => onToggleModerator(user.id, user.role !== "moderator")}
+                        className={cn(
+                          "ml-2 align-middle hover:text-yellow-400",
+                          user.role === "moderator" ? "text-yellow-500" : "text-gray-500"
+                        )}
+                        title={user.role === "moderator" ? "Odbierz rolę moderatora" : "Mianuj moderatorem"}
+                      >
+                        <Star className="h-3.5 w-3.5" />
+                      </button>
+                    )}
+                    {onKick && !user.isLocal && user.role !== "host" && (
+                      <button
+                        onClick={() => onKick(user.id)}
+                        className="ml-2 text-gray-500 hover:text-red-400 align-middle"
+                        title="Usuń z pokoju"
+                      >
+                        <UserX className="h-3.5 w-3.5" />
+                      </button>
+                    )}
+                    {onBan && !user.isLocal && user.role !== "host" && (
+                      <button
+                        onClick={() => onBan(user.id)}
+                        className="ml-1 text-gray-500 hover:text-red-400 align-middle"
+                        title="Zablokuj w pokoju"
+                      >
+                        <Ban className="h-3.5 w-3.5" />
+                      </button>
+                    )}
+                    {onWipe && ownDevices?.includes(user.id) && (
+                      <button
+                        onClick={() => onWipe(user.id)}
+                        className="ml-1 text-gray-500 hover:text-red-400 align-middle"
+                        title="Wyczyść to urządzenie zdalnie"
+                      >
+                        <Eraser className="h-3.5 w-3.5" />
+                      </button>
+                    )}
                   </td>
                 </tr>
               ))}
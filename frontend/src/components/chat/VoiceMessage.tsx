@@ -0,0 +1,75 @@
+import React from "react";
+import { Play, Square } from "lucide-react";
+import { cn } from "@/lib/utils";
+
+interface VoiceMessageProps {
+  mediaId?: string;
+  mediaUrl?: string;
+  waveform?: number[];
+  durationMs?: number;
+  // Odtwarzanie w back-endzie (ffplay); bez niego zostaje element <audio>
+  nativePlayback: boolean;
+  playing: boolean;
+}
+
+const formatDuration = (ms: number) => {
+  const seconds = Math.round(ms / 1000);
+  return `${Math.floor(seconds / 60)}:${String(seconds % 60).padStart(2, "0")}`;
+};
+
+// Przebieg głośności policzony przez back-end (0-255 na słupek)
+function Waveform({ values, active }: { values: number[]; active: boolean }) {
+  return (
+    <div className="flex items-center gap-px h-8">
+      {values.map((v, i) => (
+        <div
+          key={i}
+          className={cn("w-1 rounded-sm", active ? "bg-blue-400" : "bg-gray-400")}
+          style={{ height: `${Math.max(8, (v / 255) * 100)}%` }}
+        />
+      ))}
+    </div>
+  );
+}
+
+export function VoiceMessage({ mediaId, mediaUrl, waveform, durationMs, nativePlayback, playing }: VoiceMessageProps) {
+  const toggle = async () => {
+    try {
+      if (playing) {
+        await window.go.wailsbridge.Bridge.StopVoicePlayback();
+      } else {
+        await window.go.wailsbridge.Bridge.PlayVoiceMessage(mediaId!);
+      }
+    } catch (error) {
+      console.error("Błąd odtwarzania wiadomości głosowej:", error);
+    }
+  };
+
+  if (!nativePlayback || !mediaId) {
+    return (
+      <div className="mt-1 space-y-1">
+        {waveform && waveform.length > 0 && <Waveform values={waveform} active={false} />}
+        <audio controls src={mediaUrl} className="max-w-full">
+          Twoja przeglądarka nie obsługuje elementu audio.
+        </audio>
+      </div>
+    );
+  }
+
+  return (
+    <div className="flex items-center gap-2 mt-1">
+      <button
+        type="button"
+        onClick={toggle}
+        className="rounded-full bg-gray-700 hover:bg-gray-600 p-2"
+        title={playing ? "Zatrzymaj" : "Odtwórz"}
+      >
+        {playing ? <Square className="h-4 w-4" /> : <Play className="h-4 w-4" />}
+      </button>
+      {waveform && waveform.length > 0 && <Waveform values={waveform} active={playing} />}
+      {durationMs !== undefined && (
+        <span className="text-xs text-gray-400">{formatDuration(durationMs)}</span>
+      )}
+    </div>
+  );
+}
@@ -15,8 +15,18 @@ declare global {
   }
 }
 
+// Zaproszenie z linku execp2p://join/
+export interface RoomInvite {
+  room_id: string;
+  access_key: string;
+  address?: string;
+}
+
 interface ConnectViewProps {
   onSuccess?: () => void;
+  invite?: RoomInvite | null;
+  // zaproszenie przyjęte albo odrzucone; nie wypełnia już formularza
+  onInviteHandled?: () => void;
 }
 
 // Etapy dołączania do pokoju
@@ -29,9 +39,10 @@ enum JoinSteps {
   ERROR = 5
 }
 
-export function ConnectView({ onSuccess }: ConnectViewProps) {
+export function ConnectView({ onSuccess, invite, onInviteHandled }: ConnectViewProps) {
   // Tworzenie pokoju
   const [creatingRoom, setCreatingRoom] = useState(false);
+  const [incognito, setIncognito] = useState(false);
   const [createdRoomInfo, setCreatedRoomInfo] = useState<{room_id: string, access_key: string, listen_port?: number} | null>(null);
   
   // Dołączanie do pokoju
@@ -40,6 +51,18 @@ export function ConnectView({ onSuccess }: ConnectViewProps) {
   const [joinStep, setJoinStep] = useState<JoinSteps>(JoinSteps.ENTER_ROOM_ID);
   const [foundRoomInfo, setFoundRoomInfo] = useState<{users_count: number, address?: string} | null>(null);
   const [error, setError] = useState<string | null>(null);
+  const [fromInvite, setFromInvite] = useState(false);
+
+  // Zaproszenie z linku wypełnia formularz; dołączenie trzeba potwierdzić
+  useEffect(() => {
+    if (!invite) return;
+    setRoomId(invite.room_id);
+    setAccessKey(invite.access_key);
+    setFoundRoomInfo(invite.address ? { users_count: 0, address: invite.address } : null);
+    setFromInvite(true);
+    setError(null);
+    setJoinStep(JoinSteps.ENTER_ACCESS_KEY);
+  }, [invite]);
 
   // Nasłuchiwanie zdarzeń bezpieczeństwa
   useEffect(() => {
@@ -58,7 +81,9 @@ export function ConnectView({ onSuccess }: ConnectViewProps) {
       setCreatingRoom(true);
       
       // Wywołanie funkcji z Wails
-      const result = await window.go.wailsbridge.Bridge.CreateRoom();
+      const result = incognito
+        ? await window.go.wailsbridge.Bridge.CreateIncognitoRoom()
+        : await window.go.wailsbridge.Bridge.CreateRoom();
       
       // Zapisz informacje o utworzonym pokoju, wraz z portem nasłuchiwania
       setCreatedRoomInfo({
@@ -129,6 +154,7 @@ export function ConnectView({ onSuccess }: ConnectViewProps) {
       
       // Jeśli dotarliśmy tutaj, połączenie się powiodło
       setJoinStep(JoinSteps.CONNECTED);
+      if (fromInvite && onInviteHandled) onInviteHandled();
       
       // Przejdź do widoku czatu
       if (onSuccess) onSuccess();
@@ -146,6 +172,8 @@ export function ConnectView({ onSuccess }: ConnectViewProps) {
     setError(null);
     setFoundRoomInfo(null);
     setAccessKey("");
+    if (fromInvite && onInviteHandled) onInviteHandled();
+    setFromInvite(false);
   };
 
   // Renderowanie różnych etapów procesu dołączania
@@ -195,10 +223,18 @@ export function ConnectView({ onSuccess }: ConnectViewProps) {
                 <div className="bg-blue-500/20 rounded-full p-2 mr-3">
                   <Search className="h-5 w-5 text-blue-400" />
                 </div>
-                <div>
-                  <p className="text-sm font-semibold text-blue-300">Znaleziono pokój!</p>
-                  <p className="text-xs text-gray-300 mt-1">Aktywni użytkownicy: {foundRoomInfo?.users_count}</p>
-                </div>
+                {fromInvite ? (
+                  <div>
+                    <p className="text-sm font-semibold text-blue-300">Zaproszenie do pokoju</p>
+                    <p className="text-xs text-gray-300 mt-1 break-all">{roomId}</p>
+                    <p className="text-xs text-gray-400 mt-1">Dołącz tylko, jeśli wiesz, od kogo jest link.</p>
+                  </div>
+                ) : (
+                  <div>
+                    <p className="text-sm font-semibold text-blue-300">Znaleziono pokój!</p>
+                    <p className="text-xs text-gray-300 mt-1">Aktywni użytkownicy: {foundRoomInfo?.users_count}</p>
+                  </div>
+                )}
               </div>
             </div>
             
@@ -296,6 +332,20 @@ export function ConnectView({ onSuccess }: ConnectViewProps) {
             </CardDescription>
           </CardHeader>
           <CardContent>
+            <label className="flex items-start gap-2 mb-3 text-sm text-gray-300">
+              <input
+                type="checkbox"
+                className="mt-1"
+                checked={incognito}
+                onChange={(e) => setIncognito(e.target.checked)}
+              />
+              <span>
+                Pokój incognito
+                <span className="block text-xs text-gray-500">
+                  Nic o pokoju nie trafi na dysk ani do logów, także u pozostałych uczestników.
+                </span>
+              </span>
+            </label>
             <Button 
               onClick={handleCreate} 
               disabled={creatingRoom || joinStep === JoinSteps.CONNECTING}
@@ -0,0 +1,73 @@
+import React from "react";
+import { Card, CardHeader, CardTitle, CardContent, CardFooter, CardDescription } from "@/components/ui/card";
+import { Button } from "@/components/ui/button";
+import { Bug } from "lucide-react";
+
+interface CrashData {
+  time: number;
+  // goroutine, w której wystąpił błąd, np. network.readLoop
+  where: string;
+  panic: string;
+  version: string;
+  platform: string;
+  // obsługa trwa dalej, pokoje nie zostały opuszczone
+  recovered: boolean;
+  // plik raportu, pusty gdy nie zapisano
+  report: string;
+  rooms: string[];
+}
+
+// Powiadomienie o błędzie wewnętrznym aplikacji (panice) z miejscem zapisu raportu
+export function CrashNotice() {
+  const [crash, setCrash] = React.useState<CrashData | null>(null);
+
+  React.useEffect(() => {
+    window.runtime.EventsOn("app:crash", (data: CrashData) => setCrash(data));
+    return () => {
+      window.runtime.EventsOff("app:crash");
+    };
+  }, []);
+
+  if (!crash) {
+    return null;
+  }
+
+  return (
+    <div className="fixed bottom-4 right-4 z-50 max-w-md w-full">
+      <Card className="border-red-600 bg-gray-900">
+        <CardHeader>
+          <CardTitle className="flex items-center text-red-400">
+            <Bug className="h-5 w-5 mr-2" />
+            Błąd wewnętrzny aplikacji
+          </CardTitle>
+          <CardDescription className="text-gray-300">
+            {crash.rooms.length > 0
+              ? `Połączenia zostały zamknięte, a pokoje opuszczone (${crash.rooms.length}). Możesz do nich wrócić.`
+              : "Aplikacja działa dalej."}
+          </CardDescription>
+        </CardHeader>
+        <CardContent className="space-y-2 text-xs">
+          <div className="font-mono break-all text-gray-400">
+            {crash.where}: {crash.panic}
+          </div>
+          {crash.report ? (
+            <div>
+              Raport (stos wywołań, wersja {crash.version}, {crash.platform}) zapisano w:
+              <div className="font-mono break-all bg-gray-950 p-2 rounded-md border border-gray-800 mt-1">
+                {crash.report}
+              </div>
+              Nie jest nigdzie wysyłany; możesz go dołączyć do zgłoszenia błędu.
+            </div>
+          ) : (
+            <div className="text-gray-500">Raportu nie zapisano na dysku (tryb bez zapisu danych).</div>
+          )}
+        </CardContent>
+        <CardFooter className="flex justify-end">
+          <Button variant="outline" size="sm" onClick={() => setCrash(null)}>
+            Zamknij
+          </Button>
+        </CardFooter>
+      </Card>
+    </div>
+  );
+}
@@ -0,0 +1,236 @@
+import React from "react";
+import { Card, CardHeader, CardTitle, CardContent, CardDescription } from "@/components/ui/card";
+import { Button } from "@/components/ui/button";
+import { Activity, RefreshCw, Trash2, Network, Handshake, ListOrdered, HardDrive } from "lucide-react";
+import { LogCard } from "./LogCard";
+import { MetricsCard, MetricsData } from "./MetricsCard";
+
+interface JoinMethodStats {
+  method: string;
+  attempts: number;
+  successes: number;
+  failures: number;
+  success_rate: number;
+}
+
+interface DiagnosticsData {
+  started_at: number;
+  uptime_seconds: number;
+  counters: Record<string, number>;
+  join_methods: JoinMethodStats[];
+  handshake_successes: number;
+  handshake_failures: number;
+  handshake_failure_rate: number;
+}
+
+interface MediaCacheStats {
+  memory_items: number;
+  memory_size: number;
+  memory_limit: number;
+  disk_items: number;
+  disk_size: number;
+  disk_limit: number;
+}
+
+const formatMiB = (bytes: number) => `${(bytes / (1 << 20)).toFixed(1)} MiB`;
+
+// Czytelne nazwy metod łączenia
+const methodLabels: Record<string, string> = {
+  direct: "Bezpośredni adres",
+  local_discovery: "Autodetekcja (mDNS/DHT/broadcast)",
+  localhost: "Lokalne instancje",
+  signaling: "Serwer sygnalizacyjny",
+};
+
+const formatRate = (rate: number) => `${(rate * 100).toFixed(0)}%`;
+
+export function DiagnosticsView() {
+  const [data, setData] = React.useState<DiagnosticsData | null>(null);
+  const [media, setMedia] = React.useState<MediaCacheStats | null>(null);
+  const [metrics, setMetrics] = React.useState<MetricsData | null>(null);
+  const [loading, setLoading] = React.useState(false);
+
+  const refresh = async () => {
+    try {
+      setLoading(true);
+      const result = await window.go.wailsbridge.Bridge.GetDiagnostics();
+      setData(result as DiagnosticsData);
+      setMetrics((await window.go.wailsbridge.Bridge.GetMetrics()) as MetricsData);
+      setMedia((await window.go.wailsbridge.Bridge.GetMediaCacheStats()) as MediaCacheStats);
+    } catch (error) {
+      console.error("Błąd podczas pobierania diagnostyki:", error);
+    } finally {
+      setLoading(false);
+    }
+  };
+
+  const reset = async () => {
+    await window.go.wailsbridge.Bridge.ResetDiagnostics();
+    refresh();
+  };
+
+  const clearMedia = async () => {
+    try {
+      await window.go.wailsbridge.Bridge.ClearMediaCache();
+    } catch (error) {
+      console.error("Błąd podczas czyszczenia multimediów:", error);
+    }
+    refresh();
+  };
+
+  React.useEffect(() => {
+    refresh();
+    const interval = setInterval(refresh, 5000);
+    return () => clearInterval(interval);
+  }, []);
+
+  const counters = Object.entries(data?.counters || {}).sort(([a], [b]) => a.localeCompare(b));
+
+  return (
+    <div className="p-6 space-y-6 max-w-3xl mx-auto overflow-y-auto h-full">
+      <div className="flex items-center justify-between mb-6">
+        <h2 className="text-2xl font-bold flex items-center">
+          <Activity className="h-6 w-6 mr-2 text-blue-400" />
+          Diagnostyka
+        </h2>
+        <div className="flex gap-2">
+          <Button variant="outline" size="sm" onClick={refresh} disabled={loading}>
+            <RefreshCw className={loading ? "h-4 w-4 animate-spin" : "h-4 w-4"} />
+          </Button>
+          <Button variant="outline" size="sm" onClick={reset}>
+            <Trash2 className="h-4 w-4" />
+          </Button>
+        </div>
+      </div>
+
+      <p className="text-sm text-gray-400">
+        Liczniki są przechowywane wyłącznie lokalnie i nigdy nie są wysyłane przez sieć.
+        {data && ` Zbierane od ${Math.floor(data.uptime_seconds / 60)} min.`}
+      </p>
+
+      <Card className="mb-6">
+        <CardHeader>
+          <CardTitle className="flex items-center">
+            <Network className="h-5 w-5 mr-2 text-blue-400" />
+            Metody łączenia
+          </CardTitle>
+          <CardDescription>
+            Skuteczność poszczególnych metod dołączania do pokoju.
+          </CardDescription>
+        </CardHeader>
+        <CardContent>
+          {data && data.join_methods && data.join_methods.length > 0 ? (
+            <table className="w-full text-sm">
+              <thead className="text-gray-400">
+                <tr>
+                  <th className="text-left py-1">Metoda</th>
+                  <th className="text-right py-1">Próby</th>
+                  <th className="text-right py-1">Sukcesy</th>
+                  <th className="text-right py-1">Błędy</th>
+                  <th className="text-right py-1">Skuteczność</th>
+                </tr>
+              </thead>
+              <tbody>
+                {data.join_methods.map((m) => (
+                  <tr key={m.method} className="border-t border-gray-700">
+                    <td className="py-1">{methodLabels[m.method] || m.method}</td>
+                    <td className="text-right py-1">{m.attempts}</td>
+                    <td className="text-right py-1 text-green-400">{m.successes}</td>
+                    <td className="text-right py-1 text-red-400">{m.failures}</td>
+                    <td className="text-right py-1">{formatRate(m.success_rate)}</td>
+                  </tr>
+                ))}
+              </tbody>
+            </table>
+          ) : (
+            <div className="text-gray-500 text-sm">Brak prób łączenia w tej sesji.</div>
+          )}
+        </CardContent>
+      </Card>
+
+      <MetricsCard metrics={metrics} />
+
+      <Card className="mb-6">
+        <CardHeader>
+          <CardTitle className="flex items-center">
+            <Handshake className="h-5 w-5 mr-2 text-blue-400" />
+            Handshake
+          </CardTitle>
+        </CardHeader>
+        <CardContent className="space-y-2 text-sm">
+          <div className="flex justify-between">
+            <span className="text-gray-400">Udane:</span>
+            <span className="text-green-400">{data?.handshake_successes ?? 0}</span>
+          </div>
+          <div className="flex justify-between">
+            <span className="text-gray-400">Nieudane:</span>
+            <span className="text-red-400">{data?.handshake_failures ?? 0}</span>
+          </div>
+          <div className="flex justify-between">
+            <span className="text-gray-400">Odsetek błędów:</span>
+            <span>{formatRate(data?.handshake_failure_rate ?? 0)}</span>
+          </div>
+        </CardContent>
+      </Card>
+
+      <Card className="mb-6">
+        <CardHeader>
+          <CardTitle className="flex items-center justify-between">
+            <span className="flex items-center">
+              <HardDrive className="h-5 w-5 mr-2 text-blue-400" />
+              Multimedia
+            </span>
+            <Button variant="outline" size="sm" onClick={clearMedia}>
+              <Trash2 className="h-4 w-4 mr-1" />
+              Wyczyść
+            </Button>
+          </CardTitle>
+          <CardDescription>
+            Zdjęcia i nagrania głosowe; na dysku są zaszyfrowane, najdawniej oglądane usuwane są pierwsze.
+          </CardDescription>
+        </CardHeader>
+        <CardContent className="space-y-2 text-sm">
+          <div className="flex justify-between">
+            <span className="text-gray-400">W pamięci:</span>
+            <span>
+              {media?.memory_items ?? 0} ({formatMiB(media?.memory_size ?? 0)} z {formatMiB(media?.memory_limit ?? 0)})
+            </span>
+          </div>
+          <div className="flex justify-between">
+            <span className="text-gray-400">Na dysku:</span>
+            <span>
+              {media && media.disk_limit > 0
+                ? `${media.disk_items} (${formatMiB(media.disk_size)} z ${formatMiB(media.disk_limit)})`
+                : "wyłączone"}
+            </span>
+          </div>
+        </CardContent>
+      </Card>
+
+      <LogCard />
+
+      <Card>
+        <CardHeader>
+          <CardTitle className="flex items-center">
+            <ListOrdered className="h-5 w-5 mr-2 text-blue-400" />
+            Wszystkie liczniki
+          </CardTitle>
+        </CardHeader>
+        <CardContent>
+          {counters.length > 0 ? (
+            <ul className="space-y-1 font-mono text-xs">
+              {counters.map(([name, value]) => (
+                <li key={name} className="flex justify-between">
+                  <span className="text-gray-400">{name}</span>
+                  <span>{value}</span>
+                </li>
+              ))}
+            </ul>
+          ) : (
+            <div className="text-gray-500 text-sm">Brak danych.</div>
+          )}
+        </CardContent>
+      </Card>
+    </div>
+  );
+}
@@ -0,0 +1,129 @@
+import React from "react";
+import { Card, CardHeader, CardTitle, CardContent, CardDescription } from "@/components/ui/card";
+import { ScrollText } from "lucide-react";
+
+interface LogEntry {
+  time: string;
+  time_formatted: string;
+  level: string;
+  msg: string;
+  attrs?: Record<string, unknown>;
+}
+
+// ile wpisów pokazujemy naraz
+const shownEntries = 300;
+
+const levelRank: Record<string, number> = { debug: 0, info: 1, warn: 2, error: 3 };
+
+// "WARN+2" i podobne poziomy pośrednie liczą się jako najbliższy niższy
+const levelKey = (level: string) => level.toLowerCase().replace(/[+-]\d+$/, "");
+
+const rank = (level: string) => levelRank[levelKey(level)] ?? 1;
+
+const levelColors: Record<string, string> = {
+  debug: "text-gray-500",
+  info: "text-blue-400",
+  warn: "text-yellow-400",
+  error: "text-red-400",
+};
+
+const formatAttrs = (attrs?: Record<string, unknown>) =>
+  Object.entries(attrs || {})
+    .map(([key, value]) => `${key}=${typeof value === "string" ? value : JSON.stringify(value)}`)
+    .join(" ");
+
+// Podgląd ostatnich wpisów dziennika, także gdy nie jest on nigdzie zapisywany
+export function LogCard() {
+  const [level, setLevel] = React.useState("info");
+  const [entries, setEntries] = React.useState<LogEntry[]>([]);
+  // poziom samego dziennika, pusty: nigdzie nie jest zapisywany
+  const [logLevel, setLogLevel] = React.useState("");
+  const [error, setError] = React.useState<string | null>(null);
+
+  React.useEffect(() => {
+    window.go.wailsbridge.Bridge.GetLogLevel().then(setLogLevel);
+  }, []);
+
+  // Zmiana poziomu działa od razu, bez opuszczania pokoju, i zostaje po restarcie
+  const changeLogLevel = async (value: string) => {
+    try {
+      setLogLevel(value);
+      await window.go.wailsbridge.Bridge.SetLogLevel(value);
+      setError(null);
+    } catch (e) {
+      setError(String(e));
+    }
+  };
+
+  React.useEffect(() => {
+    window.go.wailsbridge.Bridge.GetRecentLogs(level, shownEntries)
+      .then((list: LogEntry[]) => setEntries(list))
+      .catch((error: unknown) => console.error("Błąd podczas pobierania dziennika:", error));
+
+    window.runtime.EventsOn("log:entry", (entry: LogEntry) => {
+      if (rank(entry.level) < levelRank[level]) {
+        return;
+      }
+      setEntries((current) => [...current, entry].slice(-shownEntries));
+    });
+    return () => {
+      window.runtime.EventsOff("log:entry");
+    };
+  }, [level]);
+
+  return (
+    <Card className="mb-6">
+      <CardHeader>
+        <CardTitle className="flex items-center justify-between">
+          <span className="flex items-center">
+            <ScrollText className="h-5 w-5 mr-2 text-blue-400" />
+            Dziennik
+          </span>
+          <select
+            value={level}
+            onChange={(e) => setLevel(e.target.value)}
+            className="bg-gray-900 border border-gray-700 rounded px-2 py-1 text-sm"
+          >
+            <option value="debug">Wszystko</option>
+            <option value="info">Informacje</option>
+            <option value="warn">Ostrzeżenia</option>
+            <option value="error">Błędy</option>
+          </select>
+        </CardTitle>
+        <CardDescription>
+          Ostatnie zdarzenia aplikacji, np. przyczyny nieudanych połączeń. Trzymane tylko w pamięci.
+        </CardDescription>
+      </CardHeader>
+      <CardContent className="space-y-3">
+        <div className="flex items-center justify-between text-sm">
+          <span className="text-gray-400">Poziom dziennika (zapisywany w konfiguracji):</span>
+          <select
+            value={logLevel}
+            onChange={(e) => changeLogLevel(e.target.value)}
+            className="bg-gray-900 border border-gray-700 rounded px-2 py-1 text-sm"
+          >
+            {logLevel === "" && <option value="">wyłączony</option>}
+            <option value="debug">debug (szczegółowy)</option>
+            <option value="info">info</option>
+            <option value="warn">warn</option>
+            <option value="error">error</option>
+          </select>
+        </div>
+        {error && <p className="text-sm text-red-400">{error}</p>}
+        {entries.length > 0 ? (
+          <ul className="space-y-1 font-mono text-xs max-h-80 overflow-y-auto">
+            {[...entries].reverse().map((e, i) => (
+              <li key={`${e.time}-${i}`} className="break-all">
+                <span className="text-gray-500">{e.time_formatted}</span>{" "}
+                <span className={levelColors[levelKey(e.level)] || ""}>{e.level}</span>{" "}
+                <span>{e.msg}</span> <span className="text-gray-400">{formatAttrs(e.attrs)}</span>
+              </li>
+            ))}
+          </ul>
+        ) : (
+          <div className="text-gray-500 text-sm">Brak wpisów.</div>
+        )}
+      </CardContent>
+    </Card>
+  );
+}
@@ -0,0 +1,91 @@
+import { Card, CardHeader, CardTitle, CardContent, CardDescription } from "@/components/ui/card";
+import { Gauge } from "lucide-react";
+
+interface MethodStats {
+  method: string;
+  attempts: number;
+  successes: number;
+  failures: number;
+  success_rate: number;
+}
+
+export interface MetricsData {
+  gauges: Record<string, number>;
+  bytes_sent: number;
+  bytes_received: number;
+  messages_sent: number;
+  messages_received: number;
+  handshakes: number;
+  key_rotations: number;
+  connect_latency: { count: number; average: number; max: number };
+  discovery_methods: MethodStats[];
+}
+
+const discoveryLabels: Record<string, string> = {
+  mdns: "mDNS",
+  dht: "DHT",
+  broadcast: "Broadcast",
+};
+
+const formatBytes = (bytes: number) => {
+  if (bytes < 1024) return `${bytes} B`;
+  if (bytes < 1 << 20) return `${(bytes / 1024).toFixed(1)} KiB`;
+  return `${(bytes / (1 << 20)).toFixed(1)} MiB`;
+};
+
+const formatSeconds = (seconds: number) =>
+  seconds < 1 ? `${Math.round(seconds * 1000)} ms` : `${seconds.toFixed(2)} s`;
+
+// Ruch, bieżący stan i czas łączenia; te same wartości demon podaje na /metrics
+export function MetricsCard({ metrics }: { metrics: MetricsData | null }) {
+  const latency = metrics?.connect_latency;
+  const rows: [string, string][] = [
+    ["Połączeni uczestnicy:", String(metrics?.gauges?.["peers.connected"] ?? 0)],
+    ["Aktywne pokoje:", String(metrics?.gauges?.["rooms.active"] ?? 0)],
+    ["Wysłano:", `${formatBytes(metrics?.bytes_sent ?? 0)} (${metrics?.messages_sent ?? 0} wiad.)`],
+    ["Odebrano:", `${formatBytes(metrics?.bytes_received ?? 0)} (${metrics?.messages_received ?? 0} wiad.)`],
+    ["Zmiany kluczy:", String(metrics?.key_rotations ?? 0)],
+    [
+      "Czas łączenia:",
+      latency && latency.count > 0
+        ? `śr. ${formatSeconds(latency.average)}, maks. ${formatSeconds(latency.max)} (${latency.count})`
+        : "brak pomiarów",
+    ],
+  ];
+
+  return (
+    <Card className="mb-6">
+      <CardHeader>
+        <CardTitle className="flex items-center">
+          <Gauge className="h-5 w-5 mr-2 text-blue-400" />
+          Ruch i opóźnienia
+        </CardTitle>
+        <CardDescription>
+          Czas łączenia liczony jest od nawiązania połączenia do ustanowienia szyfrowanego kanału.
+        </CardDescription>
+      </CardHeader>
+      <CardContent className="space-y-2 text-sm">
+        {rows.map(([label, value]) => (
+          <div key={label} className="flex justify-between">
+            <span className="text-gray-400">{label}</span>
+            <span>{value}</span>
+          </div>
+        ))}
+        {metrics && metrics.discovery_methods && metrics.discovery_methods.length > 0 && (
+          <div className="pt-2">
+            <div className="text-gray-400 mb-1">Autodetekcja według metody:</div>
+            {metrics.discovery_methods.map((m) => (
+              <div key={m.method} className="flex justify-between">
+                <span>{discoveryLabels[m.method] || m.method}</span>
+                <span>
+                  <span className="text-green-400">{m.successes}</span> / {m.attempts} (
+                  {(m.success_rate * 100).toFixed(0)}%)
+                </span>
+              </div>
+            ))}
+          </div>
+        )}
+      </CardContent>
+    </Card>
+  );
+}
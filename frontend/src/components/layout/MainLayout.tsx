@@ -8,6 +8,7 @@ type MainLayoutProps = {
   connectionStatus?: {
     connected: boolean;
     secure: boolean;
+    degraded?: boolean;
   };
 };
 
@@ -1,7 +1,7 @@
 import React from "react";
 import { Button } from "@/components/ui/button";
 import { cn } from "@/lib/utils";
-import { MessageSquare, Settings, Link2 } from "lucide-react";
+import { MessageSquare, Settings, Link2, Activity } from "lucide-react";
 
 type NavItem = {
   id: string;
@@ -15,6 +15,7 @@ interface SidebarProps {
   connectionStatus?: {
     connected: boolean;
     secure: boolean;
+    degraded?: boolean;
   };
 }
 
@@ -26,16 +27,19 @@ export function Sidebar({
   const navItems: NavItem[] = [
     { id: 'connect', label: 'Połącz', icon: <Link2 className="h-5 w-5" /> },
     { id: 'chat', label: 'Czat', icon: <MessageSquare className="h-5 w-5" /> },
-    { id: 'settings', label: 'Ustawienia', icon: <Settings className="h-5 w-5" /> }
+    { id: 'settings', label: 'Ustawienia', icon: <Settings className="h-5 w-5" /> },
+    { id: 'diagnostics', label: 'Diagnostyka', icon: <Activity className="h-5 w-5" /> }
   ];
 
   const getStatusClass = () => {
+    if (connectionStatus.degraded) return "bg-orange-900/20 text-orange-500";
     if (connectionStatus.secure) return "bg-green-900/20 text-green-500";
     if (connectionStatus.connected) return "bg-orange-900/20 text-orange-500";
     return "bg-red-900/20 text-red-500";
   };
 
   const getStatusText = () => {
+    if (connectionStatus.degraded) return "Niestabilne";
     if (connectionStatus.secure) return "Bezpieczne";
     if (connectionStatus.connected) return "Łączenie...";
     return "Rozłączono";
@@ -0,0 +1,112 @@
+import React from "react";
+import { Card, CardHeader, CardTitle, CardContent, CardDescription } from "@/components/ui/card";
+import { Button } from "@/components/ui/button";
+import { Input } from "@/components/ui/input";
+import { QrCode, CheckCircle2, AlertTriangle, RefreshCw } from "lucide-react";
+
+interface VerificationQR {
+  payload: string;
+  image: string;
+  fingerprint: string;
+  expires_at: string;
+}
+
+interface VerificationResult {
+  peer_id: string;
+  fingerprint: string;
+  mutual: boolean;
+}
+
+// Weryfikacja tożsamości rozmówcy w cztery oczy: pokaż swój kod, zeskanuj jego
+export function QRVerificationCard() {
+  const [qr, setQr] = React.useState<VerificationQR | null>(null);
+  const [scanned, setScanned] = React.useState("");
+  const [result, setResult] = React.useState<VerificationResult | null>(null);
+  const [error, setError] = React.useState<string | null>(null);
+
+  const showCode = async () => {
+    try {
+      setError(null);
+      const code = await window.go.wailsbridge.Bridge.GetVerificationQR("");
+      setQr(code as VerificationQR);
+    } catch (e) {
+      setError(String(e));
+    }
+  };
+
+  const verifyScanned = async () => {
+    try {
+      setError(null);
+      setResult(null);
+      const res = await window.go.wailsbridge.Bridge.VerifyScannedQR(scanned);
+      setResult(res as VerificationResult);
+      setScanned("");
+    } catch (e) {
+      setError(String(e));
+    }
+  };
+
+  return (
+    <Card>
+      <CardHeader>
+        <CardTitle className="flex items-center">
+          <QrCode className="h-5 w-5 mr-2 text-blue-400" />
+          Weryfikacja Kodem QR
+        </CardTitle>
+        <CardDescription>
+          Gdy jesteście obok siebie: pokaż swój kod rozmówcy i zeskanuj jego kod.
+          Kod jest powiązany z tym pokojem i ważny przez 10 minut.
+        </CardDescription>
+      </CardHeader>
+      <CardContent className="space-y-4">
+        <div className="flex flex-col items-center gap-2">
+          {qr ? (
+            <>
+              <img src={qr.image} alt="Kod QR weryfikacji" className="w-56 h-56 rounded bg-white p-2" />
+              <span className="text-xs text-gray-500">
+                Ważny do {new Date(qr.expires_at).toLocaleTimeString()}
+              </span>
+            </>
+          ) : null}
+          <Button variant="outline" onClick={showCode} className="flex items-center gap-2">
+            {qr ? <RefreshCw className="h-4 w-4" /> : <QrCode className="h-4 w-4" />}
+            {qr ? "Odśwież kod" : "Pokaż mój kod QR"}
+          </Button>
+        </div>
+
+        <div className="space-y-2">
+          <label className="text-sm text-gray-400">Treść zeskanowanego kodu rozmówcy:</label>
+          <div className="flex gap-2">
+            <Input
+              value={scanned}
+              onChange={(e) => setScanned(e.target.value)}
+              placeholder="execp2p-verify:1?..."
+              className="font-mono text-xs"
+            />
+            <Button onClick={verifyScanned} disabled={!scanned.trim()}>
+              Sprawdź
+            </Button>
+          </div>
+        </div>
+
+        {result && (
+          <div className="text-green-400 text-sm flex items-start">
+            <CheckCircle2 className="h-4 w-4 mr-1 mt-0.5 flex-shrink-0" />
+            <span>
+              Tożsamość {result.peer_id.substring(0, 8)}... potwierdzona.
+              {result.mutual
+                ? " Rozmówca widzi również Twój prawidłowy odcisk palca."
+                : " Poproś rozmówcę, aby zeskanował także Twój kod."}
+            </span>
+          </div>
+        )}
+        {error && (
+          <div className="text-red-400 text-sm flex items-start">
+            <AlertTriangle className="h-4 w-4 mr-1 mt-0.5 flex-shrink-0" />
+            <span>Weryfikacja nieudana: {error}</span>
+          </div>
+        )}
+      </CardContent>
+    </Card>
+  );
+}
@@ -0,0 +1,132 @@
+import React from "react";
+import { Card, CardHeader, CardTitle, CardContent, CardFooter, CardDescription } from "@/components/ui/card";
+import { Button } from "@/components/ui/button";
+import { ShieldAlert } from "lucide-react";
+
+export interface SecurityAlertData {
+  peer_id: string;
+  nickname: string;
+  // tożsamość ogłoszona przez rozmówcę
+  fingerprint: string;
+  // identity_changed, certificate_changed albo tls_mismatch
+  reason: string;
+  expected: string;
+  presented: string;
+  since: string;
+  since_formatted: string;
+  // połączenia rozmówcy są odrzucane, nie tylko wiadomości
+  refused: boolean;
+  rejected: boolean;
+}
+
+const titles: Record<string, string> = {
+  identity_changed: "Odcisk palca rozmówcy się zmienił!",
+  certificate_changed: "Certyfikat TLS rozmówcy się zmienił!",
+  tls_mismatch: "Certyfikat TLS nie pasuje do tożsamości!",
+};
+
+function describe(alert: SecurityAlertData): string {
+  const who = alert.nickname || alert.peer_id.substring(0, 8) + "...";
+  switch (alert.reason) {
+    case "identity_changed":
+      return `${who} przedstawia inną tożsamość niż zapamiętana. Może to oznaczać reinstalację aplikacji albo próbę podszycia się (atak MITM).`;
+    case "certificate_changed":
+      return `${who} ma tę samą tożsamość, ale połączenie używa innego certyfikatu TLS niż zapamiętany. Może to oznaczać utratę danych aplikacji albo próbę podszycia się (atak MITM).`;
+    default:
+      return `Połączenie z ${who} przedstawiło certyfikat TLS, którego tożsamość rozmówcy nie podpisała. Ktoś może pośredniczyć w połączeniu (atak MITM).`;
+  }
+}
+
+// Alarm bezpieczeństwa: rozmówca odizolowany po nieudanym sprawdzeniu
+// tożsamości lub certyfikatu czeka na decyzję użytkownika
+export function SecurityAlert() {
+  const [alerts, setAlerts] = React.useState<SecurityAlertData[]>([]);
+  const [error, setError] = React.useState<string | null>(null);
+
+  React.useEffect(() => {
+    const add = (data: SecurityAlertData) => {
+      setAlerts((current) => [...current.filter((a) => a.peer_id !== data.peer_id), data]);
+    };
+    // izolacje sprzed uruchomienia, o których jeszcze nie zdecydowano
+    window.go.wailsbridge.Bridge.GetQuarantinedPeers()
+      .then((list: SecurityAlertData[]) => list.filter((a) => !a.rejected).forEach(add))
+      .catch(() => {});
+    window.runtime.EventsOn("security:alert", (data: SecurityAlertData) => {
+      setError(null);
+      add(data);
+    });
+    return () => {
+      window.runtime.EventsOff("security:alert");
+    };
+  }, []);
+
+  const alert = alerts[0];
+  if (!alert) {
+    return null;
+  }
+
+  const decide = async (accept: boolean) => {
+    try {
+      if (accept) {
+        await window.go.wailsbridge.Bridge.AcceptPeer(alert.peer_id);
+      } else {
+        await window.go.wailsbridge.Bridge.RejectPeer(alert.peer_id);
+      }
+      setError(null);
+      setAlerts((current) => current.slice(1));
+    } catch (e) {
+      setError(String(e));
+    }
+  };
+
+  const certificate = alert.reason !== "identity_changed";
+
+  return (
+    <div className="fixed inset-0 z-50 flex items-center justify-center bg-black/70 p-4">
+      <Card className="max-w-xl w-full border-red-600 bg-gray-900">
+        <CardHeader>
+          <CardTitle className="flex items-center text-red-400">
+            <ShieldAlert className="h-6 w-6 mr-2" />
+            {titles[alert.reason] ?? "Alarm bezpieczeństwa"}
+          </CardTitle>
+          <CardDescription className="text-gray-300">
+            {describe(alert)}
+            {alert.refused ? " Połączenie zostało odrzucone." : " Połączenie trwa, ale wiadomości są wstrzymane."}
+          </CardDescription>
+        </CardHeader>
+        <CardContent className="space-y-3">
+          <div>
+            <div className="text-xs text-gray-400 mb-1">
+              {alert.reason === "tls_mismatch" ? "Certyfikat ogłoszony przez tożsamość" : certificate ? "Zapamiętany certyfikat" : "Zapamiętany odcisk palca"}
+            </div>
+            <div className="bg-gray-950 p-2 rounded-md font-mono text-xs break-all border border-gray-800">
+              {alert.expected || "—"}
+            </div>
+          </div>
+          <div>
+            <div className="text-xs text-gray-400 mb-1">
+              {alert.reason === "tls_mismatch" ? "Certyfikat połączenia" : certificate ? "Nowy certyfikat" : "Nowy odcisk palca"}
+            </div>
+            <div className="bg-gray-950 p-2 rounded-md font-mono text-xs break-all border border-red-800 text-red-300">
+              {alert.presented || "—"}
+            </div>
+          </div>
+          <p className="text-xs text-gray-500">Od {alert.since_formatted}</p>
+          <p className="text-sm text-gray-400">
+            Zaakceptuj tylko wtedy, gdy potwierdzisz zmianę z rozmówcą innym kanałem (telefon, spotkanie). Odrzucenie
+            rozłącza rozmówcę i odrzuca jego kolejne połączenia.
+          </p>
+          {error && <p className="text-sm text-red-400">{error}</p>}
+        </CardContent>
+        <CardFooter className="flex justify-end gap-2">
+          <Button variant="outline" onClick={() => decide(true)}>
+            Akceptuj
+          </Button>
+          <Button variant="destructive" onClick={() => decide(false)}>
+            Odrzuć
+          </Button>
+        </CardFooter>
+      </Card>
+    </div>
+  );
+}
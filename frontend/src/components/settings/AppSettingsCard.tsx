@@ -0,0 +1,193 @@
+import React from "react";
+import { Card, CardHeader, CardTitle, CardContent, CardDescription } from "@/components/ui/card";
+import { Button } from "@/components/ui/button";
+import { Input } from "@/components/ui/input";
+import { SlidersHorizontal } from "lucide-react";
+
+interface AppSettings {
+  network: { min_port: number; max_port: number; max_peers: number };
+  discovery: {
+    enable_mdns: boolean;
+    enable_dht: boolean;
+    enable_broadcast: boolean;
+    signaling_server: string;
+    when_occupied: string;
+  };
+  room: { nickname: string; incognito: boolean; rejoin: boolean };
+  trust: { on_fingerprint_change: string; require_verified: boolean; strict_tls: boolean };
+  history: { enabled: boolean; max_messages: number };
+}
+
+interface SaveResult {
+  applied: string[];
+  restart_required: string[];
+}
+
+// Ustawienia zapisywane w pliku konfiguracji (config.yaml)
+export function AppSettingsCard() {
+  const [settings, setSettings] = React.useState<AppSettings | null>(null);
+  const [status, setStatus] = React.useState("");
+
+  const load = async () => {
+    try {
+      setSettings((await window.go.wailsbridge.Bridge.GetSettings()) as AppSettings);
+    } catch (e) {
+      console.error("Błąd podczas pobierania ustawień:", e);
+    }
+  };
+
+  React.useEffect(() => {
+    load();
+  }, []);
+
+  if (!settings) {
+    return null;
+  }
+
+  // zmienia jedno pole w jednej sekcji
+  const set = <S extends keyof AppSettings, K extends keyof AppSettings[S]>(
+    section: S,
+    key: K,
+    value: AppSettings[S][K]
+  ) => {
+    setSettings({ ...settings, [section]: { ...settings[section], [key]: value } });
+  };
+
+  const save = async () => {
+    try {
+      const result = (await window.go.wailsbridge.Bridge.UpdateSettings(settings)) as SaveResult;
+      setStatus(
+        result.restart_required.length > 0
+          ? `Zapisano; restart wymagany dla: ${result.restart_required.join(", ")}`
+          : "Zapisano"
+      );
+      load();
+    } catch (e) {
+      setStatus(`Błąd: ${e}`);
+    }
+    setTimeout(() => setStatus(""), 5000);
+  };
+
+  const checkbox = (checked: boolean, onChange: (v: boolean) => void, label: string) => (
+    <label className="flex items-center gap-2 text-sm">
+      <input type="checkbox" checked={checked} onChange={(e) => onChange(e.target.checked)} />
+      {label}
+    </label>
+  );
+
+  return (
+    <Card>
+      <CardHeader>
+        <CardTitle className="flex items-center">
+          <SlidersHorizontal className="h-5 w-5 mr-2 text-blue-400" />
+          Ustawienia Aplikacji
+        </CardTitle>
+        <CardDescription>
+          Zapisywane w pliku konfiguracji. Opcje podane w wierszu poleceń mają pierwszeństwo.
+        </CardDescription>
+      </CardHeader>
+      <CardContent className="space-y-5">
+        <div className="space-y-2">
+          <h3 className="text-sm font-medium">Profil</h3>
+          <div className="flex items-center gap-2">
+            <span className="text-sm text-gray-400 w-40">Domyślny pseudonim:</span>
+            <Input
+              value={settings.room.nickname}
+              onChange={(e) => set("room", "nickname", e.target.value)}
+              placeholder="Użytkownik"
+              maxLength={32}
+              className="text-sm"
+            />
+          </div>
+        </div>
+
+        <div className="space-y-2">
+          <h3 className="text-sm font-medium">Sieć</h3>
+          <div className="flex items-center gap-2">
+            <span className="text-sm text-gray-400 w-40">Zakres portów:</span>
+            <Input
+              type="number"
+              value={settings.network.min_port}
+              onChange={(e) => set("network", "min_port", Number(e.target.value))}
+              className="text-sm w-28"
+            />
+            <span className="text-gray-500">–</span>
+            <Input
+              type="number"
+              value={settings.network.max_port}
+              onChange={(e) => set("network", "max_port", Number(e.target.value))}
+              className="text-sm w-28"
+            />
+          </div>
+          <div className="flex items-center gap-2">
+            <span className="text-sm text-gray-400 w-40">Maks. uczestników:</span>
+            <Input
+              type="number"
+              min={2}
+              value={settings.network.max_peers}
+              onChange={(e) => set("network", "max_peers", Number(e.target.value))}
+              className="text-sm w-28"
+            />
+          </div>
+        </div>
+
+        <div className="space-y-2">
+          <h3 className="text-sm font-medium">Wykrywanie pokoi</h3>
+          {checkbox(settings.discovery.enable_mdns, (v) => set("discovery", "enable_mdns", v), "mDNS w sieci lokalnej")}
+          {checkbox(settings.discovery.enable_broadcast, (v) => set("discovery", "enable_broadcast", v), "Rozgłaszanie UDP w sieci lokalnej")}
+          {checkbox(settings.discovery.enable_dht, (v) => set("discovery", "enable_dht", v), "BitTorrent DHT (internet)")}
+          <div className="flex items-center gap-2">
+            <span className="text-sm text-gray-400 w-40">Serwer sygnalizacyjny:</span>
+            <Input
+              value={settings.discovery.signaling_server}
+              onChange={(e) => set("discovery", "signaling_server", e.target.value.trim())}
+              placeholder="wyłączony"
+              className="text-sm"
+            />
+          </div>
+          <div className="flex items-center gap-2">
+            <span className="text-sm text-gray-400 w-40">Gdy ktoś dołączy:</span>
+            <select
+              value={settings.discovery.when_occupied}
+              onChange={(e) => set("discovery", "when_occupied", e.target.value)}
+              className="bg-gray-900 border border-gray-700 rounded px-2 py-1 text-sm"
+            >
+              <option value="reduce">Ogłaszaj rzadziej</option>
+              <option value="stop">Przestań ogłaszać</option>
+              <option value="keep">Ogłaszaj jak dotąd</option>
+            </select>
+          </div>
+        </div>
+
+        <div className="space-y-2">
+          <h3 className="text-sm font-medium">Prywatność</h3>
+          {checkbox(settings.room.incognito, (v) => set("room", "incognito", v), "Pokoje incognito: nic nie jest zapisywane na dysku")}
+          {checkbox(settings.room.rejoin, (v) => set("room", "rejoin", v), "Po uruchomieniu wróć do pokojów sprzed zamknięcia aplikacji")}
+          {checkbox(settings.history.enabled, (v) => set("history", "enabled", v), "Zapisuj zaszyfrowaną historię wiadomości")}
+          {checkbox(settings.trust.require_verified, (v) => set("trust", "require_verified", v), "Tryb ścisły: tylko zweryfikowani rozmówcy")}
+          {checkbox(settings.trust.strict_tls, (v) => set("trust", "strict_tls", v), "Rozłączaj i izoluj rozmówcę, gdy certyfikat TLS nie pasuje do tożsamości")}
+          <div className="flex items-center gap-2">
+            <span className="text-sm text-gray-400 w-40">Zmiana odcisku palca:</span>
+            <select
+              value={settings.trust.on_fingerprint_change}
+              onChange={(e) => set("trust", "on_fingerprint_change", e.target.value)}
+              className="bg-gray-900 border border-gray-700 rounded px-2 py-1 text-sm"
+            >
+              <option value="refuse">Odrzuć połączenie</option>
+              <option value="warn">Tylko ostrzeż</option>
+            </select>
+          </div>
+        </div>
+
+        <div className="flex items-center gap-2">
+          <Button onClick={save}>Zapisz</Button>
+          {status && (
+            <span className={status.startsWith("Błąd") ? "text-red-400 text-xs" : "text-green-400 text-xs"}>
+              {status}
+            </span>
+          )}
+        </div>
+      </CardContent>
+    </Card>
+  );
+}
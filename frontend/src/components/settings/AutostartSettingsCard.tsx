@@ -0,0 +1,89 @@
+import React from "react";
+import { Card, CardHeader, CardTitle, CardContent, CardDescription } from "@/components/ui/card";
+import { Power } from "lucide-react";
+
+interface AutostartSettings {
+  enabled: boolean;
+  mode: string;
+}
+
+// Uruchamianie ExecP2P po zalogowaniu do systemu
+export function AutostartSettingsCard() {
+  const [settings, setSettings] = React.useState<AutostartSettings | null>(null);
+  const [mode, setMode] = React.useState("gui");
+  const [status, setStatus] = React.useState("");
+
+  const load = async () => {
+    try {
+      const s = (await window.go.wailsbridge.Bridge.GetAutostart()) as AutostartSettings;
+      setSettings(s);
+      if (s.enabled) {
+        setMode(s.mode);
+      }
+    } catch (e) {
+      setStatus(`Błąd: ${e}`);
+    }
+  };
+
+  React.useEffect(() => {
+    load();
+  }, []);
+
+  // zmiany zapisują się od razu
+  const apply = async (enabled: boolean, nextMode: string) => {
+    setMode(nextMode);
+    try {
+      await window.go.wailsbridge.Bridge.SetAutostart(enabled, nextMode);
+      setStatus("");
+    } catch (e) {
+      setStatus(`Błąd: ${e}`);
+    }
+    load();
+  };
+
+  return (
+    <Card>
+      <CardHeader>
+        <CardTitle className="flex items-center">
+          <Power className="h-5 w-5 mr-2 text-blue-400" />
+          Uruchamianie
+        </CardTitle>
+        <CardDescription>
+          Uruchamiaj ExecP2P po zalogowaniu do systemu.
+        </CardDescription>
+      </CardHeader>
+      <CardContent className="space-y-3">
+        {settings && (
+          <>
+            <label className="flex items-center gap-2 text-sm">
+              <input
+                type="checkbox"
+                checked={settings.enabled}
+                onChange={(e) => apply(e.target.checked, mode)}
+              />
+              Uruchamiaj po zalogowaniu
+            </label>
+            <label className="flex items-center gap-2 text-sm">
+              Tryb
+              <select
+                className="bg-gray-900 border border-gray-700 rounded px-2 py-1 text-sm"
+                value={mode}
+                onChange={(e) => (settings.enabled ? apply(true, e.target.value) : setMode(e.target.value))}
+              >
+                <option value="gui">Okno (zminimalizowane)</option>
+                <option value="daemon">Demon w tle, bez okna</option>
+              </select>
+            </label>
+            {mode === "daemon" && (
+              <p className="text-xs text-gray-400">
+                Demon udostępnia lokalne API (execp2p daemon). Magazyn kluczy chroniony hasłem
+                wymaga ustawienia $EXECP2P_KEYSTORE_PASSPHRASE.
+              </p>
+            )}
+          </>
+        )}
+        {status && <p className="text-red-400 text-xs">{status}</p>}
+      </CardContent>
+    </Card>
+  );
+}
@@ -0,0 +1,93 @@
+import React from "react";
+import { Card, CardHeader, CardTitle, CardContent, CardDescription } from "@/components/ui/card";
+import { Button } from "@/components/ui/button";
+import { Input } from "@/components/ui/input";
+import { Clock } from "lucide-react";
+
+interface LocaleSettings {
+  language: string;
+  timezone: string;
+  effective_zone: string;
+  sample_date_time: string;
+}
+
+// Język i strefa czasowa używane przez back-end do formatowania dat
+export function LocaleSettingsCard() {
+  const [settings, setSettings] = React.useState<LocaleSettings | null>(null);
+  const [language, setLanguage] = React.useState("pl");
+  const [timezone, setTimezone] = React.useState("");
+  const [status, setStatus] = React.useState("");
+
+  const load = async () => {
+    try {
+      const s = (await window.go.wailsbridge.Bridge.GetLocaleSettings()) as LocaleSettings;
+      setSettings(s);
+      setLanguage(s.language || "pl");
+      setTimezone(s.timezone || "");
+    } catch (e) {
+      console.error("Błąd podczas pobierania ustawień czasu:", e);
+    }
+  };
+
+  React.useEffect(() => {
+    load();
+  }, []);
+
+  const save = async () => {
+    try {
+      await window.go.wailsbridge.Bridge.SetLocaleSettings(language, timezone.trim());
+      setStatus("Zapisano");
+      load();
+    } catch (e) {
+      setStatus(`Błąd: ${e}`);
+    }
+    setTimeout(() => setStatus(""), 3000);
+  };
+
+  return (
+    <Card>
+      <CardHeader>
+        <CardTitle className="flex items-center">
+          <Clock className="h-5 w-5 mr-2 text-blue-400" />
+          Data i Czas
+        </CardTitle>
+        <CardDescription>
+          Format dat w wiadomościach, eksporcie historii i w wierszu poleceń.
+        </CardDescription>
+      </CardHeader>
+      <CardContent className="space-y-3">
+        <div className="flex items-center gap-2">
+          <span className="text-sm text-gray-400 w-32">Język:</span>
+          <select
+            value={language}
+            onChange={(e) => setLanguage(e.target.value)}
+            className="bg-gray-900 border border-gray-700 rounded px-2 py-1 text-sm"
+          >
+            <option value="pl">Polski</option>
+            <option value="en">English</option>
+          </select>
+        </div>
+        <div className="flex items-center gap-2">
+          <span className="text-sm text-gray-400 w-32">Strefa czasowa:</span>
+          <Input
+            value={timezone}
+            onChange={(e) => setTimezone(e.target.value)}
+            placeholder={settings?.effective_zone || "systemowa"}
+            className="text-sm"
+          />
+        </div>
+        {settings && (
+          <p className="text-xs text-gray-500">Przykład: {settings.sample_date_time}</p>
+        )}
+        <div className="flex items-center gap-2">
+          <Button onClick={save}>Zapisz</Button>
+          {status && (
+            <span className={status.startsWith("Błąd") ? "text-red-400 text-xs" : "text-green-400 text-xs"}>
+              {status}
+            </span>
+          )}
+        </div>
+      </CardContent>
+    </Card>
+  );
+}
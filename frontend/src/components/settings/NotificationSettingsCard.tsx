@@ -0,0 +1,98 @@
+import React from "react";
+import { Card, CardHeader, CardTitle, CardContent, CardDescription } from "@/components/ui/card";
+import { Bell } from "lucide-react";
+
+interface NotificationSettings {
+  enabled: boolean;
+  hide_preview: boolean;
+  muted_rooms: string[];
+  available: boolean;
+}
+
+interface NotificationSettingsCardProps {
+  roomId?: string;
+}
+
+// Powiadomienia systemowe o wiadomościach, gdy okno jest w tle
+export function NotificationSettingsCard({ roomId }: NotificationSettingsCardProps) {
+  const [settings, setSettings] = React.useState<NotificationSettings | null>(null);
+  const [status, setStatus] = React.useState("");
+
+  const load = async () => {
+    try {
+      setSettings((await window.go.wailsbridge.Bridge.GetNotificationSettings()) as NotificationSettings);
+    } catch (e) {
+      console.error("Błąd podczas pobierania ustawień powiadomień:", e);
+    }
+  };
+
+  React.useEffect(() => {
+    load();
+  }, []);
+
+  // zmiany zapisują się od razu
+  const apply = async (change: () => Promise<void>) => {
+    try {
+      await change();
+      setStatus("");
+    } catch (e) {
+      setStatus(`Błąd: ${e}`);
+    }
+    load();
+  };
+
+  if (!settings) {
+    return null;
+  }
+  const muted = !!roomId && (settings.muted_rooms || []).includes(roomId);
+
+  return (
+    <Card>
+      <CardHeader>
+        <CardTitle className="flex items-center">
+          <Bell className="h-5 w-5 mr-2 text-blue-400" />
+          Powiadomienia
+        </CardTitle>
+        <CardDescription>
+          Powiadomienia systemowe o wiadomościach, które przychodzą, gdy okno jest w tle.
+        </CardDescription>
+      </CardHeader>
+      <CardContent className="space-y-3">
+        {!settings.available && (
+          <p className="text-xs text-yellow-400">
+            System nie obsługuje powiadomień (na Linuksie potrzebne jest notify-send).
+          </p>
+        )}
+        <label className="flex items-center gap-2 text-sm">
+          <input
+            type="checkbox"
+            checked={settings.enabled}
+            onChange={(e) => apply(() => window.go.wailsbridge.Bridge.SetNotifications(e.target.checked, settings.hide_preview))}
+          />
+          Pokazuj powiadomienia
+        </label>
+        <label className="flex items-center gap-2 text-sm">
+          <input
+            type="checkbox"
+            checked={settings.hide_preview}
+            disabled={!settings.enabled}
+            onChange={(e) => apply(() => window.go.wailsbridge.Bridge.SetNotifications(settings.enabled, e.target.checked))}
+          />
+          Ukrywaj treść wiadomości (tylko nadawca)
+        </label>
+        {roomId && (
+          <label className="flex items-center gap-2 text-sm">
+            <input
+              type="checkbox"
+              checked={muted}
+              disabled={!settings.enabled}
+              onChange={(e) => apply(() => window.go.wailsbridge.Bridge.SetRoomMuted(roomId, e.target.checked))}
+            />
+            Wycisz ten pokój
+          </label>
+        )}
+        {status && <p className="text-red-400 text-xs">{status}</p>}
+      </CardContent>
+    </Card>
+  );
+}
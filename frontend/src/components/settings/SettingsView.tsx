@@ -2,6 +2,11 @@ import React from "react";
 import { Card, CardHeader, CardTitle, CardContent, CardDescription } from "@/components/ui/card";
 import { Button } from "@/components/ui/button";
 import { cn } from "@/lib/utils";
+import { QRVerificationCard } from "@/components/security/QRVerificationCard";
+import { LocaleSettingsCard } from "./LocaleSettingsCard";
+import { AppSettingsCard } from "./AppSettingsCard";
+import { NotificationSettingsCard } from "./NotificationSettingsCard";
+import { AutostartSettingsCard } from "./AutostartSettingsCard";
 import { 
   Fingerprint, 
   Copy, 
@@ -12,9 +17,21 @@ import {
   Info, 
   Server, 
   Network, 
-  Lock
+  Lock,
+  Trash2,
+  ShieldCheck,
+  ShieldOff
 } from "lucide-react";
 
+interface PinnedPeer {
+  peer_id: string;
+  fingerprint: string;
+  first_seen: string;
+  last_seen: string;
+  verified?: boolean;
+  verified_method?: string;
+}
+
 interface SettingsViewProps {
   identityFingerprint?: string;
   roomId?: string;
@@ -45,6 +62,56 @@ export function SettingsView({
   const [regenerating, setRegenerating] = React.useState(false);
   const [currentAccessKey, setCurrentAccessKey] = React.useState(accessKey);
   const [regenerateStatus, setRegenerateStatus] = React.useState("");
+  const [pinnedPeers, setPinnedPeers] = React.useState<PinnedPeer[]>([]);
+
+  const loadPinnedPeers = async () => {
+    try {
+      const peers = await window.go.wailsbridge.Bridge.GetPinnedPeers();
+      setPinnedPeers(peers as PinnedPeer[]);
+    } catch (error) {
+      console.error("Błąd podczas pobierania zapamiętanych tożsamości:", error);
+    }
+  };
+
+  const [requireVerified, setRequireVerified] = React.useState(false);
+
+  const toggleVerified = async (peer: PinnedPeer) => {
+    try {
+      if (peer.verified) {
+        await window.go.wailsbridge.Bridge.UnverifyPeer(peer.peer_id);
+      } else {
+        await window.go.wailsbridge.Bridge.MarkPeerVerified(peer.peer_id);
+      }
+      loadPinnedPeers();
+    } catch (error) {
+      console.error("Nie udało się zmienić stanu weryfikacji:", error);
+    }
+  };
+
+  const toggleRequireVerified = async (enabled: boolean) => {
+    try {
+      await window.go.wailsbridge.Bridge.SetRequireVerified(enabled);
+      setRequireVerified(enabled);
+    } catch (error) {
+      console.error("Nie udało się zmienić trybu ścisłego:", error);
+    }
+  };
+
+  const forgetPeer = async (peerId: string) => {
+    try {
+      await window.go.wailsbridge.Bridge.ForgetPeer(peerId);
+      loadPinnedPeers();
+    } catch (error) {
+      console.error("Nie udało się usunąć tożsamości:", error);
+    }
+  };
+
+  React.useEffect(() => {
+    loadPinnedPeers();
+    window.go.wailsbridge.Bridge.GetRequireVerified()
+      .then(setRequireVerified)
+      .catch(() => {});
+  }, []);
 
   // Aktualizuj klucz dostępu, gdy zmienia się prop
   React.useEffect(() => {
@@ -56,6 +123,15 @@ export function SettingsView({
       .catch(err => console.error("Nie udało się skopiować do schowka:", err));
   };
   
+  // link execp2p://join/ z ID pokoju i kluczem dostępu
+  const copyInviteLink = async () => {
+    try {
+      copyToClipboard(await window.go.wailsbridge.Bridge.GetInviteLink());
+    } catch (err) {
+      console.error("Nie udało się utworzyć linku z zaproszeniem:", err);
+    }
+  };
+
   const handleRegenerateKey = async () => {
     if (!onRegenerateAccessKey) return;
     
@@ -170,6 +246,15 @@ export function SettingsView({
               <Copy className="h-4 w-4" />
             </Button>
             </div>
+            <Button
+              variant="outline"
+              onClick={copyInviteLink}
+              disabled={!currentAccessKey}
+              className="w-full flex items-center justify-center gap-2 mt-2"
+            >
+              <Copy className="h-4 w-4" />
+              <span>Kopiuj link z zaproszeniem</span>
+            </Button>
             <div className="flex justify-between items-center mt-4">
               <Button 
                 variant="outline" 
@@ -275,6 +360,81 @@ export function SettingsView({
           </CardContent>
         </Card>
       )}
+
+      {roomId && <QRVerificationCard />}
+
+      <Card>
+        <CardHeader>
+          <CardTitle className="flex items-center">
+            <Fingerprint className="h-5 w-5 mr-2 text-blue-400" />
+            Zapamiętane Tożsamości (TOFU)
+          </CardTitle>
+          <CardDescription>
+            Odcisk palca każdego rozmówcy jest zapamiętywany przy pierwszym połączeniu.
+            Jeśli później się zmieni, połączenie zostanie odrzucone.
+          </CardDescription>
+        </CardHeader>
+        <CardContent>
+          <label className="flex items-center gap-2 mb-4 text-sm">
+            <input
+              type="checkbox"
+              checked={requireVerified}
+              onChange={(e) => toggleRequireVerified(e.target.checked)}
+            />
+            Tryb ścisły: odrzucaj wiadomości od niezweryfikowanych rozmówców
+          </label>
+          {pinnedPeers.length === 0 ? (
+            <p className="text-sm text-gray-400">Brak zapamiętanych tożsamości.</p>
+          ) : (
+            <ul className="space-y-2">
+              {pinnedPeers.map((peer) => (
+                <li key={peer.peer_id} className="flex items-start justify-between gap-2">
+                  <div className="min-w-0">
+                    <div className="text-sm font-medium mb-1">
+                      ID: {peer.peer_id.substring(0, 8)}...
+                      <span className="ml-2 text-xs text-gray-500">
+                        od {new Date(peer.first_seen).toLocaleDateString()}
+                      </span>
+                      {peer.verified && (
+                        <span className="ml-2 text-xs text-green-400">
+                          Zweryfikowany ({peer.verified_method === "qr" ? "QR" : "ręcznie"})
+                        </span>
+                      )}
+                    </div>
+                    <div className="bg-gray-900/70 p-2 rounded-md font-mono text-xs break-all border border-gray-800">
+                      {peer.fingerprint}
+                    </div>
+                  </div>
+                  <Button
+                    variant="ghost"
+                    size="icon"
+                    onClick={() => toggleVerified(peer)}
+                    title={peer.verified ? "Cofnij weryfikację" : "Oznacz jako zweryfikowany (po porównaniu odcisku palca)"}
+                  >
+                    {peer.verified ? <ShieldOff className="h-4 w-4" /> : <ShieldCheck className="h-4 w-4" />}
+                  </Button>
+                  <Button
+                    variant="ghost"
+                    size="icon"
+                    onClick={() => forgetPeer(peer.peer_id)}
+                    title="Zapomnij tożsamość"
+                  >
+                    <Trash2 className="h-4 w-4" />
+                  </Button>
+                </li>
+              ))}
+            </ul>
+          )}
+        </CardContent>
+      </Card>
+
+      <AppSettingsCard />
+
+      <NotificationSettingsCard roomId={roomId} />
+
+      <AutostartSettingsCard />
+
+      <LocaleSettingsCard />
     </div>
   );
 }
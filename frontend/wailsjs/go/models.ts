@@ -0,0 +1,407 @@
+export namespace config {
+	
+	export class NetworkSettings {
+	    min_port: number;
+	    max_port: number;
+	    max_peers: number;
+	
+	    static createFrom(source: any = {}) {
+	        return new NetworkSettings(source);
+	    }
+	
+	    constructor(source: any = {}) {
+	        if ('string' === typeof source) source = JSON.parse(source);
+	        this.min_port = source["min_port"];
+	        this.max_port = source["max_port"];
+	        this.max_peers = source["max_peers"];
+	    }
+	}
+	export class DiscoverySettings {
+	    enable_mdns: boolean;
+	    enable_dht: boolean;
+	    enable_broadcast: boolean;
+	    signaling_server: string;
+	    when_occupied: string;
+	
+	    static createFrom(source: any = {}) {
+	        return new DiscoverySettings(source);
+	    }
+	
+	    constructor(source: any = {}) {
+	        if ('string' === typeof source) source = JSON.parse(source);
+	        this.enable_mdns = source["enable_mdns"];
+	        this.enable_dht = source["enable_dht"];
+	        this.enable_broadcast = source["enable_broadcast"];
+	        this.signaling_server = source["signaling_server"];
+	        this.when_occupied = source["when_occupied"];
+	    }
+	}
+	export class RoomSettings {
+	    nickname: string;
+	    incognito: boolean;
+	    rejoin: boolean;
+	
+	    static createFrom(source: any = {}) {
+	        return new RoomSettings(source);
+	    }
+	
+	    constructor(source: any = {}) {
+	        if ('string' === typeof source) source = JSON.parse(source);
+	        this.nickname = source["nickname"];
+	        this.incognito = source["incognito"];
+	        this.rejoin = source["rejoin"];
+	    }
+	}
+	export class TrustSettings {
+	    on_fingerprint_change: string;
+	    require_verified: boolean;
+	    strict_tls: boolean;
+	
+	    static createFrom(source: any = {}) {
+	        return new TrustSettings(source);
+	    }
+	
+	    constructor(source: any = {}) {
+	        if ('string' === typeof source) source = JSON.parse(source);
+	        this.on_fingerprint_change = source["on_fingerprint_change"];
+	        this.require_verified = source["require_verified"];
+	        this.strict_tls = source["strict_tls"];
+	    }
+	}
+	export class HistorySettings {
+	    enabled: boolean;
+	    max_messages: number;
+	
+	    static createFrom(source: any = {}) {
+	        return new HistorySettings(source);
+	    }
+	
+	    constructor(source: any = {}) {
+	        if ('string' === typeof source) source = JSON.parse(source);
+	        this.enabled = source["enabled"];
+	        this.max_messages = source["max_messages"];
+	    }
+	}
+	export class Settings {
+	    network: NetworkSettings;
+	    discovery: DiscoverySettings;
+	    room: RoomSettings;
+	    trust: TrustSettings;
+	    history: HistorySettings;
+	
+	    static createFrom(source: any = {}) {
+	        return new Settings(source);
+	    }
+	
+	    constructor(source: any = {}) {
+	        if ('string' === typeof source) source = JSON.parse(source);
+	        this.network = this.convertValues(source["network"], NetworkSettings);
+	        this.discovery = this.convertValues(source["discovery"], DiscoverySettings);
+	        this.room = this.convertValues(source["room"], RoomSettings);
+	        this.trust = this.convertValues(source["trust"], TrustSettings);
+	        this.history = this.convertValues(source["history"], HistorySettings);
+	    }
+	
+		convertValues(a: any, classs: any, asMap: boolean = false): any {
+		    if (!a) {
+		        return a;
+		    }
+		    if (a.slice && a.map) {
+		        return (a as any[]).map(elem => this.convertValues(elem, classs));
+		    } else if ("object" === typeof a) {
+		        if (asMap) {
+		            for (const key of Object.keys(a)) {
+		                a[key] = new classs(a[key]);
+		            }
+		            return a;
+		        }
+		        return new classs(a);
+		    }
+		    return a;
+		}
+	}
+
+}
+
+export namespace outbox {
+	
+	export class Message {
+	    id: string;
+	    room_id: string;
+	    body: string;
+	    queued_at: any;
+	
+	    static createFrom(source: any = {}) {
+	        return new Message(source);
+	    }
+	
+	    constructor(source: any = {}) {
+	        if ('string' === typeof source) source = JSON.parse(source);
+	        this.id = source["id"];
+	        this.room_id = source["room_id"];
+	        this.body = source["body"];
+	        this.queued_at = source["queued_at"];
+	    }
+	}
+
+}
+
+export namespace room {
+	
+	export class Invite {
+	    room_id: string;
+	    access_key: string;
+	    address?: string;
+	
+	    static createFrom(source: any = {}) {
+	        return new Invite(source);
+	    }
+	
+	    constructor(source: any = {}) {
+	        if ('string' === typeof source) source = JSON.parse(source);
+	        this.room_id = source["room_id"];
+	        this.access_key = source["access_key"];
+	        this.address = source["address"];
+	    }
+	}
+
+}
+
+export namespace types {
+	
+	export class Ban {
+	    fingerprint: string;
+	    nickname?: string;
+	    reason?: string;
+	    banned_at: number;
+	
+	    static createFrom(source: any = {}) {
+	        return new Ban(source);
+	    }
+	
+	    constructor(source: any = {}) {
+	        if ('string' === typeof source) source = JSON.parse(source);
+	        this.fingerprint = source["fingerprint"];
+	        this.nickname = source["nickname"];
+	        this.reason = source["reason"];
+	        this.banned_at = source["banned_at"];
+	    }
+	}
+	export class CreateRoomResult {
+	    room_id: string;
+	    access_key: string;
+	    listen_port: number;
+	    incognito: boolean;
+	
+	    static createFrom(source: any = {}) {
+	        return new CreateRoomResult(source);
+	    }
+	
+	    constructor(source: any = {}) {
+	        if ('string' === typeof source) source = JSON.parse(source);
+	        this.room_id = source["room_id"];
+	        this.access_key = source["access_key"];
+	        this.listen_port = source["listen_port"];
+	        this.incognito = source["incognito"];
+	    }
+	}
+	export class NetworkStatus {
+	    peer_id: string;
+	    listen_port: number;
+	    room_id: string;
+	    room_name?: string;
+	    role?: string;
+	    connected_peers: number;
+	    verified_peers: number;
+	    e2e_encryption: boolean;
+	    is_running: boolean;
+	    is_listener: boolean;
+	    degraded: boolean;
+	    closes_at?: string;
+	
+	    static createFrom(source: any = {}) {
+	        return new NetworkStatus(source);
+	    }
+	
+	    constructor(source: any = {}) {
+	        if ('string' === typeof source) source = JSON.parse(source);
+	        this.peer_id = source["peer_id"];
+	        this.listen_port = source["listen_port"];
+	        this.room_id = source["room_id"];
+	        this.room_name = source["room_name"];
+	        this.role = source["role"];
+	        this.connected_peers = source["connected_peers"];
+	        this.verified_peers = source["verified_peers"];
+	        this.e2e_encryption = source["e2e_encryption"];
+	        this.is_running = source["is_running"];
+	        this.is_listener = source["is_listener"];
+	        this.degraded = source["degraded"];
+	        this.closes_at = source["closes_at"];
+	    }
+	}
+	export class PeerInfo {
+	    id: string;
+	    nickname: string;
+	    isLocal: boolean;
+	    presence: string;
+	    role: string;
+	    fingerprint: string;
+	    verification?: string;
+	    address?: string;
+	    transport?: string;
+	    connected_since?: number;
+	    last_activity?: number;
+	    offline?: boolean;
+	    status?: string;
+	    avatar?: string;
+	
+	    static createFrom(source: any = {}) {
+	        return new PeerInfo(source);
+	    }
+	
+	    constructor(source: any = {}) {
+	        if ('string' === typeof source) source = JSON.parse(source);
+	        this.id = source["id"];
+	        this.nickname = source["nickname"];
+	        this.isLocal = source["isLocal"];
+	        this.presence = source["presence"];
+	        this.role = source["role"];
+	        this.fingerprint = source["fingerprint"];
+	        this.verification = source["verification"];
+	        this.address = source["address"];
+	        this.transport = source["transport"];
+	        this.connected_since = source["connected_since"];
+	        this.last_activity = source["last_activity"];
+	        this.offline = source["offline"];
+	        this.status = source["status"];
+	        this.avatar = source["avatar"];
+	    }
+	}
+	export class Profile {
+	    nickname: string;
+	    status: string;
+	    avatar?: string;
+	    avatar_hash?: string;
+	    fingerprint: string;
+	    updated_at: number;
+	
+	    static createFrom(source: any = {}) {
+	        return new Profile(source);
+	    }
+	
+	    constructor(source: any = {}) {
+	        if ('string' === typeof source) source = JSON.parse(source);
+	        this.nickname = source["nickname"];
+	        this.status = source["status"];
+	        this.avatar = source["avatar"];
+	        this.avatar_hash = source["avatar_hash"];
+	        this.fingerprint = source["fingerprint"];
+	        this.updated_at = source["updated_at"];
+	    }
+	}
+	export class RoomSummary {
+	    room_id: string;
+	    room_name?: string;
+	    is_listener: boolean;
+	    incognito: boolean;
+	    connected_peers: number;
+	    unread: number;
+	    active: boolean;
+	
+	    static createFrom(source: any = {}) {
+	        return new RoomSummary(source);
+	    }
+	
+	    constructor(source: any = {}) {
+	        if ('string' === typeof source) source = JSON.parse(source);
+	        this.room_id = source["room_id"];
+	        this.room_name = source["room_name"];
+	        this.is_listener = source["is_listener"];
+	        this.incognito = source["incognito"];
+	        this.connected_peers = source["connected_peers"];
+	        this.unread = source["unread"];
+	        this.active = source["active"];
+	    }
+	}
+	export class EncryptionAlgorithms {
+	    key_exchange: string;
+	    signatures: string;
+	    symmetric: string;
+	
+	    static createFrom(source: any = {}) {
+	        return new EncryptionAlgorithms(source);
+	    }
+	
+	    constructor(source: any = {}) {
+	        if ('string' === typeof source) source = JSON.parse(source);
+	        this.key_exchange = source["key_exchange"];
+	        this.signatures = source["signatures"];
+	        this.symmetric = source["symmetric"];
+	    }
+	}
+	export class RoomInfo {
+	    room_id: string;
+	    access_key: string;
+	    is_private: boolean;
+	
+	    static createFrom(source: any = {}) {
+	        return new RoomInfo(source);
+	    }
+	
+	    constructor(source: any = {}) {
+	        if ('string' === typeof source) source = JSON.parse(source);
+	        this.room_id = source["room_id"];
+	        this.access_key = source["access_key"];
+	        this.is_private = source["is_private"];
+	    }
+	}
+	export class SecuritySummary {
+	    encryption_algorithms: EncryptionAlgorithms;
+	    identity_fingerprint?: string;
+	    identity_persistent: boolean;
+	    keystore_protection?: string;
+	    pinned_peers: number;
+	    room_archived: boolean;
+	    require_verified: boolean;
+	    incognito: boolean;
+	    peer_fingerprints: Record<string, string>;
+	    room_info?: RoomInfo;
+	
+	    static createFrom(source: any = {}) {
+	        return new SecuritySummary(source);
+	    }
+	
+	    constructor(source: any = {}) {
+	        if ('string' === typeof source) source = JSON.parse(source);
+	        this.encryption_algorithms = this.convertValues(source["encryption_algorithms"], EncryptionAlgorithms);
+	        this.identity_fingerprint = source["identity_fingerprint"];
+	        this.identity_persistent = source["identity_persistent"];
+	        this.keystore_protection = source["keystore_protection"];
+	        this.pinned_peers = source["pinned_peers"];
+	        this.room_archived = source["room_archived"];
+	        this.require_verified = source["require_verified"];
+	        this.incognito = source["incognito"];
+	        this.peer_fingerprints = source["peer_fingerprints"];
+	        this.room_info = this.convertValues(source["room_info"], RoomInfo);
+	    }
+	
+		convertValues(a: any, classs: any, asMap: boolean = false): any {
+		    if (!a) {
+		        return a;
+		    }
+		    if (a.slice && a.map) {
+		        return (a as any[]).map(elem => this.convertValues(elem, classs));
+		    } else if ("object" === typeof a) {
+		        if (asMap) {
+		            for (const key of Object.keys(a)) {
+		                a[key] = new classs(a[key]);
+		            }
+		            return a;
+		        }
+		        return new classs(a);
+		    }
+		    return a;
+		}
+	}
+
+}
@@ -1,37 +1,229 @@
 // Cynhyrchwyd y ffeil hon yn awtomatig. PEIDIWCH Â MODIWL
 // This file is automatically generated. DO NOT EDIT
-import {context} from '../models';
+import {config,context,outbox,room,types} from '../models';
+
+export function AcceptContactRequest(arg1:string):Promise<void>;
+
+export function AcceptPeer(arg1:string):Promise<void>;
+
+export function AddRoomShortcode(arg1:string,arg2:string):Promise<Record<string, any>>;
+
+export function BanFingerprint(arg1:string,arg2:string):Promise<void>;
+
+export function BanPeer(arg1:string,arg2:string):Promise<void>;
+
+export function CancelTransfer(arg1:string):Promise<void>;
+
+export function CancelVoiceRecording():Promise<void>;
+
+export function CheckMailbox():Promise<number>;
+
+export function ChooseAndSendFile():Promise<Record<string, any>>;
+
+export function ClearHistory(arg1:string):Promise<void>;
+
+export function ClearMediaCache():Promise<void>;
+
+export function ClearQueuedMessages(arg1:string):Promise<number>;
 
 export function CloseConnection():Promise<void>;
 
-export function CreateRoom():Promise<Record<string, any>>;
+export function ContactUser(arg1:string,arg2:string,arg3:string,arg4:boolean):Promise<string>;
+
+export function CreateIncognitoRoom():Promise<types.CreateRoomResult>;
+
+export function CreateRoom():Promise<types.CreateRoomResult>;
+
+export function DismissContactRequest(arg1:string):Promise<void>;
 
 export function EmitNetworkError(arg1:Error):Promise<void>;
 
 export function EmitSecurityMessage(arg1:string):Promise<void>;
 
+export function ExportIdentity(arg1:string):Promise<string>;
+
 export function FindRoom(arg1:string):Promise<Record<string, any>>;
 
-export function GetNetworkStatus():Promise<Record<string, any>>;
+export function ForgetPeer(arg1:string):Promise<void>;
+
+export function GetArchiveStatus():Promise<Record<string, any>>;
+
+export function GetAutostart():Promise<Record<string, any>>;
+
+export function GetBans():Promise<Array<types.Ban>>;
+
+export function GetContactRequests():Promise<Array<Record<string, any>>>;
+
+export function GetDiagnostics():Promise<Record<string, any>>;
+
+export function GetHistory(arg1:string,arg2:string,arg3:number):Promise<Record<string, any>>;
+
+export function GetHistoryRooms():Promise<Array<Record<string, any>>>;
+
+export function GetInviteLink():Promise<string>;
+
+export function GetLocaleSettings():Promise<Record<string, any>>;
+
+export function GetLogLevel():Promise<string>;
+
+export function GetMediaCacheStats():Promise<Record<string, any>>;
+
+export function GetMetrics():Promise<Record<string, any>>;
+
+export function GetNetworkStatus():Promise<types.NetworkStatus>;
+
+export function GetNickname():Promise<string>;
+
+export function GetNotificationSettings():Promise<Record<string, any>>;
+
+export function GetOriginalMedia(arg1:string):Promise<string>;
 
 export function GetPeerFingerprint():Promise<string>;
 
+export function GetPeerVerificationStates():Promise<Array<Record<string, any>>>;
+
+export function GetPeers():Promise<Array<types.PeerInfo>>;
+
+export function GetPinnedPeers():Promise<Array<Record<string, any>>>;
+
+export function GetPresence():Promise<string>;
+
+export function GetProfile():Promise<types.Profile>;
+
+export function GetQuarantinedPeers():Promise<Array<Record<string, any>>>;
+
+export function GetQueuedMessages(arg1:string):Promise<Array<outbox.Message>>;
+
+export function GetRecentLogs(arg1:string,arg2:number):Promise<Array<Record<string, any>>>;
+
+export function GetRequireVerified():Promise<boolean>;
+
 export function GetRoomAccessKey():Promise<string>;
 
-export function GetSecuritySummary():Promise<Record<string, any>>;
+export function GetRoomShortcodes():Promise<Array<Record<string, any>>>;
+
+export function GetSecuritySummary():Promise<types.SecuritySummary>;
+
+export function GetSettings():Promise<config.Settings>;
+
+export function GetTransfers():Promise<Array<Record<string, any>>>;
+
+export function GetUnreadCount():Promise<number>;
 
 export function GetUserID():Promise<string>;
 
+export function GetVerificationQR(arg1:string):Promise<Record<string, any>>;
+
+export function GetVoiceSupport():Promise<Record<string, any>>;
+
+export function ImportIdentity(arg1:string):Promise<string>;
+
+export function IsPrimaryDevice():Promise<boolean>;
+
 export function JoinRoom(arg1:string,arg2:string,arg3:string):Promise<void>;
 
 export function JoinRoomWithFallback(arg1:string,arg2:string):Promise<void>;
 
 export function JoinUserByID(arg1:string,arg2:string):Promise<void>;
 
+export function KickPeer(arg1:string):Promise<void>;
+
+export function LeaveRoom(arg1:string):Promise<void>;
+
+export function ListRooms():Promise<Array<types.RoomSummary>>;
+
+export function MarkPeerVerified(arg1:string):Promise<void>;
+
+export function MarkRoomRead(arg1:string):Promise<void>;
+
+export function OwnDevices():Promise<Array<string>>;
+
+export function PlayVoiceMessage(arg1:string):Promise<void>;
+
+export function Raise():Promise<void>;
+
+export function ReceiveInvite(arg1:room.Invite):Promise<void>;
+
+export function ReceiveInviteLink(arg1:string):Promise<void>;
+
 export function RegenerateRoomAccessKey():Promise<string>;
 
-export function SendMessage(arg1:string):Promise<void>;
+export function RejectPeer(arg1:string):Promise<void>;
+
+export function RejoinRooms():Promise<void>;
+
+export function ReloadConfig():Promise<Record<string, any>>;
+
+export function RemoveRoomShortcode(arg1:string):Promise<void>;
+
+export function RenameRoom(arg1:string):Promise<void>;
+
+export function ReportActivity():Promise<void>;
+
+export function ResetDiagnostics():Promise<void>;
+
+export function RotateRoomAccessKeyAndDisconnect():Promise<string>;
+
+export function SaveReceivedFile(arg1:string):Promise<string>;
+
+export function SearchMessages(arg1:string,arg2:string,arg3:number):Promise<Array<Record<string, any>>>;
+
+export function SelectRoom(arg1:string):Promise<void>;
+
+export function SendFile(arg1:string):Promise<string>;
+
+export function SendFileData(arg1:string,arg2:Array<number>):Promise<string>;
+
+export function SendMedia(arg1:string,arg2:string,arg3:string):Promise<Record<string, any>>;
+
+export function SendMessage(arg1:string):Promise<string>;
+
+export function SetAutostart(arg1:boolean,arg2:string):Promise<void>;
+
+export function SetAvatar(arg1:string):Promise<types.Profile>;
 
 export function SetContext(arg1:context.Context):Promise<void>;
 
+export function SetLocaleSettings(arg1:string,arg2:string):Promise<void>;
+
+export function SetLogLevel(arg1:string):Promise<void>;
+
+export function SetNotifications(arg1:boolean,arg2:boolean):Promise<void>;
+
+export function SetPeerRole(arg1:string,arg2:string):Promise<void>;
+
+export function SetPresence(arg1:string):Promise<void>;
+
+export function SetProfileStatus(arg1:string):Promise<types.Profile>;
+
+export function SetRequireVerified(arg1:boolean):Promise<void>;
+
+export function SetRoomMuted(arg1:string,arg2:boolean):Promise<void>;
+
+export function SetWindowFocused(arg1:boolean):Promise<void>;
+
+export function StartVoiceRecording():Promise<void>;
+
+export function StopVoicePlayback():Promise<void>;
+
+export function StopVoiceRecording():Promise<Record<string, any>>;
+
+export function SyncHistory():Promise<string>;
+
+export function TakePendingInvite():Promise<room.Invite>;
+
+export function TrustPeerCertificate(arg1:string,arg2:string):Promise<void>;
+
+export function TrustPeerFingerprint(arg1:string,arg2:string):Promise<void>;
+
+export function UnbanFingerprint(arg1:string):Promise<void>;
+
+export function UnverifyPeer(arg1:string):Promise<void>;
+
 export function UpdateNickname(arg1:string):Promise<void>;
+
+export function UpdateSettings(arg1:config.Settings):Promise<Record<string, any>>;
+
+export function VerifyScannedQR(arg1:string):Promise<Record<string, any>>;
+
+export function WipeDevice(arg1:string):Promise<void>;
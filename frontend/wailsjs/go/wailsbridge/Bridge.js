@@ -2,14 +2,74 @@
 // Cynhyrchwyd y ffeil hon yn awtomatig. PEIDIWCH Â MODIWL
 // This file is automatically generated. DO NOT EDIT
 
+export function AcceptContactRequest(arg1) {
+  return window['go']['wailsbridge']['Bridge']['AcceptContactRequest'](arg1);
+}
+
+export function AcceptPeer(arg1) {
+  return window['go']['wailsbridge']['Bridge']['AcceptPeer'](arg1);
+}
+
+export function AddRoomShortcode(arg1, arg2) {
+  return window['go']['wailsbridge']['Bridge']['AddRoomShortcode'](arg1, arg2);
+}
+
+export function BanFingerprint(arg1, arg2) {
+  return window['go']['wailsbridge']['Bridge']['BanFingerprint'](arg1, arg2);
+}
+
+export function BanPeer(arg1, arg2) {
+  return window['go']['wailsbridge']['Bridge']['BanPeer'](arg1, arg2);
+}
+
+export function CancelTransfer(arg1) {
+  return window['go']['wailsbridge']['Bridge']['CancelTransfer'](arg1);
+}
+
+export function CancelVoiceRecording() {
+  return window['go']['wailsbridge']['Bridge']['CancelVoiceRecording']();
+}
+
+export function CheckMailbox() {
+  return window['go']['wailsbridge']['Bridge']['CheckMailbox']();
+}
+
+export function ChooseAndSendFile() {
+  return window['go']['wailsbridge']['Bridge']['ChooseAndSendFile']();
+}
+
+export function ClearHistory(arg1) {
+  return window['go']['wailsbridge']['Bridge']['ClearHistory'](arg1);
+}
+
+export function ClearMediaCache() {
+  return window['go']['wailsbridge']['Bridge']['ClearMediaCache']();
+}
+
+export function ClearQueuedMessages(arg1) {
+  return window['go']['wailsbridge']['Bridge']['ClearQueuedMessages'](arg1);
+}
+
 export function CloseConnection() {
   return window['go']['wailsbridge']['Bridge']['CloseConnection']();
 }
 
+export function ContactUser(arg1, arg2, arg3, arg4) {
+  return window['go']['wailsbridge']['Bridge']['ContactUser'](arg1, arg2, arg3, arg4);
+}
+
+export function CreateIncognitoRoom() {
+  return window['go']['wailsbridge']['Bridge']['CreateIncognitoRoom']();
+}
+
 export function CreateRoom() {
   return window['go']['wailsbridge']['Bridge']['CreateRoom']();
 }
 
+export function DismissContactRequest(arg1) {
+  return window['go']['wailsbridge']['Bridge']['DismissContactRequest'](arg1);
+}
+
 export function EmitNetworkError(arg1) {
   return window['go']['wailsbridge']['Bridge']['EmitNetworkError'](arg1);
 }
@@ -18,30 +78,166 @@ export function EmitSecurityMessage(arg1) {
   return window['go']['wailsbridge']['Bridge']['EmitSecurityMessage'](arg1);
 }
 
+export function ExportIdentity(arg1) {
+  return window['go']['wailsbridge']['Bridge']['ExportIdentity'](arg1);
+}
+
 export function FindRoom(arg1) {
   return window['go']['wailsbridge']['Bridge']['FindRoom'](arg1);
 }
 
+export function ForgetPeer(arg1) {
+  return window['go']['wailsbridge']['Bridge']['ForgetPeer'](arg1);
+}
+
+export function GetArchiveStatus() {
+  return window['go']['wailsbridge']['Bridge']['GetArchiveStatus']();
+}
+
+export function GetAutostart() {
+  return window['go']['wailsbridge']['Bridge']['GetAutostart']();
+}
+
+export function GetBans() {
+  return window['go']['wailsbridge']['Bridge']['GetBans']();
+}
+
+export function GetContactRequests() {
+  return window['go']['wailsbridge']['Bridge']['GetContactRequests']();
+}
+
+export function GetDiagnostics() {
+  return window['go']['wailsbridge']['Bridge']['GetDiagnostics']();
+}
+
+export function GetHistory(arg1, arg2, arg3) {
+  return window['go']['wailsbridge']['Bridge']['GetHistory'](arg1, arg2, arg3);
+}
+
+export function GetHistoryRooms() {
+  return window['go']['wailsbridge']['Bridge']['GetHistoryRooms']();
+}
+
+export function GetInviteLink() {
+  return window['go']['wailsbridge']['Bridge']['GetInviteLink']();
+}
+
+export function GetLocaleSettings() {
+  return window['go']['wailsbridge']['Bridge']['GetLocaleSettings']();
+}
+
+export function GetLogLevel() {
+  return window['go']['wailsbridge']['Bridge']['GetLogLevel']();
+}
+
+export function GetMediaCacheStats() {
+  return window['go']['wailsbridge']['Bridge']['GetMediaCacheStats']();
+}
+
+export function GetMetrics() {
+  return window['go']['wailsbridge']['Bridge']['GetMetrics']();
+}
+
 export function GetNetworkStatus() {
   return window['go']['wailsbridge']['Bridge']['GetNetworkStatus']();
 }
 
+export function GetNickname() {
+  return window['go']['wailsbridge']['Bridge']['GetNickname']();
+}
+
+export function GetNotificationSettings() {
+  return window['go']['wailsbridge']['Bridge']['GetNotificationSettings']();
+}
+
+export function GetOriginalMedia(arg1) {
+  return window['go']['wailsbridge']['Bridge']['GetOriginalMedia'](arg1);
+}
+
 export function GetPeerFingerprint() {
   return window['go']['wailsbridge']['Bridge']['GetPeerFingerprint']();
 }
 
+export function GetPeerVerificationStates() {
+  return window['go']['wailsbridge']['Bridge']['GetPeerVerificationStates']();
+}
+
+export function GetPeers() {
+  return window['go']['wailsbridge']['Bridge']['GetPeers']();
+}
+
+export function GetPinnedPeers() {
+  return window['go']['wailsbridge']['Bridge']['GetPinnedPeers']();
+}
+
+export function GetPresence() {
+  return window['go']['wailsbridge']['Bridge']['GetPresence']();
+}
+
+export function GetProfile() {
+  return window['go']['wailsbridge']['Bridge']['GetProfile']();
+}
+
+export function GetQuarantinedPeers() {
+  return window['go']['wailsbridge']['Bridge']['GetQuarantinedPeers']();
+}
+
+export function GetQueuedMessages(arg1) {
+  return window['go']['wailsbridge']['Bridge']['GetQueuedMessages'](arg1);
+}
+
+export function GetRecentLogs(arg1, arg2) {
+  return window['go']['wailsbridge']['Bridge']['GetRecentLogs'](arg1, arg2);
+}
+
+export function GetRequireVerified() {
+  return window['go']['wailsbridge']['Bridge']['GetRequireVerified']();
+}
+
 export function GetRoomAccessKey() {
   return window['go']['wailsbridge']['Bridge']['GetRoomAccessKey']();
 }
 
+export function GetRoomShortcodes() {
+  return window['go']['wailsbridge']['Bridge']['GetRoomShortcodes']();
+}
+
 export function GetSecuritySummary() {
   return window['go']['wailsbridge']['Bridge']['GetSecuritySummary']();
 }
 
+export function GetSettings() {
+  return window['go']['wailsbridge']['Bridge']['GetSettings']();
+}
+
+export function GetTransfers() {
+  return window['go']['wailsbridge']['Bridge']['GetTransfers']();
+}
+
+export function GetUnreadCount() {
+  return window['go']['wailsbridge']['Bridge']['GetUnreadCount']();
+}
+
 export function GetUserID() {
   return window['go']['wailsbridge']['Bridge']['GetUserID']();
 }
 
+export function GetVerificationQR(arg1) {
+  return window['go']['wailsbridge']['Bridge']['GetVerificationQR'](arg1);
+}
+
+export function GetVoiceSupport() {
+  return window['go']['wailsbridge']['Bridge']['GetVoiceSupport']();
+}
+
+export function ImportIdentity(arg1) {
+  return window['go']['wailsbridge']['Bridge']['ImportIdentity'](arg1);
+}
+
+export function IsPrimaryDevice() {
+  return window['go']['wailsbridge']['Bridge']['IsPrimaryDevice']();
+}
+
 export function JoinRoom(arg1, arg2, arg3) {
   return window['go']['wailsbridge']['Bridge']['JoinRoom'](arg1, arg2, arg3);
 }
@@ -54,18 +250,206 @@ export function JoinUserByID(arg1, arg2) {
   return window['go']['wailsbridge']['Bridge']['JoinUserByID'](arg1, arg2);
 }
 
+export function KickPeer(arg1) {
+  return window['go']['wailsbridge']['Bridge']['KickPeer'](arg1);
+}
+
+export function LeaveRoom(arg1) {
+  return window['go']['wailsbridge']['Bridge']['LeaveRoom'](arg1);
+}
+
+export function ListRooms() {
+  return window['go']['wailsbridge']['Bridge']['ListRooms']();
+}
+
+export function MarkPeerVerified(arg1) {
+  return window['go']['wailsbridge']['Bridge']['MarkPeerVerified'](arg1);
+}
+
+export function MarkRoomRead(arg1) {
+  return window['go']['wailsbridge']['Bridge']['MarkRoomRead'](arg1);
+}
+
+export function OwnDevices() {
+  return window['go']['wailsbridge']['Bridge']['OwnDevices']();
+}
+
+export function PlayVoiceMessage(arg1) {
+  return window['go']['wailsbridge']['Bridge']['PlayVoiceMessage'](arg1);
+}
+
+export function Raise() {
+  return window['go']['wailsbridge']['Bridge']['Raise']();
+}
+
+export function ReceiveInvite(arg1) {
+  return window['go']['wailsbridge']['Bridge']['ReceiveInvite'](arg1);
+}
+
+export function ReceiveInviteLink(arg1) {
+  return window['go']['wailsbridge']['Bridge']['ReceiveInviteLink'](arg1);
+}
+
 export function RegenerateRoomAccessKey() {
   return window['go']['wailsbridge']['Bridge']['RegenerateRoomAccessKey']();
 }
 
+export function RejectPeer(arg1) {
+  return window['go']['wailsbridge']['Bridge']['RejectPeer'](arg1);
+}
+
+export function RejoinRooms() {
+  return window['go']['wailsbridge']['Bridge']['RejoinRooms']();
+}
+
+export function ReloadConfig() {
+  return window['go']['wailsbridge']['Bridge']['ReloadConfig']();
+}
+
+export function RemoveRoomShortcode(arg1) {
+  return window['go']['wailsbridge']['Bridge']['RemoveRoomShortcode'](arg1);
+}
+
+export function RenameRoom(arg1) {
+  return window['go']['wailsbridge']['Bridge']['RenameRoom'](arg1);
+}
+
+export function ReportActivity() {
+  return window['go']['wailsbridge']['Bridge']['ReportActivity']();
+}
+
+export function ResetDiagnostics() {
+  return window['go']['wailsbridge']['Bridge']['ResetDiagnostics']();
+}
+
+export function RotateRoomAccessKeyAndDisconnect() {
+  return window['go']['wailsbridge']['Bridge']['RotateRoomAccessKeyAndDisconnect']();
+}
+
+export function SaveReceivedFile(arg1) {
+  return window['go']['wailsbridge']['Bridge']['SaveReceivedFile'](arg1);
+}
+
+export function SearchMessages(arg1, arg2, arg3) {
+  return window['go']['wailsbridge']['Bridge']['SearchMessages'](arg1, arg2, arg3);
+}
+
+export function SelectRoom(arg1) {
+  return window['go']['wailsbridge']['Bridge']['SelectRoom'](arg1);
+}
+
+export function SendFile(arg1) {
+  return window['go']['wailsbridge']['Bridge']['SendFile'](arg1);
+}
+
+export function SendFileData(arg1, arg2) {
+  return window['go']['wailsbridge']['Bridge']['SendFileData'](arg1, arg2);
+}
+
+export function SendMedia(arg1, arg2, arg3) {
+  return window['go']['wailsbridge']['Bridge']['SendMedia'](arg1, arg2, arg3);
+}
+
 export function SendMessage(arg1) {
   return window['go']['wailsbridge']['Bridge']['SendMessage'](arg1);
 }
 
+export function SetAutostart(arg1, arg2) {
+  return window['go']['wailsbridge']['Bridge']['SetAutostart'](arg1, arg2);
+}
+
+export function SetAvatar(arg1) {
+  return window['go']['wailsbridge']['Bridge']['SetAvatar'](arg1);
+}
+
 export function SetContext(arg1) {
   return window['go']['wailsbridge']['Bridge']['SetContext'](arg1);
 }
 
+export function SetLocaleSettings(arg1, arg2) {
+  return window['go']['wailsbridge']['Bridge']['SetLocaleSettings'](arg1, arg2);
+}
+
+export function SetLogLevel(arg1) {
+  return window['go']['wailsbridge']['Bridge']['SetLogLevel'](arg1);
+}
+
+export function SetNotifications(arg1, arg2) {
+  return window['go']['wailsbridge']['Bridge']['SetNotifications'](arg1, arg2);
+}
+
+export function SetPeerRole(arg1, arg2) {
+  return window['go']['wailsbridge']['Bridge']['SetPeerRole'](arg1, arg2);
+}
+
+export function SetPresence(arg1) {
+  return window['go']['wailsbridge']['Bridge']['SetPresence'](arg1);
+}
+
+export function SetProfileStatus(arg1) {
+  return window['go']['wailsbridge']['Bridge']['SetProfileStatus'](arg1);
+}
+
+export function SetRequireVerified(arg1) {
+  return window['go']['wailsbridge']['Bridge']['SetRequireVerified'](arg1);
+}
+
+export function SetRoomMuted(arg1, arg2) {
+  return window['go']['wailsbridge']['Bridge']['SetRoomMuted'](arg1, arg2);
+}
+
+export function SetWindowFocused(arg1) {
+  return window['go']['wailsbridge']['Bridge']['SetWindowFocused'](arg1);
+}
+
+export function StartVoiceRecording() {
+  return window['go']['wailsbridge']['Bridge']['StartVoiceRecording']();
+}
+
+export function StopVoicePlayback() {
+  return window['go']['wailsbridge']['Bridge']['StopVoicePlayback']();
+}
+
+export function StopVoiceRecording() {
+  return window['go']['wailsbridge']['Bridge']['StopVoiceRecording']();
+}
+
+export function SyncHistory() {
+  return window['go']['wailsbridge']['Bridge']['SyncHistory']();
+}
+
+export function TakePendingInvite() {
+  return window['go']['wailsbridge']['Bridge']['TakePendingInvite']();
+}
+
+export function TrustPeerCertificate(arg1, arg2) {
+  return window['go']['wailsbridge']['Bridge']['TrustPeerCertificate'](arg1, arg2);
+}
+
+export function TrustPeerFingerprint(arg1, arg2) {
+  return window['go']['wailsbridge']['Bridge']['TrustPeerFingerprint'](arg1, arg2);
+}
+
+export function UnbanFingerprint(arg1) {
+  return window['go']['wailsbridge']['Bridge']['UnbanFingerprint'](arg1);
+}
+
+export function UnverifyPeer(arg1) {
+  return window['go']['wailsbridge']['Bridge']['UnverifyPeer'](arg1);
+}
+
 export function UpdateNickname(arg1) {
   return window['go']['wailsbridge']['Bridge']['UpdateNickname'](arg1);
 }
+
+export function UpdateSettings(arg1) {
+  return window['go']['wailsbridge']['Bridge']['UpdateSettings'](arg1);
+}
+
+export function VerifyScannedQR(arg1) {
+  return window['go']['wailsbridge']['Bridge']['VerifyScannedQR'](arg1);
+}
+
+export function WipeDevice(arg1) {
+  return window['go']['wailsbridge']['Bridge']['WipeDevice'](arg1);
+}
@@ -0,0 +1,122 @@
+package app
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"execp2p/internal/crypto"
+	"execp2p/internal/diagnostics"
+	"execp2p/internal/logger"
+	"execp2p/internal/network"
+	"execp2p/internal/room"
+)
+
+// accessKeyRotatedType tells room members the host has a new access key.
+// Members keep the new key so they can reconnect after a network hiccup;
+// anyone still holding the old one fails the access key handshake.
+const accessKeyRotatedType = "access_key_rotated"
+
+type accessKeyControl struct {
+	Type      string `json:"type"`
+	RoomID    string `json:"room_id"`
+	AccessKey string `json:"access_key"`
+}
+
+func (c accessKeyControl) controlType() string { return c.Type }
+
+// AccessKeyRotation is sent on AccessKeyNotices when the host's new key
+// arrives at a guest
+type AccessKeyRotation struct {
+	RoomID    string
+	AccessKey string
+}
+
+// RotateRoomAccessKey replaces the room access key (host or moderator). The new key
+// is sent to connected members over the encrypted channel, unless evict is
+// set: then they are disconnected and must rejoin with the new key, as does
+// anyone holding an old invite.
+func (e *ExecP2P) RotateRoomAccessKey(evict bool) (string, error) {
+	// moderator: the host rotates and sends us the new key
+	if delegated, err := e.delegate(moderationControl{Action: PermRotateKey, Evict: evict}); delegated {
+		return "", err
+	}
+	// Sprawdź czy jesteśmy twórcą pokoju
+	if e.network == nil || !e.network.IsListener() {
+		return "", fmt.Errorf("tylko twórca pokoju może zregenerować klucz dostępu")
+	}
+	// Sprawdź czy mamy pokój
+	if e.currentRoom == nil {
+		return "", fmt.Errorf("nie jesteśmy połączeni z żadnym pokojem")
+	}
+
+	// Zregeneruj klucz
+	var newKey string
+	if err := e.updateRoom(func(r *room.Room) error {
+		err := r.RegenerateAccessKey()
+		newKey = r.AccessKey
+		return err
+	}); err != nil {
+		return "", err
+	}
+	diagnostics.Inc(diagnostics.AccessKeyRotated)
+
+	qnet, ok := e.network.(*network.QuicNetwork)
+	if !ok {
+		return newKey, nil
+	}
+	// new connections have to prove the new key from now on
+	qnet.SetRoomAccessKey(newKey)
+
+	if len(qnet.Peers()) == 0 {
+		return newKey, nil
+	}
+	if evict {
+		logger.L().Info("Access key rotated; disconnecting current members")
+		// their membership certificates would let them straight back in
+		qnet.RevokeMemberships()
+		qnet.Disconnect("access key rotated")
+		return newKey, nil
+	}
+	if err := e.sendControl(accessKeyControl{Type: accessKeyRotatedType, RoomID: e.currentRoom.ID, AccessKey: newKey}); err != nil {
+		return newKey, fmt.Errorf("klucz zmieniony, ale nie udało się go przekazać uczestnikom: %w", err)
+	}
+	logger.L().Info("Access key rotated and sent to current members")
+	return newKey, nil
+}
+
+// AccessKeyNotices delivers access keys rotated by the host
+func (e *ExecP2P) AccessKeyNotices() <-chan AccessKeyRotation {
+	return e.accessKeyNotices
+}
+
+// handleAccessKeyRotated adopts the host's new access key (guests)
+func (e *ExecP2P) handleAccessKeyRotated(payload *crypto.MessagePayload) {
+	var ctl accessKeyControl
+	if err := json.Unmarshal([]byte(payload.Message), &ctl); err != nil {
+		logger.L().Warn("Invalid access key rotation", "err", err)
+		return
+	}
+	if e.network == nil || e.network.IsListener() || !e.fromHost(payload.SenderID) {
+		logger.L().Warn("Ignoring access key rotation from someone other than the host", "peer", payload.SenderID)
+		return
+	}
+	if e.currentRoom == nil || ctl.RoomID != e.currentRoom.ID || ctl.AccessKey == "" {
+		logger.L().Warn("Access key rotation for another room", "room_id", ctl.RoomID)
+		return
+	}
+
+	e.updateRoom(func(r *room.Room) error {
+		r.AccessKey = ctl.AccessKey
+		return nil
+	})
+	if qnet, ok := e.network.(*network.QuicNetwork); ok {
+		qnet.SetRoomAccessKey(ctl.AccessKey)
+	}
+	logger.L().Info("Room host rotated the access key", "room_id", ctl.RoomID)
+
+	select {
+	case e.accessKeyNotices <- AccessKeyRotation{RoomID: ctl.RoomID, AccessKey: ctl.AccessKey}:
+	default:
+		logger.L().Warn("Access key notice dropped; nobody is listening")
+	}
+}
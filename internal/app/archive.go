@@ -0,0 +1,187 @@
+package app
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"execp2p/internal/archive"
+	"execp2p/internal/crypto"
+	"execp2p/internal/logger"
+	"execp2p/internal/network"
+	"execp2p/internal/storage"
+	"execp2p/internal/xmpp"
+)
+
+// ArchiveStatus tells whether the host of the current room archives
+// decrypted traffic and whether the room is incognito, as stated in its
+// signed room metadata
+type ArchiveStatus struct {
+	RoomID    string    `json:"room_id"`
+	Incognito bool      `json:"incognito"`
+	Archiving bool      `json:"archiving"`
+	Sinks     []string  `json:"sinks"`
+	Since     time.Time `json:"since,omitempty"`
+	HostID    string    `json:"host_id"`
+	// whether we are the one archiving
+	Local bool `json:"local"`
+	// false until the host's metadata has arrived
+	Known bool `json:"known"`
+}
+
+// publishRoomMetadata starts the configured archive and XMPP gateway (host
+// only) and signs the room metadata every guest receives. The metadata is published even
+// without an archive so guests can tell "not archived" from "unknown".
+func (e *ExecP2P) publishRoomMetadata(qnet *network.QuicNetwork) error {
+	opts := archive.Options{File: e.config.Archive.File, Socket: e.config.Archive.Socket}
+	if opts.Enabled() {
+		if err := storage.Allow(e.currentRoom.ID); err != nil {
+			return fmt.Errorf("an incognito room cannot be archived: %w", err)
+		}
+		exporter, err := archive.Open(opts)
+		if err != nil {
+			return fmt.Errorf("failed to start archive: %w", err)
+		}
+		e.archive = exporter
+		logger.L().Warn("Room traffic is archived on this machine", "sinks", exporter.Sinks())
+	}
+	if err := e.openGateway(); err != nil {
+		return err
+	}
+
+	// a new room starts without custom shortcodes or appointed roles
+	e.shortcodes.Replace(nil)
+	e.roles.replace(nil)
+	return e.signRoomMetadata(qnet)
+}
+
+// signRoomMetadata signs the current state of the room (name, archive,
+// incognito, shortcodes, roles) and hands it to the network, which sends it
+// to guests
+func (e *ExecP2P) signRoomMetadata(qnet *network.QuicNetwork) error {
+	opts := crypto.RoomMetadataOptions{
+		Name:       e.currentRoom.Name,
+		Incognito:  e.currentRoom.Incognito,
+		Shortcodes: e.shortcodes.List(),
+		Roles:      e.roles.list(),
+	}
+	if e.archive != nil {
+		opts.ArchiveSinks, opts.ArchivingSince = e.archive.Sinks(), e.archive.Since()
+	}
+	if e.gateway != nil {
+		opts.ArchiveSinks = append(opts.ArchiveSinks, xmpp.SinkXMPP)
+		if opts.ArchivingSince.IsZero() {
+			opts.ArchivingSince = e.gatewaySince
+		}
+	}
+
+	meta, err := e.pqCrypto.CreateRoomMetadata(e.currentRoom.ID, e.peerID, opts)
+	if err != nil {
+		return fmt.Errorf("failed to sign room metadata: %w", err)
+	}
+	if err := qnet.SetRoomMetadata(meta); err != nil {
+		return err
+	}
+	e.notifyArchiveStatus(e.archiveStatusFrom(meta))
+	return nil
+}
+
+// onRoomMetadata is called on guests for every verified record from the host
+func (e *ExecP2P) onRoomMetadata(meta *crypto.RoomMetadata) {
+	if meta.Archiving {
+		logger.L().Warn("Room host archives decrypted traffic", "host", meta.HostID, "sinks", meta.ArchiveSinks)
+	}
+	if meta.Incognito {
+		e.adoptIncognito(meta.RoomID)
+	}
+	e.adoptShortcodes(meta)
+	e.adoptRoles(meta)
+	e.notifyArchiveStatus(e.archiveStatusFrom(meta))
+}
+
+// archiveMessage writes a sent or delivered chat message to the archive
+func (e *ExecP2P) archiveMessage(payload *crypto.MessagePayload, outgoing bool) {
+	if e.archive == nil || isKeepAlive(payload.Message) {
+		return
+	}
+	direction := archive.DirectionIn
+	if outgoing {
+		direction = archive.DirectionOut
+	}
+	roomID := ""
+	if e.currentRoom != nil {
+		roomID = e.currentRoom.ID
+	}
+	if err := e.archive.Write(archive.Record{
+		RoomID:    roomID,
+		MessageID: payload.MessageID,
+		SenderID:  payload.SenderID,
+		Direction: direction,
+
+		SenderName: e.DisplayName(payload.SenderID),
+		Timestamp:  payload.Timestamp,
+		Message:    payload.Message,
+
+		TimeFormatted: e.FormatTime(payload.Timestamp).DateTime,
+	}); err != nil {
+		logger.L().Warn("Failed to archive message", "err", err)
+	}
+}
+
+// closeArchive stops the archive sinks, if any
+func (e *ExecP2P) closeArchive() {
+	if e.archive == nil {
+		return
+	}
+	if err := e.archive.Close(); err != nil {
+		logger.L().Warn("Failed to close archive", "err", err)
+	}
+	e.archive = nil
+}
+
+// ArchiveStatus returns the archiving label of the current room
+func (e *ExecP2P) ArchiveStatus() ArchiveStatus {
+	qnet, ok := e.network.(*network.QuicNetwork)
+	if !ok || qnet == nil {
+		return ArchiveStatus{}
+	}
+	meta := qnet.RoomMetadata()
+	if meta == nil {
+		return ArchiveStatus{}
+	}
+	return e.archiveStatusFrom(meta)
+}
+
+// ArchiveNotices delivers the archiving label whenever it is (re)announced
+func (e *ExecP2P) ArchiveNotices() <-chan ArchiveStatus {
+	return e.archiveNotices
+}
+
+func (e *ExecP2P) archiveStatusFrom(meta *crypto.RoomMetadata) ArchiveStatus {
+	return ArchiveStatus{
+		RoomID:    meta.RoomID,
+		Incognito: meta.Incognito,
+		Archiving: meta.Archiving,
+		Sinks:     meta.ArchiveSinks,
+		Since:     meta.ArchivingSince,
+		HostID:    meta.HostID,
+		Local:     meta.HostID == e.peerID,
+		Known:     true,
+	}
+}
+
+func (e *ExecP2P) notifyArchiveStatus(status ArchiveStatus) {
+	select {
+	case e.archiveNotices <- status:
+	default:
+		logger.L().Warn("Archive notice dropped; nobody is listening")
+	}
+}
+
+// isKeepAlive reports whether a message is the bridge's keep-alive signal
+func isKeepAlive(message string) bool {
+	var msg struct {
+		Type string `json:"type"`
+	}
+	return json.Unmarshal([]byte(message), &msg) == nil && msg.Type == "keep_alive"
+}
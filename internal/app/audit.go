@@ -0,0 +1,120 @@
+package app
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"execp2p/internal/config"
+	"execp2p/internal/logger"
+)
+
+// The security audit log records what was done to this device's identity
+// and data on another device's orders: remote wipes ordered, refused and
+// carried out. It is one JSON object per line in the log directory, which a
+// wipe leaves in place, and holds no keys or messages. Nothing is written
+// in ephemeral mode.
+
+// AuditFile is the name of the security audit log in the log directory
+const AuditFile = "security-audit.log"
+
+// security audit events
+const (
+	// we ordered a linked device to wipe itself
+	AuditWipeOrdered = "remote_wipe_ordered"
+	// the order reached the device
+	AuditWipeSent = "remote_wipe_sent"
+	// a wipe order we received was not obeyed
+	AuditWipeRefused = "remote_wipe_refused"
+	// we wiped ourselves on the primary device's orders
+	AuditWiped = "device_wiped"
+)
+
+// AuditRecord is one event of the security audit log
+type AuditRecord struct {
+	Time  time.Time `json:"time"`
+	Event string    `json:"event"`
+	// the other device
+	PeerID string `json:"peer_id,omitempty"`
+	// the identity both devices hold
+	Fingerprint string `json:"fingerprint,omitempty"`
+	Detail      string `json:"detail,omitempty"`
+}
+
+// auditMu keeps the records of concurrent sessions on lines of their own
+var auditMu sync.Mutex
+
+// audit appends rec to the security audit log
+func audit(cfg *config.Config, rec AuditRecord) {
+	logger.L().Warn("Security audit", "event", rec.Event, "peer", rec.PeerID, "detail", rec.Detail)
+	if cfg.Identity.Ephemeral {
+		return
+	}
+	if err := appendAudit(cfg, rec); err != nil {
+		logger.L().Error("Security audit record not written", "event", rec.Event, "err", err)
+	}
+}
+
+func appendAudit(cfg *config.Config, rec AuditRecord) error {
+	dir, err := LogDir(cfg)
+	if err != nil {
+		return err
+	}
+	if rec.Time.IsZero() {
+		rec.Time = time.Now().UTC()
+	}
+	line, err := json.Marshal(rec)
+	if err != nil {
+		return err
+	}
+
+	auditMu.Lock()
+	defer auditMu.Unlock()
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		return err
+	}
+	f, err := os.OpenFile(filepath.Join(dir, AuditFile), os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0o600)
+	if err != nil {
+		return err
+	}
+	if _, err := f.Write(append(line, '\n')); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Sync(); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// AuditLog returns the records of the security audit log, oldest first
+func AuditLog(cfg *config.Config) ([]AuditRecord, error) {
+	dir, err := LogDir(cfg)
+	if err != nil {
+		return nil, err
+	}
+	f, err := os.Open(filepath.Join(dir, AuditFile))
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var records []AuditRecord
+	scanner := bufio.NewScanner(f)
+	for line := 1; scanner.Scan(); line++ {
+		var rec AuditRecord
+		if err := json.Unmarshal(scanner.Bytes(), &rec); err != nil {
+			return records, fmt.Errorf("%s line %d: %w", AuditFile, line, err)
+		}
+		records = append(records, rec)
+	}
+	return records, scanner.Err()
+}
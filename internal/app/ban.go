@@ -0,0 +1,186 @@
+package app
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"execp2p/internal/ban"
+	"execp2p/internal/crypto"
+	"execp2p/internal/logger"
+	"execp2p/internal/network"
+	"execp2p/internal/storage"
+)
+
+// banType tells room members the host banned an identity, or lifted a ban.
+// The host's network refuses banned fingerprints at the announcement, so a
+// new peer ID or an old invite doesn't get them back in.
+const banType = "banned"
+
+type banControl struct {
+	Type        string `json:"type"`
+	RoomID      string `json:"room_id"`
+	Fingerprint string `json:"fingerprint"`
+	Nickname    string `json:"nickname,omitempty"`
+	Reason      string `json:"reason,omitempty"`
+	Lifted      bool   `json:"lifted,omitempty"`
+}
+
+func (c banControl) controlType() string { return c.Type }
+
+// BanChange is sent on BanNotices when an identity was banned from the room
+// or its ban lifted
+type BanChange struct {
+	RoomID      string
+	Fingerprint string
+	Nickname    string
+	Reason      string
+	Lifted      bool
+	// made by us, the host
+	Local bool
+}
+
+func newBans(db *storage.DB) *ban.List {
+	bucket, err := db.Bucket(ban.BucketName)
+	if err != nil {
+		logger.L().Warn("Bans are kept in memory only", "err", err)
+		return ban.New(nil)
+	}
+	return ban.New(bucket)
+}
+
+// Bans returns the identities banned from the current room
+func (e *ExecP2P) Bans() []ban.Entry {
+	if e.currentRoom == nil {
+		return nil
+	}
+	return e.bans.Entries(e.currentRoom.ID)
+}
+
+// BanPeer bans the identity of a peer from the room and removes the peer
+// if it is connected
+func (e *ExecP2P) BanPeer(peerID, reason string) error {
+	if delegated, err := e.delegate(moderationControl{Action: PermBan, PeerID: peerID, Reason: reason}); delegated {
+		return err
+	}
+	fingerprint, err := e.pqCrypto.GetPeerFingerprint(peerID)
+	if err != nil {
+		return fmt.Errorf("nieznana tożsamość uczestnika %s: %w", peerID, err)
+	}
+	return e.BanFingerprint(fingerprint, reason)
+}
+
+// BanFingerprint bans an identity from the room: members are told, a
+// connected peer with that identity is removed, and it is refused from then
+// on. Moderators ask the host, which keeps the list.
+func (e *ExecP2P) BanFingerprint(fingerprint, reason string) error {
+	if delegated, err := e.delegate(moderationControl{Action: PermBan, Fingerprint: fingerprint, Reason: reason}); delegated {
+		return err
+	}
+	qnet, err := e.hostNetwork()
+	if err != nil {
+		return err
+	}
+	fingerprint = strings.ToLower(strings.TrimSpace(fingerprint))
+	if _, err := hex.DecodeString(fingerprint); err != nil || fingerprint == "" {
+		return fmt.Errorf("nieprawidłowy odcisk tożsamości %q", fingerprint)
+	}
+	if own, err := e.pqCrypto.GetIdentityFingerprint(); err == nil && own == fingerprint {
+		return fmt.Errorf("nie można zablokować własnej tożsamości")
+	}
+
+	entry := ban.Entry{Fingerprint: fingerprint, Nickname: e.fingerprintName(fingerprint), Reason: reason}
+	if !e.bans.Add(e.currentRoom.ID, entry) {
+		return nil
+	}
+	qnet.SetBanned(e.bans.Fingerprints(e.currentRoom.ID))
+	logger.L().Info("Identity banned from the room", "room_id", e.currentRoom.ID, "fingerprint", fingerprint)
+	if e.dropRole(fingerprint) {
+		if err := e.signRoomMetadata(qnet); err != nil {
+			logger.L().Warn("Room metadata not updated after ban", "err", err)
+		}
+	}
+
+	change := BanChange{RoomID: e.currentRoom.ID, Fingerprint: fingerprint, Nickname: entry.Nickname, Reason: reason, Local: true}
+	e.notifyBan(change)
+	if len(e.connectedPeers()) > 0 {
+		e.sendControl(banControl{Type: banType, RoomID: change.RoomID, Fingerprint: fingerprint, Nickname: entry.Nickname, Reason: reason})
+	}
+	for _, id := range e.connectedPeers() {
+		if fp, err := e.pqCrypto.GetPeerFingerprint(id); err == nil && fp == fingerprint {
+			if err := e.KickPeer(id, network.ErrBanned.Error()); err != nil {
+				logger.L().Warn("Banned peer not removed", "peer", id, "err", err)
+			}
+		}
+	}
+	return nil
+}
+
+// UnbanFingerprint lifts the ban of an identity
+func (e *ExecP2P) UnbanFingerprint(fingerprint string) error {
+	if delegated, err := e.delegate(moderationControl{Action: PermBan, Fingerprint: fingerprint, Lift: true}); delegated {
+		return err
+	}
+	qnet, err := e.hostNetwork()
+	if err != nil {
+		return err
+	}
+	fingerprint = strings.ToLower(strings.TrimSpace(fingerprint))
+	if !e.bans.Remove(e.currentRoom.ID, fingerprint) {
+		return fmt.Errorf("tożsamość %s nie jest zablokowana", fingerprint)
+	}
+	qnet.SetBanned(e.bans.Fingerprints(e.currentRoom.ID))
+	logger.L().Info("Ban lifted", "room_id", e.currentRoom.ID, "fingerprint", fingerprint)
+
+	change := BanChange{RoomID: e.currentRoom.ID, Fingerprint: fingerprint, Nickname: e.fingerprintName(fingerprint), Lifted: true, Local: true}
+	e.notifyBan(change)
+	if len(e.connectedPeers()) > 0 {
+		e.sendControl(banControl{Type: banType, RoomID: change.RoomID, Fingerprint: fingerprint, Nickname: change.Nickname, Lifted: true})
+	}
+	return nil
+}
+
+// BanNotices delivers bans made by the host, ours included
+func (e *ExecP2P) BanNotices() <-chan BanChange {
+	return e.banNotices
+}
+
+// fingerprintName is the name an identity goes by: a connected peer's, or
+// the one in its cached profile
+func (e *ExecP2P) fingerprintName(fingerprint string) string {
+	for _, id := range e.connectedPeers() {
+		if fp, err := e.pqCrypto.GetPeerFingerprint(id); err == nil && fp == fingerprint {
+			return e.DisplayName(id)
+		}
+	}
+	if p, ok := e.profiles.cache.Get(fingerprint); ok {
+		return p.Nickname
+	}
+	return ""
+}
+
+// handleBan passes on a ban the host announced (guests)
+func (e *ExecP2P) handleBan(payload *crypto.MessagePayload) {
+	var ctl banControl
+	if err := json.Unmarshal([]byte(payload.Message), &ctl); err != nil {
+		logger.L().Warn("Invalid ban control message", "err", err)
+		return
+	}
+	if e.network == nil || e.network.IsListener() || !e.fromHost(payload.SenderID) {
+		logger.L().Warn("Ignoring ban from someone other than the host", "peer", payload.SenderID)
+		return
+	}
+	if e.currentRoom == nil || ctl.RoomID != e.currentRoom.ID || ctl.Fingerprint == "" {
+		return
+	}
+	e.notifyBan(BanChange{RoomID: ctl.RoomID, Fingerprint: ctl.Fingerprint, Nickname: ctl.Nickname, Reason: ctl.Reason, Lifted: ctl.Lifted})
+}
+
+func (e *ExecP2P) notifyBan(change BanChange) {
+	select {
+	case e.banNotices <- change:
+	default:
+		// nobody is listening
+	}
+}
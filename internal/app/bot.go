@@ -0,0 +1,240 @@
+package app
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"execp2p/internal/config"
+	"execp2p/internal/crypto"
+	"execp2p/internal/logger"
+
+	"golang.org/x/time/rate"
+)
+
+// botReplyTimeout bounds one command handler and the sending of its reply
+const botReplyTimeout = 10 * time.Second
+
+// Command is a bot command received in the room, e.g. "!status verbose"
+type Command struct {
+	// without the prefix, lower case
+	Name string
+	Args []string
+	// the whole message text
+	Text string
+
+	SenderID   string
+	SenderName string
+	RoomID     string
+}
+
+// CommandHandler answers a command; a non-empty reply is sent to the room
+type CommandHandler func(ctx context.Context, cmd Command) (string, error)
+
+// bot answers commands in the room when enabled. Replies are rate limited
+// per sender and for the whole room, so a flood of commands, or two bots
+// talking to each other, can't flood the room.
+type bot struct {
+	mu       sync.Mutex
+	enabled  bool
+	prefix   string
+	handlers map[string]CommandHandler
+
+	perSender rate.Limit
+	burst     int
+	senders   map[string]*rate.Limiter
+	room      *rate.Limiter
+}
+
+func newBot(cfg config.BotConfig) *bot {
+	perSender := rate.Every(time.Minute / time.Duration(max(1, cfg.RepliesPerMinute)))
+	roomRate := rate.Every(time.Minute / time.Duration(max(1, cfg.RoomRepliesPerMinute)))
+	return &bot{
+		enabled:   cfg.Enabled,
+		prefix:    cfg.Prefix,
+		handlers:  make(map[string]CommandHandler),
+		perSender: perSender,
+		burst:     max(1, cfg.RepliesPerMinute),
+		senders:   make(map[string]*rate.Limiter),
+		room:      rate.NewLimiter(roomRate, max(1, cfg.RoomRepliesPerMinute)),
+	}
+}
+
+// configure takes new settings; the rate limits start afresh
+func (b *bot) configure(cfg config.BotConfig) {
+	fresh := newBot(cfg)
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.enabled, b.prefix = fresh.enabled, fresh.prefix
+	b.perSender, b.burst, b.senders, b.room = fresh.perSender, fresh.burst, fresh.senders, fresh.room
+}
+
+// RegisterCommand makes the bot answer prefix+name with handler; names are
+// case-insensitive and a later registration replaces an earlier one
+func (e *ExecP2P) RegisterCommand(name string, handler CommandHandler) error {
+	name = strings.ToLower(strings.TrimSpace(name))
+	if name == "" || strings.ContainsAny(name, " \t\n") {
+		return fmt.Errorf("invalid command name %q", name)
+	}
+	if handler == nil {
+		return errors.New("command handler is nil")
+	}
+	e.bot.mu.Lock()
+	defer e.bot.mu.Unlock()
+	e.bot.handlers[name] = handler
+	return nil
+}
+
+// UnregisterCommand stops answering a command
+func (e *ExecP2P) UnregisterCommand(name string) {
+	e.bot.mu.Lock()
+	defer e.bot.mu.Unlock()
+	delete(e.bot.handlers, strings.ToLower(name))
+}
+
+// SetBotEnabled switches answering commands on or off
+func (e *ExecP2P) SetBotEnabled(enabled bool) {
+	e.bot.mu.Lock()
+	defer e.bot.mu.Unlock()
+	e.bot.enabled = enabled
+}
+
+// BotEnabled reports whether commands are answered
+func (e *ExecP2P) BotEnabled() bool {
+	e.bot.mu.Lock()
+	defer e.bot.mu.Unlock()
+	return e.bot.enabled
+}
+
+// Commands returns the names of the registered commands, sorted
+func (e *ExecP2P) Commands() []string {
+	e.bot.mu.Lock()
+	defer e.bot.mu.Unlock()
+	names := make([]string, 0, len(e.bot.handlers))
+	for name := range e.bot.handlers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// answerCommand runs the handler of a command sent by a peer, if the bot
+// is on, the message is one and the rate limits allow a reply
+func (e *ExecP2P) answerCommand(payload *crypto.MessagePayload, outgoing bool) {
+	if outgoing || payload.SenderID == e.peerID || e.currentRoom == nil {
+		return
+	}
+	text := messageText(payload.Message)
+	cmd, handler, ok := e.bot.match(text)
+	if !ok {
+		return
+	}
+	if !e.bot.allow(payload.SenderID) {
+		logger.L().Info("Bot reply rate limited", "command", cmd.Name, "sender", payload.SenderID)
+		return
+	}
+	cmd.SenderID, cmd.SenderName, cmd.RoomID = payload.SenderID, e.DisplayName(payload.SenderID), e.currentRoom.ID
+
+	go func() {
+		ctx, cancel := context.WithTimeout(context.Background(), botReplyTimeout)
+		defer cancel()
+		reply, err := handler(ctx, cmd)
+		if err != nil {
+			logger.L().Warn("Bot command failed", "command", cmd.Name, "err", err)
+			reply = "Błąd polecenia " + e.bot.prefix + cmd.Name + ": " + err.Error()
+		}
+		if reply == "" {
+			return
+		}
+		body, err := json.Marshal(map[string]string{"type": "text", "content": reply})
+		if err == nil {
+			err = e.SendMessage(ctx, string(body))
+		}
+		if err != nil {
+			logger.L().Warn("Failed to send bot reply", "command", cmd.Name, "err", err)
+		}
+	}()
+}
+
+// match parses a command and finds its handler
+func (b *bot) match(text string) (Command, CommandHandler, bool) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if !b.enabled || b.prefix == "" || !strings.HasPrefix(text, b.prefix) {
+		return Command{}, nil, false
+	}
+	fields := strings.Fields(strings.TrimPrefix(text, b.prefix))
+	if len(fields) == 0 {
+		return Command{}, nil, false
+	}
+	cmd := Command{Name: strings.ToLower(fields[0]), Args: fields[1:], Text: text}
+	handler, ok := b.handlers[cmd.Name]
+	return cmd, handler, ok
+}
+
+// allow takes a reply from the sender's and the room's allowance
+func (b *bot) allow(senderID string) bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	limiter, ok := b.senders[senderID]
+	if !ok {
+		limiter = rate.NewLimiter(b.perSender, b.burst)
+		b.senders[senderID] = limiter
+	}
+	// the room allowance is only spent on replies the sender may get
+	if limiter.Tokens() < 1 {
+		return false
+	}
+	return b.room.Allow() && limiter.Allow()
+}
+
+// messageText is the text of a chat message: the content of the frontends'
+// JSON form, or the message itself
+func messageText(message string) string {
+	var msg struct {
+		Type    string `json:"type"`
+		Content string `json:"content"`
+	}
+	if json.Unmarshal([]byte(message), &msg) != nil || msg.Type == "" {
+		return strings.TrimSpace(message)
+	}
+	if msg.Type != "text" {
+		return ""
+	}
+	return strings.TrimSpace(msg.Content)
+}
+
+// registerBuiltinCommands adds the commands every bot answers
+func (e *ExecP2P) registerBuiltinCommands() {
+	e.RegisterCommand("help", func(ctx context.Context, cmd Command) (string, error) {
+		names := e.Commands()
+		for i, name := range names {
+			names[i] = e.bot.prefix + name
+		}
+		return "Polecenia: " + strings.Join(names, ", "), nil
+	})
+	e.RegisterCommand("status", func(ctx context.Context, cmd Command) (string, error) {
+		// the session of the room the command came from
+		session := e
+		if s, ok := e.Session(cmd.RoomID); ok {
+			session = s
+		}
+		status := session.GetNetworkStatus()
+		reply := fmt.Sprintf("Pokój %s, rozmówcy: %d", status.RoomID, status.ConnectedPeers)
+		if status.E2EEncryption {
+			reply += ", szyfrowanie E2E"
+		}
+		if fp, err := e.GetPeerFingerprint(); err == nil && len(fp) >= 16 {
+			reply += ", mój odcisk palca: " + fp[:16] + "…"
+		}
+		return reply, nil
+	})
+	if e.config.XMPP.Server != "" {
+		e.registerGatewayCommand()
+	}
+}
@@ -0,0 +1,63 @@
+package app
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+
+	"execp2p/internal/logger"
+	"execp2p/internal/network"
+	"execp2p/internal/storage"
+)
+
+// certBucket holds our transport certificate. Peers pin it next to our
+// identity, so it is made once per identity and kept; its expiry isn't
+// checked by either end.
+const certBucket = "tls"
+
+type storedCertificate struct {
+	Certificate []byte `json:"certificate"`
+	// PKCS #8
+	Key []byte `json:"key"`
+}
+
+// loadCertificate returns the transport certificate of our identity, making
+// and storing one with a keyType key on first use. An ephemeral identity gets
+// a new one every run, as it gets a new identity. A stored certificate with
+// another type of key is replaced, which peers that pinned it will notice.
+func loadCertificate(db *storage.DB, keyType string) (tls.Certificate, error) {
+	bucket, err := db.Bucket(certBucket)
+	if err != nil {
+		logger.L().Warn("Transport certificate is kept in memory only", "err", err)
+		return network.NewCertificate(keyType)
+	}
+
+	var stored storedCertificate
+	if ok, err := bucket.GetJSON("certificate", &stored); err != nil {
+		logger.L().Warn("Stored transport certificate unreadable; making a new one", "err", err)
+	} else if ok {
+		key, err := x509.ParsePKCS8PrivateKey(stored.Key)
+		cert := tls.Certificate{Certificate: [][]byte{stored.Certificate}, PrivateKey: key}
+		switch {
+		case err != nil:
+			logger.L().Warn("Stored transport certificate unreadable; making a new one", "err", err)
+		case network.CertificateKeyType(cert) != keyType:
+			logger.L().Warn("Stored transport certificate has another key type; making a new one, peers will be alerted",
+				"stored", network.CertificateKeyType(cert), "configured", keyType)
+		default:
+			return cert, nil
+		}
+	}
+
+	cert, err := network.NewCertificate(keyType)
+	if err != nil {
+		return tls.Certificate{}, err
+	}
+	key, err := x509.MarshalPKCS8PrivateKey(cert.PrivateKey)
+	if err != nil {
+		return tls.Certificate{}, err
+	}
+	if err := bucket.PutJSON("certificate", storedCertificate{Certificate: cert.Certificate[0], Key: key}); err != nil {
+		logger.L().Warn("Transport certificate not saved; peers will see a new one next time", "err", err)
+	}
+	return cert, nil
+}
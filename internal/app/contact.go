@@ -0,0 +1,375 @@
+package app
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"regexp"
+	"slices"
+	"strings"
+	"time"
+
+	"execp2p/internal/crash"
+	"execp2p/internal/crypto"
+	"execp2p/internal/logger"
+	"execp2p/internal/mailbox"
+	"execp2p/internal/roster"
+	"execp2p/internal/trust"
+)
+
+// First contact: with mailbox.contact_me, a bundle signed with our identity
+// key is published on the relay under our user ID. It holds a prekey and our
+// mailbox ID, so someone who knows only the ID can leave us a first message,
+// sealed with their identity to the prekey, and where to meet them. The
+// prekey is replaced every week; once its last bundle has expired and the
+// relay has dropped what was sent to it, it is deleted.
+const (
+	prekeyBucket         = "prekeys"
+	contactRequestBucket = "contact_requests"
+
+	// a new prekey is published once the current one is this old
+	prekeyRotation = 7 * 24 * time.Hour
+	// how long a published bundle is valid; it is published again daily
+	bundleLifetime  = 30 * 24 * time.Hour
+	bundleRepublish = 24 * time.Hour
+	// the relay keeps envelopes this long, so a prekey is kept this much
+	// longer than its last bundle
+	mailboxRetention = 7 * 24 * time.Hour
+	// first messages kept until accepted or dismissed; more are dropped
+	maxContactRequests = 200
+	// longest first message
+	maxContactMessage = 2000
+)
+
+var userIDPattern = regexp.MustCompile(`^[0-9a-f]{32}$`)
+
+var (
+	// ErrNoContactBundle means nobody published a bundle under the user ID
+	ErrNoContactBundle = errors.New("no contact bundle under this user ID")
+	// ErrContactFingerprint means the published bundle is of another identity
+	// than the one expected
+	ErrContactFingerprint = errors.New("contact bundle has a different fingerprint")
+)
+
+// ContactRequest is a first message from someone we haven't met, kept
+// encrypted until accepted or dismissed
+type ContactRequest struct {
+	ID          string `json:"id"`
+	SenderID    string `json:"sender_id"`
+	SenderName  string `json:"sender_name"`
+	Fingerprint string `json:"fingerprint"`
+	Message     string `json:"message"`
+	// where to meet the sender, if they asked to
+	Rendezvous *crypto.Rendezvous `json:"rendezvous,omitempty"`
+	SentAt     time.Time          `json:"sent_at"`
+	// the sender's identity is already pinned under its ID
+	Known bool `json:"known"`
+}
+
+// prekey is a prekey of our contact bundle
+type prekey struct {
+	ID      string    `json:"id"`
+	Public  []byte    `json:"public"`
+	Private []byte    `json:"private"`
+	Created time.Time `json:"created"`
+	// when the last bundle with it expires
+	Expires time.Time `json:"expires"`
+}
+
+// startContactMe checks the mailbox once at startup, so what was left while
+// we were away is read, and keeps our contact bundle published
+func (e *ExecP2P) startContactMe() {
+	if e.mailbox.client == nil {
+		return
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	e.mailbox.stop = cancel
+	go e.serveContactMe(ctx)
+}
+
+// stopContactMe ends startContactMe's loop
+func (e *ExecP2P) stopContactMe() {
+	if e.mailbox.stop != nil {
+		e.mailbox.stop()
+	}
+}
+
+func (e *ExecP2P) serveContactMe(ctx context.Context) {
+	defer crash.Recover("app.serveContactMe")
+	if _, err := e.CheckMailbox(ctx); err != nil {
+		logger.L().Debug("Mailbox check failed", "err", err)
+	}
+	if !e.config.Mailbox.ContactMe {
+		return
+	}
+	if !e.identity.persistent {
+		logger.L().Warn("No contact bundle is published for an ephemeral identity")
+		return
+	}
+	ticker := e.clock.NewTicker(e.config.Mailbox.PollInterval)
+	defer ticker.Stop()
+	var published time.Time
+	for {
+		if time.Since(published) >= bundleRepublish {
+			if err := e.publishContactBundle(ctx); err != nil {
+				logger.L().Warn("Failed to publish contact bundle", "err", err)
+			} else {
+				published = time.Now()
+			}
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C():
+		}
+		// in a room, pollMailbox checks
+		if len(e.Sessions()) == 0 {
+			if _, err := e.CheckMailbox(ctx); err != nil {
+				logger.L().Debug("Mailbox check failed", "err", err)
+			}
+		}
+	}
+}
+
+// publishContactBundle signs a bundle with the current prekey, replacing it
+// if it is due, and puts it on the relay
+func (e *ExecP2P) publishContactBundle(ctx context.Context) error {
+	if e.mailbox.prekeys == nil {
+		return errors.New("first contact is disabled")
+	}
+	secret, err := e.pqCrypto.MailboxSecret()
+	if err != nil {
+		return err
+	}
+	key, err := e.currentPrekey()
+	if err != nil {
+		return err
+	}
+	bundle := crypto.ContactBundle{
+		UserID:       e.peerID,
+		PrekeyID:     key.ID,
+		PrekeyPubKey: key.Public,
+		MailboxID:    mailbox.ID(secret),
+		Expires:      time.Now().Add(bundleLifetime).UTC(),
+	}
+	if err := e.pqCrypto.SignContactBundle(&bundle); err != nil {
+		return err
+	}
+	key.Expires = bundle.Expires
+	if err := e.mailbox.prekeys.PutJSON(key.ID, key); err != nil {
+		return err
+	}
+	data, err := json.Marshal(&bundle)
+	if err != nil {
+		return err
+	}
+	if err := e.mailbox.client.Publish(ctx, secret, e.peerID, data); err != nil {
+		return err
+	}
+	logger.L().Info("Contact bundle published", "user_id", e.peerID, "prekey", key.ID)
+	return nil
+}
+
+// currentPrekey returns the newest prekey, or a new one when it is due.
+// Prekeys nothing can be sent to any more are deleted.
+func (e *ExecP2P) currentPrekey() (prekey, error) {
+	var newest prekey
+	for _, id := range e.mailbox.prekeys.Keys() {
+		var key prekey
+		if ok, err := e.mailbox.prekeys.GetJSON(id, &key); err != nil || !ok {
+			continue
+		}
+		if time.Now().After(key.Expires.Add(mailboxRetention)) {
+			if err := e.mailbox.prekeys.SecureDelete(id); err != nil {
+				logger.L().Warn("Failed to delete old prekey", "prekey", id, "err", err)
+			}
+			continue
+		}
+		if key.Created.After(newest.Created) {
+			newest = key
+		}
+	}
+	if newest.ID != "" && time.Since(newest.Created) < prekeyRotation {
+		return newest, nil
+	}
+	id, pub, priv, err := e.pqCrypto.NewPrekey()
+	if err != nil {
+		return prekey{}, err
+	}
+	return prekey{ID: id, Public: pub, Private: priv, Created: time.Now().UTC()}, nil
+}
+
+// openFirstContact opens a first message from the mailbox and keeps it as a
+// contact request
+func (e *ExecP2P) openFirstContact(item mailbox.Item) error {
+	if e.mailbox.requests == nil {
+		return errors.New("first contact is disabled")
+	}
+	fc, err := crypto.DeserializeFirstContact(item.Data)
+	if err != nil {
+		return err
+	}
+	var key prekey
+	if ok, err := e.mailbox.prekeys.GetJSON(fc.PrekeyID, &key); err != nil || !ok {
+		return fmt.Errorf("first contact for unknown prekey %s", fc.PrekeyID)
+	}
+	req, fingerprint, err := e.pqCrypto.OpenFirstContact(fc, key.Private)
+	if err != nil {
+		return err
+	}
+	if _, ok := e.trust.Quarantined(req.SenderID); ok {
+		return ErrPeerQuarantined
+	}
+	if e.mailbox.requests.Len() >= maxContactRequests {
+		return errors.New("too many contact requests waiting")
+	}
+	if !userIDPattern.MatchString(req.SenderID) {
+		return fmt.Errorf("first contact with invalid sender ID")
+	}
+	if len([]rune(req.Message)) > maxContactMessage {
+		return errors.New("first contact message too long")
+	}
+	if rv := req.Rendezvous; rv != nil && (rv.RoomID == "" || rv.AccessKey == "") {
+		req.Rendezvous = nil
+	}
+	pinned, known := e.trust.Get(req.SenderID)
+	return e.mailbox.requests.PutJSON(item.ID, ContactRequest{
+		ID:          item.ID,
+		SenderID:    req.SenderID,
+		SenderName:  roster.CleanNickname(req.SenderName),
+		Fingerprint: fingerprint,
+		Message:     req.Message,
+		Rendezvous:  req.Rendezvous,
+		SentAt:      req.Timestamp,
+		Known:       known && pinned.Fingerprint == fingerprint,
+	})
+}
+
+// ContactRequests lists the first messages waiting, oldest first
+func (e *ExecP2P) ContactRequests() []ContactRequest {
+	if e.mailbox.requests == nil {
+		return nil
+	}
+	var requests []ContactRequest
+	for _, id := range e.mailbox.requests.Keys() {
+		var req ContactRequest
+		if ok, err := e.mailbox.requests.GetJSON(id, &req); err == nil && ok {
+			requests = append(requests, req)
+		}
+	}
+	slices.SortFunc(requests, func(a, b ContactRequest) int { return a.SentAt.Compare(b.SentAt) })
+	return requests
+}
+
+// AcceptContactRequest pins the sender's identity, so the room it invites
+// to is entered only with that identity, and returns where to meet them
+// (nil if the request named no room). The request is removed.
+func (e *ExecP2P) AcceptContactRequest(id string) (*crypto.Rendezvous, error) {
+	req, err := e.contactRequest(id)
+	if err != nil {
+		return nil, err
+	}
+	result, pinned, err := e.trust.Check(req.SenderID, req.Fingerprint)
+	if err != nil {
+		return nil, err
+	}
+	if result == trust.ResultChanged {
+		return nil, &trust.ChangedError{PeerID: req.SenderID, Pinned: pinned.Fingerprint, Presented: req.Fingerprint}
+	}
+	return req.Rendezvous, e.mailbox.requests.SecureDelete(id)
+}
+
+// DismissContactRequest deletes a first message unanswered
+func (e *ExecP2P) DismissContactRequest(id string) error {
+	if _, err := e.contactRequest(id); err != nil {
+		return err
+	}
+	return e.mailbox.requests.SecureDelete(id)
+}
+
+func (e *ExecP2P) contactRequest(id string) (ContactRequest, error) {
+	var req ContactRequest
+	if e.mailbox.requests == nil {
+		return req, errors.New("first contact is disabled")
+	}
+	ok, err := e.mailbox.requests.GetJSON(id, &req)
+	if err != nil {
+		return req, err
+	}
+	if !ok {
+		return req, fmt.Errorf("no contact request %s", id)
+	}
+	return req, nil
+}
+
+// ContactUser leaves a first message for the person who published a contact
+// bundle under userID. With fingerprint set, the bundle must be of that
+// identity; without it, the relay could answer with a bundle of its own, so
+// the returned fingerprint should be checked with them later. With invite,
+// the message names the current room and its access key.
+func (e *ExecP2P) ContactUser(ctx context.Context, userID, fingerprint, message string, invite bool) (string, error) {
+	if e.mailbox.client == nil {
+		return "", fmt.Errorf("no mailbox server configured")
+	}
+	userID = strings.ToLower(strings.TrimSpace(userID))
+	if !userIDPattern.MatchString(userID) {
+		return "", fmt.Errorf("invalid user ID %q", userID)
+	}
+	if userID == e.peerID {
+		return "", errors.New("that is our own user ID")
+	}
+	if len([]rune(message)) > maxContactMessage {
+		return "", fmt.Errorf("message too long (at most %d characters)", maxContactMessage)
+	}
+	req := crypto.ContactRequest{SenderID: e.peerID, SenderName: e.Nickname(), Message: message}
+	if invite {
+		if e.currentRoom == nil {
+			return "", fmt.Errorf("not in a room")
+		}
+		req.Rendezvous = &crypto.Rendezvous{RoomID: e.currentRoom.ID, AccessKey: e.currentRoom.AccessKey}
+	}
+
+	data, err := e.mailbox.client.Lookup(ctx, userID)
+	if errors.Is(err, mailbox.ErrNotFound) {
+		return "", ErrNoContactBundle
+	}
+	if err != nil {
+		return "", err
+	}
+	var bundle crypto.ContactBundle
+	if err := json.Unmarshal(data, &bundle); err != nil {
+		return "", fmt.Errorf("invalid contact bundle: %w", err)
+	}
+	if bundle.UserID != userID || !mailboxIDPattern.MatchString(bundle.MailboxID) {
+		return "", errors.New("contact bundle is for another user ID")
+	}
+	actual, err := e.pqCrypto.VerifyContactBundle(&bundle)
+	if err != nil {
+		return "", fmt.Errorf("invalid contact bundle: %w", err)
+	}
+	expected := strings.ReplaceAll(fingerprint, " ", "")
+	if expected == "" {
+		// someone we met under this ID must still have the same identity
+		if pinned, ok := e.trust.Get(userID); ok {
+			expected = pinned.Fingerprint
+		}
+	}
+	if expected != "" && !strings.EqualFold(actual, expected) {
+		return actual, ErrContactFingerprint
+	}
+
+	fc, err := e.pqCrypto.SealFirstContact(&bundle, &req)
+	if err != nil {
+		return actual, err
+	}
+	envelope, err := crypto.SerializeFirstContact(fc)
+	if err != nil {
+		return actual, err
+	}
+	if err := e.mailbox.client.Deposit(ctx, e.mailbox.client.Server(), bundle.MailboxID, envelope); err != nil {
+		return actual, err
+	}
+	logger.L().Info("First message left in a mailbox", "user_id", userID, "invite", invite)
+	return actual, nil
+}
@@ -0,0 +1,111 @@
+package app
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"execp2p/internal/crypto"
+	"execp2p/internal/logger"
+	"execp2p/internal/network"
+)
+
+// Control messages ride the encrypted, signed channel between room members
+// like chat messages do, but the network hands them to handleControlMessage
+// instead of the chat. Each kind is a JSON object with its own "type".
+
+const controlSendTimeout = 10 * time.Second
+
+// handleControlMessage consumes control messages before they reach the chat
+func (e *ExecP2P) handleControlMessage(payload *crypto.MessagePayload) bool {
+	var head struct {
+		Type string `json:"type"`
+	}
+	if json.Unmarshal([]byte(payload.Message), &head) != nil {
+		return false
+	}
+	switch head.Type {
+	case emojiRequestType, emojiAssetType:
+		e.handleEmojiControl(payload)
+	case accessKeyRotatedType:
+		e.handleAccessKeyRotated(payload)
+	case historySyncRequestType, historySyncBatchType, historySyncDoneType:
+		e.handleHistorySync(payload)
+	case deviceWipeType:
+		e.handleDeviceWipe(payload)
+	case mailboxAddressType:
+		e.handleMailboxAddress(payload)
+	case mediaRequestType:
+		e.handleMediaRequest(payload)
+	case profileType, avatarRequestType, avatarType:
+		e.handleProfileControl(payload)
+	case presenceType:
+		e.handlePresence(payload)
+	case kickType:
+		e.handleKick(payload)
+	case banType:
+		e.handleBan(payload)
+	case moderationType:
+		e.handleModeration(payload)
+	case closedType:
+		e.handleRoomClosed(payload)
+	default:
+		return false
+	}
+	return true
+}
+
+// sendControl sends a control message to the connected peer
+func (e *ExecP2P) sendControl(ctl interface{ controlType() string }) error {
+	qnet, ok := e.network.(*network.QuicNetwork)
+	if !ok || qnet == nil {
+		return fmt.Errorf("not in a room")
+	}
+	data, err := json.Marshal(ctl)
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), controlSendTimeout)
+	defer cancel()
+	if err := qnet.SendControl(ctx, string(data)); err != nil {
+		logger.L().Warn("Control message not sent", "type", ctl.controlType(), "err", err)
+		return err
+	}
+	return nil
+}
+
+// sendEphemeral sends a control message that is stale soon after it is
+// sent, such as a presence change: as a datagram when the connection
+// supports them, so it is never delayed by retransmissions, otherwise like
+// sendControl
+func (e *ExecP2P) sendEphemeral(ctl interface{ controlType() string }) error {
+	qnet, ok := e.network.(*network.QuicNetwork)
+	if !ok || qnet == nil {
+		return fmt.Errorf("not in a room")
+	}
+	data, err := json.Marshal(ctl)
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), controlSendTimeout)
+	defer cancel()
+	if err := qnet.SendEphemeral(ctx, string(data)); err != nil {
+		logger.L().Warn("Ephemeral control message not sent", "type", ctl.controlType(), "err", err)
+		return err
+	}
+	return nil
+}
+
+// fromHost reports whether senderID is the host of the current room, as
+// named in its verified room metadata
+func (e *ExecP2P) fromHost(senderID string) bool {
+	qnet, ok := e.network.(*network.QuicNetwork)
+	if !ok || qnet == nil {
+		return false
+	}
+	meta := qnet.RoomMetadata()
+	return meta != nil && meta.HostID == senderID
+}
@@ -0,0 +1,53 @@
+package app
+
+import (
+	"path/filepath"
+
+	"execp2p/internal/crash"
+	"execp2p/internal/logger"
+)
+
+// Crash is sent on CrashNotices after a panic in one of our goroutines
+type Crash struct {
+	crash.Report
+	// the rooms left because of it, to be entered again
+	Rooms []string
+}
+
+// CrashNotices delivers the panics in our goroutines, after the rooms they
+// may have left in a broken state were left
+func (e *ExecP2P) CrashNotices() <-chan Crash {
+	return e.crashNotices
+}
+
+// watchCrashes writes crash dumps to the log directory, unless nothing is
+// to be written to disk, and has panics reported to e
+func (e *ExecP2P) watchCrashes() {
+	if !e.config.Identity.Ephemeral {
+		if dir, err := LogDir(e.config); err == nil {
+			crash.SetDir(filepath.Join(dir, "crashes"))
+		}
+	}
+	e.stopCrashes = crash.OnCrash(func(r crash.Report) {
+		// leaving may wait for the goroutine that panicked
+		go e.onCrash(r)
+	})
+}
+
+// onCrash leaves the rooms, saying goodbye to the peers, when the goroutine
+// that panicked is gone: a room missing its reader or handler would look
+// connected but stay silent. A goroutine that went on keeps the rooms.
+func (e *ExecP2P) onCrash(r crash.Report) {
+	notice := Crash{Report: r}
+	if !r.Recovered {
+		for _, s := range e.Sessions() {
+			notice.Rooms = append(notice.Rooms, s.state().room.ID)
+			s.leaveRoom()
+		}
+		logger.L().Warn("Left the rooms after a crash", "rooms", len(notice.Rooms))
+	}
+	select {
+	case e.crashNotices <- notice:
+	default:
+	}
+}
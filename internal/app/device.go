@@ -0,0 +1,426 @@
+package app
+
+import (
+	"crypto/ed25519"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"execp2p/internal/config"
+	"execp2p/internal/crash"
+	"execp2p/internal/crypto"
+	"execp2p/internal/keystore"
+	"execp2p/internal/logger"
+	"execp2p/internal/media"
+	"execp2p/internal/storage"
+	"execp2p/internal/trust"
+)
+
+// Remote wipe of a linked device.
+//
+// Every install that imported an identity shares it with the device it was
+// exported from, the primary. The bundle carries the primary's device key
+// (keystore.DeviceKey, which no other device can derive), and a linked
+// device keeps it in primary.pub. The primary can then order a lost linked
+// device to wipe itself: the order names the device's peer ID and the
+// identity, is signed with the device key and is only valid for a few
+// minutes, so the other linked devices can't forge one and a copy can't be
+// used against another device later. The order is sent when the device is
+// met in a room. The device shreds its keystore, local database, pins and
+// media cache, closes and reports the wipe; both ends record it in the
+// security audit log.
+const (
+	deviceWipeType = "device_wipe"
+
+	// primaryKeyFile holds the primary's device key on a linked device
+	primaryKeyFile = "primary.pub"
+
+	// how far from our clock the time of a wipe order may be
+	deviceWipeMaxSkew = 10 * time.Minute
+	// signed with the order, so the key signs nothing else alike
+	deviceWipeContext = "execp2p device wipe v1"
+)
+
+type deviceWipeControl struct {
+	Type        string    `json:"type"`
+	Target      string    `json:"target"`
+	Fingerprint string    `json:"fingerprint"`
+	Issued      time.Time `json:"issued"`
+	Signature   []byte    `json:"signature"`
+}
+
+func (c deviceWipeControl) controlType() string { return c.Type }
+
+// signed returns what the signature covers
+func (c deviceWipeControl) signed() []byte {
+	return []byte(strings.Join([]string{deviceWipeContext, c.Target, c.Fingerprint, c.Issued.UTC().Format(time.RFC3339Nano)}, "\n"))
+}
+
+// DeviceWiped is sent on DeviceWipedNotices once this device was wiped on
+// the primary's orders; the app is closed and should exit
+type DeviceWiped struct {
+	// the primary device
+	PeerID string
+	// what could not be removed, nil when everything was
+	Err error
+}
+
+// devices is what we know of the other devices of our identity, shared by
+// every session
+type devices struct {
+	mu sync.Mutex
+	// our device key, once derived
+	key ed25519.PrivateKey
+	// the primary's device key, nil when we are the primary
+	primary ed25519.PublicKey
+	// devices to wipe once met, by peer ID
+	pending map[string]struct{}
+	// our own wipe, which Close waits for
+	wiped  atomic.Bool
+	wiping sync.WaitGroup
+
+	notices chan DeviceWiped
+}
+
+// loadDevices reads the primary's device key of a linked device
+func loadDevices(cfg *config.Config, persistent bool) *devices {
+	d := &devices{pending: make(map[string]struct{}), notices: make(chan DeviceWiped, 1)}
+	if !persistent {
+		return d
+	}
+	primary, err := LinkedPrimaryKey(cfg)
+	if err != nil {
+		logger.L().Warn("Primary device key unreadable; this device can't be wiped remotely", "err", err)
+	}
+	d.primary = primary
+	return d
+}
+
+func primaryKeyPath(cfg *config.Config) (string, error) {
+	dir, err := DataDir(cfg)
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, primaryKeyFile), nil
+}
+
+// LinkedPrimaryKey returns the device key of the primary device stored on a
+// linked device, nil on the primary
+func LinkedPrimaryKey(cfg *config.Config) (ed25519.PublicKey, error) {
+	path, err := primaryKeyPath(cfg)
+	if err != nil {
+		return nil, err
+	}
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	key, err := hex.DecodeString(strings.TrimSpace(string(data)))
+	if err != nil || len(key) != ed25519.PublicKeySize {
+		return nil, fmt.Errorf("invalid key in %s", path)
+	}
+	return key, nil
+}
+
+// writePrimaryKey remembers the primary of an imported identity; without
+// one we are the primary
+func writePrimaryKey(cfg *config.Config, primary ed25519.PublicKey) error {
+	path, err := primaryKeyPath(cfg)
+	if err != nil {
+		return err
+	}
+	if primary == nil {
+		if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+		return nil
+	}
+	return os.WriteFile(path, []byte(hex.EncodeToString(primary)+"\n"), 0o600)
+}
+
+// PrimaryKey returns the device key of the identity's primary device, to
+// be put in exported bundles: our own on the primary, the one we were
+// given on a linked device
+func PrimaryKey(cfg *config.Config) (ed25519.PublicKey, error) {
+	primary, err := LinkedPrimaryKey(cfg)
+	if err != nil || primary != nil {
+		return primary, err
+	}
+	dir, err := DataDir(cfg)
+	if err != nil {
+		return nil, err
+	}
+	key, err := keystore.New(dir).DeviceKey([]byte(cfg.Identity.Passphrase))
+	if err != nil {
+		return nil, fmt.Errorf("failed to derive device key: %w", err)
+	}
+	return key.Public().(ed25519.PublicKey), nil
+}
+
+// deviceKey returns our device key, derived from the keystore or, for an
+// ephemeral identity, made for this run
+func (e *ExecP2P) deviceKey() (ed25519.PrivateKey, error) {
+	d := e.devices
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.key != nil {
+		return d.key, nil
+	}
+	if !e.identity.persistent {
+		_, key, err := ed25519.GenerateKey(nil)
+		if err != nil {
+			return nil, err
+		}
+		d.key = key
+		return key, nil
+	}
+	dir, err := DataDir(e.config)
+	if err != nil {
+		return nil, err
+	}
+	key, err := keystore.New(dir).DeviceKey([]byte(e.config.Identity.Passphrase))
+	if err != nil {
+		return nil, fmt.Errorf("failed to derive device key: %w", err)
+	}
+	d.key = key
+	return key, nil
+}
+
+// primaryKey is PrimaryKey for the identity in use
+func (e *ExecP2P) primaryKey() (ed25519.PublicKey, error) {
+	e.devices.mu.Lock()
+	primary := e.devices.primary
+	e.devices.mu.Unlock()
+	if primary != nil {
+		return primary, nil
+	}
+	key, err := e.deviceKey()
+	if err != nil {
+		return nil, err
+	}
+	return key.Public().(ed25519.PublicKey), nil
+}
+
+// setPrimary records the primary of an identity just imported, which was
+// sealed anew and so has another device key
+func (e *ExecP2P) setPrimary(primary ed25519.PublicKey) {
+	e.devices.mu.Lock()
+	e.devices.key = nil
+	e.devices.primary = primary
+	e.devices.pending = make(map[string]struct{})
+	e.devices.mu.Unlock()
+}
+
+// IsPrimaryDevice reports whether this device can wipe the other devices
+// of its identity, which holds unless the identity was imported from one
+func (e *ExecP2P) IsPrimaryDevice() bool {
+	e.devices.mu.Lock()
+	defer e.devices.mu.Unlock()
+	return e.devices.primary == nil
+}
+
+// OwnDevices returns the connected peers that hold our identity
+func (e *ExecP2P) OwnDevices() []string {
+	var own []string
+	for _, s := range e.Sessions() {
+		for _, peerID := range s.connectedPeers() {
+			if s.isOwnDevice(peerID) {
+				own = append(own, peerID)
+			}
+		}
+	}
+	return own
+}
+
+// WipeDevice orders the linked device with peerID to wipe its keys and
+// local data. The order is sent at once when the device is in one of our
+// rooms, otherwise when it is next met there while the app runs. Only the
+// primary device can order a wipe.
+func (e *ExecP2P) WipeDevice(peerID string) error {
+	if !e.IsPrimaryDevice() {
+		return fmt.Errorf("only the primary device of the identity can wipe the others")
+	}
+	if peerID == "" || peerID == e.peerID {
+		return fmt.Errorf("invalid device to wipe")
+	}
+	if _, err := e.deviceKey(); err != nil {
+		return err
+	}
+	fingerprint, _ := e.GetPeerFingerprint()
+
+	e.devices.mu.Lock()
+	e.devices.pending[peerID] = struct{}{}
+	e.devices.mu.Unlock()
+	audit(e.config, AuditRecord{Event: AuditWipeOrdered, PeerID: peerID, Fingerprint: fingerprint})
+	e.sendPendingWipes()
+	return nil
+}
+
+// CancelDeviceWipe drops a wipe order that wasn't sent yet; it reports
+// whether there was one
+func (e *ExecP2P) CancelDeviceWipe(peerID string) bool {
+	e.devices.mu.Lock()
+	_, ok := e.devices.pending[peerID]
+	delete(e.devices.pending, peerID)
+	e.devices.mu.Unlock()
+	return ok
+}
+
+// sendPendingWipes sends the wipe orders of the devices met in our rooms
+func (e *ExecP2P) sendPendingWipes() {
+	e.devices.mu.Lock()
+	if len(e.devices.pending) == 0 {
+		e.devices.mu.Unlock()
+		return
+	}
+	key := e.devices.key
+	e.devices.mu.Unlock()
+
+	for _, s := range e.Sessions() {
+		for _, peerID := range s.connectedPeers() {
+			e.devices.mu.Lock()
+			_, wanted := e.devices.pending[peerID]
+			e.devices.mu.Unlock()
+			if !wanted || !s.isOwnDevice(peerID) {
+				continue
+			}
+			if err := s.sendWipe(key, peerID); err != nil {
+				continue
+			}
+			e.devices.mu.Lock()
+			delete(e.devices.pending, peerID)
+			e.devices.mu.Unlock()
+		}
+	}
+}
+
+// sendWipe signs a wipe order for peerID and sends it in the session's room
+func (e *ExecP2P) sendWipe(key ed25519.PrivateKey, peerID string) error {
+	fingerprint, err := e.GetPeerFingerprint()
+	if err != nil {
+		return err
+	}
+	ctl := deviceWipeControl{
+		Type:        deviceWipeType,
+		Target:      peerID,
+		Fingerprint: fingerprint,
+		Issued:      time.Now().UTC(),
+	}
+	ctl.Signature = ed25519.Sign(key, ctl.signed())
+	if err := e.sendControl(ctl); err != nil {
+		return err
+	}
+	audit(e.config, AuditRecord{Event: AuditWipeSent, PeerID: peerID, Fingerprint: fingerprint})
+	return nil
+}
+
+// DeviceWipedNotices delivers the wipe of this device
+func (e *ExecP2P) DeviceWipedNotices() <-chan DeviceWiped {
+	return e.devices.notices
+}
+
+// handleDeviceWipe obeys a wipe order meant for us, after checking it came
+// from the primary
+func (e *ExecP2P) handleDeviceWipe(payload *crypto.MessagePayload) {
+	var ctl deviceWipeControl
+	if err := json.Unmarshal([]byte(payload.Message), &ctl); err != nil {
+		logger.L().Warn("Invalid device wipe message", "err", err)
+		return
+	}
+	if ctl.Target != e.peerID {
+		return
+	}
+	fingerprint, _ := e.GetPeerFingerprint()
+	if err := e.checkWipe(payload.SenderID, fingerprint, ctl); err != nil {
+		audit(e.config, AuditRecord{Event: AuditWipeRefused, PeerID: payload.SenderID, Fingerprint: fingerprint, Detail: err.Error()})
+		return
+	}
+	if e.devices.wiped.Swap(true) {
+		return
+	}
+	e.devices.wiping.Add(1)
+	go e.wipe(payload.SenderID, fingerprint)
+}
+
+// checkWipe tells why a wipe order must not be obeyed
+func (e *ExecP2P) checkWipe(senderID, fingerprint string, ctl deviceWipeControl) error {
+	e.devices.mu.Lock()
+	primary := e.devices.primary
+	e.devices.mu.Unlock()
+	switch {
+	case !e.isOwnDevice(senderID):
+		return errors.New("sender holds another identity")
+	case primary == nil:
+		return errors.New("this is the primary device")
+	case ctl.Fingerprint != fingerprint:
+		return errors.New("order is for another identity")
+	case !ed25519.Verify(primary, ctl.signed(), ctl.Signature):
+		return errors.New("not signed by the primary device")
+	}
+	if skew := time.Since(ctl.Issued); skew > deviceWipeMaxSkew || skew < -deviceWipeMaxSkew {
+		return fmt.Errorf("order issued at %s is stale", ctl.Issued.Format(time.RFC3339))
+	}
+	return nil
+}
+
+// wipe closes the app and shreds our identity and local data. The
+// subscribers are let go last, so the notice is out before they see the end.
+func (e *ExecP2P) wipe(by, fingerprint string) {
+	defer crash.Recover("app.wipe")
+	defer e.devices.wiping.Done()
+	logger.L().Warn("Wiping this device on the primary device's orders", "primary", by)
+	first := e.sessions.first()
+	first.shutdown()
+	defer first.subscriptions.closeAll()
+
+	var err error
+	if e.identity.persistent {
+		err = wipeLocalData(e.config)
+	}
+	rec := AuditRecord{Event: AuditWiped, PeerID: by, Fingerprint: fingerprint}
+	if err != nil {
+		rec.Detail = err.Error()
+	}
+	audit(e.config, rec)
+	select {
+	case e.devices.notices <- DeviceWiped{PeerID: by, Err: err}:
+	default:
+	}
+}
+
+// wipeLocalData shreds the keystore, the local database, the pins, the
+// peer ID, the primary's key and the media cache
+func wipeLocalData(cfg *config.Config) error {
+	dir, err := DataDir(cfg)
+	if err != nil {
+		return err
+	}
+	var errs []error
+	if err := keystore.New(dir).Wipe(); err != nil {
+		errs = append(errs, fmt.Errorf("keystore: %w", err))
+	}
+	if err := storage.ShredDir(filepath.Join(dir, storage.DirName)); err != nil {
+		errs = append(errs, fmt.Errorf("local storage: %w", err))
+	}
+	for _, name := range []string{trust.FileName, peerIDFile, primaryKeyFile} {
+		if err := storage.Shred(filepath.Join(dir, name)); err != nil && !os.IsNotExist(err) {
+			errs = append(errs, fmt.Errorf("%s: %w", name, err))
+		}
+	}
+	if cache, err := CacheDir(cfg); err == nil {
+		if err := storage.ShredDir(filepath.Join(cache, media.CacheDirName)); err != nil {
+			errs = append(errs, fmt.Errorf("media cache: %w", err))
+		}
+	}
+	return errors.Join(errs...)
+}
@@ -0,0 +1,50 @@
+package app
+
+import (
+	"sync"
+
+	"execp2p/internal/config"
+	"execp2p/internal/logger"
+	"execp2p/internal/paths"
+)
+
+// migrateOnce moves the files of older versions on first use of the
+// platform directories
+var migrateOnce sync.Once
+
+// DataDir returns the configured data directory or the platform default
+func DataDir(cfg *config.Config) (string, error) {
+	if cfg.Identity.DataDir != "" {
+		return cfg.Identity.DataDir, nil
+	}
+	migrate()
+	return paths.Data()
+}
+
+// CacheDir returns where the media cache is kept: the configured data
+// directory, which then holds everything, or the platform cache directory
+func CacheDir(cfg *config.Config) (string, error) {
+	if cfg.Identity.DataDir != "" {
+		return cfg.Identity.DataDir, nil
+	}
+	migrate()
+	return paths.Cache()
+}
+
+// LogDir returns where crash reports are written: the configured data
+// directory or the platform log directory
+func LogDir(cfg *config.Config) (string, error) {
+	if cfg.Identity.DataDir != "" {
+		return cfg.Identity.DataDir, nil
+	}
+	migrate()
+	return paths.Logs()
+}
+
+func migrate() {
+	migrateOnce.Do(func() {
+		if err := paths.Migrate(); err != nil {
+			logger.L().Warn("Some files were left in the old data directory", "err", err)
+		}
+	})
+}
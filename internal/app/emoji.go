@@ -0,0 +1,199 @@
+package app
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"execp2p/internal/crypto"
+	"execp2p/internal/emoji"
+	"execp2p/internal/logger"
+	"execp2p/internal/network"
+	"execp2p/internal/storage"
+)
+
+// shortcode images travel as control messages on the encrypted channel: a
+// guest asks the host for the hashes it is missing and checks every image
+// against the hash in the signed room metadata before caching it
+const (
+	emojiRequestType = "emoji_request"
+	emojiAssetType   = "emoji_asset"
+)
+
+type emojiControl struct {
+	Type   string   `json:"type"`
+	Hashes []string `json:"hashes,omitempty"`
+	Hash   string   `json:"hash,omitempty"`
+	Data   []byte   `json:"data,omitempty"`
+}
+
+func (c emojiControl) controlType() string { return c.Type }
+
+// Shortcode is a room shortcode with its image, if it has arrived yet
+type Shortcode struct {
+	crypto.RoomShortcode
+	Image *emoji.Asset
+}
+
+// newEmojiCache caches shortcode images in the local database
+func newEmojiCache(db *storage.DB) *emoji.Cache {
+	bucket, err := db.Bucket(emoji.BucketName)
+	if err != nil {
+		logger.L().Warn("Shortcode images are cached in memory only", "err", err)
+		return emoji.NewCache(nil)
+	}
+	return emoji.NewCache(bucket)
+}
+
+// AddRoomShortcode maps :code: to an image for everyone in the room (host only)
+func (e *ExecP2P) AddRoomShortcode(code string, image []byte) (crypto.RoomShortcode, error) {
+	qnet, err := e.hostNetwork()
+	if err != nil {
+		return crypto.RoomShortcode{}, err
+	}
+	asset, err := emoji.NewAsset(image)
+	if err != nil {
+		return crypto.RoomShortcode{}, err
+	}
+	sc, err := e.shortcodes.Set(code, asset)
+	if err != nil {
+		return crypto.RoomShortcode{}, err
+	}
+	e.emojiCache.Put(asset)
+
+	if err := e.signRoomMetadata(qnet); err != nil {
+		return crypto.RoomShortcode{}, err
+	}
+	logger.L().Info("Room shortcode added", "code", sc.Code, "hash", sc.Hash[:12])
+	e.notifyShortcodes()
+	return sc, nil
+}
+
+// RemoveRoomShortcode removes a shortcode from the room (host only)
+func (e *ExecP2P) RemoveRoomShortcode(code string) error {
+	qnet, err := e.hostNetwork()
+	if err != nil {
+		return err
+	}
+	if !e.shortcodes.Remove(code) {
+		return fmt.Errorf("no such shortcode: %s", code)
+	}
+	if err := e.signRoomMetadata(qnet); err != nil {
+		return err
+	}
+	e.notifyShortcodes()
+	return nil
+}
+
+// RoomShortcodes returns the room's shortcodes
+func (e *ExecP2P) RoomShortcodes() []Shortcode {
+	list := e.shortcodes.List()
+	out := make([]Shortcode, 0, len(list))
+	for _, sc := range list {
+		image, _ := e.emojiCache.Get(sc.Hash)
+		out = append(out, Shortcode{RoomShortcode: sc, Image: image})
+	}
+	return out
+}
+
+// ShortcodeNotices signals whenever the shortcodes or their images change
+func (e *ExecP2P) ShortcodeNotices() <-chan struct{} {
+	return e.shortcodeNotices
+}
+
+func (e *ExecP2P) notifyShortcodes() {
+	select {
+	case e.shortcodeNotices <- struct{}{}:
+	default:
+		// a notice is already pending
+	}
+}
+
+// hostNetwork returns the network of the room we host
+func (e *ExecP2P) hostNetwork() (*network.QuicNetwork, error) {
+	qnet, ok := e.network.(*network.QuicNetwork)
+	if !ok || qnet == nil || e.currentRoom == nil {
+		return nil, fmt.Errorf("not in a room")
+	}
+	if !qnet.IsListener() {
+		return nil, fmt.Errorf("only the room host can do that")
+	}
+	return qnet, nil
+}
+
+// adoptShortcodes takes the shortcode list from verified room metadata and
+// asks the host for images not in the cache
+func (e *ExecP2P) adoptShortcodes(meta *crypto.RoomMetadata) {
+	if err := e.shortcodes.Replace(meta.Shortcodes); err != nil {
+		logger.L().Warn("Room metadata carries invalid shortcodes", "err", err)
+	}
+
+	var missing []string
+	seen := make(map[string]bool)
+	for _, sc := range e.shortcodes.List() {
+		if !seen[sc.Hash] && !e.emojiCache.Has(sc.Hash) {
+			missing = append(missing, sc.Hash)
+		}
+		seen[sc.Hash] = true
+	}
+	e.notifyShortcodes()
+	if len(missing) == 0 {
+		return
+	}
+
+	// the handler runs on the network's read loop; don't block it
+	go e.sendControl(emojiControl{Type: emojiRequestType, Hashes: missing})
+}
+
+// handleEmojiControl handles shortcode image requests (host) and images (guests)
+func (e *ExecP2P) handleEmojiControl(payload *crypto.MessagePayload) {
+	var ctl emojiControl
+	if err := json.Unmarshal([]byte(payload.Message), &ctl); err != nil {
+		logger.L().Warn("Invalid shortcode control message", "err", err)
+		return
+	}
+	switch ctl.Type {
+	case emojiRequestType:
+		go e.serveShortcodes(payload.SenderID, ctl.Hashes)
+	case emojiAssetType:
+		e.acceptShortcodeImage(payload.SenderID, ctl)
+	}
+}
+
+// serveShortcodes answers a guest's request with the images it asked for
+func (e *ExecP2P) serveShortcodes(peerID string, hashes []string) {
+	if e.network == nil || !e.network.IsListener() {
+		return
+	}
+	if len(hashes) > emoji.MaxShortcodes {
+		hashes = hashes[:emoji.MaxShortcodes]
+	}
+	for _, hash := range hashes {
+		if _, ok := e.shortcodes.HasHash(hash); !ok {
+			continue
+		}
+		asset, ok := e.emojiCache.Get(hash)
+		if !ok {
+			continue
+		}
+		if err := e.sendControl(emojiControl{Type: emojiAssetType, Hash: hash, Data: asset.Data}); err != nil {
+			return
+		}
+	}
+	logger.L().Debug("Shortcode images sent", "peer", peerID, "requested", len(hashes))
+}
+
+// acceptShortcodeImage caches an image from the host if it matches the signed registry
+func (e *ExecP2P) acceptShortcodeImage(senderID string, ctl emojiControl) {
+	if !e.fromHost(senderID) {
+		logger.L().Warn("Ignoring shortcode image from someone other than the host", "peer", senderID)
+		return
+	}
+	if _, ok := e.shortcodes.HasHash(ctl.Hash); !ok {
+		return
+	}
+	if _, err := e.emojiCache.Accept(ctl.Hash, ctl.Data); err != nil {
+		logger.L().Warn("Rejected shortcode image", "hash", ctl.Hash, "err", err)
+		return
+	}
+	e.notifyShortcodes()
+}
@@ -0,0 +1,233 @@
+package app
+
+import (
+	"context"
+	"encoding/json"
+	"sync"
+	"time"
+
+	"execp2p/internal/crash"
+	"execp2p/internal/crypto"
+	"execp2p/internal/logger"
+	"execp2p/internal/network"
+)
+
+// Rooms that end by themselves.
+//
+// A room created with a lifetime (RoomOptions.TTL) or an idle timeout
+// (RoomOptions.IdleTimeout) is closed by its host once either runs out: the
+// host stops announcing it, tells the members with a room_closed notice,
+// closes their connections with the "room closed" code and wipes what it
+// kept of the room. Members wipe their copy too, so nothing of a one-off
+// conversation stays behind.
+const closedType = "room_closed"
+
+// why a room closed by itself
+const (
+	CloseExpired = "expired"
+	CloseIdle    = "idle"
+)
+
+type closedControl struct {
+	Type   string `json:"type"`
+	RoomID string `json:"room_id"`
+	Reason string `json:"reason"`
+}
+
+func (c closedControl) controlType() string { return c.Type }
+
+// RoomClosed is sent on ClosedNotices when the current room ended for good
+type RoomClosed struct {
+	RoomID string
+	// CloseExpired or CloseIdle, empty when the host didn't say
+	Reason string
+	// closed by us, the host
+	Local bool
+}
+
+// lifetime is when the current room closes by itself
+type lifetime struct {
+	mu         sync.Mutex
+	roomID     string
+	expiresAt  time.Time // zero: no limit
+	idle       time.Duration
+	lastActive time.Time
+	ended      bool
+	// wakes the watcher when the deadline moved
+	changed chan struct{}
+}
+
+// reset starts the lifetime of a newly entered room
+func (l *lifetime) reset(roomID string, opts RoomOptions) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	now := time.Now()
+	l.roomID, l.expiresAt, l.idle, l.lastActive, l.ended = roomID, time.Time{}, opts.IdleTimeout, now, false
+	if opts.TTL > 0 {
+		l.expiresAt = now.Add(opts.TTL)
+	}
+	if l.changed == nil {
+		l.changed = make(chan struct{}, 1)
+	}
+}
+
+// deadline returns when the room closes and why; zero when it doesn't
+func (l *lifetime) deadline() (time.Time, string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	at, reason := l.expiresAt, CloseExpired
+	if l.idle > 0 {
+		if idleAt := l.lastActive.Add(l.idle); at.IsZero() || idleAt.Before(at) {
+			at, reason = idleAt, CloseIdle
+		}
+	}
+	return at, reason
+}
+
+// limits returns when the room closes for good and its idle timeout
+func (l *lifetime) limits() (time.Time, time.Duration) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.expiresAt, l.idle
+}
+
+// end marks the room ended; it reports false if it already was
+func (l *lifetime) end(roomID string) bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.ended || roomID != l.roomID {
+		return false
+	}
+	l.ended = true
+	return true
+}
+
+// touchRoom pushes the idle timeout back after a chat message
+func (e *ExecP2P) touchRoom() {
+	e.lifetime.mu.Lock()
+	e.lifetime.lastActive = time.Now()
+	idle := e.lifetime.idle > 0
+	e.lifetime.mu.Unlock()
+	if idle {
+		select {
+		case e.lifetime.changed <- struct{}{}:
+		default:
+		}
+	}
+}
+
+// RoomClosesAt returns when the room we host closes by itself, zero when it
+// doesn't
+func (e *ExecP2P) RoomClosesAt() time.Time {
+	if e.network == nil || !e.network.IsListener() {
+		return time.Time{}
+	}
+	at, _ := e.lifetime.deadline()
+	return at
+}
+
+// ClosedNotices delivers the end of the current room, ours or the host's
+func (e *ExecP2P) ClosedNotices() <-chan RoomClosed {
+	return e.closedNotices
+}
+
+// watchLifetime closes the room we host once its lifetime or idle timeout
+// runs out
+func (e *ExecP2P) watchLifetime(ctx context.Context, roomID string, stop <-chan struct{}) {
+	defer crash.Recover("app.watchLifetime")
+	for {
+		at, reason := e.lifetime.deadline()
+		if at.IsZero() {
+			return
+		}
+		timer := time.NewTimer(time.Until(at))
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return
+		case <-stop:
+			timer.Stop()
+			return
+		case <-e.lifetime.changed:
+			timer.Stop()
+		case <-timer.C:
+			if next, _ := e.lifetime.deadline(); next.After(time.Now()) {
+				continue
+			}
+			// leaving waits for this goroutine
+			go e.closeRoom(roomID, reason)
+			return
+		}
+	}
+}
+
+// closeRoom ends the room we host for everyone in it
+func (e *ExecP2P) closeRoom(roomID, reason string) {
+	if !e.lifetime.end(roomID) {
+		return
+	}
+	logger.L().Info("Room closed by itself", "room_id", roomID, "reason", reason)
+	if e.stopAnnouncing != nil {
+		e.stopAnnouncing()
+	}
+	if len(e.connectedPeers()) > 0 {
+		if err := e.sendControl(closedControl{Type: closedType, RoomID: roomID, Reason: reason}); err == nil {
+			time.Sleep(kickGrace)
+		}
+	}
+	if qnet, ok := e.network.(*network.QuicNetwork); ok {
+		qnet.CloseRoom(reason)
+	}
+	e.roomEnded(RoomClosed{RoomID: roomID, Reason: reason, Local: true})
+}
+
+// handleRoomClosed ends the room the host closed (guests)
+func (e *ExecP2P) handleRoomClosed(payload *crypto.MessagePayload) {
+	var ctl closedControl
+	if err := json.Unmarshal([]byte(payload.Message), &ctl); err != nil {
+		logger.L().Warn("Invalid room closed message", "err", err)
+		return
+	}
+	if e.network == nil || e.network.IsListener() || !e.fromHost(payload.SenderID) {
+		logger.L().Warn("Ignoring room closed from someone other than the host", "peer", payload.SenderID)
+		return
+	}
+	if e.currentRoom == nil || ctl.RoomID != e.currentRoom.ID || !e.lifetime.end(ctl.RoomID) {
+		return
+	}
+	logger.L().Info("Host closed the room", "room_id", ctl.RoomID, "reason", ctl.Reason)
+	// closing the network waits for the read loop we are called from
+	go e.roomEnded(RoomClosed{RoomID: ctl.RoomID, Reason: ctl.Reason})
+}
+
+// roomClosedByHost ends the room when only the close code came through
+// (guests)
+func (e *ExecP2P) roomClosedByHost() {
+	if e.currentRoom == nil || !e.lifetime.end(e.currentRoom.ID) {
+		return
+	}
+	e.roomEnded(RoomClosed{RoomID: e.currentRoom.ID})
+}
+
+// roomEnded wipes what we kept of the room, leaves it and tells the GUI
+func (e *ExecP2P) roomEnded(closed RoomClosed) {
+	e.wipeRoom(closed.RoomID)
+	e.LeaveRoom()
+	select {
+	case e.closedNotices <- closed:
+	default:
+		// nobody is listening
+	}
+}
+
+// wipeRoom deletes the stored messages, queued messages, bans and roles
+// of a room
+func (e *ExecP2P) wipeRoom(roomID string) {
+	if err := e.ClearHistory(roomID); err != nil {
+		logger.L().Warn("Room history not wiped", "room_id", roomID, "err", err)
+	}
+	e.outbox.Clear(roomID)
+	e.bans.Forget(roomID)
+	e.roles.replace(nil)
+	e.shortcodes.Replace(nil)
+}
@@ -0,0 +1,113 @@
+package app
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+	"unicode"
+
+	"execp2p/internal/logger"
+	"execp2p/internal/media"
+	"execp2p/internal/network"
+)
+
+// Files travel on media streams like pictures, as opaque bytes: the chat
+// message of kind "file" carries the name and size, and the receiver keeps
+// the file in the media store until it is saved. Only the receiver keeps a
+// copy; the sender has the original.
+
+const (
+	fileKind = "file"
+	// files are never interpreted, whatever their name says
+	fileContentType = "application/octet-stream"
+
+	// how long sending one file may take
+	fileSendTimeout = 30 * time.Minute
+)
+
+// SendFile starts sending a file from disk and returns its media ID, which
+// is also its transfer ID: the progress and the outcome arrive on
+// TransferNotices
+func (e *ExecP2P) SendFile(ctx context.Context, path string) (string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", fmt.Errorf("failed to open file: %w", err)
+	}
+	info, err := f.Stat()
+	if err != nil || !info.Mode().IsRegular() {
+		f.Close()
+		return "", fmt.Errorf("not a regular file: %s", path)
+	}
+	id, err := e.startFile(ctx, filepath.Base(path), f, info.Size())
+	if err != nil {
+		f.Close()
+	}
+	return id, err
+}
+
+// SendFileData starts sending a file given by its contents, e.g. dropped on
+// the window; like SendFile
+func (e *ExecP2P) SendFileData(ctx context.Context, name string, data []byte) (string, error) {
+	return e.startFile(ctx, name, io.NopCloser(bytes.NewReader(data)), int64(len(data)))
+}
+
+func (e *ExecP2P) startFile(ctx context.Context, name string, body io.ReadCloser, size int64) (string, error) {
+	if size > network.MaxMediaSize {
+		return "", fmt.Errorf("file too large (%d bytes, limit %d)", size, network.MaxMediaSize)
+	}
+	qnet, ok := e.network.(*network.QuicNetwork)
+	if !ok {
+		return "", fmt.Errorf("not connected to a room")
+	}
+	id, err := media.NewID()
+	if err != nil {
+		return "", err
+	}
+	name = cleanFileName(name)
+
+	go func() {
+		defer body.Close()
+		ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), fileSendTimeout)
+		defer cancel()
+
+		header := network.MediaHeader{ID: id, ContentType: fileContentType, Name: name, Size: size}
+		err := e.sendMediaStream(ctx, qnet, header, body)
+		if err == nil {
+			err = e.sendMediaMessage(ctx, mediaMessage{Type: fileKind, Content: name, MediaID: id, ContentType: fileContentType, Size: size})
+		}
+		if err != nil {
+			logger.L().Warn("Failed to send file", "id", id, "err", err)
+		}
+	}()
+	return id, nil
+}
+
+// ReceivedFile returns a file received from the peer, for saving
+func (e *ExecP2P) ReceivedFile(id string) (media.Item, error) {
+	item, ok := e.media.Get(id)
+	if !ok {
+		return media.Item{}, fmt.Errorf("file %s not available", id)
+	}
+	return item, nil
+}
+
+// cleanFileName keeps the last path element of a name and drops control
+// characters, so a received name can be offered as a file name
+func cleanFileName(name string) string {
+	name = filepath.Base(strings.ReplaceAll(name, "\\", "/"))
+	name = strings.Map(func(r rune) rune {
+		if unicode.IsControl(r) {
+			return -1
+		}
+		return r
+	}, name)
+	if name == "" || name == "." || name == "/" || name == ".." {
+		return "plik"
+	}
+	return name
+}
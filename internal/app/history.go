@@ -0,0 +1,106 @@
+package app
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	"execp2p/internal/config"
+	"execp2p/internal/crypto"
+	"execp2p/internal/history"
+	"execp2p/internal/logger"
+	"execp2p/internal/storage"
+)
+
+// openHistory opens the message history in the local database; nil if
+// history is switched off
+func openHistory(cfg *config.Config, db *storage.DB) *history.Store {
+	if !cfg.History.Enabled {
+		return nil
+	}
+	store, err := history.Open(db, history.Policy{
+		MaxMessages: cfg.History.MaxMessages,
+		MaxAge:      cfg.History.MaxAge,
+	})
+	if err != nil {
+		logger.L().Warn("Message history is disabled", "err", err)
+		return nil
+	}
+	return store
+}
+
+// observeMessage sees every sent and delivered chat message
+func (e *ExecP2P) observeMessage(payload *crypto.MessagePayload, outgoing bool) {
+	if isChatMessage(payload.Message) {
+		e.touchRoom()
+	}
+	e.archiveMessage(payload, outgoing)
+	e.recordHistory(payload, outgoing)
+	e.postMessage(payload, outgoing)
+	e.mirrorMessage(payload)
+	e.answerCommand(payload, outgoing)
+}
+
+// recordHistory stores a chat message in the local history
+func (e *ExecP2P) recordHistory(payload *crypto.MessagePayload, outgoing bool) {
+	if e.history == nil || e.currentRoom == nil || !isChatMessage(payload.Message) {
+		return
+	}
+	err := e.history.Append(history.Record{
+		MessageID:  payload.MessageID,
+		RoomID:     e.currentRoom.ID,
+		SenderID:   payload.SenderID,
+		SenderName: e.DisplayName(payload.SenderID),
+		Message:    payload.Message,
+		Outgoing:   outgoing,
+		Timestamp:  payload.Timestamp,
+	})
+	if err != nil && !errors.Is(err, storage.ErrIncognito) {
+		logger.L().Warn("Failed to store message in history", "err", err)
+	}
+}
+
+// History returns a page of a room's stored messages, oldest first; before
+// is the Next cursor of the previous page or empty for the newest messages
+func (e *ExecP2P) History(roomID, before string, limit int) (history.Page, error) {
+	if e.history == nil {
+		return history.Page{}, fmt.Errorf("message history is disabled")
+	}
+	return e.history.Page(roomID, before, limit)
+}
+
+// HistoryRooms lists the rooms with stored history
+func (e *ExecP2P) HistoryRooms() []history.Room {
+	if e.history == nil {
+		return nil
+	}
+	return e.history.Rooms()
+}
+
+// SearchHistory finds stored messages containing every word of query, in
+// one room or in all of them when roomID is empty, best matches first
+func (e *ExecP2P) SearchHistory(query, roomID string, limit int) ([]history.Match, error) {
+	if e.history == nil {
+		return nil, fmt.Errorf("message history is disabled")
+	}
+	return e.history.Search(query, roomID, limit)
+}
+
+// ClearHistory securely deletes a room's stored messages
+func (e *ExecP2P) ClearHistory(roomID string) error {
+	if e.history == nil {
+		return nil
+	}
+	return e.history.DeleteRoom(roomID)
+}
+
+// isChatMessage tells user messages from keep-alives and nickname updates
+func isChatMessage(message string) bool {
+	var msg struct {
+		Type string `json:"type"`
+	}
+	if json.Unmarshal([]byte(message), &msg) != nil {
+		return true
+	}
+	return msg.Type != "keep_alive" && msg.Type != "nickname_update"
+}
@@ -0,0 +1,397 @@
+package app
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"execp2p/internal/crypto"
+	"execp2p/internal/history"
+	"execp2p/internal/logger"
+	"execp2p/internal/media"
+	"execp2p/internal/storage"
+)
+
+// History sync copies the stored history between two devices of the same
+// user: two installs that share an identity (exported on one, imported on
+// the other) and meet in a room. A device only ever serves and accepts
+// history when the connected peer proved the same identity fingerprint as
+// its own, so no one else in a room can ask for, or inject, history.
+const (
+	historySyncRequestType = "history_sync_request"
+	historySyncBatchType   = "history_sync_batch"
+	historySyncDoneType    = "history_sync_done"
+	// either side stops the sync
+	historySyncCancelType = "history_sync_cancel"
+
+	// a batch is cut at this many records or bytes of message text,
+	// whichever comes first
+	historySyncBatchRecords = 200
+	historySyncBatchBytes   = 512 << 10
+)
+
+type historySyncControl struct {
+	Type string `json:"type"`
+	// request: the newest stored message per room; only newer ones are sent
+	Since map[string]time.Time `json:"since,omitempty"`
+	// batch: stored messages, oldest first
+	Records []history.Record `json:"records,omitempty"`
+	// done: what was sent
+	Rooms    int `json:"rooms,omitempty"`
+	Messages int `json:"messages,omitempty"`
+	// the transfer ID of the sync, chosen by the requester
+	Transfer string `json:"transfer,omitempty"`
+	// batch: bytes of message text the whole sync sends
+	Total int64 `json:"total,omitempty"`
+}
+
+func (c historySyncControl) controlType() string { return c.Type }
+
+// HistorySyncResult is sent on HistorySyncNotices when a sync finished
+type HistorySyncResult struct {
+	// the other device
+	PeerID   string
+	Rooms    int
+	Messages int
+	// messages that could not be stored, e.g. while an incognito room is open
+	Failed int
+}
+
+// historySync is the state of the sync this device asked for, and of the
+// ones it serves
+type historySync struct {
+	notices chan HistorySyncResult
+
+	pending  atomic.Bool
+	deadline atomic.Int64 // unix nanos
+	stored   atomic.Int64
+	failed   atomic.Int64
+
+	mu       sync.Mutex
+	transfer *activeTransfer
+	// the syncs being served by transfer ID, set once cancelled
+	serving map[string]*atomic.Bool
+}
+
+// historySyncTimeout ends a requested sync that never finished
+const historySyncTimeout = 5 * time.Minute
+
+// SyncHistory asks the connected peer, which must be another device of
+// ours, for the history this device doesn't have yet, and returns the
+// transfer ID of the sync. The result arrives on HistorySyncNotices, the
+// progress on TransferNotices.
+func (e *ExecP2P) SyncHistory() (string, error) {
+	if e.history == nil {
+		return "", fmt.Errorf("message history is disabled")
+	}
+	peerID, err := e.ownDevice()
+	if err != nil {
+		return "", err
+	}
+
+	since := make(map[string]time.Time)
+	for _, room := range e.history.Rooms() {
+		since[room.RoomID] = room.LastActivity
+	}
+
+	id, err := media.NewID()
+	if err != nil {
+		return "", err
+	}
+	// a new request replaces the one in progress
+	e.endHistorySync(ErrTransferCanceled, true)
+
+	h := &e.historySync
+	h.stored.Store(0)
+	h.failed.Store(0)
+	h.deadline.Store(time.Now().Add(historySyncTimeout).UnixNano())
+	a := e.transfers.start(Transfer{
+		ID:        id,
+		Kind:      TransferHistory,
+		Direction: TransferReceive,
+		Name:      historySyncName,
+	}, func() { e.endHistorySync(ErrTransferCanceled, true) })
+	h.mu.Lock()
+	h.transfer = a
+	h.pending.Store(true)
+	h.mu.Unlock()
+
+	if err := e.sendControl(historySyncControl{Type: historySyncRequestType, Since: since, Transfer: id}); err != nil {
+		e.endHistorySync(err, false)
+		return "", err
+	}
+	logger.L().Info("Requested history from own device", "peer", peerID, "known_rooms", len(since), "transfer", id)
+	return id, nil
+}
+
+// historySyncName is the name history syncs are shown under
+const historySyncName = "Historia wiadomości"
+
+// endHistorySync ends the sync we asked for with err; notify tells the
+// other device to stop serving it
+func (e *ExecP2P) endHistorySync(err error, notify bool) {
+	h := &e.historySync
+	h.mu.Lock()
+	a := h.transfer
+	h.transfer = nil
+	h.pending.Store(false)
+	h.mu.Unlock()
+	if a == nil {
+		return
+	}
+	if notify {
+		e.sendControl(historySyncControl{Type: historySyncCancelType, Transfer: a.info.ID})
+	}
+	e.transfers.finish(a, err)
+}
+
+// currentHistorySync returns the transfer of the sync we asked for, if id
+// is its ID
+func (e *ExecP2P) currentHistorySync(id string) *activeTransfer {
+	h := &e.historySync
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if h.transfer == nil || h.transfer.info.ID != id {
+		return nil
+	}
+	return h.transfer
+}
+
+// HistorySyncNotices delivers the outcome of SyncHistory
+func (e *ExecP2P) HistorySyncNotices() <-chan HistorySyncResult {
+	return e.historySync.notices
+}
+
+// ownDevice returns the connected peer if it holds our identity
+func (e *ExecP2P) ownDevice() (string, error) {
+	if e.network == nil {
+		return "", fmt.Errorf("not in a room")
+	}
+	own, err := e.GetPeerFingerprint()
+	if err != nil {
+		return "", err
+	}
+	for _, peerID := range e.connectedPeers() {
+		if fp, err := e.pqCrypto.GetPeerFingerprint(peerID); err == nil && fp == own {
+			return peerID, nil
+		}
+	}
+	return "", fmt.Errorf("the connected peer is not one of your devices: import your identity on it first")
+}
+
+// isOwnDevice reports whether peerID proved our own identity fingerprint
+func (e *ExecP2P) isOwnDevice(peerID string) bool {
+	own, err := e.GetPeerFingerprint()
+	if err != nil {
+		return false
+	}
+	fp, err := e.pqCrypto.GetPeerFingerprint(peerID)
+	return err == nil && fp == own
+}
+
+func (e *ExecP2P) handleHistorySync(payload *crypto.MessagePayload) {
+	if !e.isOwnDevice(payload.SenderID) {
+		logger.L().Warn("Ignoring history sync from a peer with another identity", "peer", payload.SenderID)
+		return
+	}
+	var ctl historySyncControl
+	if err := json.Unmarshal([]byte(payload.Message), &ctl); err != nil {
+		logger.L().Warn("Invalid history sync message", "err", err)
+		return
+	}
+	switch ctl.Type {
+	case historySyncRequestType:
+		go e.serveHistory(payload.SenderID, ctl.Transfer, ctl.Since)
+	case historySyncBatchType:
+		e.acceptHistory(ctl)
+	case historySyncDoneType:
+		e.finishHistorySync(payload.SenderID, ctl)
+	case historySyncCancelType:
+		e.historySyncCanceled(payload.SenderID, ctl.Transfer)
+	}
+}
+
+// serveHistory sends our other device every stored message it doesn't have
+func (e *ExecP2P) serveHistory(peerID, id string, since map[string]time.Time) {
+	if e.history == nil {
+		e.sendControl(historySyncControl{Type: historySyncDoneType, Transfer: id})
+		return
+	}
+	if id == "" {
+		id, _ = media.NewID()
+	}
+	stored := e.history.Rooms()
+
+	// the total goes out with every batch, for the progress on the other end
+	var total int64
+	for _, room := range stored {
+		after := since[room.RoomID]
+		e.history.Scan(room.RoomID, func(rec history.Record) bool {
+			if rec.Timestamp.After(after) {
+				total += int64(len(rec.Message))
+			}
+			return true
+		})
+	}
+
+	canceled := new(atomic.Bool)
+	h := &e.historySync
+	h.mu.Lock()
+	if h.serving == nil {
+		h.serving = make(map[string]*atomic.Bool)
+	}
+	h.serving[id] = canceled
+	h.mu.Unlock()
+	a := e.transfers.start(Transfer{
+		ID:        id,
+		Kind:      TransferHistory,
+		Direction: TransferSend,
+		Name:      historySyncName,
+		Total:     total,
+	}, func() {
+		if !canceled.Swap(true) {
+			e.sendControl(historySyncControl{Type: historySyncCancelType, Transfer: id})
+		}
+	})
+
+	rooms, messages, err := e.sendHistory(id, stored, since, total, a, canceled)
+	h.mu.Lock()
+	delete(h.serving, id)
+	h.mu.Unlock()
+	e.transfers.finish(a, err)
+	if err != nil {
+		logger.L().Warn("History sync aborted", "peer", peerID, "err", err)
+		return
+	}
+	e.sendControl(historySyncControl{Type: historySyncDoneType, Rooms: rooms, Messages: messages, Transfer: id})
+	logger.L().Info("Sent history to own device", "peer", peerID, "rooms", rooms, "messages", messages)
+}
+
+// sendHistory sends the batches of a sync until done or cancelled
+func (e *ExecP2P) sendHistory(id string, rooms []history.Room, since map[string]time.Time, total int64, a *activeTransfer, canceled *atomic.Bool) (int, int, error) {
+	var batch []history.Record
+	size := 0
+	flush := func() error {
+		if len(batch) == 0 {
+			return nil
+		}
+		err := e.sendControl(historySyncControl{Type: historySyncBatchType, Records: batch, Transfer: id, Total: total})
+		if err == nil {
+			a.bytes.Add(int64(size))
+		}
+		batch, size = nil, 0
+		return err
+	}
+
+	sentRooms, messages := 0, 0
+	for _, room := range rooms {
+		after := since[room.RoomID]
+		sent := 0
+		var sendErr error
+		err := e.history.Scan(room.RoomID, func(rec history.Record) bool {
+			if canceled.Load() {
+				sendErr = ErrTransferCanceled
+				return false
+			}
+			if !rec.Timestamp.After(after) {
+				return true
+			}
+			batch = append(batch, rec)
+			size += len(rec.Message)
+			sent++
+			if len(batch) >= historySyncBatchRecords || size >= historySyncBatchBytes {
+				sendErr = flush()
+			}
+			return sendErr == nil
+		})
+		if err == nil {
+			err = sendErr
+		}
+		if err != nil {
+			return 0, 0, err
+		}
+		if sent > 0 {
+			sentRooms++
+			messages += sent
+		}
+	}
+	if canceled.Load() {
+		return 0, 0, ErrTransferCanceled
+	}
+	return sentRooms, messages, flush()
+}
+
+// historySyncCanceled stops a sync the other device cancelled, whichever
+// end of it we are
+func (e *ExecP2P) historySyncCanceled(peerID, id string) {
+	h := &e.historySync
+	h.mu.Lock()
+	canceled, serving := h.serving[id]
+	h.mu.Unlock()
+	if serving {
+		canceled.Store(true)
+	} else if e.currentHistorySync(id) != nil {
+		e.endHistorySync(fmt.Errorf("%w by the other device", ErrTransferCanceled), false)
+	} else {
+		return
+	}
+	logger.L().Info("History sync canceled by own device", "peer", peerID, "transfer", id)
+}
+
+// acceptHistory stores records from our other device, if we asked for them
+func (e *ExecP2P) acceptHistory(ctl historySyncControl) {
+	if !e.historySyncActive() || e.history == nil {
+		logger.L().Warn("Ignoring history we didn't ask for")
+		return
+	}
+	a := e.currentHistorySync(ctl.Transfer)
+	if a == nil {
+		logger.L().Warn("Ignoring history of another sync", "transfer", ctl.Transfer)
+		return
+	}
+	a.total.Store(ctl.Total)
+	records := ctl.Records
+	for _, rec := range records {
+		a.bytes.Add(int64(len(rec.Message)))
+		if err := e.history.Append(rec); err != nil {
+			if !errors.Is(err, storage.ErrIncognito) {
+				logger.L().Warn("Failed to store synced message", "err", err)
+			}
+			e.historySync.failed.Add(1)
+			continue
+		}
+		e.historySync.stored.Add(1)
+	}
+}
+
+func (e *ExecP2P) finishHistorySync(peerID string, ctl historySyncControl) {
+	if !e.historySyncActive() || e.currentHistorySync(ctl.Transfer) == nil {
+		return
+	}
+	e.endHistorySync(nil, false)
+	result := HistorySyncResult{
+		PeerID:   peerID,
+		Rooms:    ctl.Rooms,
+		Messages: int(e.historySync.stored.Load()),
+		Failed:   int(e.historySync.failed.Load()),
+	}
+	logger.L().Info("History sync finished", "peer", peerID, "rooms", result.Rooms, "messages", result.Messages, "failed", result.Failed)
+	select {
+	case e.historySync.notices <- result:
+	default:
+	}
+}
+
+func (e *ExecP2P) historySyncActive() bool {
+	if !e.historySync.pending.Load() {
+		return false
+	}
+	if time.Now().UnixNano() > e.historySync.deadline.Load() {
+		e.endHistorySync(fmt.Errorf("history sync timed out"), true)
+		return false
+	}
+	return true
+}
@@ -0,0 +1,216 @@
+package app
+
+import (
+	"crypto/ed25519"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"execp2p/internal/config"
+	"execp2p/internal/crypto"
+	"execp2p/internal/keystore"
+	"execp2p/internal/logger"
+)
+
+// identityState describes where our identity keys came from
+type identityState struct {
+	persistent bool
+	protection string
+	path       string
+}
+
+// loadIdentity unlocks the persistent identity from the keystore, creating
+// it on first launch. In ephemeral mode a fresh identity is generated and
+// nothing is written to disk.
+func loadIdentity(cfg *config.Config) (*crypto.PQCrypto, identityState, error) {
+	if cfg.Identity.Ephemeral {
+		pq, err := crypto.NewPQCrypto()
+		return pq, identityState{}, err
+	}
+
+	dir, err := DataDir(cfg)
+	if err != nil {
+		return nil, identityState{}, err
+	}
+	ks := keystore.New(dir)
+	passphrase := []byte(cfg.Identity.Passphrase)
+
+	if ks.Exists() {
+		protection, err := ks.Protection()
+		if err != nil {
+			return nil, identityState{}, fmt.Errorf("failed to read keystore %s: %w", ks.Path(), err)
+		}
+		keys, err := ks.Load(passphrase)
+		if err != nil {
+			return nil, identityState{}, fmt.Errorf("failed to unlock keystore %s: %w", ks.Path(), err)
+		}
+		pq, err := crypto.NewPQCryptoWithIdentity(keys)
+		if err != nil {
+			return nil, identityState{}, err
+		}
+		logger.L().Info("Loaded persistent identity", "path", ks.Path(), "protection", protection)
+		return pq, identityState{persistent: true, protection: protection, path: ks.Path()}, nil
+	}
+
+	// first launch: generate the identity and seal it
+	pq, err := crypto.NewPQCrypto()
+	if err != nil {
+		return nil, identityState{}, err
+	}
+
+	protection := cfg.Identity.KeystoreProtection
+	if protection == keystore.ProtectionKeychain && !keystore.KeychainAvailable() {
+		if len(passphrase) == 0 {
+			logger.L().Warn("OS keychain unavailable and no passphrase set; using an ephemeral identity")
+			return pq, identityState{}, nil
+		}
+		logger.L().Warn("OS keychain unavailable; falling back to passphrase protection")
+		protection = keystore.ProtectionPassphrase
+	}
+	if protection == keystore.ProtectionPassphrase && len(passphrase) == 0 {
+		logger.L().Warn("Passphrase protection selected but no passphrase set; using an ephemeral identity")
+		return pq, identityState{}, nil
+	}
+
+	keys, err := pq.ExportIdentityKeys()
+	if err != nil {
+		return nil, identityState{}, fmt.Errorf("failed to export identity keys: %w", err)
+	}
+	if err := ks.Save(keys, protection, passphrase); err != nil {
+		return nil, identityState{}, fmt.Errorf("failed to save keystore: %w", err)
+	}
+	logger.L().Info("Created persistent identity", "path", ks.Path(), "protection", protection)
+	return pq, identityState{persistent: true, protection: protection, path: ks.Path()}, nil
+}
+
+// peerIDFile holds our peer ID next to a persistent identity
+const peerIDFile = "peer.id"
+
+// loadPeerID returns the peer ID stored in the data directory, creating it on
+// first use. Peers pin our fingerprint under this ID, so it must stay stable
+// as long as the identity does. Ephemeral identities get a fresh ID.
+func loadPeerID(cfg *config.Config, persistent bool) (string, error) {
+	if !persistent {
+		return generatePeerID()
+	}
+
+	dir, err := DataDir(cfg)
+	if err != nil {
+		return "", err
+	}
+	path := filepath.Join(dir, peerIDFile)
+
+	data, err := os.ReadFile(path)
+	if err == nil {
+		if id := strings.TrimSpace(string(data)); id != "" {
+			return id, nil
+		}
+	} else if !os.IsNotExist(err) {
+		return "", fmt.Errorf("failed to read peer ID: %w", err)
+	}
+
+	id, err := generatePeerID()
+	if err != nil {
+		return "", err
+	}
+	if err := os.WriteFile(path, []byte(id+"\n"), 0o600); err != nil {
+		return "", fmt.Errorf("failed to save peer ID: %w", err)
+	}
+	return id, nil
+}
+
+// LoadIdentityKeys unlocks the keystore without starting the application.
+// Used by CLI commands that operate on the stored identity.
+func LoadIdentityKeys(cfg *config.Config) (*crypto.IdentityKeys, error) {
+	dir, err := DataDir(cfg)
+	if err != nil {
+		return nil, err
+	}
+	ks := keystore.New(dir)
+	if !ks.Exists() {
+		return nil, keystore.ErrNotFound
+	}
+	return ks.Load([]byte(cfg.Identity.Passphrase))
+}
+
+// StoreIdentityKeys seals keys into the keystore, replacing the current
+// identity, and returns the protection mode that was used. primary is the
+// device key of the device the identity was imported from, nil when this
+// device becomes the identity's primary.
+func StoreIdentityKeys(cfg *config.Config, keys *crypto.IdentityKeys, primary ed25519.PublicKey) (string, error) {
+	if _, err := crypto.NewPQCryptoWithIdentity(keys); err != nil {
+		return "", fmt.Errorf("invalid identity: %w", err)
+	}
+	dir, err := DataDir(cfg)
+	if err != nil {
+		return "", err
+	}
+
+	protection := cfg.Identity.KeystoreProtection
+	if protection == keystore.ProtectionKeychain && !keystore.KeychainAvailable() {
+		protection = keystore.ProtectionPassphrase
+	}
+	if protection == keystore.ProtectionPassphrase && cfg.Identity.Passphrase == "" {
+		return "", keystore.ErrPassphraseMissing
+	}
+
+	if err := keystore.New(dir).Save(keys, protection, []byte(cfg.Identity.Passphrase)); err != nil {
+		return "", err
+	}
+	if err := writePrimaryKey(cfg, primary); err != nil {
+		return "", fmt.Errorf("failed to save the primary device key: %w", err)
+	}
+	return protection, nil
+}
+
+// ExportIdentity seals the identity currently in use into a portable,
+// passphrase-protected bundle. A device importing it becomes a linked device
+// of the primary, see WipeDevice.
+func (e *ExecP2P) ExportIdentity(passphrase []byte) ([]byte, error) {
+	if e.pqCrypto == nil {
+		return nil, fmt.Errorf("crypto not initialized")
+	}
+	keys, err := e.pqCrypto.ExportIdentityKeys()
+	if err != nil {
+		return nil, err
+	}
+	primary, err := e.primaryKey()
+	if err != nil {
+		return nil, err
+	}
+	return keystore.ExportBundle(keys, primary, passphrase)
+}
+
+// ImportIdentity replaces the identity in use with one from an exported
+// bundle and persists it in the keystore (unless running ephemerally).
+// It returns the fingerprint of the imported identity.
+func (e *ExecP2P) ImportIdentity(bundle, passphrase []byte) (string, error) {
+	if e.network != nil {
+		return "", fmt.Errorf("leave the current room before importing an identity")
+	}
+	keys, primary, err := keystore.ImportBundle(bundle, passphrase)
+	if err != nil {
+		return "", err
+	}
+	pq, err := crypto.NewPQCryptoWithIdentity(keys)
+	if err != nil {
+		return "", err
+	}
+
+	if !e.config.Identity.Ephemeral {
+		protection, err := StoreIdentityKeys(e.config, keys, primary)
+		if err != nil {
+			return "", fmt.Errorf("failed to persist imported identity: %w", err)
+		}
+		dir, _ := DataDir(e.config)
+		e.identity = identityState{persistent: true, protection: protection, path: keystore.New(dir).Path()}
+	}
+	e.roomMu.Lock()
+	e.pqCrypto = pq
+	e.roomMu.Unlock()
+	e.setPrimary(primary)
+
+	logger.L().Info("Imported identity", "fingerprint", keys.Fingerprint())
+	return keys.Fingerprint(), nil
+}
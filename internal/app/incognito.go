@@ -0,0 +1,79 @@
+package app
+
+import (
+	"time"
+
+	"execp2p/internal/logger"
+	"execp2p/internal/room"
+	"execp2p/internal/storage"
+)
+
+// RoomOptions are chosen when a room is created
+type RoomOptions struct {
+	// keep the room in memory only: no history, archive or trust data is
+	// written and the room ID is redacted from logs
+	Incognito bool
+	// close the room this long after it was created, 0 never
+	TTL time.Duration
+	// close the room after this long without a chat message, 0 never
+	IdleTimeout time.Duration
+}
+
+// DefaultRoomOptions are the options of rooms created without any, from
+// the config
+func (e *ExecP2P) DefaultRoomOptions() RoomOptions {
+	return RoomOptions{Incognito: e.config.Room.Incognito, TTL: e.config.Room.TTL, IdleTimeout: e.config.Room.IdleTimeout}
+}
+
+// enterIncognito closes the storage gate for roomID. It runs before
+// anything about the room is logged or written.
+func (e *ExecP2P) enterIncognito(roomID string) {
+	storage.SetIncognito(roomID, true)
+	logger.L().Info("Incognito room: nothing is written to disk", "room_id", roomID)
+}
+
+// adoptIncognito is called on guests when the host's metadata declares the
+// room incognito. Peers pinned since joining were already written, so their
+// pins are taken back out of the trust store before the gate closes.
+func (e *ExecP2P) adoptIncognito(roomID string) {
+	if storage.IsIncognito(roomID) {
+		return
+	}
+
+	e.pinsMu.Lock()
+	for peerID := range e.sessionPins {
+		if err := e.trust.KeepInMemory(peerID); err != nil {
+			logger.L().Warn("Failed to remove pin of incognito room peer", "peer", peerID, "err", err)
+		}
+	}
+	e.pinsMu.Unlock()
+
+	e.updateRoom(func(r *room.Room) error {
+		if r.ID == roomID {
+			r.Incognito = true
+		}
+		return nil
+	})
+	e.enterIncognito(roomID)
+}
+
+// leaveIncognito reopens the storage gate when the room is closed. Messages
+// still waiting to be sent are discarded with the room.
+func (e *ExecP2P) leaveIncognito() {
+	if e.currentRoom != nil && e.currentRoom.Incognito {
+		storage.SetIncognito(e.currentRoom.ID, false)
+		e.outbox.Clear(e.currentRoom.ID)
+	}
+}
+
+// resetSessionPins starts tracking pins for a newly entered room
+func (e *ExecP2P) resetSessionPins() {
+	e.pinsMu.Lock()
+	e.sessionPins = make(map[string]struct{})
+	e.pinsMu.Unlock()
+}
+
+// IsIncognito reports whether the current room is incognito
+func (e *ExecP2P) IsIncognito() bool {
+	return e.currentRoom != nil && storage.IsIncognito(e.currentRoom.ID)
+}
@@ -0,0 +1,84 @@
+package app
+
+import (
+	"context"
+	"errors"
+	"time"
+)
+
+// Join failure classes, for callers that react to them differently (e.g.
+// exit codes). Errors returned by JoinRoom match them with errors.Is.
+var (
+	// ErrDiscovery means the room's host could not be found
+	ErrDiscovery = errors.New("room not found")
+	// ErrTransport means the host was found but no connection came up
+	ErrTransport = errors.New("connection failed")
+)
+
+// waitForPeerInterval is how often WaitForPeer checks the connection
+const waitForPeerInterval = 200 * time.Millisecond
+
+// joinError keeps the message of err and adds its class
+type joinError struct {
+	class error
+	err   error
+}
+
+func (e *joinError) Error() string   { return e.err.Error() }
+func (e *joinError) Unwrap() []error { return []error{e.class, e.err} }
+
+func discoveryError(err error) error { return &joinError{class: ErrDiscovery, err: err} }
+func transportError(err error) error { return &joinError{class: ErrTransport, err: err} }
+
+// abandonJoin undoes a join that failed, so the session can enter a room
+// again
+func (e *ExecP2P) abandonJoin() {
+	if e.network != nil {
+		e.network.Stop()
+	}
+	e.leaveIncognito()
+	e.roomMu.Lock()
+	e.network = nil
+	e.isRunning = false
+	e.currentRoom = nil
+	e.roomMu.Unlock()
+}
+
+// WaitForPeer waits until the secure channel with a member of the room is
+// up, after JoinRoom returned: the access key is only checked then. It fails
+// with an error matching network.ErrAccessDenied when the key was refused,
+// network.ErrRoomFull when the room had no place left,
+// network.ErrIncompatibleVersion when the host speaks no protocol version
+// we do, network.ErrBanned or network.ErrRemoved when the host banned or
+// removed us, network.ErrRoomClosed when it closed the room, or with ctx's
+// error.
+func (e *ExecP2P) WaitForPeer(ctx context.Context) error {
+	ticker := time.NewTicker(waitForPeerInterval)
+	defer ticker.Stop()
+	for {
+		if reason := e.closeReason.Load(); reason != nil {
+			return *reason
+		}
+		if pq := e.state().pqCrypto; pq != nil && len(pq.GetVerifiedPeers()) > 0 {
+			return nil
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+		}
+	}
+}
+
+// NetworkErrors delivers the errors of the transports of our rooms;
+// network.Code tells what kind each one is
+func (e *ExecP2P) NetworkErrors() <-chan error {
+	return e.networkErrors
+}
+
+// RefusalNotices delivers why the host of a room we joined turned us away:
+// network.ErrAccessDenied, network.ErrRoomFull, network.ErrBanned or
+// network.ErrIncompatibleVersion
+func (e *ExecP2P) RefusalNotices() <-chan error {
+	return e.refusalNotices
+}
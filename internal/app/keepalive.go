@@ -0,0 +1,49 @@
+package app
+
+import (
+	"context"
+	"encoding/json"
+	"time"
+
+	"execp2p/internal/crash"
+)
+
+// keepAliveInterval is how often KeepAlive signals an open connection
+const keepAliveInterval = time.Second
+
+// KeepAlive sends a keep-alive message every second to every room we are
+// in with peers connected, until ctx ends; without traffic an idle QUIC
+// connection times out. Frontends run it for as long as they drive the app.
+func (e *ExecP2P) KeepAlive(ctx context.Context) {
+	defer crash.Recover("app.KeepAlive")
+	ticker := e.clock.NewTicker(keepAliveInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C():
+			for _, s := range e.Sessions() {
+				s.keepAlive(ctx)
+			}
+		}
+	}
+}
+
+// keepAlive signals the session's connection, if a peer is connected
+func (e *ExecP2P) keepAlive(ctx context.Context) {
+	status := e.GetNetworkStatus()
+	if !status.IsRunning || status.ConnectedPeers == 0 {
+		return
+	}
+	msg, err := json.Marshal(map[string]interface{}{
+		"type":    "keep_alive",
+		"content": "",
+		"time":    time.Now().Unix(),
+	})
+	if err == nil {
+		// only a signal: errors are ignored
+		_ = e.SendMessage(ctx, string(msg))
+	}
+}
@@ -0,0 +1,81 @@
+package app
+
+import (
+	"encoding/json"
+	"time"
+
+	"execp2p/internal/crypto"
+	"execp2p/internal/logger"
+)
+
+// kickType tells a member the host removed it from the room. The notice
+// rides the encrypted channel signed by the host; the connection is closed
+// and the keys renewed right after, so the member reads nothing further.
+const kickType = "kicked"
+
+// how long the notice gets to arrive before the connection is closed
+const kickGrace = 300 * time.Millisecond
+
+type kickControl struct {
+	Type   string `json:"type"`
+	RoomID string `json:"room_id"`
+	PeerID string `json:"peer_id"`
+	Reason string `json:"reason,omitempty"`
+}
+
+func (c kickControl) controlType() string { return c.Type }
+
+// Kick is sent on KickNotices when the host removed us from a room
+type Kick struct {
+	RoomID string
+	Reason string
+}
+
+// KickPeer removes a connected peer from the room: the peer is told why,
+// its connection is closed and the session keys are renewed. It may join
+// again with the access key; a ban keeps it out. A moderator asks the host.
+func (e *ExecP2P) KickPeer(peerID, reason string) error {
+	if delegated, err := e.delegate(moderationControl{Action: PermKick, PeerID: peerID, Reason: reason}); delegated {
+		return err
+	}
+	qnet, err := e.hostNetwork()
+	if err != nil {
+		return err
+	}
+
+	err = e.sendControl(kickControl{Type: kickType, RoomID: e.currentRoom.ID, PeerID: peerID, Reason: reason})
+	if err == nil {
+		time.Sleep(kickGrace)
+	}
+	// the peer goes either way; the close code tells it as well
+	return qnet.KickPeer(peerID, reason)
+}
+
+// KickNotices delivers our removals from a room by its host
+func (e *ExecP2P) KickNotices() <-chan Kick {
+	return e.kickNotices
+}
+
+// handleKick takes note that the host removed us (guests)
+func (e *ExecP2P) handleKick(payload *crypto.MessagePayload) {
+	var ctl kickControl
+	if err := json.Unmarshal([]byte(payload.Message), &ctl); err != nil {
+		logger.L().Warn("Invalid kick control message", "err", err)
+		return
+	}
+	if e.network == nil || e.network.IsListener() || !e.fromHost(payload.SenderID) {
+		logger.L().Warn("Ignoring kick from someone other than the host", "peer", payload.SenderID)
+		return
+	}
+	if e.currentRoom == nil || ctl.RoomID != e.currentRoom.ID || ctl.PeerID != e.peerID {
+		return
+	}
+	logger.L().Warn("Room host removed us from the room", "room_id", ctl.RoomID, "reason", ctl.Reason)
+	e.forgetRoom()
+
+	select {
+	case e.kickNotices <- Kick{RoomID: ctl.RoomID, Reason: ctl.Reason}:
+	default:
+		logger.L().Warn("Kick notice dropped; nobody is listening")
+	}
+}
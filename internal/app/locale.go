@@ -0,0 +1,27 @@
+package app
+
+import (
+	"time"
+
+	"execp2p/internal/timefmt"
+)
+
+// FormatTime formats a timestamp with the user's language and time zone
+func (e *ExecP2P) FormatTime(t time.Time) timefmt.Formatted {
+	return timefmt.Default().Format(t)
+}
+
+// LocaleSettings returns the configured language and time zone
+func (e *ExecP2P) LocaleSettings() (language, timezone string) {
+	return e.config.Locale.Language, e.config.Locale.Timezone
+}
+
+// SetLocale changes how timestamps are formatted from now on
+func (e *ExecP2P) SetLocale(language, timezone string) error {
+	if err := timefmt.Default().Configure(language, timezone); err != nil {
+		return err
+	}
+	e.config.Locale.Language = timefmt.Default().Language()
+	e.config.Locale.Timezone = timezone
+	return nil
+}
@@ -0,0 +1,339 @@
+package app
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/url"
+	"regexp"
+	"slices"
+	"sync"
+
+	"execp2p/internal/config"
+	"execp2p/internal/crash"
+	"execp2p/internal/crypto"
+	"execp2p/internal/history"
+	"execp2p/internal/logger"
+	"execp2p/internal/mailbox"
+	"execp2p/internal/storage"
+)
+
+// Store-and-forward delivery: while no peer is connected, messages are
+// sealed to the identity key of each peer we met in the room and parked in
+// that peer's mailbox on a relay. Peers learn each other's mailbox address
+// over the encrypted channel; the relay never sees plaintext.
+const mailboxAddressType = "mailbox_address"
+
+type mailboxAddressControl struct {
+	Type      string `json:"type"`
+	Server    string `json:"server"`
+	MailboxID string `json:"mailbox_id"`
+}
+
+func (c mailboxAddressControl) controlType() string { return c.Type }
+
+var mailboxIDPattern = regexp.MustCompile(`^[0-9a-f]{64}$`)
+
+// MailboxDelivery is sent on MailboxNotices when parked messages arrived
+type MailboxDelivery struct {
+	Messages int
+	// rooms the messages belong to
+	Rooms []string
+	// envelopes dropped: unknown sender, changed fingerprint, not for us
+	Rejected int
+	// first messages from people we haven't met, see ContactRequests
+	ContactRequests int
+}
+
+// mailboxState is the relay client and what we know about peers' mailboxes
+type mailboxState struct {
+	client   *mailbox.Client
+	contacts *mailbox.Contacts
+	notices  chan MailboxDelivery
+
+	// our contact bundle's prekeys and the first messages sent to them,
+	// see contact.go
+	prekeys  *storage.Bucket
+	requests *storage.Bucket
+	stop     context.CancelFunc
+
+	// one check of the mailbox at a time
+	checkMu sync.Mutex
+
+	// peers we told our address this session
+	announced map[string]struct{}
+	mu        sync.Mutex
+}
+
+// openMailbox sets up the relay client if a mailbox server is configured
+func openMailbox(cfg *config.Config, db *storage.DB) *mailboxState {
+	state := &mailboxState{
+		notices:   make(chan MailboxDelivery, 4),
+		announced: make(map[string]struct{}),
+	}
+	if cfg.Mailbox.Server == "" {
+		return state
+	}
+	bucket, err := db.Bucket(mailbox.BucketName)
+	if err != nil {
+		logger.L().Warn("Offline delivery is disabled", "err", err)
+		return state
+	}
+	state.client = mailbox.NewClient(cfg.Mailbox.Server)
+	state.contacts = mailbox.NewContacts(bucket)
+	if state.prekeys, err = db.Bucket(prekeyBucket); err == nil {
+		state.requests, err = db.Bucket(contactRequestBucket)
+	}
+	if err != nil {
+		logger.L().Warn("First contact through the mailbox is disabled", "err", err)
+		state.prekeys, state.requests = nil, nil
+	}
+	return state
+}
+
+// MailboxNotices delivers news about messages fetched from our mailbox
+func (e *ExecP2P) MailboxNotices() <-chan MailboxDelivery {
+	return e.mailbox.notices
+}
+
+// announceMailbox tells newly connected peers where to leave messages for us
+func (e *ExecP2P) announceMailbox() {
+	if e.mailbox.client == nil || e.network == nil || e.IsIncognito() {
+		return
+	}
+	connected := e.connectedPeers()
+	var fresh []string
+	e.mailbox.mu.Lock()
+	// a peer that reconnects may have restarted and forgotten us
+	for peerID := range e.mailbox.announced {
+		if !slices.Contains(connected, peerID) {
+			delete(e.mailbox.announced, peerID)
+		}
+	}
+	for _, peerID := range connected {
+		if _, ok := e.mailbox.announced[peerID]; !ok && e.pqCrypto.HasSession(peerID) {
+			e.mailbox.announced[peerID] = struct{}{}
+			fresh = append(fresh, peerID)
+		}
+	}
+	e.mailbox.mu.Unlock()
+	if len(fresh) == 0 {
+		return
+	}
+
+	secret, err := e.pqCrypto.MailboxSecret()
+	if err != nil {
+		logger.L().Warn("Cannot derive mailbox secret", "err", err)
+		return
+	}
+	ctl := mailboxAddressControl{Type: mailboxAddressType, Server: e.mailbox.client.Server(), MailboxID: mailbox.ID(secret)}
+	if err := e.sendControl(ctl); err != nil {
+		e.mailbox.mu.Lock()
+		for _, peerID := range fresh {
+			delete(e.mailbox.announced, peerID)
+		}
+		e.mailbox.mu.Unlock()
+	}
+}
+
+// handleMailboxAddress remembers where a peer takes messages while offline
+func (e *ExecP2P) handleMailboxAddress(payload *crypto.MessagePayload) {
+	if e.mailbox.contacts == nil || e.currentRoom == nil {
+		return
+	}
+	var ctl mailboxAddressControl
+	if err := json.Unmarshal([]byte(payload.Message), &ctl); err != nil {
+		logger.L().Warn("Invalid mailbox address", "err", err)
+		return
+	}
+	if u, err := url.Parse(ctl.Server); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" || !mailboxIDPattern.MatchString(ctl.MailboxID) {
+		logger.L().Warn("Ignoring invalid mailbox address", "peer", payload.SenderID)
+		return
+	}
+	kemPub, sigPub, err := e.pqCrypto.GetPeerIdentityKeys(payload.SenderID)
+	if err != nil {
+		return
+	}
+	err = e.mailbox.contacts.Put(mailbox.Contact{
+		PeerID:      payload.SenderID,
+		Fingerprint: crypto.ComputeFingerprint(kemPub, sigPub),
+		KEMPubKey:   kemPub,
+		SigPubKey:   sigPub,
+		Server:      ctl.Server,
+		MailboxID:   ctl.MailboxID,
+	}, e.currentRoom.ID)
+	if err != nil && !errors.Is(err, storage.ErrIncognito) {
+		logger.L().Warn("Failed to save mailbox address", "peer", payload.SenderID, "err", err)
+	}
+}
+
+// SendOffline seals a message for every peer of the current room that is
+// offline and has a mailbox, and returns how many mailboxes took it
+func (e *ExecP2P) SendOffline(ctx context.Context, message string) (int, error) {
+	if e.mailbox.client == nil || e.network == nil || e.currentRoom == nil || e.IsIncognito() {
+		return 0, nil
+	}
+	connected := e.connectedPeers()
+	var sent *crypto.MessagePayload
+	var lastErr error
+	parked := 0
+	for _, contact := range e.mailbox.contacts.InRoom(e.currentRoom.ID) {
+		if slices.Contains(connected, contact.PeerID) {
+			continue
+		}
+		sealed, payload, err := e.pqCrypto.SealMessage(contact.KEMPubKey, contact.SigPubKey, e.peerID, e.currentRoom.ID, message)
+		if err != nil {
+			lastErr = err
+			continue
+		}
+		data, err := crypto.SerializeSealedMessage(sealed)
+		if err != nil {
+			lastErr = err
+			continue
+		}
+		if err := e.mailbox.client.Deposit(ctx, contact.Server, contact.MailboxID, data); err != nil {
+			logger.L().Warn("Failed to park message for offline peer", "peer", contact.PeerID, "err", err)
+			lastErr = err
+			continue
+		}
+		if sent == nil {
+			sent = payload
+		}
+		parked++
+	}
+	if sent != nil {
+		e.recordHistory(sent, true)
+		logger.L().Info("Message parked for offline peers", "mailboxes", parked)
+	}
+	if parked == 0 && lastErr != nil {
+		return 0, fmt.Errorf("offline delivery failed: %w", lastErr)
+	}
+	return parked, nil
+}
+
+// CheckMailbox fetches the messages parked for us, stores them in the
+// history and shows those of the current room in the chat
+func (e *ExecP2P) CheckMailbox(ctx context.Context) (MailboxDelivery, error) {
+	var delivery MailboxDelivery
+	if e.mailbox.client == nil {
+		return delivery, fmt.Errorf("no mailbox server configured")
+	}
+	e.mailbox.checkMu.Lock()
+	defer e.mailbox.checkMu.Unlock()
+	secret, err := e.pqCrypto.MailboxSecret()
+	if err != nil {
+		return delivery, err
+	}
+	items, err := e.mailbox.client.Fetch(ctx, secret)
+	if err != nil || len(items) == 0 {
+		return delivery, err
+	}
+
+	acked := make([]string, 0, len(items))
+	for _, item := range items {
+		if kind, _ := crypto.EnvelopeType(item.Data); kind == crypto.MessageTypeFirstContact {
+			err := e.openFirstContact(item)
+			if errors.Is(err, storage.ErrIncognito) {
+				continue
+			}
+			acked = append(acked, item.ID)
+			if err != nil {
+				logger.L().Warn("Dropping first contact", "err", err)
+				delivery.Rejected++
+				continue
+			}
+			delivery.ContactRequests++
+			continue
+		}
+		payload, roomID, err := e.openEnvelope(item.Data)
+		if errors.Is(err, storage.ErrIncognito) {
+			// keep it for when the incognito room is closed
+			continue
+		}
+		acked = append(acked, item.ID)
+		if err != nil {
+			logger.L().Warn("Dropping mailbox envelope", "err", err)
+			delivery.Rejected++
+			continue
+		}
+		delivery.Messages++
+		if !slices.Contains(delivery.Rooms, roomID) {
+			delivery.Rooms = append(delivery.Rooms, roomID)
+		}
+		if s, ok := e.Session(roomID); ok {
+			s.countUnread(payload)
+			s.subscriptions.publish(payload)
+		}
+	}
+	if err := e.mailbox.client.Ack(ctx, secret, acked); err != nil {
+		logger.L().Warn("Failed to acknowledge mailbox envelopes", "err", err)
+	}
+	if delivery.Messages > 0 || delivery.Rejected > 0 || delivery.ContactRequests > 0 {
+		select {
+		case e.mailbox.notices <- delivery:
+		default:
+		}
+	}
+	return delivery, nil
+}
+
+// openEnvelope opens a parked message from a peer we have pinned and stores it
+func (e *ExecP2P) openEnvelope(data []byte) (*crypto.MessagePayload, string, error) {
+	sealed, err := crypto.DeserializeSealedMessage(data)
+	if err != nil {
+		return nil, "", err
+	}
+	payload, fingerprint, err := e.pqCrypto.OpenSealedMessage(sealed)
+	if err != nil {
+		return nil, "", err
+	}
+	// only peers we met can leave messages, and only with the identity we pinned
+	pinned, ok := e.trust.Get(sealed.SenderID)
+	if !ok || pinned.Fingerprint != fingerprint {
+		return nil, "", fmt.Errorf("sealed message from unknown or changed identity %s", sealed.SenderID)
+	}
+	if err := e.allowSender(sealed.SenderID); err != nil {
+		return nil, "", err
+	}
+	if err := storage.Allow(sealed.RoomID); err != nil {
+		return nil, "", err
+	}
+
+	if e.history != nil {
+		err := e.history.Append(history.Record{
+			MessageID:  payload.MessageID,
+			RoomID:     sealed.RoomID,
+			SenderID:   payload.SenderID,
+			SenderName: e.DisplayName(payload.SenderID),
+			Message:    payload.Message,
+			Timestamp:  payload.Timestamp,
+		})
+		if err != nil {
+			return nil, "", err
+		}
+	}
+	return payload, sealed.RoomID, nil
+}
+
+// pollMailbox checks the mailbox now and then while we are in a room
+func (e *ExecP2P) pollMailbox(ctx context.Context, stop <-chan struct{}) {
+	defer crash.Recover("app.pollMailbox")
+	if e.mailbox.client == nil {
+		return
+	}
+	ticker := e.clock.NewTicker(e.config.Mailbox.PollInterval)
+	defer ticker.Stop()
+	for {
+		if _, err := e.CheckMailbox(ctx); err != nil {
+			logger.L().Debug("Mailbox check failed", "err", err)
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-stop:
+			return
+		case <-ticker.C():
+		}
+	}
+}
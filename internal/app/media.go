@@ -0,0 +1,328 @@
+package app
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"execp2p/internal/config"
+	"execp2p/internal/crypto"
+	"execp2p/internal/logger"
+	"execp2p/internal/media"
+	"execp2p/internal/network"
+	"execp2p/internal/storage"
+)
+
+// mediaKinds are the chat message types that carry media
+var mediaKinds = map[string]bool{"image": true, "gif": true, "audio": true}
+
+// mediaRequestType asks the sender of a picture for its full-resolution original
+const mediaRequestType = "media_request"
+
+// how long serving a requested original may take
+const mediaServeTimeout = 5 * time.Minute
+
+// mediaMessage is the chat message that points at a media stream
+type mediaMessage struct {
+	Type        string `json:"type"`
+	Content     string `json:"content"`
+	MediaID     string `json:"media_id"`
+	ContentType string `json:"content_type"`
+	Size        int64  `json:"size"`
+	// pictures: dimensions, preview and the original kept by the sender
+	Width       int            `json:"width,omitempty"`
+	Height      int            `json:"height,omitempty"`
+	ThumbnailID string         `json:"thumbnail_id,omitempty"`
+	Original    *mediaOriginal `json:"original,omitempty"`
+	// voice messages: length and loudness bars (see voice.Waveform)
+	DurationMs int64  `json:"duration_ms,omitempty"`
+	Waveform   []byte `json:"waveform,omitempty"`
+}
+
+// mediaOriginal is a full-resolution picture available on request
+type mediaOriginal struct {
+	MediaID string `json:"media_id"`
+	Size    int64  `json:"size"`
+	Width   int    `json:"width"`
+	Height  int    `json:"height"`
+}
+
+type mediaRequestControl struct {
+	Type    string `json:"type"`
+	MediaID string `json:"media_id"`
+}
+
+func (c mediaRequestControl) controlType() string { return c.Type }
+
+// mediaWaiters are callers of RequestOriginal waiting for a media ID
+type mediaWaiters struct {
+	mu      sync.Mutex
+	waiting map[string][]chan struct{}
+}
+
+// openMedia keeps media in memory and, for a persistent identity, in the
+// encrypted disk cache in the cache directory
+func openMedia(cfg *config.Config, db *storage.DB) *media.Store {
+	if cfg.Media.CacheLimit <= 0 || !db.Persistent() {
+		return media.NewStore(cfg.Media.MemoryLimit, nil)
+	}
+	dir, err := CacheDir(cfg)
+	if err != nil {
+		logger.L().Warn("Media is kept in memory only", "err", err)
+		return media.NewStore(cfg.Media.MemoryLimit, nil)
+	}
+	index, err := db.Bucket(media.IndexBucket)
+	if err == nil {
+		var disk *media.DiskCache
+		if disk, err = media.OpenDiskCache(filepath.Join(dir, media.CacheDirName), index, cfg.Media.CacheLimit); err == nil {
+			return media.NewStore(cfg.Media.MemoryLimit, disk)
+		}
+	}
+	logger.L().Warn("Media is kept in memory only", "err", err)
+	return media.NewStore(cfg.Media.MemoryLimit, nil)
+}
+
+// MediaStats returns how much media is kept in memory and on disk
+func (e *ExecP2P) MediaStats() media.Stats {
+	return e.media.Stats()
+}
+
+// ClearMedia drops all received and sent media, shredding the disk cache.
+// Messages that refer to it show a missing picture afterwards.
+func (e *ExecP2P) ClearMedia() error {
+	if err := e.media.Clear(); err != nil {
+		return fmt.Errorf("failed to clear media cache: %w", err)
+	}
+	return nil
+}
+
+// SendMedia streams a picture or voice message to the peer on a stream of
+// its own, then sends the chat message of the given kind (image, gif,
+// audio) that refers to it. It returns the media ID.
+func (e *ExecP2P) SendMedia(ctx context.Context, kind, name, contentType string, body io.Reader, size int64) (string, error) {
+	if !mediaKinds[kind] {
+		return "", fmt.Errorf("unknown media kind %q", kind)
+	}
+	if !media.Allowed(contentType) {
+		return "", fmt.Errorf("unsupported media type %q", contentType)
+	}
+	qnet, ok := e.network.(*network.QuicNetwork)
+	if !ok {
+		return "", fmt.Errorf("not connected to a room")
+	}
+	id, err := media.NewID()
+	if err != nil {
+		return "", err
+	}
+
+	// our own copy, so the picture shows up on our side too
+	var local bytes.Buffer
+	header := network.MediaHeader{ID: id, ContentType: contentType, Name: name, Size: size}
+	if err := e.sendMediaStream(ctx, qnet, header, io.TeeReader(body, &local)); err != nil {
+		return "", err
+	}
+	e.storeMedia(media.Item{ID: id, ContentType: contentType, Name: name, SenderID: e.peerID, Data: local.Bytes()})
+
+	msg := mediaMessage{Type: kind, Content: name, MediaID: id, ContentType: contentType, Size: size}
+	if kind == "audio" {
+		e.analyzeVoice(ctx, &msg, local.Bytes())
+	}
+	return id, e.sendMediaMessage(ctx, msg)
+}
+
+// SendPicture strips the metadata from a picture (image or gif), scales it
+// down and sends it with a thumbnail. A full-resolution original stays here
+// until the peer asks for it. It returns the media ID of the sent picture.
+func (e *ExecP2P) SendPicture(ctx context.Context, kind, name, contentType string, data []byte) (string, error) {
+	if kind != "image" && kind != "gif" {
+		return "", fmt.Errorf("not a picture kind: %q", kind)
+	}
+	if !media.Allowed(contentType) {
+		return "", fmt.Errorf("unsupported media type %q", contentType)
+	}
+	qnet, ok := e.network.(*network.QuicNetwork)
+	if !ok {
+		return "", fmt.Errorf("not connected to a room")
+	}
+	pic, err := media.PreparePicture(data, contentType)
+	if err != nil {
+		return "", err
+	}
+
+	msg := mediaMessage{
+		Type:        kind,
+		Content:     name,
+		ContentType: pic.ContentType,
+		Size:        int64(len(pic.Data)),
+		Width:       pic.Width,
+		Height:      pic.Height,
+	}
+	// the thumbnail first, so it is there when the chat message arrives
+	if pic.Thumbnail != nil {
+		if msg.ThumbnailID, err = e.streamMedia(ctx, qnet, pic.ThumbnailType, name, pic.Thumbnail); err != nil {
+			return "", err
+		}
+	}
+	if msg.MediaID, err = e.streamMedia(ctx, qnet, pic.ContentType, name, pic.Data); err != nil {
+		return "", err
+	}
+	if pic.Original != nil {
+		id, err := media.NewID()
+		if err != nil {
+			return "", err
+		}
+		if err := e.storeMedia(media.Item{ID: id, ContentType: pic.ContentType, Name: name, SenderID: e.peerID, Data: pic.Original}); err == nil {
+			msg.Original = &mediaOriginal{MediaID: id, Size: int64(len(pic.Original)), Width: pic.OriginalWidth, Height: pic.OriginalHeight}
+		}
+	}
+	return msg.MediaID, e.sendMediaMessage(ctx, msg)
+}
+
+// streamMedia sends one media body and keeps our own copy
+func (e *ExecP2P) streamMedia(ctx context.Context, qnet *network.QuicNetwork, contentType, name string, data []byte) (string, error) {
+	id, err := media.NewID()
+	if err != nil {
+		return "", err
+	}
+	header := network.MediaHeader{ID: id, ContentType: contentType, Name: name, Size: int64(len(data))}
+	if err := e.sendMediaStream(ctx, qnet, header, bytes.NewReader(data)); err != nil {
+		return "", err
+	}
+	e.storeMedia(media.Item{ID: id, ContentType: contentType, Name: name, SenderID: e.peerID, Data: data})
+	return id, nil
+}
+
+// sendMediaMessage sends the message pointing at a media item under the
+// item's ID, so the ID returned for the media is also the message's
+func (e *ExecP2P) sendMediaMessage(ctx context.Context, msg mediaMessage) error {
+	data, err := json.Marshal(msg)
+	if err != nil {
+		return err
+	}
+	return e.network.SendMessageWithID(ctx, msg.MediaID, string(data))
+}
+
+// Media returns a picture or voice message sent or received, from memory
+// or the disk cache
+func (e *ExecP2P) Media(id string) (media.Item, bool) {
+	return e.media.Get(id)
+}
+
+// RequestOriginal asks the sender of a picture for its full-resolution
+// original and waits until it has arrived
+func (e *ExecP2P) RequestOriginal(ctx context.Context, id string) (media.Item, error) {
+	if item, ok := e.media.Get(id); ok {
+		return item, nil
+	}
+	arrived := make(chan struct{}, 1)
+	w := &e.mediaWaiters
+	w.mu.Lock()
+	if w.waiting == nil {
+		w.waiting = make(map[string][]chan struct{})
+	}
+	w.waiting[id] = append(w.waiting[id], arrived)
+	w.mu.Unlock()
+	defer func() {
+		w.mu.Lock()
+		defer w.mu.Unlock()
+		for i, ch := range w.waiting[id] {
+			if ch == arrived {
+				w.waiting[id] = append(w.waiting[id][:i], w.waiting[id][i+1:]...)
+				break
+			}
+		}
+		if len(w.waiting[id]) == 0 {
+			delete(w.waiting, id)
+		}
+	}()
+
+	if err := e.sendControl(mediaRequestControl{Type: mediaRequestType, MediaID: id}); err != nil {
+		return media.Item{}, err
+	}
+	select {
+	case <-arrived:
+	case <-ctx.Done():
+		return media.Item{}, fmt.Errorf("original not received: %w", ctx.Err())
+	}
+	item, ok := e.media.Get(id)
+	if !ok {
+		return media.Item{}, fmt.Errorf("original not kept")
+	}
+	return item, nil
+}
+
+// handleMediaRequest sends one of our originals to the peer asking for it
+func (e *ExecP2P) handleMediaRequest(payload *crypto.MessagePayload) {
+	var ctl mediaRequestControl
+	if err := json.Unmarshal([]byte(payload.Message), &ctl); err != nil {
+		logger.L().Warn("Invalid media request", "err", err)
+		return
+	}
+	// only what we sent ourselves is served
+	item, ok := e.media.Get(ctl.MediaID)
+	if !ok || item.SenderID != e.peerID {
+		logger.L().Debug("Requested media not available", "peer", payload.SenderID, "id", ctl.MediaID)
+		return
+	}
+	qnet, ok := e.network.(*network.QuicNetwork)
+	if !ok {
+		return
+	}
+	go func() {
+		ctx, cancel := context.WithTimeout(context.Background(), mediaServeTimeout)
+		defer cancel()
+		header := network.MediaHeader{ID: item.ID, ContentType: item.ContentType, Name: item.Name, Size: int64(len(item.Data))}
+		if err := e.sendMediaStream(ctx, qnet, header, bytes.NewReader(item.Data)); err != nil {
+			logger.L().Warn("Failed to send requested original", "id", item.ID, "err", err)
+		}
+	}()
+}
+
+// receiveMedia stores a media body streamed by a peer
+func (e *ExecP2P) receiveMedia(senderID string, header network.MediaHeader, body io.Reader) error {
+	if !media.Allowed(header.ContentType) {
+		return fmt.Errorf("unsupported media type %q", header.ContentType)
+	}
+	a := e.transfers.start(Transfer{
+		ID:        header.ID,
+		Kind:      transferKind(header.ContentType),
+		Direction: TransferReceive,
+		Name:      header.Name,
+		Total:     header.Size,
+	}, func() { e.cancelMedia(header.ID) })
+	data, err := io.ReadAll(a.reader(body))
+	e.transfers.finish(a, err)
+	if err != nil {
+		return err
+	}
+	return e.storeMedia(media.Item{ID: header.ID, ContentType: header.ContentType, Name: cleanFileName(header.Name), SenderID: senderID, Data: data})
+}
+
+// cancelMedia resets the stream of a media body being received
+func (e *ExecP2P) cancelMedia(id string) {
+	if qnet, ok := e.network.(*network.QuicNetwork); ok {
+		qnet.CancelMedia(id)
+	}
+}
+
+func (e *ExecP2P) storeMedia(item media.Item) error {
+	if err := e.media.Put(item); err != nil {
+		logger.L().Warn("Media not kept", "id", item.ID, "err", err)
+		return err
+	}
+	w := &e.mediaWaiters
+	w.mu.Lock()
+	for _, ch := range w.waiting[item.ID] {
+		select {
+		case ch <- struct{}{}:
+		default:
+		}
+	}
+	w.mu.Unlock()
+	return nil
+}
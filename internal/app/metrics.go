@@ -0,0 +1,17 @@
+package app
+
+import "execp2p/internal/diagnostics"
+
+// registerGauges makes the diagnostics gauges read the state of e's sessions
+func (e *ExecP2P) registerGauges() {
+	diagnostics.RegisterGauge(diagnostics.GaugePeersConnected, func() int64 {
+		var n int64
+		for _, s := range e.Sessions() {
+			n += int64(len(s.connectedPeers()))
+		}
+		return n
+	})
+	diagnostics.RegisterGauge(diagnostics.GaugeRoomsActive, func() int64 {
+		return int64(len(e.Sessions()))
+	})
+}
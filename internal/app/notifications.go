@@ -0,0 +1,70 @@
+package app
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+
+	"execp2p/internal/config"
+	"execp2p/internal/room"
+)
+
+// NotificationSettings returns the desktop notification settings in effect
+func (e *ExecP2P) NotificationSettings() config.NotificationsConfig {
+	e.reloadMu.Lock()
+	defer e.reloadMu.Unlock()
+	n := e.config.Notifications
+	n.MutedRooms = slices.Clone(n.MutedRooms)
+	return n
+}
+
+// ShouldNotify reports whether a message in roomID may show a desktop
+// notification
+func (e *ExecP2P) ShouldNotify(roomID string) bool {
+	e.reloadMu.Lock()
+	defer e.reloadMu.Unlock()
+	n := e.config.Notifications
+	return n.Enabled && !slices.Contains(n.MutedRooms, roomID)
+}
+
+// SetNotifications turns desktop notifications and their previews on or
+// off, at once and in the config file
+func (e *ExecP2P) SetNotifications(enabled, hidePreview bool) error {
+	return e.updateNotifications(func(n *config.NotificationsConfig) {
+		n.Enabled, n.HidePreview = enabled, hidePreview
+	})
+}
+
+// SetRoomMuted mutes or unmutes the notifications of a room, at once and in
+// the config file
+func (e *ExecP2P) SetRoomMuted(roomID string, muted bool) error {
+	if !room.ValidateRoomID(roomID) {
+		return fmt.Errorf("invalid room ID: %s", roomID)
+	}
+	return e.updateNotifications(func(n *config.NotificationsConfig) {
+		n.MutedRooms = slices.DeleteFunc(slices.Clone(n.MutedRooms), func(id string) bool { return id == roomID })
+		if muted {
+			n.MutedRooms = append(n.MutedRooms, roomID)
+		}
+	})
+}
+
+// updateNotifications applies change to the notification settings and
+// writes them to the config file. They are applied even when they can't be
+// saved.
+func (e *ExecP2P) updateNotifications(change func(n *config.NotificationsConfig)) error {
+	e.reloadMu.Lock()
+	defer e.reloadMu.Unlock()
+
+	n := e.config.Notifications
+	change(&n)
+	// so the next reload finds nothing changed
+	e.config.Notifications = n
+	if e.loadedConfig != nil {
+		e.loadedConfig.Notifications = n
+	}
+	if e.configFile == "" {
+		return errors.New("no config file to save the notification settings to")
+	}
+	return config.SaveNotifications(e.configFile, n)
+}
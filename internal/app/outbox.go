@@ -0,0 +1,84 @@
+package app
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"execp2p/internal/logger"
+	"execp2p/internal/network"
+	"execp2p/internal/outbox"
+	"execp2p/internal/storage"
+)
+
+// leaveFlushTimeout bounds sending the queued messages when leaving a room
+const leaveFlushTimeout = 3 * time.Second
+
+func newOutbox(db *storage.DB) *outbox.Outbox {
+	bucket, err := db.Bucket(outbox.BucketName)
+	if err != nil {
+		logger.L().Warn("Unsent messages are kept in memory only", "err", err)
+		return outbox.New(outbox.DefaultLimit, nil)
+	}
+	return outbox.New(outbox.DefaultLimit, bucket)
+}
+
+// QueueMessage keeps a message that couldn't be sent, for the current room,
+// under the ID it was tried with (SendMessageWithID)
+func (e *ExecP2P) QueueMessage(messageID, body string) (outbox.Message, error) {
+	if e.currentRoom == nil {
+		return outbox.Message{}, fmt.Errorf("not in a room")
+	}
+	return e.outbox.AddWithID(e.currentRoom.ID, messageID, body)
+}
+
+// QueuedMessages returns the unsent messages of a room, oldest first
+func (e *ExecP2P) QueuedMessages(roomID string) []outbox.Message {
+	return e.outbox.List(roomID)
+}
+
+// ClearQueuedMessages discards the unsent messages of a room and returns
+// how many there were
+func (e *ExecP2P) ClearQueuedMessages(roomID string) int {
+	return e.outbox.Clear(roomID)
+}
+
+// flushBeforeLeaving sends what is still queued while a peer is there to
+// take it, with a bound, before the room is left
+func (e *ExecP2P) flushBeforeLeaving() {
+	if e.currentRoom == nil || len(e.network.Peers()) == 0 || len(e.outbox.List(e.currentRoom.ID)) == 0 {
+		return
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), leaveFlushTimeout)
+	defer cancel()
+	if _, err := e.FlushOutbox(ctx); err != nil {
+		logger.L().Warn("Queued messages left unsent", "room_id", e.currentRoom.ID, "err", err)
+	}
+}
+
+// FlushOutbox sends the current room's unsent messages in order. It stops at
+// the first one that fails, so they never arrive out of order, and returns
+// how many were sent.
+func (e *ExecP2P) FlushOutbox(ctx context.Context) (int, error) {
+	if e.currentRoom == nil {
+		return 0, nil
+	}
+	sent := 0
+	for _, msg := range e.outbox.List(e.currentRoom.ID) {
+		// the queue's ID stays the same however often it is tried
+		if err := e.SendMessageWithID(ctx, msg.ID, msg.Body); err != nil {
+			undelivered, partly := network.PartlyDelivered(err)
+			if !partly {
+				return sent, err
+			}
+			// sending it again would repeat it to those who got it
+			logger.L().Warn("Queued message not delivered to everyone", "room_id", msg.RoomID, "undelivered", len(undelivered))
+		}
+		e.outbox.Remove(msg.RoomID, msg.ID)
+		sent++
+	}
+	if sent > 0 {
+		logger.L().Info("Queued messages sent", "count", sent)
+	}
+	return sent, nil
+}
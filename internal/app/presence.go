@@ -0,0 +1,210 @@
+package app
+
+import (
+	"encoding/json"
+	"fmt"
+	"sync"
+	"time"
+
+	"execp2p/internal/crypto"
+	"execp2p/internal/logger"
+)
+
+// Presence tells the room whether someone is around
+type Presence string
+
+const (
+	PresenceOnline Presence = "online"
+	PresenceAway   Presence = "away"
+	// do not disturb: around, but not to be notified
+	PresenceDND Presence = "dnd"
+)
+
+// ParsePresence checks a presence given by name
+func ParsePresence(s string) (Presence, error) {
+	switch p := Presence(s); p {
+	case PresenceOnline, PresenceAway, PresenceDND:
+		return p, nil
+	}
+	return "", fmt.Errorf("unknown presence %q: want online, away or dnd", s)
+}
+
+// members announce their presence to the room when it changes and to every
+// peer that finishes its key exchange; a peer not heard from is online
+const presenceType = "presence"
+
+type presenceControl struct {
+	Type     string   `json:"type"`
+	Presence Presence `json:"presence"`
+}
+
+func (c presenceControl) controlType() string { return c.Type }
+
+// PresenceChange is sent on PresenceNotices when a member's presence changed
+type PresenceChange struct {
+	PeerID   string
+	Presence Presence
+	// ours, set by the user or by idle detection
+	Local bool
+}
+
+// presenceState is our presence and the ones peers announced
+type presenceState struct {
+	mu sync.Mutex
+	// what the user picked; idle detection only moves online to away
+	chosen  Presence
+	current Presence
+	// last time the user did something
+	lastActive time.Time
+	peers      map[string]Presence
+	notices    chan PresenceChange
+}
+
+func newPresence() *presenceState {
+	return &presenceState{
+		chosen:     PresenceOnline,
+		current:    PresenceOnline,
+		lastActive: time.Now(),
+		peers:      make(map[string]Presence),
+		notices:    make(chan PresenceChange, 16),
+	}
+}
+
+// PresenceNotices delivers presence changes of room members, ours included
+func (e *ExecP2P) PresenceNotices() <-chan PresenceChange {
+	return e.presence.notices
+}
+
+// Presence returns our presence as the room sees it
+func (e *ExecP2P) Presence() Presence {
+	e.presence.mu.Lock()
+	defer e.presence.mu.Unlock()
+	return e.presence.current
+}
+
+// PeerPresence returns the presence a peer announced
+func (e *ExecP2P) PeerPresence(peerID string) Presence {
+	if peerID == e.peerID {
+		return e.Presence()
+	}
+	e.presence.mu.Lock()
+	defer e.presence.mu.Unlock()
+	if p, ok := e.presence.peers[peerID]; ok {
+		return p
+	}
+	return PresenceOnline
+}
+
+// SetPresence sets the presence the user picked. While it is online, idle
+// detection turns it to away after room.away_after without activity.
+func (e *ExecP2P) SetPresence(p Presence) error {
+	if _, err := ParsePresence(string(p)); err != nil {
+		return err
+	}
+	e.presence.mu.Lock()
+	e.presence.chosen = p
+	e.presence.lastActive = time.Now()
+	e.presence.mu.Unlock()
+	e.changePresence(p)
+	return nil
+}
+
+// NoteActivity tells idle detection the user did something: typed, sent a
+// message or moved the pointer. Away set by idle detection ends with it.
+func (e *ExecP2P) NoteActivity() {
+	e.presence.mu.Lock()
+	e.presence.lastActive = time.Now()
+	back := e.presence.chosen == PresenceOnline && e.presence.current == PresenceAway
+	e.presence.mu.Unlock()
+	if back {
+		e.changePresence(PresenceOnline)
+	}
+}
+
+// checkIdle turns an online presence to away once the user has been idle
+// for longer than room.away_after; zero turns idle detection off
+func (e *ExecP2P) checkIdle() {
+	awayAfter := e.config.Room.AwayAfter
+	if awayAfter <= 0 {
+		return
+	}
+	e.presence.mu.Lock()
+	idle := e.presence.current == PresenceOnline && time.Since(e.presence.lastActive) > awayAfter
+	e.presence.mu.Unlock()
+	if idle {
+		logger.L().Debug("User is idle; presence set to away", "after", awayAfter)
+		e.changePresence(PresenceAway)
+	}
+}
+
+// changePresence announces our presence if it changed
+func (e *ExecP2P) changePresence(p Presence) {
+	e.presence.mu.Lock()
+	changed := e.presence.current != p
+	e.presence.current = p
+	e.presence.mu.Unlock()
+	if !changed {
+		return
+	}
+	e.notifyPresence(PresenceChange{PeerID: e.peerID, Presence: p, Local: true})
+	e.notifyStatus()
+	for _, s := range e.Sessions() {
+		go s.sendPresenceChange()
+	}
+}
+
+// sendPresence tells the connected peers our presence
+func (e *ExecP2P) sendPresence() {
+	if e.network == nil || len(e.network.Peers()) == 0 {
+		return
+	}
+	e.sendControl(presenceControl{Type: presenceType, Presence: e.Presence()})
+}
+
+// sendPresenceChange tells the connected peers our presence changed. Unlike
+// the announcement to a peer that just joined, it goes as ephemeral data
+// (network.SendEphemeral) and may be lost; the next change corrects it.
+func (e *ExecP2P) sendPresenceChange() {
+	if e.network == nil || len(e.network.Peers()) == 0 {
+		return
+	}
+	e.sendEphemeral(presenceControl{Type: presenceType, Presence: e.Presence()})
+}
+
+// handlePresence records a presence a peer announced
+func (e *ExecP2P) handlePresence(payload *crypto.MessagePayload) {
+	var ctl presenceControl
+	if err := json.Unmarshal([]byte(payload.Message), &ctl); err != nil {
+		logger.L().Warn("Invalid presence control message", "err", err)
+		return
+	}
+	p, err := ParsePresence(string(ctl.Presence))
+	if err != nil {
+		logger.L().Warn("Ignoring presence", "peer", payload.SenderID, "err", err)
+		return
+	}
+	e.presence.mu.Lock()
+	old, known := e.presence.peers[payload.SenderID]
+	e.presence.peers[payload.SenderID] = p
+	e.presence.mu.Unlock()
+	if known && old == p || !known && p == PresenceOnline {
+		return
+	}
+	e.notifyPresence(PresenceChange{PeerID: payload.SenderID, Presence: p})
+	e.notifyStatus()
+}
+
+// forgetPresence drops what a departed peer announced
+func (e *ExecP2P) forgetPresence(peerID string) {
+	e.presence.mu.Lock()
+	delete(e.presence.peers, peerID)
+	e.presence.mu.Unlock()
+}
+
+func (e *ExecP2P) notifyPresence(change PresenceChange) {
+	select {
+	case e.presence.notices <- change:
+	default:
+		// nobody is listening
+	}
+}
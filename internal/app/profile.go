@@ -0,0 +1,239 @@
+package app
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sync"
+
+	"execp2p/internal/crypto"
+	"execp2p/internal/emoji"
+	"execp2p/internal/logger"
+	"execp2p/internal/profile"
+	"execp2p/internal/storage"
+)
+
+// Profiles are signed with the identity key and sent to every peer once the
+// key exchange with it is done, and again when they change. A peer can only
+// publish a profile for its own identity; the ones received are cached by
+// fingerprint. Avatars travel like shortcode images: the profile carries the
+// hash and whoever lacks the image asks its owner for it.
+const (
+	profileType       = "profile"
+	avatarRequestType = "avatar_request"
+	avatarType        = "avatar"
+)
+
+type profileControl struct {
+	Type    string          `json:"type"`
+	Profile *crypto.Profile `json:"profile,omitempty"`
+	Hash    string          `json:"hash,omitempty"`
+	Data    []byte          `json:"data,omitempty"`
+}
+
+func (c profileControl) controlType() string { return c.Type }
+
+// profileState is the profile cache and our own signed profile
+type profileState struct {
+	cache *profile.Cache
+	mu    sync.Mutex
+	own   *crypto.Profile
+}
+
+func newProfiles(db *storage.DB) *profileState {
+	bucket, err := db.Bucket(profile.BucketName)
+	if err != nil {
+		logger.L().Warn("Profiles are cached in memory only", "err", err)
+		return &profileState{cache: profile.NewCache(nil)}
+	}
+	return &profileState{cache: profile.NewCache(bucket)}
+}
+
+// Profile returns our own signed profile. It is signed again when the
+// nickname changed since.
+func (e *ExecP2P) Profile() (*crypto.Profile, error) {
+	e.profiles.mu.Lock()
+	defer e.profiles.mu.Unlock()
+
+	own := e.profiles.own
+	if own == nil {
+		fingerprint, err := e.pqCrypto.GetIdentityFingerprint()
+		if err != nil {
+			return nil, err
+		}
+		// avatar and status of an earlier session
+		own, _ = e.profiles.cache.Get(fingerprint)
+	}
+	if own != nil && own.PeerID == e.peerID && own.Nickname == e.Nickname() {
+		e.profiles.own = own
+		return own, nil
+	}
+	var avatarHash, status string
+	if own != nil {
+		avatarHash, status = own.AvatarHash, own.Status
+	}
+	return e.signProfileLocked(avatarHash, status)
+}
+
+// SetProfileStatus sets the status text of our profile and sends the
+// profile to the room
+func (e *ExecP2P) SetProfileStatus(status string) (*crypto.Profile, error) {
+	status, err := profile.CleanStatus(status)
+	if err != nil {
+		return nil, err
+	}
+	own, err := e.Profile()
+	if err != nil {
+		return nil, err
+	}
+	return e.updateProfile(own.AvatarHash, status)
+}
+
+// SetAvatar sets the avatar of our profile, or removes it for an empty
+// image, and sends the profile to the room
+func (e *ExecP2P) SetAvatar(image []byte) (*crypto.Profile, error) {
+	own, err := e.Profile()
+	if err != nil {
+		return nil, err
+	}
+	if len(image) == 0 {
+		return e.updateProfile("", own.Status)
+	}
+	asset, err := emoji.NewAsset(image)
+	if err != nil {
+		return nil, err
+	}
+	e.emojiCache.Put(asset)
+	return e.updateProfile(asset.Hash, own.Status)
+}
+
+// Avatar returns the avatar image of a profile, if it has arrived
+func (e *ExecP2P) Avatar(p *crypto.Profile) (*emoji.Asset, bool) {
+	if p == nil || p.AvatarHash == "" {
+		return nil, false
+	}
+	return e.emojiCache.Get(p.AvatarHash)
+}
+
+// PeerProfile returns the verified profile of a peer, also one cached from
+// an earlier session with the same identity
+func (e *ExecP2P) PeerProfile(peerID string) (*crypto.Profile, bool) {
+	if peerID == e.peerID {
+		own, err := e.Profile()
+		return own, err == nil
+	}
+	fingerprint, err := e.pqCrypto.GetPeerFingerprint(peerID)
+	if err != nil {
+		return nil, false
+	}
+	return e.profiles.cache.Get(fingerprint)
+}
+
+func (e *ExecP2P) updateProfile(avatarHash, status string) (*crypto.Profile, error) {
+	e.profiles.mu.Lock()
+	own, err := e.signProfileLocked(avatarHash, status)
+	e.profiles.mu.Unlock()
+	if err != nil {
+		return nil, err
+	}
+	e.notifyStatus()
+	for _, s := range e.Sessions() {
+		go s.sendProfile()
+	}
+	return own, nil
+}
+
+// signProfileLocked signs and caches our profile; profiles.mu must be held
+func (e *ExecP2P) signProfileLocked(avatarHash, status string) (*crypto.Profile, error) {
+	own, err := e.pqCrypto.CreateProfile(e.peerID, e.Nickname(), avatarHash, status)
+	if err != nil {
+		return nil, fmt.Errorf("failed to sign profile: %w", err)
+	}
+	e.profiles.cache.Put(own)
+	e.profiles.own = own
+	return own, nil
+}
+
+// sendProfile sends our profile to the connected peers
+func (e *ExecP2P) sendProfile() {
+	if e.network == nil || len(e.network.Peers()) == 0 {
+		return
+	}
+	own, err := e.Profile()
+	if err != nil {
+		logger.L().Warn("Cannot sign profile", "err", err)
+		return
+	}
+	e.sendControl(profileControl{Type: profileType, Profile: own})
+}
+
+// handleProfileControl handles profiles, avatar requests and avatars
+func (e *ExecP2P) handleProfileControl(payload *crypto.MessagePayload) {
+	var ctl profileControl
+	if err := json.Unmarshal([]byte(payload.Message), &ctl); err != nil {
+		logger.L().Warn("Invalid profile control message", "err", err)
+		return
+	}
+	switch ctl.Type {
+	case profileType:
+		e.acceptProfile(payload.SenderID, ctl.Profile)
+	case avatarRequestType:
+		own, err := e.Profile()
+		if err != nil || own.AvatarHash == "" || own.AvatarHash != ctl.Hash {
+			return
+		}
+		if asset, ok := e.emojiCache.Get(own.AvatarHash); ok {
+			go e.sendControl(profileControl{Type: avatarType, Hash: asset.Hash, Data: asset.Data})
+		}
+	case avatarType:
+		e.acceptAvatar(payload.SenderID, ctl)
+	}
+}
+
+// acceptProfile caches a profile the sender signed for itself and adopts
+// its nickname
+func (e *ExecP2P) acceptProfile(senderID string, p *crypto.Profile) {
+	if p == nil || p.PeerID != senderID {
+		logger.L().Warn("Ignoring profile not sent by its owner", "peer", senderID)
+		return
+	}
+	if err := e.pqCrypto.VerifyProfile(p); err != nil {
+		logger.L().Warn("Rejected profile", "peer", senderID, "err", err)
+		return
+	}
+	if status, err := profile.CleanStatus(p.Status); err != nil || status != p.Status {
+		logger.L().Warn("Rejected profile with an invalid status text", "peer", senderID)
+		return
+	}
+	if p.AvatarHash != "" && !emoji.ValidHash(p.AvatarHash) {
+		logger.L().Warn("Rejected profile with an invalid avatar hash", "peer", senderID)
+		return
+	}
+	if err := e.profiles.cache.Put(p); err != nil {
+		if !errors.Is(err, profile.ErrStale) {
+			logger.L().Warn("Profile not cached", "peer", senderID, "err", err)
+		}
+		return
+	}
+	// notifies as well
+	e.SetPeerNickname(senderID, p.Nickname)
+
+	if p.AvatarHash != "" && !e.emojiCache.Has(p.AvatarHash) {
+		// the handler runs on the network's read loop; don't block it
+		go e.sendControl(profileControl{Type: avatarRequestType, Hash: p.AvatarHash})
+	}
+}
+
+// acceptAvatar caches an image that matches the avatar in the sender's
+// verified profile
+func (e *ExecP2P) acceptAvatar(senderID string, ctl profileControl) {
+	p, ok := e.PeerProfile(senderID)
+	if !ok || p.AvatarHash == "" || p.AvatarHash != ctl.Hash || e.emojiCache.Has(ctl.Hash) {
+		return
+	}
+	if _, err := e.emojiCache.Accept(ctl.Hash, ctl.Data); err != nil {
+		logger.L().Warn("Rejected avatar", "peer", senderID, "err", err)
+		return
+	}
+	e.notifyStatus()
+}
@@ -3,21 +3,45 @@ package app
 import (
 	"context"
 	"crypto/rand"
+	"crypto/tls"
 	"encoding/hex"
+	"errors"
 	"fmt"
 	mathrand "math/rand"
 	"net"
+	"sync"
+	"sync/atomic"
 	"time"
 
+	"execp2p/internal/archive"
+	"execp2p/internal/ban"
+	"execp2p/internal/clock"
 	"execp2p/internal/config"
+	"execp2p/internal/crash"
 	"execp2p/internal/crypto"
+	"execp2p/internal/diagnostics"
 	"execp2p/internal/discovery"
+	"execp2p/internal/emoji"
+	"execp2p/internal/history"
 	"execp2p/internal/logger"
+	"execp2p/internal/media"
 	"execp2p/internal/network"
+	"execp2p/internal/outbox"
+	"execp2p/internal/rejoin"
 	"execp2p/internal/room"
+	"execp2p/internal/roster"
+	"execp2p/internal/storage"
+	"execp2p/internal/trust"
 	"execp2p/internal/types"
+	"execp2p/internal/webhook"
+	"execp2p/internal/xmpp"
+
+	"github.com/anacrolix/dht/v2"
 )
 
+// roomDescription is the description of the rooms we create
+const roomDescription = "Post-quantum encrypted chat room"
+
 // ExecP2P is the main application state
 type ExecP2P struct {
 	config      *config.Config
@@ -29,26 +53,221 @@ type ExecP2P struct {
 	network  network.Network
 	// Pole gui zostało usunięte - GUI jest inicjalizowane w main.go
 
+	// where the identity keys live (keystore or ephemeral)
+	identity identityState
+
+	// encrypted local database, unlocked with the identity keystore
+	db *storage.DB
+
+	// our transport certificate, kept for the identity, see certificate.go
+	certificate tls.Certificate
+
+	// pinned peer fingerprints (TOFU) and alerts about changed ones
+	trust              *trust.Store
+	fingerprintChanges chan FingerprintChange
+	// peers refused after a failed security check, see quarantine.go
+	quarantineNotices chan trust.Quarantine
+
+	// host-side compliance archive and the room's archiving label
+	archive        *archive.Exporter
+	archiveNotices chan ArchiveStatus
+
+	// local webhook told about room events, nil when not configured
+	webhook *webhook.Hook
+
+	// host-side mirror of the room in an XMPP MUC, see xmpp.go
+	gateway      *xmpp.Gateway
+	gatewaySince time.Time
+
+	// answers to commands sent in the room
+	bot *bot
+
+	// encrypted local message history, nil when switched off
+	history *history.Store
+	// history pulled from another device of ours
+	historySync historySync
+	// the other devices of our identity, see device.go
+	devices *devices
+
+	// offline delivery through a relay mailbox
+	mailbox *mailboxState
+
+	// pictures and voice messages by media ID, and
+	// callers waiting for a requested original
+	media        *media.Store
+	mediaWaiters mediaWaiters
+
+	// voice messages recorded and played natively
+	voice *voiceState
+
+	// files, media and history syncs in progress
+	transfers *transfers
+
+	// access keys rotated by the room host, for the GUI
+	accessKeyNotices chan AccessKeyRotation
+
+	// key epoch changes after peers left, for the GUI
+	rekeyNotices chan network.RekeyEvent
+
+	// removals from the room by its host, for the GUI
+	kickNotices chan Kick
+
+	// peers that went away and why, for the GUI
+	departureNotices chan Departure
+
+	// peers that went silent or were heard from again, for the GUI
+	livenessNotices chan Liveness
+
+	// identities banned from the rooms we host, and bans announced to us
+	bans       *ban.List
+	banNotices chan BanChange
+
+	// roles the host granted in the current room
+	roles *roleState
+
+	// changes of the network status or the member list, for the GUI
+	statusNotices chan struct{}
+
+	// messages sent while no peer could take them, per room
+	outbox *outbox.Outbox
+	// rooms to enter again at startup
+	savedRooms *rejoin.List
+
+	// room members and their nicknames
+	roster *roster.Roster
+
+	// the room's custom shortcodes and their images, cached by hash
+	shortcodes       *emoji.Registry
+	emojiCache       *emoji.Cache
+	shortcodeNotices chan struct{}
+
+	// our signed profile and the verified ones of peers, by fingerprint
+	profiles *profileState
+
+	// online, away or do not disturb, ours and the peers'
+	presence *presenceState
+
+	// peers pinned since the current room was entered; their pins are kept
+	// in memory only if the room turns out to be incognito
+	sessionPins map[string]struct{}
+	pinsMu      sync.Mutex
+
+	// when the peer last failed a reachability check (unix nanos, 0 = ok)
+	degradedAt atomic.Int64
+
+	// whether the access key was refused, the room was full, or the host
+	// speaks no protocol version we do, since the room was entered
+	accessDenied atomic.Bool
+	roomFull     atomic.Bool
+	incompatible atomic.Bool
+	// whether the host reported an error connecting again won't fix
+	// (network.Retryable), since the room was entered
+	noRetry atomic.Bool
+	// why the host turned us away, removed us or closed the room since we
+	// last joined one; kept after leaving, for WaitForPeer
+	closeReason atomic.Pointer[error]
+
+	// why the host of a room we joined turned us away, for the GUI
+	refusalNotices chan error
+
+	// the transport's errors, for the GUI
+	networkErrors chan error
+
+	// when the current room closes by itself, and its end, see expiry.go
+	lifetime      lifetime
+	closedNotices chan RoomClosed
+
+	// how the room's host was reached, empty when we host
+	joinMethod string
+	// result of the last NAT check
+	nat natState
+
+	// host-side pacing of discovery announcements by room occupancy
+	cadence *discovery.Cadence
+	// the room's context for announcing, and what stops the announcers,
+	// so a reload can restart them
+	announceCtx    context.Context
+	stopAnnouncing context.CancelFunc
+
+	// where ReloadConfig reads the configuration and UpdateSettings writes
+	// it; reloads run one at a time
+	configFile   string
+	configSource func() (*config.Config, error)
+	// the configuration last applied, with the sections waiting for a restart
+	loadedConfig *config.Config
+	reloadMu     sync.Mutex
+
+	// everyone reading incoming messages (GUI, library users)
+	subscriptions subscriptions
+	// chat messages received since the room was last read, see unread.go
+	unread atomic.Int64
+
+	// panics in our goroutines, and what stops reporting them to us, see
+	// crash.go
+	crashNotices chan Crash
+	stopCrashes  func()
+
+	// the sessions of every room we are in, see session.go
+	sessions *sessionSet
+
+	// creates the transport of a room, see SetNetworkFactory
+	newNetwork network.Factory
+	// drives the app's schedules, see SetClock
+	clock clock.Clock
+
 	// runtime state
 	isRunning  bool
 	listenPort int
 
 	// sync
 	stopChan chan struct{}
+	// guards network, currentRoom, pqCrypto, stopChan and isRunning, which
+	// entering and leaving a room replace while the GUI reads them
+	roomMu sync.RWMutex
+	// the room's goroutines; reset waits for them before clearing the room
+	handlers sync.WaitGroup
 }
 
 // NewExecP2P creates a new ExecP2P instance
 func NewExecP2P(cfg *config.Config) (*ExecP2P, error) {
-	// generate a random peer ID for this session
-	peerID, err := generatePeerID()
+	// set up post-quantum crypto with our (possibly persistent) identity
+	pqCrypto, identity, err := loadIdentity(cfg)
+	if err != nil {
+		return nil, fmt.Errorf("failed to initialize cryptography: %w", err)
+	}
+	pqCrypto.SetKeyRotationInterval(cfg.Crypto.KeyRotationInterval)
+	if len(cfg.Discovery.STUNServers) > 0 {
+		discovery.StunServers = cfg.Discovery.STUNServers
+	}
+	newNetwork, err := networkFactory(cfg)
+	if err != nil {
+		return nil, fmt.Errorf("failed to set up the transport: %w", err)
+	}
+
+	// the peer ID is stable for a persistent identity, random otherwise
+	peerID, err := loadPeerID(cfg, identity.persistent)
 	if err != nil {
 		return nil, fmt.Errorf("failed to generate peer ID: %w", err)
 	}
 
-	// set up post-quantum crypto
-	pqCrypto, err := crypto.NewPQCrypto()
+	trustStore, err := openTrustStore(cfg, identity.persistent)
 	if err != nil {
-		return nil, fmt.Errorf("failed to initialize cryptography: %w", err)
+		return nil, err
+	}
+
+	db, err := openStorage(cfg, identity)
+	if err != nil {
+		return nil, err
+	}
+
+	certificate, err := loadCertificate(db, cfg.Network.TLSKey)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create TLS certificate: %w", err)
+	}
+
+	hook, err := openWebhook(cfg)
+	if err != nil {
+		return nil, err
 	}
 
 	// find a port we can use
@@ -57,13 +276,63 @@ func NewExecP2P(cfg *config.Config) (*ExecP2P, error) {
 		return nil, fmt.Errorf("failed to find available port: %w", err)
 	}
 
-	return &ExecP2P{
-		config:     cfg,
-		peerID:     peerID,
-		pqCrypto:   pqCrypto,
-		listenPort: listenPort,
-		stopChan:   make(chan struct{}),
-	}, nil
+	e := &ExecP2P{
+		config:      cfg,
+		peerID:      peerID,
+		pqCrypto:    pqCrypto,
+		identity:    identity,
+		db:          db,
+		certificate: certificate,
+		trust:       trustStore,
+		history:     openHistory(cfg, db),
+		mailbox:     openMailbox(cfg, db),
+		media:       openMedia(cfg, db),
+		voice:       newVoice(cfg),
+		webhook:     hook,
+		listenPort:  listenPort,
+		stopChan:    make(chan struct{}),
+
+		fingerprintChanges: make(chan FingerprintChange, 8),
+		quarantineNotices:  make(chan trust.Quarantine, 8),
+		archiveNotices:     make(chan ArchiveStatus, 8),
+		accessKeyNotices:   make(chan AccessKeyRotation, 4),
+		rekeyNotices:       make(chan network.RekeyEvent, 8),
+		kickNotices:        make(chan Kick, 4),
+		departureNotices:   make(chan Departure, 8),
+		livenessNotices:    make(chan Liveness, 8),
+		refusalNotices:     make(chan error, 4),
+		networkErrors:      make(chan error, 8),
+		closedNotices:      make(chan RoomClosed, 4),
+		crashNotices:       make(chan Crash, 4),
+		newNetwork:         newNetwork,
+		clock:              clock.Real,
+		bans:               newBans(db),
+		banNotices:         make(chan BanChange, 8),
+		roles:              newRoles(),
+		roster:             roster.New(),
+		shortcodes:         emoji.NewRegistry(),
+		emojiCache:         newEmojiCache(db),
+		outbox:             newOutbox(db),
+		savedRooms:         newSavedRooms(db),
+		profiles:           newProfiles(db),
+		presence:           newPresence(),
+		shortcodeNotices:   make(chan struct{}, 1),
+		statusNotices:      make(chan struct{}, 1),
+		sessionPins:        make(map[string]struct{}),
+		historySync:        historySync{notices: make(chan HistorySyncResult, 4)},
+		devices:            loadDevices(cfg, identity.persistent),
+		transfers:          newTransfers(),
+		bot:                newBot(cfg.Bot),
+	}
+	e.sessions = &sessionSet{all: []*ExecP2P{e}}
+	e.registerBuiltinCommands()
+	e.registerGauges()
+	e.watchCrashes()
+	e.startContactMe()
+	if cfg.Room.Nickname != "" {
+		e.roster.SetNickname(peerID, cfg.Room.Nickname)
+	}
+	return e, nil
 }
 
 // StartGUILifecycle starts the new GUI-driven application flow
@@ -75,37 +344,64 @@ func (e *ExecP2P) StartGUILifecycle(ctx context.Context) error {
 
 // CreateRoom creates a new chat room and starts listening
 func (e *ExecP2P) CreateRoom(ctx context.Context) (*types.CreateRoomResult, error) {
+	return e.CreateRoomWithOptions(ctx, e.DefaultRoomOptions())
+}
+
+// CreateRoomWithOptions creates a new chat room with the given options and starts listening
+func (e *ExecP2P) CreateRoomWithOptions(ctx context.Context, opts RoomOptions) (*types.CreateRoomResult, error) {
 	// Tworzymy pokój jako prywatny (z kluczem dostępu)
-	newRoom, err := room.NewRoom("ExecP2P Chat", "Post-quantum encrypted chat room", e.config.Network.MaxPeers, true)
+	newRoom, err := room.NewRoom("ExecP2P Chat", roomDescription, e.config.Network.MaxPeers, true)
 	if err != nil {
 		return nil, fmt.Errorf("failed to create room: %w", err)
 	}
+	return e.hostRoom(ctx, newRoom, opts)
+}
+
+// hostRoom starts hosting newRoom, new or one we created before
+func (e *ExecP2P) hostRoom(ctx context.Context, newRoom *room.Room, opts RoomOptions) (*types.CreateRoomResult, error) {
+	if opts.Incognito {
+		newRoom.Incognito = true
+		e.enterIncognito(newRoom.ID)
+	}
 
 	// Ustawiamy port nasłuchiwania w obiekcie pokoju
 	newRoom.ListenPort = e.listenPort
 	logger.L().Info("Utworzono pokój z portem nasłuchiwania", "port", e.listenPort)
 
+	e.roomMu.Lock()
 	e.currentRoom = newRoom
+	e.roomMu.Unlock()
+	e.lifetime.reset(newRoom.ID, opts)
 
 	if err := e.initializeComponents(ctx, true, ""); err != nil {
 		return nil, fmt.Errorf("failed to initialize components: %w", err)
 	}
 
+	// archiving (if configured) and incognito mode are labelled in the signed room metadata
+	if qnet, ok := e.network.(*network.QuicNetwork); ok {
+		if err := e.publishRoomMetadata(qnet); err != nil {
+			return nil, err
+		}
+	}
+
 	if err := e.startServices(ctx); err != nil {
 		return nil, fmt.Errorf("failed to start services: %w", err)
 	}
 
+	e.joinMethod = ""
+	diagnostics.Inc(diagnostics.RoomCreated)
+
 	// start background handlers now that room exists
-	go e.handleMessages(ctx)
-	go e.handlePeerEvents(ctx)
-	go e.handleSecurityEvents(ctx)
-	go e.handleNetworkErrors(ctx)
+	e.startHandlers(ctx)
+	stop := e.stopChan
+	e.goHandler(func() { e.watchLifetime(ctx, newRoom.ID, stop) })
 
 	// Zwróć ID pokoju i klucz dostępu oraz informację o porcie
 	return &types.CreateRoomResult{
 		RoomID:     newRoom.ID,
 		AccessKey:  newRoom.AccessKey,
 		ListenPort: e.listenPort,
+		Incognito:  newRoom.Incognito,
 	}, nil
 }
 
@@ -125,12 +421,26 @@ func (e *ExecP2P) JoinRoom(ctx context.Context, roomID string, remoteAddr string
 	wantedAccessKey := accessKey
 
 	// Tworzymy obiekt pokoju z kluczem dostępu
+	e.roomMu.Lock()
 	e.currentRoom = &room.Room{
 		ID:        wantedRoomID,
 		Name:      "ExecP2P E2E Chat",
 		MaxPeers:  e.config.Network.MaxPeers,
 		IsPrivate: true,
 		AccessKey: wantedAccessKey,
+		Incognito: e.config.Room.Incognito,
+	}
+	e.roomMu.Unlock()
+	e.accessDenied.Store(false)
+	e.roomFull.Store(false)
+	e.incompatible.Store(false)
+	e.noRetry.Store(false)
+	e.closeReason.Store(nil)
+	e.lifetime.reset(roomID, RoomOptions{})
+	e.resetSessionPins()
+	e.shortcodes.Replace(nil)
+	if e.currentRoom.Incognito {
+		e.enterIncognito(roomID)
 	}
 
 	// Jeśli podano konkretny adres, spróbuj połączyć się bezpośrednio
@@ -139,27 +449,32 @@ func (e *ExecP2P) JoinRoom(ctx context.Context, roomID string, remoteAddr string
 
 		// Ustawiamy isListener=false, ponieważ dołączamy do istniejącego pokoju
 		if err := e.initializeComponents(ctx, false, remoteAddr); err != nil {
-			e.currentRoom = nil // Resetujemy pokój w przypadku błędu
-			return fmt.Errorf("błąd inicjalizacji połączenia: %w", err)
+			e.abandonJoin() // Resetujemy pokój w przypadku błędu
+			diagnostics.RecordJoin(diagnostics.JoinDirect, false)
+			return transportError(fmt.Errorf("błąd inicjalizacji połączenia: %w", err))
 		}
 
 		// Próba uruchomienia usług, które ustanowią połączenie
 		if err := e.startServices(ctx); err != nil {
 			// Sprzątamy po nieudanej próbie
-			if e.network != nil {
-				e.network.Stop()
-				e.network = nil
-			}
-			e.currentRoom = nil
-			return fmt.Errorf("błąd uruchamiania usług sieciowych: %w", err)
+			e.abandonJoin()
+			diagnostics.RecordJoin(diagnostics.JoinDirect, false)
+			return transportError(fmt.Errorf("błąd uruchamiania usług sieciowych: %w", err))
 		}
+		diagnostics.RecordJoin(diagnostics.JoinDirect, true)
+		e.joinMethod = diagnostics.JoinDirect
 
 		// Sprawdź czy faktycznie połączyliśmy się z pokojem o właściwym ID
 		// Ta weryfikacja musi być wykonana po nawiązaniu połączenia, gdy wymiana
 		// kluczy jest zakończona
-		go func() {
+		stop := e.stopChan
+		e.goHandler(func() {
 			// Daj trochę czasu na ustanowienie połączenia i wymianę danych
-			time.Sleep(2 * time.Second)
+			select {
+			case <-time.After(2 * time.Second):
+			case <-stop:
+				return
+			}
 
 			// Czy mamy aktywne połączenie?
 			if e.network == nil {
@@ -180,79 +495,121 @@ func (e *ExecP2P) JoinRoom(ctx context.Context, roomID string, remoteAddr string
 			} else {
 				logger.L().Info("Poprawnie dołączono do pokoju", "room_id", wantedRoomID)
 			}
-		}()
+		})
 
 		// Uruchom obsługę wiadomości i zdarzeń
-		go e.handleMessages(ctx)
-		go e.handlePeerEvents(ctx)
-		go e.handleSecurityEvents(ctx)
-		go e.handleNetworkErrors(ctx)
+		e.startHandlers(ctx)
 
 		return nil
 	}
 
 	// W przeciwnym razie używamy zaawansowanej strategii łączenia
-	return e.JoinRoomWithFallback(ctx, roomID, accessKey)
+	if err := e.JoinRoomWithFallback(ctx, roomID, accessKey); err != nil {
+		e.abandonJoin()
+		return err
+	}
+	return nil
 }
 
 // JoinRoomWithFallback implementuje wielopoziomową strategię łączenia
 // z automatycznym fallback do różnych metod
 func (e *ExecP2P) JoinRoomWithFallback(ctx context.Context, roomID string, accessKey string) error {
+	e.resetSessionPins()
+	e.lifetime.reset(roomID, RoomOptions{})
+	e.shortcodes.Replace(nil)
+	if e.config.Room.Incognito {
+		e.enterIncognito(roomID)
+	}
 	logger.L().Info("Rozpoczynam zaawansowaną procedurę łączenia z pokojem", "room_id", roomID)
 
+	// libp2p (DHT i mDNS) i WebRTC (SDP przez serwer sygnalizacyjny) same
+	// szukają gospodarza po ID pokoju
+	switch e.config.Network.Transport {
+	case "libp2p":
+		return e.joinByRoomID(ctx, network.Libp2pRoomAddr, diagnostics.JoinLibp2p)
+	case "webrtc":
+		return e.joinByRoomID(ctx, network.WebRTCRoomAddr, diagnostics.JoinWebRTC)
+	}
+
 	// 2. Najpierw spróbuj autodetekcji przez broadcast, mDNS i DHT (w sieci lokalnej)
 	// Jest to preferowana metoda, która automatycznie dopasuje port nasłuchujący
 	if addr, err := e.tryLocalNetworkDiscovery(ctx, roomID); err == nil {
 		logger.L().Info("Połączono przez autodetekcję w sieci lokalnej", "addr", addr)
 
 		if err := e.initializeComponents(ctx, false, addr); err != nil {
-			return fmt.Errorf("błąd inicjalizacji komponentów: %w", err)
+			diagnostics.RecordJoin(diagnostics.JoinDiscovery, false)
+			return transportError(fmt.Errorf("błąd inicjalizacji komponentów: %w", err))
 		}
 
 		if err := e.startServices(ctx); err != nil {
-			return fmt.Errorf("błąd uruchamiania usług: %w", err)
+			diagnostics.RecordJoin(diagnostics.JoinDiscovery, false)
+			return transportError(fmt.Errorf("błąd uruchamiania usług: %w", err))
 		}
+		diagnostics.RecordJoin(diagnostics.JoinDiscovery, true)
+		e.joinMethod = diagnostics.JoinDiscovery
 
-		go e.handleMessages(ctx)
-		go e.handlePeerEvents(ctx)
-		go e.handleSecurityEvents(ctx)
-		go e.handleNetworkErrors(ctx)
+		e.startHandlers(ctx)
 
 		return nil
 	}
+	diagnostics.RecordJoin(diagnostics.JoinDiscovery, false)
 
 	// 1. Próba lokalnego połączenia przez localhost jako druga opcja
 	// To pomaga przy uruchamianiu wielu instancji na jednym komputerze
 	if localAddr, err := e.tryLocalConnections(ctx, roomID); err == nil {
 		logger.L().Info("Połączono lokalnie", "addr", localAddr)
+		diagnostics.RecordJoin(diagnostics.JoinLocalhost, true)
+		e.joinMethod = diagnostics.JoinLocalhost
 		return nil
 	}
+	diagnostics.RecordJoin(diagnostics.JoinLocalhost, false)
 
 	// 3. Spróbuj połączenia przez serwer sygnalizacyjny i UDP hole punching
-	signalingConfig := discovery.NewSignalingConfig("")
+	signalingConfig := discovery.NewSignalingConfig(e.config.Discovery.SignalingServer)
 	if addr, err := e.trySignalingAndHolePunching(ctx, roomID, signalingConfig); err == nil {
 		logger.L().Info("Połączono przez hole punching", "addr", addr)
 
 		if err := e.initializeComponents(ctx, false, addr); err != nil {
-			return fmt.Errorf("błąd inicjalizacji komponentów: %w", err)
+			diagnostics.RecordJoin(diagnostics.JoinSignaling, false)
+			return transportError(fmt.Errorf("błąd inicjalizacji komponentów: %w", err))
 		}
 
 		if err := e.startServices(ctx); err != nil {
-			return fmt.Errorf("błąd uruchamiania usług: %w", err)
+			diagnostics.RecordJoin(diagnostics.JoinSignaling, false)
+			return transportError(fmt.Errorf("błąd uruchamiania usług: %w", err))
 		}
+		diagnostics.RecordJoin(diagnostics.JoinSignaling, true)
+		e.joinMethod = diagnostics.JoinSignaling
 
-		go e.handleMessages(ctx)
-		go e.handlePeerEvents(ctx)
-		go e.handleSecurityEvents(ctx)
-		go e.handleNetworkErrors(ctx)
+		e.startHandlers(ctx)
 
 		return nil
 	}
+	diagnostics.RecordJoin(diagnostics.JoinSignaling, false)
 
 	// 4. Ostateczność: przekazywanie przez TURN (nie zaimplementowane)
 	// W przyszłości można dodać kod do obsługi relayingu przez TURN
 
-	return fmt.Errorf("wszystkie metody połączenia zawiodły - spróbuj podać bezpośredni adres IP")
+	return discoveryError(fmt.Errorf("wszystkie metody połączenia zawiodły - spróbuj podać bezpośredni adres IP"))
+}
+
+// joinByRoomID dołącza przez transport, który sam znajduje gospodarza po ID
+// pokoju; addr mówi mu, że ma go szukać
+func (e *ExecP2P) joinByRoomID(ctx context.Context, addr, method string) error {
+	if err := e.initializeComponents(ctx, false, addr); err != nil {
+		diagnostics.RecordJoin(method, false)
+		return transportError(fmt.Errorf("błąd inicjalizacji komponentów: %w", err))
+	}
+	if err := e.startServices(ctx); err != nil {
+		diagnostics.RecordJoin(method, false)
+		return discoveryError(fmt.Errorf("nie znaleziono gospodarza przez %s: %w", method, err))
+	}
+	diagnostics.RecordJoin(method, true)
+	e.joinMethod = method
+
+	e.startHandlers(ctx)
+
+	return nil
 }
 
 // tryLocalConnections próbuje nawiązać połączenie z lokalnymi instancjami
@@ -272,15 +629,14 @@ func (e *ExecP2P) tryLocalConnections(ctx context.Context, roomID string) (strin
 
 		if err := e.startServices(ctx); err != nil {
 			e.network.Stop()
+			e.roomMu.Lock()
 			e.network = nil
+			e.roomMu.Unlock()
 			continue
 		}
 
 		// Sukces! Uruchom usługi obsługi
-		go e.handleMessages(ctx)
-		go e.handlePeerEvents(ctx)
-		go e.handleSecurityEvents(ctx)
-		go e.handleNetworkErrors(ctx)
+		e.startHandlers(ctx)
 
 		logger.L().Info("Udało się połączyć lokalnie", "room_id", roomID, "addr", localAddr)
 		return localAddr, nil
@@ -294,13 +650,18 @@ func (e *ExecP2P) tryLocalNetworkDiscovery(ctx context.Context, roomID string) (
 	logger.L().Info("Próba wykrycia urządzeń w sieci lokalnej", "room_id", roomID)
 
 	// Utwórz serwer DHT
-	dhtServer, err := discovery.StartDHTNode(e.config.Discovery.BTDHTPort)
-	if err != nil {
-		logger.L().Warn("Nie udało się uruchomić węzła DHT", "err", err)
+	var dhtServer *dht.Server
+	if e.config.Discovery.EnableBTDHT {
+		var err error
+		if dhtServer, err = discovery.StartDHTNode(e.config.Discovery.BTDHTPort); err != nil {
+			logger.L().Warn("Nie udało się uruchomić węzła DHT", "err", err)
+		} else {
+			defer dhtServer.Close()
+		}
 	}
 
-	// Uruchom autodetekcję z wszystkimi dostępnymi metodami
-	addr, err := discovery.AutoDiscovery(ctx, roomID, dhtServer)
+	// Uruchom autodetekcję z wszystkimi włączonymi metodami
+	addr, err := discovery.AutoDiscovery(ctx, roomID, dhtServer, e.discoveryMethods())
 	if err != nil {
 		return "", fmt.Errorf("autodetekcja nie powiodła się: %w", err)
 	}
@@ -308,6 +669,12 @@ func (e *ExecP2P) tryLocalNetworkDiscovery(ctx context.Context, roomID string) (
 	return addr, nil
 }
 
+// discoveryMethods returns the local discovery methods switched on
+func (e *ExecP2P) discoveryMethods() discovery.Methods {
+	d := e.config.Discovery
+	return discovery.Methods{MDNS: d.EnableMDNS, DHT: d.EnableBTDHT, Broadcast: d.EnableBroadcast}
+}
+
 // trySignalingAndHolePunching próbuje łączenia przez serwer sygnalizacyjny i hole punching
 func (e *ExecP2P) trySignalingAndHolePunching(ctx context.Context, roomID string, config *discovery.SignalingServerConfig) (string, error) {
 	logger.L().Info("Próba połączenia przez serwer sygnalizacyjny", "room_id", roomID)
@@ -337,19 +704,55 @@ func (e *ExecP2P) trySignalingAndHolePunching(ctx context.Context, roomID string
 	return "", fmt.Errorf("nie udało się nawiązać połączenia przez hole punching")
 }
 
-// Close shuts down the application
+// Close shuts down the application: every room is left, kept to enter again
+// at the next start, and the shared state closed. Closing another session
+// only leaves its room.
 func (e *ExecP2P) Close() {
-	if !e.isRunning {
+	if e.sessions.first() != e {
+		e.leaveRoom()
 		return
 	}
+	// a remote wipe in progress is not cut short by the exit
+	e.devices.wiping.Wait()
+	if e.shutdown() {
+		e.subscriptions.closeAll()
+	}
+}
 
-	e.isRunning = false
-	close(e.stopChan)
+// shutdown closes the rooms and the shared state, keeping the subscribers;
+// it reports false if that was done already
+func (e *ExecP2P) shutdown() bool {
+	if !e.sessions.close() {
+		return false
+	}
+	e.leaveOthers()
+	e.leave()
+	// the room's goroutines may still use what is closed below
+	e.handlers.Wait()
+
+	e.stopCrashes()
+	e.stopContactMe()
+	e.voice.close()
+	e.closeWebhook()
+	e.closeStorage()
+	return true
+}
 
-	// GUI handling now done in the wailsbridge
+// SetNetworkFactory replaces the transport of the rooms created or joined
+// from now on. It is for integration tests: the NewNetwork of a shared
+// network.MemorySwitch runs several apps in one process without sockets.
+func (e *ExecP2P) SetNetworkFactory(f network.Factory) {
+	e.newNetwork = f
+}
 
-	if e.network != nil {
-		e.network.Stop()
+// SetClock runs the app's schedules on c: the key rotation check, the
+// search for a missing host, rejoin pauses, keep-alives and mailbox polls.
+// It is for tests, which move a clock.Fake forward instead of waiting.
+// The transport's own timeouts keep the wall clock.
+func (e *ExecP2P) SetClock(c clock.Clock) {
+	e.clock = c
+	if e.pqCrypto != nil {
+		e.pqCrypto.SetClock(c)
 	}
 }
 
@@ -358,7 +761,7 @@ func (e *ExecP2P) initializeComponents(ctx context.Context, isListener bool, rem
 	var err error
 
 	// Inicjalizacja sieci z przekazaniem dodatkowych parametrów
-	net, err := network.NewNetwork(
+	net, err := e.newNetwork(
 		ctx,
 		e.peerID,
 		e.currentRoom.ID,
@@ -372,7 +775,32 @@ func (e *ExecP2P) initializeComponents(ctx context.Context, isListener bool, rem
 	}
 
 	// Ustaw sieć
+	e.roomMu.Lock()
 	e.network = net
+	e.roomMu.Unlock()
+
+	// trust-on-first-use check of every peer's identity
+	if qnet, ok := net.(*network.QuicNetwork); ok {
+		qnet.SetPeerVerifier(e.verifyPeerIdentity)
+		qnet.SetCertificate(e.certificate)
+		qnet.SetCertVerifier(e.verifyPeerCertificate)
+		qnet.SetCertMismatchHandler(e.onCertMismatch)
+		qnet.SetQuarantined(e.quarantinedIDs())
+		qnet.SetSenderPolicy(e.allowSender)
+		qnet.SetControlHandler(e.handleControlMessage)
+		qnet.SetRekeyHandler(e.onRekey)
+		qnet.SetPeerHandler(e.onPeerEvent)
+		qnet.SetLocalNickname(e.Nickname())
+		qnet.SetMessageObserver(e.observeMessage)
+		qnet.SetMediaHandler(e.receiveMedia)
+		qnet.SetZeroRTT(e.config.Network.ZeroRTT)
+		if !isListener {
+			qnet.SetRoomMetadataHandler(e.onRoomMetadata)
+		} else {
+			qnet.SetBanned(e.bans.Fingerprints(e.currentRoom.ID))
+			qnet.SetMaxPeers(e.currentRoom.MaxPeers)
+		}
+	}
 
 	// Dostosuj strukturę sieci, aby zawierała klucz dostępu do pokoju
 	if qnet, ok := net.(*network.QuicNetwork); ok && e.currentRoom != nil {
@@ -388,7 +816,10 @@ func (e *ExecP2P) initializeComponents(ctx context.Context, isListener bool, rem
 
 // start up networking and discovery
 func (e *ExecP2P) startServices(ctx context.Context) error {
+	e.roomMu.Lock()
 	e.isRunning = true
+	e.roomMu.Unlock()
+	e.notifyStatus()
 
 	if err := e.network.Start(ctx); err != nil {
 		return fmt.Errorf("failed to start network transport: %w", err)
@@ -402,61 +833,146 @@ func (e *ExecP2P) startServices(ctx context.Context) error {
 		// Log the listen port dla łatwiejszego debugowania
 		logger.L().Info("Listening for connections", "port", listenPort, "room_id", roomID)
 
+		e.announceCtx = ctx
+		if err := e.startAnnouncing(); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// startAnnouncing starts the host-side discovery methods switched on, after
+// stopping the ones running
+func (e *ExecP2P) startAnnouncing() error {
+	if e.stopAnnouncing != nil {
+		e.stopAnnouncing()
+	}
+	ctx, cancel := context.WithCancel(e.announceCtx)
+	e.stopAnnouncing = cancel
+	roomID := e.currentRoom.ID
+	listenPort := e.listenPort
+
+	// announce aggressively while the room is empty, less (or not at all) once someone joined
+	cadence, err := discovery.NewCadence(e.config.Discovery.WhenOccupied,
+		e.config.Discovery.AnnounceInterval, e.config.Discovery.OccupiedInterval)
+	if err != nil {
+		cancel()
+		return err
+	}
+	cadence.SetOccupied(len(e.network.Peers()) > 0)
+	e.cadence = cadence
+
+	if e.config.Discovery.EnableBTDHT {
 		// Start DHT node with a random port offset to avoid conflicts with multiple instances
 		dhtPort := e.config.Discovery.BTDHTPort + mathrand.Intn(10)
 		dhtServer, err := discovery.StartDHTNode(dhtPort)
 		if err != nil {
 			logger.L().Warn("DHT node startup failed", "err", err)
+		} else {
+			context.AfterFunc(ctx, dhtServer.Close)
+			go discovery.AnnounceDHT(ctx, dhtServer, roomID, listenPort, cadence)
 		}
-
-		go discovery.Advertise(ctx, roomID, listenPort)
+	}
+	if e.config.Discovery.EnableMDNS {
+		go discovery.Advertise(ctx, roomID, listenPort, cadence)
+	}
+	if e.config.Discovery.SignalingServer != "" {
+		signaling := discovery.NewSignalingConfig(e.config.Discovery.SignalingServer)
+		go discovery.AnnounceSignaling(ctx, signaling, roomID, listenPort, cadence)
+	}
+	if e.config.Discovery.EnableBroadcast {
 		// Use dynamic port for discovery responder to avoid conflicts
-		go discovery.StartDiscoveryResponder(ctx, roomID, listenPort)
-		if dhtServer != nil {
-			go discovery.AnnounceDHT(ctx, dhtServer, roomID, listenPort)
+		if err := discovery.StartDiscoveryResponder(ctx, roomID, listenPort); err != nil {
+			logger.L().Warn("Broadcast discovery responder failed", "err", err)
 		}
 	}
-
 	return nil
 }
 
+// startHandlers starts the room's goroutines on its transport and stop
+// channel as they are now: leaving and entering the next room replace both
+// while a goroutine may still be on its way out
+func (e *ExecP2P) startHandlers(ctx context.Context) {
+	e.roomMu.RLock()
+	transport, stop := e.network, e.stopChan
+	e.roomMu.RUnlock()
+	e.goHandler(func() { e.handleMessages(ctx, transport, stop) })
+	e.goHandler(func() { e.handlePeerEvents(ctx, transport, stop) })
+	e.goHandler(func() { e.handleSecurityEvents(ctx, transport, stop) })
+	e.goHandler(func() { e.handleNetworkErrors(ctx, transport, stop) })
+}
+
+// goHandler runs fn as one of the room's goroutines
+func (e *ExecP2P) goHandler(fn func()) {
+	e.handlers.Add(1)
+	go func() {
+		defer e.handlers.Done()
+		fn()
+	}()
+}
+
 // handle receiving encrypted messages
-func (e *ExecP2P) handleMessages(ctx context.Context) {
-	receiveChan := e.network.GetIncomingMessages()
+func (e *ExecP2P) handleMessages(ctx context.Context, transport network.Network, stop <-chan struct{}) {
+	defer crash.Recover("app.handleMessages")
+	receiveChan := transport.GetIncomingMessages()
 	for {
 		select {
 		case <-ctx.Done():
 			return
-		case <-e.stopChan:
+		case <-stop:
 			return
-		case <-receiveChan:
-			// Messages will be handled by the wailsbridge event system
-			// to avoid circular dependencies
+		case msg, ok := <-receiveChan:
+			if !ok {
+				return
+			}
+			if msg != nil {
+				e.countUnread(msg)
+				e.subscriptions.publish(msg)
+			}
 		}
 	}
 }
 
 // handle peer connection events
-func (e *ExecP2P) handlePeerEvents(ctx context.Context) {
-	ticker := time.NewTicker(2 * time.Second)
+func (e *ExecP2P) handlePeerEvents(ctx context.Context, transport network.Network, stop <-chan struct{}) {
+	defer crash.Recover("app.handlePeerEvents")
+	ticker := e.clock.NewTicker(2 * time.Second)
 	defer ticker.Stop()
 
+	// messages parked for us while we were away
+	e.goHandler(func() { e.pollMailbox(ctx, stop) })
+	e.rememberRoom(true)
+
+	var peers map[string]struct{}
+	var rv rendezvous
 	for {
 		select {
 		case <-ctx.Done():
 			return
-		case <-e.stopChan:
+		case <-stop:
 			return
-		case <-ticker.C:
+		case <-ticker.C():
 			// Status updates are now handled via the wailsbridge event system
+			if e.cadence != nil {
+				e.cadence.SetOccupied(len(transport.Peers()) > 0)
+			}
+			e.announceMailbox()
+			e.checkIdle()
+			peers = e.notifyPeerChanges(peers)
+			e.syncGateway()
+			e.rememberRoom(false)
+			e.seekHost(ctx, &rv)
+			e.sendPendingWipes()
 		}
 	}
 }
 
 // handle security events and fingerprint displays
-func (e *ExecP2P) handleSecurityEvents(ctx context.Context) {
-	fingerprintTicker := time.NewTicker(60 * time.Second)
-	keyRotationCheckTicker := time.NewTicker(1 * time.Minute)
+func (e *ExecP2P) handleSecurityEvents(ctx context.Context, transport network.Network, stop <-chan struct{}) {
+	defer crash.Recover("app.handleSecurityEvents")
+	fingerprintTicker := e.clock.NewTicker(60 * time.Second)
+	keyRotationCheckTicker := e.clock.NewTicker(1 * time.Minute)
 	defer fingerprintTicker.Stop()
 	defer keyRotationCheckTicker.Stop()
 
@@ -466,26 +982,25 @@ func (e *ExecP2P) handleSecurityEvents(ctx context.Context) {
 		select {
 		case <-ctx.Done():
 			return
-		case <-e.stopChan:
+		case <-stop:
 			return
-		case <-fingerprintTicker.C:
+		case <-fingerprintTicker.C():
 			currentFingerprints := e.getPeerFingerprints()
 			if !equalStringMaps(lastShownFingerprints, currentFingerprints) && len(currentFingerprints) > 0 {
 				// Fingerprints will be shown via wailsbridge events
 				lastShownFingerprints = currentFingerprints
 			}
 
-		case <-keyRotationCheckTicker.C:
-			if e.network == nil {
-				continue
-			}
-			rotated, err := e.network.ForceKeyRotation()
+		case <-keyRotationCheckTicker.C():
+			rotated, err := transport.ForceKeyRotation()
 			if err != nil {
 				// Security messages handled via wailsbridge
 				logger.L().Error("Key rotation error", "err", err)
+				diagnostics.Inc(diagnostics.KeyRotationFailed)
 				continue
 			}
 			if rotated {
+				diagnostics.Inc(diagnostics.KeyRotation)
 				logger.L().Info("Forward secrecy: Keys rotated, re-establishing secure channels")
 			}
 		}
@@ -507,6 +1022,11 @@ func (e *ExecP2P) getPeerFingerprints() map[string]string {
 	return fingerprints
 }
 
+// PeerFingerprints returns the fingerprints of all verified peers by peer ID
+func (e *ExecP2P) PeerFingerprints() map[string]string {
+	return e.getPeerFingerprints()
+}
+
 // check if two string maps are the same
 func equalStringMaps(a, b map[string]string) bool {
 	if len(a) != len(b) {
@@ -573,44 +1093,49 @@ func isPortAvailable(port int) bool {
 
 // SendMessage sends a message over the network.
 func (e *ExecP2P) SendMessage(ctx context.Context, message string) error {
-	if e.network == nil {
+	return e.SendMessageWithID(ctx, crypto.NewMessageID(), message)
+}
+
+// SendMessageWithID sends a message under a given ID. Sending it again
+// after an error under the same ID can't show it twice.
+func (e *ExecP2P) SendMessageWithID(ctx context.Context, messageID, message string) error {
+	transport := e.state().network
+	if transport == nil {
 		return fmt.Errorf("not connected to a room")
 	}
-	return e.network.SendMessage(ctx, message)
+	if peerID := e.quarantinedPeer(); peerID != "" {
+		return fmt.Errorf("%w: %s", ErrPeerQuarantined, peerID)
+	}
+	// nobody is here: park the message for the peers we met in this room
+	if len(transport.Peers()) == 0 {
+		if parked, err := e.SendOffline(ctx, message); err != nil {
+			return err
+		} else if parked > 0 {
+			return nil
+		}
+	}
+	return transport.SendMessageWithID(ctx, messageID, message)
 }
 
 // GetPeerFingerprint returns our cryptographic fingerprint
 func (e *ExecP2P) GetPeerFingerprint() (string, error) {
-	if e.pqCrypto == nil {
+	pq := e.state().pqCrypto
+	if pq == nil {
 		return "", fmt.Errorf("crypto not initialized")
 	}
-	return e.pqCrypto.GetIdentityFingerprint()
+	return pq.GetIdentityFingerprint()
 }
 
 // GetRoomInfo returns info about the current room
 func (e *ExecP2P) GetRoomInfo() *room.Room {
-	return e.currentRoom
+	return e.state().room
 }
 
 // RegenerateRoomAccessKey tworzy nowy klucz dostępu dla bieżącego pokoju
+// i przekazuje go połączonym uczestnikom.
 // Może być wywołane tylko przez twórcę pokoju (isListener)
 func (e *ExecP2P) RegenerateRoomAccessKey() (string, error) {
-	// Sprawdź czy jesteśmy twórcą pokoju
-	if e.network == nil || !e.network.IsListener() {
-		return "", fmt.Errorf("tylko twórca pokoju może zregenerować klucz dostępu")
-	}
-
-	// Sprawdź czy mamy pokój
-	if e.currentRoom == nil {
-		return "", fmt.Errorf("nie jesteśmy połączeni z żadnym pokojem")
-	}
-
-	// Zregeneruj klucz
-	if err := e.currentRoom.RegenerateAccessKey(); err != nil {
-		return "", err
-	}
-
-	return e.currentRoom.AccessKey, nil
+	return e.RotateRoomAccessKey(false)
 }
 
 // GetListenPort returns the port we're listening on
@@ -621,71 +1146,91 @@ func (e *ExecP2P) GetListenPort() int {
 // GetNetworkAccess returns the network object for direct access to network functions
 // UWAGA: Ta metoda jest eksporterem prywatnego pola - używać ostrożnie!
 func (e *ExecP2P) GetNetworkAccess() network.Network {
-	return e.network
+	return e.state().network
 }
 
 // TryLocalNetworkDiscovery to publiczny wrapper dla metody prywatnej
 func (e *ExecP2P) TryLocalNetworkDiscovery(ctx context.Context, roomID string) (string, error) {
+	diagnostics.Inc(diagnostics.RoomFind)
 	return e.tryLocalNetworkDiscovery(ctx, roomID)
 }
 
+// GetDiagnostics returns the local usage and failure counters
+func (e *ExecP2P) GetDiagnostics() diagnostics.Snapshot {
+	return diagnostics.Default().Snapshot()
+}
+
 // GetNetworkStatus returns current network and encryption status
-func (e *ExecP2P) GetNetworkStatus() map[string]interface{} {
-	status := map[string]interface{}{
-		"peer_id":         e.peerID,
-		"listen_port":     e.listenPort,
-		"room_id":         "",
-		"connected_peers": 0,
-		"verified_peers":  0,
-		"e2e_encryption":  false,
-		"is_running":      e.isRunning,
-		"is_listener":     e.network != nil && e.network.IsListener(),
+func (e *ExecP2P) GetNetworkStatus() types.NetworkStatus {
+	st := e.state()
+	status := types.NetworkStatus{
+		PeerID:     e.peerID,
+		ListenPort: e.listenPort,
+		IsRunning:  st.running,
+		IsListener: st.network != nil && st.network.IsListener(),
+		Degraded:   e.ConnectionDegraded(),
 	}
 
-	if e.currentRoom != nil {
-		status["room_id"] = e.currentRoom.ID
+	if st.room != nil {
+		status.RoomID = st.room.ID
+		status.RoomName = st.room.Name
+		status.Role = string(e.Role())
+		if at := e.RoomClosesAt(); !at.IsZero() {
+			status.ClosesAt = at.Format(time.RFC3339)
+		}
 	}
 
-	if e.network != nil {
-		status["connected_peers"] = len(e.network.GetConnectedPeers())
+	if st.network != nil {
+		status.ConnectedPeers = len(st.network.Peers())
 	}
 
-	if e.pqCrypto != nil {
-		verifiedPeers := len(e.pqCrypto.GetVerifiedPeers())
-		status["verified_peers"] = verifiedPeers
+	if st.pqCrypto != nil {
+		status.VerifiedPeers = len(st.pqCrypto.GetVerifiedPeers())
 
 		// Pokój jest uważany za zaszyfrowany, gdy:
 		// 1. Mamy zweryfikowane peery (klasyczny przypadek e2e)
 		// 2. LUB gdy jesteśmy twórcą pokoju (network w trybie listener)
-		if verifiedPeers > 0 || (e.network != nil && e.network.IsListener()) {
-			status["e2e_encryption"] = true
-		}
+		status.E2EEncryption = status.VerifiedPeers > 0 || status.IsListener
 	}
 
 	return status
 }
 
 // GetSecuritySummary returns a summary of our security features
-func (e *ExecP2P) GetSecuritySummary() map[string]interface{} {
-	summary := map[string]interface{}{
-		"encryption_algorithms": map[string]string{
-			"key_exchange": "CRYSTALS-Kyber-1024",
-			"signatures":   "CRYSTALS-DILITHIUM-5",
-			"symmetric":    "ChaCha20-Poly1305",
+func (e *ExecP2P) GetSecuritySummary() types.SecuritySummary {
+	summary := types.SecuritySummary{
+		EncryptionAlgorithms: types.EncryptionAlgorithms{
+			KeyExchange: "CRYSTALS-Kyber-1024",
+			Signatures:  "CRYSTALS-DILITHIUM-5",
+			Symmetric:   "ChaCha20-Poly1305",
 		},
+		IdentityPersistent: e.identity.persistent,
+		PinnedPeers:        len(e.trust.List()),
+		RoomArchived:       e.ArchiveStatus().Archiving,
+		RequireVerified:    e.RequireVerified(),
+		Incognito:          e.IsIncognito(),
+		PeerFingerprints:   map[string]string{},
 	}
 	if e.pqCrypto != nil {
 		if fingerprint, err := e.pqCrypto.GetIdentityFingerprint(); err == nil {
-			summary["identity_fingerprint"] = fingerprint
+			summary.IdentityFingerprint = fingerprint
 		}
+		for _, peerID := range e.pqCrypto.GetVerifiedPeers() {
+			if fingerprint, err := e.pqCrypto.GetPeerFingerprint(peerID); err == nil {
+				summary.PeerFingerprints[peerID] = fingerprint
+			}
+		}
+	}
+	if e.identity.persistent {
+		summary.KeystoreProtection = e.identity.protection
 	}
 
 	// Dodaj informacje o pokoju, jeśli jesteśmy twórcą
 	if e.currentRoom != nil && e.network != nil && e.network.IsListener() {
-		summary["room_info"] = map[string]interface{}{
-			"room_id":    e.currentRoom.ID,
-			"access_key": e.currentRoom.AccessKey,
-			"is_private": e.currentRoom.IsPrivate,
+		summary.RoomInfo = &types.RoomInfo{
+			RoomID:    e.currentRoom.ID,
+			AccessKey: e.currentRoom.AccessKey,
+			IsPrivate: e.currentRoom.IsPrivate,
 		}
 	}
 
@@ -693,31 +1238,74 @@ func (e *ExecP2P) GetSecuritySummary() map[string]interface{} {
 }
 
 // handleNetworkErrors listens for async errors from the transport layer
-func (e *ExecP2P) handleNetworkErrors(ctx context.Context) {
-	if e.network == nil {
-		return
-	}
-	errChan := e.network.GetErrorChannel()
+func (e *ExecP2P) handleNetworkErrors(ctx context.Context, transport network.Network, stop <-chan struct{}) {
+	defer crash.Recover("app.handleNetworkErrors")
+	errChan := transport.GetErrorChannel()
+	listener := transport.IsListener()
 	for {
 		select {
 		case <-ctx.Done():
 			return
-		case <-e.stopChan:
+		case <-stop:
 			return
 		case err := <-errChan:
 			if err == nil {
 				continue
 			}
+			if errors.Is(err, network.ErrPeerLeft) {
+				// not an error; DepartureNotices tells
+				continue
+			}
 			// Network errors are logged and will be emitted via wailsbridge
-			logger.L().Error("Network error", "err", err)
+			logger.L().Error("Network error", "code", network.Code(err), "err", err)
+			if !listener && !network.Retryable(err) {
+				// finding the host again wouldn't help
+				e.noRetry.Store(true)
+			}
+			select {
+			case e.networkErrors <- err:
+			default:
+				// nobody is listening
+			}
+			switch {
+			case errors.Is(err, network.ErrAccessDenied):
+				e.accessDenied.Store(true)
+				e.forgetRoom()
+			case errors.Is(err, network.ErrRoomFull):
+				e.roomFull.Store(true)
+			case errors.Is(err, network.ErrIncompatibleVersion):
+				// the room stays saved: it can be entered after an update
+				e.incompatible.Store(true)
+			case errors.Is(err, network.ErrBanned):
+				e.forgetRoom()
+			case errors.Is(err, network.ErrRemoved):
+				// KickNotices tells, when the kick message came through
+				e.closeReason.Store(&err)
+				e.forgetRoom()
+				continue
+			case errors.Is(err, network.ErrRoomClosed):
+				e.closeReason.Store(&err)
+				// leaving waits for this goroutine
+				go e.roomClosedByHost()
+				continue
+			default:
+				continue
+			}
+			e.closeReason.Store(&err)
+			select {
+			case e.refusalNotices <- err:
+			default:
+				// nobody is listening
+			}
 		}
 	}
 }
 
 // IsListener returns true if the network is in listening mode
 func (e *ExecP2P) IsListener() bool {
-	if e.network == nil {
+	transport := e.state().network
+	if transport == nil {
 		return false
 	}
-	return e.network.IsListener()
+	return transport.IsListener()
 }
@@ -0,0 +1,158 @@
+package app
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"execp2p/internal/logger"
+	"execp2p/internal/network"
+	"execp2p/internal/trust"
+)
+
+// ErrPeerQuarantined is returned for messages to or from a peer held after a
+// failed security check, until the user accepts or rejects it
+var ErrPeerQuarantined = errors.New("peer is quarantined until the user accepts or rejects it")
+
+// quarantine holds a peer after a failed security check and alerts the user
+func (e *ExecP2P) quarantine(q trust.Quarantine) {
+	if q.Since.IsZero() {
+		q.Since = time.Now().UTC()
+	}
+	if err := e.trust.Quarantine(q); err != nil {
+		logger.L().Warn("Failed to save trust store", "err", err)
+	}
+	e.updateQuarantined()
+	logger.L().Warn("Peer quarantined", "peer", q.PeerID, "reason", q.Reason, "refused", q.Refused)
+	select {
+	case e.quarantineNotices <- q:
+	default:
+		logger.L().Warn("Quarantine alert dropped; nobody is listening")
+	}
+}
+
+// onCertMismatch is the network's CertMismatchHandler. The peer is
+// quarantined either way; with trust.strict_tls its connection is closed
+// and refused until the user decides, without it stays open but carries no
+// messages.
+func (e *ExecP2P) onCertMismatch(m network.CertMismatch) bool {
+	strict := e.config.Trust.StrictTLS
+	if !strict {
+		logger.L().Warn("TLS certificate mismatch tolerated; trust.strict_tls is off", "peer", m.PeerID)
+	}
+	e.quarantine(trust.Quarantine{
+		PeerID:      m.PeerID,
+		Fingerprint: m.Fingerprint,
+		Reason:      trust.ReasonCertMismatch,
+		Expected:    m.Announced,
+		Presented:   m.Presented,
+		Refused:     strict,
+	})
+	return !strict
+}
+
+// QuarantineNotices delivers the peers quarantined after a failed security
+// check
+func (e *ExecP2P) QuarantineNotices() <-chan trust.Quarantine {
+	return e.quarantineNotices
+}
+
+// QuarantinedPeers lists the peers held until the user decides about them
+func (e *ExecP2P) QuarantinedPeers() []trust.Quarantine {
+	return e.trust.QuarantinedPeers()
+}
+
+// AcceptPeer is the user's acceptance of a quarantined peer: a changed
+// identity or certificate is pinned in place of the old one and the
+// quarantine lifted. A certificate mismatch has nothing to pin; the peer's
+// next connection is checked again.
+func (e *ExecP2P) AcceptPeer(peerID string) error {
+	if peerID == "" {
+		return fmt.Errorf("peer ID is required")
+	}
+	q, ok := e.trust.Quarantined(peerID)
+	if !ok {
+		return fmt.Errorf("peer %s is not quarantined", peerID)
+	}
+
+	var err error
+	switch q.Reason {
+	case trust.ReasonIdentityChanged:
+		err = e.trust.Pin(peerID, q.Presented)
+	case trust.ReasonCertificateChanged:
+		err = e.trust.PinCertificate(peerID, q.Presented)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to pin the peer: %w", err)
+	}
+	if err := e.ReleasePeer(peerID); err != nil {
+		return err
+	}
+	logger.L().Info("Quarantined peer accepted", "peer", peerID, "reason", q.Reason)
+	return nil
+}
+
+// RejectPeer is the user's rejection of a quarantined peer: it is
+// disconnected and refused until released (ReleasePeer, trust release)
+func (e *ExecP2P) RejectPeer(peerID string) error {
+	if peerID == "" {
+		return fmt.Errorf("peer ID is required")
+	}
+	if err := e.trust.Reject(peerID); err != nil {
+		return err
+	}
+	e.updateQuarantined()
+	if qnet, ok := e.network.(*network.QuicNetwork); ok {
+		for _, p := range qnet.Peers() {
+			if p.ID == peerID {
+				qnet.Disconnect(network.ErrQuarantined.Error())
+				break
+			}
+		}
+	}
+	logger.L().Info("Quarantined peer rejected", "peer", peerID)
+	return nil
+}
+
+// ReleasePeer lifts a peer's quarantine without pinning anything, so its
+// next connection is checked like any other
+func (e *ExecP2P) ReleasePeer(peerID string) error {
+	if peerID == "" {
+		return fmt.Errorf("peer ID is required")
+	}
+	if err := e.trust.Release(peerID); err != nil {
+		return err
+	}
+	e.updateQuarantined()
+	logger.L().Info("Peer released from quarantine", "peer", peerID)
+	return nil
+}
+
+// quarantinedPeer returns a connected peer in quarantine, empty if none
+func (e *ExecP2P) quarantinedPeer() string {
+	for _, p := range e.network.Peers() {
+		if _, ok := e.trust.Quarantined(p.ID); ok {
+			return p.ID
+		}
+	}
+	return ""
+}
+
+// updateQuarantined hands the network the peers it must refuse
+func (e *ExecP2P) updateQuarantined() {
+	if qnet, ok := e.network.(*network.QuicNetwork); ok {
+		qnet.SetQuarantined(e.quarantinedIDs())
+	}
+}
+
+// quarantinedIDs are the quarantined peers refused at the announcement; the
+// others may connect, but their messages are dropped (allowSender)
+func (e *ExecP2P) quarantinedIDs() []string {
+	var ids []string
+	for _, q := range e.trust.QuarantinedPeers() {
+		if q.Refused {
+			ids = append(ids, q.PeerID)
+		}
+	}
+	return ids
+}
@@ -0,0 +1,45 @@
+package app
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"execp2p/internal/logger"
+	"execp2p/internal/network"
+)
+
+// EnsurePeerReachable probes the peer and, if it doesn't answer, reconnects
+// once. A failure marks the connection as degraded until the peer is heard
+// from again.
+func (e *ExecP2P) EnsurePeerReachable(ctx context.Context) error {
+	qnet, ok := e.network.(*network.QuicNetwork)
+	if !ok || qnet == nil {
+		return fmt.Errorf("brak aktywnego pokoju")
+	}
+
+	if err := qnet.CheckReachable(ctx); err != nil {
+		e.degradedAt.Store(time.Now().UnixNano())
+		e.notifyStatus()
+		logger.L().Warn("Peer unreachable", "err", err)
+		return err
+	}
+	if e.degradedAt.Swap(0) != 0 {
+		e.notifyStatus()
+	}
+	return nil
+}
+
+// ConnectionDegraded reports whether the last reachability check failed and
+// nothing has been received from the peer since
+func (e *ExecP2P) ConnectionDegraded() bool {
+	since := e.degradedAt.Load()
+	if since == 0 {
+		return false
+	}
+	qnet, ok := e.network.(*network.QuicNetwork)
+	if !ok || qnet == nil {
+		return true
+	}
+	return qnet.LastHeard().UnixNano() < since
+}
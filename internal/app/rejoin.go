@@ -0,0 +1,158 @@
+package app
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"execp2p/internal/crash"
+	"execp2p/internal/logger"
+	"execp2p/internal/rejoin"
+	"execp2p/internal/room"
+	"execp2p/internal/storage"
+)
+
+// Rooms restored at startup.
+//
+// The room we are in is kept in the encrypted store with its access key and,
+// for a room we joined, the addresses its host was reached at. It is dropped
+// when we leave it, the room ends or the host turns us away; quitting the
+// application keeps it. With room.rejoin on, the frontends enter the kept
+// rooms again when they start: a room we created is hosted again under the
+// same ID, key and, if it is free, port, so its guests find it where it was.
+// Incognito rooms are never kept. A room whose host could not be found at
+// startup is tried again until it can (RejoinLater), and a guest that lost
+// its host keeps looking for it (rendezvous.go), so a room both sides left
+// by restarting forms again once they are back.
+
+func newSavedRooms(db *storage.DB) *rejoin.List {
+	bucket, err := db.Bucket(rejoin.BucketName)
+	if err != nil {
+		logger.L().Warn("Rooms to rejoin are kept in memory only", "err", err)
+		return rejoin.New(nil)
+	}
+	return rejoin.New(bucket)
+}
+
+// RoomsToRejoin returns the rooms we were in when the application last
+// closed, the one entered first first; none unless room.rejoin is on
+func (e *ExecP2P) RoomsToRejoin() []rejoin.Room {
+	if !e.config.Room.Rejoin {
+		return nil
+	}
+	return e.savedRooms.Rooms()
+}
+
+// Rejoin enters a saved room again: one we created is hosted again, one we
+// joined is joined at the host's last known addresses and, failing those,
+// found again like any other
+func (e *ExecP2P) Rejoin(ctx context.Context, r rejoin.Room) error {
+	if r.Host {
+		return e.rehost(ctx, r)
+	}
+	for _, addr := range r.Addresses {
+		err := e.JoinRoom(ctx, r.RoomID, addr, r.AccessKey)
+		if err == nil {
+			return nil
+		}
+		logger.L().Debug("Host not at its last known address", "room_id", r.RoomID, "addr", addr, "err", err)
+	}
+	return e.JoinRoom(ctx, r.RoomID, "", r.AccessKey)
+}
+
+// RejoinLater enters rooms that could not be entered at startup once their
+// hosts can be found, trying with growing pauses until ctx ends. enter
+// enters one room (e.g. in a new session). A room is given up once it is no
+// longer kept, we are in it again, or entering it fails for another reason than its host not
+// being found or reached.
+func (e *ExecP2P) RejoinLater(ctx context.Context, rooms []rejoin.Room, enter func(rejoin.Room) error) {
+	defer crash.Recover("app.RejoinLater")
+	pause := rendezvousFirst
+	for len(rooms) > 0 {
+		select {
+		case <-ctx.Done():
+			return
+		case <-e.clock.After(pause):
+		}
+		pause = min(2*pause, rendezvousMax)
+
+		var left []rejoin.Room
+		for _, r := range rooms {
+			if _, ok := e.savedRooms.Get(r.RoomID); !ok {
+				continue
+			}
+			if _, in := e.Session(r.RoomID); in {
+				continue
+			}
+			err := enter(r)
+			switch {
+			case err == nil:
+				logger.L().Info("Rejoined room", "room_id", r.RoomID)
+			case errors.Is(err, ErrDiscovery) || errors.Is(err, ErrTransport):
+				logger.L().Debug("Room's host not found yet", "room_id", r.RoomID, "err", err)
+				left = append(left, r)
+			default:
+				logger.L().Warn("Giving up rejoining room", "room_id", r.RoomID, "err", err)
+			}
+		}
+		rooms = left
+	}
+}
+
+// rehost hosts a room we created again, unless it closed by itself meanwhile
+func (e *ExecP2P) rehost(ctx context.Context, r rejoin.Room) error {
+	opts := RoomOptions{IdleTimeout: r.IdleTimeout}
+	if !r.ExpiresAt.IsZero() {
+		if opts.TTL = time.Until(r.ExpiresAt); opts.TTL <= 0 {
+			e.wipeRoom(r.RoomID)
+			e.savedRooms.Forget(r.RoomID)
+			return fmt.Errorf("room %s expired while the application was closed", r.RoomID)
+		}
+	}
+	if r.Port != 0 && !e.sessions.claimPort(e, r.Port) {
+		logger.L().Warn("Room's port is taken; its guests have to find it again", "room_id", r.RoomID, "port", r.Port)
+	}
+	_, err := e.hostRoom(ctx, &room.Room{
+		ID:          r.RoomID,
+		Name:        r.Name,
+		Description: roomDescription,
+		MaxPeers:    e.config.Network.MaxPeers,
+		IsPrivate:   true,
+		AccessKey:   r.AccessKey,
+	}, opts)
+	return err
+}
+
+// rememberRoom keeps the current room to enter again; entered marks it as
+// just entered. A guest's room is kept once the host is reached, with the
+// address it was reached at.
+func (e *ExecP2P) rememberRoom(entered bool) {
+	st := e.state()
+	current := st.room
+	if current == nil || current.Incognito || st.network == nil {
+		return
+	}
+	r := rejoin.Room{RoomID: current.ID, AccessKey: current.AccessKey, Name: current.Name, Host: st.network.IsListener()}
+	if r.Host {
+		r.Port = e.listenPort
+		r.ExpiresAt, r.IdleTimeout = e.lifetime.limits()
+	} else {
+		peers := st.network.Peers()
+		if len(peers) == 0 {
+			return
+		}
+		r.Addresses = []string{peers[0].Address}
+	}
+	if entered {
+		r.EnteredAt = time.Now()
+	}
+	e.savedRooms.Save(r)
+}
+
+// forgetRoom drops the current room from the rooms to enter again
+func (e *ExecP2P) forgetRoom() {
+	if e.currentRoom != nil {
+		e.savedRooms.Forget(e.currentRoom.ID)
+	}
+}
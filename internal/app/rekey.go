@@ -0,0 +1,21 @@
+package app
+
+import (
+	"execp2p/internal/logger"
+	"execp2p/internal/network"
+)
+
+// RekeyNotices delivers key epoch changes after peers left the room
+func (e *ExecP2P) RekeyNotices() <-chan network.RekeyEvent {
+	return e.rekeyNotices
+}
+
+func (e *ExecP2P) onRekey(event network.RekeyEvent) {
+	logger.L().Info("Key epoch changed", "epoch", event.Epoch, "reason", event.Reason, "departed", len(event.Departed))
+
+	select {
+	case e.rekeyNotices <- event:
+	default:
+		logger.L().Warn("Rekey notice dropped; nobody is listening")
+	}
+}
@@ -0,0 +1,145 @@
+package app
+
+import (
+	"errors"
+	"reflect"
+	"strings"
+
+	"execp2p/internal/config"
+	"execp2p/internal/discovery"
+	"execp2p/internal/logger"
+)
+
+// ReloadResult lists the config file sections a reload found changed, by
+// their key in the file
+type ReloadResult struct {
+	// in effect now; rooms created or joined later use them too
+	Applied []string `json:"applied"`
+	// kept at their old values until the application is restarted
+	RestartRequired []string `json:"restart_required"`
+}
+
+// sections applied by ApplyConfig; the others are only read at startup
+var reloadable = map[string]func(e *ExecP2P, cfg *config.Config){
+	"discovery":     (*ExecP2P).applyDiscovery,
+	"trust":         func(e *ExecP2P, cfg *config.Config) { e.config.Trust = cfg.Trust },
+	"room":          (*ExecP2P).applyRoom,
+	"locale":        (*ExecP2P).applyLocale,
+	"bot":           (*ExecP2P).applyBot,
+	"crypto":        (*ExecP2P).applyCrypto,
+	"log":           (*ExecP2P).applyLog,
+	"notifications": func(e *ExecP2P, cfg *config.Config) { e.config.Notifications = cfg.Notifications },
+}
+
+// SetConfigSource tells ReloadConfig where to read the configuration from,
+// normally the config file at path layered as at startup. UpdateSettings
+// writes to path.
+func (e *ExecP2P) SetConfigSource(path string, source func() (*config.Config, error)) {
+	e.reloadMu.Lock()
+	defer e.reloadMu.Unlock()
+	e.configFile, e.configSource = path, source
+}
+
+// ReloadConfig reads the configuration again and applies what changed. An
+// invalid configuration changes nothing.
+func (e *ExecP2P) ReloadConfig() (ReloadResult, error) {
+	e.reloadMu.Lock()
+	source := e.configSource
+	e.reloadMu.Unlock()
+	if source == nil {
+		return ReloadResult{}, errors.New("no configuration source to reload from")
+	}
+	cfg, err := source()
+	if err != nil {
+		return ReloadResult{}, err
+	}
+	return e.ApplyConfig(cfg), nil
+}
+
+// ApplyConfig switches the running backend to cfg, without leaving the room.
+// Discovery, trust, room defaults, locale, the bot, key rotation, logging
+// and notifications take effect at once: the host's discovery announcements
+// are restarted with the new methods. Changes to other sections are
+// reported and ignored.
+func (e *ExecP2P) ApplyConfig(cfg *config.Config) ReloadResult {
+	e.reloadMu.Lock()
+	defer e.reloadMu.Unlock()
+
+	e.loadedConfig = cfg
+	result := ReloadResult{Applied: []string{}, RestartRequired: []string{}}
+	oldValue, newValue := reflect.ValueOf(e.config).Elem(), reflect.ValueOf(cfg).Elem()
+	for i := 0; i < oldValue.NumField(); i++ {
+		key := strings.Split(oldValue.Type().Field(i).Tag.Get("yaml"), ",")[0]
+		if key == "" || key == "-" || reflect.DeepEqual(oldValue.Field(i).Interface(), newValue.Field(i).Interface()) {
+			continue
+		}
+		apply, ok := reloadable[key]
+		if !ok {
+			result.RestartRequired = append(result.RestartRequired, key)
+			continue
+		}
+		apply(e, cfg)
+		result.Applied = append(result.Applied, key)
+	}
+
+	// sections waiting for a restart are reported again by every reload
+	if len(result.Applied) > 0 {
+		logger.L().Info("Configuration reloaded", "applied", result.Applied, "restart_required", result.RestartRequired)
+	}
+	return result
+}
+
+func (e *ExecP2P) applyDiscovery(cfg *config.Config) {
+	old := e.config.Discovery
+	e.config.Discovery = cfg.Discovery
+	if len(cfg.Discovery.STUNServers) > 0 && !reflect.DeepEqual(old.STUNServers, cfg.Discovery.STUNServers) {
+		discovery.StunServers = cfg.Discovery.STUNServers
+		// the cached answer came from other servers
+		e.nat.mu.Lock()
+		e.nat.status = NATStatus{}
+		e.nat.mu.Unlock()
+	}
+
+	// joining reads the settings when it starts; a hosted room keeps its
+	// connections and only swaps its announcers
+	hosting := e.isRunning && e.network != nil && e.network.IsListener() &&
+		e.announceCtx != nil && e.announceCtx.Err() == nil
+	if !hosting {
+		return
+	}
+	if err := e.startAnnouncing(); err != nil {
+		logger.L().Warn("Failed to restart discovery announcements", "err", err)
+	}
+}
+
+func (e *ExecP2P) applyRoom(cfg *config.Config) {
+	nickname := cfg.Room.Nickname
+	if nickname != e.config.Room.Nickname && nickname != "" {
+		e.SetLocalNickname(nickname)
+	}
+	e.config.Room = cfg.Room
+}
+
+func (e *ExecP2P) applyLocale(cfg *config.Config) {
+	if err := e.SetLocale(cfg.Locale.Language, cfg.Locale.Timezone); err != nil {
+		logger.L().Warn("Invalid locale settings; keeping the current ones", "err", err)
+	}
+}
+
+func (e *ExecP2P) applyBot(cfg *config.Config) {
+	e.config.Bot = cfg.Bot
+	e.bot.configure(cfg.Bot)
+}
+
+func (e *ExecP2P) applyCrypto(cfg *config.Config) {
+	e.config.Crypto = cfg.Crypto
+	e.pqCrypto.SetKeyRotationInterval(cfg.Crypto.KeyRotationInterval)
+}
+
+func (e *ExecP2P) applyLog(cfg *config.Config) {
+	e.config.Log = cfg.Log
+	// empty leaves the level taken from the environment or a flag
+	if cfg.Log.Level != "" {
+		logger.SetLevel(logger.ParseLevel(cfg.Log.Level))
+	}
+}
@@ -0,0 +1,120 @@
+package app
+
+import (
+	"context"
+	"fmt"
+	"sync/atomic"
+	"time"
+
+	"execp2p/internal/discovery"
+	"execp2p/internal/logger"
+	"execp2p/internal/network"
+)
+
+// Finding the host again.
+//
+// A guest that lost the host of a saved room keeps looking for it, with
+// growing pauses: at the addresses the host was last reached at, then
+// through local discovery and the signaling server, on which the host
+// announces itself again once it is back. So when both sides restart, the
+// room forms again without anyone passing addresses around.
+
+const (
+	// how long the host may be missing before we look for it, and the
+	// longest pause between two searches
+	rendezvousFirst = 5 * time.Second
+	rendezvousMax   = 2 * time.Minute
+	// how long one address is dialed
+	rendezvousDial = 10 * time.Second
+)
+
+// rendezvous paces the search for a missing host; only the search itself
+// runs outside the loop that owns it
+type rendezvous struct {
+	running atomic.Bool
+	next    time.Time
+	pause   time.Duration
+}
+
+// seekHost starts a search for the host of the saved room we are in when it
+// is missing and it is time to (guests)
+func (e *ExecP2P) seekHost(ctx context.Context, rv *rendezvous) {
+	qnet, ok := e.network.(*network.QuicNetwork)
+	if !ok || qnet == nil || qnet.IsListener() {
+		return
+	}
+	if len(qnet.Peers()) > 0 {
+		rv.next, rv.pause = time.Time{}, 0
+		return
+	}
+	current := e.currentRoom
+	if current == nil || qnet.Removed() || e.accessDenied.Load() || e.roomFull.Load() || e.incompatible.Load() || e.noRetry.Load() {
+		return
+	}
+	saved, ok := e.savedRooms.Get(current.ID)
+	if !ok {
+		return
+	}
+	now := e.clock.Now()
+	if rv.next.IsZero() {
+		// give a connection being set up, or dropped for a moment, its time
+		rv.next = now.Add(rendezvousFirst)
+		return
+	}
+	if now.Before(rv.next) || !rv.running.CompareAndSwap(false, true) {
+		return
+	}
+	rv.pause = min(max(2*rv.pause, rendezvousFirst), rendezvousMax)
+	rv.next = now.Add(rv.pause)
+
+	go func() {
+		defer rv.running.Store(false)
+		e.findHost(ctx, qnet, current.ID, saved.Addresses)
+	}()
+}
+
+// findHost dials the host where it was last reached and, failing that,
+// where discovery finds it
+func (e *ExecP2P) findHost(ctx context.Context, qnet *network.QuicNetwork, roomID string, known []string) {
+	for _, addr := range known {
+		if e.redial(ctx, qnet, addr) == nil {
+			return
+		}
+	}
+	addr, err := e.discoverHost(ctx, roomID)
+	if err != nil {
+		logger.L().Debug("Room's host not found yet", "room_id", roomID, "err", err)
+		return
+	}
+	e.redial(ctx, qnet, addr)
+}
+
+// redial dials the host at addr
+func (e *ExecP2P) redial(ctx context.Context, qnet *network.QuicNetwork, addr string) error {
+	dialCtx, cancel := context.WithTimeout(ctx, rendezvousDial)
+	defer cancel()
+	if err := qnet.RedialAt(dialCtx, addr); err != nil {
+		logger.L().Debug("Room's host not at address", "addr", addr, "err", err)
+		return err
+	}
+	logger.L().Info("Found the room's host again", "addr", addr)
+	return nil
+}
+
+// discoverHost looks the room up on the local network, the DHT and the
+// signaling server
+func (e *ExecP2P) discoverHost(ctx context.Context, roomID string) (string, error) {
+	addr, err := e.tryLocalNetworkDiscovery(ctx, roomID)
+	if err == nil {
+		return addr, nil
+	}
+	if e.config.Discovery.SignalingServer == "" {
+		return "", err
+	}
+	signaling := discovery.NewSignalingConfig(e.config.Discovery.SignalingServer)
+	addr, serr := e.trySignalingAndHolePunching(ctx, roomID, signaling)
+	if serr != nil {
+		return "", fmt.Errorf("%w; %v", err, serr)
+	}
+	return addr, nil
+}
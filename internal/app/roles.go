@@ -0,0 +1,296 @@
+package app
+
+import (
+	"encoding/json"
+	"fmt"
+	"slices"
+	"strings"
+	"sync"
+	"unicode/utf8"
+
+	"execp2p/internal/crypto"
+	"execp2p/internal/logger"
+	"execp2p/internal/room"
+)
+
+// Role is what a member may do in a room. The creator is the host; it can
+// appoint moderators, who may then kick, ban, rotate the access key and
+// rename the room as well. Everyone else is a member.
+type Role string
+
+const (
+	RoleHost      Role = "host"
+	RoleModerator Role = "moderator"
+	RoleMember    Role = "member"
+)
+
+// Permission is a moderation action a role may be allowed
+type Permission string
+
+const (
+	PermKick      Permission = "kick"
+	PermBan       Permission = "ban"
+	PermRotateKey Permission = "rotate_key"
+	PermRename    Permission = "rename"
+)
+
+var rolePermissions = map[Role][]Permission{
+	RoleHost:      {PermKick, PermBan, PermRotateKey, PermRename},
+	RoleModerator: {PermKick, PermBan, PermRotateKey, PermRename},
+}
+
+// Can reports whether the role allows an action
+func (r Role) Can(p Permission) bool {
+	return slices.Contains(rolePermissions[r], p)
+}
+
+// ParseRole checks a role the host may grant, given by name
+func ParseRole(s string) (Role, error) {
+	switch r := Role(s); r {
+	case RoleModerator, RoleMember:
+		return r, nil
+	}
+	return "", fmt.Errorf("unknown role %q: want moderator or member", s)
+}
+
+// MaxRoomNameLength caps the room name, in characters
+const MaxRoomNameLength = 64
+
+// Roles live in the room metadata as grants signed by the host, which every
+// guest checks. Members holding a role ask the host to act for them; the
+// host checks the sender's role against its own grants before it does.
+const moderationType = "moderation"
+
+type moderationControl struct {
+	Type        string     `json:"type"`
+	RoomID      string     `json:"room_id"`
+	Action      Permission `json:"action"`
+	PeerID      string     `json:"peer_id,omitempty"`
+	Fingerprint string     `json:"fingerprint,omitempty"`
+	Reason      string     `json:"reason,omitempty"`
+	Name        string     `json:"name,omitempty"`
+	// for rotate_key: disconnect the members too
+	Evict bool `json:"evict,omitempty"`
+	// for ban: lift it instead
+	Lift bool `json:"lift,omitempty"`
+}
+
+func (c moderationControl) controlType() string { return c.Type }
+
+// roleState is the role grants of the current room, by fingerprint
+type roleState struct {
+	mu     sync.Mutex
+	grants map[string]crypto.RoleGrant
+}
+
+func newRoles() *roleState {
+	return &roleState{grants: make(map[string]crypto.RoleGrant)}
+}
+
+func (r *roleState) list() []crypto.RoleGrant {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	grants := make([]crypto.RoleGrant, 0, len(r.grants))
+	for _, g := range r.grants {
+		grants = append(grants, g)
+	}
+	slices.SortFunc(grants, func(a, b crypto.RoleGrant) int { return strings.Compare(a.Fingerprint, b.Fingerprint) })
+	return grants
+}
+
+func (r *roleState) replace(grants []crypto.RoleGrant) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	clear(r.grants)
+	for _, g := range grants {
+		r.grants[g.Fingerprint] = g
+	}
+}
+
+// dropRole takes away the role of an identity; it reports whether it had one
+func (e *ExecP2P) dropRole(fingerprint string) bool {
+	e.roles.mu.Lock()
+	defer e.roles.mu.Unlock()
+	_, ok := e.roles.grants[fingerprint]
+	delete(e.roles.grants, fingerprint)
+	return ok
+}
+
+// RoleOf returns the role of a room member, ourselves included
+func (e *ExecP2P) RoleOf(peerID string) Role {
+	if e.isHost(peerID) {
+		return RoleHost
+	}
+	var fingerprint string
+	var err error
+	if peerID == e.peerID {
+		fingerprint, err = e.pqCrypto.GetIdentityFingerprint()
+	} else {
+		fingerprint, err = e.pqCrypto.GetPeerFingerprint(peerID)
+	}
+	if err != nil {
+		return RoleMember
+	}
+	e.roles.mu.Lock()
+	grant, ok := e.roles.grants[fingerprint]
+	e.roles.mu.Unlock()
+	if !ok {
+		return RoleMember
+	}
+	return Role(grant.Role)
+}
+
+// Role returns our role in the current room
+func (e *ExecP2P) Role() Role {
+	return e.RoleOf(e.peerID)
+}
+
+// isHost reports whether peerID hosts the current room
+func (e *ExecP2P) isHost(peerID string) bool {
+	if e.network == nil {
+		return false
+	}
+	if e.network.IsListener() {
+		return peerID == e.peerID
+	}
+	return e.fromHost(peerID)
+}
+
+// SetPeerRole appoints a connected peer moderator, or makes it a member
+// again (host only). The signed grant goes out with the room metadata.
+func (e *ExecP2P) SetPeerRole(peerID string, role Role) error {
+	qnet, err := e.hostNetwork()
+	if err != nil {
+		return err
+	}
+	if _, err := ParseRole(string(role)); err != nil {
+		return err
+	}
+	fingerprint, err := e.pqCrypto.GetPeerFingerprint(peerID)
+	if err != nil {
+		return fmt.Errorf("nieznana tożsamość uczestnika %s: %w", peerID, err)
+	}
+
+	if role == RoleMember {
+		e.dropRole(fingerprint)
+	} else {
+		grant, err := e.pqCrypto.CreateRoleGrant(e.currentRoom.ID, fingerprint, string(role))
+		if err != nil {
+			return fmt.Errorf("failed to sign role grant: %w", err)
+		}
+		e.roles.mu.Lock()
+		e.roles.grants[fingerprint] = *grant
+		e.roles.mu.Unlock()
+	}
+
+	logger.L().Info("Role changed", "room_id", e.currentRoom.ID, "peer", peerID, "role", role)
+	e.notifyStatus()
+	return e.signRoomMetadata(qnet)
+}
+
+// RenameRoom names the current room for everyone in it and returns the name
+// as stored, spaces collapsed. Only the host and members whose role allows
+// it may rename; a moderator's rename shows once the host has signed it.
+func (e *ExecP2P) RenameRoom(name string) (string, error) {
+	name = strings.Join(strings.Fields(name), " ")
+	if utf8.RuneCountInString(name) > MaxRoomNameLength {
+		return "", fmt.Errorf("nazwa pokoju jest dłuższa niż %d znaków", MaxRoomNameLength)
+	}
+	if delegated, err := e.delegate(moderationControl{Action: PermRename, Name: name}); delegated {
+		return name, err
+	}
+	qnet, err := e.hostNetwork()
+	if err != nil {
+		return "", err
+	}
+	e.updateRoom(func(r *room.Room) error {
+		r.Name = name
+		return nil
+	})
+	e.notifyStatus()
+	return name, e.signRoomMetadata(qnet)
+}
+
+// delegate asks the host to carry out an action when we are a guest. It
+// reports false on the host, which acts itself.
+func (e *ExecP2P) delegate(req moderationControl) (bool, error) {
+	if e.network == nil || e.network.IsListener() {
+		return false, nil
+	}
+	if e.currentRoom == nil {
+		return true, fmt.Errorf("nie jesteśmy połączeni z żadnym pokojem")
+	}
+	if !e.Role().Can(req.Action) {
+		return true, fmt.Errorf("brak uprawnień: %s wymaga roli moderatora", req.Action)
+	}
+	req.Type, req.RoomID = moderationType, e.currentRoom.ID
+	return true, e.sendControl(req)
+}
+
+// adoptRoles takes the room name and the role grants from verified room
+// metadata, keeping only grants the host really signed for this room
+func (e *ExecP2P) adoptRoles(meta *crypto.RoomMetadata) {
+	var grants []crypto.RoleGrant
+	for _, g := range meta.Roles {
+		if _, err := ParseRole(g.Role); err != nil || g.RoomID != meta.RoomID {
+			logger.L().Warn("Ignoring invalid role grant", "role", g.Role, "room_id", g.RoomID)
+			continue
+		}
+		if err := e.pqCrypto.VerifyRoleGrant(&g, meta.HostID); err != nil {
+			logger.L().Warn("Rejected role grant", "fingerprint", g.Fingerprint, "err", err)
+			continue
+		}
+		grants = append(grants, g)
+	}
+	e.roles.replace(grants)
+	e.updateRoom(func(r *room.Room) error {
+		if r.ID == meta.RoomID {
+			r.Name = meta.Name
+		}
+		return nil
+	})
+	e.notifyStatus()
+}
+
+// handleModeration carries out an action a member asked for, if its role
+// allows it (host)
+func (e *ExecP2P) handleModeration(payload *crypto.MessagePayload) {
+	var ctl moderationControl
+	if err := json.Unmarshal([]byte(payload.Message), &ctl); err != nil {
+		logger.L().Warn("Invalid moderation request", "err", err)
+		return
+	}
+	if e.network == nil || !e.network.IsListener() || e.currentRoom == nil || ctl.RoomID != e.currentRoom.ID {
+		return
+	}
+	if role := e.RoleOf(payload.SenderID); !role.Can(ctl.Action) {
+		logger.L().Warn("Refused moderation request", "peer", payload.SenderID, "role", role, "action", ctl.Action)
+		return
+	}
+	logger.L().Info("Moderation request", "peer", payload.SenderID, "action", ctl.Action)
+
+	// the actions send control messages themselves; don't block the read loop
+	go func() {
+		var err error
+		switch ctl.Action {
+		case PermKick:
+			err = e.KickPeer(ctl.PeerID, ctl.Reason)
+		case PermBan:
+			switch {
+			case ctl.Lift:
+				err = e.UnbanFingerprint(ctl.Fingerprint)
+			case ctl.Fingerprint != "":
+				err = e.BanFingerprint(ctl.Fingerprint, ctl.Reason)
+			default:
+				err = e.BanPeer(ctl.PeerID, ctl.Reason)
+			}
+		case PermRotateKey:
+			_, err = e.RotateRoomAccessKey(ctl.Evict)
+		case PermRename:
+			_, err = e.RenameRoom(ctl.Name)
+		}
+		if err != nil {
+			logger.L().Warn("Moderation request failed", "peer", payload.SenderID, "action", ctl.Action, "err", err)
+		}
+	}()
+}
@@ -0,0 +1,162 @@
+package app
+
+import (
+	"errors"
+
+	"execp2p/internal/config"
+	"execp2p/internal/network"
+	"execp2p/internal/roster"
+	"execp2p/internal/types"
+)
+
+// Roster returns the room members with unambiguous display names
+func (e *ExecP2P) Roster() []roster.Entry {
+	e.syncRoster()
+	return e.roster.Entries()
+}
+
+// GetPeers returns the room members, ourselves included, with what is known
+// about each: identity, verification, connection and profile
+func (e *ExecP2P) GetPeers() []types.PeerInfo {
+	connections := make(map[string]network.PeerInfo)
+	if e.network != nil {
+		for _, p := range e.network.Peers() {
+			connections[p.ID] = p
+		}
+	}
+	transport := e.Transport()
+
+	peers := []types.PeerInfo{}
+	for _, member := range e.Roster() {
+		peer := types.PeerInfo{
+			ID:          member.PeerID,
+			Nickname:    member.DisplayName,
+			IsLocal:     member.Local,
+			Presence:    string(e.PeerPresence(member.PeerID)),
+			Role:        string(e.RoleOf(member.PeerID)),
+			Fingerprint: member.Fingerprint,
+		}
+		if !member.Local {
+			v := e.PeerVerificationState(member.PeerID)
+			peer.Verification = string(v.State)
+			if v.Fingerprint != "" {
+				peer.Fingerprint = v.Fingerprint
+			}
+		}
+		if conn, ok := connections[member.PeerID]; ok {
+			peer.Address = conn.Address
+			peer.Transport = transport.Protocol + "/" + transport.Method
+			peer.ConnectedSince = conn.ConnectedAt.Unix()
+			if !conn.LastActivity.IsZero() {
+				peer.LastActivity = conn.LastActivity.Unix()
+			}
+			peer.Offline = conn.Offline
+		}
+		if p, ok := e.PeerProfile(member.PeerID); ok {
+			peer.Status = p.Status
+			if avatar, ok := e.Avatar(p); ok {
+				peer.Avatar = avatar.DataURL()
+			}
+		}
+		peers = append(peers, peer)
+	}
+	return peers
+}
+
+// Nickname returns the nickname we chose, as announced to peers
+func (e *ExecP2P) Nickname() string {
+	return e.roster.Nickname(e.peerID)
+}
+
+// SetLocalNickname records our own nickname, in every room we are in.
+// Peers connecting from now on get it in our announcement; the ones
+// connected already have to be told.
+func (e *ExecP2P) SetLocalNickname(nickname string) string {
+	var name string
+	for _, s := range e.sessions.list() {
+		if n := s.setLocalNickname(nickname); s == e {
+			name = n
+		}
+	}
+	return name
+}
+
+func (e *ExecP2P) setLocalNickname(nickname string) string {
+	e.syncRoster()
+	defer e.notifyStatus()
+	name := e.roster.SetNickname(e.peerID, nickname)
+	if qnet, ok := e.network.(*network.QuicNetwork); ok && qnet != nil {
+		qnet.SetLocalNickname(e.Nickname())
+	}
+	// the profile carries the nickname too
+	go e.sendProfile()
+	return name
+}
+
+// SaveNickname sets our nickname and writes it to the config file, so it is
+// also ours after a restart
+func (e *ExecP2P) SaveNickname(nickname string) (string, error) {
+	name := e.SetLocalNickname(nickname)
+	nickname = e.Nickname()
+
+	e.reloadMu.Lock()
+	defer e.reloadMu.Unlock()
+	if e.configFile == "" {
+		return name, errors.New("no config file to save the nickname to")
+	}
+	if err := config.SaveNickname(e.configFile, nickname); err != nil {
+		return name, err
+	}
+	// so the next reload finds nothing changed
+	e.config.Room.Nickname = nickname
+	if e.loadedConfig != nil {
+		e.loadedConfig.Room.Nickname = nickname
+	}
+	return name, nil
+}
+
+// SetPeerNickname records a nickname announced by a peer and returns the
+// name to display for it
+func (e *ExecP2P) SetPeerNickname(peerID, nickname string) string {
+	e.syncRoster()
+	defer e.notifyStatus()
+	return e.roster.SetNickname(peerID, nickname)
+}
+
+// DisplayName returns the unambiguous name of a member
+func (e *ExecP2P) DisplayName(peerID string) string {
+	e.syncRoster()
+	return e.roster.DisplayName(peerID)
+}
+
+// connectedPeers returns the IDs of the connected peers
+func (e *ExecP2P) connectedPeers() []string {
+	transport := e.state().network
+	if transport == nil {
+		return nil
+	}
+	var ids []string
+	for _, p := range transport.Peers() {
+		ids = append(ids, p.ID)
+	}
+	return ids
+}
+
+// syncRoster brings membership and fingerprints in line with the transport
+func (e *ExecP2P) syncRoster() {
+	// runs from the transport's handlers too, while a leave may reset the session
+	st := e.state()
+	if fp, err := st.pqCrypto.GetIdentityFingerprint(); err == nil {
+		e.roster.Upsert(e.peerID, fp, true)
+	}
+	if st.network == nil {
+		e.roster.Retain(nil)
+		return
+	}
+	peers := e.connectedPeers()
+	for _, id := range peers {
+		fp, _ := st.pqCrypto.GetPeerFingerprint(id)
+		e.roster.Upsert(id, fp, false)
+	}
+	e.roster.Retain(peers)
+}
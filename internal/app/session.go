@@ -0,0 +1,341 @@
+package app
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+	"sync"
+
+	"execp2p/internal/crypto"
+	"execp2p/internal/emoji"
+	"execp2p/internal/logger"
+	"execp2p/internal/network"
+	"execp2p/internal/room"
+	"execp2p/internal/roster"
+)
+
+// Several rooms at once.
+//
+// Every room we are in has a session of its own: an ExecP2P with the room,
+// its network and crypto session, roster, roles, shortcodes and lifetime.
+// What belongs to the user rather than to a room - identity, storage,
+// trust, history, media, bans, profiles, presence and the notice channels -
+// is shared with the instance NewExecP2P returned, which is the first
+// session. Library users and the daemon that stay in one room never see
+// the others.
+type sessionSet struct {
+	mu  sync.Mutex
+	all []*ExecP2P // the first is the one NewExecP2P returned
+	// set by Close: no room can be entered any more
+	closed bool
+}
+
+func (s *sessionSet) list() []*ExecP2P {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return slices.Clone(s.all)
+}
+
+func (s *sessionSet) add(e *ExecP2P) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.all = append(s.all, e)
+}
+
+func (s *sessionSet) remove(e *ExecP2P) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.all = slices.DeleteFunc(s.all, func(other *ExecP2P) bool { return other == e })
+}
+
+func (s *sessionSet) first() *ExecP2P {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.all[0]
+}
+
+// freePort finds an available port no session has taken yet
+func (s *sessionSet) freePort(minPort, maxPort int) (int, error) {
+	for range maxPort - minPort + 1 {
+		port, err := findAvailablePort(minPort, maxPort)
+		if err != nil {
+			return 0, err
+		}
+		s.mu.Lock()
+		taken := slices.ContainsFunc(s.all, func(e *ExecP2P) bool { return e.listenPort == port })
+		s.mu.Unlock()
+		if !taken {
+			return port, nil
+		}
+	}
+	return 0, fmt.Errorf("every available port in range %d-%d is taken by a room", minPort, maxPort)
+}
+
+// claimPort gives e the port a room it hosts again listened on, unless
+// another session has it or it is in use
+func (s *sessionSet) claimPort(e *ExecP2P, port int) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if port == e.listenPort {
+		return true
+	}
+	if slices.ContainsFunc(s.all, func(other *ExecP2P) bool { return other.listenPort == port }) || !isPortAvailable(port) {
+		return false
+	}
+	e.listenPort = port
+	return true
+}
+
+// close marks the sessions closed; it reports false if they already were
+func (s *sessionSet) close() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.closed {
+		return false
+	}
+	s.closed = true
+	return true
+}
+
+// OpenSession returns a session to create or join a room in: the first one
+// while it isn't in a room, a new one sharing its state otherwise. A new
+// session that didn't get into its room is given back with Close.
+func (e *ExecP2P) OpenSession() (*ExecP2P, error) {
+	e.sessions.mu.Lock()
+	closed := e.sessions.closed
+	e.sessions.mu.Unlock()
+	if closed {
+		return nil, errors.New("the app is closed")
+	}
+	first := e.sessions.first()
+	if !first.state().running {
+		return first, nil
+	}
+	return first.newSession()
+}
+
+// Sessions returns the sessions in a room, the first one first
+func (e *ExecP2P) Sessions() []*ExecP2P {
+	all := e.sessions.list()
+	return slices.DeleteFunc(all, func(s *ExecP2P) bool {
+		st := s.state()
+		return st.room == nil || !st.running
+	})
+}
+
+// Session returns the session in the given room
+func (e *ExecP2P) Session(roomID string) (*ExecP2P, bool) {
+	for _, s := range e.Sessions() {
+		if s.state().room.ID == roomID {
+			return s, true
+		}
+	}
+	return nil, false
+}
+
+// LeaveRoom leaves the session's room, which won't be entered again at the
+// next start. Another session is forgotten along with its subscriptions;
+// the first one, holding the shared state, goes back to the lobby: out of
+// any room, ready to create or join the next one, its subscribers kept.
+func (e *ExecP2P) LeaveRoom() {
+	e.forgetRoom()
+	e.leaveRoom()
+}
+
+// leaveRoom leaves the session's room, keeping it to enter again
+func (e *ExecP2P) leaveRoom() {
+	if e.sessions.first() != e {
+		e.leave()
+		e.subscriptions.closeAll()
+		e.sessions.remove(e)
+		return
+	}
+	if e.currentRoom == nil {
+		return
+	}
+	e.leave()
+	e.reset()
+	logger.L().Info("Left the room; back in the lobby")
+}
+
+// newSession opens a session sharing the state of the first one, with its
+// own copy of the identity keys and a port of its own
+func (e *ExecP2P) newSession() (*ExecP2P, error) {
+	pqCrypto, err := e.cloneCrypto()
+	if err != nil {
+		return nil, err
+	}
+
+	listenPort, err := e.sessions.freePort(e.config.Network.MinPort, e.config.Network.MaxPort)
+	if err != nil {
+		return nil, fmt.Errorf("failed to find available port: %w", err)
+	}
+
+	s := &ExecP2P{
+		config:      e.config,
+		peerID:      e.peerID,
+		pqCrypto:    pqCrypto,
+		identity:    e.identity,
+		db:          e.db,
+		certificate: e.certificate,
+		trust:       e.trust,
+		history:     e.history,
+		mailbox:     e.mailbox,
+		media:       e.media,
+		voice:       e.voice,
+		webhook:     e.webhook,
+		listenPort:  listenPort,
+		stopChan:    make(chan struct{}),
+		sessions:    e.sessions,
+
+		fingerprintChanges: e.fingerprintChanges,
+		quarantineNotices:  e.quarantineNotices,
+		archiveNotices:     e.archiveNotices,
+		accessKeyNotices:   e.accessKeyNotices,
+		rekeyNotices:       e.rekeyNotices,
+		kickNotices:        e.kickNotices,
+		departureNotices:   e.departureNotices,
+		livenessNotices:    e.livenessNotices,
+		refusalNotices:     e.refusalNotices,
+		networkErrors:      e.networkErrors,
+		closedNotices:      e.closedNotices,
+		crashNotices:       e.crashNotices,
+		newNetwork:         e.newNetwork,
+		clock:              e.clock,
+		bans:               e.bans,
+		banNotices:         e.banNotices,
+		roles:              newRoles(),
+		roster:             roster.New(),
+		shortcodes:         emoji.NewRegistry(),
+		emojiCache:         e.emojiCache,
+		outbox:             e.outbox,
+		savedRooms:         e.savedRooms,
+		profiles:           e.profiles,
+		presence:           e.presence,
+		shortcodeNotices:   e.shortcodeNotices,
+		statusNotices:      e.statusNotices,
+		sessionPins:        make(map[string]struct{}),
+		historySync:        historySync{notices: e.historySync.notices},
+		devices:            e.devices,
+		transfers:          e.transfers,
+		bot:                e.bot,
+	}
+	if nickname := e.Nickname(); nickname != "" {
+		s.roster.SetNickname(s.peerID, nickname)
+	}
+	e.sessions.add(s)
+	logger.L().Info("Opened another room session", "port", listenPort)
+	return s, nil
+}
+
+// cloneCrypto starts a crypto session with our identity keys and no peers
+func (e *ExecP2P) cloneCrypto() (*crypto.PQCrypto, error) {
+	keys, err := e.pqCrypto.ExportIdentityKeys()
+	if err != nil {
+		return nil, fmt.Errorf("failed to export identity keys: %w", err)
+	}
+	pqCrypto, err := crypto.NewPQCryptoWithIdentity(keys)
+	if err != nil {
+		return nil, fmt.Errorf("failed to initialize cryptography: %w", err)
+	}
+	pqCrypto.SetKeyRotationInterval(e.config.Crypto.KeyRotationInterval)
+	pqCrypto.SetClock(e.clock)
+	return pqCrypto, nil
+}
+
+// leave ends the session's room, leaving the shared state open
+func (e *ExecP2P) leave() {
+	e.roomMu.Lock()
+	if e.isRunning {
+		e.isRunning = false
+		close(e.stopChan)
+	}
+	e.roomMu.Unlock()
+	defer e.notifyStatus()
+
+	if e.stopAnnouncing != nil {
+		e.stopAnnouncing()
+	}
+	if e.network != nil {
+		e.flushBeforeLeaving()
+		// says goodbye to the peer before closing the connection
+		e.network.Stop()
+	}
+	e.closeArchive()
+	e.closeGateway()
+	e.leaveIncognito()
+}
+
+// reset takes the first session back to the lobby after leave: the next
+// room starts with a crypto session, member list, roles and flags of its own
+func (e *ExecP2P) reset() {
+	// the room's goroutines read what is replaced below until they are gone
+	e.handlers.Wait()
+
+	pqCrypto, err := e.cloneCrypto()
+	if err != nil {
+		logger.L().Warn("Crypto session kept after leaving the room", "err", err)
+	}
+	e.roomMu.Lock()
+	if err == nil {
+		e.pqCrypto = pqCrypto
+	}
+	e.currentRoom = nil
+	e.network = nil
+	e.stopChan = make(chan struct{})
+	e.roomMu.Unlock()
+
+	e.cadence, e.announceCtx, e.stopAnnouncing = nil, nil, nil
+	e.joinMethod = ""
+	e.roster.Retain(nil)
+	e.roles.replace(nil)
+	e.shortcodes.Replace(nil)
+	e.resetSessionPins()
+	e.degradedAt.Store(0)
+	e.accessDenied.Store(false)
+	e.roomFull.Store(false)
+	e.incompatible.Store(false)
+	e.noRetry.Store(false)
+	e.unread.Store(0)
+	e.notifyStatus()
+}
+
+// roomState is what entering and leaving a room replace, read at once
+type roomState struct {
+	network  network.Network
+	room     *room.Room
+	pqCrypto *crypto.PQCrypto
+	running  bool
+}
+
+// state returns the session's room state for goroutines other than the
+// one entering and leaving rooms
+func (e *ExecP2P) state() roomState {
+	e.roomMu.RLock()
+	defer e.roomMu.RUnlock()
+	return roomState{network: e.network, room: e.currentRoom, pqCrypto: e.pqCrypto, running: e.isRunning}
+}
+
+// updateRoom changes a copy of the current room and puts it in its place.
+// The room is never changed in place, so a room read through state() stays
+// as it was.
+func (e *ExecP2P) updateRoom(f func(*room.Room) error) error {
+	e.roomMu.Lock()
+	defer e.roomMu.Unlock()
+	if e.currentRoom == nil {
+		return fmt.Errorf("nie jesteśmy połączeni z żadnym pokojem")
+	}
+	updated := *e.currentRoom
+	if err := f(&updated); err != nil {
+		return err
+	}
+	e.currentRoom = &updated
+	return nil
+}
+
+// leaveOthers leaves the rooms of every session but the first
+func (e *ExecP2P) leaveOthers() {
+	for _, s := range e.sessions.list()[1:] {
+		s.leaveRoom()
+	}
+}
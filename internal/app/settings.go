@@ -0,0 +1,78 @@
+package app
+
+import (
+	"errors"
+
+	"execp2p/internal/config"
+	"execp2p/internal/logger"
+)
+
+// Settings returns the options the GUI's settings pane changes, as last
+// loaded: values waiting for a restart are included
+func (e *ExecP2P) Settings() config.Settings {
+	e.reloadMu.Lock()
+	defer e.reloadMu.Unlock()
+	if e.loadedConfig != nil {
+		return e.loadedConfig.Settings()
+	}
+	return e.config.Settings()
+}
+
+// UpdateSettings checks s, writes it to the config file and applies it as a
+// reload would. Flags given at startup keep overriding the file.
+func (e *ExecP2P) UpdateSettings(s config.Settings) (ReloadResult, error) {
+	e.reloadMu.Lock()
+	path, cfg := e.configFile, *e.config
+	if e.loadedConfig != nil {
+		cfg = *e.loadedConfig
+	}
+	e.reloadMu.Unlock()
+	if path == "" {
+		return ReloadResult{}, errors.New("no config file to save the settings to")
+	}
+
+	cfg.ApplySettings(s)
+	if err := cfg.Validate(); err != nil {
+		return ReloadResult{}, err
+	}
+	if err := config.SaveSettings(path, s); err != nil {
+		return ReloadResult{}, err
+	}
+	return e.ReloadConfig()
+}
+
+// LogLevel returns the log level in effect, empty while logging is off
+func (e *ExecP2P) LogLevel() string {
+	e.reloadMu.Lock()
+	defer e.reloadMu.Unlock()
+	return e.config.Log.Level
+}
+
+// SetLogLevel changes the log level at once, without leaving any room, and
+// writes it to the config file so it holds after a restart too. The level
+// is applied even when it can't be saved.
+func (e *ExecP2P) SetLogLevel(level string) error {
+	e.reloadMu.Lock()
+	defer e.reloadMu.Unlock()
+
+	if level == "" {
+		return errors.New("log level is required")
+	}
+	cfg := *e.config
+	cfg.Log.Level = level
+	if err := cfg.Validate(); err != nil {
+		return err
+	}
+	logger.SetLevel(logger.ParseLevel(level))
+	logger.L().Info("Log level changed", "level", level)
+
+	// so the next reload finds nothing changed
+	e.config.Log.Level = level
+	if e.loadedConfig != nil {
+		e.loadedConfig.Log.Level = level
+	}
+	if e.configFile == "" {
+		return errors.New("no config file to save the log level to")
+	}
+	return config.SaveLogLevel(e.configFile, level)
+}
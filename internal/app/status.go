@@ -0,0 +1,107 @@
+package app
+
+import (
+	"execp2p/internal/logger"
+	"execp2p/internal/network"
+)
+
+// StatusNotices signals whenever GetNetworkStatus or GetPeers may have
+// changed: a peer connected, finished its key exchange or left, a room was
+// entered or left, the connection degraded or a nickname changed
+func (e *ExecP2P) StatusNotices() <-chan struct{} {
+	return e.statusNotices
+}
+
+func (e *ExecP2P) notifyStatus() {
+	select {
+	case e.statusNotices <- struct{}{}:
+	default:
+		// a notice is already pending
+	}
+}
+
+func (e *ExecP2P) onPeerEvent(event network.PeerEvent) {
+	logger.L().Debug("Peer state changed", "peer", event.PeerID, "state", event.Kind)
+	if event.Kind == network.PeerConnected && event.Nickname != "" {
+		// notifies as well
+		e.SetPeerNickname(event.PeerID, event.Nickname)
+		return
+	}
+	switch event.Kind {
+	case network.PeerVerified:
+		// the peer can check our signature now
+		go e.sendProfile()
+		go e.sendPresence()
+	case network.PeerDisconnected:
+		e.forgetPresence(event.PeerID)
+		e.notifyDeparture(event)
+	case network.PeerOffline, network.PeerOnline:
+		e.notifyLiveness(event)
+	}
+	e.notifyStatus()
+}
+
+// Departure is sent on DepartureNotices when a peer went away
+type Departure struct {
+	RoomID string
+	PeerID string
+	// why, one of the network.LeaveReason values: e.g. "left" when it said
+	// goodbye, "disconnected" when its connection was lost
+	Reason string
+}
+
+// DepartureNotices delivers the peers that went away from our rooms
+func (e *ExecP2P) DepartureNotices() <-chan Departure {
+	return e.departureNotices
+}
+
+// Liveness is sent on LivenessNotices when a peer went silent or was heard
+// from again; its connection is still there
+type Liveness struct {
+	RoomID string
+	PeerID string
+	Online bool
+}
+
+// PeerOffline reports whether the connected peer has been silent for a while
+func (e *ExecP2P) PeerOffline(peerID string) bool {
+	if e.network == nil {
+		return false
+	}
+	for _, p := range e.network.Peers() {
+		if p.ID == peerID {
+			return p.Offline
+		}
+	}
+	return false
+}
+
+// LivenessNotices delivers the peers of our rooms that went offline or came
+// back online
+func (e *ExecP2P) LivenessNotices() <-chan Liveness {
+	return e.livenessNotices
+}
+
+func (e *ExecP2P) notifyLiveness(event network.PeerEvent) {
+	l := Liveness{PeerID: event.PeerID, Online: event.Kind == network.PeerOnline}
+	if e.currentRoom != nil {
+		l.RoomID = e.currentRoom.ID
+	}
+	select {
+	case e.livenessNotices <- l:
+	default:
+		// nobody is listening
+	}
+}
+
+func (e *ExecP2P) notifyDeparture(event network.PeerEvent) {
+	d := Departure{PeerID: event.PeerID, Reason: event.Reason}
+	if e.currentRoom != nil {
+		d.RoomID = e.currentRoom.ID
+	}
+	select {
+	case e.departureNotices <- d:
+	default:
+		// nobody is listening
+	}
+}
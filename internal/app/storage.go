@@ -0,0 +1,48 @@
+package app
+
+import (
+	"fmt"
+	"path/filepath"
+
+	"execp2p/internal/config"
+	"execp2p/internal/keystore"
+	"execp2p/internal/logger"
+	"execp2p/internal/storage"
+)
+
+// openStorage opens the encrypted local database. It unlocks with the
+// identity keystore; an ephemeral identity gets a database in memory.
+func openStorage(cfg *config.Config, identity identityState) (*storage.DB, error) {
+	if !identity.persistent {
+		return storage.OpenMemory(), nil
+	}
+	dir, err := DataDir(cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	key, err := keystore.New(dir).StorageKey([]byte(cfg.Identity.Passphrase))
+	if err != nil {
+		return nil, fmt.Errorf("failed to derive storage key: %w", err)
+	}
+	db, err := storage.Open(filepath.Join(dir, storage.DirName), key)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open local storage: %w", err)
+	}
+	return db, nil
+}
+
+// Storage returns the encrypted local database
+func (e *ExecP2P) Storage() *storage.DB {
+	return e.db
+}
+
+// closeStorage closes the local database
+func (e *ExecP2P) closeStorage() {
+	if e.db == nil {
+		return
+	}
+	if err := e.db.Close(); err != nil {
+		logger.L().Warn("Failed to close local storage", "err", err)
+	}
+}
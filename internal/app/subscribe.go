@@ -0,0 +1,82 @@
+package app
+
+import (
+	"sync"
+
+	"execp2p/internal/crypto"
+	"execp2p/internal/logger"
+)
+
+// defaultSubscriptionBuffer is how many messages a subscriber may fall behind
+// before new ones are dropped for it
+const defaultSubscriptionBuffer = 256
+
+// subscriptions fans incoming messages out to every consumer (GUI, library
+// users) so none of them takes messages away from the others
+type subscriptions struct {
+	mu     sync.Mutex
+	next   int
+	subs   map[int]chan *crypto.MessagePayload
+	closed bool
+}
+
+// Subscribe returns a channel of incoming decrypted messages and a function
+// that ends the subscription. The channel is closed when the subscription
+// ends or the app is closed. A subscriber that falls more than buffer
+// messages behind misses the newer ones.
+func (e *ExecP2P) Subscribe(buffer int) (<-chan *crypto.MessagePayload, func()) {
+	if buffer <= 0 {
+		buffer = defaultSubscriptionBuffer
+	}
+	ch := make(chan *crypto.MessagePayload, buffer)
+
+	s := &e.subscriptions
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.closed {
+		close(ch)
+		return ch, func() {}
+	}
+	if s.subs == nil {
+		s.subs = make(map[int]chan *crypto.MessagePayload)
+	}
+	id := s.next
+	s.next++
+	s.subs[id] = ch
+
+	var once sync.Once
+	return ch, func() {
+		once.Do(func() {
+			s.mu.Lock()
+			defer s.mu.Unlock()
+			if sub, ok := s.subs[id]; ok {
+				delete(s.subs, id)
+				close(sub)
+			}
+		})
+	}
+}
+
+// publish hands an incoming message to every subscriber without blocking
+func (s *subscriptions) publish(msg *crypto.MessagePayload) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, ch := range s.subs {
+		select {
+		case ch <- msg:
+		default:
+			logger.L().Warn("Subscriber is not keeping up; message dropped for it", "message_id", msg.MessageID)
+		}
+	}
+}
+
+// closeAll ends every subscription
+func (s *subscriptions) closeAll() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.closed = true
+	for id, ch := range s.subs {
+		delete(s.subs, id)
+		close(ch)
+	}
+}
@@ -0,0 +1,210 @@
+package app
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"execp2p/internal/logger"
+	"execp2p/internal/network"
+)
+
+// Long transfers (files, media bodies, history sync) get a transfer ID, so
+// the GUI can show their progress and cancel them. Media transfers use the
+// media ID; cancelling resets the media stream, which the other end sees as
+// network.ErrMediaCanceled. A history sync is cancelled with a control
+// message (see historysync.go).
+
+// transfer kinds
+const (
+	TransferFile    = "file"
+	TransferMedia   = "media"
+	TransferHistory = "history"
+)
+
+// transfer directions
+const (
+	TransferSend    = "send"
+	TransferReceive = "receive"
+)
+
+// progress is reported at most this often per transfer
+const transferProgressInterval = 200 * time.Millisecond
+
+// ErrTransferCanceled means a transfer was cancelled, here or by the peer
+var ErrTransferCanceled = errors.New("transfer canceled")
+
+// Transfer is the state of a transfer: Bytes grows up to Total (0 when not
+// known yet), then a last notice has Done set and Err if it failed
+type Transfer struct {
+	ID        string
+	Kind      string
+	Direction string
+	Name      string
+	Bytes     int64
+	Total     int64
+	Done      bool
+	Err       error
+}
+
+// Canceled reports whether the transfer was cancelled
+func (t Transfer) Canceled() bool {
+	return errors.Is(t.Err, ErrTransferCanceled)
+}
+
+// transfers are the transfers in progress
+type transfers struct {
+	notices chan Transfer
+
+	mu     sync.Mutex
+	active map[string]*activeTransfer
+}
+
+type activeTransfer struct {
+	info   Transfer
+	bytes  atomic.Int64
+	total  atomic.Int64
+	cancel func()
+	done   chan struct{}
+}
+
+func newTransfers() *transfers {
+	return &transfers{notices: make(chan Transfer, 64), active: make(map[string]*activeTransfer)}
+}
+
+// TransferNotices delivers transfer progress and outcomes to the GUI
+func (e *ExecP2P) TransferNotices() <-chan Transfer {
+	return e.transfers.notices
+}
+
+// Transfers returns the transfers in progress
+func (e *ExecP2P) Transfers() []Transfer {
+	t := e.transfers
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	list := make([]Transfer, 0, len(t.active))
+	for _, a := range t.active {
+		list = append(list, a.snapshot())
+	}
+	return list
+}
+
+// CancelTransfer aborts a transfer in progress on both ends
+func (e *ExecP2P) CancelTransfer(id string) error {
+	t := e.transfers
+	t.mu.Lock()
+	a, ok := t.active[id]
+	t.mu.Unlock()
+	if !ok {
+		return fmt.Errorf("no transfer %s in progress", id)
+	}
+	logger.L().Info("Canceling transfer", "id", id, "kind", a.info.Kind)
+	a.cancel()
+	return nil
+}
+
+// start registers a transfer; cancel aborts it. Progress is reported until
+// finish is called.
+func (t *transfers) start(info Transfer, cancel func()) *activeTransfer {
+	a := &activeTransfer{info: info, cancel: cancel, done: make(chan struct{})}
+	a.total.Store(info.Total)
+	t.mu.Lock()
+	t.active[info.ID] = a
+	t.mu.Unlock()
+	go t.report(a)
+	return a
+}
+
+// finish ends a transfer and reports its outcome
+func (t *transfers) finish(a *activeTransfer, err error) {
+	t.mu.Lock()
+	if t.active[a.info.ID] == a {
+		delete(t.active, a.info.ID)
+	}
+	t.mu.Unlock()
+	close(a.done)
+
+	if errors.Is(err, context.Canceled) || errors.Is(err, network.ErrMediaCanceled) {
+		err = fmt.Errorf("%w: %v", ErrTransferCanceled, err)
+	}
+	info := a.snapshot()
+	info.Done, info.Err = true, err
+	// the outcome must not be lost behind progress notices
+	select {
+	case t.notices <- info:
+	case <-time.After(time.Second):
+		logger.L().Warn("Transfer notice dropped", "id", info.ID)
+	}
+}
+
+// report sends progress notices while the transfer moves
+func (t *transfers) report(a *activeTransfer) {
+	ticker := time.NewTicker(transferProgressInterval)
+	defer ticker.Stop()
+	var last int64
+	for {
+		select {
+		case <-a.done:
+			return
+		case <-ticker.C:
+			if n := a.bytes.Load(); n != last {
+				last = n
+				select {
+				case t.notices <- a.snapshot():
+				default:
+				}
+			}
+		}
+	}
+}
+
+func (a *activeTransfer) snapshot() Transfer {
+	info := a.info
+	info.Bytes, info.Total = a.bytes.Load(), a.total.Load()
+	return info
+}
+
+// reader counts the bytes read through r as progress
+func (a *activeTransfer) reader(r io.Reader) io.Reader {
+	return &progressReader{r: r, a: a}
+}
+
+// progressReader counts the bytes read through it
+type progressReader struct {
+	r io.Reader
+	a *activeTransfer
+}
+
+func (p *progressReader) Read(b []byte) (int, error) {
+	n, err := p.r.Read(b)
+	p.a.bytes.Add(int64(n))
+	return n, err
+}
+
+// transferKind tells files from pictures and voice messages
+func transferKind(contentType string) string {
+	if contentType == fileContentType {
+		return TransferFile
+	}
+	return TransferMedia
+}
+
+// sendMediaStream sends a media body as a transfer that can be cancelled
+func (e *ExecP2P) sendMediaStream(ctx context.Context, qnet *network.QuicNetwork, header network.MediaHeader, body io.Reader) error {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	a := e.transfers.start(Transfer{
+		ID:        header.ID,
+		Kind:      transferKind(header.ContentType),
+		Direction: TransferSend,
+		Name:      header.Name,
+		Total:     header.Size,
+	}, cancel)
+	err := qnet.SendMedia(ctx, header, a.reader(body))
+	e.transfers.finish(a, err)
+	return err
+}
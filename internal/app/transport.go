@@ -0,0 +1,93 @@
+package app
+
+import (
+	"sync"
+	"time"
+
+	"execp2p/internal/config"
+	"execp2p/internal/discovery"
+	"execp2p/internal/network"
+)
+
+// natCheckTTL is how long the result of a NAT check is reused
+const natCheckTTL = 10 * time.Minute
+
+// TransportInfo describes the connection to the room
+type TransportInfo struct {
+	// "quic", "libp2p" or "webrtc" (network.transport), empty when not in
+	// a room
+	Protocol string `json:"protocol"`
+	// how the host was reached: "direct", "local_discovery", "localhost",
+	// "signaling", "libp2p" or "webrtc"; "host" when we host the room
+	Method     string `json:"method"`
+	LocalAddr  string `json:"local_addr,omitempty"`
+	RemoteAddr string `json:"remote_addr,omitempty"`
+}
+
+// NATStatus is the outcome of the last NAT check
+type NATStatus struct {
+	discovery.NATInfo
+	CheckedAt time.Time `json:"checked_at"`
+	// why the check failed, e.g. UDP to the STUN servers is blocked
+	Error string `json:"error,omitempty"`
+}
+
+type natState struct {
+	mu     sync.Mutex
+	status NATStatus
+}
+
+// Transport describes the current connection to the room
+func (e *ExecP2P) Transport() TransportInfo {
+	transport := e.state().network
+	if transport == nil {
+		return TransportInfo{}
+	}
+	info := TransportInfo{Protocol: e.config.Network.Transport, Method: e.joinMethod}
+	if transport.IsListener() {
+		info.Method = "host"
+	}
+	if qnet, ok := transport.(*network.QuicNetwork); ok {
+		info.LocalAddr, info.RemoteAddr = qnet.Addrs()
+	}
+	return info
+}
+
+// networkFactory is the transport network.transport selects
+func networkFactory(cfg *config.Config) (network.Factory, error) {
+	switch cfg.Network.Transport {
+	case "libp2p":
+		bootstrap := cfg.Network.Libp2pBootstrap
+		if len(bootstrap) == 0 {
+			bootstrap = network.DefaultLibp2pBootstrap()
+		}
+		return network.NewLibp2pFactory(network.Libp2pOptions{Bootstrap: bootstrap})
+	case "webrtc":
+		var ice []string
+		for _, server := range discovery.StunServers {
+			ice = append(ice, "stun:"+server)
+		}
+		return network.NewWebRTCFactory(network.WebRTCOptions{
+			Signaler:   discovery.NewRTCSignaling(discovery.NewSignalingConfig(cfg.Discovery.SignalingServer)),
+			ICEServers: ice,
+		})
+	default:
+		return network.NewNetwork, nil
+	}
+}
+
+// NATStatus tells whether we are behind a NAT. The STUN servers are asked
+// at most once per natCheckTTL, so the first call may take a few seconds.
+func (e *ExecP2P) NATStatus() NATStatus {
+	e.nat.mu.Lock()
+	defer e.nat.mu.Unlock()
+	if !e.nat.status.CheckedAt.IsZero() && time.Since(e.nat.status.CheckedAt) < natCheckTTL {
+		return e.nat.status
+	}
+	info, err := discovery.DetectNAT()
+	e.nat.status = NATStatus{NATInfo: info, CheckedAt: time.Now()}
+	if err != nil {
+		e.nat.status.Error = err.Error()
+	}
+	return e.nat.status
+}
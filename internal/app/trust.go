@@ -0,0 +1,174 @@
+package app
+
+import (
+	"fmt"
+	"time"
+
+	"execp2p/internal/config"
+	"execp2p/internal/logger"
+	"execp2p/internal/trust"
+)
+
+// FingerprintChange is raised when a known peer presents a different
+// identity, or with Certificate set, its pinned identity over a different
+// TLS certificate
+type FingerprintChange struct {
+	PeerID      string    `json:"peer_id"`
+	Pinned      string    `json:"pinned_fingerprint"`
+	Presented   string    `json:"presented_fingerprint"`
+	FirstSeen   time.Time `json:"first_seen"`
+	Refused     bool      `json:"refused"`
+	Certificate bool      `json:"certificate,omitempty"`
+}
+
+// openTrustStore opens the pin database next to a persistent identity.
+// Ephemeral sessions keep their pins in memory only.
+func openTrustStore(cfg *config.Config, persistent bool) (*trust.Store, error) {
+	if !persistent {
+		return trust.NewMemoryStore(), nil
+	}
+	dir, err := DataDir(cfg)
+	if err != nil {
+		return nil, err
+	}
+	store, err := trust.Open(dir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open trust store: %w", err)
+	}
+	return store, nil
+}
+
+// verifyPeerIdentity is the network's PeerVerifier: it pins new peers and
+// quarantines known peers whose fingerprint changed, refusing them too
+// unless the policy is "warn"
+func (e *ExecP2P) verifyPeerIdentity(peerID, fingerprint string) error {
+	result, pinned, err := e.trust.Check(peerID, fingerprint)
+	if err != nil {
+		logger.L().Warn("Failed to save trust store", "err", err)
+	}
+
+	switch result {
+	case trust.ResultPinned:
+		logger.L().Info("Pinned new peer identity", "peer", peerID, "fingerprint", fingerprint)
+		e.pinsMu.Lock()
+		e.sessionPins[peerID] = struct{}{}
+		e.pinsMu.Unlock()
+	case trust.ResultChanged:
+		refuse := e.config.Trust.OnFingerprintChange != trust.PolicyWarn
+		logger.L().Warn("Peer identity fingerprint changed",
+			"peer", peerID, "pinned", pinned.Fingerprint, "presented", fingerprint, "refused", refuse)
+
+		e.notifyFingerprintChange(FingerprintChange{
+			PeerID:    peerID,
+			Pinned:    pinned.Fingerprint,
+			Presented: fingerprint,
+			FirstSeen: pinned.FirstSeen,
+			Refused:   refuse,
+		})
+		e.quarantine(trust.Quarantine{
+			PeerID:      peerID,
+			Fingerprint: fingerprint,
+			Reason:      trust.ReasonIdentityChanged,
+			Expected:    pinned.Fingerprint,
+			Presented:   fingerprint,
+			Refused:     refuse,
+		})
+		if refuse {
+			return &trust.ChangedError{
+				PeerID:    peerID,
+				Pinned:    pinned.Fingerprint,
+				Presented: fingerprint,
+				FirstSeen: pinned.FirstSeen,
+			}
+		}
+	}
+	return nil
+}
+
+// verifyPeerCertificate is the network's CertVerifier: it pins the TLS
+// certificate a known identity first connects with and treats a different
+// one later like a changed identity
+func (e *ExecP2P) verifyPeerCertificate(peerID, fingerprint, certFingerprint string) error {
+	result, pinned, err := e.trust.CheckCertificate(peerID, fingerprint, certFingerprint)
+	if err != nil {
+		logger.L().Warn("Failed to save trust store", "err", err)
+	}
+
+	switch result {
+	case trust.ResultPinned:
+		logger.L().Info("Pinned peer TLS certificate", "peer", peerID, "certificate", certFingerprint)
+	case trust.ResultChanged:
+		refuse := e.config.Trust.OnFingerprintChange != trust.PolicyWarn
+		logger.L().Warn("Peer TLS certificate changed",
+			"peer", peerID, "pinned", pinned.TLSFingerprint, "presented", certFingerprint, "refused", refuse)
+
+		e.notifyFingerprintChange(FingerprintChange{
+			PeerID:      peerID,
+			Pinned:      pinned.TLSFingerprint,
+			Presented:   certFingerprint,
+			FirstSeen:   pinned.FirstSeen,
+			Refused:     refuse,
+			Certificate: true,
+		})
+		e.quarantine(trust.Quarantine{
+			PeerID:      peerID,
+			Fingerprint: fingerprint,
+			Reason:      trust.ReasonCertificateChanged,
+			Expected:    pinned.TLSFingerprint,
+			Presented:   certFingerprint,
+			Refused:     refuse,
+		})
+		if refuse {
+			return &trust.ChangedError{
+				PeerID:      peerID,
+				Pinned:      pinned.TLSFingerprint,
+				Presented:   certFingerprint,
+				FirstSeen:   pinned.FirstSeen,
+				Certificate: true,
+			}
+		}
+	}
+	return nil
+}
+
+func (e *ExecP2P) notifyFingerprintChange(change FingerprintChange) {
+	select {
+	case e.fingerprintChanges <- change:
+	default:
+		logger.L().Warn("Fingerprint change alert dropped; nobody is listening")
+	}
+}
+
+// FingerprintChanges delivers an alert whenever a known peer presents a
+// different identity fingerprint
+func (e *ExecP2P) FingerprintChanges() <-chan FingerprintChange {
+	return e.fingerprintChanges
+}
+
+// PinnedPeers lists the peers whose fingerprints we have pinned
+func (e *ExecP2P) PinnedPeers() []trust.Entry {
+	return e.trust.List()
+}
+
+// ForgetPeer removes a pin so the peer's next fingerprint is trusted anew
+func (e *ExecP2P) ForgetPeer(peerID string) error {
+	return e.trust.Forget(peerID)
+}
+
+// PinPeer accepts a new fingerprint for a peer, e.g. after it was verified
+// out of band following a fingerprint change
+func (e *ExecP2P) PinPeer(peerID, fingerprint string) error {
+	if peerID == "" || fingerprint == "" {
+		return fmt.Errorf("peer ID and fingerprint are required")
+	}
+	return e.trust.Pin(peerID, fingerprint)
+}
+
+// PinPeerCertificate accepts a new TLS certificate for a pinned peer, e.g.
+// after it was confirmed out of band following a certificate change
+func (e *ExecP2P) PinPeerCertificate(peerID, certFingerprint string) error {
+	if peerID == "" || certFingerprint == "" {
+		return fmt.Errorf("peer ID and certificate fingerprint are required")
+	}
+	return e.trust.PinCertificate(peerID, certFingerprint)
+}
@@ -0,0 +1,22 @@
+package app
+
+import "execp2p/internal/crypto"
+
+// UnreadCount returns how many chat messages arrived in the session's room
+// since it was last marked read
+func (e *ExecP2P) UnreadCount() int {
+	return int(e.unread.Load())
+}
+
+// MarkRead marks every message of the session's room as read
+func (e *ExecP2P) MarkRead() {
+	e.unread.Store(0)
+}
+
+// countUnread counts an incoming message as unread unless it is a
+// keep-alive or a nickname update
+func (e *ExecP2P) countUnread(msg *crypto.MessagePayload) {
+	if isChatMessage(msg.Message) {
+		e.unread.Add(1)
+	}
+}
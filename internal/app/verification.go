@@ -0,0 +1,157 @@
+package app
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"execp2p/internal/logger"
+	"execp2p/internal/trust"
+	"execp2p/internal/verification"
+)
+
+// ErrPeerNotVerified is returned by the strict-mode sender policy
+var ErrPeerNotVerified = errors.New("peer identity has not been verified by the user")
+
+// PeerVerification is a peer's place in the verification state machine:
+// unverified → keys exchanged → user verified
+type PeerVerification struct {
+	PeerID      string
+	State       trust.State
+	Fingerprint string
+	VerifiedAt  time.Time
+	Method      string
+}
+
+// VerificationCode returns the code to show to a peer in the current room.
+// With an empty peerID the first connected peer is used.
+func (e *ExecP2P) VerificationCode(peerID string) (verification.Code, error) {
+	if e.currentRoom == nil || e.network == nil {
+		return verification.Code{}, fmt.Errorf("nie jesteśmy połączeni z żadnym pokojem")
+	}
+	own, err := e.pqCrypto.GetIdentityFingerprint()
+	if err != nil {
+		return verification.Code{}, err
+	}
+
+	if peerID == "" {
+		if peers := e.connectedPeers(); len(peers) > 0 {
+			peerID = peers[0]
+		}
+	}
+	// without a peer the code still proves our own fingerprint
+	peerFingerprint := ""
+	if peerID != "" {
+		peerFingerprint, _ = e.pqCrypto.GetPeerFingerprint(peerID)
+	}
+	return verification.NewCode(e.peerID, own, e.currentRoom.ID, peerFingerprint), nil
+}
+
+// VerifyScannedCode checks a code scanned from a peer's screen and
+// remembers the peer as verified
+func (e *ExecP2P) VerifyScannedCode(payload string) (verification.Result, error) {
+	if e.currentRoom == nil {
+		return verification.Result{}, fmt.Errorf("nie jesteśmy połączeni z żadnym pokojem")
+	}
+	code, err := verification.Parse(payload)
+	if err != nil {
+		return verification.Result{}, err
+	}
+	own, err := e.pqCrypto.GetIdentityFingerprint()
+	if err != nil {
+		return verification.Result{}, err
+	}
+
+	result, err := verification.Check(code, verification.Session{
+		Fingerprint:      own,
+		RoomID:           e.currentRoom.ID,
+		PeerFingerprints: e.getPeerFingerprints(),
+	}, time.Now())
+	if err != nil {
+		logger.L().Warn("QR verification failed", "peer", code.PeerID, "err", err)
+		return verification.Result{}, err
+	}
+
+	if err := e.trust.MarkVerified(result.PeerID, result.Fingerprint, trust.MethodQR); err != nil {
+		return verification.Result{}, fmt.Errorf("failed to record verification: %w", err)
+	}
+
+	logger.L().Info("Peer verified by QR code", "peer", result.PeerID, "mutual", result.Mutual)
+	return result, nil
+}
+
+// MarkPeerVerified records that the user compared a peer's fingerprint out
+// of band. A connected peer's current fingerprint is used, otherwise the
+// pinned one.
+func (e *ExecP2P) MarkPeerVerified(peerID string) error {
+	fingerprint, err := e.pqCrypto.GetPeerFingerprint(peerID)
+	if err != nil {
+		entry, ok := e.trust.Get(peerID)
+		if !ok {
+			return fmt.Errorf("unknown peer %s", peerID)
+		}
+		fingerprint = entry.Fingerprint
+	}
+	if err := e.trust.MarkVerified(peerID, fingerprint, trust.MethodManual); err != nil {
+		return err
+	}
+	logger.L().Info("Peer marked as verified", "peer", peerID)
+	return nil
+}
+
+// UnverifyPeer withdraws the user's verification of a peer
+func (e *ExecP2P) UnverifyPeer(peerID string) error {
+	return e.trust.ClearVerified(peerID)
+}
+
+// PeerVerificationState returns how far a peer has been verified. User
+// verification only counts for the fingerprint that was verified.
+func (e *ExecP2P) PeerVerificationState(peerID string) PeerVerification {
+	v := PeerVerification{PeerID: peerID, State: trust.StateUnverified}
+
+	current, err := e.pqCrypto.GetPeerFingerprint(peerID)
+	if err == nil {
+		v.Fingerprint = current
+		if e.pqCrypto.HasSession(peerID) {
+			v.State = trust.StateKeysExchanged
+		}
+	}
+
+	if entry, ok := e.trust.Get(peerID); ok && entry.Verified() {
+		if v.Fingerprint == "" {
+			v.Fingerprint = entry.Fingerprint
+		}
+		if entry.Fingerprint == v.Fingerprint {
+			v.State = trust.StateUserVerified
+			v.VerifiedAt = entry.VerifiedAt
+			v.Method = entry.VerifiedMethod
+		}
+	}
+	return v
+}
+
+// RequireVerified reports whether strict mode is on
+func (e *ExecP2P) RequireVerified() bool {
+	return e.config.Trust.RequireVerified
+}
+
+// SetRequireVerified turns strict mode on or off: when on, messages from
+// peers the user hasn't verified are dropped without being decrypted
+func (e *ExecP2P) SetRequireVerified(required bool) {
+	e.config.Trust.RequireVerified = required
+	logger.L().Info("Strict verification mode changed", "enabled", required)
+}
+
+// allowSender is the network's SenderPolicy
+func (e *ExecP2P) allowSender(senderID string) error {
+	if _, ok := e.trust.Quarantined(senderID); ok {
+		return ErrPeerQuarantined
+	}
+	if !e.config.Trust.RequireVerified {
+		return nil
+	}
+	if e.PeerVerificationState(senderID).State != trust.StateUserVerified {
+		return ErrPeerNotVerified
+	}
+	return nil
+}
@@ -0,0 +1,221 @@
+package app
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"execp2p/internal/config"
+	"execp2p/internal/logger"
+	"execp2p/internal/network"
+	"execp2p/internal/voice"
+)
+
+// voiceMessageName is the name voice messages are sent under
+const voiceMessageName = "Wiadomość głosowa"
+
+// VoicePlayback tells the GUI that playback of a voice message started or
+// ended
+type VoicePlayback struct {
+	MediaID string
+	Playing bool
+}
+
+// VoiceMessage is a sent voice message
+type VoiceMessage struct {
+	MediaID  string
+	Duration time.Duration
+	Waveform []byte
+}
+
+// voiceState is the recording and the playback in progress
+type voiceState struct {
+	engine *voice.Engine
+	// why the engine is missing, for the GUI
+	unavailable error
+	notices     chan VoicePlayback
+
+	mu        sync.Mutex
+	recording *voice.Recording
+	playback  *voice.Playback
+}
+
+// newVoice finds ffmpeg; voice messages fall back to the web view without it
+func newVoice(cfg *config.Config) *voiceState {
+	v := &voiceState{notices: make(chan VoicePlayback, 8)}
+	v.engine, v.unavailable = voice.NewEngine(voice.Options{
+		FFmpegPath:  cfg.Voice.FFmpegPath,
+		Input:       cfg.Voice.Input,
+		Bitrate:     cfg.Voice.Bitrate,
+		MaxDuration: cfg.Voice.MaxDuration,
+	})
+	if v.unavailable != nil {
+		logger.L().Info("Native voice messages are unavailable", "err", v.unavailable)
+	}
+	return v
+}
+
+// VoiceSupport reports whether voice messages are recorded and played
+// natively; if they aren't recorded, reason says why
+func (e *ExecP2P) VoiceSupport() (record, play bool, reason error) {
+	if e.voice.engine == nil {
+		return false, false, e.voice.unavailable
+	}
+	return true, e.voice.engine.CanPlay(), nil
+}
+
+// VoicePlaybackNotices delivers playback starts and ends to the GUI
+func (e *ExecP2P) VoicePlaybackNotices() <-chan VoicePlayback {
+	return e.voice.notices
+}
+
+// StartVoiceRecording starts capturing the microphone
+func (e *ExecP2P) StartVoiceRecording() error {
+	v := e.voice
+	if v.engine == nil {
+		return v.unavailable
+	}
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	if v.recording != nil {
+		return fmt.Errorf("already recording")
+	}
+	rec, err := v.engine.Record()
+	if err != nil {
+		return err
+	}
+	v.recording = rec
+	return nil
+}
+
+// StopVoiceRecording ends the recording, encodes it to Opus and sends it
+// as a voice message with its duration and waveform
+func (e *ExecP2P) StopVoiceRecording(ctx context.Context) (VoiceMessage, error) {
+	v := e.voice
+	v.mu.Lock()
+	rec := v.recording
+	v.recording = nil
+	v.mu.Unlock()
+	if rec == nil {
+		return VoiceMessage{}, fmt.Errorf("not recording")
+	}
+
+	pcm, err := rec.Stop()
+	if err != nil {
+		return VoiceMessage{}, err
+	}
+	clip, err := v.engine.Encode(ctx, pcm)
+	if err != nil {
+		return VoiceMessage{}, err
+	}
+	qnet, ok := e.network.(*network.QuicNetwork)
+	if !ok {
+		return VoiceMessage{}, fmt.Errorf("not connected to a room")
+	}
+	id, err := e.streamMedia(ctx, qnet, clip.ContentType, voiceMessageName, clip.Data)
+	if err != nil {
+		return VoiceMessage{}, err
+	}
+	sent := VoiceMessage{MediaID: id, Duration: clip.Duration, Waveform: clip.Waveform}
+	return sent, e.sendMediaMessage(ctx, mediaMessage{
+		Type:        "audio",
+		Content:     voiceMessageName,
+		MediaID:     id,
+		ContentType: clip.ContentType,
+		Size:        int64(len(clip.Data)),
+		DurationMs:  clip.Duration.Milliseconds(),
+		Waveform:    clip.Waveform,
+	})
+}
+
+// CancelVoiceRecording ends the recording without sending it
+func (e *ExecP2P) CancelVoiceRecording() {
+	v := e.voice
+	v.mu.Lock()
+	rec := v.recording
+	v.recording = nil
+	v.mu.Unlock()
+	if rec != nil {
+		rec.Cancel()
+	}
+}
+
+// PlayVoice plays a voice message, stopping the one playing
+func (e *ExecP2P) PlayVoice(id string) error {
+	v := e.voice
+	if v.engine == nil {
+		return v.unavailable
+	}
+	item, ok := e.media.Get(id)
+	if !ok {
+		return fmt.Errorf("voice message %s not available", id)
+	}
+	e.StopVoicePlayback()
+
+	playback, err := v.engine.Play(item.Data)
+	if err != nil {
+		return err
+	}
+	v.mu.Lock()
+	v.playback = playback
+	v.mu.Unlock()
+	v.notify(VoicePlayback{MediaID: id, Playing: true})
+
+	go func() {
+		<-playback.Done()
+		v.mu.Lock()
+		if v.playback == playback {
+			v.playback = nil
+		}
+		v.mu.Unlock()
+		v.notify(VoicePlayback{MediaID: id})
+	}()
+	return nil
+}
+
+// StopVoicePlayback stops the voice message playing, if any
+func (e *ExecP2P) StopVoicePlayback() {
+	v := e.voice
+	v.mu.Lock()
+	playback := v.playback
+	v.mu.Unlock()
+	if playback != nil {
+		playback.Stop()
+	}
+}
+
+// analyzeVoice measures a voice message recorded by the web view; without
+// ffmpeg it goes out without a waveform
+func (e *ExecP2P) analyzeVoice(ctx context.Context, msg *mediaMessage, data []byte) {
+	if e.voice.engine == nil {
+		return
+	}
+	duration, waveform, err := e.voice.engine.Analyze(ctx, data)
+	if err != nil {
+		logger.L().Debug("Voice message not analysed", "err", err)
+		return
+	}
+	msg.DurationMs, msg.Waveform = duration.Milliseconds(), waveform
+}
+
+func (v *voiceState) notify(n VoicePlayback) {
+	select {
+	case v.notices <- n:
+	default:
+	}
+}
+
+// close stops a recording or playback in progress
+func (v *voiceState) close() {
+	v.mu.Lock()
+	rec, playback := v.recording, v.playback
+	v.recording = nil
+	v.mu.Unlock()
+	if rec != nil {
+		rec.Cancel()
+	}
+	if playback != nil {
+		playback.Stop()
+	}
+}
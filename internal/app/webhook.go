@@ -0,0 +1,82 @@
+package app
+
+import (
+	"fmt"
+
+	"execp2p/internal/config"
+	"execp2p/internal/crypto"
+	"execp2p/internal/logger"
+	"execp2p/internal/webhook"
+)
+
+// openWebhook starts the configured webhook; nil if there is none
+func openWebhook(cfg *config.Config) (*webhook.Hook, error) {
+	if cfg.Webhook.URL == "" {
+		return nil, nil
+	}
+	hook, err := webhook.New(webhook.Options{URL: cfg.Webhook.URL, Secret: cfg.Webhook.Secret})
+	if err != nil {
+		return nil, fmt.Errorf("failed to set up webhook: %w", err)
+	}
+	logger.L().Info("Room events are posted to a local webhook", "signed", cfg.Webhook.Secret != "")
+	return hook, nil
+}
+
+// closeWebhook posts the queued events and stops the webhook
+func (e *ExecP2P) closeWebhook() {
+	if e.webhook != nil {
+		e.webhook.Close()
+		e.webhook = nil
+	}
+}
+
+// webhookRoom returns the room events can be posted for: incognito rooms
+// leave no trace outside the app
+func (e *ExecP2P) webhookRoom() (string, bool) {
+	if e.webhook == nil || e.currentRoom == nil || e.IsIncognito() {
+		return "", false
+	}
+	return e.currentRoom.ID, true
+}
+
+// postMessage tells the webhook about a delivered chat message
+func (e *ExecP2P) postMessage(payload *crypto.MessagePayload, outgoing bool) {
+	roomID, ok := e.webhookRoom()
+	if !ok || outgoing || payload.SenderID == e.peerID || !isChatMessage(payload.Message) {
+		return
+	}
+	e.webhook.Send(webhook.EventMessage, roomID, webhook.Message{
+		MessageID:  payload.MessageID,
+		SenderID:   payload.SenderID,
+		SenderName: e.DisplayName(payload.SenderID),
+		Timestamp:  payload.Timestamp,
+		Message:    payload.Message,
+	})
+}
+
+// notifyPeerChanges tells the webhook about peers that connected or left
+// since the last call, given the peers seen then; it returns the peers now
+func (e *ExecP2P) notifyPeerChanges(before map[string]struct{}) map[string]struct{} {
+	roomID, ok := e.webhookRoom()
+	if !ok || e.network == nil {
+		return nil
+	}
+	fingerprints := e.PeerFingerprints()
+	now := make(map[string]struct{})
+	for _, peerID := range e.connectedPeers() {
+		now[peerID] = struct{}{}
+		if _, known := before[peerID]; !known {
+			e.webhook.Send(webhook.EventPeerConnected, roomID, webhook.Peer{
+				PeerID:      peerID,
+				Name:        e.DisplayName(peerID),
+				Fingerprint: fingerprints[peerID],
+			})
+		}
+	}
+	for peerID := range before {
+		if _, still := now[peerID]; !still {
+			e.webhook.Send(webhook.EventPeerDisconnected, roomID, webhook.Peer{PeerID: peerID, Name: e.DisplayName(peerID)})
+		}
+	}
+	return now
+}
@@ -0,0 +1,164 @@
+package app
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	"execp2p/internal/crash"
+	"execp2p/internal/crypto"
+	"execp2p/internal/logger"
+	"execp2p/internal/storage"
+	"execp2p/internal/xmpp"
+)
+
+// gatewaySendTimeout bounds sending one message from the MUC to the room
+const gatewaySendTimeout = 10 * time.Second
+
+// how our presence is shown in the MUC and the MUC's in the room
+var (
+	xmppShows = map[Presence]string{
+		PresenceAway: "away",
+		PresenceDND:  "dnd",
+	}
+	xmppShowLabels = map[string]string{
+		"away": "zaraz wracam",
+		"xa":   "zaraz wracam",
+		"dnd":  "nie przeszkadzać",
+	}
+)
+
+// gatewayMessage is a message from the MUC as sent to the room: text the
+// frontends show as it is, marked so it isn't sent back
+type gatewayMessage struct {
+	Type    string `json:"type"`
+	Content string `json:"content"`
+	Via     string `json:"via"`
+	Author  string `json:"author"`
+}
+
+// openGateway starts the configured XMPP gateway (host only). The room's
+// decrypted messages leave through it, so it is announced among the
+// archive sinks of the room metadata.
+func (e *ExecP2P) openGateway() error {
+	cfg := e.config.XMPP
+	if cfg.Server == "" {
+		return nil
+	}
+	if err := storage.Allow(e.currentRoom.ID); err != nil {
+		return fmt.Errorf("an incognito room cannot be mirrored in XMPP: %w", err)
+	}
+	gw, err := xmpp.New(xmpp.Options{
+		Server: cfg.Server,
+		Domain: cfg.Domain,
+		Secret: cfg.Secret,
+		Room:   cfg.Room,
+		Nick:   cfg.Nick,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to start XMPP gateway: %w", err)
+	}
+	e.gateway, e.gatewaySince = gw, time.Now().UTC()
+	logger.L().Warn("Room traffic is mirrored in an XMPP MUC", "room", cfg.Room)
+	e.syncGateway()
+	go e.relayGateway(gw)
+	return nil
+}
+
+// closeGateway takes the room's members out of the MUC, if mirrored
+func (e *ExecP2P) closeGateway() {
+	if e.gateway == nil {
+		return
+	}
+	e.gateway.Close()
+	e.gateway = nil
+}
+
+// syncGateway shows us and the connected peers in the MUC, with their
+// names and presence
+func (e *ExecP2P) syncGateway() {
+	if e.gateway == nil {
+		return
+	}
+	ids := append([]string{e.peerID}, e.connectedPeers()...)
+	members := make([]xmpp.Member, 0, len(ids))
+	for _, id := range ids {
+		members = append(members, xmpp.Member{ID: id, Nick: e.DisplayName(id), Show: xmppShows[e.PeerPresence(id)]})
+	}
+	e.gateway.Sync(members)
+}
+
+// mirrorMessage posts a sent or delivered chat message to the MUC as its
+// sender; messages that came from the MUC are not sent back
+func (e *ExecP2P) mirrorMessage(payload *crypto.MessagePayload) {
+	if e.gateway == nil || !isChatMessage(payload.Message) {
+		return
+	}
+	var msg gatewayMessage
+	if json.Unmarshal([]byte(payload.Message), &msg) == nil && msg.Via == xmpp.SinkXMPP {
+		return
+	}
+	text := messageText(payload.Message)
+	if text == "" {
+		return
+	}
+	err := e.gateway.Send(payload.SenderID, text)
+	if err != nil {
+		// a peer that has just connected may not be in the MUC yet
+		e.syncGateway()
+		err = e.gateway.Send(payload.SenderID, text)
+	}
+	if err != nil {
+		logger.L().Warn("Failed to mirror message in XMPP", "sender", payload.SenderID, "err", err)
+	}
+}
+
+// relayGateway sends what the MUC's occupants write to the room until the
+// gateway is closed
+func (e *ExecP2P) relayGateway(gw *xmpp.Gateway) {
+	defer crash.Recover("app.relayGateway")
+	for m := range gw.Messages() {
+		body, err := json.Marshal(gatewayMessage{
+			Type:    "text",
+			Content: m.Nick + ": " + m.Body,
+			Via:     xmpp.SinkXMPP,
+			Author:  m.Nick,
+		})
+		if err != nil {
+			continue
+		}
+		ctx, cancel := context.WithTimeout(context.Background(), gatewaySendTimeout)
+		if err := e.SendMessage(ctx, string(body)); err != nil {
+			logger.L().Warn("Failed to send XMPP message to the room", "nick", m.Nick, "err", err)
+		}
+		cancel()
+	}
+}
+
+// registerGatewayCommand makes the bot list who is in the MUC
+func (e *ExecP2P) registerGatewayCommand() {
+	e.RegisterCommand("xmpp", func(ctx context.Context, cmd Command) (string, error) {
+		session := e
+		if s, ok := e.Session(cmd.RoomID); ok {
+			session = s
+		}
+		if session.gateway == nil {
+			return "Ten pokój nie jest połączony z XMPP", nil
+		}
+		occupants := session.gateway.Occupants()
+		if len(occupants) == 0 {
+			return "W pokoju XMPP " + e.config.XMPP.Room + " nie ma nikogo poza tym pokojem", nil
+		}
+		names := make([]string, 0, len(occupants))
+		for _, o := range occupants {
+			if label := xmppShowLabels[o.Show]; label != "" {
+				names = append(names, o.Nick+" ("+label+")")
+			} else {
+				names = append(names, o.Nick)
+			}
+		}
+		return "W pokoju XMPP " + e.config.XMPP.Room + ": " + strings.Join(names, ", "), nil
+	})
+}
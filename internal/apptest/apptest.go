@@ -0,0 +1,252 @@
+// Package apptest runs several complete ExecP2P cores in one process for
+// end-to-end tests.
+//
+// The apps of a Cluster talk over one network.MemorySwitch instead of UDP
+// and run their schedules on one clock.Fake, so a test decides when key
+// rotation checks, searches for a missing host and rejoin attempts happen
+// by calling Advance. Each app has its own data directory, an ephemeral
+// identity unless Persistent is given, its own port range and discovery
+// switched off; nothing leaves the process.
+//
+//	c := apptest.New(t)
+//	host, guest := c.Add("host"), c.Add("guest")
+//	room := host.Create()
+//	guest.Join(host, room)
+//	host.Send("hello")
+//	guest.Expect("hello")
+package apptest
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"execp2p/internal/app"
+	"execp2p/internal/clock"
+	"execp2p/internal/config"
+	"execp2p/internal/crypto"
+	"execp2p/internal/keystore"
+	"execp2p/internal/network"
+	"execp2p/internal/types"
+)
+
+// Timeout is how long the helpers wait for something to happen before
+// failing the test
+var Timeout = 15 * time.Second
+
+// the first port range handed out; each app gets portSpan ports above it
+const (
+	portBase = 20000
+	portSpan = 100
+)
+
+// Cluster is a set of apps sharing a switch and a clock
+type Cluster struct {
+	Switch *network.MemorySwitch
+	Clock  *clock.Fake
+
+	t     testing.TB
+	mu    sync.Mutex
+	peers []*Peer
+}
+
+// Peer is one app of a cluster
+type Peer struct {
+	Name   string
+	App    *app.ExecP2P
+	Config *config.Config
+
+	cluster  *Cluster
+	messages <-chan *crypto.MessagePayload
+	// messages taken from the subscription but not expected yet
+	pending []*crypto.MessagePayload
+}
+
+// Option changes the config of an app before it is made
+type Option func(*config.Config)
+
+// Ports makes the app listen in [min, max], e.g. on the ports the join
+// fallback tries on localhost
+func Ports(min, max int) Option {
+	return func(cfg *config.Config) {
+		cfg.Network.MinPort, cfg.Network.MaxPort = min, max
+	}
+}
+
+// Persistent gives the app an identity kept in its data directory, sealed
+// with passphrase, instead of an ephemeral one
+func Persistent(passphrase string) Option {
+	return func(cfg *config.Config) {
+		cfg.Identity.Ephemeral = false
+		cfg.Identity.KeystoreProtection = keystore.ProtectionPassphrase
+		cfg.Identity.Passphrase = passphrase
+	}
+}
+
+// New returns an empty cluster; its apps are closed when the test ends
+func New(t testing.TB) *Cluster {
+	t.Helper()
+	return &Cluster{
+		Switch: network.NewMemorySwitch(),
+		Clock:  clock.NewFake(time.Now()),
+		t:      t,
+	}
+}
+
+// Add makes a new app in the cluster; names must be unique
+func (c *Cluster) Add(name string, opts ...Option) *Peer {
+	c.t.Helper()
+	c.mu.Lock()
+	index := len(c.peers)
+	c.mu.Unlock()
+
+	cfg := config.DefaultConfig()
+	cfg.Identity.Ephemeral = true
+	cfg.Identity.DataDir = c.t.TempDir()
+	cfg.Network.MinPort = portBase + index*portSpan
+	cfg.Network.MaxPort = cfg.Network.MinPort + portSpan - 1
+	cfg.Discovery.EnableMDNS = false
+	cfg.Discovery.EnableBTDHT = false
+	cfg.Discovery.EnableBroadcast = false
+	cfg.Discovery.EnableDNS = false
+	cfg.Discovery.SignalingServer = ""
+	cfg.Mailbox.Server = ""
+	for _, opt := range opts {
+		opt(cfg)
+	}
+
+	e, err := app.NewExecP2P(cfg)
+	if err != nil {
+		c.t.Fatalf("%s: %v", name, err)
+	}
+	e.SetNetworkFactory(c.Switch.Factory(name))
+	e.SetClock(c.Clock)
+	messages, unsubscribe := e.Subscribe(0)
+	c.t.Cleanup(func() {
+		unsubscribe()
+		e.Close()
+	})
+
+	p := &Peer{Name: name, App: e, Config: cfg, cluster: c, messages: messages}
+	c.mu.Lock()
+	c.peers = append(c.peers, p)
+	c.mu.Unlock()
+	return p
+}
+
+// Peers returns the apps of the cluster in the order they were added
+func (c *Cluster) Peers() []*Peer {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return append([]*Peer(nil), c.peers...)
+}
+
+// Advance moves the shared clock forward by d
+func (c *Cluster) Advance(d time.Duration) {
+	c.Clock.Advance(d)
+}
+
+// Eventually fails the test unless cond holds within Timeout
+func (c *Cluster) Eventually(what string, cond func() bool) {
+	c.t.Helper()
+	deadline := time.Now().Add(Timeout)
+	for !cond() {
+		if time.Now().After(deadline) {
+			c.t.Fatalf("timed out waiting for %s", what)
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+}
+
+// Create makes the app host a new room
+func (p *Peer) Create() *types.CreateRoomResult {
+	p.cluster.t.Helper()
+	room, err := p.App.CreateRoom(context.Background())
+	if err != nil {
+		p.cluster.t.Fatalf("%s: create room: %v", p.Name, err)
+	}
+	return room
+}
+
+// Addr is where the app listens on the switch
+func (p *Peer) Addr() string {
+	return fmt.Sprintf("127.0.0.1:%d", p.App.GetNetworkStatus().ListenPort)
+}
+
+// Join makes the app join room at host and waits for the secure channel
+func (p *Peer) Join(host *Peer, room *types.CreateRoomResult) {
+	p.cluster.t.Helper()
+	if err := p.JoinAt(room, host.Addr()); err != nil {
+		p.cluster.t.Fatalf("%s: join room: %v", p.Name, err)
+	}
+	if err := p.Await(); err != nil {
+		p.cluster.t.Fatalf("%s: no secure channel with the host: %v", p.Name, err)
+	}
+}
+
+// Await waits up to Timeout for the secure channel after JoinAt and returns
+// what WaitForPeer returned, e.g. network.ErrRoomFull
+func (p *Peer) Await() error {
+	ctx, cancel := context.WithTimeout(context.Background(), Timeout)
+	defer cancel()
+	return p.App.WaitForPeer(ctx)
+}
+
+// JoinAt joins room at addr, or through the join fallback when addr is
+// empty, and returns what JoinRoom returned
+func (p *Peer) JoinAt(room *types.CreateRoomResult, addr string) error {
+	return p.App.JoinRoom(context.Background(), room.RoomID, addr, room.AccessKey)
+}
+
+// Send sends text to the room
+func (p *Peer) Send(text string) {
+	p.cluster.t.Helper()
+	if err := p.App.SendMessage(context.Background(), text); err != nil {
+		p.cluster.t.Fatalf("%s: send %q: %v", p.Name, text, err)
+	}
+}
+
+// Expect waits for a message with text and returns it; messages received
+// meanwhile stay for later calls
+func (p *Peer) Expect(text string) *crypto.MessagePayload {
+	p.cluster.t.Helper()
+	for i, msg := range p.pending {
+		if msg.Message == text {
+			p.pending = append(p.pending[:i], p.pending[i+1:]...)
+			return msg
+		}
+	}
+	timeout := time.After(Timeout)
+	for {
+		select {
+		case msg, ok := <-p.messages:
+			if !ok {
+				p.cluster.t.Fatalf("%s: app closed while waiting for %q", p.Name, text)
+			}
+			if msg.Message == text {
+				return msg
+			}
+			p.pending = append(p.pending, msg)
+		case <-timeout:
+			p.cluster.t.Fatalf("%s: no message %q", p.Name, text)
+		}
+	}
+}
+
+// ConnectedPeers returns how many peers the app has a connection with
+func (p *Peer) ConnectedPeers() int {
+	return p.App.GetNetworkStatus().ConnectedPeers
+}
+
+// Disconnect drops every packet to and from the app until Reconnect, as if
+// its machine lost the network
+func (p *Peer) Disconnect() {
+	p.cluster.Switch.Cut(p.Name, true)
+}
+
+// Reconnect ends Disconnect
+func (p *Peer) Reconnect() {
+	p.cluster.Switch.Cut(p.Name, false)
+}
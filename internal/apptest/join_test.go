@@ -0,0 +1,38 @@
+package apptest_test
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"execp2p/internal/apptest"
+	"execp2p/internal/network"
+)
+
+// a banned identity learns why at once instead of waiting out the timeout
+func TestWaitForPeerBanned(t *testing.T) {
+	c := apptest.New(t)
+	host, guest := c.Add("host"), c.Add("guest")
+
+	room := host.Create()
+	guest.Join(host, room)
+	fingerprint, err := guest.App.GetPeerFingerprint()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := host.App.BanFingerprint(fingerprint, "spam"); err != nil {
+		t.Fatal(err)
+	}
+	guest.App.LeaveRoom()
+
+	if err := guest.JoinAt(room, host.Addr()); err != nil {
+		t.Fatal(err)
+	}
+	started := time.Now()
+	if err := guest.Await(); !errors.Is(err, network.ErrBanned) {
+		t.Fatalf("got %v, want %v", err, network.ErrBanned)
+	}
+	if waited := time.Since(started); waited > apptest.Timeout/2 {
+		t.Errorf("took %s to tell", waited)
+	}
+}
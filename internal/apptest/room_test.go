@@ -0,0 +1,237 @@
+package apptest_test
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"execp2p/internal/app"
+	"execp2p/internal/apptest"
+	"execp2p/internal/diagnostics"
+	"execp2p/internal/network"
+)
+
+// receive waits for a notice on ch
+func receive[T any](t *testing.T, what string, ch <-chan T) T {
+	t.Helper()
+	select {
+	case v := <-ch:
+		return v
+	case <-time.After(apptest.Timeout):
+		t.Fatalf("no %s", what)
+		panic("unreachable")
+	}
+}
+
+// departure waits for peerID to leave p's room
+func departure(t *testing.T, p *apptest.Peer, peerID string) app.Departure {
+	t.Helper()
+	timeout := time.After(apptest.Timeout)
+	for {
+		select {
+		case d := <-p.App.DepartureNotices():
+			if d.PeerID == peerID {
+				return d
+			}
+		case <-timeout:
+			t.Fatalf("%s: %s never left", p.Name, peerID)
+		}
+	}
+}
+
+func peerID(p *apptest.Peer) string {
+	return p.App.GetNetworkStatus().PeerID
+}
+
+func TestCreateJoinMessage(t *testing.T) {
+	c := apptest.New(t)
+	host, guest, other := c.Add("host"), c.Add("guest"), c.Add("other")
+
+	room := host.Create()
+	guest.Join(host, room)
+
+	for _, dir := range []struct{ from, to *apptest.Peer }{{host, guest}, {guest, host}} {
+		text := "hello from " + dir.from.Name
+		dir.from.Send(text)
+		if msg := dir.to.Expect(text); msg.SenderID != peerID(dir.from) {
+			t.Errorf("%s: %q from %s, want %s", dir.to.Name, text, msg.SenderID, peerID(dir.from))
+		}
+	}
+
+	// the transport holds one peer at a time
+	if err := other.JoinAt(room, host.Addr()); err != nil {
+		t.Fatal(err)
+	}
+	if err := other.Await(); !errors.Is(err, network.ErrRoomFull) {
+		t.Fatalf("got %v, want %v", err, network.ErrRoomFull)
+	}
+	host.Send("still private")
+	guest.Expect("still private")
+}
+
+func TestJoinWrongAccessKey(t *testing.T) {
+	c := apptest.New(t)
+	host, guest := c.Add("host"), c.Add("guest")
+
+	room := host.Create()
+	wrong := *room
+	wrong.AccessKey = "not the access key"
+	if err := guest.JoinAt(&wrong, host.Addr()); err != nil {
+		return // refused at once
+	}
+	if err := guest.Await(); err == nil {
+		t.Fatal("joined with a wrong access key")
+	}
+}
+
+func TestKick(t *testing.T) {
+	c := apptest.New(t)
+	host, guest := c.Add("host"), c.Add("guest")
+
+	room := host.Create()
+	guest.Join(host, room)
+	id := peerID(guest)
+
+	if err := host.App.KickPeer(id, "off topic"); err != nil {
+		t.Fatal(err)
+	}
+	kick := receive(t, "kick notice", guest.App.KickNotices())
+	if kick.RoomID != room.RoomID || kick.Reason != "off topic" {
+		t.Errorf("kick notice %+v", kick)
+	}
+	if d := departure(t, host, id); d.Reason != network.LeaveReasonKicked {
+		t.Errorf("departure reason %q, want %q", d.Reason, network.LeaveReasonKicked)
+	}
+	rekey := receive(t, "rekey", host.App.RekeyNotices())
+	if len(rekey.Departed) != 1 || rekey.Departed[0] != id {
+		t.Errorf("rekey %+v", rekey)
+	}
+
+	// a kick is not a ban
+	guest.App.LeaveRoom()
+	guest.Join(host, room)
+	host.Send("welcome back")
+	guest.Expect("welcome back")
+}
+
+func TestBan(t *testing.T) {
+	c := apptest.New(t)
+	host, guest := c.Add("host"), c.Add("guest")
+
+	room := host.Create()
+	guest.Join(host, room)
+	id := peerID(guest)
+
+	if err := host.App.BanPeer(id, "spam"); err != nil {
+		t.Fatal(err)
+	}
+	// a connected peer is removed as by a kick; the ban keeps it out after
+	if d := departure(t, host, id); d.Reason != network.LeaveReasonKicked {
+		t.Errorf("departure reason %q, want %q", d.Reason, network.LeaveReasonKicked)
+	}
+	if bans := host.App.Bans(); len(bans) != 1 || bans[0].Reason != "spam" {
+		t.Fatalf("bans %+v", bans)
+	}
+
+	guest.App.LeaveRoom()
+	if err := guest.JoinAt(room, host.Addr()); err != nil {
+		t.Fatal(err)
+	}
+	if err := guest.Await(); !errors.Is(err, network.ErrBanned) {
+		t.Fatalf("got %v, want %v", err, network.ErrBanned)
+	}
+
+	// lifted, the identity gets in again
+	fingerprint := host.App.Bans()[0].Fingerprint
+	if err := host.App.UnbanFingerprint(fingerprint); err != nil {
+		t.Fatal(err)
+	}
+	guest.App.LeaveRoom()
+	guest.Join(host, room)
+}
+
+func TestLeave(t *testing.T) {
+	c := apptest.New(t)
+	host, alice, bob := c.Add("host"), c.Add("alice"), c.Add("bob")
+
+	room := host.Create()
+	alice.Join(host, room)
+	id := peerID(alice)
+	alice.App.LeaveRoom()
+	if d := departure(t, host, id); d.Reason != network.LeaveReasonLeft {
+		t.Errorf("departure reason %q, want %q", d.Reason, network.LeaveReasonLeft)
+	}
+	rekey := receive(t, "rekey", host.App.RekeyNotices())
+	if len(rekey.Departed) != 1 || rekey.Departed[0] != id || rekey.Remaining != 0 {
+		t.Errorf("rekey %+v", rekey)
+	}
+
+	// the place is free for the next guest
+	bob.Join(host, room)
+	host.Send("after alice")
+	bob.Expect("after alice")
+	bob.Send("hello")
+	host.Expect("hello")
+}
+
+func TestKeyRotation(t *testing.T) {
+	c := apptest.New(t)
+	host, guest := c.Add("host"), c.Add("guest")
+
+	room := host.Create()
+	guest.Join(host, room)
+	host.Send("before rotation")
+	guest.Expect("before rotation")
+
+	rotations := diagnostics.Default().Get(diagnostics.KeyRotation)
+	interval := host.Config.Crypto.KeyRotationInterval
+	for d := time.Duration(0); d <= interval; d += time.Minute {
+		c.Advance(time.Minute)
+	}
+	c.Eventually("the keys to rotate", func() bool {
+		return diagnostics.Default().Get(diagnostics.KeyRotation) >= rotations+2
+	})
+
+	host.Send("after rotation")
+	guest.Expect("after rotation")
+	guest.Send("reply after rotation")
+	host.Expect("reply after rotation")
+}
+
+func TestAccessKeyRotation(t *testing.T) {
+	c := apptest.New(t)
+	host, guest, late := c.Add("host"), c.Add("guest"), c.Add("late")
+
+	room := host.Create()
+	guest.Join(host, room)
+
+	key, err := host.App.RotateRoomAccessKey(false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if rotated := receive(t, "access key", guest.App.AccessKeyNotices()); rotated.AccessKey != key || rotated.RoomID != room.RoomID {
+		t.Fatalf("guest got %+v, want key %q", rotated, key)
+	}
+	host.Send("same session")
+	guest.Expect("same session")
+
+	// evicting drops whoever is connected
+	key, err = host.App.RotateRoomAccessKey(true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	c.Eventually("the guest to be evicted", func() bool { return host.ConnectedPeers() == 0 })
+
+	// the old invite no longer works, the new one does
+	if err := late.JoinAt(room, host.Addr()); err == nil {
+		if err := late.Await(); err == nil {
+			t.Fatal("joined with the old access key")
+		}
+	}
+	late.App.LeaveRoom()
+	renewed := *room
+	renewed.AccessKey = key
+	late.Join(host, &renewed)
+	host.Send("new key")
+	late.Expect("new key")
+}
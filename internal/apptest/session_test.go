@@ -0,0 +1,29 @@
+package apptest_test
+
+import (
+	"testing"
+
+	"execp2p/internal/apptest"
+)
+
+// the host leaves, creates a room again and the guest joins it; nothing of
+// the first room may linger
+func TestLeaveRecreateRejoin(t *testing.T) {
+	c := apptest.New(t)
+	host, guest := c.Add("host"), c.Add("guest")
+
+	first := host.Create()
+	guest.Join(host, first)
+	host.Send("first room")
+	guest.Expect("first room")
+
+	host.App.LeaveRoom()
+	guest.App.LeaveRoom()
+
+	second := host.Create()
+	guest.Join(host, second)
+	host.Send("second room")
+	guest.Expect("second room")
+	guest.Send("back again")
+	host.Expect("back again")
+}
@@ -0,0 +1,112 @@
+package apptest_test
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"execp2p/internal/app"
+	"execp2p/internal/apptest"
+	"execp2p/internal/keystore"
+	"execp2p/internal/storage"
+)
+
+// linkedPair returns a primary device and a device that imported its
+// identity, in one room
+func linkedPair(t *testing.T, c *apptest.Cluster) (primary, linked *apptest.Peer) {
+	t.Helper()
+	primary = c.Add("primary", apptest.Persistent("primary passphrase"))
+	linked = c.Add("linked", apptest.Persistent("linked passphrase"))
+
+	bundle, err := primary.App.ExportIdentity([]byte("export passphrase"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := linked.App.ImportIdentity(bundle, []byte("export passphrase")); err != nil {
+		t.Fatal(err)
+	}
+	if !primary.App.IsPrimaryDevice() || linked.App.IsPrimaryDevice() {
+		t.Fatal("the exporting device must be the primary")
+	}
+
+	room := primary.Create()
+	linked.Join(primary, room)
+	c.Eventually("the devices to see each other", func() bool {
+		return len(primary.App.OwnDevices()) == 1 && len(linked.App.OwnDevices()) == 1
+	})
+	return primary, linked
+}
+
+func auditEvents(t *testing.T, p *apptest.Peer) []string {
+	t.Helper()
+	records, err := app.AuditLog(p.Config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var events []string
+	for _, rec := range records {
+		events = append(events, rec.Event)
+	}
+	return events
+}
+
+func TestRemoteWipe(t *testing.T) {
+	c := apptest.New(t)
+	primary, linked := linkedPair(t, c)
+	linkedID := linked.App.GetNetworkStatus().PeerID
+	dir := linked.Config.Identity.DataDir
+
+	if err := linked.App.WipeDevice(primary.App.GetNetworkStatus().PeerID); err == nil {
+		t.Fatal("a linked device ordered a wipe")
+	}
+	if err := primary.App.WipeDevice(linkedID); err != nil {
+		t.Fatal(err)
+	}
+
+	select {
+	case wiped := <-linked.App.DeviceWipedNotices():
+		if wiped.Err != nil {
+			t.Fatalf("wipe left data behind: %v", wiped.Err)
+		}
+		if wiped.PeerID != primary.App.GetNetworkStatus().PeerID {
+			t.Fatalf("wiped by %s", wiped.PeerID)
+		}
+	case <-time.After(apptest.Timeout):
+		t.Fatal("the linked device wasn't wiped")
+	}
+	for _, name := range []string{keystore.FileName, storage.DirName, "peer.id", "trust.json", "primary.pub"} {
+		if _, err := os.Stat(filepath.Join(dir, name)); !os.IsNotExist(err) {
+			t.Errorf("%s survived the wipe: %v", name, err)
+		}
+	}
+
+	if got := auditEvents(t, linked); len(got) != 1 || got[0] != app.AuditWiped {
+		t.Errorf("linked device audit log: %v", got)
+	}
+	c.Eventually("the primary to record the order", func() bool {
+		got := auditEvents(t, primary)
+		return len(got) == 2 && got[0] == app.AuditWipeOrdered && got[1] == app.AuditWipeSent
+	})
+}
+
+// an order is only sent to a device met in a room
+func TestRemoteWipePending(t *testing.T) {
+	c := apptest.New(t)
+	primary, linked := linkedPair(t, c)
+	linkedID := linked.App.GetNetworkStatus().PeerID
+	linked.App.LeaveRoom()
+
+	if err := primary.App.WipeDevice(linkedID); err != nil {
+		t.Fatal(err)
+	}
+	if got := auditEvents(t, primary); len(got) != 1 || got[0] != app.AuditWipeOrdered {
+		t.Fatalf("primary audit log: %v", got)
+	}
+	if !primary.App.CancelDeviceWipe(linkedID) {
+		t.Fatal("the order wasn't pending")
+	}
+	if primary.App.CancelDeviceWipe(linkedID) {
+		t.Fatal("the order was cancelled twice")
+	}
+}
@@ -0,0 +1,157 @@
+// Package archive exports decrypted room traffic on the host machine for
+// compliance setups. It is opt-in and host-configured; the host announces it
+// to every participant through signed room metadata, so nobody is archived
+// without being told.
+//
+// Records are written as JSON lines to an append-only file and/or streamed to
+// read-only observers connected to a local (unix domain) socket.
+package archive
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"execp2p/internal/logger"
+)
+
+// sink kinds as announced in room metadata
+const (
+	SinkFile   = "file"
+	SinkSocket = "socket"
+)
+
+// directions of a record
+const (
+	DirectionIn  = "in"
+	DirectionOut = "out"
+)
+
+// Record is one archived message
+type Record struct {
+	RoomID    string `json:"room_id"`
+	MessageID string `json:"message_id"`
+	SenderID  string `json:"sender_id"`
+	// unambiguous nickname of the sender at the time
+	SenderName string    `json:"sender_name,omitempty"`
+	Direction  string    `json:"direction"`
+	Timestamp  time.Time `json:"timestamp"`
+	// Timestamp in the host's language and time zone
+	TimeFormatted string    `json:"time_formatted,omitempty"`
+	Archived      time.Time `json:"archived_at"`
+	Message       string    `json:"message"`
+}
+
+// Options selects the sinks; empty fields are disabled
+type Options struct {
+	File   string
+	Socket string
+}
+
+// Enabled reports whether any sink is configured
+func (o Options) Enabled() bool {
+	return o.File != "" || o.Socket != ""
+}
+
+type sink interface {
+	kind() string
+	write(line []byte) error
+	close() error
+}
+
+// Exporter fans records out to the configured sinks
+type Exporter struct {
+	mu     sync.Mutex
+	sinks  []sink
+	since  time.Time
+	closed bool
+}
+
+// Open starts the configured sinks
+func Open(opts Options) (*Exporter, error) {
+	if !opts.Enabled() {
+		return nil, errors.New("no archive sink configured")
+	}
+
+	e := &Exporter{since: time.Now().UTC()}
+	if opts.File != "" {
+		s, err := openFileSink(opts.File)
+		if err != nil {
+			return nil, err
+		}
+		e.sinks = append(e.sinks, s)
+	}
+	if opts.Socket != "" {
+		s, err := openSocketSink(opts.Socket)
+		if err != nil {
+			e.Close()
+			return nil, err
+		}
+		e.sinks = append(e.sinks, s)
+	}
+	return e, nil
+}
+
+// Sinks returns the kinds of the active sinks
+func (e *Exporter) Sinks() []string {
+	kinds := make([]string, 0, len(e.sinks))
+	for _, s := range e.sinks {
+		kinds = append(kinds, s.kind())
+	}
+	return kinds
+}
+
+// Since returns when archiving started
+func (e *Exporter) Since() time.Time {
+	return e.since
+}
+
+// Write exports a record to every sink. A failing sink is logged and does
+// not stop the others.
+func (e *Exporter) Write(rec Record) error {
+	if rec.Archived.IsZero() {
+		rec.Archived = time.Now().UTC()
+	}
+	line, err := json.Marshal(rec)
+	if err != nil {
+		return fmt.Errorf("failed to encode archive record: %w", err)
+	}
+	line = append(line, '\n')
+
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if e.closed {
+		return errors.New("archive is closed")
+	}
+
+	var firstErr error
+	for _, s := range e.sinks {
+		if err := s.write(line); err != nil {
+			logger.L().Warn("Archive sink write failed", "sink", s.kind(), "err", err)
+			if firstErr == nil {
+				firstErr = err
+			}
+		}
+	}
+	return firstErr
+}
+
+// Close stops all sinks
+func (e *Exporter) Close() error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if e.closed {
+		return nil
+	}
+	e.closed = true
+
+	var firstErr error
+	for _, s := range e.sinks {
+		if err := s.close(); err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+	return firstErr
+}
@@ -0,0 +1,157 @@
+package archive
+
+import (
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"execp2p/internal/crash"
+	"execp2p/internal/logger"
+)
+
+// fileSink appends records to a JSON lines file
+type fileSink struct {
+	f *os.File
+}
+
+func openFileSink(path string) (*fileSink, error) {
+	if err := os.MkdirAll(filepath.Dir(path), 0o700); err != nil {
+		return nil, fmt.Errorf("failed to create archive directory: %w", err)
+	}
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0o600)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open archive file: %w", err)
+	}
+	return &fileSink{f: f}, nil
+}
+
+func (s *fileSink) kind() string { return SinkFile }
+
+func (s *fileSink) write(line []byte) error {
+	_, err := s.f.Write(line)
+	return err
+}
+
+func (s *fileSink) close() error {
+	return s.f.Close()
+}
+
+const (
+	// records queued per observer before it is considered too slow
+	observerQueue = 256
+	// how long one write to an observer may take
+	observerWriteTimeout = 5 * time.Second
+)
+
+// socketSink streams records to every observer connected to a local socket.
+// Observers are read-only: anything they send is ignored. An observer that
+// cannot keep up is disconnected rather than slowing down the chat.
+type socketSink struct {
+	path     string
+	listener net.Listener
+
+	mu        sync.Mutex
+	observers map[*observer]struct{}
+}
+
+type observer struct {
+	conn  net.Conn
+	queue chan []byte
+}
+
+func openSocketSink(path string) (*socketSink, error) {
+	// a stale socket from a previous run would make Listen fail
+	if fi, err := os.Lstat(path); err == nil && fi.Mode()&os.ModeSocket != 0 {
+		os.Remove(path)
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0o700); err != nil {
+		return nil, fmt.Errorf("failed to create archive socket directory: %w", err)
+	}
+
+	listener, err := net.Listen("unix", path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to listen on archive socket: %w", err)
+	}
+	// only the local user may observe
+	if err := os.Chmod(path, 0o600); err != nil {
+		listener.Close()
+		return nil, fmt.Errorf("failed to restrict archive socket: %w", err)
+	}
+
+	s := &socketSink{path: path, listener: listener, observers: make(map[*observer]struct{})}
+	go s.acceptLoop()
+	return s, nil
+}
+
+func (s *socketSink) kind() string { return SinkSocket }
+
+func (s *socketSink) acceptLoop() {
+	defer crash.Recover("archive.acceptLoop")
+	for {
+		conn, err := s.listener.Accept()
+		if err != nil {
+			return // listener closed
+		}
+		o := &observer{conn: conn, queue: make(chan []byte, observerQueue)}
+		s.mu.Lock()
+		s.observers[o] = struct{}{}
+		count := len(s.observers)
+		s.mu.Unlock()
+		logger.L().Info("Archive observer connected", "observers", count)
+
+		go s.serve(o)
+	}
+}
+
+func (s *socketSink) serve(o *observer) {
+	defer s.drop(o)
+	for line := range o.queue {
+		o.conn.SetWriteDeadline(time.Now().Add(observerWriteTimeout))
+		if _, err := o.conn.Write(line); err != nil {
+			logger.L().Info("Archive observer disconnected", "err", err)
+			return
+		}
+	}
+}
+
+func (s *socketSink) drop(o *observer) {
+	s.mu.Lock()
+	if _, ok := s.observers[o]; ok {
+		delete(s.observers, o)
+		close(o.queue)
+	}
+	s.mu.Unlock()
+	o.conn.Close()
+}
+
+func (s *socketSink) write(line []byte) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for o := range s.observers {
+		select {
+		case o.queue <- line:
+		default:
+			logger.L().Warn("Archive observer too slow; disconnecting")
+			delete(s.observers, o)
+			close(o.queue)
+			o.conn.Close()
+		}
+	}
+	return nil
+}
+
+func (s *socketSink) close() error {
+	err := s.listener.Close()
+	s.mu.Lock()
+	for o := range s.observers {
+		delete(s.observers, o)
+		close(o.queue)
+		o.conn.Close()
+	}
+	s.mu.Unlock()
+	os.Remove(s.path)
+	return err
+}
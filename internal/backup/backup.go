@@ -0,0 +1,260 @@
+// Package backup produces and restores passphrase-encrypted archives of the
+// whole application state (identity, trust data, rooms and settings).
+//
+// The archive is a gzip-compressed tar sealed with the same envelope format
+// as the identity keystore. The identity keys are carried in plaintext inside
+// the sealed archive and re-sealed into a fresh keystore on restore, so a
+// keychain-protected identity can be moved to a machine with a different
+// keychain.
+package backup
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"execp2p/internal/crypto"
+	"execp2p/internal/keystore"
+	"execp2p/internal/media"
+)
+
+const (
+	formatVersion = 1
+
+	manifestEntry = "manifest.json"
+	identityEntry = "identity.json"
+	filesPrefix   = "files/"
+)
+
+var ErrExists = errors.New("data directory already contains state; use overwrite to replace it")
+
+// Manifest describes the contents of a backup archive
+type Manifest struct {
+	Version     int       `json:"version"`
+	CreatedAt   time.Time `json:"created_at"`
+	AppVersion  string    `json:"app_version"`
+	HasIdentity bool      `json:"has_identity"`
+	Files       []string  `json:"files"`
+}
+
+// Archive is a decrypted backup held in memory
+type Archive struct {
+	Manifest Manifest
+	Identity *crypto.IdentityKeys
+	Files    map[string][]byte
+}
+
+// Create archives every regular file in dataDir (except the keystore, which is
+// replaced by the plaintext identity) and seals the result with passphrase.
+func Create(dataDir string, identity *crypto.IdentityKeys, appVersion string, passphrase []byte) ([]byte, error) {
+	if len(passphrase) == 0 {
+		return nil, keystore.ErrPassphraseMissing
+	}
+
+	files, err := collectFiles(dataDir)
+	if err != nil {
+		return nil, err
+	}
+
+	manifest := Manifest{
+		Version:     formatVersion,
+		CreatedAt:   time.Now().UTC(),
+		AppVersion:  appVersion,
+		HasIdentity: identity != nil,
+	}
+	for name := range files {
+		manifest.Files = append(manifest.Files, name)
+	}
+
+	var buf bytes.Buffer
+	gz := gzip.NewWriter(&buf)
+	tw := tar.NewWriter(gz)
+
+	manifestBytes, err := json.MarshalIndent(manifest, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	if err := writeEntry(tw, manifestEntry, manifestBytes); err != nil {
+		return nil, err
+	}
+	if identity != nil {
+		idBytes, err := json.Marshal(identity)
+		if err != nil {
+			return nil, err
+		}
+		if err := writeEntry(tw, identityEntry, idBytes); err != nil {
+			return nil, err
+		}
+	}
+	for _, name := range manifest.Files {
+		if err := writeEntry(tw, filesPrefix+name, files[name]); err != nil {
+			return nil, err
+		}
+	}
+	if err := tw.Close(); err != nil {
+		return nil, err
+	}
+	if err := gz.Close(); err != nil {
+		return nil, err
+	}
+
+	return keystore.SealWithPassphrase(buf.Bytes(), passphrase)
+}
+
+// Open decrypts and parses a backup archive
+func Open(data, passphrase []byte) (*Archive, error) {
+	plaintext, err := keystore.OpenWithPassphrase(data, passphrase)
+	if err != nil {
+		return nil, err
+	}
+
+	gz, err := gzip.NewReader(bytes.NewReader(plaintext))
+	if err != nil {
+		return nil, fmt.Errorf("corrupted backup: %w", err)
+	}
+	defer gz.Close()
+
+	archive := &Archive{Files: make(map[string][]byte)}
+	var haveManifest bool
+
+	tr := tar.NewReader(gz)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("corrupted backup: %w", err)
+		}
+		content, err := io.ReadAll(tr)
+		if err != nil {
+			return nil, fmt.Errorf("corrupted backup: %w", err)
+		}
+
+		switch {
+		case hdr.Name == manifestEntry:
+			if err := json.Unmarshal(content, &archive.Manifest); err != nil {
+				return nil, fmt.Errorf("invalid backup manifest: %w", err)
+			}
+			haveManifest = true
+		case hdr.Name == identityEntry:
+			var keys crypto.IdentityKeys
+			if err := json.Unmarshal(content, &keys); err != nil {
+				return nil, fmt.Errorf("invalid identity in backup: %w", err)
+			}
+			archive.Identity = &keys
+		case strings.HasPrefix(hdr.Name, filesPrefix):
+			name := strings.TrimPrefix(hdr.Name, filesPrefix)
+			if !safeRelPath(name) {
+				return nil, fmt.Errorf("unsafe path in backup: %s", hdr.Name)
+			}
+			archive.Files[name] = content
+		}
+	}
+
+	if !haveManifest {
+		return nil, fmt.Errorf("backup has no manifest")
+	}
+	if archive.Manifest.Version > formatVersion {
+		return nil, fmt.Errorf("backup format %d is newer than supported (%d)", archive.Manifest.Version, formatVersion)
+	}
+	return archive, nil
+}
+
+// Restore writes the archived files into dataDir. Existing state is only
+// replaced when overwrite is true. The identity is not written here; the
+// caller re-seals it into a keystore with the desired protection.
+func (a *Archive) Restore(dataDir string, overwrite bool) error {
+	if !overwrite {
+		existing, err := collectFiles(dataDir)
+		if err != nil {
+			return err
+		}
+		if len(existing) > 0 || keystore.New(dataDir).Exists() {
+			return ErrExists
+		}
+	}
+
+	for name, content := range a.Files {
+		target := filepath.Join(dataDir, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(target), 0o700); err != nil {
+			return err
+		}
+		if err := os.WriteFile(target, content, 0o600); err != nil {
+			return fmt.Errorf("failed to restore %s: %w", name, err)
+		}
+	}
+	return nil
+}
+
+// collectFiles reads all regular files in dir keyed by slash-separated relative path
+func collectFiles(dir string) (map[string][]byte, error) {
+	files := make(map[string][]byte)
+	err := filepath.WalkDir(dir, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			if os.IsNotExist(err) && p == dir {
+				return filepath.SkipDir
+			}
+			return err
+		}
+		if !d.Type().IsRegular() {
+			return nil
+		}
+		rel, err := filepath.Rel(dir, p)
+		if err != nil {
+			return err
+		}
+		rel = filepath.ToSlash(rel)
+		// the keystore is carried as a plaintext identity, temp files are skipped
+		if rel == keystore.FileName || strings.HasPrefix(path.Base(rel), ".") {
+			return nil
+		}
+		// cached media can be large and is only a cache
+		if strings.HasPrefix(rel, media.CacheDirName+"/") {
+			return nil
+		}
+		content, err := os.ReadFile(p)
+		if err != nil {
+			return err
+		}
+		files[rel] = content
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to read data directory: %w", err)
+	}
+	return files, nil
+}
+
+func writeEntry(tw *tar.Writer, name string, content []byte) error {
+	hdr := &tar.Header{
+		Name:    name,
+		Mode:    0o600,
+		Size:    int64(len(content)),
+		ModTime: time.Now(),
+	}
+	if err := tw.WriteHeader(hdr); err != nil {
+		return err
+	}
+	_, err := tw.Write(content)
+	return err
+}
+
+// safeRelPath rejects absolute paths and parent traversal
+func safeRelPath(name string) bool {
+	if name == "" || path.IsAbs(name) || strings.Contains(name, "\\") {
+		return false
+	}
+	clean := path.Clean(name)
+	return clean == name && clean != ".." && !strings.HasPrefix(clean, "../")
+}
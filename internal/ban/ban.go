@@ -0,0 +1,155 @@
+// Package ban keeps the identities a room host banned, per room and by
+// identity fingerprint, so a banned person can't come back with a new peer
+// ID or an old invite.
+package ban
+
+import (
+	"errors"
+	"slices"
+	"sync"
+	"time"
+
+	"execp2p/internal/logger"
+	"execp2p/internal/storage"
+)
+
+// BucketName is the storage bucket the ban lists are kept in
+const BucketName = "bans"
+
+// Entry is a banned identity
+type Entry struct {
+	Fingerprint string `json:"fingerprint"`
+	// the name it went by, for the list shown to the host
+	Nickname string    `json:"nickname,omitempty"`
+	Reason   string    `json:"reason,omitempty"`
+	BannedAt time.Time `json:"banned_at"`
+}
+
+// Store keeps the lists across restarts, one key per room.
+// *storage.Bucket is one.
+type Store interface {
+	PutJSON(key string, v interface{}) error
+	GetJSON(key string, v interface{}) (bool, error)
+	Delete(key string) error
+	Keys() []string
+}
+
+// List is safe for concurrent use. Lists are kept in memory and, when a
+// store is given, written to it on every change; while an incognito room is
+// active the encrypted database refuses writes and they stay in memory.
+type List struct {
+	mu    sync.Mutex
+	rooms map[string][]Entry
+	store Store
+}
+
+// New returns the ban lists found in store, which may be nil
+func New(store Store) *List {
+	l := &List{rooms: make(map[string][]Entry), store: store}
+	if store == nil {
+		return l
+	}
+	for _, roomID := range store.Keys() {
+		var entries []Entry
+		if ok, err := store.GetJSON(roomID, &entries); err != nil || !ok {
+			logger.L().Warn("Dropping unreadable ban list", "room_id", roomID, "err", err)
+			store.Delete(roomID)
+			continue
+		}
+		if len(entries) > 0 {
+			l.rooms[roomID] = entries
+		}
+	}
+	return l
+}
+
+// Add bans an identity in roomID; it reports false if it was banned already
+func (l *List) Add(roomID string, entry Entry) bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if l.indexLocked(roomID, entry.Fingerprint) >= 0 {
+		return false
+	}
+	if entry.BannedAt.IsZero() {
+		entry.BannedAt = time.Now()
+	}
+	l.rooms[roomID] = append(l.rooms[roomID], entry)
+	l.save(roomID)
+	return true
+}
+
+// Remove lifts a ban; it reports whether the identity was banned
+func (l *List) Remove(roomID, fingerprint string) bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	i := l.indexLocked(roomID, fingerprint)
+	if i < 0 {
+		return false
+	}
+	l.rooms[roomID] = slices.Delete(slices.Clone(l.rooms[roomID]), i, i+1)
+	l.save(roomID)
+	return true
+}
+
+// Forget drops the whole ban list of roomID
+func (l *List) Forget(roomID string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if _, ok := l.rooms[roomID]; !ok {
+		return
+	}
+	l.rooms[roomID] = nil
+	l.save(roomID)
+}
+
+// Has reports whether an identity is banned in roomID
+func (l *List) Has(roomID, fingerprint string) bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.indexLocked(roomID, fingerprint) >= 0
+}
+
+// Entries returns the bans of roomID, oldest first
+func (l *List) Entries(roomID string) []Entry {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return slices.Clone(l.rooms[roomID])
+}
+
+// Fingerprints returns the banned fingerprints of roomID
+func (l *List) Fingerprints(roomID string) []string {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	fingerprints := make([]string, len(l.rooms[roomID]))
+	for i, entry := range l.rooms[roomID] {
+		fingerprints[i] = entry.Fingerprint
+	}
+	return fingerprints
+}
+
+// indexLocked finds a ban; l.mu must be held
+func (l *List) indexLocked(roomID, fingerprint string) int {
+	return slices.IndexFunc(l.rooms[roomID], func(e Entry) bool { return e.Fingerprint == fingerprint })
+}
+
+// save writes the list of roomID to the store; l.mu must be held
+func (l *List) save(roomID string) {
+	entries := l.rooms[roomID]
+	if len(entries) == 0 {
+		delete(l.rooms, roomID)
+	}
+	if l.store == nil {
+		return
+	}
+	var err error
+	if len(entries) > 0 {
+		err = l.store.PutJSON(roomID, entries)
+	} else {
+		err = l.store.Delete(roomID)
+	}
+	if err != nil && !errors.Is(err, storage.ErrIncognito) {
+		logger.L().Warn("Failed to store the ban list", "room_id", roomID, "err", err)
+	}
+}
@@ -4,45 +4,104 @@ import (
 	"time"
 )
 
-// Config holds all app configuration
+// Config holds all app configuration. The yaml tags name the keys of the
+// config file; fields tagged "-" are secrets, which only come from the
+// environment, or settings nothing reads yet.
 type Config struct {
 	// Network configuration
-	Network NetworkConfig
+	Network NetworkConfig `yaml:"network"`
 
 	// Cryptography configuration
-	Crypto CryptoConfig
+	Crypto CryptoConfig `yaml:"crypto"`
 
 	// UI configuration
-	UI UIConfig
+	UI UIConfig `yaml:"-"`
 
 	// Discovery configuration
-	Discovery DiscoveryConfig
+	Discovery DiscoveryConfig `yaml:"discovery"`
+
+	// Identity persistence configuration
+	Identity IdentityConfig `yaml:"identity"`
+
+	// Defaults for created and joined rooms
+	Room RoomConfig `yaml:"room"`
+
+	// Peer trust (TOFU) configuration
+	Trust TrustConfig `yaml:"trust"`
+
+	// Compliance archive of decrypted traffic (host only, opt-in)
+	Archive ArchiveConfig `yaml:"archive"`
+
+	// Language and time zone used to format timestamps
+	Locale LocaleConfig `yaml:"locale"`
+
+	// Encrypted local message history
+	History HistoryConfig `yaml:"history"`
+
+	// Store-and-forward delivery to offline peers through a relay
+	Mailbox MailboxConfig `yaml:"mailbox"`
+
+	// Received media cache
+	Media MediaConfig `yaml:"media"`
+
+	// Voice messages recorded and played in the backend
+	Voice VoiceConfig `yaml:"voice"`
+
+	// Room events posted to a local URL
+	Webhook WebhookConfig `yaml:"webhook"`
+
+	// Hosted rooms mirrored in an XMPP multi-user chat (host only, opt-in)
+	XMPP XMPPConfig `yaml:"xmpp"`
+
+	// Automated answers to commands such as "!status"
+	Bot BotConfig `yaml:"bot"`
+
+	// Desktop notifications of messages arriving while the window is in
+	// the background
+	Notifications NotificationsConfig `yaml:"notifications"`
+
+	// Diagnostic logging
+	Log LogConfig `yaml:"log"`
 }
 
 // NetworkConfig holds networking settings
 type NetworkConfig struct {
 	// port range for listening
-	MinPort int
-	MaxPort int
+	MinPort int `yaml:"min_port"`
+	MaxPort int `yaml:"max_port"`
 
 	// connection timeouts
-	ConnectTimeout time.Duration
-	ReadTimeout    time.Duration
-	WriteTimeout   time.Duration
+	ConnectTimeout time.Duration `yaml:"-"`
+	ReadTimeout    time.Duration `yaml:"-"`
+	WriteTimeout   time.Duration `yaml:"-"`
 
 	// max peers per room
-	MaxPeers int
+	MaxPeers int `yaml:"max_peers"`
+
+	// resume TLS sessions with known hosts and allow 0-RTT
+	ZeroRTT bool `yaml:"zero_rtt"`
+
+	// key type of the TLS certificate: "ed25519", "ecdsa" or "rsa"
+	TLSKey string `yaml:"tls_key"`
+
+	// what carries the room's QUIC: "quic" (UDP), "libp2p" or "webrtc"
+	// (needs discovery.signaling_server)
+	Transport string `yaml:"transport"`
+
+	// multiaddrs of the libp2p DHT's first peers; none means the public
+	// IPFS bootstrap peers
+	Libp2pBootstrap []string `yaml:"libp2p_bootstrap"`
 }
 
 // CryptoConfig holds crypto settings
 type CryptoConfig struct {
 	// post-quantum algorithms we use
-	KEMAlgorithm       string
-	SignatureAlgorithm string
-	SymmetricAlgorithm string
+	KEMAlgorithm       string `yaml:"-"`
+	SignatureAlgorithm string `yaml:"-"`
+	SymmetricAlgorithm string `yaml:"-"`
 
 	// how often to rotate keys
-	KeyRotationInterval time.Duration
+	KeyRotationInterval time.Duration `yaml:"key_rotation_interval"`
 }
 
 // UIConfig holds UI settings
@@ -60,22 +119,222 @@ type UIConfig struct {
 // DiscoveryConfig holds peer discovery settings
 type DiscoveryConfig struct {
 	// mDNS settings
-	EnableMDNS   bool
-	MDNSInterval time.Duration
+	EnableMDNS   bool          `yaml:"enable_mdns"`
+	MDNSInterval time.Duration `yaml:"-"`
 
 	// BitTorrent DHT settings
-	EnableBTDHT bool
-	BTDHTPort   int
+	EnableBTDHT bool `yaml:"enable_dht"`
+	BTDHTPort   int  `yaml:"dht_port"`
+
+	// UDP broadcast on the local network
+	EnableBroadcast bool `yaml:"enable_broadcast"`
 
 	// DNS TXT settings
-	EnableDNS bool
-	DNSServer string
+	EnableDNS bool   `yaml:"-"`
+	DNSServer string `yaml:"-"`
 
 	// STUN settings
-	STUNServers []string
+	STUNServers []string `yaml:"stun_servers"`
+
+	// server joiners ask for the host's public address before hole
+	// punching, empty disables it
+	SignalingServer string `yaml:"signaling_server"`
 
 	// how long to wait for discovery
-	DiscoveryTimeout time.Duration
+	DiscoveryTimeout time.Duration `yaml:"-"`
+
+	// how often the host announces an empty room on the DHT
+	AnnounceInterval time.Duration `yaml:"announce_interval"`
+
+	// what announcing does once a peer is connected: "reduce" announces
+	// every OccupiedInterval, "stop" pauses DHT and mDNS announcements until
+	// the room is empty again, "keep" doesn't change anything
+	WhenOccupied     string        `yaml:"when_occupied"`
+	OccupiedInterval time.Duration `yaml:"occupied_interval"`
+}
+
+// IdentityConfig holds identity persistence settings
+type IdentityConfig struct {
+	// generate a throw-away identity on every launch instead of using the keystore
+	Ephemeral bool `yaml:"ephemeral"`
+
+	// how the keystore is protected: "keychain" or "passphrase"
+	KeystoreProtection string `yaml:"keystore_protection"`
+
+	// directory holding the keystore, empty means the platform default
+	DataDir string `yaml:"data_dir"`
+
+	// passphrase for passphrase-protected keystores (never written to disk)
+	Passphrase string `yaml:"-"`
+}
+
+// RoomConfig holds room defaults
+type RoomConfig struct {
+	// nickname shown to the room, empty shows the default one
+	Nickname string `yaml:"nickname"`
+
+	// incognito rooms are kept in memory only: nothing about them is written
+	// to disk and their ID is redacted from logs
+	Incognito bool `yaml:"incognito"`
+
+	// presence turns to away after this long without activity, 0 never
+	AwayAfter time.Duration `yaml:"away_after"`
+
+	// rooms we create close by themselves this long after they were
+	// created, or after this long without a chat message; 0 never
+	TTL         time.Duration `yaml:"ttl"`
+	IdleTimeout time.Duration `yaml:"idle_timeout"`
+
+	// enter the rooms we were in again at startup: host the ones we
+	// created, join the others
+	Rejoin bool `yaml:"rejoin"`
+}
+
+// TrustConfig holds trust-on-first-use settings
+type TrustConfig struct {
+	// what to do when a known peer presents a different fingerprint:
+	// "refuse" drops the connection, "warn" only raises the alert
+	OnFingerprintChange string `yaml:"on_fingerprint_change"`
+
+	// strict mode: drop messages from peers the user hasn't verified
+	RequireVerified bool `yaml:"require_verified"`
+
+	// close a connection whose TLS certificate the peer's identity doesn't
+	// vouch for; false keeps it, the peer is quarantined either way
+	StrictTLS bool `yaml:"strict_tls"`
+}
+
+// ArchiveConfig holds the host-side export of decrypted room traffic.
+// Archiving is announced to all participants; both sinks are off by default.
+type ArchiveConfig struct {
+	// JSON lines file the records are appended to
+	File string `yaml:"file"`
+
+	// local socket read-only observers can connect to
+	Socket string `yaml:"socket"`
+}
+
+// LocaleConfig holds timestamp formatting settings
+type LocaleConfig struct {
+	// "pl" or "en"; locale names like "en_US.UTF-8" are accepted
+	Language string `yaml:"language"`
+
+	// IANA time zone such as "Europe/Warsaw", empty means the system zone
+	Timezone string `yaml:"timezone"`
+}
+
+// HistoryConfig holds the local message history settings. History is kept
+// in the encrypted store and never for incognito rooms.
+type HistoryConfig struct {
+	Enabled bool `yaml:"enabled"`
+
+	// messages kept per room, 0 keeps all
+	MaxMessages int `yaml:"max_messages"`
+
+	// messages older than this are dropped, 0 keeps them forever
+	MaxAge time.Duration `yaml:"max_age"`
+}
+
+// MailboxConfig holds the relay used for offline delivery. Messages are
+// sealed to the recipient before they leave the machine.
+type MailboxConfig struct {
+	// relay (signaling server) URL, empty disables offline delivery
+	Server string `yaml:"server"`
+
+	// how often our mailbox is checked while in a room
+	PollInterval time.Duration `yaml:"poll_interval"`
+
+	// publish a contact bundle under our user ID, so that people who know
+	// only the ID can leave us a first message (persistent identity only)
+	ContactMe bool `yaml:"contact_me"`
+}
+
+// MediaConfig holds the limits of the received pictures and voice
+// messages. Media is cached encrypted on disk; incognito rooms and
+// ephemeral identities keep it in memory only.
+type MediaConfig struct {
+	// bytes kept in memory
+	MemoryLimit int64 `yaml:"memory_limit"`
+
+	// bytes kept in the disk cache, 0 disables it
+	CacheLimit int64 `yaml:"cache_limit"`
+}
+
+// VoiceConfig holds the native voice message pipeline, which runs ffmpeg.
+// Without ffmpeg voice messages are recorded by the web view.
+type VoiceConfig struct {
+	// path of ffmpeg, empty looks it up in PATH
+	FFmpegPath string `yaml:"ffmpeg_path"`
+
+	// microphone as an ffmpeg "format:device", empty is the system default
+	Input string `yaml:"input"`
+
+	// Opus bitrate in bits per second
+	Bitrate int `yaml:"bitrate"`
+
+	// longest recording
+	MaxDuration time.Duration `yaml:"max_duration"`
+}
+
+// WebhookConfig holds the local webhook that is told about delivered
+// messages and peers connecting; it is off by default
+type WebhookConfig struct {
+	// loopback URL the events are posted to, empty disables the webhook
+	URL string `yaml:"url"`
+
+	// HMAC-SHA256 key signing the requests, empty leaves them unsigned
+	Secret string `yaml:"-"`
+}
+
+// XMPPConfig holds the gateway that mirrors the rooms we host in an XMPP
+// MUC, connected as a component of an XMPP server on this machine. It is
+// announced to all participants like an archive and off by default.
+type XMPPConfig struct {
+	// host:port of the server's component listener, empty disables the
+	// gateway
+	Server string `yaml:"server"`
+
+	// the component's domain, as configured on the server
+	Domain string `yaml:"domain"`
+
+	// bare JID of the MUC, e.g. team@conference.example.org
+	Room string `yaml:"room"`
+
+	// nickname of the gateway's own occupant
+	Nick string `yaml:"nick"`
+
+	// component secret shared with the server
+	Secret string `yaml:"-"`
+}
+
+// BotConfig holds the responder that answers commands sent in the room;
+// it is off by default
+type BotConfig struct {
+	Enabled bool `yaml:"enabled"`
+
+	// what starts a command, e.g. "!" for "!status"
+	Prefix string `yaml:"prefix"`
+
+	// replies a single peer can get per minute, and the whole room
+	RepliesPerMinute     int `yaml:"replies_per_minute"`
+	RoomRepliesPerMinute int `yaml:"room_replies_per_minute"`
+}
+
+// NotificationsConfig holds the desktop notifications of the GUI
+type NotificationsConfig struct {
+	Enabled bool `yaml:"enabled"`
+
+	// show only who wrote, not what, e.g. while sharing the screen
+	HidePreview bool `yaml:"hide_preview"`
+
+	// rooms whose messages never notify
+	MutedRooms []string `yaml:"muted_rooms"`
+}
+
+// LogConfig holds diagnostic logging settings
+type LogConfig struct {
+	// "debug", "info", "warn" or "error"; empty keeps logging off
+	Level string `yaml:"level"`
 }
 
 // DefaultConfig returns sensible defaults
@@ -88,12 +347,14 @@ func DefaultConfig() *Config {
 			ReadTimeout:    10 * time.Second,
 			WriteTimeout:   10 * time.Second,
 			MaxPeers:       10,
+			TLSKey:         "ed25519",
+			Transport:      "quic",
 		},
 		Crypto: CryptoConfig{
 			KEMAlgorithm:        "Kyber1024",
 			SignatureAlgorithm:  "DILITHIUM5",
 			SymmetricAlgorithm:  "ChaCha20-Poly1305",
-			KeyRotationInterval: 1 * time.Hour,
+			KeyRotationInterval: 15 * time.Minute,
 		},
 		UI: UIConfig{
 			EnableColors:      true,
@@ -103,18 +364,64 @@ func DefaultConfig() *Config {
 			InputBufferSize:   4096,
 		},
 		Discovery: DiscoveryConfig{
-			EnableMDNS:   true,
-			MDNSInterval: 5 * time.Second,
-			EnableBTDHT:  true,
-			BTDHTPort:    6881,
-			EnableDNS:    true,
-			DNSServer:    "8.8.8.8:53",
+			EnableMDNS:      true,
+			MDNSInterval:    5 * time.Second,
+			EnableBTDHT:     true,
+			BTDHTPort:       6881,
+			EnableBroadcast: true,
+			EnableDNS:       true,
+			DNSServer:       "8.8.8.8:53",
 			STUNServers: []string{
 				"stun.l.google.com:19302",
 				"stun1.l.google.com:19302",
-				"stun2.l.google.com:19302",
+				"stun.twilio.com:3478",
+				"stun.stunprotocol.org:3478",
 			},
 			DiscoveryTimeout: 60 * time.Second,
+			AnnounceInterval: 3 * time.Minute,
+			WhenOccupied:     "reduce",
+			OccupiedInterval: 30 * time.Minute,
+		},
+		Identity: IdentityConfig{
+			Ephemeral:          false,
+			KeystoreProtection: "keychain",
+		},
+		Room: RoomConfig{
+			AwayAfter: 5 * time.Minute,
+		},
+		Trust: TrustConfig{
+			OnFingerprintChange: "refuse",
+			StrictTLS:           true,
+		},
+		Locale: LocaleConfig{
+			Language: "pl",
+		},
+		History: HistoryConfig{
+			Enabled:     true,
+			MaxMessages: 5000,
+		},
+		Mailbox: MailboxConfig{
+			PollInterval: 2 * time.Minute,
+		},
+		Media: MediaConfig{
+			MemoryLimit: 64 << 20,
+			CacheLimit:  512 << 20,
+		},
+		Voice: VoiceConfig{
+			Bitrate:     24000,
+			MaxDuration: 5 * time.Minute,
+		},
+		XMPP: XMPPConfig{
+			Nick: "ExecP2P",
+		},
+		Bot: BotConfig{
+			Prefix:               "!",
+			RepliesPerMinute:     6,
+			RoomRepliesPerMinute: 20,
+		},
+		Notifications: NotificationsConfig{
+			Enabled:    true,
+			MutedRooms: []string{},
 		},
 	}
 }
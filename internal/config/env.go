@@ -0,0 +1,96 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// EnvPrefix starts the environment variables that override config keys
+const EnvPrefix = "EXECP2P_"
+
+var durationType = reflect.TypeOf(time.Duration(0))
+
+// EnvName returns the variable overriding the key at path, e.g.
+// EXECP2P_NETWORK_MIN_PORT for network.min_port
+func EnvName(path ...string) string {
+	return EnvPrefix + strings.ToUpper(strings.Join(path, "_"))
+}
+
+// LoadEnv sets every key of cfg given in the environment, under the name
+// EnvName gives it. Values are written as in the file; lists are separated
+// by commas. Every malformed value is reported.
+func LoadEnv(cfg *Config) error {
+	return errors.Join(loadEnv(reflect.ValueOf(cfg).Elem(), nil)...)
+}
+
+func loadEnv(v reflect.Value, path []string) []error {
+	var errs []error
+	for i := 0; i < v.NumField(); i++ {
+		key := strings.Split(v.Type().Field(i).Tag.Get("yaml"), ",")[0]
+		if key == "" || key == "-" {
+			continue
+		}
+		field, fieldPath := v.Field(i), append(path[:len(path):len(path)], key)
+		if field.Kind() == reflect.Struct {
+			errs = append(errs, loadEnv(field, fieldPath)...)
+			continue
+		}
+		name := EnvName(fieldPath...)
+		value, ok := os.LookupEnv(name)
+		if !ok {
+			continue
+		}
+		if err := setString(field, value); err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", name, err))
+		}
+	}
+	return errs
+}
+
+// setString parses s into v as the type of v requires
+func setString(v reflect.Value, s string) error {
+	s = strings.TrimSpace(s)
+	if v.Type() == durationType {
+		d, err := time.ParseDuration(s)
+		if err != nil {
+			return fmt.Errorf("%q is not a duration, e.g. 30s or 5m", s)
+		}
+		v.SetInt(int64(d))
+		return nil
+	}
+	switch v.Kind() {
+	case reflect.String:
+		v.SetString(s)
+	case reflect.Bool:
+		b, err := strconv.ParseBool(s)
+		if err != nil {
+			return fmt.Errorf("%q is not true or false", s)
+		}
+		v.SetBool(b)
+	case reflect.Int, reflect.Int64:
+		n, err := strconv.ParseInt(s, 10, 64)
+		if err != nil {
+			return fmt.Errorf("%q is not a whole number", s)
+		}
+		v.SetInt(n)
+	case reflect.Slice:
+		if v.Type().Elem().Kind() != reflect.String {
+			return fmt.Errorf("unsupported list type %s", v.Type())
+		}
+		items := []string{}
+		for _, item := range strings.Split(s, ",") {
+			if item = strings.TrimSpace(item); item != "" {
+				items = append(items, item)
+			}
+		}
+		v.Set(reflect.ValueOf(items))
+	default:
+		return fmt.Errorf("unsupported type %s", v.Type())
+	}
+	return nil
+}
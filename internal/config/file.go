@@ -0,0 +1,141 @@
+package config
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"execp2p/internal/paths"
+	"execp2p/internal/room"
+	"execp2p/internal/roster"
+
+	"gopkg.in/yaml.v3"
+)
+
+// FileName is the name of the config file in the config directory
+const FileName = "config.yaml"
+
+// DefaultPath returns where the config file is looked for by default,
+// e.g. ~/.config/execp2p/config.yaml
+func DefaultPath() (string, error) {
+	dir, err := paths.Config()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, FileName), nil
+}
+
+// LoadFile reads the config file at path over cfg: keys it leaves out keep
+// their value. Unknown keys and values of the wrong type are errors; a
+// missing file gives one matching os.ErrNotExist.
+func LoadFile(path string, cfg *Config) error {
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+	if err != nil {
+		return fmt.Errorf("failed to read config file: %w", err)
+	}
+	dec := yaml.NewDecoder(bytes.NewReader(data))
+	dec.KnownFields(true)
+	if err := dec.Decode(cfg); err != nil && !errors.Is(err, io.EOF) {
+		return fmt.Errorf("invalid config file %s: %w", path, err)
+	}
+	return nil
+}
+
+// Validate reports every setting that is out of range or malformed
+func (c *Config) Validate() error {
+	var errs []error
+	check := func(ok bool, format string, args ...interface{}) {
+		if !ok {
+			errs = append(errs, fmt.Errorf(format, args...))
+		}
+	}
+	oneOf := func(key, value string, allowed ...string) {
+		for _, a := range allowed {
+			if value == a {
+				return
+			}
+		}
+		errs = append(errs, fmt.Errorf("%s: %q is not one of %q", key, value, allowed))
+	}
+	positive := func(key string, d time.Duration) {
+		check(d > 0, "%s: must be a positive duration, e.g. 30s or 5m", key)
+	}
+
+	n := c.Network
+	check(validPort(n.MinPort), "network.min_port: %d is not a port", n.MinPort)
+	check(validPort(n.MaxPort), "network.max_port: %d is not a port", n.MaxPort)
+	check(n.MinPort <= n.MaxPort, "network.min_port (%d) is above network.max_port (%d)", n.MinPort, n.MaxPort)
+	check(n.MaxPeers >= 2, "network.max_peers: a room needs at least 2 members, not %d", n.MaxPeers)
+	oneOf("network.tls_key", n.TLSKey, "ed25519", "ecdsa", "rsa")
+	oneOf("network.transport", n.Transport, "quic", "libp2p", "webrtc")
+	check(n.Transport != "webrtc" || c.Discovery.SignalingServer != "", "network.transport: webrtc needs discovery.signaling_server to exchange SDP")
+
+	positive("crypto.key_rotation_interval", c.Crypto.KeyRotationInterval)
+
+	d := c.Discovery
+	check(validPort(d.BTDHTPort), "discovery.dht_port: %d is not a port", d.BTDHTPort)
+	for _, server := range d.STUNServers {
+		_, _, err := net.SplitHostPort(server)
+		check(err == nil, "discovery.stun_servers: %q is not host:port", server)
+	}
+	if d.SignalingServer != "" {
+		check(validHTTPURL(d.SignalingServer), "discovery.signaling_server: %q is not an http(s) URL", d.SignalingServer)
+	}
+	positive("discovery.announce_interval", d.AnnounceInterval)
+	positive("discovery.occupied_interval", d.OccupiedInterval)
+	oneOf("discovery.when_occupied", d.WhenOccupied, "reduce", "stop", "keep")
+
+	oneOf("identity.keystore_protection", c.Identity.KeystoreProtection, "keychain", "passphrase")
+	if nick := c.Room.Nickname; nick != "" {
+		check(roster.CleanNickname(nick) == nick, "room.nickname: %q has surrounding spaces, # or control characters, or more than %d characters", nick, roster.MaxNicknameLength)
+	}
+	check(c.Room.AwayAfter >= 0, "room.away_after: must not be negative")
+	check(c.Room.TTL >= 0, "room.ttl: must not be negative")
+	check(c.Room.IdleTimeout >= 0, "room.idle_timeout: must not be negative")
+	oneOf("trust.on_fingerprint_change", c.Trust.OnFingerprintChange, "refuse", "warn")
+
+	check(c.History.MaxMessages >= 0, "history.max_messages: must not be negative")
+	check(c.History.MaxAge >= 0, "history.max_age: must not be negative")
+	if c.Mailbox.Server != "" {
+		check(validHTTPURL(c.Mailbox.Server), "mailbox.server: %q is not an http(s) URL", c.Mailbox.Server)
+		positive("mailbox.poll_interval", c.Mailbox.PollInterval)
+	}
+	check(!c.Mailbox.ContactMe || c.Mailbox.Server != "", "mailbox.contact_me: needs mailbox.server")
+	check(c.Media.MemoryLimit > 0, "media.memory_limit: must be positive")
+	check(c.Media.CacheLimit >= 0, "media.cache_limit: must not be negative")
+	check(c.Voice.Bitrate > 0, "voice.bitrate: must be positive")
+	positive("voice.max_duration", c.Voice.MaxDuration)
+	if x := c.XMPP; x.Server != "" {
+		_, _, err := net.SplitHostPort(x.Server)
+		check(err == nil, "xmpp.server: %q is not host:port", x.Server)
+		check(x.Domain != "", "xmpp.domain: required with xmpp.server")
+		check(strings.Count(x.Room, "@") == 1 && !strings.HasPrefix(x.Room, "@") && !strings.HasSuffix(x.Room, "@"), "xmpp.room: %q is not a MUC address like room@conference.example.org", x.Room)
+		check(x.Nick != "", "xmpp.nick: required with xmpp.server")
+	}
+	check(c.Bot.RepliesPerMinute > 0, "bot.replies_per_minute: must be positive")
+	check(c.Bot.RoomRepliesPerMinute > 0, "bot.room_replies_per_minute: must be positive")
+	for _, id := range c.Notifications.MutedRooms {
+		check(room.ValidateRoomID(id), "notifications.muted_rooms: %q is not a room ID", id)
+	}
+	if c.Log.Level != "" {
+		oneOf("log.level", c.Log.Level, "debug", "info", "warn", "warning", "error")
+	}
+	return errors.Join(errs...)
+}
+
+func validPort(p int) bool { return p > 0 && p <= 65535 }
+
+func validHTTPURL(s string) bool {
+	u, err := url.Parse(s)
+	return err == nil && (u.Scheme == "http" || u.Scheme == "https") && u.Host != ""
+}
@@ -0,0 +1,208 @@
+package config
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Settings are the options the GUI's settings pane can change. Each field
+// has the key and section it has in the config file, so saving them only
+// touches those keys.
+type Settings struct {
+	Network   NetworkSettings   `json:"network" yaml:"network"`
+	Discovery DiscoverySettings `json:"discovery" yaml:"discovery"`
+	Room      RoomSettings      `json:"room" yaml:"room"`
+	Trust     TrustSettings     `json:"trust" yaml:"trust"`
+	History   HistorySettings   `json:"history" yaml:"history"`
+}
+
+// NetworkSettings are the listening port range and the room size
+type NetworkSettings struct {
+	MinPort  int `json:"min_port" yaml:"min_port"`
+	MaxPort  int `json:"max_port" yaml:"max_port"`
+	MaxPeers int `json:"max_peers" yaml:"max_peers"`
+}
+
+// DiscoverySettings are the ways rooms are found
+type DiscoverySettings struct {
+	EnableMDNS      bool   `json:"enable_mdns" yaml:"enable_mdns"`
+	EnableDHT       bool   `json:"enable_dht" yaml:"enable_dht"`
+	EnableBroadcast bool   `json:"enable_broadcast" yaml:"enable_broadcast"`
+	SignalingServer string `json:"signaling_server" yaml:"signaling_server"`
+	WhenOccupied    string `json:"when_occupied" yaml:"when_occupied"`
+}
+
+// RoomSettings are the defaults for created and joined rooms
+type RoomSettings struct {
+	Nickname  string `json:"nickname" yaml:"nickname"`
+	Incognito bool   `json:"incognito" yaml:"incognito"`
+	Rejoin    bool   `json:"rejoin" yaml:"rejoin"`
+}
+
+// TrustSettings decide how peers' identities are checked
+type TrustSettings struct {
+	OnFingerprintChange string `json:"on_fingerprint_change" yaml:"on_fingerprint_change"`
+	RequireVerified     bool   `json:"require_verified" yaml:"require_verified"`
+	StrictTLS           bool   `json:"strict_tls" yaml:"strict_tls"`
+}
+
+// HistorySettings decide whether messages are kept on disk
+type HistorySettings struct {
+	Enabled     bool `json:"enabled" yaml:"enabled"`
+	MaxMessages int  `json:"max_messages" yaml:"max_messages"`
+}
+
+// Settings returns the part of c the settings pane shows
+func (c *Config) Settings() Settings {
+	return Settings{
+		Network: NetworkSettings{MinPort: c.Network.MinPort, MaxPort: c.Network.MaxPort, MaxPeers: c.Network.MaxPeers},
+		Discovery: DiscoverySettings{
+			EnableMDNS:      c.Discovery.EnableMDNS,
+			EnableDHT:       c.Discovery.EnableBTDHT,
+			EnableBroadcast: c.Discovery.EnableBroadcast,
+			SignalingServer: c.Discovery.SignalingServer,
+			WhenOccupied:    c.Discovery.WhenOccupied,
+		},
+		Room:    RoomSettings{Nickname: c.Room.Nickname, Incognito: c.Room.Incognito, Rejoin: c.Room.Rejoin},
+		Trust:   TrustSettings{OnFingerprintChange: c.Trust.OnFingerprintChange, RequireVerified: c.Trust.RequireVerified, StrictTLS: c.Trust.StrictTLS},
+		History: HistorySettings{Enabled: c.History.Enabled, MaxMessages: c.History.MaxMessages},
+	}
+}
+
+// ApplySettings sets the fields of c that s covers
+func (c *Config) ApplySettings(s Settings) {
+	c.Network.MinPort, c.Network.MaxPort, c.Network.MaxPeers = s.Network.MinPort, s.Network.MaxPort, s.Network.MaxPeers
+	c.Discovery.EnableMDNS = s.Discovery.EnableMDNS
+	c.Discovery.EnableBTDHT = s.Discovery.EnableDHT
+	c.Discovery.EnableBroadcast = s.Discovery.EnableBroadcast
+	c.Discovery.SignalingServer = s.Discovery.SignalingServer
+	c.Discovery.WhenOccupied = s.Discovery.WhenOccupied
+	c.Room.Nickname, c.Room.Incognito, c.Room.Rejoin = s.Room.Nickname, s.Room.Incognito, s.Room.Rejoin
+	c.Trust.OnFingerprintChange, c.Trust.RequireVerified = s.Trust.OnFingerprintChange, s.Trust.RequireVerified
+	c.Trust.StrictTLS = s.Trust.StrictTLS
+	c.History.Enabled, c.History.MaxMessages = s.History.Enabled, s.History.MaxMessages
+}
+
+// SaveSettings writes s to the config file at path, creating it if needed.
+// The file's other keys and its comments are kept.
+func SaveSettings(path string, s Settings) error {
+	return saveValues(path, s)
+}
+
+// SaveNickname writes the default nickname (room.nickname) to the config
+// file at path, like SaveSettings
+func SaveNickname(path, nickname string) error {
+	return saveValues(path, map[string]map[string]string{"room": {"nickname": nickname}})
+}
+
+// SaveLogLevel writes the log level (log.level) to the config file at path,
+// like SaveSettings
+func SaveLogLevel(path, level string) error {
+	return saveValues(path, map[string]map[string]string{"log": {"level": level}})
+}
+
+// SaveNotifications writes the notification settings (notifications) to the
+// config file at path, like SaveSettings
+func SaveNotifications(path string, n NotificationsConfig) error {
+	if n.MutedRooms == nil {
+		// an empty list, so the file's old one is replaced
+		n.MutedRooms = []string{}
+	}
+	return saveValues(path, map[string]NotificationsConfig{"notifications": n})
+}
+
+// saveValues merges the keys v encodes to into the config file at path
+func saveValues(path string, v interface{}) error {
+	var doc yaml.Node
+	data, err := os.ReadFile(path)
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return fmt.Errorf("failed to read config file: %w", err)
+	}
+	if err := yaml.Unmarshal(data, &doc); err != nil {
+		return fmt.Errorf("invalid config file %s: %w", path, err)
+	}
+	if doc.Kind == 0 {
+		// a missing or empty file
+		doc = yaml.Node{Kind: yaml.DocumentNode, Content: []*yaml.Node{{Kind: yaml.MappingNode, Tag: "!!map"}}}
+	}
+	root := doc.Content[0]
+	if root.Kind != yaml.MappingNode {
+		return fmt.Errorf("invalid config file %s: not a mapping of sections", path)
+	}
+
+	var values yaml.Node
+	if err := values.Encode(v); err != nil {
+		return err
+	}
+	mergeMapping(root, &values)
+
+	var buf bytes.Buffer
+	enc := yaml.NewEncoder(&buf)
+	enc.SetIndent(2)
+	if err := enc.Encode(&doc); err != nil {
+		return err
+	}
+	if err := enc.Close(); err != nil {
+		return err
+	}
+	return writeFileAtomic(path, buf.Bytes())
+}
+
+// mergeMapping sets the keys of src in dst, recursing into mappings both
+// have; replaced values keep the comments of the old ones
+func mergeMapping(dst, src *yaml.Node) {
+	for i := 0; i+1 < len(src.Content); i += 2 {
+		key, value := src.Content[i], src.Content[i+1]
+		j := mappingIndex(dst, key.Value)
+		if j < 0 {
+			dst.Content = append(dst.Content, key, value)
+			continue
+		}
+		old := dst.Content[j+1]
+		if old.Kind == yaml.MappingNode && value.Kind == yaml.MappingNode {
+			mergeMapping(old, value)
+			continue
+		}
+		value.HeadComment, value.LineComment, value.FootComment = old.HeadComment, old.LineComment, old.FootComment
+		dst.Content[j+1] = value
+	}
+}
+
+// mappingIndex returns the index of key's node in a mapping, or -1
+func mappingIndex(m *yaml.Node, key string) int {
+	for i := 0; i+1 < len(m.Content); i += 2 {
+		if m.Content[i].Value == key {
+			return i
+		}
+	}
+	return -1
+}
+
+// writeFileAtomic replaces path with data, so a reader never sees half a file
+func writeFileAtomic(path string, data []byte) error {
+	dir := filepath.Dir(path)
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		return fmt.Errorf("failed to create config directory: %w", err)
+	}
+	tmp, err := os.CreateTemp(dir, "."+filepath.Base(path)+".*")
+	if err != nil {
+		return fmt.Errorf("failed to write config file: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return fmt.Errorf("failed to write config file: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("failed to write config file: %w", err)
+	}
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		return fmt.Errorf("failed to write config file: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,45 @@
+package config
+
+import (
+	"context"
+	"os"
+	"time"
+)
+
+// WatchInterval is how often Watch looks at the config file
+const WatchInterval = 2 * time.Second
+
+// Watch calls onChange whenever the file at path is created, modified or
+// removed, until ctx ends. It polls, so editors that replace the file
+// instead of writing to it are noticed too.
+func Watch(ctx context.Context, path string, interval time.Duration, onChange func()) {
+	last := fileState(path)
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if state := fileState(path); state != last {
+				last = state
+				onChange()
+			}
+		}
+	}
+}
+
+// watchedState is what Watch compares between polls
+type watchedState struct {
+	exists  bool
+	size    int64
+	modTime time.Time
+}
+
+func fileState(path string) watchedState {
+	info, err := os.Stat(path)
+	if err != nil {
+		return watchedState{}
+	}
+	return watchedState{exists: true, size: info.Size(), modTime: info.ModTime()}
+}
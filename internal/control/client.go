@@ -0,0 +1,66 @@
+package control
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"time"
+)
+
+// clientTimeout bounds one request to the daemon; a NAT check may take a
+// few seconds
+const clientTimeout = 30 * time.Second
+
+// Client calls the HTTP API of a running daemon
+type Client struct {
+	http  *http.Client
+	base  string
+	token string
+}
+
+// NewClient returns a client for the daemon on the unix socket, or on the
+// loopback TCP address addr if set
+func NewClient(socket, addr, token string) *Client {
+	c := &Client{http: &http.Client{Timeout: clientTimeout}, base: "http://" + addr, token: token}
+	if addr == "" {
+		// the host part is ignored, every request goes to the socket
+		c.base = "http://daemon"
+		c.http.Transport = &http.Transport{
+			DialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+				var d net.Dialer
+				return d.DialContext(ctx, "unix", socket)
+			},
+		}
+	}
+	return c
+}
+
+// Get requests path, e.g. "/v1/status", and decodes the answer into v
+func (c *Client) Get(ctx context.Context, path string, v interface{}) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, c.base+path, nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Authorization", "Bearer "+c.token)
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return fmt.Errorf("daemon not reachable: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		var e struct {
+			Error string `json:"error"`
+		}
+		if json.NewDecoder(resp.Body).Decode(&e) == nil && e.Error != "" {
+			return fmt.Errorf("daemon answered %s: %s", resp.Status, e.Error)
+		}
+		return fmt.Errorf("daemon answered %s", resp.Status)
+	}
+	if err := json.NewDecoder(resp.Body).Decode(v); err != nil {
+		return fmt.Errorf("invalid answer from the daemon: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,813 @@
+// Package control lets local programs drive the ExecP2P backend without a
+// GUI: create and join rooms, send messages, read history and follow events.
+// The operations are named methods taking and returning JSON, so the same set
+// is served over HTTP (see Serve) and over any other framing.
+package control
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"slices"
+	"time"
+
+	"execp2p/internal/app"
+	"execp2p/internal/ban"
+	"execp2p/internal/crash"
+	"execp2p/internal/crypto"
+	"execp2p/internal/diagnostics"
+	"execp2p/internal/history"
+	"execp2p/internal/network"
+	"execp2p/internal/rejoin"
+	"execp2p/internal/roster"
+	"execp2p/internal/trust"
+)
+
+var (
+	// ErrUnknownMethod is returned by Call for a method that doesn't exist
+	ErrUnknownMethod = errors.New("unknown method")
+	// ErrInvalidParams is wrapped by errors about a method's parameters
+	ErrInvalidParams = errors.New("invalid parameters")
+)
+
+// defaultHistoryLimit is the page size of the history method
+const defaultHistoryLimit = 50
+
+// Controller exposes an app.ExecP2P to local programs. It takes the place of
+// the GUI: Run consumes the backend's notices and keeps connections alive.
+type Controller struct {
+	app    *app.ExecP2P
+	self   string
+	events *hub
+	// methods by name; params is the raw JSON object, possibly empty
+	methods map[string]func(ctx context.Context, params json.RawMessage) (interface{}, error)
+}
+
+// New returns a Controller for e; nothing happens until Run
+func New(e *app.ExecP2P) *Controller {
+	c := &Controller{
+		app:    e,
+		self:   e.GetNetworkStatus().PeerID,
+		events: newHub(),
+	}
+	c.methods = map[string]func(context.Context, json.RawMessage) (interface{}, error){
+		"status":        c.status,
+		"create_room":   c.createRoom,
+		"join_room":     c.joinRoom,
+		"leave_room":    c.leaveRoom,
+		"send":          c.send,
+		"set_nickname":  c.setNickname,
+		"set_status":    c.setStatus,
+		"set_presence":  c.setPresence,
+		"peers":         c.peers,
+		"kick":          c.kick,
+		"accept_peer":   c.acceptPeer,
+		"reject_peer":   c.rejectPeer,
+		"ban":           c.ban,
+		"unban":         c.unban,
+		"bans":          c.bans,
+		"set_role":      c.setRole,
+		"rename_room":   c.renameRoom,
+		"history":       c.history,
+		"nat":           c.nat,
+		"reload_config": c.reloadConfig,
+		"own_devices":   c.ownDevices,
+		"wipe_device":   c.wipeDevice,
+
+		"contact":          c.contact,
+		"contact_requests": c.contactRequests,
+		"accept_contact":   c.acceptContact,
+		"dismiss_contact":  c.dismissContact,
+	}
+	return c
+}
+
+// Call runs the named method with params, a JSON object
+func (c *Controller) Call(ctx context.Context, method string, params json.RawMessage) (interface{}, error) {
+	m, ok := c.methods[method]
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", ErrUnknownMethod, method)
+	}
+	return m(ctx, params)
+}
+
+// decodeParams reads a method's parameters; absent parameters leave v as is
+func decodeParams(params json.RawMessage, v interface{}) error {
+	if len(params) == 0 || string(params) == "null" {
+		return nil
+	}
+	if err := json.Unmarshal(params, v); err != nil {
+		return fmt.Errorf("%w: %v", ErrInvalidParams, err)
+	}
+	return nil
+}
+
+// Status is the answer to the status method
+type Status struct {
+	PeerID      string `json:"peer_id"`
+	Fingerprint string `json:"fingerprint"`
+	Nickname    string `json:"nickname"`
+	RoomID      string `json:"room_id,omitempty"`
+	RoomName    string `json:"room_name,omitempty"`
+	Role        string `json:"role,omitempty"`
+	// RFC 3339; when the room we host closes by itself
+	ClosesAt       string `json:"closes_at,omitempty"`
+	AccessKey      string `json:"access_key,omitempty"`
+	ListenPort     int    `json:"listen_port,omitempty"`
+	Listener       bool   `json:"listener"`
+	Incognito      bool   `json:"incognito"`
+	Running        bool   `json:"running"`
+	ConnectedPeers int    `json:"connected_peers"`
+	Encrypted      bool   `json:"e2e_encryption"`
+	Degraded       bool   `json:"degraded"`
+
+	Transport app.TransportInfo `json:"transport"`
+}
+
+func (c *Controller) status(ctx context.Context, params json.RawMessage) (interface{}, error) {
+	return c.currentStatus(), nil
+}
+
+func (c *Controller) currentStatus() Status {
+	net := c.app.GetNetworkStatus()
+	s := Status{
+		PeerID:         c.self,
+		Nickname:       c.app.DisplayName(c.self),
+		Incognito:      c.app.IsIncognito(),
+		Running:        net.IsRunning,
+		Listener:       net.IsListener,
+		ConnectedPeers: net.ConnectedPeers,
+		Encrypted:      net.E2EEncryption,
+		Degraded:       net.Degraded,
+	}
+	s.Fingerprint, _ = c.app.GetPeerFingerprint()
+	s.Transport = c.app.Transport()
+	if r := c.app.GetRoomInfo(); r != nil {
+		s.RoomID, s.RoomName, s.Role, s.ClosesAt = r.ID, net.RoomName, net.Role, net.ClosesAt
+		// the invite is only ours to hand out as the host
+		if s.Listener {
+			s.AccessKey = r.AccessKey
+			s.ListenPort = c.app.GetListenPort()
+		}
+	}
+	return s
+}
+
+// nat checks whether we are behind a NAT; the result is cached for a while
+func (c *Controller) nat(ctx context.Context, params json.RawMessage) (interface{}, error) {
+	return c.app.NATStatus(), nil
+}
+
+// reloadConfig reads the config file again and applies what it can without
+// leaving the room
+func (c *Controller) reloadConfig(ctx context.Context, params json.RawMessage) (interface{}, error) {
+	return c.app.ReloadConfig()
+}
+
+// Room is the answer to create_room and join_room
+type Room struct {
+	RoomID     string `json:"room_id"`
+	AccessKey  string `json:"access_key,omitempty"`
+	ListenPort int    `json:"listen_port,omitempty"`
+	Incognito  bool   `json:"incognito"`
+}
+
+func (c *Controller) createRoom(ctx context.Context, params json.RawMessage) (interface{}, error) {
+	if err := c.lobby(); err != nil {
+		return nil, err
+	}
+	opts := c.app.DefaultRoomOptions()
+	var p struct {
+		Incognito bool `json:"incognito"`
+		// durations such as "30m"; the config's when left out
+		TTL         string `json:"ttl"`
+		IdleTimeout string `json:"idle_timeout"`
+	}
+	if err := decodeParams(params, &p); err != nil {
+		return nil, err
+	}
+	opts.Incognito = p.Incognito
+	if err := durationParam("ttl", p.TTL, &opts.TTL); err != nil {
+		return nil, err
+	}
+	if err := durationParam("idle_timeout", p.IdleTimeout, &opts.IdleTimeout); err != nil {
+		return nil, err
+	}
+	// the room outlives the request that created it
+	result, err := c.app.CreateRoomWithOptions(context.WithoutCancel(ctx), opts)
+	if err != nil {
+		return nil, err
+	}
+	return Room{RoomID: result.RoomID, AccessKey: result.AccessKey, ListenPort: result.ListenPort, Incognito: result.Incognito}, nil
+}
+
+// durationParam parses a duration parameter such as "30m" into to, unless
+// it was left out
+func durationParam(key, value string, to *time.Duration) error {
+	if value == "" {
+		return nil
+	}
+	d, err := time.ParseDuration(value)
+	if err != nil || d < 0 {
+		return fmt.Errorf("%w: %s: %q is not a duration such as 30m", ErrInvalidParams, key, value)
+	}
+	*to = d
+	return nil
+}
+
+// rejoin enters the room we were in when the process last stopped again
+// (room.rejoin); one room at a time, so the latest one. When its host can't
+// be found yet, it is tried again in the background while we stay in the
+// lobby.
+func (c *Controller) rejoin(ctx context.Context) {
+	defer crash.Recover("control.rejoin")
+	rooms := c.app.RoomsToRejoin()
+	if len(rooms) == 0 {
+		return
+	}
+	r := rooms[len(rooms)-1]
+	event := rejoined{RoomID: r.RoomID, Host: r.Host}
+	err := c.app.Rejoin(ctx, r)
+	if err != nil {
+		event.Error = err.Error()
+	}
+	c.events.publish(EventRejoined, event)
+	if err == nil {
+		return
+	}
+	c.app.RejoinLater(ctx, []rejoin.Room{r}, func(r rejoin.Room) error {
+		if err := c.lobby(); err != nil {
+			return err
+		}
+		if err := c.app.Rejoin(ctx, r); err != nil {
+			return err
+		}
+		c.events.publish(EventRejoined, rejoined{RoomID: r.RoomID, Host: r.Host})
+		return nil
+	})
+}
+
+// lobby checks we are out of any room: the daemon is in one at a time
+func (c *Controller) lobby() error {
+	if room := c.app.GetRoomInfo(); room != nil {
+		return fmt.Errorf("already in room %s; leave_room first", room.ID)
+	}
+	return nil
+}
+
+func (c *Controller) joinRoom(ctx context.Context, params json.RawMessage) (interface{}, error) {
+	if err := c.lobby(); err != nil {
+		return nil, err
+	}
+	var p struct {
+		RoomID    string `json:"room_id"`
+		AccessKey string `json:"access_key"`
+		// host:port of the host, to skip discovery
+		Address string `json:"address"`
+	}
+	if err := decodeParams(params, &p); err != nil {
+		return nil, err
+	}
+	if p.RoomID == "" || p.AccessKey == "" {
+		return nil, fmt.Errorf("%w: room_id and access_key are required", ErrInvalidParams)
+	}
+	if err := c.app.JoinRoom(context.WithoutCancel(ctx), p.RoomID, p.Address, p.AccessKey); err != nil {
+		return nil, err
+	}
+	return Room{RoomID: p.RoomID, Incognito: c.app.IsIncognito()}, nil
+}
+
+func (c *Controller) leaveRoom(ctx context.Context, params json.RawMessage) (interface{}, error) {
+	room := c.app.GetRoomInfo()
+	if room == nil {
+		return nil, fmt.Errorf("not in a room")
+	}
+	// back in the lobby: the next create_room or join_room runs in this process
+	c.app.LeaveRoom()
+	return map[string]string{"room_id": room.ID}, nil
+}
+
+func (c *Controller) send(ctx context.Context, params json.RawMessage) (interface{}, error) {
+	c.app.NoteActivity()
+	var p struct {
+		Text string `json:"text"`
+	}
+	if err := decodeParams(params, &p); err != nil {
+		return nil, err
+	}
+	if p.Text == "" {
+		return nil, fmt.Errorf("%w: text is required", ErrInvalidParams)
+	}
+	// the JSON form the GUI sends, so it renders the message as its own
+	body, err := json.Marshal(chatMessage{Type: "text", Content: p.Text})
+	if err != nil {
+		return nil, err
+	}
+	id := crypto.NewMessageID()
+	if err := c.app.SendMessageWithID(ctx, id, string(body)); err != nil {
+		undelivered, partly := network.PartlyDelivered(err)
+		if !partly {
+			diagnostics.Inc(diagnostics.MessageSendFailed)
+			return nil, err
+		}
+		diagnostics.Inc(diagnostics.MessageSent)
+		// sent, but some members didn't get it; sending it again would
+		// repeat it to the others
+		return sendResult{ID: id, Undelivered: undelivered}, nil
+	}
+	diagnostics.Inc(diagnostics.MessageSent)
+	return sendResult{ID: id}, nil
+}
+
+// sendResult is the ID of the sent message, the one its message event
+// carries, and the members it didn't reach when it reached the others
+type sendResult struct {
+	ID          string   `json:"id"`
+	Undelivered []string `json:"undelivered,omitempty"`
+}
+
+func (c *Controller) setNickname(ctx context.Context, params json.RawMessage) (interface{}, error) {
+	var p struct {
+		Nickname string `json:"nickname"`
+	}
+	if err := decodeParams(params, &p); err != nil {
+		return nil, err
+	}
+	nickname := roster.CleanNickname(p.Nickname)
+	if nickname == "" {
+		return nil, fmt.Errorf("%w: nickname is required", ErrInvalidParams)
+	}
+	name := c.app.SetLocalNickname(nickname)
+	if c.app.GetRoomInfo() != nil {
+		body, _ := json.Marshal(chatMessage{Type: "nickname_update", Nickname: nickname})
+		if err := c.app.SendMessage(ctx, string(body)); err != nil {
+			return nil, fmt.Errorf("nickname set, but not announced to the room: %w", err)
+		}
+	}
+	return map[string]string{"nickname": name}, nil
+}
+
+func (c *Controller) setStatus(ctx context.Context, params json.RawMessage) (interface{}, error) {
+	var p struct {
+		Status string `json:"status"`
+	}
+	if err := decodeParams(params, &p); err != nil {
+		return nil, err
+	}
+	profile, err := c.app.SetProfileStatus(p.Status)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidParams, err)
+	}
+	return map[string]string{"status": profile.Status}, nil
+}
+
+func (c *Controller) setPresence(ctx context.Context, params json.RawMessage) (interface{}, error) {
+	var p struct {
+		Presence string `json:"presence"`
+	}
+	if err := decodeParams(params, &p); err != nil {
+		return nil, err
+	}
+	presence, err := app.ParsePresence(p.Presence)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidParams, err)
+	}
+	if err := c.app.SetPresence(presence); err != nil {
+		return nil, err
+	}
+	return map[string]string{"presence": string(presence)}, nil
+}
+
+func (c *Controller) kick(ctx context.Context, params json.RawMessage) (interface{}, error) {
+	var p struct {
+		PeerID string `json:"peer_id"`
+		Reason string `json:"reason"`
+	}
+	if err := decodeParams(params, &p); err != nil {
+		return nil, err
+	}
+	if p.PeerID == "" {
+		return nil, fmt.Errorf("%w: peer_id is required", ErrInvalidParams)
+	}
+	if err := c.app.KickPeer(p.PeerID, p.Reason); err != nil {
+		return nil, err
+	}
+	return map[string]string{"peer_id": p.PeerID}, nil
+}
+
+// ownDevices lists the connected devices that hold our identity
+func (c *Controller) ownDevices(ctx context.Context, params json.RawMessage) (interface{}, error) {
+	devices := c.app.OwnDevices()
+	if devices == nil {
+		devices = []string{}
+	}
+	return map[string]interface{}{"peer_ids": devices, "primary": c.app.IsPrimaryDevice()}, nil
+}
+
+// wipeDevice orders a linked device to wipe itself, see app.WipeDevice
+func (c *Controller) wipeDevice(ctx context.Context, params json.RawMessage) (interface{}, error) {
+	var p struct {
+		PeerID string `json:"peer_id"`
+	}
+	if err := decodeParams(params, &p); err != nil {
+		return nil, err
+	}
+	if p.PeerID == "" {
+		return nil, fmt.Errorf("%w: peer_id is required", ErrInvalidParams)
+	}
+	if err := c.app.WipeDevice(p.PeerID); err != nil {
+		return nil, err
+	}
+	return map[string]string{"peer_id": p.PeerID}, nil
+}
+
+func (c *Controller) deviceWiped(w app.DeviceWiped) {
+	ev := deviceWiped{PeerID: w.PeerID}
+	if w.Err != nil {
+		ev.Error = w.Err.Error()
+	}
+	c.events.publish(EventDeviceWiped, ev)
+}
+
+// acceptPeer accepts a quarantined peer, pinning what it presented
+func (c *Controller) acceptPeer(ctx context.Context, params json.RawMessage) (interface{}, error) {
+	return c.decidePeer(params, c.app.AcceptPeer)
+}
+
+// rejectPeer rejects a quarantined peer, refusing it until released
+func (c *Controller) rejectPeer(ctx context.Context, params json.RawMessage) (interface{}, error) {
+	return c.decidePeer(params, c.app.RejectPeer)
+}
+
+func (c *Controller) decidePeer(params json.RawMessage, decide func(string) error) (interface{}, error) {
+	var p struct {
+		PeerID string `json:"peer_id"`
+	}
+	if err := decodeParams(params, &p); err != nil {
+		return nil, err
+	}
+	if p.PeerID == "" {
+		return nil, fmt.Errorf("%w: peer_id is required", ErrInvalidParams)
+	}
+	if err := decide(p.PeerID); err != nil {
+		return nil, err
+	}
+	return map[string]string{"peer_id": p.PeerID}, nil
+}
+
+// ban bans a connected peer's identity, or a fingerprint
+func (c *Controller) ban(ctx context.Context, params json.RawMessage) (interface{}, error) {
+	var p struct {
+		PeerID      string `json:"peer_id"`
+		Fingerprint string `json:"fingerprint"`
+		Reason      string `json:"reason"`
+	}
+	if err := decodeParams(params, &p); err != nil {
+		return nil, err
+	}
+	var err error
+	switch {
+	case p.Fingerprint != "":
+		err = c.app.BanFingerprint(p.Fingerprint, p.Reason)
+	case p.PeerID != "":
+		err = c.app.BanPeer(p.PeerID, p.Reason)
+	default:
+		return nil, fmt.Errorf("%w: peer_id or fingerprint is required", ErrInvalidParams)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return c.banList(), nil
+}
+
+func (c *Controller) unban(ctx context.Context, params json.RawMessage) (interface{}, error) {
+	var p struct {
+		Fingerprint string `json:"fingerprint"`
+	}
+	if err := decodeParams(params, &p); err != nil {
+		return nil, err
+	}
+	if p.Fingerprint == "" {
+		return nil, fmt.Errorf("%w: fingerprint is required", ErrInvalidParams)
+	}
+	if err := c.app.UnbanFingerprint(p.Fingerprint); err != nil {
+		return nil, err
+	}
+	return c.banList(), nil
+}
+
+// contact leaves a first message for someone who published a contact
+// bundle, inviting them to our room with invite
+func (c *Controller) contact(ctx context.Context, params json.RawMessage) (interface{}, error) {
+	var p struct {
+		UserID      string `json:"user_id"`
+		Fingerprint string `json:"fingerprint"`
+		Text        string `json:"text"`
+		Invite      bool   `json:"invite"`
+	}
+	if err := decodeParams(params, &p); err != nil {
+		return nil, err
+	}
+	if p.UserID == "" || p.Text == "" {
+		return nil, fmt.Errorf("%w: user_id and text are required", ErrInvalidParams)
+	}
+	fingerprint, err := c.app.ContactUser(ctx, p.UserID, p.Fingerprint, p.Text, p.Invite)
+	if err != nil {
+		return nil, err
+	}
+	return map[string]string{"user_id": p.UserID, "fingerprint": fingerprint}, nil
+}
+
+func (c *Controller) contactRequests(ctx context.Context, params json.RawMessage) (interface{}, error) {
+	requests := c.app.ContactRequests()
+	if requests == nil {
+		requests = []app.ContactRequest{}
+	}
+	return requests, nil
+}
+
+// acceptContact pins the sender of a first message and returns the room it
+// invites to, to be entered with join_room
+func (c *Controller) acceptContact(ctx context.Context, params json.RawMessage) (interface{}, error) {
+	id, err := contactRequestID(params)
+	if err != nil {
+		return nil, err
+	}
+	rendezvous, err := c.app.AcceptContactRequest(id)
+	if err != nil {
+		return nil, err
+	}
+	result := map[string]string{"id": id}
+	if rendezvous != nil {
+		result["room_id"], result["access_key"], result["address"] = rendezvous.RoomID, rendezvous.AccessKey, rendezvous.Address
+	}
+	return result, nil
+}
+
+func (c *Controller) dismissContact(ctx context.Context, params json.RawMessage) (interface{}, error) {
+	id, err := contactRequestID(params)
+	if err != nil {
+		return nil, err
+	}
+	if err := c.app.DismissContactRequest(id); err != nil {
+		return nil, err
+	}
+	return map[string]string{"id": id}, nil
+}
+
+func contactRequestID(params json.RawMessage) (string, error) {
+	var p struct {
+		ID string `json:"id"`
+	}
+	if err := decodeParams(params, &p); err != nil {
+		return "", err
+	}
+	if p.ID == "" {
+		return "", fmt.Errorf("%w: id is required", ErrInvalidParams)
+	}
+	return p.ID, nil
+}
+
+func (c *Controller) bans(ctx context.Context, params json.RawMessage) (interface{}, error) {
+	return c.banList(), nil
+}
+
+func (c *Controller) setRole(ctx context.Context, params json.RawMessage) (interface{}, error) {
+	var p struct {
+		PeerID string `json:"peer_id"`
+		Role   string `json:"role"`
+	}
+	if err := decodeParams(params, &p); err != nil {
+		return nil, err
+	}
+	role, err := app.ParseRole(p.Role)
+	if err != nil || p.PeerID == "" {
+		return nil, fmt.Errorf("%w: peer_id and a role (moderator or member) are required", ErrInvalidParams)
+	}
+	if err := c.app.SetPeerRole(p.PeerID, role); err != nil {
+		return nil, err
+	}
+	return map[string]string{"peer_id": p.PeerID, "role": string(role)}, nil
+}
+
+func (c *Controller) renameRoom(ctx context.Context, params json.RawMessage) (interface{}, error) {
+	var p struct {
+		Name string `json:"name"`
+	}
+	if err := decodeParams(params, &p); err != nil {
+		return nil, err
+	}
+	name, err := c.app.RenameRoom(p.Name)
+	if err != nil {
+		return nil, err
+	}
+	return map[string]string{"name": name}, nil
+}
+
+// banList is the current room's ban list, empty rather than null
+func (c *Controller) banList() []ban.Entry {
+	if bans := c.app.Bans(); bans != nil {
+		return bans
+	}
+	return []ban.Entry{}
+}
+
+// Peer is a room member in the answer to the peers method
+type Peer struct {
+	PeerID      string `json:"peer_id"`
+	Name        string `json:"name"`
+	Fingerprint string `json:"fingerprint"`
+	Verified    bool   `json:"verified"`
+	// "unverified", "keys_exchanged" or "user_verified"; empty for ourselves
+	Verification string `json:"verification,omitempty"`
+	Local        bool   `json:"local"`
+	// status text from the member's signed profile
+	Status string `json:"status,omitempty"`
+	// online, away or dnd
+	Presence string `json:"presence"`
+	// host, moderator or member
+	Role string `json:"role"`
+	// the connection to the member; empty for ourselves
+	Address   string `json:"address,omitempty"`
+	Transport string `json:"transport,omitempty"` // e.g. quic/direct
+	// unix seconds; activity is anything received, keep-alives included
+	ConnectedSince int64 `json:"connected_since,omitempty"`
+	LastActivity   int64 `json:"last_activity,omitempty"`
+	// connected, but silent for a while
+	Offline bool `json:"offline,omitempty"`
+}
+
+func (c *Controller) peers(ctx context.Context, params json.RawMessage) (interface{}, error) {
+	return c.peerList(), nil
+}
+
+// peerList returns the room members for the peers method and event
+func (c *Controller) peerList() []Peer {
+	peers := []Peer{}
+	for _, member := range c.app.GetPeers() {
+		peers = append(peers, Peer{
+			PeerID:         member.ID,
+			Name:           member.Nickname,
+			Fingerprint:    member.Fingerprint,
+			Verified:       member.Verification == string(trust.StateUserVerified),
+			Verification:   member.Verification,
+			Local:          member.IsLocal,
+			Status:         member.Status,
+			Presence:       member.Presence,
+			Role:           member.Role,
+			Address:        member.Address,
+			Transport:      member.Transport,
+			ConnectedSince: member.ConnectedSince,
+			LastActivity:   member.LastActivity,
+			Offline:        member.Offline,
+		})
+	}
+	return peers
+}
+
+// HistoryPage is the answer to the history method, oldest message first
+type HistoryPage struct {
+	Messages []history.Record `json:"messages"`
+	// the before cursor of the preceding page, empty at the start
+	Next string `json:"next,omitempty"`
+}
+
+func (c *Controller) history(ctx context.Context, params json.RawMessage) (interface{}, error) {
+	p := struct {
+		RoomID string `json:"room_id"`
+		Before string `json:"before"`
+		Limit  int    `json:"limit"`
+	}{Limit: defaultHistoryLimit}
+	if err := decodeParams(params, &p); err != nil {
+		return nil, err
+	}
+	if p.RoomID == "" {
+		if r := c.app.GetRoomInfo(); r != nil {
+			p.RoomID = r.ID
+		}
+	}
+	if p.RoomID == "" {
+		return nil, fmt.Errorf("%w: room_id is required outside a room", ErrInvalidParams)
+	}
+	page, err := c.app.History(p.RoomID, p.Before, p.Limit)
+	if err != nil {
+		return nil, err
+	}
+	if page.Records == nil {
+		page.Records = []history.Record{}
+	}
+	return HistoryPage{Messages: page.Records, Next: page.Next}, nil
+}
+
+// Run keeps the backend's connections alive and turns its notices into
+// events until ctx ends. Only one consumer may read the backend's notices,
+// so a Controller can't run next to the GUI. With room.rejoin on, the room
+// the process was in when it last stopped is entered again.
+func (c *Controller) Run(ctx context.Context) {
+	go c.app.KeepAlive(ctx)
+	go c.rejoin(ctx)
+
+	// after a panic the events go on, the crash among them
+	for !c.publishEvents(ctx) {
+	}
+}
+
+// publishEvents turns the backend's notices into events until ctx ends or
+// the backend closes; it returns false if handling one panicked
+func (c *Controller) publishEvents(ctx context.Context) (done bool) {
+	defer crash.Recover("control.publishEvents")
+	messages, unsubscribe := c.app.Subscribe(0)
+	defer unsubscribe()
+	ticker := time.NewTicker(statusInterval)
+	defer ticker.Stop()
+
+	var last Status
+	var lastPeers string
+	publishStatus := func() {
+		if s := c.currentStatus(); s != last {
+			last = s
+			c.events.publish(EventStatus, s)
+		}
+		peers := c.peerList()
+		// activity alone is not a change of membership
+		quiet := slices.Clone(peers)
+		for i := range quiet {
+			quiet[i].LastActivity = 0
+		}
+		if b, _ := json.Marshal(quiet); string(b) != lastPeers {
+			lastPeers = string(b)
+			c.events.publish(EventPeers, peers)
+		}
+	}
+	for {
+		select {
+		case <-ctx.Done():
+			return true
+		case msg, ok := <-messages:
+			if !ok {
+				// a remote wipe lets the subscribers go right after its notice
+				select {
+				case w := <-c.app.DeviceWipedNotices():
+					c.deviceWiped(w)
+				default:
+				}
+				return true
+			}
+			c.message(msg)
+		case w := <-c.app.DeviceWipedNotices():
+			c.deviceWiped(w)
+		case change := <-c.app.FingerprintChanges():
+			c.events.publish(EventFingerprintChanged, change)
+		case q := <-c.app.QuarantineNotices():
+			c.events.publish(EventQuarantined, q)
+		case r := <-c.app.HistorySyncNotices():
+			c.events.publish(EventHistorySynced, historySynced{PeerID: r.PeerID, Rooms: r.Rooms, Messages: r.Messages, Failed: r.Failed})
+		case t := <-c.app.TransferNotices():
+			c.events.publish(EventTransfer, transferEvent(t))
+		case r := <-c.app.AccessKeyNotices():
+			c.events.publish(EventAccessKey, Room{RoomID: r.RoomID, AccessKey: r.AccessKey})
+		case r := <-c.app.RekeyNotices():
+			c.events.publish(EventRekey, rekey{Epoch: r.Epoch, Reason: r.Reason, Departed: r.Departed, Remaining: r.Remaining})
+		case a := <-c.app.ArchiveNotices():
+			c.events.publish(EventArchive, a)
+		case d := <-c.app.MailboxNotices():
+			c.events.publish(EventMailbox, mailboxDelivered{Messages: d.Messages, Rooms: d.Rooms, Rejected: d.Rejected, ContactRequests: d.ContactRequests})
+		case p := <-c.app.PresenceNotices():
+			c.events.publish(EventPresence, presenceChanged{PeerID: p.PeerID, Presence: string(p.Presence), Local: p.Local})
+		case d := <-c.app.DepartureNotices():
+			c.events.publish(EventPeerDisconnected, peerDisconnected{RoomID: d.RoomID, PeerID: d.PeerID, Reason: d.Reason})
+		case l := <-c.app.LivenessNotices():
+			event := EventPeerOffline
+			if l.Online {
+				event = EventPeerOnline
+			}
+			c.events.publish(event, peerLiveness{RoomID: l.RoomID, PeerID: l.PeerID})
+		case err := <-c.app.NetworkErrors():
+			c.events.publish(EventNetworkError, newNetworkError(err))
+		case k := <-c.app.KickNotices():
+			c.events.publish(EventKicked, kicked{RoomID: k.RoomID, Reason: k.Reason})
+		case r := <-c.app.ClosedNotices():
+			c.events.publish(EventRoomClosed, roomClosed{RoomID: r.RoomID, Reason: r.Reason, Local: r.Local})
+		case cr := <-c.app.CrashNotices():
+			c.events.publish(EventCrash, crashed{Where: cr.Where, Panic: cr.Panic, Version: cr.Version, Platform: cr.Platform, Recovered: cr.Recovered, Report: cr.Path, Rooms: cr.Rooms})
+		case b := <-c.app.BanNotices():
+			c.events.publish(EventBanned, banned{RoomID: b.RoomID, Fingerprint: b.Fingerprint, Nickname: b.Nickname, Reason: b.Reason, Lifted: b.Lifted, Local: b.Local})
+		case <-c.app.ShortcodeNotices():
+		case <-c.app.VoicePlaybackNotices():
+		case <-c.app.StatusNotices():
+			publishStatus()
+		case <-ticker.C:
+			// the connection recovers without a notice once the peer is heard again
+			publishStatus()
+		}
+	}
+}
+
+// Events returns the events published from now on, and a function that
+// ends the subscription. The channel is closed when the subscription ends,
+// and also when the subscriber falls more than buffer events behind: a
+// consumer that lost events has to resynchronize (status, peers, history).
+func (c *Controller) Events(buffer int) (<-chan Event, func()) {
+	return c.events.subscribe(buffer)
+}
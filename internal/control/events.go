@@ -0,0 +1,293 @@
+package control
+
+import (
+	"encoding/json"
+	"errors"
+	"sync"
+	"time"
+
+	"execp2p/internal/app"
+	"execp2p/internal/crypto"
+	"execp2p/internal/diagnostics"
+	"execp2p/internal/logger"
+	"execp2p/internal/network"
+)
+
+// event types
+const (
+	EventMessage            = "message"
+	EventNickname           = "nickname"
+	EventStatus             = "status"
+	EventPeers              = "peers"
+	EventFingerprintChanged = "fingerprint_changed"
+	EventQuarantined        = "peer_quarantined"
+	EventTransfer           = "transfer"
+	EventHistorySynced      = "history_synced"
+	EventAccessKey          = "access_key"
+	EventRekey              = "rekey"
+	EventArchive            = "archive"
+	EventMailbox            = "mailbox"
+	EventPresence           = "presence"
+	EventKicked             = "kicked"
+	EventPeerDisconnected   = "peer_disconnected"
+	EventPeerOffline        = "peer_offline"
+	EventPeerOnline         = "peer_online"
+	EventBanned             = "banned"
+	EventRoomClosed         = "room_closed"
+	EventRejoined           = "rejoined"
+	EventNetworkError       = "network_error"
+	EventCrash              = "crash"
+	EventDeviceWiped        = "device_wiped"
+	// the subscriber fell behind and missed events
+	EventsLost = "events_lost"
+)
+
+const (
+	// how often status and membership are checked for changes nobody
+	// announced
+	statusInterval = 5 * time.Second
+	// events a subscriber may fall behind before it is cut off
+	defaultEventBuffer = 256
+)
+
+// Event is something that happened in the backend. Data depends on Type:
+// Message for "message", Status for "status", []Peer for "peers" and so on.
+type Event struct {
+	Type string      `json:"type"`
+	Time time.Time   `json:"time"`
+	Data interface{} `json:"data"`
+}
+
+// Message is an incoming chat message
+type Message struct {
+	ID         string `json:"id"`
+	RoomID     string `json:"room_id"`
+	SenderID   string `json:"sender_id"`
+	SenderName string `json:"sender_name"`
+	// "text", or what the GUI sends: "image", "gif", "audio", "file"
+	Type string `json:"type"`
+	Text string `json:"text"`
+	// the media or file, for media messages
+	MediaID   string    `json:"media_id,omitempty"`
+	Size      int64     `json:"size,omitempty"`
+	Timestamp time.Time `json:"timestamp"`
+	// how many of the sender's messages before this one never arrived
+	Gap uint64 `json:"gap,omitempty"`
+}
+
+// chatMessage is the JSON form of chat messages sent by the frontends
+type chatMessage struct {
+	Type     string `json:"type"`
+	Content  string `json:"content"`
+	Nickname string `json:"nickname,omitempty"`
+	MediaID  string `json:"media_id,omitempty"`
+	Size     int64  `json:"size,omitempty"`
+}
+
+type nicknameChange struct {
+	PeerID string `json:"peer_id"`
+	Name   string `json:"name"`
+}
+
+type deviceWiped struct {
+	PeerID string `json:"peer_id"`
+	Error  string `json:"error,omitempty"`
+}
+
+type historySynced struct {
+	PeerID   string `json:"peer_id"`
+	Rooms    int    `json:"rooms"`
+	Messages int    `json:"messages"`
+	Failed   int    `json:"failed"`
+}
+
+type rekey struct {
+	Epoch     uint64   `json:"epoch"`
+	Reason    string   `json:"reason"`
+	Departed  []string `json:"departed"`
+	Remaining int      `json:"remaining"`
+}
+
+type mailboxDelivered struct {
+	Messages        int      `json:"messages"`
+	Rooms           []string `json:"rooms"`
+	Rejected        int      `json:"rejected"`
+	ContactRequests int      `json:"contact_requests"`
+}
+
+type presenceChanged struct {
+	PeerID   string `json:"peer_id"`
+	Presence string `json:"presence"`
+	Local    bool   `json:"local"`
+}
+
+type peerDisconnected struct {
+	RoomID string `json:"room_id"`
+	PeerID string `json:"peer_id"`
+	Reason string `json:"reason"`
+}
+
+type peerLiveness struct {
+	RoomID string `json:"room_id"`
+	PeerID string `json:"peer_id"`
+}
+
+// networkError is a transport error; Code is one of the network.ErrorCode
+// values, Reason the close reason when the peer gave one
+type networkError struct {
+	Code      string `json:"code"`
+	Reason    string `json:"reason,omitempty"`
+	Message   string `json:"message"`
+	Retryable bool   `json:"retryable"`
+}
+
+func newNetworkError(err error) networkError {
+	e := networkError{Code: string(network.Code(err)), Message: err.Error(), Retryable: network.Retryable(err)}
+	var closeErr *network.CloseError
+	if errors.As(err, &closeErr) {
+		e.Reason = closeErr.Reason
+	}
+	return e
+}
+
+type kicked struct {
+	RoomID string `json:"room_id"`
+	Reason string `json:"reason,omitempty"`
+}
+
+type roomClosed struct {
+	RoomID string `json:"room_id"`
+	Reason string `json:"reason,omitempty"`
+	Local  bool   `json:"local"`
+}
+
+// crashed is a panic in the backend; rooms lists those left because of it
+type crashed struct {
+	Where     string   `json:"where"`
+	Panic     string   `json:"panic"`
+	Version   string   `json:"version"`
+	Platform  string   `json:"platform"`
+	Recovered bool     `json:"recovered"`
+	Report    string   `json:"report,omitempty"`
+	Rooms     []string `json:"rooms,omitempty"`
+}
+
+type rejoined struct {
+	RoomID string `json:"room_id"`
+	Host   bool   `json:"host"`
+	Error  string `json:"error,omitempty"`
+}
+
+type banned struct {
+	RoomID      string `json:"room_id"`
+	Fingerprint string `json:"fingerprint"`
+	Nickname    string `json:"nickname,omitempty"`
+	Reason      string `json:"reason,omitempty"`
+	Lifted      bool   `json:"lifted,omitempty"`
+	Local       bool   `json:"local"`
+}
+
+type transfer struct {
+	ID        string `json:"id"`
+	Kind      string `json:"kind"`
+	Direction string `json:"direction"`
+	Name      string `json:"name"`
+	Bytes     int64  `json:"bytes"`
+	Total     int64  `json:"total"`
+	Done      bool   `json:"done"`
+	Canceled  bool   `json:"canceled,omitempty"`
+	Error     string `json:"error,omitempty"`
+}
+
+func transferEvent(t app.Transfer) transfer {
+	ev := transfer{ID: t.ID, Kind: t.Kind, Direction: t.Direction, Name: t.Name, Bytes: t.Bytes, Total: t.Total, Done: t.Done, Canceled: t.Canceled()}
+	if t.Err != nil && !ev.Canceled {
+		ev.Error = t.Err.Error()
+	}
+	return ev
+}
+
+// message publishes an incoming message; keep-alives are dropped and
+// nickname updates applied
+func (c *Controller) message(msg *crypto.MessagePayload) {
+	// the network echoes what we say while we are alone
+	if msg == nil || msg.SenderID == c.self {
+		return
+	}
+	ev := Message{
+		ID:        msg.MessageID,
+		SenderID:  msg.SenderID,
+		Type:      "text",
+		Text:      msg.Message,
+		Timestamp: msg.Timestamp,
+		Gap:       msg.Gap,
+	}
+	if r := c.app.GetRoomInfo(); r != nil {
+		ev.RoomID = r.ID
+	}
+
+	var body chatMessage
+	if json.Unmarshal([]byte(msg.Message), &body) == nil && body.Type != "" {
+		switch body.Type {
+		case "keep_alive":
+			return
+		case "nickname_update":
+			name := c.app.SetPeerNickname(msg.SenderID, body.Nickname)
+			c.events.publish(EventNickname, nicknameChange{PeerID: msg.SenderID, Name: name})
+			return
+		}
+		ev.Type, ev.Text, ev.MediaID, ev.Size = body.Type, body.Content, body.MediaID, body.Size
+	}
+	diagnostics.Inc(diagnostics.MessageReceived)
+	ev.SenderName = c.app.DisplayName(msg.SenderID)
+	c.events.publish(EventMessage, ev)
+}
+
+// hub fans events out to every subscriber
+type hub struct {
+	mu   sync.Mutex
+	next int
+	subs map[int]chan Event
+}
+
+func newHub() *hub {
+	return &hub{subs: make(map[int]chan Event)}
+}
+
+func (h *hub) subscribe(buffer int) (<-chan Event, func()) {
+	if buffer <= 0 {
+		buffer = defaultEventBuffer
+	}
+	ch := make(chan Event, buffer)
+	h.mu.Lock()
+	id := h.next
+	h.next++
+	h.subs[id] = ch
+	h.mu.Unlock()
+
+	return ch, func() {
+		h.mu.Lock()
+		defer h.mu.Unlock()
+		if sub, ok := h.subs[id]; ok {
+			delete(h.subs, id)
+			close(sub)
+		}
+	}
+}
+
+// publish hands an event to every subscriber without blocking; one that is
+// full is cut off
+func (h *hub) publish(typ string, data interface{}) {
+	ev := Event{Type: typ, Time: time.Now(), Data: data}
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	for id, ch := range h.subs {
+		select {
+		case ch <- ev:
+		default:
+			logger.L().Warn("Event subscriber is not keeping up; disconnecting it", "event", typ)
+			delete(h.subs, id)
+			close(ch)
+		}
+	}
+}
@@ -0,0 +1,34 @@
+package control
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"time"
+
+	"execp2p/internal/diagnostics"
+)
+
+// ServeMetrics serves the diagnostics on ln until ctx ends: Prometheus text
+// at GET /metrics and expvar JSON at GET /debug/vars. Unlike the control API
+// it takes no token; the counters carry no message content or peer
+// identities, and ln is expected to be loopback (ListenLoopback).
+func ServeMetrics(ctx context.Context, ln net.Listener) error {
+	srv := &http.Server{
+		Handler:           diagnostics.Handler(),
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+	stop := context.AfterFunc(ctx, func() {
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		srv.Shutdown(shutdownCtx)
+	})
+	defer stop()
+
+	if err := srv.Serve(ln); !errors.Is(err, http.ErrServerClosed) {
+		return fmt.Errorf("metrics endpoint stopped: %w", err)
+	}
+	return nil
+}
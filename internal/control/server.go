@@ -0,0 +1,289 @@
+package control
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"time"
+
+	"execp2p/internal/logger"
+
+	"github.com/gorilla/websocket"
+)
+
+const (
+	// request bodies larger than this are refused
+	maxRequestBody = 1 << 20
+	// how long writing one event to a WebSocket may take
+	eventWriteTimeout = 10 * time.Second
+	// how often idle WebSockets are pinged
+	pingInterval = 30 * time.Second
+)
+
+// Listen opens the control endpoint: a unix socket at socket, only usable by
+// the local user, or, if addr is set, a TCP address that must be loopback
+func Listen(socket, addr string) (net.Listener, error) {
+	if addr != "" {
+		return ListenLoopback(addr)
+	}
+
+	// a stale socket from a previous run would make Listen fail
+	if fi, err := os.Lstat(socket); err == nil && fi.Mode()&os.ModeSocket != 0 {
+		os.Remove(socket)
+	}
+	if err := os.MkdirAll(filepath.Dir(socket), 0o700); err != nil {
+		return nil, fmt.Errorf("failed to create control socket directory: %w", err)
+	}
+	ln, err := net.Listen("unix", socket)
+	if err != nil {
+		return nil, fmt.Errorf("failed to listen on control socket: %w", err)
+	}
+	if err := os.Chmod(socket, 0o600); err != nil {
+		ln.Close()
+		return nil, fmt.Errorf("failed to restrict control socket: %w", err)
+	}
+	return ln, nil
+}
+
+// ListenLoopback listens on the TCP address addr, refusing anything but
+// loopback: the control API and the metrics are not for other machines
+func ListenLoopback(addr string) (net.Listener, error) {
+	host, _, err := net.SplitHostPort(addr)
+	if err != nil {
+		return nil, fmt.Errorf("invalid address %q: %w", addr, err)
+	}
+	if ip := net.ParseIP(host); host != "localhost" && (ip == nil || !ip.IsLoopback()) {
+		return nil, fmt.Errorf("only listening on loopback, not %s", host)
+	}
+	ln, err := net.Listen("tcp", addr)
+	if err != nil {
+		return nil, fmt.Errorf("failed to listen on %s: %w", addr, err)
+	}
+	return ln, nil
+}
+
+// NewToken returns a random bearer token for the control API
+func NewToken() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", fmt.Errorf("failed to generate control token: %w", err)
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+// WriteToken stores token where only the local user can read it, for
+// clients to pick up
+func WriteToken(path, token string) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0o700); err != nil {
+		return fmt.Errorf("failed to create control token directory: %w", err)
+	}
+	if err := os.WriteFile(path, []byte(token+"\n"), 0o600); err != nil {
+		return fmt.Errorf("failed to write control token: %w", err)
+	}
+	return nil
+}
+
+// Serve answers the REST API on ln until ctx ends. Every request must carry
+// "Authorization: Bearer <token>". Methods map to routes:
+//
+//	GET  /v1/status           status
+//	POST /v1/rooms            create_room  {"incognito", "ttl", "idle_timeout"}
+//	POST /v1/rooms/join       join_room    {"room_id", "access_key", "address"}
+//	DELETE /v1/room           leave_room
+//	POST /v1/messages         send         {"text"}
+//	PUT  /v1/nickname         set_nickname {"nickname"}
+//	PUT  /v1/profile/status   set_status   {"status"}
+//	PUT  /v1/presence         set_presence {"presence"}
+//	GET  /v1/peers            peers
+//	POST /v1/peers/kick       kick         {"peer_id", "reason"}
+//	POST /v1/peers/accept     accept_peer  {"peer_id"}
+//	POST /v1/peers/reject     reject_peer  {"peer_id"}
+//	GET  /v1/bans             bans
+//	POST /v1/bans             ban          {"peer_id" or "fingerprint", "reason"}
+//	DELETE /v1/bans           unban        {"fingerprint"}
+//	PUT  /v1/peers/role       set_role     {"peer_id", "role"}
+//	PUT  /v1/room/name        rename_room  {"name"}
+//	GET  /v1/history          history      ?room_id=&before=&limit=
+//	GET  /v1/nat              nat
+//	POST /v1/config/reload    reload_config
+//	POST /v1/contacts         contact      {"user_id", "fingerprint", "text", "invite"}
+//	GET  /v1/contacts/requests contact_requests
+//	POST /v1/contacts/requests/accept  accept_contact  {"id"}
+//	POST /v1/contacts/requests/dismiss dismiss_contact {"id"}
+//	GET  /v1/events           WebSocket of Event, one JSON text message each
+//
+// Answers are JSON; errors are {"error": "..."} with a 4xx or 5xx status.
+func (c *Controller) Serve(ctx context.Context, ln net.Listener, token string) error {
+	mux := http.NewServeMux()
+	mux.Handle("GET /v1/status", c.handle("status"))
+	mux.Handle("POST /v1/rooms", c.handle("create_room"))
+	mux.Handle("POST /v1/rooms/join", c.handle("join_room"))
+	mux.Handle("DELETE /v1/room", c.handle("leave_room"))
+	mux.Handle("POST /v1/messages", c.handle("send"))
+	mux.Handle("PUT /v1/nickname", c.handle("set_nickname"))
+	mux.Handle("PUT /v1/profile/status", c.handle("set_status"))
+	mux.Handle("PUT /v1/presence", c.handle("set_presence"))
+	mux.Handle("GET /v1/peers", c.handle("peers"))
+	mux.Handle("POST /v1/peers/kick", c.handle("kick"))
+	mux.Handle("POST /v1/peers/accept", c.handle("accept_peer"))
+	mux.Handle("POST /v1/peers/reject", c.handle("reject_peer"))
+	mux.Handle("GET /v1/bans", c.handle("bans"))
+	mux.Handle("POST /v1/bans", c.handle("ban"))
+	mux.Handle("DELETE /v1/bans", c.handle("unban"))
+	mux.Handle("PUT /v1/peers/role", c.handle("set_role"))
+	mux.Handle("PUT /v1/room/name", c.handle("rename_room"))
+	mux.Handle("GET /v1/history", c.handle("history"))
+	mux.Handle("GET /v1/nat", c.handle("nat"))
+	mux.Handle("POST /v1/config/reload", c.handle("reload_config"))
+	mux.Handle("POST /v1/contacts", c.handle("contact"))
+	mux.Handle("GET /v1/contacts/requests", c.handle("contact_requests"))
+	mux.Handle("POST /v1/contacts/requests/accept", c.handle("accept_contact"))
+	mux.Handle("POST /v1/contacts/requests/dismiss", c.handle("dismiss_contact"))
+	mux.HandleFunc("GET /v1/events", c.serveEvents)
+
+	srv := &http.Server{
+		Handler:           authorize(token, mux),
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+	stop := context.AfterFunc(ctx, func() {
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		srv.Shutdown(shutdownCtx)
+	})
+	defer stop()
+
+	if err := srv.Serve(ln); !errors.Is(err, http.ErrServerClosed) {
+		return fmt.Errorf("control API stopped: %w", err)
+	}
+	return nil
+}
+
+// authorize lets through requests carrying the bearer token
+func authorize(token string, next http.Handler) http.Handler {
+	want := []byte("Bearer " + token)
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if subtle.ConstantTimeCompare([]byte(r.Header.Get("Authorization")), want) != 1 {
+			writeError(w, http.StatusUnauthorized, errors.New("missing or wrong bearer token"))
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// handle serves a method; parameters come from the JSON body, or from the
+// query string of GET requests
+func (c *Controller) handle(method string) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var params json.RawMessage
+		if r.Method == http.MethodGet {
+			params = queryParams(r)
+		} else {
+			body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, maxRequestBody))
+			if err != nil {
+				writeError(w, http.StatusRequestEntityTooLarge, err)
+				return
+			}
+			params = body
+		}
+
+		result, err := c.Call(r.Context(), method, params)
+		switch {
+		case errors.Is(err, ErrInvalidParams):
+			writeError(w, http.StatusBadRequest, err)
+		case err != nil:
+			writeError(w, http.StatusInternalServerError, err)
+		default:
+			writeJSON(w, http.StatusOK, result)
+		}
+	})
+}
+
+// queryParams turns a query string into a JSON object; limit is a number
+func queryParams(r *http.Request) json.RawMessage {
+	params := make(map[string]interface{})
+	for name, values := range r.URL.Query() {
+		v := values[len(values)-1]
+		if n, err := strconv.Atoi(v); err == nil && name == "limit" {
+			params[name] = n
+			continue
+		}
+		params[name] = v
+	}
+	b, _ := json.Marshal(params)
+	return b
+}
+
+var upgrader = websocket.Upgrader{
+	// browsers have no business here: a page could otherwise reach a
+	// loopback port
+	CheckOrigin: func(r *http.Request) bool { return r.Header.Get("Origin") == "" },
+}
+
+// serveEvents streams events over a WebSocket until the client leaves or
+// falls behind
+func (c *Controller) serveEvents(w http.ResponseWriter, r *http.Request) {
+	conn, err := upgrader.Upgrade(w, r, nil)
+	if err != nil {
+		return // the upgrader has answered
+	}
+	defer conn.Close()
+
+	events, stop := c.Events(0)
+	defer stop()
+
+	// the client sends nothing, but reading notices when it goes away
+	gone := make(chan struct{})
+	go func() {
+		defer close(gone)
+		for {
+			if _, _, err := conn.ReadMessage(); err != nil {
+				return
+			}
+		}
+	}()
+
+	ping := time.NewTicker(pingInterval)
+	defer ping.Stop()
+	for {
+		select {
+		case <-gone:
+			return
+		case <-ping.C:
+			if err := conn.WriteControl(websocket.PingMessage, nil, time.Now().Add(eventWriteTimeout)); err != nil {
+				return
+			}
+		case ev, ok := <-events:
+			if !ok {
+				conn.WriteControl(websocket.CloseMessage,
+					websocket.FormatCloseMessage(websocket.CloseTryAgainLater, "too slow, events were lost"),
+					time.Now().Add(eventWriteTimeout))
+				return
+			}
+			conn.SetWriteDeadline(time.Now().Add(eventWriteTimeout))
+			if err := conn.WriteJSON(ev); err != nil {
+				logger.L().Debug("Event stream closed", "err", err)
+				return
+			}
+		}
+	}
+}
+
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
+
+func writeError(w http.ResponseWriter, status int, err error) {
+	writeJSON(w, status, map[string]string{"error": err.Error()})
+}
@@ -0,0 +1,171 @@
+package control
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"sync"
+	"time"
+)
+
+// JSON-RPC 2.0 error codes
+const (
+	rpcParseError     = -32700
+	rpcInvalidRequest = -32600
+	rpcUnknownMethod  = -32601
+	rpcInvalidParams  = -32602
+	// the method ran and failed
+	rpcFailed = -32000
+)
+
+type rpcRequest struct {
+	Version string          `json:"jsonrpc"`
+	ID      json.RawMessage `json:"id,omitempty"`
+	Method  string          `json:"method"`
+	Params  json.RawMessage `json:"params,omitempty"`
+}
+
+type rpcResponse struct {
+	Version string          `json:"jsonrpc"`
+	ID      json.RawMessage `json:"id"`
+	Result  interface{}     `json:"result,omitempty"`
+	Error   *rpcError       `json:"error,omitempty"`
+}
+
+type rpcError struct {
+	Code    int    `json:"code"`
+	Message string `json:"message"`
+}
+
+// rpcNotification carries an event to the client
+type rpcNotification struct {
+	Version string `json:"jsonrpc"`
+	Method  string `json:"method"`
+	Params  Event  `json:"params"`
+}
+
+// ServeStdio speaks JSON-RPC 2.0 over newline-delimited JSON: requests are
+// read from r, one per line, and answered on w, where every event is also
+// written as an "event" notification. Requests are handled one at a time in
+// order, so messages are sent in the order they were asked for. It returns
+// when r ends or ctx does.
+func (c *Controller) ServeStdio(ctx context.Context, r io.Reader, w io.Writer) error {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	var mu sync.Mutex
+	enc := json.NewEncoder(w)
+	write := func(v interface{}) error {
+		mu.Lock()
+		defer mu.Unlock()
+		return enc.Encode(v)
+	}
+
+	// subscribed before the first request, whose events would be lost otherwise
+	events, stop := c.Events(0)
+	go func() {
+		for {
+			err := forward(ctx, events, func(ev Event) error {
+				return write(rpcNotification{Version: "2.0", Method: "event", Params: ev})
+			})
+			stop()
+			if err != nil || ctx.Err() != nil {
+				cancel()
+				return
+			}
+			// cut off for falling behind: say so and carry on, the client
+			// can resynchronize with status, peers and history
+			write(rpcNotification{Version: "2.0", Method: "event", Params: Event{Type: EventsLost, Time: time.Now()}})
+			events, stop = c.Events(0)
+		}
+	}()
+
+	lines := make(chan []byte)
+	readErr := make(chan error, 1)
+	go func() {
+		scanner := bufio.NewScanner(r)
+		scanner.Buffer(make([]byte, 64<<10), maxRequestBody)
+		for scanner.Scan() {
+			select {
+			case lines <- append([]byte(nil), scanner.Bytes()...):
+			case <-ctx.Done():
+				return
+			}
+		}
+		readErr <- scanner.Err()
+	}()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case err := <-readErr:
+			if err != nil {
+				return fmt.Errorf("failed to read requests: %w", err)
+			}
+			return nil
+		case line := <-lines:
+			if len(line) == 0 {
+				continue
+			}
+			if resp := c.rpc(ctx, line); resp != nil {
+				if err := write(resp); err != nil {
+					return fmt.Errorf("failed to write response: %w", err)
+				}
+			}
+		}
+	}
+}
+
+// forward writes events until the subscription ends or ctx does
+func forward(ctx context.Context, events <-chan Event, write func(Event) error) error {
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case ev, ok := <-events:
+			if !ok {
+				return nil
+			}
+			if err := write(ev); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+// rpc answers one request line; notifications (no id) get no answer
+func (c *Controller) rpc(ctx context.Context, line []byte) *rpcResponse {
+	var req rpcRequest
+	if err := json.Unmarshal(line, &req); err != nil {
+		return &rpcResponse{Version: "2.0", ID: json.RawMessage("null"), Error: &rpcError{Code: rpcParseError, Message: err.Error()}}
+	}
+	if req.Version != "2.0" || req.Method == "" {
+		id := req.ID
+		if id == nil {
+			id = json.RawMessage("null")
+		}
+		return &rpcResponse{Version: "2.0", ID: id, Error: &rpcError{Code: rpcInvalidRequest, Message: "not a JSON-RPC 2.0 request"}}
+	}
+
+	result, err := c.Call(ctx, req.Method, req.Params)
+	if req.ID == nil {
+		return nil
+	}
+	resp := &rpcResponse{Version: "2.0", ID: req.ID, Result: result}
+	switch {
+	case errors.Is(err, ErrUnknownMethod):
+		resp.Error = &rpcError{Code: rpcUnknownMethod, Message: err.Error()}
+	case errors.Is(err, ErrInvalidParams):
+		resp.Error = &rpcError{Code: rpcInvalidParams, Message: err.Error()}
+	case err != nil:
+		resp.Error = &rpcError{Code: rpcFailed, Message: err.Error()}
+	}
+	if resp.Error != nil {
+		resp.Result = nil
+	}
+	return resp
+}
@@ -0,0 +1,204 @@
+// Package crash turns panics in long-running goroutines into crash reports.
+//
+// A goroutine defers Recover, or a loop that recovers its items itself calls
+// Capture. The panic is logged, written as a local dump (stack, version,
+// platform) and handed to the handlers registered with OnCrash, which tell
+// the user and tear the connections down. The process keeps running.
+// Nothing is sent anywhere: the dumps stay in the log directory for the
+// user to look at or attach to a bug report.
+package crash
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"runtime"
+	"runtime/debug"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"execp2p/internal/logger"
+)
+
+// maxDumps is how many dump files are kept; older ones are removed
+const maxDumps = 20
+
+// Report describes a panic
+type Report struct {
+	Time time.Time `json:"time"`
+	// the goroutine that panicked, e.g. "network.readLoop"
+	Where    string `json:"where"`
+	Panic    string `json:"panic"`
+	Stack    string `json:"stack"`
+	Version  string `json:"version"`
+	Platform string `json:"platform"`
+	// the goroutine went on with its next item instead of ending
+	Recovered bool `json:"recovered"`
+	// the dump file, empty when none was written
+	Path string `json:"path,omitempty"`
+}
+
+var (
+	mu       sync.Mutex
+	dir      string
+	version  = "dev"
+	handlers = make(map[int]func(Report))
+	nextID   int
+)
+
+// SetDir sets where dumps are written; empty writes none
+func SetDir(d string) {
+	mu.Lock()
+	dir = d
+	mu.Unlock()
+}
+
+// SetVersion sets the application version recorded in reports
+func SetVersion(v string) {
+	mu.Lock()
+	version = v
+	mu.Unlock()
+}
+
+// OnCrash calls fn with every report from now on, until the returned
+// function is called. fn runs on the goroutine that panicked.
+func OnCrash(fn func(Report)) (remove func()) {
+	mu.Lock()
+	id := nextID
+	nextID++
+	handlers[id] = fn
+	mu.Unlock()
+
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			mu.Lock()
+			delete(handlers, id)
+			mu.Unlock()
+		})
+	}
+}
+
+// Recover, deferred at the top of a goroutine, reports a panic in it; the
+// goroutine then ends
+func Recover(where string) {
+	if r := recover(); r != nil {
+		report(where, r, false)
+	}
+}
+
+// Capture reports value, recovered by the caller, which goes on with its
+// next item
+func Capture(where string, value interface{}) {
+	report(where, value, true)
+}
+
+// Exit, deferred in main, writes the dump of a panic on the main goroutine
+// and exits the way an unrecovered panic does
+func Exit() {
+	r := recover()
+	if r == nil {
+		return
+	}
+	rep := newReport("main", r, false)
+	rep.Path = writeDump(rep)
+	fmt.Fprintf(os.Stderr, "panic: %v\n\n%s", r, rep.Stack)
+	if rep.Path != "" {
+		fmt.Fprintf(os.Stderr, "\ncrash report: %s\n", rep.Path)
+	}
+	os.Exit(2)
+}
+
+func report(where string, value interface{}, recovered bool) {
+	rep := newReport(where, value, recovered)
+	rep.Path = writeDump(rep)
+	logger.L().Error("Panic", "where", where, "panic", rep.Panic, "recovered", recovered, "report", rep.Path)
+
+	mu.Lock()
+	fns := make([]func(Report), 0, len(handlers))
+	for _, fn := range handlers {
+		fns = append(fns, fn)
+	}
+	mu.Unlock()
+	for _, fn := range fns {
+		callHandler(fn, rep)
+	}
+}
+
+// callHandler keeps a panicking handler from taking the report's goroutine
+// down with it
+func callHandler(fn func(Report), rep Report) {
+	defer func() {
+		if r := recover(); r != nil {
+			logger.L().Error("Panic in crash handler", "panic", fmt.Sprint(r))
+		}
+	}()
+	fn(rep)
+}
+
+func newReport(where string, value interface{}, recovered bool) Report {
+	mu.Lock()
+	v := version
+	mu.Unlock()
+	return Report{
+		Time:      time.Now(),
+		Where:     where,
+		Panic:     fmt.Sprint(value),
+		Stack:     string(debug.Stack()),
+		Version:   v,
+		Platform:  fmt.Sprintf("%s/%s (%s)", runtime.GOOS, runtime.GOARCH, runtime.Version()),
+		Recovered: recovered,
+	}
+}
+
+// writeDump writes rep to the dump directory and returns the file, or ""
+// when there is no directory or the write failed
+func writeDump(rep Report) string {
+	mu.Lock()
+	d := dir
+	mu.Unlock()
+	if d == "" {
+		return ""
+	}
+	if err := os.MkdirAll(d, 0o700); err != nil {
+		logger.L().Warn("Failed to create crash report directory", "err", err)
+		return ""
+	}
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "ExecP2P crash report\n\n")
+	for _, field := range [][2]string{
+		{"time", rep.Time.UTC().Format(time.RFC3339Nano)},
+		{"version", rep.Version},
+		{"platform", rep.Platform},
+		{"where", rep.Where},
+		{"panic", rep.Panic},
+		{"recovered", fmt.Sprint(rep.Recovered)},
+	} {
+		fmt.Fprintf(&b, "%-11s%s\n", field[0]+":", field[1])
+	}
+	fmt.Fprintf(&b, "\n%s", rep.Stack)
+
+	path := filepath.Join(d, "crash-"+rep.Time.UTC().Format("20060102-150405.000000000")+".txt")
+	if err := os.WriteFile(path, []byte(b.String()), 0o600); err != nil {
+		logger.L().Warn("Failed to write crash report", "err", err)
+		return ""
+	}
+	prune(d)
+	return path
+}
+
+// prune removes all but the newest maxDumps dumps in d
+func prune(d string) {
+	dumps, err := filepath.Glob(filepath.Join(d, "crash-*.txt"))
+	if err != nil || len(dumps) <= maxDumps {
+		return
+	}
+	// the names sort by time
+	sort.Strings(dumps)
+	for _, old := range dumps[:len(dumps)-maxDumps] {
+		os.Remove(old)
+	}
+}
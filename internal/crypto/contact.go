@@ -0,0 +1,293 @@
+package crypto
+
+import (
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"golang.org/x/crypto/chacha20poly1305"
+)
+
+// MessageTypeFirstContact marks a first message from someone we haven't
+// met, sealed to the prekey of our published contact bundle
+const MessageTypeFirstContact = 8
+
+const (
+	contactBundleInfo   = "execp2p-contact-bundle-v1"
+	contactRequestInfo  = "execp2p-contact-request-v1"
+	firstContactKeyInfo = "execp2p-first-contact-v1"
+)
+
+// ErrBundleExpired means a contact bundle is past its expiry and may have
+// lost its prekey
+var ErrBundleExpired = errors.New("contact bundle expired")
+
+// ContactBundle is what we publish on the relay under our user ID, so that
+// someone who knows only the ID can leave us a first message while we are
+// offline. It is signed with our Dilithium identity key. The prekey is a
+// Kyber key replaced every few days, so a first message can't be opened
+// with the identity key alone once its prekey is gone.
+type ContactBundle struct {
+	Version      uint8     `json:"version"`
+	UserID       string    `json:"user_id"`
+	KEMPubKey    []byte    `json:"kem_pub_key"`
+	SigPubKey    []byte    `json:"sig_pub_key"`
+	PrekeyID     string    `json:"prekey_id"`
+	PrekeyPubKey []byte    `json:"prekey_pub_key"`
+	MailboxID    string    `json:"mailbox_id"`
+	Expires      time.Time `json:"expires"`
+	Signature    []byte    `json:"signature"`
+}
+
+// Rendezvous is where the sender of a first message can be met
+type Rendezvous struct {
+	RoomID    string `json:"room_id"`
+	AccessKey string `json:"access_key"`
+	// host address, empty to look the host up
+	Address string `json:"address,omitempty"`
+}
+
+// ContactRequest is the content of a first message. Everything about the
+// sender is inside the sealed envelope, so the relay learns only which
+// mailbox it went to.
+type ContactRequest struct {
+	SenderID             string      `json:"sender_id"`
+	SenderName           string      `json:"sender_name,omitempty"`
+	SenderKEMPubKey      []byte      `json:"sender_kem_pub_key"`
+	SenderSigPubKey      []byte      `json:"sender_sig_pub_key"`
+	RecipientFingerprint string      `json:"recipient_fingerprint"`
+	PrekeyID             string      `json:"prekey_id"`
+	Message              string      `json:"message"`
+	Rendezvous           *Rendezvous `json:"rendezvous,omitempty"`
+	Timestamp            time.Time   `json:"timestamp"`
+	Signature            []byte      `json:"signature"`
+}
+
+// FirstContact is the envelope of a first message: apart from the prekey it
+// is sealed to, nothing in it is readable without that prekey
+type FirstContact struct {
+	Version          uint8  `json:"version"`
+	Type             uint8  `json:"type"`
+	PrekeyID         string `json:"prekey_id"`
+	KEMCiphertext    []byte `json:"kem_ciphertext"`
+	Salt             []byte `json:"salt"`
+	EncryptedPayload []byte `json:"encrypted_payload"`
+}
+
+// NewPrekey generates a Kyber key pair for a contact bundle
+func (pq *PQCrypto) NewPrekey() (id string, pub, priv []byte, err error) {
+	pk, sk, err := pq.kemScheme.GenerateKeyPair()
+	if err != nil {
+		return "", nil, nil, err
+	}
+	if pub, err = pk.MarshalBinary(); err != nil {
+		return "", nil, nil, err
+	}
+	if priv, err = sk.MarshalBinary(); err != nil {
+		return "", nil, nil, err
+	}
+	raw := make([]byte, 8)
+	if _, err := rand.Read(raw); err != nil {
+		return "", nil, nil, err
+	}
+	return hex.EncodeToString(raw), pub, priv, nil
+}
+
+// SignContactBundle fills in our identity keys and signs the bundle
+func (pq *PQCrypto) SignContactBundle(bundle *ContactBundle) error {
+	bundle.Version = 1
+	bundle.KEMPubKey, bundle.SigPubKey = pq.GetIdentityPublicKeys()
+	signData, err := signable(contactBundleInfo, bundle, func(b *ContactBundle) { b.Signature = nil })
+	if err != nil {
+		return err
+	}
+	bundle.Signature = pq.sigScheme.Sign(pq.identitySigPrivateKey, signData, nil)
+	return nil
+}
+
+// VerifyContactBundle checks the bundle's signature and expiry and returns
+// the identity fingerprint it speaks for. The relay could hand out a bundle
+// of its own, so the caller compares it with one learned out of band.
+func (pq *PQCrypto) VerifyContactBundle(bundle *ContactBundle) (string, error) {
+	if bundle.Version != 1 {
+		return "", fmt.Errorf("unsupported contact bundle version %d", bundle.Version)
+	}
+	if time.Now().After(bundle.Expires) {
+		return "", ErrBundleExpired
+	}
+	sigPub, err := pq.sigScheme.UnmarshalBinaryPublicKey(bundle.SigPubKey)
+	if err != nil {
+		return "", fmt.Errorf("invalid bundle key: %w", err)
+	}
+	signData, err := signable(contactBundleInfo, bundle, func(b *ContactBundle) { b.Signature = nil })
+	if err != nil {
+		return "", err
+	}
+	if !pq.sigScheme.Verify(sigPub, signData, bundle.Signature, nil) {
+		return "", ErrInvalidSignature
+	}
+	return ComputeFingerprint(bundle.KEMPubKey, bundle.SigPubKey), nil
+}
+
+// SealFirstContact signs req as ours and seals it to the prekey of a
+// verified bundle
+func (pq *PQCrypto) SealFirstContact(bundle *ContactBundle, req *ContactRequest) (*FirstContact, error) {
+	prekey, err := pq.kemScheme.UnmarshalBinaryPublicKey(bundle.PrekeyPubKey)
+	if err != nil {
+		return nil, fmt.Errorf("invalid prekey: %w", err)
+	}
+	req.SenderKEMPubKey, req.SenderSigPubKey = pq.GetIdentityPublicKeys()
+	req.RecipientFingerprint = ComputeFingerprint(bundle.KEMPubKey, bundle.SigPubKey)
+	req.PrekeyID = bundle.PrekeyID
+	req.Timestamp = time.Now()
+	signData, err := signable(contactRequestInfo, req, func(r *ContactRequest) { r.Signature = nil })
+	if err != nil {
+		return nil, err
+	}
+	req.Signature = pq.sigScheme.Sign(pq.identitySigPrivateKey, signData, nil)
+	plaintext, err := json.Marshal(req)
+	if err != nil {
+		return nil, err
+	}
+
+	kemCT, sharedSecret, err := pq.kemScheme.Encapsulate(prekey)
+	if err != nil {
+		return nil, err
+	}
+	fc := &FirstContact{
+		Version:       1,
+		Type:          MessageTypeFirstContact,
+		PrekeyID:      bundle.PrekeyID,
+		KEMCiphertext: kemCT,
+		Salt:          make([]byte, 32),
+	}
+	if _, err := rand.Read(fc.Salt); err != nil {
+		return nil, err
+	}
+	aead, aad, err := firstContactAEAD(sharedSecret, fc)
+	if err != nil {
+		return nil, err
+	}
+	nonce := make([]byte, aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, err
+	}
+	fc.EncryptedPayload = aead.Seal(nonce, nonce, plaintext, aad)
+	return fc, nil
+}
+
+// OpenFirstContact opens a first message with the private key of the
+// prekey it names and checks that its sender signed it for us. It returns
+// the request and the sender's identity fingerprint.
+func (pq *PQCrypto) OpenFirstContact(fc *FirstContact, prekeyPriv []byte) (*ContactRequest, string, error) {
+	if fc.Type != MessageTypeFirstContact {
+		return nil, "", fmt.Errorf("not a first contact")
+	}
+	sk, err := pq.kemScheme.UnmarshalBinaryPrivateKey(prekeyPriv)
+	if err != nil {
+		return nil, "", fmt.Errorf("invalid prekey: %w", err)
+	}
+	sharedSecret, err := pq.kemScheme.Decapsulate(sk, fc.KEMCiphertext)
+	if err != nil {
+		return nil, "", ErrDecryptionFailed
+	}
+	aead, aad, err := firstContactAEAD(sharedSecret, fc)
+	if err != nil {
+		return nil, "", err
+	}
+	if len(fc.EncryptedPayload) < aead.NonceSize() {
+		return nil, "", ErrInvalidNonceSize
+	}
+	nonce, ciphertext := fc.EncryptedPayload[:aead.NonceSize()], fc.EncryptedPayload[aead.NonceSize():]
+	plaintext, err := aead.Open(nil, nonce, ciphertext, aad)
+	if err != nil {
+		return nil, "", ErrDecryptionFailed
+	}
+
+	var req ContactRequest
+	if err := json.Unmarshal(plaintext, &req); err != nil {
+		return nil, "", fmt.Errorf("invalid first contact: %w", err)
+	}
+	own, err := pq.GetIdentityFingerprint()
+	if err != nil {
+		return nil, "", err
+	}
+	// signed for another identity or prekey: replayed by someone else
+	if req.RecipientFingerprint != own || req.PrekeyID != fc.PrekeyID {
+		return nil, "", fmt.Errorf("first contact is for another identity")
+	}
+	sigPub, err := pq.sigScheme.UnmarshalBinaryPublicKey(req.SenderSigPubKey)
+	if err != nil {
+		return nil, "", fmt.Errorf("invalid sender key: %w", err)
+	}
+	signData, err := signable(contactRequestInfo, &req, func(r *ContactRequest) { r.Signature = nil })
+	if err != nil {
+		return nil, "", err
+	}
+	if !pq.sigScheme.Verify(sigPub, signData, req.Signature, nil) {
+		return nil, "", ErrInvalidSignature
+	}
+	return &req, ComputeFingerprint(req.SenderKEMPubKey, req.SenderSigPubKey), nil
+}
+
+// EnvelopeType returns the type of a mailbox envelope, sealed message or
+// first contact, without opening it
+func EnvelopeType(data []byte) (uint8, error) {
+	var head struct {
+		Type uint8 `json:"type"`
+	}
+	if err := json.Unmarshal(data, &head); err != nil {
+		return 0, err
+	}
+	return head.Type, nil
+}
+
+// SerializeFirstContact encodes a first contact for the mailbox
+func SerializeFirstContact(fc *FirstContact) ([]byte, error) {
+	return json.Marshal(fc)
+}
+
+// DeserializeFirstContact decodes a first contact from the mailbox
+func DeserializeFirstContact(data []byte) (*FirstContact, error) {
+	var fc FirstContact
+	if err := json.Unmarshal(data, &fc); err != nil {
+		return nil, err
+	}
+	return &fc, nil
+}
+
+// firstContactAEAD derives the envelope's key; the additional data is the
+// envelope without its payload
+func firstContactAEAD(sharedSecret []byte, fc *FirstContact) (cipher.AEAD, []byte, error) {
+	key, err := deriveKeyWithSalt(sharedSecret, fc.Salt, firstContactKeyInfo, chacha20poly1305.KeySize)
+	if err != nil {
+		return nil, nil, err
+	}
+	aead, err := chacha20poly1305.NewX(key)
+	if err != nil {
+		return nil, nil, err
+	}
+	header := *fc
+	header.EncryptedPayload = nil
+	aad, err := json.Marshal(&header)
+	if err != nil {
+		return nil, nil, err
+	}
+	return aead, aad, nil
+}
+
+// signable is v without its signature, in JSON, prefixed with a domain so a
+// signature can't be taken for one of another kind
+func signable[T any](domain string, v *T, clear func(*T)) ([]byte, error) {
+	c := *v
+	clear(&c)
+	data, err := json.Marshal(&c)
+	if err != nil {
+		return nil, err
+	}
+	return append([]byte(domain+"\x00"), data...), nil
+}
@@ -0,0 +1,118 @@
+package crypto
+
+import (
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/binary"
+	"errors"
+	"time"
+
+	"golang.org/x/crypto/chacha20poly1305"
+)
+
+// Datagrams.
+//
+// Ephemeral data (typing indicators, presence) may ride QUIC datagrams, which
+// hold about a kilobyte: no room for a Dilithium signature. A datagram is
+// therefore only sealed with XChaCha20-Poly1305 under a key derived from the
+// session secret shared with its recipient. Nobody but the two ends of the
+// session holds that secret, so a datagram that opens came from the peer it
+// names. It carries no sequence number and may be lost, repeated or
+// reordered.
+//
+// Layout: version (1 byte) || sender ID length (1 byte) || sender ID ||
+// nonce (24 bytes) || sealed (timestamp in unix ms (8 bytes) || message).
+// The header and the recipient ID are authenticated as associated data.
+
+const (
+	datagramVersion = 1
+	datagramInfo    = "execp2p-datagram-v1"
+)
+
+// ErrDatagramCorrupt means a datagram is malformed or failed authentication
+var ErrDatagramCorrupt = errors.New("datagram corrupt")
+
+// SealDatagram encrypts message for peerID under the session secret shared
+// with it
+func (pq *PQCrypto) SealDatagram(message, peerID, senderID string) ([]byte, error) {
+	if len(senderID) > 255 {
+		return nil, ErrDatagramCorrupt
+	}
+	pq.peersMutex.RLock()
+	peer, exists := pq.peers[peerID]
+	var secret []byte
+	if exists {
+		secret = peer.CurrentSharedSecret
+	}
+	pq.peersMutex.RUnlock()
+	if len(secret) == 0 {
+		return nil, ErrPeerNotFound
+	}
+
+	aead, err := datagramCipher(secret)
+	if err != nil {
+		return nil, err
+	}
+	header := append([]byte{datagramVersion, byte(len(senderID))}, senderID...)
+	nonce := make([]byte, aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, err
+	}
+	plain := binary.BigEndian.AppendUint64(nil, uint64(time.Now().UnixMilli()))
+	plain = append(plain, message...)
+
+	out := append(header, nonce...)
+	return aead.Seal(out, nonce, plain, datagramAAD(header, peerID)), nil
+}
+
+// OpenDatagram decrypts a datagram sent to recipientID, with the current or
+// a retained session secret of the sender it names
+func (pq *PQCrypto) OpenDatagram(data []byte, recipientID string) (*MessagePayload, error) {
+	if len(data) < 2 || data[0] != datagramVersion {
+		return nil, ErrDatagramCorrupt
+	}
+	headerLen := 2 + int(data[1])
+	if len(data) < headerLen+chacha20poly1305.NonceSizeX+chacha20poly1305.Overhead+8 {
+		return nil, ErrDatagramCorrupt
+	}
+	header, rest := data[:headerLen], data[headerLen:]
+	senderID := string(header[2:])
+	nonce, sealed := rest[:chacha20poly1305.NonceSizeX], rest[chacha20poly1305.NonceSizeX:]
+
+	pq.peersMutex.RLock()
+	peer, exists := pq.peers[senderID]
+	pq.peersMutex.RUnlock()
+	if !exists {
+		return nil, ErrPeerNotFound
+	}
+	secrets, _ := pq.candidateSecrets(peer, 0)
+	aad := datagramAAD(header, recipientID)
+	for _, secret := range secrets {
+		aead, err := datagramCipher(secret)
+		if err != nil {
+			return nil, err
+		}
+		plain, err := aead.Open(nil, nonce, sealed, aad)
+		if err != nil {
+			continue
+		}
+		return &MessagePayload{
+			SenderID:  senderID,
+			Timestamp: time.UnixMilli(int64(binary.BigEndian.Uint64(plain[:8]))),
+			Message:   string(plain[8:]),
+		}, nil
+	}
+	return nil, ErrDatagramCorrupt
+}
+
+func datagramCipher(secret []byte) (cipher.AEAD, error) {
+	key, err := deriveKeyWithSalt(secret, nil, datagramInfo, chacha20poly1305.KeySize)
+	if err != nil {
+		return nil, err
+	}
+	return chacha20poly1305.NewX(key)
+}
+
+func datagramAAD(header []byte, recipientID string) []byte {
+	return append(append([]byte(nil), header...), recipientID...)
+}
@@ -0,0 +1,664 @@
+package crypto
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+
+	"github.com/cloudflare/circl/kem"
+	"github.com/cloudflare/circl/kem/kyber/kyber1024"
+	"golang.org/x/crypto/chacha20poly1305"
+	"golang.org/x/crypto/hkdf"
+)
+
+// Group key agreement for multi-peer rooms, modelled on MLS TreeKEM
+// (RFC 9420). Members are the leaves of a binary tree of Kyber key pairs;
+// every member holds the private keys on the path from its leaf to the root.
+// A commit adds and removes members and gives the committer's path fresh
+// keys: each new path secret is encrypted only to the subtrees next to the
+// path, so a commit costs O(log N) encryptions instead of one per member.
+//
+// Every commit starts a new epoch whose secret mixes the previous epoch's
+// init secret with the new path, so removed members can't follow and
+// compromising the current state reveals nothing about earlier epochs.
+//
+// Commits are not signed here: they travel over the authenticated peer
+// channel, and the confirmation tag proves the committer derived the same
+// epoch. A Group is not safe for concurrent use.
+
+var (
+	// ErrGroupRemoved means the commit removed us from the group
+	ErrGroupRemoved = errors.New("removed from the group")
+	// ErrGroupEpoch means a commit or welcome doesn't follow the current epoch
+	ErrGroupEpoch = errors.New("group commit for another epoch")
+	// ErrGroupConfirmation means the epoch derived from a commit or welcome differs from the committer's
+	ErrGroupConfirmation = errors.New("group epoch confirmation failed")
+)
+
+var groupKEM kem.Scheme = kyber1024.Scheme()
+
+// GroupKeyPackage is what a peer hands out to be added to a group
+type GroupKeyPackage struct {
+	MemberID  string `json:"member_id"`
+	PublicKey []byte `json:"public_key"`
+}
+
+// GroupLeafKeys is a peer's leaf key pair for joining a group
+type GroupLeafKeys struct {
+	memberID string
+	pub      kem.PublicKey
+	priv     kem.PrivateKey
+}
+
+// NewGroupLeafKeys generates a leaf key pair for memberID
+func NewGroupLeafKeys(memberID string) (*GroupLeafKeys, error) {
+	pub, priv, err := groupKEM.GenerateKeyPair()
+	if err != nil {
+		return nil, err
+	}
+	return &GroupLeafKeys{memberID: memberID, pub: pub, priv: priv}, nil
+}
+
+// KeyPackage returns the public part to send to the group
+func (k *GroupLeafKeys) KeyPackage() GroupKeyPackage {
+	pub, _ := k.pub.MarshalBinary()
+	return GroupKeyPackage{MemberID: k.memberID, PublicKey: pub}
+}
+
+// groupNode is a node of the public tree; no public key means blank
+type groupNode struct {
+	PublicKey []byte `json:"pk,omitempty"`
+	MemberID  string `json:"member,omitempty"` // leaves only
+}
+
+func (n groupNode) blank() bool { return len(n.PublicKey) == 0 }
+
+// GroupSealedSecret is a path secret encrypted to one tree node
+type GroupSealedSecret struct {
+	Target        uint32 `json:"target"`
+	KEMCiphertext []byte `json:"kem_ct"`
+	Ciphertext    []byte `json:"ct"`
+}
+
+// GroupPathNode is a new public key on the committer's path with its
+// secret for the neighbouring subtree
+type GroupPathNode struct {
+	Node      uint32              `json:"node"`
+	PublicKey []byte              `json:"public_key"`
+	Secrets   []GroupSealedSecret `json:"secrets"`
+}
+
+// GroupCommit moves the group to the next epoch
+type GroupCommit struct {
+	GroupID      string            `json:"group_id"`
+	Epoch        uint64            `json:"epoch"` // the epoch this commit starts
+	Committer    uint32            `json:"committer"`
+	Removes      []uint32          `json:"removes,omitempty"`
+	Adds         []GroupKeyPackage `json:"adds,omitempty"`
+	LeafKey      []byte            `json:"leaf_key"`
+	Path         []GroupPathNode   `json:"path"`
+	Confirmation []byte            `json:"confirmation"`
+}
+
+// GroupWelcome lets a member added by a commit join the new epoch
+type GroupWelcome struct {
+	GroupID      string            `json:"group_id"`
+	Epoch        uint64            `json:"epoch"`
+	Tree         []groupNode       `json:"tree"`
+	Leaves       uint32            `json:"leaves"`
+	Committer    uint32            `json:"committer"`
+	Secrets      GroupSealedSecret `json:"secrets"`
+	Confirmation []byte            `json:"confirmation"`
+}
+
+// welcomeSecrets is what only the new member can read from a welcome
+type welcomeSecrets struct {
+	EpochSecret []byte `json:"epoch_secret"`
+	PathSecret  []byte `json:"path_secret,omitempty"`
+	PathNode    uint32 `json:"path_node"`
+}
+
+// Group is our view of a group at its current epoch
+type Group struct {
+	id      string
+	epoch   uint64
+	self    uint32 // our leaf node index
+	leaves  uint32
+	nodes   []groupNode
+	private map[uint32]kem.PrivateKey
+
+	epochSecret []byte
+}
+
+// CreateGroup starts a group with us as its only member
+func CreateGroup(groupID string, self *GroupLeafKeys) (*Group, error) {
+	pk := self.KeyPackage()
+	secret := make([]byte, 32)
+	if _, err := rand.Read(secret); err != nil {
+		return nil, err
+	}
+	return &Group{
+		id:          groupID,
+		self:        0,
+		leaves:      1,
+		nodes:       []groupNode{{PublicKey: pk.PublicKey, MemberID: pk.MemberID}},
+		private:     map[uint32]kem.PrivateKey{0: self.priv},
+		epochSecret: secret,
+	}, nil
+}
+
+// ID returns the group ID
+func (g *Group) ID() string { return g.id }
+
+// Epoch returns the current epoch number
+func (g *Group) Epoch() uint64 { return g.epoch }
+
+// EpochKey returns the symmetric key all members share in this epoch
+func (g *Group) EpochKey() []byte {
+	return groupExpand(g.epochSecret, "key", 32)
+}
+
+// Members lists the member IDs in leaf order
+func (g *Group) Members() []string {
+	var members []string
+	for i := uint32(0); i < g.leaves; i++ {
+		if n := g.nodes[2*i]; !n.blank() {
+			members = append(members, n.MemberID)
+		}
+	}
+	return members
+}
+
+func (g *Group) leafOf(memberID string) (uint32, bool) {
+	for i := uint32(0); i < g.leaves; i++ {
+		if n := g.nodes[2*i]; !n.blank() && n.MemberID == memberID {
+			return 2 * i, true
+		}
+	}
+	return 0, false
+}
+
+// Commit adds and removes members and refreshes our path. The commit goes
+// to the members that stay; each added member gets its welcome.
+func (g *Group) Commit(adds []GroupKeyPackage, removes []string) (*GroupCommit, []*GroupWelcome, error) {
+	commit := &GroupCommit{GroupID: g.id, Epoch: g.epoch + 1, Committer: g.self, Adds: adds}
+	for _, id := range removes {
+		leaf, ok := g.leafOf(id)
+		if !ok {
+			return nil, nil, fmt.Errorf("%s is not a member", id)
+		}
+		if leaf == g.self {
+			return nil, nil, fmt.Errorf("can't remove ourselves")
+		}
+		commit.Removes = append(commit.Removes, leaf)
+	}
+	for _, pk := range adds {
+		if _, ok := g.leafOf(pk.MemberID); ok {
+			return nil, nil, fmt.Errorf("%s is already a member", pk.MemberID)
+		}
+		if _, err := groupKEM.UnmarshalBinaryPublicKey(pk.PublicKey); err != nil {
+			return nil, nil, ErrInvalidKeySize
+		}
+	}
+
+	next := g.clone()
+	added := next.applyMembership(commit.Removes, commit.Adds)
+
+	// fresh leaf key and path secrets up to the root
+	leafSecret := make([]byte, 32)
+	if _, err := rand.Read(leafSecret); err != nil {
+		return nil, nil, err
+	}
+	leafPub, leafPriv, err := groupNodeKeys(leafSecret)
+	if err != nil {
+		return nil, nil, err
+	}
+	commit.LeafKey = leafPub
+	next.nodes[next.self].PublicKey = leafPub
+	next.private = map[uint32]kem.PrivateKey{next.self: leafPriv}
+
+	pathSecrets := make(map[uint32][]byte)
+	secret := groupExpand(leafSecret, "path", 32)
+	copath := treeCopath(next.self, next.leaves)
+	for i, node := range treeDirectPath(next.self, next.leaves) {
+		targets := next.resolution(copath[i], added)
+		if len(targets) == 0 && len(next.resolution(copath[i], nil)) == 0 {
+			// nobody on the other side: the node stays blank
+			next.nodes[node] = groupNode{}
+			continue
+		}
+		pub, priv, err := groupNodeKeys(secret)
+		if err != nil {
+			return nil, nil, err
+		}
+		next.nodes[node] = groupNode{PublicKey: pub}
+		next.private[node] = priv
+		pathSecrets[node] = secret
+		commit.Path = append(commit.Path, GroupPathNode{Node: node, PublicKey: pub})
+		secret = groupExpand(secret, "path", 32)
+	}
+	commitSecret := secret
+
+	next.epoch = commit.Epoch
+	next.epochSecret = groupEpochSecret(g.initSecret(), commitSecret, next.context())
+	commit.Confirmation = next.confirmation()
+
+	// encrypt each path secret to the subtree next to its node
+	aad := next.context()
+	for i := range commit.Path {
+		node := commit.Path[i].Node
+		for _, target := range next.resolution(treeCopathChild(next.self, node), added) {
+			sealed, err := groupSeal(next.nodes[target].PublicKey, target, pathSecrets[node], aad)
+			if err != nil {
+				return nil, nil, err
+			}
+			commit.Path[i].Secrets = append(commit.Path[i].Secrets, sealed)
+		}
+	}
+
+	welcomes := make([]*GroupWelcome, 0, len(added))
+	for leaf := range added {
+		w, err := next.welcome(leaf, pathSecrets)
+		if err != nil {
+			return nil, nil, err
+		}
+		welcomes = append(welcomes, w)
+	}
+
+	*g = *next
+	return commit, welcomes, nil
+}
+
+// ProcessCommit moves to the epoch started by another member's commit
+func (g *Group) ProcessCommit(commit *GroupCommit) error {
+	if commit.GroupID != g.id || commit.Epoch != g.epoch+1 {
+		return ErrGroupEpoch
+	}
+	if commit.Committer == g.self || commit.Committer >= 2*g.leaves || commit.Committer&1 != 0 || g.nodes[commit.Committer].blank() {
+		return fmt.Errorf("%w: unknown committer", ErrInvalidHandshake)
+	}
+	for _, leaf := range commit.Removes {
+		if leaf == g.self {
+			return ErrGroupRemoved
+		}
+	}
+
+	next := g.clone()
+	added := next.applyMembership(commit.Removes, commit.Adds)
+	if _, err := groupKEM.UnmarshalBinaryPublicKey(commit.LeafKey); err != nil {
+		return ErrInvalidKeySize
+	}
+	next.nodes[commit.Committer].PublicKey = commit.LeafKey
+
+	// take the committer's new path into the tree
+	updated := make(map[uint32]GroupPathNode, len(commit.Path))
+	for _, p := range commit.Path {
+		updated[p.Node] = p
+	}
+	directPath := treeDirectPath(commit.Committer, next.leaves)
+	matched := 0
+	for _, node := range directPath {
+		if p, ok := updated[node]; ok {
+			next.nodes[node] = groupNode{PublicKey: p.PublicKey}
+			matched++
+		} else {
+			next.nodes[node] = groupNode{}
+		}
+		delete(next.private, node)
+	}
+	if matched != len(commit.Path) {
+		return fmt.Errorf("%w: malformed commit path", ErrInvalidHandshake)
+	}
+	next.epoch = commit.Epoch
+
+	// the lowest updated node above us holds a secret encrypted to our subtree
+	var secret []byte
+	var from int
+	for i, node := range directPath {
+		p, ok := updated[node]
+		if !ok || !treeIsAncestor(node, g.self) {
+			continue
+		}
+		s, err := next.openPathSecret(p, treeCopathChild(commit.Committer, node), added)
+		if err != nil {
+			return err
+		}
+		secret, from = s, i
+		break
+	}
+	if secret == nil {
+		return fmt.Errorf("%w: no path secret for us", ErrInvalidHandshake)
+	}
+	commitSecret, err := next.derivePath(directPath[from:], secret)
+	if err != nil {
+		return err
+	}
+
+	next.epochSecret = groupEpochSecret(g.initSecret(), commitSecret, next.context())
+	if !hmac.Equal(next.confirmation(), commit.Confirmation) {
+		return ErrGroupConfirmation
+	}
+	*g = *next
+	return nil
+}
+
+// JoinGroup joins at the epoch of the commit that added us
+func JoinGroup(w *GroupWelcome, self *GroupLeafKeys) (*Group, error) {
+	selfPub, _ := self.pub.MarshalBinary()
+	g := &Group{
+		id:      w.GroupID,
+		epoch:   w.Epoch,
+		leaves:  w.Leaves,
+		nodes:   w.Tree,
+		private: map[uint32]kem.PrivateKey{},
+	}
+	if uint32(len(g.nodes)) != treeWidth(g.leaves) {
+		return nil, fmt.Errorf("%w: malformed group tree", ErrInvalidHandshake)
+	}
+	leaf, ok := g.leafOf(self.memberID)
+	if !ok || !hmac.Equal(g.nodes[leaf].PublicKey, selfPub) || w.Secrets.Target != leaf {
+		return nil, fmt.Errorf("%w: welcome is not for us", ErrInvalidHandshake)
+	}
+	g.self = leaf
+	g.private[leaf] = self.priv
+
+	plain, err := groupOpen(self.priv, w.Secrets, g.context())
+	if err != nil {
+		return nil, err
+	}
+	var secrets welcomeSecrets
+	if err := json.Unmarshal(plain, &secrets); err != nil {
+		return nil, fmt.Errorf("%w: malformed welcome", ErrInvalidHandshake)
+	}
+	g.epochSecret = secrets.EpochSecret
+
+	// the committer's path from where it meets ours
+	if secrets.PathSecret != nil {
+		directPath := treeDirectPath(w.Committer, g.leaves)
+		for i, node := range directPath {
+			if node == secrets.PathNode {
+				if _, err := g.derivePath(directPath[i:], secrets.PathSecret); err != nil {
+					return nil, err
+				}
+				break
+			}
+		}
+	}
+	if !hmac.Equal(g.confirmation(), w.Confirmation) {
+		return nil, ErrGroupConfirmation
+	}
+	return g, nil
+}
+
+// applyMembership blanks removed leaves and their paths and places new
+// members in the leftmost free leaves, growing the tree if needed. Returns
+// the leaves of the added members.
+func (g *Group) applyMembership(removes []uint32, adds []GroupKeyPackage) map[uint32]bool {
+	for _, leaf := range removes {
+		g.blankPath(leaf)
+	}
+	added := make(map[uint32]bool, len(adds))
+	for _, pk := range adds {
+		leaf, ok := g.freeLeaf()
+		if !ok {
+			g.grow()
+			leaf, _ = g.freeLeaf()
+		}
+		g.nodes[leaf] = groupNode{PublicKey: pk.PublicKey, MemberID: pk.MemberID}
+		// the new member knows none of the keys above it yet
+		for _, node := range treeDirectPath(leaf, g.leaves) {
+			g.nodes[node] = groupNode{}
+			delete(g.private, node)
+		}
+		added[leaf] = true
+	}
+	return added
+}
+
+func (g *Group) blankPath(leaf uint32) {
+	if leaf >= 2*g.leaves || leaf&1 != 0 {
+		return
+	}
+	g.nodes[leaf] = groupNode{}
+	for _, node := range treeDirectPath(leaf, g.leaves) {
+		g.nodes[node] = groupNode{}
+		delete(g.private, node)
+	}
+}
+
+func (g *Group) freeLeaf() (uint32, bool) {
+	for i := uint32(0); i < g.leaves; i++ {
+		if g.nodes[2*i].blank() {
+			return 2 * i, true
+		}
+	}
+	return 0, false
+}
+
+// grow doubles the number of leaves; existing nodes keep their indices
+func (g *Group) grow() {
+	g.leaves *= 2
+	nodes := make([]groupNode, treeWidth(g.leaves))
+	copy(nodes, g.nodes)
+	g.nodes = nodes
+}
+
+// resolution is the smallest set of non-blank nodes covering the subtree
+// under x, leaving out the given (newly added) leaves
+func (g *Group) resolution(x uint32, exclude map[uint32]bool) []uint32 {
+	if x >= uint32(len(g.nodes)) {
+		return nil
+	}
+	if !g.nodes[x].blank() {
+		if exclude[x] {
+			return nil
+		}
+		return []uint32{x}
+	}
+	if treeLevel(x) == 0 {
+		return nil
+	}
+	return append(g.resolution(treeLeft(x), exclude), g.resolution(treeRight(x), exclude)...)
+}
+
+// openPathSecret decrypts the copy of a path secret sent to a node we hold
+func (g *Group) openPathSecret(p GroupPathNode, copathChild uint32, exclude map[uint32]bool) ([]byte, error) {
+	for _, target := range g.resolution(copathChild, exclude) {
+		priv, ok := g.private[target]
+		if !ok {
+			continue
+		}
+		for _, sealed := range p.Secrets {
+			if sealed.Target == target {
+				return groupOpen(priv, sealed, g.context())
+			}
+		}
+	}
+	return nil, fmt.Errorf("%w: no path secret for us", ErrInvalidHandshake)
+}
+
+// derivePath walks the committer's updated path from its first node with
+// secret, checks each derived key against the public tree and returns the
+// secret that comes after the root
+func (g *Group) derivePath(path []uint32, secret []byte) ([]byte, error) {
+	for _, node := range path {
+		if g.nodes[node].blank() {
+			continue
+		}
+		pub, priv, err := groupNodeKeys(secret)
+		if err != nil {
+			return nil, err
+		}
+		if !hmac.Equal(pub, g.nodes[node].PublicKey) {
+			return nil, fmt.Errorf("%w: path key mismatch", ErrInvalidHandshake)
+		}
+		g.private[node] = priv
+		secret = groupExpand(secret, "path", 32)
+	}
+	return secret, nil
+}
+
+// welcome builds the welcome for a member added at leaf
+func (g *Group) welcome(leaf uint32, pathSecrets map[uint32][]byte) (*GroupWelcome, error) {
+	secrets := welcomeSecrets{EpochSecret: g.epochSecret}
+	// the lowest node of our path above the new member
+	for _, node := range treeDirectPath(g.self, g.leaves) {
+		if treeIsAncestor(node, leaf) {
+			if s, ok := pathSecrets[node]; ok {
+				secrets.PathSecret, secrets.PathNode = s, node
+			}
+			break
+		}
+	}
+	plain, err := json.Marshal(secrets)
+	if err != nil {
+		return nil, err
+	}
+	sealed, err := groupSeal(g.nodes[leaf].PublicKey, leaf, plain, g.context())
+	if err != nil {
+		return nil, err
+	}
+	return &GroupWelcome{
+		GroupID:      g.id,
+		Epoch:        g.epoch,
+		Tree:         append([]groupNode(nil), g.nodes...),
+		Leaves:       g.leaves,
+		Committer:    g.self,
+		Secrets:      sealed,
+		Confirmation: g.confirmation(),
+	}, nil
+}
+
+func (g *Group) clone() *Group {
+	c := *g
+	c.nodes = append([]groupNode(nil), g.nodes...)
+	c.private = make(map[uint32]kem.PrivateKey, len(g.private))
+	for k, v := range g.private {
+		c.private[k] = v
+	}
+	return &c
+}
+
+// context binds secrets to the group, epoch and public tree
+func (g *Group) context() []byte {
+	tree, _ := json.Marshal(g.nodes)
+	treeHash := sha256.Sum256(tree)
+	ctx := appendField(nil, []byte(g.id))
+	ctx = binary.LittleEndian.AppendUint64(ctx, g.epoch)
+	return appendField(ctx, treeHash[:])
+}
+
+func (g *Group) initSecret() []byte {
+	return groupExpand(g.epochSecret, "init", 32)
+}
+
+func (g *Group) confirmation() []byte {
+	mac := hmac.New(sha256.New, groupExpand(g.epochSecret, "confirm", 32))
+	mac.Write(g.context())
+	return mac.Sum(nil)
+}
+
+// treeCopathChild is the child of node (on leaf's direct path) that is not
+// above leaf
+func treeCopathChild(leaf, node uint32) uint32 {
+	if treeIsAncestor(treeLeft(node), leaf) {
+		return treeRight(node)
+	}
+	return treeLeft(node)
+}
+
+func groupEpochSecret(initSecret, commitSecret, context []byte) []byte {
+	prk := hkdf.Extract(sha256.New, commitSecret, initSecret)
+	out := make([]byte, 32)
+	io.ReadFull(hkdf.Expand(sha256.New, prk, append([]byte("execp2p-group-epoch"), context...)), out)
+	return out
+}
+
+func groupExpand(secret []byte, label string, n int) []byte {
+	out := make([]byte, n)
+	io.ReadFull(hkdf.Expand(sha256.New, secret, []byte("execp2p-group-"+label)), out)
+	return out
+}
+
+// groupNodeKeys derives a node's key pair from its path secret
+func groupNodeKeys(secret []byte) ([]byte, kem.PrivateKey, error) {
+	pub, priv := groupKEM.DeriveKeyPair(groupExpand(secret, "node", groupKEM.SeedSize()))
+	pubBytes, err := pub.MarshalBinary()
+	if err != nil {
+		return nil, nil, err
+	}
+	return pubBytes, priv, nil
+}
+
+// groupSeal encrypts a secret to a node's public key
+func groupSeal(publicKey []byte, target uint32, plaintext, aad []byte) (GroupSealedSecret, error) {
+	pub, err := groupKEM.UnmarshalBinaryPublicKey(publicKey)
+	if err != nil {
+		return GroupSealedSecret{}, ErrInvalidKeySize
+	}
+	kemCT, shared, err := groupKEM.Encapsulate(pub)
+	if err != nil {
+		return GroupSealedSecret{}, err
+	}
+	aead, err := chacha20poly1305.New(groupExpand(shared, "seal", chacha20poly1305.KeySize))
+	if err != nil {
+		return GroupSealedSecret{}, err
+	}
+	// every encapsulation yields a fresh key, so a zero nonce is safe
+	nonce := make([]byte, aead.NonceSize())
+	return GroupSealedSecret{
+		Target:        target,
+		KEMCiphertext: kemCT,
+		Ciphertext:    aead.Seal(nil, nonce, plaintext, aad),
+	}, nil
+}
+
+func groupOpen(priv kem.PrivateKey, sealed GroupSealedSecret, aad []byte) ([]byte, error) {
+	shared, err := groupKEM.Decapsulate(priv, sealed.KEMCiphertext)
+	if err != nil {
+		return nil, err
+	}
+	aead, err := chacha20poly1305.New(groupExpand(shared, "seal", chacha20poly1305.KeySize))
+	if err != nil {
+		return nil, err
+	}
+	nonce := make([]byte, aead.NonceSize())
+	plain, err := aead.Open(nil, nonce, sealed.Ciphertext, aad)
+	if err != nil {
+		return nil, ErrDecryptionFailed
+	}
+	return plain, nil
+}
+
+// SerializeGroupCommit converts a commit to bytes
+func SerializeGroupCommit(c *GroupCommit) ([]byte, error) {
+	return json.Marshal(c)
+}
+
+// DeserializeGroupCommit converts bytes back to a commit
+func DeserializeGroupCommit(data []byte) (*GroupCommit, error) {
+	var c GroupCommit
+	if err := json.Unmarshal(data, &c); err != nil {
+		return nil, err
+	}
+	return &c, nil
+}
+
+// SerializeGroupWelcome converts a welcome to bytes
+func SerializeGroupWelcome(w *GroupWelcome) ([]byte, error) {
+	return json.Marshal(w)
+}
+
+// DeserializeGroupWelcome converts bytes back to a welcome
+func DeserializeGroupWelcome(data []byte) (*GroupWelcome, error) {
+	var w GroupWelcome
+	if err := json.Unmarshal(data, &w); err != nil {
+		return nil, err
+	}
+	return &w, nil
+}
@@ -0,0 +1,228 @@
+package crypto
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"slices"
+	"testing"
+)
+
+// testGroup is every member's view of one group
+type testGroup struct {
+	t       *testing.T
+	members map[string]*Group
+}
+
+func newTestGroup(t *testing.T, creator string) *testGroup {
+	t.Helper()
+	keys, err := NewGroupLeafKeys(creator)
+	if err != nil {
+		t.Fatal(err)
+	}
+	g, err := CreateGroup("room", keys)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &testGroup{t: t, members: map[string]*Group{creator: g}}
+}
+
+// commit has committer add and remove members, sending the commit and
+// welcomes over the wire encoding
+func (tg *testGroup) commit(committer string, add, remove []string) {
+	tg.t.Helper()
+	leaves := make(map[string]*GroupLeafKeys)
+	var packages []GroupKeyPackage
+	for _, id := range add {
+		keys, err := NewGroupLeafKeys(id)
+		if err != nil {
+			tg.t.Fatal(err)
+		}
+		leaves[id] = keys
+		packages = append(packages, keys.KeyPackage())
+	}
+	commit, welcomes, err := tg.members[committer].Commit(packages, remove)
+	if err != nil {
+		tg.t.Fatal(err)
+	}
+	data, err := SerializeGroupCommit(commit)
+	if err != nil {
+		tg.t.Fatal(err)
+	}
+	for id, g := range tg.members {
+		if id == committer {
+			continue
+		}
+		c, err := DeserializeGroupCommit(data)
+		if err != nil {
+			tg.t.Fatal(err)
+		}
+		err = g.ProcessCommit(c)
+		if slices.Contains(remove, id) {
+			if !errors.Is(err, ErrGroupRemoved) {
+				tg.t.Fatalf("%s: got %v, want ErrGroupRemoved", id, err)
+			}
+			delete(tg.members, id)
+			continue
+		}
+		if err != nil {
+			tg.t.Fatalf("%s: %v", id, err)
+		}
+	}
+	if len(welcomes) != len(add) {
+		tg.t.Fatalf("%d welcomes for %d members", len(welcomes), len(add))
+	}
+	for _, w := range welcomes {
+		data, err := SerializeGroupWelcome(w)
+		if err != nil {
+			tg.t.Fatal(err)
+		}
+		w, err := DeserializeGroupWelcome(data)
+		if err != nil {
+			tg.t.Fatal(err)
+		}
+		var joined bool
+		for id, keys := range leaves {
+			if tg.members[id] != nil {
+				continue
+			}
+			if g, err := JoinGroup(w, keys); err == nil {
+				tg.members[id] = g
+				joined = true
+				break
+			}
+		}
+		if !joined {
+			tg.t.Fatal("welcome opened by no added member")
+		}
+	}
+}
+
+// agree checks every member is in the same epoch with the same key
+func (tg *testGroup) agree(epoch uint64, members ...string) []byte {
+	tg.t.Helper()
+	slices.Sort(members)
+	var key []byte
+	for id, g := range tg.members {
+		if g.Epoch() != epoch {
+			tg.t.Fatalf("%s in epoch %d, want %d", id, g.Epoch(), epoch)
+		}
+		got := g.Members()
+		slices.Sort(got)
+		if !slices.Equal(got, members) {
+			tg.t.Fatalf("%s sees %v, want %v", id, got, members)
+		}
+		if key == nil {
+			key = g.EpochKey()
+		} else if !bytes.Equal(key, g.EpochKey()) {
+			tg.t.Fatalf("%s derived another epoch key", id)
+		}
+	}
+	return key
+}
+
+func TestGroup(t *testing.T) {
+	tg := newTestGroup(t, "a")
+	first := tg.agree(0, "a")
+
+	tg.commit("a", []string{"b", "c"}, nil)
+	second := tg.agree(1, "a", "b", "c")
+	if bytes.Equal(first, second) {
+		t.Fatal("epoch key not refreshed")
+	}
+
+	// a joined member commits in turn
+	tg.commit("c", []string{"d", "e"}, nil)
+	tg.agree(2, "a", "b", "c", "d", "e")
+
+	// an update alone refreshes the key
+	before := tg.members["a"].EpochKey()
+	tg.commit("b", nil, nil)
+	if bytes.Equal(before, tg.agree(3, "a", "b", "c", "d", "e")) {
+		t.Fatal("epoch key not refreshed by an update")
+	}
+
+	// removed members can't follow
+	removed := tg.members["d"]
+	tg.commit("a", nil, []string{"d"})
+	key := tg.agree(4, "a", "b", "c", "e")
+	if bytes.Equal(removed.EpochKey(), key) {
+		t.Fatal("removed member holds the epoch key")
+	}
+
+	// the freed leaf is reused
+	tg.commit("e", []string{"f"}, []string{"b"})
+	tg.agree(5, "a", "c", "e", "f")
+}
+
+func TestGroupLarge(t *testing.T) {
+	tg := newTestGroup(t, "m0")
+	var ids []string
+	for i := 1; i < 12; i++ {
+		ids = append(ids, fmt.Sprintf("m%d", i))
+	}
+	tg.commit("m0", ids, nil)
+	tg.agree(1, append(ids, "m0")...)
+	tg.commit("m7", nil, []string{"m3", "m4"})
+	tg.agree(2, "m0", "m1", "m2", "m5", "m6", "m7", "m8", "m9", "m10", "m11")
+}
+
+func TestGroupRejects(t *testing.T) {
+	tg := newTestGroup(t, "a")
+	tg.commit("a", []string{"b", "c"}, nil)
+	a, b := tg.members["a"], tg.members["b"]
+
+	commit, _, err := a.Commit(nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	stale := *commit
+	stale.Epoch = b.Epoch()
+	if err := b.ProcessCommit(&stale); !errors.Is(err, ErrGroupEpoch) {
+		t.Fatalf("stale commit: %v", err)
+	}
+	forged := *commit
+	forged.Confirmation = bytes.Clone(commit.Confirmation)
+	forged.Confirmation[0] ^= 1
+	if err := b.ProcessCommit(&forged); !errors.Is(err, ErrGroupConfirmation) {
+		t.Fatalf("forged confirmation: %v", err)
+	}
+	if err := b.ProcessCommit(commit); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, _, err := a.Commit(nil, []string{"a"}); err == nil {
+		t.Fatal("committer removed itself")
+	}
+	if _, _, err := a.Commit(nil, []string{"x"}); err == nil {
+		t.Fatal("removed a non-member")
+	}
+	keys, _ := NewGroupLeafKeys("b")
+	if _, _, err := a.Commit([]GroupKeyPackage{keys.KeyPackage()}, nil); err == nil {
+		t.Fatal("added a member twice")
+	}
+}
+
+func TestTree(t *testing.T) {
+	// 8 leaves: nodes 0..14, root 7
+	if got := treeRoot(8); got != 7 {
+		t.Fatalf("root %d, want 7", got)
+	}
+	tests := []struct {
+		leaf   uint32
+		path   []uint32
+		copath []uint32
+	}{
+		{0, []uint32{1, 3, 7}, []uint32{2, 5, 11}},
+		{4, []uint32{5, 3, 7}, []uint32{6, 1, 11}},
+		{14, []uint32{13, 11, 7}, []uint32{12, 9, 3}},
+	}
+	for _, tt := range tests {
+		if got := treeDirectPath(tt.leaf, 8); !slices.Equal(got, tt.path) {
+			t.Errorf("direct path of %d: %v, want %v", tt.leaf, got, tt.path)
+		}
+		if got := treeCopath(tt.leaf, 8); !slices.Equal(got, tt.copath) {
+			t.Errorf("copath of %d: %v, want %v", tt.leaf, got, tt.copath)
+		}
+	}
+}
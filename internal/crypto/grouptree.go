@@ -0,0 +1,88 @@
+package crypto
+
+// Array-based left-balanced binary tree (RFC 9420, appendix C). Leaf i is
+// node 2i; parents sit between their children; the number of leaves is a
+// power of two, so a tree of n leaves has 2n-1 nodes.
+
+// treeLevel is the height of node x above the leaves
+func treeLevel(x uint32) uint32 {
+	if x&1 == 0 {
+		return 0
+	}
+	k := uint32(0)
+	for (x>>k)&1 == 1 {
+		k++
+	}
+	return k
+}
+
+// treeWidth is the number of nodes in a tree of n leaves
+func treeWidth(leaves uint32) uint32 {
+	if leaves == 0 {
+		return 0
+	}
+	return 2*(leaves-1) + 1
+}
+
+func treeRoot(leaves uint32) uint32 {
+	w := treeWidth(leaves)
+	r := uint32(1)
+	for r<<1 <= w {
+		r <<= 1
+	}
+	return r - 1
+}
+
+func treeLeft(x uint32) uint32 {
+	k := treeLevel(x)
+	return x ^ (1 << (k - 1))
+}
+
+func treeRight(x uint32) uint32 {
+	k := treeLevel(x)
+	return x ^ (3 << (k - 1))
+}
+
+func treeParent(x uint32) uint32 {
+	k := treeLevel(x)
+	b := (x >> (k + 1)) & 1
+	return (x | (1 << k)) ^ (b << (k + 1))
+}
+
+func treeSibling(x uint32) uint32 {
+	p := treeParent(x)
+	if x < p {
+		return treeRight(p)
+	}
+	return treeLeft(p)
+}
+
+// treeDirectPath lists x's ancestors from its parent up to the root
+func treeDirectPath(x, leaves uint32) []uint32 {
+	r := treeRoot(leaves)
+	var path []uint32
+	for x != r {
+		x = treeParent(x)
+		path = append(path, x)
+	}
+	return path
+}
+
+// treeCopath lists the sibling of x and of each of its ancestors below the root
+func treeCopath(x, leaves uint32) []uint32 {
+	path := treeDirectPath(x, leaves)
+	if len(path) == 0 {
+		return nil
+	}
+	copath := []uint32{treeSibling(x)}
+	for _, y := range path[:len(path)-1] {
+		copath = append(copath, treeSibling(y))
+	}
+	return copath
+}
+
+// treeIsAncestor reports whether a is an ancestor of (or equal to) leaf node x
+func treeIsAncestor(a, x uint32) bool {
+	k := treeLevel(a)
+	return x>>(k+1) == a>>(k+1)
+}
@@ -0,0 +1,120 @@
+package crypto
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/cloudflare/circl/kem/kyber/kyber1024"
+	"github.com/cloudflare/circl/sign"
+	mode5 "github.com/cloudflare/circl/sign/dilithium/mode5"
+)
+
+// IdentityKeys is the serialized form of our long-term identity key pairs
+type IdentityKeys struct {
+	KEMPrivateKey []byte `json:"kem_private_key"`
+	KEMPublicKey  []byte `json:"kem_public_key"`
+	SigPrivateKey []byte `json:"sig_private_key"`
+	SigPublicKey  []byte `json:"sig_public_key"`
+}
+
+// NewPQCryptoWithIdentity creates a crypto instance that reuses previously
+// generated identity keys instead of generating fresh ones. Ephemeral keys are
+// always generated anew.
+func NewPQCryptoWithIdentity(keys *IdentityKeys) (*PQCrypto, error) {
+	if keys == nil {
+		return nil, fmt.Errorf("identity keys are required")
+	}
+
+	pq := &PQCrypto{
+		kemScheme:           kyber1024.Scheme(),
+		sigScheme:           mode5.Scheme(),
+		peers:               make(map[string]*PeerCryptoState),
+		keyRotationInterval: 15 * time.Minute,
+		lastKeyRotation:     time.Now(),
+	}
+
+	if err := pq.loadIdentityKeys(keys); err != nil {
+		return nil, fmt.Errorf("failed to load identity keys: %w", err)
+	}
+
+	if err := pq.generateEphemeralKeyPairs(); err != nil {
+		return nil, fmt.Errorf("failed to generate ephemeral keys: %w", err)
+	}
+
+	return pq, nil
+}
+
+// ExportIdentityKeys returns our identity key pairs in serialized form so
+// they can be persisted in the keystore
+func (pq *PQCrypto) ExportIdentityKeys() (*IdentityKeys, error) {
+	kemPriv, err := pq.identityKEMPrivateKey.MarshalBinary()
+	if err != nil {
+		return nil, err
+	}
+	kemPub, err := pq.identityKEMPublicKey.MarshalBinary()
+	if err != nil {
+		return nil, err
+	}
+	sigPriv, err := pq.identitySigPrivateKey.MarshalBinary()
+	if err != nil {
+		return nil, err
+	}
+	sigPub, err := pq.identitySigPublicKey.MarshalBinary()
+	if err != nil {
+		return nil, err
+	}
+	return &IdentityKeys{
+		KEMPrivateKey: kemPriv,
+		KEMPublicKey:  kemPub,
+		SigPrivateKey: sigPriv,
+		SigPublicKey:  sigPub,
+	}, nil
+}
+
+// load identity keys and make sure the public halves match the private ones
+func (pq *PQCrypto) loadIdentityKeys(keys *IdentityKeys) error {
+	kemPriv, err := pq.kemScheme.UnmarshalBinaryPrivateKey(keys.KEMPrivateKey)
+	if err != nil {
+		return fmt.Errorf("invalid KEM private key: %w", err)
+	}
+	kemPub := kemPriv.Public()
+	if len(keys.KEMPublicKey) > 0 {
+		stored, err := pq.kemScheme.UnmarshalBinaryPublicKey(keys.KEMPublicKey)
+		if err != nil {
+			return fmt.Errorf("invalid KEM public key: %w", err)
+		}
+		if !stored.Equal(kemPub) {
+			return fmt.Errorf("KEM public key does not match private key")
+		}
+	}
+
+	sigPriv, err := pq.sigScheme.UnmarshalBinaryPrivateKey(keys.SigPrivateKey)
+	if err != nil {
+		return fmt.Errorf("invalid signature private key: %w", err)
+	}
+	sigPub, ok := sigPriv.Public().(sign.PublicKey)
+	if !ok {
+		return fmt.Errorf("unexpected signature public key type")
+	}
+	if len(keys.SigPublicKey) > 0 {
+		stored, err := pq.sigScheme.UnmarshalBinaryPublicKey(keys.SigPublicKey)
+		if err != nil {
+			return fmt.Errorf("invalid signature public key: %w", err)
+		}
+		if !stored.Equal(sigPub) {
+			return fmt.Errorf("signature public key does not match private key")
+		}
+	}
+
+	pq.identityKEMPrivateKey = kemPriv
+	pq.identityKEMPublicKey = kemPub
+	pq.identitySigPrivateKey = sigPriv
+	pq.identitySigPublicKey = sigPub
+	return nil
+}
+
+// Fingerprint returns the identity fingerprint for these keys, computed the
+// same way as GetIdentityFingerprint
+func (k *IdentityKeys) Fingerprint() string {
+	return ComputeFingerprint(k.KEMPublicKey, k.SigPublicKey)
+}
@@ -0,0 +1,218 @@
+package crypto
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"golang.org/x/crypto/chacha20poly1305"
+)
+
+// MessageTypeSealed marks a message sealed to a peer's identity key for
+// store-and-forward delivery through a mailbox
+const MessageTypeSealed = 7
+
+const (
+	sealedKeyInfo     = "execp2p-sealed-message-v1"
+	mailboxSecretInfo = "execp2p-mailbox-secret-v1"
+)
+
+// SealedMessage is a chat message for a peer that is offline. It is
+// encapsulated to the recipient's long-term Kyber identity key, so only the
+// recipient can open it, and signed with the sender's Dilithium identity key.
+// Unlike session messages it has no forward secrecy: whoever later gets the
+// recipient's identity key can open mailbox messages kept until then.
+type SealedMessage struct {
+	Version              uint8     `json:"version"`
+	Type                 uint8     `json:"type"`
+	SenderID             string    `json:"sender_id"`
+	SenderKEMPubKey      []byte    `json:"sender_kem_pub_key"`
+	SenderSigPubKey      []byte    `json:"sender_sig_pub_key"`
+	RecipientFingerprint string    `json:"recipient_fingerprint"`
+	RoomID               string    `json:"room_id"`
+	Timestamp            time.Time `json:"timestamp"`
+	KEMCiphertext        []byte    `json:"kem_ciphertext"`
+	Salt                 []byte    `json:"salt"`
+	EncryptedPayload     []byte    `json:"encrypted_payload"`
+	Signature            []byte    `json:"signature"`
+}
+
+// SealMessage seals a chat message for the peer whose identity KEM key is
+// recipientKEMPub. The payload carries a fresh message ID like a session message.
+func (pq *PQCrypto) SealMessage(recipientKEMPub, recipientSigPub []byte, senderID, roomID, message string) (*SealedMessage, *MessagePayload, error) {
+	pub, err := pq.kemScheme.UnmarshalBinaryPublicKey(recipientKEMPub)
+	if err != nil {
+		return nil, nil, fmt.Errorf("invalid recipient key: %w", err)
+	}
+	kemCT, sharedSecret, err := pq.kemScheme.Encapsulate(pub)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	payload := &MessagePayload{
+		Timestamp: time.Now(),
+		Message:   message,
+		SenderID:  senderID,
+		MessageID: generateMessageID(),
+	}
+	payloadBytes, err := SerializePayload(*payload)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	kemPub, sigPub := pq.GetIdentityPublicKeys()
+	sealed := &SealedMessage{
+		Version:              1,
+		Type:                 MessageTypeSealed,
+		SenderID:             senderID,
+		SenderKEMPubKey:      kemPub,
+		SenderSigPubKey:      sigPub,
+		RecipientFingerprint: ComputeFingerprint(recipientKEMPub, recipientSigPub),
+		RoomID:               roomID,
+		Timestamp:            payload.Timestamp,
+		KEMCiphertext:        kemCT,
+		Salt:                 make([]byte, 32),
+	}
+	if _, err := rand.Read(sealed.Salt); err != nil {
+		return nil, nil, err
+	}
+
+	key, err := deriveKeyWithSalt(sharedSecret, sealed.Salt, sealedKeyInfo, chacha20poly1305.KeySize)
+	if err != nil {
+		return nil, nil, err
+	}
+	aead, err := chacha20poly1305.NewX(key)
+	if err != nil {
+		return nil, nil, err
+	}
+	nonce := make([]byte, aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, nil, err
+	}
+	aad, err := sealedHeader(sealed)
+	if err != nil {
+		return nil, nil, err
+	}
+	sealed.EncryptedPayload = aead.Seal(nonce, nonce, payloadBytes, aad)
+
+	signData, err := sealedSignable(sealed)
+	if err != nil {
+		return nil, nil, err
+	}
+	sealed.Signature = pq.sigScheme.Sign(pq.identitySigPrivateKey, signData, nil)
+	return sealed, payload, nil
+}
+
+// OpenSealedMessage checks the sender's signature, opens a message sealed to
+// our identity and returns it with the sender's identity fingerprint. The
+// caller decides whether that fingerprint belongs to the claimed sender.
+func (pq *PQCrypto) OpenSealedMessage(sealed *SealedMessage) (*MessagePayload, string, error) {
+	if sealed.Type != MessageTypeSealed {
+		return nil, "", fmt.Errorf("not a sealed message")
+	}
+	own, err := pq.GetIdentityFingerprint()
+	if err != nil {
+		return nil, "", err
+	}
+	if sealed.RecipientFingerprint != own {
+		return nil, "", fmt.Errorf("sealed message is for another identity")
+	}
+
+	sigPub, err := pq.sigScheme.UnmarshalBinaryPublicKey(sealed.SenderSigPubKey)
+	if err != nil {
+		return nil, "", fmt.Errorf("invalid sender key: %w", err)
+	}
+	signData, err := sealedSignable(sealed)
+	if err != nil {
+		return nil, "", err
+	}
+	if !pq.sigScheme.Verify(sigPub, signData, sealed.Signature, nil) {
+		return nil, "", ErrInvalidSignature
+	}
+
+	sharedSecret, err := pq.kemScheme.Decapsulate(pq.identityKEMPrivateKey, sealed.KEMCiphertext)
+	if err != nil {
+		return nil, "", ErrDecryptionFailed
+	}
+	key, err := deriveKeyWithSalt(sharedSecret, sealed.Salt, sealedKeyInfo, chacha20poly1305.KeySize)
+	if err != nil {
+		return nil, "", err
+	}
+	aead, err := chacha20poly1305.NewX(key)
+	if err != nil {
+		return nil, "", err
+	}
+	if len(sealed.EncryptedPayload) < aead.NonceSize() {
+		return nil, "", ErrInvalidNonceSize
+	}
+	aad, err := sealedHeader(sealed)
+	if err != nil {
+		return nil, "", err
+	}
+	nonce, ciphertext := sealed.EncryptedPayload[:aead.NonceSize()], sealed.EncryptedPayload[aead.NonceSize():]
+	payloadBytes, err := aead.Open(nil, nonce, ciphertext, aad)
+	if err != nil {
+		return nil, "", ErrDecryptionFailed
+	}
+
+	var payload MessagePayload
+	if err := json.Unmarshal(payloadBytes, &payload); err != nil {
+		return nil, "", fmt.Errorf("invalid sealed payload: %w", err)
+	}
+	if payload.SenderID != sealed.SenderID {
+		return nil, "", fmt.Errorf("sealed message sender mismatch")
+	}
+	return &payload, ComputeFingerprint(sealed.SenderKEMPubKey, sealed.SenderSigPubKey), nil
+}
+
+// MailboxSecret is the secret that unlocks our mailbox on a relay server. It
+// is derived from the identity, so every device holding the identity reads
+// the same mailbox; the server only ever learns its hash.
+func (pq *PQCrypto) MailboxSecret() ([]byte, error) {
+	priv, err := pq.identitySigPrivateKey.MarshalBinary()
+	if err != nil {
+		return nil, err
+	}
+	return deriveKeyWithSalt(priv, nil, mailboxSecretInfo, 32)
+}
+
+// GetPeerIdentityKeys returns the identity public keys a peer announced
+func (pq *PQCrypto) GetPeerIdentityKeys(peerID string) ([]byte, []byte, error) {
+	pq.peersMutex.RLock()
+	defer pq.peersMutex.RUnlock()
+	peer, exists := pq.peers[peerID]
+	if !exists || len(peer.IdentityKEMPublicKey) == 0 {
+		return nil, nil, ErrPeerNotFound
+	}
+	return bytes.Clone(peer.IdentityKEMPublicKey), bytes.Clone(peer.IdentitySigPublicKey), nil
+}
+
+// SerializeSealedMessage encodes a sealed message for the mailbox
+func SerializeSealedMessage(sealed *SealedMessage) ([]byte, error) {
+	return json.Marshal(sealed)
+}
+
+// DeserializeSealedMessage decodes a sealed message from the mailbox
+func DeserializeSealedMessage(data []byte) (*SealedMessage, error) {
+	var sealed SealedMessage
+	if err := json.Unmarshal(data, &sealed); err != nil {
+		return nil, err
+	}
+	return &sealed, nil
+}
+
+// sealedHeader is the AEAD additional data: everything but the payload and signature
+func sealedHeader(sealed *SealedMessage) ([]byte, error) {
+	header := *sealed
+	header.EncryptedPayload = nil
+	header.Signature = nil
+	return json.Marshal(&header)
+}
+
+func sealedSignable(sealed *SealedMessage) ([]byte, error) {
+	signable := *sealed
+	signable.Signature = nil
+	return json.Marshal(&signable)
+}
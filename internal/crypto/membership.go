@@ -0,0 +1,172 @@
+package crypto
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"execp2p/internal/wire"
+)
+
+// MessageTypeMembershipCert marks a signed room membership certificate
+const MessageTypeMembershipCert = 6
+
+// membershipProofContext separates membership proofs from other signatures
+// made with the identity key
+var membershipProofContext = []byte("execp2p-membership-proof-v1")
+
+// MembershipCert is issued by the room host to a peer that joined with the
+// access key. It names the member's identity, so on later connections the
+// member proves membership by signing with that identity instead of running
+// the access key handshake again.
+type MembershipCert struct {
+	Version           uint8     `json:"version"`
+	Type              uint8     `json:"type"`
+	RoomID            string    `json:"room_id"`
+	HostID            string    `json:"host_id"`
+	HostFingerprint   string    `json:"host_fingerprint"`
+	MemberID          string    `json:"member_id"`
+	MemberFingerprint string    `json:"member_fingerprint"`
+	MemberSigPubKey   []byte    `json:"member_sig_pub_key"`
+	IssuedAt          time.Time `json:"issued_at"`
+	ExpiresAt         time.Time `json:"expires_at"`
+	Signature         []byte    `json:"signature"`
+}
+
+// IssueMembershipCert certifies the identity the peer announced as a member
+// of the room until validity runs out
+func (pq *PQCrypto) IssueMembershipCert(roomID, hostID, memberID string, validity time.Duration) (*MembershipCert, error) {
+	pq.peersMutex.RLock()
+	peer, exists := pq.peers[memberID]
+	var sigPub []byte
+	var memberFingerprint string
+	if exists {
+		sigPub = append([]byte(nil), peer.IdentitySigPublicKey...)
+		memberFingerprint = peer.TrustFingerprint
+	}
+	pq.peersMutex.RUnlock()
+	if !exists {
+		return nil, ErrPeerNotFound
+	}
+
+	fingerprint, err := pq.GetIdentityFingerprint()
+	if err != nil {
+		return nil, err
+	}
+	now := time.Now()
+	cert := &MembershipCert{
+		Version:           1,
+		Type:              MessageTypeMembershipCert,
+		RoomID:            roomID,
+		HostID:            hostID,
+		HostFingerprint:   fingerprint,
+		MemberID:          memberID,
+		MemberFingerprint: memberFingerprint,
+		MemberSigPubKey:   sigPub,
+		IssuedAt:          now,
+		ExpiresAt:         now.Add(validity),
+	}
+	signData, err := getSignableDataForMembershipCert(cert)
+	if err != nil {
+		return nil, fmt.Errorf("failed to serialize membership certificate for signing: %w", err)
+	}
+	cert.Signature = pq.sigScheme.Sign(pq.identitySigPrivateKey, signData, nil)
+	return cert, nil
+}
+
+// VerifyMembershipCert checks that the certificate is current, for roomID,
+// and signed by its host: ourselves when we host the room, otherwise the
+// host's announced identity
+func (pq *PQCrypto) VerifyMembershipCert(cert *MembershipCert, roomID string) error {
+	if cert.Type != MessageTypeMembershipCert || cert.RoomID != roomID {
+		return fmt.Errorf("%w: membership certificate for another room", ErrInvalidHandshake)
+	}
+	if time.Now().After(cert.ExpiresAt) {
+		return fmt.Errorf("%w: membership certificate expired", ErrInvalidHandshake)
+	}
+
+	var sigPubBytes []byte
+	own, err := pq.GetIdentityFingerprint()
+	if err != nil {
+		return err
+	}
+	if cert.HostFingerprint == own {
+		_, sigPubBytes = pq.GetIdentityPublicKeys()
+	} else {
+		pq.peersMutex.RLock()
+		peer, exists := pq.peers[cert.HostID]
+		if exists && peer.TrustFingerprint == cert.HostFingerprint {
+			sigPubBytes = peer.IdentitySigPublicKey
+		}
+		pq.peersMutex.RUnlock()
+		if sigPubBytes == nil {
+			return ErrPeerNotFound
+		}
+	}
+
+	sigPub, err := pq.sigScheme.UnmarshalBinaryPublicKey(sigPubBytes)
+	if err != nil {
+		return ErrInvalidKeySize
+	}
+	signData, err := getSignableDataForMembershipCert(cert)
+	if err != nil {
+		return fmt.Errorf("failed to serialize membership certificate for verification: %w", err)
+	}
+	if !pq.sigScheme.Verify(sigPub, signData, cert.Signature, nil) {
+		return ErrInvalidSignature
+	}
+	return nil
+}
+
+// SignMembershipProof proves possession of our identity key for binding
+// (the connection's TLS exporter), to go with our membership certificate
+func (pq *PQCrypto) SignMembershipProof(binding []byte) []byte {
+	return pq.sigScheme.Sign(pq.identitySigPrivateKey, membershipProofData(binding), nil)
+}
+
+// VerifyMembershipProof checks that the certificate's member signed binding
+func (pq *PQCrypto) VerifyMembershipProof(cert *MembershipCert, binding, proof []byte) error {
+	sigPub, err := pq.sigScheme.UnmarshalBinaryPublicKey(cert.MemberSigPubKey)
+	if err != nil {
+		return ErrInvalidKeySize
+	}
+	if !pq.sigScheme.Verify(sigPub, membershipProofData(binding), proof, nil) {
+		return ErrInvalidSignature
+	}
+	return nil
+}
+
+// MatchesAnnouncement reports whether the announcement comes from the
+// certified member identity
+func (cert *MembershipCert) MatchesAnnouncement(announcement *PeerAnnouncement) bool {
+	return announcement.PeerID == cert.MemberID &&
+		announcement.TrustFingerprint == cert.MemberFingerprint &&
+		bytes.Equal(announcement.IdentitySigPubKey, cert.MemberSigPubKey)
+}
+
+func membershipProofData(binding []byte) []byte {
+	return append(append([]byte(nil), membershipProofContext...), binding...)
+}
+
+// SerializeMembershipCert converts a certificate to bytes
+func SerializeMembershipCert(cert *MembershipCert) ([]byte, error) {
+	return json.Marshal(cert)
+}
+
+// DeserializeMembershipCert converts bytes back to a certificate, from JSON
+// or CBOR
+func DeserializeMembershipCert(data []byte) (*MembershipCert, error) {
+	var cert MembershipCert
+	if err := wire.Unmarshal(data, &cert); err != nil {
+		return nil, err
+	}
+	return &cert, nil
+}
+
+// serialize a certificate for signing (without signature field)
+func getSignableDataForMembershipCert(cert *MembershipCert) ([]byte, error) {
+	certToSign := *cert
+	certToSign.Signature = nil
+	return SerializeMembershipCert(&certToSign)
+}
@@ -0,0 +1,87 @@
+package crypto
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+)
+
+// pakeExchange runs both sides of an exchange and returns the sides
+// and each one's verification of the other's confirmation
+func pakeExchange(t *testing.T, passA, passB, ctxA, ctxB []byte) (a, b *PAKE, errA, errB error) {
+	t.Helper()
+	a, err := NewPAKE(PAKEInitiator, passA, ctxA)
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, err = NewPAKE(PAKEResponder, passB, ctxB)
+	if err != nil {
+		t.Fatal(err)
+	}
+	confA, err := a.Finish(b.Share())
+	if err != nil {
+		t.Fatal(err)
+	}
+	confB, err := b.Finish(a.Share())
+	if err != nil {
+		t.Fatal(err)
+	}
+	return a, b, a.Verify(confB), b.Verify(confA)
+}
+
+func TestPAKE(t *testing.T) {
+	a, b, errA, errB := pakeExchange(t, []byte("access key"), []byte("access key"), []byte("session"), []byte("session"))
+	if errA != nil || errB != nil {
+		t.Fatalf("confirmation failed: %v, %v", errA, errB)
+	}
+	if len(a.Key()) == 0 || !bytes.Equal(a.Key(), b.Key()) {
+		t.Fatal("keys differ")
+	}
+}
+
+func TestPAKEMismatch(t *testing.T) {
+	tests := []struct {
+		name        string
+		passB, ctxB []byte
+	}{
+		{"access key", []byte("wrong key"), []byte("session")},
+		{"context", []byte("access key"), []byte("other session")},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			a, b, errA, errB := pakeExchange(t, []byte("access key"), tt.passB, []byte("session"), tt.ctxB)
+			if !errors.Is(errA, ErrPAKEFailed) || !errors.Is(errB, ErrPAKEFailed) {
+				t.Fatalf("got %v, %v, want ErrPAKEFailed", errA, errB)
+			}
+			if bytes.Equal(a.Key(), b.Key()) {
+				t.Fatal("keys agree")
+			}
+		})
+	}
+}
+
+func TestPAKEState(t *testing.T) {
+	if _, err := NewPAKE(PAKEInitiator, nil, nil); err == nil {
+		t.Fatal("empty access key accepted")
+	}
+	a, err := NewPAKE(PAKEInitiator, []byte("k"), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := a.Verify(make([]byte, 32)); !errors.Is(err, ErrPAKEState) {
+		t.Fatalf("verify before finish: %v", err)
+	}
+	if _, err := a.Finish([]byte("not a point")); !errors.Is(err, ErrPAKEFailed) {
+		t.Fatalf("invalid share: %v", err)
+	}
+	b, err := NewPAKE(PAKEResponder, []byte("k"), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := a.Finish(b.Share()); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := a.Finish(b.Share()); !errors.Is(err, ErrPAKEState) {
+		t.Fatalf("second finish: %v", err)
+	}
+}
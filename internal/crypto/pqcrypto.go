@@ -1,6 +1,7 @@
 package crypto
 
 import (
+	"crypto/hmac"
 	"crypto/rand"
 	"crypto/sha256"
 	"encoding/hex"
@@ -10,6 +11,8 @@ import (
 	"sync"
 	"time"
 
+	"execp2p/internal/clock"
+
 	"github.com/cloudflare/circl/kem"
 	"github.com/cloudflare/circl/kem/kyber/kyber1024"
 	"github.com/cloudflare/circl/sign"
@@ -26,6 +29,11 @@ var (
 	ErrPeerNotFound      = errors.New("peer not found")
 	ErrInvalidHandshake  = errors.New("invalid handshake")
 	ErrKeyRotationFailed = errors.New("key rotation failed")
+
+	// ErrRotationInFlight means none of our keys opens a message whose key
+	// epoch is too recent for it to be stale, i.e. the matching key
+	// exchange has not been processed yet
+	ErrRotationInFlight = errors.New("message key epoch not established yet")
 )
 
 // message types for our protocol
@@ -50,9 +58,12 @@ type PQCrypto struct {
 	identitySigPrivateKey sign.PrivateKey
 	identitySigPublicKey  sign.PublicKey
 
-	// ephemeral keys for forward secrecy
+	// ephemeral keys for forward secrecy; a few previous pairs are kept so
+	// key exchanges encapsulated to them while we rotated still work
 	ephemeralKEMPrivateKey kem.PrivateKey
 	ephemeralKEMPublicKey  kem.PublicKey
+	previousEphemeral      []kemKeyPair // newest first
+	ephemeralMutex         sync.RWMutex
 
 	// peer state tracking
 	peers      map[string]*PeerCryptoState
@@ -61,6 +72,8 @@ type PQCrypto struct {
 	// key rotation
 	keyRotationInterval time.Duration
 	lastKeyRotation     time.Time
+	// tells when a rotation is due, the wall clock when nil
+	rotationClock clock.Clock
 }
 
 // PeerCryptoState holds crypto state for each peer
@@ -69,12 +82,44 @@ type PeerCryptoState struct {
 	IdentityKEMPublicKey  []byte
 	IdentitySigPublicKey  []byte
 	CurrentSharedSecret   []byte
-	PreviousSharedSecret  []byte // for forward secrecy during rotation
+	PreviousSecrets       []RetainedSecret // superseded secrets for messages in flight during rotation
 	LastMessageTime       time.Time
 	LastKeyRotation       time.Time
-	Verified              bool // whether we've verified this peer
+	SendSequence          uint64 // last sequence number we used towards this peer
+	SendSequenceEpoch     uint64 // when that numbering started, unix nanos
+	Verified              bool   // whether we've verified this peer
 	TrustFingerprint      string
 	EphemeralKEMPublicKey []byte // newly tracked peer ephemeral key
+	// epoch of the newest key exchange the peer sent us
+	lastPeerKeyExchange time.Time
+}
+
+// how many superseded keys are kept around while a rotation is in flight
+const (
+	maxRetainedSecrets       = 4
+	maxRetainedEphemeralKeys = 4
+)
+
+// RetainedSecret is a superseded shared secret with its rotation epoch
+type RetainedSecret struct {
+	Secret []byte
+	Epoch  time.Time
+}
+
+type kemKeyPair struct {
+	pub  kem.PublicKey
+	priv kem.PrivateKey
+}
+
+// retain keeps a superseded secret for messages still in flight
+func (p *PeerCryptoState) retain(secret []byte, epoch time.Time) {
+	if len(secret) == 0 {
+		return
+	}
+	p.PreviousSecrets = append([]RetainedSecret{{Secret: secret, Epoch: epoch}}, p.PreviousSecrets...)
+	if len(p.PreviousSecrets) > maxRetainedSecrets {
+		p.PreviousSecrets = p.PreviousSecrets[:maxRetainedSecrets]
+	}
 }
 
 // KeyExchangeMessage is for the handshake
@@ -89,6 +134,9 @@ type KeyExchangeMessage struct {
 	Signature          []byte    `json:"signature"`
 	Timestamp          time.Time `json:"timestamp"`
 	Nonce              []byte    `json:"nonce"`
+	// identifies which of the recipient's KEM keys the ciphertext was
+	// encapsulated to; empty means the identity key (legacy)
+	RecipientKeyID []byte `json:"recipient_key_id,omitempty"`
 }
 
 // EncryptedMessage is for encrypted chat messages
@@ -110,6 +158,14 @@ type MessagePayload struct {
 	Message   string    `json:"message"`
 	SenderID  string    `json:"sender_id"`
 	MessageID string    `json:"message_id"`
+	// per-sender counter, starting at 1; 0 for peers that don't send it
+	Sequence uint64 `json:"seq,omitempty"`
+	// when the sender started this numbering (unix nanos): a later one
+	// means it counts from 1 again, e.g. after reconnecting
+	SequenceEpoch uint64 `json:"seq_epoch,omitempty"`
+	// set on receive: how many of the sender's messages before this one
+	// never arrived
+	Gap uint64 `json:"-"`
 }
 
 // PeerAnnouncement is for broadcasting our identity
@@ -121,6 +177,8 @@ type PeerAnnouncement struct {
 	IdentitySigPubKey  []byte    `json:"identity_sig_pub_key"`
 	TrustFingerprint   string    `json:"trust_fingerprint"`
 	TLSCertFingerprint string    `json:"tls_cert_fp"`
+	TLSKeySignature    []byte    `json:"tls_key_sig,omitempty"` // over the TLS certificate's key, see tlskey.go
+	Nickname           string    `json:"nickname,omitempty"`    // signed like the rest
 	Signature          []byte    `json:"signature"`
 	Timestamp          time.Time `json:"timestamp"`
 }
@@ -175,6 +233,14 @@ func (pq *PQCrypto) generateEphemeralKeyPairs() error {
 	if err != nil {
 		return err
 	}
+	pq.ephemeralMutex.Lock()
+	defer pq.ephemeralMutex.Unlock()
+	if pq.ephemeralKEMPublicKey != nil {
+		pq.previousEphemeral = append([]kemKeyPair{{pq.ephemeralKEMPublicKey, pq.ephemeralKEMPrivateKey}}, pq.previousEphemeral...)
+		if len(pq.previousEphemeral) > maxRetainedEphemeralKeys {
+			pq.previousEphemeral = pq.previousEphemeral[:maxRetainedEphemeralKeys]
+		}
+	}
 	pq.ephemeralKEMPublicKey = kemPub
 	pq.ephemeralKEMPrivateKey = kemPriv
 	return nil
@@ -189,12 +255,15 @@ func (pq *PQCrypto) GetIdentityPublicKeys() ([]byte, []byte) {
 
 // GetEphemeralKEMPublicKey returns our current ephemeral key
 func (pq *PQCrypto) GetEphemeralKEMPublicKey() []byte {
+	pq.ephemeralMutex.RLock()
+	defer pq.ephemeralMutex.RUnlock()
 	kemPubBytes, _ := pq.ephemeralKEMPublicKey.MarshalBinary()
 	return kemPubBytes
 }
 
-// CreatePeerAnnouncement creates a signed announcement of our identity
-func (pq *PQCrypto) CreatePeerAnnouncement(peerID string, certFingerprint string) (*PeerAnnouncement, error) {
+// CreatePeerAnnouncement creates a signed announcement of our identity,
+// transport certificate and nickname
+func (pq *PQCrypto) CreatePeerAnnouncement(peerID string, certFingerprint string, certPublicKey []byte, nickname string) (*PeerAnnouncement, error) {
 	kemPubBytes, sigPubBytes := pq.GetIdentityPublicKeys()
 	fingerprint, err := pq.GetIdentityFingerprint()
 	if err != nil {
@@ -209,6 +278,8 @@ func (pq *PQCrypto) CreatePeerAnnouncement(peerID string, certFingerprint string
 		IdentitySigPubKey:  sigPubBytes,
 		TrustFingerprint:   fingerprint,
 		TLSCertFingerprint: certFingerprint,
+		TLSKeySignature:    pq.SignTLSKey(certPublicKey),
+		Nickname:           nickname,
 		Timestamp:          time.Now(),
 	}
 
@@ -223,22 +294,37 @@ func (pq *PQCrypto) CreatePeerAnnouncement(peerID string, certFingerprint string
 	return announcement, nil
 }
 
-// ProcessPeerAnnouncement handles incoming peer announcements
-func (pq *PQCrypto) ProcessPeerAnnouncement(announcement *PeerAnnouncement) error {
-	// verify the signature
+// VerifyPeerAnnouncement checks the announcement signature and returns the
+// fingerprint of the announced identity keys. The self-reported fingerprint
+// must match the keys.
+func (pq *PQCrypto) VerifyPeerAnnouncement(announcement *PeerAnnouncement) (string, error) {
 	signData, err := getSignableDataForPeerAnnouncement(announcement)
 	if err != nil {
-		return fmt.Errorf("failed to serialize announcement for verification: %w", err)
+		return "", fmt.Errorf("failed to serialize announcement for verification: %w", err)
 	}
 
 	// convert signature public key
 	sigPub, err := pq.sigScheme.UnmarshalBinaryPublicKey(announcement.IdentitySigPubKey)
 	if err != nil {
-		return ErrInvalidKeySize
+		return "", ErrInvalidKeySize
 	}
 
 	if !pq.sigScheme.Verify(sigPub, signData, announcement.Signature, nil) {
-		return ErrInvalidSignature
+		return "", ErrInvalidSignature
+	}
+
+	fingerprint := ComputeFingerprint(announcement.IdentityKEMPubKey, announcement.IdentitySigPubKey)
+	if announcement.TrustFingerprint != fingerprint {
+		return "", fmt.Errorf("%w: announced fingerprint does not match identity keys", ErrInvalidHandshake)
+	}
+	return fingerprint, nil
+}
+
+// ProcessPeerAnnouncement handles incoming peer announcements
+func (pq *PQCrypto) ProcessPeerAnnouncement(announcement *PeerAnnouncement) error {
+	// verify the signature
+	if _, err := pq.VerifyPeerAnnouncement(announcement); err != nil {
+		return err
 	}
 
 	// store peer info
@@ -250,6 +336,10 @@ func (pq *PQCrypto) ProcessPeerAnnouncement(announcement *PeerAnnouncement) erro
 		peer.IdentityKEMPublicKey = announcement.IdentityKEMPubKey
 		peer.IdentitySigPublicKey = announcement.IdentitySigPubKey
 		peer.TrustFingerprint = announcement.TrustFingerprint
+		// a peer announces itself on every new connection and may have
+		// restarted since, losing its ephemeral key: the next key exchange
+		// goes to its identity key
+		peer.EphemeralKEMPublicKey = nil
 	} else {
 		// create new peer
 		pq.peers[announcement.PeerID] = &PeerCryptoState{
@@ -293,6 +383,11 @@ func (pq *PQCrypto) InitiateKeyExchange(peerID string, senderID string) (*KeyExc
 		peerKEMPub = peerIdentityKEMPub
 	}
 
+	peerKEMPubBytes, err := peerKEMPub.MarshalBinary()
+	if err != nil {
+		return nil, err
+	}
+
 	// do key encapsulation with chosen key
 	ciphertext, sharedSecret, err := pq.kemScheme.Encapsulate(peerKEMPub)
 	if err != nil {
@@ -323,6 +418,11 @@ func (pq *PQCrypto) InitiateKeyExchange(peerID string, senderID string) (*KeyExc
 		Timestamp:          now,
 		Nonce:              nonce,
 	}
+	// Kyber decapsulation with the wrong key doesn't fail, it yields an
+	// unrelated secret, so tell the peer which key we used
+	if len(peer.EphemeralKEMPublicKey) > 0 {
+		keyExchange.RecipientKeyID = kemKeyID(peerKEMPubBytes)
+	}
 
 	// sign the key exchange message
 	signData, err := getSignableDataForKeyExchange(keyExchange)
@@ -332,8 +432,9 @@ func (pq *PQCrypto) InitiateKeyExchange(peerID string, senderID string) (*KeyExc
 	signature := pq.sigScheme.Sign(pq.identitySigPrivateKey, signData, nil)
 	keyExchange.Signature = signature
 
-	// store the shared secret
+	// store the shared secret, keeping the old one for messages in flight
 	pq.peersMutex.Lock()
+	peer.retain(peer.CurrentSharedSecret, peer.LastKeyRotation)
 	peer.CurrentSharedSecret = sharedSecret
 	peer.LastKeyRotation = now
 	peer.LastMessageTime = now
@@ -366,15 +467,13 @@ func (pq *PQCrypto) ProcessKeyExchange(keyExchange *KeyExchangeMessage) error {
 		return fmt.Errorf("invalid ciphertext size: expected %d, got %d", expectedSize, actualSize)
 	}
 
-	// First try with our identity private key (legacy)
-	sharedSecret, err := pq.kemScheme.Decapsulate(pq.identityKEMPrivateKey, keyExchange.KEMCiphertext)
+	privateKey, err := pq.kemPrivateKeyFor(keyExchange.RecipientKeyID)
 	if err != nil {
-		// If that fails, attempt with our *current ephemeral* private key – this allows peers
-		// to encapsulate to our short-lived key for stronger forward secrecy.
-		sharedSecret, err = pq.kemScheme.Decapsulate(pq.ephemeralKEMPrivateKey, keyExchange.KEMCiphertext)
-		if err != nil {
-			return fmt.Errorf("failed to decapsulate: %w", err)
-		}
+		return err
+	}
+	sharedSecret, err := pq.kemScheme.Decapsulate(privateKey, keyExchange.KEMCiphertext)
+	if err != nil {
+		return fmt.Errorf("failed to decapsulate: %w", err)
 	}
 
 	// use sender's timestamp as the agreed key rotation epoch
@@ -390,15 +489,18 @@ func (pq *PQCrypto) ProcessKeyExchange(keyExchange *KeyExchangeMessage) error {
 	if peer, exists := pq.peers[keyExchange.SenderID]; exists {
 		// update stored peer data
 		peer.EphemeralKEMPublicKey = keyExchange.EphemeralKEMPubKey
+		if rotationTime.After(peer.lastPeerKeyExchange) {
+			peer.lastPeerKeyExchange = rotationTime
+		}
 		// only update if this is a newer key rotation or we have no secret yet
 		if len(peer.CurrentSharedSecret) == 0 || rotationTime.After(peer.LastKeyRotation) {
 			// keep previous secret for messages in flight
-			peer.PreviousSharedSecret = peer.CurrentSharedSecret
+			peer.retain(peer.CurrentSharedSecret, peer.LastKeyRotation)
 			peer.CurrentSharedSecret = sharedSecret
 			peer.LastKeyRotation = rotationTime
 		} else if rotationTime.Before(peer.LastKeyRotation) {
 			// older epoch - keep as previous secret for compatibility
-			peer.PreviousSharedSecret = sharedSecret
+			peer.retain(sharedSecret, rotationTime)
 		}
 		peer.Verified = true
 	} else {
@@ -412,29 +514,96 @@ func (pq *PQCrypto) ProcessKeyExchange(keyExchange *KeyExchangeMessage) error {
 			LastKeyRotation:       rotationTime,
 			LastMessageTime:       time.Now(),
 			Verified:              true,
+			lastPeerKeyExchange:   rotationTime,
 		}
 	}
 
 	return nil
 }
 
+// kemPrivateKeyFor returns our KEM private key matching a key ID from a key
+// exchange: the identity key for legacy messages without an ID, otherwise the
+// current or a recent ephemeral key
+func (pq *PQCrypto) kemPrivateKeyFor(keyID []byte) (kem.PrivateKey, error) {
+	if len(keyID) == 0 {
+		return pq.identityKEMPrivateKey, nil
+	}
+
+	pq.ephemeralMutex.RLock()
+	candidates := append([]kemKeyPair{
+		{pq.identityKEMPublicKey, pq.identityKEMPrivateKey},
+		{pq.ephemeralKEMPublicKey, pq.ephemeralKEMPrivateKey},
+	}, pq.previousEphemeral...)
+	pq.ephemeralMutex.RUnlock()
+
+	for _, c := range candidates {
+		if c.pub == nil {
+			continue
+		}
+		pubBytes, err := c.pub.MarshalBinary()
+		if err != nil {
+			continue
+		}
+		if hmac.Equal(kemKeyID(pubBytes), keyID) {
+			return c.priv, nil
+		}
+	}
+	return nil, fmt.Errorf("%w: encapsulated to an unknown key", ErrInvalidHandshake)
+}
+
+// kemKeyID is a short identifier of a KEM public key
+func kemKeyID(pubKey []byte) []byte {
+	sum := sha256.Sum256(pubKey)
+	return sum[:8]
+}
+
 // EncryptMessageForPeer encrypts a message for a specific peer
 func (pq *PQCrypto) EncryptMessageForPeer(message, peerID, senderID string) (*EncryptedMessage, error) {
-	pq.peersMutex.RLock()
-	peer, exists := pq.peers[peerID]
-	pq.peersMutex.RUnlock()
+	return pq.encryptForPeer(message, generateMessageID(), peerID, senderID, true)
+}
+
+// EncryptMessageWithID encrypts a message for a specific peer under a given
+// message ID, the same for every recipient and every attempt to send it, so
+// the receiver can drop copies
+func (pq *PQCrypto) EncryptMessageWithID(message, messageID, peerID, senderID string) (*EncryptedMessage, error) {
+	return pq.encryptForPeer(message, messageID, peerID, senderID, true)
+}
 
+// EncryptOutOfBandForPeer encrypts a message that travels outside the chat
+// order, e.g. the header of a media stream. It carries no sequence number,
+// so it leaves no gap in the numbering of chat messages.
+func (pq *PQCrypto) EncryptOutOfBandForPeer(message, peerID, senderID string) (*EncryptedMessage, error) {
+	return pq.encryptForPeer(message, generateMessageID(), peerID, senderID, false)
+}
+
+func (pq *PQCrypto) encryptForPeer(message, messageID, peerID, senderID string, numbered bool) (*EncryptedMessage, error) {
+	// snapshot the key material and take the next sequence number
+	pq.peersMutex.Lock()
+	peer, exists := pq.peers[peerID]
 	if !exists || len(peer.CurrentSharedSecret) == 0 {
+		pq.peersMutex.Unlock()
 		return nil, ErrPeerNotFound
 	}
+	sharedSecret := peer.CurrentSharedSecret
+	epoch := uint64(peer.LastKeyRotation.Unix())
+	var sequence, sequenceEpoch uint64
+	if numbered {
+		if peer.SendSequence == 0 {
+			peer.SendSequenceEpoch = uint64(time.Now().UnixNano())
+		}
+		peer.SendSequence++
+		sequence, sequenceEpoch = peer.SendSequence, peer.SendSequenceEpoch
+	}
+	pq.peersMutex.Unlock()
 
 	// create message payload
-	messageID := generateMessageID()
 	payload := MessagePayload{
-		Timestamp: time.Now(),
-		Message:   message,
-		SenderID:  senderID,
-		MessageID: messageID,
+		Timestamp:     time.Now(),
+		Message:       message,
+		SenderID:      senderID,
+		MessageID:     messageID,
+		Sequence:      sequence,
+		SequenceEpoch: sequenceEpoch,
 	}
 
 	// serialize payload
@@ -456,12 +625,12 @@ func (pq *PQCrypto) EncryptMessageForPeer(message, peerID, senderID string) (*En
 		SenderID:         senderID,
 		RecipientID:      peerID,
 		Timestamp:        time.Now(),
-		KeyRotationEpoch: uint64(peer.LastKeyRotation.Unix()),
+		KeyRotationEpoch: epoch,
 		Salt:             salt,
 	}
 
 	// derive encryption key from shared secret
-	encKey, err := deriveKeyWithSalt(peer.CurrentSharedSecret, salt, "message_encryption", 32)
+	encKey, err := deriveKeyWithSalt(sharedSecret, salt, "message_encryption", 32)
 	if err != nil {
 		return nil, err
 	}
@@ -521,20 +690,90 @@ func (pq *PQCrypto) DecryptMessageFromPeer(encMsg *EncryptedMessage) (*MessagePa
 		return nil, ErrInvalidSignature
 	}
 
-	// choose the right shared secret based on key rotation epoch
-	var sharedSecret []byte
-	currentEpoch := uint64(peer.LastKeyRotation.Unix())
-
-	if encMsg.KeyRotationEpoch == currentEpoch {
-		sharedSecret = peer.CurrentSharedSecret
-	} else if len(peer.PreviousSharedSecret) > 0 {
-		sharedSecret = peer.PreviousSharedSecret
-	} else {
+	// pick candidate secrets: the one whose epoch matches first, then the other.
+	// Epochs have one-second resolution, so two rotations within the same
+	// second can only be told apart by trying both.
+	secrets, inFlight := pq.candidateSecrets(peer, encMsg.KeyRotationEpoch)
+	if len(secrets) == 0 {
+		if inFlight {
+			return nil, ErrRotationInFlight
+		}
 		return nil, ErrDecryptionFailed
 	}
 
+	aad, err := getAADForEncryptedHeader(encMsg)
+	if err != nil {
+		return nil, err
+	}
+
+	var payloadBytes []byte
+	for _, sharedSecret := range secrets {
+		payloadBytes, err = openPayload(sharedSecret, encMsg, aad)
+		if err == nil {
+			break
+		}
+	}
+	if err != nil {
+		if errors.Is(err, ErrDecryptionFailed) && inFlight {
+			return nil, ErrRotationInFlight
+		}
+		return nil, err
+	}
+
+	// deserialize payload
+	payload, err := DeserializePayload(payloadBytes)
+	if err != nil {
+		return nil, err
+	}
+
+	// update peer's last message time
+	pq.peersMutex.Lock()
+	peer.LastMessageTime = time.Now()
+	pq.peersMutex.Unlock()
+
+	return payload, nil
+}
+
+// candidateSecrets returns the shared secrets that may decrypt a message with
+// the given epoch (best match first), and whether a key for that epoch may
+// still be on its way: the epoch is no older than the newest we know, or
+// than the peer's newest key exchange. Epochs are whole seconds, so keys of
+// rotations within one second, e.g. both sides rotating at once, share one;
+// a key exchange of that second may still come.
+func (pq *PQCrypto) candidateSecrets(peer *PeerCryptoState, epoch uint64) ([][]byte, bool) {
+	pq.peersMutex.RLock()
+	defer pq.peersMutex.RUnlock()
+
+	var newestEpoch uint64
+	var matching, other [][]byte
+	add := func(secret []byte, rotation time.Time) {
+		if len(secret) == 0 {
+			return
+		}
+		secretEpoch := uint64(rotation.Unix())
+		if secretEpoch > newestEpoch {
+			newestEpoch = secretEpoch
+		}
+		if secretEpoch == epoch {
+			matching = append(matching, secret)
+		} else {
+			other = append(other, secret)
+		}
+	}
+	add(peer.CurrentSharedSecret, peer.LastKeyRotation)
+	for _, retained := range peer.PreviousSecrets {
+		add(retained.Secret, retained.Epoch)
+	}
+
+	inFlight := epoch >= newestEpoch || epoch >= uint64(peer.lastPeerKeyExchange.Unix())
+	return append(matching, other...), inFlight
+}
+
+// openPayload decrypts the message payload with one shared secret
+func openPayload(sharedSecret []byte, encMsg *EncryptedMessage, aad []byte) ([]byte, error) {
 	// derive decryption key
 	var decKey []byte
+	var err error
 	if len(encMsg.Salt) > 0 {
 		decKey, err = deriveKeyWithSalt(sharedSecret, encMsg.Salt, "message_encryption", 32)
 	} else {
@@ -558,42 +797,51 @@ func (pq *PQCrypto) DecryptMessageFromPeer(encMsg *EncryptedMessage) (*MessagePa
 	nonce := encMsg.EncryptedPayload[:cipher.NonceSize()]
 	ciphertext := encMsg.EncryptedPayload[cipher.NonceSize():]
 
-	// decrypt payload
-	aad, err := getAADForEncryptedHeader(encMsg)
-	if err != nil {
-		return nil, err
-	}
 	payloadBytes, err := cipher.Open(nil, nonce, ciphertext, aad)
 	if err != nil {
 		return nil, ErrDecryptionFailed
 	}
+	return payloadBytes, nil
+}
 
-	// deserialize payload
-	payload, err := DeserializePayload(payloadBytes)
-	if err != nil {
-		return nil, err
-	}
+// SetKeyRotationInterval changes how often RotateKeys actually rotates.
+// A zero interval makes every call rotate.
+func (pq *PQCrypto) SetKeyRotationInterval(interval time.Duration) {
+	pq.keyRotationInterval = interval
+}
 
-	// update peer's last message time
-	pq.peersMutex.Lock()
-	peer.LastMessageTime = time.Now()
-	pq.peersMutex.Unlock()
+// SetClock makes the rotation schedule follow c, e.g. a test's fake clock.
+// Timestamps sent to peers keep the wall clock.
+func (pq *PQCrypto) SetClock(c clock.Clock) {
+	pq.rotationClock = c
+	pq.lastKeyRotation = c.Now()
+}
 
-	return payload, nil
+func (pq *PQCrypto) rotationNow() time.Time {
+	if pq.rotationClock == nil {
+		return time.Now()
+	}
+	return pq.rotationClock.Now()
 }
 
 // RotateKeys rotates the cryptographic material for forward secrecy.
 // It returns a boolean that is true when a rotation was performed
 // and false if the rotation interval has not yet elapsed.
 func (pq *PQCrypto) RotateKeys() (bool, error) {
-	now := time.Now()
-	if now.Sub(pq.lastKeyRotation) < pq.keyRotationInterval {
+	if pq.rotationNow().Sub(pq.lastKeyRotation) < pq.keyRotationInterval {
 		return false, nil // rotation not due yet
 	}
+	return true, pq.RotateKeysNow()
+}
+
+// RotateKeysNow rotates the cryptographic material regardless of the
+// rotation interval, e.g. when a peer has left
+func (pq *PQCrypto) RotateKeysNow() error {
+	now := pq.rotationNow()
 
 	// generate new ephemeral keys
 	if err := pq.generateEphemeralKeyPairs(); err != nil {
-		return false, ErrKeyRotationFailed
+		return ErrKeyRotationFailed
 	}
 
 	pq.peersMutex.Lock()
@@ -602,16 +850,35 @@ func (pq *PQCrypto) RotateKeys() (bool, error) {
 	// for each peer, rotate their keys
 	for _, peer := range pq.peers {
 		// move current to previous
-		peer.PreviousSharedSecret = peer.CurrentSharedSecret
+		peer.retain(peer.CurrentSharedSecret, peer.LastKeyRotation)
 		// clear current (will be re-established through new key exchange)
 		peer.CurrentSharedSecret = nil
 	}
 
 	pq.lastKeyRotation = now
-	return true, nil
+	return nil
+}
+
+// EndPeerSession wipes every shared secret with a peer that left, including
+// the ones kept for messages in flight. Its identity stays known; a new
+// key exchange is needed before anything is exchanged with it again.
+// Reports whether there was a session to end.
+func (pq *PQCrypto) EndPeerSession(peerID string) bool {
+	pq.peersMutex.Lock()
+	defer pq.peersMutex.Unlock()
+
+	peer, exists := pq.peers[peerID]
+	if !exists || (len(peer.CurrentSharedSecret) == 0 && len(peer.PreviousSecrets) == 0) {
+		return false
+	}
+	peer.CurrentSharedSecret = nil
+	peer.PreviousSecrets = nil
+	return true
 }
 
-// GetVerifiedPeers returns verified peer IDs
+// GetVerifiedPeers returns the peers whose announcement signature checked
+// out and with whom a key exchange completed. This is not human
+// verification; see trust.StateUserVerified.
 func (pq *PQCrypto) GetVerifiedPeers() []string {
 	pq.peersMutex.RLock()
 	defer pq.peersMutex.RUnlock()
@@ -625,6 +892,15 @@ func (pq *PQCrypto) GetVerifiedPeers() []string {
 	return peers
 }
 
+// HasSession reports whether a shared secret with the peer is established
+func (pq *PQCrypto) HasSession(peerID string) bool {
+	pq.peersMutex.RLock()
+	defer pq.peersMutex.RUnlock()
+
+	peer, exists := pq.peers[peerID]
+	return exists && peer.Verified && len(peer.CurrentSharedSecret) > 0
+}
+
 // GetPeerFingerprint returns the trust fingerprint for a peer
 func (pq *PQCrypto) GetPeerFingerprint(peerID string) (string, error) {
 	pq.peersMutex.RLock()
@@ -640,13 +916,18 @@ func (pq *PQCrypto) GetPeerFingerprint(peerID string) (string, error) {
 func (pq *PQCrypto) GetIdentityFingerprint() (string, error) {
 	kemPubBytes, _ := pq.identityKEMPublicKey.MarshalBinary()
 	sigPubBytes, _ := pq.identitySigPublicKey.MarshalBinary()
+	return ComputeFingerprint(kemPubBytes, sigPubBytes), nil
+}
 
+// ComputeFingerprint derives the identity fingerprint from the identity
+// public keys: the first 16 bytes of SHA-256(KEM key || signature key), hex-encoded
+func ComputeFingerprint(kemPub, sigPub []byte) string {
 	hash := sha256.New()
-	hash.Write(kemPubBytes)
-	hash.Write(sigPubBytes)
+	hash.Write(kemPub)
+	hash.Write(sigPub)
 
 	fingerprint := hash.Sum(nil)
-	return hex.EncodeToString(fingerprint[:16]), nil // first 16 bytes as hex
+	return hex.EncodeToString(fingerprint[:16]) // first 16 bytes as hex
 }
 
 // serialize announcement for signing (without signature field)
@@ -701,6 +982,11 @@ func deriveKeyWithSalt(sharedSecret []byte, salt []byte, info string, length int
 	return key, nil
 }
 
+// NewMessageID returns a fresh message ID
+func NewMessageID() string {
+	return generateMessageID()
+}
+
 // generate a unique message ID
 func generateMessageID() string {
 	bytes := make([]byte, 16)
@@ -0,0 +1,95 @@
+package crypto
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+)
+
+// MessageTypeProfile marks a signed user profile
+const MessageTypeProfile = 8
+
+// Profile is what a user shows about themselves: nickname, the hash of an
+// avatar image and a short status text. It is signed with the identity key,
+// so nobody else can put words or a face under that identity.
+type Profile struct {
+	Version     uint8  `json:"version"`
+	Type        uint8  `json:"type"`
+	PeerID      string `json:"peer_id"`
+	Fingerprint string `json:"fingerprint"`
+	Nickname    string `json:"nickname"`
+	// SHA-256 of the avatar image, hex; empty for none
+	AvatarHash string    `json:"avatar_hash,omitempty"`
+	Status     string    `json:"status,omitempty"`
+	UpdatedAt  time.Time `json:"updated_at"`
+	Signature  []byte    `json:"signature"`
+}
+
+// CreateProfile signs a profile for our identity
+func (pq *PQCrypto) CreateProfile(peerID, nickname, avatarHash, status string) (*Profile, error) {
+	fingerprint, err := pq.GetIdentityFingerprint()
+	if err != nil {
+		return nil, err
+	}
+	profile := &Profile{
+		Version:     1,
+		Type:        MessageTypeProfile,
+		PeerID:      peerID,
+		Fingerprint: fingerprint,
+		Nickname:    nickname,
+		AvatarHash:  avatarHash,
+		Status:      status,
+		UpdatedAt:   time.Now(),
+	}
+
+	signData, err := getSignableDataForProfile(profile)
+	if err != nil {
+		return nil, fmt.Errorf("failed to serialize profile for signing: %w", err)
+	}
+	profile.Signature = pq.sigScheme.Sign(pq.identitySigPrivateKey, signData, nil)
+	return profile, nil
+}
+
+// VerifyProfile checks that the profile was signed by the announced identity
+// of the peer it names
+func (pq *PQCrypto) VerifyProfile(profile *Profile) error {
+	if profile.Type != MessageTypeProfile {
+		return fmt.Errorf("%w: not a profile", ErrInvalidHandshake)
+	}
+	pq.peersMutex.RLock()
+	peer, exists := pq.peers[profile.PeerID]
+	var sigPubBytes []byte
+	var fingerprint string
+	if exists {
+		sigPubBytes = peer.IdentitySigPublicKey
+		fingerprint = peer.TrustFingerprint
+	}
+	pq.peersMutex.RUnlock()
+
+	if !exists {
+		return ErrPeerNotFound
+	}
+	if profile.Fingerprint != fingerprint {
+		return fmt.Errorf("%w: profile names a different identity", ErrInvalidHandshake)
+	}
+
+	sigPub, err := pq.sigScheme.UnmarshalBinaryPublicKey(sigPubBytes)
+	if err != nil {
+		return ErrInvalidKeySize
+	}
+	signData, err := getSignableDataForProfile(profile)
+	if err != nil {
+		return fmt.Errorf("failed to serialize profile for verification: %w", err)
+	}
+	if !pq.sigScheme.Verify(sigPub, signData, profile.Signature, nil) {
+		return ErrInvalidSignature
+	}
+	return nil
+}
+
+// serialize profile for signing (without signature field)
+func getSignableDataForProfile(profile *Profile) ([]byte, error) {
+	profileToSign := *profile
+	profileToSign.Signature = nil
+	return json.Marshal(&profileToSign)
+}
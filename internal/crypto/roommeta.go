@@ -0,0 +1,124 @@
+package crypto
+
+import (
+	"fmt"
+	"time"
+)
+
+// MessageTypeRoomMetadata marks a signed room metadata record
+const MessageTypeRoomMetadata = 5
+
+// RoomMetadata is a statement by the room host about the room, signed with
+// the host's identity key so guests can attribute it. It carries the
+// room's name, the archiving label (whether the host exports decrypted
+// traffic), the incognito flag (nothing about the room may be written to
+// disk), the room's custom shortcodes and the roles the host granted.
+type RoomMetadata struct {
+	Version         uint8           `json:"version"`
+	Type            uint8           `json:"type"`
+	RoomID          string          `json:"room_id"`
+	HostID          string          `json:"host_id"`
+	HostFingerprint string          `json:"host_fingerprint"`
+	Name            string          `json:"name,omitempty"`
+	Incognito       bool            `json:"incognito,omitempty"`
+	Archiving       bool            `json:"archiving"`
+	ArchiveSinks    []string        `json:"archive_sinks,omitempty"` // "file", "socket", "xmpp"
+	ArchivingSince  time.Time       `json:"archiving_since,omitempty"`
+	Shortcodes      []RoomShortcode `json:"shortcodes,omitempty"`
+	Roles           []RoleGrant     `json:"roles,omitempty"` // besides the host's own, see role.go
+	Timestamp       time.Time       `json:"timestamp"`
+	Signature       []byte          `json:"signature"`
+}
+
+// RoomShortcode maps a custom :shortcode: to an image, identified by the
+// SHA-256 of its content so every participant renders the same picture
+type RoomShortcode struct {
+	Code string `json:"code"`
+	Hash string `json:"hash"`
+	MIME string `json:"mime"`
+	Size int    `json:"size"`
+}
+
+// RoomMetadataOptions is what the host states about its room
+type RoomMetadataOptions struct {
+	Name           string
+	Incognito      bool
+	ArchiveSinks   []string
+	ArchivingSince time.Time
+	Shortcodes     []RoomShortcode
+	Roles          []RoleGrant
+}
+
+// CreateRoomMetadata builds and signs a room metadata record
+func (pq *PQCrypto) CreateRoomMetadata(roomID, hostID string, opts RoomMetadataOptions) (*RoomMetadata, error) {
+	fingerprint, err := pq.GetIdentityFingerprint()
+	if err != nil {
+		return nil, err
+	}
+
+	meta := &RoomMetadata{
+		Version:         1,
+		Type:            MessageTypeRoomMetadata,
+		RoomID:          roomID,
+		HostID:          hostID,
+		HostFingerprint: fingerprint,
+		Name:            opts.Name,
+		Incognito:       opts.Incognito,
+		Archiving:       len(opts.ArchiveSinks) > 0,
+		ArchiveSinks:    opts.ArchiveSinks,
+		Shortcodes:      opts.Shortcodes,
+		Roles:           opts.Roles,
+		Timestamp:       time.Now(),
+	}
+	if meta.Archiving {
+		meta.ArchivingSince = opts.ArchivingSince
+	}
+
+	signData, err := getSignableDataForRoomMetadata(meta)
+	if err != nil {
+		return nil, fmt.Errorf("failed to serialize room metadata for signing: %w", err)
+	}
+	meta.Signature = pq.sigScheme.Sign(pq.identitySigPrivateKey, signData, nil)
+	return meta, nil
+}
+
+// VerifyRoomMetadata checks that the record was signed by the announced
+// identity of its host
+func (pq *PQCrypto) VerifyRoomMetadata(meta *RoomMetadata) error {
+	pq.peersMutex.RLock()
+	peer, exists := pq.peers[meta.HostID]
+	var sigPubBytes []byte
+	var fingerprint string
+	if exists {
+		sigPubBytes = peer.IdentitySigPublicKey
+		fingerprint = peer.TrustFingerprint
+	}
+	pq.peersMutex.RUnlock()
+
+	if !exists {
+		return ErrPeerNotFound
+	}
+	if meta.HostFingerprint != fingerprint {
+		return fmt.Errorf("%w: room metadata names a different host identity", ErrInvalidHandshake)
+	}
+
+	sigPub, err := pq.sigScheme.UnmarshalBinaryPublicKey(sigPubBytes)
+	if err != nil {
+		return ErrInvalidKeySize
+	}
+	signData, err := getSignableDataForRoomMetadata(meta)
+	if err != nil {
+		return fmt.Errorf("failed to serialize room metadata for verification: %w", err)
+	}
+	if !pq.sigScheme.Verify(sigPub, signData, meta.Signature, nil) {
+		return ErrInvalidSignature
+	}
+	return nil
+}
+
+// serialize room metadata for signing (without signature field)
+func getSignableDataForRoomMetadata(meta *RoomMetadata) ([]byte, error) {
+	metaToSign := *meta
+	metaToSign.Signature = nil
+	return SerializeRoomMetadata(&metaToSign)
+}
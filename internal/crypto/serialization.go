@@ -1,7 +1,11 @@
 package crypto
 
+//go:generate go run execp2p/internal/wire/wiregen -schema ../wire/frames.cddl
+
 import (
 	"encoding/json"
+
+	"execp2p/internal/wire"
 )
 
 // SerializePayload converts a MessagePayload to bytes
@@ -24,10 +28,12 @@ func SerializeEncryptedMessage(msg *EncryptedMessage) ([]byte, error) {
 	return json.Marshal(msg)
 }
 
-// DeserializeEncryptedMessage converts bytes back to an EncryptedMessage
+// DeserializeEncryptedMessage converts bytes back to an EncryptedMessage,
+// from JSON or CBOR (internal/wire); the Serialize functions write the JSON
+// that signatures cover
 func DeserializeEncryptedMessage(data []byte) (*EncryptedMessage, error) {
 	var msg EncryptedMessage
-	err := json.Unmarshal(data, &msg)
+	err := wire.Unmarshal(data, &msg)
 	if err != nil {
 		return nil, err
 	}
@@ -42,7 +48,7 @@ func SerializePeerAnnouncement(announcement *PeerAnnouncement) ([]byte, error) {
 // DeserializePeerAnnouncement converts bytes back to a PeerAnnouncement
 func DeserializePeerAnnouncement(data []byte) (*PeerAnnouncement, error) {
 	var announcement PeerAnnouncement
-	err := json.Unmarshal(data, &announcement)
+	err := wire.Unmarshal(data, &announcement)
 	if err != nil {
 		return nil, err
 	}
@@ -57,9 +63,24 @@ func SerializeKeyExchange(keyExchange *KeyExchangeMessage) ([]byte, error) {
 // DeserializeKeyExchange converts bytes back to a KeyExchangeMessage
 func DeserializeKeyExchange(data []byte) (*KeyExchangeMessage, error) {
 	var keyExchange KeyExchangeMessage
-	err := json.Unmarshal(data, &keyExchange)
+	err := wire.Unmarshal(data, &keyExchange)
 	if err != nil {
 		return nil, err
 	}
 	return &keyExchange, nil
 }
+
+// SerializeRoomMetadata converts a RoomMetadata to bytes
+func SerializeRoomMetadata(meta *RoomMetadata) ([]byte, error) {
+	return json.Marshal(meta)
+}
+
+// DeserializeRoomMetadata converts bytes back to a RoomMetadata
+func DeserializeRoomMetadata(data []byte) (*RoomMetadata, error) {
+	var meta RoomMetadata
+	err := wire.Unmarshal(data, &meta)
+	if err != nil {
+		return nil, err
+	}
+	return &meta, nil
+}
@@ -0,0 +1,251 @@
+package crypto
+
+import (
+	"bufio"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+
+	"golang.org/x/crypto/chacha20poly1305"
+)
+
+// Attachments are encrypted with the STREAM construction (Hoang, Reyhanitabar,
+// Rogaway, Vizár), like age: the plaintext is cut into chunks of
+// StreamChunkSize, each sealed with ChaCha20-Poly1305 under a per-stream key.
+// The nonce is the chunk counter plus a flag marking the last chunk, so
+// chunks can't be reordered, dropped or repeated and a stream cut at a chunk
+// boundary is detected. Neither side ever holds more than one chunk.
+//
+// Stream layout: version (1 byte) || salt (16 bytes) || sealed chunks.
+// Every chunk but the last holds exactly StreamChunkSize bytes of plaintext.
+
+const (
+	// StreamChunkSize is the plaintext size of a full chunk
+	StreamChunkSize = 64 << 10
+
+	streamVersion  = 1
+	streamSaltSize = 16
+	streamInfo     = "execp2p-stream-v1"
+	streamOverhead = chacha20poly1305.Overhead
+	// counter (11 bytes) || last-chunk flag (1 byte)
+	streamLastFlag = 1
+)
+
+var (
+	// ErrStreamTruncated means the stream ended before its last chunk
+	ErrStreamTruncated = errors.New("encrypted stream truncated")
+	// ErrStreamCorrupt means a chunk failed authentication or the stream is malformed
+	ErrStreamCorrupt = errors.New("encrypted stream corrupt")
+)
+
+// NewStreamKey returns a random key for EncryptStream
+func NewStreamKey() ([]byte, error) {
+	key := make([]byte, chacha20poly1305.KeySize)
+	if _, err := rand.Read(key); err != nil {
+		return nil, err
+	}
+	return key, nil
+}
+
+// StreamCiphertextSize returns the encrypted size of a plaintext of n bytes
+func StreamCiphertextSize(n int64) int64 {
+	chunks := n / StreamChunkSize
+	if n%StreamChunkSize != 0 || n == 0 {
+		chunks++
+	}
+	return 1 + streamSaltSize + n + chunks*streamOverhead
+}
+
+type streamNonce [chacha20poly1305.NonceSize]byte
+
+func (n *streamNonce) set(counter uint64, last bool) {
+	*n = streamNonce{}
+	binary.BigEndian.PutUint64(n[3:11], counter)
+	if last {
+		n[11] = streamLastFlag
+	}
+}
+
+func streamAEAD(key, salt []byte) (cipher.AEAD, error) {
+	if len(key) != chacha20poly1305.KeySize {
+		return nil, ErrInvalidKeySize
+	}
+	streamKey, err := deriveKeyWithSalt(key, salt, streamInfo, chacha20poly1305.KeySize)
+	if err != nil {
+		return nil, err
+	}
+	return chacha20poly1305.New(streamKey)
+}
+
+// streamWriter seals chunks as they fill up
+type streamWriter struct {
+	dst     io.Writer
+	aead    cipher.AEAD
+	aad     []byte
+	buf     []byte
+	out     []byte
+	counter uint64
+	nonce   streamNonce
+	closed  bool
+}
+
+// EncryptStream returns a writer that encrypts everything written to it
+// into dst. aad (e.g. a transfer ID and content type) is bound to every
+// chunk and must be given again to decrypt. Close writes the last chunk and
+// must be called; it does not close dst.
+func EncryptStream(dst io.Writer, key, aad []byte) (io.WriteCloser, error) {
+	salt := make([]byte, streamSaltSize)
+	if _, err := rand.Read(salt); err != nil {
+		return nil, err
+	}
+	aead, err := streamAEAD(key, salt)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := dst.Write(append([]byte{streamVersion}, salt...)); err != nil {
+		return nil, err
+	}
+	return &streamWriter{
+		dst:  dst,
+		aead: aead,
+		aad:  aad,
+		buf:  make([]byte, 0, StreamChunkSize),
+		out:  make([]byte, 0, StreamChunkSize+streamOverhead),
+	}, nil
+}
+
+func (w *streamWriter) Write(p []byte) (int, error) {
+	if w.closed {
+		return 0, fmt.Errorf("write to closed encrypted stream")
+	}
+	written := 0
+	for len(p) > 0 {
+		// a full chunk is only sealed once more data shows it isn't the last
+		if len(w.buf) == StreamChunkSize {
+			if err := w.seal(false); err != nil {
+				return written, err
+			}
+		}
+		n := copy(w.buf[len(w.buf):StreamChunkSize], p)
+		w.buf = w.buf[:len(w.buf)+n]
+		p = p[n:]
+		written += n
+	}
+	return written, nil
+}
+
+// Close seals the last chunk
+func (w *streamWriter) Close() error {
+	if w.closed {
+		return nil
+	}
+	w.closed = true
+	return w.seal(true)
+}
+
+func (w *streamWriter) seal(last bool) error {
+	w.nonce.set(w.counter, last)
+	w.out = w.aead.Seal(w.out[:0], w.nonce[:], w.buf, w.aad)
+	w.buf = w.buf[:0]
+	w.counter++
+	_, err := w.dst.Write(w.out)
+	return err
+}
+
+// streamReader opens chunks as they are read
+type streamReader struct {
+	src     *bufio.Reader
+	aead    cipher.AEAD
+	aad     []byte
+	in      []byte
+	out     []byte
+	plain   []byte
+	counter uint64
+	nonce   streamNonce
+	done    bool
+	err     error
+}
+
+// DecryptStream returns a reader of the plaintext of an EncryptStream
+// stream. Data is only returned once its chunk has been authenticated; a
+// stream that was cut short ends with ErrStreamTruncated instead of io.EOF.
+func DecryptStream(src io.Reader, key, aad []byte) (io.Reader, error) {
+	header := make([]byte, 1+streamSaltSize)
+	if _, err := io.ReadFull(src, header); err != nil {
+		return nil, ErrStreamTruncated
+	}
+	if header[0] != streamVersion {
+		return nil, fmt.Errorf("%w: unknown version %d", ErrStreamCorrupt, header[0])
+	}
+	aead, err := streamAEAD(key, header[1:])
+	if err != nil {
+		return nil, err
+	}
+	return &streamReader{
+		src:  bufio.NewReaderSize(src, StreamChunkSize+streamOverhead),
+		aead: aead,
+		aad:  aad,
+		in:   make([]byte, StreamChunkSize+streamOverhead),
+		out:  make([]byte, 0, StreamChunkSize),
+	}, nil
+}
+
+func (r *streamReader) Read(p []byte) (int, error) {
+	for len(r.plain) == 0 {
+		if r.err != nil {
+			return 0, r.err
+		}
+		if r.done {
+			return 0, io.EOF
+		}
+		r.err = r.next()
+	}
+	n := copy(p, r.plain)
+	r.plain = r.plain[n:]
+	return n, nil
+}
+
+// next reads and opens one chunk
+func (r *streamReader) next() error {
+	n, err := io.ReadFull(r.src, r.in)
+	last := false
+	switch {
+	case err == io.ErrUnexpectedEOF || err == io.EOF:
+		// a short chunk can only be the last one
+		last = true
+	case err != nil:
+		return err
+	default:
+		// a full chunk is the last one if nothing follows it
+		if _, err := r.src.Peek(1); err == io.EOF {
+			last = true
+		}
+	}
+	if n < streamOverhead {
+		return ErrStreamTruncated
+	}
+
+	r.nonce.set(r.counter, last)
+	// not in place: a failed Open wipes its output
+	plain, err := r.aead.Open(r.out[:0], r.nonce[:], r.in[:n], r.aad)
+	if err != nil {
+		if last {
+			// the stream ended after a chunk that wasn't sealed as the last one
+			r.nonce.set(r.counter, false)
+			if _, err := r.aead.Open(r.out[:0], r.nonce[:], r.in[:n], r.aad); err == nil {
+				return ErrStreamTruncated
+			}
+		}
+		return ErrStreamCorrupt
+	}
+	if !last && len(plain) != StreamChunkSize {
+		return ErrStreamCorrupt
+	}
+	r.counter++
+	r.plain = plain
+	r.done = last
+	return nil
+}
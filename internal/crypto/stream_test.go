@@ -0,0 +1,99 @@
+package crypto
+
+import (
+	"bytes"
+	"crypto/rand"
+	"errors"
+	"io"
+	"testing"
+)
+
+func encryptStream(t *testing.T, key, aad, plaintext []byte) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	w, err := EncryptStream(&buf, key, aad)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// odd writes cross chunk boundaries
+	for p := plaintext; len(p) > 0; {
+		n := min(len(p), 1000)
+		if _, err := w.Write(p[:n]); err != nil {
+			t.Fatal(err)
+		}
+		p = p[n:]
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func decryptStream(key, aad, ciphertext []byte) ([]byte, error) {
+	r, err := DecryptStream(bytes.NewReader(ciphertext), key, aad)
+	if err != nil {
+		return nil, err
+	}
+	return io.ReadAll(r)
+}
+
+func TestStream(t *testing.T) {
+	key, err := NewStreamKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, n := range []int{0, 1, StreamChunkSize - 1, StreamChunkSize, StreamChunkSize + 1, 3*StreamChunkSize + 17} {
+		plaintext := make([]byte, n)
+		rand.Read(plaintext)
+		ciphertext := encryptStream(t, key, []byte("aad"), plaintext)
+		if int64(len(ciphertext)) != StreamCiphertextSize(int64(n)) {
+			t.Errorf("%d bytes: ciphertext of %d, StreamCiphertextSize %d", n, len(ciphertext), StreamCiphertextSize(int64(n)))
+		}
+		got, err := decryptStream(key, []byte("aad"), ciphertext)
+		if err != nil {
+			t.Fatalf("%d bytes: %v", n, err)
+		}
+		if !bytes.Equal(got, plaintext) {
+			t.Fatalf("%d bytes: plaintext differs", n)
+		}
+	}
+}
+
+func TestStreamTampered(t *testing.T) {
+	key, err := NewStreamKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	plaintext := make([]byte, 2*StreamChunkSize+5)
+	ciphertext := encryptStream(t, key, nil, plaintext)
+	chunk := StreamChunkSize + streamOverhead
+	header := 1 + streamSaltSize
+
+	flipped := bytes.Clone(ciphertext)
+	flipped[header+10] ^= 1
+	swapped := bytes.Clone(ciphertext)
+	copy(swapped[header:], ciphertext[header+chunk:header+2*chunk])
+	copy(swapped[header+chunk:], ciphertext[header:header+chunk])
+	otherKey, _ := NewStreamKey()
+
+	tests := []struct {
+		name       string
+		key, aad   []byte
+		ciphertext []byte
+		want       error
+	}{
+		{"flipped bit", key, nil, flipped, ErrStreamCorrupt},
+		{"swapped chunks", key, nil, swapped, ErrStreamCorrupt},
+		{"wrong key", otherKey, nil, ciphertext, ErrStreamCorrupt},
+		{"wrong aad", key, []byte("other"), ciphertext, ErrStreamCorrupt},
+		{"cut at a chunk", key, nil, ciphertext[:header+chunk], ErrStreamTruncated},
+		{"cut in a chunk", key, nil, ciphertext[:header+chunk+100], ErrStreamCorrupt},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := decryptStream(tt.key, tt.aad, tt.ciphertext); !errors.Is(err, tt.want) {
+				t.Fatalf("got %v, want %v", err, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,33 @@
+package crypto
+
+import "fmt"
+
+// tlsKeyContext separates signatures over the transport certificate's key
+// from other signatures made with the identity key
+var tlsKeyContext = []byte("execp2p-tls-key-v1")
+
+// SignTLSKey signs the public key of our transport certificate (its DER
+// SubjectPublicKeyInfo) with our identity, for the announcement
+func (pq *PQCrypto) SignTLSKey(publicKey []byte) []byte {
+	return pq.sigScheme.Sign(pq.identitySigPrivateKey, tlsKeyData(publicKey), nil)
+}
+
+// VerifyTLSKey checks that the identity of the announcement signed
+// publicKey, the key of the certificate the peer's connection presented
+func (pq *PQCrypto) VerifyTLSKey(announcement *PeerAnnouncement, publicKey []byte) error {
+	if len(announcement.TLSKeySignature) == 0 {
+		return fmt.Errorf("%w: announcement does not sign the TLS key", ErrInvalidHandshake)
+	}
+	sigPub, err := pq.sigScheme.UnmarshalBinaryPublicKey(announcement.IdentitySigPubKey)
+	if err != nil {
+		return ErrInvalidKeySize
+	}
+	if !pq.sigScheme.Verify(sigPub, tlsKeyData(publicKey), announcement.TLSKeySignature, nil) {
+		return ErrInvalidSignature
+	}
+	return nil
+}
+
+func tlsKeyData(publicKey []byte) []byte {
+	return append(append([]byte(nil), tlsKeyContext...), publicKey...)
+}
@@ -0,0 +1,660 @@
+// Code generated by wiregen from frames.cddl; DO NOT EDIT.
+
+package crypto
+
+import (
+	"execp2p/internal/wire"
+	"math"
+)
+
+// AppendCBOR appends the CBOR encoding of m (peer-announcement)
+func (m *PeerAnnouncement) AppendCBOR(b []byte) []byte {
+	n := 9
+	if len(m.TLSKeySignature) != 0 {
+		n++
+	}
+	if len(m.Nickname) != 0 {
+		n++
+	}
+	b = wire.AppendMapHeader(b, n)
+	b = wire.AppendUint(b, 1)
+	b = wire.AppendUint(b, uint64(m.Version))
+	b = wire.AppendUint(b, 2)
+	b = wire.AppendUint(b, uint64(m.Type))
+	b = wire.AppendUint(b, 3)
+	b = wire.AppendText(b, m.PeerID)
+	b = wire.AppendUint(b, 4)
+	b = wire.AppendBytes(b, m.IdentityKEMPubKey)
+	b = wire.AppendUint(b, 5)
+	b = wire.AppendBytes(b, m.IdentitySigPubKey)
+	b = wire.AppendUint(b, 6)
+	b = wire.AppendText(b, m.TrustFingerprint)
+	b = wire.AppendUint(b, 7)
+	b = wire.AppendText(b, m.TLSCertFingerprint)
+	if len(m.TLSKeySignature) != 0 {
+		b = wire.AppendUint(b, 8)
+		b = wire.AppendBytes(b, m.TLSKeySignature)
+	}
+	if len(m.Nickname) != 0 {
+		b = wire.AppendUint(b, 9)
+		b = wire.AppendText(b, m.Nickname)
+	}
+	b = wire.AppendUint(b, 10)
+	b = wire.AppendBytes(b, m.Signature)
+	b = wire.AppendUint(b, 11)
+	b = wire.AppendTime(b, m.Timestamp)
+	return b
+}
+
+// DecodeCBOR reads m from d (peer-announcement)
+func (m *PeerAnnouncement) DecodeCBOR(d *wire.Decoder) error {
+	n, err := d.MapHeader()
+	if err != nil {
+		return err
+	}
+	if err := d.Enter(); err != nil {
+		return err
+	}
+	defer d.Leave()
+	const required = 0xcfe
+	var seen uint64
+	last := int64(-1)
+	for i := 0; i < n; i++ {
+		key, err := d.MapKey(&last)
+		if err != nil {
+			return err
+		}
+		if key < 64 {
+			seen |= 1 << key
+		}
+		switch key {
+		case 1:
+			var v uint64
+			v, err = d.Uint(math.MaxUint8)
+			m.Version = uint8(v)
+		case 2:
+			var v uint64
+			v, err = d.Uint(math.MaxUint8)
+			m.Type = uint8(v)
+		case 3:
+			m.PeerID, err = d.Text()
+		case 4:
+			m.IdentityKEMPubKey, err = d.Bytes()
+		case 5:
+			m.IdentitySigPubKey, err = d.Bytes()
+		case 6:
+			m.TrustFingerprint, err = d.Text()
+		case 7:
+			m.TLSCertFingerprint, err = d.Text()
+		case 8:
+			m.TLSKeySignature, err = d.Bytes()
+		case 9:
+			m.Nickname, err = d.Text()
+		case 10:
+			m.Signature, err = d.Bytes()
+		case 11:
+			m.Timestamp, err = d.Time()
+		default:
+			err = d.Skip()
+		}
+		if err != nil {
+			return err
+		}
+	}
+	if seen&required != required {
+		return d.Missing("peer-announcement", required, seen)
+	}
+	return nil
+}
+
+// AppendCBOR appends the CBOR encoding of m (key-exchange)
+func (m *KeyExchangeMessage) AppendCBOR(b []byte) []byte {
+	n := 10
+	if len(m.RecipientKeyID) != 0 {
+		n++
+	}
+	b = wire.AppendMapHeader(b, n)
+	b = wire.AppendUint(b, 1)
+	b = wire.AppendUint(b, uint64(m.Version))
+	b = wire.AppendUint(b, 2)
+	b = wire.AppendUint(b, uint64(m.Type))
+	b = wire.AppendUint(b, 3)
+	b = wire.AppendText(b, m.SenderID)
+	b = wire.AppendUint(b, 4)
+	b = wire.AppendBytes(b, m.IdentityKEMPubKey)
+	b = wire.AppendUint(b, 5)
+	b = wire.AppendBytes(b, m.IdentitySigPubKey)
+	b = wire.AppendUint(b, 6)
+	b = wire.AppendBytes(b, m.EphemeralKEMPubKey)
+	b = wire.AppendUint(b, 7)
+	b = wire.AppendBytes(b, m.KEMCiphertext)
+	b = wire.AppendUint(b, 8)
+	b = wire.AppendBytes(b, m.Signature)
+	b = wire.AppendUint(b, 9)
+	b = wire.AppendTime(b, m.Timestamp)
+	b = wire.AppendUint(b, 10)
+	b = wire.AppendBytes(b, m.Nonce)
+	if len(m.RecipientKeyID) != 0 {
+		b = wire.AppendUint(b, 11)
+		b = wire.AppendBytes(b, m.RecipientKeyID)
+	}
+	return b
+}
+
+// DecodeCBOR reads m from d (key-exchange)
+func (m *KeyExchangeMessage) DecodeCBOR(d *wire.Decoder) error {
+	n, err := d.MapHeader()
+	if err != nil {
+		return err
+	}
+	if err := d.Enter(); err != nil {
+		return err
+	}
+	defer d.Leave()
+	const required = 0x7fe
+	var seen uint64
+	last := int64(-1)
+	for i := 0; i < n; i++ {
+		key, err := d.MapKey(&last)
+		if err != nil {
+			return err
+		}
+		if key < 64 {
+			seen |= 1 << key
+		}
+		switch key {
+		case 1:
+			var v uint64
+			v, err = d.Uint(math.MaxUint8)
+			m.Version = uint8(v)
+		case 2:
+			var v uint64
+			v, err = d.Uint(math.MaxUint8)
+			m.Type = uint8(v)
+		case 3:
+			m.SenderID, err = d.Text()
+		case 4:
+			m.IdentityKEMPubKey, err = d.Bytes()
+		case 5:
+			m.IdentitySigPubKey, err = d.Bytes()
+		case 6:
+			m.EphemeralKEMPubKey, err = d.Bytes()
+		case 7:
+			m.KEMCiphertext, err = d.Bytes()
+		case 8:
+			m.Signature, err = d.Bytes()
+		case 9:
+			m.Timestamp, err = d.Time()
+		case 10:
+			m.Nonce, err = d.Bytes()
+		case 11:
+			m.RecipientKeyID, err = d.Bytes()
+		default:
+			err = d.Skip()
+		}
+		if err != nil {
+			return err
+		}
+	}
+	if seen&required != required {
+		return d.Missing("key-exchange", required, seen)
+	}
+	return nil
+}
+
+// AppendCBOR appends the CBOR encoding of m (encrypted-message)
+func (m *EncryptedMessage) AppendCBOR(b []byte) []byte {
+	n := 9
+	b = wire.AppendMapHeader(b, n)
+	b = wire.AppendUint(b, 1)
+	b = wire.AppendUint(b, uint64(m.Version))
+	b = wire.AppendUint(b, 2)
+	b = wire.AppendUint(b, uint64(m.Type))
+	b = wire.AppendUint(b, 3)
+	b = wire.AppendText(b, m.SenderID)
+	b = wire.AppendUint(b, 4)
+	b = wire.AppendText(b, m.RecipientID)
+	b = wire.AppendUint(b, 5)
+	b = wire.AppendBytes(b, m.Signature)
+	b = wire.AppendUint(b, 6)
+	b = wire.AppendBytes(b, m.EncryptedPayload)
+	b = wire.AppendUint(b, 7)
+	b = wire.AppendTime(b, m.Timestamp)
+	b = wire.AppendUint(b, 8)
+	b = wire.AppendUint(b, m.KeyRotationEpoch)
+	b = wire.AppendUint(b, 9)
+	b = wire.AppendBytes(b, m.Salt)
+	return b
+}
+
+// DecodeCBOR reads m from d (encrypted-message)
+func (m *EncryptedMessage) DecodeCBOR(d *wire.Decoder) error {
+	n, err := d.MapHeader()
+	if err != nil {
+		return err
+	}
+	if err := d.Enter(); err != nil {
+		return err
+	}
+	defer d.Leave()
+	const required = 0x3fe
+	var seen uint64
+	last := int64(-1)
+	for i := 0; i < n; i++ {
+		key, err := d.MapKey(&last)
+		if err != nil {
+			return err
+		}
+		if key < 64 {
+			seen |= 1 << key
+		}
+		switch key {
+		case 1:
+			var v uint64
+			v, err = d.Uint(math.MaxUint8)
+			m.Version = uint8(v)
+		case 2:
+			var v uint64
+			v, err = d.Uint(math.MaxUint8)
+			m.Type = uint8(v)
+		case 3:
+			m.SenderID, err = d.Text()
+		case 4:
+			m.RecipientID, err = d.Text()
+		case 5:
+			m.Signature, err = d.Bytes()
+		case 6:
+			m.EncryptedPayload, err = d.Bytes()
+		case 7:
+			m.Timestamp, err = d.Time()
+		case 8:
+			var v uint64
+			v, err = d.Uint(math.MaxUint64)
+			m.KeyRotationEpoch = v
+		case 9:
+			m.Salt, err = d.Bytes()
+		default:
+			err = d.Skip()
+		}
+		if err != nil {
+			return err
+		}
+	}
+	if seen&required != required {
+		return d.Missing("encrypted-message", required, seen)
+	}
+	return nil
+}
+
+// AppendCBOR appends the CBOR encoding of m (room-metadata)
+func (m *RoomMetadata) AppendCBOR(b []byte) []byte {
+	n := 9
+	if len(m.Name) != 0 {
+		n++
+	}
+	if m.Incognito {
+		n++
+	}
+	if len(m.ArchiveSinks) != 0 {
+		n++
+	}
+	if len(m.Shortcodes) != 0 {
+		n++
+	}
+	if len(m.Roles) != 0 {
+		n++
+	}
+	b = wire.AppendMapHeader(b, n)
+	b = wire.AppendUint(b, 1)
+	b = wire.AppendUint(b, uint64(m.Version))
+	b = wire.AppendUint(b, 2)
+	b = wire.AppendUint(b, uint64(m.Type))
+	b = wire.AppendUint(b, 3)
+	b = wire.AppendText(b, m.RoomID)
+	b = wire.AppendUint(b, 4)
+	b = wire.AppendText(b, m.HostID)
+	b = wire.AppendUint(b, 5)
+	b = wire.AppendText(b, m.HostFingerprint)
+	if len(m.Name) != 0 {
+		b = wire.AppendUint(b, 6)
+		b = wire.AppendText(b, m.Name)
+	}
+	if m.Incognito {
+		b = wire.AppendUint(b, 7)
+		b = wire.AppendBool(b, m.Incognito)
+	}
+	b = wire.AppendUint(b, 8)
+	b = wire.AppendBool(b, m.Archiving)
+	if len(m.ArchiveSinks) != 0 {
+		b = wire.AppendUint(b, 9)
+		b = wire.AppendArrayHeader(b, len(m.ArchiveSinks))
+		for i := range m.ArchiveSinks {
+			b = wire.AppendText(b, m.ArchiveSinks[i])
+		}
+	}
+	b = wire.AppendUint(b, 10)
+	b = wire.AppendTime(b, m.ArchivingSince)
+	if len(m.Shortcodes) != 0 {
+		b = wire.AppendUint(b, 11)
+		b = wire.AppendArrayHeader(b, len(m.Shortcodes))
+		for i := range m.Shortcodes {
+			b = m.Shortcodes[i].AppendCBOR(b)
+		}
+	}
+	if len(m.Roles) != 0 {
+		b = wire.AppendUint(b, 12)
+		b = wire.AppendArrayHeader(b, len(m.Roles))
+		for i := range m.Roles {
+			b = m.Roles[i].AppendCBOR(b)
+		}
+	}
+	b = wire.AppendUint(b, 13)
+	b = wire.AppendTime(b, m.Timestamp)
+	b = wire.AppendUint(b, 14)
+	b = wire.AppendBytes(b, m.Signature)
+	return b
+}
+
+// DecodeCBOR reads m from d (room-metadata)
+func (m *RoomMetadata) DecodeCBOR(d *wire.Decoder) error {
+	n, err := d.MapHeader()
+	if err != nil {
+		return err
+	}
+	if err := d.Enter(); err != nil {
+		return err
+	}
+	defer d.Leave()
+	const required = 0x653e
+	var seen uint64
+	last := int64(-1)
+	for i := 0; i < n; i++ {
+		key, err := d.MapKey(&last)
+		if err != nil {
+			return err
+		}
+		if key < 64 {
+			seen |= 1 << key
+		}
+		switch key {
+		case 1:
+			var v uint64
+			v, err = d.Uint(math.MaxUint8)
+			m.Version = uint8(v)
+		case 2:
+			var v uint64
+			v, err = d.Uint(math.MaxUint8)
+			m.Type = uint8(v)
+		case 3:
+			m.RoomID, err = d.Text()
+		case 4:
+			m.HostID, err = d.Text()
+		case 5:
+			m.HostFingerprint, err = d.Text()
+		case 6:
+			m.Name, err = d.Text()
+		case 7:
+			m.Incognito, err = d.Bool()
+		case 8:
+			m.Archiving, err = d.Bool()
+		case 9:
+			m.ArchiveSinks, err = wire.DecodeArray(d, func(d *wire.Decoder, item *string) (err error) {
+				*item, err = d.Text()
+				return err
+			})
+		case 10:
+			m.ArchivingSince, err = d.Time()
+		case 11:
+			m.Shortcodes, err = wire.DecodeArray(d, func(d *wire.Decoder, item *RoomShortcode) (err error) {
+				err = item.DecodeCBOR(d)
+				return err
+			})
+		case 12:
+			m.Roles, err = wire.DecodeArray(d, func(d *wire.Decoder, item *RoleGrant) (err error) {
+				err = item.DecodeCBOR(d)
+				return err
+			})
+		case 13:
+			m.Timestamp, err = d.Time()
+		case 14:
+			m.Signature, err = d.Bytes()
+		default:
+			err = d.Skip()
+		}
+		if err != nil {
+			return err
+		}
+	}
+	if seen&required != required {
+		return d.Missing("room-metadata", required, seen)
+	}
+	return nil
+}
+
+// AppendCBOR appends the CBOR encoding of m (room-shortcode)
+func (m *RoomShortcode) AppendCBOR(b []byte) []byte {
+	n := 4
+	b = wire.AppendMapHeader(b, n)
+	b = wire.AppendUint(b, 1)
+	b = wire.AppendText(b, m.Code)
+	b = wire.AppendUint(b, 2)
+	b = wire.AppendText(b, m.Hash)
+	b = wire.AppendUint(b, 3)
+	b = wire.AppendText(b, m.MIME)
+	b = wire.AppendUint(b, 4)
+	b = wire.AppendInt(b, int64(m.Size))
+	return b
+}
+
+// DecodeCBOR reads m from d (room-shortcode)
+func (m *RoomShortcode) DecodeCBOR(d *wire.Decoder) error {
+	n, err := d.MapHeader()
+	if err != nil {
+		return err
+	}
+	if err := d.Enter(); err != nil {
+		return err
+	}
+	defer d.Leave()
+	const required = 0x1e
+	var seen uint64
+	last := int64(-1)
+	for i := 0; i < n; i++ {
+		key, err := d.MapKey(&last)
+		if err != nil {
+			return err
+		}
+		if key < 64 {
+			seen |= 1 << key
+		}
+		switch key {
+		case 1:
+			m.Code, err = d.Text()
+		case 2:
+			m.Hash, err = d.Text()
+		case 3:
+			m.MIME, err = d.Text()
+		case 4:
+			var v int64
+			v, err = d.Int(math.MinInt, math.MaxInt)
+			m.Size = int(v)
+		default:
+			err = d.Skip()
+		}
+		if err != nil {
+			return err
+		}
+	}
+	if seen&required != required {
+		return d.Missing("room-shortcode", required, seen)
+	}
+	return nil
+}
+
+// AppendCBOR appends the CBOR encoding of m (role-grant)
+func (m *RoleGrant) AppendCBOR(b []byte) []byte {
+	n := 8
+	b = wire.AppendMapHeader(b, n)
+	b = wire.AppendUint(b, 1)
+	b = wire.AppendUint(b, uint64(m.Version))
+	b = wire.AppendUint(b, 2)
+	b = wire.AppendUint(b, uint64(m.Type))
+	b = wire.AppendUint(b, 3)
+	b = wire.AppendText(b, m.RoomID)
+	b = wire.AppendUint(b, 4)
+	b = wire.AppendText(b, m.Fingerprint)
+	b = wire.AppendUint(b, 5)
+	b = wire.AppendText(b, m.Role)
+	b = wire.AppendUint(b, 6)
+	b = wire.AppendText(b, m.GrantedBy)
+	b = wire.AppendUint(b, 7)
+	b = wire.AppendTime(b, m.IssuedAt)
+	b = wire.AppendUint(b, 8)
+	b = wire.AppendBytes(b, m.Signature)
+	return b
+}
+
+// DecodeCBOR reads m from d (role-grant)
+func (m *RoleGrant) DecodeCBOR(d *wire.Decoder) error {
+	n, err := d.MapHeader()
+	if err != nil {
+		return err
+	}
+	if err := d.Enter(); err != nil {
+		return err
+	}
+	defer d.Leave()
+	const required = 0x1fe
+	var seen uint64
+	last := int64(-1)
+	for i := 0; i < n; i++ {
+		key, err := d.MapKey(&last)
+		if err != nil {
+			return err
+		}
+		if key < 64 {
+			seen |= 1 << key
+		}
+		switch key {
+		case 1:
+			var v uint64
+			v, err = d.Uint(math.MaxUint8)
+			m.Version = uint8(v)
+		case 2:
+			var v uint64
+			v, err = d.Uint(math.MaxUint8)
+			m.Type = uint8(v)
+		case 3:
+			m.RoomID, err = d.Text()
+		case 4:
+			m.Fingerprint, err = d.Text()
+		case 5:
+			m.Role, err = d.Text()
+		case 6:
+			m.GrantedBy, err = d.Text()
+		case 7:
+			m.IssuedAt, err = d.Time()
+		case 8:
+			m.Signature, err = d.Bytes()
+		default:
+			err = d.Skip()
+		}
+		if err != nil {
+			return err
+		}
+	}
+	if seen&required != required {
+		return d.Missing("role-grant", required, seen)
+	}
+	return nil
+}
+
+// AppendCBOR appends the CBOR encoding of m (membership-cert)
+func (m *MembershipCert) AppendCBOR(b []byte) []byte {
+	n := 11
+	b = wire.AppendMapHeader(b, n)
+	b = wire.AppendUint(b, 1)
+	b = wire.AppendUint(b, uint64(m.Version))
+	b = wire.AppendUint(b, 2)
+	b = wire.AppendUint(b, uint64(m.Type))
+	b = wire.AppendUint(b, 3)
+	b = wire.AppendText(b, m.RoomID)
+	b = wire.AppendUint(b, 4)
+	b = wire.AppendText(b, m.HostID)
+	b = wire.AppendUint(b, 5)
+	b = wire.AppendText(b, m.HostFingerprint)
+	b = wire.AppendUint(b, 6)
+	b = wire.AppendText(b, m.MemberID)
+	b = wire.AppendUint(b, 7)
+	b = wire.AppendText(b, m.MemberFingerprint)
+	b = wire.AppendUint(b, 8)
+	b = wire.AppendBytes(b, m.MemberSigPubKey)
+	b = wire.AppendUint(b, 9)
+	b = wire.AppendTime(b, m.IssuedAt)
+	b = wire.AppendUint(b, 10)
+	b = wire.AppendTime(b, m.ExpiresAt)
+	b = wire.AppendUint(b, 11)
+	b = wire.AppendBytes(b, m.Signature)
+	return b
+}
+
+// DecodeCBOR reads m from d (membership-cert)
+func (m *MembershipCert) DecodeCBOR(d *wire.Decoder) error {
+	n, err := d.MapHeader()
+	if err != nil {
+		return err
+	}
+	if err := d.Enter(); err != nil {
+		return err
+	}
+	defer d.Leave()
+	const required = 0xffe
+	var seen uint64
+	last := int64(-1)
+	for i := 0; i < n; i++ {
+		key, err := d.MapKey(&last)
+		if err != nil {
+			return err
+		}
+		if key < 64 {
+			seen |= 1 << key
+		}
+		switch key {
+		case 1:
+			var v uint64
+			v, err = d.Uint(math.MaxUint8)
+			m.Version = uint8(v)
+		case 2:
+			var v uint64
+			v, err = d.Uint(math.MaxUint8)
+			m.Type = uint8(v)
+		case 3:
+			m.RoomID, err = d.Text()
+		case 4:
+			m.HostID, err = d.Text()
+		case 5:
+			m.HostFingerprint, err = d.Text()
+		case 6:
+			m.MemberID, err = d.Text()
+		case 7:
+			m.MemberFingerprint, err = d.Text()
+		case 8:
+			m.MemberSigPubKey, err = d.Bytes()
+		case 9:
+			m.IssuedAt, err = d.Time()
+		case 10:
+			m.ExpiresAt, err = d.Time()
+		case 11:
+			m.Signature, err = d.Bytes()
+		default:
+			err = d.Skip()
+		}
+		if err != nil {
+			return err
+		}
+	}
+	if seen&required != required {
+		return d.Missing("membership-cert", required, seen)
+	}
+	return nil
+}
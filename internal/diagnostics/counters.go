@@ -0,0 +1,258 @@
+// Package diagnostics keeps local-only usage and failure counters, gauges
+// and the connect latency.
+//
+// Nothing recorded here ever leaves the machine on its own: the metrics live
+// in memory for the lifetime of the process and are only exposed through the
+// bridge, expvar and, when the daemon is asked to, a loopback /metrics
+// endpoint (prometheus.go), so the user (or a maintainer looking over their
+// shoulder) can spot environmental problems such as blocked discovery or
+// failing handshakes.
+package diagnostics
+
+import (
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// counter names for feature usage
+const (
+	RoomCreated        = "room.created"
+	RoomFind           = "room.find"
+	AccessKeyRotated   = "room.access_key_rotated"
+	MessageSent        = "message.sent"
+	MessageSendFailed  = "message.send_failed"
+	MessageReceived    = "message.received"
+	MessageDecryptFail = "message.decrypt_failed"
+	MessageOutOfOrder  = "message.out_of_order"
+	MessageReordered   = "message.reordered"
+	MessageGap         = "message.gap"
+	MessageDuplicate   = "message.duplicate"
+	MessageChunked     = "message.chunked"
+	MessageUnassembled = "message.reassembly_failed"
+	MessageUnverified  = "message.rejected_unverified"
+	RotationBuffered   = "crypto.rotation_buffered"
+	RotationExpired    = "crypto.rotation_buffer_expired"
+	KeyRotation        = "crypto.key_rotation"
+	KeyRotationFailed  = "crypto.key_rotation_failed"
+)
+
+// counter names for reachability checks before a send is given up
+const (
+	ProbeFailed      = "connection.probe_failed"
+	ReconnectAttempt = "connection.reconnect_attempted"
+	ReconnectSuccess = "connection.reconnect_succeeded"
+)
+
+// counter name for frames refused before handling (network/validate.go)
+const FrameRejected = "connection.frame_rejected"
+
+// counter names for the handshake (announcement + key exchange)
+const (
+	HandshakeSuccess            = "handshake.success"
+	HandshakeFailure            = "handshake.failure"
+	HandshakeBadAccessKey       = "handshake.failure.access_key"
+	HandshakeBadMembership      = "handshake.failure.membership"
+	HandshakeRoomMismatch       = "handshake.failure.room_id"
+	HandshakeBadAnnouncement    = "handshake.failure.announcement"
+	HandshakeBadKeyExchange     = "handshake.failure.key_exchange"
+	HandshakeFingerprintChanged = "handshake.failure.fingerprint_changed"
+	HandshakeBanned             = "handshake.failure.banned"
+	HandshakeQuarantined        = "handshake.failure.quarantined"
+	HandshakeRoomFull           = "handshake.failure.room_full"
+	HandshakeTLSMismatch        = "handshake.failure.tls_fingerprint"
+	HandshakeConnectionFailed   = "handshake.failure.connection"
+	HandshakeVersion            = "handshake.failure.version"
+)
+
+// join methods as used in JoinRoom / JoinRoomWithFallback
+const (
+	JoinDirect    = "direct"
+	JoinDiscovery = "local_discovery"
+	JoinLocalhost = "localhost"
+	JoinSignaling = "signaling"
+	JoinLibp2p    = "libp2p"
+	JoinWebRTC    = "webrtc"
+)
+
+const joinPrefix = "join."
+
+// Registry is a set of named monotonic counters
+type Registry struct {
+	mu        sync.Mutex
+	counters  map[string]uint64
+	connect   Latency
+	startedAt time.Time
+}
+
+// MethodStats summarizes attempts for a single join method
+type MethodStats struct {
+	Method      string  `json:"method"`
+	Attempts    uint64  `json:"attempts"`
+	Successes   uint64  `json:"successes"`
+	Failures    uint64  `json:"failures"`
+	SuccessRate float64 `json:"success_rate"`
+}
+
+// Snapshot is a point-in-time copy of the registry with derived rates
+type Snapshot struct {
+	StartedAt            time.Time         `json:"started_at"`
+	UptimeSeconds        int64             `json:"uptime_seconds"`
+	Counters             map[string]uint64 `json:"counters"`
+	Gauges               map[string]int64  `json:"gauges"`
+	ConnectLatency       Latency           `json:"connect_latency"`
+	JoinMethods          []MethodStats     `json:"join_methods"`
+	DiscoveryMethods     []MethodStats     `json:"discovery_methods"`
+	HandshakeSuccesses   uint64            `json:"handshake_successes"`
+	HandshakeFailures    uint64            `json:"handshake_failures"`
+	HandshakeFailureRate float64           `json:"handshake_failure_rate"`
+}
+
+var defaultRegistry = NewRegistry()
+
+// NewRegistry returns an empty registry
+func NewRegistry() *Registry {
+	return &Registry{
+		counters:  make(map[string]uint64),
+		startedAt: time.Now(),
+	}
+}
+
+// Default returns the process-wide registry
+func Default() *Registry {
+	return defaultRegistry
+}
+
+// Inc increments a counter in the default registry
+func Inc(name string) {
+	defaultRegistry.Add(name, 1)
+}
+
+// RecordJoin records the outcome of a join attempt using the given method
+func RecordJoin(method string, ok bool) {
+	defaultRegistry.RecordJoin(method, ok)
+}
+
+// RecordHandshakeFailure records a failed handshake together with its reason
+func RecordHandshakeFailure(reason string) {
+	defaultRegistry.Add(HandshakeFailure, 1)
+	if reason != "" && reason != HandshakeFailure {
+		defaultRegistry.Add(reason, 1)
+	}
+}
+
+// Add increments a counter by delta
+func (r *Registry) Add(name string, delta uint64) {
+	r.mu.Lock()
+	r.counters[name] += delta
+	r.mu.Unlock()
+}
+
+// Get returns the current value of a counter
+func (r *Registry) Get(name string) uint64 {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.counters[name]
+}
+
+// RecordJoin records the outcome of a join attempt using the given method
+func (r *Registry) RecordJoin(method string, ok bool) {
+	r.record(joinPrefix, method, ok)
+}
+
+// record counts an attempt of a method under prefix and its outcome
+func (r *Registry) record(prefix, method string, ok bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.counters[prefix+method+".attempt"]++
+	if ok {
+		r.counters[prefix+method+".success"]++
+	} else {
+		r.counters[prefix+method+".failure"]++
+	}
+}
+
+// Reset clears all counters and restarts the uptime clock
+func (r *Registry) Reset() {
+	r.mu.Lock()
+	r.counters = make(map[string]uint64)
+	r.connect = Latency{}
+	r.startedAt = time.Now()
+	r.mu.Unlock()
+}
+
+// Snapshot copies the counters and computes per-method and handshake rates
+func (r *Registry) Snapshot() Snapshot {
+	r.mu.Lock()
+	counters := make(map[string]uint64, len(r.counters))
+	for k, v := range r.counters {
+		counters[k] = v
+	}
+	connect := r.connect
+	connect.Buckets = append([]uint64(nil), connect.Buckets...)
+	startedAt := r.startedAt
+	r.mu.Unlock()
+
+	snap := Snapshot{
+		StartedAt:          startedAt,
+		UptimeSeconds:      int64(time.Since(startedAt).Seconds()),
+		Counters:           counters,
+		Gauges:             readGauges(),
+		ConnectLatency:     connect,
+		HandshakeSuccesses: counters[HandshakeSuccess],
+		HandshakeFailures:  counters[HandshakeFailure],
+	}
+	snap.HandshakeFailureRate = rate(snap.HandshakeFailures, snap.HandshakeSuccesses+snap.HandshakeFailures)
+
+	snap.JoinMethods = methodStats(counters, joinPrefix)
+	snap.DiscoveryMethods = methodStats(counters, discoveryPrefix)
+
+	return snap
+}
+
+// methodStats sums up the attempt, success and failure counters under
+// prefix by method
+func methodStats(counters map[string]uint64, prefix string) []MethodStats {
+	methods := make(map[string]*MethodStats)
+	for name, v := range counters {
+		if !strings.HasPrefix(name, prefix) {
+			continue
+		}
+		rest := strings.TrimPrefix(name, prefix)
+		dot := strings.LastIndex(rest, ".")
+		if dot <= 0 {
+			continue
+		}
+		method, kind := rest[:dot], rest[dot+1:]
+		ms, ok := methods[method]
+		if !ok {
+			ms = &MethodStats{Method: method}
+			methods[method] = ms
+		}
+		switch kind {
+		case "attempt":
+			ms.Attempts = v
+		case "success":
+			ms.Successes = v
+		case "failure":
+			ms.Failures = v
+		}
+	}
+	var stats []MethodStats
+	for _, ms := range methods {
+		ms.SuccessRate = rate(ms.Successes, ms.Attempts)
+		stats = append(stats, *ms)
+	}
+	sort.Slice(stats, func(i, j int) bool {
+		return stats[i].Method < stats[j].Method
+	})
+	return stats
+}
+
+func rate(part, total uint64) float64 {
+	if total == 0 {
+		return 0
+	}
+	return float64(part) / float64(total)
+}
@@ -0,0 +1,118 @@
+package diagnostics
+
+import (
+	"sort"
+	"sync"
+	"time"
+)
+
+// counter names for traffic, as it goes over the connection: frames,
+// datagrams and media bodies
+const (
+	BytesSent     = "traffic.bytes_sent"
+	BytesReceived = "traffic.bytes_received"
+)
+
+// gauge names; the application registers how they are read
+const (
+	GaugePeersConnected = "peers.connected"
+	GaugeRoomsActive    = "rooms.active"
+)
+
+const discoveryPrefix = "discovery."
+
+// latencyBuckets are the upper bounds, in seconds, of the connect latency
+// histogram
+var latencyBuckets = []float64{0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10, 30}
+
+// Latency is a histogram of durations
+type Latency struct {
+	Count uint64 `json:"count"`
+	// seconds
+	Sum float64 `json:"sum"`
+	Max float64 `json:"max"`
+	// cumulative counts for each of Bounds
+	Buckets []uint64  `json:"buckets"`
+	Bounds  []float64 `json:"bounds"`
+}
+
+// Average returns the mean duration in seconds, 0 before the first one
+func (l Latency) Average() float64 {
+	if l.Count == 0 {
+		return 0
+	}
+	return l.Sum / float64(l.Count)
+}
+
+func (l *Latency) observe(seconds float64) {
+	if l.Buckets == nil {
+		l.Bounds = latencyBuckets
+		l.Buckets = make([]uint64, len(latencyBuckets))
+	}
+	l.Count++
+	l.Sum += seconds
+	l.Max = max(l.Max, seconds)
+	for i, bound := range l.Bounds {
+		if seconds <= bound {
+			l.Buckets[i]++
+		}
+	}
+}
+
+var (
+	gaugesMu sync.Mutex
+	gauges   = make(map[string]func() int64)
+)
+
+// RegisterGauge makes read the source of a gauge, replacing an earlier one
+// under the same name. Gauges are read when a snapshot is taken, so they
+// survive Reset.
+func RegisterGauge(name string, read func() int64) {
+	gaugesMu.Lock()
+	gauges[name] = read
+	gaugesMu.Unlock()
+}
+
+func readGauges() map[string]int64 {
+	gaugesMu.Lock()
+	defer gaugesMu.Unlock()
+	values := make(map[string]int64, len(gauges))
+	for name, read := range gauges {
+		values[name] = read()
+	}
+	return values
+}
+
+// Add increments a counter in the default registry by delta
+func Add(name string, delta uint64) {
+	defaultRegistry.Add(name, delta)
+}
+
+// RecordDiscovery records the outcome of one local discovery method ("mdns",
+// "dht", "broadcast") during a join
+func RecordDiscovery(method string, ok bool) {
+	defaultRegistry.record(discoveryPrefix, method, ok)
+}
+
+// ObserveConnect records how long a connection took from the dial (or the
+// accept) to the secure channel
+func ObserveConnect(d time.Duration) {
+	defaultRegistry.ObserveConnect(d)
+}
+
+// ObserveConnect records a connect latency
+func (r *Registry) ObserveConnect(d time.Duration) {
+	r.mu.Lock()
+	r.connect.observe(d.Seconds())
+	r.mu.Unlock()
+}
+
+// sortedKeys returns the keys of m in order
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -0,0 +1,74 @@
+package diagnostics
+
+import (
+	"bufio"
+	"expvar"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// Export.
+//
+// The default registry is published as the expvar "execp2p" (a Snapshot)
+// and written in the Prometheus text format by WritePrometheus. Counter
+// "message.sent" becomes execp2p_message_sent_total, gauge "peers.connected"
+// execp2p_peers_connected, and the connect latency the histogram
+// execp2p_connect_latency_seconds.
+
+func init() {
+	expvar.Publish("execp2p", expvar.Func(func() interface{} { return defaultRegistry.Snapshot() }))
+}
+
+// Handler serves /metrics (Prometheus) and /debug/vars (expvar)
+func Handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /metrics", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+		WritePrometheus(w, defaultRegistry.Snapshot())
+	})
+	mux.Handle("GET /debug/vars", expvar.Handler())
+	return mux
+}
+
+// WritePrometheus writes snap in the Prometheus text exposition format
+func WritePrometheus(w io.Writer, snap Snapshot) error {
+	b := bufio.NewWriter(w)
+
+	fmt.Fprintf(b, "# TYPE execp2p_uptime_seconds gauge\nexecp2p_uptime_seconds %d\n", snap.UptimeSeconds)
+	for _, name := range sortedKeys(snap.Counters) {
+		metric := metricName(name) + "_total"
+		fmt.Fprintf(b, "# TYPE %s counter\n%s %d\n", metric, metric, snap.Counters[name])
+	}
+	for _, name := range sortedKeys(snap.Gauges) {
+		metric := metricName(name)
+		fmt.Fprintf(b, "# TYPE %s gauge\n%s %d\n", metric, metric, snap.Gauges[name])
+	}
+
+	const latency = "execp2p_connect_latency_seconds"
+	l := snap.ConnectLatency
+	fmt.Fprintf(b, "# TYPE %s histogram\n", latency)
+	for i, bound := range latencyBuckets {
+		var n uint64
+		if i < len(l.Buckets) {
+			n = l.Buckets[i]
+		}
+		fmt.Fprintf(b, "%s_bucket{le=\"%s\"} %d\n", latency, strconv.FormatFloat(bound, 'g', -1, 64), n)
+	}
+	fmt.Fprintf(b, "%s_bucket{le=\"+Inf\"} %d\n%s_sum %s\n%s_count %d\n",
+		latency, l.Count, latency, strconv.FormatFloat(l.Sum, 'g', -1, 64), latency, l.Count)
+
+	return b.Flush()
+}
+
+// metricName turns a counter name into a Prometheus metric name
+func metricName(name string) string {
+	return "execp2p_" + strings.Map(func(r rune) rune {
+		if r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' || r == '_' {
+			return r
+		}
+		return '_'
+	}, name)
+}
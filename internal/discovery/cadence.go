@@ -0,0 +1,161 @@
+package discovery
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"execp2p/internal/logger"
+)
+
+// what announcers do once the room has a connected peer
+const (
+	// OccupiedReduce announces less often
+	OccupiedReduce = "reduce"
+	// OccupiedStop stops announcing until the room is empty again
+	OccupiedStop = "stop"
+	// OccupiedKeep announces as if the room were empty
+	OccupiedKeep = "keep"
+)
+
+// Cadence paces periodic announcements by room state: aggressive while the
+// room waits for peers, reduced or paused once someone is connected. When
+// the room becomes empty again announcers resume at once.
+type Cadence struct {
+	idle     time.Duration
+	occupied time.Duration // 0 pauses announcing
+	keep     bool
+
+	mu         sync.Mutex
+	isOccupied bool
+	changed    chan struct{}
+}
+
+// NewCadence returns a cadence announcing every idle while the room is
+// empty; mode and occupiedInterval decide what happens once it isn't
+func NewCadence(mode string, idle, occupiedInterval time.Duration) (*Cadence, error) {
+	if idle <= 0 {
+		return nil, fmt.Errorf("announce interval must be positive")
+	}
+	c := &Cadence{idle: idle, changed: make(chan struct{})}
+	switch mode {
+	case OccupiedReduce, "":
+		if occupiedInterval < idle {
+			occupiedInterval = idle
+		}
+		c.occupied = occupiedInterval
+	case OccupiedStop:
+	case OccupiedKeep:
+		c.occupied, c.keep = idle, true
+	default:
+		return nil, fmt.Errorf("unknown discovery mode %q (use %s, %s or %s)", mode, OccupiedReduce, OccupiedStop, OccupiedKeep)
+	}
+	return c, nil
+}
+
+// SetOccupied records whether the room has a connected peer
+func (c *Cadence) SetOccupied(occupied bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.isOccupied == occupied {
+		return
+	}
+	c.isOccupied = occupied
+	// wake up everyone waiting for the old state
+	close(c.changed)
+	c.changed = make(chan struct{})
+
+	if c.keep {
+		return
+	}
+	if occupied {
+		logger.L().Info("Peer connected; discovery announcements reduced", "interval", c.occupied)
+	} else {
+		logger.L().Info("Room empty; discovery announcements resumed", "interval", c.idle)
+	}
+}
+
+// Interval returns the current time between announcements, 0 if paused
+func (c *Cadence) Interval() time.Duration {
+	interval, _, _ := c.state()
+	return interval
+}
+
+func (c *Cadence) state() (time.Duration, bool, <-chan struct{}) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.isOccupied {
+		return c.occupied, true, c.changed
+	}
+	return c.idle, false, c.changed
+}
+
+// Wait blocks until the next announcement is due. Emptying the room makes it
+// due immediately. Returns false when ctx is done.
+func (c *Cadence) Wait(ctx context.Context) bool {
+	start := time.Now()
+	for {
+		interval, occupied, changed := c.state()
+
+		var timer *time.Timer
+		var due <-chan time.Time
+		if interval > 0 {
+			timer = time.NewTimer(time.Until(start.Add(interval)))
+			due = timer.C
+		}
+
+		select {
+		case <-ctx.Done():
+			stopTimer(timer)
+			return false
+		case <-due:
+			return true
+		case <-changed:
+			stopTimer(timer)
+			if occupied {
+				// the room emptied: announce right away
+				return true
+			}
+			// a peer connected: wait with the new interval
+		}
+	}
+}
+
+func stopTimer(t *time.Timer) {
+	if t != nil {
+		t.Stop()
+	}
+}
+
+// WaitActive blocks while announcing is paused. Returns false when ctx is done.
+func (c *Cadence) WaitActive(ctx context.Context) bool {
+	for {
+		interval, _, changed := c.state()
+		if interval > 0 {
+			return true
+		}
+		select {
+		case <-ctx.Done():
+			return false
+		case <-changed:
+		}
+	}
+}
+
+// WaitPaused blocks while announcing is on. Returns false when ctx is done.
+func (c *Cadence) WaitPaused(ctx context.Context) bool {
+	for {
+		interval, _, changed := c.state()
+		if interval == 0 {
+			return true
+		}
+		select {
+		case <-ctx.Done():
+			return false
+		case <-changed:
+		}
+	}
+}
@@ -7,6 +7,7 @@ import (
 	"net"
 	"time"
 
+	"execp2p/internal/crash"
 	"execp2p/internal/logger"
 
 	"github.com/anacrolix/dht/v2"
@@ -30,14 +31,25 @@ func StartDHTNode(port int) (*dht.Server, error) {
 	return s, nil
 }
 
-// AnnounceDHT announces our presence on the DHT for a given room ID.
-func AnnounceDHT(ctx context.Context, server *dht.Server, roomID string, listenPort int) {
+// DHTAnnounceInterval is how often an empty room is announced on the DHT
+const DHTAnnounceInterval = 3 * time.Minute
+
+// AnnounceDHT announces our presence on the DHT for a given room ID, paced
+// by cadence (nil announces every DHTAnnounceInterval).
+func AnnounceDHT(ctx context.Context, server *dht.Server, roomID string, listenPort int, cadence *Cadence) {
+	defer crash.Recover("discovery.AnnounceDHT")
 	infoHash := getInfoHash(roomID)
-	ticker := time.NewTicker(3 * time.Minute) // announce periodically
-	defer ticker.Stop()
+	if cadence == nil {
+		cadence, _ = NewCadence(OccupiedKeep, DHTAnnounceInterval, 0)
+	}
 
 	for {
-		logger.L().Debug("DHT announce", "room", roomID[:8])
+		if !cadence.WaitActive(ctx) {
+			logger.L().Info("Stopping DHT announcement")
+			return
+		}
+		// the whole ID, which logs of incognito rooms redact; a prefix would slip through
+		logger.L().Debug("DHT announce", "room", roomID)
 
 		// Użyj AnnounceTraversal zamiast Announce (która jest przestarzała)
 		ann, err := server.AnnounceTraversal(infoHash)
@@ -51,9 +63,7 @@ func AnnounceDHT(ctx context.Context, server *dht.Server, roomID string, listenP
 			}()
 		}
 
-		select {
-		case <-ticker.C:
-		case <-ctx.Done():
+		if !cadence.Wait(ctx) {
 			logger.L().Info("Stopping DHT announcement")
 			return
 		}
@@ -8,17 +8,17 @@ import (
 	"github.com/pion/stun"
 )
 
+// StunServers are asked for our external address, in order
+var StunServers = []string{
+	"stun.l.google.com:19302",
+	"stun1.l.google.com:19302",
+	"stun.twilio.com:3478",
+	"stun.stunprotocol.org:3478",
+}
+
 // ExternalUDPAddr gets our external IP:port by asking a STUN server
 // Używa wielu serwerów STUN jako fallback, jeśli jeden nie odpowiada
 func ExternalUDPAddr(localPort int) (string, error) {
-	// Lista serwerów STUN do próbowania
-	stunServers := []string{
-		"stun.l.google.com:19302",
-		"stun1.l.google.com:19302",
-		"stun.twilio.com:3478",
-		"stun.stunprotocol.org:3478",
-	}
-
 	// Sprawdź czy port jest dostępny
 	if !isPortAvailable(localPort) {
 		// Spróbuj znaleźć inny dostępny port
@@ -34,7 +34,7 @@ func ExternalUDPAddr(localPort int) (string, error) {
 	var lastError error
 
 	// Spróbuj każdego serwera STUN z listy
-	for _, server := range stunServers {
+	for _, server := range StunServers {
 		addr, err := tryStunServer(server, localPort)
 		if err != nil {
 			lastError = err
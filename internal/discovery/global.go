@@ -3,6 +3,7 @@ package discovery
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"net"
@@ -10,6 +11,8 @@ import (
 	"strings"
 	"time"
 
+	"execp2p/internal/diagnostics"
+
 	"github.com/anacrolix/dht/v2"
 )
 
@@ -138,50 +141,77 @@ func ValidateAddress(addr string) error {
 	return nil
 }
 
-// AutoDiscovery tries multiple discovery methods simultaneously
-func AutoDiscovery(ctx context.Context, roomID string, dhtServer *dht.Server) (string, error) {
+// Methods selects the local discovery methods AutoDiscovery uses
+type Methods struct {
+	MDNS      bool
+	DHT       bool
+	Broadcast bool
+}
+
+// AutoDiscovery tries the enabled discovery methods simultaneously
+func AutoDiscovery(ctx context.Context, roomID string, dhtServer *dht.Server, methods Methods) (string, error) {
 	ctx, cancel := context.WithTimeout(ctx, 30*time.Second)
 	defer cancel()
 
 	// collect results from different discovery methods
 	results := make(chan string, 3)
 	errors := make(chan error, 3)
+	started := 0
 
 	// start multiple discovery methods
-	go func() {
-		// local network discovery (mDNS) - usually fastest
-		if addr, err := Lookup(ctx, roomID, 8*time.Second); err == nil {
-			results <- addr
-		} else {
-			errors <- fmt.Errorf("mDNS: %w", err)
-		}
-	}()
+	if methods.MDNS {
+		started++
+		go func() {
+			// local network discovery (mDNS) - usually fastest
+			if addr, err := Lookup(ctx, roomID, 8*time.Second); err == nil {
+				recordDiscovery(ctx, "mdns", true)
+				results <- addr
+			} else {
+				recordDiscovery(ctx, "mdns", false)
+				errors <- fmt.Errorf("mDNS: %w", err)
+			}
+		}()
+	}
 
-	go func() {
-		// global discovery via DHT
-		if dhtServer != nil {
-			if addr, err := LookupDHT(ctx, dhtServer, roomID, 15*time.Second); err == nil {
+	if methods.DHT {
+		started++
+		go func() {
+			// global discovery via DHT
+			if dhtServer != nil {
+				if addr, err := LookupDHT(ctx, dhtServer, roomID, 15*time.Second); err == nil {
+					recordDiscovery(ctx, "dht", true)
+					results <- addr
+				} else {
+					recordDiscovery(ctx, "dht", false)
+					errors <- fmt.Errorf("dht: %w", err)
+				}
+			} else {
+				errors <- fmt.Errorf("dht: server not initialized")
+			}
+		}()
+	}
+
+	if methods.Broadcast {
+		started++
+		go func() {
+			// broadcast discovery on local network
+			if addr, err := BroadcastDiscovery(ctx, roomID, 10*time.Second); err == nil {
+				recordDiscovery(ctx, "broadcast", true)
 				results <- addr
 			} else {
-				errors <- fmt.Errorf("dht: %w", err)
+				recordDiscovery(ctx, "broadcast", false)
+				errors <- fmt.Errorf("broadcast: %w", err)
 			}
-		} else {
-			errors <- fmt.Errorf("dht: server not initialized")
-		}
-	}()
+		}()
+	}
 
-	go func() {
-		// broadcast discovery on local network
-		if addr, err := BroadcastDiscovery(ctx, roomID, 10*time.Second); err == nil {
-			results <- addr
-		} else {
-			errors <- fmt.Errorf("broadcast: %w", err)
-		}
-	}()
+	if started == 0 {
+		return "", fmt.Errorf("all local discovery methods are disabled")
+	}
 
 	// wait for first success or all failures
 	var errorList []error
-	for i := 0; i < 3; i++ {
+	for i := 0; i < started; i++ {
 		select {
 		case addr := <-results:
 			return addr, nil
@@ -196,6 +226,15 @@ func AutoDiscovery(ctx context.Context, roomID string, dhtServer *dht.Server) (s
 	return "", fmt.Errorf("all discovery methods failed: %v", errorList)
 }
 
+// recordDiscovery counts the outcome of one method, unless it was cut short
+// because another one found the room first (or the join was abandoned)
+func recordDiscovery(ctx context.Context, method string, ok bool) {
+	if !ok && errors.Is(ctx.Err(), context.Canceled) {
+		return
+	}
+	diagnostics.RecordDiscovery(method, ok)
+}
+
 // BroadcastDiscovery sends UDP broadcasts to find peers on local networks
 func BroadcastDiscovery(ctx context.Context, roomID string, timeout time.Duration) (string, error) {
 	ctx, cancel := context.WithTimeout(ctx, timeout)
@@ -289,10 +328,11 @@ func StartDiscoveryResponder(ctx context.Context, roomID string, port int) error
 	if err != nil {
 		return err
 	}
-	defer conn.Close()
+	// closing the socket ends the read loop, and frees the port for a
+	// responder started after this one
+	context.AfterFunc(ctx, func() { conn.Close() })
 
 	go func() {
-		defer conn.Close()
 		buf := make([]byte, 1024)
 
 		for {
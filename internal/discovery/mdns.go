@@ -5,26 +5,49 @@ import (
 	"fmt"
 	"time"
 
+	"execp2p/internal/crash"
+	"execp2p/internal/logger"
 	"execp2p/internal/room"
 
 	"github.com/grandcat/zeroconf"
 )
 
-// Advertise announces our room on the local network via mDNS
-func Advertise(ctx context.Context, roomID string, port int) error {
-	serviceType := serviceTypeForRoom(roomID)
-
-	server, err := zeroconf.Register(roomID, serviceType, "local.", port, []string{fmt.Sprintf("room=%s", roomID)}, nil)
+// Advertise announces our room on the local network via mDNS. While
+// cadence (if any) pauses announcing the service is withdrawn and it is
+// registered again once the room is empty.
+func Advertise(ctx context.Context, roomID string, port int, cadence *Cadence) error {
+	defer crash.Recover("discovery.Advertise")
+	server, err := registerService(roomID, port)
 	if err != nil {
 		return err
 	}
 	go func() {
-		<-ctx.Done()
-		server.Shutdown()
+		for {
+			if cadence == nil || !cadence.WaitPaused(ctx) {
+				<-ctx.Done()
+				server.Shutdown()
+				return
+			}
+			server.Shutdown()
+			logger.L().Debug("mDNS advertisement withdrawn while the room is occupied")
+
+			if !cadence.WaitActive(ctx) {
+				return
+			}
+			if server, err = registerService(roomID, port); err != nil {
+				logger.L().Warn("mDNS re-advertisement failed", "err", err)
+				return
+			}
+		}
 	}()
 	return nil
 }
 
+func registerService(roomID string, port int) (*zeroconf.Server, error) {
+	serviceType := serviceTypeForRoom(roomID)
+	return zeroconf.Register(roomID, serviceType, "local.", port, []string{fmt.Sprintf("room=%s", roomID)}, nil)
+}
+
 // Lookup tries to find someone hosting this room on the local network
 func Lookup(ctx context.Context, roomID string, timeout time.Duration) (string, error) {
 	serviceType := serviceTypeForRoom(roomID)
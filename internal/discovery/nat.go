@@ -0,0 +1,48 @@
+package discovery
+
+import (
+	"fmt"
+	"net"
+)
+
+// NATInfo tells whether this machine sits behind a NAT
+type NATInfo struct {
+	// our address as a STUN server sees it
+	ExternalAddr string `json:"external_addr"`
+	// the external address is not one of our own: peers on the internet
+	// can't dial us without hole punching or port forwarding
+	BehindNAT bool `json:"behind_nat"`
+}
+
+// DetectNAT asks the STUN servers for our external address and compares it
+// with the addresses of the local interfaces
+func DetectNAT() (NATInfo, error) {
+	var lastErr error
+	for _, server := range StunServers {
+		addr, err := tryStunServer(server, 0)
+		if err != nil {
+			lastErr = err
+			continue
+		}
+		host, _, err := net.SplitHostPort(addr)
+		if err != nil {
+			return NATInfo{}, fmt.Errorf("invalid STUN answer %q: %w", addr, err)
+		}
+		return NATInfo{ExternalAddr: addr, BehindNAT: !isOwnAddress(net.ParseIP(host))}, nil
+	}
+	return NATInfo{}, fmt.Errorf("no STUN server answered: %w", lastErr)
+}
+
+// isOwnAddress reports whether ip is assigned to a local interface
+func isOwnAddress(ip net.IP) bool {
+	addrs, err := net.InterfaceAddrs()
+	if err != nil || ip == nil {
+		return false
+	}
+	for _, a := range addrs {
+		if n, ok := a.(*net.IPNet); ok && n.IP.Equal(ip) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,205 @@
+package discovery
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/anacrolix/dht/v2"
+	"github.com/pion/stun"
+)
+
+// The probes below check what the network lets discovery do. They send
+// nothing that identifies a room and are meant for diagnostics only.
+
+// STUNResult is the answer of one STUN server
+type STUNResult struct {
+	Server string `json:"server"`
+	// our address as the server sees it
+	MappedAddr string        `json:"mapped_addr,omitempty"`
+	RTT        time.Duration `json:"rtt_ns,omitempty"`
+	Error      string        `json:"error,omitempty"`
+}
+
+// STUNProbe is the outcome of asking several STUN servers from one socket
+type STUNProbe struct {
+	// the socket's own address, to compare the mapped addresses with
+	LocalAddr string       `json:"local_addr"`
+	Results   []STUNResult `json:"results"`
+	// a mapped address is one of our own with the socket's port: no NAT
+	Public bool `json:"public"`
+}
+
+// ProbeSTUN asks every server for our address from the same local socket,
+// one after the other. Comparing the answers tells how the NAT maps ports.
+func ProbeSTUN(ctx context.Context, servers []string, timeout time.Duration) (*STUNProbe, error) {
+	conn, err := net.ListenUDP("udp4", &net.UDPAddr{IP: net.IPv4zero})
+	if err != nil {
+		return nil, fmt.Errorf("failed to open UDP socket: %w", err)
+	}
+	defer conn.Close()
+	local := conn.LocalAddr().(*net.UDPAddr)
+
+	probe := &STUNProbe{LocalAddr: local.String()}
+	for _, server := range servers {
+		if ctx.Err() != nil {
+			break
+		}
+		r := STUNResult{Server: server}
+		mapped, rtt, err := stunBinding(conn, server, timeout)
+		if err != nil {
+			r.Error = err.Error()
+		} else {
+			r.MappedAddr, r.RTT = mapped.String(), rtt
+			if mapped.Port == local.Port && isOwnAddress(mapped.IP) {
+				probe.Public = true
+			}
+		}
+		probe.Results = append(probe.Results, r)
+	}
+	return probe, nil
+}
+
+// stunBinding sends one binding request from conn and waits for its answer
+func stunBinding(conn *net.UDPConn, server string, timeout time.Duration) (*net.UDPAddr, time.Duration, error) {
+	raddr, err := net.ResolveUDPAddr("udp4", server)
+	if err != nil {
+		return nil, 0, err
+	}
+	req := stun.MustBuild(stun.TransactionID, stun.BindingRequest)
+	started := time.Now()
+	if _, err := conn.WriteToUDP(req.Raw, raddr); err != nil {
+		return nil, 0, err
+	}
+	conn.SetReadDeadline(started.Add(timeout))
+	buf := make([]byte, 1500)
+	for {
+		n, _, err := conn.ReadFromUDP(buf)
+		if err != nil {
+			return nil, 0, fmt.Errorf("no answer: %w", err)
+		}
+		res := &stun.Message{Raw: append([]byte(nil), buf[:n]...)}
+		// late answers of earlier servers are skipped
+		if res.Decode() != nil || res.TransactionID != req.TransactionID {
+			continue
+		}
+		var xor stun.XORMappedAddress
+		if err := xor.GetFrom(res); err != nil {
+			return nil, 0, fmt.Errorf("invalid answer: %w", err)
+		}
+		return &net.UDPAddr{IP: xor.IP, Port: xor.Port}, time.Since(started), nil
+	}
+}
+
+// ProbeBroadcast sends a UDP broadcast to every broadcast address discovery
+// uses and reports how many could be sent and whether one came back to us,
+// which shows the firewall lets broadcasts in as well as out
+func ProbeBroadcast(timeout time.Duration) (sent int, heard bool, err error) {
+	ln, err := net.ListenUDP("udp4", &net.UDPAddr{IP: net.IPv4zero})
+	if err != nil {
+		return 0, false, fmt.Errorf("failed to open UDP socket: %w", err)
+	}
+	defer ln.Close()
+	port := ln.LocalAddr().(*net.UDPAddr).Port
+
+	conn, err := net.ListenUDP("udp4", &net.UDPAddr{IP: net.IPv4zero})
+	if err != nil {
+		return 0, false, fmt.Errorf("failed to open UDP socket: %w", err)
+	}
+	defer conn.Close()
+	if err := setBroadcastSocket(conn); err != nil {
+		return 0, false, fmt.Errorf("broadcast not allowed on socket: %w", err)
+	}
+
+	nonce := make([]byte, 16)
+	rand.Read(nonce)
+	probe := []byte("execp2p_probe " + hex.EncodeToString(nonce))
+
+	var lastErr error
+	for _, addr := range getBroadcastAddresses() {
+		host, _, err := net.SplitHostPort(addr)
+		if err != nil {
+			continue
+		}
+		if _, err := conn.WriteToUDP(probe, &net.UDPAddr{IP: net.ParseIP(host), Port: port}); err != nil {
+			lastErr = err
+			continue
+		}
+		sent++
+	}
+	if sent == 0 {
+		return 0, false, fmt.Errorf("no broadcast could be sent: %w", lastErr)
+	}
+
+	ln.SetReadDeadline(time.Now().Add(timeout))
+	buf := make([]byte, 256)
+	for {
+		n, _, err := ln.ReadFromUDP(buf)
+		if err != nil {
+			return sent, false, nil
+		}
+		if bytes.Equal(buf[:n], probe) {
+			return sent, true, nil
+		}
+	}
+}
+
+// ProbeDHT bootstraps a throw-away DHT node and reports how many nodes
+// answered out of those asked
+func ProbeDHT(ctx context.Context, timeout time.Duration) (tried, answered int, err error) {
+	conn, err := net.ListenPacket("udp", ":0")
+	if err != nil {
+		return 0, 0, fmt.Errorf("failed to listen for dht: %w", err)
+	}
+	config := dht.NewDefaultServerConfig()
+	config.Conn = conn
+	config.NoSecurity = true
+	s, err := dht.NewServer(config)
+	if err != nil {
+		conn.Close()
+		return 0, 0, fmt.Errorf("failed to create dht server: %w", err)
+	}
+	defer s.Close()
+
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+	stats, err := s.BootstrapContext(ctx)
+	if err != nil && !errors.Is(err, context.DeadlineExceeded) {
+		return int(stats.NumAddrsTried), int(stats.NumResponses), err
+	}
+	return int(stats.NumAddrsTried), int(stats.NumResponses), nil
+}
+
+// ProbeSignalingServer checks that the server answers its room list
+func ProbeSignalingServer(ctx context.Context, config *SignalingServerConfig) error {
+	if config.ServerURL == "" {
+		return errors.New("no signaling server configured")
+	}
+	ctx, cancel := context.WithTimeout(ctx, config.RequestTimeout)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, strings.TrimSuffix(config.ServerURL, "/")+"/api/rooms", nil)
+	if err != nil {
+		return err
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("server answered %s", resp.Status)
+	}
+	var rooms []RoomInfo
+	if err := json.NewDecoder(resp.Body).Decode(&rooms); err != nil {
+		return fmt.Errorf("not an ExecP2P signaling server: %w", err)
+	}
+	return nil
+}
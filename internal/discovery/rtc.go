@@ -0,0 +1,135 @@
+package discovery
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"time"
+
+	"execp2p/internal/network"
+)
+
+// rtcAnswerPoll to odstęp między pytaniami gościa o odpowiedź gospodarza
+const rtcAnswerPoll = 500 * time.Millisecond
+
+// RTCSignaling wymienia SDP sesji WebRTC przez serwer sygnalizacyjny
+// (network.RTCSignaler). Oferty pokoju odbiera gospodarz z tokenem, który
+// serwer wiąże z pokojem przy pierwszym odbiorze.
+type RTCSignaling struct {
+	config    *SignalingServerConfig
+	client    *http.Client
+	hostToken string
+}
+
+// NewRTCSignaling tworzy klienta wymiany SDP z nowym tokenem gospodarza
+func NewRTCSignaling(config *SignalingServerConfig) *RTCSignaling {
+	token := make([]byte, 16)
+	rand.Read(token)
+	return &RTCSignaling{
+		config:    config,
+		client:    &http.Client{},
+		hostToken: hex.EncodeToString(token),
+	}
+}
+
+// Offer zostawia ofertę gościa dla gospodarza pokoju
+func (s *RTCSignaling) Offer(ctx context.Context, roomID string, offer network.RTCOffer) error {
+	_, err := s.do(ctx, "POST", s.path(roomID, "offer"), false, offer, nil)
+	return err
+}
+
+// Answer czeka na odpowiedź gospodarza na ofertę sesji
+func (s *RTCSignaling) Answer(ctx context.Context, roomID, session string) (string, error) {
+	for {
+		var answer struct {
+			SDP string `json:"sdp"`
+		}
+		status, err := s.do(ctx, "GET", s.path(roomID, "answer", session), false, nil, &answer)
+		if err != nil {
+			return "", err
+		}
+		if status == http.StatusOK {
+			return answer.SDP, nil
+		}
+		select {
+		case <-ctx.Done():
+			return "", ctx.Err()
+		case <-time.After(rtcAnswerPoll):
+		}
+	}
+}
+
+// Offers odbiera oferty zostawione dla gospodarza pokoju
+func (s *RTCSignaling) Offers(ctx context.Context, roomID string) ([]network.RTCOffer, error) {
+	var offers []network.RTCOffer
+	if _, err := s.do(ctx, "GET", s.path(roomID, "offers"), true, nil, &offers); err != nil {
+		return nil, err
+	}
+	return offers, nil
+}
+
+// Reply zostawia odpowiedź gospodarza na ofertę sesji
+func (s *RTCSignaling) Reply(ctx context.Context, roomID, session, sdp string) error {
+	body := map[string]string{"sdp": sdp}
+	_, err := s.do(ctx, "POST", s.path(roomID, "answer", session), true, body, nil)
+	return err
+}
+
+func (s *RTCSignaling) path(roomID string, parts ...string) string {
+	p := s.config.ServerURL + "/api/rtc/" + url.PathEscape(roomID)
+	for _, part := range parts {
+		p += "/" + url.PathEscape(part)
+	}
+	return p
+}
+
+// do wysyła żądanie i dekoduje odpowiedź 200 do out; 204 nie jest błędem
+func (s *RTCSignaling) do(ctx context.Context, method, reqURL string, asHost bool, in, out any) (int, error) {
+	var body io.Reader
+	if in != nil {
+		data, err := json.Marshal(in)
+		if err != nil {
+			return 0, fmt.Errorf("błąd serializacji SDP: %w", err)
+		}
+		body = bytes.NewReader(data)
+	}
+	httpCtx, cancel := context.WithTimeout(ctx, s.config.RequestTimeout)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(httpCtx, method, reqURL, body)
+	if err != nil {
+		return 0, fmt.Errorf("błąd tworzenia żądania HTTP: %w", err)
+	}
+	if in != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	if asHost {
+		req.Header.Set("X-RTC-Host-Token", s.hostToken)
+	}
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return 0, fmt.Errorf("nie udało się połączyć z serwerem sygnalizacyjnym: %w", err)
+	}
+	defer resp.Body.Close()
+
+	switch resp.StatusCode {
+	case http.StatusOK:
+		if out != nil {
+			if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+				return resp.StatusCode, fmt.Errorf("błąd parsowania odpowiedzi JSON: %w", err)
+			}
+		}
+		return resp.StatusCode, nil
+	case http.StatusNoContent:
+		return resp.StatusCode, nil
+	default:
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return resp.StatusCode, fmt.Errorf("serwer zwrócił błąd: %d - %s", resp.StatusCode, bytes.TrimSpace(msg))
+	}
+}
@@ -9,6 +9,7 @@ import (
 	"net/http"
 	"time"
 
+	"execp2p/internal/crash"
 	"execp2p/internal/logger"
 )
 
@@ -191,6 +192,45 @@ func AnnounceExternalAddress(ctx context.Context, config *SignalingServerConfig,
 	}
 }
 
+// AnnounceSignaling co jakiś czas rejestruje pokój na serwerze
+// sygnalizacyjnym pod bieżącym zewnętrznym adresem, tak by goście znaleźli
+// gospodarza także po restarcie którejkolwiek ze stron
+func AnnounceSignaling(ctx context.Context, config *SignalingServerConfig, roomID string, port int, cadence *Cadence) {
+	defer crash.Recover("discovery.AnnounceSignaling")
+	if cadence == nil {
+		cadence, _ = NewCadence(OccupiedKeep, DHTAnnounceInterval, 0)
+	}
+
+	for {
+		if !cadence.WaitActive(ctx) {
+			logger.L().Info("Koniec ogłaszania na serwerze sygnalizacyjnym")
+			return
+		}
+		if addr, err := externalAddr(port); err != nil {
+			logger.L().Warn("Nie udało się ustalić zewnętrznego adresu", "err", err)
+		} else if err := RegisterRoomOnSignalingServer(ctx, config, roomID, addr); err != nil {
+			logger.L().Warn("Nie udało się zarejestrować na serwerze sygnalizacyjnym", "err", err)
+		}
+
+		if !cadence.Wait(ctx) {
+			logger.L().Info("Koniec ogłaszania na serwerze sygnalizacyjnym")
+			return
+		}
+	}
+}
+
+// externalAddr zwraca zewnętrzny adres IP:port, przez STUN lub z zewnętrznego IP
+func externalAddr(port int) (string, error) {
+	if addr, err := ExternalUDPAddr(port); err == nil {
+		return addr, nil
+	}
+	ip, err := GetExternalIP()
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("%s:%d", ip, port), nil
+}
+
 // ConnectWithSignalingServer próbuje nawiązać połączenie przez serwer sygnalizacyjny
 func ConnectWithSignalingServer(ctx context.Context, config *SignalingServerConfig, roomID string, localPort int) (string, error) {
 	// Pobierz informacje o pokoju
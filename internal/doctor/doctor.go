@@ -0,0 +1,209 @@
+// Package doctor checks what the network allows ExecP2P to do: STUN and the
+// NAT type, UDP broadcast on the local network, the BitTorrent DHT and the
+// signaling server. From the results it tells which ways of joining a room
+// can be expected to work.
+package doctor
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"execp2p/internal/discovery"
+)
+
+// NAT types, by how the NAT maps our socket for different destinations
+const (
+	NATNone = "none"
+	// the same external address for every destination: hole punching works
+	NATEndpointIndependent = "endpoint_independent"
+	// a new external address per destination: hole punching rarely works
+	NATSymmetric = "symmetric"
+	// behind a NAT, but fewer than two STUN servers answered
+	NATUnknown = "unknown"
+	// no STUN server answered: UDP to the internet may be blocked
+	NATNoUDP = "udp_blocked"
+)
+
+// verdicts of a join strategy
+const (
+	Works    = "works"
+	MayWork  = "may_work"
+	WontWork = "wont_work"
+)
+
+// Options configures Run
+type Options struct {
+	STUNServers []string
+	// empty skips the signaling check
+	SignalingServer string
+	// bounds each STUN request and the broadcast check
+	ProbeTimeout time.Duration
+	// bounds the DHT bootstrap, which asks many nodes
+	DHTTimeout time.Duration
+}
+
+// Check is the outcome of one probe
+type Check struct {
+	OK      bool   `json:"ok"`
+	Skipped bool   `json:"skipped,omitempty"`
+	Detail  string `json:"detail"`
+}
+
+// Strategy is how a way of joining is expected to fare
+type Strategy struct {
+	Name    string `json:"name"`
+	Verdict string `json:"verdict"`
+	Reason  string `json:"reason"`
+}
+
+// Report is the outcome of Run
+type Report struct {
+	STUN *discovery.STUNProbe `json:"stun"`
+	NAT  string               `json:"nat"`
+	// our address on the internet, if a STUN server told it
+	ExternalAddr string     `json:"external_addr,omitempty"`
+	Broadcast    Check      `json:"broadcast"`
+	DHT          Check      `json:"dht"`
+	Signaling    Check      `json:"signaling"`
+	Strategies   []Strategy `json:"strategies"`
+}
+
+// Run performs the checks, concurrently, and judges the join strategies
+func Run(ctx context.Context, opts Options) *Report {
+	if opts.ProbeTimeout <= 0 {
+		opts.ProbeTimeout = 3 * time.Second
+	}
+	if opts.DHTTimeout <= 0 {
+		opts.DHTTimeout = 15 * time.Second
+	}
+	r := &Report{}
+
+	var wg sync.WaitGroup
+	run := func(f func()) {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			f()
+		}()
+	}
+	run(func() {
+		probe, err := discovery.ProbeSTUN(ctx, opts.STUNServers, opts.ProbeTimeout)
+		if err != nil {
+			probe = &discovery.STUNProbe{Results: []discovery.STUNResult{{Error: err.Error()}}}
+		}
+		r.STUN = probe
+		r.NAT, r.ExternalAddr = classifyNAT(probe)
+	})
+	run(func() { r.Broadcast = checkBroadcast(opts.ProbeTimeout) })
+	run(func() { r.DHT = checkDHT(ctx, opts.DHTTimeout) })
+	run(func() { r.Signaling = checkSignaling(ctx, opts.SignalingServer) })
+	wg.Wait()
+
+	r.Strategies = r.judge()
+	return r
+}
+
+// classifyNAT compares the addresses the STUN servers saw
+func classifyNAT(p *discovery.STUNProbe) (nat, external string) {
+	var mapped []string
+	for _, res := range p.Results {
+		if res.MappedAddr != "" {
+			mapped = append(mapped, res.MappedAddr)
+		}
+	}
+	if len(mapped) == 0 {
+		return NATNoUDP, ""
+	}
+	for _, addr := range mapped[1:] {
+		if addr != mapped[0] {
+			return NATSymmetric, mapped[0]
+		}
+	}
+	switch {
+	case p.Public:
+		return NATNone, mapped[0]
+	case len(mapped) == 1:
+		return NATUnknown, mapped[0]
+	}
+	return NATEndpointIndependent, mapped[0]
+}
+
+func checkBroadcast(timeout time.Duration) Check {
+	sent, heard, err := discovery.ProbeBroadcast(timeout)
+	switch {
+	case err != nil:
+		return Check{Detail: err.Error()}
+	case !heard:
+		return Check{Detail: fmt.Sprintf("sent to %d broadcast addresses, but none came back; a firewall may drop incoming broadcasts", sent)}
+	}
+	return Check{OK: true, Detail: fmt.Sprintf("sent to %d broadcast addresses and received back", sent)}
+}
+
+func checkDHT(ctx context.Context, timeout time.Duration) Check {
+	tried, answered, err := discovery.ProbeDHT(ctx, timeout)
+	switch {
+	case err != nil:
+		return Check{Detail: err.Error()}
+	case answered == 0:
+		return Check{Detail: fmt.Sprintf("none of %d nodes answered; bootstrap nodes unreachable or UDP blocked", tried)}
+	}
+	return Check{OK: true, Detail: fmt.Sprintf("%d of %d nodes answered", answered, tried)}
+}
+
+func checkSignaling(ctx context.Context, url string) Check {
+	if url == "" {
+		return Check{Skipped: true, Detail: "no signaling server configured"}
+	}
+	if err := discovery.ProbeSignalingServer(ctx, discovery.NewSignalingConfig(url)); err != nil {
+		return Check{Detail: fmt.Sprintf("%s: %v", url, err)}
+	}
+	return Check{OK: true, Detail: url + " answers"}
+}
+
+// judge tells which join strategies can be expected to work, in the order
+// JoinRoom tries them
+func (r *Report) judge() []Strategy {
+	var out []Strategy
+
+	direct := Strategy{Name: "direct address", Verdict: Works, Reason: "QUIC over UDP to an address you are given"}
+	switch r.NAT {
+	case NATNoUDP:
+		direct = Strategy{Name: "direct address", Verdict: MayWork, Reason: "only on the local network: UDP to the internet seems blocked"}
+	case NATNone:
+		direct.Reason += "; others can also dial you, you are not behind a NAT"
+	default:
+		direct.Reason += "; others can only dial you if you host with a forwarded port"
+	}
+	out = append(out, direct)
+
+	if r.Broadcast.OK {
+		out = append(out, Strategy{Name: "local network discovery", Verdict: Works, Reason: "UDP broadcast gets through"})
+	} else {
+		out = append(out, Strategy{Name: "local network discovery", Verdict: MayWork, Reason: "UDP broadcast failed, only mDNS is left: " + r.Broadcast.Detail})
+	}
+
+	if r.DHT.OK {
+		out = append(out, Strategy{Name: "DHT", Verdict: Works, Reason: "the DHT is reachable; the host must be reachable too"})
+	} else {
+		out = append(out, Strategy{Name: "DHT", Verdict: WontWork, Reason: r.DHT.Detail})
+	}
+
+	out = append(out, Strategy{Name: "same machine", Verdict: Works, Reason: "rooms hosted on this machine are found on localhost"})
+
+	signaling := Strategy{Name: "signaling and hole punching"}
+	switch {
+	case !r.Signaling.OK:
+		signaling.Verdict, signaling.Reason = WontWork, r.Signaling.Detail
+	case r.NAT == NATNoUDP:
+		signaling.Verdict, signaling.Reason = WontWork, "UDP to the internet seems blocked"
+	case r.NAT == NATSymmetric:
+		signaling.Verdict, signaling.Reason = MayWork, "a symmetric NAT changes the port per destination, so holes rarely line up"
+	case r.NAT == NATUnknown:
+		signaling.Verdict, signaling.Reason = MayWork, "the NAT type could not be told with a single STUN answer"
+	default:
+		signaling.Verdict, signaling.Reason = Works, "the server answers and the NAT keeps one external address"
+	}
+	return append(out, signaling)
+}
@@ -0,0 +1,90 @@
+package emoji
+
+import (
+	"errors"
+	"sync"
+
+	"execp2p/internal/logger"
+	"execp2p/internal/storage"
+)
+
+// BucketName is the storage bucket shortcode images are cached in
+const BucketName = "emoji"
+
+// Cache holds shortcode images and profile avatars by hash. Images are kept
+// in memory and, when a bucket is given, in the encrypted local database so
+// they aren't fetched again in the next session. While an incognito room is active the database
+// refuses writes and images stay in memory.
+type Cache struct {
+	mu     sync.RWMutex
+	assets map[string]*Asset
+	bucket *storage.Bucket
+}
+
+// NewCache returns a cache backed by bucket, which may be nil
+func NewCache(bucket *storage.Bucket) *Cache {
+	return &Cache{assets: make(map[string]*Asset), bucket: bucket}
+}
+
+// Get returns the image with the given hash
+func (c *Cache) Get(hash string) (*Asset, bool) {
+	c.mu.RLock()
+	asset, ok := c.assets[hash]
+	c.mu.RUnlock()
+	if ok {
+		return asset, true
+	}
+	if c.bucket == nil {
+		return nil, false
+	}
+
+	data, ok := c.bucket.Get(hash)
+	if !ok {
+		return nil, false
+	}
+	// whatever is on disk is checked like an image from the network
+	asset, err := NewAsset(data)
+	if err != nil || asset.Hash != hash {
+		logger.L().Warn("Dropping corrupt cached shortcode image", "hash", hash)
+		c.bucket.Delete(hash)
+		return nil, false
+	}
+
+	c.mu.Lock()
+	c.assets[hash] = asset
+	c.mu.Unlock()
+	return asset, true
+}
+
+// Has reports whether the image with the given hash is cached
+func (c *Cache) Has(hash string) bool {
+	_, ok := c.Get(hash)
+	return ok
+}
+
+// Put caches an image
+func (c *Cache) Put(asset *Asset) {
+	c.mu.Lock()
+	c.assets[asset.Hash] = asset
+	c.mu.Unlock()
+
+	if c.bucket == nil {
+		return
+	}
+	if err := c.bucket.Put(asset.Hash, asset.Data); err != nil && !errors.Is(err, storage.ErrIncognito) {
+		logger.L().Warn("Failed to store shortcode image", "hash", asset.Hash, "err", err)
+	}
+}
+
+// Accept checks an image received for a registry entry and caches it
+func (c *Cache) Accept(want string, data []byte) (*Asset, error) {
+	asset, err := NewAsset(data)
+	if err != nil {
+		return nil, err
+	}
+	if asset.Hash != want {
+		return nil, ErrHashMismatch
+	}
+	c.Put(asset)
+	return asset, nil
+}
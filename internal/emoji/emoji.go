@@ -0,0 +1,204 @@
+// Package emoji keeps a room's custom shortcodes. The host maps :codes: to
+// small images; the mapping (code → SHA-256 of the image) travels in the
+// signed room metadata, while the images themselves are fetched from the host
+// once and cached by hash, so every participant renders the same picture and
+// a forged image never matches a signed hash.
+package emoji
+
+import (
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/http"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+
+	"execp2p/internal/crypto"
+)
+
+// MaxImageBytes caps a single shortcode image
+const MaxImageBytes = 64 << 10
+
+// MaxShortcodes caps the number of shortcodes in a room
+const MaxShortcodes = 64
+
+var (
+	// ErrInvalidCode means the shortcode name is not allowed
+	ErrInvalidCode = errors.New("shortcode must be 2-32 characters of a-z, 0-9, _, + or -")
+	// ErrTooLarge means the image exceeds MaxImageBytes
+	ErrTooLarge = fmt.Errorf("shortcode image exceeds %d KB", MaxImageBytes>>10)
+	// ErrUnsupportedImage means the image is not PNG, GIF, WebP or JPEG
+	ErrUnsupportedImage = errors.New("shortcode image must be PNG, GIF, WebP or JPEG")
+	// ErrRegistryFull means the room already has MaxShortcodes shortcodes
+	ErrRegistryFull = fmt.Errorf("a room can have at most %d shortcodes", MaxShortcodes)
+	// ErrHashMismatch means an image doesn't match the hash in the registry
+	ErrHashMismatch = errors.New("shortcode image does not match the signed hash")
+)
+
+var codePattern = regexp.MustCompile(`^[a-z0-9_+-]{2,32}$`)
+
+var allowedMIME = map[string]bool{
+	"image/png":  true,
+	"image/gif":  true,
+	"image/webp": true,
+	"image/jpeg": true,
+}
+
+// NormalizeCode strips the surrounding colons and lowercases a shortcode
+func NormalizeCode(code string) (string, error) {
+	code = strings.ToLower(strings.Trim(strings.TrimSpace(code), ":"))
+	if !codePattern.MatchString(code) {
+		return "", ErrInvalidCode
+	}
+	return code, nil
+}
+
+// Asset is a shortcode image
+type Asset struct {
+	Hash string
+	MIME string
+	Data []byte
+}
+
+// NewAsset checks an image and computes its hash. The MIME type is sniffed
+// from the content, never taken from the sender.
+func NewAsset(data []byte) (*Asset, error) {
+	if len(data) == 0 {
+		return nil, ErrUnsupportedImage
+	}
+	if len(data) > MaxImageBytes {
+		return nil, ErrTooLarge
+	}
+	mime := http.DetectContentType(data)
+	if !allowedMIME[mime] {
+		return nil, ErrUnsupportedImage
+	}
+	sum := sha256.Sum256(data)
+	return &Asset{Hash: hex.EncodeToString(sum[:]), MIME: mime, Data: data}, nil
+}
+
+// DataURL returns the image as a data: URL for the frontend
+func (a *Asset) DataURL() string {
+	return "data:" + a.MIME + ";base64," + base64.StdEncoding.EncodeToString(a.Data)
+}
+
+// Registry maps shortcodes to image hashes. On the host it is the source of
+// the signed list; on guests it mirrors the last verified room metadata.
+type Registry struct {
+	mu    sync.RWMutex
+	codes map[string]crypto.RoomShortcode
+}
+
+// NewRegistry returns an empty registry
+func NewRegistry() *Registry {
+	return &Registry{codes: make(map[string]crypto.RoomShortcode)}
+}
+
+// Set maps code to asset, replacing a previous image for the same code
+func (r *Registry) Set(code string, asset *Asset) (crypto.RoomShortcode, error) {
+	code, err := NormalizeCode(code)
+	if err != nil {
+		return crypto.RoomShortcode{}, err
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if _, ok := r.codes[code]; !ok && len(r.codes) >= MaxShortcodes {
+		return crypto.RoomShortcode{}, ErrRegistryFull
+	}
+	sc := crypto.RoomShortcode{Code: code, Hash: asset.Hash, MIME: asset.MIME, Size: len(asset.Data)}
+	r.codes[code] = sc
+	return sc, nil
+}
+
+// Remove deletes a shortcode and reports whether it existed
+func (r *Registry) Remove(code string) bool {
+	code, err := NormalizeCode(code)
+	if err != nil {
+		return false
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	_, ok := r.codes[code]
+	delete(r.codes, code)
+	return ok
+}
+
+// Replace swaps the whole registry for the list from room metadata. Invalid
+// entries are skipped and returned as an error; the valid ones are kept.
+func (r *Registry) Replace(list []crypto.RoomShortcode) error {
+	codes := make(map[string]crypto.RoomShortcode, len(list))
+	var skipped []string
+	for _, sc := range list {
+		code, err := NormalizeCode(sc.Code)
+		if err != nil || !allowedMIME[sc.MIME] || !ValidHash(sc.Hash) ||
+			sc.Size <= 0 || sc.Size > MaxImageBytes || len(codes) >= MaxShortcodes {
+			skipped = append(skipped, sc.Code)
+			continue
+		}
+		sc.Code = code
+		codes[code] = sc
+	}
+
+	r.mu.Lock()
+	r.codes = codes
+	r.mu.Unlock()
+
+	if len(skipped) > 0 {
+		return fmt.Errorf("skipped invalid shortcodes: %s", strings.Join(skipped, ", "))
+	}
+	return nil
+}
+
+// Lookup returns the entry for a shortcode
+func (r *Registry) Lookup(code string) (crypto.RoomShortcode, bool) {
+	code, err := NormalizeCode(code)
+	if err != nil {
+		return crypto.RoomShortcode{}, false
+	}
+
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	sc, ok := r.codes[code]
+	return sc, ok
+}
+
+// HasHash reports whether any shortcode refers to hash
+func (r *Registry) HasHash(hash string) (crypto.RoomShortcode, bool) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	for _, sc := range r.codes {
+		if sc.Hash == hash {
+			return sc, true
+		}
+	}
+	return crypto.RoomShortcode{}, false
+}
+
+// List returns all shortcodes sorted by code
+func (r *Registry) List() []crypto.RoomShortcode {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	list := make([]crypto.RoomShortcode, 0, len(r.codes))
+	for _, sc := range r.codes {
+		list = append(list, sc)
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].Code < list[j].Code })
+	return list
+}
+
+// ValidHash reports whether hash has the form of an image hash
+func ValidHash(hash string) bool {
+	b, err := hex.DecodeString(hash)
+	return err == nil && len(b) == sha256.Size
+}
@@ -0,0 +1,102 @@
+// Package frame is the framing of the ExecP2P wire protocol without a
+// transport: the frame every stream carries, its validation, protocol
+// version negotiation and the JSON and CBOR encodings (internal/wire). The
+// QUIC transport (internal/network) builds on it, and so can a client on
+// another transport. Like internal/crypto and internal/wire, it has no
+// dependency that keeps it from compiling to WebAssembly
+// (GOOS=js GOARCH=wasm).
+package frame
+
+//go:generate go run execp2p/internal/wire/wiregen -schema ../wire/frames.cddl
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+
+	"execp2p/internal/crypto"
+	"execp2p/internal/wire"
+)
+
+const (
+	// TypeChunk is a piece of a chat frame too large for one
+	TypeChunk = "chunk"
+	// TypeMedia opens a stream carrying a media body after the frame
+	TypeMedia = "media"
+
+	// ChunkSize is the largest payload sent in one frame
+	ChunkSize = 64 << 10
+	// MaxSize is the largest frame read from a stream; above a full chunk
+	// and the largest control frame
+	MaxSize = 1 << 20
+)
+
+// Frame is what every stream carries, one per stream
+type Frame struct {
+	Type      string `json:"type"`
+	Payload   string `json:"payload"`
+	Timestamp int64  `json:"timestamp"`
+	SenderID  string `json:"sender_id"`
+	RoomID    string `json:"room_id"` // Identyfikator pokoju
+	// protocol versions the sender speaks, on frames opening a session
+	MinVersion int `json:"min_version,omitempty"`
+	MaxVersion int `json:"max_version,omitempty"`
+	// encoded into Payload in the format the frame is sent in (chunks)
+	Body wire.Codec `json:"-"`
+}
+
+// Chunk is one piece of a split frame, the payload of a chunk frame
+type Chunk struct {
+	// the same for every piece of the frame
+	ID    string `json:"id"`
+	Type  string `json:"type"`
+	Total int    `json:"total"`
+
+	Index int    `json:"index"`
+	Data  string `json:"data"`
+}
+
+// MemberProof is a guest's membership certificate with its proof of
+// identity, the payload of a memberproof frame
+type MemberProof struct {
+	Cert  *crypto.MembershipCert `json:"cert"`
+	Proof []byte                 `json:"proof"`
+}
+
+// Decode reads a frame in whichever encoding it is in, with how many bytes
+// that took; rest yields what follows it on the stream
+func Decode(r *bufio.Reader) (w Frame, rest io.Reader, n int64, err error) {
+	first, err := r.Peek(1)
+	if err != nil {
+		return w, nil, 0, err
+	}
+	f, ok := wire.Detect(first[0])
+	if !ok {
+		return w, nil, 0, fmt.Errorf("unknown frame encoding (first byte %#x)", first[0])
+	}
+	if f == wire.CBOR {
+		d := wire.NewDecoder(r, MaxSize)
+		err = w.DecodeCBOR(d)
+		return w, r, d.Offset(), err
+	}
+	// the decoder may read past the frame
+	dec := json.NewDecoder(io.LimitReader(r, MaxSize))
+	err = dec.Decode(&w)
+	return w, io.MultiReader(dec.Buffered(), r), dec.InputOffset(), err
+}
+
+// Encode encodes w in f, with our versions on a frame opening a session
+// and the payload of a chunk in f as well. A JSON frame is not followed by
+// a newline.
+func Encode(w Frame, f wire.Format) ([]byte, error) {
+	Stamp(&w)
+	if w.Body != nil {
+		payload, err := wire.Marshal(w.Body, f)
+		if err != nil {
+			return nil, err
+		}
+		w.Payload = string(payload)
+	}
+	return wire.Marshal(&w, f)
+}
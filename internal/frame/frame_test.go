@@ -0,0 +1,169 @@
+package frame
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"io"
+	"strings"
+	"testing"
+
+	"execp2p/internal/room"
+	"execp2p/internal/wire"
+)
+
+const testSender = "0123456789abcdef0123456789abcdef"
+
+func testRoomID(t *testing.T) string {
+	t.Helper()
+	id, err := room.GenerateRoomID()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return id
+}
+
+func TestValidate(t *testing.T) {
+	roomID := testRoomID(t)
+	valid := Frame{Type: "message", Payload: "abcdef", Timestamp: 1, SenderID: testSender, RoomID: roomID}
+
+	tests := []struct {
+		name  string
+		edit  func(w *Frame)
+		valid bool
+	}{
+		{"valid", func(w *Frame) {}, true},
+		{"no room", func(w *Frame) { w.RoomID = "" }, true},
+		{"versions", func(w *Frame) { w.Type, w.MinVersion, w.MaxVersion = "pake", 1, 2 }, true},
+		{"ping without payload", func(w *Frame) { w.Type, w.Payload = "ping", "" }, true},
+		{"leaving", func(w *Frame) { w.Type, w.Payload = "leaving", "" }, true},
+		{"chunk is not hex", func(w *Frame) { w.Type, w.Payload = TypeChunk, `{"id":"x"}` }, true},
+		{"largest message", func(w *Frame) { w.Payload = strings.Repeat("a", ChunkSize) }, true},
+
+		{"unknown type", func(w *Frame) { w.Type = "shell" }, false},
+		{"no type", func(w *Frame) { w.Type = "" }, false},
+		{"short sender", func(w *Frame) { w.SenderID = "abc" }, false},
+		{"long sender", func(w *Frame) { w.SenderID = strings.Repeat("a", maxSenderIDLen+1) }, false},
+		{"sender not hex", func(w *Frame) { w.SenderID = "0123456789abcdeg" }, false},
+		{"bad room", func(w *Frame) { w.RoomID = "room" }, false},
+		{"no timestamp", func(w *Frame) { w.Timestamp = 0 }, false},
+		{"negative timestamp", func(w *Frame) { w.Timestamp = -1 }, false},
+		{"min above max", func(w *Frame) { w.MinVersion, w.MaxVersion = 2, 1 }, false},
+		{"max only", func(w *Frame) { w.MaxVersion = 2 }, false},
+		{"negative version", func(w *Frame) { w.MinVersion, w.MaxVersion = -1, 1 }, false},
+		{"message too large", func(w *Frame) { w.Payload = strings.Repeat("a", ChunkSize+1) }, false},
+		{"no payload", func(w *Frame) { w.Payload = "" }, false},
+		{"payload not hex", func(w *Frame) { w.Payload = "hello" }, false},
+		{"payload on leaving", func(w *Frame) { w.Type = "leaving" }, false},
+		{"long ping", func(w *Frame) { w.Type, w.Payload = "ping", strings.Repeat("a", 130) }, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := valid
+			tt.edit(&w)
+			err := Validate(w)
+			if tt.valid && err != nil {
+				t.Fatalf("rejected: %v", err)
+			}
+			if !tt.valid && !errors.Is(err, ErrMalformed) {
+				t.Fatalf("got %v, want ErrMalformed", err)
+			}
+		})
+	}
+}
+
+func TestEncodeDecode(t *testing.T) {
+	roomID := testRoomID(t)
+	for _, f := range []wire.Format{wire.JSON, wire.CBOR} {
+		t.Run(f.String(), func(t *testing.T) {
+			w := Frame{Type: "pake", Payload: "00ff", Timestamp: 1700000000, SenderID: testSender, RoomID: roomID}
+			data, err := Encode(w, f)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got, ok := wire.Detect(data[0]); !ok || got != f {
+				t.Fatalf("detected %v, want %v", got, f)
+			}
+
+			// a media body follows the frame on its stream
+			r := bufio.NewReader(io.MultiReader(bytes.NewReader(data), strings.NewReader("body")))
+			got, rest, n, err := Decode(r)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if n != int64(len(data)) {
+				t.Errorf("read %d bytes, want %d", n, len(data))
+			}
+			// a session-opening frame is stamped with our versions
+			w.MinVersion, w.MaxVersion = MinProtocolVersion, ProtocolVersion
+			if got != w {
+				t.Errorf("got %+v, want %+v", got, w)
+			}
+			if body, _ := io.ReadAll(rest); string(body) != "body" {
+				t.Errorf("rest %q, want %q", body, "body")
+			}
+		})
+	}
+}
+
+func TestEncodeChunk(t *testing.T) {
+	roomID := testRoomID(t)
+	c := &Chunk{ID: "c1", Type: "message", Total: 3, Index: 1, Data: "abcd"}
+	for _, f := range []wire.Format{wire.JSON, wire.CBOR} {
+		t.Run(f.String(), func(t *testing.T) {
+			data, err := Encode(Frame{Type: TypeChunk, Timestamp: 1, SenderID: testSender, RoomID: roomID, Body: c}, f)
+			if err != nil {
+				t.Fatal(err)
+			}
+			w, _, _, err := Decode(bufio.NewReader(bytes.NewReader(data)))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err := Validate(w); err != nil {
+				t.Fatal(err)
+			}
+			var got Chunk
+			if err := wire.Unmarshal([]byte(w.Payload), &got); err != nil {
+				t.Fatal(err)
+			}
+			if got != *c {
+				t.Errorf("got %+v, want %+v", got, *c)
+			}
+		})
+	}
+}
+
+func TestDecodeMalformed(t *testing.T) {
+	w := Frame{Type: "message", Payload: "abcd", Timestamp: 1, SenderID: testSender}
+	data, err := Encode(w, wire.CBOR)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, in := range [][]byte{
+		[]byte("garbage"),
+		data[:len(data)-3],
+	} {
+		if _, _, _, err := Decode(bufio.NewReader(bytes.NewReader(in))); err == nil {
+			t.Errorf("%x decoded", in)
+		}
+	}
+}
+
+func TestNegotiate(t *testing.T) {
+	tests := []struct {
+		min, max int
+		want     int
+		ok       bool
+	}{
+		{1, 1, 1, true},
+		{1, 2, 2, true},
+		{1, 5, ProtocolVersion, true},
+		{3, 5, 0, false},
+	}
+	for _, tt := range tests {
+		got, ok := Negotiate(tt.min, tt.max)
+		if got != tt.want || ok != tt.ok {
+			t.Errorf("Negotiate(%d, %d) = %d, %v, want %d, %v", tt.min, tt.max, got, ok, tt.want, tt.ok)
+		}
+	}
+}
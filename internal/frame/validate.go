@@ -0,0 +1,97 @@
+package frame
+
+import (
+	"errors"
+	"fmt"
+
+	"execp2p/internal/room"
+)
+
+// Wire validation.
+//
+// Every field of a frame comes from the peer. Before any handler sees a
+// frame, Validate checks that its type is one we know, that the
+// sender and room IDs have the shape ours have, that it is timestamped and
+// that its payload is encoded as its type's is and not larger than its type
+// ever needs. A frame that fails is a protocol violation: the connection is
+// closed (internal/network) as for a forged announcement.
+
+// limits of the sender ID; ours are 32 hex digits (16 random bytes)
+const (
+	minSenderIDLen = 8
+	maxSenderIDLen = 64
+)
+
+// frameRule is what a frame type's payload looks like
+type frameRule struct {
+	// longest payload, in bytes of the JSON string
+	maxPayload int
+	// the payload must be present
+	required bool
+	// the payload is hex-encoded
+	hex bool
+}
+
+// rules has an entry for every frame type we handle
+var rules = map[string]frameRule{
+	"pake":         {maxPayload: 4 << 10, required: true, hex: true},
+	"pakeconfirm":  {maxPayload: 4 << 10, required: true, hex: true},
+	"memberproof":  {maxPayload: 128 << 10, required: true, hex: true},
+	"membercert":   {maxPayload: 128 << 10, required: true, hex: true},
+	"memberdenied": {maxPayload: 0},
+	"announcement": {maxPayload: 128 << 10, required: true, hex: true},
+	"keyexchange":  {maxPayload: 128 << 10, required: true, hex: true},
+	"roommeta":     {maxPayload: 256 << 10, required: true, hex: true},
+	// the liveness ping has no payload, a reachability probe's is its ID
+	"ping":    {maxPayload: 128, hex: true},
+	"pong":    {maxPayload: 128, hex: true},
+	"leaving": {maxPayload: 0},
+	// larger chat payloads are sent as chunks
+	"message": {maxPayload: ChunkSize, required: true, hex: true},
+	TypeMedia: {maxPayload: ChunkSize, required: true, hex: true},
+	// an encoded chunk carrying up to ChunkSize of the payload
+	TypeChunk: {maxPayload: ChunkSize + 1<<10, required: true},
+}
+
+// ErrMalformed is wrapped by every validation failure
+var ErrMalformed = errors.New("malformed frame")
+
+// Validate checks w before it is handled
+func Validate(w Frame) error {
+	rule, ok := rules[w.Type]
+	if !ok {
+		return fmt.Errorf("%w: unknown type %.32q", ErrMalformed, w.Type)
+	}
+	if n := len(w.SenderID); n < minSenderIDLen || n > maxSenderIDLen || !IsHex(w.SenderID) {
+		return fmt.Errorf("%w: invalid sender ID in %s", ErrMalformed, w.Type)
+	}
+	if w.RoomID != "" && !room.ValidateRoomID(w.RoomID) {
+		return fmt.Errorf("%w: invalid room ID in %s", ErrMalformed, w.Type)
+	}
+	if w.Timestamp <= 0 {
+		return fmt.Errorf("%w: no timestamp in %s", ErrMalformed, w.Type)
+	}
+	if w.MinVersion < 0 || w.MinVersion > w.MaxVersion || (w.MinVersion == 0) != (w.MaxVersion == 0) {
+		return fmt.Errorf("%w: invalid protocol versions %d-%d in %s", ErrMalformed, w.MinVersion, w.MaxVersion, w.Type)
+	}
+	switch {
+	case len(w.Payload) > rule.maxPayload:
+		return fmt.Errorf("%w: %s payload of %d bytes exceeds %d", ErrMalformed, w.Type, len(w.Payload), rule.maxPayload)
+	case rule.required && w.Payload == "":
+		return fmt.Errorf("%w: %s without payload", ErrMalformed, w.Type)
+	case rule.hex && !IsHex(w.Payload):
+		return fmt.Errorf("%w: %s payload is not hex", ErrMalformed, w.Type)
+	}
+	return nil
+}
+
+// IsHex reports whether s has hex digits only
+func IsHex(s string) bool {
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		if !('0' <= c && c <= '9' || 'a' <= c && c <= 'f' || 'A' <= c && c <= 'F') {
+			return false
+		}
+	}
+	return true
+}
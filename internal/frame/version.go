@@ -0,0 +1,90 @@
+package frame
+
+import (
+	"errors"
+	"fmt"
+)
+
+// Wire protocol versions.
+//
+// The frames that open a session (pake, memberproof, announcement) carry
+// the range of wire protocol versions their sender speaks. Each side takes
+// the highest version both ranges share for the connection, so both agree
+// without another round trip. A peer sending no range predates the
+// exchange and speaks version 1. When the ranges don't overlap, the side
+// that notices closes the connection, and both report
+// ErrIncompatibleVersion, which a guest doesn't retry.
+//
+// A change to the frames or the crypto raises ProtocolVersion and is only
+// used with peers whose version allows it; dropping the old format raises
+// MinProtocolVersion.
+//
+// Version 2 encodes frames in CBOR (internal/wire) instead of JSON. Frames
+// sent before the version is agreed are JSON; a receiver tells the two
+// apart by their first byte.
+
+const (
+	// ProtocolVersion is the newest version we speak
+	ProtocolVersion = 2
+	// MinProtocolVersion is the oldest version we still speak
+	MinProtocolVersion = 1
+	// CBORProtocolVersion is the first version with CBOR frames
+	CBORProtocolVersion = 2
+	// what a peer that sends no range speaks
+	legacyProtocolVersion = 1
+)
+
+// ErrIncompatibleVersion means we and the peer have no protocol version in
+// common
+var ErrIncompatibleVersion = errors.New("niezgodna wersja protokołu")
+
+// VersionError is reported when the peer's versions don't overlap ours.
+// errors.Is matches ErrIncompatibleVersion.
+type VersionError struct {
+	Min, Max         int
+	PeerMin, PeerMax int
+}
+
+func (e *VersionError) Error() string {
+	return fmt.Sprintf("%v: obsługiwane %d–%d, u drugiej strony %d–%d", ErrIncompatibleVersion, e.Min, e.Max, e.PeerMin, e.PeerMax)
+}
+
+func (e *VersionError) Unwrap() error { return ErrIncompatibleVersion }
+
+// versioned frames open a session and carry the sender's versions
+var versioned = map[string]bool{
+	"pake":         true,
+	"memberproof":  true,
+	"announcement": true,
+}
+
+// OpensSession reports whether frames of type t open a session and carry
+// the sender's versions
+func OpensSession(t string) bool {
+	return versioned[t]
+}
+
+// PeerVersions returns the versions the sender of w speaks
+func PeerVersions(w Frame) (int, int) {
+	if w.MinVersion == 0 && w.MaxVersion == 0 {
+		return legacyProtocolVersion, legacyProtocolVersion
+	}
+	return w.MinVersion, w.MaxVersion
+}
+
+// Negotiate returns the version to speak with a peer that speaks
+// [peerMin, peerMax], and false when there is none
+func Negotiate(peerMin, peerMax int) (int, bool) {
+	v := min(ProtocolVersion, peerMax)
+	if v < max(MinProtocolVersion, peerMin) {
+		return 0, false
+	}
+	return v, true
+}
+
+// Stamp adds our versions to a frame that opens a session
+func Stamp(w *Frame) {
+	if versioned[w.Type] {
+		w.MinVersion, w.MaxVersion = MinProtocolVersion, ProtocolVersion
+	}
+}
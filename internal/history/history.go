@@ -0,0 +1,266 @@
+// Package history keeps the chat history in the encrypted local database:
+// one bucket per room, sealed like everything else in storage, so messages
+// survive a restart without ever being written in the clear. Incognito
+// rooms are never recorded.
+package history
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"execp2p/internal/logger"
+	"execp2p/internal/storage"
+)
+
+const (
+	// bucketPrefix starts the name of every room's history bucket; the
+	// rest is a hash of the room ID so file names don't reveal rooms
+	bucketPrefix = "history."
+	// indexBucket lists the rooms with history
+	indexBucket = "history"
+
+	// DefaultPageSize is the page size when none is given
+	DefaultPageSize = 50
+	// MaxPageSize caps a single page
+	MaxPageSize = 500
+)
+
+// Record is one stored message
+type Record struct {
+	MessageID  string    `json:"id"`
+	RoomID     string    `json:"room_id"`
+	SenderID   string    `json:"sender_id"`
+	SenderName string    `json:"sender_name,omitempty"`
+	Message    string    `json:"message"`
+	Outgoing   bool      `json:"outgoing"`
+	Timestamp  time.Time `json:"timestamp"`
+}
+
+// Page is a slice of a room's history, oldest first
+type Page struct {
+	Records []Record
+	// Next is the cursor for the page before this one, empty at the start of history
+	Next string
+}
+
+// Room summarizes a room with stored history
+type Room struct {
+	RoomID       string    `json:"room_id"`
+	Messages     int       `json:"messages"`
+	LastActivity time.Time `json:"last_activity"`
+}
+
+// Policy bounds how much history is kept
+type Policy struct {
+	// messages kept per room, oldest dropped first; 0 keeps all
+	MaxMessages int
+	// messages older than this are dropped; 0 keeps them forever
+	MaxAge time.Duration
+}
+
+// Store is the history of all rooms
+type Store struct {
+	db     *storage.DB
+	policy Policy
+
+	mu    sync.Mutex
+	index *storage.Bucket
+	// full-text indexes of the rooms searched so far, by bucket name
+	indexes map[string]*roomIndex
+}
+
+// Open returns the history kept in db and drops what the policy no longer allows
+func Open(db *storage.DB, policy Policy) (*Store, error) {
+	index, err := db.Bucket(indexBucket)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open history: %w", err)
+	}
+	s := &Store{db: db, policy: policy, index: index, indexes: make(map[string]*roomIndex)}
+	for _, room := range s.Rooms() {
+		if err := s.Prune(room.RoomID); err != nil && !errors.Is(err, storage.ErrIncognito) {
+			logger.L().Warn("History pruning failed", "err", err)
+		}
+	}
+	return s, nil
+}
+
+// Append stores a message. Storing the same message again overwrites it.
+func (s *Store) Append(rec Record) error {
+	if err := storage.Allow(rec.RoomID); err != nil {
+		return err
+	}
+	if rec.RoomID == "" || rec.MessageID == "" {
+		return fmt.Errorf("history record without room or message ID")
+	}
+	bucket, err := s.bucket(rec.RoomID)
+	if err != nil {
+		return err
+	}
+	key := recordKey(rec)
+	if err := bucket.PutJSON(key, rec); err != nil {
+		return err
+	}
+	s.indexed(rec.RoomID, func(ix *roomIndex) { ix.add(key, MessageText(rec.Message)) })
+	if err := s.prune(rec.RoomID, bucket); err != nil {
+		return err
+	}
+	return s.touch(rec.RoomID, bucket.Len(), rec.Timestamp)
+}
+
+// Page returns up to limit messages of a room older than the before cursor
+// (the Next of a previous page); an empty cursor starts at the newest message
+func (s *Store) Page(roomID, before string, limit int) (Page, error) {
+	if limit <= 0 {
+		limit = DefaultPageSize
+	}
+	if limit > MaxPageSize {
+		limit = MaxPageSize
+	}
+	bucket, err := s.bucket(roomID)
+	if err != nil {
+		return Page{}, err
+	}
+
+	keys := bucket.Keys()
+	end := len(keys)
+	if before != "" {
+		end = sort.SearchStrings(keys, before)
+	}
+	start := end - limit
+	if start < 0 {
+		start = 0
+	}
+
+	page := Page{Records: make([]Record, 0, end-start)}
+	for _, key := range keys[start:end] {
+		var rec Record
+		if ok, err := bucket.GetJSON(key, &rec); err != nil || !ok {
+			continue
+		}
+		page.Records = append(page.Records, rec)
+	}
+	if start > 0 {
+		page.Next = keys[start]
+	}
+	return page, nil
+}
+
+// Scan calls fn for every stored message of a room, oldest first, until fn returns false
+func (s *Store) Scan(roomID string, fn func(Record) bool) error {
+	bucket, err := s.bucket(roomID)
+	if err != nil {
+		return err
+	}
+	for _, key := range bucket.Keys() {
+		var rec Record
+		if ok, err := bucket.GetJSON(key, &rec); err != nil || !ok {
+			continue
+		}
+		if !fn(rec) {
+			return nil
+		}
+	}
+	return nil
+}
+
+// Rooms lists the rooms with stored history, most recently active first
+func (s *Store) Rooms() []Room {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var rooms []Room
+	for _, key := range s.index.Keys() {
+		var room Room
+		if ok, err := s.index.GetJSON(key, &room); err == nil && ok && room.Messages > 0 {
+			rooms = append(rooms, room)
+		}
+	}
+	sort.Slice(rooms, func(i, j int) bool { return rooms[i].LastActivity.After(rooms[j].LastActivity) })
+	return rooms
+}
+
+// DeleteRoom securely deletes a room's history
+func (s *Store) DeleteRoom(roomID string) error {
+	if err := s.db.DeleteBucket(bucketName(roomID)); err != nil {
+		return err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.indexes, bucketName(roomID))
+	return s.index.SecureDelete(bucketName(roomID))
+}
+
+// Prune drops a room's messages the policy no longer allows
+func (s *Store) Prune(roomID string) error {
+	bucket, err := s.bucket(roomID)
+	if err != nil {
+		return err
+	}
+	if err := s.prune(roomID, bucket); err != nil {
+		return err
+	}
+	return s.touch(roomID, bucket.Len(), time.Time{})
+}
+
+func (s *Store) prune(roomID string, bucket *storage.Bucket) error {
+	keys := bucket.Keys()
+	drop := 0
+	if s.policy.MaxMessages > 0 && len(keys) > s.policy.MaxMessages {
+		drop = len(keys) - s.policy.MaxMessages
+	}
+	if s.policy.MaxAge > 0 {
+		cutoff := recordKeyPrefix(time.Now().Add(-s.policy.MaxAge))
+		if n := sort.SearchStrings(keys, cutoff); n > drop {
+			drop = n
+		}
+	}
+	for _, key := range keys[:drop] {
+		if err := bucket.Delete(key); err != nil {
+			return err
+		}
+		s.indexed(roomID, func(ix *roomIndex) { ix.remove(key) })
+	}
+	return nil
+}
+
+// touch updates a room's entry in the index
+func (s *Store) touch(roomID string, messages int, activity time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	key := bucketName(roomID)
+	room := Room{RoomID: roomID}
+	s.index.GetJSON(key, &room)
+	room.Messages = messages
+	if activity.After(room.LastActivity) {
+		room.LastActivity = activity
+	}
+	return s.index.PutJSON(key, room)
+}
+
+func (s *Store) bucket(roomID string) (*storage.Bucket, error) {
+	if roomID == "" {
+		return nil, fmt.Errorf("no room given")
+	}
+	return s.db.Bucket(bucketName(roomID))
+}
+
+func bucketName(roomID string) string {
+	sum := sha256.Sum256([]byte(roomID))
+	return bucketPrefix + hex.EncodeToString(sum[:16])
+}
+
+// recordKey sorts records by time; the message ID keeps them unique
+func recordKey(rec Record) string {
+	return recordKeyPrefix(rec.Timestamp) + strings.ReplaceAll(rec.MessageID, ".", "_")
+}
+
+func recordKeyPrefix(t time.Time) string {
+	return fmt.Sprintf("%019d.", t.UnixNano())
+}
@@ -0,0 +1,197 @@
+package history
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"execp2p/internal/storage"
+)
+
+func openStore(t *testing.T, dir string, key []byte, policy Policy) (*Store, *storage.DB) {
+	t.Helper()
+	db, err := storage.Open(dir, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s, err := Open(db, policy)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return s, db
+}
+
+func record(room string, i int, at time.Time, text string) Record {
+	return Record{
+		MessageID: fmt.Sprintf("m%03d", i),
+		RoomID:    room,
+		SenderID:  "0123456789abcdef",
+		Message:   text,
+		Timestamp: at.Add(time.Duration(i) * time.Second),
+	}
+}
+
+func TestRoundTrip(t *testing.T) {
+	dir := t.TempDir()
+	key := make([]byte, 32)
+	now := time.Now().UTC()
+
+	s, db := openStore(t, dir, key, Policy{})
+	for i := 0; i < 120; i++ {
+		if err := s.Append(record("room-a", i, now, fmt.Sprintf("message %d", i))); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := s.Append(record("room-b", 0, now.Add(time.Hour), "later")); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	// nothing is stored in the clear
+	files, _ := filepath.Glob(filepath.Join(dir, "*"))
+	for _, f := range files {
+		data, _ := os.ReadFile(f)
+		if bytes.Contains(data, []byte("message 7")) {
+			t.Fatalf("%s holds a message in the clear", f)
+		}
+	}
+
+	s, db = openStore(t, dir, key, Policy{})
+	defer db.Close()
+	rooms := s.Rooms()
+	if len(rooms) != 2 || rooms[0].RoomID != "room-b" || rooms[1].Messages != 120 {
+		t.Fatalf("rooms %+v", rooms)
+	}
+
+	// pages walk back from the newest message
+	var got []Record
+	cursor := ""
+	for pages := 0; ; pages++ {
+		page, err := s.Page("room-a", cursor, 50)
+		if err != nil {
+			t.Fatal(err)
+		}
+		got = append(page.Records, got...)
+		if page.Next == "" {
+			if pages != 2 {
+				t.Fatalf("%d pages, want 3", pages+1)
+			}
+			break
+		}
+		cursor = page.Next
+	}
+	if len(got) != 120 {
+		t.Fatalf("%d records, want 120", len(got))
+	}
+	for i, rec := range got {
+		if want := record("room-a", i, now, fmt.Sprintf("message %d", i)); rec.MessageID != want.MessageID || rec.Message != want.Message || !rec.Timestamp.Equal(want.Timestamp) {
+			t.Fatalf("record %d is %+v, want %+v", i, rec, want)
+		}
+	}
+}
+
+func TestWrongKey(t *testing.T) {
+	dir := t.TempDir()
+	s, db := openStore(t, dir, make([]byte, 32), Policy{})
+	if err := s.Append(record("room", 0, time.Now(), "secret")); err != nil {
+		t.Fatal(err)
+	}
+	db.Close()
+
+	other := make([]byte, 32)
+	other[0] = 1
+	db, err := storage.Open(dir, other)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	if s, err := Open(db, Policy{}); err == nil {
+		if page, err := s.Page("room", "", 0); err == nil && len(page.Records) > 0 {
+			t.Fatal("history read with the wrong key")
+		}
+	}
+}
+
+func TestPolicy(t *testing.T) {
+	now := time.Now().UTC()
+	s, db := openStore(t, t.TempDir(), make([]byte, 32), Policy{MaxMessages: 10})
+	defer db.Close()
+	for i := 0; i < 25; i++ {
+		if err := s.Append(record("room", i, now, "text")); err != nil {
+			t.Fatal(err)
+		}
+	}
+	page, err := s.Page("room", "", 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(page.Records) != 10 || page.Records[0].MessageID != "m015" {
+		t.Fatalf("kept %d records from %s", len(page.Records), page.Records[0].MessageID)
+	}
+
+	aged, db2 := openStore(t, t.TempDir(), make([]byte, 32), Policy{MaxAge: time.Hour})
+	defer db2.Close()
+	aged.Append(record("room", 0, now.Add(-2*time.Hour), "old"))
+	aged.Append(record("room", 1, now, "new"))
+	page, _ = aged.Page("room", "", 0)
+	if len(page.Records) != 1 || page.Records[0].Message != "new" {
+		t.Fatalf("kept %+v", page.Records)
+	}
+}
+
+func TestIncognito(t *testing.T) {
+	s, db := openStore(t, t.TempDir(), make([]byte, 32), Policy{})
+	defer db.Close()
+	storage.SetIncognito("hidden", true)
+	t.Cleanup(func() { storage.SetIncognito("hidden", false) })
+	if err := s.Append(record("hidden", 0, time.Now(), "text")); !errors.Is(err, storage.ErrIncognito) {
+		t.Fatalf("got %v, want ErrIncognito", err)
+	}
+}
+
+func TestSearch(t *testing.T) {
+	now := time.Now().UTC()
+	s, db := openStore(t, t.TempDir(), make([]byte, 32), Policy{})
+	defer db.Close()
+	texts := []string{
+		"Zażółć gęślą jaźń",
+		`{"content":"meeting at noon","type":"text"}`,
+		"lunch at noon, then the meeting",
+		"nothing here",
+	}
+	for i, text := range texts {
+		if err := s.Append(record("room", i, now, text)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	tests := []struct {
+		query string
+		want  []string
+	}{
+		{"zazolc", []string{"m000"}},
+		{"MEETING noon", []string{"m002", "m001"}},
+		{"lunch meeting", []string{"m002"}},
+		{"type", nil},
+		{"", nil},
+	}
+	for _, tt := range tests {
+		matches, err := s.Search(tt.query, "room", 0)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var ids []string
+		for _, m := range matches {
+			ids = append(ids, m.MessageID)
+		}
+		if fmt.Sprint(ids) != fmt.Sprint(tt.want) {
+			t.Errorf("%q found %v, want %v", tt.query, ids, tt.want)
+		}
+	}
+}
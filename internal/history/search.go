@@ -0,0 +1,298 @@
+package history
+
+import (
+	"encoding/json"
+	"math"
+	"sort"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// The full-text index lives in memory only. It is built from the decrypted
+// history the first time a room is searched and kept up to date on Append,
+// so no plaintext (not even word lists) ever reaches the disk.
+
+const (
+	// DefaultSearchLimit is the number of matches when none is given
+	DefaultSearchLimit = 20
+	// MaxSearchLimit caps the matches of one search
+	MaxSearchLimit = 200
+
+	// minTokenLen drops one-letter words from the index
+	minTokenLen = 2
+	// snippetRunes is the length of the text shown around a match
+	snippetRunes = 80
+)
+
+// Match is one search result
+type Match struct {
+	Record
+	// higher is better; only comparable within one search
+	Score float64
+	// part of the message around the first matched word
+	Snippet string
+}
+
+// roomIndex is an inverted index of one room's messages
+type roomIndex struct {
+	// token -> record key -> occurrences
+	postings map[string]map[string]int
+	// record key -> its distinct tokens, to unindex it
+	docs map[string][]string
+}
+
+func newRoomIndex() *roomIndex {
+	return &roomIndex{postings: make(map[string]map[string]int), docs: make(map[string][]string)}
+}
+
+func (ix *roomIndex) add(key, text string) {
+	ix.remove(key)
+	counts := make(map[string]int)
+	for _, tok := range tokenize(text) {
+		counts[tok]++
+	}
+	if len(counts) == 0 {
+		return
+	}
+	tokens := make([]string, 0, len(counts))
+	for tok, n := range counts {
+		docs := ix.postings[tok]
+		if docs == nil {
+			docs = make(map[string]int)
+			ix.postings[tok] = docs
+		}
+		docs[key] = n
+		tokens = append(tokens, tok)
+	}
+	ix.docs[key] = tokens
+}
+
+func (ix *roomIndex) remove(key string) {
+	for _, tok := range ix.docs[key] {
+		delete(ix.postings[tok], key)
+		if len(ix.postings[tok]) == 0 {
+			delete(ix.postings, tok)
+		}
+	}
+	delete(ix.docs, key)
+}
+
+// score ranks the records containing every term (a term also matches longer
+// words it is a prefix of) by tf-idf
+func (ix *roomIndex) score(terms []string) map[string]float64 {
+	total := float64(len(ix.docs))
+	var scores map[string]float64
+	for _, term := range terms {
+		hits := make(map[string]float64)
+		for tok, docs := range ix.postings {
+			if !strings.HasPrefix(tok, term) {
+				continue
+			}
+			idf := math.Log(1 + total/float64(len(docs)))
+			// an exact word counts more than a prefix of a longer one
+			weight := 1.0
+			if tok != term {
+				weight = 0.5
+			}
+			for key, n := range docs {
+				hits[key] += weight * float64(n) * idf
+			}
+		}
+		if scores == nil {
+			scores = hits
+			continue
+		}
+		for key := range scores {
+			if s, ok := hits[key]; ok {
+				scores[key] += s
+			} else {
+				delete(scores, key)
+			}
+		}
+	}
+	return scores
+}
+
+// Search finds the stored messages containing every word of query, in one
+// room or, with an empty roomID, in all of them. The best matches come
+// first; equally good ones newest first.
+func (s *Store) Search(query, roomID string, limit int) ([]Match, error) {
+	if limit <= 0 {
+		limit = DefaultSearchLimit
+	}
+	if limit > MaxSearchLimit {
+		limit = MaxSearchLimit
+	}
+	terms := uniqueTerms(tokenize(query))
+	if len(terms) == 0 {
+		return nil, nil
+	}
+
+	rooms := []string{roomID}
+	if roomID == "" {
+		rooms = rooms[:0]
+		for _, room := range s.Rooms() {
+			rooms = append(rooms, room.RoomID)
+		}
+	}
+
+	type hit struct {
+		roomID, key string
+		score       float64
+	}
+	var hits []hit
+	for _, id := range rooms {
+		ix, err := s.roomIndex(id)
+		if err != nil {
+			return nil, err
+		}
+		s.mu.Lock()
+		for key, score := range ix.score(terms) {
+			hits = append(hits, hit{id, key, score})
+		}
+		s.mu.Unlock()
+	}
+	sort.Slice(hits, func(i, j int) bool {
+		if hits[i].score != hits[j].score {
+			return hits[i].score > hits[j].score
+		}
+		// keys start with the timestamp
+		return hits[i].key > hits[j].key
+	})
+
+	matches := make([]Match, 0, min(limit, len(hits)))
+	for _, h := range hits {
+		if len(matches) == limit {
+			break
+		}
+		bucket, err := s.bucket(h.roomID)
+		if err != nil {
+			return nil, err
+		}
+		var rec Record
+		if ok, err := bucket.GetJSON(h.key, &rec); err != nil || !ok {
+			continue
+		}
+		matches = append(matches, Match{Record: rec, Score: h.score, Snippet: snippet(MessageText(rec.Message), terms)})
+	}
+	return matches, nil
+}
+
+// roomIndex returns the room's index, building it on first use
+func (s *Store) roomIndex(roomID string) (*roomIndex, error) {
+	s.mu.Lock()
+	ix, ok := s.indexes[bucketName(roomID)]
+	s.mu.Unlock()
+	if ok {
+		return ix, nil
+	}
+
+	bucket, err := s.bucket(roomID)
+	if err != nil {
+		return nil, err
+	}
+	ix = newRoomIndex()
+	for _, key := range bucket.Keys() {
+		var rec Record
+		if ok, err := bucket.GetJSON(key, &rec); err == nil && ok {
+			ix.add(key, MessageText(rec.Message))
+		}
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	// Append may have built it meanwhile
+	if existing, ok := s.indexes[bucketName(roomID)]; ok {
+		return existing, nil
+	}
+	s.indexes[bucketName(roomID)] = ix
+	return ix, nil
+}
+
+// indexed updates a room's index, if it was built, after a write
+func (s *Store) indexed(roomID string, update func(ix *roomIndex)) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if ix, ok := s.indexes[bucketName(roomID)]; ok {
+		update(ix)
+	}
+}
+
+// MessageText returns the searchable text of a stored message: the message
+// itself, or the "content" of a JSON message (media data is never indexed)
+func MessageText(message string) string {
+	if !strings.HasPrefix(strings.TrimSpace(message), "{") {
+		return message
+	}
+	var msg struct {
+		Content string `json:"content"`
+	}
+	if json.Unmarshal([]byte(message), &msg) != nil {
+		return message
+	}
+	return msg.Content
+}
+
+// foldDiacritics makes "zażółć" match "zazolc" and the other way round
+var foldDiacritics = strings.NewReplacer(
+	"ą", "a", "ć", "c", "ę", "e", "ł", "l", "ń", "n", "ó", "o", "ś", "s", "ź", "z", "ż", "z",
+	"ä", "a", "ö", "o", "ü", "u", "é", "e", "è", "e", "á", "a", "í", "i", "ú", "u",
+)
+
+func tokenize(text string) []string {
+	text = foldDiacritics.Replace(strings.ToLower(text))
+	words := strings.FieldsFunc(text, func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+	tokens := words[:0]
+	for _, w := range words {
+		if utf8.RuneCountInString(w) >= minTokenLen {
+			tokens = append(tokens, w)
+		}
+	}
+	return tokens
+}
+
+func uniqueTerms(tokens []string) []string {
+	seen := make(map[string]struct{}, len(tokens))
+	terms := tokens[:0]
+	for _, t := range tokens {
+		if _, ok := seen[t]; !ok {
+			seen[t] = struct{}{}
+			terms = append(terms, t)
+		}
+	}
+	return terms
+}
+
+// snippet cuts the text around the first word that matches a term
+func snippet(text string, terms []string) string {
+	runes := []rune(text)
+	if len(runes) <= snippetRunes {
+		return text
+	}
+	folded := []rune(foldDiacritics.Replace(strings.ToLower(text)))
+	at := 0
+	if len(folded) == len(runes) {
+		lower := string(folded)
+		for _, term := range terms {
+			if i := strings.Index(lower, term); i >= 0 {
+				at = utf8.RuneCountInString(lower[:i])
+				break
+			}
+		}
+	}
+
+	start := max(at-snippetRunes/4, 0)
+	end := min(start+snippetRunes, len(runes))
+	start = max(end-snippetRunes, 0)
+	out := string(runes[start:end])
+	if start > 0 {
+		out = "…" + out
+	}
+	if end < len(runes) {
+		out += "…"
+	}
+	return out
+}
@@ -0,0 +1,136 @@
+// Package instance keeps a single GUI running per user. The first launch
+// listens on a unix socket in the data directory; a later launch finds it
+// there, hands over its arguments (such as an invite link) and exits
+// instead of starting a second identity on other ports.
+package instance
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"path/filepath"
+	"time"
+
+	"execp2p/internal/crash"
+	"execp2p/internal/logger"
+)
+
+const (
+	// how long a later launch waits for the running instance
+	handoffTimeout = 5 * time.Second
+	// the largest handoff accepted
+	maxHandoff = 64 << 10
+)
+
+// ErrRunning means another instance holds the lock; the arguments were
+// handed to it
+var ErrRunning = errors.New("ExecP2P is already running")
+
+// Lock is held by the running instance
+type Lock struct {
+	ln       net.Listener
+	path     string
+	handoffs chan []string
+}
+
+type handoff struct {
+	Args []string `json:"args"`
+}
+
+// Acquire takes the lock at path, a socket. When another instance holds it,
+// args are handed to that instance and ErrRunning is returned.
+func Acquire(path string, args []string) (*Lock, error) {
+	if conn, err := net.DialTimeout("unix", path, handoffTimeout); err == nil {
+		return nil, handOver(conn, args)
+	}
+
+	// nobody answers: a stale socket of a crashed instance (Windows doesn't
+	// always report it as a socket)
+	if fi, err := os.Lstat(path); err == nil && !fi.IsDir() {
+		os.Remove(path)
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0o700); err != nil {
+		return nil, fmt.Errorf("failed to create instance lock directory: %w", err)
+	}
+	ln, err := net.Listen("unix", path)
+	if err != nil {
+		// started at the same moment as another launch, which won
+		if conn, dialErr := net.DialTimeout("unix", path, handoffTimeout); dialErr == nil {
+			return nil, handOver(conn, args)
+		}
+		return nil, fmt.Errorf("failed to take the instance lock: %w", err)
+	}
+	if err := os.Chmod(path, 0o600); err != nil {
+		ln.Close()
+		return nil, fmt.Errorf("failed to restrict the instance lock: %w", err)
+	}
+
+	l := &Lock{ln: ln, path: path, handoffs: make(chan []string, 8)}
+	go l.serve()
+	return l, nil
+}
+
+// Handoffs returns the arguments of later launches; the channel is closed
+// with the lock
+func (l *Lock) Handoffs() <-chan []string {
+	return l.handoffs
+}
+
+// Close releases the lock
+func (l *Lock) Close() error {
+	err := l.ln.Close()
+	os.Remove(l.path)
+	return err
+}
+
+func (l *Lock) serve() {
+	defer crash.Recover("instance.serve")
+	defer close(l.handoffs)
+	for {
+		conn, err := l.ln.Accept()
+		if err != nil {
+			return
+		}
+		l.receive(conn)
+	}
+}
+
+// receive reads one handoff and confirms it
+func (l *Lock) receive(conn net.Conn) {
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(handoffTimeout))
+	var h handoff
+	if err := json.NewDecoder(io.LimitReader(conn, maxHandoff)).Decode(&h); err != nil {
+		logger.L().Warn("Invalid handoff from another launch", "err", err)
+		return
+	}
+	select {
+	case l.handoffs <- h.Args:
+	default:
+		logger.L().Warn("Handoff from another launch dropped; too many waiting")
+	}
+	conn.Write([]byte("{\"ok\":true}\n"))
+}
+
+// handOver gives args to the running instance on conn; ErrRunning either
+// way, as that instance keeps the lock
+func handOver(conn net.Conn, args []string) error {
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(handoffTimeout))
+	if args == nil {
+		args = []string{}
+	}
+	if err := json.NewEncoder(conn).Encode(handoff{Args: args}); err != nil {
+		return fmt.Errorf("%w, but did not take the arguments: %v", ErrRunning, err)
+	}
+	var reply struct {
+		OK bool `json:"ok"`
+	}
+	if err := json.NewDecoder(conn).Decode(&reply); err != nil || !reply.OK {
+		return fmt.Errorf("%w, but did not take the arguments", ErrRunning)
+	}
+	return ErrRunning
+}
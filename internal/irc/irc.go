@@ -0,0 +1,446 @@
+// Package irc is a small IRC client for relaying a room to a channel: it
+// registers, joins one channel, hands over what is said there and says
+// lines in it, at a pace servers don't take for flooding. It reconnects
+// when the server goes away.
+package irc
+
+import (
+	"bufio"
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"net"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
+
+	"execp2p/internal/crash"
+	"execp2p/internal/logger"
+
+	"golang.org/x/time/rate"
+)
+
+const (
+	// how long connecting and registering may take
+	registerTimeout = 30 * time.Second
+	// how long writing one line may take
+	writeTimeout = 10 * time.Second
+	// a server that sent nothing for this long is pinged, and dropped after
+	// twice as long
+	idleTimeout = 2 * time.Minute
+	// longest text of one PRIVMSG; the server adds our prefix to the
+	// 512-byte line
+	maxText = 400
+	// lines waiting to be said; newer ones are dropped when it is full
+	queueSize = 256
+	// messages from the channel waiting to be handed over
+	inboxSize = 64
+	// pause before reconnecting, doubled up to maxRetryDelay
+	retryDelay    = 5 * time.Second
+	maxRetryDelay = 5 * time.Minute
+)
+
+// lines said in a burst and then one per interval, below the usual flood
+// limits
+var (
+	sayBurst    = 4
+	sayInterval = time.Second
+)
+
+// ErrClosed is returned by Say after Close
+var ErrClosed = errors.New("IRC client closed")
+
+// Options configures the client
+type Options struct {
+	// host:port of the server
+	Server string
+	// TLS, which most networks expect on port 6697
+	TLS  bool
+	Nick string
+	// the channel, e.g. "#execp2p"
+	Channel string
+	// server password (PASS), empty for none
+	Password string
+}
+
+// Message is something said in the channel
+type Message struct {
+	Nick string
+	Text string
+	// a /me action
+	Action bool
+}
+
+// Client is connected to one channel
+type Client struct {
+	opts     Options
+	messages chan Message
+	queue    chan string
+	limiter  *rate.Limiter
+	stop     chan struct{}
+	done     sync.WaitGroup
+	stopOnce sync.Once
+
+	mu   sync.Mutex
+	conn net.Conn
+	nick string
+}
+
+// Dial connects, registers and joins the channel. It fails when the first
+// attempt does; later disconnections are retried.
+func Dial(ctx context.Context, opts Options) (*Client, error) {
+	if _, _, err := net.SplitHostPort(opts.Server); err != nil {
+		return nil, fmt.Errorf("invalid IRC server address: %w", err)
+	}
+	if !strings.HasPrefix(opts.Channel, "#") && !strings.HasPrefix(opts.Channel, "&") {
+		return nil, fmt.Errorf("invalid IRC channel %q: want e.g. #execp2p", opts.Channel)
+	}
+	if opts.Nick == "" || strings.ContainsAny(opts.Nick, " ,*?!@:#") {
+		return nil, fmt.Errorf("invalid IRC nickname %q", opts.Nick)
+	}
+	c := &Client{
+		opts:     opts,
+		messages: make(chan Message, inboxSize),
+		queue:    make(chan string, queueSize),
+		limiter:  rate.NewLimiter(rate.Every(sayInterval), sayBurst),
+		stop:     make(chan struct{}),
+		nick:     opts.Nick,
+	}
+	r, err := c.connect(ctx)
+	if err != nil {
+		return nil, err
+	}
+	c.done.Add(2)
+	go c.run(r)
+	go c.sayLoop()
+	return c, nil
+}
+
+// Messages delivers what is said in the channel by others; it is closed by
+// Close
+func (c *Client) Messages() <-chan Message {
+	return c.messages
+}
+
+// Say queues text for the channel, line by line, a long line split into
+// several
+func (c *Client) Say(text string) error {
+	select {
+	case <-c.stop:
+		return ErrClosed
+	default:
+	}
+	for _, line := range strings.Split(text, "\n") {
+		line = strings.TrimRight(line, "\r")
+		if strings.TrimSpace(line) == "" {
+			continue
+		}
+		for _, part := range splitText(line, maxText) {
+			select {
+			case c.queue <- part:
+			default:
+				return errors.New("IRC is not keeping up; line dropped")
+			}
+		}
+	}
+	return nil
+}
+
+// Close leaves the server
+func (c *Client) Close() {
+	c.stopOnce.Do(func() {
+		close(c.stop)
+		c.mu.Lock()
+		if c.conn != nil {
+			c.writeLocked("QUIT :ExecP2P relay stopped")
+			c.conn.Close()
+		}
+		c.mu.Unlock()
+		c.done.Wait()
+		close(c.messages)
+	})
+}
+
+// connect dials the server and registers, then joins the channel
+func (c *Client) connect(ctx context.Context) (*bufio.Reader, error) {
+	ctx, cancel := context.WithTimeout(ctx, registerTimeout)
+	defer cancel()
+	var conn net.Conn
+	var err error
+	if c.opts.TLS {
+		host, _, _ := net.SplitHostPort(c.opts.Server)
+		d := &tls.Dialer{Config: &tls.Config{ServerName: host, MinVersion: tls.VersionTLS12}}
+		conn, err = d.DialContext(ctx, "tcp", c.opts.Server)
+	} else {
+		var d net.Dialer
+		conn, err = d.DialContext(ctx, "tcp", c.opts.Server)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to the IRC server: %w", err)
+	}
+	deadline, _ := ctx.Deadline()
+	conn.SetReadDeadline(deadline)
+
+	c.mu.Lock()
+	c.conn, c.nick = conn, c.opts.Nick
+	if c.opts.Password != "" {
+		c.writeLocked("PASS " + c.opts.Password)
+	}
+	c.writeLocked("NICK " + c.nick)
+	err = c.writeLocked("USER " + c.opts.Nick + " 0 * :ExecP2P relay")
+	c.mu.Unlock()
+
+	r := bufio.NewReader(conn)
+	if err == nil {
+		err = c.register(r)
+	}
+	if err != nil {
+		c.drop()
+		return nil, err
+	}
+	conn.SetReadDeadline(time.Time{})
+	logger.L().Info("Connected to IRC", "server", c.opts.Server, "channel", c.opts.Channel, "nick", c.currentNick())
+	return r, nil
+}
+
+// register reads until the server welcomes us, then joins the channel
+func (c *Client) register(r *bufio.Reader) error {
+	for {
+		line, err := readLine(r)
+		if err != nil {
+			return fmt.Errorf("IRC registration failed: %w", err)
+		}
+		msg := parse(line)
+		switch msg.command {
+		case "PING":
+			c.write("PONG :" + msg.trailing())
+		case "001":
+			c.mu.Lock()
+			if len(msg.params) > 0 {
+				c.nick = msg.params[0]
+			}
+			err := c.writeLocked("JOIN " + c.opts.Channel)
+			c.mu.Unlock()
+			return err
+		case "432", "433", "436":
+			// nickname taken or refused: try another
+			c.mu.Lock()
+			if len(c.nick) >= len(c.opts.Nick)+3 {
+				c.mu.Unlock()
+				return fmt.Errorf("IRC nickname %s is taken", c.opts.Nick)
+			}
+			c.nick += "_"
+			err := c.writeLocked("NICK " + c.nick)
+			c.mu.Unlock()
+			if err != nil {
+				return err
+			}
+		case "464", "465":
+			return fmt.Errorf("IRC server refused us: %s", msg.trailing())
+		case "ERROR":
+			return fmt.Errorf("IRC server closed the connection: %s", msg.trailing())
+		}
+	}
+}
+
+// run reads the channel, reconnecting until the client is closed
+func (c *Client) run(r *bufio.Reader) {
+	defer crash.Recover("irc.run")
+	defer c.done.Done()
+	delay := retryDelay
+	for {
+		err := c.serve(r)
+		c.drop()
+		if c.stopped() {
+			return
+		}
+		logger.L().Warn("IRC connection lost; reconnecting", "err", err)
+
+		for r = nil; r == nil; {
+			select {
+			case <-c.stop:
+				return
+			case <-time.After(delay):
+			}
+			delay = min(2*delay, maxRetryDelay)
+			var err error
+			if r, err = c.connect(context.Background()); err != nil {
+				logger.L().Warn("Failed to reconnect to IRC", "err", err, "retry_in", delay)
+			}
+		}
+		delay = retryDelay
+	}
+}
+
+// serve handles the lines of the current connection until it ends
+func (c *Client) serve(r *bufio.Reader) error {
+	pinged := false
+	for {
+		c.mu.Lock()
+		conn := c.conn
+		c.mu.Unlock()
+		if conn == nil {
+			return errors.New("disconnected")
+		}
+		conn.SetReadDeadline(time.Now().Add(idleTimeout))
+		line, err := readLine(r)
+		var ne net.Error
+		if errors.As(err, &ne) && ne.Timeout() && !pinged {
+			// quiet server: make sure it is still there
+			pinged = true
+			c.write("PING :execp2p")
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		pinged = false
+
+		msg := parse(line)
+		switch msg.command {
+		case "PING":
+			c.write("PONG :" + msg.trailing())
+		case "ERROR":
+			return fmt.Errorf("IRC server closed the connection: %s", msg.trailing())
+		case "KICK":
+			if len(msg.params) >= 2 && strings.EqualFold(msg.params[1], c.currentNick()) {
+				logger.L().Warn("Kicked from the IRC channel; joining again", "channel", c.opts.Channel, "by", msg.nick(), "reason", msg.trailing())
+				c.write("JOIN " + c.opts.Channel)
+			}
+		case "NICK":
+			if strings.EqualFold(msg.nick(), c.currentNick()) {
+				c.mu.Lock()
+				c.nick = msg.trailing()
+				c.mu.Unlock()
+			}
+		case "471", "473", "474", "475", "403", "405":
+			logger.L().Warn("Could not join the IRC channel", "channel", c.opts.Channel, "reply", msg.command, "reason", msg.trailing())
+		case "PRIVMSG":
+			c.handlePrivmsg(msg)
+		}
+	}
+}
+
+// handlePrivmsg hands over a message said in the channel
+func (c *Client) handlePrivmsg(msg message) {
+	if len(msg.params) < 2 || !strings.EqualFold(msg.params[0], c.opts.Channel) {
+		return
+	}
+	nick, text := msg.nick(), msg.trailing()
+	if nick == "" || strings.EqualFold(nick, c.currentNick()) {
+		return
+	}
+	action := false
+	if strings.HasPrefix(text, "\x01") {
+		// CTCP: only actions are said to the channel
+		body, ok := strings.CutPrefix(strings.TrimSuffix(text[1:], "\x01"), "ACTION ")
+		if !ok {
+			return
+		}
+		text, action = body, true
+	}
+	text = strings.TrimSpace(StripFormatting(text))
+	if text == "" {
+		return
+	}
+	select {
+	case c.messages <- Message{Nick: nick, Text: text, Action: action}:
+	default:
+		logger.L().Warn("IRC relay is not keeping up; message dropped", "nick", nick)
+	}
+}
+
+// sayLoop writes queued lines at the pace the limiter allows
+func (c *Client) sayLoop() {
+	defer crash.Recover("irc.sayLoop")
+	defer c.done.Done()
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go func() {
+		<-c.stop
+		cancel()
+	}()
+	for {
+		select {
+		case <-c.stop:
+			return
+		case text := <-c.queue:
+			if err := c.limiter.Wait(ctx); err != nil {
+				return
+			}
+			if err := c.write("PRIVMSG " + c.opts.Channel + " :" + text); err != nil {
+				logger.L().Warn("Failed to say a line on IRC", "err", err)
+			}
+		}
+	}
+}
+
+// write sends a line on the current connection
+func (c *Client) write(line string) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.writeLocked(line)
+}
+
+func (c *Client) writeLocked(line string) error {
+	if c.conn == nil {
+		return errors.New("not connected to IRC")
+	}
+	c.conn.SetWriteDeadline(time.Now().Add(writeTimeout))
+	_, err := c.conn.Write([]byte(line + "\r\n"))
+	return err
+}
+
+// drop closes the current connection
+func (c *Client) drop() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.conn != nil {
+		c.conn.Close()
+		c.conn = nil
+	}
+}
+
+func (c *Client) currentNick() string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.nick
+}
+
+func (c *Client) stopped() bool {
+	select {
+	case <-c.stop:
+		return true
+	default:
+		return false
+	}
+}
+
+// readLine reads a line without its CRLF, invalid UTF-8 replaced
+func readLine(r *bufio.Reader) (string, error) {
+	line, err := r.ReadString('\n')
+	if err != nil {
+		return "", err
+	}
+	return strings.ToValidUTF8(strings.TrimRight(line, "\r\n"), "�"), nil
+}
+
+// splitText cuts s into pieces of at most max bytes, at a space where
+// there is one and never inside a character
+func splitText(s string, max int) []string {
+	var parts []string
+	for len(s) > max {
+		cut := max
+		for cut > 0 && !utf8.RuneStart(s[cut]) {
+			cut--
+		}
+		if i := strings.LastIndexByte(s[:cut], ' '); i > max/2 {
+			cut = i
+		}
+		parts = append(parts, s[:cut])
+		s = strings.TrimLeft(s[cut:], " ")
+	}
+	return append(parts, s)
+}
@@ -0,0 +1,102 @@
+package irc
+
+import "strings"
+
+// message is a parsed protocol line (RFC 1459 / 2812, tags ignored)
+type message struct {
+	prefix  string
+	command string
+	params  []string
+}
+
+// parse splits "[@tags] [:prefix] COMMAND params [:trailing]"
+func parse(line string) message {
+	var m message
+	if strings.HasPrefix(line, "@") {
+		_, line, _ = strings.Cut(line, " ")
+	}
+	line = strings.TrimLeft(line, " ")
+	if strings.HasPrefix(line, ":") {
+		m.prefix, line, _ = strings.Cut(line[1:], " ")
+	}
+	line = strings.TrimLeft(line, " ")
+	m.command, line, _ = strings.Cut(line, " ")
+	m.command = strings.ToUpper(m.command)
+	for line != "" {
+		line = strings.TrimLeft(line, " ")
+		if strings.HasPrefix(line, ":") {
+			m.params = append(m.params, line[1:])
+			break
+		}
+		var param string
+		param, line, _ = strings.Cut(line, " ")
+		if param != "" {
+			m.params = append(m.params, param)
+		}
+	}
+	return m
+}
+
+// nick is the sender's nickname, empty for the server
+func (m message) nick() string {
+	nick, _, found := strings.Cut(m.prefix, "!")
+	if !found && strings.Contains(nick, ".") {
+		return ""
+	}
+	return nick
+}
+
+// trailing is the last parameter
+func (m message) trailing() string {
+	if len(m.params) == 0 {
+		return ""
+	}
+	return m.params[len(m.params)-1]
+}
+
+// StripFormatting removes mIRC bold, colour, italic, underline, strikethrough,
+// monospace, reverse and reset codes
+func StripFormatting(s string) string {
+	if !strings.ContainsAny(s, "\x02\x03\x04\x0f\x11\x16\x1d\x1e\x1f") {
+		return s
+	}
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		switch s[i] {
+		case '\x02', '\x0f', '\x11', '\x16', '\x1d', '\x1e', '\x1f':
+		case '\x03':
+			// up to two digits, optionally a comma and up to two more
+			i += skipColour(s[i+1:], isDigit, 2)
+		case '\x04':
+			i += skipColour(s[i+1:], isHex, 6)
+		default:
+			b.WriteByte(s[i])
+		}
+	}
+	return b.String()
+}
+
+// skipColour returns how many bytes of "fg[,bg]" follow a colour code
+func skipColour(s string, valid func(byte) bool, width int) int {
+	n := countRun(s, valid, width)
+	if n > 0 && n < len(s) && s[n] == ',' {
+		if bg := countRun(s[n+1:], valid, width); bg > 0 {
+			n += 1 + bg
+		}
+	}
+	return n
+}
+
+func countRun(s string, valid func(byte) bool, max int) int {
+	n := 0
+	for n < len(s) && n < max && valid(s[n]) {
+		n++
+	}
+	return n
+}
+
+func isDigit(c byte) bool { return c >= '0' && c <= '9' }
+
+func isHex(c byte) bool {
+	return isDigit(c) || c >= 'a' && c <= 'f' || c >= 'A' && c <= 'F'
+}
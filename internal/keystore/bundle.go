@@ -0,0 +1,67 @@
+package keystore
+
+import (
+	"crypto/ed25519"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"execp2p/internal/crypto"
+)
+
+// bundleKind tags exported identity bundles so other envelopes (backups)
+// are not mistaken for them
+const bundleKind = "execp2p-identity"
+
+// identityBundle is the plaintext of an exported identity
+type identityBundle struct {
+	Kind        string               `json:"kind"`
+	Fingerprint string               `json:"fingerprint"`
+	ExportedAt  time.Time            `json:"exported_at"`
+	Keys        *crypto.IdentityKeys `json:"keys"`
+	// the device key of the primary device, see app.WipeDevice
+	Primary ed25519.PublicKey `json:"primary,omitempty"`
+}
+
+// ExportBundle seals identity keys into a passphrase-protected bundle that
+// can be imported on another machine, along with the device key of the
+// identity's primary device
+func ExportBundle(keys *crypto.IdentityKeys, primary ed25519.PublicKey, passphrase []byte) ([]byte, error) {
+	if keys == nil {
+		return nil, fmt.Errorf("no identity to export")
+	}
+	plaintext, err := json.Marshal(identityBundle{
+		Kind:        bundleKind,
+		Fingerprint: keys.Fingerprint(),
+		ExportedAt:  time.Now().UTC(),
+		Keys:        keys,
+		Primary:     primary,
+	})
+	if err != nil {
+		return nil, err
+	}
+	return SealWithPassphrase(plaintext, passphrase)
+}
+
+// ImportBundle opens a bundle produced by ExportBundle and returns its keys
+// and the primary's device key, nil in bundles of older versions
+func ImportBundle(data, passphrase []byte) (*crypto.IdentityKeys, ed25519.PublicKey, error) {
+	plaintext, err := OpenWithPassphrase(data, passphrase)
+	if err != nil {
+		return nil, nil, err
+	}
+	var bundle identityBundle
+	if err := json.Unmarshal(plaintext, &bundle); err != nil {
+		return nil, nil, fmt.Errorf("invalid identity bundle: %w", err)
+	}
+	if bundle.Kind != bundleKind || bundle.Keys == nil {
+		return nil, nil, fmt.Errorf("file is not an ExecP2P identity bundle")
+	}
+	if bundle.Keys.Fingerprint() != bundle.Fingerprint {
+		return nil, nil, fmt.Errorf("identity bundle fingerprint mismatch")
+	}
+	if bundle.Primary != nil && len(bundle.Primary) != ed25519.PublicKeySize {
+		return nil, nil, fmt.Errorf("invalid primary device key in identity bundle")
+	}
+	return bundle.Keys, bundle.Primary, nil
+}
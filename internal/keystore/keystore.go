@@ -0,0 +1,401 @@
+// Package keystore persists the long-term identity keys on disk.
+//
+// The identity is serialized to JSON and sealed with XChaCha20-Poly1305. The
+// sealing key either comes from a user passphrase (Argon2id) or is a random
+// key kept in the operating system keychain.
+package keystore
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"time"
+
+	"execp2p/internal/crypto"
+	"execp2p/internal/storage"
+
+	"github.com/zalando/go-keyring"
+	"golang.org/x/crypto/argon2"
+	"golang.org/x/crypto/chacha20poly1305"
+	"golang.org/x/crypto/hkdf"
+)
+
+// protection modes for the keystore file
+const (
+	ProtectionPassphrase = "passphrase"
+	ProtectionKeychain   = "keychain"
+)
+
+// FileName is the name of the keystore file inside the data directory
+const FileName = "identity.keystore"
+
+// keychain entry used for ProtectionKeychain
+const (
+	keychainService = "execp2p"
+	keychainUser    = "identity-keystore"
+)
+
+const envelopeVersion = 1
+
+// HKDF info for keys derived from the keystore's own key, see StorageKey
+// and DeviceKey
+const (
+	storageKeyInfo = "execp2p local storage v1"
+	deviceKeyInfo  = "execp2p device signing v1"
+)
+
+var (
+	ErrNotFound          = errors.New("keystore not found")
+	ErrWrongPassphrase   = errors.New("wrong passphrase or corrupted keystore")
+	ErrPassphraseMissing = errors.New("passphrase required to unlock keystore")
+	ErrKeychainMissing   = errors.New("keystore key not found in OS keychain")
+)
+
+// argon2id parameters, stored alongside the ciphertext so they can be raised later
+type kdfParams struct {
+	Time    uint32 `json:"time"`
+	Memory  uint32 `json:"memory"`
+	Threads uint8  `json:"threads"`
+}
+
+var defaultKDFParams = kdfParams{Time: 3, Memory: 64 * 1024, Threads: 4}
+
+// envelope is the on-disk format
+type envelope struct {
+	Version    int        `json:"version"`
+	Protection string     `json:"protection"`
+	KDF        string     `json:"kdf,omitempty"`
+	KDFParams  *kdfParams `json:"kdf_params,omitempty"`
+	Salt       []byte     `json:"salt,omitempty"`
+	Nonce      []byte     `json:"nonce"`
+	Ciphertext []byte     `json:"ciphertext"`
+}
+
+// storedIdentity is the plaintext sealed inside the envelope
+type storedIdentity struct {
+	Keys      *crypto.IdentityKeys `json:"keys"`
+	CreatedAt time.Time            `json:"created_at"`
+}
+
+// Keystore is an encrypted identity file in a data directory
+type Keystore struct {
+	path string
+}
+
+// New returns a keystore stored in dir
+func New(dir string) *Keystore {
+	return &Keystore{path: filepath.Join(dir, FileName)}
+}
+
+// Path returns the location of the keystore file
+func (k *Keystore) Path() string {
+	return k.path
+}
+
+// Exists reports whether a keystore file is present
+func (k *Keystore) Exists() bool {
+	_, err := os.Stat(k.path)
+	return err == nil
+}
+
+// Protection returns the protection mode of the existing keystore file
+func (k *Keystore) Protection() (string, error) {
+	env, err := k.readEnvelope()
+	if err != nil {
+		return "", err
+	}
+	return env.Protection, nil
+}
+
+// Save seals the identity keys and writes them to disk, replacing any
+// previous keystore. For ProtectionPassphrase a non-empty passphrase is
+// required; for ProtectionKeychain a fresh random key is stored in the OS keychain.
+func (k *Keystore) Save(keys *crypto.IdentityKeys, protection string, passphrase []byte) error {
+	plaintext, err := json.Marshal(storedIdentity{Keys: keys, CreatedAt: time.Now()})
+	if err != nil {
+		return fmt.Errorf("failed to serialize identity: %w", err)
+	}
+	data, err := seal(plaintext, protection, passphrase)
+	if err != nil {
+		return err
+	}
+	return writeFileAtomic(k.path, data)
+}
+
+// Load unlocks the keystore and returns the identity keys. The passphrase
+// is ignored for keychain-protected keystores.
+func (k *Keystore) Load(passphrase []byte) (*crypto.IdentityKeys, error) {
+	env, err := k.readEnvelope()
+	if err != nil {
+		return nil, err
+	}
+	plaintext, err := open(env, passphrase)
+	if err != nil {
+		return nil, err
+	}
+	var id storedIdentity
+	if err := json.Unmarshal(plaintext, &id); err != nil {
+		return nil, fmt.Errorf("failed to parse identity: %w", err)
+	}
+	if id.Keys == nil {
+		return nil, fmt.Errorf("keystore contains no identity")
+	}
+	return id.Keys, nil
+}
+
+// StorageKey derives the key of the encrypted local database from the
+// keystore's own key (passphrase or OS keychain), so the database unlocks
+// together with the identity. Re-sealing the keystore with a new passphrase
+// changes this key.
+func (k *Keystore) StorageKey(passphrase []byte) ([]byte, error) {
+	return k.subkey(passphrase, storageKeyInfo, chacha20poly1305.KeySize)
+}
+
+// DeviceKey derives the Ed25519 key of this device from the keystore's own
+// key. Devices sharing an identity seal it each with a key of their own, so
+// this key tells them apart. Re-sealing the keystore changes it, like the
+// storage key.
+func (k *Keystore) DeviceKey(passphrase []byte) (ed25519.PrivateKey, error) {
+	seed, err := k.subkey(passphrase, deviceKeyInfo, ed25519.SeedSize)
+	if err != nil {
+		return nil, err
+	}
+	return ed25519.NewKeyFromSeed(seed), nil
+}
+
+// subkey derives size bytes for info from the keystore's own key
+func (k *Keystore) subkey(passphrase []byte, info string, size int) ([]byte, error) {
+	env, err := k.readEnvelope()
+	if err != nil {
+		return nil, err
+	}
+	// opening proves the passphrase is right before anything is derived from it
+	if _, err := open(env, passphrase); err != nil {
+		return nil, err
+	}
+	key, err := envelopeKey(env, passphrase)
+	if err != nil {
+		return nil, err
+	}
+
+	out := make([]byte, size)
+	if _, err := io.ReadFull(hkdf.New(sha256.New, key, env.Salt, []byte(info)), out); err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// Delete removes the keystore file and, if used, its keychain entry
+func (k *Keystore) Delete() error {
+	if env, err := k.readEnvelope(); err == nil && env.Protection == ProtectionKeychain {
+		_ = keyring.Delete(keychainService, keychainUser)
+	}
+	if err := os.Remove(k.path); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return nil
+}
+
+// Wipe shreds the keystore file and removes its keychain entry, if used
+func (k *Keystore) Wipe() error {
+	if env, err := k.readEnvelope(); err == nil && env.Protection == ProtectionKeychain {
+		_ = keyring.Delete(keychainService, keychainUser)
+	}
+	if err := storage.Shred(k.path); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return nil
+}
+
+func (k *Keystore) readEnvelope() (*envelope, error) {
+	data, err := os.ReadFile(k.path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, ErrNotFound
+		}
+		return nil, err
+	}
+	return parseEnvelope(data)
+}
+
+func parseEnvelope(data []byte) (*envelope, error) {
+	var env envelope
+	if err := json.Unmarshal(data, &env); err != nil {
+		return nil, fmt.Errorf("failed to parse keystore: %w", err)
+	}
+	if env.Version != envelopeVersion {
+		return nil, fmt.Errorf("unsupported keystore version %d", env.Version)
+	}
+	return &env, nil
+}
+
+// SealWithPassphrase encrypts arbitrary data into a passphrase-protected
+// envelope (same format as the keystore file). Used for backups and exports.
+func SealWithPassphrase(plaintext, passphrase []byte) ([]byte, error) {
+	return seal(plaintext, ProtectionPassphrase, passphrase)
+}
+
+// OpenWithPassphrase decrypts an envelope produced by SealWithPassphrase
+func OpenWithPassphrase(data, passphrase []byte) ([]byte, error) {
+	env, err := parseEnvelope(data)
+	if err != nil {
+		return nil, err
+	}
+	if env.Protection != ProtectionPassphrase {
+		return nil, fmt.Errorf("envelope is not passphrase protected")
+	}
+	return open(env, passphrase)
+}
+
+// KeychainAvailable reports whether the OS keychain can be used on this machine
+func KeychainAvailable() bool {
+	_, err := keyring.Get(keychainService, "probe")
+	return err == nil || errors.Is(err, keyring.ErrNotFound)
+}
+
+// seal encrypts plaintext into a serialized envelope
+func seal(plaintext []byte, protection string, passphrase []byte) ([]byte, error) {
+	env := &envelope{Version: envelopeVersion, Protection: protection}
+
+	var key []byte
+	switch protection {
+	case ProtectionPassphrase:
+		if len(passphrase) == 0 {
+			return nil, ErrPassphraseMissing
+		}
+		env.Salt = make([]byte, 16)
+		if _, err := rand.Read(env.Salt); err != nil {
+			return nil, err
+		}
+		params := defaultKDFParams
+		env.KDF = "argon2id"
+		env.KDFParams = &params
+		key = deriveKey(passphrase, env.Salt, params)
+	case ProtectionKeychain:
+		key = make([]byte, chacha20poly1305.KeySize)
+		if _, err := rand.Read(key); err != nil {
+			return nil, err
+		}
+		if err := keyring.Set(keychainService, keychainUser, base64.StdEncoding.EncodeToString(key)); err != nil {
+			return nil, fmt.Errorf("failed to store key in OS keychain: %w", err)
+		}
+	default:
+		return nil, fmt.Errorf("unknown keystore protection %q", protection)
+	}
+
+	aead, err := chacha20poly1305.NewX(key)
+	if err != nil {
+		return nil, err
+	}
+	env.Nonce = make([]byte, aead.NonceSize())
+	if _, err := rand.Read(env.Nonce); err != nil {
+		return nil, err
+	}
+	env.Ciphertext = aead.Seal(nil, env.Nonce, plaintext, envelopeAAD(env))
+
+	return json.MarshalIndent(env, "", "  ")
+}
+
+// open decrypts an envelope
+func open(env *envelope, passphrase []byte) ([]byte, error) {
+	key, err := envelopeKey(env, passphrase)
+	if err != nil {
+		return nil, err
+	}
+
+	aead, err := chacha20poly1305.NewX(key)
+	if err != nil {
+		return nil, err
+	}
+	if len(env.Nonce) != aead.NonceSize() {
+		return nil, ErrWrongPassphrase
+	}
+	plaintext, err := aead.Open(nil, env.Nonce, env.Ciphertext, envelopeAAD(env))
+	if err != nil {
+		return nil, ErrWrongPassphrase
+	}
+	return plaintext, nil
+}
+
+// envelopeKey recovers the key an envelope was sealed with
+func envelopeKey(env *envelope, passphrase []byte) ([]byte, error) {
+	switch env.Protection {
+	case ProtectionPassphrase:
+		if len(passphrase) == 0 {
+			return nil, ErrPassphraseMissing
+		}
+		if env.KDF != "argon2id" || env.KDFParams == nil {
+			return nil, fmt.Errorf("unsupported key derivation %q", env.KDF)
+		}
+		return deriveKey(passphrase, env.Salt, *env.KDFParams), nil
+	case ProtectionKeychain:
+		encoded, err := keyring.Get(keychainService, keychainUser)
+		if err != nil {
+			if errors.Is(err, keyring.ErrNotFound) {
+				return nil, ErrKeychainMissing
+			}
+			return nil, fmt.Errorf("failed to read key from OS keychain: %w", err)
+		}
+		key, err := base64.StdEncoding.DecodeString(encoded)
+		if err != nil {
+			return nil, fmt.Errorf("invalid key in OS keychain: %w", err)
+		}
+		return key, nil
+	default:
+		return nil, fmt.Errorf("unknown keystore protection %q", env.Protection)
+	}
+}
+
+func deriveKey(passphrase, salt []byte, p kdfParams) []byte {
+	return argon2.IDKey(passphrase, salt, p.Time, p.Memory, p.Threads, chacha20poly1305.KeySize)
+}
+
+// envelopeAAD binds the header fields to the ciphertext so they cannot be swapped
+func envelopeAAD(env *envelope) []byte {
+	header := struct {
+		Version    int        `json:"version"`
+		Protection string     `json:"protection"`
+		KDF        string     `json:"kdf"`
+		KDFParams  *kdfParams `json:"kdf_params"`
+		Salt       []byte     `json:"salt"`
+	}{env.Version, env.Protection, env.KDF, env.KDFParams, env.Salt}
+	aad, _ := json.Marshal(header)
+	return aad
+}
+
+// writeFileAtomic writes data to a temp file and renames it into place
+func writeFileAtomic(path string, data []byte) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0o700); err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(path), ".keystore-*")
+	if err != nil {
+		return err
+	}
+	tmpName := tmp.Name()
+	defer os.Remove(tmpName)
+
+	if err := tmp.Chmod(0o600); err != nil {
+		tmp.Close()
+		return err
+	}
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmpName, path)
+}
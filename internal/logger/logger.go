@@ -6,18 +6,24 @@ import (
 	"os"
 )
 
-var defaultLogger *slog.Logger
+var (
+	defaultLogger *slog.Logger
+	// where enabled logs are written, and at which level
+	output  io.Writer = os.Stdout
+	level   slog.Level
+	enabled bool
+)
 
 func init() {
 	lvlStr := os.Getenv("ENTROPIA_LOG_LEVEL")
 	if lvlStr == "" {
-		// silent by default – discard logs until enabled via flag or env var
-		defaultLogger = slog.New(slog.NewTextHandler(io.Discard, nil))
+		// silent by default – only the recent entries are kept (ring.go)
+		// until enabled via flag or env var
+		defaultLogger = slog.New(newHandler(nil, slog.LevelInfo))
 		return
 	}
 
-	lvl := ParseLevel(lvlStr)
-	defaultLogger = slog.New(slog.NewJSONHandler(os.Stdout, &slog.HandlerOptions{Level: lvl}))
+	SetLevel(ParseLevel(lvlStr))
 }
 
 // L returns the shared application logger.
@@ -33,8 +39,19 @@ func Set(l *slog.Logger) {
 }
 
 // SetLevel changes logging level at runtime.
-func SetLevel(level slog.Level) {
-	defaultLogger = slog.New(slog.NewJSONHandler(os.Stdout, &slog.HandlerOptions{Level: level}))
+func SetLevel(l slog.Level) {
+	level, enabled = l, true
+	out := slog.NewJSONHandler(output, &slog.HandlerOptions{Level: level, ReplaceAttr: redactAttr})
+	defaultLogger = slog.New(newHandler(out, min(level, slog.LevelInfo)))
+}
+
+// SetOutput sends logs to w instead of stdout, e.g. when stdout carries a
+// protocol. Logs stay disabled until a level is set.
+func SetOutput(w io.Writer) {
+	output = w
+	if enabled {
+		SetLevel(level)
+	}
 }
 
 // ParseLevel converts a textual level ("debug", "info", "warn", "error") to a slog.Level.
@@ -0,0 +1,65 @@
+package logger
+
+import (
+	"log/slog"
+	"strings"
+	"sync"
+)
+
+// Redacted replaces redacted values in log output
+const Redacted = "[incognito]"
+
+var (
+	redactMu sync.RWMutex
+	redacted = make(map[string]struct{})
+)
+
+// Redact hides value (e.g. an incognito room ID) from every log record,
+// whether it appears as an attribute, in an error or in the message
+func Redact(value string) {
+	if value == "" {
+		return
+	}
+	redactMu.Lock()
+	redacted[value] = struct{}{}
+	redactMu.Unlock()
+}
+
+// Unredact stops hiding value
+func Unredact(value string) {
+	redactMu.Lock()
+	delete(redacted, value)
+	redactMu.Unlock()
+}
+
+// redactAttr is used as slog ReplaceAttr for all handlers
+func redactAttr(_ []string, a slog.Attr) slog.Attr {
+	redactMu.RLock()
+	defer redactMu.RUnlock()
+	if len(redacted) == 0 {
+		return a
+	}
+
+	var s string
+	switch v := a.Value.Resolve(); {
+	case v.Kind() == slog.KindString:
+		s = v.String()
+	case v.Kind() == slog.KindAny:
+		if err, ok := v.Any().(error); ok && err != nil {
+			s = err.Error()
+		} else {
+			return a
+		}
+	default:
+		return a
+	}
+
+	replaced := s
+	for value := range redacted {
+		replaced = strings.ReplaceAll(replaced, value, Redacted)
+	}
+	if replaced == s {
+		return a
+	}
+	return slog.String(a.Key, replaced)
+}
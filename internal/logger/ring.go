@@ -0,0 +1,160 @@
+package logger
+
+import (
+	"context"
+	"encoding/json"
+	"log/slog"
+	"sync"
+	"time"
+)
+
+// Recent entries.
+//
+// The last ringSize records are kept in memory, whether or not logs are
+// written anywhere, so a frontend can show what went wrong with a connection
+// without the user digging for log files. Records at Info and above are kept,
+// Debug too when the log level is Debug; they are redacted like the output.
+
+// ringSize is how many records are kept
+const ringSize = 1000
+
+// Entry is a kept log record
+type Entry struct {
+	Time    time.Time              `json:"time"`
+	Level   string                 `json:"level"`
+	Message string                 `json:"msg"`
+	Attrs   map[string]interface{} `json:"attrs,omitempty"`
+
+	level slog.Level
+}
+
+var ring = &entryRing{subscribers: make(map[chan Entry]struct{})}
+
+type entryRing struct {
+	mu      sync.Mutex
+	entries []Entry
+	// index of the oldest entry once the ring is full
+	next        int
+	subscribers map[chan Entry]struct{}
+}
+
+// Write takes one JSON record; the slog JSON handler writes each record
+// in a single call
+func (r *entryRing) Write(p []byte) (int, error) {
+	var fields map[string]interface{}
+	if err := json.Unmarshal(p, &fields); err != nil {
+		return len(p), nil
+	}
+	e := Entry{Attrs: fields}
+	if s, ok := fields[slog.TimeKey].(string); ok {
+		e.Time, _ = time.Parse(time.RFC3339Nano, s)
+	}
+	e.Level, _ = fields[slog.LevelKey].(string)
+	_ = e.level.UnmarshalText([]byte(e.Level))
+	e.Message, _ = fields[slog.MessageKey].(string)
+	delete(fields, slog.TimeKey)
+	delete(fields, slog.LevelKey)
+	delete(fields, slog.MessageKey)
+	if len(fields) == 0 {
+		e.Attrs = nil
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if len(r.entries) < ringSize {
+		r.entries = append(r.entries, e)
+	} else {
+		r.entries[r.next] = e
+		r.next = (r.next + 1) % ringSize
+	}
+	for ch := range r.subscribers {
+		select {
+		case ch <- e:
+		default:
+			// a slow reader misses entries; Recent still has them
+		}
+	}
+	return len(p), nil
+}
+
+// Recent returns up to limit kept entries at minLevel or above, oldest
+// first; limit <= 0 means all of them
+func Recent(minLevel slog.Level, limit int) []Entry {
+	ring.mu.Lock()
+	ordered := make([]Entry, 0, len(ring.entries))
+	ordered = append(ordered, ring.entries[ring.next:]...)
+	ordered = append(ordered, ring.entries[:ring.next]...)
+	ring.mu.Unlock()
+
+	var kept []Entry
+	for _, e := range ordered {
+		if e.level >= minLevel {
+			kept = append(kept, e)
+		}
+	}
+	if limit > 0 && len(kept) > limit {
+		kept = kept[len(kept)-limit:]
+	}
+	return kept
+}
+
+// Subscribe delivers every entry kept from now on, dropping those a full
+// channel of size buffer can't take, until the returned cancel is called
+func Subscribe(buffer int) (<-chan Entry, func()) {
+	ch := make(chan Entry, buffer)
+	ring.mu.Lock()
+	ring.subscribers[ch] = struct{}{}
+	ring.mu.Unlock()
+
+	var once sync.Once
+	return ch, func() {
+		once.Do(func() {
+			ring.mu.Lock()
+			delete(ring.subscribers, ch)
+			ring.mu.Unlock()
+		})
+	}
+}
+
+// teeHandler sends records to the log output, if any, and to the ring
+type teeHandler struct {
+	out  slog.Handler
+	ring slog.Handler
+}
+
+func newHandler(out slog.Handler, ringLevel slog.Level) slog.Handler {
+	return &teeHandler{
+		out:  out,
+		ring: slog.NewJSONHandler(ring, &slog.HandlerOptions{Level: ringLevel, ReplaceAttr: redactAttr}),
+	}
+}
+
+func (h *teeHandler) Enabled(ctx context.Context, l slog.Level) bool {
+	return h.ring.Enabled(ctx, l) || (h.out != nil && h.out.Enabled(ctx, l))
+}
+
+func (h *teeHandler) Handle(ctx context.Context, r slog.Record) error {
+	if h.ring.Enabled(ctx, r.Level) {
+		_ = h.ring.Handle(ctx, r.Clone())
+	}
+	if h.out != nil && h.out.Enabled(ctx, r.Level) {
+		return h.out.Handle(ctx, r)
+	}
+	return nil
+}
+
+func (h *teeHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	t := &teeHandler{ring: h.ring.WithAttrs(attrs)}
+	if h.out != nil {
+		t.out = h.out.WithAttrs(attrs)
+	}
+	return t
+}
+
+func (h *teeHandler) WithGroup(name string) slog.Handler {
+	t := &teeHandler{ring: h.ring.WithGroup(name)}
+	if h.out != nil {
+		t.out = h.out.WithGroup(name)
+	}
+	return t
+}
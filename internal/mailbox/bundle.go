@@ -0,0 +1,45 @@
+package mailbox
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+)
+
+// MaxBundleSize is the largest contact bundle the relay accepts
+const MaxBundleSize = 64 << 10
+
+// Publish puts our contact bundle on the relay under our user ID. The
+// mailbox secret proves the entry is ours: the relay keeps it only for the
+// mailbox the bundle names, and only we can replace or remove it.
+func (c *Client) Publish(ctx context.Context, secret []byte, userID string, bundle []byte) error {
+	if len(bundle) > MaxBundleSize {
+		return fmt.Errorf("contact bundle too large (%d bytes)", len(bundle))
+	}
+	body, err := json.Marshal(map[string][]byte{"data": bundle})
+	if err != nil {
+		return err
+	}
+	url := fmt.Sprintf("%s/api/contact/%s", c.server, userID)
+	return c.do(ctx, http.MethodPut, url, secret, body, nil)
+}
+
+// Unpublish removes our contact bundle from the relay
+func (c *Client) Unpublish(ctx context.Context, secret []byte, userID string) error {
+	url := fmt.Sprintf("%s/api/contact/%s", c.server, userID)
+	return c.do(ctx, http.MethodDelete, url, secret, nil, nil)
+}
+
+// Lookup fetches the contact bundle published under a user ID; ErrNotFound
+// if there is none
+func (c *Client) Lookup(ctx context.Context, userID string) ([]byte, error) {
+	var resp struct {
+		Data []byte `json:"data"`
+	}
+	url := fmt.Sprintf("%s/api/contact/%s", c.server, userID)
+	if err := c.do(ctx, http.MethodGet, url, nil, nil, &resp); err != nil {
+		return nil, err
+	}
+	return resp.Data, nil
+}
@@ -0,0 +1,78 @@
+package mailbox
+
+import (
+	"slices"
+	"time"
+
+	"execp2p/internal/storage"
+)
+
+// BucketName is the storage bucket peers' mailbox addresses are kept in
+const BucketName = "mailbox"
+
+// maxContactRooms bounds the rooms remembered per contact
+const maxContactRooms = 32
+
+// Contact is where a peer we have met takes messages while it is offline
+type Contact struct {
+	PeerID      string `json:"peer_id"`
+	Fingerprint string `json:"fingerprint"`
+	// the peer's identity public keys, to seal messages to
+	KEMPubKey []byte `json:"kem_pub_key"`
+	SigPubKey []byte `json:"sig_pub_key"`
+	// relay URL and mailbox ID the peer announced
+	Server    string `json:"server"`
+	MailboxID string `json:"mailbox_id"`
+	// rooms we shared with the peer, newest last
+	Rooms     []string  `json:"rooms"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// Contacts are the mailbox addresses of peers, kept in the encrypted database
+type Contacts struct {
+	bucket *storage.Bucket
+}
+
+// NewContacts returns the contacts stored in bucket
+func NewContacts(bucket *storage.Bucket) *Contacts {
+	return &Contacts{bucket: bucket}
+}
+
+// Get returns the contact of a peer
+func (c *Contacts) Get(peerID string) (Contact, bool) {
+	var contact Contact
+	ok, err := c.bucket.GetJSON(peerID, &contact)
+	return contact, err == nil && ok
+}
+
+// Put saves a peer's mailbox address and remembers the room it was seen in
+func (c *Contacts) Put(contact Contact, roomID string) error {
+	if old, ok := c.Get(contact.PeerID); ok && old.Fingerprint == contact.Fingerprint {
+		contact.Rooms = old.Rooms
+	}
+	if roomID != "" {
+		contact.Rooms = slices.DeleteFunc(contact.Rooms, func(r string) bool { return r == roomID })
+		contact.Rooms = append(contact.Rooms, roomID)
+		if len(contact.Rooms) > maxContactRooms {
+			contact.Rooms = contact.Rooms[len(contact.Rooms)-maxContactRooms:]
+		}
+	}
+	contact.UpdatedAt = time.Now()
+	return c.bucket.PutJSON(contact.PeerID, contact)
+}
+
+// InRoom lists the contacts we met in a room
+func (c *Contacts) InRoom(roomID string) []Contact {
+	var contacts []Contact
+	for _, peerID := range c.bucket.Keys() {
+		if contact, ok := c.Get(peerID); ok && slices.Contains(contact.Rooms, roomID) {
+			contacts = append(contacts, contact)
+		}
+	}
+	return contacts
+}
+
+// Forget removes a peer's mailbox address
+func (c *Contacts) Forget(peerID string) error {
+	return c.bucket.SecureDelete(peerID)
+}
@@ -0,0 +1,135 @@
+// Package mailbox parks sealed messages for offline peers on a relay (the
+// signaling server) and fetches the ones parked for us. The relay only sees
+// opaque envelopes sealed to the recipient's identity key; it stores them
+// under a mailbox ID, the SHA-256 of a secret only the recipient knows.
+// Anyone can deposit, only the holder of the secret can read and delete.
+// The relay also keeps contact bundles under user IDs, through which people
+// we haven't met find our mailbox.
+package mailbox
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+)
+
+const (
+	// MaxEnvelopeSize is the largest envelope the relay accepts
+	MaxEnvelopeSize = 256 << 10
+
+	secretHeader   = "X-Mailbox-Secret"
+	requestTimeout = 15 * time.Second
+)
+
+// ErrNotFound is returned when the relay has nothing under the ID asked for
+var ErrNotFound = errors.New("not found on the mailbox relay")
+
+// Item is an envelope waiting in our mailbox
+type Item struct {
+	ID       string `json:"id"`
+	Data     []byte `json:"data"`
+	Received int64  `json:"received"`
+}
+
+// Client talks to the mailbox API of a relay server
+type Client struct {
+	server string
+	http   *http.Client
+}
+
+// NewClient returns a client for the relay at serverURL (e.g. "https://relay.example.com")
+func NewClient(serverURL string) *Client {
+	return &Client{
+		server: strings.TrimRight(serverURL, "/"),
+		http:   &http.Client{Timeout: requestTimeout},
+	}
+}
+
+// Server is the relay URL
+func (c *Client) Server() string {
+	return c.server
+}
+
+// ID derives the public mailbox ID from its secret
+func ID(secret []byte) string {
+	sum := sha256.Sum256(secret)
+	return hex.EncodeToString(sum[:])
+}
+
+// Deposit parks an envelope in someone's mailbox on the relay at server
+func (c *Client) Deposit(ctx context.Context, server, mailboxID string, envelope []byte) error {
+	if len(envelope) > MaxEnvelopeSize {
+		return fmt.Errorf("envelope too large for the mailbox (%d bytes)", len(envelope))
+	}
+	body, err := json.Marshal(map[string][]byte{"data": envelope})
+	if err != nil {
+		return err
+	}
+	url := fmt.Sprintf("%s/api/mailbox/%s", strings.TrimRight(server, "/"), mailboxID)
+	return c.do(ctx, http.MethodPost, url, nil, body, nil)
+}
+
+// Fetch lists the envelopes in our mailbox; they stay there until Ack
+func (c *Client) Fetch(ctx context.Context, secret []byte) ([]Item, error) {
+	var items []Item
+	url := fmt.Sprintf("%s/api/mailbox/%s", c.server, ID(secret))
+	if err := c.do(ctx, http.MethodGet, url, secret, nil, &items); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+// Ack deletes fetched envelopes from our mailbox
+func (c *Client) Ack(ctx context.Context, secret []byte, ids []string) error {
+	if len(ids) == 0 {
+		return nil
+	}
+	body, err := json.Marshal(map[string][]string{"ids": ids})
+	if err != nil {
+		return err
+	}
+	url := fmt.Sprintf("%s/api/mailbox/%s/ack", c.server, ID(secret))
+	return c.do(ctx, http.MethodPost, url, secret, body, nil)
+}
+
+func (c *Client) do(ctx context.Context, method, url string, secret, body []byte, out interface{}) error {
+	var reader io.Reader
+	if body != nil {
+		reader = bytes.NewReader(body)
+	}
+	req, err := http.NewRequestWithContext(ctx, method, url, reader)
+	if err != nil {
+		return err
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	if secret != nil {
+		req.Header.Set(secretHeader, hex.EncodeToString(secret))
+	}
+
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return fmt.Errorf("mailbox relay unreachable: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode == http.StatusNotFound {
+		return ErrNotFound
+	}
+	if resp.StatusCode != http.StatusOK {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return fmt.Errorf("mailbox relay returned %d: %s", resp.StatusCode, strings.TrimSpace(string(msg)))
+	}
+	if out == nil {
+		return nil
+	}
+	return json.NewDecoder(resp.Body).Decode(out)
+}
@@ -0,0 +1,319 @@
+package media
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"execp2p/internal/crypto"
+	"execp2p/internal/logger"
+	"execp2p/internal/storage"
+)
+
+const (
+	// CacheDirName is the media cache directory inside the cache directory
+	CacheDirName = "media"
+	// IndexBucket is the storage bucket describing the cached files
+	IndexBucket = "media"
+
+	cacheFileExt = ".bin"
+	// access times are written to the index at most this often per item
+	touchInterval = time.Hour
+)
+
+// cacheEntry is the index record of one cached file. Every file is sealed
+// with a key of its own that only lives in the encrypted database: dropping
+// the record leaves the file unreadable.
+type cacheEntry struct {
+	ContentType string    `json:"content_type"`
+	Name        string    `json:"name,omitempty"`
+	SenderID    string    `json:"sender_id"`
+	Size        int64     `json:"size"`
+	Stored      time.Time `json:"stored"`
+	Used        time.Time `json:"used"`
+	Key         []byte    `json:"key"`
+}
+
+// DiskCache keeps media in files under a data directory, up to a size
+// limit, dropping the least recently used first. Files are encrypted with
+// crypto.EncryptStream; their keys and metadata are kept in an index bucket
+// of the local database. While an incognito room is active nothing is
+// written.
+type DiskCache struct {
+	dir   string
+	limit int64
+	index *storage.Bucket
+
+	mu      sync.Mutex
+	entries map[string]*cacheEntry
+	size    int64
+}
+
+// OpenDiskCache opens the cache in dir with its index bucket. Files without
+// a record and records without a file are dropped, then the cache is
+// trimmed to limit.
+func OpenDiskCache(dir string, index *storage.Bucket, limit int64) (*DiskCache, error) {
+	if limit <= 0 {
+		return nil, fmt.Errorf("invalid media cache size %d", limit)
+	}
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		return nil, fmt.Errorf("failed to create media cache directory: %w", err)
+	}
+	c := &DiskCache{dir: dir, limit: limit, index: index, entries: make(map[string]*cacheEntry)}
+
+	for _, id := range index.Keys() {
+		var entry cacheEntry
+		ok, err := index.GetJSON(id, &entry)
+		if !ok || err != nil || !validID(id) || !fileExists(c.path(id)) {
+			index.Delete(id)
+			continue
+		}
+		c.entries[id] = &entry
+		c.size += entry.Size
+	}
+
+	files, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read media cache directory: %w", err)
+	}
+	for _, f := range files {
+		id, ok := strings.CutSuffix(f.Name(), cacheFileExt)
+		if _, known := c.entries[id]; !ok || !known {
+			// leftovers of an interrupted write or a lost index
+			os.Remove(filepath.Join(dir, f.Name()))
+		}
+	}
+
+	c.mu.Lock()
+	c.trimLocked()
+	c.mu.Unlock()
+	return c, nil
+}
+
+// Limit returns how many bytes the cache may hold
+func (c *DiskCache) Limit() int64 {
+	return c.limit
+}
+
+// Put writes an item to the cache, replacing one with the same ID
+func (c *DiskCache) Put(item Item) error {
+	if !validID(item.ID) {
+		return fmt.Errorf("invalid media ID %q", item.ID)
+	}
+	size := int64(len(item.Data))
+	if size > c.limit {
+		return fmt.Errorf("media too large to cache (%d bytes)", size)
+	}
+	if err := storage.Allow(""); err != nil {
+		return err
+	}
+	key, err := crypto.NewStreamKey()
+	if err != nil {
+		return err
+	}
+	if err := c.writeFile(item.ID, key, item.Data); err != nil {
+		return err
+	}
+
+	now := time.Now()
+	entry := &cacheEntry{
+		ContentType: item.ContentType,
+		Name:        item.Name,
+		SenderID:    item.SenderID,
+		Size:        size,
+		Stored:      item.Stored,
+		Used:        now,
+		Key:         key,
+	}
+	if entry.Stored.IsZero() {
+		entry.Stored = now
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if err := c.index.PutJSON(item.ID, entry); err != nil {
+		os.Remove(c.path(item.ID))
+		return err
+	}
+	if old, ok := c.entries[item.ID]; ok {
+		c.size -= old.Size
+	}
+	c.entries[item.ID] = entry
+	c.size += size
+	c.trimLocked()
+	return nil
+}
+
+// Get reads an item from the cache
+func (c *DiskCache) Get(id string) (Item, bool) {
+	c.mu.Lock()
+	entry, ok := c.entries[id]
+	if ok {
+		stale := time.Since(entry.Used) > touchInterval
+		entry.Used = time.Now()
+		if stale {
+			// best effort: refused while an incognito room is active
+			c.index.PutJSON(id, entry)
+		}
+	}
+	c.mu.Unlock()
+	if !ok {
+		return Item{}, false
+	}
+
+	data, err := c.readFile(id, entry.Key, entry.Size)
+	if err != nil {
+		logger.L().Warn("Dropping unreadable cached media", "id", id, "err", err)
+		c.mu.Lock()
+		// unless it has been replaced meanwhile
+		if c.entries[id] == entry {
+			c.removeLocked(id)
+		}
+		c.mu.Unlock()
+		return Item{}, false
+	}
+	return Item{
+		ID:          id,
+		ContentType: entry.ContentType,
+		Name:        entry.Name,
+		SenderID:    entry.SenderID,
+		Data:        data,
+		Stored:      entry.Stored,
+	}, true
+}
+
+// Stats returns the number of cached items and their size in bytes
+func (c *DiskCache) Stats() (int, int64) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return len(c.entries), c.size
+}
+
+// Clear shreds every cached file and drops the index
+func (c *DiskCache) Clear() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	var errs []error
+	for id := range c.entries {
+		if err := storage.Shred(c.path(id)); err != nil && !os.IsNotExist(err) {
+			errs = append(errs, err)
+		}
+		if err := c.index.Delete(id); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	c.entries = make(map[string]*cacheEntry)
+	c.size = 0
+	if err := c.index.Compact(); err != nil {
+		errs = append(errs, err)
+	}
+	return errors.Join(errs...)
+}
+
+// trimLocked drops the least recently used items until the cache fits its limit
+func (c *DiskCache) trimLocked() {
+	if c.size <= c.limit {
+		return
+	}
+	ids := make([]string, 0, len(c.entries))
+	for id := range c.entries {
+		ids = append(ids, id)
+	}
+	sort.Slice(ids, func(i, j int) bool {
+		return c.entries[ids[i]].Used.Before(c.entries[ids[j]].Used)
+	})
+	for _, id := range ids {
+		if c.size <= c.limit {
+			break
+		}
+		c.removeLocked(id)
+	}
+}
+
+func (c *DiskCache) removeLocked(id string) {
+	entry, ok := c.entries[id]
+	if !ok {
+		return
+	}
+	delete(c.entries, id)
+	c.size -= entry.Size
+	c.index.Delete(id)
+	os.Remove(c.path(id))
+}
+
+// writeFile seals data into a temporary file and moves it in place
+func (c *DiskCache) writeFile(id string, key, data []byte) error {
+	tmp, err := os.CreateTemp(c.dir, "."+id+"-*")
+	if err != nil {
+		return fmt.Errorf("failed to create cache file: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+
+	enc, err := crypto.EncryptStream(tmp, key, []byte(id))
+	if err == nil {
+		_, err = enc.Write(data)
+	}
+	if err == nil {
+		err = enc.Close()
+	}
+	if err == nil {
+		err = tmp.Sync()
+	}
+	if cerr := tmp.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		return fmt.Errorf("failed to write cache file: %w", err)
+	}
+	return os.Rename(tmp.Name(), c.path(id))
+}
+
+func (c *DiskCache) readFile(id string, key []byte, size int64) ([]byte, error) {
+	f, err := os.Open(c.path(id))
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	plain, err := crypto.DecryptStream(f, key, []byte(id))
+	if err != nil {
+		return nil, err
+	}
+	var buf bytes.Buffer
+	buf.Grow(int(size))
+	if _, err := io.Copy(&buf, plain); err != nil {
+		return nil, err
+	}
+	if int64(buf.Len()) != size {
+		return nil, fmt.Errorf("cached media has %d bytes, expected %d", buf.Len(), size)
+	}
+	return buf.Bytes(), nil
+}
+
+func (c *DiskCache) path(id string) string {
+	return filepath.Join(c.dir, id+cacheFileExt)
+}
+
+// validID accepts media IDs as made by NewID, which are safe file names
+func validID(id string) bool {
+	if len(id) != 32 {
+		return false
+	}
+	for _, r := range id {
+		if (r < '0' || r > '9') && (r < 'a' || r > 'f') {
+			return false
+		}
+	}
+	return true
+}
+
+func fileExists(path string) bool {
+	_, err := os.Stat(path)
+	return err == nil
+}
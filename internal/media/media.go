@@ -0,0 +1,203 @@
+// Package media keeps the pictures and voice messages exchanged in chat.
+// They travel on media streams of their own (network/media.go); chat
+// messages only carry the media ID.
+package media
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"mime"
+	"sync"
+	"time"
+
+	"execp2p/internal/logger"
+	"execp2p/internal/storage"
+)
+
+// DefaultBudget is how many bytes of media a Store keeps in memory by default
+const DefaultBudget = 128 << 20
+
+// allowedTypes are the content types we send and display. SVG and HTML are
+// left out on purpose: media is served to the web view.
+var allowedTypes = map[string]bool{
+	"image/png":  true,
+	"image/jpeg": true,
+	"image/gif":  true,
+	"image/webp": true,
+	"audio/webm": true,
+	"audio/ogg":  true,
+	"audio/mpeg": true,
+	"audio/mp4":  true,
+	"audio/wav":  true,
+	// files of any kind, never displayed
+	"application/octet-stream": true,
+}
+
+// Allowed reports whether media of a content type may be sent and shown
+func Allowed(contentType string) bool {
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	return err == nil && allowedTypes[mediaType]
+}
+
+// NewID returns a random media ID
+func NewID() (string, error) {
+	id := make([]byte, 16)
+	if _, err := rand.Read(id); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(id), nil
+}
+
+// Item is one stored media file
+type Item struct {
+	ID          string
+	ContentType string
+	Name        string
+	SenderID    string
+	Data        []byte
+	Stored      time.Time
+}
+
+// Store keeps media in memory up to a byte budget, dropping the least
+// recently used items first. With a disk cache every item is written there
+// as well, and items that fell out of memory are read back from it.
+type Store struct {
+	mu     sync.Mutex
+	budget int64
+	size   int64
+	items  map[string]*Item
+	order  []string
+	disk   *DiskCache
+}
+
+// Stats describes what a Store holds
+type Stats struct {
+	MemoryItems int
+	MemorySize  int64
+	MemoryLimit int64
+	DiskItems   int
+	DiskSize    int64
+	DiskLimit   int64
+}
+
+// NewStore returns an empty store that holds up to budget bytes in memory;
+// disk may be nil
+func NewStore(budget int64, disk *DiskCache) *Store {
+	if budget <= 0 {
+		budget = DefaultBudget
+	}
+	return &Store{budget: budget, items: make(map[string]*Item), disk: disk}
+}
+
+// Put stores an item, replacing one with the same ID. An item the disk
+// cache refuses (incognito room, too large) is kept in memory only.
+func (s *Store) Put(item Item) error {
+	if item.Stored.IsZero() {
+		item.Stored = time.Now()
+	}
+	cached := false
+	if s.disk != nil {
+		err := s.disk.Put(item)
+		if err != nil && !errors.Is(err, storage.ErrIncognito) {
+			logger.L().Warn("Media not cached on disk", "id", item.ID, "err", err)
+		}
+		cached = err == nil
+	}
+	if err := s.keep(item); err != nil && !cached {
+		return err
+	}
+	return nil
+}
+
+// Get returns a stored item
+func (s *Store) Get(id string) (Item, bool) {
+	s.mu.Lock()
+	item, ok := s.items[id]
+	if ok {
+		s.touchLocked(id)
+	}
+	s.mu.Unlock()
+	if ok {
+		return *item, true
+	}
+	if s.disk == nil {
+		return Item{}, false
+	}
+	found, ok := s.disk.Get(id)
+	if !ok {
+		return Item{}, false
+	}
+	s.keep(found)
+	return found, true
+}
+
+// Stats returns what the store holds in memory and on disk
+func (s *Store) Stats() Stats {
+	s.mu.Lock()
+	stats := Stats{MemoryItems: len(s.items), MemorySize: s.size, MemoryLimit: s.budget}
+	s.mu.Unlock()
+	if s.disk != nil {
+		stats.DiskItems, stats.DiskSize = s.disk.Stats()
+		stats.DiskLimit = s.disk.Limit()
+	}
+	return stats
+}
+
+// Clear drops every stored item, shredding the disk cache
+func (s *Store) Clear() error {
+	s.mu.Lock()
+	s.items = make(map[string]*Item)
+	s.order = nil
+	s.size = 0
+	s.mu.Unlock()
+	if s.disk != nil {
+		return s.disk.Clear()
+	}
+	return nil
+}
+
+// keep holds an item in memory
+func (s *Store) keep(item Item) error {
+	size := int64(len(item.Data))
+	if size > s.budget {
+		return fmt.Errorf("media too large to keep (%d bytes)", size)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.removeLocked(item.ID)
+	for s.size+size > s.budget && len(s.order) > 0 {
+		s.removeLocked(s.order[0])
+	}
+	s.items[item.ID] = &item
+	s.order = append(s.order, item.ID)
+	s.size += size
+	return nil
+}
+
+// touchLocked moves an item to the recently used end
+func (s *Store) touchLocked(id string) {
+	for i, other := range s.order {
+		if other == id {
+			s.order = append(append(s.order[:i], s.order[i+1:]...), id)
+			return
+		}
+	}
+}
+
+func (s *Store) removeLocked(id string) {
+	item, ok := s.items[id]
+	if !ok {
+		return
+	}
+	delete(s.items, id)
+	s.size -= int64(len(item.Data))
+	for i, other := range s.order {
+		if other == id {
+			s.order = append(s.order[:i], s.order[i+1:]...)
+			break
+		}
+	}
+}
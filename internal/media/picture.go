@@ -0,0 +1,352 @@
+package media
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"image"
+	"image/draw"
+	"image/gif"
+	"image/jpeg"
+	"image/png"
+	"mime"
+)
+
+// Pictures are prepared before they are sent: decoded and encoded again,
+// which drops EXIF (GPS position, camera, time), XMP and comments, turned
+// upright according to the EXIF orientation, scaled down for the chat and
+// given a thumbnail. The full-resolution picture stays with the sender
+// until the peer asks for it.
+
+const (
+	// MaxDimension is the longest side of the picture shown in the chat
+	MaxDimension = 2048
+	// ThumbnailDimension is the longest side of a thumbnail
+	ThumbnailDimension = 320
+
+	jpegQuality      = 85
+	thumbnailQuality = 75
+)
+
+// Picture is a picture ready to be sent
+type Picture struct {
+	// the picture for the chat, without metadata and at most MaxDimension
+	ContentType string
+	Data        []byte
+	Width       int
+	Height      int
+
+	// a small preview; nil if the picture can't be decoded here (WebP)
+	Thumbnail     []byte
+	ThumbnailType string
+
+	// the full-resolution picture without metadata; nil when Data already
+	// is full resolution
+	Original       []byte
+	OriginalWidth  int
+	OriginalHeight int
+}
+
+// PreparePicture strips metadata from a picture, scales it down and makes
+// a thumbnail
+func PreparePicture(data []byte, contentType string) (*Picture, error) {
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return nil, fmt.Errorf("invalid content type %q", contentType)
+	}
+	switch mediaType {
+	case "image/jpeg":
+		img, err := jpeg.Decode(bytes.NewReader(data))
+		if err != nil {
+			return nil, fmt.Errorf("invalid JPEG: %w", err)
+		}
+		return prepareStill(orient(toRGBA(img), jpegOrientation(data)), mediaType)
+	case "image/png":
+		img, err := png.Decode(bytes.NewReader(data))
+		if err != nil {
+			return nil, fmt.Errorf("invalid PNG: %w", err)
+		}
+		return prepareStill(toRGBA(img), mediaType)
+	case "image/gif":
+		return prepareGIF(data)
+	case "image/webp":
+		stripped, err := stripWebPMetadata(data)
+		if err != nil {
+			return nil, err
+		}
+		return &Picture{ContentType: mediaType, Data: stripped}, nil
+	}
+	return nil, fmt.Errorf("unsupported picture type %q", contentType)
+}
+
+// prepareStill scales a decoded picture and encodes it again
+func prepareStill(img *image.RGBA, mediaType string) (*Picture, error) {
+	w, h := img.Bounds().Dx(), img.Bounds().Dy()
+	pic := &Picture{ContentType: mediaType}
+
+	shown := img
+	if w > MaxDimension || h > MaxDimension {
+		original, err := encodeStill(img, mediaType, jpegQuality)
+		if err != nil {
+			return nil, err
+		}
+		pic.Original, pic.OriginalWidth, pic.OriginalHeight = original, w, h
+		shown = fit(img, MaxDimension)
+	}
+	data, err := encodeStill(shown, mediaType, jpegQuality)
+	if err != nil {
+		return nil, err
+	}
+	pic.Data, pic.Width, pic.Height = data, shown.Bounds().Dx(), shown.Bounds().Dy()
+
+	if err := pic.thumbnail(img, mediaType); err != nil {
+		return nil, err
+	}
+	return pic, nil
+}
+
+// prepareGIF encodes a GIF again frame by frame, which drops comments and
+// application data. Animations keep their size; scaling every frame would
+// need a new palette per frame.
+func prepareGIF(data []byte) (*Picture, error) {
+	anim, err := gif.DecodeAll(bytes.NewReader(data))
+	if err != nil {
+		return nil, fmt.Errorf("invalid GIF: %w", err)
+	}
+	var buf bytes.Buffer
+	if err := gif.EncodeAll(&buf, anim); err != nil {
+		return nil, err
+	}
+	pic := &Picture{
+		ContentType: "image/gif",
+		Data:        buf.Bytes(),
+		Width:       anim.Config.Width,
+		Height:      anim.Config.Height,
+	}
+
+	// the first frame, drawn on the logical screen, is the thumbnail
+	first := image.NewRGBA(image.Rect(0, 0, anim.Config.Width, anim.Config.Height))
+	if len(anim.Image) > 0 {
+		draw.Draw(first, anim.Image[0].Bounds(), anim.Image[0], anim.Image[0].Bounds().Min, draw.Over)
+	}
+	if err := pic.thumbnail(first, "image/png"); err != nil {
+		return nil, err
+	}
+	return pic, nil
+}
+
+// thumbnail is JPEG for photos and PNG where transparency may matter
+func (p *Picture) thumbnail(img *image.RGBA, mediaType string) error {
+	data, err := encodeStill(fit(img, ThumbnailDimension), mediaType, thumbnailQuality)
+	if err != nil {
+		return err
+	}
+	p.Thumbnail, p.ThumbnailType = data, mediaType
+	return nil
+}
+
+func encodeStill(img image.Image, mediaType string, quality int) ([]byte, error) {
+	var buf bytes.Buffer
+	var err error
+	if mediaType == "image/jpeg" {
+		err = jpeg.Encode(&buf, img, &jpeg.Options{Quality: quality})
+	} else {
+		err = png.Encode(&buf, img)
+	}
+	return buf.Bytes(), err
+}
+
+func toRGBA(img image.Image) *image.RGBA {
+	b := img.Bounds()
+	rgba := image.NewRGBA(image.Rect(0, 0, b.Dx(), b.Dy()))
+	draw.Draw(rgba, rgba.Bounds(), img, b.Min, draw.Src)
+	return rgba
+}
+
+// fit scales img down so that its longer side is at most max
+func fit(img *image.RGBA, max int) *image.RGBA {
+	w, h := img.Bounds().Dx(), img.Bounds().Dy()
+	if w <= max && h <= max {
+		return img
+	}
+	if w >= h {
+		h = (h*max + w/2) / w
+		w = max
+	} else {
+		w = (w*max + h/2) / h
+		h = max
+	}
+	return scaleDown(img, w, h)
+}
+
+// scaleDown averages the source pixels covered by every target pixel (box
+// filter); good for shrinking, which is all we do
+func scaleDown(src *image.RGBA, w, h int) *image.RGBA {
+	if w < 1 {
+		w = 1
+	}
+	if h < 1 {
+		h = 1
+	}
+	sw, sh := src.Bounds().Dx(), src.Bounds().Dy()
+	dst := image.NewRGBA(image.Rect(0, 0, w, h))
+	for y := 0; y < h; y++ {
+		y0, y1 := y*sh/h, (y+1)*sh/h
+		if y1 == y0 {
+			y1 = y0 + 1
+		}
+		for x := 0; x < w; x++ {
+			x0, x1 := x*sw/w, (x+1)*sw/w
+			if x1 == x0 {
+				x1 = x0 + 1
+			}
+			var r, g, b, a, n uint32
+			for sy := y0; sy < y1; sy++ {
+				row := src.Pix[sy*src.Stride+x0*4 : sy*src.Stride+x1*4]
+				for i := 0; i < len(row); i += 4 {
+					r += uint32(row[i])
+					g += uint32(row[i+1])
+					b += uint32(row[i+2])
+					a += uint32(row[i+3])
+					n++
+				}
+			}
+			o := y*dst.Stride + x*4
+			dst.Pix[o] = uint8(r / n)
+			dst.Pix[o+1] = uint8(g / n)
+			dst.Pix[o+2] = uint8(b / n)
+			dst.Pix[o+3] = uint8(a / n)
+		}
+	}
+	return dst
+}
+
+// orient turns a picture upright according to its EXIF orientation (1-8)
+func orient(img *image.RGBA, orientation int) *image.RGBA {
+	if orientation < 2 || orientation > 8 {
+		return img
+	}
+	w, h := img.Bounds().Dx(), img.Bounds().Dy()
+	// orientations 5-8 swap width and height
+	dw, dh := w, h
+	if orientation >= 5 {
+		dw, dh = h, w
+	}
+	dst := image.NewRGBA(image.Rect(0, 0, dw, dh))
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			var dx, dy int
+			switch orientation {
+			case 2: // mirrored
+				dx, dy = w-1-x, y
+			case 3: // rotated 180°
+				dx, dy = w-1-x, h-1-y
+			case 4: // mirrored vertically
+				dx, dy = x, h-1-y
+			case 5: // mirrored along the main diagonal
+				dx, dy = y, x
+			case 6: // rotated 90° clockwise
+				dx, dy = h-1-y, x
+			case 7: // mirrored along the anti-diagonal
+				dx, dy = h-1-y, w-1-x
+			case 8: // rotated 90° counter-clockwise
+				dx, dy = y, w-1-x
+			}
+			copy(dst.Pix[dy*dst.Stride+dx*4:dy*dst.Stride+dx*4+4], img.Pix[y*img.Stride+x*4:y*img.Stride+x*4+4])
+		}
+	}
+	return dst
+}
+
+// jpegOrientation reads the EXIF orientation of a JPEG; 1 (upright) if
+// there is none
+func jpegOrientation(data []byte) int {
+	if len(data) < 4 || data[0] != 0xFF || data[1] != 0xD8 {
+		return 1
+	}
+	for i := 2; i+4 <= len(data); {
+		if data[i] != 0xFF {
+			return 1
+		}
+		marker := data[i+1]
+		// start of scan: no more metadata
+		if marker == 0xDA {
+			return 1
+		}
+		size := int(binary.BigEndian.Uint16(data[i+2:]))
+		if size < 2 || i+2+size > len(data) {
+			return 1
+		}
+		segment := data[i+4 : i+2+size]
+		if marker == 0xE1 && bytes.HasPrefix(segment, []byte("Exif\x00\x00")) {
+			return exifOrientation(segment[6:])
+		}
+		i += 2 + size
+	}
+	return 1
+}
+
+// exifOrientation finds tag 0x0112 in IFD0 of a TIFF structure
+func exifOrientation(tiff []byte) int {
+	if len(tiff) < 8 {
+		return 1
+	}
+	var order binary.ByteOrder
+	switch string(tiff[:2]) {
+	case "II":
+		order = binary.LittleEndian
+	case "MM":
+		order = binary.BigEndian
+	default:
+		return 1
+	}
+	ifd := int(order.Uint32(tiff[4:]))
+	if ifd+2 > len(tiff) {
+		return 1
+	}
+	entries := int(order.Uint16(tiff[ifd:]))
+	for n := 0; n < entries; n++ {
+		entry := ifd + 2 + n*12
+		if entry+12 > len(tiff) {
+			return 1
+		}
+		if order.Uint16(tiff[entry:]) == 0x0112 {
+			return int(order.Uint16(tiff[entry+8:]))
+		}
+	}
+	return 1
+}
+
+// stripWebPMetadata drops the EXIF and XMP chunks of a WebP file, which
+// can't be decoded here, and clears their flags
+func stripWebPMetadata(data []byte) ([]byte, error) {
+	if len(data) < 12 || string(data[:4]) != "RIFF" || string(data[8:12]) != "WEBP" {
+		return nil, fmt.Errorf("invalid WebP")
+	}
+	out := append([]byte(nil), data[:12]...)
+	for i := 12; i < len(data); {
+		if i+8 > len(data) {
+			return nil, fmt.Errorf("invalid WebP chunk")
+		}
+		size := int(binary.LittleEndian.Uint32(data[i+4:]))
+		end := i + 8 + size + size%2
+		if size < 0 || end > len(data) {
+			return nil, fmt.Errorf("invalid WebP chunk")
+		}
+		switch string(data[i : i+4]) {
+		case "EXIF", "XMP ":
+		case "VP8X":
+			chunk := append([]byte(nil), data[i:end]...)
+			if len(chunk) > 8 {
+				// flags: bit 3 EXIF, bit 2 XMP
+				chunk[8] &^= 0x0C
+			}
+			out = append(out, chunk...)
+		default:
+			out = append(out, data[i:end]...)
+		}
+		i = end
+	}
+	binary.LittleEndian.PutUint32(out[4:], uint32(len(out)-8))
+	return out, nil
+}
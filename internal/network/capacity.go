@@ -0,0 +1,36 @@
+package network
+
+import (
+	"errors"
+	"slices"
+)
+
+// Room capacity.
+//
+// The host counts itself and every connected peer against the room's
+// MaxPeers. An announcement from a new peer that would go beyond it is
+// refused with closeCodeRoomFull, which the joiner reports as ErrRoomFull
+// rather than retrying. Peers already in the room may reconnect.
+
+// ErrRoomFull means the room already has as many members as it allows
+var ErrRoomFull = errors.New("pokój jest pełny")
+
+// SetMaxPeers sets how many members the room allows, the host included;
+// 0 means no limit (host)
+func (qn *QuicNetwork) SetMaxPeers(n int) {
+	qn.maxPeers.Store(int64(n))
+}
+
+// roomFull reports whether admitting peerID would exceed the room's limit
+func (qn *QuicNetwork) roomFull(peerID string) bool {
+	limit := int(qn.maxPeers.Load())
+	if !qn.isListener || limit <= 0 {
+		return false
+	}
+	connected := qn.connectedPeerIDs()
+	if slices.Contains(connected, peerID) {
+		return false
+	}
+	// the host takes one place
+	return len(connected)+1 >= limit
+}
@@ -0,0 +1,164 @@
+package network
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/hex"
+	"fmt"
+	"math/big"
+	"time"
+
+	"github.com/quic-go/quic-go"
+)
+
+// Transport certificates.
+//
+// Every peer presents a self-signed certificate on its QUIC connections, the
+// guest too (the host asks for it). Its signed announcement names the
+// certificate's fingerprint and carries an identity signature over the
+// certificate's public key (crypto.SignTLSKey): the certificate is bound to
+// the identity by a signature over its key, not only by comparing
+// fingerprint strings. The application keeps one certificate per identity
+// (SetCertificate), so peers can pin it next to the identity and notice
+// when a known identity turns up with another one (CertVerifier).
+
+// CertVerifier decides whether a peer whose identity has the given
+// fingerprint may present a transport certificate with certFingerprint.
+// A non-nil error refuses the connection.
+type CertVerifier func(peerID, fingerprint, certFingerprint string) error
+
+// transport certificate key types
+const (
+	// the default: the smallest certificates and handshakes, and a key
+	// made in no time
+	KeyEd25519 = "ed25519"
+	// P-256
+	KeyECDSA = "ecdsa"
+	// RSA-2048, for platforms whose TLS stack lacks the others
+	KeyRSA = "rsa"
+)
+
+// NewCertificate makes a self-signed transport certificate with a key of
+// keyType, Ed25519 when empty
+func NewCertificate(keyType string) (tls.Certificate, error) {
+	var key crypto.Signer
+	var err error
+	usage := x509.KeyUsageDigitalSignature
+	switch keyType {
+	case KeyEd25519, "":
+		_, key, err = ed25519.GenerateKey(rand.Reader)
+	case KeyECDSA:
+		key, err = ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	case KeyRSA:
+		key, err = rsa.GenerateKey(rand.Reader, 2048)
+		usage |= x509.KeyUsageKeyEncipherment
+	default:
+		return tls.Certificate{}, fmt.Errorf("unknown certificate key type %q", keyType)
+	}
+	if err != nil {
+		return tls.Certificate{}, err
+	}
+	template := x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject: pkix.Name{
+			Organization: []string{"ExecP2P"},
+		},
+		NotBefore: time.Now(),
+		NotAfter:  time.Now().Add(time.Hour * 24 * 365),
+
+		KeyUsage:              usage,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
+		BasicConstraintsValid: true,
+	}
+	certDER, err := x509.CreateCertificate(rand.Reader, &template, &template, key.Public(), key)
+	if err != nil {
+		return tls.Certificate{}, err
+	}
+	return tls.Certificate{Certificate: [][]byte{certDER}, PrivateKey: key}, nil
+}
+
+// CertificateKeyType returns the key type of cert, empty if it is none of
+// the known ones
+func CertificateKeyType(cert tls.Certificate) string {
+	switch cert.PrivateKey.(type) {
+	case ed25519.PrivateKey:
+		return KeyEd25519
+	case *ecdsa.PrivateKey:
+		return KeyECDSA
+	case *rsa.PrivateKey:
+		return KeyRSA
+	}
+	return ""
+}
+
+// SetCertificate sets the transport certificate; without one a fresh one is
+// made when the network starts. Call before Start.
+func (qn *QuicNetwork) SetCertificate(cert tls.Certificate) {
+	qn.certificate = &cert
+}
+
+// SetCertVerifier installs a check run on every peer announcement, after
+// the identity check
+func (qn *QuicNetwork) SetCertVerifier(verifier CertVerifier) {
+	qn.keyExchangeMutex.Lock()
+	qn.certVerifier = verifier
+	qn.keyExchangeMutex.Unlock()
+}
+
+// tlsConfig is the TLS config of both ends: our certificate, and the
+// peer's asked for. Chains aren't verified; the announcement vouches for
+// the certificate.
+func (qn *QuicNetwork) tlsConfig() (*tls.Config, error) {
+	if qn.certificate == nil {
+		cert, err := NewCertificate(KeyEd25519)
+		if err != nil {
+			return nil, err
+		}
+		qn.certificate = &cert
+	}
+	parsed, err := x509.ParseCertificate(qn.certificate.Certificate[0])
+	if err != nil {
+		return nil, err
+	}
+	qn.localCertFingerprint = certFingerprint(parsed.Raw)
+	qn.localCertPublicKey = parsed.RawSubjectPublicKeyInfo
+	return &tls.Config{
+		Certificates: []tls.Certificate{*qn.certificate},
+		NextProtos:   []string{"execp2p-chat"},
+		ClientAuth:   tls.RequireAnyClientCert,
+	}, nil
+}
+
+// certFingerprint is the hex SHA-256 of a DER certificate
+func certFingerprint(der []byte) string {
+	sum := sha256.Sum256(der)
+	return hex.EncodeToString(sum[:])
+}
+
+// peerCertFingerprint is the fingerprint of the certificate the peer
+// presented on conn, empty if it presented none
+func peerCertFingerprint(conn quic.Connection) string {
+	certs := conn.ConnectionState().TLS.PeerCertificates
+	if len(certs) == 0 {
+		return ""
+	}
+	return certFingerprint(certs[0].Raw)
+}
+
+// peerCertPublicKey is the public key (DER SubjectPublicKeyInfo) of the
+// certificate the peer presented on conn, nil if it presented none
+func peerCertPublicKey(conn quic.Connection) []byte {
+	certs := conn.ConnectionState().TLS.PeerCertificates
+	if len(certs) == 0 {
+		return nil
+	}
+	return certs[0].RawSubjectPublicKeyInfo
+}
@@ -0,0 +1,178 @@
+package network
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"execp2p/internal/diagnostics"
+	"execp2p/internal/frame"
+	"execp2p/internal/logger"
+	"execp2p/internal/wire"
+)
+
+// Splitting large chat frames.
+//
+// Every frame read is capped at maxFrameSize, so a peer can't make us buffer
+// a frame of any size. A chat frame whose payload is over chunkSize (a long
+// pasted text, a message carrying a lot of metadata) is therefore sent as
+// "chunk" frames of at most chunkSize each, on streams of their own, and put
+// back together on the receiving side before it is handled. A reassembled
+// payload is capped at maxReassembledSize, and one that isn't complete within
+// reassemblyTimeout is dropped. The payload is already encrypted and
+// authenticated, so chunks need no protection of their own: a tampered one
+// makes the whole message fail to decrypt.
+
+const (
+	chunkFrameType = frame.TypeChunk
+
+	// the largest payload sent in one frame
+	chunkSize = frame.ChunkSize
+	// the largest frame read from a stream
+	maxFrameSize = frame.MaxSize
+	// the largest payload put back together from chunks
+	maxReassembledSize = 16 << 20
+	// how many split frames may be in reassembly at once
+	maxReassemblies = 16
+	// how long the rest of a split frame is waited for
+	reassemblyTimeout = 30 * time.Second
+)
+
+// chunk is one piece of a split frame, the payload of a chunk frame
+type chunk = frame.Chunk
+
+// reassembly collects the pieces of one split frame
+type reassembly struct {
+	whole message
+	parts []string
+	have  int
+	size  int
+	timer *time.Timer
+}
+
+// reassemblies are the split frames being put back together, by sender and
+// chunk ID
+type reassemblies struct {
+	mu     sync.Mutex
+	frames map[string]*reassembly
+}
+
+// writeChunks sends w, whose payload is over chunkSize, split into chunk
+// frames
+func (qn *QuicNetwork) writeChunks(ctx context.Context, w message) error {
+	if len(w.Payload) > maxReassembledSize {
+		return fmt.Errorf("message too large (%d bytes, limit %d)", len(w.Payload), maxReassembledSize)
+	}
+	id := make([]byte, 8)
+	if _, err := rand.Read(id); err != nil {
+		return err
+	}
+	total := (len(w.Payload) + chunkSize - 1) / chunkSize
+	c := chunk{ID: hex.EncodeToString(id), Type: w.Type, Total: total}
+	logger.L().Debug("Sending frame in chunks", "type", w.Type, "size", len(w.Payload), "chunks", total)
+	diagnostics.Inc(diagnostics.MessageChunked)
+
+	for c.Index = 0; c.Index < total; c.Index++ {
+		end := min((c.Index+1)*chunkSize, len(w.Payload))
+		c.Data = w.Payload[c.Index*chunkSize : end]
+		if err := qn.writeWrapperContext(ctx, message{
+			Type:      chunkFrameType,
+			Body:      &c,
+			Timestamp: w.Timestamp,
+			SenderID:  w.SenderID,
+			RoomID:    w.RoomID,
+		}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// handleChunk adds a piece to its frame and handles the frame once it is
+// complete
+func (qn *QuicNetwork) handleChunk(w message) {
+	var c chunk
+	if err := wire.Unmarshal([]byte(w.Payload), &c); err != nil {
+		logger.L().Warn("Invalid chunk", "from", shortID(w.SenderID), "err", err)
+		return
+	}
+	if c.ID == "" || c.Data == "" || planeOf(c.Type) != planeChat || c.Type == chunkFrameType || c.Type == mediaFrameType ||
+		c.Total < 1 || c.Total > maxReassembledSize/chunkSize || c.Index < 0 || c.Index >= c.Total ||
+		len(c.Data) > chunkSize {
+		logger.L().Warn("Invalid chunk", "from", shortID(w.SenderID), "type", c.Type, "index", c.Index, "total", c.Total)
+		diagnostics.Inc(diagnostics.MessageUnassembled)
+		return
+	}
+
+	key := w.SenderID + "/" + c.ID
+	r := &qn.chunks
+	r.mu.Lock()
+	f := r.frames[key]
+	if f == nil {
+		if len(r.frames) >= maxReassemblies {
+			r.mu.Unlock()
+			logger.L().Warn("Too many split frames in reassembly; dropping", "from", shortID(w.SenderID))
+			diagnostics.Inc(diagnostics.MessageUnassembled)
+			return
+		}
+		f = &reassembly{
+			whole: message{Type: c.Type, Timestamp: w.Timestamp, SenderID: w.SenderID, RoomID: w.RoomID},
+			parts: make([]string, c.Total),
+		}
+		f.timer = time.AfterFunc(reassemblyTimeout, func() { qn.reassemblyTimedOut(key) })
+		if r.frames == nil {
+			r.frames = make(map[string]*reassembly)
+		}
+		r.frames[key] = f
+	}
+	if c.Type != f.whole.Type || c.Total != len(f.parts) || f.parts[c.Index] != "" {
+		r.mu.Unlock()
+		logger.L().Warn("Chunk doesn't match its frame", "from", shortID(w.SenderID), "index", c.Index)
+		return
+	}
+	f.parts[c.Index] = c.Data
+	f.have++
+	f.size += len(c.Data)
+	if f.have < len(f.parts) {
+		r.mu.Unlock()
+		return
+	}
+	f.timer.Stop()
+	delete(r.frames, key)
+	r.mu.Unlock()
+
+	whole := f.whole
+	whole.Payload = strings.Join(f.parts, "")
+	logger.L().Debug("Split frame reassembled", "type", whole.Type, "from", shortID(whole.SenderID), "size", f.size)
+	qn.handleChatFrame(whole)
+}
+
+// reassemblyTimedOut drops a split frame whose pieces didn't all arrive
+func (qn *QuicNetwork) reassemblyTimedOut(key string) {
+	r := &qn.chunks
+	r.mu.Lock()
+	f := r.frames[key]
+	delete(r.frames, key)
+	r.mu.Unlock()
+	if f == nil {
+		return
+	}
+	logger.L().Warn("Split frame incomplete; dropping", "from", shortID(f.whole.SenderID), "have", f.have, "total", len(f.parts))
+	diagnostics.Inc(diagnostics.MessageUnassembled)
+}
+
+// dropChunks forgets the split frames in reassembly; their remaining pieces
+// went with the connection
+func (qn *QuicNetwork) dropChunks() {
+	r := &qn.chunks
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for key, f := range r.frames {
+		f.timer.Stop()
+		delete(r.frames, key)
+	}
+}
@@ -0,0 +1,160 @@
+package network
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/quic-go/quic-go"
+
+	"execp2p/internal/logger"
+)
+
+// Why a connection ended.
+//
+// Every connection is closed with an application error code saying why,
+// and a short message. When the peer closes it, the side left behind
+// reports the reason on the error channel as a *CloseError and in the
+// PeerDisconnected event, so it can tell the user why the other side went
+// away. A guest the host removed, banned, turned away from a full room or
+// shut out of a closed one doesn't reconnect on its own.
+
+// application error codes connections are closed with
+const (
+	// nothing to report, e.g. redialing
+	closeCodeNone quic.ApplicationErrorCode = 0
+	// the handshake failed: wrong access key, invalid membership
+	// certificate or rejected identity
+	closeCodeRefused quic.ApplicationErrorCode = 1
+	// the host removed the peer, or refused a banned identity (kick.go)
+	closeCodeKicked quic.ApplicationErrorCode = 2
+	closeCodeBanned quic.ApplicationErrorCode = 3
+	// the room has no place left (capacity.go)
+	closeCodeRoomFull quic.ApplicationErrorCode = 4
+	// the host closed the room for good (closed.go)
+	closeCodeRoomClosed quic.ApplicationErrorCode = 5
+	// the peer is stopping: it left the room or the application quits
+	closeCodeShutdown quic.ApplicationErrorCode = 6
+	// the peer sent something it shouldn't have
+	closeCodeProtocol quic.ApplicationErrorCode = 7
+	// we have no protocol version in common (version.go)
+	closeCodeVersion quic.ApplicationErrorCode = 8
+)
+
+// Why a peer is gone, in PeerEvent.Reason, RekeyEvent.Reason and
+// CloseError.Reason
+const (
+	// it said goodbye or closed the connection because it was stopping
+	LeaveReasonLeft = "left"
+	// its connection was lost or closed without a reason
+	LeaveReasonDisconnected = "disconnected"
+	// the host removed it
+	LeaveReasonKicked = "kicked"
+	// its identity is banned from the room
+	LeaveReasonBanned = "banned"
+	// the handshake failed
+	LeaveReasonRefused = "refused"
+	// the room had no place left
+	LeaveReasonRoomFull = "room_full"
+	// the host closed the room for good
+	LeaveReasonRoomClosed = "room_closed"
+	// it broke the protocol
+	LeaveReasonProtocol = "protocol_violation"
+	// it speaks no protocol version we do
+	LeaveReasonVersion = "incompatible_version"
+)
+
+var (
+	// ErrPeerLeft means the peer closed the connection because it stopped
+	ErrPeerLeft = errors.New("peer left")
+	// ErrRefused means the peer refused the handshake
+	ErrRefused = errors.New("refused by the peer")
+	// ErrProtocol means the peer closed the connection over a protocol
+	// violation
+	ErrProtocol = errors.New("protocol violation")
+)
+
+// CloseError is reported on the error channel when the peer closed the
+// connection with a reason. errors.Is matches the error of its reason,
+// e.g. ErrBanned or ErrPeerLeft.
+type CloseError struct {
+	// one of the LeaveReason values
+	Reason string
+	// what the peer said
+	Message string
+}
+
+func (e *CloseError) Error() string {
+	if e.Message == "" {
+		return fmt.Sprintf("connection closed by the peer: %s", e.Reason)
+	}
+	return fmt.Sprintf("connection closed by the peer: %s (%s)", e.Reason, e.Message)
+}
+
+func (e *CloseError) Unwrap() error {
+	switch e.Reason {
+	case LeaveReasonLeft:
+		return ErrPeerLeft
+	case LeaveReasonKicked:
+		return ErrRemoved
+	case LeaveReasonBanned:
+		return ErrBanned
+	case LeaveReasonRefused:
+		return ErrRefused
+	case LeaveReasonRoomFull:
+		return ErrRoomFull
+	case LeaveReasonRoomClosed:
+		return ErrRoomClosed
+	case LeaveReasonProtocol:
+		return ErrProtocol
+	case LeaveReasonVersion:
+		return ErrIncompatibleVersion
+	}
+	return nil
+}
+
+// closeReason returns the LeaveReason of a close code
+func closeReason(code quic.ApplicationErrorCode) string {
+	switch code {
+	case closeCodeRefused:
+		return LeaveReasonRefused
+	case closeCodeKicked:
+		return LeaveReasonKicked
+	case closeCodeBanned:
+		return LeaveReasonBanned
+	case closeCodeRoomFull:
+		return LeaveReasonRoomFull
+	case closeCodeRoomClosed:
+		return LeaveReasonRoomClosed
+	case closeCodeShutdown:
+		return LeaveReasonLeft
+	case closeCodeProtocol:
+		return LeaveReasonProtocol
+	case closeCodeVersion:
+		return LeaveReasonVersion
+	}
+	return LeaveReasonDisconnected
+}
+
+// noteClosed returns why conn ended and, when the peer closed it with a
+// reason, reports it on the error channel
+func (qn *QuicNetwork) noteClosed(conn quic.Connection) string {
+	var appErr *quic.ApplicationError
+	if !errors.As(context.Cause(conn.Context()), &appErr) {
+		return LeaveReasonDisconnected
+	}
+	reason := closeReason(appErr.ErrorCode)
+	if !appErr.Remote || appErr.ErrorCode == closeCodeNone {
+		return reason
+	}
+
+	logger.L().Info("Connection closed by the peer", "room_id", qn.roomID, "reason", reason, "message", appErr.ErrorMessage)
+	if !qn.isListener {
+		switch appErr.ErrorCode {
+		case closeCodeKicked, closeCodeBanned, closeCodeRoomFull, closeCodeRoomClosed, closeCodeVersion:
+			qn.removed.Store(true)
+		}
+	}
+	qn.sendError(&CloseError{Reason: reason, Message: appErr.ErrorMessage})
+	return reason
+}
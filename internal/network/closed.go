@@ -0,0 +1,25 @@
+package network
+
+import (
+	"errors"
+
+	"execp2p/internal/logger"
+)
+
+// ErrRoomClosed means the host closed the room for good
+var ErrRoomClosed = errors.New("room closed by the host")
+
+// CloseRoom ends the room for the connected peer (host): its connection is
+// closed with closeCodeRoomClosed, so it doesn't try to reconnect
+func (qn *QuicNetwork) CloseRoom(reason string) {
+	if !qn.isListener {
+		return
+	}
+	if reason == "" {
+		reason = ErrRoomClosed.Error()
+	}
+	if conn := qn.currentConn(); conn != nil {
+		logger.L().Info("Closing the room", "room_id", qn.roomID, "reason", reason)
+		conn.CloseWithError(closeCodeRoomClosed, reason)
+	}
+}
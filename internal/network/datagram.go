@@ -0,0 +1,113 @@
+package network
+
+import (
+	"context"
+	"errors"
+
+	"execp2p/internal/crash"
+	"execp2p/internal/crypto"
+	"execp2p/internal/diagnostics"
+	"execp2p/internal/logger"
+
+	"github.com/quic-go/quic-go"
+)
+
+// Ephemeral data.
+//
+// Typing indicators, presence and the like are better late than never only
+// up to a point: a stale one is worse than none. SendEphemeral sends such a
+// control message as a QUIC datagram (RFC 9221) when both ends negotiated
+// datagram support on the connection, sealed for each recipient with
+// crypto.SealDatagram. A datagram may be lost, and is never retransmitted or
+// ordered. When the peer lacks datagram support, or a message doesn't fit in
+// one, it goes as an ordinary control message on a stream instead, so the
+// receiving side sees the same control message either way.
+
+// datagramsSupported reports whether conn negotiated datagram support
+func datagramsSupported(conn quic.Connection) bool {
+	return conn != nil && conn.ConnectionState().SupportsDatagrams
+}
+
+// SupportsDatagrams reports whether the current connection carries
+// datagrams; without them SendEphemeral falls back to streams
+func (qn *QuicNetwork) SupportsDatagrams() bool {
+	return datagramsSupported(qn.currentConn())
+}
+
+// SendEphemeral sends a control message that may be lost: as a datagram
+// when the connection supports them, or on a stream like SendControl
+func (qn *QuicNetwork) SendEphemeral(ctx context.Context, msg string) error {
+	conn := qn.currentConn()
+	recipients := qn.connectedPeerIDs()
+	if conn == nil || len(recipients) == 0 {
+		return ErrNotConnected
+	}
+	if !datagramsSupported(conn) {
+		return qn.SendControl(ctx, msg)
+	}
+
+	qn.rotationMutex.RLock()
+	defer qn.rotationMutex.RUnlock()
+	var errs []error
+	for _, peerID := range recipients {
+		if err := qn.sendDatagram(conn, msg, peerID); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// sendDatagram sends msg to peerID as a datagram, or on a stream when it
+// doesn't fit in one
+func (qn *QuicNetwork) sendDatagram(conn quic.Connection, msg, peerID string) error {
+	data, err := qn.pqCrypto.SealDatagram(msg, peerID, qn.localPeerID)
+	if err != nil {
+		return err
+	}
+	err = conn.SendDatagram(data)
+	if err == nil {
+		diagnostics.Add(diagnostics.BytesSent, uint64(len(data)))
+	}
+	var tooLarge *quic.DatagramTooLargeError
+	if errors.As(err, &tooLarge) {
+		logger.L().Debug("Ephemeral message too large for a datagram; using a stream", "size", len(data), "max", tooLarge.MaxDatagramPayloadSize)
+		return qn.sendTo(msg, crypto.NewMessageID(), peerID)
+	}
+	return err
+}
+
+// datagramLoop hands the datagrams received on conn to the control handler
+// until the connection ends
+func (qn *QuicNetwork) datagramLoop(conn quic.Connection) {
+	defer crash.Recover("network.datagramLoop")
+	for {
+		data, err := conn.ReceiveDatagram(qn.ctx)
+		if err != nil {
+			return
+		}
+		diagnostics.Add(diagnostics.BytesReceived, uint64(len(data)))
+		qn.heard()
+		qn.handleDatagram(data)
+	}
+}
+
+func (qn *QuicNetwork) handleDatagram(data []byte) {
+	payload, err := qn.pqCrypto.OpenDatagram(data, qn.localPeerID)
+	if err != nil {
+		logger.L().Debug("Datagram dropped", "err", err)
+		return
+	}
+	qn.keyExchangeMutex.RLock()
+	policy := qn.senderPolicy
+	qn.keyExchangeMutex.RUnlock()
+	if policy != nil {
+		if err := policy(payload.SenderID); err != nil {
+			logger.L().Debug("Datagram rejected by sender policy", "peer", shortID(payload.SenderID), "err", err)
+			return
+		}
+	}
+	// never chat: a datagram nobody handles is dropped
+	if !qn.handleControl(payload) {
+		logger.L().Debug("Datagram not handled; dropped", "peer", shortID(payload.SenderID))
+	}
+}
@@ -0,0 +1,61 @@
+package network
+
+import (
+	"execp2p/internal/crypto"
+	"execp2p/internal/diagnostics"
+	"execp2p/internal/logger"
+)
+
+// Duplicate suppression.
+//
+// A message that seemed to fail may have arrived anyway, and sending it
+// again (after a reconnect, from the queue of unsent messages) delivers it
+// twice. Senders keep the message ID across attempts, so the IDs recently
+// seen from each peer are remembered and a copy is dropped before it reaches
+// the incoming channel. It still takes its sequence number (reorder.go), so
+// dropping it leaves no gap.
+
+// how many message IDs are remembered per peer
+const dedupWindow = 512
+
+// recentIDs remembers the last dedupWindow message IDs of a peer
+type recentIDs struct {
+	ids  map[string]struct{}
+	ring []string
+	next int
+}
+
+// seen reports whether id was recorded before, and records it
+func (r *recentIDs) seen(id string) bool {
+	if _, ok := r.ids[id]; ok {
+		return true
+	}
+	if len(r.ring) < dedupWindow {
+		r.ring = append(r.ring, id)
+	} else {
+		delete(r.ids, r.ring[r.next])
+		r.ring[r.next] = id
+		r.next = (r.next + 1) % dedupWindow
+	}
+	r.ids[id] = struct{}{}
+	return false
+}
+
+// duplicateLocked reports whether payload was delivered before;
+// inflightMutex must be held
+func (qn *QuicNetwork) duplicateLocked(payload *crypto.MessagePayload) bool {
+	if payload.MessageID == "" {
+		return false
+	}
+	r := qn.recent[payload.SenderID]
+	if r == nil {
+		r = &recentIDs{ids: make(map[string]struct{})}
+		qn.recent[payload.SenderID] = r
+	}
+	if !r.seen(payload.MessageID) {
+		return false
+	}
+	logger.L().Debug("Duplicate message dropped", "peer", shortID(payload.SenderID), "message_id", payload.MessageID)
+	diagnostics.Inc(diagnostics.MessageDuplicate)
+	return true
+}
@@ -0,0 +1,119 @@
+package network
+
+import (
+	"errors"
+	"fmt"
+)
+
+// What went wrong.
+//
+// Errors on the error channel are typed, so a frontend can show its own
+// message for each kind instead of the raw text, and the application can
+// tell what is worth retrying: a lost connection is, a refused access key
+// or a peer that broke the protocol isn't. Code and Retryable classify any
+// error from the channel, *CloseError included.
+
+// ErrorCode classifies an error from the error channel
+type ErrorCode string
+
+const (
+	// the peer could not be authenticated, or didn't authenticate us:
+	// access key, membership certificate, identity or TLS certificate
+	CodeAuth ErrorCode = "auth"
+	// the connection failed or was lost
+	CodeTransport ErrorCode = "transport"
+	// the peer sent something it shouldn't have
+	CodeProtocol ErrorCode = "protocol"
+	// the peer is in another room
+	CodeRoomMismatch ErrorCode = "room_mismatch"
+	// we and the peer have no protocol version in common
+	CodeVersion ErrorCode = "version"
+	// the peer closed the connection with a reason, see CloseError
+	CodeClosed ErrorCode = "closed"
+	// anything else
+	CodeUnknown ErrorCode = "unknown"
+)
+
+// AuthError means the handshake authenticating the peer failed
+type AuthError struct {
+	Err error
+}
+
+func (e *AuthError) Error() string { return e.Err.Error() }
+func (e *AuthError) Unwrap() error { return e.Err }
+
+// TransportError means the connection failed or was lost while doing Op
+type TransportError struct {
+	// e.g. "dial" or "accept"
+	Op  string
+	Err error
+}
+
+func (e *TransportError) Error() string { return e.Op + ": " + e.Err.Error() }
+func (e *TransportError) Unwrap() error { return e.Err }
+
+// ProtocolError means the peer sent something malformed or unexpected.
+// errors.Is matches ErrProtocol.
+type ProtocolError struct {
+	Err error
+}
+
+func (e *ProtocolError) Error() string   { return e.Err.Error() }
+func (e *ProtocolError) Unwrap() []error { return []error{ErrProtocol, e.Err} }
+
+// RoomMismatch means the peer announced itself for another room
+type RoomMismatch struct {
+	// our room, and the one the peer announced
+	Expected string
+	Got      string
+}
+
+func (e *RoomMismatch) Error() string {
+	return fmt.Sprintf("niezgodne ID pokoju: %s", e.Got)
+}
+
+// Code classifies err
+func Code(err error) ErrorCode {
+	var (
+		authErr      *AuthError
+		transportErr *TransportError
+		protocolErr  *ProtocolError
+		mismatch     *RoomMismatch
+		closeErr     *CloseError
+	)
+	switch {
+	case errors.Is(err, ErrIncompatibleVersion):
+		return CodeVersion
+	case errors.As(err, &authErr), errors.Is(err, ErrAccessDenied):
+		return CodeAuth
+	case errors.As(err, &transportErr):
+		return CodeTransport
+	case errors.As(err, &protocolErr):
+		return CodeProtocol
+	case errors.As(err, &mismatch):
+		return CodeRoomMismatch
+	case errors.As(err, &closeErr):
+		switch closeErr.Reason {
+		case LeaveReasonRefused:
+			return CodeAuth
+		case LeaveReasonProtocol:
+			return CodeProtocol
+		}
+		return CodeClosed
+	}
+	return CodeUnknown
+}
+
+// Retryable reports whether connecting again may help after err: the
+// connection was lost, or the peer stopped or dropped it without a reason
+func Retryable(err error) bool {
+	switch Code(err) {
+	case CodeTransport:
+		return true
+	case CodeClosed:
+		var closeErr *CloseError
+		errors.As(err, &closeErr)
+		return closeErr.Reason == LeaveReasonLeft || closeErr.Reason == LeaveReasonDisconnected
+	}
+	return false
+}
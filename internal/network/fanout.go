@@ -0,0 +1,119 @@
+package network
+
+import (
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"execp2p/internal/logger"
+	"execp2p/internal/wire"
+)
+
+// Sending to everyone in the room.
+//
+// A message is encrypted once per recipient, under the session key shared
+// with that peer, and each envelope names its recipient; all of them carry
+// the same message ID. Every recipient is
+// tried even when an earlier one fails; a message that reached some of them
+// but not all fails with a *FanoutError saying who got it and who didn't,
+// so the caller neither reports it lost nor sends it again to everyone.
+
+// FanoutError means a message reached some of the recipients but not all
+type FanoutError struct {
+	// the peers that got the message
+	Delivered []string
+	// why each of the others didn't
+	Failed map[string]error
+}
+
+// Undelivered returns the peers that didn't get the message, sorted
+func (e *FanoutError) Undelivered() []string {
+	ids := make([]string, 0, len(e.Failed))
+	for id := range e.Failed {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	return ids
+}
+
+func (e *FanoutError) Error() string {
+	ids := e.Undelivered()
+	reasons := make([]string, 0, len(ids))
+	for _, id := range ids {
+		reasons = append(reasons, fmt.Sprintf("%s: %v", shortID(id), e.Failed[id]))
+	}
+	return fmt.Sprintf("message not delivered to %d of %d peers (%s)",
+		len(e.Failed), len(e.Failed)+len(e.Delivered), strings.Join(reasons, "; "))
+}
+
+func (e *FanoutError) Unwrap() []error {
+	errs := make([]error, 0, len(e.Failed))
+	for _, err := range e.Failed {
+		errs = append(errs, err)
+	}
+	return errs
+}
+
+// PartlyDelivered reports whether err is a *FanoutError: the message reached
+// someone, so it must not be sent again to everyone. It returns the peers
+// that didn't get it.
+func PartlyDelivered(err error) ([]string, bool) {
+	var fanoutErr *FanoutError
+	if !errors.As(err, &fanoutErr) || len(fanoutErr.Delivered) == 0 {
+		return nil, false
+	}
+	return fanoutErr.Undelivered(), true
+}
+
+// fanOut encrypts msg for each recipient and sends it. It fails with the
+// error of the only recipient, with a *FanoutError when some of several got
+// it, or with an error wrapping them all when nobody did.
+func (qn *QuicNetwork) fanOut(msg, messageID string, recipients []string) error {
+	var delivered []string
+	failed := make(map[string]error)
+	for _, peerID := range recipients {
+		if err := qn.sendTo(msg, messageID, peerID); err != nil {
+			logger.L().Debug("Message not delivered", "peer", shortID(peerID), "err", err)
+			failed[peerID] = err
+			continue
+		}
+		delivered = append(delivered, peerID)
+	}
+
+	switch {
+	case len(failed) == 0:
+		return nil
+	case len(recipients) == 1:
+		return failed[recipients[0]]
+	case len(delivered) == 0:
+		errs := make([]error, 0, len(failed))
+		for _, err := range failed {
+			errs = append(errs, err)
+		}
+		return fmt.Errorf("message not delivered to any of %d peers: %w", len(recipients), errors.Join(errs...))
+	}
+	logger.L().Warn("Message delivered to some peers only", "delivered", len(delivered), "failed", len(failed))
+	return &FanoutError{Delivered: delivered, Failed: failed}
+}
+
+// sendTo sends msg encrypted for peerID
+func (qn *QuicNetwork) sendTo(msg, messageID, peerID string) error {
+	encMsg, err := qn.pqCrypto.EncryptMessageWithID(msg, messageID, peerID, qn.localPeerID)
+	if err != nil {
+		return err
+	}
+	msgBytes, err := wire.Marshal(encMsg, qn.format())
+	if err != nil {
+		return err
+	}
+	logger.L().Debug("Sending message", "peer", shortID(peerID), "size", len(msgBytes))
+	return qn.writeWrapper(message{
+		Type:      "message",
+		Payload:   hex.EncodeToString(msgBytes),
+		Timestamp: time.Now().Unix(),
+		SenderID:  qn.localPeerID,
+	})
+}
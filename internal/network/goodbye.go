@@ -0,0 +1,49 @@
+package network
+
+import (
+	"context"
+	"slices"
+	"time"
+
+	"execp2p/internal/logger"
+)
+
+// Leaving on purpose.
+//
+// A peer that stops (it leaves the room or the application quits) first
+// sends a "leaving" control frame. The other side drops the connection with
+// LeaveReasonLeft instead of waiting for it to time out, so it can tell a
+// peer that left from one that crashed or lost its network.
+
+// goodbyeTimeout bounds sending the goodbye, so stopping never hangs on a
+// peer that is already gone
+const goodbyeTimeout = time.Second
+
+// sayGoodbye tells the connected peer we are leaving
+func (qn *QuicNetwork) sayGoodbye() {
+	if qn.currentConn() == nil || len(qn.connectedPeerIDs()) == 0 {
+		return
+	}
+	ctx, cancel := context.WithTimeout(qn.ctx, goodbyeTimeout)
+	defer cancel()
+	err := qn.writeWrapperContext(ctx, message{
+		Type:      "leaving",
+		Timestamp: time.Now().Unix(),
+		SenderID:  qn.localPeerID,
+		RoomID:    qn.roomID,
+	})
+	if err != nil {
+		logger.L().Debug("Goodbye not sent", "err", err)
+	}
+}
+
+// handleLeaving drops the connection of a peer that said goodbye
+func (qn *QuicNetwork) handleLeaving(w message) {
+	conn := qn.currentConn()
+	if conn == nil || !slices.Contains(qn.connectedPeerIDs(), w.SenderID) {
+		return
+	}
+	logger.L().Info("Peer left the room", "room_id", qn.roomID, "peer", shortID(w.SenderID))
+	qn.dropConnection(conn, LeaveReasonLeft)
+	conn.CloseWithError(closeCodeNone, "peer left")
+}
@@ -0,0 +1,72 @@
+package network
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+
+	"execp2p/internal/logger"
+)
+
+// Removing a peer.
+//
+// The host closes the peer's connection with closeCodeKicked and rekeys at
+// once, so the peer holds no key for anything sent afterwards. A guest whose
+// connection the host closed that way doesn't reconnect on its own; getting
+// back in takes joining again, in plain sight of the room. Banned identities
+// are refused with closeCodeBanned as soon as their announcement is checked,
+// whatever peer ID, access key or membership certificate they bring.
+
+var (
+	// ErrRemoved means the host removed us from the room
+	ErrRemoved = errors.New("removed from the room by the host")
+	// ErrBanned means the host banned our identity from the room
+	ErrBanned = errors.New("banned from the room")
+)
+
+// KickPeer closes the connection of a connected peer (host only) and ends
+// its session right away
+func (qn *QuicNetwork) KickPeer(peerID, reason string) error {
+	if !qn.isListener {
+		return fmt.Errorf("only the room host can remove peers")
+	}
+	conn := qn.currentConn()
+	if conn == nil || !slices.Contains(qn.connectedPeerIDs(), peerID) {
+		return fmt.Errorf("%w: %s", ErrNotConnected, shortID(peerID))
+	}
+	if reason == "" {
+		reason = ErrRemoved.Error()
+	}
+
+	logger.L().Info("Removing peer from the room", "room_id", qn.roomID, "peer", shortID(peerID), "reason", reason)
+	conn.CloseWithError(closeCodeKicked, reason)
+	qn.dropConnection(conn, LeaveReasonKicked)
+	return nil
+}
+
+// Removed reports whether the host removed us from the room
+func (qn *QuicNetwork) Removed() bool {
+	return qn.removed.Load()
+}
+
+// SetBanned replaces the identity fingerprints refused at the announcement
+// (host)
+func (qn *QuicNetwork) SetBanned(fingerprints []string) {
+	banned := make(map[string]struct{}, len(fingerprints))
+	for _, fp := range fingerprints {
+		banned[fp] = struct{}{}
+	}
+	qn.bannedMutex.Lock()
+	qn.banned = banned
+	qn.bannedMutex.Unlock()
+}
+
+func (qn *QuicNetwork) isBanned(fingerprint string) bool {
+	if !qn.isListener {
+		return false
+	}
+	qn.bannedMutex.RLock()
+	defer qn.bannedMutex.RUnlock()
+	_, ok := qn.banned[fingerprint]
+	return ok
+}
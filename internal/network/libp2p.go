@@ -0,0 +1,502 @@
+package network
+
+import (
+	"bufio"
+	"context"
+	"crypto/sha256"
+	"crypto/tls"
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"sync"
+	"time"
+
+	"execp2p/internal/crash"
+	"execp2p/internal/crypto"
+	"execp2p/internal/logger"
+
+	"github.com/ipfs/go-cid"
+	"github.com/libp2p/go-libp2p"
+	dht "github.com/libp2p/go-libp2p-kad-dht"
+	"github.com/libp2p/go-libp2p/core/host"
+	lpnetwork "github.com/libp2p/go-libp2p/core/network"
+	"github.com/libp2p/go-libp2p/core/peer"
+	"github.com/libp2p/go-libp2p/core/routing"
+	"github.com/libp2p/go-libp2p/p2p/discovery/mdns"
+	"github.com/libp2p/go-libp2p/p2p/security/noise"
+	"github.com/libp2p/go-libp2p/p2p/transport/tcp"
+	"github.com/multiformats/go-multiaddr"
+	"github.com/multiformats/go-multihash"
+	"github.com/quic-go/quic-go"
+)
+
+// libp2p transport.
+//
+// The room's QUIC connection runs over a libp2p stream instead of UDP: the
+// libp2p host (noise over TCP) takes care of reaching the peer -
+// its DHT, circuit relays, hole punching and UPnP - and our own TLS, access
+// key and post-quantum handshakes run inside as on any other carrier. Each
+// packet is framed on the stream with its length.
+//
+// The room's host listens on the room's port and announces itself under a
+// key derived from the room ID, in the DHT and with mDNS. A guest dials a
+// "/p2p/" multiaddr of the host when it is given one, and otherwise looks
+// the room up by its ID; any other address (Libp2pRoomAddr, or host:port
+// found by the app's discovery) means the lookup.
+
+// libp2pProtocol carries the QUIC packets of a room
+const libp2pProtocol = "/execp2p/quic/1.0.0"
+
+// Libp2pRoomAddr is the remote address of a guest that finds the room's
+// host by the room ID
+const Libp2pRoomAddr = "libp2p"
+
+const (
+	// packets a stream holds before dropping, like a socket buffer
+	libp2pStreamQueue = 256
+	// how often the host renews its DHT record
+	libp2pProvideInterval = 30 * time.Minute
+	// pause before a guest opens a new stream after one failed
+	libp2pStreamRetry = time.Second
+)
+
+// Libp2pOptions configures the libp2p transport
+type Libp2pOptions struct {
+	// multiaddrs of the DHT's first peers, see DefaultLibp2pBootstrap;
+	// without any the room's host is only found with mDNS or at a /p2p/
+	// address
+	Bootstrap []string
+}
+
+// DefaultLibp2pBootstrap returns the public bootstrap peers of the IPFS DHT
+func DefaultLibp2pBootstrap() []string {
+	var addrs []string
+	for _, a := range dht.DefaultBootstrapPeers {
+		addrs = append(addrs, a.String())
+	}
+	return addrs
+}
+
+// NewLibp2pFactory returns a Factory of networks whose QUIC runs over
+// libp2p
+func NewLibp2pFactory(opts Libp2pOptions) (Factory, error) {
+	bootstrap, err := parseBootstrap(opts.Bootstrap)
+	if err != nil {
+		return nil, err
+	}
+	return func(ctx context.Context, peerID, roomID string, listenPort int, pqCrypto *crypto.PQCrypto, isListener bool, remoteAddr string) (Network, error) {
+		qn, err := NewQuicNetwork(ctx, peerID, roomID, listenPort, pqCrypto, isListener, remoteAddr)
+		if err != nil {
+			return nil, err
+		}
+		qn.packets = &libp2pHost{roomID: roomID, bootstrap: bootstrap}
+		return qn, nil
+	}, nil
+}
+
+func parseBootstrap(addrs []string) ([]peer.AddrInfo, error) {
+	var mas []multiaddr.Multiaddr
+	for _, a := range addrs {
+		ma, err := multiaddr.NewMultiaddr(a)
+		if err != nil {
+			return nil, fmt.Errorf("invalid libp2p bootstrap address %q: %w", a, err)
+		}
+		mas = append(mas, ma)
+	}
+	infos, err := peer.AddrInfosFromP2pAddrs(mas...)
+	if err != nil {
+		return nil, fmt.Errorf("invalid libp2p bootstrap address: %w", err)
+	}
+	return infos, nil
+}
+
+// libp2pHost carries the packets of one network
+type libp2pHost struct {
+	roomID    string
+	bootstrap []peer.AddrInfo
+
+	mu sync.Mutex
+	// the listening host, once listen opened it
+	host host.Host
+}
+
+// roomKey is the DHT key the room's host is provided under; the room ID
+// itself is not published
+func (h *libp2pHost) roomKey() cid.Cid {
+	sum, _ := multihash.Sum([]byte("execp2p room "+h.roomID), multihash.SHA2_256, -1)
+	return cid.NewCidV1(cid.Raw, sum)
+}
+
+// mdnsService is the room's mDNS service name
+func (h *libp2pHost) mdnsService() string {
+	sum := sha256.Sum256([]byte("execp2p room " + h.roomID))
+	return "execp2p-" + hex.EncodeToString(sum[:8])
+}
+
+// start creates a libp2p host on port, 0 for any
+func (h *libp2pHost) start(ctx context.Context, port int) (host.Host, *dht.IpfsDHT, error) {
+	var kad *dht.IpfsDHT
+	opts := []libp2p.Option{
+		// TCP only: libp2p's QUIC transport turns session tickets off,
+		// which the quic-go we build with panics on under current Go
+		libp2p.ListenAddrStrings(
+			fmt.Sprintf("/ip4/0.0.0.0/tcp/%d", port),
+			fmt.Sprintf("/ip6/::/tcp/%d", port),
+		),
+		libp2p.Security(noise.ID, noise.New),
+		libp2p.Transport(tcp.NewTCPTransport),
+		libp2p.UserAgent("execp2p"),
+		libp2p.NATPortMap(),
+		libp2p.EnableRelay(),
+		libp2p.EnableHolePunching(),
+	}
+	if len(h.bootstrap) > 0 {
+		opts = append(opts,
+			libp2p.Routing(func(lh host.Host) (routing.PeerRouting, error) {
+				var err error
+				kad, err = dht.New(ctx, lh, dht.Mode(dht.ModeAuto), dht.BootstrapPeers(h.bootstrap...))
+				return kad, err
+			}),
+			// relays for when we are behind a NAT come from the DHT's peers
+			libp2p.EnableAutoRelayWithPeerSource(func(ctx context.Context, num int) <-chan peer.AddrInfo {
+				out := make(chan peer.AddrInfo, num)
+				defer close(out)
+				if kad == nil {
+					return out
+				}
+				for _, id := range kad.RoutingTable().ListPeers() {
+					if len(out) == num {
+						break
+					}
+					out <- kad.Host().Peerstore().PeerInfo(id)
+				}
+				return out
+			}),
+		)
+	}
+	lh, err := libp2p.New(opts...)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to start libp2p host: %w", err)
+	}
+	if kad != nil {
+		if err := kad.Bootstrap(ctx); err != nil {
+			logger.L().Warn("libp2p DHT bootstrap failed", "err", err)
+		}
+	}
+	return lh, kad, nil
+}
+
+// close shuts a host and its DHT
+func closeLibp2p(lh host.Host, kad *dht.IpfsDHT) {
+	if kad != nil {
+		kad.Close()
+	}
+	lh.Close()
+}
+
+// addrs returns the /p2p/ multiaddrs a guest can dial the listening host at
+func (h *libp2pHost) addrs() []string {
+	h.mu.Lock()
+	lh := h.host
+	h.mu.Unlock()
+	if lh == nil {
+		return nil
+	}
+	infos, err := peer.AddrInfoToP2pAddrs(&peer.AddrInfo{ID: lh.ID(), Addrs: lh.Addrs()})
+	if err != nil {
+		return nil
+	}
+	addrs := make([]string, 0, len(infos))
+	for _, a := range infos {
+		addrs = append(addrs, a.String())
+	}
+	return addrs
+}
+
+// listen starts the room's libp2p host at the port of addr and announces it
+func (h *libp2pHost) listen(addr string, tlsConfig *tls.Config, conf *quic.Config) (listener, error) {
+	port, err := addrPort(addr)
+	if err != nil {
+		return nil, err
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	lh, kad, err := h.start(ctx, port)
+	if err != nil {
+		cancel()
+		return nil, err
+	}
+	pc := newPathConn(pathAddr{network: "libp2p", id: lh.ID().String()})
+	lh.SetStreamHandler(libp2pProtocol, func(s lpnetwork.Stream) {
+		remote := pathAddr{network: "libp2p", id: s.Conn().RemotePeer().String()}
+		lh.ConnManager().Protect(s.Conn().RemotePeer(), "execp2p")
+		p := newStreamPath(s)
+		if pc.attach(remote, p) {
+			go readStream(pc, remote, p)
+		}
+	})
+
+	md := mdns.NewMdnsService(lh, h.mdnsService(), noPeers{})
+	if err := md.Start(); err != nil {
+		logger.L().Warn("libp2p mDNS unavailable", "err", err)
+	}
+	if kad != nil {
+		go h.provide(ctx, kad)
+	}
+
+	h.mu.Lock()
+	h.host = lh
+	h.mu.Unlock()
+	logger.L().Info("Listening on libp2p", "peer", lh.ID().String(), "addrs", h.addrs())
+
+	l, err := listenOn(pc, tlsConfig, conf)
+	if err != nil {
+		cancel()
+		md.Close()
+		closeLibp2p(lh, kad)
+		return nil, err
+	}
+	return libp2pListener{listener: l, stop: func() {
+		cancel()
+		md.Close()
+		closeLibp2p(lh, kad)
+	}}, nil
+}
+
+// provide keeps the room's record in the DHT while the host listens
+func (h *libp2pHost) provide(ctx context.Context, kad *dht.IpfsDHT) {
+	defer crash.Recover("network.libp2pHost.provide")
+	key := h.roomKey()
+	for {
+		// a record needs peers to go to
+		for kad.RoutingTable().Size() == 0 {
+			select {
+			case <-ctx.Done():
+				return
+			case <-time.After(time.Second):
+			}
+		}
+		wait := libp2pProvideInterval
+		if err := kad.Provide(ctx, key, true); err != nil {
+			if ctx.Err() != nil {
+				return
+			}
+			logger.L().Warn("libp2p DHT announcement failed", "err", err)
+			wait = time.Minute
+		} else {
+			logger.L().Debug("Room announced in the libp2p DHT")
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(wait):
+		}
+	}
+}
+
+// dial finds the room's host and connects to it over a libp2p stream
+func (h *libp2pHost) dial(ctx context.Context, addr string, tlsConfig *tls.Config, conf *quic.Config, early bool) (quic.Connection, error) {
+	pathCtx, cancel := context.WithCancel(context.Background())
+	lh, kad, err := h.start(pathCtx, 0)
+	if err != nil {
+		cancel()
+		return nil, err
+	}
+	stop := func() {
+		cancel()
+		closeLibp2p(lh, kad)
+	}
+	target, err := h.find(ctx, lh, kad, addr)
+	if err != nil {
+		stop()
+		return nil, err
+	}
+	lh.ConnManager().Protect(target, "execp2p")
+
+	pc := newPathConn(pathAddr{network: "libp2p", id: lh.ID().String()})
+	remote := pathAddr{network: "libp2p", id: target.String()}
+	go keepStream(pathCtx, lh, pc, target, remote)
+	conn, err := dialOn(ctx, pc, remote, tlsConfig, conf, early)
+	if err != nil {
+		stop()
+		return nil, err
+	}
+	context.AfterFunc(conn.Context(), stop)
+	return conn, nil
+}
+
+// find connects to the room's host: at addr when it is a /p2p/ multiaddr,
+// otherwise the first peer announcing the room
+func (h *libp2pHost) find(ctx context.Context, lh host.Host, kad *dht.IpfsDHT, addr string) (peer.ID, error) {
+	if ma, err := multiaddr.NewMultiaddr(addr); err == nil {
+		if info, err := peer.AddrInfoFromP2pAddr(ma); err == nil {
+			if err := lh.Connect(ctx, *info); err != nil {
+				return "", fmt.Errorf("failed to reach %s: %w", addr, err)
+			}
+			return info.ID, nil
+		}
+	}
+
+	lookupCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	found := make(chan peer.AddrInfo, 16)
+	md := mdns.NewMdnsService(lh, h.mdnsService(), foundPeers{ctx: lookupCtx, found: found})
+	if err := md.Start(); err != nil {
+		logger.L().Warn("libp2p mDNS unavailable", "err", err)
+	}
+	defer md.Close()
+	if kad != nil {
+		go func() {
+			defer crash.Recover("network.libp2pHost.find")
+			for info := range kad.FindProvidersAsync(lookupCtx, h.roomKey(), 0) {
+				select {
+				case found <- info:
+				case <-lookupCtx.Done():
+					return
+				}
+			}
+		}()
+	}
+
+	for {
+		select {
+		case info := <-found:
+			if info.ID == lh.ID() {
+				continue
+			}
+			if err := lh.Connect(ctx, info); err != nil {
+				logger.L().Debug("libp2p room candidate unreachable", "peer", info.ID.String(), "err", err)
+				continue
+			}
+			logger.L().Info("Found room host over libp2p", "peer", info.ID.String())
+			return info.ID, nil
+		case <-ctx.Done():
+			return "", fmt.Errorf("room host not found over libp2p: %w", ctx.Err())
+		}
+	}
+}
+
+// keepStream keeps a stream to the room's host open until ctx ends, opening
+// a new one when it fails, e.g. once hole punching replaced a relayed
+// connection the relay has cut
+func keepStream(ctx context.Context, lh host.Host, pc *pathConn, target peer.ID, remote pathAddr) {
+	defer crash.Recover("network.keepStream")
+	for ctx.Err() == nil {
+		s, err := lh.NewStream(lpnetwork.WithAllowLimitedConn(ctx, "execp2p"), target, libp2pProtocol)
+		if err == nil {
+			p := newStreamPath(s)
+			if !pc.attach(remote, p) {
+				return
+			}
+			readStream(pc, remote, p)
+		} else {
+			logger.L().Debug("libp2p stream failed", "peer", target.String(), "err", err)
+		}
+		select {
+		case <-ctx.Done():
+		case <-time.After(libp2pStreamRetry):
+		}
+	}
+}
+
+// libp2pListener stops the host with the listener
+type libp2pListener struct {
+	listener
+	stop func()
+}
+
+func (l libp2pListener) Close() error {
+	err := l.listener.Close()
+	l.stop()
+	return err
+}
+
+// streamPath is a packet path over a libp2p stream
+type streamPath struct {
+	s    lpnetwork.Stream
+	out  chan []byte
+	done chan struct{}
+	once sync.Once
+}
+
+func newStreamPath(s lpnetwork.Stream) *streamPath {
+	p := &streamPath{
+		s:    s,
+		out:  make(chan []byte, libp2pStreamQueue),
+		done: make(chan struct{}),
+	}
+	go p.writeLoop()
+	return p
+}
+
+func (p *streamPath) send(pkt []byte) error {
+	frame := make([]byte, 2+len(pkt))
+	binary.BigEndian.PutUint16(frame, uint16(len(pkt)))
+	copy(frame[2:], pkt)
+	select {
+	case p.out <- frame:
+	case <-p.done:
+	default:
+	}
+	return nil
+}
+
+func (p *streamPath) writeLoop() {
+	defer crash.Recover("network.streamPath.writeLoop")
+	for {
+		select {
+		case frame := <-p.out:
+			if _, err := p.s.Write(frame); err != nil {
+				p.close()
+				return
+			}
+		case <-p.done:
+			return
+		}
+	}
+}
+
+func (p *streamPath) close() error {
+	p.once.Do(func() {
+		close(p.done)
+		p.s.Reset()
+	})
+	return nil
+}
+
+// readStream delivers the packets of p until it fails
+func readStream(pc *pathConn, remote pathAddr, p *streamPath) {
+	defer crash.Recover("network.readStream")
+	defer pc.detach(remote, p)
+	r := bufio.NewReader(p.s)
+	var size [2]byte
+	buf := make([]byte, 1<<16)
+	for {
+		if _, err := io.ReadFull(r, size[:]); err != nil {
+			return
+		}
+		n := int(binary.BigEndian.Uint16(size[:]))
+		if _, err := io.ReadFull(r, buf[:n]); err != nil {
+			return
+		}
+		pc.deliver(remote, buf[:n])
+	}
+}
+
+// noPeers ignores the peers the host's mDNS finds
+type noPeers struct{}
+
+func (noPeers) HandlePeerFound(peer.AddrInfo) {}
+
+// foundPeers passes on the peers a guest's mDNS finds
+type foundPeers struct {
+	ctx   context.Context
+	found chan<- peer.AddrInfo
+}
+
+func (f foundPeers) HandlePeerFound(info peer.AddrInfo) {
+	select {
+	case f.found <- info:
+	case <-f.ctx.Done():
+	}
+}
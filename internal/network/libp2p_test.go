@@ -0,0 +1,62 @@
+package network
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestLibp2pRoom(t *testing.T) {
+	if testing.Short() {
+		t.Skip("opens libp2p hosts")
+	}
+	f, err := NewLibp2pFactory(Libp2pOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx := testContext(t)
+	roomID := testRoomID(t)
+
+	host := newTestPeer(t, f, roomID, freePort(t), true, "")
+	host.start(t, ctx)
+	var addr string
+	for _, a := range host.qn.packets.(*libp2pHost).addrs() {
+		if strings.HasPrefix(a, "/ip4/127.0.0.1/") {
+			addr = a
+		}
+	}
+	if addr == "" {
+		t.Fatal("host has no loopback address")
+	}
+
+	guest := newTestPeer(t, f, roomID, 0, false, addr)
+	guest.start(t, ctx)
+	exchange(t, ctx, host, guest)
+}
+
+func TestLibp2pBootstrap(t *testing.T) {
+	if _, err := NewLibp2pFactory(Libp2pOptions{Bootstrap: DefaultLibp2pBootstrap()}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := NewLibp2pFactory(Libp2pOptions{Bootstrap: []string{"/ip4/1.2.3.4/tcp/1"}}); err == nil {
+		t.Fatal("bootstrap peer without /p2p/ accepted")
+	}
+}
+
+func TestLibp2pRoomLookup(t *testing.T) {
+	if testing.Short() {
+		t.Skip("opens libp2p hosts")
+	}
+	f, err := NewLibp2pFactory(Libp2pOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx := testContext(t)
+	roomID := testRoomID(t)
+
+	// no DHT: the guest finds the host with mDNS
+	host := newTestPeer(t, f, roomID, freePort(t), true, "")
+	host.start(t, ctx)
+	guest := newTestPeer(t, f, roomID, 0, false, Libp2pRoomAddr)
+	guest.start(t, ctx)
+	exchange(t, ctx, host, guest)
+}
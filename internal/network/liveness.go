@@ -0,0 +1,94 @@
+package network
+
+import (
+	"time"
+
+	"execp2p/internal/crash"
+	"execp2p/internal/logger"
+)
+
+// Peer liveness.
+//
+// A peer that vanishes without closing its connection (its machine sleeps,
+// its network goes away) is only noticed by QUIC when the connection times
+// out. Until then the transport pings a peer it hasn't heard from for
+// livenessInterval, and one that stays silent for livenessTimeout is
+// reported offline (PeerOffline); the first frame heard from it again
+// reports it online (PeerOnline).
+
+const (
+	// how often the connection is checked, and how long a peer may be
+	// silent before it is pinged
+	livenessInterval = 5 * time.Second
+	// how long a peer may be silent before it is reported offline; below
+	// QUIC's idle timeout, so it shows before the connection is dropped
+	livenessTimeout = 15 * time.Second
+)
+
+// watchLiveness pings a silent peer and reports it offline or online, until
+// the network stops
+func (qn *QuicNetwork) watchLiveness() {
+	defer crash.Recover("network.watchLiveness")
+	ticker := time.NewTicker(livenessInterval)
+	defer ticker.Stop()
+	last := time.Now()
+	for {
+		select {
+		case <-qn.ctx.Done():
+			return
+		case <-ticker.C:
+			now := time.Now()
+			// a late tick means we were the ones asleep (suspended machine,
+			// stopped process); the peer's frames are still queued
+			qn.checkLiveness(now.Sub(last) > 2*livenessInterval)
+			last = now
+		}
+	}
+}
+
+func (qn *QuicNetwork) checkLiveness(woke bool) {
+	peers := qn.connectedPeerIDs()
+	if qn.currentConn() == nil || len(peers) == 0 {
+		qn.offline.Store(false)
+		return
+	}
+	silent := time.Since(qn.LastHeard())
+	if silent < livenessInterval {
+		return
+	}
+	if err := qn.writeWrapper(message{
+		Type:      "ping",
+		Timestamp: time.Now().Unix(),
+		SenderID:  qn.localPeerID,
+	}); err != nil {
+		logger.L().Debug("Liveness ping not sent", "err", err)
+	}
+	if woke {
+		return
+	}
+	if silent >= livenessTimeout && qn.offline.CompareAndSwap(false, true) {
+		logger.L().Info("Peer went silent", "room_id", qn.roomID, "silent", silent.Round(time.Second))
+		for _, id := range peers {
+			qn.notifyPeer(PeerEvent{PeerID: id, Kind: PeerOffline})
+		}
+	}
+}
+
+// heard notes that something arrived from the peer; a peer reported
+// offline is online again
+func (qn *QuicNetwork) heard() {
+	qn.lastHeard.Store(time.Now().UnixNano())
+	if !qn.offline.CompareAndSwap(true, false) {
+		return
+	}
+	logger.L().Info("Peer heard from again", "room_id", qn.roomID)
+	for _, id := range qn.connectedPeerIDs() {
+		qn.notifyPeer(PeerEvent{PeerID: id, Kind: PeerOnline})
+	}
+}
+
+// Offline reports whether the connected peer has been silent for longer
+// than the liveness timeout
+func (qn *QuicNetwork) Offline() bool {
+	return qn.offline.Load()
+}
@@ -0,0 +1,370 @@
+package network
+
+import (
+	"context"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"regexp"
+	"time"
+
+	"execp2p/internal/crash"
+	"execp2p/internal/crypto"
+	"execp2p/internal/diagnostics"
+	"execp2p/internal/frame"
+	"execp2p/internal/logger"
+	"execp2p/internal/wire"
+
+	"github.com/quic-go/quic-go"
+)
+
+// Media streams.
+//
+// Pictures and voice messages don't ride inside chat messages. Each one gets
+// its own bidirectional stream on the chat plane: a "media" frame whose
+// payload is the header (ID, content type, size and a fresh stream key)
+// encrypted like a chat message, followed on the same stream by the raw
+// bytes encrypted with crypto.EncryptStream. The receiver answers with one
+// status byte once the body has been authenticated and stored. The chat
+// message sent afterwards only refers to the media ID.
+//
+// A media stream is handed off as soon as its frame is read, so a large
+// body never holds up the chat frames behind it.
+
+const (
+	mediaFrameType = frame.TypeMedia
+
+	// MaxMediaSize is the largest media body a peer may send
+	MaxMediaSize = 64 << 20
+
+	// a body that stalls for this long is abandoned
+	mediaIdleTimeout = 30 * time.Second
+	// how long the sender waits for the receiver's status byte
+	mediaAckTimeout = 30 * time.Second
+
+	mediaAccepted byte = 1
+	mediaRejected byte = 0
+
+	mediaStreamCanceled quic.StreamErrorCode = 1
+)
+
+var (
+	// ErrMediaRejected means the peer refused or failed to store the media
+	ErrMediaRejected = errors.New("peer rejected the media")
+	// ErrMediaCanceled means the transfer was canceled with CancelMedia, on
+	// either end
+	ErrMediaCanceled = errors.New("media transfer canceled")
+
+	mediaIDPattern = regexp.MustCompile(`^[0-9a-f]{32}$`)
+)
+
+// MediaHeader describes a media body
+type MediaHeader struct {
+	ID          string `json:"id"`
+	ContentType string `json:"content_type"`
+	Name        string `json:"name,omitempty"`
+	Size        int64  `json:"size"`
+}
+
+// mediaHeaderFrame is the encrypted part of a media frame
+type mediaHeaderFrame struct {
+	MediaHeader
+	Key []byte `json:"key"`
+}
+
+// MediaHandler stores a media body received from a peer. body yields exactly
+// header.Size authenticated bytes or fails; a non-nil error rejects the media.
+type MediaHandler func(senderID string, header MediaHeader, body io.Reader) error
+
+// SetMediaHandler installs the consumer of received media
+func (qn *QuicNetwork) SetMediaHandler(handler MediaHandler) {
+	qn.keyExchangeMutex.Lock()
+	qn.mediaHandler = handler
+	qn.keyExchangeMutex.Unlock()
+}
+
+// SendMedia streams header.Size bytes of body to the peer on a stream of its
+// own and returns once the peer has stored them
+func (qn *QuicNetwork) SendMedia(ctx context.Context, header MediaHeader, body io.Reader) error {
+	if !mediaIDPattern.MatchString(header.ID) {
+		return fmt.Errorf("invalid media ID %q", header.ID)
+	}
+	if header.Size < 0 || header.Size > MaxMediaSize {
+		return fmt.Errorf("media too large (%d bytes, limit %d)", header.Size, MaxMediaSize)
+	}
+	conn := qn.currentConn()
+	peers := qn.connectedPeerIDs()
+	if conn == nil || len(peers) == 0 {
+		return ErrNotConnected
+	}
+	peerID := peers[0]
+
+	key, err := crypto.NewStreamKey()
+	if err != nil {
+		return err
+	}
+	opening, err := qn.encryptMediaHeader(mediaHeaderFrame{MediaHeader: header, Key: key}, peerID)
+	if err != nil {
+		return err
+	}
+
+	stream, err := conn.OpenStreamSync(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to open media stream: %w", err)
+	}
+	qn.trackMediaStream(header.ID, stream)
+	defer qn.untrackMediaStream(header.ID, stream)
+	// cancelling ctx aborts the transfer in both directions
+	stop := context.AfterFunc(ctx, func() {
+		stream.CancelWrite(mediaStreamCanceled)
+		stream.CancelRead(mediaStreamCanceled)
+	})
+	defer stop()
+
+	if _, err := stream.Write(opening); err != nil {
+		return fmt.Errorf("failed to send media header: %w", err)
+	}
+	enc, err := crypto.EncryptStream(stream, key, []byte(header.ID))
+	if err != nil {
+		stream.CancelWrite(mediaStreamCanceled)
+		return err
+	}
+	written, err := io.Copy(enc, io.LimitReader(body, header.Size))
+	diagnostics.Add(diagnostics.BytesSent, uint64(len(opening))+uint64(written))
+	if err == nil && written != header.Size {
+		err = fmt.Errorf("media body ended after %d of %d bytes", written, header.Size)
+	}
+	if err == nil {
+		err = enc.Close()
+	}
+	if err != nil {
+		stream.CancelWrite(mediaStreamCanceled)
+		return fmt.Errorf("failed to send media: %w", ctxErr(ctx, mediaCanceled(err)))
+	}
+	stream.Close()
+
+	stream.SetReadDeadline(time.Now().Add(mediaAckTimeout))
+	status := make([]byte, 1)
+	if _, err := io.ReadFull(stream, status); err != nil {
+		return fmt.Errorf("no confirmation for media: %w", ctxErr(ctx, mediaCanceled(err)))
+	}
+	if status[0] != mediaAccepted {
+		return ErrMediaRejected
+	}
+	logger.L().Debug("Media sent", "peer", shortID(peerID), "id", header.ID, "size", header.Size)
+	return nil
+}
+
+// encryptMediaHeader builds the media frame that opens the stream
+func (qn *QuicNetwork) encryptMediaHeader(h mediaHeaderFrame, peerID string) ([]byte, error) {
+	plain, err := json.Marshal(h)
+	if err != nil {
+		return nil, err
+	}
+	// wait for a key rotation in progress, like a chat message
+	qn.rotationMutex.RLock()
+	encMsg, err := qn.pqCrypto.EncryptOutOfBandForPeer(string(plain), peerID, qn.localPeerID)
+	qn.rotationMutex.RUnlock()
+	if err != nil {
+		return nil, err
+	}
+	f := qn.format()
+	msgBytes, err := wire.Marshal(encMsg, f)
+	if err != nil {
+		return nil, err
+	}
+	// no trailing newline: the body starts right after the frame
+	return frame.Encode(message{
+		Type:      mediaFrameType,
+		Payload:   hex.EncodeToString(msgBytes),
+		Timestamp: time.Now().Unix(),
+		SenderID:  qn.localPeerID,
+	}, f)
+}
+
+// receiveMedia reads the body that follows a media frame and answers with
+// the status byte
+func (qn *QuicNetwork) receiveMedia(w message, stream quic.Stream, body io.Reader) {
+	defer func() {
+		if r := recover(); r != nil {
+			crash.Capture("network.receiveMedia", r)
+			stream.CancelRead(mediaStreamCanceled)
+			stream.CancelWrite(mediaStreamCanceled)
+		}
+	}()
+	qn.heard()
+
+	status := mediaAccepted
+	if err := qn.readMedia(w, stream, body); errors.Is(err, ErrMediaCanceled) {
+		logger.L().Info("Media transfer canceled", "from", shortID(w.SenderID))
+		status = mediaRejected
+		stream.CancelRead(mediaStreamCanceled)
+	} else if err != nil {
+		logger.L().Warn("Media rejected", "from", shortID(w.SenderID), "err", err)
+		diagnostics.Inc(diagnostics.MessageDecryptFail)
+		status = mediaRejected
+		stream.CancelRead(mediaStreamCanceled)
+	}
+	stream.SetWriteDeadline(time.Now().Add(mediaAckTimeout))
+	stream.Write([]byte{status})
+	stream.Close()
+}
+
+func (qn *QuicNetwork) readMedia(w message, stream quic.Stream, body io.Reader) error {
+	qn.keyExchangeMutex.RLock()
+	handler := qn.mediaHandler
+	policy := qn.senderPolicy
+	qn.keyExchangeMutex.RUnlock()
+	if handler == nil {
+		return fmt.Errorf("media not accepted here")
+	}
+
+	bytesPayload, err := hex.DecodeString(w.Payload)
+	if err != nil {
+		return err
+	}
+	encMsg, err := crypto.DeserializeEncryptedMessage(bytesPayload)
+	if err != nil {
+		return err
+	}
+	if policy != nil {
+		if err := policy(encMsg.SenderID); err != nil {
+			return err
+		}
+	}
+	payload, err := qn.decryptMediaHeader(encMsg)
+	if err != nil {
+		return err
+	}
+	var h mediaHeaderFrame
+	if err := json.Unmarshal([]byte(payload.Message), &h); err != nil {
+		return fmt.Errorf("invalid media header: %w", err)
+	}
+	header := h.MediaHeader
+	if !mediaIDPattern.MatchString(header.ID) || header.Size < 0 || header.Size > MaxMediaSize {
+		return fmt.Errorf("invalid media header")
+	}
+
+	qn.trackMediaStream(header.ID, stream)
+	defer qn.untrackMediaStream(header.ID, stream)
+
+	// every read gets a fresh deadline: only a stalled body times out
+	plain, err := crypto.DecryptStream(&idleReader{r: body, stream: stream}, h.Key, []byte(header.ID))
+	if err != nil {
+		return mediaCanceled(err)
+	}
+	if err := handler(payload.SenderID, header, &sizedReader{r: plain, left: header.Size}); err != nil {
+		return mediaCanceled(err)
+	}
+	logger.L().Debug("Media received", "from", shortID(payload.SenderID), "id", header.ID, "size", header.Size)
+	return nil
+}
+
+// decryptMediaHeader decrypts a media header, waiting a little for the key
+// exchange it may have overtaken (see rotation.go)
+func (qn *QuicNetwork) decryptMediaHeader(encMsg *crypto.EncryptedMessage) (*crypto.MessagePayload, error) {
+	deadline := time.Now().Add(inflightGrace)
+	for {
+		payload, err := qn.pqCrypto.DecryptMessageFromPeer(encMsg)
+		if !awaitingKey(err) || time.Now().After(deadline) {
+			return payload, err
+		}
+		select {
+		case <-qn.ctx.Done():
+			return nil, qn.ctx.Err()
+		case <-time.After(200 * time.Millisecond):
+		}
+	}
+}
+
+// idleReader renews the stream's read deadline on every read
+type idleReader struct {
+	r      io.Reader
+	stream quic.Stream
+}
+
+func (r *idleReader) Read(p []byte) (int, error) {
+	r.stream.SetReadDeadline(time.Now().Add(mediaIdleTimeout))
+	n, err := r.r.Read(p)
+	diagnostics.Add(diagnostics.BytesReceived, uint64(n))
+	return n, err
+}
+
+// sizedReader yields exactly left bytes and fails if the body is shorter or longer
+type sizedReader struct {
+	r    io.Reader
+	left int64
+}
+
+func (r *sizedReader) Read(p []byte) (int, error) {
+	if r.left == 0 {
+		// the body must end here
+		var extra [1]byte
+		if n, err := r.r.Read(extra[:]); n > 0 || (err != nil && err != io.EOF) {
+			if err == nil {
+				err = fmt.Errorf("media body longer than announced")
+			}
+			return 0, err
+		}
+		return 0, io.EOF
+	}
+	if int64(len(p)) > r.left {
+		p = p[:r.left]
+	}
+	n, err := r.r.Read(p)
+	r.left -= int64(n)
+	if err == io.EOF && r.left > 0 {
+		err = fmt.Errorf("media body shorter than announced")
+	}
+	return n, err
+}
+
+// CancelMedia aborts the transfer of a media body in either direction; the
+// other end sees ErrMediaCanceled. It reports whether such a transfer was
+// in flight.
+func (qn *QuicNetwork) CancelMedia(id string) bool {
+	qn.mediaStreamsMu.Lock()
+	stream, ok := qn.mediaStreams[id]
+	qn.mediaStreamsMu.Unlock()
+	if ok {
+		stream.CancelRead(mediaStreamCanceled)
+		stream.CancelWrite(mediaStreamCanceled)
+	}
+	return ok
+}
+
+func (qn *QuicNetwork) trackMediaStream(id string, stream quic.Stream) {
+	qn.mediaStreamsMu.Lock()
+	defer qn.mediaStreamsMu.Unlock()
+	if qn.mediaStreams == nil {
+		qn.mediaStreams = make(map[string]quic.Stream)
+	}
+	qn.mediaStreams[id] = stream
+}
+
+func (qn *QuicNetwork) untrackMediaStream(id string, stream quic.Stream) {
+	qn.mediaStreamsMu.Lock()
+	defer qn.mediaStreamsMu.Unlock()
+	if qn.mediaStreams[id] == stream {
+		delete(qn.mediaStreams, id)
+	}
+}
+
+// mediaCanceled turns a stream reset by CancelMedia into ErrMediaCanceled
+func mediaCanceled(err error) error {
+	var streamErr *quic.StreamError
+	if errors.As(err, &streamErr) && streamErr.ErrorCode == mediaStreamCanceled {
+		return ErrMediaCanceled
+	}
+	return err
+}
+
+// ctxErr prefers the context's error over the one a cancelled stream reports
+func ctxErr(ctx context.Context, err error) error {
+	if ctx.Err() != nil {
+		return ctx.Err()
+	}
+	return err
+}
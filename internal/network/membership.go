@@ -0,0 +1,258 @@
+package network
+
+import (
+	"encoding/hex"
+	"fmt"
+	"time"
+
+	"execp2p/internal/crypto"
+	"execp2p/internal/diagnostics"
+	"execp2p/internal/frame"
+	"execp2p/internal/logger"
+	"execp2p/internal/wire"
+
+	"github.com/quic-go/quic-go"
+)
+
+// Room membership certificates.
+//
+// Once a guest has joined with the access key, the host signs a membership
+// certificate naming the guest's identity ("membercert"). When the guest
+// connects again it presents the certificate together with a signature over
+// the new TLS session made with that identity ("memberproof"), instead of
+// running the access key handshake. Membership then rests on the host's
+// signature, not on the shared key: a member keeps access after the key is
+// rotated, and an announcement on such a connection must come from exactly
+// the certified identity (the host's, on the guest side).
+//
+// The host revokes all certificates issued so far when it rotates the key
+// and evicts everyone. A refused certificate ("memberdenied") is dropped by
+// the guest, which falls back to the access key on the next connection.
+
+// membershipValidity is how long a certificate is valid; it is renewed on
+// every connection
+const membershipValidity = 24 * time.Hour
+
+// membershipContextLabel is the TLS exporter label membership proofs sign
+const membershipContextLabel = "EXPERIMENTAL-execp2p-membership-proof-v1"
+
+// memberProof is a guest's certificate with its proof of identity
+type memberProof = frame.MemberProof
+
+// currentMembership returns our membership certificate for this room, if any
+func (qn *QuicNetwork) currentMembership() *crypto.MembershipCert {
+	qn.membershipMutex.Lock()
+	defer qn.membershipMutex.Unlock()
+	if qn.membership == nil || time.Now().After(qn.membership.ExpiresAt) {
+		return nil
+	}
+	return qn.membership
+}
+
+// RevokeMemberships invalidates every membership certificate issued so far
+// (host). Members have to rejoin with the access key.
+func (qn *QuicNetwork) RevokeMemberships() {
+	qn.membershipMutex.Lock()
+	qn.membersNotBefore = time.Now()
+	qn.membershipMutex.Unlock()
+	logger.L().Info("Membership certificates revoked", "room_id", qn.roomID)
+}
+
+// startMemberSession opens a connection with our membership certificate
+// instead of the access key handshake (guest)
+func (qn *QuicNetwork) startMemberSession(conn quic.Connection, cert *crypto.MembershipCert) error {
+	binding, err := exportBinding(conn, membershipContextLabel)
+	if err != nil {
+		return fmt.Errorf("failed to bind membership proof to the session: %w", err)
+	}
+	payload, err := wire.Marshal(&memberProof{Cert: cert, Proof: qn.pqCrypto.SignMembershipProof(binding)}, qn.formatOn(conn))
+	if err != nil {
+		return err
+	}
+
+	// the host is authenticated by its announcement matching the certificate
+	qn.pakeMutex.Lock()
+	qn.pake = &pakeSession{conn: conn, member: cert, confirmed: true}
+	qn.pakeMutex.Unlock()
+
+	logger.L().Debug("Connecting with membership certificate", "room_id", qn.roomID)
+	if err := qn.writeWrapper(message{
+		Type:      "memberproof",
+		Payload:   hex.EncodeToString(payload),
+		Timestamp: time.Now().Unix(),
+		SenderID:  qn.localPeerID,
+		RoomID:    qn.roomID,
+	}); err != nil {
+		return err
+	}
+	return qn.sendPeerAnnouncement()
+}
+
+// issueMembership sends a newly joined guest its certificate (host)
+func (qn *QuicNetwork) issueMembership(peerID string) {
+	cert, err := qn.pqCrypto.IssueMembershipCert(qn.roomID, qn.localPeerID, peerID, membershipValidity)
+	if err != nil {
+		logger.L().Warn("Membership certificate not issued", "peer", shortID(peerID), "err", err)
+		return
+	}
+	payload, err := wire.Marshal(cert, qn.format())
+	if err != nil {
+		return
+	}
+	if err := qn.writeWrapper(message{
+		Type:      "membercert",
+		Payload:   hex.EncodeToString(payload),
+		Timestamp: time.Now().Unix(),
+		SenderID:  qn.localPeerID,
+		RoomID:    qn.roomID,
+	}); err != nil {
+		logger.L().Warn("Membership certificate not sent", "peer", shortID(peerID), "err", err)
+	}
+}
+
+// handleMemberCert stores the certificate the host issued to us (guest)
+func (qn *QuicNetwork) handleMemberCert(w message) {
+	if qn.isListener {
+		return
+	}
+	cert, err := decodeMembershipCert(w.Payload)
+	if err != nil {
+		logger.L().Warn("Invalid membership certificate", "err", err)
+		return
+	}
+	own, _ := qn.pqCrypto.GetIdentityFingerprint()
+	if cert.HostID != w.SenderID || cert.MemberID != qn.localPeerID || cert.MemberFingerprint != own {
+		logger.L().Warn("Membership certificate for someone else", "host", shortID(cert.HostID))
+		return
+	}
+	if err := qn.pqCrypto.VerifyMembershipCert(cert, qn.roomID); err != nil {
+		logger.L().Warn("Invalid membership certificate", "host", shortID(cert.HostID), "err", err)
+		return
+	}
+
+	qn.membershipMutex.Lock()
+	qn.membership = cert
+	qn.membershipMutex.Unlock()
+	logger.L().Debug("Membership certificate received", "room_id", qn.roomID, "expires", cert.ExpiresAt)
+}
+
+// handleMemberProof admits a guest with a valid certificate (host)
+func (qn *QuicNetwork) handleMemberProof(w message) {
+	s := qn.session()
+	if !qn.isListener || s == nil {
+		return
+	}
+	bytesPayload, err := hex.DecodeString(w.Payload)
+	if err != nil {
+		qn.membershipDenied(w.SenderID, err)
+		return
+	}
+	var proof memberProof
+	if err := wire.Unmarshal(bytesPayload, &proof); err != nil || proof.Cert == nil {
+		qn.membershipDenied(w.SenderID, fmt.Errorf("malformed membership proof"))
+		return
+	}
+	if err := qn.verifyMemberProof(s.conn, w.SenderID, &proof); err != nil {
+		qn.membershipDenied(w.SenderID, err)
+		return
+	}
+
+	qn.pakeMutex.Lock()
+	s.member = proof.Cert
+	s.confirmed = true
+	qn.pakeMutex.Unlock()
+
+	logger.L().Debug("Member admitted by certificate", "peer", shortID(w.SenderID))
+	if err := qn.sendPeerAnnouncement(); err != nil {
+		logger.L().Error("Peer announcement send failed", "err", err)
+	}
+}
+
+func (qn *QuicNetwork) verifyMemberProof(conn quic.Connection, senderID string, proof *memberProof) error {
+	cert := proof.Cert
+	if cert.MemberID != senderID || cert.HostID != qn.localPeerID {
+		return fmt.Errorf("membership certificate for someone else")
+	}
+	if err := qn.pqCrypto.VerifyMembershipCert(cert, qn.roomID); err != nil {
+		return err
+	}
+	qn.membershipMutex.Lock()
+	revoked := cert.IssuedAt.Before(qn.membersNotBefore)
+	qn.membershipMutex.Unlock()
+	if revoked {
+		return fmt.Errorf("membership certificate revoked")
+	}
+	binding, err := exportBinding(conn, membershipContextLabel)
+	if err != nil {
+		return err
+	}
+	return qn.pqCrypto.VerifyMembershipProof(cert, binding, proof.Proof)
+}
+
+// handleMemberDenied drops a certificate the host no longer accepts (guest)
+func (qn *QuicNetwork) handleMemberDenied(w message) {
+	if qn.isListener {
+		return
+	}
+	qn.membershipMutex.Lock()
+	qn.membership = nil
+	qn.membershipMutex.Unlock()
+	logger.L().Info("Host refused our membership certificate; the access key is needed to rejoin")
+	qn.sendError(&AuthError{Err: fmt.Errorf("członkostwo w pokoju wygasło lub zostało cofnięte; dołącz ponownie z kluczem dostępu")})
+}
+
+// membershipDenied ends a connection with an invalid certificate (host)
+func (qn *QuicNetwork) membershipDenied(peerID string, err error) {
+	logger.L().Warn("Membership certificate refused", "room_id", qn.roomID, "peer", shortID(peerID), "err", err)
+	diagnostics.RecordHandshakeFailure(diagnostics.HandshakeBadMembership)
+	if err := qn.writeWrapper(message{
+		Type:      "memberdenied",
+		Timestamp: time.Now().Unix(),
+		SenderID:  qn.localPeerID,
+		RoomID:    qn.roomID,
+	}); err != nil {
+		logger.L().Debug("Membership refusal not sent", "err", err)
+	}
+
+	conn := qn.currentConn()
+	time.AfterFunc(500*time.Millisecond, func() {
+		if conn != nil {
+			conn.CloseWithError(closeCodeRefused, "invalid membership certificate")
+		}
+	})
+}
+
+// admittedBy checks that an announcement on a connection admitted by
+// certificate comes from the certified identity: the member's on the host,
+// the issuing host's on the guest
+func (qn *QuicNetwork) admittedBy(cert *crypto.MembershipCert, announcement *crypto.PeerAnnouncement) bool {
+	if qn.isListener {
+		return cert.MatchesAnnouncement(announcement)
+	}
+	return announcement.PeerID == cert.HostID && announcement.TrustFingerprint == cert.HostFingerprint
+}
+
+// sessionMember returns the certificate the current connection was admitted by
+func (qn *QuicNetwork) sessionMember() *crypto.MembershipCert {
+	s := qn.session()
+	if s == nil {
+		return nil
+	}
+	qn.pakeMutex.Lock()
+	defer qn.pakeMutex.Unlock()
+	return s.member
+}
+
+// exportBinding derives a value unique to the connection's TLS session
+func exportBinding(conn quic.Connection, label string) ([]byte, error) {
+	state := conn.ConnectionState().TLS
+	return state.ExportKeyingMaterial(label, nil, 32)
+}
+
+func decodeMembershipCert(payload string) (*crypto.MembershipCert, error) {
+	bytesPayload, err := hex.DecodeString(payload)
+	if err != nil {
+		return nil, err
+	}
+	return crypto.DeserializeMembershipCert(bytesPayload)
+}
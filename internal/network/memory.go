@@ -0,0 +1,219 @@
+package network
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"net"
+	"strconv"
+	"sync"
+	"sync/atomic"
+
+	"execp2p/internal/crypto"
+
+	"github.com/quic-go/quic-go"
+)
+
+// In-memory transport.
+//
+// A MemorySwitch carries the packets of the networks it creates between
+// them in memory, without sockets, so whole app-level flows (creating and
+// joining rooms, the handshakes and key exchange, rotation, messages,
+// moderation) run in go test without ports or a flaky UDP stack. The
+// networks are ordinary QUIC networks: only the packet connection under
+// QUIC is replaced, so every feature of the transport works the same.
+//
+// A host is reachable at any "host:port" with its listen port; give every
+// app on a switch its own port range (network.min_port, network.max_port),
+// as two hosts on one port would be two apps on one UDP port. Packets are
+// never lost or reordered unless Cut says so. Cut works on the networks of
+// one Factory, so an app keeps being cut off when it redials from a new
+// port.
+
+// first port given to a dialing network
+const memoryEphemeralPort = 49152
+
+// switches so far; each gets an IP of its own, as quic-go tracks packet
+// connections by local address across the process and the connections of
+// a closed switch may still be shutting down
+var memorySwitches atomic.Uint32
+
+// MemorySwitch connects the networks created by its NewNetwork
+type MemorySwitch struct {
+	mu    sync.Mutex
+	conns map[int]*memoryConn
+	// hosts whose packets are dropped, both ways
+	cut      map[string]bool
+	nextPort int
+	// the address every connection on the switch has, with its port
+	ip net.IP
+}
+
+// memoryHost is the machine the networks of one Factory run on
+type memoryHost struct {
+	sw   *MemorySwitch
+	name string
+}
+
+// NewMemorySwitch returns an empty switch
+func NewMemorySwitch() *MemorySwitch {
+	return &MemorySwitch{
+		conns:    make(map[int]*memoryConn),
+		cut:      make(map[string]bool),
+		nextPort: memoryEphemeralPort,
+		ip:       memorySwitchIP(memorySwitches.Add(1)),
+	}
+}
+
+// memorySwitchIP is a loopback address of switch n, away from 127.0.0.1
+func memorySwitchIP(n uint32) net.IP {
+	return net.IPv4(127, 1+byte(n>>16), byte(n>>8), byte(n))
+}
+
+// NewNetwork is NewNetwork on the switch instead of UDP; it is a Factory
+// of an unnamed host
+func (s *MemorySwitch) NewNetwork(ctx context.Context, peerID, roomID string, listenPort int, pqCrypto *crypto.PQCrypto, isListener bool, remoteAddr string) (Network, error) {
+	return s.Factory("")(ctx, peerID, roomID, listenPort, pqCrypto, isListener, remoteAddr)
+}
+
+// Factory returns a NewNetwork on the switch for the networks of host,
+// e.g. one app, which Cut then cuts off together
+func (s *MemorySwitch) Factory(host string) Factory {
+	h := &memoryHost{sw: s, name: host}
+	return func(ctx context.Context, peerID, roomID string, listenPort int, pqCrypto *crypto.PQCrypto, isListener bool, remoteAddr string) (Network, error) {
+		qn, err := NewQuicNetwork(ctx, peerID, roomID, listenPort, pqCrypto, isListener, remoteAddr)
+		if err != nil {
+			return nil, err
+		}
+		qn.packets = h
+		return qn, nil
+	}
+}
+
+// Cut drops every packet to and from the networks of host until it is
+// called again with false, as if the machine lost its network
+func (s *MemorySwitch) Cut(host string, cut bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if cut {
+		s.cut[host] = true
+	} else {
+		delete(s.cut, host)
+	}
+}
+
+// open attaches a connection of host at port, or at a free one when port
+// is 0
+func (s *MemorySwitch) open(host string, port int) (*memoryConn, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if port == 0 {
+		for s.conns[s.nextPort] != nil {
+			s.nextPort++
+		}
+		port = s.nextPort
+		s.nextPort++
+	} else if s.conns[port] != nil {
+		return nil, fmt.Errorf("memory port %d already in use", port)
+	}
+	c := &memoryConn{
+		inbox: newInbox(),
+		sw:    s,
+		host:  host,
+		addr:  &net.UDPAddr{IP: s.ip, Port: port},
+	}
+	s.conns[port] = c
+	return c, nil
+}
+
+// deliver hands a packet from a connection to the one at port to, dropping
+// it when there is none, either host is cut off or the connection's queue
+// is full
+func (s *MemorySwitch) deliver(from *memoryConn, to int, data []byte) {
+	s.mu.Lock()
+	c := s.conns[to]
+	drop := c == nil || s.cut[c.host] || s.cut[from.host]
+	s.mu.Unlock()
+	if drop {
+		return
+	}
+	c.push(from.addr, data)
+}
+
+func (s *MemorySwitch) detach(c *memoryConn) {
+	s.mu.Lock()
+	if s.conns[c.addr.Port] == c {
+		delete(s.conns, c.addr.Port)
+	}
+	s.mu.Unlock()
+}
+
+// listen opens a QUIC listener at the port of addr
+func (h *memoryHost) listen(addr string, tlsConfig *tls.Config, conf *quic.Config) (listener, error) {
+	port, err := addrPort(addr)
+	if err != nil {
+		return nil, err
+	}
+	pc, err := h.sw.open(h.name, port)
+	if err != nil {
+		return nil, err
+	}
+	return listenOn(pc, tlsConfig, conf)
+}
+
+// dial connects to the host listening at the port of addr
+func (h *memoryHost) dial(ctx context.Context, addr string, tlsConfig *tls.Config, conf *quic.Config, early bool) (quic.Connection, error) {
+	port, err := addrPort(addr)
+	if err != nil {
+		return nil, err
+	}
+	pc, err := h.sw.open(h.name, 0)
+	if err != nil {
+		return nil, err
+	}
+	remote := &net.UDPAddr{IP: h.sw.ip, Port: port}
+	return dialOn(ctx, pc, remote, tlsConfig, conf, early)
+}
+
+// addrPort is the port of a "host:port" address; the host does not matter
+// on a switch
+func addrPort(addr string) (int, error) {
+	_, portStr, err := net.SplitHostPort(addr)
+	if err != nil {
+		return 0, err
+	}
+	port, err := strconv.Atoi(portStr)
+	if err != nil {
+		return 0, fmt.Errorf("invalid port in %q: %w", addr, err)
+	}
+	return port, nil
+}
+
+// memoryConn is a net.PacketConn attached to a MemorySwitch
+type memoryConn struct {
+	*inbox
+	sw   *MemorySwitch
+	host string
+	addr *net.UDPAddr
+}
+
+func (c *memoryConn) WriteTo(p []byte, addr net.Addr) (int, error) {
+	if c.isClosed() {
+		return 0, net.ErrClosed
+	}
+	to, ok := addr.(*net.UDPAddr)
+	if !ok {
+		return 0, fmt.Errorf("not a memory address: %v", addr)
+	}
+	c.sw.deliver(c, to.Port, p)
+	return len(p), nil
+}
+
+func (c *memoryConn) Close() error {
+	if c.shut() {
+		c.sw.detach(c)
+	}
+	return nil
+}
+
+func (c *memoryConn) LocalAddr() net.Addr { return c.addr }
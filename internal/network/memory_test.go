@@ -0,0 +1,14 @@
+package network
+
+import "testing"
+
+func TestMemoryRoom(t *testing.T) {
+	sw := NewMemorySwitch()
+	ctx := testContext(t)
+	roomID := testRoomID(t)
+	host := newTestPeer(t, sw.Factory("host"), roomID, 9000, true, "")
+	host.start(t, ctx)
+	guest := newTestPeer(t, sw.Factory("guest"), roomID, 0, false, "127.0.0.1:9000")
+	guest.start(t, ctx)
+	exchange(t, ctx, host, guest)
+}
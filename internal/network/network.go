@@ -17,24 +17,32 @@ type Network interface {
 	// encrypt and send a message to all verified peers
 	SendMessage(ctx context.Context, message string) error
 
+	// send a message under a given ID, the same on every attempt
+	SendMessageWithID(ctx context.Context, messageID, message string) error
+
 	// get the channel for incoming messages
 	GetIncomingMessages() <-chan *crypto.MessagePayload
 
-	// get the list of connected peer IDs
-	GetConnectedPeers() []string
+	// Peers returns the connected peers with their connection details
+	Peers() []PeerInfo
 
 	// ForceKeyRotation triggers an immediate key rotation and re-establishes
 	// fresh shared secrets with all connected peers. It returns a boolean that
 	// indicates whether a rotation actually took place.
 	ForceKeyRotation() (bool, error)
 
-	// get the channel where the transport reports asynchronous errors
+	// get the channel where the transport reports asynchronous errors;
+	// Code and Retryable classify them
 	GetErrorChannel() <-chan error
 
 	// IsListener returns true if the network is a listener (creator)
 	IsListener() bool
 }
 
+// Factory creates the transport of a room; NewNetwork outside tests, or
+// the NewNetwork of a MemorySwitch
+type Factory func(ctx context.Context, peerID, roomID string, listenPort int, pqCrypto *crypto.PQCrypto, isListener bool, remoteAddr string) (Network, error)
+
 // NewNetwork returns a QUIC-based transport.
 // if isListener is true (room creator) it listens, otherwise dials remoteAddr
 func NewNetwork(ctx context.Context, peerID, roomID string, listenPort int, pqCrypto *crypto.PQCrypto, isListener bool, remoteAddr string) (Network, error) {
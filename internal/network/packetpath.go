@@ -0,0 +1,297 @@
+package network
+
+import (
+	"context"
+	"crypto/tls"
+	"net"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/quic-go/quic-go"
+)
+
+// Packet carriers other than UDP.
+//
+// QUIC only needs a net.PacketConn, so a network can run over anything that
+// carries datagrams: a MemorySwitch (memory.go), libp2p streams (libp2p.go)
+// or WebRTC data channels (webrtc.go). The TLS and access-key handshakes,
+// the planes and the post-quantum layer stay the same on every carrier.
+
+// packetHost carries the QUIC packets of a network instead of UDP
+type packetHost interface {
+	// listen opens a QUIC listener at the port of addr
+	listen(addr string, tlsConfig *tls.Config, conf *quic.Config) (listener, error)
+	// dial connects to the host at addr
+	dial(ctx context.Context, addr string, tlsConfig *tls.Config, conf *quic.Config, early bool) (quic.Connection, error)
+}
+
+// listenOn opens a QUIC listener on pc; closing the listener closes pc
+func listenOn(pc net.PacketConn, tlsConfig *tls.Config, conf *quic.Config) (listener, error) {
+	tr := &quic.Transport{Conn: pc}
+	var l listener
+	var err error
+	if conf.Allow0RTT {
+		var el *quic.EarlyListener
+		if el, err = tr.ListenEarly(tlsConfig, conf); err == nil {
+			l = earlyListener{el}
+		}
+	} else {
+		l, err = tr.Listen(tlsConfig, conf)
+	}
+	if err != nil {
+		tr.Close()
+		pc.Close()
+		return nil, err
+	}
+	return packetListener{listener: l, tr: tr, pc: pc}, nil
+}
+
+// dialOn connects to remote over pc, which the connection then owns like a
+// dialed UDP socket
+func dialOn(ctx context.Context, pc net.PacketConn, remote net.Addr, tlsConfig *tls.Config, conf *quic.Config, early bool) (quic.Connection, error) {
+	tr := &quic.Transport{Conn: pc}
+	var conn quic.Connection
+	var err error
+	if early {
+		conn, err = tr.DialEarly(ctx, remote, tlsConfig, conf)
+	} else {
+		conn, err = tr.Dial(ctx, remote, tlsConfig, conf)
+	}
+	if err != nil {
+		tr.Close()
+		pc.Close()
+		return nil, err
+	}
+	context.AfterFunc(conn.Context(), func() {
+		tr.Close()
+		pc.Close()
+	})
+	return conn, nil
+}
+
+// packetListener closes the transport and packet connection of a listener
+// with it
+type packetListener struct {
+	listener
+	tr *quic.Transport
+	pc net.PacketConn
+}
+
+func (l packetListener) Close() error {
+	err := l.listener.Close()
+	l.tr.Close()
+	l.pc.Close()
+	return err
+}
+
+// inboxQueue is how many packets an inbox holds before dropping, like a
+// full socket buffer
+const inboxQueue = 1024
+
+type inboxPacket struct {
+	from net.Addr
+	data []byte
+}
+
+// inbox is the receiving half of a packet connection that is not a socket:
+// a queue read with a deadline
+type inbox struct {
+	in     chan inboxPacket
+	closed chan struct{}
+	once   sync.Once
+
+	mu           sync.Mutex
+	readDeadline time.Time
+	// closed and replaced when the read deadline moves
+	changed chan struct{}
+}
+
+func newInbox() *inbox {
+	return &inbox{
+		in:      make(chan inboxPacket, inboxQueue),
+		closed:  make(chan struct{}),
+		changed: make(chan struct{}),
+	}
+}
+
+// push queues a copy of data, dropping it when the queue is full
+func (b *inbox) push(from net.Addr, data []byte) {
+	select {
+	case b.in <- inboxPacket{from: from, data: append([]byte(nil), data...)}:
+	case <-b.closed:
+	default:
+	}
+}
+
+// shut closes the inbox; true the first time
+func (b *inbox) shut() bool {
+	first := false
+	b.once.Do(func() {
+		close(b.closed)
+		first = true
+	})
+	return first
+}
+
+// isClosed reports whether the inbox is shut
+func (b *inbox) isClosed() bool {
+	select {
+	case <-b.closed:
+		return true
+	default:
+		return false
+	}
+}
+
+func (b *inbox) ReadFrom(p []byte) (int, net.Addr, error) {
+	for {
+		b.mu.Lock()
+		deadline, changed := b.readDeadline, b.changed
+		b.mu.Unlock()
+
+		var timeout <-chan time.Time
+		var timer *time.Timer
+		if !deadline.IsZero() {
+			wait := time.Until(deadline)
+			if wait <= 0 {
+				return 0, nil, os.ErrDeadlineExceeded
+			}
+			timer = time.NewTimer(wait)
+			timeout = timer.C
+		}
+		select {
+		case pkt := <-b.in:
+			if timer != nil {
+				timer.Stop()
+			}
+			return copy(p, pkt.data), pkt.from, nil
+		case <-b.closed:
+			if timer != nil {
+				timer.Stop()
+			}
+			return 0, nil, net.ErrClosed
+		case <-timeout:
+			return 0, nil, os.ErrDeadlineExceeded
+		case <-changed:
+			if timer != nil {
+				timer.Stop()
+			}
+		}
+	}
+}
+
+func (b *inbox) SetDeadline(t time.Time) error { return b.SetReadDeadline(t) }
+
+func (b *inbox) SetReadDeadline(t time.Time) error {
+	b.mu.Lock()
+	b.readDeadline = t
+	close(b.changed)
+	b.changed = make(chan struct{})
+	b.mu.Unlock()
+	return nil
+}
+
+func (b *inbox) SetWriteDeadline(time.Time) error { return nil }
+
+// the queue is the buffer; QUIC asks to grow them on sockets
+func (b *inbox) SetReadBuffer(int) error  { return nil }
+func (b *inbox) SetWriteBuffer(int) error { return nil }
+
+// pathAddr is the address of a peer on a packet path: its libp2p peer ID
+// or a WebRTC session
+type pathAddr struct {
+	network string
+	id      string
+}
+
+func (a pathAddr) Network() string { return a.network }
+func (a pathAddr) String() string  { return a.id }
+
+// packetPath carries packets to one peer
+type packetPath interface {
+	// send hands one packet to the path, dropping it when the path is
+	// backed up
+	send(p []byte) error
+	close() error
+}
+
+// pathConn is a net.PacketConn over packet paths, one to each peer
+type pathConn struct {
+	*inbox
+	local net.Addr
+
+	mu    sync.Mutex
+	paths map[string]packetPath
+}
+
+func newPathConn(local net.Addr) *pathConn {
+	return &pathConn{
+		inbox: newInbox(),
+		local: local,
+		paths: make(map[string]packetPath),
+	}
+}
+
+// attach makes p the path to addr, closing the one it replaces; false when
+// the connection is closed
+func (c *pathConn) attach(addr net.Addr, p packetPath) bool {
+	c.mu.Lock()
+	if c.isClosed() {
+		c.mu.Unlock()
+		p.close()
+		return false
+	}
+	old := c.paths[addr.String()]
+	c.paths[addr.String()] = p
+	c.mu.Unlock()
+	if old != nil {
+		old.close()
+	}
+	return true
+}
+
+// detach closes p and forgets it if it is still the path to addr
+func (c *pathConn) detach(addr net.Addr, p packetPath) {
+	c.mu.Lock()
+	if c.paths[addr.String()] == p {
+		delete(c.paths, addr.String())
+	}
+	c.mu.Unlock()
+	p.close()
+}
+
+// deliver queues a packet that arrived on the path from addr
+func (c *pathConn) deliver(from net.Addr, data []byte) {
+	c.push(from, data)
+}
+
+func (c *pathConn) WriteTo(p []byte, addr net.Addr) (int, error) {
+	if c.isClosed() {
+		return 0, net.ErrClosed
+	}
+	c.mu.Lock()
+	path := c.paths[addr.String()]
+	c.mu.Unlock()
+	// no path is like no route: the packet is lost and QUIC resends it
+	if path != nil {
+		path.send(p)
+	}
+	return len(p), nil
+}
+
+func (c *pathConn) Close() error {
+	if !c.shut() {
+		return nil
+	}
+	c.mu.Lock()
+	paths := c.paths
+	c.paths = make(map[string]packetPath)
+	c.mu.Unlock()
+	for _, p := range paths {
+		p.close()
+	}
+	return nil
+}
+
+func (c *pathConn) LocalAddr() net.Addr { return c.local }
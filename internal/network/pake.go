@@ -0,0 +1,185 @@
+package network
+
+import (
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"time"
+
+	"execp2p/internal/crypto"
+	"execp2p/internal/diagnostics"
+	"execp2p/internal/logger"
+
+	"github.com/quic-go/quic-go"
+)
+
+// Room access key handshake.
+//
+// When the room has an access key, every connection starts with a SPAKE2
+// exchange (crypto/pake.go) keyed with it: both sides send a share ("pake"),
+// then a key confirmation ("pakeconfirm"). The access key itself never
+// leaves the machine, not even hashed. Peer announcements are only sent and
+// accepted once the peer's confirmation checks out. The exchange is bound to
+// the connection's TLS session, so it can't be relayed onto another one.
+
+// ErrAccessDenied is reported on the error channel when the access key
+// handshake fails: one side holds a wrong key
+var ErrAccessDenied = errors.New("nieprawidłowy klucz dostępu")
+
+// pakeContextLabel is the TLS exporter label the exchange is bound to
+const pakeContextLabel = "EXPERIMENTAL-execp2p-access-key-pake-v1"
+
+// pakeSession is the access key handshake on one connection
+type pakeSession struct {
+	conn      quic.Connection
+	pake      *crypto.PAKE
+	confirmed bool
+	// the membership certificate the connection was admitted by instead, see membership.go
+	member *crypto.MembershipCert
+}
+
+// startSession opens a new connection: the membership certificate if we
+// have one, the access key handshake if the room has a key, the peer
+// announcement otherwise
+func (qn *QuicNetwork) startSession(conn quic.Connection) error {
+	if !qn.isListener {
+		if cert := qn.currentMembership(); cert != nil {
+			return qn.startMemberSession(conn, cert)
+		}
+	}
+
+	qn.keyExchangeMutex.RLock()
+	accessKey := qn.roomAccessKey
+	qn.keyExchangeMutex.RUnlock()
+	if accessKey == "" {
+		return qn.sendPeerAnnouncement()
+	}
+
+	state := conn.ConnectionState().TLS
+	binding, err := state.ExportKeyingMaterial(pakeContextLabel, nil, 32)
+	if err != nil {
+		return fmt.Errorf("failed to bind access key handshake to the session: %w", err)
+	}
+	role := crypto.PAKEInitiator
+	if qn.isListener {
+		role = crypto.PAKEResponder
+	}
+	pake, err := crypto.NewPAKE(role, []byte(accessKey), binding)
+	if err != nil {
+		return err
+	}
+
+	qn.pakeMutex.Lock()
+	qn.pake = &pakeSession{conn: conn, pake: pake}
+	qn.pakeMutex.Unlock()
+
+	return qn.writeWrapper(message{
+		Type:      "pake",
+		Payload:   hex.EncodeToString(pake.Share()),
+		Timestamp: time.Now().Unix(),
+		SenderID:  qn.localPeerID,
+		RoomID:    qn.roomID,
+	})
+}
+
+// session returns the access key handshake of the current connection
+func (qn *QuicNetwork) session() *pakeSession {
+	conn := qn.currentConn()
+	qn.pakeMutex.Lock()
+	defer qn.pakeMutex.Unlock()
+	if qn.pake == nil || qn.pake.conn != conn {
+		return nil
+	}
+	return qn.pake
+}
+
+// accessConfirmed reports whether the peer on the current connection proved
+// it knows the access key
+func (qn *QuicNetwork) accessConfirmed() bool {
+	s := qn.session()
+	if s == nil {
+		return false
+	}
+	qn.pakeMutex.Lock()
+	defer qn.pakeMutex.Unlock()
+	return s.confirmed
+}
+
+func (qn *QuicNetwork) handlePakeShare(w message) {
+	s := qn.session()
+	if s == nil {
+		logger.L().Debug("Access key handshake from peer, but this room has no key", "peer", shortID(w.SenderID))
+		return
+	}
+	if s.pake == nil {
+		// we connected with a membership certificate
+		return
+	}
+	share, err := hex.DecodeString(w.Payload)
+	if err != nil {
+		qn.accessDenied(w.SenderID, err)
+		return
+	}
+
+	qn.pakeMutex.Lock()
+	confirm, err := s.pake.Finish(share)
+	qn.pakeMutex.Unlock()
+	if err != nil {
+		qn.accessDenied(w.SenderID, err)
+		return
+	}
+
+	if err := qn.writeWrapper(message{
+		Type:      "pakeconfirm",
+		Payload:   hex.EncodeToString(confirm),
+		Timestamp: time.Now().Unix(),
+		SenderID:  qn.localPeerID,
+		RoomID:    qn.roomID,
+	}); err != nil {
+		logger.L().Warn("Access key confirmation not sent", "err", err)
+	}
+}
+
+func (qn *QuicNetwork) handlePakeConfirm(w message) {
+	s := qn.session()
+	if s == nil || s.pake == nil {
+		return
+	}
+	confirm, err := hex.DecodeString(w.Payload)
+	if err != nil {
+		qn.accessDenied(w.SenderID, err)
+		return
+	}
+
+	qn.pakeMutex.Lock()
+	err = s.pake.Verify(confirm)
+	if err == nil {
+		s.confirmed = true
+	}
+	qn.pakeMutex.Unlock()
+	if err != nil {
+		qn.accessDenied(w.SenderID, err)
+		return
+	}
+
+	logger.L().Debug("Access key confirmed", "peer", shortID(w.SenderID))
+	if err := qn.sendPeerAnnouncement(); err != nil {
+		logger.L().Error("Peer announcement send failed", "err", err)
+	}
+}
+
+// accessDenied ends a connection whose peer doesn't know the access key
+func (qn *QuicNetwork) accessDenied(peerID string, err error) {
+	logger.L().Warn("Odrzucenie peer'a z nieprawidłowym kluczem dostępu",
+		"room_id", qn.roomID, "peer", shortID(peerID), "err", err)
+	diagnostics.RecordHandshakeFailure(diagnostics.HandshakeBadAccessKey)
+	qn.sendError(&AuthError{Err: ErrAccessDenied})
+
+	// give the error a moment to reach the peer's own check before closing
+	conn := qn.currentConn()
+	time.AfterFunc(500*time.Millisecond, func() {
+		if conn != nil {
+			conn.CloseWithError(closeCodeRefused, "invalid access key")
+		}
+	})
+}
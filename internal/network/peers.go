@@ -0,0 +1,63 @@
+package network
+
+import "time"
+
+// PeerInfo is a connected peer as the transport sees it
+type PeerInfo struct {
+	ID string
+	// remote address of the connection the peer is on
+	Address     string
+	ConnectedAt time.Time
+	// when anything, keep-alives included, was last received from the peer
+	LastActivity time.Time
+	// silent for longer than the liveness timeout
+	Offline bool
+}
+
+// PeerEventKind says what changed about a peer
+type PeerEventKind string
+
+const (
+	// the peer's announcement was accepted
+	PeerConnected PeerEventKind = "connected"
+	// the key exchange with the peer completed, messages can flow
+	PeerVerified PeerEventKind = "verified"
+	// the connection to the peer was lost or closed
+	PeerDisconnected PeerEventKind = "disconnected"
+	// nothing was heard from the peer for a while, its connection is
+	// still there (liveness.go)
+	PeerOffline PeerEventKind = "offline"
+	// the peer was heard from again after PeerOffline
+	PeerOnline PeerEventKind = "online"
+)
+
+// PeerEvent reports a peer joining, finishing its handshake or leaving
+type PeerEvent struct {
+	PeerID string
+	Kind   PeerEventKind
+	// the nickname from the peer's announcement, for PeerConnected; empty
+	// if it didn't choose one
+	Nickname string
+	// why the peer is gone, for PeerDisconnected: one of the LeaveReason
+	// values
+	Reason string
+}
+
+// PeerHandler is told about every PeerEvent
+type PeerHandler func(PeerEvent)
+
+// SetPeerHandler installs the callback for peer connection changes
+func (qn *QuicNetwork) SetPeerHandler(handler PeerHandler) {
+	qn.keyExchangeMutex.Lock()
+	qn.peerHandler = handler
+	qn.keyExchangeMutex.Unlock()
+}
+
+func (qn *QuicNetwork) notifyPeer(event PeerEvent) {
+	qn.keyExchangeMutex.RLock()
+	handler := qn.peerHandler
+	qn.keyExchangeMutex.RUnlock()
+	if handler != nil {
+		handler(event)
+	}
+}
@@ -0,0 +1,288 @@
+package network
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"time"
+
+	"execp2p/internal/crash"
+	"execp2p/internal/diagnostics"
+	"execp2p/internal/frame"
+	"execp2p/internal/logger"
+	"execp2p/internal/wire"
+
+	"github.com/quic-go/quic-go"
+)
+
+// Control plane and chat plane.
+//
+// Wrappers travel on two planes of the same QUIC connection. Control frames
+// (access key handshake, membership, announcement, key exchange, room metadata, probes, goodbye) use unidirectional
+// streams; chat frames and media streams (media.go) use bidirectional
+// streams. QUIC limits and flow-controls the two stream kinds separately, and each plane is accepted,
+// parsed and dispatched on its own, so a large chat payload never holds up a
+// key rotation or a probe and either plane can evolve without the other.
+// Within a plane frames are handled in the order the peer opened them.
+//
+// A chat frame can overtake the control frame that establishes its key; the
+// rotation buffer (rotation.go) parks it until the key exchange arrives.
+
+type plane int
+
+const (
+	planeControl plane = iota
+	planeChat
+)
+
+func (p plane) String() string {
+	if p == planeChat {
+		return "chat"
+	}
+	return "control"
+}
+
+// how many streams of each plane the peer may have open at once
+const (
+	maxControlStreams = 64
+	maxChatStreams    = 100
+)
+
+// chatFrameTypes are the wrapper types carried on the chat plane
+var chatFrameTypes = map[string]bool{
+	"message":      true,
+	mediaFrameType: true,
+	chunkFrameType: true,
+}
+
+func planeOf(wrapperType string) plane {
+	if chatFrameTypes[wrapperType] {
+		return planeChat
+	}
+	return planeControl
+}
+
+// quicConfig sets the per-plane stream limits and offers datagrams
+// (datagram.go)
+func quicConfig() *quic.Config {
+	return &quic.Config{
+		MaxIncomingStreams:    maxChatStreams,
+		MaxIncomingUniStreams: maxControlStreams,
+		EnableDatagrams:       true,
+	}
+}
+
+// readLoop reads both planes of conn, and its datagrams, until it fails
+func (qn *QuicNetwork) readLoop(conn quic.Connection) {
+	defer crash.Recover("network.readLoop")
+	if datagramsSupported(conn) {
+		go qn.datagramLoop(conn)
+	}
+	go qn.planeLoop(conn, planeChat, func(ctx context.Context) (io.Reader, error) {
+		return conn.AcceptStream(ctx)
+	}, qn.handleChatFrame)
+
+	qn.planeLoop(conn, planeControl, func(ctx context.Context) (io.Reader, error) {
+		return conn.AcceptUniStream(ctx)
+	}, qn.handleControlFrame)
+
+	// Połączenie zostało utracone, ale pokój trwa dalej: dołączający
+	// może połączyć się ponownie, a host przyjmie go z powrotem
+	qn.dropConnection(conn, qn.noteClosed(conn))
+}
+
+// planeLoop accepts one plane's streams. They are read in parallel but
+// handled one at a time in the order the peer opened them, so frames of the
+// same plane never pass each other.
+func (qn *QuicNetwork) planeLoop(conn quic.Connection, p plane, accept func(context.Context) (io.Reader, error), handle func(message)) {
+	defer crash.Recover("network.planeLoop")
+	ordered := make(chan chan message, 64)
+	defer close(ordered)
+	go qn.dispatchLoop(ordered, handle)
+
+	for {
+		stream, err := accept(qn.ctx)
+		if err != nil {
+			// Kontekst został zamknięty lub połączenie zostało przerwane
+			logger.L().Debug("Connection stream error", "plane", p, "err", err)
+
+			// Jeśli to nie jest błąd przerwania kontekstu, zgłoś błąd (raz, z płaszczyzny sterowania);
+			// zamknięcie z podanym powodem zgłasza noteClosed
+			var appErr *quic.ApplicationError
+			if p == planeControl && qn.ctx.Err() == nil && !errors.As(err, &appErr) {
+				qn.sendError(&TransportError{Op: "accept stream", Err: err})
+			}
+			return
+		}
+
+		slot := make(chan message, 1)
+		select {
+		case ordered <- slot:
+		case <-qn.ctx.Done():
+			return
+		}
+
+		// Odczyt strumienia w osobnej goroutine
+		go func(s io.Reader, slot chan message) {
+			defer close(slot)
+			defer func() {
+				// Obsługa paniki w readStream, aby nie zakończyć głównej pętli
+				if r := recover(); r != nil {
+					crash.Capture("network.readStream", r)
+				}
+			}()
+			if w, ok := qn.readStream(conn, s, p); ok {
+				slot <- w
+			}
+		}(stream, slot)
+	}
+}
+
+// dispatchLoop handles decoded wrappers one at a time in stream order
+func (qn *QuicNetwork) dispatchLoop(ordered <-chan chan message, handle func(message)) {
+	for slot := range ordered {
+		w, ok := <-slot
+		if !ok {
+			continue
+		}
+		func() {
+			defer func() {
+				if r := recover(); r != nil {
+					crash.Capture("network.dispatch", r)
+				}
+			}()
+			qn.heard()
+			handle(w)
+		}()
+	}
+}
+
+// streams of both planes carry a single wrapper, in JSON or CBOR
+type planeStream interface {
+	io.Reader
+	SetReadDeadline(time.Time) error
+}
+
+func (qn *QuicNetwork) readStream(conn quic.Connection, r io.Reader, p plane) (message, bool) {
+	var wrapper message
+	stream, ok := r.(planeStream)
+	if !ok {
+		return wrapper, false
+	}
+	// a bidirectional stream is closed for writing as well, unless it
+	// carries a media body and is handed on (media.go)
+	bidi, isBidi := r.(quic.Stream)
+	handedOff := false
+	if isBidi {
+		defer func() {
+			if !handedOff {
+				bidi.Close()
+			}
+		}()
+	}
+	// a stalled stream must not hold up the ones behind it forever
+	stream.SetReadDeadline(time.Now().Add(streamReadTimeout))
+
+	// larger chat payloads come in chunks (chunk.go)
+	wrapper, rest, n, err := frame.Decode(bufio.NewReader(stream))
+	diagnostics.Add(diagnostics.BytesReceived, uint64(n))
+	if err != nil {
+		logger.L().Warn("Invalid message", "plane", p, "err", err)
+		return wrapper, false
+	}
+	if err := frame.Validate(wrapper); err != nil {
+		qn.rejectFrame(conn, err)
+		return wrapper, false
+	}
+	if !qn.agreeVersion(conn, wrapper) {
+		return wrapper, false
+	}
+	if planeOf(wrapper.Type) != p {
+		logger.L().Warn("Frame on the wrong plane; dropping", "type", wrapper.Type, "plane", p, "from", shortID(wrapper.SenderID))
+		return wrapper, false
+	}
+	if wrapper.Type == mediaFrameType {
+		if isBidi {
+			// the body follows the frame
+			handedOff = true
+			go qn.receiveMedia(wrapper, bidi, rest)
+		}
+		return wrapper, false
+	}
+	logger.L().Debug("Received wrapper", "type", wrapper.Type, "plane", p, "from", shortID(wrapper.SenderID), "size", len(wrapper.Payload))
+	return wrapper, true
+}
+
+// writeWrapperContext sends a wrapper on its plane, bounded by ctx
+func (qn *QuicNetwork) writeWrapperContext(ctx context.Context, w message) error {
+	if planeOf(w.Type) == planeChat && w.Type != chunkFrameType && len(w.Payload) > chunkSize {
+		return qn.writeChunks(ctx, w)
+	}
+	conn := qn.currentConn()
+	if conn == nil {
+		return fmt.Errorf("connection closed")
+	}
+
+	var stream quic.SendStream
+	var err error
+	if planeOf(w.Type) == planeChat {
+		stream, err = conn.OpenStreamSync(ctx)
+	} else {
+		stream, err = conn.OpenUniStreamSync(ctx)
+	}
+	if err != nil {
+		qn.sendError(&TransportError{Op: "open stream", Err: err})
+		return fmt.Errorf("failed to open stream: %w", err)
+	}
+	defer stream.Close()
+
+	f := qn.formatOn(conn)
+	data, err := frame.Encode(w, f)
+	if err != nil {
+		return err
+	}
+	if f == wire.JSON {
+		data = append(data, '\n')
+	}
+	n, err := stream.Write(data)
+	diagnostics.Add(diagnostics.BytesSent, uint64(n))
+	return err
+}
+
+func (qn *QuicNetwork) handleControlFrame(w message) {
+	switch w.Type {
+	case "pake":
+		qn.handlePakeShare(w)
+	case "pakeconfirm":
+		qn.handlePakeConfirm(w)
+	case "memberproof":
+		qn.handleMemberProof(w)
+	case "membercert":
+		qn.handleMemberCert(w)
+	case "memberdenied":
+		qn.handleMemberDenied(w)
+	case "announcement":
+		qn.handlePeerAnnouncement(w)
+	case "keyexchange":
+		qn.handleKeyExchange(w)
+	case "roommeta":
+		qn.handleRoomMetadata(w)
+	case "ping":
+		qn.handlePing(w)
+	case "pong":
+		qn.handlePong(w)
+	case "leaving":
+		qn.handleLeaving(w)
+	}
+}
+
+func (qn *QuicNetwork) handleChatFrame(w message) {
+	switch w.Type {
+	case "message":
+		qn.handleEncryptedChat(w)
+	case chunkFrameType:
+		qn.handleChunk(w)
+	}
+}
@@ -0,0 +1,83 @@
+package network
+
+import (
+	"errors"
+
+	"execp2p/internal/logger"
+)
+
+// Quarantine.
+//
+// A connection whose TLS certificate the peer's announcement doesn't vouch
+// for (another fingerprint, or a key the announced identity didn't sign) may
+// have a man in the middle. By default it is closed at once with a protocol
+// error and the peer is quarantined: refused at its announcement, over this
+// connection or any later one, until the application lifts the quarantine
+// (SetQuarantined). A CertMismatchHandler may keep such a connection open
+// instead, which then only raises the error.
+
+// ErrQuarantined means we refuse the peer until the user decides about it
+var ErrQuarantined = errors.New("peer quarantined")
+
+// CertMismatch is a connection whose TLS certificate the peer's
+// announcement doesn't vouch for
+type CertMismatch struct {
+	PeerID string
+	// the identity the peer announced
+	Fingerprint string
+	// the certificate fingerprint announced, and the one the connection
+	// presented
+	Announced string
+	Presented string
+	Err       error
+}
+
+// CertMismatchHandler is told of every CertMismatch and decides whether the
+// connection stays open; the peer is quarantined unless it does
+type CertMismatchHandler func(CertMismatch) (keep bool)
+
+// SetCertMismatchHandler installs the handler of connections whose
+// certificate fails the check
+func (qn *QuicNetwork) SetCertMismatchHandler(handler CertMismatchHandler) {
+	qn.keyExchangeMutex.Lock()
+	qn.certMismatchHandler = handler
+	qn.keyExchangeMutex.Unlock()
+}
+
+// SetQuarantined replaces the peer IDs refused at the announcement
+func (qn *QuicNetwork) SetQuarantined(peerIDs []string) {
+	quarantined := make(map[string]struct{}, len(peerIDs))
+	for _, id := range peerIDs {
+		quarantined[id] = struct{}{}
+	}
+	qn.quarantineMutex.Lock()
+	qn.quarantined = quarantined
+	qn.quarantineMutex.Unlock()
+}
+
+func (qn *QuicNetwork) isQuarantined(peerID string) bool {
+	qn.quarantineMutex.RLock()
+	defer qn.quarantineMutex.RUnlock()
+	_, ok := qn.quarantined[peerID]
+	return ok
+}
+
+// certMismatch decides about a connection that failed the certificate check;
+// true means it stays open
+func (qn *QuicNetwork) certMismatch(m CertMismatch) bool {
+	qn.keyExchangeMutex.RLock()
+	handler := qn.certMismatchHandler
+	qn.keyExchangeMutex.RUnlock()
+	if handler != nil && handler(m) {
+		return true
+	}
+
+	qn.quarantineMutex.Lock()
+	if qn.quarantined == nil {
+		qn.quarantined = make(map[string]struct{})
+	}
+	qn.quarantined[m.PeerID] = struct{}{}
+	qn.quarantineMutex.Unlock()
+	logger.L().Warn("Peer quarantined", "peer", shortID(m.PeerID))
+	return false
+}
@@ -2,36 +2,28 @@ package network
 
 import (
 	"context"
-	"crypto/rand"
-	"crypto/rsa"
 	"crypto/tls"
-	"crypto/x509"
-	"crypto/x509/pkix"
 	"encoding/hex"
-	"encoding/json"
 	"fmt"
-	"math/big"
 	"sync"
+	"sync/atomic"
 	"time"
 
+	"execp2p/internal/crash"
 	"execp2p/internal/crypto"
+	"execp2p/internal/diagnostics"
+	"execp2p/internal/frame"
 	"execp2p/internal/logger"
-
-	"crypto/sha256"
+	"execp2p/internal/wire"
 
 	"github.com/quic-go/quic-go"
 )
 
-// message is what we send over the QUIC stream
-// payload is hex-encoded, serialized crypto structures
-type message struct {
-	Type      string `json:"type"`
-	Payload   string `json:"payload"`
-	Timestamp int64  `json:"timestamp"`
-	SenderID  string `json:"sender_id"`
-	RoomID    string `json:"room_id"`    // Identyfikator pokoju
-	AccessKey string `json:"access_key"` // Klucz dostępu (opcjonalny, tylko dla pierwszego połączenia)
-}
+// how long a single stream may take to deliver its message
+const streamReadTimeout = 30 * time.Second
+
+// message is what we send over the QUIC stream (internal/frame)
+type message = frame.Frame
 
 // QuicNetwork is a transport that uses QUIC for reliable, secure, and multiplexed communication.
 type QuicNetwork struct {
@@ -56,19 +48,122 @@ type QuicNetwork struct {
 
 	peersMutex   sync.RWMutex
 	connectedIDs []string
+	// when each connected peer's announcement was first accepted
+	connectedSince map[string]time.Time
 
 	// state tracking to prevent message spam
 	announcementSent bool
 	keyExchangeSent  map[string]bool
 	keyExchangeMutex sync.RWMutex
 
-	// certificate fingerprints
+	// our transport certificate, its fingerprint and public key, see cert.go
+	certificate          *tls.Certificate
 	localCertFingerprint string
+	localCertPublicKey   []byte
 
 	// klucz dostępu do pokoju (do weryfikacji przy dołączaniu)
 	roomAccessKey string
+
+	// our nickname, sent in every announcement
+	localNickname string
+
+	// optional check of the peer's identity fingerprint (TOFU)
+	peerVerifier PeerVerifier
+	// optional check of the peer's transport certificate, see cert.go
+	certVerifier CertVerifier
+	// peers refused until the user decides, and who decides about a
+	// certificate mismatch, see quarantine.go
+	quarantineMutex     sync.RWMutex
+	quarantined         map[string]struct{}
+	certMismatchHandler CertMismatchHandler
+
+	// identity fingerprints the host refuses, see kick.go
+	bannedMutex sync.RWMutex
+	banned      map[string]struct{}
+
+	// members the room allows, the host included, see capacity.go
+	maxPeers atomic.Int64
+
+	// optional check whether messages from a sender may be decrypted
+	senderPolicy SenderPolicy
+
+	// access key handshake on the current connection, see pake.go
+	pakeMutex sync.Mutex
+	pake      *pakeSession
+
+	// membership certificates, see membership.go: ours as a guest, and
+	// the cut-off for revoked ones as the host
+	membershipMutex  sync.Mutex
+	membership       *crypto.MembershipCert
+	membersNotBefore time.Time
+
+	// signed room metadata and its consumers, see roommeta.go
+	roomMetadata        *crypto.RoomMetadata
+	roomMetadataHandler RoomMetadataHandler
+	messageObserver     MessageObserver
+	controlHandler      ControlHandler
+
+	// consumer of media bodies, see media.go
+	mediaHandler MediaHandler
+	// media streams in flight by media ID, for CancelMedia
+	mediaStreams   map[string]quic.Stream
+	mediaStreamsMu sync.Mutex
+
+	// peers connecting, verifying and leaving, see peers.go
+	peerHandler PeerHandler
+
+	// key epoch changes after departures, see rekey.go
+	rekeyHandler RekeyHandler
+	keyEpoch     atomic.Uint64
+
+	// held exclusively while keys are rotated so that messages sent
+	// meanwhile wait for the new key instead of failing
+	rotationMutex sync.RWMutex
+
+	// rotation-in-flight buffer, see rotation.go
+	inflightMutex sync.Mutex
+	inflight      []inflightMessage
+	// reordering window, see reorder.go
+	lastSequence  map[string]uint64
+	sequenceEpoch map[string]uint64
+	held          map[string]*heldMessages
+	// message IDs recently delivered, by sender, see dedup.go
+	recent map[string]*recentIDs
+	// chat frames split into chunks, see chunk.go
+	chunks reassemblies
+
+	// outstanding reachability probes by nonce, see reachability.go
+	probeMutex sync.Mutex
+	probes     map[string]chan struct{}
+	lastHeard  atomic.Int64 // unix nanos of the last wrapper received
+	// the peer has been silent too long, see liveness.go
+	offline atomic.Bool
+
+	// session resumption with 0-RTT, see resume.go
+	zeroRTT bool
+
+	// carries the packets instead of UDP when set, see packetpath.go
+	packets packetHost
+
+	// the protocol version agreed with the peer, see version.go
+	wire wireVersion
+
+	// set once the host removed us from the room, see kick.go
+	removed atomic.Bool
+
+	// unix nanos of the dial or accept the pending key exchange completes,
+	// for the connect latency
+	connectStarted atomic.Int64
 }
 
+// PeerVerifier decides whether a peer presenting the given identity
+// fingerprint may connect. A non-nil error refuses the connection.
+type PeerVerifier func(peerID, fingerprint string) error
+
+// SenderPolicy decides whether messages from a peer may be decrypted and
+// delivered. A non-nil error drops the message.
+type SenderPolicy func(senderID string) error
+
 // NewQuicNetwork creates the transport but doesn't start goroutines until Start
 func NewQuicNetwork(ctx context.Context, peerID, roomID string, listenPort int, pq *crypto.PQCrypto, isListener bool, remoteAddr string) (*QuicNetwork, error) {
 	netCtx, cancel := context.WithCancel(ctx)
@@ -85,20 +180,33 @@ func NewQuicNetwork(ctx context.Context, peerID, roomID string, listenPort int,
 		incomingMessages: make(chan *crypto.MessagePayload, 100),
 		errorChan:        make(chan error, 10),
 		keyExchangeSent:  make(map[string]bool),
+		connectedSince:   make(map[string]time.Time),
+		lastSequence:     make(map[string]uint64),
+		sequenceEpoch:    make(map[string]uint64),
+		held:             make(map[string]*heldMessages),
+		recent:           make(map[string]*recentIDs),
+		probes:           make(map[string]chan struct{}),
 	}
 	return qn, nil
 }
 
 // Start sets up the QUIC connection and launches the reader goroutine
 func (qn *QuicNetwork) Start(ctx context.Context) error {
+	var err error
 	if qn.isListener {
-		return qn.listenQUIC()
+		err = qn.listenQUIC()
+	} else {
+		err = qn.dialQUIC(qn.ctx)
 	}
-	return qn.dialQUIC()
+	if err == nil {
+		go qn.watchLiveness()
+	}
+	return err
 }
 
 // Stop closes the connection and cancels background work
 func (qn *QuicNetwork) Stop() {
+	qn.sayGoodbye()
 	qn.cancel()
 
 	// Zabezpieczenie przed nagłym zamykaniem połączenia
@@ -111,32 +219,46 @@ func (qn *QuicNetwork) Stop() {
 	if conn != nil {
 		// Krótkie opóźnienie, aby dać czas na zakończenie bieżących operacji
 		time.Sleep(100 * time.Millisecond)
-		conn.CloseWithError(0, "closing")
+		conn.CloseWithError(closeCodeShutdown, "leaving")
 	}
 }
 
-// SendMessage encrypts and sends a chat message to the peer
+// SendMessage encrypts a chat message for each connected peer and sends it;
+// when only some of them got it, it fails with a *FanoutError (fanout.go)
 func (qn *QuicNetwork) SendMessage(ctx context.Context, msg string) error {
-	// Tworzymy identyfikator wiadomości
-	messageID := fmt.Sprintf("%s-%d", qn.localPeerID, time.Now().UnixNano())
+	return qn.sendMessage(ctx, crypto.NewMessageID(), msg, true)
+}
 
+// SendMessageWithID is SendMessage under a given message ID. A caller that
+// sends a message again after an error passes the same ID each time, so a
+// copy that did arrive is dropped (dedup.go).
+func (qn *QuicNetwork) SendMessageWithID(ctx context.Context, messageID, msg string) error {
+	return qn.sendMessage(ctx, messageID, msg, true)
+}
+
+// SendControl sends a control message over the encrypted channel. Unlike a
+// chat message it is neither echoed locally nor observed, and it fails when
+// no peer is connected.
+func (qn *QuicNetwork) SendControl(ctx context.Context, msg string) error {
+	return qn.sendMessage(ctx, crypto.NewMessageID(), msg, false)
+}
+
+func (qn *QuicNetwork) sendMessage(ctx context.Context, messageID, msg string, chat bool) error {
 	// Sprawdź połączenie - powinno być weryfikowane zarówno dla twórcy jak i dla dołączającego
 	qn.connMutex.RLock()
 	conn := qn.conn
 	qn.connMutex.RUnlock()
 
-	// Sprawdź czy mamy połączonych użytkowników
-	qn.peersMutex.RLock()
-	connectedPeers := len(qn.connectedIDs)
-	var peerID string
-	if connectedPeers > 0 {
-		peerID = qn.connectedIDs[0] // Zapisz ID peer'a do użycia później
-	}
-	qn.peersMutex.RUnlock()
+	// Sprawdź czy mamy połączonych użytkowników; wiadomość dostaje każdy z nich
+	recipients := qn.connectedPeerIDs()
+	connectedPeers := len(recipients)
 
 	// Przypadek 1: Nie mamy aktywnego połączenia lub jesteśmy twórcą pokoju bez połączonych użytkowników
 	// W tym przypadku tylko zapisujemy wiadomość lokalnie
 	if conn == nil || (qn.isListener && connectedPeers == 0) {
+		if !chat {
+			return ErrNotConnected
+		}
 		// Dodaj wiadomość do lokalnego kanału tylko w tych przypadkach
 		localMessage := &crypto.MessagePayload{
 			SenderID:  qn.localPeerID,
@@ -156,35 +278,56 @@ func (qn *QuicNetwork) SendMessage(ctx context.Context, msg string) error {
 	}
 
 	// Jeśli dotarliśmy tutaj, mamy aktywne połączenie i możemy wysłać wiadomość
-	if peerID == "" {
+	if connectedPeers == 0 {
 		// Mamy połączenie, ale nie znamy ID peer'a - to nie powinno się zdarzyć
 		return fmt.Errorf("no verified peer connected")
 	}
 
-	encMsg, err := qn.pqCrypto.EncryptMessageForPeer(msg, peerID, qn.localPeerID)
-	if err != nil {
-		return err
-	}
-	msgBytes, err := crypto.SerializeEncryptedMessage(encMsg)
-	if err != nil {
+	// wait for a key rotation in progress; the message then goes out under the new key
+	qn.rotationMutex.RLock()
+	defer qn.rotationMutex.RUnlock()
+
+	sent := time.Now()
+	err := qn.fanOut(msg, messageID, recipients)
+	if _, partly := PartlyDelivered(err); err != nil && !partly {
 		return err
 	}
-
-	wrapper := message{
-		Type:      "message",
-		Payload:   hex.EncodeToString(msgBytes),
-		Timestamp: time.Now().Unix(),
-		SenderID:  qn.localPeerID,
+	if chat {
+		qn.observeMessage(&crypto.MessagePayload{
+			Timestamp: sent,
+			Message:   msg,
+			SenderID:  qn.localPeerID,
+			MessageID: messageID,
+		}, true)
 	}
-	logger.L().Debug("Sending message", "peer", peerID[:8], "size", len(msgBytes))
-	return qn.writeWrapper(wrapper)
+	return err
 }
 
 func (qn *QuicNetwork) GetIncomingMessages() <-chan *crypto.MessagePayload {
 	return qn.incomingMessages
 }
 
-func (qn *QuicNetwork) GetConnectedPeers() []string {
+// Peers returns the connected peers with their connection details
+func (qn *QuicNetwork) Peers() []PeerInfo {
+	_, remote := qn.Addrs()
+	lastHeard := qn.LastHeard()
+	qn.peersMutex.RLock()
+	defer qn.peersMutex.RUnlock()
+	peers := make([]PeerInfo, 0, len(qn.connectedIDs))
+	for _, id := range qn.connectedIDs {
+		peers = append(peers, PeerInfo{
+			ID:           id,
+			Address:      remote,
+			ConnectedAt:  qn.connectedSince[id],
+			LastActivity: lastHeard,
+			Offline:      qn.offline.Load(),
+		})
+	}
+	return peers
+}
+
+// connectedPeerIDs returns the IDs of the connected peers
+func (qn *QuicNetwork) connectedPeerIDs() []string {
 	qn.peersMutex.RLock()
 	defer qn.peersMutex.RUnlock()
 	return append([]string(nil), qn.connectedIDs...)
@@ -203,19 +346,13 @@ func (qn *QuicNetwork) sendError(err error) {
 }
 
 func (qn *QuicNetwork) listenQUIC() error {
-	tlsConfig, err := generateTLSConfig()
+	tlsConfig, err := qn.tlsConfig()
 	if err != nil {
 		return fmt.Errorf("failed to generate TLS config: %w", err)
 	}
 
-	// compute fingerprint of our first certificate
-	if len(tlsConfig.Certificates) > 0 && len(tlsConfig.Certificates[0].Certificate) > 0 {
-		fp := sha256.Sum256(tlsConfig.Certificates[0].Certificate[0])
-		qn.localCertFingerprint = hex.EncodeToString(fp[:])
-	}
-
 	addr := fmt.Sprintf("0.0.0.0:%d", qn.listenPort)
-	listener, err := quic.ListenAddr(addr, tlsConfig, nil)
+	listener, err := qn.listen(addr, tlsConfig)
 	if err != nil {
 		return fmt.Errorf("failed to listen on %s: %w", addr, err)
 	}
@@ -226,60 +363,81 @@ func (qn *QuicNetwork) listenQUIC() error {
 	return nil
 }
 
-func (qn *QuicNetwork) acceptLoop(listener *quic.Listener) {
+func (qn *QuicNetwork) acceptLoop(listener listener) {
+	defer crash.Recover("network.acceptLoop")
 	defer listener.Close()
-	// accept one connection for our 1-to-1 chat
-	conn, err := listener.Accept(qn.ctx)
-	if err != nil {
-		logger.L().Error("Accept error", "err", err)
-		qn.sendError(err)
-		return
-	}
+	for {
+		conn, err := listener.Accept(qn.ctx)
+		if err != nil {
+			if qn.ctx.Err() == nil {
+				logger.L().Error("Accept error", "err", err)
+				qn.sendError(&TransportError{Op: "accept", Err: err})
+			}
+			return
+		}
+		accepted := time.Now()
+		// nothing is handled from 0-RTT data, which may be a replay (resume.go)
+		if !awaitHandshake(qn.ctx, conn) {
+			logger.L().Debug("Handshake not completed", "remote", conn.RemoteAddr().String())
+			continue
+		}
 
-	qn.connMutex.Lock()
-	qn.conn = conn
-	qn.connMutex.Unlock()
-	logger.L().Info("Peer connected", "remote", conn.RemoteAddr().String())
+		// 1-to-1 chat: another connection is only taken once the current one
+		// is gone, e.g. when the peer reconnects after a network hiccup
+		qn.connMutex.Lock()
+		if qn.conn != nil && qn.conn.Context().Err() == nil {
+			qn.connMutex.Unlock()
+			logger.L().Info("Refusing second connection", "remote", conn.RemoteAddr().String())
+			conn.CloseWithError(closeCodeRoomFull, ErrRoomFull.Error())
+			continue
+		}
+		qn.conn = conn
+		qn.connMutex.Unlock()
+		qn.connectStarted.Store(accepted.UnixNano())
+		logger.L().Info("Peer connected", "remote", conn.RemoteAddr().String(), "resumed", resumed(conn))
+
+		// listener starts the session (access key handshake, then
+		// announcement) after getting a connection
+		if err := qn.startSession(conn); err != nil {
+			logger.L().Error("Peer announcement send failed", "err", err)
+		}
 
-	// joiner knows the remote address and can send announcement immediately
-	// listener should send announcement after getting a connection
-	if err := qn.sendPeerAnnouncement(); err != nil {
-		logger.L().Error("Peer announcement send failed", "err", err)
+		go qn.readLoop(conn)
 	}
-
-	qn.readLoop(conn)
 }
 
-func (qn *QuicNetwork) dialQUIC() error {
-	if qn.remoteAddr == "" {
+func (qn *QuicNetwork) dialQUIC(ctx context.Context) error {
+	remoteAddr := qn.remoteAddress()
+	if remoteAddr == "" {
 		return fmt.Errorf("remote address required for joiner")
 	}
 
-	tlsCfg, err := generateTLSConfig()
+	tlsCfg, err := qn.tlsConfig()
 	if err != nil {
 		return err
 	}
 	tlsCfg.InsecureSkipVerify = true // still skip PKI validation
 
-	if len(tlsCfg.Certificates) > 0 && len(tlsCfg.Certificates[0].Certificate) > 0 {
-		fp := sha256.Sum256(tlsCfg.Certificates[0].Certificate[0])
-		qn.localCertFingerprint = hex.EncodeToString(fp[:])
+	qn.connectStarted.Store(time.Now().UnixNano())
+	conn, err := qn.dial(ctx, remoteAddr, tlsCfg)
+	if err == nil && !awaitHandshake(ctx, conn) {
+		err = fmt.Errorf("handshake not completed")
+		conn.CloseWithError(closeCodeNone, "")
 	}
-
-	conn, err := quic.DialAddr(qn.ctx, qn.remoteAddr, tlsCfg, nil)
 	if err != nil {
-		qn.sendError(err)
-		return fmt.Errorf("failed to dial %s: %w", qn.remoteAddr, err)
+		diagnostics.RecordHandshakeFailure(diagnostics.HandshakeConnectionFailed)
+		qn.sendError(&TransportError{Op: "dial " + remoteAddr, Err: err})
+		return fmt.Errorf("failed to dial %s: %w", remoteAddr, err)
 	}
 
 	qn.connMutex.Lock()
 	qn.conn = conn
 	qn.connMutex.Unlock()
 
-	logger.L().Info("Dialed peer", "remote", conn.RemoteAddr().String())
+	logger.L().Info("Dialed peer", "remote", conn.RemoteAddr().String(), "resumed", resumed(conn))
 
-	// joiner knows the remote address and can send announcement immediately
-	if err := qn.sendPeerAnnouncement(); err != nil {
+	// joiner knows the remote address and can start the session immediately
+	if err := qn.startSession(conn); err != nil {
 		return err
 	}
 
@@ -288,77 +446,8 @@ func (qn *QuicNetwork) dialQUIC() error {
 	return nil
 }
 
-func (qn *QuicNetwork) readLoop(conn quic.Connection) {
-	for {
-		stream, err := conn.AcceptStream(qn.ctx)
-		if err != nil {
-			// Kontekst został zamknięty lub połączenie zostało przerwane
-			logger.L().Debug("Connection stream error", "err", err)
-
-			// Jeśli to nie jest błąd przerwania kontekstu, zgłoś błąd
-			if qn.ctx.Err() == nil {
-				qn.sendError(fmt.Errorf("błąd strumienia połączenia: %w", err))
-			}
-
-			// Bezpiecznie zakończ połączenie
-			go qn.Stop() // Uruchom w goroutine, aby uniknąć zakleszczenia
-			return
-		}
-
-		// Obsługa strumienia w osobnej goroutine
-		go func(s quic.Stream) {
-			defer func() {
-				// Obsługa paniki w handleStream, aby nie zakończyć głównej pętli readLoop
-				if r := recover(); r != nil {
-					logger.L().Error("Panika w obsłudze strumienia", "recover", r)
-				}
-			}()
-			qn.handleStream(s)
-		}(stream)
-	}
-}
-
-func (qn *QuicNetwork) handleStream(stream quic.Stream) {
-	defer stream.Close()
-	decoder := json.NewDecoder(stream)
-	var wrapper message
-	if err := decoder.Decode(&wrapper); err != nil {
-		logger.L().Warn("Invalid message", "err", err)
-		return
-	}
-	logger.L().Debug("Received wrapper", "type", wrapper.Type, "from", wrapper.SenderID[:8], "size", len(wrapper.Payload))
-	qn.handleWrapper(wrapper)
-}
-
 func (qn *QuicNetwork) writeWrapper(w message) error {
-	qn.connMutex.RLock()
-	conn := qn.conn
-	qn.connMutex.RUnlock()
-
-	if conn == nil {
-		return fmt.Errorf("connection closed")
-	}
-
-	stream, err := conn.OpenStreamSync(qn.ctx)
-	if err != nil {
-		qn.sendError(err)
-		return fmt.Errorf("failed to open stream: %w", err)
-	}
-	defer stream.Close()
-
-	encoder := json.NewEncoder(stream)
-	return encoder.Encode(w)
-}
-
-func (qn *QuicNetwork) handleWrapper(w message) {
-	switch w.Type {
-	case "announcement":
-		qn.handlePeerAnnouncement(w)
-	case "keyexchange":
-		qn.handleKeyExchange(w)
-	case "message":
-		qn.handleEncryptedChat(w)
-	}
+	return qn.writeWrapperContext(qn.ctx, w)
 }
 
 func (qn *QuicNetwork) handlePeerAnnouncement(w message) {
@@ -370,6 +459,7 @@ func (qn *QuicNetwork) handlePeerAnnouncement(w message) {
 	announcement, err := crypto.DeserializePeerAnnouncement(bytesPayload)
 	if err != nil {
 		logger.L().Warn("Błąd deserializacji ogłoszenia", "err", err)
+		diagnostics.RecordHandshakeFailure(diagnostics.HandshakeBadAnnouncement)
 		return
 	}
 
@@ -388,13 +478,14 @@ func (qn *QuicNetwork) handlePeerAnnouncement(w message) {
 			// Jako słuchacz (host) trzymamy się naszego ID
 			logger.L().Warn("Odrzucenie ogłoszenia peer z nieprawidłowym ID pokoju",
 				"expected", qn.roomID, "got", w.RoomID)
+			diagnostics.RecordHandshakeFailure(diagnostics.HandshakeRoomMismatch)
 
 			// Zamiast natychmiast wysyłać błąd, który może przerwać połączenie,
 			// utrzymaj połączenie, ale ignoruj wiadomości
 			go func() {
 				// Oczekujemy chwilę, aby klient miał czas odebrać potwierdzenie
 				time.Sleep(500 * time.Millisecond)
-				qn.sendError(fmt.Errorf("niezgodne ID pokoju: %s", w.RoomID))
+				qn.sendError(&RoomMismatch{Expected: qn.roomID, Got: w.RoomID})
 			}()
 			return
 		}
@@ -405,31 +496,136 @@ func (qn *QuicNetwork) handlePeerAnnouncement(w message) {
 	roomAccessKey := qn.roomAccessKey
 	qn.keyExchangeMutex.RUnlock()
 
-	if roomAccessKey != "" && w.AccessKey != roomAccessKey {
+	// klucz dostępu sprawdza wcześniej uzgodnienie PAKE (pake.go); bez niego ogłoszenie jest odrzucane
+	if roomAccessKey != "" && !qn.accessConfirmed() {
 		logger.L().Warn("Odrzucenie ogłoszenia peer z nieprawidłowym kluczem dostępu",
-			"room_id", qn.roomID, "peer", announcement.PeerID[:8])
+			"room_id", qn.roomID, "peer", shortID(announcement.PeerID))
+		diagnostics.RecordHandshakeFailure(diagnostics.HandshakeBadAccessKey)
 
 		// Tak samo jak powyżej, opóźnij wysłanie błędu
 		go func() {
 			time.Sleep(500 * time.Millisecond)
-			qn.sendError(fmt.Errorf("nieprawidłowy klucz dostępu"))
+			qn.sendError(&AuthError{Err: fmt.Errorf("nieprawidłowy klucz dostępu")})
 		}()
 		return
 	}
 
+	fingerprint, err := qn.pqCrypto.VerifyPeerAnnouncement(announcement)
+	if err != nil {
+		logger.L().Warn("Invalid peer announcement", "err", err)
+		diagnostics.RecordHandshakeFailure(diagnostics.HandshakeBadAnnouncement)
+		return
+	}
+
+	if qn.isBanned(fingerprint) {
+		logger.L().Warn("Refusing banned identity", "peer", shortID(announcement.PeerID), "fingerprint", fingerprint)
+		diagnostics.RecordHandshakeFailure(diagnostics.HandshakeBanned)
+		if conn := qn.currentConn(); conn != nil {
+			conn.CloseWithError(closeCodeBanned, ErrBanned.Error())
+		}
+		return
+	}
+
+	if qn.isQuarantined(announcement.PeerID) {
+		logger.L().Warn("Refusing quarantined peer", "peer", shortID(announcement.PeerID))
+		diagnostics.RecordHandshakeFailure(diagnostics.HandshakeQuarantined)
+		qn.sendError(&AuthError{Err: ErrQuarantined})
+		qn.refuseConnection(ErrQuarantined.Error())
+		return
+	}
+
+	if qn.roomFull(announcement.PeerID) {
+		logger.L().Warn("Refusing peer: room full", "peer", shortID(announcement.PeerID), "max_peers", qn.maxPeers.Load())
+		diagnostics.RecordHandshakeFailure(diagnostics.HandshakeRoomFull)
+		if conn := qn.currentConn(); conn != nil {
+			conn.CloseWithError(closeCodeRoomFull, ErrRoomFull.Error())
+		}
+		return
+	}
+
+	// a connection admitted by membership certificate is bound to the certified identity
+	if cert := qn.sessionMember(); cert != nil && !qn.admittedBy(cert, announcement) {
+		logger.L().Warn("Announcement does not match the membership certificate", "peer", shortID(announcement.PeerID))
+		diagnostics.RecordHandshakeFailure(diagnostics.HandshakeBadMembership)
+		qn.refuseConnection("identity does not match membership certificate")
+		return
+	}
+
+	// the connection's certificate must be the announced one, its key
+	// signed by the announced identity; see quarantine.go for a mismatch
+	if conn := qn.currentConn(); conn != nil {
+		presented := peerCertFingerprint(conn)
+		err := qn.pqCrypto.VerifyTLSKey(announcement, peerCertPublicKey(conn))
+		if err == nil && presented != announcement.TLSCertFingerprint {
+			err = fmt.Errorf("tls fingerprint mismatch")
+		}
+		if err != nil {
+			logger.L().Warn("TLS certificate not bound to the announced identity; possible MITM", "peer", shortID(announcement.PeerID), "err", err)
+			diagnostics.RecordHandshakeFailure(diagnostics.HandshakeTLSMismatch)
+			qn.sendError(&AuthError{Err: fmt.Errorf("tls certificate not bound to identity: %w", err)})
+			keep := qn.certMismatch(CertMismatch{
+				PeerID:      announcement.PeerID,
+				Fingerprint: fingerprint,
+				Announced:   announcement.TLSCertFingerprint,
+				Presented:   presented,
+				Err:         err,
+			})
+			if !keep {
+				conn.CloseWithError(closeCodeProtocol, "tls certificate not bound to identity")
+				return
+			}
+		}
+	}
+
+	// sprawdź tożsamość peer'a zanim zapamiętamy jego klucze
+	qn.keyExchangeMutex.RLock()
+	verifier := qn.peerVerifier
+	certVerifier := qn.certVerifier
+	qn.keyExchangeMutex.RUnlock()
+	if verifier != nil {
+		if err := verifier(announcement.PeerID, fingerprint); err != nil {
+			logger.L().Warn("Peer identity rejected", "peer", shortID(announcement.PeerID), "err", err)
+			diagnostics.RecordHandshakeFailure(diagnostics.HandshakeFingerprintChanged)
+			qn.sendError(&AuthError{Err: err})
+			qn.refuseConnection("peer identity rejected")
+			return
+		}
+	}
+	// and that the identity still uses the transport certificate it did
+	if certVerifier != nil && announcement.TLSCertFingerprint != "" {
+		if err := certVerifier(announcement.PeerID, fingerprint, announcement.TLSCertFingerprint); err != nil {
+			logger.L().Warn("Peer TLS certificate rejected", "peer", shortID(announcement.PeerID), "err", err)
+			diagnostics.RecordHandshakeFailure(diagnostics.HandshakeFingerprintChanged)
+			qn.sendError(&AuthError{Err: err})
+			qn.refuseConnection("peer certificate rejected")
+			return
+		}
+	}
+
 	if err := qn.pqCrypto.ProcessPeerAnnouncement(announcement); err != nil {
 		logger.L().Warn("Invalid peer announcement", "err", err)
+		diagnostics.RecordHandshakeFailure(diagnostics.HandshakeBadAnnouncement)
+		qn.sendError(&ProtocolError{Err: fmt.Errorf("invalid announcement: %w", err)})
+		if conn := qn.currentConn(); conn != nil {
+			conn.CloseWithError(closeCodeProtocol, "invalid announcement")
+		}
 		return
 	}
 
 	logger.L().Info("Peer announcement accepted",
 		"room_id", qn.roomID,
-		"peer", announcement.PeerID[:8],
-		"access_key_ok", roomAccessKey == "" || w.AccessKey == roomAccessKey)
+		"peer", shortID(announcement.PeerID),
+		"access_key_checked", roomAccessKey != "")
 
 	qn.peersMutex.Lock()
+	if _, ok := qn.connectedSince[announcement.PeerID]; !ok {
+		// a connection carries one peer
+		clear(qn.connectedSince)
+		qn.connectedSince[announcement.PeerID] = time.Now()
+	}
 	qn.connectedIDs = []string{announcement.PeerID}
 	qn.peersMutex.Unlock()
+	qn.notifyPeer(PeerEvent{PeerID: announcement.PeerID, Kind: PeerConnected, Nickname: announcement.Nickname})
 
 	if !qn.announcementSent {
 		if err := qn.sendPeerAnnouncement(); err == nil {
@@ -453,17 +649,17 @@ func (qn *QuicNetwork) handlePeerAnnouncement(w message) {
 		}
 	}
 
-	// verify remote certificate hash matches announced fingerprint
-	tlsState := qn.conn.ConnectionState().TLS
-	if len(tlsState.PeerCertificates) > 0 {
-		hash := sha256.Sum256(tlsState.PeerCertificates[0].Raw)
-		remoteFp := hex.EncodeToString(hash[:])
-		if remoteFp != announcement.TLSCertFingerprint {
-			logger.L().Warn("TLS certificate fingerprint mismatch; possible MITM")
-			qn.sendError(fmt.Errorf("tls fingerprint mismatch"))
-			return
+	// the host tells every guest about the room, e.g. that it is archived
+	if qn.isListener {
+		if err := qn.sendRoomMetadata(); err != nil {
+			logger.L().Warn("Room metadata send failed", "err", err)
+		}
+		// and certifies its membership for later connections
+		if roomAccessKey != "" {
+			qn.issueMembership(announcement.PeerID)
 		}
 	}
+
 }
 
 func (qn *QuicNetwork) handleKeyExchange(w message) {
@@ -473,13 +669,23 @@ func (qn *QuicNetwork) handleKeyExchange(w message) {
 	}
 	keyEx, err := crypto.DeserializeKeyExchange(bytesPayload)
 	if err != nil {
+		diagnostics.RecordHandshakeFailure(diagnostics.HandshakeBadKeyExchange)
 		return
 	}
 	if err := qn.pqCrypto.ProcessKeyExchange(keyEx); err != nil {
 		logger.L().Warn("Invalid key exchange", "err", err)
+		diagnostics.RecordHandshakeFailure(diagnostics.HandshakeBadKeyExchange)
 		return
 	}
-	logger.L().Info("Secure channel established", "peer", keyEx.SenderID[:8])
+	diagnostics.Inc(diagnostics.HandshakeSuccess)
+	if started := qn.connectStarted.Swap(0); started != 0 {
+		diagnostics.ObserveConnect(time.Since(time.Unix(0, started)))
+	}
+	logger.L().Info("Secure channel established", "peer", shortID(keyEx.SenderID))
+	qn.notifyPeer(PeerEvent{PeerID: keyEx.SenderID, Kind: PeerVerified})
+
+	// messages that raced ahead of this key exchange can be decrypted now
+	qn.drainInflight()
 }
 
 func (qn *QuicNetwork) handleEncryptedChat(w message) {
@@ -493,9 +699,18 @@ func (qn *QuicNetwork) handleEncryptedChat(w message) {
 		logger.L().Warn("Message deserialization error", "err", err)
 		return
 	}
-	payload, err := qn.pqCrypto.DecryptMessageFromPeer(encMsg)
-	if err != nil {
-		logger.L().Warn("Message decryption error", "err", err)
+	// every recipient gets an envelope of its own (fanout.go)
+	if encMsg.RecipientID != "" && encMsg.RecipientID != qn.localPeerID {
+		logger.L().Debug("Message for another peer; skipped", "recipient", shortID(encMsg.RecipientID))
+		return
+	}
+	qn.receiveEncrypted(encMsg)
+}
+
+// passLocked passes a decrypted message on, once it is its turn
+// (reorder.go); inflightMutex must be held
+func (qn *QuicNetwork) passLocked(payload *crypto.MessagePayload) {
+	if qn.duplicateLocked(payload) {
 		return
 	}
 
@@ -508,6 +723,12 @@ func (qn *QuicNetwork) handleEncryptedChat(w message) {
 		return
 	}
 
+	if qn.handleControl(payload) {
+		return
+	}
+
+	qn.observeMessage(payload, false)
+
 	// W przeciwnym razie przekaż wiadomość do kanału
 	select {
 	case qn.incomingMessages <- payload:
@@ -517,34 +738,24 @@ func (qn *QuicNetwork) handleEncryptedChat(w message) {
 }
 
 func (qn *QuicNetwork) sendPeerAnnouncement() error {
-	announcement, err := qn.pqCrypto.CreatePeerAnnouncement(qn.localPeerID, qn.localCertFingerprint)
+	qn.keyExchangeMutex.RLock()
+	nickname := qn.localNickname
+	qn.keyExchangeMutex.RUnlock()
+	announcement, err := qn.pqCrypto.CreatePeerAnnouncement(qn.localPeerID, qn.localCertFingerprint, qn.localCertPublicKey, nickname)
 	if err != nil {
 		return err
 	}
-	bytesPayload, err := crypto.SerializePeerAnnouncement(announcement)
+	bytesPayload, err := wire.Marshal(announcement, qn.format())
 	if err != nil {
 		return err
 	}
 
-	// Pobierz informacje o kluczu dostępu do pokoju
-	var accessKey string
-	if qn.roomID != "" {
-		// Użyj klucza dostępu z naszej struktury
-		qn.keyExchangeMutex.RLock()
-		accessKey = qn.roomAccessKey
-		qn.keyExchangeMutex.RUnlock()
-		logger.L().Debug("Dodanie klucza dostępu do ogłoszenia",
-			"room_id", qn.roomID,
-			"has_key", accessKey != "")
-	}
-
 	wrapper := message{
 		Type:      "announcement",
 		Payload:   hex.EncodeToString(bytesPayload),
 		Timestamp: time.Now().Unix(),
 		SenderID:  qn.localPeerID,
 		RoomID:    qn.roomID, // Dodaj ID pokoju do ogłoszenia
-		AccessKey: accessKey, // Dodaj klucz dostępu (jeśli dostępny)
 	}
 
 	logger.L().Debug("Wysyłanie ogłoszenia peer", "room_id", qn.roomID)
@@ -561,7 +772,7 @@ func (qn *QuicNetwork) sendKeyExchange(peerID string) error {
 	if err != nil {
 		return err
 	}
-	bytesPayload, err := crypto.SerializeKeyExchange(keyEx)
+	bytesPayload, err := wire.Marshal(keyEx, qn.format())
 	if err != nil {
 		return err
 	}
@@ -575,6 +786,10 @@ func (qn *QuicNetwork) sendKeyExchange(peerID string) error {
 }
 
 func (qn *QuicNetwork) ForceKeyRotation() (bool, error) {
+	// senders wait until the new key exchange is on the wire
+	qn.rotationMutex.Lock()
+	defer qn.rotationMutex.Unlock()
+
 	rotated, err := qn.pqCrypto.RotateKeys()
 	if err != nil || !rotated {
 		return rotated, err
@@ -624,30 +839,41 @@ func (qn *QuicNetwork) SetRoomAccessKey(accessKey string) {
 	qn.keyExchangeMutex.Unlock()
 }
 
-// generateTLSConfig sets up a ephemeral, self-signed TLS config for the QUIC listener
-func generateTLSConfig() (*tls.Config, error) {
-	key, err := rsa.GenerateKey(rand.Reader, 2048)
-	if err != nil {
-		return nil, err
-	}
-	template := x509.Certificate{
-		SerialNumber: big.NewInt(1),
-		Subject: pkix.Name{
-			Organization: []string{"ExecP2P"},
-		},
-		NotBefore: time.Now(),
-		NotAfter:  time.Now().Add(time.Hour * 24 * 365),
+// SetLocalNickname sets the nickname sent in our announcements. Peers
+// already connected learn of a change from a chat message instead.
+func (qn *QuicNetwork) SetLocalNickname(nickname string) {
+	qn.keyExchangeMutex.Lock()
+	qn.localNickname = nickname
+	qn.keyExchangeMutex.Unlock()
+}
 
-		KeyUsage:              x509.KeyUsageKeyEncipherment | x509.KeyUsageDigitalSignature,
-		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
-		BasicConstraintsValid: true,
-	}
-	certDER, err := x509.CreateCertificate(rand.Reader, &template, &template, &key.PublicKey, key)
-	if err != nil {
-		return nil, err
+// SetPeerVerifier installs a check run on every peer announcement
+func (qn *QuicNetwork) SetPeerVerifier(verifier PeerVerifier) {
+	qn.keyExchangeMutex.Lock()
+	qn.peerVerifier = verifier
+	qn.keyExchangeMutex.Unlock()
+}
+
+// SetSenderPolicy installs a check run before every incoming message is
+// decrypted
+func (qn *QuicNetwork) SetSenderPolicy(policy SenderPolicy) {
+	qn.keyExchangeMutex.Lock()
+	qn.senderPolicy = policy
+	qn.keyExchangeMutex.Unlock()
+}
+
+// refuseConnection closes the current connection with a reason the peer can see
+func (qn *QuicNetwork) refuseConnection(reason string) {
+	qn.connMutex.RLock()
+	conn := qn.conn
+	qn.connMutex.RUnlock()
+	if conn != nil {
+		conn.CloseWithError(closeCodeRefused, reason)
 	}
-	return &tls.Config{
-		Certificates: []tls.Certificate{{Certificate: [][]byte{certDER}, PrivateKey: key}},
-		NextProtos:   []string{"execp2p-chat"},
-	}, nil
+}
+
+// Disconnect closes the connection to the current peer. The room stays open:
+// the peer may reconnect if it still passes the access key handshake.
+func (qn *QuicNetwork) Disconnect(reason string) {
+	qn.refuseConnection(reason)
 }
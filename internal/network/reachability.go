@@ -0,0 +1,216 @@
+package network
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"time"
+
+	"execp2p/internal/diagnostics"
+	"execp2p/internal/logger"
+
+	"github.com/quic-go/quic-go"
+)
+
+// ProbeTimeout bounds a single reachability probe
+const ProbeTimeout = 2 * time.Second
+
+var (
+	// ErrNotConnected means there is no QUIC connection to probe
+	ErrNotConnected = errors.New("no connection to peer")
+	// ErrProbeTimeout means the peer did not answer a probe in time
+	ErrProbeTimeout = errors.New("peer did not answer the probe")
+	// ErrCannotReconnect means only the peer can re-establish the connection
+	ErrCannotReconnect = errors.New("the room host waits for the peer to reconnect")
+)
+
+// Probe sends a transport ping and waits for the peer's pong. It proves a
+// working round trip, unlike the connection state which lags behind a
+// silently dropped path.
+func (qn *QuicNetwork) Probe(ctx context.Context) (time.Duration, error) {
+	if qn.currentConn() == nil {
+		return 0, ErrNotConnected
+	}
+
+	nonce := make([]byte, 8)
+	if _, err := rand.Read(nonce); err != nil {
+		return 0, err
+	}
+	id := hex.EncodeToString(nonce)
+
+	pong := make(chan struct{}, 1)
+	qn.probeMutex.Lock()
+	qn.probes[id] = pong
+	qn.probeMutex.Unlock()
+	defer func() {
+		qn.probeMutex.Lock()
+		delete(qn.probes, id)
+		qn.probeMutex.Unlock()
+	}()
+
+	ctx, cancel := context.WithTimeout(ctx, ProbeTimeout)
+	defer cancel()
+
+	start := time.Now()
+	err := qn.writeWrapperContext(ctx, message{
+		Type:      "ping",
+		Payload:   id,
+		Timestamp: start.Unix(),
+		SenderID:  qn.localPeerID,
+	})
+	if err != nil {
+		diagnostics.Inc(diagnostics.ProbeFailed)
+		return 0, fmt.Errorf("probe not sent: %w", err)
+	}
+
+	select {
+	case <-pong:
+		rtt := time.Since(start)
+		logger.L().Debug("Peer answered probe", "rtt", rtt)
+		return rtt, nil
+	case <-ctx.Done():
+		diagnostics.Inc(diagnostics.ProbeFailed)
+		if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+			return 0, ErrProbeTimeout
+		}
+		return 0, ctx.Err()
+	}
+}
+
+// Reconnect dials the host again if the connection was lost. The host keeps
+// listening and takes the peer back; only the joining side can redial.
+func (qn *QuicNetwork) Reconnect(ctx context.Context) error {
+	if qn.isListener {
+		return ErrCannotReconnect
+	}
+	if qn.removed.Load() {
+		return ErrRemoved
+	}
+	if qn.ctx.Err() != nil {
+		return fmt.Errorf("network stopped: %w", qn.ctx.Err())
+	}
+
+	if conn := qn.currentConn(); conn != nil {
+		// a connection that still looks alive but doesn't answer is replaced
+		conn.CloseWithError(0, "reconnecting")
+		qn.dropConnection(conn, LeaveReasonDisconnected)
+	}
+
+	diagnostics.Inc(diagnostics.ReconnectAttempt)
+	logger.L().Info("Reconnecting to peer", "addr", qn.remoteAddress())
+	if err := qn.dialQUIC(ctx); err != nil {
+		return err
+	}
+	diagnostics.Inc(diagnostics.ReconnectSuccess)
+	return nil
+}
+
+// RedialAt reconnects to the host at addr, where it may be after a restart
+// (guest); later reconnects go there too
+func (qn *QuicNetwork) RedialAt(ctx context.Context, addr string) error {
+	qn.connMutex.Lock()
+	qn.remoteAddr = addr
+	qn.connMutex.Unlock()
+	return qn.Reconnect(ctx)
+}
+
+// remoteAddress returns where the host is dialed (guest)
+func (qn *QuicNetwork) remoteAddress() string {
+	qn.connMutex.RLock()
+	defer qn.connMutex.RUnlock()
+	return qn.remoteAddr
+}
+
+// CheckReachable probes the peer and, if it doesn't answer, reconnects once
+// and probes again
+func (qn *QuicNetwork) CheckReachable(ctx context.Context) error {
+	_, err := qn.Probe(ctx)
+	if err == nil {
+		return nil
+	}
+	logger.L().Info("Peer unreachable; trying to reconnect", "err", err)
+
+	if rerr := qn.Reconnect(ctx); rerr != nil {
+		return fmt.Errorf("%w; reconnect failed: %v", err, rerr)
+	}
+	_, err = qn.Probe(ctx)
+	return err
+}
+
+// LastHeard returns when anything was last received from the peer
+func (qn *QuicNetwork) LastHeard() time.Time {
+	nanos := qn.lastHeard.Load()
+	if nanos == 0 {
+		return time.Time{}
+	}
+	return time.Unix(0, nanos)
+}
+
+// Addrs returns the local and remote address of the connection, empty
+// when there is none
+func (qn *QuicNetwork) Addrs() (local, remote string) {
+	conn := qn.currentConn()
+	if conn == nil {
+		return "", ""
+	}
+	return conn.LocalAddr().String(), conn.RemoteAddr().String()
+}
+
+func (qn *QuicNetwork) currentConn() quic.Connection {
+	qn.connMutex.RLock()
+	defer qn.connMutex.RUnlock()
+	return qn.conn
+}
+
+// dropConnection forgets conn (if it is still the current one) and its peer
+// without stopping the network, so the peer can come back
+func (qn *QuicNetwork) dropConnection(conn quic.Connection, reason string) {
+	qn.connMutex.Lock()
+	if qn.conn != conn {
+		qn.connMutex.Unlock()
+		return
+	}
+	qn.conn = nil
+	qn.connMutex.Unlock()
+
+	qn.peersMutex.Lock()
+	departed := qn.connectedIDs
+	qn.connectedIDs = nil
+	clear(qn.connectedSince)
+	qn.peersMutex.Unlock()
+	qn.offline.Store(false)
+	qn.dropChunks()
+	for _, id := range departed {
+		qn.notifyPeer(PeerEvent{PeerID: id, Kind: PeerDisconnected, Reason: reason})
+	}
+
+	// whoever was on the connection has to run a full handshake to come back
+	qn.RekeyAfterLeave(departed, reason)
+}
+
+func (qn *QuicNetwork) handlePing(w message) {
+	err := qn.writeWrapper(message{
+		Type:      "pong",
+		Payload:   w.Payload,
+		Timestamp: time.Now().Unix(),
+		SenderID:  qn.localPeerID,
+	})
+	if err != nil {
+		logger.L().Debug("Pong not sent", "err", err)
+	}
+}
+
+func (qn *QuicNetwork) handlePong(w message) {
+	qn.probeMutex.Lock()
+	pong, ok := qn.probes[w.Payload]
+	qn.probeMutex.Unlock()
+	if !ok {
+		return
+	}
+	select {
+	case pong <- struct{}{}:
+	default:
+	}
+}
@@ -0,0 +1,112 @@
+package network
+
+import (
+	"time"
+
+	"execp2p/internal/diagnostics"
+	"execp2p/internal/logger"
+)
+
+// Rekey when a member leaves.
+//
+// When a peer disconnects (or is removed from the room) its shared secrets
+// are wiped, our ephemeral keys are replaced and every remaining peer gets a
+// fresh key exchange. The departed peer can't decrypt anything sent after
+// that, and coming back takes a full handshake. Each such rekey starts a new
+// key epoch, reported to the RekeyHandler.
+
+// RekeyEvent documents a key epoch change
+type RekeyEvent struct {
+	RoomID    string
+	Epoch     uint64
+	Reason    string
+	Departed  []string
+	Remaining int
+	At        time.Time
+}
+
+// RekeyHandler is told about every key epoch change
+type RekeyHandler func(RekeyEvent)
+
+// SetRekeyHandler installs the callback for key epoch changes
+func (qn *QuicNetwork) SetRekeyHandler(handler RekeyHandler) {
+	qn.keyExchangeMutex.Lock()
+	qn.rekeyHandler = handler
+	qn.keyExchangeMutex.Unlock()
+}
+
+// KeyEpoch returns the number of rekeys after departures so far
+func (qn *QuicNetwork) KeyEpoch() uint64 {
+	return qn.keyEpoch.Load()
+}
+
+// RekeyAfterLeave ends the sessions of peers that left and rekeys the ones
+// that remain. Peers that are connected again by now are left alone.
+func (qn *QuicNetwork) RekeyAfterLeave(departed []string, reason string) {
+	if qn.ctx.Err() != nil {
+		// shutting down, nothing left to protect
+		return
+	}
+
+	qn.rotationMutex.Lock()
+	qn.peersMutex.RLock()
+	connected := make(map[string]bool, len(qn.connectedIDs))
+	for _, id := range qn.connectedIDs {
+		connected[id] = true
+	}
+	qn.peersMutex.RUnlock()
+
+	var gone []string
+	for _, id := range departed {
+		if connected[id] {
+			continue
+		}
+		if qn.pqCrypto.EndPeerSession(id) {
+			gone = append(gone, id)
+		}
+		qn.keyExchangeMutex.Lock()
+		qn.keyExchangeSent[id] = false
+		qn.keyExchangeMutex.Unlock()
+	}
+	if len(gone) == 0 {
+		qn.rotationMutex.Unlock()
+		return
+	}
+
+	if err := qn.pqCrypto.RotateKeysNow(); err != nil {
+		logger.L().Error("Rekey after departure failed", "err", err)
+		diagnostics.Inc(diagnostics.KeyRotationFailed)
+	} else {
+		diagnostics.Inc(diagnostics.KeyRotation)
+	}
+	remaining := make([]string, 0, len(connected))
+	for id := range connected {
+		remaining = append(remaining, id)
+	}
+	for _, id := range remaining {
+		qn.keyExchangeMutex.Lock()
+		qn.keyExchangeSent[id] = true
+		qn.keyExchangeMutex.Unlock()
+		if err := qn.sendKeyExchange(id); err != nil {
+			logger.L().Warn("Rekey of remaining peer failed", "peer", shortID(id), "err", err)
+			qn.keyExchangeMutex.Lock()
+			qn.keyExchangeSent[id] = false
+			qn.keyExchangeMutex.Unlock()
+		}
+	}
+	epoch := qn.keyEpoch.Add(1)
+	qn.rotationMutex.Unlock()
+
+	shortGone := make([]string, len(gone))
+	for i, id := range gone {
+		shortGone[i] = shortID(id)
+	}
+	logger.L().Info("Keys renewed after a peer left", "epoch", epoch, "reason", reason, "departed", shortGone, "remaining", len(remaining))
+
+	qn.keyExchangeMutex.RLock()
+	handler := qn.rekeyHandler
+	qn.keyExchangeMutex.RUnlock()
+	if handler != nil {
+		handler(RekeyEvent{RoomID: qn.roomID, Epoch: epoch, Reason: reason, Departed: gone, Remaining: len(remaining), At: time.Now()})
+	}
+}
@@ -0,0 +1,194 @@
+package network
+
+import (
+	"time"
+
+	"execp2p/internal/crypto"
+	"execp2p/internal/diagnostics"
+	"execp2p/internal/logger"
+)
+
+// Reordering window.
+//
+// Every chat message travels on a QUIC stream of its own, so with retries
+// and reconnects a later message can overtake an earlier one. Senders number
+// their messages (MessagePayload.Sequence); a message that arrives ahead of
+// the next expected one is held until the missing ones arrive, for at most
+// reorderWait or reorderMax held messages. Then the gap is given up on: the
+// held messages are delivered in order and the first one after the gap
+// carries how many are missing (MessagePayload.Gap).
+//
+// A sender counts from 1 again when it reconnects with new keys and stamps
+// each numbering with when it started (MessagePayload.SequenceEpoch). A
+// later epoch resets the sender's counter, so the new numbering is waited
+// for from 1 even if its first message is overtaken; a message of an
+// earlier one is late. Peers that don't send the epoch are taken to have
+// restarted when their seq 1 arrives again.
+
+const (
+	// how long a gap in a sender's numbering is waited for
+	reorderWait = 2 * time.Second
+	// how many messages of a sender may be held meanwhile
+	reorderMax = 32
+)
+
+// heldMessages are the messages of one sender waiting for a gap to close
+type heldMessages struct {
+	msgs map[uint64]*crypto.MessagePayload
+	// when the sender last made progress
+	since time.Time
+	timer *time.Timer
+}
+
+// deliverLocked passes a decrypted message on in its sender's order;
+// inflightMutex must be held
+func (qn *QuicNetwork) deliverLocked(payload *crypto.MessagePayload) {
+	seq := payload.Sequence
+	if seq == 0 {
+		qn.passLocked(payload) // peer doesn't number its messages
+		return
+	}
+
+	sender := payload.SenderID
+	last := qn.lastSequence[sender]
+	// nothing known of the sender's numbering: its first message starts it
+	fresh := last == 0
+	if epoch := payload.SequenceEpoch; epoch != 0 {
+		current := qn.sequenceEpoch[sender]
+		switch {
+		case epoch < current:
+			// from before the sender counted again, e.g. held up by the reconnect
+			qn.lateLocked(payload, last)
+			return
+		case epoch > current:
+			if current != 0 {
+				logger.L().Debug("Message numbering restarted", "peer", shortID(sender), "last", last)
+				qn.flushHeldLocked(sender)
+			}
+			qn.sequenceEpoch[sender] = epoch
+			qn.lastSequence[sender] = 0
+			fresh, last = current == 0 && last == 0, 0
+		}
+	} else if seq == 1 && last != 0 {
+		// the sender started counting again: it reconnected with new keys
+		logger.L().Debug("Message numbering restarted", "peer", shortID(sender), "last", last)
+		qn.flushHeldLocked(sender)
+		fresh, last = true, 0
+	}
+
+	switch {
+	case fresh || seq == last+1:
+		qn.lastSequence[sender] = seq
+		qn.passLocked(payload)
+		qn.releaseHeldLocked(sender)
+	case seq <= last:
+		qn.lateLocked(payload, last)
+	default:
+		qn.holdLocked(payload)
+	}
+}
+
+// lateLocked delivers a message that came later than the window rather
+// than lose it
+func (qn *QuicNetwork) lateLocked(payload *crypto.MessagePayload, last uint64) {
+	logger.L().Warn("Message out of order", "peer", shortID(payload.SenderID), "seq", payload.Sequence, "last", last)
+	diagnostics.Inc(diagnostics.MessageOutOfOrder)
+	qn.passLocked(payload)
+}
+
+// holdLocked keeps a message that arrived ahead of its predecessors
+func (qn *QuicNetwork) holdLocked(payload *crypto.MessagePayload) {
+	sender := payload.SenderID
+	h := qn.held[sender]
+	if h == nil {
+		h = &heldMessages{msgs: make(map[uint64]*crypto.MessagePayload), since: time.Now()}
+		h.timer = time.AfterFunc(reorderWait, func() { qn.gapTimedOut(sender) })
+		qn.held[sender] = h
+	}
+	h.msgs[payload.Sequence] = payload
+	diagnostics.Inc(diagnostics.MessageReordered)
+	logger.L().Debug("Message held for reordering", "peer", shortID(sender), "seq", payload.Sequence, "expected", qn.lastSequence[sender]+1)
+
+	if len(h.msgs) > reorderMax {
+		qn.skipGapLocked(sender)
+	}
+}
+
+// releaseHeldLocked delivers the held messages that follow on from the last
+// one delivered
+func (qn *QuicNetwork) releaseHeldLocked(sender string) {
+	h := qn.held[sender]
+	if h == nil {
+		return
+	}
+	released := false
+	for {
+		next := qn.lastSequence[sender] + 1
+		payload, ok := h.msgs[next]
+		if !ok {
+			break
+		}
+		delete(h.msgs, next)
+		qn.lastSequence[sender] = next
+		qn.passLocked(payload)
+		released = true
+	}
+	if len(h.msgs) == 0 {
+		h.timer.Stop()
+		delete(qn.held, sender)
+		return
+	}
+	if released {
+		// another gap; it gets a full wait of its own
+		h.since = time.Now()
+		h.timer.Reset(reorderWait)
+	}
+}
+
+// skipGapLocked gives up on the missing messages before the first held one
+func (qn *QuicNetwork) skipGapLocked(sender string) {
+	h := qn.held[sender]
+	if h == nil || len(h.msgs) == 0 {
+		return
+	}
+	var first uint64
+	for seq := range h.msgs {
+		if first == 0 || seq < first {
+			first = seq
+		}
+	}
+	last := qn.lastSequence[sender]
+	payload := h.msgs[first]
+	delete(h.msgs, first)
+	payload.Gap = first - last - 1
+	logger.L().Warn("Gap in message sequence", "peer", shortID(sender), "seq", first, "last", last, "missing", payload.Gap)
+	diagnostics.Inc(diagnostics.MessageGap)
+
+	qn.lastSequence[sender] = first
+	qn.passLocked(payload)
+	qn.releaseHeldLocked(sender)
+}
+
+// flushHeldLocked delivers everything held for sender, in order, with the
+// gaps flagged
+func (qn *QuicNetwork) flushHeldLocked(sender string) {
+	for qn.held[sender] != nil {
+		qn.skipGapLocked(sender)
+	}
+}
+
+// gapTimedOut gives up on a gap that didn't close within reorderWait
+func (qn *QuicNetwork) gapTimedOut(sender string) {
+	qn.inflightMutex.Lock()
+	defer qn.inflightMutex.Unlock()
+	h := qn.held[sender]
+	if h == nil {
+		return
+	}
+	if wait := reorderWait - time.Since(h.since); wait > 0 {
+		// the sender made progress since the timer was set
+		h.timer.Reset(wait)
+		return
+	}
+	qn.skipGapLocked(sender)
+}
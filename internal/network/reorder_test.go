@@ -0,0 +1,112 @@
+package network
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"testing"
+
+	"execp2p/internal/crypto"
+)
+
+// reorderPeer returns a network whose delivered messages can be read back
+func reorderPeer(t *testing.T) *QuicNetwork {
+	t.Helper()
+	qn, err := NewQuicNetwork(context.Background(), "me", "room", 0, nil, false, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(qn.cancel)
+	return qn
+}
+
+// receive hands qn the sender's messages as epoch/seq pairs; a pair that
+// comes again is another message, with an ID ending in '
+func receive(qn *QuicNetwork, msgs ...[2]uint64) {
+	qn.inflightMutex.Lock()
+	defer qn.inflightMutex.Unlock()
+	seen := make(map[string]bool)
+	for _, m := range msgs {
+		id := fmt.Sprintf("%d-%d", m[0], m[1])
+		for seen[id] {
+			id += "'"
+		}
+		seen[id] = true
+		qn.deliverLocked(&crypto.MessagePayload{
+			SenderID:      "sender",
+			MessageID:     id,
+			SequenceEpoch: m[0],
+			Sequence:      m[1],
+		})
+	}
+}
+
+// delivered drains what qn passed on, as message IDs, and the gaps flagged
+func delivered(qn *QuicNetwork) (ids []string, gaps uint64) {
+	for {
+		select {
+		case p := <-qn.incomingMessages:
+			ids = append(ids, p.MessageID)
+			gaps += p.Gap
+		default:
+			return ids, gaps
+		}
+	}
+}
+
+func TestReorder(t *testing.T) {
+	tests := []struct {
+		name string
+		msgs [][2]uint64
+		want []string
+	}{
+		{"in order", [][2]uint64{{1, 1}, {1, 2}, {1, 3}}, []string{"1-1", "1-2", "1-3"}},
+		{"overtaken", [][2]uint64{{1, 1}, {1, 3}, {1, 2}}, []string{"1-1", "1-2", "1-3"}},
+		{"joined late", [][2]uint64{{1, 5}, {1, 7}, {1, 6}}, []string{"1-5", "1-6", "1-7"}},
+		{
+			"restart", [][2]uint64{{1, 1}, {1, 2}, {1, 3}, {2, 1}, {2, 2}},
+			[]string{"1-1", "1-2", "1-3", "2-1", "2-2"},
+		},
+		{
+			// the new numbering's 2 overtakes its 1: it waits for 1
+			"restart overtaken", [][2]uint64{{1, 1}, {1, 2}, {1, 3}, {2, 2}, {2, 1}, {2, 3}},
+			[]string{"1-1", "1-2", "1-3", "2-1", "2-2", "2-3"},
+		},
+		{
+			// a message of the old numbering after the new one began is late
+			"old after restart", [][2]uint64{{1, 1}, {2, 1}, {1, 2}, {2, 2}},
+			[]string{"1-1", "2-1", "1-2", "2-2"},
+		},
+		// peers without the epoch restart on seq 1
+		{"restart without epoch", [][2]uint64{{0, 1}, {0, 2}, {0, 1}, {0, 2}}, []string{"0-1", "0-2", "0-1'", "0-2'"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			qn := reorderPeer(t)
+			receive(qn, tt.msgs...)
+			ids, gaps := delivered(qn)
+			if !slices.Equal(ids, tt.want) {
+				t.Errorf("delivered %v, want %v", ids, tt.want)
+			}
+			if gaps != 0 {
+				t.Errorf("%d messages reported missing", gaps)
+			}
+			if h := qn.held["sender"]; h != nil {
+				t.Errorf("%d messages still held", len(h.msgs))
+			}
+		})
+	}
+}
+
+func TestReorderGapOnRestart(t *testing.T) {
+	qn := reorderPeer(t)
+	// 3 of the old numbering never came; the new one flushes what waits for it
+	receive(qn, [2]uint64{1, 1}, [2]uint64{1, 2}, [2]uint64{1, 4}, [2]uint64{2, 1})
+	ids, gaps := delivered(qn)
+	if want := []string{"1-1", "1-2", "1-4", "2-1"}; !slices.Equal(ids, want) {
+		t.Errorf("delivered %v, want %v", ids, want)
+	}
+	if gaps != 1 {
+		t.Errorf("%d messages reported missing, want 1", gaps)
+	}
+}
@@ -0,0 +1,108 @@
+package network
+
+import (
+	"context"
+	"crypto/tls"
+
+	"github.com/quic-go/quic-go"
+)
+
+// Session resumption and 0-RTT.
+//
+// With SetZeroRTT the host accepts 0-RTT and a guest keeps the session
+// tickets it is given, so reconnecting to a host it has met resumes the TLS
+// session instead of exchanging certificates and signatures again. 0-RTT
+// data can be replayed by anyone who recorded it, so no frame is sent or
+// handled before the handshake is complete: both ends wait for it before
+// the session starts (awaitHandshake). The frames that open a session
+// (access key handshake, membership proof) are bound to the TLS exporter,
+// which only exists once the handshake is complete, so they couldn't go
+// earlier in any case.
+
+// sessionTickets are kept for the lifetime of the process, across rooms and
+// reconnects, by host address
+var sessionTickets = tls.NewLRUClientSessionCache(64)
+
+// SetZeroRTT allows session resumption with 0-RTT; call before Start
+func (qn *QuicNetwork) SetZeroRTT(enabled bool) {
+	qn.zeroRTT = enabled
+}
+
+// listener is a QUIC listener with or without 0-RTT
+type listener interface {
+	Accept(context.Context) (quic.Connection, error)
+	Close() error
+}
+
+// earlyListener accepts connections before their handshake is complete
+type earlyListener struct {
+	*quic.EarlyListener
+}
+
+func (l earlyListener) Accept(ctx context.Context) (quic.Connection, error) {
+	conn, err := l.EarlyListener.Accept(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return conn, nil
+}
+
+// listen opens the host's listener, accepting 0-RTT when it is allowed
+func (qn *QuicNetwork) listen(addr string, tlsConfig *tls.Config) (listener, error) {
+	if qn.packets != nil {
+		cfg := quicConfig()
+		cfg.Allow0RTT = qn.zeroRTT
+		return qn.packets.listen(addr, tlsConfig, cfg)
+	}
+	if !qn.zeroRTT {
+		return quic.ListenAddr(addr, tlsConfig, quicConfig())
+	}
+	cfg := quicConfig()
+	cfg.Allow0RTT = true
+	l, err := quic.ListenAddrEarly(addr, tlsConfig, cfg)
+	if err != nil {
+		return nil, err
+	}
+	return earlyListener{l}, nil
+}
+
+// dial connects to the host, resuming an earlier session when 0-RTT is
+// allowed
+func (qn *QuicNetwork) dial(ctx context.Context, addr string, tlsConfig *tls.Config) (quic.Connection, error) {
+	if qn.zeroRTT {
+		tlsConfig.ClientSessionCache = sessionTickets
+	}
+	if qn.packets != nil {
+		return qn.packets.dial(ctx, addr, tlsConfig, quicConfig(), qn.zeroRTT)
+	}
+	if !qn.zeroRTT {
+		return quic.DialAddr(ctx, addr, tlsConfig, quicConfig())
+	}
+	conn, err := quic.DialAddrEarly(ctx, addr, tlsConfig, quicConfig())
+	if err != nil {
+		return nil, err
+	}
+	return conn, nil
+}
+
+// awaitHandshake waits until the handshake of conn is complete; false means
+// the connection failed first or ctx ended
+func awaitHandshake(ctx context.Context, conn quic.Connection) bool {
+	early, ok := conn.(quic.EarlyConnection)
+	if !ok {
+		return true
+	}
+	select {
+	case <-early.HandshakeComplete():
+		return conn.Context().Err() == nil
+	case <-conn.Context().Done():
+		return false
+	case <-ctx.Done():
+		return false
+	}
+}
+
+// resumed reports whether conn resumed an earlier TLS session
+func resumed(conn quic.Connection) bool {
+	return conn.ConnectionState().TLS.DidResume
+}
@@ -0,0 +1,139 @@
+package network
+
+import (
+	"encoding/hex"
+	"fmt"
+	"time"
+
+	"execp2p/internal/crypto"
+	"execp2p/internal/logger"
+	"execp2p/internal/wire"
+)
+
+// RoomMetadataHandler is called on the guest side with every verified room
+// metadata record received from the host
+type RoomMetadataHandler func(meta *crypto.RoomMetadata)
+
+// MessageObserver sees every chat message that is actually sent or
+// delivered, after encryption or decryption respectively
+type MessageObserver func(payload *crypto.MessagePayload, outgoing bool)
+
+// ControlHandler sees every delivered message before it reaches the chat
+// and returns true if it consumed it, e.g. a room-level control message
+// riding on the encrypted channel. It must not block.
+type ControlHandler func(payload *crypto.MessagePayload) bool
+
+// SetRoomMetadata sets the signed record the host hands to every guest and
+// sends it to an already connected one
+func (qn *QuicNetwork) SetRoomMetadata(meta *crypto.RoomMetadata) error {
+	if !qn.isListener {
+		return fmt.Errorf("only the room host publishes room metadata")
+	}
+	qn.keyExchangeMutex.Lock()
+	qn.roomMetadata = meta
+	qn.keyExchangeMutex.Unlock()
+
+	if len(qn.connectedPeerIDs()) > 0 {
+		return qn.sendRoomMetadata()
+	}
+	return nil
+}
+
+// RoomMetadata returns the current room metadata: our own record on the
+// host, the last verified one from the host on a guest
+func (qn *QuicNetwork) RoomMetadata() *crypto.RoomMetadata {
+	qn.keyExchangeMutex.RLock()
+	defer qn.keyExchangeMutex.RUnlock()
+	return qn.roomMetadata
+}
+
+// SetRoomMetadataHandler installs the callback for records from the host
+func (qn *QuicNetwork) SetRoomMetadataHandler(handler RoomMetadataHandler) {
+	qn.keyExchangeMutex.Lock()
+	qn.roomMetadataHandler = handler
+	qn.keyExchangeMutex.Unlock()
+}
+
+// SetMessageObserver installs a tap on sent and delivered chat messages
+func (qn *QuicNetwork) SetMessageObserver(observer MessageObserver) {
+	qn.keyExchangeMutex.Lock()
+	qn.messageObserver = observer
+	qn.keyExchangeMutex.Unlock()
+}
+
+// SetControlHandler installs the filter for control messages
+func (qn *QuicNetwork) SetControlHandler(handler ControlHandler) {
+	qn.keyExchangeMutex.Lock()
+	qn.controlHandler = handler
+	qn.keyExchangeMutex.Unlock()
+}
+
+func (qn *QuicNetwork) handleControl(payload *crypto.MessagePayload) bool {
+	qn.keyExchangeMutex.RLock()
+	handler := qn.controlHandler
+	qn.keyExchangeMutex.RUnlock()
+	return handler != nil && handler(payload)
+}
+
+func (qn *QuicNetwork) observeMessage(payload *crypto.MessagePayload, outgoing bool) {
+	qn.keyExchangeMutex.RLock()
+	observer := qn.messageObserver
+	qn.keyExchangeMutex.RUnlock()
+	if observer != nil {
+		observer(payload, outgoing)
+	}
+}
+
+func (qn *QuicNetwork) sendRoomMetadata() error {
+	meta := qn.RoomMetadata()
+	if meta == nil {
+		return nil
+	}
+	bytesPayload, err := wire.Marshal(meta, qn.format())
+	if err != nil {
+		return err
+	}
+	return qn.writeWrapper(message{
+		Type:      "roommeta",
+		Payload:   hex.EncodeToString(bytesPayload),
+		Timestamp: time.Now().Unix(),
+		SenderID:  qn.localPeerID,
+		RoomID:    qn.roomID,
+	})
+}
+
+func (qn *QuicNetwork) handleRoomMetadata(w message) {
+	if qn.isListener {
+		// guests have no say in room metadata
+		logger.L().Warn("Ignoring room metadata from a guest", "peer", shortID(w.SenderID))
+		return
+	}
+	bytesPayload, err := hex.DecodeString(w.Payload)
+	if err != nil {
+		logger.L().Warn("Room metadata decode error", "err", err)
+		return
+	}
+	meta, err := crypto.DeserializeRoomMetadata(bytesPayload)
+	if err != nil {
+		logger.L().Warn("Room metadata deserialization error", "err", err)
+		return
+	}
+	if meta.HostID != w.SenderID || meta.RoomID != qn.roomID {
+		logger.L().Warn("Room metadata for another room or host", "room_id", meta.RoomID, "host", shortID(meta.HostID))
+		return
+	}
+	if err := qn.pqCrypto.VerifyRoomMetadata(meta); err != nil {
+		logger.L().Warn("Invalid room metadata signature", "host", shortID(meta.HostID), "err", err)
+		return
+	}
+
+	qn.keyExchangeMutex.Lock()
+	qn.roomMetadata = meta
+	handler := qn.roomMetadataHandler
+	qn.keyExchangeMutex.Unlock()
+
+	logger.L().Info("Room metadata received", "room_id", meta.RoomID, "archiving", meta.Archiving)
+	if handler != nil {
+		handler(meta)
+	}
+}
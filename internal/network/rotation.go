@@ -0,0 +1,130 @@
+package network
+
+import (
+	"errors"
+	"time"
+
+	"execp2p/internal/crypto"
+	"execp2p/internal/diagnostics"
+	"execp2p/internal/logger"
+)
+
+// Rotation-in-flight buffer.
+//
+// When a peer rotates keys it sends a key exchange and then keeps sending
+// messages under the new key. Key exchanges travel on the control plane and
+// chat on the chat plane (plane.go), so one of those messages may be seen
+// before the key exchange has been processed; decryption then reports
+// ErrRotationInFlight, or ErrPeerNotFound if even the announcement is late.
+// Instead of dropping it, the message is parked here until the key exchange
+// arrives (or inflightGrace runs out). While anything is parked, later
+// messages queue behind it so delivery order is preserved.
+
+const (
+	// how long a message may wait for its key exchange
+	inflightGrace = 10 * time.Second
+	// upper bound on parked messages
+	maxInflightMessages = 64
+)
+
+type inflightMessage struct {
+	msg      *crypto.EncryptedMessage
+	received time.Time
+}
+
+// receiveEncrypted decrypts and delivers a message, parking it if its key
+// has not been established yet
+func (qn *QuicNetwork) receiveEncrypted(encMsg *crypto.EncryptedMessage) {
+	qn.keyExchangeMutex.RLock()
+	policy := qn.senderPolicy
+	qn.keyExchangeMutex.RUnlock()
+	if policy != nil {
+		if err := policy(encMsg.SenderID); err != nil {
+			logger.L().Debug("Message rejected by sender policy", "peer", shortID(encMsg.SenderID), "err", err)
+			diagnostics.Inc(diagnostics.MessageUnverified)
+			return
+		}
+	}
+
+	qn.inflightMutex.Lock()
+	defer qn.inflightMutex.Unlock()
+
+	// something is already waiting; keep the order
+	if len(qn.inflight) > 0 {
+		qn.parkLocked(encMsg)
+		return
+	}
+
+	payload, err := qn.pqCrypto.DecryptMessageFromPeer(encMsg)
+	if awaitingKey(err) {
+		qn.parkLocked(encMsg)
+		return
+	}
+	if err != nil {
+		logger.L().Warn("Message decryption error", "err", err)
+		diagnostics.Inc(diagnostics.MessageDecryptFail)
+		return
+	}
+	qn.deliverLocked(payload)
+}
+
+func (qn *QuicNetwork) parkLocked(encMsg *crypto.EncryptedMessage) {
+	if len(qn.inflight) >= maxInflightMessages {
+		logger.L().Warn("Rotation buffer full; dropping message", "peer", shortID(encMsg.SenderID))
+		diagnostics.Inc(diagnostics.MessageDecryptFail)
+		return
+	}
+
+	qn.inflight = append(qn.inflight, inflightMessage{msg: encMsg, received: time.Now()})
+	diagnostics.Inc(diagnostics.RotationBuffered)
+	logger.L().Debug("Message waiting for key exchange", "peer", shortID(encMsg.SenderID), "epoch", encMsg.KeyRotationEpoch, "queued", len(qn.inflight))
+
+	if len(qn.inflight) == 1 {
+		time.AfterFunc(inflightGrace, qn.drainInflight)
+	}
+}
+
+// drainInflight retries parked messages in arrival order. It stops at the
+// first message whose key is still missing unless that one has expired.
+func (qn *QuicNetwork) drainInflight() {
+	qn.inflightMutex.Lock()
+	defer qn.inflightMutex.Unlock()
+
+	for len(qn.inflight) > 0 {
+		head := qn.inflight[0]
+		payload, err := qn.pqCrypto.DecryptMessageFromPeer(head.msg)
+		switch {
+		case awaitingKey(err):
+			if time.Since(head.received) < inflightGrace {
+				// still within grace; check again when it runs out
+				time.AfterFunc(inflightGrace-time.Since(head.received), qn.drainInflight)
+				return
+			}
+			logger.L().Warn("Key exchange never arrived; dropping message", "peer", shortID(head.msg.SenderID), "epoch", head.msg.KeyRotationEpoch)
+			diagnostics.Inc(diagnostics.RotationExpired)
+			diagnostics.Inc(diagnostics.MessageDecryptFail)
+		case err != nil:
+			logger.L().Warn("Message decryption error", "err", err)
+			diagnostics.Inc(diagnostics.MessageDecryptFail)
+		default:
+			qn.deliverLocked(payload)
+		}
+		qn.inflight[0] = inflightMessage{}
+		qn.inflight = qn.inflight[1:]
+	}
+	qn.inflight = nil
+}
+
+// awaitingKey reports whether a message failed only because the control
+// frame that establishes its key hasn't been handled yet
+func awaitingKey(err error) bool {
+	return errors.Is(err, crypto.ErrRotationInFlight) || errors.Is(err, crypto.ErrPeerNotFound)
+}
+
+// shortID shortens a peer ID for logging
+func shortID(id string) string {
+	if len(id) > 8 {
+		return id[:8]
+	}
+	return id
+}
@@ -0,0 +1,116 @@
+package network
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"net"
+	"testing"
+	"time"
+
+	"execp2p/internal/crypto"
+	"execp2p/internal/room"
+)
+
+// testPeer is one side of a room in the transport tests
+type testPeer struct {
+	qn       *QuicNetwork
+	verified chan struct{}
+}
+
+func newTestPeer(t *testing.T, f Factory, roomID string, port int, isListener bool, remoteAddr string) *testPeer {
+	t.Helper()
+	pq, err := crypto.NewPQCrypto()
+	if err != nil {
+		t.Fatal(err)
+	}
+	id := make([]byte, 16)
+	rand.Read(id)
+	n, err := f(context.Background(), hex.EncodeToString(id), roomID, port, pq, isListener, remoteAddr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	p := &testPeer{qn: n.(*QuicNetwork), verified: make(chan struct{}, 16)}
+	p.qn.SetPeerHandler(func(e PeerEvent) {
+		if e.Kind == PeerVerified {
+			select {
+			case p.verified <- struct{}{}:
+			default:
+			}
+		}
+	})
+	return p
+}
+
+func (p *testPeer) start(t *testing.T, ctx context.Context) {
+	t.Helper()
+	if err := p.qn.Start(ctx); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(p.qn.Stop)
+}
+
+// exchange waits until both peers hold each other's keys, then sends a
+// message each way
+func exchange(t *testing.T, ctx context.Context, host, guest *testPeer) {
+	t.Helper()
+	for _, p := range []*testPeer{host, guest} {
+		select {
+		case <-p.verified:
+		case <-ctx.Done():
+			t.Fatal("secure channel not established")
+		}
+	}
+	for _, dir := range []struct {
+		from, to *testPeer
+		text     string
+	}{{host, guest, "from host"}, {guest, host, "from guest"}} {
+		if err := dir.from.qn.SendMessage(ctx, dir.text); err != nil {
+			t.Fatal(err)
+		}
+		select {
+		case msg := <-dir.to.qn.GetIncomingMessages():
+			if msg.Message != dir.text {
+				t.Fatalf("got %q, want %q", msg.Message, dir.text)
+			}
+		case <-ctx.Done():
+			t.Fatalf("%q never arrived", dir.text)
+		}
+	}
+}
+
+// freePort returns a port free for both UDP and TCP
+func freePort(t *testing.T) int {
+	t.Helper()
+	for i := 0; i < 20; i++ {
+		pc, err := net.ListenPacket("udp", "127.0.0.1:0")
+		if err != nil {
+			t.Fatal(err)
+		}
+		port := pc.LocalAddr().(*net.UDPAddr).Port
+		l, err := net.Listen("tcp", fmt.Sprintf("127.0.0.1:%d", port))
+		pc.Close()
+		if err == nil {
+			l.Close()
+			return port
+		}
+	}
+	t.Fatal("no free port")
+	return 0
+}
+
+func testContext(t *testing.T) context.Context {
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	t.Cleanup(cancel)
+	return ctx
+}
+
+func testRoomID(t *testing.T) string {
+	t.Helper()
+	id, err := room.GenerateRoomID()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return id
+}
@@ -0,0 +1,17 @@
+package network
+
+import (
+	"github.com/quic-go/quic-go"
+
+	"execp2p/internal/diagnostics"
+	"execp2p/internal/logger"
+)
+
+// rejectFrame closes conn over a frame that failed validation
+// (frame.Validate)
+func (qn *QuicNetwork) rejectFrame(conn quic.Connection, err error) {
+	logger.L().Warn("Malformed frame; closing the connection", "remote", conn.RemoteAddr().String(), "err", err)
+	diagnostics.Inc(diagnostics.FrameRejected)
+	qn.sendError(&ProtocolError{Err: err})
+	conn.CloseWithError(closeCodeProtocol, "malformed frame")
+}
@@ -0,0 +1,94 @@
+package network
+
+import (
+	"fmt"
+	"sync"
+
+	"github.com/quic-go/quic-go"
+
+	"execp2p/internal/diagnostics"
+	"execp2p/internal/frame"
+	"execp2p/internal/logger"
+	"execp2p/internal/wire"
+)
+
+// Wire protocol versions (internal/frame).
+//
+// The version is agreed per connection from the frames that open a session.
+// When there is none, the side that notices closes the connection with
+// closeCodeVersion.
+
+const (
+	// the newest version we speak
+	ProtocolVersion = frame.ProtocolVersion
+	// the oldest version we still speak
+	MinProtocolVersion = frame.MinProtocolVersion
+)
+
+// ErrIncompatibleVersion means we and the peer have no protocol version in
+// common
+var ErrIncompatibleVersion = frame.ErrIncompatibleVersion
+
+// VersionError is reported when the peer's versions don't overlap ours
+type VersionError = frame.VersionError
+
+// wireVersion is the version agreed on a connection
+type wireVersion struct {
+	mu      sync.Mutex
+	conn    quic.Connection
+	version int
+}
+
+// agreeVersion settles the version of conn from a frame that opens a
+// session; false means there is none and conn was closed
+func (qn *QuicNetwork) agreeVersion(conn quic.Connection, w message) bool {
+	if !frame.OpensSession(w.Type) {
+		return true
+	}
+	peerMin, peerMax := frame.PeerVersions(w)
+	v, ok := frame.Negotiate(peerMin, peerMax)
+	if !ok {
+		err := &VersionError{Min: MinProtocolVersion, Max: ProtocolVersion, PeerMin: peerMin, PeerMax: peerMax}
+		logger.L().Warn("No protocol version in common; closing the connection", "remote", conn.RemoteAddr().String(), "err", err)
+		diagnostics.RecordHandshakeFailure(diagnostics.HandshakeVersion)
+		qn.sendError(err)
+		conn.CloseWithError(closeCodeVersion, fmt.Sprintf("protocol versions %d-%d", MinProtocolVersion, ProtocolVersion))
+		return false
+	}
+
+	qn.wire.mu.Lock()
+	changed := qn.wire.conn != conn || qn.wire.version != v
+	qn.wire.conn, qn.wire.version = conn, v
+	qn.wire.mu.Unlock()
+	if changed {
+		logger.L().Debug("Protocol version agreed", "version", v, "peer_min", peerMin, "peer_max", peerMax)
+	}
+	return true
+}
+
+// Version returns the protocol version agreed with the peer on the current
+// connection, 0 before its first frame arrived
+func (qn *QuicNetwork) Version() int {
+	return qn.versionOn(qn.currentConn())
+}
+
+func (qn *QuicNetwork) versionOn(conn quic.Connection) int {
+	qn.wire.mu.Lock()
+	defer qn.wire.mu.Unlock()
+	if conn == nil || qn.wire.conn != conn {
+		return 0
+	}
+	return qn.wire.version
+}
+
+// format returns the encoding of frames sent on the current connection
+func (qn *QuicNetwork) format() wire.Format {
+	return qn.formatOn(qn.currentConn())
+}
+
+func (qn *QuicNetwork) formatOn(conn quic.Connection) wire.Format {
+	if qn.versionOn(conn) >= frame.CBORProtocolVersion {
+		return wire.CBOR
+	}
+	return wire.JSON
+}
@@ -0,0 +1,302 @@
+package network
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/tls"
+	"encoding/hex"
+	"fmt"
+	"time"
+
+	"execp2p/internal/crash"
+	"execp2p/internal/crypto"
+	"execp2p/internal/logger"
+
+	"github.com/pion/webrtc/v4"
+	"github.com/quic-go/quic-go"
+)
+
+// WebRTC transport.
+//
+// The room's QUIC connection runs over a WebRTC data channel instead of
+// UDP: ICE (with the STUN servers) finds a path between the two ends, DTLS
+// and SCTP carry the packets, and QUIC's TLS, the access key handshake and
+// the post-quantum handshake run inside the channel as on any other
+// carrier. The channel is unordered without retransmissions, so it behaves
+// like UDP and QUIC does the rest.
+//
+// The SDP of a session goes through an RTCSignaler, the signaling server
+// outside tests. A guest leaves its offer under the room ID and waits for
+// the answer; the host takes the room's offers, answers each and gets one
+// path per guest. Candidates are gathered before the description is sent,
+// so one offer and one answer are all a session needs.
+
+// WebRTCRoomAddr is the remote address of a guest; the host is found
+// through the signaler by the room ID
+const WebRTCRoomAddr = "webrtc"
+
+const (
+	// how often the host asks for new offers
+	rtcPollInterval = time.Second
+	// how long a session may take from the offer to an open channel
+	rtcSetupTimeout = 30 * time.Second
+	// bytes queued in a channel before packets are dropped, like a full
+	// socket buffer
+	rtcMaxBuffered = 1 << 20
+	// the host's address on its guests' paths
+	rtcHostID = "host"
+)
+
+// RTCOffer is a guest's offer waiting for the host's answer
+type RTCOffer struct {
+	Session string `json:"session"`
+	SDP     string `json:"sdp"`
+}
+
+// RTCSignaler relays the SDP of WebRTC sessions between a room's host and
+// its guests
+type RTCSignaler interface {
+	// Offer leaves a guest's offer for the host of roomID
+	Offer(ctx context.Context, roomID string, offer RTCOffer) error
+	// Answer waits for the host's answer to a session
+	Answer(ctx context.Context, roomID, session string) (string, error)
+	// Offers takes the offers left for the host of roomID
+	Offers(ctx context.Context, roomID string) ([]RTCOffer, error)
+	// Reply leaves the host's answer to a session
+	Reply(ctx context.Context, roomID, session, sdp string) error
+}
+
+// WebRTCOptions configures the WebRTC transport
+type WebRTCOptions struct {
+	Signaler RTCSignaler
+	// STUN and TURN URLs, e.g. "stun:stun.l.google.com:19302"
+	ICEServers []string
+}
+
+// NewWebRTCFactory returns a Factory of networks whose QUIC runs over
+// WebRTC data channels
+func NewWebRTCFactory(opts WebRTCOptions) (Factory, error) {
+	if opts.Signaler == nil {
+		return nil, fmt.Errorf("the WebRTC transport needs a signaler")
+	}
+	return func(ctx context.Context, peerID, roomID string, listenPort int, pqCrypto *crypto.PQCrypto, isListener bool, remoteAddr string) (Network, error) {
+		qn, err := NewQuicNetwork(ctx, peerID, roomID, listenPort, pqCrypto, isListener, remoteAddr)
+		if err != nil {
+			return nil, err
+		}
+		qn.packets = &webrtcHost{roomID: roomID, opts: opts}
+		return qn, nil
+	}, nil
+}
+
+// webrtcHost carries the packets of one network
+type webrtcHost struct {
+	roomID string
+	opts   WebRTCOptions
+}
+
+func (h *webrtcHost) newPeer() (*webrtc.PeerConnection, error) {
+	var conf webrtc.Configuration
+	if len(h.opts.ICEServers) > 0 {
+		conf.ICEServers = []webrtc.ICEServer{{URLs: h.opts.ICEServers}}
+	}
+	peer, err := webrtc.NewPeerConnection(conf)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create WebRTC peer: %w", err)
+	}
+	return peer, nil
+}
+
+// describe sets desc as the local description and returns it with every
+// candidate gathered
+func describe(peer *webrtc.PeerConnection, desc webrtc.SessionDescription) (string, error) {
+	gathered := webrtc.GatheringCompletePromise(peer)
+	if err := peer.SetLocalDescription(desc); err != nil {
+		return "", err
+	}
+	<-gathered
+	return peer.LocalDescription().SDP, nil
+}
+
+// listen answers the room's offers until the listener is closed
+func (h *webrtcHost) listen(addr string, tlsConfig *tls.Config, conf *quic.Config) (listener, error) {
+	pc := newPathConn(pathAddr{network: "webrtc", id: rtcHostID})
+	l, err := listenOn(pc, tlsConfig, conf)
+	if err != nil {
+		return nil, err
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	go h.answerLoop(ctx, pc)
+	return webrtcListener{listener: l, cancel: cancel}, nil
+}
+
+func (h *webrtcHost) answerLoop(ctx context.Context, pc *pathConn) {
+	defer crash.Recover("network.webrtcHost.answerLoop")
+	ticker := time.NewTicker(rtcPollInterval)
+	defer ticker.Stop()
+	for {
+		offers, err := h.opts.Signaler.Offers(ctx, h.roomID)
+		if err != nil && ctx.Err() == nil {
+			logger.L().Debug("WebRTC offers unavailable", "err", err)
+		}
+		for _, offer := range offers {
+			go h.answer(ctx, pc, offer)
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// answer sets up the session a guest offered
+func (h *webrtcHost) answer(ctx context.Context, pc *pathConn, offer RTCOffer) {
+	defer crash.Recover("network.webrtcHost.answer")
+	peer, err := h.newPeer()
+	if err != nil {
+		logger.L().Warn("WebRTC session refused", "err", err)
+		return
+	}
+	remote := pathAddr{network: "webrtc", id: offer.Session}
+	opened := make(chan struct{})
+	peer.OnDataChannel(func(dc *webrtc.DataChannel) {
+		p := newChannelPath(peer, dc, pc, remote)
+		dc.OnOpen(func() {
+			if pc.attach(remote, p) {
+				close(opened)
+			}
+		})
+	})
+
+	err = peer.SetRemoteDescription(webrtc.SessionDescription{Type: webrtc.SDPTypeOffer, SDP: offer.SDP})
+	var sdp string
+	if err == nil {
+		var desc webrtc.SessionDescription
+		if desc, err = peer.CreateAnswer(nil); err == nil {
+			sdp, err = describe(peer, desc)
+		}
+	}
+	if err == nil {
+		err = h.opts.Signaler.Reply(ctx, h.roomID, offer.Session, sdp)
+	}
+	if err != nil {
+		logger.L().Debug("WebRTC answer failed", "session", shortID(offer.Session), "err", err)
+		peer.Close()
+		return
+	}
+
+	select {
+	case <-opened:
+		logger.L().Debug("WebRTC session open", "session", shortID(offer.Session))
+	case <-time.After(rtcSetupTimeout):
+		logger.L().Debug("WebRTC session never opened", "session", shortID(offer.Session))
+		peer.Close()
+	case <-ctx.Done():
+		peer.Close()
+	}
+}
+
+// dial offers a session to the room's host and connects over its channel
+func (h *webrtcHost) dial(ctx context.Context, addr string, tlsConfig *tls.Config, conf *quic.Config, early bool) (quic.Connection, error) {
+	peer, err := h.newPeer()
+	if err != nil {
+		return nil, err
+	}
+	ordered, retransmits := false, uint16(0)
+	dc, err := peer.CreateDataChannel("execp2p-quic", &webrtc.DataChannelInit{Ordered: &ordered, MaxRetransmits: &retransmits})
+	if err != nil {
+		peer.Close()
+		return nil, fmt.Errorf("failed to create data channel: %w", err)
+	}
+	opened := make(chan struct{})
+	dc.OnOpen(func() { close(opened) })
+
+	id := make([]byte, 16)
+	rand.Read(id)
+	session := hex.EncodeToString(id)
+	pc := newPathConn(pathAddr{network: "webrtc", id: session})
+	remote := pathAddr{network: "webrtc", id: rtcHostID}
+	p := newChannelPath(peer, dc, pc, remote)
+
+	if err := h.offer(ctx, peer, session); err != nil {
+		peer.Close()
+		return nil, err
+	}
+	select {
+	case <-opened:
+	case <-ctx.Done():
+		peer.Close()
+		return nil, fmt.Errorf("WebRTC channel not opened: %w", ctx.Err())
+	}
+	pc.attach(remote, p)
+	return dialOn(ctx, pc, remote, tlsConfig, conf, early)
+}
+
+// offer sends the session's offer and applies the host's answer
+func (h *webrtcHost) offer(ctx context.Context, peer *webrtc.PeerConnection, session string) error {
+	desc, err := peer.CreateOffer(nil)
+	if err != nil {
+		return fmt.Errorf("failed to create WebRTC offer: %w", err)
+	}
+	sdp, err := describe(peer, desc)
+	if err != nil {
+		return fmt.Errorf("failed to create WebRTC offer: %w", err)
+	}
+	if err := h.opts.Signaler.Offer(ctx, h.roomID, RTCOffer{Session: session, SDP: sdp}); err != nil {
+		return fmt.Errorf("WebRTC offer not delivered: %w", err)
+	}
+	answer, err := h.opts.Signaler.Answer(ctx, h.roomID, session)
+	if err != nil {
+		return fmt.Errorf("no WebRTC answer from the host: %w", err)
+	}
+	if err := peer.SetRemoteDescription(webrtc.SessionDescription{Type: webrtc.SDPTypeAnswer, SDP: answer}); err != nil {
+		return fmt.Errorf("invalid WebRTC answer: %w", err)
+	}
+	return nil
+}
+
+// webrtcListener stops answering offers with the listener
+type webrtcListener struct {
+	listener
+	cancel context.CancelFunc
+}
+
+func (l webrtcListener) Close() error {
+	l.cancel()
+	return l.listener.Close()
+}
+
+// channelPath is a packet path over a data channel
+type channelPath struct {
+	peer *webrtc.PeerConnection
+	dc   *webrtc.DataChannel
+}
+
+// newChannelPath delivers the channel's packets to pc and detaches the
+// path when the session ends
+func newChannelPath(peer *webrtc.PeerConnection, dc *webrtc.DataChannel, pc *pathConn, remote pathAddr) *channelPath {
+	p := &channelPath{peer: peer, dc: dc}
+	dc.OnMessage(func(msg webrtc.DataChannelMessage) {
+		pc.deliver(remote, msg.Data)
+	})
+	// closing the peer from its own callbacks could wait on them
+	dc.OnClose(func() { go pc.detach(remote, p) })
+	peer.OnConnectionStateChange(func(state webrtc.PeerConnectionState) {
+		if state == webrtc.PeerConnectionStateFailed || state == webrtc.PeerConnectionStateClosed {
+			go pc.detach(remote, p)
+		}
+	})
+	return p
+}
+
+func (p *channelPath) send(pkt []byte) error {
+	if p.dc.BufferedAmount() > rtcMaxBuffered {
+		return nil
+	}
+	return p.dc.Send(pkt)
+}
+
+func (p *channelPath) close() error {
+	return p.peer.Close()
+}
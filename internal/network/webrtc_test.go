@@ -0,0 +1,81 @@
+package network
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+)
+
+// memorySignaler relays SDP in memory, as the signaling server does
+type memorySignaler struct {
+	mu      sync.Mutex
+	offers  map[string][]RTCOffer
+	answers map[string]string
+}
+
+func newMemorySignaler() *memorySignaler {
+	return &memorySignaler{offers: make(map[string][]RTCOffer), answers: make(map[string]string)}
+}
+
+func (s *memorySignaler) Offer(ctx context.Context, roomID string, offer RTCOffer) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.offers[roomID] = append(s.offers[roomID], offer)
+	return nil
+}
+
+func (s *memorySignaler) Answer(ctx context.Context, roomID, session string) (string, error) {
+	for {
+		s.mu.Lock()
+		sdp, ok := s.answers[session]
+		s.mu.Unlock()
+		if ok {
+			return sdp, nil
+		}
+		select {
+		case <-ctx.Done():
+			return "", ctx.Err()
+		case <-time.After(10 * time.Millisecond):
+		}
+	}
+}
+
+func (s *memorySignaler) Offers(ctx context.Context, roomID string) ([]RTCOffer, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	offers := s.offers[roomID]
+	delete(s.offers, roomID)
+	return offers, nil
+}
+
+func (s *memorySignaler) Reply(ctx context.Context, roomID, session, sdp string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.answers[session] = sdp
+	return nil
+}
+
+func TestWebRTCRoom(t *testing.T) {
+	if testing.Short() {
+		t.Skip("opens WebRTC sessions")
+	}
+	f, err := NewWebRTCFactory(WebRTCOptions{Signaler: newMemorySignaler()})
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx := testContext(t)
+	roomID := testRoomID(t)
+
+	host := newTestPeer(t, f, roomID, 0, true, "")
+	host.start(t, ctx)
+	guest := newTestPeer(t, f, roomID, 0, false, WebRTCRoomAddr)
+	guest.start(t, ctx)
+	exchange(t, ctx, host, guest)
+}
+
+func TestWebRTCNeedsSignaler(t *testing.T) {
+	if _, err := NewWebRTCFactory(WebRTCOptions{}); err == nil {
+		t.Fatal("factory without a signaler")
+	}
+}
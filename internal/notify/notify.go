@@ -0,0 +1,103 @@
+// Package notify shows desktop notifications with the tool each system
+// ships for it: notify-send on Linux and the BSDs, osascript on macOS and
+// PowerShell toasts on Windows. Where the tool is missing notifications are
+// skipped.
+package notify
+
+import (
+	"context"
+	"errors"
+	"html"
+	"os"
+	"os/exec"
+	"runtime"
+	"time"
+
+	"execp2p/internal/crash"
+	"execp2p/internal/logger"
+
+	"golang.org/x/time/rate"
+)
+
+// AppName is the application notifications are shown for
+const AppName = "ExecP2P"
+
+// how long the notification tool gets to return
+const sendTimeout = 10 * time.Second
+
+// ErrUnavailable means the system has no notification tool we know
+var ErrUnavailable = errors.New("desktop notifications unavailable")
+
+// Notifier shows notifications in the background, at most a few at a time:
+// a burst of messages doesn't become a burst of notifications
+type Notifier struct {
+	command func(ctx context.Context, title, body string) *exec.Cmd
+	limit   *rate.Limiter
+}
+
+// New finds the notification tool of this system; ErrUnavailable without one
+func New() (*Notifier, error) {
+	n := &Notifier{limit: rate.NewLimiter(rate.Every(2*time.Second), 3)}
+	switch runtime.GOOS {
+	case "darwin":
+		path, err := exec.LookPath("osascript")
+		if err != nil {
+			return nil, ErrUnavailable
+		}
+		n.command = func(ctx context.Context, title, body string) *exec.Cmd {
+			// the text goes in as arguments, never into the script
+			return exec.CommandContext(ctx, path,
+				"-e", "on run argv",
+				"-e", "display notification (item 2 of argv) with title (item 1 of argv)",
+				"-e", "end run",
+				"--", title, body)
+		}
+	case "windows":
+		path, err := exec.LookPath("powershell.exe")
+		if err != nil {
+			return nil, ErrUnavailable
+		}
+		n.command = func(ctx context.Context, title, body string) *exec.Cmd {
+			cmd := exec.CommandContext(ctx, path, "-NoProfile", "-NonInteractive", "-WindowStyle", "Hidden", "-Command", toastScript)
+			// the text goes in through the environment, never into the script
+			cmd.Env = append(os.Environ(), "EXECP2P_NOTIFY_TITLE="+title, "EXECP2P_NOTIFY_BODY="+body)
+			return cmd
+		}
+	default:
+		path, err := exec.LookPath("notify-send")
+		if err != nil {
+			return nil, ErrUnavailable
+		}
+		n.command = func(ctx context.Context, title, body string) *exec.Cmd {
+			// most notification daemons read the body as markup
+			return exec.CommandContext(ctx, path, "--app-name="+AppName, "--", title, html.EscapeString(body))
+		}
+	}
+	return n, nil
+}
+
+// Notify shows a notification without waiting for it. It is dropped when
+// too many were shown lately.
+func (n *Notifier) Notify(title, body string) {
+	if n == nil || !n.limit.Allow() {
+		return
+	}
+	go func() {
+		defer crash.Recover("notify.Notify")
+		ctx, cancel := context.WithTimeout(context.Background(), sendTimeout)
+		defer cancel()
+		if out, err := n.command(ctx, title, body).CombinedOutput(); err != nil {
+			logger.L().Debug("Failed to show a notification", "err", err, "output", string(out))
+		}
+	}()
+}
+
+// toastScript shows a toast with the title and body from the environment.
+// Toasts need a registered application ID, so PowerShell's is used.
+const toastScript = `[Windows.UI.Notifications.ToastNotificationManager, Windows.UI.Notifications, ContentType = WindowsRuntime] > $null
+$xml = [Windows.UI.Notifications.ToastNotificationManager]::GetTemplateContent([Windows.UI.Notifications.ToastTemplateType]::ToastText02)
+$text = $xml.GetElementsByTagName('text')
+$text.Item(0).AppendChild($xml.CreateTextNode($env:EXECP2P_NOTIFY_TITLE)) > $null
+$text.Item(1).AppendChild($xml.CreateTextNode($env:EXECP2P_NOTIFY_BODY)) > $null
+$app = '{1AC14E77-02E7-4E5D-B744-2EB1AE5198B7}\WindowsPowerShell\v1.0\powershell.exe'
+[Windows.UI.Notifications.ToastNotificationManager]::CreateToastNotifier($app).Show([Windows.UI.Notifications.ToastNotification]::new($xml))`
@@ -0,0 +1,149 @@
+// Package outbox queues the messages the user sent while nobody in the room
+// could take them, until they are sent again or discarded. Each room has its
+// own queue, capped so a long outage can't grow it without bound.
+package outbox
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"sync"
+	"time"
+
+	"execp2p/internal/logger"
+	"execp2p/internal/storage"
+)
+
+// BucketName is the storage bucket the queues are kept in
+const BucketName = "outbox"
+
+// DefaultLimit is how many messages a room's queue holds
+const DefaultLimit = 100
+
+// ErrFull is returned when a room's queue is at its limit
+var ErrFull = errors.New("outbox full")
+
+// Message is a queued message
+type Message struct {
+	ID     string `json:"id"`
+	RoomID string `json:"room_id"`
+	// what was given to send: text, or the JSON of a media message
+	Body     string    `json:"body"`
+	QueuedAt time.Time `json:"queued_at"`
+}
+
+// Store keeps the queues across restarts, one key per room.
+// *storage.Bucket is one.
+type Store interface {
+	PutJSON(key string, v interface{}) error
+	GetJSON(key string, v interface{}) (bool, error)
+	Delete(key string) error
+	Keys() []string
+}
+
+// Outbox is safe for concurrent use. Queues are kept in memory and, when a
+// store is given, written to it on every change; while an incognito room is
+// active the encrypted database refuses writes and they stay in memory.
+type Outbox struct {
+	mu    sync.Mutex
+	limit int
+	rooms map[string][]Message
+	store Store
+}
+
+// New returns an outbox holding limit messages per room, with the queues
+// found in store, which may be nil
+func New(limit int, store Store) *Outbox {
+	o := &Outbox{limit: limit, rooms: make(map[string][]Message), store: store}
+	if store == nil {
+		return o
+	}
+	for _, roomID := range store.Keys() {
+		var queue []Message
+		if ok, err := store.GetJSON(roomID, &queue); err != nil || !ok {
+			logger.L().Warn("Dropping unreadable outbox queue", "room_id", roomID, "err", err)
+			store.Delete(roomID)
+			continue
+		}
+		if len(queue) > 0 {
+			o.rooms[roomID] = queue
+		}
+	}
+	return o
+}
+
+// Add queues body for roomID
+func (o *Outbox) Add(roomID, body string) (Message, error) {
+	id := make([]byte, 8)
+	rand.Read(id)
+	return o.AddWithID(roomID, hex.EncodeToString(id), body)
+}
+
+// AddWithID queues body for roomID under the ID it was already tried with,
+// so the receiver can tell a copy that did arrive
+func (o *Outbox) AddWithID(roomID, id, body string) (Message, error) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	if len(o.rooms[roomID]) >= o.limit {
+		return Message{}, ErrFull
+	}
+	msg := Message{ID: id, RoomID: roomID, Body: body, QueuedAt: time.Now()}
+	o.rooms[roomID] = append(o.rooms[roomID], msg)
+	o.save(roomID)
+	return msg, nil
+}
+
+// List returns the queue of roomID, oldest first
+func (o *Outbox) List(roomID string) []Message {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	return append([]Message{}, o.rooms[roomID]...)
+}
+
+// Remove drops one message, once it was sent; it reports whether it was queued
+func (o *Outbox) Remove(roomID, id string) bool {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	queue := o.rooms[roomID]
+	for i, msg := range queue {
+		if msg.ID == id {
+			o.rooms[roomID] = append(queue[:i:i], queue[i+1:]...)
+			o.save(roomID)
+			return true
+		}
+	}
+	return false
+}
+
+// Clear drops the queue of roomID and returns how many messages it held
+func (o *Outbox) Clear(roomID string) int {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	n := len(o.rooms[roomID])
+	delete(o.rooms, roomID)
+	o.save(roomID)
+	return n
+}
+
+// save writes the queue of roomID to the store; o.mu must be held
+func (o *Outbox) save(roomID string) {
+	queue := o.rooms[roomID]
+	if len(queue) == 0 {
+		delete(o.rooms, roomID)
+	}
+	if o.store == nil {
+		return
+	}
+	var err error
+	if len(queue) > 0 {
+		err = o.store.PutJSON(roomID, queue)
+	} else {
+		err = o.store.Delete(roomID)
+	}
+	if err != nil && !errors.Is(err, storage.ErrIncognito) {
+		logger.L().Warn("Failed to store the outbox", "room_id", roomID, "err", err)
+	}
+}
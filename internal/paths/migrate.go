@@ -0,0 +1,149 @@
+package paths
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+
+	"execp2p/internal/logger"
+)
+
+// legacyState lists what older versions, which kept everything in the
+// config directory, wrote there: the identity keystore, the peer ID, the
+// pins, the encrypted database, the media cache and crash reports. The
+// config file stays, and sockets and the daemon token belong to whichever
+// instance is running.
+var legacyState = []string{"identity.keystore", "peer.id", "trust.json", "store", "media", "crashes"}
+
+// Migrate moves the files of older versions to the directories they belong
+// in now. An entry already present at its new place is left where it was,
+// so nothing is overwritten and an interrupted move is finished by the next
+// start.
+func Migrate() error {
+	legacy, err := Config()
+	if err != nil {
+		return err
+	}
+	data, err := Data()
+	if err != nil {
+		return err
+	}
+	cache, err := Cache()
+	if err != nil {
+		return err
+	}
+	logs, err := Logs()
+	if err != nil {
+		return err
+	}
+
+	var errs []error
+	for _, name := range legacyState {
+		target := filepath.Join(data, name)
+		switch name {
+		case "media":
+			target = filepath.Join(cache, name)
+		case "crashes":
+			target = filepath.Join(logs, name)
+		}
+		if err := move(filepath.Join(legacy, name), target); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	for _, path := range legacyLogs() {
+		if err := move(path, filepath.Join(logs, "debug.log")); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// move renames src to dst, copying when they are on different file systems
+func move(src, dst string) error {
+	if src == dst {
+		return nil
+	}
+	if _, err := os.Lstat(src); errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if _, err := os.Lstat(dst); err == nil {
+		logger.L().Warn("Not migrating a file already present at its new location", "from", src, "to", dst)
+		return nil
+	}
+	err := os.Rename(src, dst)
+	if err == nil || errors.Is(err, os.ErrNotExist) {
+		// moved, possibly by another instance starting at the same time
+		if err == nil {
+			logger.L().Info("Migrated to the platform directory", "from", src, "to", dst)
+		}
+		return nil
+	}
+
+	// copied under another name first, so dst is either complete or missing
+	partial := dst + ".migrating"
+	os.RemoveAll(partial)
+	if err := copyTree(src, partial); err != nil {
+		os.RemoveAll(partial)
+		return fmt.Errorf("failed to move %s to %s: %w", src, dst, err)
+	}
+	if err := os.Rename(partial, dst); err != nil {
+		os.RemoveAll(partial)
+		return fmt.Errorf("failed to move %s to %s: %w", src, dst, err)
+	}
+	logger.L().Info("Migrated to the platform directory", "from", src, "to", dst)
+	if err := os.RemoveAll(src); err != nil {
+		return fmt.Errorf("failed to remove %s after copying it: %w", src, err)
+	}
+	return nil
+}
+
+// copyTree copies the directories and regular files under src to dst,
+// keeping their permissions
+func copyTree(src, dst string) error {
+	return filepath.WalkDir(src, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(src, path)
+		if err != nil {
+			return err
+		}
+		target := filepath.Join(dst, rel)
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+		switch {
+		case d.IsDir():
+			return os.MkdirAll(target, info.Mode().Perm())
+		case info.Mode().IsRegular():
+			return copyFile(path, target, info.Mode().Perm())
+		}
+		// sockets and links are left behind
+		return nil
+	})
+}
+
+func copyFile(src, dst string, perm fs.FileMode) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+	out, err := os.OpenFile(dst, os.O_WRONLY|os.O_CREATE|os.O_EXCL, perm)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(out, in); err != nil {
+		out.Close()
+		return err
+	}
+	if err := out.Sync(); err != nil {
+		out.Close()
+		return err
+	}
+	return out.Close()
+}
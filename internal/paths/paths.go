@@ -0,0 +1,65 @@
+// Package paths tells where ExecP2P keeps its files, following each
+// platform's conventions: the XDG base directories on Linux and the BSDs,
+// Application Support, Caches and Logs on macOS, and AppData on Windows.
+// Settings, state that must survive (identity, trust data, history), the
+// media cache and logs each get their own directory, so a cache cleaner or
+// a backup of the user's settings does the expected thing.
+package paths
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+// appName is the name of our directory in each of the base directories
+const appName = "execp2p"
+
+// Config returns the directory of the config file, e.g. ~/.config/execp2p.
+// It isn't created: the file is optional.
+func Config() (string, error) {
+	base, err := os.UserConfigDir()
+	if err != nil {
+		return "", fmt.Errorf("failed to locate user config directory: %w", err)
+	}
+	return filepath.Join(base, appName), nil
+}
+
+// Data returns the directory of persistent state: the identity keystore,
+// trust data, the encrypted history and the local sockets. It is created
+// with owner-only permissions if it does not exist yet.
+func Data() (string, error) {
+	dir, err := dataDir()
+	if err != nil {
+		return "", fmt.Errorf("failed to locate data directory: %w", err)
+	}
+	return ensure(dir, "data")
+}
+
+// Cache returns the directory of files that can be thrown away, such as
+// the encrypted media cache, created like Data
+func Cache() (string, error) {
+	dir, err := cacheDir()
+	if err != nil {
+		return "", fmt.Errorf("failed to locate cache directory: %w", err)
+	}
+	return ensure(dir, "cache")
+}
+
+// Logs returns the directory of log files and crash reports, created like
+// Data
+func Logs() (string, error) {
+	dir, err := logDir()
+	if err != nil {
+		return "", fmt.Errorf("failed to locate log directory: %w", err)
+	}
+	return ensure(dir, "log")
+}
+
+// ensure creates dir, of the given kind, readable only by us
+func ensure(dir, kind string) (string, error) {
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		return "", fmt.Errorf("failed to create %s directory %s: %w", kind, dir, err)
+	}
+	return dir, nil
+}
@@ -0,0 +1,30 @@
+//go:build darwin
+
+package paths
+
+import (
+	"os"
+	"path/filepath"
+)
+
+// dataDir is ~/Library/Application Support/execp2p, next to the config
+func dataDir() (string, error) {
+	return Config()
+}
+
+// cacheDir is ~/Library/Caches/execp2p
+func cacheDir() (string, error) {
+	base, err := os.UserCacheDir()
+	return filepath.Join(base, appName), err
+}
+
+// logDir is ~/Library/Logs/execp2p
+func logDir() (string, error) {
+	home, err := os.UserHomeDir()
+	return filepath.Join(home, "Library", "Logs", appName), err
+}
+
+// legacyLogs lists log files of older versions, outside the log directory
+func legacyLogs() []string {
+	return nil
+}
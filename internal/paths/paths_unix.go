@@ -0,0 +1,48 @@
+//go:build !windows && !darwin
+
+package paths
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+)
+
+// dataDir is $XDG_DATA_HOME/execp2p, ~/.local/share/execp2p by default
+func dataDir() (string, error) {
+	base, err := xdgDir("XDG_DATA_HOME", ".local/share")
+	return filepath.Join(base, appName), err
+}
+
+// cacheDir is $XDG_CACHE_HOME/execp2p, ~/.cache/execp2p by default
+func cacheDir() (string, error) {
+	base, err := os.UserCacheDir()
+	return filepath.Join(base, appName), err
+}
+
+// logDir is $XDG_STATE_HOME/execp2p, ~/.local/state/execp2p by default
+func logDir() (string, error) {
+	base, err := xdgDir("XDG_STATE_HOME", ".local/state")
+	return filepath.Join(base, appName), err
+}
+
+// xdgDir returns the base directory named by env, or fallback in the home
+// directory; relative paths in env are ignored, as the spec asks
+func xdgDir(env, fallback string) (string, error) {
+	if dir := os.Getenv(env); filepath.IsAbs(dir) {
+		return dir, nil
+	}
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return "", err
+	}
+	if home == "" {
+		return "", errors.New("$HOME is not defined")
+	}
+	return filepath.Join(home, filepath.FromSlash(fallback)), nil
+}
+
+// legacyLogs lists log files of older versions, outside the log directory
+func legacyLogs() []string {
+	return nil
+}
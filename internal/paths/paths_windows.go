@@ -0,0 +1,36 @@
+//go:build windows
+
+package paths
+
+import (
+	"os"
+	"path/filepath"
+)
+
+// dataDir is %AppData%\execp2p, next to the config, so it roams with the
+// user's profile
+func dataDir() (string, error) {
+	return Config()
+}
+
+// cacheDir is %LocalAppData%\execp2p\cache, which doesn't roam
+func cacheDir() (string, error) {
+	base, err := os.UserCacheDir()
+	return filepath.Join(base, appName, "cache"), err
+}
+
+// logDir is %LocalAppData%\execp2p\logs
+func logDir() (string, error) {
+	base, err := os.UserCacheDir()
+	return filepath.Join(base, appName, "logs"), err
+}
+
+// legacyLogs lists log files of older versions, outside the log directory:
+// the debug log once written to the profile directory
+func legacyLogs() []string {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return nil
+	}
+	return []string{filepath.Join(home, "execp2p_debug.log")}
+}
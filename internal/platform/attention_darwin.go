@@ -0,0 +1,47 @@
+//go:build darwin
+
+package platform
+
+/*
+#cgo CFLAGS: -x objective-c
+#cgo LDFLAGS: -framework Cocoa
+#include <stdlib.h>
+#import <Cocoa/Cocoa.h>
+
+static void requestAttention(void) {
+	dispatch_async(dispatch_get_main_queue(), ^{
+		[NSApp requestUserAttention:NSInformationalRequest];
+	});
+}
+
+static void setBadge(const char *label) {
+	NSString *text = label ? [NSString stringWithUTF8String:label] : nil;
+	dispatch_async(dispatch_get_main_queue(), ^{
+		[[NSApp dockTile] setBadgeLabel:text];
+	});
+}
+*/
+import "C"
+
+import (
+	"strconv"
+	"unsafe"
+)
+
+// RequestAttention bounces our Dock icon once
+func RequestAttention() error {
+	C.requestAttention()
+	return nil
+}
+
+// SetBadge shows count on our Dock icon, nothing for 0
+func SetBadge(count int) error {
+	if count <= 0 {
+		C.setBadge(nil)
+		return nil
+	}
+	label := C.CString(strconv.Itoa(count))
+	defer C.free(unsafe.Pointer(label))
+	C.setBadge(label)
+	return nil
+}
@@ -0,0 +1,46 @@
+//go:build !windows && !darwin
+
+package platform
+
+import (
+	"errors"
+	"os"
+	"os/exec"
+	"strconv"
+	"strings"
+)
+
+// RequestAttention asks the window manager to mark our window as wanting
+// attention, through wmctrl; X11 only
+func RequestAttention() error {
+	wmctrl, err := exec.LookPath("wmctrl")
+	if err != nil {
+		return errors.ErrUnsupported
+	}
+	// window ID, desktop, PID, host and title
+	out, err := exec.Command(wmctrl, "-l", "-p").Output()
+	if err != nil {
+		return err
+	}
+	pid := strconv.Itoa(os.Getpid())
+	found := false
+	for _, line := range strings.Split(string(out), "\n") {
+		fields := strings.Fields(line)
+		if len(fields) < 3 || fields[2] != pid {
+			continue
+		}
+		found = true
+		if err := exec.Command(wmctrl, "-i", "-r", fields[0], "-b", "add,demands_attention").Run(); err != nil {
+			return err
+		}
+	}
+	if !found {
+		return errors.New("no window to mark")
+	}
+	return nil
+}
+
+// SetBadge does nothing here; the window title carries the count
+func SetBadge(count int) error {
+	return errors.ErrUnsupported
+}
@@ -0,0 +1,44 @@
+package platform
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+)
+
+// AutostartMode is what starts at login
+type AutostartMode string
+
+const (
+	// the GUI, with its window minimized
+	AutostartGUI AutostartMode = "gui"
+	// the background daemon with its local API, without a window
+	AutostartDaemon AutostartMode = "daemon"
+)
+
+// autostartCommand returns the command line started at login in mode
+func autostartCommand(mode AutostartMode) ([]string, error) {
+	exe, err := os.Executable()
+	if err != nil {
+		return nil, fmt.Errorf("failed to locate the executable: %w", err)
+	}
+	if resolved, err := filepath.EvalSymlinks(exe); err == nil {
+		exe = resolved
+	}
+	switch mode {
+	case AutostartGUI:
+		return []string{exe, "--minimized"}, nil
+	case AutostartDaemon:
+		return []string{exe, "daemon"}, nil
+	}
+	return nil, fmt.Errorf("unknown autostart mode %q", mode)
+}
+
+// autostartModeOf tells the mode of a registered command line
+func autostartModeOf(args []string) AutostartMode {
+	if len(args) > 1 && slices.Contains(args[1:], "daemon") {
+		return AutostartDaemon
+	}
+	return AutostartGUI
+}
@@ -0,0 +1,89 @@
+//go:build darwin
+
+package platform
+
+import (
+	"bytes"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+// launchd label of the login item
+const autostartLabel = "execp2p.autostart"
+
+// autostartFile returns the LaunchAgent that starts ExecP2P at login
+func autostartFile() (string, error) {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return "", fmt.Errorf("failed to locate home directory: %w", err)
+	}
+	return filepath.Join(home, "Library", "LaunchAgents", autostartLabel+".plist"), nil
+}
+
+// Autostart returns what starts at login, empty when nothing does
+func Autostart() (AutostartMode, error) {
+	path, err := autostartFile()
+	if err != nil {
+		return "", err
+	}
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return "", nil
+	}
+	if err != nil {
+		return "", fmt.Errorf("failed to read launch agent: %w", err)
+	}
+	if bytes.Contains(data, []byte("<string>daemon</string>")) {
+		return AutostartDaemon, nil
+	}
+	return AutostartGUI, nil
+}
+
+// EnableAutostart starts ExecP2P at login in mode, through a LaunchAgent
+func EnableAutostart(mode AutostartMode) error {
+	args, err := autostartCommand(mode)
+	if err != nil {
+		return err
+	}
+	path, err := autostartFile()
+	if err != nil {
+		return err
+	}
+	var b bytes.Buffer
+	b.WriteString(xml.Header)
+	b.WriteString(`<!DOCTYPE plist PUBLIC "-//Apple//DTD PLIST 1.0//EN" "http://www.apple.com/DTDs/PropertyList-1.0.dtd">` + "\n")
+	b.WriteString("<plist version=\"1.0\">\n<dict>\n")
+	b.WriteString("\t<key>Label</key>\n\t<string>" + autostartLabel + "</string>\n")
+	b.WriteString("\t<key>ProgramArguments</key>\n\t<array>\n")
+	for _, arg := range args {
+		b.WriteString("\t\t<string>")
+		xml.EscapeText(&b, []byte(arg))
+		b.WriteString("</string>\n")
+	}
+	b.WriteString("\t</array>\n")
+	b.WriteString("\t<key>RunAtLoad</key>\n\t<true/>\n")
+	b.WriteString("\t<key>ProcessType</key>\n\t<string>Interactive</string>\n")
+	b.WriteString("</dict>\n</plist>\n")
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return fmt.Errorf("failed to create LaunchAgents directory: %w", err)
+	}
+	if err := os.WriteFile(path, b.Bytes(), 0o644); err != nil {
+		return fmt.Errorf("failed to write launch agent: %w", err)
+	}
+	return nil
+}
+
+// DisableAutostart stops ExecP2P from starting at login
+func DisableAutostart() error {
+	path, err := autostartFile()
+	if err != nil {
+		return err
+	}
+	if err := os.Remove(path); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return fmt.Errorf("failed to remove launch agent: %w", err)
+	}
+	return nil
+}
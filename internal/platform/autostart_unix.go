@@ -0,0 +1,113 @@
+//go:build !windows && !darwin
+
+package platform
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// autostartFile returns the XDG autostart entry of ExecP2P
+func autostartFile() (string, error) {
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return "", fmt.Errorf("failed to locate user config directory: %w", err)
+	}
+	return filepath.Join(dir, "autostart", "execp2p.desktop"), nil
+}
+
+// Autostart returns what starts at login, empty when nothing does
+func Autostart() (AutostartMode, error) {
+	path, err := autostartFile()
+	if err != nil {
+		return "", err
+	}
+	f, err := os.Open(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return "", nil
+	}
+	if err != nil {
+		return "", fmt.Errorf("failed to read autostart entry: %w", err)
+	}
+	defer f.Close()
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		if exec, ok := strings.CutPrefix(scanner.Text(), "Exec="); ok {
+			return autostartModeOf(strings.Fields(exec)), nil
+		}
+	}
+	return "", scanner.Err()
+}
+
+// EnableAutostart starts ExecP2P at login in mode, through an XDG
+// autostart entry
+func EnableAutostart(mode AutostartMode) error {
+	args, err := autostartCommand(mode)
+	if err != nil {
+		return err
+	}
+	path, err := autostartFile()
+	if err != nil {
+		return err
+	}
+	quoted := make([]string, len(args))
+	for i, arg := range args {
+		quoted[i] = desktopQuote(arg)
+	}
+	entry := "[Desktop Entry]\n" +
+		"Type=Application\n" +
+		"Name=ExecP2P\n" +
+		"Comment=Post-quantum end-to-end encrypted chat\n" +
+		"Exec=" + strings.Join(quoted, " ") + "\n" +
+		"Terminal=false\n" +
+		"X-GNOME-Autostart-enabled=true\n"
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return fmt.Errorf("failed to create autostart directory: %w", err)
+	}
+	if err := os.WriteFile(path, []byte(entry), 0o644); err != nil {
+		return fmt.Errorf("failed to write autostart entry: %w", err)
+	}
+	return nil
+}
+
+// DisableAutostart stops ExecP2P from starting at login
+func DisableAutostart() error {
+	path, err := autostartFile()
+	if err != nil {
+		return err
+	}
+	if err := os.Remove(path); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return fmt.Errorf("failed to remove autostart entry: %w", err)
+	}
+	return nil
+}
+
+// desktopQuote quotes an argument of a desktop entry's Exec key: reserved
+// characters are escaped inside double quotes, and backslashes once more
+// for the string value the key is
+func desktopQuote(arg string) string {
+	if arg != "" && !strings.ContainsAny(arg, " \t\n\"'\\><~|&;$*?#()`=%") {
+		return arg
+	}
+	var b strings.Builder
+	b.WriteByte('"')
+	for _, r := range arg {
+		switch r {
+		case '"', '`', '$':
+			b.WriteString(`\\`)
+		case '\\':
+			b.WriteString(`\\\`)
+		}
+		if r == '%' {
+			b.WriteString("%%")
+			continue
+		}
+		b.WriteRune(r)
+	}
+	b.WriteByte('"')
+	return b.String()
+}
@@ -0,0 +1,77 @@
+//go:build windows
+
+package platform
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"golang.org/x/sys/windows"
+	"golang.org/x/sys/windows/registry"
+)
+
+const (
+	// the per-user programs started at login
+	runKey = `Software\Microsoft\Windows\CurrentVersion\Run`
+	// our value under runKey
+	runValue = "ExecP2P"
+)
+
+// Autostart returns what starts at login, empty when nothing does
+func Autostart() (AutostartMode, error) {
+	k, err := registry.OpenKey(registry.CURRENT_USER, runKey, registry.QUERY_VALUE)
+	if errors.Is(err, registry.ErrNotExist) {
+		return "", nil
+	}
+	if err != nil {
+		return "", fmt.Errorf("failed to open the Run key: %w", err)
+	}
+	defer k.Close()
+	cmdline, _, err := k.GetStringValue(runValue)
+	if errors.Is(err, registry.ErrNotExist) {
+		return "", nil
+	}
+	if err != nil {
+		return "", fmt.Errorf("failed to read the Run value: %w", err)
+	}
+	return autostartModeOf(strings.Fields(cmdline)), nil
+}
+
+// EnableAutostart starts ExecP2P at login in mode, through the user's Run
+// key
+func EnableAutostart(mode AutostartMode) error {
+	args, err := autostartCommand(mode)
+	if err != nil {
+		return err
+	}
+	quoted := make([]string, len(args))
+	for i, arg := range args {
+		quoted[i] = windows.EscapeArg(arg)
+	}
+	k, _, err := registry.CreateKey(registry.CURRENT_USER, runKey, registry.SET_VALUE)
+	if err != nil {
+		return fmt.Errorf("failed to open the Run key: %w", err)
+	}
+	defer k.Close()
+	if err := k.SetStringValue(runValue, strings.Join(quoted, " ")); err != nil {
+		return fmt.Errorf("failed to write the Run value: %w", err)
+	}
+	return nil
+}
+
+// DisableAutostart stops ExecP2P from starting at login
+func DisableAutostart() error {
+	k, err := registry.OpenKey(registry.CURRENT_USER, runKey, registry.SET_VALUE)
+	if errors.Is(err, registry.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to open the Run key: %w", err)
+	}
+	defer k.Close()
+	if err := k.DeleteValue(runValue); err != nil && !errors.Is(err, registry.ErrNotExist) {
+		return fmt.Errorf("failed to remove the Run value: %w", err)
+	}
+	return nil
+}
@@ -5,7 +5,10 @@ import (
 	"log"
 	"net"
 	"os"
+	"path/filepath"
 	"runtime"
+
+	"execp2p/internal/paths"
 )
 
 // IsWindows returns true if running on Windows
@@ -57,8 +60,12 @@ func InitPlatform() error {
 
 // Windows-specific initialization
 func initWindows() error {
-	// Create debug log file in a known location
-	logFile, err := os.Create(os.ExpandEnv("%USERPROFILE%\\execp2p_debug.log"))
+	// Create debug log file in the log directory
+	dir, err := paths.Logs()
+	if err != nil {
+		return err
+	}
+	logFile, err := os.Create(filepath.Join(dir, "debug.log"))
 	if err != nil {
 		return fmt.Errorf("failed to create debug log file: %w", err)
 	}
@@ -0,0 +1,102 @@
+// Package profile keeps the signed profiles of the people we met, by
+// identity fingerprint, so their avatar and status are known before they
+// connect again. Only profiles whose signature was checked are put here.
+package profile
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"unicode/utf8"
+
+	"execp2p/internal/crypto"
+	"execp2p/internal/logger"
+	"execp2p/internal/storage"
+)
+
+// BucketName is the storage bucket profiles are kept in
+const BucketName = "profiles"
+
+// MaxStatusLength caps the status text, in characters
+const MaxStatusLength = 80
+
+// ErrStale is returned for a profile older than the one already cached
+var ErrStale = errors.New("profile is older than the cached one")
+
+// Store keeps profiles across restarts, one key per fingerprint.
+// *storage.Bucket is one.
+type Store interface {
+	PutJSON(key string, v interface{}) error
+	GetJSON(key string, v interface{}) (bool, error)
+	Delete(key string) error
+}
+
+// Cache is safe for concurrent use. While an incognito room is active the
+// encrypted database refuses writes and profiles stay in memory.
+type Cache struct {
+	mu       sync.RWMutex
+	profiles map[string]*crypto.Profile
+	store    Store
+}
+
+// NewCache returns a cache backed by store, which may be nil
+func NewCache(store Store) *Cache {
+	return &Cache{profiles: make(map[string]*crypto.Profile), store: store}
+}
+
+// Get returns the profile of the identity with the given fingerprint
+func (c *Cache) Get(fingerprint string) (*crypto.Profile, bool) {
+	c.mu.RLock()
+	p, ok := c.profiles[fingerprint]
+	c.mu.RUnlock()
+	if ok || c.store == nil || fingerprint == "" {
+		return p, ok
+	}
+
+	var stored crypto.Profile
+	if ok, err := c.store.GetJSON(fingerprint, &stored); err != nil || !ok {
+		if err != nil {
+			logger.L().Warn("Dropping unreadable cached profile", "fingerprint", fingerprint, "err", err)
+			c.store.Delete(fingerprint)
+		}
+		return nil, false
+	}
+	if stored.Fingerprint != fingerprint {
+		c.store.Delete(fingerprint)
+		return nil, false
+	}
+	c.mu.Lock()
+	c.profiles[fingerprint] = &stored
+	c.mu.Unlock()
+	return &stored, true
+}
+
+// Put caches a verified profile. A profile older than the cached one of the
+// same identity is refused with ErrStale, so a replayed profile can't undo a
+// change.
+func (c *Cache) Put(p *crypto.Profile) error {
+	if cached, ok := c.Get(p.Fingerprint); ok && p.UpdatedAt.Before(cached.UpdatedAt) {
+		return ErrStale
+	}
+	c.mu.Lock()
+	c.profiles[p.Fingerprint] = p
+	c.mu.Unlock()
+
+	if c.store == nil {
+		return nil
+	}
+	if err := c.store.PutJSON(p.Fingerprint, p); err != nil && !errors.Is(err, storage.ErrIncognito) {
+		logger.L().Warn("Failed to store profile", "fingerprint", p.Fingerprint, "err", err)
+	}
+	return nil
+}
+
+// CleanStatus trims a status text and checks its length
+func CleanStatus(status string) (string, error) {
+	status = strings.Join(strings.Fields(status), " ")
+	if utf8.RuneCountInString(status) > MaxStatusLength {
+		return "", fmt.Errorf("status text is longer than %d characters", MaxStatusLength)
+	}
+	return status, nil
+}
@@ -0,0 +1,162 @@
+// Package rejoin keeps the rooms the user is in, with what it takes to enter
+// them again (room ID, access key, where the host was reached), so they can
+// be restored when the application starts.
+package rejoin
+
+import (
+	"errors"
+	"slices"
+	"sync"
+	"time"
+
+	"execp2p/internal/logger"
+	"execp2p/internal/storage"
+)
+
+// BucketName is the storage bucket the rooms are kept in
+const BucketName = "rooms"
+
+// maxAddresses is how many host addresses are kept per room
+const maxAddresses = 4
+
+// Room is a room to enter again
+type Room struct {
+	RoomID    string `json:"room_id"`
+	AccessKey string `json:"access_key"`
+	Name      string `json:"name,omitempty"`
+	// created by us: entering it again means hosting it again
+	Host bool `json:"host"`
+	// host: the port guests reached us on
+	Port int `json:"port,omitempty"`
+	// guest: where the host was reached, latest first
+	Addresses []string `json:"addresses,omitempty"`
+	// host: when the room closes by itself, zero never
+	ExpiresAt   time.Time     `json:"expires_at,omitempty"`
+	IdleTimeout time.Duration `json:"idle_timeout,omitempty"`
+	// when we last entered it
+	EnteredAt time.Time `json:"entered_at"`
+}
+
+// Store keeps the rooms across restarts, one key per room.
+// *storage.Bucket is one.
+type Store interface {
+	PutJSON(key string, v interface{}) error
+	GetJSON(key string, v interface{}) (bool, error)
+	Delete(key string) error
+	Keys() []string
+}
+
+// List is safe for concurrent use. Rooms are kept in memory and, when a
+// store is given, written to it on every change; while an incognito room is
+// active the encrypted database refuses writes and they stay in memory.
+type List struct {
+	mu    sync.Mutex
+	rooms map[string]Room
+	store Store
+}
+
+// New returns the rooms found in store, which may be nil
+func New(store Store) *List {
+	l := &List{rooms: make(map[string]Room), store: store}
+	if store == nil {
+		return l
+	}
+	for _, roomID := range store.Keys() {
+		var r Room
+		if ok, err := store.GetJSON(roomID, &r); err != nil || !ok || r.AccessKey == "" {
+			logger.L().Warn("Dropping unreadable saved room", "room_id", roomID, "err", err)
+			store.Delete(roomID)
+			continue
+		}
+		l.rooms[roomID] = r
+	}
+	return l
+}
+
+// Save keeps r, replacing what was kept of the room. The host addresses
+// already known are kept after the ones r brings.
+func (l *List) Save(r Room) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	old, known := l.rooms[r.RoomID]
+	if known {
+		r.Addresses = mergeAddresses(r.Addresses, old.Addresses)
+		if r.EnteredAt.IsZero() {
+			r.EnteredAt = old.EnteredAt
+		}
+	}
+	if r.EnteredAt.IsZero() {
+		r.EnteredAt = time.Now()
+	}
+	if known && equal(old, r) {
+		return
+	}
+	l.rooms[r.RoomID] = r
+	l.save(r.RoomID)
+}
+
+// Forget drops a room; it won't be entered again
+func (l *List) Forget(roomID string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if _, ok := l.rooms[roomID]; !ok {
+		return
+	}
+	delete(l.rooms, roomID)
+	l.save(roomID)
+}
+
+// Get returns what is kept of a room
+func (l *List) Get(roomID string) (Room, bool) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	r, ok := l.rooms[roomID]
+	return r, ok
+}
+
+// Rooms returns the rooms, the one entered first first
+func (l *List) Rooms() []Room {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	rooms := make([]Room, 0, len(l.rooms))
+	for _, r := range l.rooms {
+		rooms = append(rooms, r)
+	}
+	slices.SortFunc(rooms, func(a, b Room) int { return a.EnteredAt.Compare(b.EnteredAt) })
+	return rooms
+}
+
+// save writes a room's entry to the store; l.mu must be held
+func (l *List) save(roomID string) {
+	if l.store == nil {
+		return
+	}
+	var err error
+	if r, ok := l.rooms[roomID]; ok {
+		err = l.store.PutJSON(roomID, r)
+	} else {
+		err = l.store.Delete(roomID)
+	}
+	if err != nil && !errors.Is(err, storage.ErrIncognito) {
+		logger.L().Warn("Failed to store the saved room", "room_id", roomID, "err", err)
+	}
+}
+
+// mergeAddresses puts latest before earlier, without repeats, up to
+// maxAddresses
+func mergeAddresses(latest, earlier []string) []string {
+	merged := make([]string, 0, maxAddresses)
+	for _, addr := range slices.Concat(latest, earlier) {
+		if addr != "" && !slices.Contains(merged, addr) && len(merged) < maxAddresses {
+			merged = append(merged, addr)
+		}
+	}
+	return merged
+}
+
+func equal(a, b Room) bool {
+	return a.AccessKey == b.AccessKey && a.Name == b.Name && a.Host == b.Host && a.Port == b.Port &&
+		slices.Equal(a.Addresses, b.Addresses) && a.ExpiresAt.Equal(b.ExpiresAt) &&
+		a.IdleTimeout == b.IdleTimeout && a.EnteredAt.Equal(b.EnteredAt)
+}
@@ -0,0 +1,59 @@
+package room
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"net/url"
+	"strings"
+)
+
+// InviteScheme is the URL scheme of invite links
+const InviteScheme = "execp2p"
+
+// Invite is what joining a room takes, as an invite link carries it:
+// execp2p://join/<room-id>?key=<access-key>&addr=<host:port>
+type Invite struct {
+	RoomID    string `json:"room_id"`
+	AccessKey string `json:"access_key"`
+	// host address, empty to look the host up
+	Address string `json:"address,omitempty"`
+}
+
+// Link returns the invite as an execp2p:// link
+func (i Invite) Link() string {
+	query := url.Values{"key": {i.AccessKey}}
+	if i.Address != "" {
+		query.Set("addr", i.Address)
+	}
+	u := url.URL{Scheme: InviteScheme, Host: "join", Path: "/" + i.RoomID, RawQuery: query.Encode()}
+	return u.String()
+}
+
+// ParseInvite reads an invite link
+func ParseInvite(link string) (Invite, error) {
+	u, err := url.Parse(strings.TrimSpace(link))
+	if err != nil {
+		return Invite{}, fmt.Errorf("invalid invite link: %w", err)
+	}
+	if !strings.EqualFold(u.Scheme, InviteScheme) || u.Host != "join" {
+		return Invite{}, errors.New("not an execp2p://join/ invite link")
+	}
+	invite := Invite{
+		RoomID:    strings.Trim(u.Path, "/"),
+		AccessKey: u.Query().Get("key"),
+		Address:   u.Query().Get("addr"),
+	}
+	if !ValidateRoomID(invite.RoomID) {
+		return Invite{}, fmt.Errorf("invalid room ID in invite link: %q", invite.RoomID)
+	}
+	if invite.AccessKey == "" {
+		return Invite{}, errors.New("invite link has no access key")
+	}
+	if invite.Address != "" {
+		if _, _, err := net.SplitHostPort(invite.Address); err != nil {
+			return Invite{}, fmt.Errorf("invalid host address in invite link: %w", err)
+		}
+	}
+	return invite, nil
+}
@@ -7,6 +7,8 @@ import (
 	"fmt"
 	"strings"
 
+	"execp2p/internal/logger"
+
 	"github.com/btcsuite/btcutil/base58"
 )
 
@@ -28,6 +30,7 @@ type Room struct {
 	IsPrivate   bool   `json:"is_private"`
 	AccessKey   string `json:"access_key,omitempty"`  // Klucz dostępu do pokoju
 	ListenPort  int    `json:"listen_port,omitempty"` // Port, na którym nasłuchuje host pokoju
+	Incognito   bool   `json:"incognito,omitempty"`   // Pokój tylko w pamięci, nic nie trafia na dysk
 }
 
 // GenerateRoomID creates a cryptographically secure room ID
@@ -166,8 +169,12 @@ func (r *Room) ValidateAccessKey(key string) bool {
 	return r.AccessKey == key
 }
 
-// GetShortID returns a shortened version of the room ID for display
+// GetShortID returns a shortened version of the room ID for display. An
+// incognito room's is the redaction token: logs redact only whole IDs.
 func (r *Room) GetShortID() string {
+	if r.Incognito {
+		return logger.Redacted
+	}
 	if len(r.ID) > 16 {
 		return r.ID[:8] + "..." + r.ID[len(r.ID)-8:]
 	}
@@ -0,0 +1,50 @@
+package room
+
+import (
+	"bytes"
+	"log/slog"
+	"os"
+	"strings"
+	"testing"
+
+	"execp2p/internal/logger"
+)
+
+// nothing of an incognito room's ID reaches the logs, short form included
+func TestShortIDIncognito(t *testing.T) {
+	var buf bytes.Buffer
+	prev := logger.L()
+	logger.SetOutput(&buf)
+	logger.SetLevel(slog.LevelDebug)
+	t.Cleanup(func() {
+		logger.SetOutput(os.Stdout)
+		logger.Set(prev)
+	})
+
+	r, err := NewRoom("test", "", 2, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	r.Incognito = true
+	logger.Redact(r.ID)
+	t.Cleanup(func() { logger.Unredact(r.ID) })
+
+	logger.L().Info("Room "+r.GetShortID(), "room", r.GetShortID(), "room_id", r.ID)
+
+	out := buf.String()
+	random := strings.TrimPrefix(r.ID, RoomIDPrefix)
+	for _, fragment := range []string{random[:8], random[len(random)-8:]} {
+		if strings.Contains(out, fragment) {
+			t.Errorf("log holds %q of the room ID: %s", fragment, out)
+		}
+	}
+	if !strings.Contains(out, logger.Redacted) {
+		t.Errorf("log doesn't show %s: %s", logger.Redacted, out)
+	}
+
+	// other rooms keep their short ID
+	r.Incognito = false
+	if got := r.GetShortID(); !strings.HasSuffix(got, random[len(random)-8:]) {
+		t.Errorf("short ID %q", got)
+	}
+}
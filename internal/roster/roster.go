@@ -0,0 +1,198 @@
+// Package roster keeps the room's member list with nicknames. Nicknames are
+// chosen freely, so two members may pick the same one; the roster then adds a
+// short discriminator derived from each member's identity fingerprint
+// ("Ala#3f9c") so messages are never attributed ambiguously.
+package roster
+
+import (
+	"sort"
+	"strings"
+	"sync"
+	"unicode/utf8"
+)
+
+// DefaultNickname is shown for members who haven't picked a nickname
+const DefaultNickname = "Użytkownik"
+
+// MaxNicknameLength caps nicknames, in characters
+const MaxNicknameLength = 32
+
+// minDiscriminator is the shortest discriminator used, in hex characters
+const minDiscriminator = 4
+
+// Member is one room participant
+type Member struct {
+	PeerID      string
+	Nickname    string
+	Fingerprint string
+	Local       bool
+}
+
+// Entry is a member with the name to display for it
+type Entry struct {
+	Member
+	DisplayName string
+	// whether the display name carries a discriminator
+	Disambiguated bool
+}
+
+// Roster is safe for concurrent use
+type Roster struct {
+	mu      sync.RWMutex
+	members map[string]*Member
+}
+
+// New returns an empty roster
+func New() *Roster {
+	return &Roster{members: make(map[string]*Member)}
+}
+
+// Upsert adds a member or updates its fingerprint and locality, keeping the
+// nickname
+func (r *Roster) Upsert(peerID, fingerprint string, local bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	m, ok := r.members[peerID]
+	if !ok {
+		m = &Member{PeerID: peerID, Nickname: DefaultNickname}
+		r.members[peerID] = m
+	}
+	if fingerprint != "" {
+		m.Fingerprint = fingerprint
+	}
+	m.Local = local
+}
+
+// SetNickname sets a member's nickname, adding the member if needed, and
+// returns the display name it ends up with
+func (r *Roster) SetNickname(peerID, nickname string) string {
+	r.mu.Lock()
+	m, ok := r.members[peerID]
+	if !ok {
+		m = &Member{PeerID: peerID}
+		r.members[peerID] = m
+	}
+	m.Nickname = CleanNickname(nickname)
+	r.mu.Unlock()
+
+	return r.DisplayName(peerID)
+}
+
+// Remove drops a member
+func (r *Roster) Remove(peerID string) {
+	r.mu.Lock()
+	delete(r.members, peerID)
+	r.mu.Unlock()
+}
+
+// Retain drops every non-local member not in peerIDs
+func (r *Roster) Retain(peerIDs []string) {
+	keep := make(map[string]bool, len(peerIDs))
+	for _, id := range peerIDs {
+		keep[id] = true
+	}
+	r.mu.Lock()
+	for id, m := range r.members {
+		if !m.Local && !keep[id] {
+			delete(r.members, id)
+		}
+	}
+	r.mu.Unlock()
+}
+
+// Nickname returns the nickname a member chose, without a discriminator
+func (r *Roster) Nickname(peerID string) string {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	if m, ok := r.members[peerID]; ok && m.Nickname != "" {
+		return m.Nickname
+	}
+	return DefaultNickname
+}
+
+// DisplayName returns the unambiguous name of a member; unknown members get
+// the default nickname with their discriminator
+func (r *Roster) DisplayName(peerID string) string {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	m, ok := r.members[peerID]
+	if !ok {
+		src := discriminatorSource(&Member{PeerID: peerID})
+		return DefaultNickname + "#" + src[:min(minDiscriminator, len(src))]
+	}
+	name, _ := r.displayNameLocked(m)
+	return name
+}
+
+// Entries returns all members ordered by display name
+func (r *Roster) Entries() []Entry {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	entries := make([]Entry, 0, len(r.members))
+	for _, m := range r.members {
+		name, disambiguated := r.displayNameLocked(m)
+		entries = append(entries, Entry{Member: *m, DisplayName: name, Disambiguated: disambiguated})
+	}
+	sort.Slice(entries, func(i, j int) bool {
+		if entries[i].DisplayName != entries[j].DisplayName {
+			return entries[i].DisplayName < entries[j].DisplayName
+		}
+		return entries[i].PeerID < entries[j].PeerID
+	})
+	return entries
+}
+
+// displayNameLocked appends the shortest discriminator that tells m apart
+// from every other member with the same nickname
+func (r *Roster) displayNameLocked(m *Member) (string, bool) {
+	var clashing []*Member
+	for _, other := range r.members {
+		if other != m && strings.EqualFold(other.Nickname, m.Nickname) {
+			clashing = append(clashing, other)
+		}
+	}
+	if len(clashing) == 0 {
+		return m.Nickname, false
+	}
+
+	own := discriminatorSource(m)
+	n := minDiscriminator
+	for _, other := range clashing {
+		theirs := discriminatorSource(other)
+		for n < len(own) && n <= len(theirs) && own[:n] == theirs[:n] {
+			n++
+		}
+	}
+	return m.Nickname + "#" + own[:min(n, len(own))], true
+}
+
+// discriminatorSource is the fingerprint, or the peer ID before the
+// fingerprint is known
+func discriminatorSource(m *Member) string {
+	if m.Fingerprint != "" {
+		return strings.ToLower(m.Fingerprint)
+	}
+	return strings.ToLower(m.PeerID)
+}
+
+// CleanNickname trims a nickname, strips the discriminator separator and
+// control characters and caps the length; empty becomes DefaultNickname
+func CleanNickname(nickname string) string {
+	nickname = strings.Map(func(r rune) rune {
+		if r == '#' || r < 0x20 || r == 0x7f {
+			return -1
+		}
+		return r
+	}, nickname)
+	nickname = strings.TrimSpace(nickname)
+	if utf8.RuneCountInString(nickname) > MaxNicknameLength {
+		nickname = string([]rune(nickname)[:MaxNicknameLength])
+	}
+	if nickname == "" {
+		return DefaultNickname
+	}
+	return nickname
+}
@@ -0,0 +1,28 @@
+package selftest
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestRunRotationCheck(t *testing.T) {
+	if testing.Short() {
+		t.Skip("opens QUIC connections on the loopback interface")
+	}
+
+	report, err := RunRotationCheck(context.Background(), RotationOptions{
+		Messages:  20,
+		Rotations: 3,
+		Timeout:   30 * time.Second,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if report.Received != 40 {
+		t.Errorf("received %d messages, want 40", report.Received)
+	}
+	if report.Rotations != 3 {
+		t.Errorf("performed %d rotations, want 3", report.Rotations)
+	}
+}
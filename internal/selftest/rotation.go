@@ -0,0 +1,297 @@
+// Package selftest runs in-process integration checks of the secure channel:
+// two peers talk over real QUIC connections on the loopback interface and
+// the results are verified end to end.
+package selftest
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"net"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"execp2p/internal/crypto"
+	"execp2p/internal/network"
+	"execp2p/internal/room"
+)
+
+// RotationOptions configures RunRotationCheck
+type RotationOptions struct {
+	// messages sent in each direction
+	Messages int
+	// key rotations performed while sending, alternating between the peers
+	Rotations int
+	// overall deadline for the check
+	Timeout time.Duration
+}
+
+// RotationReport summarizes a successful check
+type RotationReport struct {
+	Sent      int
+	Received  int
+	Rotations int
+	Duration  time.Duration
+}
+
+// peer is one side of the conversation
+type peer struct {
+	name string
+	pq   *crypto.PQCrypto
+	net  *network.QuicNetwork
+	// a value for each key exchange of the other side processed
+	keyed chan struct{}
+	// messages from the other side received intact so far
+	received atomic.Int64
+}
+
+// RunRotationCheck connects two peers, exchanges messages in both
+// directions while keys are rotated mid-stream and verifies every message
+// decrypts on the other side, intact and in order.
+func RunRotationCheck(ctx context.Context, opts RotationOptions) (*RotationReport, error) {
+	if opts.Messages <= 0 {
+		opts.Messages = 50
+	}
+	if opts.Rotations < 0 {
+		opts.Rotations = 0
+	}
+	if opts.Timeout <= 0 {
+		opts.Timeout = 60 * time.Second
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, opts.Timeout)
+	defer cancel()
+	started := time.Now()
+
+	port, err := freeUDPPort()
+	if err != nil {
+		return nil, fmt.Errorf("no free port: %w", err)
+	}
+
+	// frames carry the room ID, and peers drop frames whose ID isn't one
+	roomID, err := room.GenerateRoomID()
+	if err != nil {
+		return nil, err
+	}
+
+	host, err := newPeer(ctx, "host", roomID, port, true, "")
+	if err != nil {
+		return nil, err
+	}
+	defer host.net.Stop()
+	if err := host.net.Start(ctx); err != nil {
+		return nil, fmt.Errorf("host failed to start: %w", err)
+	}
+
+	guest, err := newPeer(ctx, "guest", roomID, 0, false, fmt.Sprintf("127.0.0.1:%d", port))
+	if err != nil {
+		return nil, err
+	}
+	defer guest.net.Stop()
+	if err := guest.net.Start(ctx); err != nil {
+		return nil, fmt.Errorf("guest failed to start: %w", err)
+	}
+
+	if err := waitForChannel(ctx, host, guest); err != nil {
+		return nil, err
+	}
+
+	// receivers verify content and order as messages come in
+	var wg sync.WaitGroup
+	recvErrs := make(chan error, 2)
+	for _, pair := range [][2]*peer{{guest, host}, {host, guest}} {
+		from, to := pair[0], pair[1]
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			err := expectMessages(ctx, from, to, opts.Messages)
+			if err != nil {
+				// stop the sender too; its own error would only be the deadline
+				cancel()
+			}
+			recvErrs <- err
+		}()
+	}
+	// a receiver's error says more than whatever the sender ran into after
+	fail := func(err error) (*RotationReport, error) {
+		cancel()
+		wg.Wait()
+		close(recvErrs)
+		for rerr := range recvErrs {
+			if rerr != nil {
+				return nil, rerr
+			}
+		}
+		return nil, err
+	}
+
+	// rotate every `every` messages, alternating sides; the rotation runs
+	// concurrently with sending so some messages are sent mid-rotation. As
+	// with the app's rotation schedule, rotations don't pile up: the next
+	// starts once the previous one has been taken up and everything sent
+	// before it has arrived, since only a few superseded keys are kept for
+	// late messages.
+	every := opts.Messages / (opts.Rotations + 1)
+	if every == 0 {
+		every = 1
+	}
+	rotDone := make(chan error, 1)
+	rotDone <- nil
+	rotations := 0
+
+	for i := 0; i < opts.Messages; i++ {
+		if i > 0 && i%every == 0 && rotations < opts.Rotations {
+			if err := <-rotDone; err != nil {
+				return fail(err)
+			}
+			if err := waitForDelivery(ctx, i, host, guest); err != nil {
+				return fail(err)
+			}
+			rotator, other := host, guest
+			if rotations%2 == 1 {
+				rotator, other = guest, host
+			}
+			rotations++
+			go func(p, other *peer) {
+				rotDone <- rotate(ctx, p, other)
+			}(rotator, other)
+		}
+
+		for _, from := range []*peer{guest, host} {
+			if err := from.net.SendMessage(ctx, messageText(from, i)); err != nil {
+				return fail(fmt.Errorf("%s failed to send message %d: %w", from.name, i, err))
+			}
+		}
+	}
+
+	if err := <-rotDone; err != nil {
+		return fail(err)
+	}
+
+	wg.Wait()
+	close(recvErrs)
+	for err := range recvErrs {
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return &RotationReport{
+		Sent:      2 * opts.Messages,
+		Received:  2 * opts.Messages,
+		Rotations: rotations,
+		Duration:  time.Since(started),
+	}, nil
+}
+
+func newPeer(ctx context.Context, name, roomID string, port int, isListener bool, remoteAddr string) (*peer, error) {
+	pq, err := crypto.NewPQCrypto()
+	if err != nil {
+		return nil, fmt.Errorf("%s crypto: %w", name, err)
+	}
+	// every ForceKeyRotation call must actually rotate
+	pq.SetKeyRotationInterval(0)
+
+	id := make([]byte, 16)
+	if _, err := rand.Read(id); err != nil {
+		return nil, err
+	}
+	qn, err := network.NewQuicNetwork(ctx, hex.EncodeToString(id), roomID, port, pq, isListener, remoteAddr)
+	if err != nil {
+		return nil, fmt.Errorf("%s network: %w", name, err)
+	}
+	p := &peer{name: name, pq: pq, net: qn, keyed: make(chan struct{}, 64)}
+	qn.SetPeerHandler(func(e network.PeerEvent) {
+		if e.Kind == network.PeerVerified {
+			select {
+			case p.keyed <- struct{}{}:
+			default:
+			}
+		}
+	})
+	return p, nil
+}
+
+// waitForChannel blocks until each peer has processed the other's key
+// exchange. Holding a secret isn't enough: the side that initiated has one
+// before the other side has it, and messages sent then would race the key
+// exchange.
+func waitForChannel(ctx context.Context, peers ...*peer) error {
+	for _, p := range peers {
+		select {
+		case <-ctx.Done():
+			return fmt.Errorf("secure channel not established: %w", ctx.Err())
+		case <-p.keyed:
+		}
+	}
+	return nil
+}
+
+// rotate has p rotate its keys and waits until other has taken up the new one
+func rotate(ctx context.Context, p, other *peer) error {
+	rotated, err := p.net.ForceKeyRotation()
+	if err == nil && !rotated {
+		err = fmt.Errorf("rotation was not performed")
+	}
+	if err != nil {
+		return fmt.Errorf("%s key rotation: %w", p.name, err)
+	}
+	select {
+	case <-other.keyed:
+		return nil
+	case <-ctx.Done():
+		return fmt.Errorf("%s never took up the key of %s: %w", other.name, p.name, ctx.Err())
+	}
+}
+
+// waitForDelivery blocks until each peer has received n messages
+func waitForDelivery(ctx context.Context, n int, peers ...*peer) error {
+	ticker := time.NewTicker(5 * time.Millisecond)
+	defer ticker.Stop()
+	for _, p := range peers {
+		for p.received.Load() < int64(n) {
+			select {
+			case <-ctx.Done():
+				return fmt.Errorf("%s received %d of %d messages: %w", p.name, p.received.Load(), n, ctx.Err())
+			case <-ticker.C:
+			}
+		}
+	}
+	return nil
+}
+
+// expectMessages reads n messages sent by from on to's side and checks them
+func expectMessages(ctx context.Context, from, to *peer, n int) error {
+	incoming := to.net.GetIncomingMessages()
+	for i := 0; i < n; i++ {
+		select {
+		case <-ctx.Done():
+			return fmt.Errorf("%s received %d of %d messages from %s: %w", to.name, i, n, from.name, ctx.Err())
+		case payload := <-incoming:
+			want := messageText(from, i)
+			if payload.Message != want {
+				return fmt.Errorf("%s: message %d from %s out of order or corrupted: got %q, want %q", to.name, i, from.name, payload.Message, want)
+			}
+			if payload.Sequence != 0 && payload.Sequence != uint64(i+1) {
+				return fmt.Errorf("%s: message %d from %s has sequence %d", to.name, i, from.name, payload.Sequence)
+			}
+			to.received.Add(1)
+		}
+	}
+	return nil
+}
+
+func messageText(from *peer, i int) string {
+	return fmt.Sprintf("%s message %d", from.name, i)
+}
+
+func freeUDPPort() (int, error) {
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		return 0, err
+	}
+	defer conn.Close()
+	return conn.LocalAddr().(*net.UDPAddr).Port, nil
+}
@@ -0,0 +1,560 @@
+package storage
+
+import (
+	"bufio"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+
+	"execp2p/internal/logger"
+
+	"golang.org/x/crypto/chacha20poly1305"
+	"golang.org/x/crypto/hkdf"
+)
+
+// DirName is the database directory inside the data directory
+const DirName = "store"
+
+// file suffixes of a bucket: the log itself, a compaction being written and
+// a finished compaction waiting to replace the log. The latter two are
+// dot-prefixed so a backup taken meanwhile skips them.
+const (
+	bucketExt  = ".edb"
+	tmpSuffix  = ".tmp"
+	newSuffix  = ".new"
+	headerSize = 4
+)
+
+// a bucket is compacted once most of its records are overwritten or deleted
+const compactMinRecords = 64
+
+var (
+	// ErrClosed is returned by operations on a closed database
+	ErrClosed = errors.New("storage: database closed")
+	// ErrCorrupt means a record failed authentication: wrong key or tampering
+	ErrCorrupt = errors.New("storage: record failed authentication")
+
+	bucketName = regexp.MustCompile(`^[a-z0-9][a-z0-9_.-]{0,63}$`)
+)
+
+// DB is an encrypted key-value store split into named buckets. Each bucket
+// is an append-only log of XChaCha20-Poly1305 sealed records in its own
+// file, replayed into memory when the bucket is opened and compacted when it
+// is mostly garbage. An in-memory DB (OpenMemory) never touches disk.
+//
+// Writes to an on-disk DB are refused with ErrIncognito while an incognito
+// room is active.
+type DB struct {
+	dir string
+	key []byte
+
+	mu      sync.Mutex
+	buckets map[string]*Bucket
+	closed  atomic.Bool
+}
+
+// Open opens (creating if needed) the database in dir. key must be 32 bytes,
+// normally keystore.StorageKey.
+func Open(dir string, key []byte) (*DB, error) {
+	if len(key) != chacha20poly1305.KeySize {
+		return nil, fmt.Errorf("storage: key must be %d bytes", chacha20poly1305.KeySize)
+	}
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		return nil, fmt.Errorf("failed to create storage directory: %w", err)
+	}
+	return &DB{
+		dir:     dir,
+		key:     append([]byte(nil), key...),
+		buckets: make(map[string]*Bucket),
+	}, nil
+}
+
+// OpenMemory returns a database that lives in memory only, used with
+// ephemeral identities
+func OpenMemory() *DB {
+	return &DB{buckets: make(map[string]*Bucket)}
+}
+
+// Persistent reports whether the database is stored on disk
+func (db *DB) Persistent() bool {
+	return db.dir != ""
+}
+
+// Bucket opens a bucket, creating it on first write. Names are lowercase
+// letters, digits, '.', '_' and '-'.
+func (db *DB) Bucket(name string) (*Bucket, error) {
+	if !bucketName.MatchString(name) {
+		return nil, fmt.Errorf("storage: invalid bucket name %q", name)
+	}
+
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	if db.closed.Load() {
+		return nil, ErrClosed
+	}
+	if b, ok := db.buckets[name]; ok {
+		return b, nil
+	}
+
+	b := &Bucket{db: db, name: name, data: make(map[string][]byte)}
+	if db.Persistent() {
+		if err := b.load(); err != nil {
+			return nil, fmt.Errorf("failed to open bucket %s: %w", name, err)
+		}
+	}
+	db.buckets[name] = b
+	return b, nil
+}
+
+// Buckets lists the buckets stored on disk (or opened, for a memory DB)
+func (db *DB) Buckets() ([]string, error) {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	names := make(map[string]struct{}, len(db.buckets))
+	for name := range db.buckets {
+		names[name] = struct{}{}
+	}
+	if db.Persistent() {
+		entries, err := os.ReadDir(db.dir)
+		if err != nil {
+			return nil, err
+		}
+		for _, e := range entries {
+			if name, ok := strings.CutSuffix(e.Name(), bucketExt); ok && bucketName.MatchString(name) {
+				names[name] = struct{}{}
+			}
+		}
+	}
+
+	list := make([]string, 0, len(names))
+	for name := range names {
+		list = append(list, name)
+	}
+	sort.Strings(list)
+	return list, nil
+}
+
+// DeleteBucket removes a bucket and securely deletes its file
+func (db *DB) DeleteBucket(name string) error {
+	if !bucketName.MatchString(name) {
+		return fmt.Errorf("storage: invalid bucket name %q", name)
+	}
+
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	if db.closed.Load() {
+		return ErrClosed
+	}
+
+	if b, ok := db.buckets[name]; ok {
+		b.mu.Lock()
+		b.closeFile()
+		b.data = make(map[string][]byte)
+		b.mu.Unlock()
+		delete(db.buckets, name)
+	}
+	if !db.Persistent() {
+		return nil
+	}
+	for _, path := range []string{bucketPath(db.dir, name), stagePath(db.dir, name, tmpSuffix), stagePath(db.dir, name, newSuffix)} {
+		if err := Shred(path); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	}
+	return nil
+}
+
+// Close flushes and closes all buckets and forgets the key
+func (db *DB) Close() error {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	if db.closed.Swap(true) {
+		return nil
+	}
+
+	var firstErr error
+	for _, b := range db.buckets {
+		b.mu.Lock()
+		if err := b.closeFile(); err != nil && firstErr == nil {
+			firstErr = err
+		}
+		b.mu.Unlock()
+	}
+	for i := range db.key {
+		db.key[i] = 0
+	}
+	return firstErr
+}
+
+// Bucket is a named set of key/value pairs
+type Bucket struct {
+	db   *DB
+	name string
+
+	mu      sync.Mutex
+	file    *os.File
+	aead    cipher.AEAD
+	records uint64 // records in the log; the next record's sequence number
+	data    map[string][]byte
+}
+
+// record is the plaintext of one log entry
+type record struct {
+	Op    string `json:"op"` // "put" or "del"
+	Key   string `json:"k"`
+	Value []byte `json:"v,omitempty"`
+}
+
+// Get returns a copy of the value stored under key
+func (b *Bucket) Get(key string) ([]byte, bool) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	v, ok := b.data[key]
+	if !ok {
+		return nil, false
+	}
+	return append([]byte(nil), v...), true
+}
+
+// Put stores value under key
+func (b *Bucket) Put(key string, value []byte) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if err := b.writable(); err != nil {
+		return err
+	}
+	if err := b.appendLocked(record{Op: "put", Key: key, Value: value}); err != nil {
+		return err
+	}
+	b.data[key] = append([]byte(nil), value...)
+	return b.maybeCompactLocked()
+}
+
+// PutJSON stores v encoded as JSON
+func (b *Bucket) PutJSON(key string, v interface{}) error {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	return b.Put(key, data)
+}
+
+// GetJSON decodes the value under key into v
+func (b *Bucket) GetJSON(key string, v interface{}) (bool, error) {
+	data, ok := b.Get(key)
+	if !ok {
+		return false, nil
+	}
+	return true, json.Unmarshal(data, v)
+}
+
+// Delete removes key. The old value stays in the log until the next
+// compaction; use SecureDelete to get rid of it immediately.
+func (b *Bucket) Delete(key string) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if err := b.writable(); err != nil {
+		return err
+	}
+	if _, ok := b.data[key]; !ok {
+		return nil
+	}
+	if err := b.appendLocked(record{Op: "del", Key: key}); err != nil {
+		return err
+	}
+	delete(b.data, key)
+	return b.maybeCompactLocked()
+}
+
+// SecureDelete removes key and rewrites the bucket, overwriting the old log
+// so the value cannot be recovered from it
+func (b *Bucket) SecureDelete(key string) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if err := b.writable(); err != nil {
+		return err
+	}
+	delete(b.data, key)
+	if !b.db.Persistent() {
+		return nil
+	}
+	return b.compactLocked(true)
+}
+
+// Keys returns all keys in sorted order
+func (b *Bucket) Keys() []string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	keys := make([]string, 0, len(b.data))
+	for k := range b.data {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// Len returns the number of keys
+func (b *Bucket) Len() int {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return len(b.data)
+}
+
+// Compact rewrites the log with only the live values
+func (b *Bucket) Compact() error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if !b.db.Persistent() {
+		return nil
+	}
+	return b.compactLocked(false)
+}
+
+func (b *Bucket) writable() error {
+	if b.db.closed.Load() {
+		return ErrClosed
+	}
+	if b.db.Persistent() && Suspended() {
+		return ErrIncognito
+	}
+	return nil
+}
+
+func bucketPath(dir, name string) string {
+	return filepath.Join(dir, name+bucketExt)
+}
+
+func stagePath(dir, name, suffix string) string {
+	return filepath.Join(dir, "."+name+bucketExt+suffix)
+}
+
+// load finishes an interrupted compaction and replays the log
+func (b *Bucket) load() error {
+	key := make([]byte, chacha20poly1305.KeySize)
+	kdf := hkdf.New(sha256.New, b.db.key, nil, []byte("execp2p bucket "+b.name))
+	if _, err := io.ReadFull(kdf, key); err != nil {
+		return err
+	}
+	aead, err := chacha20poly1305.NewX(key)
+	if err != nil {
+		return err
+	}
+	b.aead = aead
+
+	path := bucketPath(b.db.dir, b.name)
+	os.Remove(stagePath(b.db.dir, b.name, tmpSuffix))
+	if newPath := stagePath(b.db.dir, b.name, newSuffix); fileExists(newPath) {
+		// a compaction was written completely but not moved into place
+		if err := os.Rename(newPath, path); err != nil {
+			return err
+		}
+	}
+
+	f, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE, 0o600)
+	if err != nil {
+		return err
+	}
+	good, err := b.replay(f)
+	if err != nil {
+		f.Close()
+		return err
+	}
+	// drop a torn record left by a crash mid-write
+	if info, err := f.Stat(); err == nil && info.Size() > good {
+		logger.L().Warn("Truncating incomplete storage record", "bucket", b.name, "bytes", info.Size()-good)
+		if err := f.Truncate(good); err != nil {
+			f.Close()
+			return err
+		}
+	}
+	if _, err := f.Seek(good, io.SeekStart); err != nil {
+		f.Close()
+		return err
+	}
+	b.file = f
+	return nil
+}
+
+// replay applies every record in f and returns the offset after the last
+// complete one
+func (b *Bucket) replay(f *os.File) (int64, error) {
+	r := bufio.NewReader(f)
+	var offset int64
+	for {
+		var header [headerSize]byte
+		if _, err := io.ReadFull(r, header[:]); err != nil {
+			return offset, nil
+		}
+		size := binary.BigEndian.Uint32(header[:])
+		sealed := make([]byte, size)
+		if _, err := io.ReadFull(r, sealed); err != nil {
+			return offset, nil
+		}
+
+		rec, err := b.open(sealed, b.records)
+		if err != nil {
+			return 0, err
+		}
+		switch rec.Op {
+		case "put":
+			b.data[rec.Key] = rec.Value
+		case "del":
+			delete(b.data, rec.Key)
+		}
+		b.records++
+		offset += headerSize + int64(size)
+	}
+}
+
+// seal encrypts a record; its sequence number is authenticated so records
+// cannot be reordered or moved between buckets
+func (b *Bucket) seal(rec record, seq uint64) ([]byte, error) {
+	plaintext, err := json.Marshal(rec)
+	if err != nil {
+		return nil, err
+	}
+	nonce := make([]byte, b.aead.NonceSize(), b.aead.NonceSize()+len(plaintext)+b.aead.Overhead())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, err
+	}
+	sealed := b.aead.Seal(nonce, nonce, plaintext, b.aad(seq))
+
+	out := make([]byte, headerSize, headerSize+len(sealed))
+	binary.BigEndian.PutUint32(out, uint32(len(sealed)))
+	return append(out, sealed...), nil
+}
+
+func (b *Bucket) open(sealed []byte, seq uint64) (record, error) {
+	var rec record
+	if len(sealed) < b.aead.NonceSize() {
+		return rec, ErrCorrupt
+	}
+	nonce, ciphertext := sealed[:b.aead.NonceSize()], sealed[b.aead.NonceSize():]
+	plaintext, err := b.aead.Open(nil, nonce, ciphertext, b.aad(seq))
+	if err != nil {
+		return rec, ErrCorrupt
+	}
+	if err := json.Unmarshal(plaintext, &rec); err != nil {
+		return rec, fmt.Errorf("%w: %v", ErrCorrupt, err)
+	}
+	return rec, nil
+}
+
+func (b *Bucket) aad(seq uint64) []byte {
+	aad := make([]byte, 0, len(b.name)+9)
+	aad = append(aad, b.name...)
+	aad = append(aad, 0)
+	return binary.BigEndian.AppendUint64(aad, seq)
+}
+
+func (b *Bucket) appendLocked(rec record) error {
+	if !b.db.Persistent() {
+		return nil
+	}
+	data, err := b.seal(rec, b.records)
+	if err != nil {
+		return err
+	}
+	if _, err := b.file.Write(data); err != nil {
+		return fmt.Errorf("failed to write storage record: %w", err)
+	}
+	if err := b.file.Sync(); err != nil {
+		return err
+	}
+	b.records++
+	return nil
+}
+
+func (b *Bucket) maybeCompactLocked() error {
+	if !b.db.Persistent() || b.records < compactMinRecords || b.records < 2*uint64(len(b.data)) {
+		return nil
+	}
+	return b.compactLocked(false)
+}
+
+// compactLocked writes the live values to a fresh log and swaps it in. With
+// shred the old log is overwritten before it is replaced.
+func (b *Bucket) compactLocked(shred bool) error {
+	path := bucketPath(b.db.dir, b.name)
+	tmpPath := stagePath(b.db.dir, b.name, tmpSuffix)
+	newPath := stagePath(b.db.dir, b.name, newSuffix)
+	tmp, err := os.OpenFile(tmpPath, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0o600)
+	if err != nil {
+		return err
+	}
+
+	keys := make([]string, 0, len(b.data))
+	for k := range b.data {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	w := bufio.NewWriter(tmp)
+	for i, k := range keys {
+		data, err := b.seal(record{Op: "put", Key: k, Value: b.data[k]}, uint64(i))
+		if err == nil {
+			_, err = w.Write(data)
+		}
+		if err != nil {
+			tmp.Close()
+			os.Remove(tmp.Name())
+			return err
+		}
+	}
+	if err := w.Flush(); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return err
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return err
+	}
+	tmp.Close()
+
+	// from here on the new log is complete; load() finishes the swap after a crash
+	if err := os.Rename(tmpPath, newPath); err != nil {
+		return err
+	}
+	b.closeFile()
+	if shred {
+		if err := overwrite(path); err != nil && !os.IsNotExist(err) {
+			return fmt.Errorf("failed to overwrite old storage log: %w", err)
+		}
+	}
+	if err := os.Rename(newPath, path); err != nil {
+		return err
+	}
+	syncDir(b.db.dir)
+
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND, 0o600)
+	if err != nil {
+		return err
+	}
+	b.file = f
+	b.records = uint64(len(keys))
+	return nil
+}
+
+func (b *Bucket) closeFile() error {
+	if b.file == nil {
+		return nil
+	}
+	err := b.file.Close()
+	b.file = nil
+	return err
+}
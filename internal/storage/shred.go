@@ -0,0 +1,78 @@
+package storage
+
+import (
+	"crypto/rand"
+	"errors"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+)
+
+// Shred overwrites a file with random data, flushes it to disk and removes
+// it. On flash storage and copy-on-write file systems old blocks may survive
+// the overwrite; the data in them is still encrypted.
+func Shred(path string) error {
+	if err := overwrite(path); err != nil {
+		return err
+	}
+	return os.Remove(path)
+}
+
+// ShredDir shreds every file under dir and removes the directory. A missing
+// directory is not an error.
+func ShredDir(dir string) error {
+	var errs []error
+	err := filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			if !os.IsNotExist(err) {
+				errs = append(errs, err)
+			}
+			return nil
+		}
+		if d.Type().IsRegular() {
+			if err := Shred(path); err != nil {
+				errs = append(errs, err)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		errs = append(errs, err)
+	}
+	if err := os.RemoveAll(dir); err != nil {
+		errs = append(errs, err)
+	}
+	return errors.Join(errs...)
+}
+
+// overwrite replaces the contents of a file in place with random bytes
+func overwrite(path string) error {
+	f, err := os.OpenFile(path, os.O_WRONLY, 0)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	info, err := f.Stat()
+	if err != nil {
+		return err
+	}
+	if _, err := io.CopyN(f, rand.Reader, info.Size()); err != nil {
+		return err
+	}
+	return f.Sync()
+}
+
+func fileExists(path string) bool {
+	_, err := os.Stat(path)
+	return err == nil
+}
+
+// syncDir flushes directory entries (renames) to disk; best effort
+func syncDir(dir string) {
+	if d, err := os.Open(dir); err == nil {
+		d.Sync()
+		d.Close()
+	}
+}
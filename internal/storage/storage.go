@@ -0,0 +1,74 @@
+// Package storage holds the encrypted local database and is the single gate
+// for writing session state to disk.
+//
+// The database (DB) is a bucketed key-value store sealed with a key derived
+// from the identity keystore, meant for history, contacts, pins and the
+// outbox. While an incognito room is active nothing derived from the session
+// may be persisted: writers ask the gate first and keep their state in
+// memory when it is closed. Room IDs of incognito rooms are also redacted
+// from logs.
+package storage
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+
+	"execp2p/internal/logger"
+)
+
+// ErrIncognito is returned when a write is refused because an incognito room is active
+var ErrIncognito = errors.New("incognito room: nothing is written to disk")
+
+var (
+	mu        sync.RWMutex
+	incognito = make(map[string]struct{})
+)
+
+// SetIncognito marks or unmarks a room as incognito
+func SetIncognito(roomID string, on bool) {
+	mu.Lock()
+	defer mu.Unlock()
+
+	if on {
+		incognito[roomID] = struct{}{}
+		logger.Redact(roomID)
+		return
+	}
+	delete(incognito, roomID)
+	logger.Unredact(roomID)
+}
+
+// IsIncognito reports whether a room is incognito
+func IsIncognito(roomID string) bool {
+	mu.RLock()
+	defer mu.RUnlock()
+
+	_, ok := incognito[roomID]
+	return ok
+}
+
+// Suspended reports whether any incognito room is active, in which case no
+// session state may be written
+func Suspended() bool {
+	mu.RLock()
+	defer mu.RUnlock()
+
+	return len(incognito) > 0
+}
+
+// Allow returns ErrIncognito if state for roomID must not be persisted.
+// An empty roomID stands for state that is not tied to a room; it is refused
+// while any incognito room is active.
+func Allow(roomID string) error {
+	if roomID == "" {
+		if Suspended() {
+			return ErrIncognito
+		}
+		return nil
+	}
+	if IsIncognito(roomID) {
+		return fmt.Errorf("%w (room %s)", ErrIncognito, logger.Redacted)
+	}
+	return nil
+}
@@ -0,0 +1,168 @@
+// Package timefmt formats timestamps according to the user's language and
+// time zone, so the GUI, history exports and the CLI show the same times.
+package timefmt
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+)
+
+// supported languages
+const (
+	LanguagePolish  = "pl"
+	LanguageEnglish = "en"
+)
+
+// DefaultLanguage is used when none (or an unsupported one) is configured
+const DefaultLanguage = LanguagePolish
+
+type layouts struct {
+	time     string
+	date     string
+	dateTime string
+	months   [12]string
+}
+
+var languages = map[string]layouts{
+	LanguagePolish: {
+		time:     "15:04:05",
+		date:     "2 {month} 2006",
+		dateTime: "2 {month} 2006, 15:04:05",
+		months: [12]string{"stycznia", "lutego", "marca", "kwietnia", "maja", "czerwca",
+			"lipca", "sierpnia", "września", "października", "listopada", "grudnia"},
+	},
+	LanguageEnglish: {
+		time:     "3:04:05 PM",
+		date:     "{month} 2, 2006",
+		dateTime: "{month} 2, 2006, 3:04:05 PM",
+		months: [12]string{"January", "February", "March", "April", "May", "June",
+			"July", "August", "September", "October", "November", "December"},
+	},
+}
+
+// Formatted is a timestamp in raw and human-readable form
+type Formatted struct {
+	// milliseconds since the Unix epoch
+	EpochMillis int64  `json:"epoch_ms"`
+	Time        string `json:"time"`
+	Date        string `json:"date"`
+	DateTime    string `json:"date_time"`
+	// RFC 3339 in the configured time zone
+	ISO string `json:"iso"`
+}
+
+// Formatter formats timestamps for one language and time zone
+type Formatter struct {
+	mu       sync.RWMutex
+	language string
+	location *time.Location
+}
+
+// New returns a formatter. An empty timezone means the system's local zone.
+func New(language, timezone string) (*Formatter, error) {
+	f := &Formatter{}
+	if err := f.Configure(language, timezone); err != nil {
+		return nil, err
+	}
+	return f, nil
+}
+
+// Configure changes the language and time zone
+func (f *Formatter) Configure(language, timezone string) error {
+	language = normalizeLanguage(language)
+	if _, ok := languages[language]; !ok {
+		return fmt.Errorf("unsupported language %q (supported: pl, en)", language)
+	}
+
+	location := time.Local
+	if timezone != "" {
+		loc, err := time.LoadLocation(timezone)
+		if err != nil {
+			return fmt.Errorf("unknown time zone %q: %w", timezone, err)
+		}
+		location = loc
+	}
+
+	f.mu.Lock()
+	f.language = language
+	f.location = location
+	f.mu.Unlock()
+	return nil
+}
+
+// Language returns the configured language
+func (f *Formatter) Language() string {
+	f.mu.RLock()
+	defer f.mu.RUnlock()
+	return f.language
+}
+
+// Timezone returns the name of the configured time zone
+func (f *Formatter) Timezone() string {
+	f.mu.RLock()
+	defer f.mu.RUnlock()
+	return f.location.String()
+}
+
+// Format renders t in every form
+func (f *Formatter) Format(t time.Time) Formatted {
+	f.mu.RLock()
+	l := languages[f.language]
+	t = t.In(f.location)
+	f.mu.RUnlock()
+
+	return Formatted{
+		EpochMillis: t.UnixMilli(),
+		Time:        t.Format(l.time),
+		Date:        l.format(t, l.date),
+		DateTime:    l.format(t, l.dateTime),
+		ISO:         t.Format(time.RFC3339),
+	}
+}
+
+// DateTime is shorthand for Format(t).DateTime
+func (f *Formatter) DateTime(t time.Time) string {
+	return f.Format(t).DateTime
+}
+
+// format applies a layout with a localized month name
+func (l layouts) format(t time.Time, layout string) string {
+	// the month name goes in after formatting so its letters are not
+	// mistaken for layout elements
+	const placeholder = "\x00"
+	s := t.Format(strings.Replace(layout, "{month}", placeholder, 1))
+	return strings.Replace(s, placeholder, l.months[t.Month()-1], 1)
+}
+
+func normalizeLanguage(language string) string {
+	if language == "" {
+		return DefaultLanguage
+	}
+	// accept locale names such as "pl_PL.UTF-8" or "en-US"
+	language = strings.ToLower(language)
+	if i := strings.IndexAny(language, "_-."); i > 0 {
+		language = language[:i]
+	}
+	return language
+}
+
+var (
+	defaultMu        sync.RWMutex
+	defaultFormatter = &Formatter{language: DefaultLanguage, location: time.Local}
+)
+
+// Default returns the process-wide formatter
+func Default() *Formatter {
+	defaultMu.RLock()
+	defer defaultMu.RUnlock()
+	return defaultFormatter
+}
+
+// SetDefault replaces the process-wide formatter
+func SetDefault(f *Formatter) {
+	defaultMu.Lock()
+	defaultFormatter = f
+	defaultMu.Unlock()
+}
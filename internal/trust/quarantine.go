@@ -0,0 +1,106 @@
+package trust
+
+import (
+	"fmt"
+	"sort"
+	"time"
+
+	"execp2p/internal/storage"
+)
+
+// why a peer was quarantined
+const (
+	// its connection presented a TLS certificate its announcement doesn't
+	// vouch for
+	ReasonCertMismatch = "tls_mismatch"
+	// a known peer presented another identity fingerprint
+	ReasonIdentityChanged = "identity_changed"
+	// a known identity connected with another TLS certificate
+	ReasonCertificateChanged = "certificate_changed"
+)
+
+// Quarantine is a peer held until the user accepts or rejects it, after one
+// of its connections failed a security check. No messages flow to or from it
+// meanwhile; a Refused one isn't let connect at all.
+type Quarantine struct {
+	PeerID string `json:"peer_id"`
+	// the identity fingerprint the peer announced
+	Fingerprint string `json:"fingerprint"`
+	Reason      string `json:"reason"`
+	// what was expected, and what the connection presented
+	Expected  string    `json:"expected"`
+	Presented string    `json:"presented"`
+	Since     time.Time `json:"since"`
+	// its connections are refused, not only its messages
+	Refused bool `json:"refused"`
+	// the user rejected it; it stays refused until released
+	Rejected bool `json:"rejected,omitempty"`
+
+	// quarantined while an incognito room was active; kept in memory only
+	transient bool
+}
+
+// Quarantine holds a peer until Release; an earlier quarantine of the
+// peer is replaced
+func (s *Store) Quarantine(q Quarantine) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if q.Since.IsZero() {
+		q.Since = time.Now().UTC()
+	}
+	q.transient = storage.Suspended()
+	s.quarantined[q.PeerID] = &q
+	return s.saveLocked()
+}
+
+// Quarantined returns a peer's quarantine
+func (s *Store) Quarantined(peerID string) (Quarantine, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	q, ok := s.quarantined[peerID]
+	if !ok {
+		return Quarantine{}, false
+	}
+	return *q, true
+}
+
+// QuarantinedPeers returns all quarantines ordered by peer ID
+func (s *Store) QuarantinedPeers() []Quarantine {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	list := make([]Quarantine, 0, len(s.quarantined))
+	for _, q := range s.quarantined {
+		list = append(list, *q)
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].PeerID < list[j].PeerID })
+	return list
+}
+
+// Reject records the user's rejection of a quarantined peer: it is refused
+// from now on, until Release
+func (s *Store) Reject(peerID string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	q, ok := s.quarantined[peerID]
+	if !ok {
+		return fmt.Errorf("peer %s is not quarantined", peerID)
+	}
+	q.Refused, q.Rejected = true, true
+	return s.saveLocked()
+}
+
+// Release lifts a peer's quarantine
+func (s *Store) Release(peerID string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.quarantined[peerID]; !ok {
+		return fmt.Errorf("peer %s is not quarantined", peerID)
+	}
+	delete(s.quarantined, peerID)
+	return s.saveLocked()
+}
@@ -0,0 +1,354 @@
+// Package trust implements trust-on-first-use pinning of peer identities.
+//
+// The first time a peer ID is seen its identity fingerprint is pinned. Later
+// connections from the same peer ID must present the same fingerprint; a
+// different one means the peer reinstalled, moved to a new identity, or
+// someone is impersonating it. The TLS certificate the identity connects with
+// is pinned alongside it, so a known identity arriving over another
+// transport certificate is noticed too. A peer whose connection failed a
+// security check is quarantined, refused until the user decides about it.
+package trust
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+
+	"execp2p/internal/storage"
+)
+
+// FileName is the name of the pin database inside the data directory
+const FileName = "trust.json"
+
+const storeVersion = 1
+
+// policies for a peer presenting a different fingerprint
+const (
+	PolicyRefuse = "refuse"
+	PolicyWarn   = "warn"
+)
+
+// ErrFingerprintChanged is wrapped by ChangedError
+var ErrFingerprintChanged = errors.New("peer identity fingerprint changed")
+
+// ErrCertificateChanged is wrapped by ChangedError for a transport certificate
+var ErrCertificateChanged = errors.New("peer TLS certificate changed")
+
+// ChangedError reports a known peer presenting a different fingerprint, of
+// its identity or, with Certificate set, of its transport certificate
+type ChangedError struct {
+	PeerID      string
+	Pinned      string
+	Presented   string
+	FirstSeen   time.Time
+	Certificate bool
+}
+
+func (e *ChangedError) Error() string {
+	return fmt.Sprintf("%v: peer %s was pinned to %s, now presents %s", e.Unwrap(), e.PeerID, e.Pinned, e.Presented)
+}
+
+func (e *ChangedError) Unwrap() error {
+	if e.Certificate {
+		return ErrCertificateChanged
+	}
+	return ErrFingerprintChanged
+}
+
+// Result is the outcome of Check
+type Result int
+
+const (
+	// first contact; the fingerprint has been pinned
+	ResultPinned Result = iota
+	// the fingerprint matches the pin
+	ResultMatched
+	// the fingerprint differs from the pin
+	ResultChanged
+)
+
+// Entry is a pinned peer
+type Entry struct {
+	PeerID      string    `json:"peer_id"`
+	Fingerprint string    `json:"fingerprint"`
+	FirstSeen   time.Time `json:"first_seen"`
+	LastSeen    time.Time `json:"last_seen"`
+
+	// fingerprint of the TLS certificate the identity connects with,
+	// pinned on the first connection that presents one
+	TLSFingerprint string `json:"tls_fingerprint,omitempty"`
+
+	// set once a person confirmed the pinned fingerprint; a new pin starts
+	// unverified again
+	VerifiedAt     time.Time `json:"verified_at,omitempty"`
+	VerifiedMethod string    `json:"verified_method,omitempty"`
+
+	// pinned while an incognito room was active; kept in memory only
+	transient bool
+}
+
+// Verified reports whether the pinned fingerprint was confirmed by the user
+func (e Entry) Verified() bool {
+	return !e.VerifiedAt.IsZero()
+}
+
+// verification methods
+const (
+	MethodQR     = "qr"
+	MethodManual = "manual"
+)
+
+// State is how far a peer has been verified
+type State string
+
+const (
+	// nothing established yet
+	StateUnverified State = "unverified"
+	// the key exchange completed, the identity is authenticated by its
+	// signature but not confirmed by a person
+	StateKeysExchanged State = "keys_exchanged"
+	// a person confirmed the fingerprint (QR scan or comparison)
+	StateUserVerified State = "user_verified"
+)
+
+type storeFile struct {
+	Version     int                    `json:"version"`
+	Peers       map[string]*Entry      `json:"peers"`
+	Quarantined map[string]*Quarantine `json:"quarantined,omitempty"`
+}
+
+// Store is the pin database. A store without a path lives in memory only.
+type Store struct {
+	mu          sync.Mutex
+	path        string
+	peers       map[string]*Entry
+	quarantined map[string]*Quarantine
+}
+
+// Open loads the pin database from dir, starting empty if it doesn't exist
+func Open(dir string) (*Store, error) {
+	s := &Store{path: filepath.Join(dir, FileName), peers: make(map[string]*Entry), quarantined: make(map[string]*Quarantine)}
+
+	data, err := os.ReadFile(s.path)
+	if os.IsNotExist(err) {
+		return s, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read trust store: %w", err)
+	}
+
+	var f storeFile
+	if err := json.Unmarshal(data, &f); err != nil {
+		return nil, fmt.Errorf("failed to parse trust store %s: %w", s.path, err)
+	}
+	if f.Version > storeVersion {
+		return nil, fmt.Errorf("trust store version %d is newer than supported (%d)", f.Version, storeVersion)
+	}
+	for id, e := range f.Peers {
+		if e != nil {
+			s.peers[id] = e
+		}
+	}
+	for id, q := range f.Quarantined {
+		if q != nil {
+			s.quarantined[id] = q
+		}
+	}
+	return s, nil
+}
+
+// NewMemoryStore returns a store that is never written to disk
+func NewMemoryStore() *Store {
+	return &Store{peers: make(map[string]*Entry), quarantined: make(map[string]*Quarantine)}
+}
+
+// Check compares a peer's fingerprint against its pin, pinning it on first
+// contact. For ResultChanged the returned entry is the existing pin, which
+// is left untouched.
+func (s *Store) Check(peerID, fingerprint string) (Result, Entry, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now().UTC()
+	e, ok := s.peers[peerID]
+	if !ok {
+		e = &Entry{PeerID: peerID, Fingerprint: fingerprint, FirstSeen: now, LastSeen: now, transient: storage.Suspended()}
+		s.peers[peerID] = e
+		return ResultPinned, *e, s.saveLocked()
+	}
+	if e.Fingerprint != fingerprint {
+		return ResultChanged, *e, nil
+	}
+	e.LastSeen = now
+	return ResultMatched, *e, s.saveLocked()
+}
+
+// CheckCertificate compares the TLS certificate a peer connects with against
+// the one pinned for its identity, pinning it if there is none yet. Only a
+// peer presenting its pinned identity is checked; for any other the result
+// is ResultMatched and nothing is stored. For ResultChanged the returned
+// entry is the existing pin, which is left untouched.
+func (s *Store) CheckCertificate(peerID, fingerprint, certFingerprint string) (Result, Entry, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	e, ok := s.peers[peerID]
+	if !ok || e.Fingerprint != fingerprint {
+		return ResultMatched, Entry{}, nil
+	}
+	switch e.TLSFingerprint {
+	case certFingerprint:
+		return ResultMatched, *e, nil
+	case "":
+		e.TLSFingerprint = certFingerprint
+		return ResultPinned, *e, s.saveLocked()
+	}
+	return ResultChanged, *e, nil
+}
+
+// PinCertificate accepts a new TLS certificate for a pinned peer
+func (s *Store) PinCertificate(peerID, certFingerprint string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	e, ok := s.peers[peerID]
+	if !ok {
+		return fmt.Errorf("peer %s is not pinned", peerID)
+	}
+	e.TLSFingerprint = certFingerprint
+	return s.saveLocked()
+}
+
+// Pin sets the fingerprint for a peer, replacing any existing pin
+func (s *Store) Pin(peerID, fingerprint string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now().UTC()
+	s.peers[peerID] = &Entry{PeerID: peerID, Fingerprint: fingerprint, FirstSeen: now, LastSeen: now, transient: storage.Suspended()}
+	return s.saveLocked()
+}
+
+// MarkVerified records that the user confirmed fingerprint for a peer. The
+// fingerprint must be the pinned one; an unpinned peer is pinned with it.
+func (s *Store) MarkVerified(peerID, fingerprint, method string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now().UTC()
+	e, ok := s.peers[peerID]
+	if !ok {
+		e = &Entry{PeerID: peerID, Fingerprint: fingerprint, FirstSeen: now, LastSeen: now, transient: storage.Suspended()}
+		s.peers[peerID] = e
+	}
+	if e.Fingerprint != fingerprint {
+		return &ChangedError{PeerID: peerID, Pinned: e.Fingerprint, Presented: fingerprint, FirstSeen: e.FirstSeen}
+	}
+	e.VerifiedAt = now
+	e.VerifiedMethod = method
+	return s.saveLocked()
+}
+
+// ClearVerified withdraws a peer's verification, keeping the pin
+func (s *Store) ClearVerified(peerID string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	e, ok := s.peers[peerID]
+	if !ok {
+		return fmt.Errorf("peer %s is not pinned", peerID)
+	}
+	e.VerifiedAt = time.Time{}
+	e.VerifiedMethod = ""
+	return s.saveLocked()
+}
+
+// KeepInMemory turns a peer's pin into one that is never written again and
+// removes it from the file. Used when a room turns out to be incognito after
+// the host was already pinned.
+func (s *Store) KeepInMemory(peerID string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	e, ok := s.peers[peerID]
+	if !ok || e.transient {
+		return nil
+	}
+	e.transient = true
+	return s.saveLocked()
+}
+
+// Get returns a peer's pin
+func (s *Store) Get(peerID string) (Entry, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	e, ok := s.peers[peerID]
+	if !ok {
+		return Entry{}, false
+	}
+	return *e, true
+}
+
+// Forget removes a peer's pin so the next fingerprint is trusted anew
+func (s *Store) Forget(peerID string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.peers[peerID]; !ok {
+		return fmt.Errorf("peer %s is not pinned", peerID)
+	}
+	delete(s.peers, peerID)
+	return s.saveLocked()
+}
+
+// List returns all pins ordered by peer ID
+func (s *Store) List() []Entry {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	entries := make([]Entry, 0, len(s.peers))
+	for _, e := range s.peers {
+		entries = append(entries, *e)
+	}
+	sort.Slice(entries, func(i, j int) bool { return entries[i].PeerID < entries[j].PeerID })
+	return entries
+}
+
+func (s *Store) saveLocked() error {
+	// nothing is written while an incognito room is active
+	if s.path == "" || storage.Suspended() {
+		return nil
+	}
+
+	peers := make(map[string]*Entry, len(s.peers))
+	for id, e := range s.peers {
+		if !e.transient {
+			peers[id] = e
+		}
+	}
+	quarantined := make(map[string]*Quarantine, len(s.quarantined))
+	for id, q := range s.quarantined {
+		if !q.transient {
+			quarantined[id] = q
+		}
+	}
+	data, err := json.MarshalIndent(storeFile{Version: storeVersion, Peers: peers, Quarantined: quarantined}, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(s.path), 0o700); err != nil {
+		return err
+	}
+	// dot-prefixed so a backup taken meanwhile skips it
+	tmp := filepath.Join(filepath.Dir(s.path), "."+FileName+".tmp")
+	if err := os.WriteFile(tmp, data, 0o600); err != nil {
+		return fmt.Errorf("failed to write trust store: %w", err)
+	}
+	return os.Rename(tmp, s.path)
+}
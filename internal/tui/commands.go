@@ -0,0 +1,455 @@
+package tui
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"execp2p/internal/app"
+	"execp2p/internal/network"
+	"execp2p/internal/rejoin"
+	"execp2p/internal/roster"
+	"execp2p/internal/types"
+
+	tea "github.com/charmbracelet/bubbletea"
+)
+
+const helpText = `Polecenia:
+  /create [incognito]     nowy pokój; pokazuje jego ID i klucz dostępu
+  /join <id> <klucz>      dołącza do pokoju
+  /leave                  opuszcza pokój; można potem utworzyć lub dołączyć do kolejnego
+  /nick <nick>            zmienia nick widoczny dla rozmówców
+  /verify <nick>          oznacza rozmówcę jako zweryfikowanego (po porównaniu odcisków)
+  /accept <peer-id>       akceptuje odizolowanego rozmówcę i jego nowy odcisk lub certyfikat
+  /reject <peer-id>       odrzuca odizolowanego rozmówcę; jego połączenia będą odrzucane
+  /presence <stan>        online, away (zaraz wracam) albo dnd (nie przeszkadzać)
+  /sync                   pobiera historię z drugiego urządzenia z tą samą tożsamością
+  /devices                pokazuje połączone urządzenia z tą samą tożsamością
+  /wipe <peer-id>         nieodwracalnie czyści zgubione urządzenie (tylko z urządzenia głównego)
+  /file <ścieżka>         wysyła plik
+  /save <ścieżka>         zapisuje ostatni odebrany plik
+  /cancel                 przerywa trwające transfery
+  /clear                  czyści widok czatu (historia zostaje)
+  /quit                   kończy
+Klawisze: Tab przełącza listę pokojów i pole wpisywania, F2 panel odcisków,
+PgUp/PgDn i strzałki przewijają czat, Ctrl+W/Ctrl+U kasują słowo/początek
+wiersza, Ctrl+C kończy.`
+
+// handleKey applies a key; it reports whether the user quit. Keys the
+// interface doesn't take go to the input line.
+func (m *model) handleKey(k tea.KeyMsg, cmd *tea.Cmd) bool {
+	m.app.NoteActivity()
+	switch k.Type {
+	case tea.KeyCtrlC:
+		return true
+	case tea.KeyCtrlD:
+		if m.input.Value() == "" {
+			return true
+		}
+	case tea.KeyTab:
+		if m.focus == focusInput {
+			m.focus = focusRooms
+			m.input.Blur()
+		} else {
+			m.focusInput()
+		}
+		return false
+	case tea.KeyEsc:
+		m.focusInput()
+		return false
+	case tea.KeyF2:
+		m.peers = !m.peers
+		m.dirty = true
+		return false
+	case tea.KeyPgUp:
+		m.chat.PageUp()
+		return false
+	case tea.KeyPgDown:
+		m.chat.PageDown()
+		return false
+	}
+
+	if m.focus == focusRooms {
+		m.roomKey(k)
+		return false
+	}
+	switch k.Type {
+	case tea.KeyUp:
+		m.chat.ScrollUp(1)
+	case tea.KeyDown:
+		m.chat.ScrollDown(1)
+	case tea.KeyEnter:
+		text := strings.TrimSpace(m.input.Value())
+		m.input.Reset()
+		m.chat.GotoBottom()
+		if text == "" {
+			return false
+		}
+		if strings.HasPrefix(text, "/") {
+			return m.command(text)
+		}
+		m.send(text)
+	default:
+		m.input, *cmd = m.input.Update(k)
+	}
+	return false
+}
+
+func (m *model) focusInput() {
+	m.focus = focusInput
+	m.input.Focus()
+}
+
+func (m *model) roomKey(k tea.KeyMsg) {
+	i := m.roomIndex(m.selected)
+	switch k.Type {
+	case tea.KeyUp:
+		if i > 0 {
+			m.open(m.rooms[i-1].id)
+		}
+	case tea.KeyDown:
+		if i+1 < len(m.rooms) {
+			m.open(m.rooms[i+1].id)
+		}
+	case tea.KeyEnter, tea.KeyRight:
+		m.focusInput()
+	}
+}
+
+// command runs a slash command; it reports whether the user quit
+func (m *model) command(text string) bool {
+	fields := strings.Fields(text)
+	name, args := fields[0], fields[1:]
+	// the rest of the line, for arguments with spaces
+	rest := strings.TrimSpace(strings.TrimPrefix(text, name))
+
+	switch name {
+	case "/quit", "/q", "/exit":
+		return true
+	case "/help", "/h", "/?":
+		for _, l := range strings.Split(helpText, "\n") {
+			m.append(m.selected, line{text: l, kind: lineSystem})
+		}
+	case "/create":
+		m.create(len(args) > 0 && args[0] == "incognito")
+	case "/join":
+		if len(args) != 2 {
+			m.warn("Użycie: /join <id pokoju> <klucz dostępu>")
+			break
+		}
+		m.join(args[0], args[1])
+	case "/leave":
+		m.leave()
+	case "/nick":
+		m.setNick(rest)
+	case "/verify":
+		m.verify(rest)
+	case "/accept":
+		if err := m.app.AcceptPeer(rest); err != nil {
+			m.warn("Nie można zaakceptować: %v", err)
+		} else {
+			m.system("Zaakceptowano %s; wiadomości wznowione.", rest)
+		}
+	case "/reject":
+		if err := m.app.RejectPeer(rest); err != nil {
+			m.warn("Nie można odrzucić: %v", err)
+		} else {
+			m.system("Odrzucono %s; kolejne połączenia będą odrzucane.", rest)
+		}
+	case "/presence":
+		p, err := app.ParsePresence(rest)
+		if err != nil {
+			m.warn("Użycie: /presence online|away|dnd")
+			break
+		}
+		m.app.SetPresence(p)
+		m.system("Twój stan: %s", presenceLabels[p])
+	case "/sync":
+		if _, err := m.app.SyncHistory(); err != nil {
+			m.warn("Nie można zsynchronizować historii: %v", err)
+		} else {
+			m.system("Pobieranie historii z drugiego urządzenia…")
+		}
+	case "/devices":
+		devices := m.app.OwnDevices()
+		if len(devices) == 0 {
+			m.system("Żadne inne urządzenie z tą tożsamością nie jest połączone.")
+		} else {
+			m.system("Twoje urządzenia w pokoju: %s", strings.Join(devices, ", "))
+		}
+	case "/wipe":
+		if len(args) != 1 {
+			m.warn("Użycie: /wipe <peer-id>")
+			break
+		}
+		if err := m.app.WipeDevice(args[0]); err != nil {
+			m.warn("Nie można wyczyścić urządzenia: %v", err)
+		} else {
+			m.system("Polecenie wyczyszczenia %s zostanie wysłane, gdy urządzenie będzie w pokoju.", args[0])
+		}
+	case "/file":
+		m.sendFile(rest)
+	case "/save":
+		m.saveFile(rest)
+	case "/cancel":
+		transfers := m.app.Transfers()
+		for _, t := range transfers {
+			m.app.CancelTransfer(t.ID)
+		}
+		if len(transfers) == 0 {
+			m.system("Brak trwających transferów.")
+		}
+	case "/clear":
+		m.chats[m.selected] = []line{}
+		m.dirty = true
+	case "/peers":
+		m.peers = !m.peers
+		m.dirty = true
+	default:
+		m.warn("Nieznane polecenie %s, /help pokazuje listę.", name)
+	}
+	return false
+}
+
+// send sends a text message to the room we are in
+func (m *model) send(text string) {
+	room := m.liveRoom()
+	if room == "" {
+		m.warn("Najpierw utwórz pokój (/create) albo dołącz do pokoju (/join).")
+		return
+	}
+	body, _ := json.Marshal(chatMessage{Type: "text", Content: text})
+	m.open(room)
+	m.append(room, line{time: m.app.FormatTime(time.Now()).Time, sender: m.nick, text: text, kind: lineOwn})
+	go func() {
+		err := m.app.SendMessage(m.ctx, string(body))
+		if undelivered, partly := network.PartlyDelivered(err); partly {
+			m.post(func(m *model) { m.warn("Wiadomość nie dotarła do: %s", m.displayNames(undelivered)) })
+		} else if err != nil {
+			m.post(func(m *model) { m.warn("Nie wysłano wiadomości: %v", err) })
+		}
+	}()
+}
+
+// displayNames returns the names of the given room members, comma-separated
+func (m *model) displayNames(peerIDs []string) string {
+	names := make([]string, 0, len(peerIDs))
+	for _, id := range peerIDs {
+		names = append(names, m.app.DisplayName(id))
+	}
+	return strings.Join(names, ", ")
+}
+
+func (m *model) create(incognito bool) {
+	if m.liveRoom() != "" {
+		m.warn("Jesteś już w pokoju; najpierw go opuść (/leave).")
+		return
+	}
+	if !m.startBusy() {
+		return
+	}
+	m.system("Tworzenie pokoju…")
+	go func() {
+		create := m.app.CreateRoom
+		if incognito {
+			create = func(ctx context.Context) (*types.CreateRoomResult, error) {
+				return m.app.CreateRoomWithOptions(ctx, app.RoomOptions{Incognito: true})
+			}
+		}
+		result, err := create(m.ctx)
+		m.post(func(m *model) {
+			m.busy = false
+			if err != nil {
+				m.warn("Nie utworzono pokoju: %v", err)
+				return
+			}
+			m.refresh()
+			m.open(result.RoomID)
+			m.system("Utworzono pokój %s, klucz dostępu: %s. Przekaż oba rozmówcy.", result.RoomID, result.AccessKey)
+			if result.Incognito {
+				m.system("Pokój incognito: nic o nim nie trafi na dysk.")
+			}
+		})
+	}()
+}
+
+func (m *model) join(roomID, accessKey string) {
+	if m.liveRoom() != "" {
+		m.warn("Jesteś już w pokoju; najpierw go opuść (/leave).")
+		return
+	}
+	if !m.startBusy() {
+		return
+	}
+	m.system("Łączenie z pokojem %s…", roomID)
+	go func() {
+		err := m.app.JoinRoom(m.ctx, roomID, "", accessKey)
+		m.post(func(m *model) {
+			m.busy = false
+			if err != nil {
+				m.warn("Nie dołączono do pokoju: %v", err)
+				return
+			}
+			m.refresh()
+			m.open(roomID)
+			m.system("Dołączono do pokoju. Porównaj odciski palców (F2) z rozmówcą i potwierdź je poleceniem /verify.")
+		})
+	}()
+}
+
+// rejoin enters again the room we were in when the terminal UI last closed
+func (m *model) rejoin(r rejoin.Room) {
+	if !m.startBusy() {
+		return
+	}
+	m.system("Powrót do pokoju %s…", r.RoomID)
+	go func() {
+		err := m.app.Rejoin(m.ctx, r)
+		m.post(func(m *model) {
+			m.busy = false
+			switch {
+			case err == nil:
+				m.rejoined(r)
+			case errors.Is(err, app.ErrDiscovery) || errors.Is(err, app.ErrTransport):
+				m.warn("Nie udało się wrócić do pokoju: %v. Wejdziemy do niego, gdy gospodarz się pojawi.", err)
+				go m.app.RejoinLater(m.ctx, []rejoin.Room{r}, m.rejoinLater)
+			default:
+				m.warn("Nie udało się wrócić do pokoju: %v", err)
+			}
+		})
+	}()
+}
+
+// rejoinLater enters the room once its host is back, unless we entered
+// another one meanwhile; it runs outside the UI loop
+func (m *model) rejoinLater(r rejoin.Room) error {
+	if room := m.app.GetRoomInfo(); room != nil {
+		return fmt.Errorf("already in room %s", room.ID)
+	}
+	if err := m.app.Rejoin(m.ctx, r); err != nil {
+		return err
+	}
+	m.post(func(m *model) { m.rejoined(r) })
+	return nil
+}
+
+func (m *model) rejoined(r rejoin.Room) {
+	m.refresh()
+	m.open(r.RoomID)
+	m.system("Z powrotem w pokoju %s.", r.RoomID)
+}
+
+func (m *model) leave() {
+	roomID := m.liveRoom()
+	if roomID == "" {
+		m.warn("Nie jesteś w żadnym pokoju.")
+		return
+	}
+	if !m.startBusy() {
+		return
+	}
+	go func() {
+		m.app.LeaveRoom()
+		m.post(func(m *model) {
+			m.busy = false
+			m.refresh()
+			m.system("Opuszczono pokój %s. /create albo /join wchodzi do kolejnego.", roomID)
+		})
+	}()
+}
+
+// startBusy allows one join or create at a time
+func (m *model) startBusy() bool {
+	if m.busy {
+		m.warn("Poczekaj na zakończenie poprzedniej operacji.")
+		return false
+	}
+	m.busy = true
+	return true
+}
+
+func (m *model) setNick(nick string) {
+	nick = roster.CleanNickname(nick)
+	if nick == "" {
+		m.warn("Użycie: /nick <nick>")
+		return
+	}
+	m.nick = m.app.SetLocalNickname(nick)
+	m.system("Twój nick: %s", m.nick)
+	if m.liveRoom() == "" {
+		return
+	}
+	body, _ := json.Marshal(chatMessage{Type: "nickname_update", Nickname: nick})
+	go func() {
+		if err := m.app.SendMessage(m.ctx, string(body)); err != nil {
+			m.post(func(m *model) { m.warn("Rozmówcy nie dostali nowego nicka: %v", err) })
+		}
+	}()
+}
+
+// verify marks a peer, named by display name or peer ID, as verified
+func (m *model) verify(name string) {
+	if name == "" {
+		m.warn("Użycie: /verify <nick>")
+		return
+	}
+	for _, entry := range m.app.Roster() {
+		if entry.Local || (entry.DisplayName != name && entry.PeerID != name) {
+			continue
+		}
+		if err := m.app.MarkPeerVerified(entry.PeerID); err != nil {
+			m.warn("Nie zweryfikowano %s: %v", entry.DisplayName, err)
+			return
+		}
+		m.system("%s oznaczony jako zweryfikowany.", entry.DisplayName)
+		return
+	}
+	m.warn("Nie ma w pokoju rozmówcy %s.", name)
+}
+
+func (m *model) sendFile(path string) {
+	if path == "" {
+		m.warn("Użycie: /file <ścieżka>")
+		return
+	}
+	if _, err := m.app.SendFile(m.ctx, path); err != nil {
+		m.warn("Nie wysłano pliku: %v", err)
+		return
+	}
+	m.system("Wysyłanie pliku %s…", path)
+}
+
+func (m *model) saveFile(path string) {
+	if path == "" {
+		m.warn("Użycie: /save <ścieżka>")
+		return
+	}
+	if m.lastFile == "" {
+		m.warn("Nie odebrano jeszcze żadnego pliku.")
+		return
+	}
+	item, err := m.app.ReceivedFile(m.lastFile)
+	if err == nil {
+		err = os.WriteFile(path, item.Data, 0o600)
+	}
+	if err != nil {
+		m.warn("Nie zapisano pliku: %v", err)
+		return
+	}
+	m.system("Zapisano %s w %s.", item.Name, path)
+}
+
+// formatSize shows a size in bytes, KiB or MiB
+func formatSize(n int64) string {
+	switch {
+	case n < 1<<10:
+		return fmt.Sprintf("%d B", n)
+	case n < 1<<20:
+		return fmt.Sprintf("%.1f KiB", float64(n)/(1<<10))
+	}
+	return fmt.Sprintf("%.1f MiB", float64(n)/(1<<20))
+}
@@ -0,0 +1,304 @@
+package tui
+
+import (
+	"fmt"
+	"strings"
+
+	"execp2p/internal/app"
+	"execp2p/internal/trust"
+
+	"github.com/charmbracelet/lipgloss"
+	"github.com/charmbracelet/x/ansi"
+)
+
+var (
+	titleStyle    = lipgloss.NewStyle().Reverse(true)
+	boldStyle     = lipgloss.NewStyle().Bold(true)
+	dimStyle      = lipgloss.NewStyle().Faint(true)
+	selectedStyle = lipgloss.NewStyle().Reverse(true)
+	ownStyle      = lipgloss.NewStyle().Foreground(lipgloss.Color("2"))
+	peerStyle     = lipgloss.NewStyle().Foreground(lipgloss.Color("6"))
+	warningStyle  = lipgloss.NewStyle().Bold(true).Foreground(lipgloss.Color("3"))
+	goodStyle     = lipgloss.NewStyle().Foreground(lipgloss.Color("2"))
+)
+
+const (
+	roomsWidth = 22
+	panelWidth = 38
+	// narrower terminals show the panel instead of the chat
+	panelMinWidth = 100
+	// the smallest window the interface is drawn in
+	minWidth, minHeight = 40, 8
+)
+
+// how presence states are shown
+var presenceLabels = map[app.Presence]string{
+	app.PresenceOnline: "dostępny",
+	app.PresenceAway:   "zaraz wracam",
+	app.PresenceDND:    "nie przeszkadzać",
+}
+
+// columns returns the widths of the room list, the chat and the panel; a
+// column that doesn't fit is 0 wide
+func (m *model) columns() (rooms, chat, panel int) {
+	rooms = roomsWidth
+	if m.peers {
+		panel = panelWidth
+		if m.width < panelMinWidth {
+			panel = m.width - rooms - 1
+		}
+	}
+	chat = m.width - rooms - 1
+	if panel > 0 {
+		chat -= panel + 1
+	}
+	return rooms, max(chat, 0), panel
+}
+
+// layout sizes the chat and the input line to the window and lays out the
+// selected room's chat again if it changed
+func (m *model) layout() {
+	if m.width < minWidth || m.height < minHeight {
+		return
+	}
+	_, chatW, _ := m.columns()
+	rows := m.height - 3
+	if m.chat.Width != chatW || m.chat.Height != rows {
+		m.chat.Width, m.chat.Height = chatW, rows
+		m.dirty = true
+	}
+	m.input.Prompt = "> "
+	if m.focus == focusRooms {
+		m.input.Prompt = "  "
+	}
+	// the prompt and the cursor
+	m.input.Width = m.width - lipgloss.Width(m.input.Prompt) - 1
+	if !m.dirty {
+		return
+	}
+	m.dirty = false
+	if chatW == 0 {
+		return
+	}
+	atBottom := m.chat.AtBottom()
+	lines := m.chatLines(chatW)
+	// the newest line sits just above the status line
+	if pad := rows - len(lines); pad > 0 {
+		lines = append(make([]string, pad), lines...)
+	}
+	m.chat.SetContent(strings.Join(lines, "\n"))
+	if atBottom {
+		m.chat.GotoBottom()
+	}
+}
+
+// View draws the whole screen
+func (m *model) View() string {
+	if m.width < minWidth || m.height < minHeight {
+		return truncate("Za małe okno terminala", m.width)
+	}
+	roomsW, chatW, panelW := m.columns()
+	rows := m.height - 3
+	sep := dimStyle.Render(strings.TrimSuffix(strings.Repeat("│\n", rows), "\n"))
+
+	body := []string{column(m.roomLines(), roomsW, rows), sep}
+	if chatW > 0 {
+		body = append(body, lipgloss.NewStyle().Width(chatW).Height(rows).Render(m.chat.View()))
+		if panelW > 0 {
+			body = append(body, sep)
+		}
+	}
+	if panelW > 0 {
+		body = append(body, column(m.panelLines(panelW), panelW, rows))
+	}
+
+	return lipgloss.JoinVertical(lipgloss.Left,
+		titleStyle.Width(m.width).Render(truncate(m.title(), m.width)),
+		lipgloss.JoinHorizontal(lipgloss.Top, body...),
+		dimStyle.Width(m.width).Render(truncate(clean(m.status), m.width)),
+		m.input.View(),
+	)
+}
+
+func (m *model) title() string {
+	status := m.app.GetNetworkStatus()
+	room := m.liveRoom()
+	if room == "" {
+		return " ExecP2P · brak pokoju"
+	}
+	title := fmt.Sprintf(" ExecP2P · pokój %s · rozmówcy: %d", room, status.ConnectedPeers)
+	if status.E2EEncryption {
+		title += " · E2E"
+	}
+	if m.app.IsIncognito() {
+		title += " · incognito"
+	}
+	if status.Degraded {
+		title += " · łączenie ponowne…"
+	}
+	return title
+}
+
+// styled is a line of a column: text in one style
+type styled struct {
+	text  string
+	style *lipgloss.Style
+}
+
+func (m *model) roomLines() []styled {
+	lines := []styled{{text: " Pokoje", style: &boldStyle}}
+	for _, r := range m.rooms {
+		name := " Konsola"
+		switch {
+		case r.live:
+			name = " ● " + r.id
+		case r.id != "":
+			name = fmt.Sprintf(" %s (%d)", r.id, r.messages)
+		}
+		var style *lipgloss.Style
+		if r.id == m.selected {
+			style = &boldStyle
+			if m.focus == focusRooms {
+				style = &selectedStyle
+			}
+		}
+		lines = append(lines, styled{text: name, style: style})
+	}
+	return lines
+}
+
+// chatLines lays out the selected room's chat, wrapped to width
+func (m *model) chatLines(width int) []string {
+	var lines []string
+	wrap := lipgloss.NewStyle().Width(width)
+	for _, l := range m.chats[m.selected] {
+		style, prefix := wrap, ""
+		if l.time != "" {
+			prefix = l.time + " "
+		}
+		switch l.kind {
+		case lineOwn:
+			style = style.Inherit(ownStyle)
+		case lineSystem:
+			style = style.Inherit(dimStyle)
+		case lineWarning:
+			style = style.Inherit(warningStyle)
+		}
+		if l.sender != "" {
+			prefix += l.sender + ": "
+			if l.kind == lineChat {
+				style = style.Inherit(peerStyle)
+			}
+		}
+		lines = append(lines, strings.Split(style.Render(clean(prefix+l.text)), "\n")...)
+	}
+	return lines
+}
+
+// panelLines shows our fingerprint and the peers' with their verification
+func (m *model) panelLines(width int) []styled {
+	lines := []styled{{text: " Twój odcisk palca", style: &boldStyle}}
+	if fp, err := m.app.GetPeerFingerprint(); err == nil {
+		lines = appendWrapped(lines, " ", formatFingerprint(fp), width, nil)
+	}
+
+	lines = append(lines, styled{}, styled{text: " Rozmówcy", style: &boldStyle})
+	peers := 0
+	for _, entry := range m.app.Roster() {
+		if entry.Local {
+			continue
+		}
+		peers++
+		v := m.app.PeerVerificationState(entry.PeerID)
+		fp := v.Fingerprint
+		if fp == "" {
+			fp = entry.Fingerprint
+		}
+		name := " " + entry.DisplayName
+		if p := m.app.PeerPresence(entry.PeerID); p != app.PresenceOnline {
+			name += " (" + presenceLabels[p] + ")"
+		}
+		if m.app.PeerOffline(entry.PeerID) {
+			name += " (brak kontaktu)"
+		}
+		lines = append(lines, styled{text: name})
+		lines = appendWrapped(lines, "   ", formatFingerprint(fp), width, &dimStyle)
+		if v.State == trust.StateUserVerified {
+			lines = append(lines, styled{text: "   ✓ zweryfikowany", style: &goodStyle})
+		} else {
+			lines = append(lines, styled{text: "   ! niezweryfikowany (/verify)", style: &warningStyle})
+		}
+	}
+	if peers == 0 {
+		lines = append(lines, styled{text: " nikogo nie ma", style: &dimStyle})
+	}
+
+	if r := m.app.GetRoomInfo(); r != nil && m.app.IsListener() && r.AccessKey != "" {
+		lines = append(lines, styled{}, styled{text: " Zaproszenie", style: &boldStyle})
+		lines = appendWrapped(lines, " ", "ID: "+r.ID, width, nil)
+		lines = appendWrapped(lines, " ", "Klucz: "+r.AccessKey, width, nil)
+	}
+	return lines
+}
+
+// appendWrapped adds text wrapped to width, each line indented
+func appendWrapped(lines []styled, indent, text string, width int, style *lipgloss.Style) []styled {
+	wrapped := lipgloss.NewStyle().Width(width - lipgloss.Width(indent)).Render(clean(text))
+	for _, l := range strings.Split(wrapped, "\n") {
+		lines = append(lines, styled{text: indent + strings.TrimRight(l, " "), style: style})
+	}
+	return lines
+}
+
+// column renders lines cut to width, and as many as fit in rows
+func column(lines []styled, width, rows int) string {
+	out := make([]string, 0, rows)
+	for _, l := range lines[:min(len(lines), rows)] {
+		text := truncate(clean(l.text), width)
+		if l.style != nil {
+			text = l.style.Render(text)
+		}
+		out = append(out, text)
+	}
+	return lipgloss.NewStyle().Width(width).Height(rows).Render(strings.Join(out, "\n"))
+}
+
+// truncate cuts s to width terminal columns, marking the cut
+func truncate(s string, width int) string {
+	return ansi.Truncate(s, max(width, 0), "…")
+}
+
+// clean drops control characters, so text from peers can't move the
+// cursor or restyle the terminal
+func clean(s string) string {
+	return strings.Map(func(r rune) rune {
+		if r == '\t' {
+			return ' '
+		}
+		if r < 0x20 || (r >= 0x7f && r < 0xa0) {
+			return -1
+		}
+		return r
+	}, s)
+}
+
+// formatFingerprint groups a fingerprint by four characters for reading aloud
+func formatFingerprint(fp string) string {
+	if fp == "" {
+		return "(nieznany)"
+	}
+	var groups []string
+	for len(fp) > 4 {
+		groups = append(groups, fp[:4])
+		fp = fp[4:]
+	}
+	return strings.Join(append(groups, fp), " ")
+}
+
+// shortFingerprint is the start of a fingerprint, for notices
+func shortFingerprint(fp string) string {
+	if len(fp) > 16 {
+		return formatFingerprint(fp[:16]) + "…"
+	}
+	return formatFingerprint(fp)
+}
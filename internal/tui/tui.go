@@ -0,0 +1,452 @@
+// Package tui is a terminal frontend for the ExecP2P backend, for machines
+// reached over SSH: a room list, the chat of the selected room and a
+// fingerprint panel, driven by the keyboard and by slash commands (/help).
+// It is a Bubble Tea program driving the same app.ExecP2P as the Wails GUI
+// and takes its place: the backend's notice channels are read here and
+// handed to the program as messages.
+package tui
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	"execp2p/internal/app"
+	"execp2p/internal/crash"
+	"execp2p/internal/crypto"
+	"execp2p/internal/history"
+	"execp2p/internal/trust"
+
+	"github.com/charmbracelet/bubbles/textinput"
+	"github.com/charmbracelet/bubbles/viewport"
+	tea "github.com/charmbracelet/bubbletea"
+)
+
+const (
+	// stored messages shown when a room is opened
+	historyLines = 200
+	// lines kept per room, oldest dropped first
+	maxLines = 2000
+	// how often the room list and the panel are refreshed
+	refreshInterval = time.Second
+)
+
+type lineKind int
+
+const (
+	lineChat lineKind = iota
+	lineOwn
+	lineSystem
+	lineWarning
+)
+
+type line struct {
+	time   string
+	sender string
+	text   string
+	kind   lineKind
+}
+
+// roomEntry is a row of the room list; the console (empty ID) is always
+// first, then the room we are in, then rooms with stored history
+type roomEntry struct {
+	id       string
+	live     bool
+	messages int
+}
+
+type focus int
+
+const (
+	focusInput focus = iota
+	focusRooms
+)
+
+// messages the program gets besides keys and the window size
+type (
+	// postMsg runs a function on the model, e.g. with the result of a
+	// join made in the background
+	postMsg func(*model)
+	// refreshMsg asks for the room list to be rebuilt
+	refreshMsg struct{}
+	// tickMsg is refreshMsg on a schedule
+	tickMsg struct{}
+	// closedMsg tells the backend stopped delivering messages
+	closedMsg struct{}
+)
+
+// model is the state of the interface; only Update touches it
+type model struct {
+	ctx  context.Context
+	app  *app.ExecP2P
+	post func(func(*model))
+
+	rooms    []roomEntry
+	selected string
+	focus    focus
+	chats    map[string][]line
+	// the chat of the selected room changed since it was laid out
+	dirty bool
+
+	width, height int
+	chat          viewport.Model
+	input         textinput.Model
+	status        string
+	// a join or create in progress
+	busy bool
+
+	peers bool
+	nick  string
+	// our peer ID: the network echoes what we say while we are alone
+	self string
+	// the last file received, for /save
+	lastFile string
+	// why the program ended, other than the user quitting
+	err error
+}
+
+// Run shows the interface until the user quits or ctx ends
+func Run(ctx context.Context, e *app.ExecP2P) error {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	m := newModel(ctx, e)
+	p := tea.NewProgram(m, tea.WithAltScreen(), tea.WithContext(ctx))
+	m.post = func(f func(*model)) { p.Send(postMsg(f)) }
+
+	m.system("ExecP2P w terminalu. /create tworzy pokój, /join <id> <klucz> dołącza, /help pokazuje polecenia.")
+	m.refresh()
+	// one room at a time: the latest of those we were in
+	if rooms := e.RoomsToRejoin(); len(rooms) > 0 {
+		m.rejoin(rooms[len(rooms)-1])
+	}
+
+	go e.KeepAlive(ctx)
+	messages, unsubscribe := e.Subscribe(0)
+	defer unsubscribe()
+	go listen(ctx, e, p, messages)
+
+	if _, err := p.Run(); err != nil && ctx.Err() == nil {
+		return fmt.Errorf("terminal UI failed: %w", err)
+	}
+	return m.err
+}
+
+func newModel(ctx context.Context, e *app.ExecP2P) *model {
+	input := textinput.New()
+	input.Prompt = "> "
+	input.Focus()
+	return &model{
+		ctx:   ctx,
+		app:   e,
+		chats: make(map[string][]line),
+		chat:  viewport.New(0, 0),
+		input: input,
+		peers: true,
+		nick:  "ja",
+		self:  e.GetNetworkStatus().PeerID,
+	}
+}
+
+// listen hands the backend's messages and notices to the program until ctx
+// ends or the backend stops
+func listen(ctx context.Context, e *app.ExecP2P, p *tea.Program, messages <-chan *crypto.MessagePayload) {
+	defer crash.Recover("tui.listen")
+	for {
+		var msg tea.Msg
+		select {
+		case <-ctx.Done():
+			return
+		case payload, ok := <-messages:
+			if !ok {
+				msg = closedMsg{}
+				select {
+				case w := <-e.DeviceWipedNotices():
+					msg = w
+				default:
+				}
+				p.Send(msg)
+				return
+			}
+			msg = payload
+		case w := <-e.DeviceWipedNotices():
+			msg = w
+		case q := <-e.QuarantineNotices():
+			msg = q
+		case r := <-e.HistorySyncNotices():
+			msg = r
+		case t := <-e.TransferNotices():
+			msg = t
+		case c := <-e.CrashNotices():
+			msg = c
+		case <-e.StatusNotices():
+			msg = refreshMsg{}
+		}
+		p.Send(msg)
+	}
+}
+
+func tick() tea.Cmd {
+	return tea.Tick(refreshInterval, func(time.Time) tea.Msg { return tickMsg{} })
+}
+
+func (m *model) Init() tea.Cmd {
+	return tea.Batch(textinput.Blink, tick())
+}
+
+func (m *model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
+	var cmd tea.Cmd
+	switch msg := msg.(type) {
+	case tea.WindowSizeMsg:
+		m.width, m.height = msg.Width, msg.Height
+		m.dirty = true
+	case tea.KeyMsg:
+		if m.handleKey(msg, &cmd) {
+			return m, tea.Quit
+		}
+	case postMsg:
+		msg(m)
+	case refreshMsg:
+		m.refresh()
+	case tickMsg:
+		m.refresh()
+		cmd = tick()
+	case *crypto.MessagePayload:
+		m.receive(msg)
+	case app.DeviceWiped:
+		m.err = wipedError(msg)
+		return m, tea.Quit
+	case closedMsg:
+		return m, tea.Quit
+	case trust.Quarantine:
+		m.quarantined(msg)
+	case app.HistorySyncResult:
+		m.system("Zsynchronizowano historię: %d wiadomości z %d pokojów (nie zapisano: %d).", msg.Messages, msg.Rooms, msg.Failed)
+		m.refresh()
+	case app.Transfer:
+		m.transferred(msg)
+	case app.Crash:
+		m.crashed(msg)
+	default:
+		// the cursor blinking
+		m.input, cmd = m.input.Update(msg)
+	}
+	m.layout()
+	return m, cmd
+}
+
+// wipedError ends the terminal UI after a remote wipe of this device
+func wipedError(w app.DeviceWiped) error {
+	if w.Err != nil {
+		return fmt.Errorf("urządzenie główne zleciło wyczyszczenie tego urządzenia; części danych nie usunięto: %w", w.Err)
+	}
+	return fmt.Errorf("urządzenie główne zleciło wyczyszczenie tego urządzenia; klucze i dane lokalne zostały usunięte")
+}
+
+// liveRoom returns the ID of the room we are in, empty if none
+func (m *model) liveRoom() string {
+	if r := m.app.GetRoomInfo(); r != nil {
+		return r.ID
+	}
+	return ""
+}
+
+// refresh rebuilds the room list, keeping the selection
+func (m *model) refresh() {
+	rooms := []roomEntry{{}}
+	live := m.liveRoom()
+	if live != "" {
+		rooms = append(rooms, roomEntry{id: live, live: true})
+	}
+	for _, r := range m.app.HistoryRooms() {
+		if r.RoomID == live {
+			rooms[1].messages = r.Messages
+			continue
+		}
+		rooms = append(rooms, roomEntry{id: r.RoomID, messages: r.Messages})
+	}
+	m.rooms = rooms
+	if m.roomIndex(m.selected) < 0 {
+		m.selected = ""
+	}
+}
+
+func (m *model) roomIndex(id string) int {
+	for i, r := range m.rooms {
+		if r.id == id {
+			return i
+		}
+	}
+	return -1
+}
+
+// open shows a room, at its newest message
+func (m *model) open(id string) {
+	if id != m.selected {
+		m.chat.SetContent("")
+	}
+	m.selected, m.dirty = id, true
+	m.load(id)
+}
+
+// load reads a room's stored messages the first time it is shown
+func (m *model) load(id string) {
+	if _, ok := m.chats[id]; ok || id == "" {
+		return
+	}
+	var lines []line
+	if page, err := m.app.History(id, "", historyLines); err == nil {
+		for _, rec := range page.Records {
+			lines = append(lines, m.recordLine(rec))
+		}
+	}
+	m.chats[id] = lines
+}
+
+// append adds a line to a room's chat
+func (m *model) append(room string, l line) {
+	m.load(room)
+	lines := append(m.chats[room], l)
+	if len(lines) > maxLines {
+		lines = lines[len(lines)-maxLines:]
+	}
+	m.chats[room] = lines
+	if room == m.selected {
+		m.dirty = true
+	}
+}
+
+// system shows a notice in the chat being viewed and on the status line
+func (m *model) system(format string, args ...interface{}) {
+	m.notice(lineSystem, format, args...)
+}
+
+func (m *model) warn(format string, args ...interface{}) {
+	m.notice(lineWarning, format, args...)
+}
+
+func (m *model) notice(kind lineKind, format string, args ...interface{}) {
+	text := format
+	if len(args) > 0 {
+		text = fmt.Sprintf(format, args...)
+	}
+	m.status = text
+	m.append(m.selected, line{time: m.app.FormatTime(time.Now()).Time, text: text, kind: kind})
+}
+
+// receive shows a message delivered in the room we are in
+func (m *model) receive(msg *crypto.MessagePayload) {
+	if msg == nil || msg.SenderID == m.self {
+		return
+	}
+	if msg.Gap > 0 {
+		m.append(m.liveRoom(), line{time: m.app.FormatTime(msg.Timestamp).Time, text: fmt.Sprintf("brakujące wiadomości od %s: %d", m.app.DisplayName(msg.SenderID), msg.Gap), kind: lineSystem})
+	}
+	var body chatMessage
+	if json.Unmarshal([]byte(msg.Message), &body) == nil {
+		switch body.Type {
+		case "keep_alive":
+			return
+		case "nickname_update":
+			before := m.app.DisplayName(msg.SenderID)
+			name := m.app.SetPeerNickname(msg.SenderID, body.Nickname)
+			if name != before {
+				m.append(m.liveRoom(), line{time: m.app.FormatTime(msg.Timestamp).Time, text: before + " zmienia nick na " + name, kind: lineSystem})
+			}
+			return
+		case "file":
+			m.lastFile = body.MediaID
+		}
+	}
+	m.append(m.liveRoom(), line{
+		time:   m.app.FormatTime(msg.Timestamp).Time,
+		sender: m.app.DisplayName(msg.SenderID),
+		text:   messageText(msg.Message),
+	})
+}
+
+// recordLine turns a stored message into a chat line
+func (m *model) recordLine(rec history.Record) line {
+	l := line{time: m.app.FormatTime(rec.Timestamp).DateTime, sender: rec.SenderName, text: messageText(rec.Message)}
+	if rec.Outgoing {
+		l.kind, l.sender = lineOwn, m.nick
+	}
+	return l
+}
+
+// quarantined asks the user to decide about a peer held after a failed
+// security check
+func (m *model) quarantined(q trust.Quarantine) {
+	name := m.app.DisplayName(q.PeerID)
+	switch q.Reason {
+	case trust.ReasonIdentityChanged:
+		m.warn("UWAGA: %s przedstawia inny odcisk palca niż zapamiętany (%s zamiast %s). Porównaj odciski poza czatem.",
+			name, shortFingerprint(q.Presented), shortFingerprint(q.Expected))
+	case trust.ReasonCertificateChanged:
+		m.warn("UWAGA: %s łączy się z innym certyfikatem TLS niż zapamiętany (%s zamiast %s), choć tożsamość jest ta sama.",
+			name, shortFingerprint(q.Presented), shortFingerprint(q.Expected))
+	default:
+		m.warn("UWAGA: certyfikat TLS połączenia z %s nie pasuje do tożsamości (%s zamiast %s, możliwy atak MITM).",
+			name, shortFingerprint(q.Presented), shortFingerprint(q.Expected))
+	}
+	action := "połączenie dopuszczone"
+	if q.Refused {
+		action = "połączenie odrzucone"
+	}
+	m.warn("Rozmówca odizolowany, %s, wiadomości wstrzymane: /accept %s akceptuje, /reject %s odrzuca.", action, q.PeerID, q.PeerID)
+}
+
+func (m *model) crashed(c app.Crash) {
+	report := ""
+	if c.Path != "" {
+		report = " Raport: " + c.Path
+	}
+	if len(c.Rooms) == 0 {
+		m.warn("Błąd wewnętrzny (%s), działanie wznowione.%s", c.Where, report)
+		return
+	}
+	m.warn("Błąd wewnętrzny (%s): opuszczono pokoje (%d), można do nich wrócić.%s", c.Where, len(c.Rooms), report)
+	m.refresh()
+}
+
+func (m *model) transferred(t app.Transfer) {
+	if !t.Done || t.Kind == app.TransferMedia {
+		return
+	}
+	switch {
+	case t.Canceled():
+		m.system("Przerwano: %s.", t.Name)
+	case t.Err != nil:
+		m.warn("Błąd transferu %s: %v", t.Name, t.Err)
+	case t.Kind == app.TransferFile && t.Direction == app.TransferSend:
+		m.system("Wysłano plik %s (%s).", t.Name, formatSize(t.Total))
+	}
+}
+
+// chatMessage is the JSON form of chat messages sent by the frontends
+type chatMessage struct {
+	Type     string `json:"type"`
+	Content  string `json:"content"`
+	Nickname string `json:"nickname,omitempty"`
+	MediaID  string `json:"media_id,omitempty"`
+	Size     int64  `json:"size,omitempty"`
+}
+
+// messageText renders a message for the terminal; media are described
+func messageText(message string) string {
+	var body chatMessage
+	if !strings.HasPrefix(strings.TrimSpace(message), "{") || json.Unmarshal([]byte(message), &body) != nil {
+		return message
+	}
+	switch body.Type {
+	case "image", "gif":
+		return "[obraz] " + body.Content
+	case "audio":
+		return "[wiadomość głosowa]"
+	case "file":
+		return "[plik] " + body.Content + " (" + formatSize(body.Size) + "), /save <ścieżka> zapisuje"
+	}
+	return body.Content
+}
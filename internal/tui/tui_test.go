@@ -0,0 +1,210 @@
+package tui
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"execp2p/internal/apptest"
+	"execp2p/internal/crypto"
+
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/charmbracelet/lipgloss"
+)
+
+func testModel(t *testing.T, width, height int) *model {
+	t.Helper()
+	c := apptest.New(t)
+	m := newModel(context.Background(), c.Add("tui").App)
+	m.post = func(f func(*model)) { t.Error("unexpected background work") }
+	m.refresh()
+	m.Update(tea.WindowSizeMsg{Width: width, Height: height})
+	return m
+}
+
+func typeText(m *model, text string) {
+	m.Update(tea.KeyMsg{Type: tea.KeyRunes, Runes: []rune(text)})
+}
+
+func press(m *model, k tea.KeyType) tea.Cmd {
+	_, cmd := m.Update(tea.KeyMsg{Type: k})
+	return cmd
+}
+
+func quits(cmd tea.Cmd) bool {
+	if cmd == nil {
+		return false
+	}
+	_, ok := cmd().(tea.QuitMsg)
+	return ok
+}
+
+func TestLayout(t *testing.T) {
+	for _, size := range []struct{ w, h int }{{160, 40}, {120, 30}, {80, 24}, {minWidth, minHeight}} {
+		m := testModel(t, size.w, size.h)
+		m.system("%s", strings.Repeat("a long notice that has to be wrapped ", 10))
+		m.Update(refreshMsg{})
+
+		lines := strings.Split(m.View(), "\n")
+		if len(lines) != size.h {
+			t.Errorf("%dx%d: %d lines", size.w, size.h, len(lines))
+		}
+		for i, l := range lines {
+			if w := lipgloss.Width(l); w > size.w {
+				t.Errorf("%dx%d: line %d is %d wide: %q", size.w, size.h, i, w, l)
+			}
+		}
+	}
+
+	m := testModel(t, minWidth-1, 20)
+	if got := m.View(); !strings.HasPrefix(got, "Za małe") {
+		t.Errorf("small window shows %q", got)
+	}
+}
+
+func TestColumns(t *testing.T) {
+	m := testModel(t, 160, 40)
+	if rooms, chat, panel := m.columns(); rooms+chat+panel+2 != 160 || panel != panelWidth {
+		t.Errorf("160 wide: %d %d %d", rooms, chat, panel)
+	}
+	// narrow: the panel takes the chat's place
+	m.Update(tea.WindowSizeMsg{Width: 80, Height: 24})
+	if _, chat, panel := m.columns(); chat != 0 || panel != 80-roomsWidth-1 {
+		t.Errorf("80 wide: chat %d, panel %d", chat, panel)
+	}
+	press(m, tea.KeyF2)
+	if _, chat, panel := m.columns(); chat != 80-roomsWidth-1 || panel != 0 {
+		t.Errorf("80 wide without the panel: chat %d, panel %d", chat, panel)
+	}
+}
+
+func TestChatWrapsAndScrolls(t *testing.T) {
+	m := testModel(t, 160, 20)
+	_, chatW, _ := m.columns()
+	m.system("%s", strings.Repeat("x", chatW*3))
+	for i := 0; i < 50; i++ {
+		m.system("line %d", i)
+	}
+	m.Update(refreshMsg{})
+	// the status line repeats the last notice; look at the chat only
+	if !strings.Contains(m.chat.View(), "line 49") {
+		t.Fatal("newest line not shown")
+	}
+	for _, l := range m.chatLines(chatW) {
+		if lipgloss.Width(l) > chatW {
+			t.Fatalf("chat line %d wide, chat %d", lipgloss.Width(l), chatW)
+		}
+	}
+
+	press(m, tea.KeyPgUp)
+	if strings.Contains(m.chat.View(), "line 49") {
+		t.Fatal("PgUp didn't scroll")
+	}
+	// new lines don't move the view while reading back
+	top := m.chat.YOffset
+	m.system("line 50")
+	m.Update(refreshMsg{})
+	if m.chat.YOffset != top {
+		t.Errorf("view moved from %d to %d", top, m.chat.YOffset)
+	}
+	press(m, tea.KeyPgDown)
+	press(m, tea.KeyPgDown)
+	if !strings.Contains(m.chat.View(), "line 50") {
+		t.Fatal("PgDn didn't come back")
+	}
+}
+
+// text from peers can't move the cursor or restyle the terminal
+func TestPeerTextIsCleaned(t *testing.T) {
+	m := testModel(t, 160, 30)
+	m.Update(&crypto.MessagePayload{
+		SenderID:  "0123456789abcdef",
+		Message:   "hi\x1b[2J\x1b]0;title\x07 there",
+		Timestamp: time.Now(),
+	})
+	view := m.View()
+	for _, seq := range []string{"\x1b[2J", "\x1b]0", "\x07"} {
+		if strings.Contains(view, seq) {
+			t.Errorf("view holds %q", seq)
+		}
+	}
+	if !strings.Contains(view, "hi[2J]0;title there") {
+		t.Error("message not shown")
+	}
+}
+
+func TestKeys(t *testing.T) {
+	m := testModel(t, 120, 30)
+
+	typeText(m, "hello world")
+	if got := m.input.Value(); got != "hello world" {
+		t.Fatalf("input %q", got)
+	}
+	press(m, tea.KeyCtrlW)
+	if got := m.input.Value(); got != "hello " {
+		t.Fatalf("after Ctrl+W: %q", got)
+	}
+	press(m, tea.KeyCtrlU)
+	if got := m.input.Value(); got != "" {
+		t.Fatalf("after Ctrl+U: %q", got)
+	}
+
+	// Tab moves between the room list and the input
+	press(m, tea.KeyTab)
+	if m.focus != focusRooms || m.input.Focused() {
+		t.Fatal("Tab didn't focus the room list")
+	}
+	typeText(m, "x")
+	if m.input.Value() != "" {
+		t.Fatal("typed into the input while on the room list")
+	}
+	press(m, tea.KeyEsc)
+	if m.focus != focusInput || !m.input.Focused() {
+		t.Fatal("Esc didn't focus the input")
+	}
+
+	if quits(press(m, tea.KeyCtrlD)) != true {
+		t.Error("Ctrl+D on an empty line didn't quit")
+	}
+	typeText(m, "x")
+	if quits(press(m, tea.KeyCtrlD)) {
+		t.Error("Ctrl+D quit with text on the line")
+	}
+	if !quits(press(m, tea.KeyCtrlC)) {
+		t.Error("Ctrl+C didn't quit")
+	}
+}
+
+func TestCommands(t *testing.T) {
+	m := testModel(t, 120, 30)
+	run := func(text string) tea.Cmd {
+		m.input.Reset()
+		typeText(m, text)
+		return press(m, tea.KeyEnter)
+	}
+
+	run("/help")
+	if !strings.Contains(m.chat.View(), "/quit") {
+		t.Error("/help not shown")
+	}
+	run("/nick Ala")
+	if m.nick != "Ala" {
+		t.Errorf("nick %q", m.nick)
+	}
+	run("/bogus")
+	if !strings.Contains(m.status, "Nieznane polecenie /bogus") {
+		t.Errorf("status %q", m.status)
+	}
+	run("no room yet")
+	if !strings.Contains(m.status, "/create") {
+		t.Errorf("status %q", m.status)
+	}
+	run("/clear")
+	if len(m.chats[""]) != 0 {
+		t.Error("/clear left lines")
+	}
+	if !quits(run("/quit")) {
+		t.Error("/quit didn't quit")
+	}
+}
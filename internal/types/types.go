@@ -2,7 +2,105 @@ package types
 
 // CreateRoomResult zawiera wynik tworzenia nowego pokoju
 type CreateRoomResult struct {
-	RoomID     string
-	AccessKey  string
-	ListenPort int // Port, na którym nasłuchuje twórca pokoju
+	RoomID     string `json:"room_id"`
+	AccessKey  string `json:"access_key"`
+	ListenPort int    `json:"listen_port"` // Port, na którym nasłuchuje twórca pokoju
+	Incognito  bool   `json:"incognito"`   // Pokój tylko w pamięci
+}
+
+// NetworkStatus opisuje stan połączenia z pokojem i szyfrowania
+type NetworkStatus struct {
+	PeerID         string `json:"peer_id"`
+	ListenPort     int    `json:"listen_port"`
+	RoomID         string `json:"room_id"` // pusty poza pokojem
+	RoomName       string `json:"room_name,omitempty"`
+	Role           string `json:"role,omitempty"` // host, moderator albo member
+	ConnectedPeers int    `json:"connected_peers"`
+	VerifiedPeers  int    `json:"verified_peers"`
+	E2EEncryption  bool   `json:"e2e_encryption"`
+	IsRunning      bool   `json:"is_running"`
+	IsListener     bool   `json:"is_listener"`         // jesteśmy hostem pokoju
+	Degraded       bool   `json:"degraded"`            // rozmówca nie odpowiada, trwa ponowne łączenie
+	ClosesAt       string `json:"closes_at,omitempty"` // RFC 3339; kiedy nasz pokój sam się zamknie
+}
+
+// EncryptionAlgorithms to nazwy używanych algorytmów postkwantowych
+type EncryptionAlgorithms struct {
+	KeyExchange string `json:"key_exchange"`
+	Signatures  string `json:"signatures"`
+	Symmetric   string `json:"symmetric"`
+}
+
+// RoomInfo to dane pokoju znane tylko jego hostowi
+type RoomInfo struct {
+	RoomID    string `json:"room_id"`
+	AccessKey string `json:"access_key"`
+	IsPrivate bool   `json:"is_private"`
+}
+
+// SecuritySummary podsumowuje tożsamość i zabezpieczenia
+type SecuritySummary struct {
+	EncryptionAlgorithms EncryptionAlgorithms `json:"encryption_algorithms"`
+	IdentityFingerprint  string               `json:"identity_fingerprint,omitempty"`
+	IdentityPersistent   bool                 `json:"identity_persistent"`
+	KeystoreProtection   string               `json:"keystore_protection,omitempty"` // tylko dla trwałej tożsamości
+	PinnedPeers          int                  `json:"pinned_peers"`
+	RoomArchived         bool                 `json:"room_archived"`
+	RequireVerified      bool                 `json:"require_verified"`
+	Incognito            bool                 `json:"incognito"`
+	// odciski palca rozmówców po wymianie kluczy, według ID
+	PeerFingerprints map[string]string `json:"peer_fingerprints"`
+	// tylko gdy jesteśmy hostem pokoju
+	RoomInfo *RoomInfo `json:"room_info,omitempty"`
+}
+
+// PeerInfo to uczestnik pokoju na liście użytkowników
+type PeerInfo struct {
+	ID          string `json:"id"`
+	Nickname    string `json:"nickname"` // z wyróżnikiem przy kolizji nicków
+	IsLocal     bool   `json:"isLocal"`
+	Presence    string `json:"presence"` // online, away albo dnd
+	Role        string `json:"role"`     // host, moderator albo member
+	Fingerprint string `json:"fingerprint"`
+	// unverified, keys_exchanged albo user_verified; pusty dla nas
+	Verification string `json:"verification,omitempty"`
+	// połączenie z uczestnikiem; puste dla nas
+	Address        string `json:"address,omitempty"`
+	Transport      string `json:"transport,omitempty"`       // np. quic/direct
+	ConnectedSince int64  `json:"connected_since,omitempty"` // unix
+	LastActivity   int64  `json:"last_activity,omitempty"`   // unix, ostatnio odebrane cokolwiek
+	// połączenie jest, ale uczestnik od dłuższej chwili milczy
+	Offline bool `json:"offline,omitempty"`
+	// z podpisanego profilu
+	Status string `json:"status,omitempty"`
+	Avatar string `json:"avatar,omitempty"` // data URL, gdy obrazek już dotarł
+}
+
+// Profile to nasz podpisany profil
+type Profile struct {
+	Nickname    string `json:"nickname"`
+	Status      string `json:"status"`
+	Avatar      string `json:"avatar,omitempty"` // data URL
+	AvatarHash  string `json:"avatar_hash,omitempty"`
+	Fingerprint string `json:"fingerprint"`
+	UpdatedAt   int64  `json:"updated_at"` // unix
+}
+
+// RoomSummary opisuje jeden z pokojów, w których jesteśmy jednocześnie
+type RoomSummary struct {
+	RoomID         string `json:"room_id"`
+	RoomName       string `json:"room_name,omitempty"`
+	IsListener     bool   `json:"is_listener"` // jesteśmy hostem pokoju
+	Incognito      bool   `json:"incognito"`
+	ConnectedPeers int    `json:"connected_peers"`
+	Unread         int    `json:"unread"` // wiadomości od ostatniego przeczytania
+	Active         bool   `json:"active"` // pokój wybrany w interfejsie
+}
+
+// Ban to tożsamość zablokowana w pokoju przez hosta
+type Ban struct {
+	Fingerprint string `json:"fingerprint"`
+	Nickname    string `json:"nickname,omitempty"`
+	Reason      string `json:"reason,omitempty"`
+	BannedAt    int64  `json:"banned_at"` // unix
 }
@@ -42,8 +42,8 @@ type AppController interface {
 	GetRoomInfo() *room.Room
 	GetListenPort() int
 	GetPeerFingerprint() (string, error)
-	GetSecuritySummary() map[string]interface{}
-	GetNetworkStatus() map[string]interface{}
+	GetSecuritySummary() types.SecuritySummary
+	GetNetworkStatus() types.NetworkStatus
 	SendMessage(ctx context.Context, message string) error
 	RegenerateRoomAccessKey() (string, error)
 }
@@ -209,14 +209,13 @@ func (ui *WebviewUI) PushFullStateUpdate() {
 
 func (ui *WebviewUI) updateSettingsPane() {
 	fingerprint, _ := ui.app.GetPeerFingerprint()
-	securitySummary := ui.app.GetSecuritySummary()
-	algos := securitySummary["encryption_algorithms"].(map[string]string)
+	algos := ui.app.GetSecuritySummary().EncryptionAlgorithms
 
 	settings := map[string]interface{}{
 		"identity_fingerprint": fingerprint,
-		"kem_algo":             algos["key_exchange"],
-		"sig_algo":             algos["signatures"],
-		"sym_algo":             algos["symmetric"],
+		"kem_algo":             algos.KeyExchange,
+		"sig_algo":             algos.Signatures,
+		"sym_algo":             algos.Symmetric,
 	}
 
 	if room := ui.app.GetRoomInfo(); room != nil {
@@ -232,9 +231,7 @@ func (ui *WebviewUI) updateSettingsPane() {
 
 func (ui *WebviewUI) updateConnectionStatus() {
 	status := ui.app.GetNetworkStatus()
-	connectedPeers := status["connected_peers"].(int)
-	verifiedPeers := status["verified_peers"].(int)
-	ui.runJS(fmt.Sprintf("updateStatus(%d, %d)", connectedPeers, verifiedPeers))
+	ui.runJS(fmt.Sprintf("updateStatus(%d, %d)", status.ConnectedPeers, status.VerifiedPeers))
 }
 
 // AddMessage adds a new message to the chat display.
@@ -0,0 +1,181 @@
+// Package verification lets two people in the same room verify each other's
+// identity by scanning a QR code instead of reading fingerprints aloud.
+//
+// A code carries the owner's peer ID and identity fingerprint, bound to the
+// session: a tag of the room, the fingerprint the owner sees for the peer it
+// is shown to, and the time it was issued. Scanning it checks that the owner's
+// fingerprint matches what our end of the connection sees and, mutually, that
+// the owner sees our real fingerprint, so a man in the middle (who would show
+// each side a different identity) cannot pass.
+package verification
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	qrcode "github.com/skip2/go-qrcode"
+)
+
+// Scheme prefixes every verification code
+const Scheme = "execp2p-verify"
+
+const codeVersion = 1
+
+// MaxAge is how long a code stays valid; a photo of an old code won't do
+const MaxAge = 10 * time.Minute
+
+// allowed clock difference between the two devices
+const clockSkew = 2 * time.Minute
+
+var (
+	ErrMalformed           = errors.New("not an ExecP2P verification code")
+	ErrUnsupportedVersion  = errors.New("unsupported verification code version")
+	ErrExpired             = errors.New("verification code expired")
+	ErrWrongRoom           = errors.New("verification code is for another room")
+	ErrUnknownPeer         = errors.New("verification code is from a peer not in this room")
+	ErrFingerprintMismatch = errors.New("fingerprint does not match the connected peer")
+	ErrSeesOtherIdentity   = errors.New("peer sees a different fingerprint for us")
+)
+
+// Code is the content of a verification QR
+type Code struct {
+	Version     int
+	PeerID      string
+	Fingerprint string
+	// RoomTag identifies the room without revealing its ID
+	RoomTag string
+	// PeerFingerprint is the fingerprint the owner sees for the peer the
+	// code is shown to; empty if it has none yet
+	PeerFingerprint string
+	Issued          time.Time
+}
+
+// NewCode creates a code for showing to the peer whose fingerprint (as we
+// see it) is peerFingerprint
+func NewCode(peerID, fingerprint, roomID, peerFingerprint string) Code {
+	return Code{
+		Version:         codeVersion,
+		PeerID:          peerID,
+		Fingerprint:     fingerprint,
+		RoomTag:         RoomTag(roomID),
+		PeerFingerprint: peerFingerprint,
+		Issued:          time.Now().UTC().Truncate(time.Second),
+	}
+}
+
+// RoomTag derives the short room identifier used in codes
+func RoomTag(roomID string) string {
+	sum := sha256.Sum256([]byte(Scheme + ":" + roomID))
+	return hex.EncodeToString(sum[:8])
+}
+
+// String encodes the code as scanned from the QR
+func (c Code) String() string {
+	v := url.Values{}
+	v.Set("id", c.PeerID)
+	v.Set("fp", c.Fingerprint)
+	v.Set("room", c.RoomTag)
+	if c.PeerFingerprint != "" {
+		v.Set("sees", c.PeerFingerprint)
+	}
+	v.Set("ts", strconv.FormatInt(c.Issued.Unix(), 10))
+	return fmt.Sprintf("%s:%d?%s", Scheme, c.Version, v.Encode())
+}
+
+// PNG renders the code as a QR image of size×size pixels
+func (c Code) PNG(size int) ([]byte, error) {
+	png, err := qrcode.Encode(c.String(), qrcode.Medium, size)
+	if err != nil {
+		return nil, fmt.Errorf("failed to render QR code: %w", err)
+	}
+	return png, nil
+}
+
+// Parse decodes a scanned code
+func Parse(s string) (Code, error) {
+	s = strings.TrimSpace(s)
+	rest, ok := strings.CutPrefix(s, Scheme+":")
+	if !ok {
+		return Code{}, ErrMalformed
+	}
+	versionStr, query, ok := strings.Cut(rest, "?")
+	if !ok {
+		return Code{}, ErrMalformed
+	}
+	version, err := strconv.Atoi(versionStr)
+	if err != nil {
+		return Code{}, ErrMalformed
+	}
+	if version != codeVersion {
+		return Code{}, fmt.Errorf("%w: %d", ErrUnsupportedVersion, version)
+	}
+	v, err := url.ParseQuery(query)
+	if err != nil {
+		return Code{}, ErrMalformed
+	}
+	ts, err := strconv.ParseInt(v.Get("ts"), 10, 64)
+	if err != nil {
+		return Code{}, ErrMalformed
+	}
+
+	c := Code{
+		Version:         version,
+		PeerID:          v.Get("id"),
+		Fingerprint:     strings.ToLower(v.Get("fp")),
+		RoomTag:         v.Get("room"),
+		PeerFingerprint: strings.ToLower(v.Get("sees")),
+		Issued:          time.Unix(ts, 0).UTC(),
+	}
+	if c.PeerID == "" || c.Fingerprint == "" || c.RoomTag == "" {
+		return Code{}, ErrMalformed
+	}
+	return c, nil
+}
+
+// Session is our side of the connection the scanned code is checked against
+type Session struct {
+	// our own identity fingerprint
+	Fingerprint string
+	RoomID      string
+	// fingerprints of the peers we are connected to, by peer ID
+	PeerFingerprints map[string]string
+}
+
+// Result describes a successful verification
+type Result struct {
+	PeerID      string
+	Fingerprint string
+	// the peer's code also confirmed our fingerprint, so both directions of
+	// the connection are verified
+	Mutual bool
+}
+
+// Check validates a scanned code against the current session
+func Check(c Code, s Session, now time.Time) (Result, error) {
+	if now.Sub(c.Issued) > MaxAge {
+		return Result{}, ErrExpired
+	}
+	if c.Issued.Sub(now) > clockSkew {
+		return Result{}, fmt.Errorf("%w: issued in the future", ErrExpired)
+	}
+	if c.RoomTag != RoomTag(s.RoomID) {
+		return Result{}, ErrWrongRoom
+	}
+	seen, ok := s.PeerFingerprints[c.PeerID]
+	if !ok {
+		return Result{}, ErrUnknownPeer
+	}
+	if seen != c.Fingerprint {
+		return Result{}, ErrFingerprintMismatch
+	}
+	if c.PeerFingerprint != "" && c.PeerFingerprint != s.Fingerprint {
+		return Result{}, ErrSeesOtherIdentity
+	}
+	return Result{PeerID: c.PeerID, Fingerprint: c.Fingerprint, Mutual: c.PeerFingerprint != ""}, nil
+}
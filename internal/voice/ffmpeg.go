@@ -0,0 +1,333 @@
+package voice
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"execp2p/internal/logger"
+)
+
+// how long ffmpeg gets to finish after being asked to quit
+const quitTimeout = 3 * time.Second
+
+// Engine runs ffmpeg and ffplay for recording, encoding and playback
+type Engine struct {
+	ffmpeg      string
+	ffplay      string
+	input       []string
+	bitrate     int
+	maxDuration time.Duration
+}
+
+// Options configure an Engine; zero values pick the defaults
+type Options struct {
+	// path of ffmpeg, empty looks it up in PATH; ffplay is looked up next to it
+	FFmpegPath string
+	// capture input as "format:device", e.g. "dshow:audio=Microphone";
+	// empty uses the platform's default microphone
+	Input       string
+	Bitrate     int
+	MaxDuration time.Duration
+}
+
+// NewEngine finds ffmpeg; ErrUnavailable if it isn't installed
+func NewEngine(opts Options) (*Engine, error) {
+	name := opts.FFmpegPath
+	if name == "" {
+		name = "ffmpeg"
+	}
+	ffmpeg, err := exec.LookPath(name)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrUnavailable, err)
+	}
+	input, err := captureInput(opts.Input)
+	if err != nil {
+		return nil, err
+	}
+	e := &Engine{ffmpeg: ffmpeg, input: input, bitrate: opts.Bitrate, maxDuration: opts.MaxDuration}
+	if e.bitrate <= 0 {
+		e.bitrate = DefaultBitrate
+	}
+	if e.maxDuration <= 0 {
+		e.maxDuration = DefaultMaxDuration
+	}
+	// ffplay usually ships with ffmpeg
+	sibling := filepath.Join(filepath.Dir(ffmpeg), "ffplay"+filepath.Ext(ffmpeg))
+	if path, err := exec.LookPath(sibling); err == nil {
+		e.ffplay = path
+	} else if path, err := exec.LookPath("ffplay"); err == nil {
+		e.ffplay = path
+	}
+	return e, nil
+}
+
+// CanPlay reports whether ffplay was found
+func (e *Engine) CanPlay() bool {
+	return e.ffplay != ""
+}
+
+// captureInput returns the ffmpeg input arguments of the microphone
+func captureInput(spec string) ([]string, error) {
+	if spec != "" {
+		format, device, ok := strings.Cut(spec, ":")
+		if !ok || format == "" {
+			return nil, fmt.Errorf("invalid voice input %q, expected format:device", spec)
+		}
+		return []string{"-f", format, "-i", device}, nil
+	}
+	switch runtime.GOOS {
+	case "linux":
+		// PulseAudio, or PipeWire through its PulseAudio server
+		return []string{"-f", "pulse", "-i", "default"}, nil
+	case "darwin":
+		return []string{"-f", "avfoundation", "-i", ":0"}, nil
+	}
+	// DirectShow has no default device: it has to be named
+	return nil, fmt.Errorf("%w: set the voice input device (e.g. dshow:audio=<name>)", ErrUnavailable)
+}
+
+// pcmArgs make ffmpeg write mono 16-bit PCM to stdout
+func pcmArgs() []string {
+	return []string{"-ac", strconv.Itoa(Channels), "-ar", strconv.Itoa(SampleRate), "-f", "s16le", "-acodec", "pcm_s16le", "pipe:1"}
+}
+
+// Recording is a microphone capture in progress
+type Recording struct {
+	cmd     *exec.Cmd
+	stdin   io.WriteCloser
+	started time.Time
+	done    chan struct{}
+	stderr  tail
+
+	mu  sync.Mutex
+	pcm bytes.Buffer
+	err error
+}
+
+// Record starts capturing the microphone. The capture ends by itself after
+// the maximum duration; Stop returns what was recorded.
+func (e *Engine) Record() (*Recording, error) {
+	args := []string{"-hide_banner", "-loglevel", "error"}
+	args = append(args, e.input...)
+	args = append(args, "-t", strconv.FormatFloat(e.maxDuration.Seconds(), 'f', 0, 64))
+	args = append(args, pcmArgs()...)
+
+	r := &Recording{cmd: exec.Command(e.ffmpeg, args...), done: make(chan struct{})}
+	r.cmd.Stderr = &r.stderr
+	stdin, err := r.cmd.StdinPipe()
+	if err != nil {
+		return nil, err
+	}
+	stdout, err := r.cmd.StdoutPipe()
+	if err != nil {
+		return nil, err
+	}
+	r.stdin = stdin
+	if err := r.cmd.Start(); err != nil {
+		return nil, fmt.Errorf("failed to start ffmpeg: %w", err)
+	}
+	r.started = time.Now()
+
+	go func() {
+		defer close(r.done)
+		buf := make([]byte, 32<<10)
+		for {
+			n, err := stdout.Read(buf)
+			r.mu.Lock()
+			r.pcm.Write(buf[:n])
+			r.mu.Unlock()
+			if err != nil {
+				break
+			}
+		}
+		if err := r.cmd.Wait(); err != nil {
+			r.mu.Lock()
+			r.err = fmt.Errorf("ffmpeg: %w (%s)", err, r.stderr.String())
+			r.mu.Unlock()
+		}
+	}()
+	return r, nil
+}
+
+// Elapsed returns how long the recording has been running
+func (r *Recording) Elapsed() time.Duration {
+	return time.Since(r.started)
+}
+
+// Done is closed when the capture has ended, by Stop or by reaching the
+// maximum duration
+func (r *Recording) Done() <-chan struct{} {
+	return r.done
+}
+
+// Stop ends the capture and returns the recorded PCM
+func (r *Recording) Stop() ([]int16, error) {
+	r.quit()
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	pcm := samples(r.pcm.Bytes())
+	if len(pcm) == 0 && r.err != nil {
+		return nil, r.err
+	}
+	if Duration(len(pcm)) < minDuration {
+		return nil, ErrTooShort
+	}
+	return pcm, nil
+}
+
+// Cancel ends the capture and drops it
+func (r *Recording) Cancel() {
+	r.quit()
+	r.mu.Lock()
+	r.pcm.Reset()
+	r.mu.Unlock()
+}
+
+// quit asks ffmpeg to finish ('q' on stdin), killing it if it doesn't
+func (r *Recording) quit() {
+	select {
+	case <-r.done:
+		return
+	default:
+	}
+	r.stdin.Write([]byte("q"))
+	r.stdin.Close()
+	select {
+	case <-r.done:
+	case <-time.After(quitTimeout):
+		r.cmd.Process.Kill()
+		<-r.done
+	}
+}
+
+// Encode turns mono PCM into an Ogg/Opus voice message with its waveform
+func (e *Engine) Encode(ctx context.Context, pcm []int16) (*Clip, error) {
+	raw := make([]byte, 2*len(pcm))
+	for i, s := range pcm {
+		binary.LittleEndian.PutUint16(raw[2*i:], uint16(s))
+	}
+	args := []string{"-hide_banner", "-loglevel", "error",
+		"-f", "s16le", "-ar", strconv.Itoa(SampleRate), "-ac", strconv.Itoa(Channels), "-i", "pipe:0",
+		"-c:a", "libopus", "-b:a", strconv.Itoa(e.bitrate), "-application", "voip",
+		"-map_metadata", "-1", "-f", "ogg", "pipe:1"}
+	data, err := e.run(ctx, args, raw)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode voice message: %w", err)
+	}
+	return &Clip{
+		Data:        data,
+		ContentType: ContentType,
+		Duration:    Duration(len(pcm)),
+		Waveform:    Waveform(pcm, WaveformBars),
+	}, nil
+}
+
+// Analyze decodes a voice message in any format ffmpeg reads and returns
+// its duration and waveform
+func (e *Engine) Analyze(ctx context.Context, data []byte) (time.Duration, []byte, error) {
+	args := append([]string{"-hide_banner", "-loglevel", "error", "-i", "pipe:0"}, pcmArgs()...)
+	raw, err := e.run(ctx, args, data)
+	if err != nil {
+		return 0, nil, fmt.Errorf("failed to decode voice message: %w", err)
+	}
+	pcm := samples(raw)
+	return Duration(len(pcm)), Waveform(pcm, WaveformBars), nil
+}
+
+func (e *Engine) run(ctx context.Context, args []string, input []byte) ([]byte, error) {
+	var out bytes.Buffer
+	var stderr tail
+	cmd := exec.CommandContext(ctx, e.ffmpeg, args...)
+	cmd.Stdin = bytes.NewReader(input)
+	cmd.Stdout = &out
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		return nil, fmt.Errorf("ffmpeg: %w (%s)", err, stderr.String())
+	}
+	return out.Bytes(), nil
+}
+
+// Playback is a voice message being played
+type Playback struct {
+	cmd  *exec.Cmd
+	done chan struct{}
+}
+
+// Play plays an encoded voice message through ffplay
+func (e *Engine) Play(data []byte) (*Playback, error) {
+	if e.ffplay == "" {
+		return nil, fmt.Errorf("%w: ffplay not found", ErrUnavailable)
+	}
+	cmd := exec.Command(e.ffplay, "-hide_banner", "-loglevel", "error", "-nodisp", "-autoexit", "-i", "pipe:0")
+	cmd.Stdin = bytes.NewReader(data)
+	if err := cmd.Start(); err != nil {
+		return nil, fmt.Errorf("failed to start ffplay: %w", err)
+	}
+	p := &Playback{cmd: cmd, done: make(chan struct{})}
+	go func() {
+		if err := cmd.Wait(); err != nil {
+			logger.L().Debug("Voice playback ended", "err", err)
+		}
+		close(p.done)
+	}()
+	return p, nil
+}
+
+// Done is closed when playback has finished or was stopped
+func (p *Playback) Done() <-chan struct{} {
+	return p.done
+}
+
+// Stop ends playback
+func (p *Playback) Stop() {
+	select {
+	case <-p.done:
+		return
+	default:
+	}
+	p.cmd.Process.Kill()
+	<-p.done
+}
+
+// samples reads little-endian 16-bit PCM, dropping a trailing odd byte
+func samples(raw []byte) []int16 {
+	pcm := make([]int16, len(raw)/2)
+	for i := range pcm {
+		pcm[i] = int16(binary.LittleEndian.Uint16(raw[2*i:]))
+	}
+	return pcm
+}
+
+// tail keeps the end of ffmpeg's error output for error messages
+type tail struct {
+	mu  sync.Mutex
+	buf []byte
+}
+
+const tailSize = 512
+
+func (t *tail) Write(p []byte) (int, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.buf = append(t.buf, p...)
+	if len(t.buf) > tailSize {
+		t.buf = t.buf[len(t.buf)-tailSize:]
+	}
+	return len(p), nil
+}
+
+func (t *tail) String() string {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return strings.TrimSpace(string(t.buf))
+}
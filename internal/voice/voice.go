@@ -0,0 +1,88 @@
+// Package voice records, encodes and plays voice messages in the backend
+// instead of the web view, whose codecs differ between platforms (WebKit on
+// macOS can neither record WebM nor play Ogg). The audio work is done by
+// ffmpeg run as a child process: it captures the microphone as raw PCM,
+// which is measured here for the waveform and then encoded to Ogg/Opus.
+// Playback uses ffplay. Without ffmpeg the engine reports ErrUnavailable
+// and the web view records as before.
+package voice
+
+import (
+	"errors"
+	"math"
+	"time"
+)
+
+const (
+	// SampleRate and Channels of the PCM that is captured and analysed
+	SampleRate = 48000
+	Channels   = 1
+
+	// ContentType of encoded voice messages
+	ContentType = "audio/ogg; codecs=opus"
+
+	// WaveformBars is the number of values in a waveform
+	WaveformBars = 64
+
+	// DefaultBitrate of the Opus encoder in bits per second; plenty for speech
+	DefaultBitrate = 24000
+	// DefaultMaxDuration caps a recording
+	DefaultMaxDuration = 5 * time.Minute
+
+	// recordings shorter than this are treated as accidental clicks
+	minDuration = 300 * time.Millisecond
+)
+
+var (
+	// ErrUnavailable means ffmpeg (or ffplay, for playback) wasn't found
+	ErrUnavailable = errors.New("voice: ffmpeg not available")
+	// ErrTooShort means a recording was stopped right after it started
+	ErrTooShort = errors.New("voice: recording too short")
+)
+
+// Clip is an encoded voice message
+type Clip struct {
+	Data        []byte
+	ContentType string
+	Duration    time.Duration
+	Waveform    []byte
+}
+
+// Duration returns how long samples of mono PCM play
+func Duration(samples int) time.Duration {
+	return time.Duration(samples) * time.Second / SampleRate
+}
+
+// Waveform reduces PCM to bars values from 0 to 255: the loudness (RMS) of
+// every slice, relative to the loudest one, so quiet recordings keep their
+// shape
+func Waveform(pcm []int16, bars int) []byte {
+	out := make([]byte, bars)
+	if len(pcm) == 0 || bars <= 0 {
+		return out
+	}
+	levels := make([]float64, bars)
+	var loudest float64
+	for i := range levels {
+		from, to := i*len(pcm)/bars, (i+1)*len(pcm)/bars
+		if to <= from {
+			to = from + 1
+		}
+		if to > len(pcm) {
+			to = len(pcm)
+		}
+		var sum float64
+		for _, s := range pcm[from:to] {
+			sum += float64(s) * float64(s)
+		}
+		levels[i] = math.Sqrt(sum / float64(to-from))
+		loudest = math.Max(loudest, levels[i])
+	}
+	if loudest == 0 {
+		return out
+	}
+	for i, level := range levels {
+		out[i] = byte(math.Round(level / loudest * 255))
+	}
+	return out
+}
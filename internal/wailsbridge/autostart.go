@@ -0,0 +1,33 @@
+package wailsbridge
+
+import (
+	"fmt"
+
+	"execp2p/internal/platform"
+)
+
+// GetAutostart zwraca, czy ExecP2P uruchamia się po zalogowaniu: enabled
+// i mode (gui — okno zminimalizowane, daemon — bez okna)
+func (b *Bridge) GetAutostart() (map[string]interface{}, error) {
+	mode, err := platform.Autostart()
+	if err != nil {
+		return nil, err
+	}
+	return map[string]interface{}{
+		"enabled": mode != "",
+		"mode":    string(mode),
+	}, nil
+}
+
+// SetAutostart rejestruje ExecP2P do uruchamiania po zalogowaniu w trybie
+// mode albo wyrejestrowuje, gdy enabled jest fałszem
+func (b *Bridge) SetAutostart(enabled bool, mode string) error {
+	if !enabled {
+		return platform.DisableAutostart()
+	}
+	switch m := platform.AutostartMode(mode); m {
+	case platform.AutostartGUI, platform.AutostartDaemon:
+		return platform.EnableAutostart(m)
+	}
+	return fmt.Errorf("nieznany tryb uruchamiania: %q", mode)
+}
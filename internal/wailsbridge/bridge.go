@@ -2,42 +2,117 @@ package wailsbridge
 
 import (
 	"context"
+	"encoding/base64"
 	"encoding/json"
+	"errors"
 	"execp2p/internal/app"
+	"execp2p/internal/config"
+	"execp2p/internal/crash"
 	"execp2p/internal/crypto"
-	"execp2p/internal/network" // potrzebne dla typu zwracanego z GetNetworkAccess
+	"execp2p/internal/diagnostics"
+	"execp2p/internal/history"
+	"execp2p/internal/logger"
+	"execp2p/internal/network"
+	"execp2p/internal/notify"
+	"execp2p/internal/outbox"
+	"execp2p/internal/room"
+	"execp2p/internal/roster"
+	"execp2p/internal/timefmt"
+	"execp2p/internal/trust"
+	"execp2p/internal/types"
+	"execp2p/internal/verification"
 	"fmt"
+	"maps"
 	"math"
 	"net"
+	"os"
+	"slices"
+	"strings"
+	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/wailsapp/wails/v2/pkg/runtime"
 )
 
-// Bufor wiadomości, które nie zostały wysłane z powodu problemów z połączeniem
-var pendingMessages = make([]string, 0)
+// Czas na sprawdzenie peer'a (ping + jedno ponowne połączenie) przed
+// zgłoszeniem, że połączenie nie jest aktywne
+const reachabilityTimeout = 8 * time.Second
 
 // EventTypes - typy zdarzeń emitowanych do frontendu
 const (
 	EventMessageReceived  = "message:received"
 	EventStatusUpdate     = "status:update"
+	EventUsersUpdate      = "users:update"
 	EventSecurityMessage  = "security:message"
 	EventNetworkError     = "network:error"
 	EventPeerFingerprints = "peer:fingerprints"
 	EventNicknameUpdate   = "nickname:update"
+
+	EventFingerprintChanged = "security:fingerprint_changed"
+	EventSecurityAlert      = "security:alert"
+	EventRoomArchive        = "room:archive"
+	EventRoomShortcodes     = "room:shortcodes"
+	EventRoomAccessKey      = "room:access_key"
+	EventSecurityRekey      = "security:rekey"
+	EventHistorySynced      = "history:synced"
+	EventMailboxDelivered   = "mailbox:delivered"
+	EventContactRequest     = "contact:request"
+	EventInviteReceived     = "invite:received"
+	EventVoicePlayback      = "voice:playback"
+	EventTransferProgress   = "transfer:progress"
+	EventTransferComplete   = "transfer:complete"
+	EventOutboxUpdate       = "outbox:update"
+	EventPeerPresence       = "peer:presence"
+	EventRoomKicked         = "room:kicked"
+	EventPeerDisconnected   = "peer:disconnected"
+	EventPeerOffline        = "peer:offline"
+	EventPeerOnline         = "peer:online"
+	EventRoomBanned         = "room:banned"
+	EventRoomClosed         = "room:closed"
+	EventRoomsUpdate        = "rooms:update"
+	EventRoomSelected       = "room:selected"
+	EventLogEntry           = "log:entry"
+	EventAppCrash           = "app:crash"
+	EventDeviceWiped        = "device:wiped"
 )
 
 // Bridge łączy istniejący back-end z Wails
 type Bridge struct {
 	ctx     context.Context
 	execp2p *app.ExecP2P
+
+	// pokój wybrany w interfejsie, gdy jesteśmy w kilku naraz (rooms.go)
+	mu         sync.Mutex
+	activeRoom string
+	// powrót do pokojów sprzed zamknięcia, raz po starcie
+	rejoinOnce sync.Once
+
+	// powiadomienia systemowe (notify.go); nil, gdy system ich nie obsługuje
+	notifier *notify.Notifier
+	// okno nie jest na wierzchu, ustawiane przez frontend
+	background atomic.Bool
+	// o uwagę prosimy raz, aż okno wróci na wierzch (unread.go)
+	attentionRequested atomic.Bool
+	// tytuł okna z liczbą nieprzeczytanych wiadomości, chroniony przez mu
+	title string
+	// zaproszenie z linku execp2p:// czekające na potwierdzenie (invite.go),
+	// chronione przez mu
+	pendingInvite *room.Invite
 }
 
 // NewBridge tworzy nową instancję Bridge
 func NewBridge(execp2p *app.ExecP2P) *Bridge {
-	return &Bridge{
+	b := &Bridge{
 		execp2p: execp2p,
 	}
+	notifier, err := notify.New()
+	if err != nil {
+		logger.L().Info("Desktop notifications unavailable", "err", err)
+	} else {
+		b.notifier = notifier
+	}
+	return b
 }
 
 // SetContext ustawia kontekst Wails
@@ -51,48 +126,31 @@ func (b *Bridge) SetContext(ctx context.Context) {
 
 // startKeepAlive wysyła regularne sygnały, aby utrzymać połączenie aktywne
 func (b *Bridge) startKeepAlive(ctx context.Context) {
-	ticker := time.NewTicker(1 * time.Second) // Znacznie częstsze sygnały dla maksymalnej stabilności
-	defer ticker.Stop()
-
-	for {
-		select {
-		case <-ctx.Done():
-			return
-		case <-ticker.C:
-			if b.execp2p != nil && b.ctx != nil {
-				// Sprawdź status sieci
-				status := b.execp2p.GetNetworkStatus()
-				if status["is_running"].(bool) && status["connected_peers"].(int) > 0 {
-					// Wyślij pusty sygnał keep-alive
-					keepAliveMsg := map[string]interface{}{
-						"type":    "keep_alive",
-						"content": "",
-						"time":    time.Now().Unix(),
-					}
-
-					msgBytes, err := json.Marshal(keepAliveMsg)
-					if err == nil {
-						// Ignorujemy błędy, bo to tylko sygnał keep-alive
-						_ = b.execp2p.SendMessage(b.ctx, string(msgBytes))
-					}
-				}
-			}
-		}
-	}
+	defer crash.Recover("wailsbridge.startKeepAlive")
+	b.execp2p.KeepAlive(ctx)
 }
 
 // CreateRoom tworzy nowy pokój
-func (b *Bridge) CreateRoom() (map[string]interface{}, error) {
-	result, err := b.execp2p.CreateRoom(b.ctx)
-	if err != nil {
-		return nil, err
-	}
-	// Zwracamy jako mapę ze wszystkimi polami
-	return map[string]interface{}{
-		"room_id":     result.RoomID,
-		"access_key":  result.AccessKey,
-		"listen_port": result.ListenPort,
-	}, nil
+func (b *Bridge) CreateRoom() (*types.CreateRoomResult, error) {
+	var result *types.CreateRoomResult
+	err := b.enter(func(s *app.ExecP2P) (err error) {
+		result, err = s.CreateRoom(b.ctx)
+		return err
+	})
+	return result, err
+}
+
+// CreateIncognitoRoom tworzy pokój incognito: nic o nim nie trafia na dysk
+// ani do logów, a uczestnicy dostają tę informację w metadanych pokoju
+func (b *Bridge) CreateIncognitoRoom() (*types.CreateRoomResult, error) {
+	opts := b.execp2p.DefaultRoomOptions()
+	opts.Incognito = true
+	var result *types.CreateRoomResult
+	err := b.enter(func(s *app.ExecP2P) (err error) {
+		result, err = s.CreateRoomWithOptions(b.ctx, opts)
+		return err
+	})
+	return result, err
 }
 
 // FindRoom wyszukuje pokój w sieci lokalnej i zwraca adres hosta z portem
@@ -105,7 +163,7 @@ func (b *Bridge) FindRoom(roomID string) (map[string]interface{}, error) {
 	defer cancel()
 
 	// Użyj autodetekcji, aby znaleźć pokój
-	addr, err := b.execp2p.TryLocalNetworkDiscovery(ctx, roomID)
+	addr, err := b.room().TryLocalNetworkDiscovery(ctx, roomID)
 	if err != nil {
 		return nil, fmt.Errorf("nie znaleziono pokoju: %w", err)
 	}
@@ -128,20 +186,71 @@ func (b *Bridge) FindRoom(roomID string) (map[string]interface{}, error) {
 // GetRoomAccessKey zwraca klucz dostępu do aktualnego pokoju
 func (b *Bridge) GetRoomAccessKey() (string, error) {
 	// Sprawdź czy bieżący pokój ma klucz dostępu w GetSecuritySummary
-	secSummary := b.execp2p.GetSecuritySummary()
-	if roomInfo, ok := secSummary["room_info"].(map[string]interface{}); ok {
-		if accessKey, ok := roomInfo["access_key"].(string); ok {
-			return accessKey, nil
-		}
+	if roomInfo := b.room().GetSecuritySummary().RoomInfo; roomInfo != nil && roomInfo.AccessKey != "" {
+		return roomInfo.AccessKey, nil
 	}
 
 	// Jeśli nie ma klucza, spróbuj go wygenerować
-	return b.execp2p.RegenerateRoomAccessKey()
+	return b.room().RegenerateRoomAccessKey()
 }
 
 // RegenerateRoomAccessKey generuje nowy klucz dostępu dla bieżącego pokoju
 func (b *Bridge) RegenerateRoomAccessKey() (string, error) {
-	return b.execp2p.RegenerateRoomAccessKey()
+	return b.room().RegenerateRoomAccessKey()
+}
+
+// RotateRoomAccessKeyAndDisconnect generuje nowy klucz i rozłącza obecnych
+// uczestników; wrócić może tylko ktoś, kto dostanie nowy klucz
+func (b *Bridge) RotateRoomAccessKeyAndDisconnect() (string, error) {
+	return b.room().RotateRoomAccessKey(true)
+}
+
+// KickPeer usuwa uczestnika z pokoju: zamyka jego połączenie i odnawia
+// klucze, więc nie odczyta dalszych wiadomości. Moderator prosi o to hosta.
+func (b *Bridge) KickPeer(peerID string) error {
+	return b.room().KickPeer(peerID, "")
+}
+
+// BanPeer blokuje tożsamość uczestnika w pokoju i usuwa go, jeśli jest
+// połączony
+func (b *Bridge) BanPeer(peerID string, reason string) error {
+	return b.room().BanPeer(peerID, reason)
+}
+
+// BanFingerprint blokuje tożsamość o podanym odcisku
+func (b *Bridge) BanFingerprint(fingerprint string, reason string) error {
+	return b.room().BanFingerprint(fingerprint, reason)
+}
+
+// UnbanFingerprint zdejmuje blokadę tożsamości
+func (b *Bridge) UnbanFingerprint(fingerprint string) error {
+	return b.room().UnbanFingerprint(fingerprint)
+}
+
+// SetPeerRole mianuje uczestnika moderatorem ("moderator") albo odbiera mu
+// tę rolę ("member"); tylko host
+func (b *Bridge) SetPeerRole(peerID string, role string) error {
+	r, err := app.ParseRole(role)
+	if err != nil {
+		return err
+	}
+	return b.room().SetPeerRole(peerID, r)
+}
+
+// RenameRoom zmienia nazwę pokoju widoczną dla wszystkich (host i moderatorzy)
+func (b *Bridge) RenameRoom(name string) error {
+	_, err := b.room().RenameRoom(name)
+	return err
+}
+
+// GetBans zwraca tożsamości zablokowane w bieżącym pokoju
+func (b *Bridge) GetBans() []types.Ban {
+	entries := b.room().Bans()
+	bans := make([]types.Ban, len(entries))
+	for i, e := range entries {
+		bans[i] = types.Ban{Fingerprint: e.Fingerprint, Nickname: e.Nickname, Reason: e.Reason, BannedAt: e.BannedAt.Unix()}
+	}
+	return bans
 }
 
 // JoinRoom dołącza do pokoju (stara metoda)
@@ -150,7 +259,9 @@ func (b *Bridge) JoinRoom(roomID string, remoteAddr string, accessKey string) er
 	if accessKey == "" {
 		return fmt.Errorf("brak klucza dostępu do pokoju")
 	}
-	return b.execp2p.JoinRoom(b.ctx, roomID, remoteAddr, accessKey)
+	return b.enter(func(s *app.ExecP2P) error {
+		return s.JoinRoom(b.ctx, roomID, remoteAddr, accessKey)
+	})
 }
 
 // JoinRoomWithFallback dołącza do pokoju z automatycznymi próbami różnych metod połączenia
@@ -165,12 +276,15 @@ func (b *Bridge) JoinRoomWithFallback(roomID string, accessKey string) error {
 	b.EmitSecurityMessage("Rozpoczynam zaawansowaną procedurę łączenia...")
 
 	// Używa nowej metody w ExecP2P, która próbuje różnych sposobów połączenia
-	return b.execp2p.JoinRoomWithFallback(b.ctx, roomID, accessKey)
+	return b.enter(func(s *app.ExecP2P) error {
+		return s.JoinRoomWithFallback(b.ctx, roomID, accessKey)
+	})
 }
 
-// SendMessage wysyła wiadomość (tekst lub multimedia)
-// retransmitPendingMessages próbuje okresowo wysłać oczekujące wiadomości
+// retransmitPendingMessages próbuje okresowo wysłać wiadomości z kolejek
+// wszystkich naszych pokojów, w kolejności ich wysłania
 func (b *Bridge) retransmitPendingMessages(ctx context.Context) {
+	defer crash.Recover("wailsbridge.retransmitPendingMessages")
 	ticker := time.NewTicker(2 * time.Second)
 	defer ticker.Stop()
 
@@ -179,54 +293,112 @@ func (b *Bridge) retransmitPendingMessages(ctx context.Context) {
 		case <-ctx.Done():
 			return
 		case <-ticker.C:
-			if len(pendingMessages) > 0 && b.execp2p != nil && b.ctx != nil {
-				// Sprawdź status połączenia
-				status := b.execp2p.GetNetworkStatus()
-				if status["is_running"].(bool) && status["connected_peers"].(int) > 0 {
-					// Próbuj ponownie wysłać oczekujące wiadomości
-					var remainingMessages []string
-					for _, msg := range pendingMessages {
-						if err := b.execp2p.SendMessage(b.ctx, msg); err != nil {
-							// Jeśli nadal nie można wysłać, zachowaj w buforze
-							remainingMessages = append(remainingMessages, msg)
-						} else {
-							fmt.Printf("Pomyślnie wysłano buforowaną wiadomość\n")
-						}
-					}
-					// Zaktualizuj listę oczekujących wiadomości
-					pendingMessages = remainingMessages
+			if b.execp2p == nil || b.ctx == nil {
+				continue
+			}
+			for _, s := range b.execp2p.Sessions() {
+				status := s.GetNetworkStatus()
+				if !status.IsRunning || status.ConnectedPeers == 0 || len(s.QueuedMessages(status.RoomID)) == 0 {
+					continue
+				}
+				// Jeśli nadal nie można wysłać, reszta zostaje w kolejce
+				if sent, _ := s.FlushOutbox(b.ctx); sent > 0 {
+					b.emitOutbox(status.RoomID)
 				}
 			}
 		}
 	}
 }
 
-func (b *Bridge) SendMessage(message string) error {
+// queueMessage odkłada wiadomość do kolejki bieżącego pokoju
+func (b *Bridge) queueMessage(id, message string) error {
+	msg, err := b.room().QueueMessage(id, message)
+	if errors.Is(err, outbox.ErrFull) {
+		return fmt.Errorf("kolejka niewysłanych wiadomości jest pełna (%d)", outbox.DefaultLimit)
+	}
+	if err != nil {
+		return err
+	}
+	b.emitOutbox(msg.RoomID)
+	return nil
+}
+
+// emitOutbox przekazuje do frontendu kolejkę niewysłanych wiadomości pokoju
+func (b *Bridge) emitOutbox(roomID string) {
+	runtime.EventsEmit(b.ctx, EventOutboxUpdate, map[string]interface{}{
+		"room_id":  roomID,
+		"messages": b.room().QueuedMessages(roomID),
+	})
+}
+
+// GetQueuedMessages zwraca niewysłane wiadomości pokoju, od najstarszej
+func (b *Bridge) GetQueuedMessages(roomID string) []outbox.Message {
+	return b.room().QueuedMessages(roomID)
+}
+
+// ClearQueuedMessages odrzuca niewysłane wiadomości pokoju i zwraca ich liczbę
+func (b *Bridge) ClearQueuedMessages(roomID string) int {
+	n := b.room().ClearQueuedMessages(roomID)
+	if n > 0 {
+		b.emitOutbox(roomID)
+	}
+	return n
+}
+
+// SendMessage wysyła wiadomość (tekst lub multimedia) i zwraca jej
+// identyfikator, ten sam u odbiorców (message:received) i w historii
+func (b *Bridge) SendMessage(message string) (id string, err error) {
+	// Liczniki diagnostyczne obejmują tylko wiadomości użytkownika (bez keep-alive)
+	defer func() {
+		if err != nil {
+			diagnostics.Inc(diagnostics.MessageSendFailed)
+		} else {
+			diagnostics.Inc(diagnostics.MessageSent)
+		}
+	}()
+
 	// Sprawdź czy połączenie istnieje
 	if b.execp2p == nil || b.ctx == nil {
-		// Dodaj wiadomość do bufora oczekujących
-		pendingMessages = append(pendingMessages, message)
-		return fmt.Errorf("brak połączenia - wiadomość buforowana")
+		return "", fmt.Errorf("brak połączenia")
 	}
-
-	// Status połączenia
-	status := b.execp2p.GetNetworkStatus()
-	if !status["is_running"].(bool) || status["connected_peers"].(int) == 0 {
-		// Dodaj wiadomość do bufora oczekujących
-		pendingMessages = append(pendingMessages, message)
-		return fmt.Errorf("połączenie nie jest aktywne - wiadomość buforowana")
+	b.room().NoteActivity()
+
+	// Jeden identyfikator na wszystkie próby i na kolejkę: kopia, która
+	// jednak dotarła, zostanie u odbiorcy odrzucona
+	id = crypto.NewMessageID()
+
+	// Status połączenia; krótka przerwa w QUIC nie powinna od razu kończyć
+	// się błędem, więc najpierw sprawdzamy peer'a i raz łączymy się ponownie
+	status := b.room().GetNetworkStatus()
+	if !status.IsRunning || status.ConnectedPeers == 0 {
+		if err := b.ensurePeerReachable(); err != nil {
+			// Rozmówca offline: zostaw zaszyfrowaną wiadomość w jego skrzynce na serwerze
+			if parked, perr := b.room().SendOffline(b.ctx, message); perr == nil && parked > 0 {
+				return id, nil
+			}
+			// Dodaj wiadomość do kolejki oczekujących
+			if qerr := b.queueMessage(id, message); qerr != nil {
+				return "", fmt.Errorf("połączenie nie jest aktywne, wiadomość nie została wysłana: %w", qerr)
+			}
+			return "", fmt.Errorf("połączenie nie jest aktywne - wiadomość buforowana")
+		}
 	}
 
 	// Dodatkowe sprawdzenie dla pierwszej wiadomości - 3 próby wysłania
 	const maxRetries = 3
 
 	// Pomocnicza funkcja do wielokrotnych prób wysłania wiadomości
-	sendWithRetries := func(msg string) error {
+	sendWithRetries := func(msg string) (string, error) {
 		var err error
 		for attempt := 0; attempt < maxRetries; attempt++ {
-			err = b.execp2p.SendMessage(b.ctx, msg)
+			err = b.room().SendMessageWithID(b.ctx, id, msg)
 			if err == nil {
-				return nil // Sukces - wiadomość wysłana
+				return id, nil // Sukces - wiadomość wysłana
+			}
+			// Część rozmówców ją dostała: ponowienie powtórzyłoby ją u nich
+			if undelivered, partly := network.PartlyDelivered(err); partly {
+				b.EmitSecurityMessage("Wiadomość nie dotarła do: " + b.displayNames(undelivered))
+				return id, nil
 			}
 
 			// Jeśli nie udało się, poczekaj przed kolejną próbą
@@ -235,7 +407,17 @@ func (b *Bridge) SendMessage(message string) error {
 			time.Sleep(waitTime)
 			fmt.Printf("Próba wysłania wiadomości %d/%d...\n", attempt+1, maxRetries)
 		}
-		return err // Zwróć ostatni błąd, jeśli wszystkie próby zawiodły
+
+		// Zanim zgłosimy błąd: sprawdź, czy peer odpowiada, i spróbuj jeszcze raz
+		if rerr := b.ensurePeerReachable(); rerr == nil {
+			if err = b.room().SendMessageWithID(b.ctx, id, msg); err == nil {
+				return id, nil
+			}
+		}
+		if qerr := b.queueMessage(id, msg); qerr != nil {
+			return "", fmt.Errorf("połączenie nie jest aktywne, wiadomość nie została wysłana: %w", qerr)
+		}
+		return "", fmt.Errorf("połączenie nie jest aktywne - wiadomość buforowana: %w", err)
 	}
 
 	// Sprawdź, czy wiadomość jest w formacie JSON (dla multimediów)
@@ -252,7 +434,7 @@ func (b *Bridge) SendMessage(message string) error {
 				return sendWithRetries(message)
 			} else {
 				// Brak mediaUrl w wiadomości multimedialnej
-				return fmt.Errorf("brak URL mediów w wiadomości typu %s", msgType)
+				return "", fmt.Errorf("brak URL mediów w wiadomości typu %s", msgType)
 			}
 		} else {
 			// Wiadomość jest poprawnym JSON, ale nie multimedia - wyślij normalnie
@@ -264,19 +446,113 @@ func (b *Bridge) SendMessage(message string) error {
 	}
 }
 
+// displayNames zwraca nazwy uczestników pokoju rozdzielone przecinkami
+func (b *Bridge) displayNames(peerIDs []string) string {
+	names := make([]string, 0, len(peerIDs))
+	for _, id := range peerIDs {
+		names = append(names, b.room().DisplayName(id))
+	}
+	return strings.Join(names, ", ")
+}
+
+// ensurePeerReachable sprawdza peer'a pingiem i w razie potrzeby raz łączy
+// się ponownie; porażka oznacza status "degraded"
+func (b *Bridge) ensurePeerReachable() error {
+	ctx, cancel := context.WithTimeout(b.ctx, reachabilityTimeout)
+	defer cancel()
+	return b.room().EnsurePeerReachable(ctx)
+}
+
 // GetNetworkStatus zwraca status sieci
-func (b *Bridge) GetNetworkStatus() map[string]interface{} {
-	return b.execp2p.GetNetworkStatus()
+func (b *Bridge) GetNetworkStatus() types.NetworkStatus {
+	return b.room().GetNetworkStatus()
 }
 
 // GetSecuritySummary zwraca podsumowanie bezpieczeństwa
-func (b *Bridge) GetSecuritySummary() map[string]interface{} {
-	return b.execp2p.GetSecuritySummary()
+func (b *Bridge) GetSecuritySummary() types.SecuritySummary {
+	return b.room().GetSecuritySummary()
+}
+
+// GetPeers zwraca listę uczestników pokoju (także nas), jak w users:update
+func (b *Bridge) GetPeers() []types.PeerInfo {
+	return b.room().GetPeers()
+}
+
+// GetDiagnostics zwraca lokalne liczniki użycia i błędów (bez telemetrii)
+func (b *Bridge) GetDiagnostics() map[string]interface{} {
+	snap := b.room().GetDiagnostics()
+
+	return map[string]interface{}{
+		"started_at":             snap.StartedAt.Unix(),
+		"uptime_seconds":         snap.UptimeSeconds,
+		"counters":               snap.Counters,
+		"join_methods":           methodStatsMaps(snap.JoinMethods),
+		"handshake_successes":    snap.HandshakeSuccesses,
+		"handshake_failures":     snap.HandshakeFailures,
+		"handshake_failure_rate": snap.HandshakeFailureRate,
+	}
+}
+
+// ResetDiagnostics zeruje lokalne liczniki diagnostyczne
+func (b *Bridge) ResetDiagnostics() {
+	diagnostics.Default().Reset()
+}
+
+// ExportIdentity zapisuje zaszyfrowaną hasłem kopię tożsamości do pliku
+// wybranego przez użytkownika i zwraca ścieżkę pliku
+func (b *Bridge) ExportIdentity(passphrase string) (string, error) {
+	if passphrase == "" {
+		return "", fmt.Errorf("hasło jest wymagane")
+	}
+	path, err := runtime.SaveFileDialog(b.ctx, runtime.SaveDialogOptions{
+		Title:           "Eksport tożsamości",
+		DefaultFilename: "execp2p-identity.json",
+	})
+	if err != nil {
+		return "", err
+	}
+	if path == "" {
+		return "", fmt.Errorf("anulowano eksport")
+	}
+
+	bundle, err := b.execp2p.ExportIdentity([]byte(passphrase))
+	if err != nil {
+		return "", err
+	}
+	if err := os.WriteFile(path, bundle, 0o600); err != nil {
+		return "", fmt.Errorf("błąd zapisu pliku: %w", err)
+	}
+	return path, nil
+}
+
+// ImportIdentity wczytuje tożsamość z pliku wybranego przez użytkownika
+// i zwraca jej odcisk palca
+func (b *Bridge) ImportIdentity(passphrase string) (string, error) {
+	path, err := runtime.OpenFileDialog(b.ctx, runtime.OpenDialogOptions{
+		Title: "Import tożsamości",
+	})
+	if err != nil {
+		return "", err
+	}
+	if path == "" {
+		return "", fmt.Errorf("anulowano import")
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return "", fmt.Errorf("błąd odczytu pliku: %w", err)
+	}
+	fingerprint, err := b.execp2p.ImportIdentity(data, []byte(passphrase))
+	if err != nil {
+		return "", err
+	}
+	b.EmitSecurityMessage("Zaimportowano tożsamość " + fingerprint)
+	return fingerprint, nil
 }
 
 // GetPeerFingerprint zwraca odcisk palca
 func (b *Bridge) GetPeerFingerprint() (string, error) {
-	return b.execp2p.GetPeerFingerprint()
+	return b.room().GetPeerFingerprint()
 }
 
 // JoinUserByID dołącza do użytkownika przez ID
@@ -286,36 +562,59 @@ func (b *Bridge) JoinUserByID(userID string, accessKey string) error {
 	if accessKey == "" {
 		return fmt.Errorf("brak klucza dostępu do pokoju")
 	}
-	return b.execp2p.JoinRoom(b.ctx, userID, "", accessKey)
+	return b.enter(func(s *app.ExecP2P) error {
+		return s.JoinRoom(b.ctx, userID, "", accessKey)
+	})
 }
 
 // GetUserID zwraca ID tego użytkownika
 func (b *Bridge) GetUserID() string {
 	// Obecnie używamy peerID jako userID
-	return b.execp2p.GetNetworkStatus()["peer_id"].(string)
+	return b.room().GetNetworkStatus().PeerID
 }
 
-// CloseConnection zamyka bieżące połączenie z pokojem
+// CloseConnection zamyka połączenie z pokojem wybranym w interfejsie
 func (b *Bridge) CloseConnection() error {
 	if b.execp2p == nil {
 		return fmt.Errorf("bridge nie zainicjalizowany")
 	}
 
-	// Wywołaj metodę Close z ExecP2P, która zamyka wszystkie połączenia
-	b.execp2p.Close()
+	// Opuść wybrany pokój; pozostałe działają dalej
+	s := b.room()
+	id := roomID(s)
+	s.LeaveRoom()
 
-	// Emituj komunikat o opuszczeniu pokoju
-	runtime.EventsEmit(b.ctx, "room:left")
+	// Przełącz na inny pokój albo emituj komunikat o opuszczeniu pokoju
+	b.roomGone(id)
 
 	return nil
 }
 
-// UpdateNickname aktualizuje nickname użytkownika i przekazuje informację do innych uczestników
+// GetNickname zwraca wybrany przez nas nick (bez wyróżnika)
+func (b *Bridge) GetNickname() string {
+	return b.room().Nickname()
+}
+
+// UpdateNickname zapisuje nick w pliku konfiguracji i przekazuje go
+// uczestnikom pokoju; kolejni dostaną go w ogłoszeniu przy połączeniu
 func (b *Bridge) UpdateNickname(nickname string) error {
 	if b.ctx == nil {
 		return fmt.Errorf("bridge nie zainicjalizowany")
 	}
 
+	// Nick oczyszczony z niedozwolonych znaków; błąd zapisu zgłaszamy
+	// dopiero po przekazaniu zmiany uczestnikom
+	_, saveErr := b.execp2p.SaveNickname(nickname)
+	if saveErr != nil {
+		saveErr = fmt.Errorf("nick nie został zapisany w pliku konfiguracji: %w", saveErr)
+	}
+	nickname = b.room().Nickname()
+
+	// Poza pokojem nie ma komu wysłać zmiany
+	if !b.room().GetNetworkStatus().IsRunning {
+		return saveErr
+	}
+
 	// Wyślij wiadomość specjalną zawierającą informację o zmianie nickname'a
 	specialMsg := map[string]interface{}{
 		"type":     "nickname_update",
@@ -328,7 +627,102 @@ func (b *Bridge) UpdateNickname(nickname string) error {
 	}
 
 	// Wyślij przez normalny kanał wiadomości
-	return b.execp2p.SendMessage(b.ctx, string(msgBytes))
+	if err := b.room().SendMessage(b.ctx, string(msgBytes)); err != nil {
+		return err
+	}
+	return saveErr
+}
+
+// GetProfile zwraca nasz podpisany profil: nick, status i awatar
+func (b *Bridge) GetProfile() (types.Profile, error) {
+	p, err := b.room().Profile()
+	if err != nil {
+		return types.Profile{}, err
+	}
+	return b.profileDTO(p), nil
+}
+
+// SetProfileStatus ustawia tekst statusu w profilu i przekazuje profil
+// uczestnikom pokoju
+func (b *Bridge) SetProfileStatus(status string) (types.Profile, error) {
+	p, err := b.room().SetProfileStatus(status)
+	if err != nil {
+		return types.Profile{}, err
+	}
+	return b.profileDTO(p), nil
+}
+
+// SetAvatar ustawia awatar (data URL lub base64); pusty usuwa awatar
+func (b *Bridge) SetAvatar(image string) (types.Profile, error) {
+	if _, data, ok := strings.Cut(image, ";base64,"); ok {
+		image = data
+	}
+	data, err := base64.StdEncoding.DecodeString(image)
+	if err != nil {
+		return types.Profile{}, fmt.Errorf("nieprawidłowy obrazek: %w", err)
+	}
+	p, err := b.room().SetAvatar(data)
+	if err != nil {
+		return types.Profile{}, err
+	}
+	return b.profileDTO(p), nil
+}
+
+func (b *Bridge) profileDTO(p *crypto.Profile) types.Profile {
+	dto := types.Profile{
+		Nickname:    p.Nickname,
+		Status:      p.Status,
+		AvatarHash:  p.AvatarHash,
+		Fingerprint: p.Fingerprint,
+		UpdatedAt:   p.UpdatedAt.Unix(),
+	}
+	if avatar, ok := b.room().Avatar(p); ok {
+		dto.Avatar = avatar.DataURL()
+	}
+	return dto
+}
+
+// GetPresence zwraca naszą dostępność: online, away albo dnd
+func (b *Bridge) GetPresence() string {
+	return string(b.room().Presence())
+}
+
+// SetPresence ustawia wybraną dostępność (online, away, dnd) i przekazuje ją
+// uczestnikom pokoju; przy online po bezczynności przechodzimy w away
+func (b *Bridge) SetPresence(presence string) error {
+	p, err := app.ParsePresence(presence)
+	if err != nil {
+		return err
+	}
+	return b.room().SetPresence(p)
+}
+
+// ReportActivity informuje back-end, że użytkownik jest przy komputerze
+// (klawiatura, wskaźnik); frontend wywołuje ją co najwyżej co kilka sekund
+func (b *Bridge) ReportActivity() {
+	b.room().NoteActivity()
+}
+
+// monitorPresence przekazuje do frontendu zmiany dostępności uczestników
+func (b *Bridge) monitorPresence(ctx context.Context) {
+	defer crash.Recover("wailsbridge.monitorPresence")
+	if b.execp2p == nil || b.ctx == nil {
+		return
+	}
+
+	notices := b.execp2p.PresenceNotices()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case change := <-notices:
+			runtime.EventsEmit(b.ctx, EventPeerPresence, map[string]interface{}{
+				"peer_id":  change.PeerID,
+				"presence": string(change.Presence),
+				"local":    change.Local,
+			})
+		}
+	}
 }
 
 // startEventMonitoring monitoruje zdarzenia z back-endu i przekazuje je do frontendu
@@ -341,30 +735,83 @@ func (b *Bridge) startEventMonitoring(ctx context.Context) {
 
 	// Monitorowanie zdarzeń bezpieczeństwa
 	go b.monitorSecurity(ctx)
+
+	// Alarmy o zmianie odcisku palca znanego peer'a
+	go b.monitorFingerprintChanges(ctx)
+
+	// Rozmówcy odizolowani po nieudanym sprawdzeniu certyfikatu TLS
+	go b.monitorQuarantines(ctx)
+
+	// Informacja, że host archiwizuje rozmowę
+	go b.monitorArchiveNotices(ctx)
+
+	// Dziennik zdarzeń dla podglądu w diagnostyce
+	go b.monitorLogs(ctx)
+
+	// Własne skróty emoji pokoju i ich obrazki
+	go b.monitorShortcodes(ctx)
+
+	// Dostępność uczestników (i nasza, także zmieniona po bezczynności)
+	go b.monitorPresence(ctx)
+
+	// Nowy klucz dostępu od hosta
+	go b.monitorAccessKeyRotation(ctx)
+
+	// Odnowienie kluczy po wyjściu uczestnika
+	go b.monitorRekeys(ctx)
+
+	// Usunięcie nas z pokoju przez hosta
+	go b.monitorKicks(ctx)
+
+	// Odejście uczestnika z podanym powodem
+	go b.monitorDepartures(ctx)
+	go b.monitorLiveness(ctx)
+
+	// Blokady tożsamości w pokoju
+	go b.monitorBans(ctx)
+
+	// Odmowa wpuszczenia do pokoju (klucz, brak miejsca, blokada)
+	go b.monitorRefusals(ctx)
+
+	// Błędy sieci z rodzajem, z którego frontend układa komunikat
+	go b.monitorNetworkErrors(ctx)
+
+	// Pokój zamknięty po upływie czasu życia lub bezczynności
+	go b.monitorRoomClosed(ctx)
+
+	// Błąd wewnętrzny (panika) i pokoje opuszczone z jego powodu
+	go b.monitorCrashes(ctx)
+
+	// Historia pobrana z innego urządzenia użytkownika
+	go b.monitorHistorySync(ctx)
+
+	// Zdalne wyczyszczenie tego urządzenia na polecenie urządzenia głównego
+	go b.monitorDeviceWipe(ctx)
+
+	// Wiadomości zostawione w skrzynce, gdy byliśmy offline
+	go b.monitorMailbox(ctx)
+
+	// Odtwarzanie wiadomości głosowych
+	go b.monitorVoicePlayback(ctx)
+
+	// Postęp wysyłania plików
+	go b.monitorTransfers(ctx)
 }
 
-// getMessageChannel zwraca kanał wiadomości z istniejącego back-endu
-func (b *Bridge) getMessageChannel() <-chan *crypto.MessagePayload {
-	var _ network.Network // Trick aby zapobiec usuwaniu importu przez kompilator
-	if b.execp2p == nil {
+// getMessageChannel subskrybuje wiadomości przychodzące z back-endu.
+// Subskrypcja trwa do zamknięcia aplikacji, więc kanał jest zamykany tylko wtedy.
+func (b *Bridge) getMessageChannel(s *app.ExecP2P) <-chan *crypto.MessagePayload {
+	if s == nil {
 		return nil
 	}
 
 	// Pobieramy status sieci aby sprawdzić czy network jest inicjalizowany
-	netStatus := b.execp2p.GetNetworkStatus()
-	if !netStatus["is_running"].(bool) {
-		return nil
-	}
-
-	// Uzyskujemy dostęp do kanału wiadomości z sieci
-	// Używamy WEWNĘTRZNEJ wiedzy o strukturze ExecP2P, co nie jest idealne
-	// ale jest konieczne, dopóki nie dodamy odpowiednich eksporterów do ExecP2P
-	network := b.execp2p.GetNetworkAccess()
-	if network == nil {
+	if !s.GetNetworkStatus().IsRunning {
 		return nil
 	}
 
-	return network.GetIncomingMessages()
+	messages, _ := s.Subscribe(0)
+	return messages
 }
 
 // monitorMessages odbiera wiadomości z back-endu i przekazuje je do frontendu
@@ -376,209 +823,246 @@ func (b *Bridge) monitorMessages(ctx context.Context) {
 	// Uruchom mechanizm retransmisji oczekujących wiadomości
 	go b.retransmitPendingMessages(ctx)
 
-	// Monitorowanie rzeczywistych wiadomości
-	go func() {
-		// Oczekiwanie na inicjalizację połączenia
-		reconnectAttempts := 0
-		maxReconnectAttempts := 5
-
-		// Licznik aktywności dla adaptacyjnego monitorowania
-		lastMsgTime := time.Now()
-		adaptiveInterval := 300 * time.Millisecond
-
-		for {
-			// Pobierz kanał wiadomości
-			msgChan := b.getMessageChannel()
-			if msgChan != nil {
-				// Resetuj licznik prób po udanym połączeniu
-				reconnectAttempts = 0
-
-				// Adaptacyjne dostosowanie interwału sprawdzania - częściej gdy czat jest aktywny
-				elapsed := time.Since(lastMsgTime)
-				if elapsed < 30*time.Second {
-					// Czat był aktywny w ciągu ostatnich 30 sekund - częste sprawdzanie (100ms)
-					adaptiveInterval = 100 * time.Millisecond
-				} else if elapsed < 2*time.Minute {
-					// Czat był aktywny w ciągu ostatnich 2 minut - umiarkowane sprawdzanie (200ms)
-					adaptiveInterval = 200 * time.Millisecond
-				} else {
-					// Czat nieaktywny dłużej niż 2 minuty - rzadsze sprawdzanie (300ms)
-					adaptiveInterval = 300 * time.Millisecond
+	// Wiadomości pierwszej sesji; kolejne pokoje dostają własne przy wejściu
+	go b.watchMessages(ctx, b.execp2p)
+}
+
+// watchMessages przekazuje do frontendu wiadomości jednego z naszych pokojów
+func (b *Bridge) watchMessages(ctx context.Context, s *app.ExecP2P) {
+	defer crash.Recover("wailsbridge.watchMessages")
+	// Oczekiwanie na inicjalizację połączenia
+	reconnectAttempts := 0
+	maxReconnectAttempts := 5
+
+	// Licznik aktywności dla adaptacyjnego monitorowania
+	lastMsgTime := time.Now()
+	adaptiveInterval := 300 * time.Millisecond
+
+	for {
+		// Pobierz kanał wiadomości
+		msgChan := b.getMessageChannel(s)
+		if msgChan != nil {
+			// Resetuj licznik prób po udanym połączeniu
+			reconnectAttempts = 0
+
+			// Adaptacyjne dostosowanie interwału sprawdzania - częściej gdy czat jest aktywny
+			elapsed := time.Since(lastMsgTime)
+			if elapsed < 30*time.Second {
+				// Czat był aktywny w ciągu ostatnich 30 sekund - częste sprawdzanie (100ms)
+				adaptiveInterval = 100 * time.Millisecond
+			} else if elapsed < 2*time.Minute {
+				// Czat był aktywny w ciągu ostatnich 2 minut - umiarkowane sprawdzanie (200ms)
+				adaptiveInterval = 200 * time.Millisecond
+			} else {
+				// Czat nieaktywny dłużej niż 2 minuty - rzadsze sprawdzanie (300ms)
+				adaptiveInterval = 300 * time.Millisecond
+			}
+
+			// Kanał jest dostępny, monitoruj go
+			for msg := range msgChan {
+				// Zaktualizuj czas ostatniej wiadomości
+				lastMsgTime = time.Now()
+				if msg == nil {
+					continue
 				}
 
-				// Kanał jest dostępny, monitoruj go
-				for msg := range msgChan {
-					// Zaktualizuj czas ostatniej wiadomości
-					lastMsgTime = time.Now()
-					if msg == nil {
-						continue
-					}
+				// Część wiadomości nadawcy nie dotarła (okno porządkowania)
+				if msg.Gap > 0 {
+					b.EmitSecurityMessage(fmt.Sprintf("Brakujące wiadomości od %s: %d", s.DisplayName(msg.SenderID), msg.Gap))
+				}
 
-					// Obsługa specjalnych wiadomości keep-alive
-					var msgDataKeepAlive map[string]interface{}
-					if err := json.Unmarshal([]byte(msg.Message), &msgDataKeepAlive); err == nil {
-						if msgType, ok := msgDataKeepAlive["type"].(string); ok && msgType == "keep_alive" {
-							// Ignoruj wiadomości keep-alive, nie pokazuj ich użytkownikowi
-							continue
-						}
+				// Obsługa specjalnych wiadomości keep-alive
+				var msgDataKeepAlive map[string]interface{}
+				if err := json.Unmarshal([]byte(msg.Message), &msgDataKeepAlive); err == nil {
+					if msgType, ok := msgDataKeepAlive["type"].(string); ok && msgType == "keep_alive" {
+						// Ignoruj wiadomości keep-alive, nie pokazuj ich użytkownikowi
+						continue
 					}
-
-					// Sprawdź, czy wiadomość zawiera multimedia lub jest wiadomością specjalną (jest w formacie JSON)
-					var msgData map[string]interface{}
-					messageType := "text"
-					messageContent := msg.Message
-					var mediaUrl string
-
-					if err := json.Unmarshal([]byte(msg.Message), &msgData); err == nil {
-						// Wiadomość może być w formacie JSON
-						if msgType, ok := msgData["type"].(string); ok {
-							messageType = msgType
-
-							// Obsługa specjalnej wiadomości o aktualizacji nickname'a
-							if messageType == "nickname_update" {
-								if nickname, ok := msgData["nickname"].(string); ok {
-									// Emituj zdarzenie aktualizacji nickname'a
-									runtime.EventsEmit(b.ctx, EventNicknameUpdate, map[string]interface{}{
-										"sender":   msg.SenderID,
-										"nickname": nickname,
-									})
-									// Nie emituj tej wiadomości jako zwykłej wiadomości
-									continue
-								}
+				}
+				diagnostics.Inc(diagnostics.MessageReceived)
+
+				// Sprawdź, czy wiadomość zawiera multimedia lub jest wiadomością specjalną (jest w formacie JSON)
+				var msgData map[string]interface{}
+				messageType := "text"
+				messageContent := msg.Message
+				var mediaUrl string
+
+				if err := json.Unmarshal([]byte(msg.Message), &msgData); err == nil {
+					// Wiadomość może być w formacie JSON
+					if msgType, ok := msgData["type"].(string); ok {
+						messageType = msgType
+
+						// Obsługa specjalnej wiadomości o aktualizacji nickname'a
+						if messageType == "nickname_update" {
+							if nickname, ok := msgData["nickname"].(string); ok {
+								// Przy kolizji nicków nazwa dostaje wyróżnik z odcisku palca
+								displayName := s.SetPeerNickname(msg.SenderID, nickname)
+								// Emituj zdarzenie aktualizacji nickname'a
+								runtime.EventsEmit(b.ctx, EventNicknameUpdate, map[string]interface{}{
+									"sender":       msg.SenderID,
+									"nickname":     roster.CleanNickname(nickname),
+									"display_name": displayName,
+								})
+								// Nie emituj tej wiadomości jako zwykłej wiadomości
+								continue
 							}
 						}
-						if content, ok := msgData["content"].(string); ok {
-							messageContent = content
-						}
-						if url, ok := msgData["mediaUrl"].(string); ok {
-							mediaUrl = url
-						}
 					}
-
-					// Emituj wiadomość do frontendu z dodatkowymi polami dla multimediów
-					messageData := map[string]interface{}{
-						"sender":    msg.SenderID,
-						"message":   messageContent,
-						"timestamp": msg.Timestamp,
-						"isLocal":   false,
-						"verified":  true,
-						"type":      messageType,
+					if content, ok := msgData["content"].(string); ok {
+						messageContent = content
 					}
+					mediaUrl = mediaURL(msgData)
+				}
 
-					// Dodaj URL do multimediów, jeśli istnieje
-					if mediaUrl != "" {
-						messageData["mediaUrl"] = mediaUrl
-					} else if messageType == "audio" || messageType == "image" || messageType == "gif" {
-						// Dodatkowe sprawdzenie dla multimediów - sprawdź, czy w oryginalnej wiadomości JSON
-						// jest URL, który mogliśmy przeoczyć
-						var msgDataMedia map[string]interface{}
-						if err := json.Unmarshal([]byte(msg.Message), &msgDataMedia); err == nil {
-							if url, ok := msgDataMedia["mediaUrl"].(string); ok && url != "" {
-								messageData["mediaUrl"] = url
-								// Loguj informację o znalezieniu URL
-								fmt.Printf("Znaleziono URL multimediów w wiadomości typu %s\n", messageType)
-							}
+				// Emituj wiadomość do frontendu z dodatkowymi polami dla multimediów
+				formatted := s.FormatTime(msg.Timestamp)
+				messageData := map[string]interface{}{
+					"id":          msg.MessageID,
+					"room_id":     roomID(s),
+					"sender":      msg.SenderID,
+					"sender_name": s.DisplayName(msg.SenderID),
+
+					"verification_state": string(s.PeerVerificationState(msg.SenderID).State),
+					"message":            messageContent,
+					"timestamp":          msg.Timestamp,
+					"epoch_ms":           formatted.EpochMillis,
+					"time":               formatted.Time,
+					"date_time":          formatted.DateTime,
+					"isLocal":            false,
+					"verified":           true,
+					"type":               messageType,
+				}
+
+				// Dodaj URL do multimediów, jeśli istnieje
+				if mediaUrl != "" {
+					messageData["mediaUrl"] = mediaUrl
+					addMediaDetails(messageData, msgData)
+				} else if messageType == "audio" || messageType == "image" || messageType == "gif" || messageType == "file" {
+					// Dodatkowe sprawdzenie dla multimediów - sprawdź, czy w oryginalnej wiadomości JSON
+					// jest URL, który mogliśmy przeoczyć
+					var msgDataMedia map[string]interface{}
+					if err := json.Unmarshal([]byte(msg.Message), &msgDataMedia); err == nil {
+						if url, ok := msgDataMedia["mediaUrl"].(string); ok && url != "" {
+							messageData["mediaUrl"] = url
+							// Loguj informację o znalezieniu URL
+							fmt.Printf("Znaleziono URL multimediów w wiadomości typu %s\n", messageType)
 						}
 					}
+				}
 
-					runtime.EventsEmit(b.ctx, EventMessageReceived, messageData)
+				runtime.EventsEmit(b.ctx, EventMessageReceived, messageData)
+				b.notifyMessage(s, msg, messageType, messageContent)
+				b.messageRead(s)
+			}
+			// Kolejna sesja kończy się razem ze swoim pokojem
+			if s != b.execp2p {
+				return
+			}
+			// Jeśli kanał został zamknięty, spróbuj go pobrać ponownie
+			// Użyj krótszego interwału dla szybszego wykrycia ponownego połączenia
+			time.Sleep(adaptiveInterval)
+		} else {
+			// Kanał nie jest dostępny, spróbuj ponownego połączenia
+			reconnectAttempts++
+
+			if reconnectAttempts <= maxReconnectAttempts {
+				// Logarytmiczne wydłużanie czasu między próbami
+				backoffTime := time.Duration(math.Pow(2, float64(reconnectAttempts))) * time.Second
+				if backoffTime > 30*time.Second {
+					backoffTime = 30 * time.Second // Maksymalnie 30 sekund między próbami
 				}
-				// Jeśli kanał został zamknięty, spróbuj go pobrać ponownie
-				// Użyj krótszego interwału dla szybszego wykrycia ponownego połączenia
-				time.Sleep(adaptiveInterval)
-			} else {
-				// Kanał nie jest dostępny, spróbuj ponownego połączenia
-				reconnectAttempts++
-
-				if reconnectAttempts <= maxReconnectAttempts {
-					// Logarytmiczne wydłużanie czasu między próbami
-					backoffTime := time.Duration(math.Pow(2, float64(reconnectAttempts))) * time.Second
-					if backoffTime > 30*time.Second {
-						backoffTime = 30 * time.Second // Maksymalnie 30 sekund między próbami
-					}
 
-					// Emituj komunikat o próbie ponownego połączenia
-					if b.ctx != nil {
-						runtime.EventsEmit(b.ctx, EventSecurityMessage, fmt.Sprintf("Próba ponownego połączenia (%d/%d)...", reconnectAttempts, maxReconnectAttempts))
-					}
+				// Emituj komunikat o próbie ponownego połączenia
+				if b.ctx != nil {
+					runtime.EventsEmit(b.ctx, EventSecurityMessage, fmt.Sprintf("Próba ponownego połączenia (%d/%d)...", reconnectAttempts, maxReconnectAttempts))
+				}
 
-					time.Sleep(backoffTime)
-				} else {
-					// Po przekroczeniu maksymalnej liczby prób, poczekaj dłużej przed kolejnymi próbami
-					if b.ctx != nil {
-						runtime.EventsEmit(b.ctx, EventNetworkError, "Nie można nawiązać stabilnego połączenia. Spróbuj ponownie połączyć się z pokojem.")
-					}
-					reconnectAttempts = 0 // Resetuj licznik, aby spróbować ponownie
-					time.Sleep(10 * time.Second)
+				time.Sleep(backoffTime)
+			} else {
+				// Po przekroczeniu maksymalnej liczby prób, poczekaj dłużej przed kolejnymi próbami
+				if b.ctx != nil {
+					b.EmitNetworkError(&network.TransportError{Op: "reconnect", Err: errors.New("nie można nawiązać stabilnego połączenia")})
 				}
+				reconnectAttempts = 0 // Resetuj licznik, aby spróbować ponownie
+				time.Sleep(10 * time.Second)
 			}
+		}
 
-			select {
-			case <-ctx.Done():
-				return
-			default:
-				// Kontynuuj pętlę
-			}
+		select {
+		case <-ctx.Done():
+			return
+		default:
+			// Kontynuuj pętlę
 		}
-	}()
+	}
+}
+
+// statusRecheckInterval co tyle sprawdzany jest status bez powiadomienia;
+// wyjście z trybu "degraded" następuje po prostu po odebraniu czegokolwiek
+const statusRecheckInterval = 5 * time.Second
+
+// samePeer porównuje uczestników z pominięciem ostatniej aktywności
+func samePeer(a, b types.PeerInfo) bool {
+	a.LastActivity, b.LastActivity = 0, 0
+	return a == b
 }
 
-// monitorNetworkStatus regularnie emituje aktualizacje statusu sieci
+// monitorNetworkStatus emituje status sieci i listę uczestników wybranego
+// pokoju oraz listę naszych pokojów, gdy się zmienią
 func (b *Bridge) monitorNetworkStatus(ctx context.Context) {
+	defer crash.Recover("wailsbridge.monitorNetworkStatus")
 	if b.execp2p == nil || b.ctx == nil {
 		return
 	}
 
-	// Śledź aktualnie połączonych użytkowników
-	ticker := time.NewTicker(100 * time.Millisecond) // Jeszcze częstsze sprawdzanie dla maksymalnej responsywności
+	// powiadomienia są wspólne dla wszystkich naszych pokojów
+	notices := b.execp2p.StatusNotices()
+	ticker := time.NewTicker(statusRecheckInterval)
 	defer ticker.Stop()
 
+	var lastStatus *types.NetworkStatus
+	var lastPeers []types.PeerInfo
+	var lastRooms []types.RoomSummary
+	emit := func() {
+		s := b.room()
+		status := s.GetNetworkStatus()
+		if lastStatus == nil || status != *lastStatus {
+			lastStatus = &status
+			runtime.EventsEmit(b.ctx, EventStatusUpdate, status)
+		}
+
+		// Lista uczestników z back-endu; przy kolizji nicków nazwy
+		// mają wyróżnik z odcisku palca
+		peers := s.GetPeers()
+		// sama aktywność uczestnika nie zmienia listy
+		if lastPeers == nil || !slices.EqualFunc(peers, lastPeers, samePeer) {
+			lastPeers = peers
+			runtime.EventsEmit(b.ctx, EventUsersUpdate, peers)
+		}
+
+		rooms := b.ListRooms()
+		if lastRooms == nil || !slices.Equal(rooms, lastRooms) {
+			lastRooms = rooms
+			runtime.EventsEmit(b.ctx, EventRoomsUpdate, rooms)
+		}
+	}
+
+	emit()
 	for {
 		select {
 		case <-ctx.Done():
 			return
+		case <-notices:
+			emit()
 		case <-ticker.C:
-			status := b.execp2p.GetNetworkStatus()
-			runtime.EventsEmit(b.ctx, EventStatusUpdate, status)
-
-			// Zawsze aktualizuj listę użytkowników
-			connectedUsers := []map[string]interface{}{}
-
-			// 1. Używamy domyślnego nicku (nie możemy pobrać z localStorage po stronie Go)
-			localNickname := "Użytkownik"
-
-			// 2. Zawsze dodaj lokalnego użytkownika do listy
-			localUser := map[string]interface{}{
-				"id":       status["peer_id"].(string),
-				"nickname": localNickname,
-				"isLocal":  true,
-			}
-			connectedUsers = append(connectedUsers, localUser)
-
-			// 2. Dodaj zdalne połączenia
-			if status["is_running"].(bool) && status["connected_peers"].(int) > 0 {
-				if network := b.execp2p.GetNetworkAccess(); network != nil {
-					peers := network.GetConnectedPeers()
-					for _, peerID := range peers {
-						// Dodaj zdalne ID do listy użytkowników
-						remoteUser := map[string]interface{}{
-							"id":       peerID,
-							"nickname": "Użytkownik",
-							"isLocal":  false,
-						}
-						connectedUsers = append(connectedUsers, remoteUser)
-					}
-				}
-			}
-
-			// 3. Zawsze emituj aktualną listę użytkowników
-			runtime.EventsEmit(b.ctx, "users:update", connectedUsers)
+			emit()
 		}
 	}
 }
 
 // monitorSecurity monitoruje zdarzenia bezpieczeństwa
 func (b *Bridge) monitorSecurity(ctx context.Context) {
+	defer crash.Recover("wailsbridge.monitorSecurity")
 	if b.execp2p == nil || b.ctx == nil {
 		return
 	}
@@ -587,39 +1071,965 @@ func (b *Bridge) monitorSecurity(ctx context.Context) {
 	ticker := time.NewTicker(5 * time.Second)
 	defer ticker.Stop()
 
+	var last map[string]string
 	for {
 		select {
 		case <-ctx.Done():
 			return
 		case <-ticker.C:
 			// Sprawdź status e2e_encryption
-			status := b.execp2p.GetNetworkStatus()
-			if status["e2e_encryption"].(bool) && status["connected_peers"].(int) > 0 {
-				// Emisja komunikatu o bezpiecznym połączeniu
-				securityInfo := b.execp2p.GetSecuritySummary()
-				if fingerprints, ok := securityInfo["peer_fingerprints"].(map[string]interface{}); ok && len(fingerprints) > 0 {
-					runtime.EventsEmit(b.ctx, EventPeerFingerprints, fingerprints)
-					b.EmitSecurityMessage("Kanał komunikacyjny zabezpieczony szyfrowaniem end-to-end.")
-				}
+			status := b.room().GetNetworkStatus()
+			if !status.E2EEncryption || status.ConnectedPeers == 0 {
+				last = nil
+				continue
+			}
+			// Emisja komunikatu o bezpiecznym połączeniu, tylko gdy
+			// zmienił się zestaw rozmówców
+			fingerprints := b.room().GetSecuritySummary().PeerFingerprints
+			if len(fingerprints) > 0 && !maps.Equal(fingerprints, last) {
+				last = fingerprints
+				runtime.EventsEmit(b.ctx, EventPeerFingerprints, fingerprints)
+				b.EmitSecurityMessage("Kanał komunikacyjny zabezpieczony szyfrowaniem end-to-end.")
 			}
 		}
 	}
 }
 
-// EmitSecurityMessage wysyła komunikat bezpieczeństwa do frontendu
-func (b *Bridge) EmitSecurityMessage(message string) {
-	if b.ctx == nil {
+// monitorFingerprintChanges przekazuje do frontendu alarmy TOFU; komunikat
+// w czacie i decyzję użytkownika obsługuje monitorQuarantines
+func (b *Bridge) monitorFingerprintChanges(ctx context.Context) {
+	defer crash.Recover("wailsbridge.monitorFingerprintChanges")
+	if b.execp2p == nil || b.ctx == nil {
 		return
 	}
 
-	runtime.EventsEmit(b.ctx, EventSecurityMessage, message)
+	changes := b.execp2p.FingerprintChanges()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case change := <-changes:
+			runtime.EventsEmit(b.ctx, EventFingerprintChanged, change)
+		}
+	}
 }
 
-// EmitNetworkError wysyła błąd sieci do frontendu
-func (b *Bridge) EmitNetworkError(err error) {
-	if b.ctx == nil || err == nil {
+// monitorQuarantines zgłasza rozmówców odizolowanych po nieudanym
+// sprawdzeniu tożsamości lub certyfikatu TLS; frontend pokazuje oba odciski
+// i czeka na decyzję (AcceptPeer / RejectPeer)
+func (b *Bridge) monitorQuarantines(ctx context.Context) {
+	defer crash.Recover("wailsbridge.monitorQuarantines")
+	if b.execp2p == nil || b.ctx == nil {
+		return
+	}
+
+	notices := b.execp2p.QuarantineNotices()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case q := <-notices:
+			runtime.EventsEmit(b.ctx, EventSecurityAlert, b.quarantineMap(q))
+
+			var what string
+			switch q.Reason {
+			case trust.ReasonIdentityChanged:
+				what = "odcisk palca peer'a " + q.PeerID + " zmienił się."
+			case trust.ReasonCertificateChanged:
+				what = "certyfikat TLS peer'a " + q.PeerID + " zmienił się, choć tożsamość jest ta sama."
+			default:
+				what = "certyfikat TLS połączenia z peer'em " + q.PeerID + " nie pasuje do jego tożsamości (możliwy atak MITM)."
+			}
+			if q.Refused {
+				what += " Połączenie odrzucone."
+			}
+			b.EmitSecurityMessage("UWAGA: " + what + " Wiadomości wstrzymane do czasu Twojej decyzji.")
+		}
+	}
+}
+
+// monitorArchiveNotices przekazuje do frontendu etykietę archiwizacji pokoju
+func (b *Bridge) monitorArchiveNotices(ctx context.Context) {
+	defer crash.Recover("wailsbridge.monitorArchiveNotices")
+	if b.execp2p == nil || b.ctx == nil {
+		return
+	}
+
+	notices := b.execp2p.ArchiveNotices()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case status := <-notices:
+			runtime.EventsEmit(b.ctx, EventRoomArchive, archiveStatusMap(status))
+			if status.Archiving && !status.Local {
+				b.EmitSecurityMessage("UWAGA: host pokoju archiwizuje odszyfrowane wiadomości na swoim komputerze.")
+			}
+		}
+	}
+}
+
+// monitorAccessKeyRotation przekazuje do frontendu klucz dostępu zmieniony przez hosta
+func (b *Bridge) monitorAccessKeyRotation(ctx context.Context) {
+	defer crash.Recover("wailsbridge.monitorAccessKeyRotation")
+	if b.execp2p == nil || b.ctx == nil {
+		return
+	}
+
+	notices := b.execp2p.AccessKeyNotices()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case rotation := <-notices:
+			runtime.EventsEmit(b.ctx, EventRoomAccessKey, map[string]interface{}{
+				"room_id":    rotation.RoomID,
+				"access_key": rotation.AccessKey,
+			})
+			b.EmitSecurityMessage("Host zmienił klucz dostępu do pokoju. Stary klucz nie pozwala już dołączyć.")
+		}
+	}
+}
+
+// monitorRekeys informuje frontend o nowej epoce kluczy po wyjściu uczestnika
+func (b *Bridge) monitorRekeys(ctx context.Context) {
+	defer crash.Recover("wailsbridge.monitorRekeys")
+	if b.execp2p == nil || b.ctx == nil {
+		return
+	}
+
+	notices := b.execp2p.RekeyNotices()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case event := <-notices:
+			s, ok := b.execp2p.Session(event.RoomID)
+			if !ok {
+				s = b.room()
+			}
+			names := make([]string, len(event.Departed))
+			for i, id := range event.Departed {
+				names[i] = s.DisplayName(id)
+			}
+			runtime.EventsEmit(b.ctx, EventSecurityRekey, map[string]interface{}{
+				"room_id":   event.RoomID,
+				"epoch":     event.Epoch,
+				"reason":    event.Reason,
+				"departed":  names,
+				"remaining": event.Remaining,
+				"time":      event.At.Format(time.RFC3339),
+			})
+			who := strings.Join(names, ", ")
+			switch event.Reason {
+			case network.LeaveReasonLeft:
+				b.EmitSecurityMessage(fmt.Sprintf("Klucze sesji odnowione (epoka %d): %s opuścił(a) pokój i nie odczyta dalszych wiadomości.", event.Epoch, who))
+			case network.LeaveReasonKicked:
+				b.EmitSecurityMessage(fmt.Sprintf("Klucze sesji odnowione (epoka %d) po usunięciu z pokoju: %s. Dalszych wiadomości nie odczyta.", event.Epoch, who))
+			default:
+				b.EmitSecurityMessage(fmt.Sprintf("Klucze sesji odnowione (epoka %d): utracono połączenie (%s) bez pożegnania. Po powrocie dołączy z nowymi kluczami.", event.Epoch, who))
+			}
+		}
+	}
+}
+
+// monitorKicks informuje frontend, że host usunął nas z pokoju
+func (b *Bridge) monitorKicks(ctx context.Context) {
+	defer crash.Recover("wailsbridge.monitorKicks")
+	if b.execp2p == nil || b.ctx == nil {
+		return
+	}
+
+	notices := b.execp2p.KickNotices()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case kick := <-notices:
+			runtime.EventsEmit(b.ctx, EventRoomKicked, map[string]interface{}{
+				"room_id": kick.RoomID,
+				"reason":  kick.Reason,
+			})
+			b.EmitSecurityMessage("Host usunął cię z pokoju. Połączenie zostało zamknięte, a klucze sesji odnowione.")
+		}
+	}
+}
+
+// monitorDepartures informuje frontend, że uczestnik odszedł i dlaczego:
+// pożegnał się, utracił połączenie, został usunięty lub odrzucony
+func (b *Bridge) monitorDepartures(ctx context.Context) {
+	defer crash.Recover("wailsbridge.monitorDepartures")
+	if b.execp2p == nil || b.ctx == nil {
+		return
+	}
+
+	notices := b.execp2p.DepartureNotices()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case d := <-notices:
+			s, ok := b.execp2p.Session(d.RoomID)
+			if !ok {
+				s = b.room()
+			}
+			runtime.EventsEmit(b.ctx, EventPeerDisconnected, map[string]interface{}{
+				"room_id": d.RoomID,
+				"peer_id": d.PeerID,
+				"name":    s.DisplayName(d.PeerID),
+				"reason":  d.Reason,
+			})
+		}
+	}
+}
+
+// monitorLiveness informuje frontend, że uczestnik od dłuższej chwili milczy
+// (peer:offline) albo znów się odezwał (peer:online)
+func (b *Bridge) monitorLiveness(ctx context.Context) {
+	defer crash.Recover("wailsbridge.monitorLiveness")
+	if b.execp2p == nil || b.ctx == nil {
+		return
+	}
+
+	notices := b.execp2p.LivenessNotices()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case l := <-notices:
+			s, ok := b.execp2p.Session(l.RoomID)
+			if !ok {
+				s = b.room()
+			}
+			event := EventPeerOffline
+			if l.Online {
+				event = EventPeerOnline
+			}
+			runtime.EventsEmit(b.ctx, event, map[string]interface{}{
+				"room_id": l.RoomID,
+				"peer_id": l.PeerID,
+				"name":    s.DisplayName(l.PeerID),
+			})
+		}
+	}
+}
+
+// monitorNetworkErrors przekazuje frontendowi błędy sieci wszystkich pokojów
+func (b *Bridge) monitorNetworkErrors(ctx context.Context) {
+	defer crash.Recover("wailsbridge.monitorNetworkErrors")
+	if b.execp2p == nil || b.ctx == nil {
+		return
+	}
+
+	errs := b.execp2p.NetworkErrors()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case err := <-errs:
+			b.EmitNetworkError(err)
+		}
+	}
+}
+
+// monitorRefusals informuje frontend, dlaczego host nie wpuścił nas do pokoju
+func (b *Bridge) monitorRefusals(ctx context.Context) {
+	defer crash.Recover("wailsbridge.monitorRefusals")
+	if b.execp2p == nil || b.ctx == nil {
+		return
+	}
+
+	notices := b.execp2p.RefusalNotices()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case err := <-notices:
+			switch {
+			case errors.Is(err, network.ErrRoomFull):
+				b.EmitSecurityMessage("Pokój jest pełny: osiągnięto limit uczestników. Spróbuj dołączyć później.")
+			case errors.Is(err, network.ErrBanned):
+				b.EmitSecurityMessage("Host zablokował twoją tożsamość w tym pokoju.")
+			case errors.Is(err, network.ErrIncompatibleVersion):
+				b.EmitSecurityMessage("Host używa niezgodnej wersji protokołu. Jedna ze stron musi zaktualizować aplikację.")
+			}
+			// odrzucony klucz dostępu frontend opisuje sam (network:error z code auth)
+		}
+	}
+}
+
+// monitorRoomClosed informuje frontend, że pokój zamknął się na dobre, a jego
+// historia została usunięta
+func (b *Bridge) monitorRoomClosed(ctx context.Context) {
+	defer crash.Recover("wailsbridge.monitorRoomClosed")
+	if b.execp2p == nil || b.ctx == nil {
+		return
+	}
+
+	notices := b.execp2p.ClosedNotices()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case closed := <-notices:
+			runtime.EventsEmit(b.ctx, EventRoomClosed, map[string]interface{}{
+				"room_id": closed.RoomID,
+				"reason":  closed.Reason,
+				"local":   closed.Local,
+			})
+			switch closed.Reason {
+			case app.CloseExpired:
+				b.EmitSecurityMessage("Pokój zamknięty: minął jego czas życia. Historia rozmowy została usunięta.")
+			case app.CloseIdle:
+				b.EmitSecurityMessage("Pokój zamknięty z powodu bezczynności. Historia rozmowy została usunięta.")
+			default:
+				b.EmitSecurityMessage("Host zamknął pokój. Historia rozmowy została usunięta.")
+			}
+			b.roomGone(closed.RoomID)
+		}
+	}
+}
+
+// monitorCrashes informuje frontend o błędzie wewnętrznym. Jeśli przerwał
+// on obsługę pokojów, zostały one opuszczone (rozmówcy dostali pożegnanie)
+// i można do nich wejść ponownie.
+func (b *Bridge) monitorCrashes(ctx context.Context) {
+	defer crash.Recover("wailsbridge.monitorCrashes")
+	if b.execp2p == nil || b.ctx == nil {
+		return
+	}
+
+	notices := b.execp2p.CrashNotices()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case c := <-notices:
+			rooms := c.Rooms
+			if rooms == nil {
+				rooms = []string{}
+			}
+			runtime.EventsEmit(b.ctx, EventAppCrash, map[string]interface{}{
+				"time":      c.Time.Unix(),
+				"where":     c.Where,
+				"panic":     c.Panic,
+				"version":   c.Version,
+				"platform":  c.Platform,
+				"recovered": c.Recovered,
+				"report":    c.Path,
+				"rooms":     rooms,
+			})
+			for _, roomID := range c.Rooms {
+				b.roomGone(roomID)
+			}
+		}
+	}
+}
+
+// monitorBans informuje frontend o zablokowaniu tożsamości w pokoju lub
+// zdjęciu blokady
+func (b *Bridge) monitorBans(ctx context.Context) {
+	defer crash.Recover("wailsbridge.monitorBans")
+	if b.execp2p == nil || b.ctx == nil {
+		return
+	}
+
+	notices := b.execp2p.BanNotices()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case change := <-notices:
+			runtime.EventsEmit(b.ctx, EventRoomBanned, map[string]interface{}{
+				"room_id":     change.RoomID,
+				"fingerprint": change.Fingerprint,
+				"nickname":    change.Nickname,
+				"reason":      change.Reason,
+				"lifted":      change.Lifted,
+				"local":       change.Local,
+			})
+			name := change.Nickname
+			if name == "" {
+				name = change.Fingerprint
+			}
+			if change.Lifted {
+				b.EmitSecurityMessage(fmt.Sprintf("Host zdjął blokadę tożsamości %s.", name))
+			} else {
+				b.EmitSecurityMessage(fmt.Sprintf("Host zablokował tożsamość %s (%s); nie może ona dołączyć do pokoju.", name, change.Fingerprint))
+			}
+		}
+	}
+}
+
+// monitorHistorySync przekazuje wynik synchronizacji historii z innym
+// urządzeniem użytkownika
+func (b *Bridge) monitorHistorySync(ctx context.Context) {
+	defer crash.Recover("wailsbridge.monitorHistorySync")
+	if b.execp2p == nil || b.ctx == nil {
+		return
+	}
+
+	notices := b.execp2p.HistorySyncNotices()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case result := <-notices:
+			runtime.EventsEmit(b.ctx, EventHistorySynced, map[string]interface{}{
+				"peer":     result.PeerID,
+				"rooms":    result.Rooms,
+				"messages": result.Messages,
+				"failed":   result.Failed,
+			})
+			b.EmitSecurityMessage(fmt.Sprintf("Zsynchronizowano historię z Twojego drugiego urządzenia: %d wiadomości z %d pokoi.",
+				result.Messages, result.Rooms))
+		}
+	}
+}
+
+// monitorDeviceWipe informuje o wyczyszczeniu tego urządzenia i zamyka
+// aplikację: bez kluczy i danych nie ma już czego pokazywać
+func (b *Bridge) monitorDeviceWipe(ctx context.Context) {
+	defer crash.Recover("wailsbridge.monitorDeviceWipe")
+	if b.execp2p == nil || b.ctx == nil {
+		return
+	}
+
+	select {
+	case <-ctx.Done():
+	case wiped := <-b.execp2p.DeviceWipedNotices():
+		detail := ""
+		if wiped.Err != nil {
+			detail = wiped.Err.Error()
+		}
+		runtime.EventsEmit(b.ctx, EventDeviceWiped, map[string]interface{}{
+			"peer":  wiped.PeerID,
+			"error": detail,
+		})
+		if wiped.Err != nil {
+			b.EmitSecurityMessage(fmt.Sprintf("Urządzenie główne zleciło wyczyszczenie tego urządzenia; części danych nie usunięto: %v", wiped.Err))
+		} else {
+			b.EmitSecurityMessage("Urządzenie główne zleciło wyczyszczenie tego urządzenia. Klucze i dane lokalne zostały usunięte.")
+		}
+		// frontend ma chwilę na pokazanie komunikatu
+		time.Sleep(5 * time.Second)
+		runtime.Quit(b.ctx)
+	}
+}
+
+// monitorMailbox informuje o wiadomościach odebranych ze skrzynki na serwerze
+func (b *Bridge) monitorMailbox(ctx context.Context) {
+	defer crash.Recover("wailsbridge.monitorMailbox")
+	if b.execp2p == nil || b.ctx == nil {
 		return
 	}
 
-	runtime.EventsEmit(b.ctx, EventNetworkError, err.Error())
+	notices := b.execp2p.MailboxNotices()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case delivery := <-notices:
+			runtime.EventsEmit(b.ctx, EventMailboxDelivered, map[string]interface{}{
+				"messages": delivery.Messages,
+				"rooms":    delivery.Rooms,
+				"rejected": delivery.Rejected,
+			})
+			if delivery.Messages > 0 {
+				b.EmitSecurityMessage(fmt.Sprintf("Odebrano %d wiadomości zostawionych w skrzynce, gdy byłeś(-aś) offline.", delivery.Messages))
+			}
+			if delivery.Rejected > 0 {
+				b.EmitSecurityMessage(fmt.Sprintf("Odrzucono %d wiadomości ze skrzynki: nieznany nadawca lub zmieniony odcisk palca.", delivery.Rejected))
+			}
+			if delivery.ContactRequests > 0 {
+				runtime.EventsEmit(b.ctx, EventContactRequest, map[string]interface{}{"count": delivery.ContactRequests})
+				b.EmitSecurityMessage(fmt.Sprintf("Nowe prośby o kontakt od osób spoza Twoich pokojów: %d. Sprawdź odcisk palca nadawcy, zanim je przyjmiesz.", delivery.ContactRequests))
+			}
+		}
+	}
+}
+
+// CheckMailbox od razu sprawdza skrzynkę na serwerze i zwraca liczbę odebranych wiadomości
+func (b *Bridge) CheckMailbox() (int, error) {
+	delivery, err := b.room().CheckMailbox(b.ctx)
+	return delivery.Messages, err
+}
+
+// ContactUser zostawia pierwszą wiadomość osobie, która opublikowała
+// wizytówkę pod danym ID użytkownika. Z invite wiadomość zaprasza do
+// wybranego pokoju. Zwraca odcisk palca adresata, do sprawdzenia z nim.
+func (b *Bridge) ContactUser(userID, fingerprint, message string, invite bool) (string, error) {
+	return b.room().ContactUser(b.ctx, userID, fingerprint, message, invite)
+}
+
+// GetContactRequests zwraca pierwsze wiadomości od osób, których jeszcze nie znamy
+func (b *Bridge) GetContactRequests() []map[string]interface{} {
+	requests := b.execp2p.ContactRequests()
+	result := make([]map[string]interface{}, 0, len(requests))
+	for _, r := range requests {
+		entry := map[string]interface{}{
+			"id":          r.ID,
+			"senderId":    r.SenderID,
+			"senderName":  r.SenderName,
+			"fingerprint": r.Fingerprint,
+			"message":     r.Message,
+			"sentAt":      r.SentAt.Format(time.RFC3339),
+			"known":       r.Known,
+			"invite":      r.Rendezvous != nil,
+		}
+		if r.Rendezvous != nil {
+			entry["roomId"] = r.Rendezvous.RoomID
+		}
+		result = append(result, entry)
+	}
+	return result
+}
+
+// AcceptContactRequest przyjmuje prośbę o kontakt: zapamiętuje tożsamość
+// nadawcy i wchodzi do pokoju, do którego zaprasza, jeśli jakiś podał
+func (b *Bridge) AcceptContactRequest(id string) error {
+	rendezvous, err := b.execp2p.AcceptContactRequest(id)
+	if err != nil || rendezvous == nil {
+		return err
+	}
+	return b.enter(func(s *app.ExecP2P) error {
+		return s.JoinRoom(b.ctx, rendezvous.RoomID, rendezvous.Address, rendezvous.AccessKey)
+	})
+}
+
+// DismissContactRequest usuwa prośbę o kontakt bez odpowiedzi
+func (b *Bridge) DismissContactRequest(id string) error {
+	return b.execp2p.DismissContactRequest(id)
+}
+
+// GetArchiveStatus zwraca informację, czy host archiwizuje bieżący pokój
+func (b *Bridge) GetArchiveStatus() map[string]interface{} {
+	return archiveStatusMap(b.room().ArchiveStatus())
+}
+
+func archiveStatusMap(status app.ArchiveStatus) map[string]interface{} {
+	since := ""
+	if !status.Since.IsZero() {
+		since = status.Since.Format(time.RFC3339)
+	}
+	return map[string]interface{}{
+		"room_id":   status.RoomID,
+		"incognito": status.Incognito,
+		"archiving": status.Archiving,
+		"sinks":     status.Sinks,
+		"since":     since,
+		"host_id":   status.HostID,
+		"local":     status.Local,
+		"known":     status.Known,
+	}
+}
+
+// monitorShortcodes przekazuje do frontendu listę skrótów pokoju po każdej zmianie
+func (b *Bridge) monitorShortcodes(ctx context.Context) {
+	defer crash.Recover("wailsbridge.monitorShortcodes")
+	if b.execp2p == nil || b.ctx == nil {
+		return
+	}
+
+	notices := b.execp2p.ShortcodeNotices()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-notices:
+			runtime.EventsEmit(b.ctx, EventRoomShortcodes, b.GetRoomShortcodes())
+		}
+	}
+}
+
+// GetRoomShortcodes zwraca własne skróty emoji pokoju; obrazek (data URL)
+// jest pusty, dopóki nie dotrze od hosta
+func (b *Bridge) GetRoomShortcodes() []map[string]interface{} {
+	list := b.room().RoomShortcodes()
+	out := make([]map[string]interface{}, 0, len(list))
+	for _, sc := range list {
+		dataURL := ""
+		if sc.Image != nil {
+			dataURL = sc.Image.DataURL()
+		}
+		out = append(out, map[string]interface{}{
+			"code":     sc.Code,
+			"hash":     sc.Hash,
+			"mime":     sc.MIME,
+			"size":     sc.Size,
+			"data_url": dataURL,
+		})
+	}
+	return out
+}
+
+// AddRoomShortcode dodaje skrót :code: z obrazkiem (data URL lub base64);
+// tylko host pokoju
+func (b *Bridge) AddRoomShortcode(code string, image string) (map[string]interface{}, error) {
+	if _, data, ok := strings.Cut(image, ";base64,"); ok {
+		image = data
+	}
+	data, err := base64.StdEncoding.DecodeString(image)
+	if err != nil {
+		return nil, fmt.Errorf("nieprawidłowy obrazek: %w", err)
+	}
+	sc, err := b.room().AddRoomShortcode(code, data)
+	if err != nil {
+		return nil, err
+	}
+	return map[string]interface{}{
+		"code": sc.Code,
+		"hash": sc.Hash,
+		"mime": sc.MIME,
+		"size": sc.Size,
+	}, nil
+}
+
+// RemoveRoomShortcode usuwa skrót z pokoju; tylko host pokoju
+func (b *Bridge) RemoveRoomShortcode(code string) error {
+	return b.room().RemoveRoomShortcode(code)
+}
+
+// GetVerificationQR zwraca kod QR do weryfikacji tożsamości przez rozmówcę
+// (obraz PNG jako data URL oraz jego treść)
+func (b *Bridge) GetVerificationQR(peerID string) (map[string]interface{}, error) {
+	code, err := b.room().VerificationCode(peerID)
+	if err != nil {
+		return nil, err
+	}
+	png, err := code.PNG(320)
+	if err != nil {
+		return nil, err
+	}
+	return map[string]interface{}{
+		"payload":     code.String(),
+		"image":       "data:image/png;base64," + base64.StdEncoding.EncodeToString(png),
+		"fingerprint": code.Fingerprint,
+		"expires_at":  code.Issued.Add(verification.MaxAge).Format(time.RFC3339),
+	}, nil
+}
+
+// VerifyScannedQR sprawdza treść kodu QR zeskanowanego z ekranu rozmówcy
+func (b *Bridge) VerifyScannedQR(payload string) (map[string]interface{}, error) {
+	result, err := b.room().VerifyScannedCode(payload)
+	if err != nil {
+		return nil, err
+	}
+	b.EmitSecurityMessage("Tożsamość rozmówcy " + result.PeerID + " potwierdzona kodem QR.")
+	return map[string]interface{}{
+		"peer_id":     result.PeerID,
+		"fingerprint": result.Fingerprint,
+		"mutual":      result.Mutual,
+	}, nil
+}
+
+// GetPinnedPeers zwraca listę zapamiętanych (TOFU) odcisków palca peerów
+func (b *Bridge) GetPinnedPeers() []map[string]interface{} {
+	entries := b.room().PinnedPeers()
+	peers := make([]map[string]interface{}, 0, len(entries))
+	for _, e := range entries {
+		peers = append(peers, map[string]interface{}{
+			"peer_id":     e.PeerID,
+			"fingerprint": e.Fingerprint,
+			"first_seen":  e.FirstSeen.Format(time.RFC3339),
+			"last_seen":   e.LastSeen.Format(time.RFC3339),
+
+			"tls_fingerprint": e.TLSFingerprint,
+
+			"first_seen_formatted": b.room().FormatTime(e.FirstSeen).DateTime,
+			"last_seen_formatted":  b.room().FormatTime(e.LastSeen).DateTime,
+
+			"verified":        e.Verified(),
+			"verified_method": e.VerifiedMethod,
+		})
+	}
+	return peers
+}
+
+// ForgetPeer usuwa zapamiętany odcisk palca peer'a
+func (b *Bridge) ForgetPeer(peerID string) error {
+	return b.room().ForgetPeer(peerID)
+}
+
+// TrustPeerFingerprint akceptuje nowy odcisk palca peer'a (po weryfikacji poza aplikacją)
+func (b *Bridge) TrustPeerFingerprint(peerID string, fingerprint string) error {
+	return b.room().PinPeer(peerID, fingerprint)
+}
+
+// GetQuarantinedPeers zwraca listę odizolowanych rozmówców
+func (b *Bridge) GetQuarantinedPeers() []map[string]interface{} {
+	list := b.room().QuarantinedPeers()
+	peers := make([]map[string]interface{}, 0, len(list))
+	for _, q := range list {
+		peers = append(peers, b.quarantineMap(q))
+	}
+	return peers
+}
+
+func (b *Bridge) quarantineMap(q trust.Quarantine) map[string]interface{} {
+	return map[string]interface{}{
+		"peer_id":         q.PeerID,
+		"nickname":        b.room().DisplayName(q.PeerID),
+		"fingerprint":     q.Fingerprint,
+		"reason":          q.Reason,
+		"expected":        q.Expected,
+		"presented":       q.Presented,
+		"since":           q.Since.Format(time.RFC3339),
+		"since_formatted": b.room().FormatTime(q.Since).DateTime,
+		"refused":         q.Refused,
+		"rejected":        q.Rejected,
+	}
+}
+
+// AcceptPeer akceptuje odizolowanego rozmówcę: zapamiętuje jego nowy odcisk
+// palca lub certyfikat i wznawia wiadomości
+func (b *Bridge) AcceptPeer(peerID string) error {
+	return b.room().AcceptPeer(peerID)
+}
+
+// RejectPeer odrzuca odizolowanego rozmówcę: rozłącza go i odmawia mu
+// połączeń do czasu zniesienia izolacji (execp2p trust release)
+func (b *Bridge) RejectPeer(peerID string) error {
+	return b.room().RejectPeer(peerID)
+}
+
+// TrustPeerCertificate akceptuje nowy certyfikat TLS peer'a o zapamiętanej tożsamości
+func (b *Bridge) TrustPeerCertificate(peerID string, certFingerprint string) error {
+	return b.room().PinPeerCertificate(peerID, certFingerprint)
+}
+
+// GetPeerVerificationStates zwraca stan weryfikacji połączonych rozmówców
+// (unverified → keys_exchanged → user_verified)
+func (b *Bridge) GetPeerVerificationStates() []map[string]interface{} {
+	states := []map[string]interface{}{}
+	for _, peer := range b.room().GetPeers() {
+		if peer.IsLocal || peer.Address == "" {
+			continue
+		}
+		v := b.room().PeerVerificationState(peer.ID)
+		state := map[string]interface{}{
+			"peer_id":      v.PeerID,
+			"display_name": peer.Nickname,
+			"state":        string(v.State),
+			"fingerprint":  v.Fingerprint,
+			"method":       v.Method,
+		}
+		if !v.VerifiedAt.IsZero() {
+			state["verified_at"] = b.room().FormatTime(v.VerifiedAt).DateTime
+		}
+		states = append(states, state)
+	}
+	return states
+}
+
+// MarkPeerVerified oznacza rozmówcę jako zweryfikowanego (po porównaniu odcisku palca)
+func (b *Bridge) MarkPeerVerified(peerID string) error {
+	return b.room().MarkPeerVerified(peerID)
+}
+
+// UnverifyPeer cofa weryfikację rozmówcy
+func (b *Bridge) UnverifyPeer(peerID string) error {
+	return b.room().UnverifyPeer(peerID)
+}
+
+// GetRequireVerified mówi, czy włączony jest tryb ścisły
+func (b *Bridge) GetRequireVerified() bool {
+	return b.room().RequireVerified()
+}
+
+// SetRequireVerified włącza tryb ścisły: wiadomości od niezweryfikowanych
+// rozmówców są odrzucane bez odszyfrowania
+func (b *Bridge) SetRequireVerified(required bool) {
+	b.room().SetRequireVerified(required)
+}
+
+// GetLocaleSettings zwraca język i strefę czasową używane do formatowania dat
+func (b *Bridge) GetLocaleSettings() map[string]interface{} {
+	language, timezone := b.execp2p.LocaleSettings()
+	return map[string]interface{}{
+		"language":         language,
+		"timezone":         timezone,
+		"effective_zone":   timefmt.Default().Timezone(),
+		"sample_date_time": b.room().FormatTime(time.Now()).DateTime,
+	}
+}
+
+// SetLocaleSettings zmienia język i strefę czasową (pusta strefa = systemowa)
+func (b *Bridge) SetLocaleSettings(language string, timezone string) error {
+	return b.execp2p.SetLocale(language, timezone)
+}
+
+// ReloadConfig wczytuje ponownie plik konfiguracji i stosuje zmiany bez
+// opuszczania pokoju; restart_required to sekcje, które wymagają restartu
+func (b *Bridge) ReloadConfig() (map[string]interface{}, error) {
+	result, err := b.execp2p.ReloadConfig()
+	if err != nil {
+		return nil, err
+	}
+	return map[string]interface{}{
+		"applied":          result.Applied,
+		"restart_required": result.RestartRequired,
+	}, nil
+}
+
+// GetSettings zwraca ustawienia, które można zmienić w panelu ustawień
+func (b *Bridge) GetSettings() config.Settings {
+	return b.execp2p.Settings()
+}
+
+// UpdateSettings zapisuje ustawienia w pliku konfiguracji i od razu je
+// stosuje; zmiany wymagające restartu są wymienione w restart_required
+func (b *Bridge) UpdateSettings(settings config.Settings) (map[string]interface{}, error) {
+	result, err := b.execp2p.UpdateSettings(settings)
+	if err != nil {
+		return nil, err
+	}
+	return map[string]interface{}{
+		"applied":          result.Applied,
+		"restart_required": result.RestartRequired,
+	}, nil
+}
+
+// GetHistory zwraca stronę zapisanej historii pokoju (od najstarszej);
+// before to kursor "next" poprzedniej strony, pusty dla najnowszych wiadomości
+func (b *Bridge) GetHistory(roomID string, before string, limit int) (map[string]interface{}, error) {
+	page, err := b.room().History(roomID, before, limit)
+	if err != nil {
+		return nil, err
+	}
+	messages := make([]map[string]interface{}, 0, len(page.Records))
+	for _, rec := range page.Records {
+		messages = append(messages, b.historyMessage(rec))
+	}
+	return map[string]interface{}{
+		"messages": messages,
+		"next":     page.Next,
+	}, nil
+}
+
+// historyMessage formatuje zapisaną wiadomość tak jak wiadomość na żywo
+func (b *Bridge) historyMessage(rec history.Record) map[string]interface{} {
+	messageType := "text"
+	messageContent := rec.Message
+	mediaUrl := ""
+	var msgData map[string]interface{}
+	if err := json.Unmarshal([]byte(rec.Message), &msgData); err == nil {
+		if msgType, ok := msgData["type"].(string); ok {
+			messageType = msgType
+		}
+		if content, ok := msgData["content"].(string); ok {
+			messageContent = content
+		}
+		mediaUrl = mediaURL(msgData)
+	}
+
+	formatted := b.room().FormatTime(rec.Timestamp)
+	messageData := map[string]interface{}{
+		"id":          rec.MessageID,
+		"sender":      rec.SenderID,
+		"sender_name": rec.SenderName,
+		"message":     messageContent,
+		"timestamp":   rec.Timestamp,
+		"epoch_ms":    formatted.EpochMillis,
+		"time":        formatted.Time,
+		"date_time":   formatted.DateTime,
+		"isLocal":     rec.Outgoing,
+		"type":        messageType,
+		"history":     true,
+	}
+	if mediaUrl != "" {
+		messageData["mediaUrl"] = mediaUrl
+		addMediaDetails(messageData, msgData)
+	}
+	return messageData
+}
+
+// SearchMessages przeszukuje zapisaną historię (wszystkie słowa zapytania,
+// także jako początki dłuższych słów); pusty roomID oznacza wszystkie pokoje.
+// Najlepsze trafienia są pierwsze.
+func (b *Bridge) SearchMessages(query string, roomID string, limit int) ([]map[string]interface{}, error) {
+	matches, err := b.room().SearchHistory(query, roomID, limit)
+	if err != nil {
+		return nil, err
+	}
+	out := make([]map[string]interface{}, 0, len(matches))
+	for _, m := range matches {
+		messageData := b.historyMessage(m.Record)
+		messageData["room_id"] = m.RoomID
+		messageData["score"] = m.Score
+		messageData["snippet"] = m.Snippet
+		out = append(out, messageData)
+	}
+	return out, nil
+}
+
+// GetHistoryRooms zwraca pokoje z zapisaną historią, ostatnio aktywne najpierw
+func (b *Bridge) GetHistoryRooms() []map[string]interface{} {
+	rooms := b.room().HistoryRooms()
+	out := make([]map[string]interface{}, 0, len(rooms))
+	for _, room := range rooms {
+		out = append(out, map[string]interface{}{
+			"room_id":       room.RoomID,
+			"messages":      room.Messages,
+			"last_activity": b.room().FormatTime(room.LastActivity).DateTime,
+		})
+	}
+	return out
+}
+
+// SyncHistory pobiera brakującą historię z połączonego urządzenia, które
+// używa tej samej tożsamości (zaimportowanej z tego komputera) i zwraca
+// identyfikator transferu; wynik przychodzi zdarzeniem history:synced
+func (b *Bridge) SyncHistory() (string, error) {
+	return b.room().SyncHistory()
+}
+
+// OwnDevices zwraca połączone urządzenia z tą samą tożsamością
+func (b *Bridge) OwnDevices() []string {
+	return b.execp2p.OwnDevices()
+}
+
+// IsPrimaryDevice mówi, czy to urządzenie może zdalnie czyścić pozostałe
+func (b *Bridge) IsPrimaryDevice() bool {
+	return b.execp2p.IsPrimaryDevice()
+}
+
+// WipeDevice zleca połączonemu (lub spotkanemu później) urządzeniu z tą samą
+// tożsamością usunięcie kluczy i danych lokalnych
+func (b *Bridge) WipeDevice(peerID string) error {
+	return b.execp2p.WipeDevice(peerID)
+}
+
+// ClearHistory bezpiecznie usuwa zapisaną historię pokoju
+func (b *Bridge) ClearHistory(roomID string) error {
+	return b.room().ClearHistory(roomID)
+}
+
+// EmitSecurityMessage wysyła komunikat bezpieczeństwa do frontendu
+func (b *Bridge) EmitSecurityMessage(message string) {
+	if b.ctx == nil {
+		return
+	}
+
+	runtime.EventsEmit(b.ctx, EventSecurityMessage, message)
+}
+
+// EmitNetworkError wysyła błąd sieci do frontendu: rodzaj (code: auth,
+// transport, protocol, room_mismatch, closed albo unknown), powód zamknięcia
+// połączenia, jeśli go podano, treść i czy ponowne łączenie może pomóc
+func (b *Bridge) EmitNetworkError(err error) {
+	if b.ctx == nil || err == nil {
+		return
+	}
+
+	data := map[string]interface{}{
+		"code":      string(network.Code(err)),
+		"message":   err.Error(),
+		"retryable": network.Retryable(err),
+	}
+	var closeErr *network.CloseError
+	if errors.As(err, &closeErr) {
+		data["reason"] = closeErr.Reason
+	}
+	runtime.EventsEmit(b.ctx, EventNetworkError, data)
 }
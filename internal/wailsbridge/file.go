@@ -0,0 +1,89 @@
+package wailsbridge
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/wailsapp/wails/v2/pkg/runtime"
+)
+
+// SendFile zaczyna wysyłać plik z dysku (np. upuszczony na okno, ścieżki
+// daje runtime.OnFileDrop) i zwraca jego identyfikator, który jest też
+// identyfikatorem transferu. Postęp przychodzi zdarzeniami
+// transfer:progress, wynik zdarzeniem transfer:complete.
+func (b *Bridge) SendFile(path string) (string, error) {
+	if b.execp2p == nil || b.ctx == nil {
+		return "", fmt.Errorf("brak połączenia")
+	}
+	id, err := b.room().SendFile(b.ctx, path)
+	if err != nil {
+		return "", fmt.Errorf("błąd wysyłania pliku: %w", err)
+	}
+	return id, nil
+}
+
+// SendFileData zaczyna wysyłać plik podany jako zawartość (np. wklejony),
+// jak SendFile
+func (b *Bridge) SendFileData(name string, data []byte) (string, error) {
+	if b.execp2p == nil || b.ctx == nil {
+		return "", fmt.Errorf("brak połączenia")
+	}
+	id, err := b.room().SendFileData(b.ctx, name, data)
+	if err != nil {
+		return "", fmt.Errorf("błąd wysyłania pliku: %w", err)
+	}
+	return id, nil
+}
+
+// ChooseAndSendFile pokazuje okno wyboru pliku i zaczyna go wysyłać; pusty
+// identyfikator oznacza, że użytkownik zrezygnował
+func (b *Bridge) ChooseAndSendFile() (map[string]interface{}, error) {
+	if b.execp2p == nil || b.ctx == nil {
+		return nil, fmt.Errorf("brak połączenia")
+	}
+	path, err := runtime.OpenFileDialog(b.ctx, runtime.OpenDialogOptions{
+		Title: "Wyślij plik",
+	})
+	if err != nil {
+		return nil, err
+	}
+	if path == "" {
+		return map[string]interface{}{"id": ""}, nil
+	}
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, fmt.Errorf("błąd odczytu pliku: %w", err)
+	}
+	id, err := b.SendFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return map[string]interface{}{
+		"id":   id,
+		"name": info.Name(),
+		"size": info.Size(),
+	}, nil
+}
+
+// SaveReceivedFile zapisuje odebrany plik (mediaId z wiadomości) w miejscu
+// wybranym przez użytkownika i zwraca ścieżkę
+func (b *Bridge) SaveReceivedFile(id string) (string, error) {
+	item, err := b.room().ReceivedFile(id)
+	if err != nil {
+		return "", err
+	}
+	path, err := runtime.SaveFileDialog(b.ctx, runtime.SaveDialogOptions{
+		Title:           "Zapisz plik",
+		DefaultFilename: item.Name,
+	})
+	if err != nil {
+		return "", err
+	}
+	if path == "" {
+		return "", fmt.Errorf("anulowano zapis")
+	}
+	if err := os.WriteFile(path, item.Data, 0o600); err != nil {
+		return "", fmt.Errorf("błąd zapisu pliku: %w", err)
+	}
+	return path, nil
+}
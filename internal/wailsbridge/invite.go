@@ -0,0 +1,71 @@
+package wailsbridge
+
+import (
+	"errors"
+
+	"execp2p/internal/logger"
+	"execp2p/internal/room"
+
+	"github.com/wailsapp/wails/v2/pkg/runtime"
+)
+
+// ReceiveInviteLink przyjmuje link execp2p:// z wiersza poleceń, z kolejnego
+// uruchomienia albo (macOS) od systemu; nieprawidłowy jest pomijany
+func (b *Bridge) ReceiveInviteLink(link string) {
+	invite, err := room.ParseInvite(link)
+	if err != nil {
+		logger.L().Warn("Ignoring an invalid invite link", "err", err)
+		b.EmitSecurityMessage("Pominięto nieprawidłowy link z zaproszeniem")
+		b.Raise()
+		return
+	}
+	b.ReceiveInvite(invite)
+}
+
+// ReceiveInvite zapamiętuje zaproszenie do potwierdzenia w interfejsie i
+// wyciąga okno na wierzch. Do pokoju nie dołączamy sami: link mógł otworzyć
+// ktoś inny, np. strona w przeglądarce.
+func (b *Bridge) ReceiveInvite(invite room.Invite) {
+	b.mu.Lock()
+	b.pendingInvite = &invite
+	b.mu.Unlock()
+	if b.ctx == nil {
+		// frontend odbierze je przez TakePendingInvite po starcie
+		return
+	}
+	b.Raise()
+	runtime.EventsEmit(b.ctx, EventInviteReceived, invite.RoomID)
+}
+
+// TakePendingInvite zwraca zaproszenie czekające na potwierdzenie i
+// zapomina je; nil, gdy żadnego nie ma
+func (b *Bridge) TakePendingInvite() *room.Invite {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	invite := b.pendingInvite
+	b.pendingInvite = nil
+	return invite
+}
+
+// GetInviteLink zwraca link execp2p:// do wybranego pokoju, z kluczem
+// dostępu; kto go ma, może dołączyć
+func (b *Bridge) GetInviteLink() (string, error) {
+	id := roomID(b.room())
+	if id == "" {
+		return "", errors.New("nie jesteśmy w żadnym pokoju")
+	}
+	accessKey, err := b.GetRoomAccessKey()
+	if err != nil {
+		return "", err
+	}
+	return room.Invite{RoomID: id, AccessKey: accessKey}.Link(), nil
+}
+
+// Raise wyciąga okno na wierzch
+func (b *Bridge) Raise() {
+	if b.ctx == nil {
+		return
+	}
+	runtime.WindowUnminimise(b.ctx)
+	runtime.WindowShow(b.ctx)
+}
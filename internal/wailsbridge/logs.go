@@ -0,0 +1,65 @@
+package wailsbridge
+
+import (
+	"context"
+	"time"
+
+	"execp2p/internal/crash"
+	"execp2p/internal/logger"
+
+	"github.com/wailsapp/wails/v2/pkg/runtime"
+)
+
+// GetRecentLogs zwraca ostatnie wpisy dziennika na poziomie level ("debug",
+// "info", "warn", "error") lub wyższym, najstarsze pierwsze; limit <= 0 to
+// wszystkie zachowane. Wpisy są w pamięci także wtedy, gdy dziennik nie jest
+// nigdzie zapisywany.
+func (b *Bridge) GetRecentLogs(level string, limit int) []map[string]interface{} {
+	entries := logger.Recent(logger.ParseLevel(level), limit)
+	list := make([]map[string]interface{}, 0, len(entries))
+	for _, e := range entries {
+		list = append(list, b.logEntryMap(e))
+	}
+	return list
+}
+
+// GetLogLevel zwraca bieżący poziom dziennika; pusty, gdy dziennik nie jest
+// nigdzie zapisywany
+func (b *Bridge) GetLogLevel() string {
+	return b.execp2p.LogLevel()
+}
+
+// SetLogLevel zmienia poziom dziennika od razu, bez opuszczania pokoju, i
+// zapisuje go w pliku konfiguracji
+func (b *Bridge) SetLogLevel(level string) error {
+	return b.execp2p.SetLogLevel(level)
+}
+
+func (b *Bridge) logEntryMap(e logger.Entry) map[string]interface{} {
+	return map[string]interface{}{
+		"time":           e.Time.Format(time.RFC3339Nano),
+		"time_formatted": b.execp2p.FormatTime(e.Time).Time,
+		"level":          e.Level,
+		"msg":            e.Message,
+		"attrs":          e.Attrs,
+	}
+}
+
+// monitorLogs przekazuje do frontendu nowe wpisy dziennika
+func (b *Bridge) monitorLogs(ctx context.Context) {
+	defer crash.Recover("wailsbridge.monitorLogs")
+	if b.execp2p == nil || b.ctx == nil {
+		return
+	}
+
+	entries, cancel := logger.Subscribe(64)
+	defer cancel()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case e := <-entries:
+			runtime.EventsEmit(b.ctx, EventLogEntry, b.logEntryMap(e))
+		}
+	}
+}
@@ -0,0 +1,261 @@
+package wailsbridge
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"fmt"
+	"mime"
+	"net/http"
+	"strings"
+	"time"
+
+	"execp2p/internal/app"
+	"execp2p/internal/crash"
+
+	"github.com/wailsapp/wails/v2/pkg/runtime"
+)
+
+const (
+	// mediaPathPrefix to ścieżka, pod którą web view pobiera multimedia
+	mediaPathPrefix = "/media/"
+	// czas na dotarcie oryginału zdjęcia od nadawcy
+	originalMediaTimeout = 2 * time.Minute
+)
+
+// NewMediaHandler obsługuje zapytania web view o multimedia (/media/<id>),
+// których nie ma wśród zasobów frontendu. Dzięki temu zdjęcia i nagrania nie
+// przechodzą przez most jako base64.
+func NewMediaHandler(execp2p *app.ExecP2P) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id, ok := strings.CutPrefix(r.URL.Path, mediaPathPrefix)
+		if !ok || r.Method != http.MethodGet {
+			http.NotFound(w, r)
+			return
+		}
+		item, ok := execp2p.Media(id)
+		if !ok {
+			http.NotFound(w, r)
+			return
+		}
+		w.Header().Set("Content-Type", item.ContentType)
+		w.Header().Set("X-Content-Type-Options", "nosniff")
+		if !strings.HasPrefix(item.ContentType, "image/") && !strings.HasPrefix(item.ContentType, "audio/") {
+			// pliki tylko do pobrania, nigdy do wyświetlenia
+			w.Header().Set("Content-Disposition", mime.FormatMediaType("attachment", map[string]string{"filename": item.Name}))
+		}
+		w.Header().Set("Cache-Control", "private, max-age=86400, immutable")
+		http.ServeContent(w, r, "", item.Stored, bytes.NewReader(item.Data))
+	})
+}
+
+// mediaURL zwraca adres multimediów wiadomości: lokalny dla mediów
+// przesłanych osobnym strumieniem, wbudowany data URL dla starszych wiadomości
+func mediaURL(msgData map[string]interface{}) string {
+	if id, ok := msgData["media_id"].(string); ok && id != "" {
+		return mediaPathPrefix + id
+	}
+	if url, ok := msgData["mediaUrl"].(string); ok {
+		return url
+	}
+	return ""
+}
+
+// addMediaDetails dodaje do wiadomości dla frontendu identyfikator
+// multimediów, a dla zdjęć miniaturę, wymiary i identyfikator oryginału
+// w pełnej rozdzielczości, jeśli nadawca go trzyma; dla nagrań długość
+// i przebieg głośności
+func addMediaDetails(messageData, msgData map[string]interface{}) {
+	if id, ok := msgData["media_id"].(string); ok && id != "" {
+		messageData["mediaId"] = id
+	}
+	if size, ok := msgData["size"].(float64); ok {
+		messageData["size"] = int64(size)
+	}
+	if ms, ok := msgData["duration_ms"].(float64); ok {
+		messageData["durationMs"] = int64(ms)
+	}
+	// []byte w JSON to base64
+	if encoded, ok := msgData["waveform"].(string); ok {
+		if raw, err := base64.StdEncoding.DecodeString(encoded); err == nil {
+			waveform := make([]int, len(raw))
+			for i, v := range raw {
+				waveform[i] = int(v)
+			}
+			messageData["waveform"] = waveform
+		}
+	}
+	if id, ok := msgData["thumbnail_id"].(string); ok && id != "" {
+		messageData["thumbnailUrl"] = mediaPathPrefix + id
+	}
+	for _, key := range []string{"width", "height"} {
+		if v, ok := msgData[key].(float64); ok {
+			messageData[key] = int(v)
+		}
+	}
+	if original, ok := msgData["original"].(map[string]interface{}); ok {
+		if id, ok := original["media_id"].(string); ok && id != "" {
+			messageData["originalId"] = id
+		}
+		if size, ok := original["size"].(float64); ok {
+			messageData["originalSize"] = int64(size)
+		}
+	}
+}
+
+// SendMedia wysyła zdjęcie, GIF lub nagranie (kind: image, gif, audio)
+// podane jako data URL osobnym strumieniem QUIC, a potem wiadomość, która
+// na nie wskazuje. Zwraca identyfikator i lokalny adres multimediów.
+func (b *Bridge) SendMedia(kind string, name string, dataURL string) (map[string]interface{}, error) {
+	if b.execp2p == nil || b.ctx == nil {
+		return nil, fmt.Errorf("brak połączenia")
+	}
+	contentType, data, err := decodeDataURL(dataURL)
+	if err != nil {
+		return nil, err
+	}
+	var id string
+	if kind == "image" || kind == "gif" {
+		// zdjęcia bez metadanych (EXIF), pomniejszone, z miniaturą
+		id, err = b.room().SendPicture(b.ctx, kind, name, contentType, data)
+	} else {
+		id, err = b.room().SendMedia(b.ctx, kind, name, contentType, bytes.NewReader(data), int64(len(data)))
+	}
+	if err != nil {
+		return nil, fmt.Errorf("błąd wysyłania multimediów: %w", err)
+	}
+	return map[string]interface{}{
+		"id":       id,
+		"mediaUrl": mediaPathPrefix + id,
+	}, nil
+}
+
+// GetOriginalMedia prosi nadawcę o zdjęcie w pełnej rozdzielczości
+// (originalId z wiadomości) i zwraca jego lokalny adres, gdy dotrze
+func (b *Bridge) GetOriginalMedia(id string) (string, error) {
+	if b.execp2p == nil || b.ctx == nil {
+		return "", fmt.Errorf("brak połączenia")
+	}
+	ctx, cancel := context.WithTimeout(b.ctx, originalMediaTimeout)
+	defer cancel()
+	item, err := b.room().RequestOriginal(ctx, id)
+	if err != nil {
+		return "", fmt.Errorf("nie udało się pobrać oryginału: %w", err)
+	}
+	return mediaPathPrefix + item.ID, nil
+}
+
+// GetMediaCacheStats zwraca liczbę i rozmiar multimediów trzymanych w pamięci
+// i w zaszyfrowanej pamięci podręcznej na dysku wraz z limitami
+func (b *Bridge) GetMediaCacheStats() map[string]interface{} {
+	stats := b.room().MediaStats()
+	return map[string]interface{}{
+		"memory_items": stats.MemoryItems,
+		"memory_size":  stats.MemorySize,
+		"memory_limit": stats.MemoryLimit,
+		"disk_items":   stats.DiskItems,
+		"disk_size":    stats.DiskSize,
+		"disk_limit":   stats.DiskLimit,
+	}
+}
+
+// ClearMediaCache usuwa wszystkie zdjęcia i nagrania z pamięci i z dysku;
+// wiadomości, które na nie wskazują, pokażą brakujący obraz
+func (b *Bridge) ClearMediaCache() error {
+	return b.room().ClearMedia()
+}
+
+// GetVoiceSupport mówi, czy wiadomości głosowe są nagrywane i odtwarzane
+// natywnie (ffmpeg); jeśli nie, frontend nagrywa sam, a reason podaje powód
+func (b *Bridge) GetVoiceSupport() map[string]interface{} {
+	record, play, reason := b.room().VoiceSupport()
+	support := map[string]interface{}{
+		"record": record,
+		"play":   play,
+	}
+	if reason != nil {
+		support["reason"] = reason.Error()
+	}
+	return support
+}
+
+// StartVoiceRecording zaczyna nagrywanie z mikrofonu w back-endzie
+func (b *Bridge) StartVoiceRecording() error {
+	if err := b.room().StartVoiceRecording(); err != nil {
+		return fmt.Errorf("nie można rozpocząć nagrywania: %w", err)
+	}
+	return nil
+}
+
+// StopVoiceRecording kończy nagrywanie i wysyła je jako wiadomość głosową
+// (Opus). Zwraca identyfikator, lokalny adres, długość i przebieg głośności.
+func (b *Bridge) StopVoiceRecording() (map[string]interface{}, error) {
+	if b.execp2p == nil || b.ctx == nil {
+		return nil, fmt.Errorf("brak połączenia")
+	}
+	sent, err := b.room().StopVoiceRecording(b.ctx)
+	if err != nil {
+		return nil, fmt.Errorf("błąd wysyłania wiadomości głosowej: %w", err)
+	}
+	waveform := make([]int, len(sent.Waveform))
+	for i, v := range sent.Waveform {
+		waveform[i] = int(v)
+	}
+	return map[string]interface{}{
+		"id":         sent.MediaID,
+		"mediaUrl":   mediaPathPrefix + sent.MediaID,
+		"durationMs": sent.Duration.Milliseconds(),
+		"waveform":   waveform,
+	}, nil
+}
+
+// CancelVoiceRecording przerywa nagrywanie bez wysyłania
+func (b *Bridge) CancelVoiceRecording() {
+	b.room().CancelVoiceRecording()
+}
+
+// PlayVoiceMessage odtwarza wiadomość głosową (mediaId z wiadomości);
+// początek i koniec odtwarzania przychodzą zdarzeniem voice:playback
+func (b *Bridge) PlayVoiceMessage(id string) error {
+	return b.room().PlayVoice(id)
+}
+
+// StopVoicePlayback zatrzymuje odtwarzaną wiadomość głosową
+func (b *Bridge) StopVoicePlayback() {
+	b.room().StopVoicePlayback()
+}
+
+// monitorVoicePlayback przekazuje frontendowi początek i koniec odtwarzania
+func (b *Bridge) monitorVoicePlayback(ctx context.Context) {
+	defer crash.Recover("wailsbridge.monitorVoicePlayback")
+	if b.execp2p == nil || b.ctx == nil {
+		return
+	}
+
+	notices := b.execp2p.VoicePlaybackNotices()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case n := <-notices:
+			runtime.EventsEmit(b.ctx, EventVoicePlayback, map[string]interface{}{
+				"mediaId": n.MediaID,
+				"playing": n.Playing,
+			})
+		}
+	}
+}
+
+// decodeDataURL rozkłada data URL w formacie data:<typ>;base64,<dane>
+func decodeDataURL(dataURL string) (string, []byte, error) {
+	meta, encoded, ok := strings.Cut(strings.TrimPrefix(dataURL, "data:"), ",")
+	contentType, isBase64 := strings.CutSuffix(meta, ";base64")
+	if !ok || !isBase64 || !strings.HasPrefix(dataURL, "data:") {
+		return "", nil, fmt.Errorf("nieprawidłowy data URL")
+	}
+	data, err := base64.StdEncoding.DecodeString(encoded)
+	if err != nil {
+		return "", nil, fmt.Errorf("nieprawidłowe dane base64: %w", err)
+	}
+	return contentType, data, nil
+}
@@ -0,0 +1,48 @@
+package wailsbridge
+
+import (
+	"execp2p/internal/diagnostics"
+)
+
+// GetMetrics zwraca metryki całej aplikacji: liczniki, bieżące wartości
+// (połączeni uczestnicy, aktywne pokoje), przesłane bajty, czas nawiązywania
+// połączenia i skuteczność poszczególnych metod wykrywania. To samo demon
+// udostępnia na /metrics (--metrics-listen).
+func (b *Bridge) GetMetrics() map[string]interface{} {
+	snap := b.room().GetDiagnostics()
+	latency := snap.ConnectLatency
+
+	return map[string]interface{}{
+		"uptime_seconds":    snap.UptimeSeconds,
+		"counters":          snap.Counters,
+		"gauges":            snap.Gauges,
+		"bytes_sent":        snap.Counters[diagnostics.BytesSent],
+		"bytes_received":    snap.Counters[diagnostics.BytesReceived],
+		"messages_sent":     snap.Counters[diagnostics.MessageSent],
+		"messages_received": snap.Counters[diagnostics.MessageReceived],
+		"handshakes":        snap.HandshakeSuccesses,
+		"key_rotations":     snap.Counters[diagnostics.KeyRotation],
+		"connect_latency": map[string]interface{}{
+			"count":   latency.Count,
+			"average": latency.Average(),
+			"max":     latency.Max,
+		},
+		"join_methods":      methodStatsMaps(snap.JoinMethods),
+		"discovery_methods": methodStatsMaps(snap.DiscoveryMethods),
+	}
+}
+
+// methodStatsMaps zamienia statystyki metod na mapy dla frontendu
+func methodStatsMaps(stats []diagnostics.MethodStats) []map[string]interface{} {
+	list := make([]map[string]interface{}, 0, len(stats))
+	for _, m := range stats {
+		list = append(list, map[string]interface{}{
+			"method":       m.Method,
+			"attempts":     m.Attempts,
+			"successes":    m.Successes,
+			"failures":     m.Failures,
+			"success_rate": m.SuccessRate,
+		})
+	}
+	return list
+}
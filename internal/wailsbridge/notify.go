@@ -0,0 +1,89 @@
+package wailsbridge
+
+import (
+	"strings"
+	"unicode/utf8"
+
+	"execp2p/internal/app"
+	"execp2p/internal/config"
+	"execp2p/internal/crypto"
+)
+
+// najdłuższy podgląd wiadomości w powiadomieniu, w znakach
+const notificationPreviewLength = 120
+
+// SetWindowFocused przekazuje, czy okno jest na wierzchu; powiadomienia
+// systemowe pokazujemy tylko, gdy nie jest. Po powrocie na wierzch wybrany
+// pokój jest przeczytany.
+func (b *Bridge) SetWindowFocused(focused bool) {
+	b.background.Store(!focused)
+	if focused {
+		b.attentionRequested.Store(false)
+		b.readActiveRoom()
+	}
+}
+
+// GetNotificationSettings zwraca ustawienia powiadomień systemowych:
+// enabled, hide_preview, muted_rooms i available (czy system je obsługuje)
+func (b *Bridge) GetNotificationSettings() map[string]interface{} {
+	n := b.execp2p.NotificationSettings()
+	return map[string]interface{}{
+		"enabled":      n.Enabled,
+		"hide_preview": n.HidePreview,
+		"muted_rooms":  n.MutedRooms,
+		"available":    b.notifier != nil,
+	}
+}
+
+// SetNotifications włącza lub wyłącza powiadomienia i ich podgląd, od razu
+// i w pliku konfiguracji
+func (b *Bridge) SetNotifications(enabled bool, hidePreview bool) error {
+	return b.execp2p.SetNotifications(enabled, hidePreview)
+}
+
+// SetRoomMuted wycisza lub przywraca powiadomienia pokoju, od razu i w
+// pliku konfiguracji
+func (b *Bridge) SetRoomMuted(roomID string, muted bool) error {
+	return b.execp2p.SetRoomMuted(roomID, muted)
+}
+
+// notifyMessage pokazuje powiadomienie o wiadomości, gdy okno jest w tle,
+// a pokój nie jest wyciszony
+func (b *Bridge) notifyMessage(s *app.ExecP2P, msg *crypto.MessagePayload, messageType, content string) {
+	if b.notifier == nil || !b.background.Load() {
+		return
+	}
+	r := s.GetRoomInfo()
+	if r == nil || !b.execp2p.ShouldNotify(r.ID) {
+		return
+	}
+	title := s.DisplayName(msg.SenderID)
+	if r.Name != "" {
+		title += " · " + r.Name
+	}
+	b.notifier.Notify(title, notificationBody(b.execp2p.NotificationSettings(), messageType, content))
+}
+
+// notificationBody zwraca treść powiadomienia: skrócony podgląd wiadomości
+// albo, gdy podgląd jest ukryty, samą informację o niej
+func notificationBody(n config.NotificationsConfig, messageType, content string) string {
+	if n.HidePreview {
+		return "Nowa wiadomość"
+	}
+	switch messageType {
+	case "image":
+		return "Zdjęcie"
+	case "gif":
+		return "GIF"
+	case "audio":
+		return "Wiadomość głosowa"
+	case "file":
+		return "Plik"
+	}
+	// jedna linia, bez nadmiaru odstępów
+	preview := strings.Join(strings.Fields(content), " ")
+	if utf8.RuneCountInString(preview) > notificationPreviewLength {
+		preview = string([]rune(preview)[:notificationPreviewLength-1]) + "…"
+	}
+	return preview
+}
@@ -0,0 +1,170 @@
+package wailsbridge
+
+import (
+	"errors"
+	"fmt"
+
+	"execp2p/internal/app"
+	"execp2p/internal/rejoin"
+	"execp2p/internal/types"
+
+	"github.com/wailsapp/wails/v2/pkg/runtime"
+)
+
+// roomID zwraca ID pokoju sesji, pusty poza pokojem
+func roomID(s *app.ExecP2P) string {
+	if r := s.GetRoomInfo(); r != nil {
+		return r.ID
+	}
+	return ""
+}
+
+// room zwraca sesję pokoju wybranego w interfejsie; gdy go opuściliśmy,
+// pierwszą z pozostałych
+func (b *Bridge) room() *app.ExecP2P {
+	b.mu.Lock()
+	active := b.activeRoom
+	b.mu.Unlock()
+
+	sessions := b.execp2p.Sessions()
+	for _, s := range sessions {
+		if roomID(s) == active {
+			return s
+		}
+	}
+	if len(sessions) > 0 {
+		return sessions[0]
+	}
+	return b.execp2p
+}
+
+// enter tworzy pokój albo dołącza do niego we własnej sesji, obok pokojów,
+// w których już jesteśmy, i wybiera go w interfejsie
+func (b *Bridge) enter(join func(s *app.ExecP2P) error) error {
+	s, err := b.execp2p.OpenSession()
+	if err != nil {
+		return err
+	}
+	if err := join(s); err != nil {
+		if s != b.execp2p {
+			s.Close()
+		}
+		return err
+	}
+	// wiadomości pierwszej sesji odbiera monitorMessages
+	if s != b.execp2p {
+		go b.watchMessages(b.ctx, s)
+	}
+	b.selectSession(s)
+	return nil
+}
+
+// ListRooms zwraca pokoje, w których jesteśmy
+func (b *Bridge) ListRooms() []types.RoomSummary {
+	if b.execp2p == nil {
+		return []types.RoomSummary{}
+	}
+	active := roomID(b.room())
+	sessions := b.execp2p.Sessions()
+	rooms := make([]types.RoomSummary, 0, len(sessions))
+	for _, s := range sessions {
+		status := s.GetNetworkStatus()
+		rooms = append(rooms, types.RoomSummary{
+			RoomID:         status.RoomID,
+			RoomName:       status.RoomName,
+			IsListener:     status.IsListener,
+			Incognito:      s.IsIncognito(),
+			ConnectedPeers: status.ConnectedPeers,
+			Unread:         s.UnreadCount(),
+			Active:         status.RoomID == active,
+		})
+	}
+	return rooms
+}
+
+// SelectRoom wybiera pokój, którego dotyczą wywołania i zdarzenia
+// interfejsu (czat, uczestnicy, status)
+func (b *Bridge) SelectRoom(roomID string) error {
+	s, ok := b.execp2p.Session(roomID)
+	if !ok {
+		return fmt.Errorf("nie jesteśmy w pokoju %s", roomID)
+	}
+	b.selectSession(s)
+	return nil
+}
+
+// LeaveRoom opuszcza jeden z naszych pokojów; pozostałe działają dalej.
+// Po opuszczeniu ostatniego wracamy do ekranu łączenia bez restartu.
+func (b *Bridge) LeaveRoom(roomID string) error {
+	s, ok := b.execp2p.Session(roomID)
+	if !ok {
+		return fmt.Errorf("nie jesteśmy w pokoju %s", roomID)
+	}
+	s.LeaveRoom()
+	b.roomGone(roomID)
+	return nil
+}
+
+// RejoinRooms wchodzi ponownie do pokojów, w których byliśmy przy
+// zamknięciu aplikacji (room.rejoin): utworzone przez nas hostuje znowu, do
+// pozostałych dołącza. Do pokojów, których gospodarza nie udało się
+// znaleźć, wchodzi w tle, gdy tylko się znajdzie. Frontend wywołuje ją po
+// starcie; kolejne wywołania nic nie robią.
+func (b *Bridge) RejoinRooms() error {
+	if b.execp2p == nil {
+		return fmt.Errorf("bridge nie zainicjalizowany")
+	}
+	var errs []error
+	b.rejoinOnce.Do(func() {
+		enterRoom := func(r rejoin.Room) error {
+			return b.enter(func(s *app.ExecP2P) error { return s.Rejoin(b.ctx, r) })
+		}
+		var later []rejoin.Room
+		for _, r := range b.execp2p.RoomsToRejoin() {
+			if err := enterRoom(r); err != nil {
+				errs = append(errs, fmt.Errorf("pokój %s: %w", r.RoomID, err))
+				later = append(later, r)
+			}
+		}
+		go b.execp2p.RejoinLater(b.ctx, later, enterRoom)
+	})
+	return errors.Join(errs...)
+}
+
+// selectSession wybiera sesję w interfejsie i od razu podaje jej status
+func (b *Bridge) selectSession(s *app.ExecP2P) {
+	id := roomID(s)
+	b.mu.Lock()
+	b.activeRoom = id
+	b.mu.Unlock()
+	if b.ctx == nil {
+		return
+	}
+	runtime.EventsEmit(b.ctx, EventRoomSelected, id)
+	runtime.EventsEmit(b.ctx, EventStatusUpdate, s.GetNetworkStatus())
+	runtime.EventsEmit(b.ctx, EventUsersUpdate, s.GetPeers())
+	// podaje też listę pokojów
+	b.readActiveRoom()
+}
+
+// roomGone przełącza interfejs po opuszczeniu pokoju: na inny z naszych
+// pokojów albo, gdy żadnego nie ma, z powrotem do ekranu łączenia
+func (b *Bridge) roomGone(roomID string) {
+	if b.ctx == nil {
+		return
+	}
+	if len(b.execp2p.Sessions()) == 0 {
+		b.unreadChanged()
+		runtime.EventsEmit(b.ctx, EventRoomsUpdate, []types.RoomSummary{})
+		runtime.EventsEmit(b.ctx, "room:left")
+		return
+	}
+	b.mu.Lock()
+	wasActive := b.activeRoom == roomID
+	b.mu.Unlock()
+	if wasActive {
+		b.selectSession(b.room())
+		return
+	}
+	b.unreadChanged()
+}
@@ -0,0 +1,72 @@
+package wailsbridge
+
+import (
+	"context"
+	"fmt"
+
+	"execp2p/internal/app"
+	"execp2p/internal/crash"
+
+	"github.com/wailsapp/wails/v2/pkg/runtime"
+)
+
+// GetTransfers zwraca trwające transfery (pliki, multimedia, synchronizacja
+// historii)
+func (b *Bridge) GetTransfers() []map[string]interface{} {
+	if b.execp2p == nil {
+		return []map[string]interface{}{}
+	}
+	list := b.room().Transfers()
+	out := make([]map[string]interface{}, 0, len(list))
+	for _, t := range list {
+		out = append(out, transferData(t))
+	}
+	return out
+}
+
+// CancelTransfer przerywa transfer po obu stronach; wynik przychodzi
+// zdarzeniem transfer:complete z polem canceled
+func (b *Bridge) CancelTransfer(id string) error {
+	if b.execp2p == nil {
+		return fmt.Errorf("brak połączenia")
+	}
+	return b.room().CancelTransfer(id)
+}
+
+// monitorTransfers przekazuje frontendowi postęp i wynik transferów
+func (b *Bridge) monitorTransfers(ctx context.Context) {
+	defer crash.Recover("wailsbridge.monitorTransfers")
+	if b.execp2p == nil || b.ctx == nil {
+		return
+	}
+
+	notices := b.execp2p.TransferNotices()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case t := <-notices:
+			data := transferData(t)
+			if !t.Done {
+				runtime.EventsEmit(b.ctx, EventTransferProgress, data)
+				continue
+			}
+			data["canceled"] = t.Canceled()
+			if t.Err != nil {
+				data["error"] = t.Err.Error()
+			}
+			runtime.EventsEmit(b.ctx, EventTransferComplete, data)
+		}
+	}
+}
+
+func transferData(t app.Transfer) map[string]interface{} {
+	return map[string]interface{}{
+		"id":        t.ID,
+		"kind":      t.Kind,
+		"direction": t.Direction,
+		"name":      t.Name,
+		"bytes":     t.Bytes,
+		"total":     t.Total,
+	}
+}
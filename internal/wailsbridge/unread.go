@@ -0,0 +1,94 @@
+package wailsbridge
+
+import (
+	"errors"
+	"fmt"
+
+	"execp2p/internal/app"
+	"execp2p/internal/logger"
+	"execp2p/internal/platform"
+
+	"github.com/wailsapp/wails/v2/pkg/runtime"
+)
+
+// tytuł okna bez liczby nieprzeczytanych wiadomości
+const windowTitle = "ExecP2P"
+
+// MarkRoomRead oznacza wszystkie wiadomości pokoju jako przeczytane
+func (b *Bridge) MarkRoomRead(roomID string) error {
+	s, ok := b.execp2p.Session(roomID)
+	if !ok {
+		return fmt.Errorf("nie jesteśmy w pokoju %s", roomID)
+	}
+	s.MarkRead()
+	b.unreadChanged()
+	return nil
+}
+
+// GetUnreadCount zwraca liczbę nieprzeczytanych wiadomości we wszystkich
+// naszych pokojach; liczby poszczególnych pokojów podaje ListRooms
+func (b *Bridge) GetUnreadCount() int {
+	total := 0
+	for _, s := range b.execp2p.Sessions() {
+		total += s.UnreadCount()
+	}
+	return total
+}
+
+// messageRead zajmuje się wiadomością przekazaną do frontendu: w pokoju,
+// który mamy przed oczami, jest od razu przeczytana; w pozostałych
+// zwiększa licznik, a przy zminimalizowanym oknie prosi o uwagę
+func (b *Bridge) messageRead(s *app.ExecP2P) {
+	if !b.background.Load() && roomID(s) == roomID(b.room()) {
+		s.MarkRead()
+		return
+	}
+	b.unreadChanged()
+	b.requestAttention()
+}
+
+// readActiveRoom oznacza wybrany pokój jako przeczytany, gdy okno jest na
+// wierzchu
+func (b *Bridge) readActiveRoom() {
+	if !b.background.Load() {
+		b.room().MarkRead()
+	}
+	b.unreadChanged()
+}
+
+// unreadChanged pokazuje liczbę nieprzeczytanych wiadomości w tytule okna,
+// na ikonie w Docku (macOS) i na liście pokojów
+func (b *Bridge) unreadChanged() {
+	if b.ctx == nil {
+		return
+	}
+	total := b.GetUnreadCount()
+	title := windowTitle
+	if total > 0 {
+		title = fmt.Sprintf("(%d) %s", total, windowTitle)
+	}
+	b.mu.Lock()
+	changed := title != b.title
+	b.title = title
+	b.mu.Unlock()
+	if changed {
+		runtime.WindowSetTitle(b.ctx, title)
+		if err := platform.SetBadge(total); err != nil && !errors.Is(err, errors.ErrUnsupported) {
+			logger.L().Debug("Failed to set the unread badge", "err", err)
+		}
+	}
+	runtime.EventsEmit(b.ctx, EventRoomsUpdate, b.ListRooms())
+}
+
+// requestAttention miga przyciskiem na pasku zadań (Windows, X11) albo
+// podskakuje ikoną w Docku (macOS), gdy okno jest zminimalizowane; raz, aż
+// okno wróci na wierzch
+func (b *Bridge) requestAttention() {
+	if !b.background.Load() || b.attentionRequested.Load() || !runtime.WindowIsMinimised(b.ctx) {
+		return
+	}
+	b.attentionRequested.Store(true)
+	if err := platform.RequestAttention(); err != nil && !errors.Is(err, errors.ErrUnsupported) {
+		logger.L().Debug("Failed to request window attention", "err", err)
+	}
+}
@@ -0,0 +1,175 @@
+// Package webhook posts room events (delivered messages, peers connecting
+// and leaving) as JSON to a URL on this machine, so other tools can react to
+// them. Only loopback URLs are accepted: the payloads carry decrypted
+// messages, which must not leave the machine.
+//
+// With a secret, every request carries the HMAC-SHA256 of its body in the
+// X-ExecP2P-Signature header ("sha256=<hex>"). The body holds the event time,
+// so receivers can also reject replays.
+package webhook
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"time"
+
+	"execp2p/internal/crash"
+	"execp2p/internal/logger"
+)
+
+// event names
+const (
+	EventMessage          = "message"
+	EventPeerConnected    = "peer_connected"
+	EventPeerDisconnected = "peer_disconnected"
+)
+
+const (
+	// events waiting to be posted; newer ones are dropped when it is full
+	queueSize = 256
+	// how long one POST may take
+	requestTimeout = 5 * time.Second
+	// SignatureHeader carries the HMAC of the body when a secret is set
+	SignatureHeader = "X-ExecP2P-Signature"
+	// EventHeader names the event, also found in the body
+	EventHeader = "X-ExecP2P-Event"
+)
+
+// Options configures the webhook; an empty URL disables it
+type Options struct {
+	URL string
+	// key of the HMAC signature, empty sends unsigned requests
+	Secret string
+}
+
+// Payload is the JSON body of a request
+type Payload struct {
+	Event  string      `json:"event"`
+	Time   time.Time   `json:"time"`
+	RoomID string      `json:"room_id"`
+	Data   interface{} `json:"data"`
+}
+
+// Message is the data of a message event
+type Message struct {
+	MessageID  string    `json:"message_id"`
+	SenderID   string    `json:"sender_id"`
+	SenderName string    `json:"sender_name"`
+	Timestamp  time.Time `json:"timestamp"`
+	// as sent: plain text or the frontends' JSON ({"type", "content", ...})
+	Message string `json:"message"`
+}
+
+// Peer is the data of peer events
+type Peer struct {
+	PeerID      string `json:"peer_id"`
+	Name        string `json:"name"`
+	Fingerprint string `json:"fingerprint,omitempty"`
+}
+
+// Hook posts events in the background, one at a time and in order
+type Hook struct {
+	url    string
+	secret []byte
+	client *http.Client
+	queue  chan Payload
+	done   chan struct{}
+}
+
+// New checks the URL and starts posting
+func New(opts Options) (*Hook, error) {
+	u, err := url.Parse(opts.URL)
+	if err != nil {
+		return nil, fmt.Errorf("invalid webhook URL: %w", err)
+	}
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return nil, fmt.Errorf("webhook URL must be http or https, not %q", u.Scheme)
+	}
+	host := u.Hostname()
+	if ip := net.ParseIP(host); host != "localhost" && (ip == nil || !ip.IsLoopback()) {
+		return nil, fmt.Errorf("webhook URL must point to this machine (localhost or a loopback address), not %s", host)
+	}
+
+	h := &Hook{
+		url:    u.String(),
+		secret: []byte(opts.Secret),
+		client: &http.Client{
+			Timeout: requestTimeout,
+			// a redirect could send the payload elsewhere
+			CheckRedirect: func(*http.Request, []*http.Request) error { return http.ErrUseLastResponse },
+		},
+		queue: make(chan Payload, queueSize),
+		done:  make(chan struct{}),
+	}
+	go h.run()
+	return h, nil
+}
+
+// Send queues an event without blocking
+func (h *Hook) Send(event, roomID string, data interface{}) {
+	select {
+	case h.queue <- Payload{Event: event, Time: time.Now().UTC(), RoomID: roomID, Data: data}:
+	default:
+		logger.L().Warn("Webhook is not keeping up; event dropped", "event", event)
+	}
+}
+
+// Close posts what is queued and stops
+func (h *Hook) Close() {
+	close(h.queue)
+	<-h.done
+}
+
+func (h *Hook) run() {
+	defer crash.Recover("webhook.run")
+	defer close(h.done)
+	for p := range h.queue {
+		if err := h.post(p); err != nil {
+			logger.L().Warn("Webhook request failed", "event", p.Event, "err", err)
+		}
+	}
+}
+
+func (h *Hook) post(p Payload) error {
+	body, err := json.Marshal(p)
+	if err != nil {
+		return err
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), requestTimeout)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, h.url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "ExecP2P-Webhook")
+	req.Header.Set(EventHeader, p.Event)
+	if len(h.secret) > 0 {
+		req.Header.Set(SignatureHeader, Sign(h.secret, body))
+	}
+
+	resp, err := h.client.Do(req)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("webhook answered %s", resp.Status)
+	}
+	return nil
+}
+
+// Sign returns the signature header value of body
+func Sign(secret, body []byte) string {
+	mac := hmac.New(sha256.New, secret)
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
@@ -0,0 +1,381 @@
+package wire
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"math/bits"
+	"time"
+	"unicode/utf8"
+)
+
+// maxDepth is how deeply arrays and maps may nest, including in skipped
+// values
+const maxDepth = 16
+
+// Decoder reads CBOR items from a stream, never past the end of the item
+// it was asked for, so what follows a frame stays in the stream
+type Decoder struct {
+	r     io.Reader
+	limit int64
+	off   int64
+	depth int
+	// a head read by Null that was not null
+	peeked   bool
+	peekByte byte
+	scratch  [8]byte
+}
+
+// NewDecoder reads at most limit bytes from r
+func NewDecoder(r io.Reader, limit int64) *Decoder {
+	return &Decoder{r: r, limit: limit}
+}
+
+// Offset returns how many bytes were read
+func (d *Decoder) Offset() int64 {
+	return d.off
+}
+
+func (d *Decoder) errorf(format string, args ...any) error {
+	return fmt.Errorf("%w at byte %d: %s", ErrMalformed, d.off, fmt.Sprintf(format, args...))
+}
+
+// read fills p from the stream within the limit
+func (d *Decoder) read(p []byte) error {
+	if int64(len(p)) > d.limit-d.off {
+		return d.errorf("frame exceeds %d bytes", d.limit)
+	}
+	n, err := io.ReadFull(d.r, p)
+	d.off += int64(n)
+	if errors.Is(err, io.ErrUnexpectedEOF) || (errors.Is(err, io.EOF) && d.off > 0) {
+		return d.errorf("truncated")
+	}
+	return err
+}
+
+func (d *Decoder) readByte() (byte, error) {
+	if d.peeked {
+		d.peeked = false
+		return d.peekByte, nil
+	}
+	if err := d.read(d.scratch[:1]); err != nil {
+		return 0, err
+	}
+	return d.scratch[0], nil
+}
+
+// head reads the head of the next item: its major type and argument. The
+// argument of a simple value is the value itself.
+func (d *Decoder) head() (byte, uint64, error) {
+	first, err := d.readByte()
+	if err != nil {
+		return 0, 0, err
+	}
+	major, info := first>>5, first&0x1f
+	var size int
+	switch {
+	case info < 24:
+		return major, uint64(info), nil
+	case info == 24:
+		size = 1
+	case info == 25:
+		size = 2
+	case info == 26:
+		size = 4
+	case info == 27:
+		size = 8
+	default:
+		// indefinite lengths and reserved values are not deterministic
+		return 0, 0, d.errorf("unsupported additional info %d", info)
+	}
+	buf := d.scratch[:size]
+	if err := d.read(buf); err != nil {
+		return 0, 0, err
+	}
+	var v uint64
+	for _, c := range buf {
+		v = v<<8 | uint64(c)
+	}
+	if major == majorOther {
+		// floats have no place in frames
+		return 0, 0, d.errorf("unsupported simple value")
+	}
+	// the shortest form only
+	if (size == 1 && v < 24) || (size > 1 && v>>(4*size) == 0) {
+		return 0, 0, d.errorf("non-minimal integer")
+	}
+	return major, v, nil
+}
+
+// expect reads the head of an item of major type m
+func (d *Decoder) expect(m byte, what string) (uint64, error) {
+	major, v, err := d.head()
+	if err != nil {
+		return 0, err
+	}
+	if major != m {
+		return 0, d.errorf("%s expected, major type %d found", what, major)
+	}
+	return v, nil
+}
+
+// Null consumes a null and reports true if the next item is one
+func (d *Decoder) Null() (bool, error) {
+	first, err := d.readByte()
+	if err != nil {
+		return false, err
+	}
+	if first == majorOther<<5|simpleNull {
+		return true, nil
+	}
+	d.peeked, d.peekByte = true, first
+	return false, nil
+}
+
+// MapHeader starts a map and returns its number of pairs
+func (d *Decoder) MapHeader() (int, error) {
+	n, err := d.expect(majorMap, "map")
+	if err != nil {
+		return 0, err
+	}
+	return d.count(n)
+}
+
+// ArrayHeader starts an array and returns its number of items
+func (d *Decoder) ArrayHeader() (int, error) {
+	n, err := d.expect(majorArray, "array")
+	if err != nil {
+		return 0, err
+	}
+	return d.count(n)
+}
+
+// count checks a number of items against what is left to read, at least
+// a byte each
+func (d *Decoder) count(n uint64) (int, error) {
+	if n > uint64(d.limit-d.off) {
+		return 0, d.errorf("%d items exceed the frame", n)
+	}
+	return int(n), nil
+}
+
+// Enter and Leave bracket the items of a map or array
+func (d *Decoder) Enter() error {
+	if d.depth++; d.depth > maxDepth {
+		return d.errorf("nested deeper than %d", maxDepth)
+	}
+	return nil
+}
+
+func (d *Decoder) Leave() {
+	d.depth--
+}
+
+// MapKey reads the next key of a map; keys must be unsigned integers in
+// ascending order, last being the previous one or -1
+func (d *Decoder) MapKey(last *int64) (uint64, error) {
+	k, err := d.expect(majorUint, "integer key")
+	if err != nil {
+		return 0, err
+	}
+	if k > math.MaxInt64 || int64(k) <= *last {
+		return 0, d.errorf("key %d out of order", k)
+	}
+	*last = int64(k)
+	return k, nil
+}
+
+// Uint reads an unsigned integer not above max
+func (d *Decoder) Uint(max uint64) (uint64, error) {
+	v, err := d.expect(majorUint, "unsigned integer")
+	if err != nil {
+		return 0, err
+	}
+	if v > max {
+		return 0, d.errorf("%d exceeds %d", v, max)
+	}
+	return v, nil
+}
+
+// Int reads an integer within [min, max]
+func (d *Decoder) Int(min, max int64) (int64, error) {
+	major, v, err := d.head()
+	if err != nil {
+		return 0, err
+	}
+	var n int64
+	switch {
+	case major == majorUint && v <= math.MaxInt64:
+		n = int64(v)
+	case major == majorNeg && v <= math.MaxInt64:
+		n = -1 - int64(v)
+	case major == majorUint || major == majorNeg:
+		return 0, d.errorf("integer out of range")
+	default:
+		return 0, d.errorf("integer expected, major type %d found", major)
+	}
+	if n < min || n > max {
+		return 0, d.errorf("%d out of range [%d, %d]", n, min, max)
+	}
+	return n, nil
+}
+
+// payload reads the n bytes of a string
+func (d *Decoder) payload(n uint64) ([]byte, error) {
+	if n > uint64(d.limit-d.off) {
+		return nil, d.errorf("string of %d bytes exceeds the frame", n)
+	}
+	buf := make([]byte, n)
+	if err := d.read(buf); err != nil {
+		return nil, err
+	}
+	return buf, nil
+}
+
+// Bytes reads a byte string; null reads as nil
+func (d *Decoder) Bytes() ([]byte, error) {
+	if null, err := d.Null(); err != nil || null {
+		return nil, err
+	}
+	n, err := d.expect(majorBytes, "byte string")
+	if err != nil {
+		return nil, err
+	}
+	return d.payload(n)
+}
+
+// StringBytes reads a byte string into a string
+func (d *Decoder) StringBytes() (string, error) {
+	n, err := d.expect(majorBytes, "byte string")
+	if err != nil {
+		return "", err
+	}
+	buf, err := d.payload(n)
+	return string(buf), err
+}
+
+// Text reads a text string
+func (d *Decoder) Text() (string, error) {
+	n, err := d.expect(majorText, "text string")
+	if err != nil {
+		return "", err
+	}
+	buf, err := d.payload(n)
+	if err != nil {
+		return "", err
+	}
+	if !utf8.Valid(buf) {
+		return "", d.errorf("text string is not UTF-8")
+	}
+	return string(buf), nil
+}
+
+// Bool reads a boolean
+func (d *Decoder) Bool() (bool, error) {
+	first, err := d.readByte()
+	if err != nil {
+		return false, err
+	}
+	switch first {
+	case majorOther<<5 | simpleFalse:
+		return false, nil
+	case majorOther<<5 | simpleTrue:
+		return true, nil
+	}
+	return false, d.errorf("boolean expected")
+}
+
+// Time reads an RFC 3339 date (tag 0)
+func (d *Decoder) Time() (time.Time, error) {
+	tag, err := d.expect(majorTag, "date")
+	if err != nil {
+		return time.Time{}, err
+	}
+	if tag != tagDateTime {
+		return time.Time{}, d.errorf("tag %d instead of a date", tag)
+	}
+	s, err := d.Text()
+	if err != nil {
+		return time.Time{}, err
+	}
+	t, err := time.Parse(time.RFC3339Nano, s)
+	if err != nil {
+		return time.Time{}, d.errorf("invalid date %.40q", s)
+	}
+	return t, nil
+}
+
+// Skip reads past the next item, e.g. the value of a key we don't know
+func (d *Decoder) Skip() error {
+	major, v, err := d.head()
+	if err != nil {
+		return err
+	}
+	switch major {
+	case majorBytes, majorText:
+		if v > uint64(d.limit-d.off) {
+			return d.errorf("string of %d bytes exceeds the frame", v)
+		}
+		// discard in pieces without holding the string
+		for v > 0 {
+			n := min(v, uint64(len(d.scratch)))
+			if err := d.read(d.scratch[:n]); err != nil {
+				return err
+			}
+			v -= n
+		}
+	case majorArray, majorMap:
+		n, err := d.count(v)
+		if err != nil {
+			return err
+		}
+		if major == majorMap {
+			n *= 2
+		}
+		if err := d.Enter(); err != nil {
+			return err
+		}
+		defer d.Leave()
+		for i := 0; i < n; i++ {
+			if err := d.Skip(); err != nil {
+				return err
+			}
+		}
+	case majorTag:
+		if err := d.Enter(); err != nil {
+			return err
+		}
+		defer d.Leave()
+		return d.Skip()
+	}
+	return nil
+}
+
+// Missing is returned by generated decoders for a frame lacking keys the
+// schema requires; keys are bits of a mask, the key being the bit's index
+func (d *Decoder) Missing(frame string, required, seen uint64) error {
+	return d.errorf("%s without key %d", frame, bits.TrailingZeros64(required&^seen))
+}
+
+// DecodeArray reads an array, each item with decode; an empty one reads as
+// nil
+func DecodeArray[T any](d *Decoder, decode func(*Decoder, *T) error) ([]T, error) {
+	n, err := d.ArrayHeader()
+	if err != nil {
+		return nil, err
+	}
+	if err := d.Enter(); err != nil {
+		return nil, err
+	}
+	defer d.Leave()
+	var items []T
+	for i := 0; i < n; i++ {
+		var item T
+		if err := decode(d, &item); err != nil {
+			return nil, err
+		}
+		items = append(items, item)
+	}
+	return items, nil
+}
@@ -0,0 +1,119 @@
+package wire
+
+import (
+	"encoding/binary"
+	"time"
+	"unicode/utf8"
+)
+
+// CBOR major types
+const (
+	majorUint  = 0
+	majorNeg   = 1
+	majorBytes = 2
+	majorText  = 3
+	majorArray = 4
+	majorMap   = 5
+	majorTag   = 6
+	majorOther = 7
+)
+
+// simple values and the tag of an RFC 3339 date
+const (
+	simpleFalse = 20
+	simpleTrue  = 21
+	simpleNull  = 22
+	tagDateTime = 0
+)
+
+// appendHead appends the head of an item of major type m with argument v,
+// in its shortest form
+func appendHead(b []byte, m byte, v uint64) []byte {
+	m <<= 5
+	switch {
+	case v < 24:
+		return append(b, m|byte(v))
+	case v <= 0xff:
+		return append(b, m|24, byte(v))
+	case v <= 0xffff:
+		return binary.BigEndian.AppendUint16(append(b, m|25), uint16(v))
+	case v <= 0xffffffff:
+		return binary.BigEndian.AppendUint32(append(b, m|26), uint32(v))
+	}
+	return binary.BigEndian.AppendUint64(append(b, m|27), v)
+}
+
+// AppendMapHeader starts a map of n pairs
+func AppendMapHeader(b []byte, n int) []byte {
+	return appendHead(b, majorMap, uint64(n))
+}
+
+// AppendArrayHeader starts an array of n items
+func AppendArrayHeader(b []byte, n int) []byte {
+	return appendHead(b, majorArray, uint64(n))
+}
+
+// AppendUint appends an unsigned integer
+func AppendUint(b []byte, v uint64) []byte {
+	return appendHead(b, majorUint, v)
+}
+
+// AppendInt appends a signed integer
+func AppendInt(b []byte, v int64) []byte {
+	if v < 0 {
+		return appendHead(b, majorNeg, uint64(-1-v))
+	}
+	return appendHead(b, majorUint, uint64(v))
+}
+
+// AppendBytes appends a byte string, or null for a nil slice so that nil
+// and empty stay apart
+func AppendBytes(b []byte, v []byte) []byte {
+	if v == nil {
+		return AppendNull(b)
+	}
+	return append(appendHead(b, majorBytes, uint64(len(v))), v...)
+}
+
+// AppendStringBytes appends s as a byte string
+func AppendStringBytes(b []byte, s string) []byte {
+	return append(appendHead(b, majorBytes, uint64(len(s))), s...)
+}
+
+// AppendText appends a text string. Like encoding/json, it replaces every
+// byte of s that is not UTF-8 with U+FFFD.
+func AppendText(b []byte, s string) []byte {
+	if !utf8.ValidString(s) {
+		var valid []byte
+		for i := 0; i < len(s); {
+			r, size := utf8.DecodeRuneInString(s[i:])
+			if r == utf8.RuneError && size == 1 {
+				valid = utf8.AppendRune(valid, utf8.RuneError)
+			} else {
+				valid = append(valid, s[i:i+size]...)
+			}
+			i += size
+		}
+		s = string(valid)
+	}
+	return append(appendHead(b, majorText, uint64(len(s))), s...)
+}
+
+// AppendBool appends a boolean
+func AppendBool(b []byte, v bool) []byte {
+	if v {
+		return append(b, majorOther<<5|simpleTrue)
+	}
+	return append(b, majorOther<<5|simpleFalse)
+}
+
+// AppendNull appends null
+func AppendNull(b []byte) []byte {
+	return append(b, majorOther<<5|simpleNull)
+}
+
+// AppendTime appends t as an RFC 3339 date (tag 0), written exactly as its
+// JSON encoding so that signatures over the JSON form still verify
+func AppendTime(b []byte, t time.Time) []byte {
+	return AppendText(appendHead(b, majorTag, tagDateTime), t.Format(time.RFC3339Nano))
+}
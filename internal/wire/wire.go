@@ -0,0 +1,82 @@
+// Package wire encodes the frames peers exchange, as described by the
+// schema in frames.cddl.
+//
+// Frames have two encodings. JSON is what every version of the protocol
+// speaks; CBOR (RFC 8949) is used once both sides agreed on protocol
+// version 2. The CBOR form of a frame is a map with small unsigned integer
+// keys, encoded deterministically: shortest lengths, definite lengths and
+// keys in ascending order. Keys a decoder doesn't know are skipped, so
+// fields can be added without a new version.
+//
+// The CBOR methods of the frame types are generated from the schema by
+// wiregen (go generate); the schema is what a client in another language
+// implements.
+package wire
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+)
+
+// Format is an encoding of frames
+type Format int
+
+const (
+	JSON Format = iota
+	CBOR
+)
+
+func (f Format) String() string {
+	if f == CBOR {
+		return "cbor"
+	}
+	return "json"
+}
+
+// Codec is a frame type of the schema; its methods are generated
+type Codec interface {
+	// AppendCBOR appends the CBOR encoding of the frame to b
+	AppendCBOR(b []byte) []byte
+	// DecodeCBOR reads the frame from d
+	DecodeCBOR(d *Decoder) error
+}
+
+// ErrMalformed is wrapped by every CBOR decoding error
+var ErrMalformed = errors.New("malformed CBOR")
+
+// Marshal encodes v in f
+func Marshal(v Codec, f Format) ([]byte, error) {
+	if f == CBOR {
+		return v.AppendCBOR(nil), nil
+	}
+	return json.Marshal(v)
+}
+
+// Unmarshal decodes data into v in whichever format it is in: a JSON frame
+// is an object and starts with '{', a CBOR one is a map
+func Unmarshal(data []byte, v Codec) error {
+	if len(data) > 0 && data[0] == '{' {
+		return json.Unmarshal(data, v)
+	}
+	d := NewDecoder(bytes.NewReader(data), int64(len(data)))
+	if err := v.DecodeCBOR(d); err != nil {
+		return err
+	}
+	if d.Offset() != int64(len(data)) {
+		return fmt.Errorf("%w: %d bytes after the frame", ErrMalformed, int64(len(data))-d.Offset())
+	}
+	return nil
+}
+
+// Detect returns the format of a frame starting with first
+func Detect(first byte) (Format, bool) {
+	switch {
+	case first == '{':
+		return JSON, true
+	case first>>5 == majorMap:
+		return CBOR, true
+	}
+	return 0, false
+}
@@ -0,0 +1,649 @@
+// Command wiregen generates the CBOR methods of the frame types from the
+// wire schema (internal/wire/frames.cddl). Run by go generate in a package
+// with frame types, it writes wire_gen.go with AppendCBOR and DecodeCBOR
+// for every rule whose "; go:" comment names a type of that package.
+//
+// It understands the part of CDDL the schema uses: maps with unsigned
+// integer keys, optional keys, uint (with .size), int, tstr, bstr, bool,
+// tdate, arrays ([* type]), references to other rules and "/ null". It
+// checks every rule against its Go type: each key must have a field of a
+// matching type, named as in the comment after the key, and each field
+// with a JSON name must have a key, so the two encodings can't drift apart.
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"flag"
+	"fmt"
+	"go/ast"
+	"go/format"
+	"go/parser"
+	"go/token"
+	"os"
+	"path/filepath"
+	"reflect"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// a rule of the schema
+type rule struct {
+	name string
+	// the Go type as pkg.Type
+	goType string
+	keys   []key
+	line   int
+}
+
+// a key of a rule's map
+type key struct {
+	n        uint64
+	optional bool
+	typ      cddlType
+	// the JSON name of the field
+	field string
+	line  int
+}
+
+// a type of the schema
+type cddlType struct {
+	// uint, int, tstr, bstr, bool, tdate, array or rule
+	kind string
+	// .size of a uint, in bytes
+	size int
+	// the element of an array
+	elem *cddlType
+	// the referenced rule
+	ref      string
+	nullable bool
+}
+
+var (
+	ruleStart  = regexp.MustCompile(`^([a-z][a-z0-9-]*)\s*=\s*\{$`)
+	keyLine    = regexp.MustCompile(`^(\?\s*)?(\d+)\s*=>\s*(.+?)\s*,?\s*;\s*([a-z][a-z0-9_]*)$`)
+	goComment  = regexp.MustCompile(`^;\s*go:\s*(\w+)\.(\w+)$`)
+	uintSize   = regexp.MustCompile(`^uint\s+\.size\s+(\d+)$`)
+	arrayOf    = regexp.MustCompile(`^\[\s*\*\s*(.+?)\s*\]$`)
+	schemaPath = flag.String("schema", "../wire/frames.cddl", "the wire schema")
+	outPath    = flag.String("out", "wire_gen.go", "the file to write")
+)
+
+func main() {
+	flag.Parse()
+	rules, err := parseSchema(*schemaPath)
+	if err != nil {
+		fail(err)
+	}
+	pkg, err := loadPackage(".", *outPath)
+	if err != nil {
+		fail(err)
+	}
+	src, err := generate(pkg, rules, filepath.Base(*schemaPath))
+	if err != nil {
+		fail(err)
+	}
+	if err := os.WriteFile(*outPath, src, 0o644); err != nil {
+		fail(err)
+	}
+}
+
+func fail(err error) {
+	fmt.Fprintln(os.Stderr, "wiregen:", err)
+	os.Exit(1)
+}
+
+// parseSchema reads the rules of the schema
+func parseSchema(path string) (map[string]*rule, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	rules := make(map[string]*rule)
+	var current *rule
+	goType := ""
+	scanner := bufio.NewScanner(f)
+	for lineNo := 1; scanner.Scan(); lineNo++ {
+		line := strings.TrimSpace(scanner.Text())
+		errorf := func(format string, args ...any) error {
+			return fmt.Errorf("%s:%d: %s", path, lineNo, fmt.Sprintf(format, args...))
+		}
+		switch {
+		case line == "":
+			if current == nil {
+				goType = ""
+			}
+		case current == nil && strings.HasPrefix(line, ";"):
+			if m := goComment.FindStringSubmatch(line); m != nil {
+				goType = m[1] + "." + m[2]
+			}
+		case current == nil:
+			m := ruleStart.FindStringSubmatch(line)
+			if m == nil {
+				return nil, errorf("a map rule expected")
+			}
+			if goType == "" {
+				return nil, errorf("rule %s has no \"; go:\" comment", m[1])
+			}
+			if rules[m[1]] != nil {
+				return nil, errorf("rule %s defined twice", m[1])
+			}
+			current = &rule{name: m[1], goType: goType, line: lineNo}
+			rules[m[1]] = current
+			goType = ""
+		case line == "}":
+			current = nil
+		case strings.HasPrefix(line, ";"):
+		default:
+			m := keyLine.FindStringSubmatch(line)
+			if m == nil {
+				return nil, errorf("a key with its JSON name in a comment expected")
+			}
+			n, err := strconv.ParseUint(m[2], 10, 64)
+			if err != nil || n > 63 {
+				return nil, errorf("keys must be below 64")
+			}
+			if len(current.keys) > 0 && current.keys[len(current.keys)-1].n >= n {
+				return nil, errorf("keys must be in ascending order")
+			}
+			typ, err := parseType(m[3])
+			if err != nil {
+				return nil, errorf("%v", err)
+			}
+			current.keys = append(current.keys, key{n: n, optional: m[1] != "", typ: typ, field: m[4], line: lineNo})
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	if current != nil {
+		return nil, fmt.Errorf("%s: rule %s is not closed", path, current.name)
+	}
+	for _, r := range rules {
+		for _, k := range r.keys {
+			for t := &k.typ; t != nil; t = t.elem {
+				if t.kind == "rule" && rules[t.ref] == nil {
+					return nil, fmt.Errorf("%s:%d: no rule %s", path, k.line, t.ref)
+				}
+			}
+		}
+	}
+	return rules, nil
+}
+
+func parseType(s string) (cddlType, error) {
+	var t cddlType
+	if rest, ok := strings.CutSuffix(s, "/ null"); ok {
+		t.nullable = true
+		s = strings.TrimSpace(rest)
+	}
+	switch {
+	case s == "uint" || s == "int" || s == "tstr" || s == "bstr" || s == "bool" || s == "tdate":
+		t.kind = s
+	case uintSize.MatchString(s):
+		t.kind = "uint"
+		t.size, _ = strconv.Atoi(uintSize.FindStringSubmatch(s)[1])
+		if t.size != 1 && t.size != 2 && t.size != 4 && t.size != 8 {
+			return t, fmt.Errorf("unsupported size %d", t.size)
+		}
+	case arrayOf.MatchString(s):
+		elem, err := parseType(arrayOf.FindStringSubmatch(s)[1])
+		if err != nil {
+			return t, err
+		}
+		if elem.nullable || elem.kind == "array" {
+			return t, fmt.Errorf("unsupported array element %s", s)
+		}
+		t.kind, t.elem = "array", &elem
+	case ruleStart.MatchString(s + " = {"):
+		t.kind, t.ref = "rule", s
+	default:
+		return t, fmt.Errorf("unsupported type %q", s)
+	}
+	if t.nullable && t.kind != "bstr" && t.kind != "rule" {
+		return t, fmt.Errorf("only bstr and rules may be null")
+	}
+	return t, nil
+}
+
+// a Go package with frame types
+type goPackage struct {
+	name  string
+	types map[string]goStruct
+}
+
+// a struct type with the imports of its file by package name
+type goStruct struct {
+	st      *ast.StructType
+	imports map[string]string
+}
+
+func loadPackage(dir, out string) (*goPackage, error) {
+	fset := token.NewFileSet()
+	pkgs, err := parser.ParseDir(fset, dir, func(fi os.FileInfo) bool {
+		return !strings.HasSuffix(fi.Name(), "_test.go") && fi.Name() != filepath.Base(out)
+	}, parser.ParseComments)
+	if err != nil {
+		return nil, err
+	}
+	if len(pkgs) != 1 {
+		return nil, fmt.Errorf("%d packages in %s", len(pkgs), dir)
+	}
+	p := &goPackage{types: make(map[string]goStruct)}
+	for name, pkg := range pkgs {
+		p.name = name
+		for _, file := range pkg.Files {
+			imports := make(map[string]string)
+			for _, imp := range file.Imports {
+				path, _ := strconv.Unquote(imp.Path.Value)
+				if imp.Name != nil {
+					imports[imp.Name.Name] = path
+				} else {
+					imports[filepath.Base(path)] = path
+				}
+			}
+			ast.Inspect(file, func(n ast.Node) bool {
+				if spec, ok := n.(*ast.TypeSpec); ok {
+					if st, ok := spec.Type.(*ast.StructType); ok {
+						p.types[spec.Name.Name] = goStruct{st: st, imports: imports}
+					}
+				}
+				return true
+			})
+		}
+	}
+	return p, nil
+}
+
+// a field of a Go struct with a JSON name
+type goField struct {
+	name      string
+	typ       ast.Expr
+	omitempty bool
+}
+
+func jsonFields(st *ast.StructType) (map[string]goField, error) {
+	fields := make(map[string]goField)
+	for _, f := range st.Fields.List {
+		if f.Tag == nil {
+			continue
+		}
+		tag, _ := strconv.Unquote(f.Tag.Value)
+		jsonTag, ok := reflect.StructTag(tag).Lookup("json")
+		if !ok || jsonTag == "-" {
+			continue
+		}
+		if len(f.Names) != 1 {
+			return nil, fmt.Errorf("embedded field with JSON tag %q", jsonTag)
+		}
+		name, opts, _ := strings.Cut(jsonTag, ",")
+		fields[name] = goField{name: f.Names[0].Name, typ: f.Type, omitempty: strings.Contains(opts, "omitempty")}
+	}
+	return fields, nil
+}
+
+// generator writes the methods of one package
+type generator struct {
+	pkg   *goPackage
+	rules map[string]*rule
+	buf   bytes.Buffer
+	// import paths the generated code needs
+	uses map[string]bool
+	// the struct being generated
+	current goStruct
+}
+
+func (g *generator) printf(format string, args ...any) {
+	fmt.Fprintf(&g.buf, format, args...)
+}
+
+func generate(pkg *goPackage, rules map[string]*rule, schema string) ([]byte, error) {
+	g := &generator{pkg: pkg, rules: rules, uses: map[string]bool{"execp2p/internal/wire": true}}
+	var names []string
+	for name, r := range rules {
+		if strings.HasPrefix(r.goType, pkg.name+".") {
+			names = append(names, name)
+		}
+	}
+	sort.Slice(names, func(i, j int) bool { return rules[names[i]].line < rules[names[j]].line })
+	if len(names) == 0 {
+		return nil, fmt.Errorf("no rule of the schema is for package %s", pkg.name)
+	}
+
+	var body bytes.Buffer
+	for _, name := range names {
+		g.buf.Reset()
+		if err := g.rule(rules[name]); err != nil {
+			return nil, fmt.Errorf("%s:%d: %s: %v", schema, rules[name].line, name, err)
+		}
+		body.Write(g.buf.Bytes())
+	}
+
+	g.buf.Reset()
+	g.printf("// Code generated by wiregen from %s; DO NOT EDIT.\n\npackage %s\n\nimport (\n", schema, pkg.name)
+	var paths []string
+	for path := range g.uses {
+		paths = append(paths, path)
+	}
+	sort.Strings(paths)
+	for _, path := range paths {
+		g.printf("\t%q\n", path)
+	}
+	g.printf(")\n")
+	g.buf.Write(body.Bytes())
+	src, err := format.Source(g.buf.Bytes())
+	if err != nil {
+		return nil, fmt.Errorf("generated code does not parse: %v\n%s", err, g.buf.Bytes())
+	}
+	return src, nil
+}
+
+// a key bound to its Go field
+type binding struct {
+	key
+	field goField
+	// the Go expression of the field, e.g. m.Payload
+	expr string
+}
+
+func (g *generator) rule(r *rule) error {
+	typeName := strings.TrimPrefix(r.goType, g.pkg.name+".")
+	s, ok := g.pkg.types[typeName]
+	if !ok {
+		return fmt.Errorf("no struct type %s in package %s", typeName, g.pkg.name)
+	}
+	g.current = s
+	fields, err := jsonFields(s.st)
+	if err != nil {
+		return err
+	}
+	var bound []binding
+	for _, k := range r.keys {
+		f, ok := fields[k.field]
+		if !ok {
+			return fmt.Errorf("key %d: %s has no field with JSON name %q", k.n, typeName, k.field)
+		}
+		delete(fields, k.field)
+		if err := g.check(k, f); err != nil {
+			return fmt.Errorf("key %d (%s): %v", k.n, k.field, err)
+		}
+		bound = append(bound, binding{key: k, field: f, expr: "m." + f.name})
+	}
+	if len(fields) > 0 {
+		var names []string
+		for name := range fields {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		return fmt.Errorf("field with JSON name %q of %s has no key", names[0], typeName)
+	}
+
+	var required uint64
+	for _, b := range bound {
+		if !b.optional {
+			required |= 1 << b.n
+		}
+	}
+
+	// encoding
+	g.printf("\n// AppendCBOR appends the CBOR encoding of m (%s)\n", r.name)
+	g.printf("func (m *%s) AppendCBOR(b []byte) []byte {\n", typeName)
+	g.printf("n := %d\n", bitsSet(required))
+	for _, b := range bound {
+		if b.optional {
+			g.printf("if %s {\nn++\n}\n", present(b))
+		}
+	}
+	g.printf("b = wire.AppendMapHeader(b, n)\n")
+	for _, b := range bound {
+		if b.optional {
+			g.printf("if %s {\n", present(b))
+		}
+		g.printf("b = wire.AppendUint(b, %d)\n", b.n)
+		g.encode(b.typ, b.field.typ, b.expr)
+		if b.optional {
+			g.printf("}\n")
+		}
+	}
+	g.printf("return b\n}\n")
+
+	// decoding
+	g.printf("\n// DecodeCBOR reads m from d (%s)\n", r.name)
+	g.printf("func (m *%s) DecodeCBOR(d *wire.Decoder) error {\n", typeName)
+	g.printf("n, err := d.MapHeader()\nif err != nil {\nreturn err\n}\n")
+	g.printf("if err := d.Enter(); err != nil {\nreturn err\n}\ndefer d.Leave()\n")
+	g.printf("const required = %#x\n", required)
+	g.printf("var seen uint64\nlast := int64(-1)\n")
+	g.printf("for i := 0; i < n; i++ {\n")
+	g.printf("key, err := d.MapKey(&last)\nif err != nil {\nreturn err\n}\n")
+	g.printf("if key < 64 {\nseen |= 1 << key\n}\n")
+	g.printf("switch key {\n")
+	for _, b := range bound {
+		g.printf("case %d:\n", b.n)
+		g.decode(b.typ, b.field.typ, b.expr)
+	}
+	g.printf("default:\nerr = d.Skip()\n}\n")
+	g.printf("if err != nil {\nreturn err\n}\n}\n")
+	g.printf("if seen&required != required {\nreturn d.Missing(%q, required, seen)\n}\n", r.name)
+	g.printf("return nil\n}\n")
+	return nil
+}
+
+func bitsSet(v uint64) int {
+	n := 0
+	for ; v != 0; v &= v - 1 {
+		n++
+	}
+	return n
+}
+
+// present is the condition under which an optional key is written: the
+// field is not what encoding/json's omitempty leaves out
+func present(b binding) string {
+	switch b.typ.kind {
+	case "tstr", "bstr", "array":
+		return "len(" + b.expr + ") != 0"
+	case "bool":
+		return b.expr
+	}
+	return b.expr + " != 0"
+}
+
+// check tells whether the Go type of f can hold k's type
+func (g *generator) check(k key, f goField) error {
+	// encoding/json writes structs whatever omitempty says
+	if k.typ.kind == "tdate" || k.typ.kind == "rule" && !k.typ.nullable {
+		if k.optional {
+			return fmt.Errorf("%s can't be optional", describe(k.typ))
+		}
+	} else if k.optional != f.omitempty {
+		return fmt.Errorf("optional in the schema is omitempty in Go")
+	}
+	if k.optional && k.typ.nullable {
+		return fmt.Errorf("an optional key is left out, not null")
+	}
+	if !k.optional && k.typ.kind == "array" {
+		return fmt.Errorf("arrays must be optional")
+	}
+	if !k.optional && k.typ.kind == "bstr" && exprString(f.typ) == "[]byte" && !k.typ.nullable {
+		return fmt.Errorf("a []byte must be bstr / null to keep nil apart from empty")
+	}
+	return g.checkType(k.typ, f.typ)
+}
+
+func (g *generator) checkType(t cddlType, e ast.Expr) error {
+	goType := exprString(e)
+	ok := false
+	switch t.kind {
+	case "uint":
+		bits, unsigned := intTypes[goType]
+		ok = unsigned && (t.size == 0 || t.size*8 == bits)
+	case "int":
+		_, ok = signedTypes[goType]
+	case "tstr":
+		ok = goType == "string"
+	case "bstr":
+		ok = goType == "string" && !t.nullable || goType == "[]byte"
+	case "bool":
+		ok = goType == "bool"
+	case "tdate":
+		ok = goType == "time.Time"
+	case "array":
+		arr, isArray := e.(*ast.ArrayType)
+		if !isArray || arr.Len != nil {
+			break
+		}
+		return g.checkType(*t.elem, arr.Elt)
+	case "rule":
+		if star, isStar := e.(*ast.StarExpr); isStar {
+			if !t.nullable {
+				break
+			}
+			e, goType = star.X, exprString(star.X)
+		} else if t.nullable {
+			break
+		}
+		if !strings.Contains(goType, ".") {
+			goType = g.pkg.name + "." + goType
+		}
+		ok = goType == g.rules[t.ref].goType
+		if ok {
+			g.useQualifier(e)
+		}
+	}
+	if !ok {
+		return fmt.Errorf("Go type %s does not hold %s", goType, describe(t))
+	}
+	return nil
+}
+
+func describe(t cddlType) string {
+	s := t.kind
+	if t.kind == "rule" {
+		s = t.ref
+	}
+	if t.nullable {
+		s += " / null"
+	}
+	return s
+}
+
+// bits of the unsigned integer types
+var intTypes = map[string]int{
+	"uint8": 8, "byte": 8, "uint16": 16, "uint32": 32, "uint64": 64, "uint": 64,
+}
+
+// bounds of the signed integer types
+var signedTypes = map[string][2]string{
+	"int":   {"math.MinInt", "math.MaxInt"},
+	"int8":  {"math.MinInt8", "math.MaxInt8"},
+	"int16": {"math.MinInt16", "math.MaxInt16"},
+	"int32": {"math.MinInt32", "math.MaxInt32"},
+	"int64": {"math.MinInt64", "math.MaxInt64"},
+}
+
+// useQualifier records the import of the package a type expression names
+func (g *generator) useQualifier(e ast.Expr) {
+	if sel, ok := e.(*ast.SelectorExpr); ok {
+		if id, ok := sel.X.(*ast.Ident); ok {
+			g.uses[g.current.imports[id.Name]] = true
+		}
+	}
+}
+
+func exprString(e ast.Expr) string {
+	var buf bytes.Buffer
+	format.Node(&buf, token.NewFileSet(), e)
+	return buf.String()
+}
+
+// encode writes the code appending expr, of Go type e, as t
+func (g *generator) encode(t cddlType, e ast.Expr, expr string) {
+	goType := exprString(e)
+	switch t.kind {
+	case "uint":
+		g.printf("b = wire.AppendUint(b, %s)\n", convert("uint64", goType, expr))
+	case "int":
+		g.printf("b = wire.AppendInt(b, %s)\n", convert("int64", goType, expr))
+	case "tstr":
+		g.printf("b = wire.AppendText(b, %s)\n", expr)
+	case "bstr":
+		if goType == "string" {
+			g.printf("b = wire.AppendStringBytes(b, %s)\n", expr)
+		} else {
+			g.printf("b = wire.AppendBytes(b, %s)\n", expr)
+		}
+	case "bool":
+		g.printf("b = wire.AppendBool(b, %s)\n", expr)
+	case "tdate":
+		g.printf("b = wire.AppendTime(b, %s)\n", expr)
+	case "array":
+		elem := e.(*ast.ArrayType).Elt
+		g.printf("b = wire.AppendArrayHeader(b, len(%s))\n", expr)
+		g.printf("for i := range %s {\n", expr)
+		g.encode(*t.elem, elem, expr+"[i]")
+		g.printf("}\n")
+	case "rule":
+		if t.nullable {
+			g.printf("if %s == nil {\nb = wire.AppendNull(b)\n} else {\nb = %s.AppendCBOR(b)\n}\n", expr, expr)
+		} else {
+			g.printf("b = %s.AppendCBOR(b)\n", expr)
+		}
+	}
+}
+
+// convert converts expr of type from to type to
+func convert(to, from, expr string) string {
+	if to == from {
+		return expr
+	}
+	return to + "(" + expr + ")"
+}
+
+// decode writes the code reading target, of Go type e, as t; it sets err
+func (g *generator) decode(t cddlType, e ast.Expr, target string) {
+	goType := exprString(e)
+	switch t.kind {
+	case "uint":
+		g.uses["math"] = true
+		max := fmt.Sprintf("math.MaxUint%d", intTypes[goType])
+		if goType == "uint" {
+			max = "math.MaxUint"
+		}
+		g.printf("var v uint64\nv, err = d.Uint(%s)\n%s = %s\n", max, target, convert(goType, "uint64", "v"))
+	case "int":
+		g.uses["math"] = true
+		bounds := signedTypes[goType]
+		g.printf("var v int64\nv, err = d.Int(%s, %s)\n%s = %s\n", bounds[0], bounds[1], target, convert(goType, "int64", "v"))
+	case "tstr":
+		g.printf("%s, err = d.Text()\n", target)
+	case "bstr":
+		if goType == "string" {
+			g.printf("%s, err = d.StringBytes()\n", target)
+		} else {
+			g.printf("%s, err = d.Bytes()\n", target)
+		}
+	case "bool":
+		g.printf("%s, err = d.Bool()\n", target)
+	case "tdate":
+		g.printf("%s, err = d.Time()\n", target)
+	case "array":
+		elem := e.(*ast.ArrayType).Elt
+		g.printf("%s, err = wire.DecodeArray(d, func(d *wire.Decoder, item *%s) (err error) {\n", target, exprString(elem))
+		g.decode(*t.elem, elem, "*item")
+		g.printf("return err\n})\n")
+	case "rule":
+		if t.nullable {
+			elem := e.(*ast.StarExpr).X
+			g.printf("%s = nil\nvar null bool\nif null, err = d.Null(); err == nil && !null {\n", target)
+			g.printf("%s = new(%s)\nerr = %s.DecodeCBOR(d)\n}\n", target, exprString(elem), target)
+		} else {
+			// an array item is decoded through its pointer
+			g.printf("err = %s.DecodeCBOR(d)\n", strings.TrimPrefix(target, "*"))
+		}
+	}
+}
@@ -0,0 +1,236 @@
+package xmpp
+
+import (
+	"crypto/sha1"
+	"encoding/hex"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strings"
+	"sync"
+	"time"
+)
+
+// namespaces
+const (
+	nsComponent = "jabber:component:accept"
+	nsStream    = "http://etherx.jabber.org/streams"
+	nsPing      = "urn:xmpp:ping"
+)
+
+const (
+	// how long connecting and the handshake may take
+	handshakeTimeout = 10 * time.Second
+	// how long writing one stanza may take
+	writeTimeout = 5 * time.Second
+)
+
+// ErrHandshake means the server refused the component's secret or domain
+var ErrHandshake = errors.New("XMPP server refused the component handshake")
+
+type message struct {
+	XMLName xml.Name `xml:"message"`
+	From    string   `xml:"from,attr,omitempty"`
+	To      string   `xml:"to,attr,omitempty"`
+	Type    string   `xml:"type,attr,omitempty"`
+	ID      string   `xml:"id,attr,omitempty"`
+	Body    string   `xml:"body,omitempty"`
+	// set on history the MUC replays
+	Delay *delay `xml:"urn:xmpp:delay delay,omitempty"`
+}
+
+type delay struct {
+	Stamp string `xml:"stamp,attr"`
+}
+
+type presence struct {
+	XMLName xml.Name   `xml:"presence"`
+	From    string     `xml:"from,attr,omitempty"`
+	To      string     `xml:"to,attr,omitempty"`
+	Type    string     `xml:"type,attr,omitempty"`
+	Show    string     `xml:"show,omitempty"`
+	Join    *mucJoin   `xml:"http://jabber.org/protocol/muc x,omitempty"`
+	Error   *stanzaErr `xml:"error,omitempty"`
+}
+
+// mucJoin asks to enter a MUC, without its history
+type mucJoin struct {
+	History struct {
+		MaxStanzas int `xml:"maxstanzas,attr"`
+	} `xml:"history"`
+}
+
+type stanzaErr struct {
+	Type     string    `xml:"type,attr"`
+	Conflict *struct{} `xml:"urn:ietf:params:xml:ns:xmpp-stanzas conflict"`
+}
+
+type iq struct {
+	XMLName xml.Name `xml:"iq"`
+	From    string   `xml:"from,attr,omitempty"`
+	To      string   `xml:"to,attr,omitempty"`
+	Type    string   `xml:"type,attr"`
+	ID      string   `xml:"id,attr"`
+	Payload struct {
+		XMLName xml.Name
+	} `xml:",any"`
+}
+
+// iqReply answers an iq: empty for a ping, an error for anything else
+type iqReply struct {
+	XMLName xml.Name     `xml:"iq"`
+	From    string       `xml:"from,attr"`
+	To      string       `xml:"to,attr"`
+	Type    string       `xml:"type,attr"`
+	ID      string       `xml:"id,attr"`
+	Error   *unavailable `xml:"error,omitempty"`
+}
+
+type unavailable struct {
+	Type      string   `xml:"type,attr"`
+	Condition struct{} `xml:"urn:ietf:params:xml:ns:xmpp-stanzas service-unavailable"`
+}
+
+type streamError struct {
+	Condition struct {
+		XMLName xml.Name
+	} `xml:",any"`
+}
+
+// stream is a component's connection to the server
+type stream struct {
+	conn net.Conn
+	dec  *xml.Decoder
+	wmu  sync.Mutex
+}
+
+// dial connects to the server's component listener and authenticates as
+// domain (XEP-0114)
+func dial(server, domain, secret string) (*stream, error) {
+	conn, err := net.DialTimeout("tcp", server, handshakeTimeout)
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to the XMPP server: %w", err)
+	}
+	s := &stream{conn: conn, dec: xml.NewDecoder(conn)}
+	if err := s.handshake(domain, secret); err != nil {
+		conn.Close()
+		return nil, err
+	}
+	return s, nil
+}
+
+func (s *stream) handshake(domain, secret string) error {
+	s.conn.SetDeadline(time.Now().Add(handshakeTimeout))
+	defer s.conn.SetDeadline(time.Time{})
+
+	var b strings.Builder
+	b.WriteString("<?xml version='1.0'?><stream:stream xmlns='" + nsComponent + "' xmlns:stream='" + nsStream + "' to='")
+	xml.EscapeText(&b, []byte(domain))
+	b.WriteString("'>")
+	if _, err := io.WriteString(s.conn, b.String()); err != nil {
+		return err
+	}
+
+	var id string
+	for id == "" {
+		tok, err := s.dec.Token()
+		if err != nil {
+			return fmt.Errorf("no XMPP stream header: %w", err)
+		}
+		start, ok := tok.(xml.StartElement)
+		if !ok {
+			continue
+		}
+		if start.Name.Space != nsStream || start.Name.Local != "stream" {
+			return fmt.Errorf("unexpected <%s> instead of an XMPP stream", start.Name.Local)
+		}
+		for _, a := range start.Attr {
+			if a.Name.Local == "id" {
+				id = a.Value
+			}
+		}
+		if id == "" {
+			return errors.New("XMPP stream header without an id")
+		}
+	}
+
+	sum := sha1.Sum([]byte(id + secret))
+	var hs struct {
+		XMLName xml.Name `xml:"handshake"`
+		Digest  string   `xml:",chardata"`
+	}
+	hs.Digest = hex.EncodeToString(sum[:])
+	if err := s.send(&hs); err != nil {
+		return err
+	}
+	start, err := s.next()
+	if err != nil {
+		return err
+	}
+	if start.Name.Local != "handshake" {
+		if err := s.streamErr(start); err != nil {
+			return fmt.Errorf("%w: %v", ErrHandshake, err)
+		}
+		return fmt.Errorf("%w: unexpected <%s>", ErrHandshake, start.Name.Local)
+	}
+	return s.dec.Skip()
+}
+
+// next returns the next stanza; io.EOF when the server closed the stream
+func (s *stream) next() (xml.StartElement, error) {
+	for {
+		tok, err := s.dec.Token()
+		if err != nil {
+			return xml.StartElement{}, err
+		}
+		switch t := tok.(type) {
+		case xml.StartElement:
+			return t, nil
+		case xml.EndElement:
+			return xml.StartElement{}, io.EOF
+		}
+	}
+}
+
+// streamErr reads a stream error, or skips what else start began and
+// returns nil
+func (s *stream) streamErr(start xml.StartElement) error {
+	if start.Name.Space != nsStream || start.Name.Local != "error" {
+		return s.dec.Skip()
+	}
+	var e streamError
+	if err := s.dec.DecodeElement(&e, &start); err != nil {
+		return err
+	}
+	return fmt.Errorf("XMPP stream error: %s", e.Condition.XMLName.Local)
+}
+
+// send writes a stanza
+func (s *stream) send(v any) error {
+	data, err := xml.Marshal(v)
+	if err != nil {
+		return err
+	}
+	s.wmu.Lock()
+	defer s.wmu.Unlock()
+	s.conn.SetWriteDeadline(time.Now().Add(writeTimeout))
+	_, err = s.conn.Write(data)
+	return err
+}
+
+// close ends the stream and the connection
+func (s *stream) close() {
+	s.wmu.Lock()
+	s.conn.SetWriteDeadline(time.Now().Add(writeTimeout))
+	io.WriteString(s.conn, "</stream:stream>")
+	s.wmu.Unlock()
+	s.conn.Close()
+}
+
+// splitJID returns the bare JID and the resource of jid
+func splitJID(jid string) (bare, resource string) {
+	bare, resource, _ = strings.Cut(jid, "/")
+	return bare, resource
+}
@@ -0,0 +1,433 @@
+// Package xmpp connects a room to an XMPP multi-user chat (XEP-0045) as a
+// server component (XEP-0114). Every member of the room is an occupant of
+// the MUC in its own right, under its nickname and with its presence, and
+// what the MUC's other occupants write is handed back to be sent to the
+// room. The gateway's own occupant receives the MUC's traffic.
+//
+// A component authenticates with a shared secret over plain TCP, and the
+// messages it carries are decrypted, so only an XMPP server on this machine
+// (a loopback address) is accepted; a remote one is reached through a
+// tunnel.
+package xmpp
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"execp2p/internal/crash"
+	"execp2p/internal/logger"
+)
+
+// SinkXMPP is how the gateway is announced among the archive sinks of the
+// room metadata
+const SinkXMPP = "xmpp"
+
+const (
+	// the resource of every JID the gateway uses
+	resource = "execp2p"
+	// appended to a member's nickname already taken in the MUC
+	conflictSuffix = " (ExecP2P)"
+	// messages from the MUC waiting to be sent to the room; newer ones are
+	// dropped when it is full
+	queueSize = 64
+	// pause before reconnecting, doubled up to maxRetryDelay
+	retryDelay    = 2 * time.Second
+	maxRetryDelay = time.Minute
+)
+
+// Options configures the gateway
+type Options struct {
+	// host:port of the XMPP server's component listener, on this machine
+	Server string
+	// the component's domain and secret, as configured on the server
+	Domain string
+	Secret string
+	// bare JID of the MUC, e.g. team@conference.example.org
+	Room string
+	// nickname of the gateway's own occupant
+	Nick string
+}
+
+// Member is a room member mirrored as an occupant of the MUC
+type Member struct {
+	// peer ID, the local part of the occupant's JID
+	ID   string
+	Nick string
+	// XMPP availability: "" (available), "away", "xa", "dnd" or "chat"
+	Show string
+}
+
+// Message is what an occupant of the MUC wrote
+type Message struct {
+	Nick string
+	Body string
+}
+
+// Occupant is someone in the MUC who is not one of the room's members
+type Occupant struct {
+	Nick string
+	Show string
+}
+
+// Gateway mirrors the room's members in the MUC and hands over what the
+// MUC's other occupants write. It reconnects when the server goes away.
+type Gateway struct {
+	opts     Options
+	messages chan Message
+	stop     chan struct{}
+	done     chan struct{}
+
+	mu sync.Mutex
+	s  *stream
+	// members the MUC should have, by ID
+	members map[string]Member
+	// members in the MUC on the current stream, as last sent
+	joined map[string]Member
+	// the MUC's other occupants, by nickname
+	occupants map[string]string
+}
+
+// New checks the options, connects to the server and joins the MUC
+func New(opts Options) (*Gateway, error) {
+	host, _, err := net.SplitHostPort(opts.Server)
+	if err != nil {
+		return nil, fmt.Errorf("invalid XMPP server address: %w", err)
+	}
+	if ip := net.ParseIP(host); host != "localhost" && (ip == nil || !ip.IsLoopback()) {
+		return nil, fmt.Errorf("XMPP server must be on this machine (localhost or a loopback address), not %s", host)
+	}
+	if opts.Domain == "" || opts.Secret == "" {
+		return nil, errors.New("XMPP component domain and secret are required")
+	}
+	if local, domain, ok := strings.Cut(opts.Room, "@"); !ok || local == "" || domain == "" || strings.Contains(opts.Room, "/") {
+		return nil, fmt.Errorf("invalid MUC address %q: want room@conference.example.org", opts.Room)
+	}
+	if opts.Nick == "" {
+		return nil, errors.New("XMPP gateway nickname is required")
+	}
+
+	s, err := dial(opts.Server, opts.Domain, opts.Secret)
+	if err != nil {
+		return nil, err
+	}
+	g := &Gateway{
+		opts:      opts,
+		messages:  make(chan Message, queueSize),
+		stop:      make(chan struct{}),
+		done:      make(chan struct{}),
+		members:   make(map[string]Member),
+		joined:    make(map[string]Member),
+		occupants: make(map[string]string),
+	}
+	if err := g.attach(s); err != nil {
+		s.close()
+		return nil, err
+	}
+	go g.run(s)
+	return g, nil
+}
+
+// Messages delivers what the MUC's other occupants write; it is closed by
+// Close
+func (g *Gateway) Messages() <-chan Message {
+	return g.messages
+}
+
+// Sync makes the MUC's occupants for the room match members: new members
+// join, departed ones leave, and changed nicknames and presence follow
+func (g *Gateway) Sync(members []Member) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	g.members = make(map[string]Member, len(members))
+	for _, m := range members {
+		m.ID = strings.ToLower(m.ID)
+		g.members[m.ID] = m
+	}
+	if g.s != nil {
+		g.syncLocked()
+	}
+}
+
+// Send posts body to the MUC as the member with the given ID
+func (g *Gateway) Send(id, body string) error {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	id = strings.ToLower(id)
+	if _, ok := g.joined[id]; !ok || g.s == nil {
+		return fmt.Errorf("member %s is not in the MUC", id)
+	}
+	return g.s.send(&message{From: g.memberJID(id), To: g.opts.Room, Type: "groupchat", Body: body})
+}
+
+// Occupants returns the MUC's other occupants, sorted by nickname
+func (g *Gateway) Occupants() []Occupant {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	list := make([]Occupant, 0, len(g.occupants))
+	for nick, show := range g.occupants {
+		list = append(list, Occupant{Nick: nick, Show: show})
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].Nick < list[j].Nick })
+	return list
+}
+
+// Close takes every member out of the MUC and disconnects
+func (g *Gateway) Close() {
+	close(g.stop)
+	g.mu.Lock()
+	if s := g.s; s != nil {
+		for id, m := range g.joined {
+			s.send(&presence{From: g.memberJID(id), To: g.occupantJID(m.Nick), Type: "unavailable"})
+		}
+		s.send(&presence{From: g.gatewayJID(), To: g.occupantJID(g.opts.Nick), Type: "unavailable"})
+		s.close()
+	}
+	g.mu.Unlock()
+	<-g.done
+	close(g.messages)
+}
+
+// run reads stanzas, reconnecting until the gateway is closed
+func (g *Gateway) run(s *stream) {
+	defer crash.Recover("xmpp.run")
+	defer close(g.done)
+	delay := retryDelay
+	for {
+		err := g.serve(s)
+		g.detach()
+		select {
+		case <-g.stop:
+			return
+		default:
+		}
+		logger.L().Warn("XMPP gateway disconnected; reconnecting", "err", err)
+
+		for s = nil; s == nil; {
+			select {
+			case <-g.stop:
+				return
+			case <-time.After(delay):
+			}
+			delay = min(2*delay, maxRetryDelay)
+			var err error
+			if s, err = dial(g.opts.Server, g.opts.Domain, g.opts.Secret); err != nil {
+				logger.L().Warn("XMPP gateway failed to reconnect", "err", err, "retry_in", delay)
+				continue
+			}
+			if err := g.attach(s); err != nil {
+				s.close()
+				s = nil
+			}
+		}
+		delay = retryDelay
+		logger.L().Info("XMPP gateway reconnected", "room", g.opts.Room)
+	}
+}
+
+// attach makes s the current stream and joins the MUC on it
+func (g *Gateway) attach(s *stream) error {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	select {
+	case <-g.stop:
+		return errors.New("XMPP gateway closed")
+	default:
+	}
+	join := &presence{From: g.gatewayJID(), To: g.occupantJID(g.opts.Nick), Join: &mucJoin{}}
+	if err := s.send(join); err != nil {
+		return err
+	}
+	g.s = s
+	g.syncLocked()
+	return nil
+}
+
+// detach forgets the stream that ended and who was in the MUC on it
+func (g *Gateway) detach() {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if g.s != nil {
+		g.s.conn.Close()
+	}
+	g.s = nil
+	clear(g.joined)
+	clear(g.occupants)
+}
+
+// syncLocked sends the presence that brings the MUC to g.members
+func (g *Gateway) syncLocked() {
+	for id, was := range g.joined {
+		if _, ok := g.members[id]; !ok {
+			g.s.send(&presence{From: g.memberJID(id), To: g.occupantJID(was.Nick), Type: "unavailable"})
+			delete(g.joined, id)
+		}
+	}
+	for id, m := range g.members {
+		was, ok := g.joined[id]
+		if ok && strings.TrimSuffix(was.Nick, conflictSuffix) == m.Nick {
+			// keep the nickname the MUC let us have
+			m.Nick = was.Nick
+			if was.Show == m.Show {
+				continue
+			}
+		}
+		// to another nickname, a member already in the MUC changes it
+		p := &presence{From: g.memberJID(id), To: g.occupantJID(m.Nick), Show: m.Show}
+		if !ok {
+			p.Join = &mucJoin{}
+		}
+		if err := g.s.send(p); err != nil {
+			logger.L().Warn("Failed to send XMPP presence", "member", id, "err", err)
+			continue
+		}
+		g.joined[id] = m
+	}
+}
+
+// serve handles the stanzas of s until it ends
+func (g *Gateway) serve(s *stream) error {
+	for {
+		start, err := s.next()
+		if err != nil {
+			if errors.Is(err, io.EOF) {
+				return errors.New("XMPP server closed the stream")
+			}
+			return err
+		}
+		switch start.Name.Local {
+		case "message":
+			var m message
+			if err := s.dec.DecodeElement(&m, &start); err != nil {
+				return err
+			}
+			g.handleMessage(m)
+		case "presence":
+			var p presence
+			if err := s.dec.DecodeElement(&p, &start); err != nil {
+				return err
+			}
+			g.handlePresence(p)
+		case "iq":
+			var q iq
+			if err := s.dec.DecodeElement(&q, &start); err != nil {
+				return err
+			}
+			g.handleIQ(s, q)
+		default:
+			if err := s.streamErr(start); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+// handleMessage hands over what another occupant wrote to the MUC; every
+// occupant of ours gets a copy, only the gateway's counts
+func (g *Gateway) handleMessage(m message) {
+	room, nick := splitJID(m.From)
+	if m.Type != "groupchat" || m.To != g.gatewayJID() || !strings.EqualFold(room, g.opts.Room) ||
+		nick == "" || m.Delay != nil || strings.TrimSpace(m.Body) == "" {
+		return
+	}
+	g.mu.Lock()
+	ours := g.ours(nick)
+	g.mu.Unlock()
+	if ours {
+		return
+	}
+	select {
+	case g.messages <- Message{Nick: nick, Body: m.Body}:
+	default:
+		logger.L().Warn("XMPP gateway is not keeping up; message dropped", "nick", nick)
+	}
+}
+
+// handlePresence keeps track of the MUC's other occupants and renames a
+// member whose nickname is taken
+func (g *Gateway) handlePresence(p presence) {
+	room, nick := splitJID(p.From)
+	if !strings.EqualFold(room, g.opts.Room) || nick == "" {
+		return
+	}
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	if p.Type == "error" {
+		g.rejected(p, nick)
+		return
+	}
+	if p.To != g.gatewayJID() || g.ours(nick) {
+		return
+	}
+	if p.Type == "unavailable" {
+		delete(g.occupants, nick)
+	} else if p.Type == "" {
+		g.occupants[nick] = p.Show
+	}
+}
+
+// rejected handles the MUC refusing an occupant of ours
+func (g *Gateway) rejected(p presence, nick string) {
+	if p.To == g.gatewayJID() {
+		logger.L().Warn("XMPP MUC refused the gateway", "room", g.opts.Room, "nick", nick)
+		return
+	}
+	local, _ := splitJID(p.To)
+	id, _, _ := strings.Cut(local, "@")
+	m, ok := g.joined[id]
+	if !ok {
+		return
+	}
+	delete(g.joined, id)
+	if p.Error == nil || p.Error.Conflict == nil || strings.HasSuffix(m.Nick, conflictSuffix) || g.s == nil {
+		logger.L().Warn("XMPP MUC refused a member", "member", id, "nick", nick)
+		return
+	}
+	m.Nick += conflictSuffix
+	if err := g.s.send(&presence{From: g.memberJID(id), To: g.occupantJID(m.Nick), Show: m.Show, Join: &mucJoin{}}); err == nil {
+		g.joined[id] = m
+	}
+}
+
+// handleIQ answers pings and turns down every other request
+func (g *Gateway) handleIQ(s *stream, q iq) {
+	if q.Type != "get" && q.Type != "set" {
+		return
+	}
+	reply := &iqReply{From: q.To, To: q.From, Type: "result", ID: q.ID}
+	if q.Payload.XMLName.Space != nsPing {
+		reply.Type, reply.Error = "error", &unavailable{Type: "cancel"}
+	}
+	s.send(reply)
+}
+
+// ours reports whether nick is an occupant of ours; the caller holds g.mu
+func (g *Gateway) ours(nick string) bool {
+	if nick == g.opts.Nick {
+		return true
+	}
+	for _, m := range g.joined {
+		if m.Nick == nick {
+			return true
+		}
+	}
+	return false
+}
+
+func (g *Gateway) gatewayJID() string {
+	return g.opts.Domain + "/" + resource
+}
+
+func (g *Gateway) memberJID(id string) string {
+	return id + "@" + g.opts.Domain + "/" + resource
+}
+
+func (g *Gateway) occupantJID(nick string) string {
+	return g.opts.Room + "/" + nick
+}
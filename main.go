@@ -3,22 +3,34 @@ package main
 import (
 	"context"
 	"embed"
+	"errors"
 	"fmt"
 	"io"
 	"log"
 	"os"
+	"os/signal"
+	"path/filepath"
 	"runtime"
+	"syscall"
+	"time"
 
 	"execp2p/internal/app"
 	"execp2p/internal/config"
+	"execp2p/internal/crash"
+	"execp2p/internal/instance"
 	"execp2p/internal/logger"
+	"execp2p/internal/paths"
 	"execp2p/internal/platform"
+	"execp2p/internal/room"
+	"execp2p/internal/timefmt"
 	"execp2p/internal/wailsbridge"
 
 	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
 	"github.com/wailsapp/wails/v2"
 	"github.com/wailsapp/wails/v2/pkg/options"
 	"github.com/wailsapp/wails/v2/pkg/options/assetserver"
+	"github.com/wailsapp/wails/v2/pkg/options/mac"
 )
 
 //go:embed all:frontend/dist
@@ -28,32 +40,128 @@ var (
 	version = "1.0.4-e2e"
 
 	rootCmd = &cobra.Command{
-		Use:     "execp2p",
-		Short:   "A GUI-based post-quantum end-to-end encrypted chat application.",
+		Use:   "execp2p [invite-link]",
+		Short: "A GUI-based post-quantum end-to-end encrypted chat application.",
+		Long: `A GUI-based post-quantum end-to-end encrypted chat application.
+
+Only one window runs per user: launching it again, e.g. by opening an
+execp2p://join/ invite link, hands the link to the running window and exits.`,
 		Version: version,
+		Args:    cobra.MaximumNArgs(1),
+		// errors are printed once by main(); usage is only shown for --help
+		SilenceUsage:  true,
+		SilenceErrors: true,
 		RunE: func(cmd *cobra.Command, args []string) error {
-			return runApp()
+			if rpcStdioFlag {
+				if len(args) > 0 {
+					return errors.New("--rpc-stdio takes no invite link; use the join method")
+				}
+				return runRPCStdio()
+			}
+			return runApp(args)
 		},
 	}
 
 	// CLI global flags
-	logLevelFlag string
+	configFlag              string
+	logLevelFlag            string
+	ephemeralFlag           bool
+	keystoreProtectionFlag  string
+	onFingerprintChangeFlag string
+	archiveFileFlag         string
+	archiveSocketFlag       string
+	requireVerifiedFlag     bool
+	incognitoFlag           bool
+	roomTTLFlag             time.Duration
+	roomIdleTimeoutFlag     time.Duration
+	rejoinFlag              bool
+	languageFlag            string
+	timezoneFlag            string
+	whenOccupiedFlag        string
+	noHistoryFlag           bool
+	mailboxServerFlag       string
+	contactMeFlag           bool
+	mediaCacheFlag          int64
+	ffmpegFlag              string
+	voiceInputFlag          string
+	rpcStdioFlag            bool
+	minimizedFlag           bool
+	webhookURLFlag          string
+	xmppServerFlag          string
+	xmppDomainFlag          string
+	xmppRoomFlag            string
+	botFlag                 bool
+
+	// defaults, the config file and the flags, checked at startup
+	baseConfig *config.Config
+	// the global flags given on the command line, by name
+	changedFlags = map[string]bool{}
 )
 
 func init() {
+	rootCmd.PersistentFlags().StringVar(&configFlag, "config", "", "Config file (default: ~/.config/execp2p/config.yaml, if it exists)")
 	rootCmd.PersistentFlags().StringVar(&logLevelFlag, "log-level", "", "Set log level (debug, info, warn, error). Overrides $EXECP2P_LOG_LEVEL")
+	rootCmd.PersistentFlags().BoolVar(&ephemeralFlag, "ephemeral", false, "Use a throw-away identity for this session instead of the persistent keystore")
+	rootCmd.PersistentFlags().StringVar(&keystoreProtectionFlag, "keystore-protection", "keychain", "How a newly created keystore is protected (keychain, passphrase). The passphrase is read from $EXECP2P_KEYSTORE_PASSPHRASE")
+	rootCmd.PersistentFlags().StringVar(&archiveFileFlag, "archive-file", "", "Host only: append decrypted room traffic to this JSON lines file (announced to all participants)")
+	rootCmd.PersistentFlags().StringVar(&archiveSocketFlag, "archive-socket", "", "Host only: stream decrypted room traffic to read-only observers on this local socket (announced to all participants)")
+	rootCmd.PersistentFlags().BoolVar(&requireVerifiedFlag, "require-verified", false, "Strict mode: drop messages from peers whose fingerprint you haven't verified (QR scan or comparison)")
+	rootCmd.PersistentFlags().BoolVar(&incognitoFlag, "incognito", false, "Create and join rooms in incognito mode: nothing about the room is written to disk or logged")
+	rootCmd.PersistentFlags().DurationVar(&roomTTLFlag, "room-ttl", 0, "Host only: close created rooms this long after they were created, wiping their history (0 never)")
+	rootCmd.PersistentFlags().DurationVar(&roomIdleTimeoutFlag, "room-idle-timeout", 0, "Host only: close created rooms after this long without a chat message, wiping their history (0 never)")
+	rootCmd.PersistentFlags().BoolVar(&rejoinFlag, "rejoin", false, "Enter the rooms you were in again at startup: rooms you created are hosted again, the others joined")
+	rootCmd.PersistentFlags().StringVar(&languageFlag, "language", "pl", "Language used to format dates and times (pl, en)")
+	rootCmd.PersistentFlags().StringVar(&timezoneFlag, "timezone", "", "IANA time zone for displayed times, e.g. Europe/Warsaw (default: system zone)")
+	rootCmd.PersistentFlags().StringVar(&whenOccupiedFlag, "discovery-when-occupied", "reduce", "Host only: what DHT/mDNS announcing does once a peer is connected (reduce, stop, keep)")
+	rootCmd.PersistentFlags().BoolVar(&noHistoryFlag, "no-history", false, "Don't keep the encrypted local message history")
+	rootCmd.PersistentFlags().StringVar(&mailboxServerFlag, "mailbox-server", "", "Relay URL for offline delivery: messages to offline peers are sealed to them and parked there")
+	rootCmd.PersistentFlags().BoolVar(&contactMeFlag, "contact-me", false, "Publish a contact bundle on the mailbox relay, so people who know your user ID can leave you a first message while you are offline")
+	rootCmd.PersistentFlags().Int64Var(&mediaCacheFlag, "media-cache-size", 512, "Disk space for the encrypted cache of pictures and voice messages, in MiB (0 keeps media in memory only)")
+	rootCmd.PersistentFlags().StringVar(&ffmpegFlag, "ffmpeg", "", "Path of ffmpeg, used to record, encode (Opus) and play voice messages (default: look it up in PATH)")
+	rootCmd.PersistentFlags().StringVar(&voiceInputFlag, "voice-input", "", "Microphone as an ffmpeg format:device, e.g. dshow:audio=Microphone (default: the system microphone; required on Windows)")
+	rootCmd.PersistentFlags().StringVar(&webhookURLFlag, "webhook-url", "", "POST delivered messages and peer connections as JSON to this local URL (loopback only). Requests are signed with $EXECP2P_WEBHOOK_SECRET if set")
+	rootCmd.PersistentFlags().StringVar(&xmppServerFlag, "xmpp-server", "", "Host only: mirror the room in an XMPP MUC through the component listener (host:port) of an XMPP server on this machine (announced to all participants). The component secret comes from $EXECP2P_XMPP_SECRET")
+	rootCmd.PersistentFlags().StringVar(&xmppDomainFlag, "xmpp-domain", "", "Domain of the XMPP component, as configured on the server")
+	rootCmd.PersistentFlags().StringVar(&xmppRoomFlag, "xmpp-room", "", "MUC the room is mirrored in, e.g. team@conference.example.org")
+	rootCmd.PersistentFlags().BoolVar(&botFlag, "bot", false, "Answer commands sent in the room, such as !status and !help (rate limited)")
+	rootCmd.PersistentFlags().StringVar(&onFingerprintChangeFlag, "on-fingerprint-change", "refuse", "What to do when a known peer presents a different identity fingerprint (refuse, warn)")
+
+	rootCmd.Flags().BoolVar(&minimizedFlag, "minimized", false, "Start with the window minimized, as when started at login")
+	rootCmd.Flags().BoolVar(&rpcStdioFlag, "rpc-stdio", false, "Run without the GUI and speak JSON-RPC on stdin/stdout (one JSON object per line), for bots and scripts")
+
+	rootCmd.PersistentPreRunE = func(cmd *cobra.Command, args []string) error {
+		if rpcStdioFlag || cmd == joinCmd || cmd == relayCmd {
+			// stdout carries the protocol or the chat
+			logger.SetOutput(os.Stderr)
+		}
+		rootCmd.PersistentFlags().Visit(func(f *pflag.Flag) { changedFlags[f.Name] = true })
+		cfg, err := buildConfig()
+		if err != nil {
+			return err
+		}
+		baseConfig = cfg
 
-	rootCmd.PersistentPreRun = func(cmd *cobra.Command, args []string) {
-		if logLevelFlag != "" {
-			// apply user-provided level
-			lvl := logger.ParseLevel(logLevelFlag)
-			logger.SetLevel(lvl)
+		if cfg.Log.Level != "" {
+			logger.SetLevel(logger.ParseLevel(cfg.Log.Level))
+		}
+		if flagChanged("log-level") {
 			logger.L().Info("Log level set via CLI flag", "level", logLevelFlag)
 		}
+
+		// the same formatter serves the GUI and CLI output
+		if f, err := timefmt.New(cfg.Locale.Language, cfg.Locale.Timezone); err != nil {
+			logger.L().Warn("Invalid locale settings; using defaults", "err", err)
+		} else {
+			timefmt.SetDefault(f)
+		}
+		return nil
 	}
 }
 
 func main() {
+	crash.SetVersion(version)
+	defer crash.Exit()
+
 	// silence all logging to keep chat interface clean
 	log.SetOutput(io.Discard)
 	log.SetFlags(0)
@@ -63,12 +171,226 @@ func main() {
 
 	if err := rootCmd.Execute(); err != nil {
 		fmt.Fprintln(os.Stderr, err)
+		var exitErr *exitError
+		if errors.As(err, &exitErr) {
+			os.Exit(exitErr.code)
+		}
 		os.Exit(1)
 	}
 }
 
-func runApp() error {
+// exitError makes main exit with a code other than 1
+type exitError struct {
+	code int
+	err  error
+}
+
+func (e *exitError) Error() string { return e.err.Error() }
+func (e *exitError) Unwrap() error { return e.err }
+
+// buildConfig layers the config file, the EXECP2P_* environment and the
+// flags given over the defaults and validates the result
+func buildConfig() (*config.Config, error) {
 	cfg := config.DefaultConfig()
+	path, err := configPath()
+	if err != nil {
+		return nil, err
+	}
+	if err := config.LoadFile(path, cfg); err != nil {
+		// only a file asked for by name has to exist
+		if !errors.Is(err, os.ErrNotExist) {
+			return nil, err
+		}
+		if configFlag != "" {
+			return nil, fmt.Errorf("config file not found: %w", err)
+		}
+	}
+	if os.Getenv("ENTROPIA_LOG_LEVEL") != "" {
+		// the logger took its level from the environment, which wins over the file
+		cfg.Log.Level = ""
+	}
+	if err := config.LoadEnv(cfg); err != nil {
+		return nil, fmt.Errorf("invalid environment:\n%w", err)
+	}
+
+	if flagChanged("ephemeral") {
+		cfg.Identity.Ephemeral = ephemeralFlag
+	}
+	if flagChanged("keystore-protection") {
+		cfg.Identity.KeystoreProtection = keystoreProtectionFlag
+	}
+	if flagChanged("on-fingerprint-change") {
+		cfg.Trust.OnFingerprintChange = onFingerprintChangeFlag
+	}
+	if flagChanged("require-verified") {
+		cfg.Trust.RequireVerified = requireVerifiedFlag
+	}
+	if flagChanged("incognito") {
+		cfg.Room.Incognito = incognitoFlag
+	}
+	if flagChanged("room-ttl") {
+		cfg.Room.TTL = roomTTLFlag
+	}
+	if flagChanged("room-idle-timeout") {
+		cfg.Room.IdleTimeout = roomIdleTimeoutFlag
+	}
+	if flagChanged("rejoin") {
+		cfg.Room.Rejoin = rejoinFlag
+	}
+	if flagChanged("archive-file") {
+		cfg.Archive.File = archiveFileFlag
+	}
+	if flagChanged("archive-socket") {
+		cfg.Archive.Socket = archiveSocketFlag
+	}
+	if flagChanged("language") {
+		cfg.Locale.Language = languageFlag
+	}
+	if flagChanged("timezone") {
+		cfg.Locale.Timezone = timezoneFlag
+	}
+	if flagChanged("discovery-when-occupied") {
+		cfg.Discovery.WhenOccupied = whenOccupiedFlag
+	}
+	if flagChanged("no-history") {
+		cfg.History.Enabled = !noHistoryFlag
+	}
+	if flagChanged("mailbox-server") {
+		cfg.Mailbox.Server = mailboxServerFlag
+	}
+	if flagChanged("contact-me") {
+		cfg.Mailbox.ContactMe = contactMeFlag
+	}
+	if flagChanged("media-cache-size") {
+		cfg.Media.CacheLimit = mediaCacheFlag << 20
+	}
+	if flagChanged("ffmpeg") {
+		cfg.Voice.FFmpegPath = ffmpegFlag
+	}
+	if flagChanged("voice-input") {
+		cfg.Voice.Input = voiceInputFlag
+	}
+	if flagChanged("webhook-url") {
+		cfg.Webhook.URL = webhookURLFlag
+	}
+	if flagChanged("xmpp-server") {
+		cfg.XMPP.Server = xmppServerFlag
+	}
+	if flagChanged("xmpp-domain") {
+		cfg.XMPP.Domain = xmppDomainFlag
+	}
+	if flagChanged("xmpp-room") {
+		cfg.XMPP.Room = xmppRoomFlag
+	}
+	if flagChanged("bot") {
+		cfg.Bot.Enabled = botFlag
+	}
+	if flagChanged("log-level") {
+		cfg.Log.Level = logLevelFlag
+	}
+
+	if err := cfg.Validate(); err != nil {
+		return nil, fmt.Errorf("invalid configuration (%s):\n%w", path, err)
+	}
+	return cfg, nil
+}
+
+// configPath returns the config file given with --config, or the default one
+func configPath() (string, error) {
+	if configFlag != "" {
+		return configFlag, nil
+	}
+	return config.DefaultPath()
+}
+
+// flagChanged reports whether a global flag was given on the command line
+func flagChanged(name string) bool {
+	return changedFlags[name]
+}
+
+// loadConfig returns the runtime configuration, with the secrets taken from
+// the environment
+func loadConfig() *config.Config {
+	cfg := *baseConfig
+	return withSecrets(&cfg)
+}
+
+func withSecrets(cfg *config.Config) *config.Config {
+	cfg.Identity.Passphrase = os.Getenv("EXECP2P_KEYSTORE_PASSPHRASE")
+	cfg.Webhook.Secret = os.Getenv("EXECP2P_WEBHOOK_SECRET")
+	cfg.XMPP.Secret = os.Getenv("EXECP2P_XMPP_SECRET")
+	return cfg
+}
+
+// watchConfig makes e apply changes to the config file, noticed by polling
+// or signalled with SIGHUP, until ctx ends. The flags given at startup keep
+// overriding the file.
+func watchConfig(ctx context.Context, e *app.ExecP2P) {
+	path, err := configPath()
+	if err != nil {
+		logger.L().Warn("Configuration can't be reloaded", "err", err)
+		return
+	}
+	e.SetConfigSource(path, func() (*config.Config, error) {
+		cfg, err := buildConfig()
+		if err != nil {
+			return nil, err
+		}
+		return withSecrets(cfg), nil
+	})
+	reload := func() {
+		if _, err := e.ReloadConfig(); err != nil {
+			logger.L().Warn("Configuration not reloaded", "err", err)
+		}
+	}
+	go config.Watch(ctx, path, config.WatchInterval, reload)
+
+	hangup := make(chan os.Signal, 1)
+	signal.Notify(hangup, syscall.SIGHUP)
+	go func() {
+		defer signal.Stop(hangup)
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-hangup:
+				reload()
+			}
+		}
+	}()
+}
+
+func runApp(args []string) error {
+	var invite *room.Invite
+	if len(args) > 0 {
+		parsed, err := room.ParseInvite(args[0])
+		if err != nil {
+			return err
+		}
+		invite = &parsed
+	}
+
+	// a second launch hands its invite to the first one and exits
+	lock, err := acquireInstance(args)
+	if err == instance.ErrRunning {
+		if invite != nil {
+			fmt.Fprintln(os.Stderr, "ExecP2P is already running; the invite link was passed to it.")
+		} else {
+			fmt.Fprintln(os.Stderr, "ExecP2P is already running; its window was brought to the front.")
+		}
+		return nil
+	}
+	if errors.Is(err, instance.ErrRunning) {
+		// the running window didn't answer in time
+		return err
+	}
+	if err != nil {
+		logger.L().Warn("Running without the single-instance lock", "err", err)
+	} else {
+		defer lock.Close()
+	}
+
+	cfg := loadConfig()
 
 	// Inicjalizacja back-endu ExecP2P
 	entApp, err := app.NewExecP2P(cfg)
@@ -77,8 +399,18 @@ func runApp() error {
 	}
 	defer entApp.Close()
 
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	watchConfig(ctx, entApp)
+
 	// Tworzenie mostu Wails-ExecP2P
 	bridge := wailsbridge.NewBridge(entApp)
+	if invite != nil {
+		bridge.ReceiveInvite(*invite)
+	}
+	if lock != nil {
+		go forwardHandoffs(lock, bridge)
+	}
 
 	// Uruchomienie Wails
 	// Inicjalizacja ustawień specyficznych dla platformy
@@ -86,14 +418,27 @@ func runApp() error {
 		logger.L().Warn("Failed to initialize platform-specific settings", "err", err)
 	}
 
+	// started at login (Settings → Uruchamianie): stay out of the way
+	startState := options.Normal
+	if minimizedFlag {
+		startState = options.Minimised
+	}
+
 	err = wails.Run(&options.App{
-		Title:  "ExecP2P",
-		Width:  1280,
-		Height: 800,
+		Title:            "ExecP2P",
+		Width:            1280,
+		Height:           800,
+		WindowStartState: startState,
 		AssetServer: &assetserver.Options{
 			Assets: assets,
+			// zdjęcia i nagrania z czatu (/media/<id>)
+			Handler: wailsbridge.NewMediaHandler(entApp),
 		},
 		BackgroundColour: &options.RGBA{R: 18, G: 18, B: 18, A: 1},
+		// upuszczone pliki trafiają do czatu (runtime.OnFileDrop we frontendzie)
+		DragAndDrop: &options.DragAndDrop{EnableFileDrop: true},
+		// macOS opens execp2p:// links in the running app, not in a new process
+		Mac: &mac.Options{OnUrlOpen: func(link string) { bridge.ReceiveInviteLink(link) }},
 		OnStartup: func(ctx context.Context) {
 			logger.L().Info("Application starting", "os", platform.GetOSName(), "arch", runtime.GOARCH)
 			bridge.SetContext(ctx)
@@ -109,3 +454,26 @@ func runApp() error {
 
 	return nil
 }
+
+// acquireInstance takes the single-instance lock of the GUI, a socket in the
+// data directory; instance.ErrRunning when another window holds it
+func acquireInstance(args []string) (*instance.Lock, error) {
+	dataDir, err := paths.Data()
+	if err != nil {
+		return nil, err
+	}
+	return instance.Acquire(filepath.Join(dataDir, "instance.sock"), args)
+}
+
+// forwardHandoffs passes the invite links of later launches to the window;
+// a launch without one only brings the window to the front
+func forwardHandoffs(lock *instance.Lock, bridge *wailsbridge.Bridge) {
+	defer crash.Recover("main.forwardHandoffs")
+	for args := range lock.Handoffs() {
+		if len(args) == 0 {
+			bridge.Raise()
+			continue
+		}
+		bridge.ReceiveInviteLink(args[0])
+	}
+}
@@ -0,0 +1,310 @@
+// Package execp2p embeds the ExecP2P engine in other Go programs: rooms,
+// the post-quantum encrypted QUIC transport, peer discovery and identity
+// pinning, without the desktop GUI or the command line.
+//
+//	client, err := execp2p.New(execp2p.Options{Ephemeral: true})
+//	if err != nil { ... }
+//	defer client.Close()
+//
+//	room, err := client.CreateRoom(ctx)
+//	// share room.ID and room.AccessKey with the other side, which calls Join
+//
+//	messages, stop := client.Subscribe()
+//	defer stop()
+//	for msg := range messages {
+//		fmt.Println(msg.SenderName, msg.Text)
+//	}
+//
+// A Client is in at most one room at a time; Leave frees it for the next.
+package execp2p
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"sync"
+	"time"
+
+	"execp2p/internal/app"
+	"execp2p/internal/config"
+	"execp2p/internal/crypto"
+	"execp2p/internal/logger"
+)
+
+var (
+	// ErrInRoom is returned when creating or joining a room while already in one
+	ErrInRoom = errors.New("already in a room")
+	// ErrClosed is returned by a Client after Close
+	ErrClosed = errors.New("client closed")
+)
+
+// Options configures a Client. The zero value uses the persistent identity
+// in the platform data directory, protected by the system keychain.
+type Options struct {
+	// Ephemeral generates a throw-away identity instead of using the keystore
+	Ephemeral bool
+	// DataDir holds the keystore and the local database; empty means the platform default
+	DataDir string
+	// Passphrase protects the keystore instead of the system keychain
+	Passphrase string
+
+	// MinPort and MaxPort bound the port a created room listens on (default 8000-9000)
+	MinPort, MaxPort int
+
+	// Incognito keeps created rooms in memory only
+	Incognito bool
+
+	// Logger receives the engine's logs; nil keeps them discarded
+	Logger *slog.Logger
+}
+
+// Room describes a room the Client created
+type Room struct {
+	ID        string
+	AccessKey string
+	Port      int
+	Incognito bool
+}
+
+// Message is an incoming chat message
+type Message struct {
+	ID         string
+	SenderID   string
+	SenderName string
+	// Type is "text" for plain messages; the GUI also sends "image", "audio" and "gif"
+	Type      string
+	Text      string
+	MediaURL  string
+	Timestamp time.Time
+}
+
+// Client is an ExecP2P peer
+type Client struct {
+	engine *app.ExecP2P
+
+	ctx    context.Context
+	cancel context.CancelFunc
+
+	mu     sync.Mutex
+	inRoom bool
+	closed bool
+	// ends the current room's context
+	cancelRoom context.CancelFunc
+}
+
+// New starts a peer with the given options
+func New(opts Options) (*Client, error) {
+	if opts.Logger != nil {
+		logger.Set(opts.Logger)
+	}
+
+	cfg := config.DefaultConfig()
+	cfg.Identity.Ephemeral = opts.Ephemeral
+	cfg.Identity.DataDir = opts.DataDir
+	if opts.Passphrase != "" {
+		cfg.Identity.KeystoreProtection = "passphrase"
+		cfg.Identity.Passphrase = opts.Passphrase
+	}
+	if opts.MinPort > 0 {
+		cfg.Network.MinPort = opts.MinPort
+	}
+	if opts.MaxPort > 0 {
+		cfg.Network.MaxPort = opts.MaxPort
+	}
+	if cfg.Network.MaxPort < cfg.Network.MinPort {
+		return nil, fmt.Errorf("invalid port range %d-%d", cfg.Network.MinPort, cfg.Network.MaxPort)
+	}
+	cfg.Room.Incognito = opts.Incognito
+
+	engine, err := app.NewExecP2P(cfg)
+	if err != nil {
+		return nil, fmt.Errorf("failed to initialize ExecP2P: %w", err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	return &Client{engine: engine, ctx: ctx, cancel: cancel}, nil
+}
+
+// CreateRoom creates a room and waits for peers. ctx bounds only the setup;
+// the room stays open until Close.
+func (c *Client) CreateRoom(ctx context.Context) (Room, error) {
+	var room Room
+	err := c.enterRoom(ctx, func(roomCtx context.Context) error {
+		result, err := c.engine.CreateRoom(roomCtx)
+		if err != nil {
+			return err
+		}
+		room = Room{ID: result.RoomID, AccessKey: result.AccessKey, Port: result.ListenPort, Incognito: result.Incognito}
+		return nil
+	})
+	return room, err
+}
+
+// Join finds a room by ID (local network, DHT, signaling server) and joins
+// it with the access key. ctx bounds only the connection attempt.
+func (c *Client) Join(ctx context.Context, roomID, accessKey string) error {
+	return c.enterRoom(ctx, func(roomCtx context.Context) error {
+		return c.engine.JoinRoomWithFallback(roomCtx, roomID, accessKey)
+	})
+}
+
+// JoinAddr joins a room whose host address ("host:port") is already known
+func (c *Client) JoinAddr(ctx context.Context, roomID, addr, accessKey string) error {
+	return c.enterRoom(ctx, func(roomCtx context.Context) error {
+		return c.engine.JoinRoom(roomCtx, roomID, addr, accessKey)
+	})
+}
+
+// enterRoom runs create or join under a context that lives as long as the
+// Client; cancelling ctx before it finishes abandons the room
+func (c *Client) enterRoom(ctx context.Context, enter func(context.Context) error) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.closed {
+		return ErrClosed
+	}
+	if c.inRoom {
+		return ErrInRoom
+	}
+
+	roomCtx, cancelRoom := context.WithCancel(c.ctx)
+	stop := context.AfterFunc(ctx, cancelRoom)
+	err := enter(roomCtx)
+	if !stop() {
+		cancelRoom()
+		return ctx.Err()
+	}
+	if err != nil {
+		cancelRoom()
+		return err
+	}
+	c.inRoom = true
+	c.cancelRoom = cancelRoom
+	return nil
+}
+
+// Leave leaves the room; the Client can then create or join another one.
+// Subscriptions stay open.
+func (c *Client) Leave() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.closed {
+		return ErrClosed
+	}
+	if !c.inRoom {
+		return fmt.Errorf("not in a room")
+	}
+	c.engine.LeaveRoom()
+	c.cancelRoom()
+	c.inRoom = false
+	return nil
+}
+
+// Send sends a text message to the room
+func (c *Client) Send(ctx context.Context, text string) error {
+	if err := c.ready(); err != nil {
+		return err
+	}
+	return c.engine.SendMessage(ctx, text)
+}
+
+// SetNickname sets the name other members see and announces it to the room
+func (c *Client) SetNickname(ctx context.Context, nickname string) error {
+	if err := c.ready(); err != nil {
+		return err
+	}
+	c.engine.SetLocalNickname(nickname)
+	msg, err := json.Marshal(map[string]string{"type": "nickname_update", "nickname": nickname})
+	if err != nil {
+		return err
+	}
+	return c.engine.SendMessage(ctx, string(msg))
+}
+
+// Subscribe returns incoming messages until stop is called or the Client is
+// closed. Every subscriber gets every message; one that falls far behind
+// misses newer messages rather than holding up the others.
+func (c *Client) Subscribe() (<-chan Message, func()) {
+	raw, stop := c.engine.Subscribe(0)
+	out := make(chan Message, cap(raw))
+	go func() {
+		defer close(out)
+		for payload := range raw {
+			if msg, ok := c.decode(payload); ok {
+				out <- msg
+			}
+		}
+	}()
+	return out, stop
+}
+
+// decode turns a payload into a Message; protocol messages (keep-alives,
+// nickname updates) are handled here and not delivered
+func (c *Client) decode(payload *crypto.MessagePayload) (Message, bool) {
+	msg := Message{
+		ID:         payload.MessageID,
+		SenderID:   payload.SenderID,
+		SenderName: c.engine.DisplayName(payload.SenderID),
+		Type:       "text",
+		Text:       payload.Message,
+		Timestamp:  payload.Timestamp,
+	}
+
+	// the GUI sends typed messages as JSON: {"type", "content", "mediaUrl"}
+	var typed struct {
+		Type     string `json:"type"`
+		Content  string `json:"content"`
+		MediaURL string `json:"mediaUrl"`
+		Nickname string `json:"nickname"`
+	}
+	if err := json.Unmarshal([]byte(payload.Message), &typed); err != nil || typed.Type == "" {
+		return msg, true
+	}
+	switch typed.Type {
+	case "keep_alive":
+		return msg, false
+	case "nickname_update":
+		c.engine.SetPeerNickname(payload.SenderID, typed.Nickname)
+		return msg, false
+	}
+	msg.Type = typed.Type
+	msg.Text = typed.Content
+	msg.MediaURL = typed.MediaURL
+	return msg, true
+}
+
+// Fingerprint returns our identity fingerprint, for comparing out of band
+func (c *Client) Fingerprint() (string, error) {
+	return c.engine.GetPeerFingerprint()
+}
+
+// PeerFingerprints returns the connected peers' fingerprints by peer ID
+func (c *Client) PeerFingerprints() map[string]string {
+	return c.engine.PeerFingerprints()
+}
+
+// Close leaves the room and shuts the peer down; subscriptions end
+func (c *Client) Close() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.closed {
+		return nil
+	}
+	c.closed = true
+	c.cancel()
+	c.engine.Close()
+	return nil
+}
+
+func (c *Client) ready() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.closed {
+		return ErrClosed
+	}
+	if !c.inRoom {
+		return fmt.Errorf("not in a room")
+	}
+	return nil
+}
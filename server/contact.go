@@ -0,0 +1,234 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"log"
+	"net/http"
+	"regexp"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/gorilla/mux"
+)
+
+// Wizytówki pozwalają napisać do kogoś, kogo się jeszcze nie spotkało,
+// znając tylko jego ID użytkownika. Klient publikuje pod swoim ID
+// podpisany pakiet kluczy (klucz Kyber do jednorazowego użytku przez kilka
+// dni i adres skrzynki). Pierwsza wiadomość trafia do tej skrzynki
+// zapieczętowana razem z tożsamością nadawcy, więc serwer nie wie, kto pisze.
+// Serwer nie sprawdza podpisu - robi to odbiorca wizytówki. Pilnuje tylko,
+// żeby wizytówkę mógł zmienić lub usunąć wyłącznie właściciel skrzynki,
+// na którą wskazuje.
+//
+// ID użytkownika jest losowe i nie wynika z klucza, więc serwer nie wie,
+// czyje jest - zajmuje je pierwszy, kto pod nim opublikuje. Nowe zajęcie
+// trwa tylko contactClaimTTL. Pełną ważność wizytówki dostaje właściciel,
+// który opublikuje ją ponownie po contactClaimAge, jak klient robi co
+// dzień. Kto chce przetrzymać cudze ID, musi więc do niego wracać, a limit
+// adresu IP i limity całego serwera nie pozwalają zająć wielu naraz.
+
+const (
+	contactMaxSize = 64 << 10            // największa wizytówka
+	contactMaxTTL  = 31 * 24 * time.Hour // najdłuższa ważność wizytówki
+
+	contactClaimTTL = 48 * time.Hour // jak długo trwa nowe zajęcie ID
+	contactClaimAge = 20 * time.Hour // po tym czasie ponowna publikacja utrwala zajęcie
+
+	contactMaxEntries    = 100000      // wizytówek na całym serwerze
+	contactMaxTotalBytes = 256 << 20   // bajtów we wszystkich wizytówkach
+	publishInterval      = time.Minute // jedna publikacja na minutę z adresu IP...
+	publishBurst         = 10          // ...po serii do tylu publikacji
+)
+
+var userIDPattern = regexp.MustCompile(`^[0-9a-f]{32}$`)
+
+type contactEntry struct {
+	data    []byte
+	owner   string    // identyfikator skrzynki właściciela
+	claimed time.Time // od kiedy właściciel zajmuje ID
+	expires time.Time
+}
+
+// ContactStore trzyma wizytówki w pamięci
+type ContactStore struct {
+	mu       sync.Mutex
+	contacts map[string]contactEntry
+	bytes    int // we wszystkich wizytówkach
+
+	maxEntries int
+	maxBytes   int
+	publishes  *ipLimiter
+}
+
+func NewContactStore() *ContactStore {
+	store := newContactStore(contactMaxEntries, contactMaxTotalBytes, newIPLimiter(publishInterval, publishBurst))
+	go store.cleanupExpired()
+	return store
+}
+
+func newContactStore(maxEntries, maxBytes int, publishes *ipLimiter) *ContactStore {
+	return &ContactStore{
+		contacts:   make(map[string]contactEntry),
+		maxEntries: maxEntries,
+		maxBytes:   maxBytes,
+		publishes:  publishes,
+	}
+}
+
+// Obsługuje publikację wizytówki przez właściciela skrzynki
+func (s *ContactStore) handlePublish(w http.ResponseWriter, r *http.Request) {
+	userID := mux.Vars(r)["userID"]
+	if !userIDPattern.MatchString(userID) {
+		http.Error(w, "Nieprawidłowe ID użytkownika", http.StatusBadRequest)
+		return
+	}
+	owner, ok := mailboxOwner(w, r)
+	if !ok {
+		return
+	}
+	// przed czytaniem treści, jak przy kopertach
+	if ok, wait := s.publishes.allow(clientIP(r), time.Now()); !ok {
+		w.Header().Set("Retry-After", strconv.Itoa(int(wait/time.Second)+1))
+		http.Error(w, "Za dużo wizytówek z tego adresu, spróbuj później", http.StatusTooManyRequests)
+		return
+	}
+	var req struct {
+		Data []byte `json:"data"`
+	}
+	if err := json.NewDecoder(io.LimitReader(r.Body, 2*contactMaxSize)).Decode(&req); err != nil || len(req.Data) == 0 {
+		http.Error(w, "Nieprawidłowy format JSON", http.StatusBadRequest)
+		return
+	}
+	if len(req.Data) > contactMaxSize {
+		http.Error(w, "Wizytówka jest za duża", http.StatusRequestEntityTooLarge)
+		return
+	}
+	var bundle struct {
+		UserID    string    `json:"user_id"`
+		MailboxID string    `json:"mailbox_id"`
+		Expires   time.Time `json:"expires"`
+	}
+	if err := json.Unmarshal(req.Data, &bundle); err != nil {
+		http.Error(w, "Nieprawidłowa wizytówka", http.StatusBadRequest)
+		return
+	}
+	if bundle.UserID != userID || bundle.MailboxID != owner {
+		http.Error(w, "Wizytówka nie należy do tej skrzynki", http.StatusForbidden)
+		return
+	}
+	now := time.Now()
+	if !bundle.Expires.After(now) || bundle.Expires.After(now.Add(contactMaxTTL)) {
+		http.Error(w, "Nieprawidłowa data ważności wizytówki", http.StatusBadRequest)
+		return
+	}
+
+	s.mu.Lock()
+	old, exists := s.contacts[userID]
+	held := exists && old.expires.After(now)
+	if held && old.owner != owner {
+		s.mu.Unlock()
+		http.Error(w, "To ID użytkownika jest zajęte", http.StatusConflict)
+		return
+	}
+	if !exists && len(s.contacts) >= s.maxEntries {
+		s.mu.Unlock()
+		http.Error(w, "Serwer nie przyjmuje nowych wizytówek", http.StatusInsufficientStorage)
+		return
+	}
+	if s.bytes-len(old.data)+len(req.Data) > s.maxBytes {
+		s.mu.Unlock()
+		http.Error(w, "Serwer nie ma miejsca na wizytówki", http.StatusInsufficientStorage)
+		return
+	}
+	entry := contactEntry{data: req.Data, owner: owner, claimed: now, expires: bundle.Expires}
+	if held {
+		entry.claimed = old.claimed
+	}
+	if now.Sub(entry.claimed) < contactClaimAge {
+		entry.expires = minTime(entry.expires, entry.claimed.Add(contactClaimTTL))
+	}
+	s.contacts[userID] = entry
+	s.bytes += len(req.Data) - len(old.data)
+	s.mu.Unlock()
+
+	w.WriteHeader(http.StatusOK)
+	w.Write([]byte(`{"status": "ok"}`))
+}
+
+// Obsługuje pobranie wizytówki - może to zrobić każdy
+func (s *ContactStore) handleLookup(w http.ResponseWriter, r *http.Request) {
+	userID := mux.Vars(r)["userID"]
+	s.mu.Lock()
+	entry, ok := s.contacts[userID]
+	s.mu.Unlock()
+	if !ok || time.Now().After(entry.expires) {
+		http.Error(w, "Nie ma wizytówki dla tego ID", http.StatusNotFound)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string][]byte{"data": entry.data})
+}
+
+// Obsługuje usunięcie wizytówki przez właściciela
+func (s *ContactStore) handleDelete(w http.ResponseWriter, r *http.Request) {
+	userID := mux.Vars(r)["userID"]
+	owner, ok := mailboxOwner(w, r)
+	if !ok {
+		return
+	}
+	s.mu.Lock()
+	entry, exists := s.contacts[userID]
+	if exists && entry.owner != owner {
+		s.mu.Unlock()
+		http.Error(w, "Wizytówka nie należy do tej skrzynki", http.StatusForbidden)
+		return
+	}
+	delete(s.contacts, userID)
+	s.bytes -= len(entry.data)
+	s.mu.Unlock()
+
+	w.WriteHeader(http.StatusOK)
+	w.Write([]byte(`{"status": "ok"}`))
+}
+
+// mailboxOwner zwraca identyfikator skrzynki, której sekret podano w nagłówku
+func mailboxOwner(w http.ResponseWriter, r *http.Request) (string, bool) {
+	secret, err := hex.DecodeString(r.Header.Get(mailboxSecretHdr))
+	if err != nil || len(secret) == 0 {
+		http.Error(w, "Brak sekretu skrzynki", http.StatusUnauthorized)
+		return "", false
+	}
+	sum := sha256.Sum256(secret)
+	return hex.EncodeToString(sum[:]), true
+}
+
+func minTime(a, b time.Time) time.Time {
+	if b.Before(a) {
+		return b
+	}
+	return a
+}
+
+// Usuwa wygasłe wizytówki
+func (s *ContactStore) cleanupExpired() {
+	ticker := time.NewTicker(time.Hour)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		now := time.Now()
+		s.publishes.prune(now)
+		s.mu.Lock()
+		for userID, entry := range s.contacts {
+			if now.After(entry.expires) {
+				delete(s.contacts, userID)
+				s.bytes -= len(entry.data)
+				log.Printf("Usunięto wygasłą wizytówkę: %s…", userID[:8])
+			}
+		}
+		s.mu.Unlock()
+	}
+}
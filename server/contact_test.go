@@ -0,0 +1,132 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/mux"
+)
+
+func contactRouter(s *ContactStore) *mux.Router {
+	router := mux.NewRouter()
+	router.HandleFunc("/api/contact/{userID}", s.handlePublish).Methods("PUT")
+	return router
+}
+
+// publish wysyła wizytówkę użytkownika user (cyfra szesnastkowa) do
+// skrzynki, której sekretem jest secret
+func publish(t *testing.T, router http.Handler, user byte, secret, ip string, expires time.Time) int {
+	t.Helper()
+	userID := strings.Repeat(string("0123456789abcdef"[user%16]), 32)
+	sum := sha256.Sum256([]byte(secret))
+	bundle, _ := json.Marshal(map[string]any{
+		"user_id":    userID,
+		"mailbox_id": hex.EncodeToString(sum[:]),
+		"expires":    expires,
+	})
+	body, _ := json.Marshal(map[string][]byte{"data": bundle})
+	req := httptest.NewRequest("PUT", "/api/contact/"+userID, strings.NewReader(string(body)))
+	req.Header.Set(mailboxSecretHdr, hex.EncodeToString([]byte(secret)))
+	req.RemoteAddr = ip + ":40000"
+	rec := httptest.NewRecorder()
+	router.ServeHTTP(rec, req)
+	return rec.Code
+}
+
+func TestPublishLimits(t *testing.T) {
+	expires := time.Now().Add(24 * time.Hour)
+
+	tests := []struct {
+		name       string
+		maxEntries int
+		maxBytes   int
+		burst      int
+		// użytkownik i adres kolejnych wizytówek
+		users []byte
+		ips   []string
+		want  []int
+	}{
+		{
+			name: "limit wizytówek", maxEntries: 2, maxBytes: 1 << 20, burst: 10,
+			users: []byte{1, 2, 3, 1},
+			ips:   []string{"10.0.0.1", "10.0.0.2", "10.0.0.3", "10.0.0.4"},
+			want:  []int{http.StatusOK, http.StatusOK, http.StatusInsufficientStorage, http.StatusOK},
+		},
+		{
+			name: "limit bajtów", maxEntries: 10, maxBytes: 400, burst: 10,
+			users: []byte{1, 2, 3},
+			ips:   []string{"10.0.0.1", "10.0.0.2", "10.0.0.3"},
+			want:  []int{http.StatusOK, http.StatusOK, http.StatusInsufficientStorage},
+		},
+		{
+			name: "limit adresu", maxEntries: 10, maxBytes: 1 << 20, burst: 2,
+			users: []byte{1, 2, 3, 4},
+			ips:   []string{"10.0.0.1", "10.0.0.1", "10.0.0.1", "10.0.0.2"},
+			want:  []int{http.StatusOK, http.StatusOK, http.StatusTooManyRequests, http.StatusOK},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			store := newContactStore(tt.maxEntries, tt.maxBytes, newIPLimiter(time.Hour, tt.burst))
+			router := contactRouter(store)
+			for i, want := range tt.want {
+				// każdy użytkownik publikuje ze swojej skrzynki
+				secret := "sekret " + string('0'+tt.users[i])
+				if got := publish(t, router, tt.users[i], secret, tt.ips[i], expires); got != want {
+					t.Errorf("wizytówka %d: %d, oczekiwano %d", i, got, want)
+				}
+			}
+		})
+	}
+}
+
+func TestContactClaim(t *testing.T) {
+	store := newContactStore(10, 1<<20, newIPLimiter(time.Hour, 10))
+	router := contactRouter(store)
+	userID := strings.Repeat("1", 32)
+	expires := time.Now().Add(30 * 24 * time.Hour)
+
+	if got := publish(t, router, 1, "właściciel", "10.0.0.1", expires); got != http.StatusOK {
+		t.Fatalf("pierwsza publikacja: %d", got)
+	}
+	// nowe zajęcie trwa krótko, choć wizytówka jest ważna miesiąc
+	if e := store.contacts[userID]; e.expires.After(time.Now().Add(contactClaimTTL)) {
+		t.Fatalf("nowe zajęcie do %v", e.expires)
+	}
+	if got := publish(t, router, 1, "ktoś inny", "10.0.0.2", expires); got != http.StatusConflict {
+		t.Fatalf("cudza publikacja: %d, oczekiwano %d", got, http.StatusConflict)
+	}
+
+	// ponowna publikacja zaraz po zajęciu go nie przedłuża
+	if got := publish(t, router, 1, "właściciel", "10.0.0.1", expires); got != http.StatusOK {
+		t.Fatalf("ponowna publikacja: %d", got)
+	}
+	if e := store.contacts[userID]; e.expires.After(time.Now().Add(contactClaimTTL)) {
+		t.Fatalf("zajęcie przedłużone do %v", e.expires)
+	}
+
+	// po contactClaimAge wizytówka dostaje pełną ważność
+	e := store.contacts[userID]
+	e.claimed = e.claimed.Add(-contactClaimAge)
+	store.contacts[userID] = e
+	if got := publish(t, router, 1, "właściciel", "10.0.0.1", expires); got != http.StatusOK {
+		t.Fatalf("publikacja po %v: %d", contactClaimAge, got)
+	}
+	if e := store.contacts[userID]; !e.expires.Equal(expires) {
+		t.Fatalf("ważność %v, oczekiwano %v", e.expires, expires)
+	}
+
+	// wygasłe zajęcie może przejąć ktoś inny
+	e = store.contacts[userID]
+	e.expires = time.Now().Add(-time.Minute)
+	store.contacts[userID] = e
+	if got := publish(t, router, 1, "ktoś inny", "10.0.0.2", expires); got != http.StatusOK {
+		t.Fatalf("przejęcie wygasłego ID: %d", got)
+	}
+}
@@ -0,0 +1,248 @@
+package main
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"log"
+	"net/http"
+	"regexp"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/gorilla/mux"
+)
+
+// Skrzynka przechowuje zaszyfrowane wiadomości dla użytkowników offline.
+// Serwer widzi tylko nieprzezroczyste koperty zapieczętowane kluczem Kyber
+// odbiorcy - nigdy treści. Identyfikator skrzynki to SHA-256 sekretu,
+// który zna tylko odbiorca; odczyt i potwierdzenie wymagają tego sekretu,
+// zostawić wiadomość może każdy.
+
+const (
+	mailboxMaxItemSize = 256 << 10          // największa koperta
+	mailboxMaxItems    = 500                // kopert w jednej skrzynce
+	mailboxMaxBytes    = 32 << 20           // bajtów w jednej skrzynce
+	mailboxTTL         = 7 * 24 * time.Hour // po tym czasie koperta znika
+	mailboxSecretHdr   = "X-Mailbox-Secret"
+
+	// Zostawić kopertę może każdy, więc bez limitów całego serwera kilka
+	// adresów zapełniłoby jego pamięć milionami skrzynek.
+	mailboxMaxBoxes      = 100000      // skrzynek na całym serwerze
+	mailboxMaxTotalBytes = 1 << 30     // bajtów we wszystkich skrzynkach
+	depositInterval      = time.Second // jedna koperta na sekundę z adresu IP...
+	depositBurst         = 60          // ...po serii do tylu kopert
+)
+
+var mailboxIDPattern = regexp.MustCompile(`^[0-9a-f]{64}$`)
+
+// MailboxItem to jedna zaparkowana koperta
+type MailboxItem struct {
+	ID       string `json:"id"`
+	Data     []byte `json:"data"`
+	Received int64  `json:"received"`
+}
+
+type mailbox struct {
+	items []MailboxItem
+	bytes int
+}
+
+// MailboxStore trzyma skrzynki w pamięci
+type MailboxStore struct {
+	mu        sync.Mutex
+	mailboxes map[string]*mailbox
+	bytes     int // we wszystkich skrzynkach
+
+	maxBoxes int
+	maxBytes int
+	deposits *ipLimiter
+}
+
+func NewMailboxStore() *MailboxStore {
+	store := newMailboxStore(mailboxMaxBoxes, mailboxMaxTotalBytes, newIPLimiter(depositInterval, depositBurst))
+	go store.cleanupExpired()
+	return store
+}
+
+func newMailboxStore(maxBoxes, maxBytes int, deposits *ipLimiter) *MailboxStore {
+	return &MailboxStore{
+		mailboxes: make(map[string]*mailbox),
+		maxBoxes:  maxBoxes,
+		maxBytes:  maxBytes,
+		deposits:  deposits,
+	}
+}
+
+// Obsługuje zostawienie koperty w skrzynce
+func (s *MailboxStore) handleDeposit(w http.ResponseWriter, r *http.Request) {
+	id := mux.Vars(r)["mailboxID"]
+	if !mailboxIDPattern.MatchString(id) {
+		http.Error(w, "Nieprawidłowy identyfikator skrzynki", http.StatusBadRequest)
+		return
+	}
+	// przed czytaniem treści, żeby zalewający adres nic nie kosztował
+	if ok, wait := s.deposits.allow(clientIP(r), time.Now()); !ok {
+		w.Header().Set("Retry-After", strconv.Itoa(int(wait/time.Second)+1))
+		http.Error(w, "Za dużo kopert z tego adresu, spróbuj później", http.StatusTooManyRequests)
+		return
+	}
+	var req struct {
+		Data []byte `json:"data"`
+	}
+	if err := json.NewDecoder(io.LimitReader(r.Body, 2*mailboxMaxItemSize)).Decode(&req); err != nil || len(req.Data) == 0 {
+		http.Error(w, "Nieprawidłowy format JSON", http.StatusBadRequest)
+		return
+	}
+	if len(req.Data) > mailboxMaxItemSize {
+		http.Error(w, "Koperta jest za duża", http.StatusRequestEntityTooLarge)
+		return
+	}
+
+	itemID := make([]byte, 16)
+	rand.Read(itemID)
+	item := MailboxItem{ID: hex.EncodeToString(itemID), Data: req.Data, Received: time.Now().Unix()}
+
+	s.mu.Lock()
+	box, ok := s.mailboxes[id]
+	if !ok && len(s.mailboxes) >= s.maxBoxes {
+		s.mu.Unlock()
+		http.Error(w, "Serwer nie przyjmuje nowych skrzynek", http.StatusInsufficientStorage)
+		return
+	}
+	if s.bytes+len(item.Data) > s.maxBytes {
+		s.mu.Unlock()
+		http.Error(w, "Serwer nie ma miejsca na koperty", http.StatusInsufficientStorage)
+		return
+	}
+	if ok && (len(box.items) >= mailboxMaxItems || box.bytes+len(item.Data) > mailboxMaxBytes) {
+		s.mu.Unlock()
+		http.Error(w, "Skrzynka jest pełna", http.StatusInsufficientStorage)
+		return
+	}
+	if !ok {
+		box = &mailbox{}
+		s.mailboxes[id] = box
+	}
+	box.items = append(box.items, item)
+	box.bytes += len(item.Data)
+	s.bytes += len(item.Data)
+	s.mu.Unlock()
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]string{"id": item.ID})
+}
+
+// Obsługuje odczyt skrzynki przez jej właściciela
+func (s *MailboxStore) handleFetch(w http.ResponseWriter, r *http.Request) {
+	id, ok := s.authorize(w, r)
+	if !ok {
+		return
+	}
+	s.mu.Lock()
+	var items []MailboxItem
+	if box, ok := s.mailboxes[id]; ok {
+		items = append(items, box.items...)
+	}
+	s.mu.Unlock()
+
+	if items == nil {
+		items = []MailboxItem{}
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(items)
+}
+
+// Obsługuje potwierdzenie odbioru - potwierdzone koperty są usuwane
+func (s *MailboxStore) handleAck(w http.ResponseWriter, r *http.Request) {
+	id, ok := s.authorize(w, r)
+	if !ok {
+		return
+	}
+	var req struct {
+		IDs []string `json:"ids"`
+	}
+	if err := json.NewDecoder(io.LimitReader(r.Body, 1<<20)).Decode(&req); err != nil {
+		http.Error(w, "Nieprawidłowy format JSON", http.StatusBadRequest)
+		return
+	}
+	acked := make(map[string]struct{}, len(req.IDs))
+	for _, itemID := range req.IDs {
+		acked[itemID] = struct{}{}
+	}
+
+	s.mu.Lock()
+	if box, ok := s.mailboxes[id]; ok {
+		kept := box.items[:0]
+		for _, item := range box.items {
+			if _, done := acked[item.ID]; done {
+				box.bytes -= len(item.Data)
+				s.bytes -= len(item.Data)
+				continue
+			}
+			kept = append(kept, item)
+		}
+		box.items = kept
+		if len(box.items) == 0 {
+			delete(s.mailboxes, id)
+		}
+	}
+	s.mu.Unlock()
+
+	w.WriteHeader(http.StatusOK)
+	w.Write([]byte(`{"status": "ok"}`))
+}
+
+// authorize sprawdza, czy sekret z nagłówka pasuje do identyfikatora skrzynki
+func (s *MailboxStore) authorize(w http.ResponseWriter, r *http.Request) (string, bool) {
+	id := mux.Vars(r)["mailboxID"]
+	if !mailboxIDPattern.MatchString(id) {
+		http.Error(w, "Nieprawidłowy identyfikator skrzynki", http.StatusBadRequest)
+		return "", false
+	}
+	secret, err := hex.DecodeString(r.Header.Get(mailboxSecretHdr))
+	if err != nil || len(secret) == 0 {
+		http.Error(w, "Brak sekretu skrzynki", http.StatusUnauthorized)
+		return "", false
+	}
+	sum := sha256.Sum256(secret)
+	if subtle.ConstantTimeCompare([]byte(hex.EncodeToString(sum[:])), []byte(id)) != 1 {
+		http.Error(w, "Nieprawidłowy sekret skrzynki", http.StatusForbidden)
+		return "", false
+	}
+	return id, true
+}
+
+// Usuwa koperty starsze niż mailboxTTL
+func (s *MailboxStore) cleanupExpired() {
+	ticker := time.NewTicker(10 * time.Minute)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		now := time.Now()
+		s.deposits.prune(now)
+		cutoff := now.Add(-mailboxTTL).Unix()
+		s.mu.Lock()
+		for id, box := range s.mailboxes {
+			kept := box.items[:0]
+			for _, item := range box.items {
+				if item.Received < cutoff {
+					box.bytes -= len(item.Data)
+					s.bytes -= len(item.Data)
+					continue
+				}
+				kept = append(kept, item)
+			}
+			box.items = kept
+			if len(box.items) == 0 {
+				delete(s.mailboxes, id)
+				log.Printf("Usunięto pustą skrzynkę: %s…", id[:8])
+			}
+		}
+		s.mu.Unlock()
+	}
+}
@@ -0,0 +1,92 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/mux"
+)
+
+func depositRouter(s *MailboxStore) *mux.Router {
+	router := mux.NewRouter()
+	router.HandleFunc("/api/mailbox/{mailboxID}", s.handleDeposit).Methods("POST")
+	return router
+}
+
+func deposit(t *testing.T, router http.Handler, box byte, ip, body string) int {
+	t.Helper()
+	id := strings.Repeat(string("0123456789abcdef"[box%16]), 64)
+	req := httptest.NewRequest("POST", "/api/mailbox/"+id, strings.NewReader(body))
+	req.RemoteAddr = ip + ":40000"
+	rec := httptest.NewRecorder()
+	router.ServeHTTP(rec, req)
+	return rec.Code
+}
+
+func TestDepositLimits(t *testing.T) {
+	// "aGVsbG8=" to 5 bajtów
+	const envelope = `{"data": "aGVsbG8="}`
+
+	tests := []struct {
+		name     string
+		maxBoxes int
+		maxBytes int
+		burst    int
+		// skrzynka i adres kolejnych kopert
+		boxes []byte
+		ips   []string
+		want  []int
+	}{
+		{
+			name: "limit skrzynek", maxBoxes: 2, maxBytes: 1 << 20, burst: 10,
+			boxes: []byte{1, 2, 3, 1},
+			ips:   []string{"10.0.0.1", "10.0.0.2", "10.0.0.3", "10.0.0.4"},
+			want:  []int{http.StatusOK, http.StatusOK, http.StatusInsufficientStorage, http.StatusOK},
+		},
+		{
+			name: "limit bajtów", maxBoxes: 10, maxBytes: 12, burst: 10,
+			boxes: []byte{1, 2, 3},
+			ips:   []string{"10.0.0.1", "10.0.0.2", "10.0.0.3"},
+			want:  []int{http.StatusOK, http.StatusOK, http.StatusInsufficientStorage},
+		},
+		{
+			name: "limit adresu", maxBoxes: 10, maxBytes: 1 << 20, burst: 2,
+			boxes: []byte{1, 2, 3, 4},
+			ips:   []string{"10.0.0.1", "10.0.0.1", "10.0.0.1", "10.0.0.2"},
+			want:  []int{http.StatusOK, http.StatusOK, http.StatusTooManyRequests, http.StatusOK},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			store := newMailboxStore(tt.maxBoxes, tt.maxBytes, newIPLimiter(time.Hour, tt.burst))
+			router := depositRouter(store)
+			for i, want := range tt.want {
+				if got := deposit(t, router, tt.boxes[i], tt.ips[i], envelope); got != want {
+					t.Errorf("koperta %d: %d, oczekiwano %d", i, got, want)
+				}
+			}
+		})
+	}
+}
+
+func TestIPLimiterRefills(t *testing.T) {
+	l := newIPLimiter(time.Second, 1)
+	now := time.Now()
+	if ok, _ := l.allow("10.0.0.1", now); !ok {
+		t.Fatal("pierwsze żądanie odrzucone")
+	}
+	ok, wait := l.allow("10.0.0.1", now)
+	if ok || wait <= 0 || wait > time.Second {
+		t.Fatalf("drugie żądanie: ok=%v wait=%s", ok, wait)
+	}
+	if ok, _ := l.allow("10.0.0.1", now.Add(time.Second)); !ok {
+		t.Fatal("odrzucone po napełnieniu wiadra")
+	}
+	l.prune(now.Add(time.Hour))
+	if len(l.buckets) != 0 {
+		t.Fatalf("po prune zostało %d wiader", len(l.buckets))
+	}
+}
@@ -0,0 +1,75 @@
+package main
+
+import (
+	"net"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// ipLimiter to wiadro żetonów dla każdego adresu IP: burst żądań od razu,
+// potem jedno co interval
+type ipLimiter struct {
+	mu       sync.Mutex
+	buckets  map[string]*tokenBucket
+	interval time.Duration
+	burst    float64
+}
+
+type tokenBucket struct {
+	tokens float64
+	last   time.Time
+}
+
+func newIPLimiter(interval time.Duration, burst int) *ipLimiter {
+	return &ipLimiter{
+		buckets:  make(map[string]*tokenBucket),
+		interval: interval,
+		burst:    float64(burst),
+	}
+}
+
+// allow zużywa żeton adresu ip; gdy go nie ma, zwraca false i czas do
+// następnego
+func (l *ipLimiter) allow(ip string, now time.Time) (bool, time.Duration) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	b, ok := l.buckets[ip]
+	if !ok {
+		b = &tokenBucket{tokens: l.burst, last: now}
+		l.buckets[ip] = b
+	}
+	b.tokens += float64(now.Sub(b.last)) / float64(l.interval)
+	if b.tokens > l.burst {
+		b.tokens = l.burst
+	}
+	b.last = now
+	if b.tokens < 1 {
+		return false, time.Duration((1 - b.tokens) * float64(l.interval))
+	}
+	b.tokens--
+	return true, 0
+}
+
+// prune zapomina adresy, których wiadra zdążyły się napełnić
+func (l *ipLimiter) prune(now time.Time) {
+	full := time.Duration(l.burst * float64(l.interval))
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	for ip, b := range l.buckets {
+		if now.Sub(b.last) >= full {
+			delete(l.buckets, ip)
+		}
+	}
+}
+
+// clientIP to adres, z którego przyszło żądanie. Nagłówkom typu
+// X-Forwarded-For nie ufamy - każdy może je ustawić.
+func clientIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
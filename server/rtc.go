@@ -0,0 +1,305 @@
+package main
+
+import (
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/json"
+	"io"
+	"net/http"
+	"regexp"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/gorilla/mux"
+)
+
+// Wymiana SDP dla transportu WebRTC. Gość zostawia ofertę pod ID pokoju,
+// gospodarz zabiera oferty swojego pokoju i zostawia odpowiedzi, gość
+// odbiera odpowiedź na swoją sesję. Serwer nie zagląda do SDP: klucze
+// i tak uzgadnia QUIC wewnątrz kanału danych, więc podmienione SDP kończy
+// się nieudanym uzgadnianiem TLS i klucza dostępu, nie podsłuchem.
+//
+// Oferty pokoju odbiera ten, kto pierwszy się po nie zgłosi, z tokenem
+// z nagłówka X-RTC-Host-Token; póki pokój żyje, oferty i odpowiedzi
+// wymagają tego samego tokenu.
+
+const (
+	rtcMaxSDP     = 16 << 10        // największy opis sesji
+	rtcMaxOffers  = 16              // ofert czekających w jednym pokoju
+	rtcMaxRooms   = 10000           // pokoi na całym serwerze
+	rtcTTL        = time.Minute     // po tym czasie oferta lub odpowiedź znika
+	rtcHostTTL    = 5 * time.Minute // po tylu minutach bez odbioru ofert pokój traci gospodarza
+	rtcHostHdr    = "X-RTC-Host-Token"
+	offerInterval = 2 * time.Second // jedna oferta co dwie sekundy z adresu IP...
+	offerBurst    = 10              // ...po serii do tylu ofert
+)
+
+var (
+	rtcRoomPattern    = regexp.MustCompile(`^[A-Za-z0-9_-]{1,64}$`)
+	rtcSessionPattern = regexp.MustCompile(`^[0-9a-f]{32}$`)
+)
+
+// RTCOffer to oferta gościa czekająca na gospodarza; odpowiedź ma tylko SDP
+type RTCOffer struct {
+	Session string `json:"session"`
+	SDP     string `json:"sdp"`
+}
+
+type rtcEntry struct {
+	sdp     string
+	created time.Time
+}
+
+type rtcRoom struct {
+	host     [32]byte // SHA-256 tokenu gospodarza, zero przed pierwszym odbiorem
+	hostSeen time.Time
+	offers   map[string]rtcEntry
+	answers  map[string]rtcEntry
+}
+
+// RTCStore trzyma oferty i odpowiedzi w pamięci
+type RTCStore struct {
+	mu       sync.Mutex
+	rooms    map[string]*rtcRoom
+	maxRooms int
+	offers   *ipLimiter
+}
+
+func NewRTCStore() *RTCStore {
+	store := newRTCStore(rtcMaxRooms, newIPLimiter(offerInterval, offerBurst))
+	go store.cleanupExpired()
+	return store
+}
+
+func newRTCStore(maxRooms int, offers *ipLimiter) *RTCStore {
+	return &RTCStore{
+		rooms:    make(map[string]*rtcRoom),
+		maxRooms: maxRooms,
+		offers:   offers,
+	}
+}
+
+// Obsługuje ofertę gościa
+func (s *RTCStore) handleOffer(w http.ResponseWriter, r *http.Request) {
+	roomID := mux.Vars(r)["roomID"]
+	if !rtcRoomPattern.MatchString(roomID) {
+		http.Error(w, "Nieprawidłowy identyfikator pokoju", http.StatusBadRequest)
+		return
+	}
+	if ok, wait := s.offers.allow(clientIP(r), time.Now()); !ok {
+		w.Header().Set("Retry-After", strconv.Itoa(int(wait/time.Second)+1))
+		http.Error(w, "Za dużo ofert z tego adresu, spróbuj później", http.StatusTooManyRequests)
+		return
+	}
+	offer, ok := decodeSDP(w, r)
+	if !ok {
+		return
+	}
+	if !rtcSessionPattern.MatchString(offer.Session) {
+		http.Error(w, "Nieprawidłowy identyfikator sesji", http.StatusBadRequest)
+		return
+	}
+
+	s.mu.Lock()
+	room, exists := s.rooms[roomID]
+	if !exists && len(s.rooms) >= s.maxRooms {
+		s.mu.Unlock()
+		http.Error(w, "Serwer nie przyjmuje nowych pokoi", http.StatusInsufficientStorage)
+		return
+	}
+	if exists && len(room.offers) >= rtcMaxOffers {
+		s.mu.Unlock()
+		http.Error(w, "Za dużo ofert czeka na gospodarza", http.StatusInsufficientStorage)
+		return
+	}
+	if !exists {
+		room = newRTCRoom()
+		s.rooms[roomID] = room
+	}
+	room.offers[offer.Session] = rtcEntry{sdp: offer.SDP, created: time.Now()}
+	s.mu.Unlock()
+
+	w.WriteHeader(http.StatusOK)
+	w.Write([]byte(`{"status": "ok"}`))
+}
+
+// Obsługuje odbiór ofert przez gospodarza - odebrane oferty są usuwane
+func (s *RTCStore) handleOffers(w http.ResponseWriter, r *http.Request) {
+	roomID := mux.Vars(r)["roomID"]
+	if !rtcRoomPattern.MatchString(roomID) {
+		http.Error(w, "Nieprawidłowy identyfikator pokoju", http.StatusBadRequest)
+		return
+	}
+	token := r.Header.Get(rtcHostHdr)
+	if len(token) < 32 {
+		http.Error(w, "Brak tokenu gospodarza", http.StatusUnauthorized)
+		return
+	}
+
+	s.mu.Lock()
+	room, ok := s.rooms[roomID]
+	if !ok {
+		if len(s.rooms) >= s.maxRooms {
+			s.mu.Unlock()
+			http.Error(w, "Serwer nie przyjmuje nowych pokoi", http.StatusInsufficientStorage)
+			return
+		}
+		room = newRTCRoom()
+		s.rooms[roomID] = room
+	}
+	if !room.claim(token, time.Now()) {
+		s.mu.Unlock()
+		http.Error(w, "Pokój ma już innego gospodarza", http.StatusForbidden)
+		return
+	}
+	offers := make([]RTCOffer, 0, len(room.offers))
+	for session, offer := range room.offers {
+		offers = append(offers, RTCOffer{Session: session, SDP: offer.sdp})
+	}
+	room.offers = make(map[string]rtcEntry)
+	s.mu.Unlock()
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(offers)
+}
+
+// Obsługuje odpowiedź gospodarza na ofertę
+func (s *RTCStore) handleAnswer(w http.ResponseWriter, r *http.Request) {
+	roomID, session, ok := rtcSession(w, r)
+	if !ok {
+		return
+	}
+	answer, ok := decodeSDP(w, r)
+	if !ok {
+		return
+	}
+
+	s.mu.Lock()
+	room, exists := s.rooms[roomID]
+	if !exists || !room.claim(r.Header.Get(rtcHostHdr), time.Now()) {
+		s.mu.Unlock()
+		http.Error(w, "Tylko gospodarz pokoju może odpowiadać", http.StatusForbidden)
+		return
+	}
+	if len(room.answers) >= rtcMaxOffers {
+		s.mu.Unlock()
+		http.Error(w, "Za dużo odpowiedzi czeka na gości", http.StatusInsufficientStorage)
+		return
+	}
+	room.answers[session] = rtcEntry{sdp: answer.SDP, created: time.Now()}
+	s.mu.Unlock()
+
+	w.WriteHeader(http.StatusOK)
+	w.Write([]byte(`{"status": "ok"}`))
+}
+
+// Obsługuje odbiór odpowiedzi przez gościa; 204, póki jej nie ma
+func (s *RTCStore) handleFetchAnswer(w http.ResponseWriter, r *http.Request) {
+	roomID, session, ok := rtcSession(w, r)
+	if !ok {
+		return
+	}
+	s.mu.Lock()
+	var answer rtcEntry
+	if room, ok := s.rooms[roomID]; ok {
+		if answer, ok = room.answers[session]; ok {
+			delete(room.answers, session)
+		}
+	}
+	s.mu.Unlock()
+
+	if answer.sdp == "" {
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]string{"sdp": answer.sdp})
+}
+
+func newRTCRoom() *rtcRoom {
+	return &rtcRoom{
+		offers:  make(map[string]rtcEntry),
+		answers: make(map[string]rtcEntry),
+	}
+}
+
+// claim sprawdza token gospodarza; pokój bez gospodarza przyjmuje każdy
+func (room *rtcRoom) claim(token string, now time.Time) bool {
+	if len(token) < 32 {
+		return false
+	}
+	sum := sha256.Sum256([]byte(token))
+	if room.host != [32]byte{} && subtle.ConstantTimeCompare(room.host[:], sum[:]) != 1 {
+		return false
+	}
+	room.host = sum
+	room.hostSeen = now
+	return true
+}
+
+// rtcSession odczytuje pokój i sesję z adresu żądania
+func rtcSession(w http.ResponseWriter, r *http.Request) (string, string, bool) {
+	vars := mux.Vars(r)
+	if !rtcRoomPattern.MatchString(vars["roomID"]) {
+		http.Error(w, "Nieprawidłowy identyfikator pokoju", http.StatusBadRequest)
+		return "", "", false
+	}
+	if !rtcSessionPattern.MatchString(vars["session"]) {
+		http.Error(w, "Nieprawidłowy identyfikator sesji", http.StatusBadRequest)
+		return "", "", false
+	}
+	return vars["roomID"], vars["session"], true
+}
+
+// decodeSDP czyta JSON z opisem sesji nie większym niż rtcMaxSDP
+func decodeSDP(w http.ResponseWriter, r *http.Request) (RTCOffer, bool) {
+	var msg RTCOffer
+	if err := json.NewDecoder(io.LimitReader(r.Body, 2*rtcMaxSDP)).Decode(&msg); err != nil {
+		http.Error(w, "Nieprawidłowy format JSON", http.StatusBadRequest)
+		return msg, false
+	}
+	if msg.SDP == "" {
+		http.Error(w, "Brak opisu sesji", http.StatusBadRequest)
+		return msg, false
+	}
+	if len(msg.SDP) > rtcMaxSDP {
+		http.Error(w, "Opis sesji jest za duży", http.StatusRequestEntityTooLarge)
+		return msg, false
+	}
+	return msg, true
+}
+
+// Usuwa przeterminowane oferty i odpowiedzi oraz pokoje bez gospodarza
+func (s *RTCStore) cleanupExpired() {
+	ticker := time.NewTicker(rtcTTL)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		s.expire(time.Now())
+	}
+}
+
+func (s *RTCStore) expire(now time.Time) {
+	s.offers.prune(now)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for id, room := range s.rooms {
+		for session, e := range room.offers {
+			if now.Sub(e.created) > rtcTTL {
+				delete(room.offers, session)
+			}
+		}
+		for session, e := range room.answers {
+			if now.Sub(e.created) > rtcTTL {
+				delete(room.answers, session)
+			}
+		}
+		if room.host != [32]byte{} && now.Sub(room.hostSeen) > rtcHostTTL {
+			room.host = [32]byte{}
+		}
+		if room.host == [32]byte{} && len(room.offers) == 0 && len(room.answers) == 0 {
+			delete(s.rooms, id)
+		}
+	}
+}
@@ -0,0 +1,119 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/mux"
+)
+
+const (
+	rtcRoom1     = "ExecP2P_abcdefghijklmnopqrstuvwx"
+	hostToken    = "00112233445566778899aabbccddeeff"
+	otherToken   = "ffeeddccbbaa99887766554433221100"
+	guestSession = "0123456789abcdef0123456789abcdef"
+)
+
+func rtcRouter(s *RTCStore) *mux.Router {
+	router := mux.NewRouter()
+	router.HandleFunc("/api/rtc/{roomID}/offer", s.handleOffer).Methods("POST")
+	router.HandleFunc("/api/rtc/{roomID}/offers", s.handleOffers).Methods("GET")
+	router.HandleFunc("/api/rtc/{roomID}/answer/{session}", s.handleAnswer).Methods("POST")
+	router.HandleFunc("/api/rtc/{roomID}/answer/{session}", s.handleFetchAnswer).Methods("GET")
+	return router
+}
+
+func rtcRequest(t *testing.T, router http.Handler, method, path, token, body string) *httptest.ResponseRecorder {
+	t.Helper()
+	req := httptest.NewRequest(method, path, strings.NewReader(body))
+	req.RemoteAddr = "10.0.0.1:40000"
+	if token != "" {
+		req.Header.Set(rtcHostHdr, token)
+	}
+	rec := httptest.NewRecorder()
+	router.ServeHTTP(rec, req)
+	return rec
+}
+
+func TestRTCExchange(t *testing.T) {
+	router := rtcRouter(newRTCStore(10, newIPLimiter(time.Hour, 10)))
+	offers := "/api/rtc/" + rtcRoom1 + "/offers"
+	answer := "/api/rtc/" + rtcRoom1 + "/answer/" + guestSession
+
+	offer := fmt.Sprintf(`{"session": %q, "sdp": "v=0 oferta"}`, guestSession)
+	if rec := rtcRequest(t, router, "POST", "/api/rtc/"+rtcRoom1+"/offer", "", offer); rec.Code != http.StatusOK {
+		t.Fatalf("oferta: %d", rec.Code)
+	}
+	if rec := rtcRequest(t, router, "GET", answer, "", ""); rec.Code != http.StatusNoContent {
+		t.Fatalf("odpowiedź przed czasem: %d", rec.Code)
+	}
+
+	rec := rtcRequest(t, router, "GET", offers, hostToken, "")
+	var got []RTCOffer
+	if rec.Code != http.StatusOK || json.Unmarshal(rec.Body.Bytes(), &got) != nil {
+		t.Fatalf("odbiór ofert: %d %s", rec.Code, rec.Body)
+	}
+	if len(got) != 1 || got[0].Session != guestSession || got[0].SDP != "v=0 oferta" {
+		t.Fatalf("oferty: %+v", got)
+	}
+	if rec := rtcRequest(t, router, "GET", offers, hostToken, ""); rec.Body.String() != "[]\n" {
+		t.Fatalf("oferty po odbiorze: %s", rec.Body)
+	}
+
+	// pokój ma już gospodarza
+	if rec := rtcRequest(t, router, "GET", offers, otherToken, ""); rec.Code != http.StatusForbidden {
+		t.Fatalf("oferty dla innego tokenu: %d", rec.Code)
+	}
+	if rec := rtcRequest(t, router, "POST", answer, otherToken, `{"sdp": "v=0 podróbka"}`); rec.Code != http.StatusForbidden {
+		t.Fatalf("odpowiedź z innym tokenem: %d", rec.Code)
+	}
+
+	if rec := rtcRequest(t, router, "POST", answer, hostToken, `{"sdp": "v=0 odpowiedź"}`); rec.Code != http.StatusOK {
+		t.Fatalf("odpowiedź: %d", rec.Code)
+	}
+	rec = rtcRequest(t, router, "GET", answer, "", "")
+	var reply RTCOffer
+	if rec.Code != http.StatusOK || json.Unmarshal(rec.Body.Bytes(), &reply) != nil || reply.SDP != "v=0 odpowiedź" {
+		t.Fatalf("odbiór odpowiedzi: %d %s", rec.Code, rec.Body)
+	}
+	if rec := rtcRequest(t, router, "GET", answer, "", ""); rec.Code != http.StatusNoContent {
+		t.Fatalf("odpowiedź odebrana drugi raz: %d", rec.Code)
+	}
+}
+
+func TestRTCLimits(t *testing.T) {
+	store := newRTCStore(1, newIPLimiter(time.Hour, 100))
+	router := rtcRouter(store)
+	offer := func(room string, i int) int {
+		body := fmt.Sprintf(`{"session": "%032x", "sdp": "v=0"}`, i)
+		return rtcRequest(t, router, "POST", "/api/rtc/"+room+"/offer", "", body).Code
+	}
+
+	for i := 0; i < rtcMaxOffers; i++ {
+		if code := offer(rtcRoom1, i); code != http.StatusOK {
+			t.Fatalf("oferta %d: %d", i, code)
+		}
+	}
+	if code := offer(rtcRoom1, rtcMaxOffers); code != http.StatusInsufficientStorage {
+		t.Fatalf("oferta ponad limit pokoju: %d", code)
+	}
+	if code := offer("ExecP2P_inny", 0); code != http.StatusInsufficientStorage {
+		t.Fatalf("pokój ponad limit serwera: %d", code)
+	}
+
+	big := fmt.Sprintf(`{"session": %q, "sdp": %q}`, guestSession, strings.Repeat("a", rtcMaxSDP+1))
+	if rec := rtcRequest(t, router, "POST", "/api/rtc/"+rtcRoom1+"/offer", "", big); rec.Code != http.StatusRequestEntityTooLarge {
+		t.Fatalf("za duże SDP: %d", rec.Code)
+	}
+
+	// oferty wygasają, a pusty pokój bez gospodarza znika
+	store.expire(time.Now().Add(2 * rtcTTL))
+	if len(store.rooms) != 0 {
+		t.Fatalf("po wygaśnięciu zostało %d pokoi", len(store.rooms))
+	}
+}
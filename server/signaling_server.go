@@ -206,12 +206,31 @@ func main() {
 	router.HandleFunc("/api/room/{roomID}", server.handleGetRoom).Methods("GET")
 	router.HandleFunc("/api/rooms", server.handleListRooms).Methods("GET")
 
+	// Skrzynki na zaszyfrowane wiadomości dla użytkowników offline
+	mailboxes := NewMailboxStore()
+	router.HandleFunc("/api/mailbox/{mailboxID}", mailboxes.handleDeposit).Methods("POST")
+	router.HandleFunc("/api/mailbox/{mailboxID}", mailboxes.handleFetch).Methods("GET")
+	router.HandleFunc("/api/mailbox/{mailboxID}/ack", mailboxes.handleAck).Methods("POST")
+
+	// Wizytówki do pierwszego kontaktu z kimś, kto jest offline
+	contacts := NewContactStore()
+	router.HandleFunc("/api/contact/{userID}", contacts.handlePublish).Methods("PUT")
+	router.HandleFunc("/api/contact/{userID}", contacts.handleLookup).Methods("GET")
+	router.HandleFunc("/api/contact/{userID}", contacts.handleDelete).Methods("DELETE")
+
+	// Wymiana SDP dla transportu WebRTC
+	rtc := NewRTCStore()
+	router.HandleFunc("/api/rtc/{roomID}/offer", rtc.handleOffer).Methods("POST")
+	router.HandleFunc("/api/rtc/{roomID}/offers", rtc.handleOffers).Methods("GET")
+	router.HandleFunc("/api/rtc/{roomID}/answer/{session}", rtc.handleAnswer).Methods("POST")
+	router.HandleFunc("/api/rtc/{roomID}/answer/{session}", rtc.handleFetchAnswer).Methods("GET")
+
 	// Obsługa CORS dla development
 	router.Use(func(next http.Handler) http.Handler {
 		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 			w.Header().Set("Access-Control-Allow-Origin", "*")
-			w.Header().Set("Access-Control-Allow-Methods", "GET, POST, OPTIONS")
-			w.Header().Set("Access-Control-Allow-Headers", "Content-Type")
+			w.Header().Set("Access-Control-Allow-Methods", "GET, POST, PUT, DELETE, OPTIONS")
+			w.Header().Set("Access-Control-Allow-Headers", "Content-Type, X-Mailbox-Secret, X-RTC-Host-Token")
 			if r.Method == "OPTIONS" {
 				w.WriteHeader(http.StatusOK)
 				return